@@ -49,6 +49,7 @@ type ConsumeRequest struct {
 	Consumer  string `json:"consumer"`
 	Count     int64  `json:"count"`
 	BlockTime int    `json:"block_time"`
+	ClaimIdle int    `json:"claim_idle,omitempty"` // milliseconds, redeliver messages pending this long first
 }
 
 // ConsumeResponse represents a response from consuming messages
@@ -242,14 +243,26 @@ func (c *Client) Acknowledge(ctx context.Context, messageID, topic, consumer str
 
 // NegativeAcknowledge negatively acknowledges a message
 func (c *Client) NegativeAcknowledge(ctx context.Context, messageID, topic, consumer string, retry bool) (*MessageResponse, error) {
-	url := fmt.Sprintf("%s/api/v1/messages/%s/nack", c.baseURL, messageID)
-	
-	req := map[string]interface{}{
+	return c.negativeAcknowledge(ctx, messageID, map[string]interface{}{
 		"topic":    topic,
 		"consumer": consumer,
 		"retry":    retry,
-	}
-	
+	})
+}
+
+// DeadLetter moves a message to the dead letter queue of its topic, noting
+// why it failed
+func (c *Client) DeadLetter(ctx context.Context, messageID, topic, consumer, reason string) (*MessageResponse, error) {
+	return c.negativeAcknowledge(ctx, messageID, map[string]interface{}{
+		"topic":    topic,
+		"consumer": consumer,
+		"reason":   reason,
+	})
+}
+
+func (c *Client) negativeAcknowledge(ctx context.Context, messageID string, req map[string]interface{}) (*MessageResponse, error) {
+	url := fmt.Sprintf("%s/api/v1/messages/%s/nack", c.baseURL, messageID)
+
 	jsonData, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -0,0 +1,3 @@
+module message-queue-service/client/go
+
+go 1.19
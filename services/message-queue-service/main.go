@@ -6,45 +6,24 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-)
-
-// Message represents a message in the queue
-type Message struct {
-	ID          string                 `json:"id"`
-	Topic       string                 `json:"topic"`
-	Payload     map[string]interface{} `json:"payload"`
-	Priority    int                    `json:"priority"`    // 1-10, higher is more priority
-	RetryCount  int                    `json:"retry_count"`
-	MaxRetries  int                    `json:"max_retries"`
-	CreatedAt   time.Time              `json:"created_at"`
-	ScheduledAt *time.Time             `json:"scheduled_at,omitempty"`
-	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
-}
 
-// MessageRequest represents a request to publish a message
-type MessageRequest struct {
-	Topic       string                 `json:"topic" binding:"required"`
-	Payload     map[string]interface{} `json:"payload" binding:"required"`
-	Priority    int                    `json:"priority"`
-	MaxRetries  int                    `json:"max_retries"`
-	ScheduledAt *time.Time             `json:"scheduled_at,omitempty"`
-	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
-}
-
-// MessageResponse represents a response for message operations
-type MessageResponse struct {
-	ID        string    `json:"id"`
-	Status    string    `json:"status"`
-	Message   string    `json:"message"`
-	Timestamp time.Time `json:"timestamp"`
-}
+	"claude-talimat/pkg/envelope"
+	"claude-talimat/pkg/events"
+	"claude-talimat/pkg/health"
+	"claude-talimat/pkg/ids"
+	"claude-talimat/pkg/logging"
+	"claude-talimat/pkg/middleware"
+	"claude-talimat/pkg/redisclient"
+	"claude-talimat/pkg/runtimeconfig"
+	"claude-talimat/pkg/types"
+	"claude-talimat/pkg/validation"
+)
 
 // QueueStats represents queue statistics
 type QueueStats struct {
@@ -56,49 +35,67 @@ type QueueStats struct {
 	Consumers       int    `json:"consumers"`
 }
 
-// HealthResponse represents health check response
-type HealthResponse struct {
-	Status    string `json:"status"`
-	Service   string `json:"service"`
-	Timestamp int64  `json:"timestamp"`
-	Version   string `json:"version"`
-	Uptime    string `json:"uptime"`
-	Redis     string `json:"redis_status"`
-}
+// Keys of the runtime configuration, the tunables operators change without
+// a redeploy. Pausing a topic is topics.<topic>.paused.
+const (
+	runtimeConsumeDefaultCount     = "consume.default_count"
+	runtimeConsumeMaxCount         = "consume.max_count"
+	runtimeConsumeDefaultBlockTime = "consume.default_block_time"
+	runtimePublishDefaultRetries   = "publish.default_max_retries"
+	runtimeStrictValidation        = "validation.strict"
+)
 
 var (
 	rdb     *redis.Client
+	runtimeConfig *runtimeconfig.Store
 	ctx     = context.Background()
 	startTime = time.Now()
 )
 
 func main() {
-	// Initialize Redis client
-	rdb = redis.NewClient(&redis.Options{
-		Addr:     "redis:6379",
-		Password: "",
-		DB:       1, // Use DB 1 for message queue
-	})
+	logging.Setup("message-queue-service", os.Getenv("LOG_LEVEL"))
 
-	// Test Redis connection
-	_, err := rdb.Ping(ctx).Result()
+	// Initialize Redis client, DB 1 is the message queue's
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "redis://redis:6379/1"
+	}
+
+	var err error
+	rdb, err = redisclient.New(redisclient.Config{URL: redisURL})
 	if err != nil {
 		log.Fatal("Failed to connect to Redis:", err)
 	}
 
+	runtimeConfig, err = runtimeconfig.New(runtimeconfig.NewRedisSource(rdb, "message-queue-service"), 0)
+	if err != nil {
+		log.Fatal("Failed to load runtime configuration:", err)
+	}
+
 	// Set Gin to release mode
 	gin.SetMode(gin.ReleaseMode)
 
 	// Create router
+	router := newRouter()
+
+	// Start server
+	log.Printf("Starting Message Queue Service on port 8008")
+	if err := router.Run(":8008"); err != nil {
+		log.Fatal("Failed to start server:", err)
+	}
+}
+
+// newRouter returns the router serving the API of the service
+func newRouter() *gin.Engine {
 	router := gin.New()
 
 	// Add middleware
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
-	router.Use(corsMiddleware())
+	router.Use(middleware.CORS())
 
 	// Health check endpoint
-	router.GET("/health", healthCheck)
+	router.GET("/health", health.Handler("message-queue-service", "1.0.0", rdb))
 
 	// Root endpoint
 	router.GET("/", func(c *gin.Context) {
@@ -114,121 +111,90 @@ func main() {
 				"nack":       "/api/v1/messages/:id/nack",
 				"stats":      "/api/v1/stats",
 				"topics":     "/api/v1/topics",
+				"runtime":    "/api/v1/runtime-config",
+				"events":     "/api/v1/events/schemas",
 			},
 		})
 	})
 
-	// API v1 routes
-	api := router.Group("/api/v1")
-	{
-		// Messages group
-		messages := api.Group("/messages")
-		{
-			// Publish message
-			messages.POST("/publish", publishMessage)
-			
-			// Publish bulk messages
-			messages.POST("/publish-bulk", publishBulkMessages)
-
-			// Consume messages
-			messages.POST("/consume", consumeMessages)
-
-			// Acknowledge message
-			messages.POST("/:id/ack", acknowledgeMessage)
-
-			// Negative acknowledge message
-			messages.POST("/:id/nack", negativeAcknowledgeMessage)
-
-			// Get message status
-			messages.GET("/:id/status", getMessageStatus)
-		}
+	// Unknown request fields are rejected while strict validation is enabled
+	strict := validation.Strict(func() bool {
+		return runtimeConfig.Bool(runtimeStrictValidation, false)
+	})
 
-		// Topics group
-		topics := api.Group("/topics")
-		{
-			// List topics
-			topics.GET("/", listTopics)
+	// API v1 routes, deprecated for version 2
+	registerRoutes(router.Group("/api/v1", envelope.Deprecated("/api/v2"), strict))
 
-			// Get topic stats
-			topics.GET("/:topic/stats", getTopicStats)
+	// API v2 routes, the same with every JSON response in one envelope
+	registerRoutes(router.Group("/api/v2", envelope.Middleware(), strict))
 
-			// Create topic
-			topics.POST("/", createTopic)
+	return router
+}
 
-			// Delete topic
-			topics.DELETE("/:topic", deleteTopic)
-		}
+// registerRoutes registers the routes of the API on the group of a version
+func registerRoutes(api *gin.RouterGroup) {
+	// Messages group
+	messages := api.Group("/messages")
+	{
+		// Publish message
+		messages.POST("/publish", publishMessage)
+		
+		// Publish bulk messages
+		messages.POST("/publish-bulk", publishBulkMessages)
 
-		// Statistics group
-		stats := api.Group("/stats")
-		{
-			// Get overall stats
-			stats.GET("/", getOverallStats)
+		// Consume messages
+		messages.POST("/consume", consumeMessages)
 
-			// Get consumer stats
-			stats.GET("/consumers", getConsumerStats)
-		}
-	}
+		// Acknowledge message
+		messages.POST("/:id/ack", acknowledgeMessage)
 
-	// Start server
-	log.Printf("Starting Message Queue Service on port 8008")
-	if err := router.Run(":8008"); err != nil {
-		log.Fatal("Failed to start server:", err)
+		// Negative acknowledge message
+		messages.POST("/:id/nack", negativeAcknowledgeMessage)
+
+		// Get message status
+		messages.GET("/:id/status", getMessageStatus)
 	}
-}
 
-// CORS middleware
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	// Topics group
+	topics := api.Group("/topics")
+	{
+		// List topics
+		topics.GET("/", listTopics)
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
+		// Get topic stats
+		topics.GET("/:topic/stats", getTopicStats)
 
-		c.Next()
-	}
-}
+		// Create topic
+		topics.POST("/", createTopic)
 
-// healthCheck returns the health status of the service
-func healthCheck(c *gin.Context) {
-	// Check Redis connection
-	redisStatus := "healthy"
-	_, err := rdb.Ping(ctx).Result()
-	if err != nil {
-		redisStatus = "unhealthy"
+		// Delete topic
+		topics.DELETE("/:topic", deleteTopic)
 	}
 
-	uptime := time.Since(startTime).String()
-	response := HealthResponse{
-		Status:    "healthy",
-		Service:   "message-queue-service",
-		Timestamp: time.Now().Unix(),
-		Version:   "1.0.0",
-		Uptime:    uptime,
-		Redis:     redisStatus,
-	}
+	// Statistics group
+	stats := api.Group("/stats")
+	{
+		// Get overall stats
+		stats.GET("/", getOverallStats)
 
-	statusCode := http.StatusOK
-	if redisStatus == "unhealthy" {
-		response.Status = "unhealthy"
-		statusCode = http.StatusServiceUnavailable
+		// Get consumer stats
+		stats.GET("/consumers", getConsumerStats)
 	}
 
-	c.JSON(statusCode, response)
+	// Runtime configuration
+	api.GET("/runtime-config", getRuntimeConfig)
+	api.PUT("/runtime-config", updateRuntimeConfig)
+
+	// Event catalogue
+	api.GET("/events/schemas", events.ListHandler())
+	api.GET("/events/schemas/:type", events.SchemaHandler())
 }
 
 // publishMessage publishes a single message to a topic
 func publishMessage(c *gin.Context) {
-	var request MessageRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
+	var request types.MessageRequest
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
@@ -237,12 +203,29 @@ func publishMessage(c *gin.Context) {
 		request.Priority = 5
 	}
 	if request.MaxRetries == 0 {
-		request.MaxRetries = 3
+		request.MaxRetries = runtimeConfig.Int(runtimePublishDefaultRetries, 3)
+	}
+
+	if topicPaused(request.Topic) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Topic is paused",
+			"message": fmt.Sprintf("publishing to %s is paused", request.Topic),
+		})
+		return
+	}
+
+	// Payloads of the topics in the event catalogue must match their schema
+	if err := events.ValidateMessage(request.Topic, request.Payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid payload",
+			"message": err.Error(),
+		})
+		return
 	}
 
 	// Create message
-	message := Message{
-		ID:         generateMessageID(),
+	message := types.Message{
+		ID:         ids.New("msg"),
 		Topic:      request.Topic,
 		Payload:    request.Payload,
 		Priority:   request.Priority,
@@ -265,7 +248,7 @@ func publishMessage(c *gin.Context) {
 	}
 
 	// Add to Redis Stream
-	streamKey := fmt.Sprintf("mq:topic:%s", request.Topic)
+	streamKey := types.StreamKey(request.Topic)
 	args := &redis.XAddArgs{
 		Stream: streamKey,
 		Values: map[string]interface{}{
@@ -286,7 +269,7 @@ func publishMessage(c *gin.Context) {
 	// Update topic stats
 	updateTopicStats(request.Topic, "published")
 
-	response := MessageResponse{
+	response := types.MessageResponse{
 		ID:        message.ID,
 		Status:    "published",
 		Message:   "Message published successfully",
@@ -300,18 +283,15 @@ func publishMessage(c *gin.Context) {
 // publishBulkMessages publishes multiple messages
 func publishBulkMessages(c *gin.Context) {
 	var request struct {
-		Messages []MessageRequest `json:"messages" binding:"required"`
+		Messages []types.MessageRequest `json:"messages" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
-	var responses []MessageResponse
+	var responses []types.MessageResponse
 	var failedMessages []string
 
 	for _, msgReq := range request.Messages {
@@ -320,12 +300,12 @@ func publishBulkMessages(c *gin.Context) {
 			msgReq.Priority = 5
 		}
 		if msgReq.MaxRetries == 0 {
-			msgReq.MaxRetries = 3
+			msgReq.MaxRetries = runtimeConfig.Int(runtimePublishDefaultRetries, 3)
 		}
 
 		// Create message
-		message := Message{
-			ID:         generateMessageID(),
+		message := types.Message{
+			ID:         ids.New("msg"),
 			Topic:      msgReq.Topic,
 			Payload:    msgReq.Payload,
 			Priority:   msgReq.Priority,
@@ -337,6 +317,16 @@ func publishBulkMessages(c *gin.Context) {
 			Metadata:   msgReq.Metadata,
 		}
 
+		if topicPaused(msgReq.Topic) {
+			failedMessages = append(failedMessages, message.ID)
+			continue
+		}
+
+		if err := events.ValidateMessage(msgReq.Topic, msgReq.Payload); err != nil {
+			failedMessages = append(failedMessages, message.ID)
+			continue
+		}
+
 		// Serialize message
 		messageData, err := json.Marshal(message)
 		if err != nil {
@@ -345,7 +335,7 @@ func publishBulkMessages(c *gin.Context) {
 		}
 
 		// Add to Redis Stream
-		streamKey := fmt.Sprintf("mq:topic:%s", msgReq.Topic)
+		streamKey := types.StreamKey(msgReq.Topic)
 		args := &redis.XAddArgs{
 			Stream: streamKey,
 			Values: map[string]interface{}{
@@ -363,7 +353,7 @@ func publishBulkMessages(c *gin.Context) {
 		// Update topic stats
 		updateTopicStats(msgReq.Topic, "published")
 
-		response := MessageResponse{
+		response := types.MessageResponse{
 			ID:        message.ID,
 			Status:    "published",
 			Message:   "Message published successfully",
@@ -386,30 +376,31 @@ func publishBulkMessages(c *gin.Context) {
 // consumeMessages consumes messages from a topic
 func consumeMessages(c *gin.Context) {
 	var request struct {
-		Topic     string `json:"topic" binding:"required"`
+		Topic     string `json:"topic" binding:"required,topic"`
 		Consumer  string `json:"consumer" binding:"required"`
 		Count     int64  `json:"count"`
 		BlockTime int    `json:"block_time"` // milliseconds
+		ClaimIdle int    `json:"claim_idle"` // milliseconds, redeliver messages pending this long
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
 	// Set defaults
 	if request.Count == 0 {
-		request.Count = 1
+		request.Count = int64(runtimeConfig.Int(runtimeConsumeDefaultCount, 1))
+	}
+	if maxCount := int64(runtimeConfig.Int(runtimeConsumeMaxCount, 0)); maxCount > 0 && request.Count > maxCount {
+		request.Count = maxCount
 	}
 	if request.BlockTime == 0 {
-		request.BlockTime = 1000 // 1 second
+		request.BlockTime = int(runtimeConfig.Duration(runtimeConsumeDefaultBlockTime, time.Second) / time.Millisecond)
 	}
 
-	streamKey := fmt.Sprintf("mq:topic:%s", request.Topic)
-	consumerGroup := fmt.Sprintf("mq:group:%s", request.Topic)
+	streamKey := types.StreamKey(request.Topic)
+	consumerGroup := types.GroupKey(request.Topic)
 	consumerName := request.Consumer
 
 	// Create consumer group if it doesn't exist
@@ -422,6 +413,30 @@ func consumeMessages(c *gin.Context) {
 		return
 	}
 
+	// Messages left pending, failed ones and the ones of consumers that
+	// died, are redelivered before new ones
+	if request.ClaimIdle > 0 {
+		claimed, err := claimMessages(streamKey, consumerGroup, consumerName, time.Duration(request.ClaimIdle)*time.Millisecond, request.Count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to claim pending messages",
+				"message": err.Error(),
+			})
+			return
+		}
+		if len(claimed) > 0 {
+			updateTopicStats(request.Topic, "consumed")
+
+			c.JSON(http.StatusOK, gin.H{
+				"success":  true,
+				"messages": claimed,
+				"count":    len(claimed),
+				"message":  "Pending messages claimed successfully",
+			})
+			return
+		}
+	}
+
 	// Read messages
 	args := &redis.XReadGroupArgs{
 		Group:    consumerGroup,
@@ -436,7 +451,7 @@ func consumeMessages(c *gin.Context) {
 		if err == redis.Nil {
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
-				"messages": []Message{},
+				"messages": []types.Message{},
 				"count":   0,
 				"message": "No messages available",
 			})
@@ -449,10 +464,10 @@ func consumeMessages(c *gin.Context) {
 		return
 	}
 
-	var messages []Message
+	var messages []types.Message
 	for _, stream := range streams {
 		for _, message := range stream.Messages {
-			var msg Message
+			var msg types.Message
 			if err := json.Unmarshal([]byte(message.Values["message"].(string)), &msg); err != nil {
 				continue
 			}
@@ -472,6 +487,59 @@ func consumeMessages(c *gin.Context) {
 	})
 }
 
+// claimMessages claims the messages pending in a consumer group for at least
+// minIdle, with the number of times each was delivered before as its retry count
+func claimMessages(streamKey, consumerGroup, consumerName string, minIdle time.Duration, count int64) ([]types.Message, error) {
+	claimed, _, err := rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   streamKey,
+		Group:    consumerGroup,
+		Consumer: consumerName,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   streamKey,
+		Group:    consumerGroup,
+		Start:    claimed[0].ID,
+		End:      claimed[len(claimed)-1].ID,
+		Count:    int64(len(claimed)),
+		Consumer: consumerName,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make(map[string]int64, len(pending))
+	for _, entry := range pending {
+		deliveries[entry.ID] = entry.RetryCount
+	}
+
+	messages := make([]types.Message, 0, len(claimed))
+	for _, message := range claimed {
+		raw, _ := message.Values["message"].(string)
+
+		var msg types.Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			continue
+		}
+		msg.ID = message.ID
+		// Claiming counts as a delivery, the first one is not a retry
+		if delivered := deliveries[message.ID]; delivered > 1 {
+			msg.RetryCount = int(delivered - 1)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
 // acknowledgeMessage acknowledges a message
 func acknowledgeMessage(c *gin.Context) {
 	messageID := c.Param("id")
@@ -484,20 +552,17 @@ func acknowledgeMessage(c *gin.Context) {
 	}
 
 	var request struct {
-		Topic    string `json:"topic" binding:"required"`
+		Topic    string `json:"topic" binding:"required,topic"`
 		Consumer string `json:"consumer" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
-	streamKey := fmt.Sprintf("mq:topic:%s", request.Topic)
-	consumerGroup := fmt.Sprintf("mq:group:%s", request.Topic)
+	streamKey := types.StreamKey(request.Topic)
+	consumerGroup := types.GroupKey(request.Topic)
 
 	// Acknowledge message
 	ackCount, err := rdb.XAck(ctx, streamKey, consumerGroup, messageID).Result()
@@ -512,7 +577,7 @@ func acknowledgeMessage(c *gin.Context) {
 	// Update topic stats
 	updateTopicStats(request.Topic, "acknowledged")
 
-	response := MessageResponse{
+	response := types.MessageResponse{
 		ID:        messageID,
 		Status:    "acknowledged",
 		Message:   "Message acknowledged successfully",
@@ -535,21 +600,19 @@ func negativeAcknowledgeMessage(c *gin.Context) {
 	}
 
 	var request struct {
-		Topic    string `json:"topic" binding:"required"`
+		Topic    string `json:"topic" binding:"required,topic"`
 		Consumer string `json:"consumer" binding:"required"`
 		Retry    bool   `json:"retry"`
+		Reason   string `json:"reason"` // why the message is dead-lettered
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
-	streamKey := fmt.Sprintf("mq:topic:%s", request.Topic)
-	consumerGroup := fmt.Sprintf("mq:group:%s", request.Topic)
+	streamKey := types.StreamKey(request.Topic)
+	consumerGroup := types.GroupKey(request.Topic)
 
 	if request.Retry {
 		// Claim message for retry
@@ -578,6 +641,20 @@ func negativeAcknowledgeMessage(c *gin.Context) {
 			return
 		}
 	} else {
+		reason := request.Reason
+		if reason == "" {
+			reason = "negative_acknowledgment"
+		}
+		values := map[string]interface{}{
+			"original_id": messageID,
+			"failed_at":   time.Now().Unix(),
+			"reason":      reason,
+		}
+		// The dead letter queue keeps the message, so it can be inspected and published again
+		if entries, err := rdb.XRange(ctx, streamKey, messageID, messageID).Result(); err == nil && len(entries) > 0 {
+			values["message"] = entries[0].Values["message"]
+		}
+
 		// Acknowledge and move to dead letter queue
 		_, err := rdb.XAck(ctx, streamKey, consumerGroup, messageID).Result()
 		if err != nil {
@@ -589,21 +666,17 @@ func negativeAcknowledgeMessage(c *gin.Context) {
 		}
 
 		// Move to dead letter queue
-		deadLetterKey := fmt.Sprintf("mq:dlq:%s", request.Topic)
+		deadLetterKey := types.DeadLetterKey(request.Topic)
 		rdb.XAdd(ctx, &redis.XAddArgs{
 			Stream: deadLetterKey,
-			Values: map[string]interface{}{
-				"original_id": messageID,
-				"failed_at":   time.Now().Unix(),
-				"reason":      "negative_acknowledgment",
-			},
+			Values: values,
 		})
 	}
 
 	// Update topic stats
 	updateTopicStats(request.Topic, "failed")
 
-	response := MessageResponse{
+	response := types.MessageResponse{
 		ID:        messageID,
 		Status:    "nack",
 		Message:   "Message negatively acknowledged",
@@ -627,7 +700,7 @@ func getMessageStatus(c *gin.Context) {
 
 	// This is a simplified implementation
 	// In a real system, you would track message status in a separate data structure
-	response := MessageResponse{
+	response := types.MessageResponse{
 		ID:        messageID,
 		Status:    "unknown",
 		Message:   "Message status retrieved",
@@ -673,32 +746,51 @@ func getTopicStats(c *gin.Context) {
 		return
 	}
 
-	streamKey := fmt.Sprintf("mq:topic:%s", topic)
+	streamKey := types.StreamKey(topic)
 	
-	// Get stream info
-	info, err := rdb.XInfoStream(ctx, streamKey).Result()
-	if err != nil {
+	// Get stream length
+	exists, err := rdb.Exists(ctx, streamKey).Result()
+	if err != nil || exists == 0 {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error":   "Topic not found",
+			"message": fmt.Sprintf("topic %s does not exist", topic),
+		})
+		return
+	}
+	length, err := rdb.XLen(ctx, streamKey).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get topic stats",
 			"message": err.Error(),
 		})
 		return
 	}
 
 	// Get consumer group info
-	consumerGroup := fmt.Sprintf("mq:group:%s", topic)
 	groups, err := rdb.XInfoGroups(ctx, streamKey).Result()
 	if err != nil {
 		groups = []redis.XInfoGroup{}
 	}
 
+	// Messages delivered to a group and not acknowledged yet are pending
+	var pending int64
+	for _, group := range groups {
+		pending += group.Pending
+	}
+
+	// Counters of the last 24 hours, kept by updateTopicStats
+	counters := topicCounters(topic)
+
 	stats := QueueStats{
-		Topic:           topic,
-		TotalMessages:   info.EntriesAdded,
-		PendingMessages: info.Length,
-		ProcessedMessages: info.EntriesAdded - info.Length,
-		FailedMessages:  0, // Would need separate tracking
-		Consumers:       len(groups),
+		Topic:             topic,
+		TotalMessages:     counters["published"],
+		PendingMessages:   pending,
+		ProcessedMessages: counters["acknowledged"],
+		FailedMessages:    counters["failed"],
+		Consumers:         len(groups),
+	}
+	if stats.TotalMessages < length {
+		stats.TotalMessages = length
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -710,18 +802,15 @@ func getTopicStats(c *gin.Context) {
 // createTopic creates a new topic
 func createTopic(c *gin.Context) {
 	var request struct {
-		Topic string `json:"topic" binding:"required"`
+		Topic string `json:"topic" binding:"required,topic"`
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
-	streamKey := fmt.Sprintf("mq:topic:%s", request.Topic)
+	streamKey := types.StreamKey(request.Topic)
 	
 	// Create stream with initial message
 	_, err := rdb.XAdd(ctx, &redis.XAddArgs{
@@ -761,7 +850,7 @@ func deleteTopic(c *gin.Context) {
 		return
 	}
 
-	streamKey := fmt.Sprintf("mq:topic:%s", topic)
+	streamKey := types.StreamKey(topic)
 	
 	// Delete the stream
 	_, err := rdb.Del(ctx, streamKey).Result()
@@ -797,11 +886,11 @@ func getOverallStats(c *gin.Context) {
 	var totalConsumers int64
 
 	for _, key := range keys {
-		info, err := rdb.XInfoStream(ctx, key).Result()
+		length, err := rdb.XLen(ctx, key).Result()
 		if err != nil {
 			continue
 		}
-		totalMessages += info.EntriesAdded
+		totalMessages += length
 		totalTopics++
 
 		// Get consumer groups
@@ -836,6 +925,24 @@ func getConsumerStats(c *gin.Context) {
 	})
 }
 
+// topicCounters returns the counters updateTopicStats keeps for a topic,
+// none when they expired
+func topicCounters(topic string) map[string]int64 {
+	values, err := rdb.HGetAll(ctx, fmt.Sprintf("mq:stats:%s", topic)).Result()
+	if err != nil {
+		return map[string]int64{}
+	}
+
+	counters := make(map[string]int64, len(values))
+	for action, value := range values {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			counters[action] = count
+		}
+	}
+	return counters
+}
+
 // updateTopicStats updates topic statistics
 func updateTopicStats(topic, action string) {
 	statsKey := fmt.Sprintf("mq:stats:%s", topic)
@@ -847,7 +954,51 @@ func updateTopicStats(topic, action string) {
 	rdb.Expire(ctx, statsKey, time.Hour*24) // 24 hours
 }
 
-// generateMessageID generates a unique message ID
-func generateMessageID() string {
-	return fmt.Sprintf("msg_%d_%d", time.Now().UnixNano(), time.Now().Unix())
+// topicPaused reports whether operators paused publishing to a topic
+func topicPaused(topic string) bool {
+	return runtimeConfig.Bool("topics."+topic+".paused", false)
+}
+
+// respondBindError answers a request body that failed to bind, listing the
+// invalid fields when they are known
+func respondBindError(c *gin.Context, err error) {
+	response := gin.H{
+		"error":   "Invalid request",
+		"message": err.Error(),
+	}
+	if fields := validation.Fields(err); len(fields) > 0 {
+		response["errors"] = fields
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
+// getRuntimeConfig returns the runtime configuration values that are set
+func getRuntimeConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    runtimeConfig.Values(),
+	})
+}
+
+// updateRuntimeConfig changes runtime configuration values, an empty value
+// restores the default of a key
+func updateRuntimeConfig(c *gin.Context) {
+	var values map[string]string
+	if err := validation.BindJSON(c, &values); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := runtimeConfig.Set(ctx, values); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update runtime configuration",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    runtimeConfig.Values(),
+	})
 }
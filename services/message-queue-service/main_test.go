@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"claude-talimat/pkg/runtimeconfig"
+	"claude-talimat/pkg/types"
+	"claude-talimat/pkg/validation"
+)
+
+// newTestServer serves the API against an in-process Redis
+func newTestServer(t testing.TB) *httptest.Server {
+	return newTestServerAt(t, &redis.Options{Addr: miniredis.RunT(t).Addr()})
+}
+
+// newTestServerAt serves the API against the Redis of options
+func newTestServerAt(t testing.TB, options *redis.Options) *httptest.Server {
+	t.Helper()
+
+	rdb = redis.NewClient(options)
+	t.Cleanup(func() { rdb.Close() })
+
+	var err error
+	runtimeConfig, err = runtimeconfig.New(runtimeconfig.NewRedisSource(rdb, "message-queue-service"), 0)
+	if err != nil {
+		t.Fatalf("Failed to load runtime configuration: %v", err)
+	}
+	t.Cleanup(runtimeConfig.Close)
+
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(newRouter())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// call posts body to path and decodes the response into out
+func call(t testing.TB, server *httptest.Server, path string, body, out interface{}) int {
+	t.Helper()
+
+	data, _ := json.Marshal(body)
+	resp, err := http.Post(server.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to call %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode response of %s: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type consumeResponse struct {
+	Messages []types.Message `json:"messages"`
+	Count    int             `json:"count"`
+}
+
+func TestPublishConsumeAcknowledge(t *testing.T) {
+	server := newTestServer(t)
+
+	status := call(t, server, "/api/v1/messages/publish", types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "email", "recipient": "ayse.yilmaz@talimat.test"},
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected the message to be published, got %d", status)
+	}
+
+	var consumed consumeResponse
+	call(t, server, "/api/v1/messages/consume", gin.H{
+		"topic":      types.TopicNotifications,
+		"consumer":   "worker-1",
+		"block_time": 10,
+	}, &consumed)
+	if consumed.Count != 1 {
+		t.Fatalf("Expected one message, got %d", consumed.Count)
+	}
+	message := consumed.Messages[0]
+	if message.Payload["recipient"] != "ayse.yilmaz@talimat.test" || message.Priority != 5 || message.MaxRetries != 3 {
+		t.Errorf("Expected the published message with defaults, got %+v", message)
+	}
+
+	status = call(t, server, "/api/v1/messages/"+message.ID+"/ack", gin.H{
+		"topic":    types.TopicNotifications,
+		"consumer": "worker-1",
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected the message to be acknowledged, got %d", status)
+	}
+
+	pending, err := rdb.XPending(ctx, types.StreamKey(types.TopicNotifications), types.GroupKey(types.TopicNotifications)).Result()
+	if err != nil {
+		t.Fatalf("Failed to get pending messages: %v", err)
+	}
+	if pending.Count != 0 {
+		t.Errorf("Expected no pending messages, got %d", pending.Count)
+	}
+
+	stats, _ := rdb.HGetAll(ctx, "mq:stats:"+types.TopicNotifications).Result()
+	if stats["published"] != "1" || stats["consumed"] != "1" || stats["acknowledged"] != "1" {
+		t.Errorf("Expected the topic stats to count the flow, got %v", stats)
+	}
+}
+
+func TestNegativeAcknowledgeDeadLetters(t *testing.T) {
+	server := newTestServer(t)
+
+	call(t, server, "/api/v1/messages/publish", types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "sms"},
+	}, nil)
+
+	var consumed consumeResponse
+	call(t, server, "/api/v1/messages/consume", gin.H{
+		"topic":      types.TopicNotifications,
+		"consumer":   "worker-1",
+		"block_time": 10,
+	}, &consumed)
+	if consumed.Count != 1 {
+		t.Fatalf("Expected one message, got %d", consumed.Count)
+	}
+
+	status := call(t, server, "/api/v1/messages/"+consumed.Messages[0].ID+"/nack", gin.H{
+		"topic":    types.TopicNotifications,
+		"consumer": "worker-1",
+		"reason":   "invalid recipient",
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected the message to be nacked, got %d", status)
+	}
+
+	dead, err := rdb.XRange(ctx, types.DeadLetterKey(types.TopicNotifications), "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read dead letter queue: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Values["original_id"] != consumed.Messages[0].ID {
+		t.Fatalf("Expected the message to be dead-lettered, got %v", dead)
+	}
+	raw, _ := dead[0].Values["message"].(string)
+	if dead[0].Values["reason"] != "invalid recipient" || !strings.Contains(raw, `"type":"sms"`) {
+		t.Errorf("Expected the dead letter to keep the message and its reason, got %v", dead[0].Values)
+	}
+}
+
+func TestConsumeRedeliversPendingMessages(t *testing.T) {
+	server := newTestServer(t)
+
+	call(t, server, "/api/v1/messages/publish", types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "email"},
+	}, nil)
+
+	consume := func(consumer string) consumeResponse {
+		var consumed consumeResponse
+		call(t, server, "/api/v1/messages/consume", gin.H{
+			"topic":      types.TopicNotifications,
+			"consumer":   consumer,
+			"block_time": 10,
+			"claim_idle": 1,
+		}, &consumed)
+		return consumed
+	}
+
+	first := consume("worker-1")
+	if first.Count != 1 || first.Messages[0].RetryCount != 0 {
+		t.Fatalf("Expected the message on its first delivery, got %+v", first)
+	}
+
+	// The message was never acknowledged, so another consumer gets it again
+	time.Sleep(5 * time.Millisecond)
+	second := consume("worker-2")
+	if second.Count != 1 || second.Messages[0].ID != first.Messages[0].ID {
+		t.Fatalf("Expected the pending message to be redelivered, got %+v", second)
+	}
+	if second.Messages[0].RetryCount != 1 || second.Messages[0].Payload["type"] != "email" {
+		t.Errorf("Expected the redelivery to count as a retry, got %+v", second.Messages[0])
+	}
+}
+
+func TestPublishToPausedTopicIsRejected(t *testing.T) {
+	server := newTestServer(t)
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/api/v1/runtime-config", bytes.NewReader([]byte(`{"topics.notifications.paused":"true"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to update runtime configuration: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the runtime configuration to be updated, got %d", resp.StatusCode)
+	}
+
+	status := call(t, server, "/api/v1/messages/publish", types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "email"},
+	}, nil)
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Expected publishing to a paused topic to be rejected, got %d", status)
+	}
+}
+
+func TestPublishInvalidPayloadIsRejected(t *testing.T) {
+	server := newTestServer(t)
+
+	var response struct {
+		Message string `json:"message"`
+	}
+	status := call(t, server, "/api/v1/messages/publish", types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "fax", "recipients": "ayse.yilmaz@talimat.test"},
+	}, &response)
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected the payload to be rejected, got %d", status)
+	}
+	if !strings.Contains(response.Message, "recipients: must be an array") || !strings.Contains(response.Message, "type: must be one of") {
+		t.Errorf("Expected the problems of the payload, got %q", response.Message)
+	}
+
+	status = call(t, server, "/api/v1/messages/publish", types.MessageRequest{
+		Topic: types.TopicNotificationEvents,
+		Payload: map[string]interface{}{
+			"id":        "evt-1",
+			"type":      "notification.status",
+			"source":    "notification-service",
+			"timestamp": "2024-03-01T09:00:00Z",
+			"data":      map[string]interface{}{"notification_id": "ntf-1", "type": "sms", "status": "lost"},
+		},
+	}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected an event with invalid data to be rejected, got %d", status)
+	}
+}
+
+type bindErrorResponse struct {
+	Message string                  `json:"message"`
+	Errors  []validation.FieldError `json:"errors"`
+}
+
+func TestPublishReportsInvalidFields(t *testing.T) {
+	server := newTestServer(t)
+
+	var response bindErrorResponse
+	status := call(t, server, "/api/v1/messages/publish", gin.H{
+		"topic":    "Bildirimler!",
+		"payload":  gin.H{"type": "sms"},
+		"priority": 11,
+	}, &response)
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected the request to be rejected, got %d", status)
+	}
+
+	rules := map[string]string{}
+	for _, field := range response.Errors {
+		rules[field.Field] = field.Rule
+	}
+	if rules["topic"] != "topic" || rules["priority"] != "max" {
+		t.Errorf("Expected the topic and priority to be reported, got %+v", response.Errors)
+	}
+}
+
+func TestStrictValidationRejectsUnknownFields(t *testing.T) {
+	server := newTestServer(t)
+
+	request := gin.H{
+		"topic":   types.TopicNotifications,
+		"payload": gin.H{"type": "sms"},
+		"retries": 5,
+	}
+	if status := call(t, server, "/api/v1/messages/publish", request, nil); status != http.StatusOK {
+		t.Fatalf("Expected unknown fields to be ignored by default, got %d", status)
+	}
+
+	if err := runtimeConfig.Set(ctx, map[string]string{runtimeStrictValidation: "true"}); err != nil {
+		t.Fatalf("Failed to enable strict validation: %v", err)
+	}
+
+	var response bindErrorResponse
+	if status := call(t, server, "/api/v1/messages/publish", request, &response); status != http.StatusBadRequest {
+		t.Fatalf("Expected unknown fields to be rejected, got %d", status)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Field != "retries" || response.Errors[0].Rule != "unknown" {
+		t.Errorf("Expected the unknown field to be reported, got %+v", response.Errors)
+	}
+}
+
+func TestEventSchemas(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/api/v1/events/schemas/notification.status")
+	if err != nil {
+		t.Fatalf("Failed to get schema: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var schema struct {
+		Title      string                 `json:"title"`
+		Required   []string               `json:"required"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&schema); err != nil {
+		t.Fatalf("Failed to decode schema: %v", err)
+	}
+	if schema.Title != "notification.status" || len(schema.Required) != 3 || schema.Properties["status"] == nil {
+		t.Errorf("Expected the schema of notification.status, got %+v", schema)
+	}
+
+	resp, err = http.Get(server.URL + "/api/v1/events/schemas/notification.unknown")
+	if err != nil {
+		t.Fatalf("Failed to get schema: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected unknown event types to be not found, got %d", resp.StatusCode)
+	}
+}
+
+func TestV2AnswersInTheEnvelope(t *testing.T) {
+	server := newTestServer(t)
+
+	var published struct {
+		Data  types.MessageResponse `json:"data"`
+		Error interface{}           `json:"error"`
+	}
+	status := call(t, server, "/api/v2/messages/publish", types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "sms", "recipient": "+905551112233"},
+	}, &published)
+	if status != http.StatusOK || published.Data.ID == "" || published.Error != nil {
+		t.Fatalf("Expected the published message under data, got %d %+v", status, published)
+	}
+
+	var failed struct {
+		Data  interface{} `json:"data"`
+		Error struct {
+			Code    string `json:"code"`
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	status = call(t, server, "/api/v2/messages/publish", gin.H{"topic": types.TopicNotifications}, &failed)
+	if status != http.StatusBadRequest || failed.Data != nil {
+		t.Fatalf("Expected the request to be rejected without data, got %d %+v", status, failed)
+	}
+	if failed.Error.Code != "invalid_request" || failed.Error.Status != http.StatusBadRequest || failed.Error.Message == "" {
+		t.Errorf("Expected the failure under error, got %+v", failed.Error)
+	}
+}
+
+func TestV1IsDeprecated(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/api/v1/topics/")
+	if err != nil {
+		t.Fatalf("Failed to list topics: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("Deprecation") != "true" || !strings.Contains(resp.Header.Get("Link"), "</api/v2>") {
+		t.Errorf("Expected version 1 to point to version 2, got %v", resp.Header)
+	}
+}
+
+// newBenchmarkServer serves the API with the request and message logs
+// dropped, so benchmarks measure the API and not the log output. It runs
+// against miniredis unless BENCHMARK_REDIS_URL points at a real Redis, which
+// `make loadtest` does. That database is flushed, so it must not hold
+// anything else.
+func newBenchmarkServer(b *testing.B) *httptest.Server {
+	b.Helper()
+
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() {
+		gin.DefaultWriter = os.Stdout
+		log.SetOutput(os.Stderr)
+	})
+
+	redisURL := os.Getenv("BENCHMARK_REDIS_URL")
+	if redisURL == "" {
+		return newTestServer(b)
+	}
+
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		b.Fatalf("Invalid BENCHMARK_REDIS_URL: %v", err)
+	}
+	server := newTestServerAt(b, options)
+	if err := rdb.FlushDB(ctx).Err(); err != nil {
+		b.Fatalf("Failed to flush the benchmark database: %v", err)
+	}
+	return server
+}
+
+// BenchmarkPublish measures publishing through the API
+func BenchmarkPublish(b *testing.B) {
+	server := newBenchmarkServer(b)
+
+	request := types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "sms", "recipient": "+905551112233"},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if status := call(b, server, "/api/v1/messages/publish", request, nil); status != http.StatusOK {
+			b.Fatalf("Expected the message to be published, got %d", status)
+		}
+	}
+}
+
+// BenchmarkConsumeLatency measures consuming and acknowledging a message
+// published right before
+func BenchmarkConsumeLatency(b *testing.B) {
+	server := newBenchmarkServer(b)
+
+	request := types.MessageRequest{
+		Topic:   types.TopicNotifications,
+		Payload: map[string]interface{}{"type": "sms", "recipient": "+905551112233"},
+	}
+	consumer := gin.H{"topic": types.TopicNotifications, "consumer": "worker-1", "block_time": 10}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		call(b, server, "/api/v1/messages/publish", request, nil)
+		b.StartTimer()
+
+		var consumed consumeResponse
+		call(b, server, "/api/v1/messages/consume", consumer, &consumed)
+		if consumed.Count != 1 {
+			b.Fatalf("Expected one message, got %d", consumed.Count)
+		}
+		call(b, server, "/api/v1/messages/"+consumed.Messages[0].ID+"/ack", consumer, nil)
+	}
+}
+
+func TestTopicStatsCountPendingAndProcessedMessages(t *testing.T) {
+	server := newTestServer(t)
+
+	for i := 0; i < 2; i++ {
+		call(t, server, "/api/v1/messages/publish", types.MessageRequest{
+			Topic:   types.TopicNotifications,
+			Payload: map[string]interface{}{"type": "email", "recipient": "ayse.yilmaz@talimat.test"},
+		}, nil)
+	}
+	var consumed consumeResponse
+	call(t, server, "/api/v1/messages/consume", gin.H{
+		"topic":      types.TopicNotifications,
+		"consumer":   "worker-1",
+		"count":      2,
+		"block_time": 10,
+	}, &consumed)
+	if consumed.Count != 2 {
+		t.Fatalf("Expected two messages, got %d", consumed.Count)
+	}
+	call(t, server, "/api/v1/messages/"+consumed.Messages[0].ID+"/ack", gin.H{
+		"topic":    types.TopicNotifications,
+		"consumer": "worker-1",
+	}, nil)
+
+	resp, err := http.Get(server.URL + "/api/v1/topics/" + types.TopicNotifications + "/stats")
+	if err != nil {
+		t.Fatalf("Failed to get topic stats: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Stats QueueStats `json:"stats"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode topic stats: %v", err)
+	}
+	stats := body.Stats
+	if stats.TotalMessages != 2 || stats.PendingMessages != 1 || stats.ProcessedMessages != 1 || stats.Consumers != 1 {
+		t.Errorf("Expected two messages, one pending and one processed, got %+v", stats)
+	}
+}
@@ -0,0 +1,342 @@
+// Package client is a Go client of version 2 of the notification service
+// API, where every response carries its resource, metadata or failure in the
+// same envelope.
+//
+//	c := client.NewClient("http://notification-service:8003", client.WithAPIKey(key))
+//	resp, err := c.Send(ctx, client.SendRequest{Type: "email", RecipientID: "user:42", Title: "Hi", Message: "Hello"})
+//
+// Requests that fail with a network error or a status the service asks to
+// retry are retried with exponential backoff. Requests creating something
+// carry an Idempotency-Key, generated per call unless set with
+// WithIdempotencyKey, so retrying them never sends twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of the notification service
+const (
+	apiKeyHeader         = "X-API-Key"
+	tenantHeader         = "X-Tenant-ID"
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+// Client represents a notification service client
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	apiKey      string
+	bearerToken string
+	tenantID    string
+	maxRetries  int
+	retryDelay  time.Duration
+	maxDelay    time.Duration
+}
+
+// Option configures a client
+type Option func(*Client)
+
+// WithAPIKey authenticates as a service with an API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken authenticates as a user with a JWT
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.bearerToken = token
+	}
+}
+
+// WithTenant makes API key callers act on behalf of a tenant
+func WithTenant(tenantID string) Option {
+	return func(c *Client) {
+		c.tenantID = tenantID
+	}
+}
+
+// WithHTTPClient replaces the HTTP client requests are made with
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how often failed requests are retried and the base delay
+// of the exponential backoff between attempts. Zero retries disables them.
+func WithRetries(maxRetries int, retryDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryDelay = retryDelay
+	}
+}
+
+// NewClient creates a new notification service client
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		maxRetries: 3,
+		retryDelay: 500 * time.Millisecond,
+		maxDelay:   10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// APIError is an error response of the service, as the error of the
+// response envelope describes it
+type APIError struct {
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Status     int          `json:"status"`
+	Detail     string       `json:"detail,omitempty"`
+	Code       string       `json:"code"` // stable code to branch on, like not_found or rate_limited
+	Errors     []FieldError `json:"errors,omitempty"`
+	RetryAfter int          `json:"retry_after,omitempty"` // seconds
+}
+
+// FieldError describes an invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("request failed with status %d: %s", e.Status, e.Title)
+	}
+	return fmt.Sprintf("request failed with status %d: %s: %s", e.Status, e.Title, e.Detail)
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey sets the Idempotency-Key of the requests made with ctx,
+// so a request repeated after the client gave up is not processed twice
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// apiPrefix is the path of the API version the client speaks
+const apiPrefix = "/api/v2"
+
+// envelope is the body of every response
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Meta  responseMeta    `json:"meta"`
+	Error *envelopeError  `json:"error"`
+}
+
+// responseMeta is what a response carries besides its resource
+type responseMeta struct {
+	Message    string      `json:"message"`
+	Pagination *Pagination `json:"pagination"`
+}
+
+// envelopeError is the failure of a response
+type envelopeError struct {
+	Code    string `json:"code"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Details struct {
+		Errors     []FieldError `json:"errors"`
+		RetryAfter int          `json:"retry_after"`
+	} `json:"details"`
+}
+
+// do sends a request, retrying it when that is safe, and decodes the data
+// of the response into out unless it is nil
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	_, err := c.call(ctx, method, path, body, out)
+	return err
+}
+
+// call is do that also returns the metadata of the response
+func (c *Client) call(ctx context.Context, method string, path string, body interface{}, out interface{}) (*responseMeta, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	// Retried writes must be recognised as the same request
+	idempotencyKey, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	if idempotencyKey == "" && method == http.MethodPost {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		respBody, retryAfter, err := c.send(ctx, method, apiPrefix+path, payload, idempotencyKey)
+		if err == nil {
+			return decodeData(respBody, out)
+		}
+
+		lastErr = err
+		if attempt >= c.maxRetries || !retryable(err) {
+			return nil, lastErr
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send makes a single attempt of a request. It returns how long the service
+// asked to wait before retrying, if it did.
+func (c *Client) send(ctx context.Context, method string, path string, payload []byte, idempotencyKey string) ([]byte, time.Duration, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set(apiKeyHeader, c.apiKey)
+	}
+	if c.bearerToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	if c.tenantID != "" {
+		httpReq.Header.Set(tenantHeader, c.tenantID)
+	}
+	if idempotencyKey != "" {
+		httpReq.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, 0, &transportError{err: fmt.Errorf("failed to send request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &transportError{err: fmt.Errorf("failed to read response: %w", err)}
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return body, 0, nil
+	}
+
+	apiErr := &APIError{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil || env.Error == nil {
+		apiErr.Detail = string(body)
+	} else {
+		apiErr.Code = env.Error.Code
+		apiErr.Detail = env.Error.Message
+		apiErr.Errors = env.Error.Details.Errors
+		apiErr.RetryAfter = env.Error.Details.RetryAfter
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	} else if apiErr.RetryAfter > 0 {
+		retryAfter = time.Duration(apiErr.RetryAfter) * time.Second
+	}
+
+	return nil, retryAfter, apiErr
+}
+
+// backoff returns the delay before the retry following an attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.retryDelay << uint(attempt)
+	if delay <= 0 || delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+	return delay
+}
+
+// transportError is a request that failed before the service answered
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// Helper functions
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *transportError:
+		return true
+	case *APIError:
+		switch e.Status {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		case http.StatusConflict:
+			// The first attempt of an idempotent request is still being processed
+			return e.Code == "request_in_progress"
+		}
+	}
+	return false
+}
+
+func decodeData(body []byte, out interface{}) (*responseMeta, error) {
+	var env envelope
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &env); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+	}
+
+	if out != nil && len(env.Data) > 0 {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+	}
+
+	return &env.Meta, nil
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(key)
+}
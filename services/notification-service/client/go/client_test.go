@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	apienvelope "claude-talimat/pkg/envelope"
+)
+
+// newV2Server answers like the handlers of the service do, behind the
+// envelope of version 2
+func newV2Server(t *testing.T, routes func(group *gin.RouterGroup)) *Client {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	routes(router.Group("/api/v2", apienvelope.Middleware()))
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, WithAPIKey("key"), WithRetries(0, 0))
+}
+
+func TestSendReadsTheEnvelopeOfVersion2(t *testing.T) {
+	c := newV2Server(t, func(group *gin.RouterGroup) {
+		group.POST("/notifications/send", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"success":          true,
+				"notification_id":  "notif-1",
+				"notification_ids": []string{"notif-1"},
+				"message":          "Notification queued for delivery",
+			})
+		})
+	})
+
+	resp, err := c.Send(context.Background(), SendRequest{Type: "email", RecipientID: "user:42", Title: "Tatbikat", Message: "Saat 14.00"})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if !resp.Success || resp.NotificationID != "notif-1" || resp.Message != "Notification queued for delivery" {
+		t.Errorf("Expected the notification and message of the response, got %+v", resp)
+	}
+}
+
+func TestListInAppReadsThePaginationFromTheMeta(t *testing.T) {
+	c := newV2Server(t, func(group *gin.RouterGroup) {
+		group.GET("/inapp/notifications", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data": gin.H{
+					"notifications": []gin.H{{"id": "inapp-1", "title": "Tatbikat"}},
+					"pagination":    gin.H{"page": 1, "limit": 1, "total": 2, "total_pages": 2},
+				},
+			})
+		})
+	})
+
+	page, err := c.ListInApp(context.Background(), InAppListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(page.Notifications) != 1 || page.Notifications[0].ID != "inapp-1" {
+		t.Errorf("Expected the notifications of the page, got %+v", page.Notifications)
+	}
+	if page.Pagination.Total != 2 || !page.Pagination.HasMore {
+		t.Errorf("Expected the pagination of the page, got %+v", page.Pagination)
+	}
+}
+
+func TestFailuresAreReadFromTheEnvelopeOfVersion2(t *testing.T) {
+	c := newV2Server(t, func(group *gin.RouterGroup) {
+		group.GET("/notifications/:id/status", func(c *gin.Context) {
+			problem.Respond(c, problem.CodeNotFound, "Notification not found")
+		})
+	})
+
+	_, err := c.GetStatus(context.Background(), "notif-1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an API error, got %v", err)
+	}
+	if apiErr.Status != http.StatusNotFound || apiErr.Code != "not_found" || apiErr.Detail != "Notification not found" {
+		t.Errorf("Expected the failure of the envelope, got %+v", apiErr)
+	}
+}
@@ -0,0 +1,381 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SendRequest represents a request to send a notification
+type SendRequest struct {
+	Type        string                 `json:"type"` // email, sms, push, inapp
+	RecipientID string                 `json:"recipient_id"`
+	Title       string                 `json:"title"`
+	Message     string                 `json:"message"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Priority    string                 `json:"priority,omitempty"` // low, normal, high, urgent
+	Channels    []string               `json:"channels,omitempty"`
+	CallbackURL string                 `json:"callback_url,omitempty"` // receives the status changes as signed events
+	Digestible  bool                   `json:"digestible,omitempty"`   // held back for recipients who prefer digests
+	CollapseKey string                 `json:"collapse_key,omitempty"` // merges notifications sent with the same key
+	TenantID    string                 `json:"tenant_id,omitempty"`    // required of API keys not bound to a tenant
+}
+
+// SendResponse represents a response for a sent notification
+type SendResponse struct {
+	Success        bool   `json:"success"`
+	NotificationID string `json:"notification_id"`
+	Message        string `json:"message"`
+}
+
+// BulkSendRequest represents a request to send a notification to many recipients
+type BulkSendRequest struct {
+	Type         string                 `json:"type"`
+	RecipientIDs []string               `json:"recipient_ids"`
+	Title        string                 `json:"title"`
+	Message      string                 `json:"message"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	Priority     string                 `json:"priority,omitempty"`
+	Channels     []string               `json:"channels,omitempty"`
+	CallbackURL  string                 `json:"callback_url,omitempty"`
+	Digestible   bool                   `json:"digestible,omitempty"`
+	CollapseKey  string                 `json:"collapse_key,omitempty"`
+	TenantID     string                 `json:"tenant_id,omitempty"`
+}
+
+// BulkSendResponse represents a response for notifications sent in bulk
+type BulkSendResponse struct {
+	Success         bool     `json:"success"`
+	NotificationIDs []string `json:"notification_ids"`
+	Message         string   `json:"message"`
+}
+
+// Notification represents a notification and its delivery status
+type Notification struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Message     string                 `json:"message"`
+	Recipient   string                 `json:"recipient"`
+	Status      string                 `json:"status"` // pending, sent, delivered, failed
+	Priority    string                 `json:"priority"`
+	TemplateID  *string                `json:"template_id,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	TenantID    string                 `json:"tenant_id"`
+	SentAt      *time.Time             `json:"sent_at,omitempty"`
+	DeliveredAt *time.Time             `json:"delivered_at,omitempty"`
+	RetryCount  int                    `json:"retry_count"`
+	Error       *string                `json:"error,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// Template represents a notification template
+type Template struct {
+	ID        string                 `json:"id,omitempty"`
+	Name      string                 `json:"name"`
+	Type      string                 `json:"type"`
+	Subject   string                 `json:"subject"`
+	Content   string                 `json:"content"`
+	Variables []string               `json:"variables"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	TenantID  string                 `json:"tenant_id"`
+	IsActive  bool                   `json:"is_active"`
+	CreatedBy string                 `json:"created_by,omitempty"`
+	CreatedAt time.Time              `json:"created_at,omitempty"`
+	UpdatedAt time.Time              `json:"updated_at,omitempty"`
+}
+
+// InAppNotification represents a notification in a user's inbox
+type InAppNotification struct {
+	ID         string                 `json:"id"`
+	UserID     string                 `json:"user_id"`
+	TenantID   string                 `json:"tenant_id"`
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Message    string                 `json:"message"`
+	Data       map[string]interface{} `json:"data"`
+	Priority   string                 `json:"priority"`
+	Category   string                 `json:"category"`
+	Read       bool                   `json:"read"`
+	Archived   bool                   `json:"archived"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ReadAt     *time.Time             `json:"read_at,omitempty"`
+	ExpiresAt  *time.Time             `json:"expires_at,omitempty"`
+	ActionURL  string                 `json:"action_url,omitempty"`
+	ActionText string                 `json:"action_text,omitempty"`
+	Tags       []string               `json:"tags"`
+}
+
+// InAppListOptions filters and pages an inbox. Zero values don't filter.
+type InAppListOptions struct {
+	UserID   string // the caller when empty, admins and services may list other users
+	Page     int
+	Limit    int // at most 100
+	Type     string
+	Category string
+	Priority string
+	Search   string // matches notifications containing every word of it
+	Read     *bool
+	Archived *bool
+}
+
+// Pagination describes a page of a listing
+type Pagination struct {
+	Page       int  `json:"page"`
+	Limit      int  `json:"limit"`
+	Total      int  `json:"total"`
+	TotalPages int  `json:"total_pages"`
+	HasMore    bool `json:"has_more"`
+}
+
+// InAppPage is a page of an inbox
+type InAppPage struct {
+	Notifications []InAppNotification `json:"notifications"`
+	Pagination    Pagination          `json:"pagination"`
+}
+
+// Send sends a notification
+func (c *Client) Send(ctx context.Context, req SendRequest) (*SendResponse, error) {
+	var resp SendResponse
+	meta, err := c.call(ctx, http.MethodPost, "/notifications/send", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.Success = true
+	resp.Message = meta.Message
+	return &resp, nil
+}
+
+// SendBulk sends a notification to many recipients
+func (c *Client) SendBulk(ctx context.Context, req BulkSendRequest) (*BulkSendResponse, error) {
+	var resp BulkSendResponse
+	meta, err := c.call(ctx, http.MethodPost, "/notifications/send-bulk", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.Success = true
+	resp.Message = meta.Message
+	return &resp, nil
+}
+
+// GetStatus returns a notification and its delivery status
+func (c *Client) GetStatus(ctx context.Context, notificationID string) (*Notification, error) {
+	var notification Notification
+	path := fmt.Sprintf("/notifications/%s/status", url.PathEscape(notificationID))
+	if err := c.do(ctx, http.MethodGet, path, nil, &notification); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// TimelineEvent is something that happened to a notification: created,
+// queued, attempt, delivered, status_changed, opened, acknowledged or escalated
+type TimelineEvent struct {
+	Type      string     `json:"type"`
+	At        time.Time  `json:"at"`
+	Status    string     `json:"status,omitempty"`
+	Attempt   int        `json:"attempt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	MessageID string     `json:"message_id,omitempty"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"`
+}
+
+// Timeline is every event of a notification, oldest first
+type Timeline struct {
+	NotificationID string          `json:"notification_id"`
+	Status         string          `json:"status"`
+	Events         []TimelineEvent `json:"events"`
+}
+
+// GetTimeline returns every event of a notification
+func (c *Client) GetTimeline(ctx context.Context, notificationID string) (*Timeline, error) {
+	var timeline Timeline
+	path := fmt.Sprintf("/notifications/%s/timeline", url.PathEscape(notificationID))
+	if err := c.do(ctx, http.MethodGet, path, nil, &timeline); err != nil {
+		return nil, err
+	}
+	return &timeline, nil
+}
+
+// StatusBatch is the status of many notifications
+type StatusBatch struct {
+	Statuses []struct {
+		ID     string                 `json:"id"`
+		Status string                 `json:"status"` // not_found for unknown notifications
+		Result map[string]interface{} `json:"result,omitempty"`
+	} `json:"statuses"`
+	Summary struct {
+		Total    int            `json:"total"`
+		Found    int            `json:"found"`
+		NotFound int            `json:"not_found"`
+		ByStatus map[string]int `json:"by_status"`
+	} `json:"summary"`
+}
+
+// GetStatuses returns the status of up to 1,000 notifications at once
+func (c *Client) GetStatuses(ctx context.Context, notificationIDs []string) (*StatusBatch, error) {
+	var batch StatusBatch
+	req := map[string]interface{}{"ids": notificationIDs}
+	if err := c.do(ctx, http.MethodPost, "/notifications/status-batch", req, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// HistoryOptions filters and pages the notification history. Zero values don't filter.
+type HistoryOptions struct {
+	RecipientID string
+	Type        string // channel
+	Status      string
+	Category    string
+	Priority    string
+	Search      string // matches notifications whose subject, title or message contain every word of it
+	From        time.Time
+	To          time.Time
+	Sort        string // newest or oldest, newest when empty
+	Cursor      string // NextCursor of the previous page
+	Limit       int    // at most 100
+}
+
+// HistoryPage is a page of the notification history
+type HistoryPage struct {
+	Notifications []map[string]interface{} `json:"notifications"`
+	Total         int                      `json:"total"`
+	NextCursor    string                   `json:"next_cursor,omitempty"`
+	HasMore       bool                     `json:"has_more"`
+}
+
+// History returns a page of the notification history of the caller's tenant
+func (c *Client) History(ctx context.Context, opts HistoryOptions) (*HistoryPage, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"recipient_id": opts.RecipientID,
+		"type":         opts.Type,
+		"status":       opts.Status,
+		"category":     opts.Category,
+		"priority":     opts.Priority,
+		"search":       opts.Search,
+		"sort":         opts.Sort,
+		"cursor":       opts.Cursor,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if !opts.From.IsZero() {
+		query.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		query.Set("to", opts.To.Format(time.RFC3339))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	path := "/notifications/history"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var page HistoryPage
+	if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ListTemplates returns the templates of the caller's tenant
+func (c *Client) ListTemplates(ctx context.Context) ([]Template, error) {
+	var templates []Template
+	if err := c.do(ctx, http.MethodGet, "/templates/", nil, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// CreateTemplate creates a template
+func (c *Client) CreateTemplate(ctx context.Context, template Template) (*Template, error) {
+	var created Template
+	if err := c.do(ctx, http.MethodPost, "/templates/", template, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateTemplate updates the given fields of a template
+func (c *Client) UpdateTemplate(ctx context.Context, templateID string, updates map[string]interface{}) error {
+	path := fmt.Sprintf("/templates/%s", url.PathEscape(templateID))
+	return c.do(ctx, http.MethodPut, path, updates, nil)
+}
+
+// DeleteTemplate deletes a template
+func (c *Client) DeleteTemplate(ctx context.Context, templateID string) error {
+	path := fmt.Sprintf("/templates/%s", url.PathEscape(templateID))
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// GetPreferences returns the notification preferences of a user
+func (c *Client) GetPreferences(ctx context.Context, userID string) (map[string]interface{}, error) {
+	var preferences map[string]interface{}
+	path := fmt.Sprintf("/preferences/%s", url.PathEscape(userID))
+	if err := c.do(ctx, http.MethodGet, path, nil, &preferences); err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+// UpdatePreferences updates the given notification preferences of a user
+func (c *Client) UpdatePreferences(ctx context.Context, userID string, preferences map[string]interface{}) error {
+	path := fmt.Sprintf("/preferences/%s", url.PathEscape(userID))
+	return c.do(ctx, http.MethodPut, path, preferences, nil)
+}
+
+// ListInApp returns a page of an in-app inbox, the newest first
+func (c *Client) ListInApp(ctx context.Context, opts InAppListOptions) (*InAppPage, error) {
+	query := url.Values{}
+	if opts.UserID != "" {
+		query.Set("user_id", opts.UserID)
+	}
+	if opts.Page > 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	for key, value := range map[string]string{
+		"type":     opts.Type,
+		"category": opts.Category,
+		"priority": opts.Priority,
+		"search":   opts.Search,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if opts.Read != nil {
+		query.Set("read", strconv.FormatBool(*opts.Read))
+	}
+	if opts.Archived != nil {
+		query.Set("archived", strconv.FormatBool(*opts.Archived))
+	}
+
+	path := "/inapp/notifications"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	// The notifications are the data, their pagination is metadata
+	var page InAppPage
+	meta, err := c.call(ctx, http.MethodGet, path, nil, &page.Notifications)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Pagination != nil {
+		page.Pagination = *meta.Pagination
+	}
+	return &page, nil
+}
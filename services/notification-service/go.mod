@@ -3,16 +3,22 @@ module claude-talimat-notifications
 go 1.19
 
 require (
+	claude-talimat/pkg v0.0.0
+	github.com/alicebob/miniredis/v2 v2.23.1
 	github.com/gin-gonic/gin v1.9.1
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
-	github.com/pusher/pusher-http-go v4.0.1+incompatible
+	github.com/lib/pq v1.10.9
 	github.com/rs/zerolog v1.31.0
+	go.uber.org/goleak v1.2.1
+	golang.org/x/sync v0.3.0
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
+	message-queue-service/client/go v0.0.0
 )
 
 require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/bytedance/sonic v1.9.1 // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
@@ -33,6 +39,7 @@ require (
 	github.com/pelletier/go-toml/v2 v2.0.8 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.11 // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
 	golang.org/x/arch v0.3.0 // indirect
 	golang.org/x/crypto v0.9.0 // indirect
 	golang.org/x/net v0.10.0 // indirect
@@ -42,3 +49,9 @@ require (
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// The shared module is built from the parent directory, see the Dockerfile
+replace claude-talimat/pkg => ../pkg
+
+// The message queue client is built from its service, see the Dockerfile
+replace message-queue-service/client/go => ../message-queue-service/client/go
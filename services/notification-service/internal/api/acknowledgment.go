@@ -0,0 +1,140 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+// ackPage is shown to recipients following an acknowledgment link. Opening the
+// link only shows the form, so mail scanners that prefetch links do not
+// acknowledge on the recipient's behalf.
+var ackPage = template.Must(template.New("ack").Parse(`<!DOCTYPE html>
+<html lang="tr">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Okuma onayı</title>
+</head>
+<body>
+{{if .Acknowledgment}}
+<p>Okuduğunuz {{.Acknowledgment.AcknowledgedAt.Format "02.01.2006 15:04"}} tarihinde kaydedildi. Teşekkürler.</p>
+{{else}}
+<form method="post">
+<p>Talimatı okuduğunuzu ve anladığınızı onaylayın.</p>
+<button type="submit">Okudum, onaylıyorum</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type AckHandler struct {
+	notificationService *services.NotificationService
+}
+
+type SMSReplyRequest struct {
+	From string `json:"from" binding:"required,phone"`
+	Body string `json:"body" binding:"required"`
+}
+
+func NewAckHandler(notificationService *services.NotificationService) *AckHandler {
+	return &AckHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterPublicRoutes registers the acknowledgment link routes. The token in
+// the link is the credential, so they are mounted outside authentication.
+func (h *AckHandler) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	ack := rg.Group("/ack")
+	{
+		ack.GET("/:token", h.ShowAcknowledgment)
+		ack.POST("/:token", h.Acknowledge)
+	}
+}
+
+// RegisterRoutes registers authenticated acknowledgment routes
+func (h *AckHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	ack := rg.Group("/acks")
+	{
+		ack.POST("/sms/inbound", RequireRole(RoleService), h.ReceiveSMSReply)
+		ack.GET("/documents/:document_id/report", RequireRole(RoleAdmin, RoleManager, RoleService), h.GetDocumentReport)
+	}
+}
+
+// ShowAcknowledgment renders the confirmation page of an acknowledgment link
+func (h *AckHandler) ShowAcknowledgment(c *gin.Context) {
+	ack, err := h.notificationService.GetAcknowledgmentStatus(c.Param("token"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get acknowledgment", err)
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	ackPage.Execute(c.Writer, gin.H{"Acknowledgment": ack})
+}
+
+// Acknowledge records the acknowledgment of a token. Browsers submitting the
+// confirmation page get the page back, API clients get JSON.
+func (h *AckHandler) Acknowledge(c *gin.Context) {
+	ack, err := h.notificationService.Acknowledge(c.Param("token"), c.Query("channel"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to acknowledge notification", err)
+		return
+	}
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		ackPage.Execute(c.Writer, gin.H{"Acknowledgment": ack})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ack,
+	})
+}
+
+// ReceiveSMSReply acknowledges the notification an inbound SMS reply refers to
+func (h *AckHandler) ReceiveSMSReply(c *gin.Context) {
+	var req SMSReplyRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	ack, err := h.notificationService.AcknowledgeSMSReply(req.From, req.Body)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to acknowledge SMS reply", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ack,
+	})
+}
+
+// GetDocumentReport returns who acknowledged a document and who has not yet
+func (h *AckHandler) GetDocumentReport(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	report, err := h.notificationService.GetAcknowledgmentReport(tenantID, c.Param("document_id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get acknowledgment report", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
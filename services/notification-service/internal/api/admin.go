@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+)
+
+type AdminHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewAdminHandler(notificationService *services.NotificationService) *AdminHandler {
+	return &AdminHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers the operations dashboard routes. The views span
+// every tenant, so only API-key callers acting across tenants see them.
+func (h *AdminHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	admin := rg.Group("/admin", requireOperator)
+	{
+		admin.GET("/queues", h.GetQueues)
+		admin.GET("/channels", h.GetChannels)
+		admin.GET("/failures", h.GetFailures)
+		admin.GET("/providers", h.GetProviders)
+		admin.GET("/workers", h.GetWorkers)
+		admin.GET("/tenants", h.GetTenants)
+		admin.GET("/storage", h.GetStorage)
+		admin.POST("/storage/cleanup", h.CleanupStorage)
+	}
+}
+
+// GetQueues returns the backlog of the queues
+func (h *AdminHandler) GetQueues(c *gin.Context) {
+	backlogs, err := h.notificationService.QueueBacklogs()
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get queue backlogs", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    backlogs,
+	})
+}
+
+// GetChannels returns the delivery rates of the channels over the last days
+func (h *AdminHandler) GetChannels(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "1"))
+
+	rates, err := h.notificationService.ChannelRates(days)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get channel delivery rates", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rates,
+	})
+}
+
+// GetFailures returns the recent failed deliveries grouped by error class
+func (h *AdminHandler) GetFailures(c *gin.Context) {
+	class := c.Query("class")
+	if class != "" && !services.IsFailureClass(class) {
+		problem.Respond(c, problem.CodeInvalidRequest, "class must be validation, timeout, provider or internal")
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	failures, err := h.notificationService.RecentFailures(class, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get recent failures", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    failures,
+	})
+}
+
+// GetProviders returns the circuit breaker state of the providers
+func (h *AdminHandler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.notificationService.ProviderHealth(),
+	})
+}
+
+// GetWorkers returns the state of the queue workers of this instance
+func (h *AdminHandler) GetWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.notificationService.WorkerStatus(),
+	})
+}
+
+// GetTenants returns the usage of every tenant over the last days
+func (h *AdminHandler) GetTenants(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+
+	usage, err := h.notificationService.TenantUsage(days)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get tenant usage", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    usage,
+	})
+}
+
+// GetStorage returns the keys and memory the service uses in Redis by key
+// prefix
+func (h *AdminHandler) GetStorage(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultStorageReportLimit)))
+
+	report, err := h.notificationService.StorageReport(limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get storage report", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// CleanupStorage removes what expired records left behind now instead of on
+// the next run of the cleanup job
+func (h *AdminHandler) CleanupStorage(c *gin.Context) {
+	cleanup, err := h.notificationService.CleanupStorage()
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to clean up storage", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    cleanup,
+	})
+}
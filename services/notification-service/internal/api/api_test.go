@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/services"
+)
+
+// Credentials the test routers accept
+const (
+	testJWTSecret = "test-jwt-secret"
+	testAPIKey    = "test-api-key"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestNotificationService returns a notification service on miniredis.
+// Its providers aren't reachable, in-app notifications are delivered.
+func newTestNotificationService(t *testing.T) *services.NotificationService {
+	t.Helper()
+
+	redisURL := "redis://" + miniredis.RunT(t).Addr()
+	service, err := services.NewNotificationService(services.NotificationConfig{
+		RedisURL:    redisURL,
+		EmailConfig: services.EmailConfig{Provider: services.EmailProviderSMTP, Host: "127.0.0.1"},
+		SMSConfig: services.SMSConfig{
+			RedisURL: redisURL,
+			Provider: services.SMSProviderNetgsm,
+			APIKey:   "netgsm-user",
+		},
+		PushConfig: services.PushConfig{
+			RedisURL:  redisURL,
+			Provider:  services.PushProviderPusher,
+			AppID:     "instance-1",
+			APISecret: "secret-key",
+		},
+		InAppConfig:     services.InAppConfig{RedisURL: redisURL},
+		WebhookConfig:   services.WebhookConfig{RedisURL: redisURL},
+		TemplateConfig:  services.TemplateConfig{RedisURL: redisURL},
+		RecipientConfig: services.RecipientConfig{RedisURL: redisURL},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notification service: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		service.Shutdown(ctx)
+	})
+	return service
+}
+
+// newTestRouter returns a router authenticating with the test credentials
+func newTestRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(AuthMiddleware(AuthConfig{
+		JWTSecret: testJWTSecret,
+		APIKeys:   map[string]string{"scheduler": testAPIKey},
+	}))
+	return router
+}
+
+// testToken returns a bearer token of the auth service for a user
+func testToken(userID string, tenantID string, role string) string {
+	encode := func(value interface{}) string {
+		data, _ := json.Marshal(value)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(jwtClaims{
+		Subject:   userID,
+		Role:      role,
+		TenantID:  tenantID,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(unsigned))
+	return "Bearer " + unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// serve sends a request to router with headers and a JSON body
+func serve(router http.Handler, method string, path string, headers map[string]string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// decode decodes the JSON body of a response into out
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", recorder.Body.String(), err)
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+)
+
+// Roles known to the notification service. Admin, manager and employee are
+// issued by the auth service; service is given to API-key callers.
+const (
+	RoleAdmin    = "admin"
+	RoleManager  = "manager"
+	RoleEmployee = "employee"
+	RoleService  = "service"
+)
+
+const (
+	// APIKeyHeader carries the key of service-to-service callers
+	APIKeyHeader = "X-API-Key"
+	// TenantHeader lets API-key callers act on behalf of a tenant
+	TenantHeader = "X-Tenant-ID"
+
+	identityContextKey = "identity"
+)
+
+// AuthConfig holds authentication configuration
+type AuthConfig struct {
+	JWTSecret string            // HS256 secret shared with the auth service
+	APIKeys   map[string]string // service name -> API key
+}
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	UserID   string `json:"user_id"`
+	TenantID string `json:"tenant_id"`
+	Role     string `json:"role"`
+	Email    string `json:"email,omitempty"`
+}
+
+// IsAdmin reports whether the caller administers its tenant
+func (i *Identity) IsAdmin() bool {
+	return i.Role == RoleAdmin
+}
+
+// CanAccessTenant reports whether the caller may read or change data of a tenant.
+// API-key callers that did not pick a tenant act across tenants.
+func (i *Identity) CanAccessTenant(tenantID string) bool {
+	if i.Role == RoleService && i.TenantID == "" {
+		return true
+	}
+	return tenantID == i.TenantID
+}
+
+// CanAccessUser reports whether the caller may read or change data of a user.
+// Users only see their own data, admins and services see their whole tenant.
+func (i *Identity) CanAccessUser(tenantID string, userID string) bool {
+	if !i.CanAccessTenant(tenantID) {
+		return false
+	}
+	return userID == i.UserID || i.Role == RoleAdmin || i.Role == RoleService
+}
+
+// ResolveTenant returns the tenant a request acts on. Only API-key callers that
+// did not pick a tenant may name one in the request.
+func (i *Identity) ResolveTenant(requested string) string {
+	if i.Role == RoleService && i.TenantID == "" {
+		return requested
+	}
+	return i.TenantID
+}
+
+// jwtClaims are the claims of tokens issued by the auth service
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	TenantID  string `json:"tenantId"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// AuthMiddleware authenticates requests with a bearer JWT or an API key and
+// stores the caller's identity on the context. Tenant and user are always
+// taken from the credentials, never from the request body.
+func AuthMiddleware(config AuthConfig) gin.HandlerFunc {
+	// Hash API keys once so lookups compare fixed-size values in constant time
+	apiKeys := make(map[string][32]byte, len(config.APIKeys))
+	for name, key := range config.APIKeys {
+		if key != "" {
+			apiKeys[name] = sha256.Sum256([]byte(key))
+		}
+	}
+
+	return func(c *gin.Context) {
+		var identity *Identity
+		var err error
+
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			identity, err = authenticateAPIKey(apiKeys, key, c.GetHeader(TenantHeader))
+		} else if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			identity, err = authenticateJWT(config.JWTSecret, strings.TrimPrefix(header, "Bearer "))
+		} else {
+			err = errors.New("bearer token or API key required")
+		}
+
+		if err != nil {
+			problem.Abort(c, problem.CodeUnauthorized, err.Error())
+			return
+		}
+
+		c.Set(identityContextKey, identity)
+		c.Next()
+	}
+}
+
+// RequireRole rejects callers whose role is not one of the given roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := GetIdentity(c)
+		if identity == nil {
+			problem.Abort(c, problem.CodeUnauthorized, "Authentication required")
+			return
+		}
+
+		for _, role := range roles {
+			if identity.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		problem.Abort(c, problem.CodeForbidden, "Insufficient permissions")
+	}
+}
+
+// GetIdentity returns the authenticated caller of a request
+func GetIdentity(c *gin.Context) *Identity {
+	value, ok := c.Get(identityContextKey)
+	if !ok {
+		return nil
+	}
+	identity, _ := value.(*Identity)
+	return identity
+}
+
+// authenticateAPIKey resolves the service an API key belongs to
+func authenticateAPIKey(apiKeys map[string][32]byte, key string, tenantID string) (*Identity, error) {
+	sum := sha256.Sum256([]byte(key))
+
+	for name, expected := range apiKeys {
+		if subtle.ConstantTimeCompare(sum[:], expected[:]) == 1 {
+			return &Identity{
+				UserID:   "service:" + name,
+				TenantID: tenantID,
+				Role:     RoleService,
+			}, nil
+		}
+	}
+
+	return nil, errors.New("invalid API key")
+}
+
+// authenticateJWT verifies an HS256 token issued by the auth service
+func authenticateJWT(secret string, token string) (*Identity, error) {
+	if secret == "" {
+		return nil, errors.New("token authentication is not configured")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Algorithm != "HS256" {
+		return nil, errors.New("unsupported token algorithm")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	var claims jwtClaims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt == 0 || claims.ExpiresAt < now {
+		return nil, errors.New("token expired")
+	}
+	if claims.NotBefore != 0 && claims.NotBefore > now {
+		return nil, errors.New("token not yet valid")
+	}
+	if claims.Subject == "" || claims.TenantID == "" {
+		return nil, errors.New("token has no user or tenant")
+	}
+
+	return &Identity{
+		UserID:   claims.Subject,
+		TenantID: claims.TenantID,
+		Role:     claims.Role,
+		Email:    claims.Email,
+	}, nil
+}
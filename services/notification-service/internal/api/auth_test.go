@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCallersWithoutValidCredentialsAreRejected(t *testing.T) {
+	router := newTestRouter()
+	router.GET("/notifications/history", func(c *gin.Context) {
+		c.JSON(http.StatusOK, GetIdentity(c))
+	})
+
+	token := testToken("user-1", "tenant-a", RoleEmployee)
+	for name, headers := range map[string]map[string]string{
+		"no credentials":  {},
+		"unknown API key": {APIKeyHeader: "other-key"},
+		"forged token":    {"Authorization": token[:len(token)-4] + "AAAA"},
+		"malformed token": {"Authorization": "Bearer token"},
+	} {
+		if recorder := serve(router, http.MethodGet, "/notifications/history", headers, nil); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to be unauthorized, got %d", name, recorder.Code)
+		}
+	}
+
+	var identity Identity
+	decode(t, serve(router, http.MethodGet, "/notifications/history", map[string]string{APIKeyHeader: testAPIKey, TenantHeader: "tenant-a"}, nil), &identity)
+	if identity.UserID != "service:scheduler" || identity.TenantID != "tenant-a" || identity.Role != RoleService {
+		t.Errorf("Expected API keys to authenticate their service for the tenant named, got %+v", identity)
+	}
+
+	decode(t, serve(router, http.MethodGet, "/notifications/history", map[string]string{"Authorization": testToken("user-1", "tenant-a", RoleManager)}, nil), &identity)
+	if identity.UserID != "user-1" || identity.TenantID != "tenant-a" || identity.Role != RoleManager {
+		t.Errorf("Expected tokens to authenticate their user, got %+v", identity)
+	}
+}
+
+func TestRolesAreRequiredWhereRestricted(t *testing.T) {
+	router := newTestRouter()
+	router.POST("/templates/", RequireRole(RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	for role, expected := range map[string]int{
+		RoleAdmin:    http.StatusCreated,
+		RoleManager:  http.StatusForbidden,
+		RoleEmployee: http.StatusForbidden,
+	} {
+		headers := map[string]string{"Authorization": testToken("user-1", "tenant-a", role)}
+		if recorder := serve(router, http.MethodPost, "/templates/", headers, nil); recorder.Code != expected {
+			t.Errorf("Expected %s to get %d, got %d", role, expected, recorder.Code)
+		}
+	}
+}
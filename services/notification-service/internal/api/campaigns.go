@@ -0,0 +1,209 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type CampaignHandler struct {
+	campaignService *services.CampaignService
+}
+
+func NewCampaignHandler(campaignService *services.CampaignService) *CampaignHandler {
+	return &CampaignHandler{
+		campaignService: campaignService,
+	}
+}
+
+// RegisterRoutes registers campaign routes
+func (h *CampaignHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	campaigns := rg.Group("/campaigns")
+	campaigns.Use(RequireRole(RoleAdmin, RoleManager, RoleService))
+	{
+		campaigns.GET("/", h.ListCampaigns)
+		campaigns.POST("/", h.CreateCampaign)
+		campaigns.GET("/:id", h.authorizeCampaign, h.GetCampaign)
+		campaigns.PUT("/:id", h.authorizeCampaign, h.UpdateCampaign)
+		campaigns.DELETE("/:id", h.authorizeCampaign, h.DeleteCampaign)
+		campaigns.POST("/:id/schedule", h.authorizeCampaign, h.ScheduleCampaign)
+		campaigns.POST("/:id/start", h.authorizeCampaign, h.StartCampaign)
+		campaigns.POST("/:id/pause", h.authorizeCampaign, h.PauseCampaign)
+		campaigns.POST("/:id/resume", h.authorizeCampaign, h.ResumeCampaign)
+		campaigns.GET("/:id/progress", h.authorizeCampaign, h.GetCampaignProgress)
+	}
+}
+
+// authorizeCampaign rejects access to campaigns of other tenants. Campaigns of
+// other tenants are reported as missing so their IDs cannot be probed.
+func (h *CampaignHandler) authorizeCampaign(c *gin.Context) {
+	campaign, err := h.campaignService.GetCampaign(c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(campaign.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Campaign not found")
+		return
+	}
+
+	c.Next()
+}
+
+// CreateCampaign handles creating a campaign
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var request services.Campaign
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	request.TenantID = identity.ResolveTenant(request.TenantID)
+	request.CreatedBy = identity.UserID
+
+	campaign, err := h.campaignService.CreateCampaign(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create campaign", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    campaign,
+	})
+}
+
+// ListCampaigns returns the campaigns of a tenant
+func (h *CampaignHandler) ListCampaigns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	campaigns, err := h.campaignService.ListCampaigns(tenantID, c.Query("status"), page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list campaigns", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    campaigns,
+	})
+}
+
+// GetCampaign returns a single campaign
+func (h *CampaignHandler) GetCampaign(c *gin.Context) {
+	campaign, err := h.campaignService.GetCampaign(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Campaign not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    campaign,
+	})
+}
+
+// UpdateCampaign handles updating a draft campaign
+func (h *CampaignHandler) UpdateCampaign(c *gin.Context) {
+	var request services.Campaign
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	campaign, err := h.campaignService.UpdateCampaign(c.Param("id"), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update campaign", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    campaign,
+	})
+}
+
+// DeleteCampaign handles deleting a campaign
+func (h *CampaignHandler) DeleteCampaign(c *gin.Context) {
+	if err := h.campaignService.DeleteCampaign(c.Param("id")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete campaign", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Campaign deleted successfully"),
+	})
+}
+
+// ScheduleCampaign handles scheduling a campaign
+func (h *CampaignHandler) ScheduleCampaign(c *gin.Context) {
+	var request struct {
+		ScheduleAt time.Time `json:"schedule_at" binding:"required"`
+	}
+
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	campaign, err := h.campaignService.ScheduleCampaign(c.Param("id"), request.ScheduleAt)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to schedule campaign", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    campaign,
+	})
+}
+
+// StartCampaign handles starting a campaign immediately
+func (h *CampaignHandler) StartCampaign(c *gin.Context) {
+	h.transition(c, h.campaignService.StartCampaign, "start")
+}
+
+// PauseCampaign handles pausing a running campaign
+func (h *CampaignHandler) PauseCampaign(c *gin.Context) {
+	h.transition(c, h.campaignService.PauseCampaign, "pause")
+}
+
+// ResumeCampaign handles resuming a paused campaign
+func (h *CampaignHandler) ResumeCampaign(c *gin.Context) {
+	h.transition(c, h.campaignService.ResumeCampaign, "resume")
+}
+
+// GetCampaignProgress returns the delivery progress of a campaign
+func (h *CampaignHandler) GetCampaignProgress(c *gin.Context) {
+	progress, err := h.campaignService.GetCampaignProgress(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get campaign progress", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    progress,
+	})
+}
+
+// transition applies a lifecycle transition to a campaign
+func (h *CampaignHandler) transition(c *gin.Context, apply func(string) (*services.Campaign, error), action string) {
+	campaign, err := apply(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to "+action+" campaign", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    campaign,
+	})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type CategoryHandler struct {
+	notificationService *services.NotificationService
+}
+
+// categoryRequest is the description and defaults of a notification category
+type categoryRequest struct {
+	Description     string   `json:"description,omitempty" binding:"max=500"`
+	DefaultPriority string   `json:"default_priority,omitempty" binding:"omitempty,priority"`
+	DefaultChannels []string `json:"default_channels,omitempty"`
+	UserMutable     bool     `json:"user_mutable"`
+}
+
+func (r categoryRequest) category(tenantID string, name string) services.NotificationCategory {
+	return services.NotificationCategory{
+		TenantID:        tenantID,
+		Name:            name,
+		Description:     r.Description,
+		DefaultPriority: r.DefaultPriority,
+		DefaultChannels: r.DefaultChannels,
+		UserMutable:     r.UserMutable,
+	}
+}
+
+func NewCategoryHandler(notificationService *services.NotificationService) *CategoryHandler {
+	return &CategoryHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers notification category routes. Everyone may see the
+// categories of their tenant, admins manage them.
+func (h *CategoryHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	categories := rg.Group("/categories")
+	{
+		categories.GET("", h.ListCategories)
+		categories.POST("", RequireRole(RoleAdmin), h.CreateCategory)
+		categories.GET("/:name", h.GetCategory)
+		categories.PUT("/:name", RequireRole(RoleAdmin), h.UpdateCategory)
+		categories.DELETE("/:name", RequireRole(RoleAdmin), h.DeleteCategory)
+	}
+}
+
+// ListCategories returns the notification categories of a tenant
+func (h *CategoryHandler) ListCategories(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	categories, err := h.notificationService.ListCategories(c.Request.Context(), tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list categories", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    categories,
+	})
+}
+
+// CreateCategory registers a notification category
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var request struct {
+		Name string `json:"name" binding:"required,max=64"`
+		categoryRequest
+	}
+
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+	category, err := h.notificationService.CreateCategory(c.Request.Context(), request.category(tenantID, request.Name))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create category", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    category,
+	})
+}
+
+// GetCategory returns a single notification category
+func (h *CategoryHandler) GetCategory(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	category, err := h.notificationService.GetCategory(c.Request.Context(), tenantID, c.Param("name"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Category not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    category,
+	})
+}
+
+// UpdateCategory replaces the description and defaults of a notification category
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	var request categoryRequest
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+	category, err := h.notificationService.UpdateCategory(c.Request.Context(), request.category(tenantID, c.Param("name")))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    category,
+	})
+}
+
+// DeleteCategory deletes a notification category
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	if err := h.notificationService.DeleteCategory(c.Request.Context(), tenantID, c.Param("name")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Category deleted successfully"),
+	})
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat-notifications/models"
+	"claude-talimat/pkg/validation"
+)
+
+const contactPointContextKey = "contact_point"
+
+type ContactPointHandler struct {
+	notificationService *services.NotificationService
+}
+
+type ContactPointRequest struct {
+	UserID       string                 `json:"user_id"`
+	EmailEnabled bool                   `json:"email_enabled"`
+	SMSEnabled   bool                   `json:"sms_enabled"`
+	PushEnabled  bool                   `json:"push_enabled"`
+	InAppEnabled bool                   `json:"in_app_enabled"`
+	EmailAddress *string                `json:"email_address" binding:"omitempty,email"`
+	PhoneNumber  *string                `json:"phone_number" binding:"omitempty,phone"`
+	PushToken    *string                `json:"push_token"`
+	Categories   []string               `json:"categories"`
+	Frequency    string                 `json:"frequency" binding:"omitempty,oneof=immediate hourly daily weekly"`
+	QuietHours   *models.QuietHours     `json:"quiet_hours"`
+	Metadata     map[string]interface{} `json:"metadata"`
+}
+
+type ConfirmPhoneRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func NewContactPointHandler(notificationService *services.NotificationService) *ContactPointHandler {
+	return &ContactPointHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterPublicRoutes registers the email confirmation link route. The token
+// in the link is the credential, so it is mounted outside authentication.
+func (h *ContactPointHandler) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	rg.GET("/contact-points/confirm/:token", h.ConfirmEmail)
+}
+
+// RegisterRoutes registers contact point routes. Users manage their own
+// contact points, admins and services may pass user_id.
+func (h *ContactPointHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	contactPoints := rg.Group("/contact-points")
+	{
+		contactPoints.POST("", h.CreateContactPoint)
+		contactPoints.GET("", h.ListContactPoints)
+		contactPoints.GET("/:id", h.authorizeContactPoint, h.GetContactPoint)
+		contactPoints.PUT("/:id", h.authorizeContactPoint, h.UpdateContactPoint)
+		contactPoints.DELETE("/:id", h.authorizeContactPoint, h.DeleteContactPoint)
+		contactPoints.POST("/:id/verify/email", h.authorizeContactPoint, h.VerifyEmail)
+		contactPoints.POST("/:id/verify/phone", h.authorizeContactPoint, h.VerifyPhone)
+		contactPoints.POST("/:id/confirm/phone", h.authorizeContactPoint, h.ConfirmPhone)
+	}
+}
+
+// authorizeContactPoint loads the contact point of the request and rejects
+// access to other users' contact points
+func (h *ContactPointHandler) authorizeContactPoint(c *gin.Context) {
+	contactPoint, err := h.notificationService.GetContactPoint(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get contact point", err)
+		c.Abort()
+		return
+	}
+
+	if !GetIdentity(c).CanAccessUser(contactPoint.TenantID, contactPoint.UserID) {
+		problem.Abort(c, problem.CodeNotFound, "Contact point not found")
+		return
+	}
+
+	c.Set(contactPointContextKey, contactPoint)
+	c.Next()
+}
+
+// CreateContactPoint adds a contact point for the caller or, for admins and
+// services, the user in the request
+func (h *ContactPointHandler) CreateContactPoint(c *gin.Context) {
+	var req ContactPointRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(c.Query("tenant_id"))
+	if req.UserID == "" {
+		req.UserID = identity.UserID
+	}
+	if !identity.CanAccessUser(tenantID, req.UserID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to add contact points of this user")
+		return
+	}
+
+	contactPoint := req.model()
+	contactPoint.TenantID = tenantID
+
+	created, err := h.notificationService.CreateContactPoint(contactPoint)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create contact point", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    created,
+	})
+}
+
+// ListContactPoints lists the contact points of the caller or, for admins and
+// services, of the user in the query
+func (h *ContactPointHandler) ListContactPoints(c *gin.Context) {
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(c.Query("tenant_id"))
+	userID := c.DefaultQuery("user_id", identity.UserID)
+	if !identity.CanAccessUser(tenantID, userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to list contact points of this user")
+		return
+	}
+
+	contactPoints, err := h.notificationService.ListContactPoints(tenantID, userID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list contact points", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    contactPoints,
+	})
+}
+
+// GetContactPoint returns a contact point
+func (h *ContactPointHandler) GetContactPoint(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    contactPoint(c),
+	})
+}
+
+// UpdateContactPoint replaces the addresses and preferences of a contact
+// point, changed addresses have to be verified again
+func (h *ContactPointHandler) UpdateContactPoint(c *gin.Context) {
+	var req ContactPointRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	updated, err := h.notificationService.UpdateContactPoint(contactPoint(c).ID, req.model())
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update contact point", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// DeleteContactPoint deletes a contact point
+func (h *ContactPointHandler) DeleteContactPoint(c *gin.Context) {
+	if err := h.notificationService.DeleteContactPoint(contactPoint(c).ID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete contact point", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Contact point deleted successfully"),
+	})
+}
+
+// VerifyEmail emails a confirmation link to the address of a contact point
+func (h *ContactPointHandler) VerifyEmail(c *gin.Context) {
+	if err := h.notificationService.RequestEmailVerification(c.Request.Context(), contactPoint(c).ID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to send confirmation link", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": localize(c, "Confirmation link sent"),
+	})
+}
+
+// ConfirmEmail verifies the email address of the confirmation link
+func (h *ContactPointHandler) ConfirmEmail(c *gin.Context) {
+	confirmed, err := h.notificationService.ConfirmEmail(c.Param("token"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to confirm email address", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    confirmed,
+	})
+}
+
+// VerifyPhone texts a verification code to the phone number of a contact point
+func (h *ContactPointHandler) VerifyPhone(c *gin.Context) {
+	if err := h.notificationService.RequestPhoneVerification(c.Request.Context(), contactPoint(c).ID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to send verification code", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": localize(c, "Verification code sent"),
+	})
+}
+
+// ConfirmPhone verifies the phone number of a contact point with the code
+// texted to it
+func (h *ContactPointHandler) ConfirmPhone(c *gin.Context) {
+	var req ConfirmPhoneRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	confirmed, err := h.notificationService.ConfirmPhone(c.Request.Context(), contactPoint(c).ID, req.Code)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to confirm phone number", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    confirmed,
+	})
+}
+
+// contactPoint returns the contact point authorizeContactPoint loaded
+func contactPoint(c *gin.Context) *models.NotificationSubscription {
+	value, _ := c.Get(contactPointContextKey)
+	contactPoint, _ := value.(*models.NotificationSubscription)
+	return contactPoint
+}
+
+// model returns the contact point a request describes
+func (r ContactPointRequest) model() models.NotificationSubscription {
+	return models.NotificationSubscription{
+		UserID:       r.UserID,
+		EmailEnabled: r.EmailEnabled,
+		SMSEnabled:   r.SMSEnabled,
+		PushEnabled:  r.PushEnabled,
+		InAppEnabled: r.InAppEnabled,
+		EmailAddress: r.EmailAddress,
+		PhoneNumber:  r.PhoneNumber,
+		PushToken:    r.PushToken,
+		Categories:   r.Categories,
+		Frequency:    r.Frequency,
+		QuietHours:   r.QuietHours,
+		Metadata:     r.Metadata,
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+const subscriptionContextKey = "push_subscription"
+
+type DeviceHandler struct {
+	pushService *services.PushNotificationService
+}
+
+type RegisterDeviceRequest struct {
+	UserID      string            `json:"user_id"`
+	DeviceToken string            `json:"device_token" binding:"required"`
+	Platform    string            `json:"platform" binding:"required,oneof=ios android web"`
+	AppVersion  string            `json:"app_version"`
+	DeviceModel string            `json:"device_model"`
+	OSVersion   string            `json:"os_version"`
+	Language    string            `json:"language"`
+	Timezone    string            `json:"timezone"`
+	Tags        map[string]string `json:"tags"`
+}
+
+type RefreshDeviceRequest struct {
+	DeviceToken string            `json:"device_token"`
+	AppVersion  string            `json:"app_version"`
+	DeviceModel string            `json:"device_model"`
+	OSVersion   string            `json:"os_version"`
+	Language    string            `json:"language"`
+	Timezone    string            `json:"timezone"`
+	Tags        map[string]string `json:"tags"`
+}
+
+func NewDeviceHandler(pushService *services.PushNotificationService) *DeviceHandler {
+	return &DeviceHandler{
+		pushService: pushService,
+	}
+}
+
+// RegisterRoutes registers push device routes. Apps register the devices of
+// the signed-in user, admins and services may pass user_id.
+func (h *DeviceHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	devices := rg.Group("/devices")
+	{
+		devices.POST("", h.RegisterDevice)
+		devices.GET("", h.ListDevices)
+		devices.GET("/pruned", RequireRole(RoleAdmin, RoleManager, RoleService), h.GetPrunedTokenReport)
+		devices.GET("/beams-auth", h.BeamsAuth)
+		devices.GET("/:id", h.authorizeSubscription, h.GetDevice)
+		devices.PUT("/:id", h.authorizeSubscription, h.RefreshDevice)
+		devices.POST("/:id/deactivate", h.authorizeSubscription, h.DeactivateDevice)
+		devices.DELETE("/:id", h.authorizeSubscription, h.DeleteDevice)
+	}
+}
+
+// authorizeSubscription loads the subscription of the request and rejects
+// access to other users' devices
+func (h *DeviceHandler) authorizeSubscription(c *gin.Context) {
+	subscription, err := h.pushService.GetSubscription(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get device", err)
+		c.Abort()
+		return
+	}
+
+	if !GetIdentity(c).CanAccessUser(subscription.TenantID, subscription.UserID) {
+		problem.Abort(c, problem.CodeNotFound, "Device not found")
+		return
+	}
+
+	c.Set(subscriptionContextKey, subscription)
+	c.Next()
+}
+
+// RegisterDevice registers the push token of a device
+func (h *DeviceHandler) RegisterDevice(c *gin.Context) {
+	var req RegisterDeviceRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(c.Query("tenant_id"))
+	userID := req.UserID
+	if userID == "" {
+		userID = identity.UserID
+	}
+	if !identity.CanAccessUser(tenantID, userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to register devices of this user")
+		return
+	}
+
+	subscription, err := h.pushService.RegisterSubscription(services.PushSubscription{
+		UserID:      userID,
+		TenantID:    tenantID,
+		DeviceToken: req.DeviceToken,
+		Platform:    req.Platform,
+		AppVersion:  req.AppVersion,
+		DeviceModel: req.DeviceModel,
+		OSVersion:   req.OSVersion,
+		Language:    req.Language,
+		Timezone:    req.Timezone,
+		Tags:        req.Tags,
+	})
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to register device", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    subscription,
+	})
+}
+
+// ListDevices returns the registered devices of a user
+func (h *DeviceHandler) ListDevices(c *gin.Context) {
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(c.Query("tenant_id"))
+	userID := c.DefaultQuery("user_id", identity.UserID)
+	if !identity.CanAccessUser(tenantID, userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to list devices of this user")
+		return
+	}
+
+	subscriptions, err := h.pushService.GetUserSubscriptions(userID, tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get devices", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    subscriptions,
+	})
+}
+
+// GetDevice returns a registered device
+func (h *DeviceHandler) GetDevice(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    pushSubscription(c),
+	})
+}
+
+// RefreshDevice updates a registered device, e.g. with a rotated token
+func (h *DeviceHandler) RefreshDevice(c *gin.Context) {
+	var req RefreshDeviceRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	subscription, err := h.pushService.RefreshSubscription(pushSubscription(c).ID, services.PushSubscription{
+		DeviceToken: req.DeviceToken,
+		AppVersion:  req.AppVersion,
+		DeviceModel: req.DeviceModel,
+		OSVersion:   req.OSVersion,
+		Language:    req.Language,
+		Timezone:    req.Timezone,
+		Tags:        req.Tags,
+	})
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to refresh device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    subscription,
+	})
+}
+
+// DeactivateDevice stops pushes to a device, e.g. after the user signed out
+func (h *DeviceHandler) DeactivateDevice(c *gin.Context) {
+	subscription, err := h.pushService.DeactivateSubscription(pushSubscription(c).ID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to deactivate device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    subscription,
+	})
+}
+
+// DeleteDevice deletes a registered device
+func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
+	if err := h.pushService.DeleteSubscription(pushSubscription(c).ID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Device deleted"),
+	})
+}
+
+// GetPrunedTokenReport returns the device tokens of a tenant that providers
+// rejected and that were pruned from sends
+func (h *DeviceHandler) GetPrunedTokenReport(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if days < 1 || days > 90 {
+		days = 30
+	}
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	report, err := h.pushService.GetPrunedTokenReport(tenantID, since, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get pruned token report", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// BeamsAuth issues the token the Pusher Beams SDK signs a device in with. The
+// SDK's token provider passes user_id and expects the token at the top level
+// of the response, so it is not wrapped like other responses.
+func (h *DeviceHandler) BeamsAuth(c *gin.Context) {
+	identity := GetIdentity(c)
+	userID := c.DefaultQuery("user_id", identity.UserID)
+	if !identity.CanAccessUser(identity.ResolveTenant(c.Query("tenant_id")), userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to sign in devices as this user")
+		return
+	}
+
+	token, expiresAt, err := h.pushService.GenerateBeamsToken(userID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to generate Beams token", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
+
+// pushSubscription returns the subscription loaded by authorizeSubscription
+func pushSubscription(c *gin.Context) *services.PushSubscription {
+	return c.MustGet(subscriptionContextKey).(*services.PushSubscription)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+// maxFeedbackBody limits the size of the event batches providers post
+const maxFeedbackBody = 5 << 20
+
+type EmailHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewEmailHandler(notificationService *services.NotificationService) *EmailHandler {
+	return &EmailHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers email suppression routes. Bounces of SMTP relays,
+// which have no webhooks, are reported by services on the feedback route.
+func (h *EmailHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	email := rg.Group("/email")
+	email.Use(RequireRole(RoleAdmin, RoleService))
+	{
+		email.GET("/suppressions", h.GetSuppressions)
+		email.POST("/suppressions", h.AddSuppression)
+		email.DELETE("/suppressions/:email", h.RemoveSuppression)
+		email.POST("/feedback", RequireRole(RoleService), h.ReportFeedback)
+	}
+}
+
+// RegisterPublicRoutes registers the bounce and complaint routes email providers
+// call, each post is verified by the signature or token its provider uses
+func (h *EmailHandler) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	rg.POST("/email/feedback/:provider", h.ReceiveFeedback)
+}
+
+// ReceiveFeedback applies the bounces and complaints an email provider posted
+func (h *EmailHandler) ReceiveFeedback(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxFeedbackBody))
+	if err != nil {
+		problem.Respond(c, problem.CodeInvalidRequest, "Invalid feedback: "+err.Error())
+		return
+	}
+
+	callback := services.EmailCallback{
+		URL:    c.Request.URL.String(),
+		Query:  c.Request.URL.Query(),
+		Header: c.Request.Header,
+		Body:   body,
+	}
+
+	if err := h.notificationService.ReceiveEmailFeedback(c.Param("provider"), callback); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to apply email feedback", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReportFeedback applies a bounce or complaint reported by a service
+func (h *EmailHandler) ReportFeedback(c *gin.Context) {
+	var request services.EmailFeedback
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	if err := h.notificationService.ApplyEmailFeedback(request); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to apply email feedback", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Email feedback applied"),
+	})
+}
+
+// GetSuppressions returns the suppressed addresses of the caller's tenant
+func (h *EmailHandler) GetSuppressions(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	suppressions, err := h.notificationService.GetEmailSuppressions(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get email suppressions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    suppressions,
+	})
+}
+
+// AddSuppression stops the email of the caller's tenant to an address
+func (h *EmailHandler) AddSuppression(c *gin.Context) {
+	var request services.EmailSuppression
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	request.Reason = services.SuppressionManual
+	suppression, err := h.notificationService.AddEmailSuppression(tenantID, request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to add email suppression", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    suppression,
+	})
+}
+
+// RemoveSuppression lets the email of the caller's tenant reach an address again
+func (h *EmailHandler) RemoveSuppression(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	if err := h.notificationService.RemoveEmailSuppression(tenantID, c.Param("email")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to remove email suppression", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Email suppression removed"),
+	})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/i18n"
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/secrets"
+	"claude-talimat/pkg/validation"
+)
+
+// respondError renders a service error as a problem. The error kind decides the
+// code, fallback is used for errors that carry none. Secrets are redacted from
+// the detail.
+func respondError(c *gin.Context, fallback problem.Code, message string, err error) {
+	detail := secrets.Redact(localize(c, message) + ": " + err.Error())
+
+	var circuitErr *services.CircuitOpenError
+	var providerErr *services.ProviderError
+	var rateLimitErr *services.RateLimitError
+	var variablesErr *services.VariablesError
+
+	switch {
+	case errors.As(err, &circuitErr):
+		retryAfter := int(math.Ceil(time.Until(circuitErr.RetryAt).Seconds()))
+		problem.Write(c, problem.New(problem.CodeProviderUnavailable, detail).WithRetryAfter(retryAfter))
+	case errors.As(err, &rateLimitErr):
+		retryAfter := int(math.Ceil(time.Until(rateLimitErr.RetryAt).Seconds()))
+		problem.Write(c, problem.New(problem.CodeRateLimited, detail).WithRetryAfter(retryAfter))
+	case errors.As(err, &providerErr):
+		problem.Respond(c, problem.CodeProviderFailure, detail)
+	case errors.As(err, &variablesErr):
+		p := problem.New(problem.CodeValidationFailed, detail)
+		for _, variableErr := range variablesErr.Errors {
+			p.WithErrors(problem.FieldError{
+				Field:   "data." + variableErr.Variable,
+				Rule:    variableErr.Rule,
+				Message: variableErr.Message,
+			})
+		}
+		problem.Write(c, p)
+	case errors.Is(err, services.ErrValidation):
+		problem.Respond(c, problem.CodeValidationFailed, detail)
+	case errors.Is(err, services.ErrNotFound):
+		problem.Respond(c, problem.CodeNotFound, detail)
+	case errors.Is(err, services.ErrConflict):
+		problem.Respond(c, problem.CodeConflict, detail)
+	case errors.Is(err, services.ErrUnauthorized):
+		problem.Respond(c, problem.CodeUnauthorized, detail)
+	default:
+		problem.Respond(c, fallback, detail)
+	}
+}
+
+// respondBindError renders a request body that failed to bind, listing the
+// offending fields when they are known
+func respondBindError(c *gin.Context, message string, err error) {
+	p := problem.New(problem.CodeInvalidRequest, localize(c, message)+": "+err.Error())
+
+	for _, field := range validation.Fields(err) {
+		p.WithErrors(problem.FieldError{
+			Field:   field.Field,
+			Rule:    field.Rule,
+			Message: field.Message,
+		})
+	}
+
+	problem.Write(c, p)
+}
+
+// localize returns an API string in the locale of the request
+func localize(c *gin.Context, text string) string {
+	return i18n.Translate(i18n.FromContext(c), text)
+}
@@ -1,167 +1,291 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
+	"claude-talimat-notifications/internal/problem"
 	"claude-talimat-notifications/internal/services"
-	"claude-talimat-notifications/models"
+	"claude-talimat/pkg/validation"
 )
 
 type NotificationHandler struct {
 	notificationService *services.NotificationService
-	emailService        *services.EmailService
-	smsService          *services.SMSService
-	pushService         *services.PushService
+	idempotencyService  *services.IdempotencyService
 }
 
-func NewNotificationHandler(
-	notificationService *services.NotificationService,
-	emailService *services.EmailService,
-	smsService *services.SMSService,
-	pushService *services.PushService,
-) *NotificationHandler {
+func NewNotificationHandler(notificationService *services.NotificationService, idempotencyService *services.IdempotencyService) *NotificationHandler {
 	return &NotificationHandler{
 		notificationService: notificationService,
-		emailService:        emailService,
-		smsService:          smsService,
-		pushService:         pushService,
+		idempotencyService:  idempotencyService,
 	}
 }
 
-// SendNotification handles sending a single notification
+// RegisterRoutes registers notification routes. AuthMiddleware must run before them.
+func (h *NotificationHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	// Sends are retried by clients, an Idempotency-Key makes the retry safe
+	idempotent := IdempotencyMiddleware(h.idempotencyService)
+
+	notifications := rg.Group("/notifications")
+	{
+		notifications.POST("/send", idempotent, h.SendNotification)
+		notifications.POST("/send-bulk", idempotent, h.SendBulkNotifications)
+		notifications.POST("/broadcast", RequireRole(RoleAdmin, RoleManager, RoleService), h.BroadcastNotification)
+		notifications.POST("/mentions", h.SendMention)
+		notifications.GET("/history", h.GetNotificationHistory)
+		notifications.GET("/:id/status", h.GetNotificationStatus)
+		notifications.GET("/:id/timeline", h.GetNotificationTimeline)
+		notifications.POST("/status-batch", h.GetNotificationStatusBatch)
+		notifications.POST("/test", RequireRole(RoleAdmin), h.TestNotification)
+	}
+
+	// Templates are shared by the whole tenant, only admins change them
+	templates := rg.Group("/templates")
+	{
+		templates.GET("/", h.GetTemplates)
+		templates.POST("/", RequireRole(RoleAdmin), h.CreateTemplate)
+		templates.PUT("/:id", RequireRole(RoleAdmin), h.UpdateTemplate)
+		templates.DELETE("/:id", RequireRole(RoleAdmin), h.DeleteTemplate)
+	}
+
+	preferences := rg.Group("/preferences")
+	{
+		preferences.GET("/:user_id", h.GetUserPreferences)
+		preferences.PUT("/:user_id", h.UpdateUserPreferences)
+	}
+}
+
+// SendNotification handles sending a single notification. Channels, when
+// given, send the notification on each of them instead of its type, without
+// a type it goes out on the default channels of its category.
 func (h *NotificationHandler) SendNotification(c *gin.Context) {
 	var request struct {
-		Type        string                 `json:"type" binding:"required"`
+		Type        string                 `json:"type,omitempty"`
+		Category    string                 `json:"category,omitempty"`
 		RecipientID string                 `json:"recipient_id" binding:"required"`
 		Title       string                 `json:"title" binding:"required"`
 		Message     string                 `json:"message" binding:"required"`
 		Data        map[string]interface{} `json:"data,omitempty"`
-		Priority    string                 `json:"priority,omitempty"`
+		Priority    string                 `json:"priority,omitempty" binding:"omitempty,priority"`
 		Channels    []string               `json:"channels,omitempty"`
+		// Content per locale, title and message are sent to recipients whose
+		// language has none
+		Localizations map[string]services.LocalizedContent `json:"localizations,omitempty"`
+		// Files the in-app notification carries, other channels leave them out
+		Attachments []services.InAppAttachment `json:"attachments,omitempty"`
+		// Receives the status changes of the notification as signed events
+		CallbackURL string `json:"callback_url,omitempty" binding:"omitempty,url"`
+		// Held back for the digest of recipients who prefer digests
+		Digestible bool `json:"digestible,omitempty"`
+		// Merged into a notification sent with the same key within the collapse window
+		CollapseKey string `json:"collapse_key,omitempty" binding:"omitempty,max=128"`
+		// Tenant sent for, only API-key callers acting across tenants name one
+		TenantID string `json:"tenant_id,omitempty"`
+	}
+
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(request.TenantID)
+	if tenantID == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "tenant_id is required")
+		return
+	}
+	channels, ok := h.categoryChannels(c, tenantID, request.Type, request.Category, request.Channels)
+	if !ok {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid request data: " + err.Error(),
+	var notificationIDs []string
+	for _, channel := range notificationChannels(request.Type, channels) {
+		result, err := h.notificationService.SendNotification(c.Request.Context(), services.NotificationRequest{
+			Type:             channel,
+			Recipients:       []string{request.RecipientID},
+			Subject:          request.Title,
+			Title:            request.Title,
+			Message:          request.Message,
+			TextBody:         request.Message,
+			Priority:         request.Priority,
+			Category:         request.Category,
+			TenantID:         tenantID,
+			UserID:           identity.UserID,
+			Metadata:         request.Data,
+			Localizations:    request.Localizations,
+			InAppAttachments: request.Attachments,
+			CallbackURL:      request.CallbackURL,
+			Digestible:       request.Digestible,
+			CollapseKey:      request.CollapseKey,
 		})
+		if err != nil {
+			respondError(c, problem.CodeInternal, "Failed to send notification", err)
+			return
+		}
+		notificationIDs = append(notificationIDs, result.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":          true,
+		"notification_id":  notificationIDs[0],
+		"notification_ids": notificationIDs,
+		"message":          localize(c, "Notification queued for delivery"),
+	})
+}
+
+// SendMention notifies users that they were mentioned on, or assigned, a
+// document, incident or task. Users mention as themselves, services name the
+// actor.
+func (h *NotificationHandler) SendMention(c *gin.Context) {
+	var request services.MentionRequest
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
 		return
 	}
 
-	// Create notification record
-	notification := &models.Notification{
-		ID:        uuid.New().String(),
-		Type:      request.Type,
-		Recipient: request.RecipientID,
-		Title:     request.Title,
-		Message:   request.Message,
-		Data:      request.Data,
-		Priority:  request.Priority,
-		Channels:  request.Channels,
-		Status:    "pending",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	identity := GetIdentity(c)
+	request.TenantID = identity.ResolveTenant(request.TenantID)
+	if request.TenantID == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "tenant_id is required")
+		return
+	}
+	if identity.Role != RoleService {
+		request.ActorID = identity.UserID
 	}
 
-	// Save notification to database
-	if err := h.notificationService.CreateNotification(notification); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to create notification: " + err.Error(),
-		})
+	results, err := h.notificationService.SendMention(c.Request.Context(), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to send mention", err)
 		return
 	}
 
-	// Send notification through appropriate channels
-	go func() {
-		if err := h.sendNotification(notification); err != nil {
-			// Update status to failed
-			notification.Status = "failed"
-			notification.UpdatedAt = time.Now()
-			h.notificationService.UpdateNotification(notification)
-		}
-	}()
+	notificationIDs := make([]string, 0, len(results))
+	for _, result := range results {
+		notificationIDs = append(notificationIDs, result.ID)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success":         true,
-		"notification_id": notification.ID,
-		"message":         "Notification queued for delivery",
+		"success":          true,
+		"notification_ids": notificationIDs,
+		"message":          localize(c, "Notification queued for delivery"),
+	})
+}
+
+// BroadcastNotification sends an in-app notification, and optionally a push,
+// to every user of the caller's tenant
+func (h *NotificationHandler) BroadcastNotification(c *gin.Context) {
+	var request services.BroadcastRequest
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	request.TenantID = GetIdentity(c).ResolveTenant(request.TenantID)
+	if request.TenantID == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "tenant_id is required")
+		return
+	}
+
+	result, err := h.notificationService.Broadcast(c.Request.Context(), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to broadcast notification", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    result,
 	})
 }
 
 // SendBulkNotifications handles sending multiple notifications
 func (h *NotificationHandler) SendBulkNotifications(c *gin.Context) {
 	var request struct {
-		Type         string                 `json:"type" binding:"required"`
+		Type         string                 `json:"type,omitempty"`
+		Category     string                 `json:"category,omitempty"`
 		RecipientIDs []string               `json:"recipient_ids" binding:"required"`
 		Title        string                 `json:"title" binding:"required"`
 		Message      string                 `json:"message" binding:"required"`
 		Data         map[string]interface{} `json:"data,omitempty"`
-		Priority     string                 `json:"priority,omitempty"`
+		Priority     string                 `json:"priority,omitempty" binding:"omitempty,priority"`
 		Channels     []string               `json:"channels,omitempty"`
+		// Content per locale, title and message are sent to recipients whose
+		// language has none
+		Localizations map[string]services.LocalizedContent `json:"localizations,omitempty"`
+		// Files the in-app notification carries, other channels leave them out
+		Attachments []services.InAppAttachment `json:"attachments,omitempty"`
+		// Receives the status changes of the notification as signed events
+		CallbackURL string `json:"callback_url,omitempty" binding:"omitempty,url"`
+		// Held back for the digest of recipients who prefer digests
+		Digestible bool `json:"digestible,omitempty"`
+		// Merged into a notification sent with the same key within the collapse window
+		CollapseKey string `json:"collapse_key,omitempty" binding:"omitempty,max=128"`
+		// Tenant sent for, only API-key callers acting across tenants name one
+		TenantID string `json:"tenant_id,omitempty"`
+	}
+
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid request data: " + err.Error(),
-		})
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(request.TenantID)
+	if tenantID == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "tenant_id is required")
+		return
+	}
+	channels, ok := h.categoryChannels(c, tenantID, request.Type, request.Category, request.Channels)
+	if !ok {
 		return
 	}
 
-	var notifications []*models.Notification
-	var notificationIDs []string
-
-	// Create notifications for each recipient
+	// One request per recipient and channel, so each has a status of its own
+	var requests []services.NotificationRequest
 	for _, recipientID := range request.RecipientIDs {
-		notification := &models.Notification{
-			ID:        uuid.New().String(),
-			Type:      request.Type,
-			Recipient: recipientID,
-			Title:     request.Title,
-			Message:   request.Message,
-			Data:      request.Data,
-			Priority:  request.Priority,
-			Channels:  request.Channels,
-			Status:    "pending",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+		for _, channel := range notificationChannels(request.Type, channels) {
+			requests = append(requests, services.NotificationRequest{
+				Type:             channel,
+				Recipients:       []string{recipientID},
+				Subject:          request.Title,
+				Title:            request.Title,
+				Message:          request.Message,
+				TextBody:         request.Message,
+				Priority:         request.Priority,
+				Category:         request.Category,
+				TenantID:         tenantID,
+				UserID:           identity.UserID,
+				Metadata:         request.Data,
+				Localizations:    request.Localizations,
+				InAppAttachments: request.Attachments,
+				CallbackURL:      request.CallbackURL,
+				Digestible:       request.Digestible,
+				CollapseKey:      request.CollapseKey,
+			})
 		}
-
-		notifications = append(notifications, notification)
-		notificationIDs = append(notificationIDs, notification.ID)
 	}
 
-	// Save all notifications to database
-	if err := h.notificationService.CreateBulkNotifications(notifications); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to create notifications: " + err.Error(),
-		})
+	results, err := h.notificationService.SendBulkNotifications(c.Request.Context(), requests)
+	if err != nil && len(results) == 0 {
+		respondError(c, problem.CodeInternal, "Failed to send notifications", err)
 		return
 	}
 
-	// Send notifications asynchronously
-	go func() {
-		for _, notification := range notifications {
-			if err := h.sendNotification(notification); err != nil {
-				// Update status to failed
-				notification.Status = "failed"
-				notification.UpdatedAt = time.Now()
-				h.notificationService.UpdateNotification(notification)
-			}
-		}
-	}()
+	notificationIDs := make([]string, 0, len(results))
+	for _, result := range results {
+		notificationIDs = append(notificationIDs, result.ID)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":          true,
 		"notification_ids": notificationIDs,
-		"message":          "Bulk notifications queued for delivery",
+		"message":          localize(c, "Bulk notifications queued for delivery"),
 	})
 }
 
@@ -169,19 +293,19 @@ func (h *NotificationHandler) SendBulkNotifications(c *gin.Context) {
 func (h *NotificationHandler) GetNotificationStatus(c *gin.Context) {
 	notificationID := c.Param("id")
 	if notificationID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Notification ID is required",
-		})
+		problem.Respond(c, problem.CodeInvalidRequest, "Notification ID is required")
 		return
 	}
 
-	notification, err := h.notificationService.GetNotification(notificationID)
+	notification, err := h.notificationService.GetNotificationStatus(c.Request.Context(), notificationID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Notification not found: " + err.Error(),
-		})
+		respondError(c, problem.CodeNotFound, "Notification not found", err)
+		return
+	}
+
+	// Notifications of other tenants are reported as missing
+	if !GetIdentity(c).CanAccessTenant(notification.TenantID) {
+		problem.Respond(c, problem.CodeNotFound, "Notification not found")
 		return
 	}
 
@@ -191,51 +315,164 @@ func (h *NotificationHandler) GetNotificationStatus(c *gin.Context) {
 	})
 }
 
-// GetNotificationHistory returns notification history with pagination
-func (h *NotificationHandler) GetNotificationHistory(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
-	recipientID := c.Query("recipient_id")
-	status := c.Query("status")
-	notificationType := c.Query("type")
+// GetNotificationTimeline returns every event of a notification, oldest first
+func (h *NotificationHandler) GetNotificationTimeline(c *gin.Context) {
+	timeline, err := h.notificationService.GetNotificationTimeline(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notification timeline", err)
+		return
+	}
+
+	// Notifications of other tenants are reported as missing
+	if !GetIdentity(c).CanAccessTenant(timeline.TenantID) {
+		problem.Respond(c, problem.CodeNotFound, "Notification not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    timeline,
+	})
+}
 
-	filters := map[string]interface{}{
-		"recipient_id": recipientID,
-		"status":       status,
-		"type":         notificationType,
+// GetNotificationStatusBatch returns the status of many notifications at once,
+// with a summary of the batch. Unknown notifications and those of other
+// tenants are reported as not found.
+func (h *NotificationHandler) GetNotificationStatusBatch(c *gin.Context) {
+	var request struct {
+		IDs []string `json:"ids" binding:"required,min=1"`
+	}
+
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+	if len(request.IDs) > services.MaxStatusBatchSize {
+		problem.Respond(c, problem.CodeInvalidRequest, fmt.Sprintf("At most %d IDs can be queried at once", services.MaxStatusBatchSize))
+		return
 	}
 
-	notifications, total, err := h.notificationService.GetNotificationHistory(page, limit, filters)
+	results, err := h.notificationService.GetNotificationStatuses(c.Request.Context(), request.IDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get notification history: " + err.Error(),
-		})
+		respondError(c, problem.CodeInternal, "Failed to get notification statuses", err)
 		return
 	}
 
+	identity := GetIdentity(c)
+	statuses := make([]gin.H, len(request.IDs))
+	byStatus := make(map[string]int)
+	found := 0
+
+	for i, id := range request.IDs {
+		result := results[i]
+		if result == nil || !identity.CanAccessTenant(result.TenantID) {
+			statuses[i] = gin.H{"id": id, "status": "not_found"}
+			continue
+		}
+
+		found++
+		byStatus[result.Status]++
+		statuses[i] = gin.H{"id": id, "status": result.Status, "result": result}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"notifications": notifications,
-			"pagination": gin.H{
-				"page":        page,
-				"limit":       limit,
-				"total":       total,
-				"total_pages": (total + limit - 1) / limit,
+			"statuses": statuses,
+			"summary": gin.H{
+				"total":     len(request.IDs),
+				"found":     found,
+				"not_found": len(request.IDs) - found,
+				"by_status": byStatus,
 			},
 		},
 	})
 }
 
-// GetTemplates returns available notification templates
+// GetNotificationHistory returns a page of the notification history of the
+// caller's tenant. Pages are continued with the next_cursor of the previous
+// one, from and to take RFC 3339 times and sort is newest or oldest.
+func (h *NotificationHandler) GetNotificationHistory(c *gin.Context) {
+	identity := GetIdentity(c)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	query := services.HistoryQuery{
+		TenantID: identity.ResolveTenant(c.Query("tenant_id")),
+		UserID:   strings.TrimPrefix(c.Query("recipient_id"), services.RecipientPrefixUser),
+		Type:     c.Query("type"),
+		Status:   c.Query("status"),
+		Category: c.Query("category"),
+		Priority: c.Query("priority"),
+		Search:   c.Query("search"),
+		Sort:     c.Query("sort"),
+		Cursor:   c.Query("cursor"),
+		Limit:    limit,
+	}
+	if query.Type == "" {
+		query.Type = c.Query("channel")
+	}
+
+	// Users and managers only see the notifications sent to them
+	if query.UserID == "" && !identity.IsAdmin() && identity.Role != RoleService {
+		query.UserID = identity.UserID
+	}
+	if query.UserID != "" && !identity.CanAccessUser(query.TenantID, query.UserID) {
+		problem.Respond(c, problem.CodeForbidden, "Access denied to this user's notifications")
+		return
+	}
+
+	for param, target := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.Respond(c, problem.CodeInvalidRequest, "Invalid time: "+value)
+			return
+		}
+		*target = &parsed
+	}
+
+	page, err := h.notificationService.QueryNotificationHistory(c.Request.Context(), query)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notification history", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    page,
+	})
+}
+
+// GetTemplates returns the templates of the caller's tenant, optionally of a
+// type or category only
 func (h *NotificationHandler) GetTemplates(c *gin.Context) {
-	templates, err := h.notificationService.GetTemplates()
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	templateService := h.notificationService.Templates()
+
+	var templates []*services.NotificationTemplate
+	var err error
+	switch {
+	case c.Query("category") != "":
+		templates, err = templateService.GetTemplatesByCategory(c.Request.Context(), c.Query("category"), tenantID, page, limit)
+	case c.Query("type") != "":
+		templates, err = templateService.GetTemplatesByType(c.Request.Context(), c.Query("type"), tenantID, page, limit)
+	default:
+		templates, err = templateService.ListTemplates(c.Request.Context(), tenantID, page, limit)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to get templates: " + err.Error(),
-		})
+		respondError(c, problem.CodeInternal, "Failed to get templates", err)
 		return
 	}
 
@@ -247,111 +484,101 @@ func (h *NotificationHandler) GetTemplates(c *gin.Context) {
 
 // CreateTemplate creates a new notification template
 func (h *NotificationHandler) CreateTemplate(c *gin.Context) {
-	var template models.NotificationTemplate
-	if err := c.ShouldBindJSON(&template); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid template data: " + err.Error(),
-		})
+	var template services.NotificationTemplate
+	if err := validation.BindJSON(c, &template); err != nil {
+		respondBindError(c, "Invalid template data", err)
 		return
 	}
 
-	template.ID = uuid.New().String()
-	template.CreatedAt = time.Now()
-	template.UpdatedAt = time.Now()
+	// Templates belong to the caller's tenant whatever the body says
+	template.ID = ""
+	template.TenantID = GetIdentity(c).ResolveTenant(template.TenantID)
 
-	if err := h.notificationService.CreateTemplate(&template); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to create template: " + err.Error(),
-		})
+	created, err := h.notificationService.Templates().CreateTemplate(c.Request.Context(), template)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create template", err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
-		"data":    template,
+		"data":    created,
 	})
 }
 
 // UpdateTemplate updates an existing notification template
 func (h *NotificationHandler) UpdateTemplate(c *gin.Context) {
 	templateID := c.Param("id")
-	if templateID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Template ID is required",
-		})
+	if !h.canAccessTemplate(c, templateID) {
+		problem.Respond(c, problem.CodeNotFound, "Template not found")
 		return
 	}
 
 	var updateData map[string]interface{}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid update data: " + err.Error(),
-		})
+	if err := validation.BindJSON(c, &updateData); err != nil {
+		respondBindError(c, "Invalid update data", err)
 		return
 	}
 
-	updateData["updated_at"] = time.Now()
+	// A template can't be moved to another tenant
+	delete(updateData, "tenant_id")
 
-	if err := h.notificationService.UpdateTemplate(templateID, updateData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to update template: " + err.Error(),
-		})
+	template, err := h.notificationService.Templates().UpdateTemplate(c.Request.Context(), templateID, updateData)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update template", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Template updated successfully",
+		"data":    template,
+		"message": localize(c, "Template updated successfully"),
 	})
 }
 
 // DeleteTemplate deletes a notification template
 func (h *NotificationHandler) DeleteTemplate(c *gin.Context) {
 	templateID := c.Param("id")
-	if templateID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Template ID is required",
-		})
+	if !h.canAccessTemplate(c, templateID) {
+		problem.Respond(c, problem.CodeNotFound, "Template not found")
 		return
 	}
 
-	if err := h.notificationService.DeleteTemplate(templateID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to delete template: " + err.Error(),
-		})
+	if err := h.notificationService.Templates().DeleteTemplate(c.Request.Context(), templateID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete template", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Template deleted successfully",
+		"message": localize(c, "Template deleted successfully"),
 	})
 }
 
+// canAccessTemplate reports whether a template exists and belongs to a
+// tenant of the caller
+func (h *NotificationHandler) canAccessTemplate(c *gin.Context, templateID string) bool {
+	template, err := h.notificationService.Templates().GetTemplate(templateID)
+	return err == nil && GetIdentity(c).CanAccessTenant(template.TenantID)
+}
+
 // GetUserPreferences returns notification preferences for a user
 func (h *NotificationHandler) GetUserPreferences(c *gin.Context) {
 	userID := c.Param("user_id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "User ID is required",
-		})
+		problem.Respond(c, problem.CodeInvalidRequest, "User ID is required")
 		return
 	}
 
-	preferences, err := h.notificationService.GetUserPreferences(userID)
+	identity := GetIdentity(c)
+	if !identity.CanAccessUser(identity.TenantID, userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to read preferences of this user")
+		return
+	}
+
+	preferences, err := h.notificationService.InApp().GetUserPreferences(c.Request.Context(), userID, identity.TenantID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "User preferences not found: " + err.Error(),
-		})
+		respondError(c, problem.CodeNotFound, "User preferences not found", err)
 		return
 	}
 
@@ -365,37 +592,37 @@ func (h *NotificationHandler) GetUserPreferences(c *gin.Context) {
 func (h *NotificationHandler) UpdateUserPreferences(c *gin.Context) {
 	userID := c.Param("user_id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "User ID is required",
-		})
+		problem.Respond(c, problem.CodeInvalidRequest, "User ID is required")
+		return
+	}
+
+	identity := GetIdentity(c)
+	if !identity.CanAccessUser(identity.TenantID, userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to update preferences of this user")
 		return
 	}
 
 	var preferences map[string]interface{}
-	if err := c.ShouldBindJSON(&preferences); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid preferences data: " + err.Error(),
-		})
+	if err := validation.BindJSON(c, &preferences); err != nil {
+		respondBindError(c, "Invalid preferences data", err)
 		return
 	}
 
-	if err := h.notificationService.UpdateUserPreferences(userID, preferences); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to update preferences: " + err.Error(),
-		})
+	updated, err := h.notificationService.UpdateUserPreferences(c.Request.Context(), userID, identity.TenantID, preferences)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update preferences", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "User preferences updated successfully",
+		"data":    updated,
+		"message": localize(c, "User preferences updated successfully"),
 	})
 }
 
-// TestNotification sends a test notification
+// TestNotification sends a test notification on a channel, skipping the
+// preferences of the recipient
 func (h *NotificationHandler) TestNotification(c *gin.Context) {
 	var request struct {
 		Type      string `json:"type" binding:"required"`
@@ -403,86 +630,100 @@ func (h *NotificationHandler) TestNotification(c *gin.Context) {
 		Channel   string `json:"channel" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid request data: " + err.Error(),
-		})
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
 		return
 	}
 
-	// Send test notification
-	var err error
 	switch request.Channel {
-	case "email":
-		err = h.emailService.SendTestEmail(request.Recipient)
-	case "sms":
-		err = h.smsService.SendTestSMS(request.Recipient)
-	case "push":
-		err = h.pushService.SendTestPush(request.Recipient)
+	case "email", "sms", "push", "inapp", "voice":
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Unsupported channel: " + request.Channel,
-		})
+		problem.Respond(c, problem.CodeInvalidRequest, "Unsupported channel: "+request.Channel)
 		return
 	}
 
+	identity := GetIdentity(c)
+	result, err := h.notificationService.SendNotification(c.Request.Context(), services.NotificationRequest{
+		Type:       request.Channel,
+		Recipients: []string{request.Recipient},
+		Subject:    "Test notification",
+		Title:      "Test notification",
+		Message:    "This is a test " + request.Type + " notification of the notification service.",
+		TextBody:   "This is a test " + request.Type + " notification of the notification service.",
+		Priority:   "normal",
+		Category:   "system",
+		TenantID:   identity.TenantID,
+		UserID:     identity.UserID,
+		Metadata:   map[string]interface{}{"test": true},
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to send test notification: " + err.Error(),
-		})
+		respondError(c, problem.CodeInternal, "Failed to send test notification", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Test notification sent successfully",
+		"data":    result,
+		"message": localize(c, "Test notification sent successfully"),
 	})
 }
 
 // HealthCheck returns service health status
 func (h *NotificationHandler) HealthCheck(c *gin.Context) {
+	providers := h.notificationService.ProviderHealth()
+
+	// A tripped provider degrades the service without taking it down
+	status := "healthy"
+	for _, provider := range providers {
+		if provider.State != services.BreakerClosed {
+			status = "degraded"
+			break
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
+		"status":    status,
 		"service":   "notification-service",
 		"timestamp": time.Now().Unix(),
+		"providers": providers,
 	})
 }
 
-// sendNotification sends a notification through appropriate channels
-func (h *NotificationHandler) sendNotification(notification *models.Notification) error {
-	var lastError error
-
-	// Send through each configured channel
-	for _, channel := range notification.Channels {
-		var err error
-
-		switch channel {
-		case "email":
-			err = h.emailService.SendEmail(notification)
-		case "sms":
-			err = h.smsService.SendSMS(notification)
-		case "push":
-			err = h.pushService.SendPush(notification)
-		case "in_app":
-			err = h.notificationService.SendInAppNotification(notification)
-		}
+// categoryChannels returns the channels of a send request, the default
+// channels of its category when it has neither type nor channels
+func (h *NotificationHandler) categoryChannels(c *gin.Context, tenantID string, notificationType string, category string, channels []string) ([]string, bool) {
+	if notificationType != "" || len(channels) > 0 {
+		return channels, true
+	}
 
-		if err != nil {
-			lastError = err
-			// Continue with other channels even if one fails
-		}
+	if category == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "Either type or category is required")
+		return nil, false
+	}
+
+	channels = h.notificationService.CategoryChannels(c.Request.Context(), tenantID, category)
+	if len(channels) == 0 {
+		problem.Respond(c, problem.CodeInvalidRequest, "Category has no default channels, type is required")
+		return nil, false
 	}
+	return channels, true
+}
+
+// Helper functions
 
-	// Update notification status
-	if lastError == nil {
-		notification.Status = "delivered"
-	} else {
-		notification.Status = "failed"
+// notificationChannels returns the channels a notification is sent on, its
+// type unless channels are given. in_app is the name older clients use.
+func notificationChannels(notificationType string, channels []string) []string {
+	if len(channels) == 0 {
+		channels = []string{notificationType}
 	}
-	notification.UpdatedAt = time.Now()
 
-	return h.notificationService.UpdateNotification(notification)
+	normalized := make([]string, len(channels))
+	for i, channel := range channels {
+		if channel == "in_app" {
+			channel = "inapp"
+		}
+		normalized[i] = channel
+	}
+	return normalized
 }
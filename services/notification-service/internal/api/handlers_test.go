@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newNotificationTestRouter serves the send and history endpoints
+func newNotificationTestRouter(t *testing.T) *gin.Engine {
+	handler := NewNotificationHandler(newTestNotificationService(t), nil)
+
+	router := newTestRouter()
+	router.POST("/notifications/send", handler.SendNotification)
+	router.POST("/notifications/send-bulk", handler.SendBulkNotifications)
+	router.GET("/notifications/history", handler.GetNotificationHistory)
+	return router
+}
+
+// inAppSend is a send request delivered without any provider
+func inAppSend(recipientID string) gin.H {
+	return gin.H{
+		"type":         "inapp",
+		"category":     "safety",
+		"recipient_id": recipientID,
+		"title":        "Tatbikat",
+		"message":      "Saat 14.00'te toplanma alanında olun",
+	}
+}
+
+func TestSendingWithoutATenantIsRejected(t *testing.T) {
+	router := newNotificationTestRouter(t)
+	apiKey := map[string]string{APIKeyHeader: testAPIKey}
+
+	for _, path := range []string{"/notifications/send", "/notifications/send-bulk"} {
+		body := inAppSend("user-1")
+		body["recipient_ids"] = []string{"user-1"}
+
+		if recorder := serve(router, http.MethodPost, path, apiKey, body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s without a tenant to be rejected, got %d", path, recorder.Code)
+		}
+
+		body["tenant_id"] = "tenant-a"
+		if recorder := serve(router, http.MethodPost, path, apiKey, body); recorder.Code != http.StatusOK {
+			t.Errorf("Expected %s naming a tenant to be sent, got %d: %s", path, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestUsersNameTheirOwnTenant(t *testing.T) {
+	router := newNotificationTestRouter(t)
+
+	// The tenant of the token wins over the one of the body
+	body := inAppSend("user-1")
+	body["tenant_id"] = "tenant-b"
+	auth := map[string]string{"Authorization": testToken("user-1", "tenant-a", RoleAdmin)}
+	if recorder := serve(router, http.MethodPost, "/notifications/send", auth, body); recorder.Code != http.StatusOK {
+		t.Fatalf("Failed to send: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response struct {
+		Data struct {
+			Total int64 `json:"total"`
+		} `json:"data"`
+	}
+	other := map[string]string{"Authorization": testToken("admin-b", "tenant-b", RoleAdmin)}
+	decode(t, serve(router, http.MethodGet, "/notifications/history", other, nil), &response)
+	if response.Data.Total != 0 {
+		t.Errorf("Expected nothing to be sent for the tenant named in the body, got %d", response.Data.Total)
+	}
+}
+
+func TestNotificationHistoryOfUsersIsTheirOwn(t *testing.T) {
+	router := newNotificationTestRouter(t)
+
+	service := map[string]string{APIKeyHeader: testAPIKey, TenantHeader: "tenant-a"}
+	for _, recipient := range []string{"user-1", "user-2"} {
+		if recorder := serve(router, http.MethodPost, "/notifications/send", service, inAppSend(recipient)); recorder.Code != http.StatusOK {
+			t.Fatalf("Failed to send: %d %s", recorder.Code, recorder.Body.String())
+		}
+	}
+
+	history := func(headers map[string]string, query string) (int, []string) {
+		var response struct {
+			Data struct {
+				Notifications []struct {
+					Recipient string `json:"recipient"`
+				} `json:"notifications"`
+			} `json:"data"`
+		}
+		recorder := serve(router, http.MethodGet, "/notifications/history"+query, headers, nil)
+		if recorder.Code != http.StatusOK {
+			return recorder.Code, nil
+		}
+		decode(t, recorder, &response)
+
+		var recipients []string
+		for _, notification := range response.Data.Notifications {
+			recipients = append(recipients, notification.Recipient)
+		}
+		return recorder.Code, recipients
+	}
+
+	employee := map[string]string{"Authorization": testToken("user-1", "tenant-a", RoleEmployee)}
+	if _, recipients := history(employee, ""); len(recipients) != 1 || recipients[0] != "user-1" {
+		t.Errorf("Expected users to see the notifications sent to them only, got %v", recipients)
+	}
+	if code, _ := history(employee, "?recipient_id=user-2"); code != http.StatusForbidden {
+		t.Errorf("Expected the history of other users to be forbidden, got %d", code)
+	}
+
+	manager := map[string]string{"Authorization": testToken("user-3", "tenant-a", RoleManager)}
+	if _, recipients := history(manager, ""); len(recipients) != 0 {
+		t.Errorf("Expected managers to see the notifications sent to them only, got %v", recipients)
+	}
+
+	admin := map[string]string{"Authorization": testToken("admin-a", "tenant-a", RoleAdmin)}
+	if _, recipients := history(admin, ""); len(recipients) != 2 {
+		t.Errorf("Expected admins to see the history of their tenant, got %v", recipients)
+	}
+	if _, recipients := history(service, ""); len(recipients) != 2 {
+		t.Errorf("Expected services to see the history of their tenant, got %v", recipients)
+	}
+}
+
+func TestSendPassesTheDeliveryOptionsToTheService(t *testing.T) {
+	handler := NewNotificationHandler(newTestNotificationService(t), nil)
+	router := newTestRouter()
+	router.POST("/notifications/send", handler.SendNotification)
+	router.GET("/notifications/:id/status", handler.GetNotificationStatus)
+	router.PUT("/preferences/:user_id", handler.UpdateUserPreferences)
+
+	user := map[string]string{"Authorization": testToken("user-1", "tenant-a", RoleAdmin)}
+	send := func(body gin.H) (string, map[string]interface{}) {
+		var sent struct {
+			NotificationID string `json:"notification_id"`
+		}
+		recorder := serve(router, http.MethodPost, "/notifications/send", user, body)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Failed to send: %d %s", recorder.Code, recorder.Body.String())
+		}
+		decode(t, recorder, &sent)
+
+		var status struct {
+			Data struct {
+				CallbackURL string                 `json:"callback_url"`
+				Metadata    map[string]interface{} `json:"metadata"`
+			} `json:"data"`
+		}
+		decode(t, serve(router, http.MethodGet, "/notifications/"+sent.NotificationID+"/status", user, nil), &status)
+		return status.Data.CallbackURL, status.Data.Metadata
+	}
+
+	body := inAppSend("user-1")
+	body["callback_url"] = "https://hooks.talimat.test/status"
+	if callbackURL, _ := send(body); callbackURL != "https://hooks.talimat.test/status" {
+		t.Errorf("Expected the callback URL to be kept, got %q", callbackURL)
+	}
+
+	body = inAppSend("user-1")
+	body["collapse_key"] = "drill-1"
+	send(body)
+	if _, metadata := send(body); metadata["collapse_count"] != float64(2) {
+		t.Errorf("Expected the second notification with the collapse key to be collapsed, got %v", metadata)
+	}
+
+	if recorder := serve(router, http.MethodPut, "/preferences/user-1", user, gin.H{"digest": "daily"}); recorder.Code != http.StatusOK {
+		t.Fatalf("Failed to prefer digests: %d %s", recorder.Code, recorder.Body.String())
+	}
+	body = inAppSend("user-1")
+	body["digestible"] = true
+	if _, metadata := send(body); metadata["digest"] != "daily" {
+		t.Errorf("Expected the digestible notification to be held for the digest, got %v", metadata)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+)
+
+// IdempotencyKeyHeader is the header clients use to make retries safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the size of client supplied keys
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRecorder captures the response body so it can be replayed
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// IdempotencyMiddleware replays the original response when a request is retried
+// with the same Idempotency-Key instead of processing it again. Keys are
+// scoped to the caller and the request URI, without a service requests pass.
+func IdempotencyMiddleware(idempotencyService *services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || idempotencyService == nil {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Abort(c, problem.CodeInvalidRequest, "Idempotency-Key must not exceed 255 characters")
+			return
+		}
+
+		// Read the body so it can be hashed and still be bound by the handler
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Abort(c, problem.CodeInvalidRequest, err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys of different callers, and of different resources, never collide
+		scope := c.Request.Method + ":" + c.Request.URL.RequestURI()
+		if identity := GetIdentity(c); identity != nil {
+			scope = identity.TenantID + ":" + identity.UserID + ":" + scope
+		}
+		sum := sha256.Sum256(append([]byte(scope+"\n"), body...))
+		requestHash := hex.EncodeToString(sum[:])
+
+		record, err := idempotencyService.Reserve(c.Request.Context(), scope, key, requestHash)
+		if errors.Is(err, services.ErrConflict) {
+			problem.Abort(c, problem.CodeRequestInProgress, "A request with this Idempotency-Key is still being processed")
+			return
+		}
+		if err != nil {
+			// Fail open: a Redis outage must not block sending
+			log.Warn().Err(err).Str("idempotencyKey", key).Msg("Idempotency check failed")
+			c.Next()
+			return
+		}
+
+		if record != nil {
+			if record.RequestHash != requestHash {
+				problem.Abort(c, problem.CodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request")
+				return
+			}
+
+			if record.Status == services.IdempotencyInProgress {
+				problem.Abort(c, problem.CodeRequestInProgress, "A request with this Idempotency-Key is still being processed")
+				return
+			}
+
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, record.ContentType, record.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+
+		c.Next()
+
+		// The outcome is recorded even when the caller is gone, its retry
+		// would otherwise wait for the reservation to expire
+		ctx := context.Background()
+
+		// Server errors are not remembered so the client can retry them
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := idempotencyService.Release(ctx, scope, key); err != nil {
+				log.Warn().Err(err).Str("idempotencyKey", key).Msg("Failed to release idempotency key")
+			}
+			return
+		}
+
+		if err := idempotencyService.Complete(
+			ctx,
+			scope,
+			key,
+			requestHash,
+			status,
+			recorder.Header().Get("Content-Type"),
+			recorder.body.Bytes(),
+		); err != nil {
+			log.Warn().Err(err).Str("idempotencyKey", key).Msg("Failed to store idempotent response")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+)
+
+// newIdempotencyTestRouter serves an endpoint answering with status, counting
+// the requests it handled
+func newIdempotencyTestRouter(t *testing.T, status *int) (*gin.Engine, *int) {
+	t.Helper()
+
+	idempotencyService, err := services.NewIdempotencyService(services.IdempotencyConfig{
+		RedisURL: "redis://" + miniredis.RunT(t).Addr(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create idempotency service: %v", err)
+	}
+
+	handled := 0
+	router := newTestRouter()
+	handler := func(c *gin.Context) {
+		handled++
+		c.JSON(*status, gin.H{"success": *status < http.StatusBadRequest, "handled": handled})
+	}
+	router.POST("/notifications/send", IdempotencyMiddleware(idempotencyService), handler)
+	router.POST("/notifications/:id/resend", IdempotencyMiddleware(idempotencyService), handler)
+	return router, &handled
+}
+
+func TestRetriesWithAnIdempotencyKeyAreReplayed(t *testing.T) {
+	status := http.StatusOK
+	router, handled := newIdempotencyTestRouter(t, &status)
+	headers := map[string]string{APIKeyHeader: testAPIKey, TenantHeader: "tenant-a", IdempotencyKeyHeader: "send-1"}
+
+	first := serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-1"))
+	retry := serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-1"))
+
+	if *handled != 1 {
+		t.Errorf("Expected the request to be handled once, got %d", *handled)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected the retry to get the first response %d %s, got %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the retry to be marked as replayed")
+	}
+
+	// Keys are scoped to the tenant of the caller
+	headers[TenantHeader] = "tenant-b"
+	if other := serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-1")); other.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected the key of another tenant not to be replayed")
+	}
+	if *handled != 2 {
+		t.Errorf("Expected the request of another tenant to be handled, got %d", *handled)
+	}
+}
+
+func TestIdempotencyKeysAreScopedToTheCallerAndResource(t *testing.T) {
+	status := http.StatusOK
+	router, handled := newIdempotencyTestRouter(t, &status)
+	replayed := func(path string, userID string) bool {
+		headers := map[string]string{"Authorization": testToken(userID, "tenant-a", RoleManager), IdempotencyKeyHeader: "resend-1"}
+		return serve(router, http.MethodPost, path, headers, nil).Header().Get("Idempotent-Replayed") == "true"
+	}
+
+	replayed("/notifications/notif-1/resend", "user-1")
+	if replayed("/notifications/notif-2/resend", "user-1") {
+		t.Errorf("Expected the key not to replay the response for another notification")
+	}
+	if replayed("/notifications/notif-1/resend?channel=sms", "user-1") {
+		t.Errorf("Expected the key not to replay the response for another query")
+	}
+	if replayed("/notifications/notif-1/resend", "user-2") {
+		t.Errorf("Expected the key of another user of the tenant not to be replayed")
+	}
+	if !replayed("/notifications/notif-1/resend", "user-1") {
+		t.Errorf("Expected the retry of the same request to be replayed")
+	}
+	if *handled != 4 {
+		t.Errorf("Expected 4 distinct requests to be handled, got %d", *handled)
+	}
+}
+
+func TestIdempotencyKeysAreRejectedWhenMisused(t *testing.T) {
+	status := http.StatusOK
+	router, handled := newIdempotencyTestRouter(t, &status)
+	headers := map[string]string{APIKeyHeader: testAPIKey, TenantHeader: "tenant-a", IdempotencyKeyHeader: "send-1"}
+
+	serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-1"))
+
+	var response problem.Problem
+	recorder := serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-2"))
+	decode(t, recorder, &response)
+	if recorder.Code != http.StatusUnprocessableEntity || response.Code != problem.CodeIdempotencyKeyReused {
+		t.Errorf("Expected a key reused for another request to be rejected, got %d %s", recorder.Code, response.Code)
+	}
+
+	headers[IdempotencyKeyHeader] = strings.Repeat("k", maxIdempotencyKeyLength+1)
+	if recorder := serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-1")); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected a key over %d characters to be rejected, got %d", maxIdempotencyKeyLength, recorder.Code)
+	}
+
+	if *handled != 1 {
+		t.Errorf("Expected rejected requests not to be handled, got %d", *handled)
+	}
+}
+
+func TestServerErrorsReleaseTheIdempotencyKey(t *testing.T) {
+	status := http.StatusInternalServerError
+	router, handled := newIdempotencyTestRouter(t, &status)
+	headers := map[string]string{APIKeyHeader: testAPIKey, TenantHeader: "tenant-a", IdempotencyKeyHeader: "send-1"}
+
+	serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-1"))
+
+	status = http.StatusOK
+	retry := serve(router, http.MethodPost, "/notifications/send", headers, inAppSend("user-1"))
+	if *handled != 2 || retry.Code != http.StatusOK {
+		t.Errorf("Expected the retry of a server error to be handled again, got %d handled and %d", *handled, retry.Code)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected the server error not to be replayed")
+	}
+}
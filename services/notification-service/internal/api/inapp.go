@@ -0,0 +1,843 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/envelope"
+	"claude-talimat/pkg/validation"
+)
+
+const inAppNotificationContextKey = "inapp_notification"
+
+type InAppHandler struct {
+	inAppService *services.InAppNotificationService
+}
+
+func NewInAppHandler(inAppService *services.InAppNotificationService) *InAppHandler {
+	return &InAppHandler{
+		inAppService: inAppService,
+	}
+}
+
+// RegisterRoutes registers in-app notification routes. Users act on their own
+// inbox, admins and services may pass user_id to act on behalf of a user.
+func (h *InAppHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	inapp := rg.Group("/inapp")
+	{
+		inapp.GET("/notifications", h.ListNotifications)
+		inapp.GET("/notifications/unread-count", h.GetUnreadCount)
+		inapp.POST("/notifications/read-all", h.MarkAllAsRead)
+		inapp.POST("/notifications/batch", h.ApplyToNotifications)
+		inapp.GET("/notifications/snoozed", h.ListSnoozedNotifications)
+		inapp.GET("/notifications/:id", h.authorizeNotification, h.GetNotification)
+		inapp.POST("/notifications/:id/read", h.authorizeNotification, h.MarkAsRead)
+		inapp.POST("/notifications/:id/archive", h.authorizeNotification, h.ArchiveNotification)
+		inapp.DELETE("/notifications/:id", h.authorizeNotification, h.DeleteNotification)
+		inapp.POST("/notifications/:id/snooze", h.authorizeNotification, h.SnoozeNotification)
+		inapp.DELETE("/notifications/:id/snooze", h.authorizeNotification, h.UnsnoozeNotification)
+		inapp.POST("/notifications/:id/actions/:action_id", h.authorizeNotification, h.RespondToAction)
+		inapp.GET("/views", h.ListSavedViews)
+		inapp.POST("/views", h.CreateSavedView)
+		inapp.PUT("/views/:view_id", h.UpdateSavedView)
+		inapp.DELETE("/views/:view_id", h.DeleteSavedView)
+		inapp.GET("/export", h.ExportNotifications)
+		inapp.GET("/by-entity/:type/:id", h.ListEntityNotifications)
+		inapp.GET("/threads", h.ListThreads)
+		inapp.POST("/threads/:thread_key/read", h.MarkThreadAsRead)
+		inapp.GET("/stats", h.GetStats)
+		inapp.GET("/actions/stats", RequireRole(RoleAdmin, RoleManager, RoleService), h.GetActionStats)
+	}
+}
+
+// authorizeNotification loads the notification of the request and rejects
+// access to other users' notifications. They are reported as missing so their
+// IDs cannot be probed.
+func (h *InAppHandler) authorizeNotification(c *gin.Context) {
+	notification, err := h.inAppService.GetNotification(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notification", err)
+		c.Abort()
+		return
+	}
+
+	if !GetIdentity(c).CanAccessUser(notification.TenantID, notification.UserID) {
+		problem.Abort(c, problem.CodeNotFound, "Notification not found")
+		return
+	}
+
+	c.Set(inAppNotificationContextKey, notification)
+	c.Next()
+}
+
+// ListNotifications returns the notifications of a user with pagination. With
+// view the filters of a saved view apply, filters in the query take over from
+// them.
+func (h *InAppHandler) ListNotifications(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filters, err := inAppFilters(c)
+	if err != nil {
+		respondError(c, problem.CodeInvalidRequest, "Invalid filter", err)
+		return
+	}
+
+	if viewID := c.Query("view"); viewID != "" {
+		view, err := h.inAppService.GetSavedView(c.Request.Context(), userID, tenantID, viewID)
+		if err != nil {
+			respondError(c, problem.CodeInternal, "Failed to get saved view", err)
+			return
+		}
+		viewFilters := view.Filters()
+		for key, value := range filters {
+			viewFilters[key] = value
+		}
+		filters = viewFilters
+	}
+
+	notifications, total, err := h.inAppService.GetUserNotifications(c.Request.Context(), userID, tenantID, page, limit, filters)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notifications", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"notifications": notifications,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// GetUnreadCount returns the number of unread notifications of a user
+func (h *InAppHandler) GetUnreadCount(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.inAppService.GetUnreadCount(c.Request.Context(), userID, tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get unread count", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"unread_count": count,
+		},
+	})
+}
+
+// MarkAllAsRead marks every notification of a user as read
+func (h *InAppHandler) MarkAllAsRead(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.inAppService.MarkAllAsRead(c.Request.Context(), userID, tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to mark notifications as read", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "All notifications marked as read"),
+		"data": gin.H{
+			"marked_count": count,
+		},
+	})
+}
+
+// ApplyToNotifications marks the selected notifications of a user as read or
+// unread, archives or deletes them in one call, with the outcome per
+// notification
+func (h *InAppHandler) ApplyToNotifications(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Operation string   `json:"operation" binding:"required,oneof=read unread archive delete"`
+		IDs       []string `json:"ids" binding:"required,min=1"`
+	}
+
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+	if len(request.IDs) > services.MaxNotificationBatchSize {
+		problem.Respond(c, problem.CodeInvalidRequest, fmt.Sprintf("At most %d notifications can be selected at once", services.MaxNotificationBatchSize))
+		return
+	}
+
+	results, err := h.inAppService.ApplyToNotifications(c.Request.Context(), userID, tenantID, request.Operation, request.IDs)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update notifications", err)
+		return
+	}
+
+	byStatus := make(map[string]int)
+	for _, result := range results {
+		byStatus[result.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"results": results,
+			"summary": gin.H{
+				"total":     len(results),
+				"done":      byStatus[services.BatchStatusDone],
+				"not_found": byStatus[services.BatchStatusNotFound],
+				"failed":    byStatus[services.BatchStatusFailed],
+			},
+		},
+	})
+}
+
+// GetNotification returns a single notification
+func (h *InAppHandler) GetNotification(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    inAppNotification(c),
+	})
+}
+
+// MarkAsRead marks a notification as read
+func (h *InAppHandler) MarkAsRead(c *gin.Context) {
+	notification := inAppNotification(c)
+
+	if err := h.inAppService.MarkAsRead(c.Request.Context(), notification.ID, notification.UserID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to mark notification as read", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Notification marked as read"),
+	})
+}
+
+// ArchiveNotification archives a notification
+func (h *InAppHandler) ArchiveNotification(c *gin.Context) {
+	notification := inAppNotification(c)
+
+	if err := h.inAppService.ArchiveNotification(c.Request.Context(), notification.ID, notification.UserID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to archive notification", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Notification archived"),
+	})
+}
+
+// DeleteNotification deletes a notification
+func (h *InAppHandler) DeleteNotification(c *gin.Context) {
+	notification := inAppNotification(c)
+
+	if err := h.inAppService.DeleteNotification(c.Request.Context(), notification.ID, notification.UserID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete notification", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Notification deleted"),
+	})
+}
+
+// savedViewRequest is the name and filters of a saved view
+type savedViewRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Type     string `json:"type,omitempty"`
+	Category string `json:"category,omitempty"`
+	Priority string `json:"priority,omitempty" binding:"omitempty,priority"`
+	Thread   string `json:"thread,omitempty"`
+	Search   string `json:"search,omitempty"`
+	Read     *bool  `json:"read,omitempty"`
+	Archived *bool  `json:"archived,omitempty"`
+}
+
+func (r savedViewRequest) view(userID string, tenantID string) services.SavedView {
+	return services.SavedView{
+		UserID:   userID,
+		TenantID: tenantID,
+		Name:     r.Name,
+		Type:     r.Type,
+		Category: r.Category,
+		Priority: r.Priority,
+		Thread:   r.Thread,
+		Search:   r.Search,
+		Read:     r.Read,
+		Archived: r.Archived,
+	}
+}
+
+// ListSavedViews returns the saved views of a user
+func (h *InAppHandler) ListSavedViews(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	views, err := h.inAppService.ListSavedViews(c.Request.Context(), userID, tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get saved views", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    views,
+	})
+}
+
+// CreateSavedView saves a named filter combination the feed of a user can be
+// requested by
+func (h *InAppHandler) CreateSavedView(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	var request savedViewRequest
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid saved view data", err)
+		return
+	}
+
+	view, err := h.inAppService.CreateSavedView(c.Request.Context(), request.view(userID, tenantID))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create saved view", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    view,
+	})
+}
+
+// UpdateSavedView replaces the name and filters of a saved view
+func (h *InAppHandler) UpdateSavedView(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	var request savedViewRequest
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid saved view data", err)
+		return
+	}
+
+	view := request.view(userID, tenantID)
+	view.ID = c.Param("view_id")
+
+	updated, err := h.inAppService.UpdateSavedView(c.Request.Context(), view)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update saved view", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// DeleteSavedView deletes a saved view
+func (h *InAppHandler) DeleteSavedView(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.inAppService.DeleteSavedView(c.Request.Context(), userID, tenantID, c.Param("view_id")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete saved view", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Saved view deleted"),
+	})
+}
+
+// ListEntityNotifications returns the notifications about a document,
+// incident or task with pagination, newest first. Users see their own, admins
+// and services see those of the whole tenant unless they pass user_id.
+func (h *InAppHandler) ListEntityNotifications(c *gin.Context) {
+	identity := GetIdentity(c)
+
+	var userID, tenantID string
+	if (identity.Role == RoleAdmin || identity.Role == RoleService) && c.Query("user_id") == "" {
+		tenantID = identity.ResolveTenant(c.Query("tenant_id"))
+	} else {
+		var ok bool
+		if userID, tenantID, ok = h.resolveUser(c); !ok {
+			return
+		}
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	notifications, total, err := h.inAppService.GetEntityNotifications(c.Request.Context(), tenantID, c.Param("type"), c.Param("id"), userID, page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notifications", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"notifications": notifications,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// ExportStatusTrailer is the trailer of exports telling whether they are
+// complete. They are streamed, so one that fails half way still has a 200.
+const ExportStatusTrailer = "X-Export-Status"
+
+// inAppExportColumns are the columns of CSV exports of the in-app feed
+var inAppExportColumns = []string{
+	"id", "created_at", "type", "category", "priority", "title", "message",
+	"read", "read_at", "archived", "response", "responded_at", "action_url",
+}
+
+// ExportNotifications streams the in-app notifications of a user between from
+// and to as CSV or JSON, oldest first, so it can be shown that they were
+// informed, for example of safety instructions. from and to take RFC 3339
+// times or dates, a date in to covers the whole day.
+func (h *InAppHandler) ExportNotifications(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		problem.Respond(c, problem.CodeInvalidRequest, "Export format must be csv or json")
+		return
+	}
+
+	var from, to time.Time
+	for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			date, dateErr := time.Parse("2006-01-02", value)
+			if dateErr != nil {
+				problem.Respond(c, problem.CodeInvalidRequest, "Invalid time: "+value)
+				return
+			}
+			if param == "to" {
+				date = date.AddDate(0, 0, 1).Add(-time.Second)
+			}
+			parsed = date
+		}
+		*target = parsed
+	}
+
+	filename := "notifications-" + userID + "." + format
+	csvWriter := csv.NewWriter(c.Writer)
+	written := 0
+
+	// The response starts with the first notification, so errors before it
+	// can still be reported as problems. It is streamed as it is read,
+	// outside the envelope of version 2.
+	start := func() {
+		envelope.Stream(c)
+		c.Header("Trailer", ExportStatusTrailer)
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		if format == "csv" {
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Status(http.StatusOK)
+			csvWriter.Write(inAppExportColumns)
+		} else {
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Status(http.StatusOK)
+			c.Writer.WriteString("[")
+		}
+	}
+
+	err := h.inAppService.ExportUserNotifications(c.Request.Context(), userID, tenantID, from, to, func(notification *services.InAppNotification) error {
+		if written == 0 {
+			start()
+		}
+		written++
+
+		if format == "json" {
+			if written > 1 {
+				c.Writer.WriteString(",")
+			}
+			return json.NewEncoder(c.Writer).Encode(notification)
+		}
+
+		if err := csvWriter.Write(inAppExportRecord(notification)); err != nil {
+			return err
+		}
+		if written%100 == 0 {
+			csvWriter.Flush()
+			c.Writer.Flush()
+		}
+		return csvWriter.Error()
+	})
+	if err != nil && written == 0 {
+		respondError(c, problem.CodeInternal, "Failed to export notifications", err)
+		return
+	}
+	if err != nil {
+		// Too late for a problem response, the client gets a truncated file
+		// and JSON arrays are left open
+		log.Error().Err(err).Str("userID", userID).Msg("In-app export aborted")
+		csvWriter.Flush()
+		c.Writer.Header().Set(ExportStatusTrailer, "failed")
+		return
+	}
+
+	if written == 0 {
+		start()
+	}
+	if format == "json" {
+		c.Writer.WriteString("]")
+	}
+	csvWriter.Flush()
+	c.Writer.Header().Set(ExportStatusTrailer, "complete")
+}
+
+// inAppExportRecord returns the CSV record of a notification
+func inAppExportRecord(notification *services.InAppNotification) []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	var response, respondedAt string
+	if notification.Response != nil {
+		response = notification.Response.Label
+		respondedAt = formatTime(&notification.Response.RespondedAt)
+	}
+
+	return []string{
+		notification.ID,
+		formatTime(&notification.CreatedAt),
+		notification.Type,
+		notification.Category,
+		notification.Priority,
+		notification.Title,
+		notification.Message,
+		strconv.FormatBool(notification.Read),
+		formatTime(notification.ReadAt),
+		strconv.FormatBool(notification.Archived),
+		response,
+		respondedAt,
+		notification.ActionURL,
+	}
+}
+
+// ListThreads returns the threads of a user with pagination, the most recently
+// active first. The notifications of a thread are listed with the thread filter.
+func (h *InAppHandler) ListThreads(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	threads, total, err := h.inAppService.GetUserThreads(c.Request.Context(), userID, tenantID, page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notification threads", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"threads": threads,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// MarkThreadAsRead marks every notification of a thread of a user as read
+func (h *InAppHandler) MarkThreadAsRead(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.inAppService.MarkThreadAsRead(c.Request.Context(), userID, tenantID, c.Param("thread_key"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to mark thread as read", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Thread marked as read"),
+		"data": gin.H{
+			"marked_count": count,
+		},
+	})
+}
+
+// ListSnoozedNotifications returns the snoozed notifications of a user, the
+// ones returning soonest first
+func (h *InAppHandler) ListSnoozedNotifications(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	notifications, total, err := h.inAppService.GetSnoozedNotifications(c.Request.Context(), userID, tenantID, page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get snoozed notifications", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"notifications": notifications,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// SnoozeNotification hides a notification until a later time. The time is
+// given either as an absolute until or as minutes from now.
+func (h *InAppHandler) SnoozeNotification(c *gin.Context) {
+	var request struct {
+		Until   *time.Time `json:"until"`
+		Minutes int        `json:"minutes"`
+		Repush  bool       `json:"repush"`
+	}
+
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid snooze data", err)
+		return
+	}
+
+	var until time.Time
+	switch {
+	case request.Until != nil:
+		until = *request.Until
+	case request.Minutes > 0:
+		until = time.Now().Add(time.Duration(request.Minutes) * time.Minute)
+	default:
+		problem.Respond(c, problem.CodeValidationFailed, "Either until or minutes is required")
+		return
+	}
+
+	notification := inAppNotification(c)
+
+	snoozed, err := h.inAppService.SnoozeNotification(c.Request.Context(), notification.ID, notification.UserID, until, request.Repush)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to snooze notification", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    snoozed,
+	})
+}
+
+// UnsnoozeNotification returns a snoozed notification to the inbox right away
+func (h *InAppHandler) UnsnoozeNotification(c *gin.Context) {
+	notification := inAppNotification(c)
+
+	unsnoozed, err := h.inAppService.UnsnoozeNotification(c.Request.Context(), notification.ID, notification.UserID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to unsnooze notification", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    unsnoozed,
+	})
+}
+
+// RespondToAction records the action a user took on a notification
+func (h *InAppHandler) RespondToAction(c *gin.Context) {
+	notification := inAppNotification(c)
+
+	answered, err := h.inAppService.RespondToAction(c.Request.Context(), notification.ID, notification.UserID, c.Param("action_id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to record action", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    answered,
+	})
+}
+
+// GetActionStats returns how many actionable notifications of the caller's
+// tenant were answered, optionally limited to a category
+func (h *InAppHandler) GetActionStats(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	stats, err := h.inAppService.GetActionStats(c.Request.Context(), tenantID, c.Query("category"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get action stats", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    stats,
+	})
+}
+
+// GetStats returns notification statistics of a user
+func (h *InAppHandler) GetStats(c *gin.Context) {
+	userID, tenantID, ok := h.resolveUser(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.inAppService.GetNotificationStats(c.Request.Context(), userID, tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notification stats", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    stats,
+	})
+}
+
+// resolveUser returns the user and tenant whose inbox a request acts on,
+// rendering a problem when the caller may not access it
+func (h *InAppHandler) resolveUser(c *gin.Context) (string, string, bool) {
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(c.Query("tenant_id"))
+	userID := c.DefaultQuery("user_id", identity.UserID)
+
+	if userID == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "User ID is required")
+		return "", "", false
+	}
+	if !identity.CanAccessUser(tenantID, userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to access notifications of this user")
+		return "", "", false
+	}
+
+	return userID, tenantID, true
+}
+
+// Helper functions
+func inAppNotification(c *gin.Context) *services.InAppNotification {
+	return c.MustGet(inAppNotificationContextKey).(*services.InAppNotification)
+}
+
+// inAppFilters maps the query string onto the filters of GetUserNotifications.
+// search matches notifications containing every word of it.
+func inAppFilters(c *gin.Context) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+
+	for _, key := range []string{"type", "category", "priority", "thread", "search"} {
+		if value := c.Query(key); value != "" {
+			filters[key] = value
+		}
+	}
+
+	for _, key := range []string{"read", "archived"} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		filters[key] = flag
+	}
+
+	return filters, nil
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// LocaleMiddleware picks the locale of the response: the one the client
+// prefers in Accept-Language, else the default locale of its tenant. It runs
+// after authentication, which tells the tenant.
+func LocaleMiddleware(tenantLocale func(tenantID string) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locale := i18n.Match(c.GetHeader("Accept-Language"))
+		if locale == "" {
+			if identity := GetIdentity(c); identity != nil && identity.TenantID != "" {
+				locale = i18n.Match(tenantLocale(identity.TenantID))
+			}
+		}
+		if locale == "" {
+			locale = i18n.Source
+		}
+
+		i18n.SetLocale(c, locale)
+		c.Next()
+	}
+}
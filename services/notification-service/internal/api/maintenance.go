@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type MaintenanceHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewMaintenanceHandler(notificationService *services.NotificationService) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers maintenance window routes. Everyone may see the
+// windows, managers schedule them and review what they held back.
+func (h *MaintenanceHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	managers := RequireRole(RoleAdmin, RoleManager, RoleService)
+
+	maintenance := rg.Group("/maintenance")
+	{
+		maintenance.GET("/windows", h.ListWindows)
+		maintenance.POST("/windows", managers, h.CreateWindow)
+		maintenance.GET("/windows/:id", h.authorizeWindow, h.GetWindow)
+		maintenance.DELETE("/windows/:id", managers, h.authorizeWindow, h.DeleteWindow)
+		maintenance.GET("/muted", managers, h.GetMutedDeliveries)
+	}
+}
+
+// authorizeWindow rejects access to maintenance windows of other tenants
+func (h *MaintenanceHandler) authorizeWindow(c *gin.Context) {
+	window, err := h.notificationService.GetMaintenanceWindow(c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(window.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Maintenance window not found")
+		return
+	}
+
+	c.Next()
+}
+
+// CreateWindow handles scheduling a maintenance window or mute rule
+func (h *MaintenanceHandler) CreateWindow(c *gin.Context) {
+	var request services.MaintenanceWindow
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	request.TenantID = identity.ResolveTenant(request.TenantID)
+	request.CreatedBy = identity.UserID
+
+	window, err := h.notificationService.CreateMaintenanceWindow(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create maintenance window", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    window,
+	})
+}
+
+// ListWindows returns the maintenance windows of a tenant, only the ones
+// muting notifications now with active=true
+func (h *MaintenanceHandler) ListWindows(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+	activeOnly := c.Query("active") == "true"
+
+	windows, err := h.notificationService.ListMaintenanceWindows(tenantID, activeOnly)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list maintenance windows", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    windows,
+	})
+}
+
+// GetWindow returns a single maintenance window
+func (h *MaintenanceHandler) GetWindow(c *gin.Context) {
+	window, err := h.notificationService.GetMaintenanceWindow(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Maintenance window not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    window,
+	})
+}
+
+// DeleteWindow cancels a maintenance window, sending what it deferred
+func (h *MaintenanceHandler) DeleteWindow(c *gin.Context) {
+	if err := h.notificationService.DeleteMaintenanceWindow(c.Param("id")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete maintenance window", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Maintenance window deleted successfully"),
+	})
+}
+
+// GetMutedDeliveries returns the audit of the deliveries maintenance windows
+// held back, optionally of a single window
+func (h *MaintenanceHandler) GetMutedDeliveries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit > 100 {
+		limit = 100
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	deliveries, err := h.notificationService.GetMutedDeliveries(tenantID, c.Query("window_id"), page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get muted deliveries", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    deliveries,
+	})
+}
@@ -0,0 +1,515 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type OnCallHandler struct {
+	onCallService *services.OnCallService
+}
+
+func NewOnCallHandler(onCallService *services.OnCallService) *OnCallHandler {
+	return &OnCallHandler{
+		onCallService: onCallService,
+	}
+}
+
+// RegisterRoutes registers on-call schedule, escalation policy, escalation
+// and alert routes. Everyone may see who is on call and acknowledge the
+// escalations paging them, managers change the schedules and policies.
+func (h *OnCallHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	managers := RequireRole(RoleAdmin, RoleManager, RoleService)
+
+	oncall := rg.Group("/oncall")
+	{
+		oncall.GET("/schedules", h.ListSchedules)
+		oncall.POST("/schedules", managers, h.CreateSchedule)
+		oncall.GET("/schedules/:id", h.authorizeSchedule, h.GetSchedule)
+		oncall.PUT("/schedules/:id", managers, h.authorizeSchedule, h.UpdateSchedule)
+		oncall.DELETE("/schedules/:id", managers, h.authorizeSchedule, h.DeleteSchedule)
+		oncall.GET("/schedules/:id/current", h.authorizeSchedule, h.GetOnCall)
+		oncall.GET("/schedules/:id/overrides", h.authorizeSchedule, h.ListOverrides)
+		oncall.POST("/schedules/:id/overrides", managers, h.authorizeSchedule, h.CreateOverride)
+		oncall.DELETE("/schedules/:id/overrides/:override_id", managers, h.authorizeSchedule, h.DeleteOverride)
+
+		oncall.GET("/policies", h.ListPolicies)
+		oncall.POST("/policies", managers, h.CreatePolicy)
+		oncall.GET("/policies/:id", h.authorizePolicy, h.GetPolicy)
+		oncall.PUT("/policies/:id", managers, h.authorizePolicy, h.UpdatePolicy)
+		oncall.DELETE("/policies/:id", managers, h.authorizePolicy, h.DeletePolicy)
+	}
+
+	escalations := rg.Group("/escalations")
+	{
+		escalations.GET("/", h.ListEscalations)
+		escalations.POST("/", managers, h.TriggerEscalation)
+		escalations.GET("/:id", h.authorizeEscalation, h.GetEscalation)
+		escalations.POST("/:id/acknowledge", h.authorizeEscalation, h.AcknowledgeEscalation)
+		escalations.POST("/:id/resolve", h.authorizeEscalation, h.ResolveEscalation)
+	}
+
+	alerts := rg.Group("/alerts")
+	{
+		alerts.GET("/", h.ListAlerts)
+		alerts.POST("/", managers, h.ProcessAlertEvent)
+		alerts.GET("/:id", h.authorizeAlert, h.GetAlert)
+		alerts.POST("/:id/resolve", h.authorizeAlert, h.ResolveAlert)
+	}
+}
+
+// authorizeSchedule rejects access to schedules of other tenants. Schedules of
+// other tenants are reported as missing so their IDs cannot be probed.
+func (h *OnCallHandler) authorizeSchedule(c *gin.Context) {
+	schedule, err := h.onCallService.GetSchedule(c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(schedule.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Schedule not found")
+		return
+	}
+
+	c.Next()
+}
+
+// authorizePolicy rejects access to escalation policies of other tenants
+func (h *OnCallHandler) authorizePolicy(c *gin.Context) {
+	policy, err := h.onCallService.GetPolicy(c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(policy.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Escalation policy not found")
+		return
+	}
+
+	c.Next()
+}
+
+// authorizeEscalation rejects access to escalations of other tenants
+func (h *OnCallHandler) authorizeEscalation(c *gin.Context) {
+	escalation, err := h.onCallService.GetEscalation(c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(escalation.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Escalation not found")
+		return
+	}
+
+	c.Next()
+}
+
+// authorizeAlert rejects access to alerts of other tenants
+func (h *OnCallHandler) authorizeAlert(c *gin.Context) {
+	alert, err := h.onCallService.GetAlert(c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(alert.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Alert not found")
+		return
+	}
+
+	c.Next()
+}
+
+// CreateSchedule handles creating an on-call schedule
+func (h *OnCallHandler) CreateSchedule(c *gin.Context) {
+	var request services.OnCallSchedule
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	request.TenantID = identity.ResolveTenant(request.TenantID)
+	request.CreatedBy = identity.UserID
+
+	schedule, err := h.onCallService.CreateSchedule(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create schedule", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    schedule,
+	})
+}
+
+// ListSchedules returns the schedules of a tenant, optionally of one team
+func (h *OnCallHandler) ListSchedules(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	schedules, err := h.onCallService.ListSchedules(tenantID, c.Query("team"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list schedules", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schedules,
+	})
+}
+
+// GetSchedule returns a single schedule
+func (h *OnCallHandler) GetSchedule(c *gin.Context) {
+	schedule, err := h.onCallService.GetSchedule(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Schedule not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schedule,
+	})
+}
+
+// UpdateSchedule handles updating a schedule
+func (h *OnCallHandler) UpdateSchedule(c *gin.Context) {
+	var request services.OnCallSchedule
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	schedule, err := h.onCallService.UpdateSchedule(c.Param("id"), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update schedule", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    schedule,
+	})
+}
+
+// DeleteSchedule handles deleting a schedule
+func (h *OnCallHandler) DeleteSchedule(c *gin.Context) {
+	if err := h.onCallService.DeleteSchedule(c.Param("id")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete schedule", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Schedule deleted successfully"),
+	})
+}
+
+// GetOnCall returns who is on call now, or at the RFC 3339 time in the at
+// query parameter
+func (h *OnCallHandler) GetOnCall(c *gin.Context) {
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.Respond(c, problem.CodeInvalidRequest, "Invalid time: "+value)
+			return
+		}
+		at = parsed
+	}
+
+	shift, err := h.onCallService.WhoIsOnCall(c.Param("id"), at)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get who is on call", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    shift,
+	})
+}
+
+// CreateOverride handles putting someone on call in place of the rotations
+func (h *OnCallHandler) CreateOverride(c *gin.Context) {
+	var request services.OnCallOverride
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+	request.CreatedBy = GetIdentity(c).UserID
+
+	override, err := h.onCallService.CreateOverride(c.Param("id"), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create override", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    override,
+	})
+}
+
+// ListOverrides returns the current and upcoming overrides of a schedule
+func (h *OnCallHandler) ListOverrides(c *gin.Context) {
+	overrides, err := h.onCallService.ListOverrides(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list overrides", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    overrides,
+	})
+}
+
+// DeleteOverride handles removing an override
+func (h *OnCallHandler) DeleteOverride(c *gin.Context) {
+	if err := h.onCallService.DeleteOverride(c.Param("id"), c.Param("override_id")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete override", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Override deleted successfully"),
+	})
+}
+
+// CreatePolicy handles creating an escalation policy
+func (h *OnCallHandler) CreatePolicy(c *gin.Context) {
+	var request services.EscalationPolicy
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	request.TenantID = identity.ResolveTenant(request.TenantID)
+	request.CreatedBy = identity.UserID
+
+	policy, err := h.onCallService.CreatePolicy(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create escalation policy", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// ListPolicies returns the escalation policies of a tenant
+func (h *OnCallHandler) ListPolicies(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	policies, err := h.onCallService.ListPolicies(tenantID, c.Query("team"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list escalation policies", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policies,
+	})
+}
+
+// GetPolicy returns a single escalation policy
+func (h *OnCallHandler) GetPolicy(c *gin.Context) {
+	policy, err := h.onCallService.GetPolicy(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Escalation policy not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// UpdatePolicy handles updating an escalation policy
+func (h *OnCallHandler) UpdatePolicy(c *gin.Context) {
+	var request services.EscalationPolicy
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	policy, err := h.onCallService.UpdatePolicy(c.Param("id"), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update escalation policy", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// DeletePolicy handles deleting an escalation policy
+func (h *OnCallHandler) DeletePolicy(c *gin.Context) {
+	if err := h.onCallService.DeletePolicy(c.Param("id")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete escalation policy", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Escalation policy deleted successfully"),
+	})
+}
+
+// TriggerEscalation handles raising an alert through an escalation policy
+func (h *OnCallHandler) TriggerEscalation(c *gin.Context) {
+	var request services.Escalation
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+	request.TenantID = GetIdentity(c).ResolveTenant(request.TenantID)
+
+	escalation, err := h.onCallService.TriggerEscalation(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to trigger escalation", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    escalation,
+	})
+}
+
+// ListEscalations returns the escalations of a tenant, the newest first
+func (h *OnCallHandler) ListEscalations(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit > 100 {
+		limit = 100
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	escalations, err := h.onCallService.ListEscalations(tenantID, c.Query("status"), page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list escalations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    escalations,
+	})
+}
+
+// GetEscalation returns a single escalation with the pages sent for it
+func (h *OnCallHandler) GetEscalation(c *gin.Context) {
+	escalation, err := h.onCallService.GetEscalation(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Escalation not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    escalation,
+	})
+}
+
+// AcknowledgeEscalation stops an escalation on behalf of the caller
+func (h *OnCallHandler) AcknowledgeEscalation(c *gin.Context) {
+	escalation, err := h.onCallService.AcknowledgeEscalation(c.Param("id"), GetIdentity(c).UserID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to acknowledge escalation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    escalation,
+	})
+}
+
+// ResolveEscalation closes an escalation on behalf of the caller
+func (h *OnCallHandler) ResolveEscalation(c *gin.Context) {
+	escalation, err := h.onCallService.ResolveEscalation(c.Param("id"), GetIdentity(c).UserID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to resolve escalation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    escalation,
+	})
+}
+
+// ProcessAlertEvent opens, repeats or resolves the alert of an incident key
+// as reported by a monitoring source
+func (h *OnCallHandler) ProcessAlertEvent(c *gin.Context) {
+	var event services.AlertEvent
+	if err := validation.BindJSON(c, &event); err != nil {
+		respondBindError(c, "Invalid alert event", err)
+		return
+	}
+	event.TenantID = GetIdentity(c).ResolveTenant(event.TenantID)
+
+	alert, err := h.onCallService.ProcessAlertEvent(event)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to process alert event", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    alert,
+	})
+}
+
+// ListAlerts returns the alerts of a tenant, the newest first
+func (h *OnCallHandler) ListAlerts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit > 100 {
+		limit = 100
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	alerts, err := h.onCallService.ListAlerts(tenantID, c.Query("status"), page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list alerts", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alerts,
+	})
+}
+
+// GetAlert returns a single alert with the notifications sent for it
+func (h *OnCallHandler) GetAlert(c *gin.Context) {
+	alert, err := h.onCallService.GetAlert(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Alert not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alert,
+	})
+}
+
+// ResolveAlert closes an alert on behalf of the caller
+func (h *OnCallHandler) ResolveAlert(c *gin.Context) {
+	alert, err := h.onCallService.ResolveAlert(c.Param("id"), GetIdentity(c).UserID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to resolve alert", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alert,
+	})
+}
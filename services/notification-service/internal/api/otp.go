@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type OTPHandler struct {
+	notificationService *services.NotificationService
+}
+
+type SendOTPRequest struct {
+	TenantID   string `json:"tenant_id"`
+	Channel    string `json:"channel" binding:"required,oneof=sms email"`
+	Recipient  string `json:"recipient" binding:"required"`
+	Purpose    string `json:"purpose" binding:"max=64"`
+	TemplateID string `json:"template_id"`
+	Locale     string `json:"locale"`
+}
+
+type VerifyOTPRequest struct {
+	TenantID  string `json:"tenant_id"`
+	Recipient string `json:"recipient" binding:"required"`
+	Purpose   string `json:"purpose" binding:"max=64"`
+	Code      string `json:"code" binding:"required"`
+}
+
+func NewOTPHandler(notificationService *services.NotificationService) *OTPHandler {
+	return &OTPHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers one-time code routes. Codes can be sent to any
+// address, so only admins and services send and verify them.
+func (h *OTPHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	otp := rg.Group("/otp")
+	otp.Use(RequireRole(RoleAdmin, RoleService))
+	{
+		otp.POST("/send", h.SendOTP)
+		otp.POST("/verify", h.VerifyOTP)
+	}
+}
+
+// SendOTP sends a one-time code by SMS or email
+func (h *OTPHandler) SendOTP(c *gin.Context) {
+	var req SendOTPRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	challenge, err := h.notificationService.SendOTP(c.Request.Context(), services.OTPRequest{
+		TenantID:   GetIdentity(c).ResolveTenant(req.TenantID),
+		Channel:    req.Channel,
+		Recipient:  req.Recipient,
+		Purpose:    req.Purpose,
+		TemplateID: req.TemplateID,
+		Locale:     req.Locale,
+	})
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to send code", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    challenge,
+	})
+}
+
+// VerifyOTP checks a one-time code
+func (h *OTPHandler) VerifyOTP(c *gin.Context) {
+	var req VerifyOTPRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		respondBindError(c, "Invalid request body", err)
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(req.TenantID)
+	if err := h.notificationService.VerifyOTP(c.Request.Context(), tenantID, req.Recipient, req.Purpose, req.Code); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to verify code", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"verified": true},
+	})
+}
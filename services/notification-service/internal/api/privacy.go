@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+)
+
+type PrivacyHandler struct {
+	privacyService *services.PrivacyService
+}
+
+func NewPrivacyHandler(privacyService *services.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+	}
+}
+
+// RegisterRoutes registers KVKK/GDPR data subject routes
+func (h *PrivacyHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	privacy := rg.Group("/privacy")
+	{
+		privacy.GET("/users/:user_id/export", h.ExportUserData)
+		privacy.DELETE("/users/:user_id", RequireRole(RoleAdmin, RoleService), h.EraseUserData)
+		privacy.GET("/erasures", RequireRole(RoleAdmin, RoleService), h.GetErasureRecords)
+	}
+}
+
+// ExportUserData returns all notification data held about a user
+func (h *PrivacyHandler) ExportUserData(c *gin.Context) {
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(c.Query("tenant_id"))
+	userID := c.Param("user_id")
+
+	if !identity.CanAccessUser(tenantID, userID) {
+		problem.Respond(c, problem.CodeForbidden, "Not allowed to export data of this user")
+		return
+	}
+
+	export, err := h.privacyService.ExportUserData(c.Request.Context(), tenantID, userID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to export user data", err)
+		return
+	}
+
+	// Offer the export as a file so it can be handed to the data subject
+	c.Header("Content-Disposition", "attachment; filename=notification-data-"+userID+".json")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    export,
+	})
+}
+
+// EraseUserData erases all notification data held about a user
+func (h *PrivacyHandler) EraseUserData(c *gin.Context) {
+	identity := GetIdentity(c)
+	tenantID := identity.ResolveTenant(c.Query("tenant_id"))
+
+	record, err := h.privacyService.EraseUserData(c.Request.Context(), tenantID, c.Param("user_id"), identity.UserID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to erase user data", err)
+		return
+	}
+
+	// Stores that could not be erased are reported so the request can be retried
+	status := http.StatusOK
+	if record.Status != "completed" {
+		status = http.StatusMultiStatus
+	}
+
+	c.JSON(status, gin.H{
+		"success": record.Status == "completed",
+		"data":    record,
+	})
+}
+
+// GetErasureRecords returns the anonymised erasure records of a tenant
+func (h *PrivacyHandler) GetErasureRecords(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	records, total, err := h.privacyService.GetErasureRecords(c.Request.Context(), tenantID, page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get erasure records", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"erasures": records,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type RetentionHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewRetentionHandler(notificationService *services.NotificationService) *RetentionHandler {
+	return &RetentionHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers retention routes
+func (h *RetentionHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	retention := rg.Group("/retention")
+	retention.Use(RequireRole(RoleAdmin, RoleService))
+	{
+		retention.GET("/policy", h.GetRetentionPolicy)
+		retention.PUT("/policy", h.UpdateRetentionPolicy)
+		retention.GET("/progress", h.GetRetentionProgress)
+		retention.POST("/run", h.RunRetention)
+	}
+}
+
+// GetRetentionPolicy returns the retention policy of the caller's tenant
+func (h *RetentionHandler) GetRetentionPolicy(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	policy, err := h.notificationService.GetRetentionPolicy(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get retention policy", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// UpdateRetentionPolicy replaces the retention policy of the caller's tenant
+func (h *RetentionHandler) UpdateRetentionPolicy(c *gin.Context) {
+	var request services.RetentionPolicy
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	request.TenantID = GetIdentity(c).ResolveTenant(request.TenantID)
+
+	policy, err := h.notificationService.SetRetentionPolicy(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update retention policy", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    policy,
+	})
+}
+
+// GetRetentionProgress returns the archival progress of the caller's tenant
+func (h *RetentionHandler) GetRetentionProgress(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	progress, err := h.notificationService.GetRetentionProgress(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get retention progress", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    progress,
+	})
+}
+
+// RunRetention applies the retention policy of the caller's tenant in the background
+func (h *RetentionHandler) RunRetention(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	h.notificationService.StartRetention(tenantID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": localize(c, "Retention run started"),
+	})
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat/pkg/runtimeconfig"
+	"claude-talimat/pkg/validation"
+)
+
+type RuntimeConfigHandler struct {
+	store *runtimeconfig.Store
+}
+
+func NewRuntimeConfigHandler(store *runtimeconfig.Store) *RuntimeConfigHandler {
+	return &RuntimeConfigHandler{
+		store: store,
+	}
+}
+
+// RegisterRoutes registers runtime configuration routes. The tunables apply
+// to every tenant, so only API-key callers acting across tenants see and
+// change them.
+func (h *RuntimeConfigHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	runtime := rg.Group("/admin/runtime-config", requireOperator)
+	{
+		runtime.GET("", h.GetRuntimeConfig)
+		runtime.PUT("", h.UpdateRuntimeConfig)
+	}
+}
+
+// requireOperator rejects callers bound to a tenant
+func requireOperator(c *gin.Context) {
+	identity := GetIdentity(c)
+	if identity.Role != RoleService || identity.TenantID != "" {
+		problem.Abort(c, problem.CodeForbidden, "Only available to operators")
+		return
+	}
+
+	c.Next()
+}
+
+// GetRuntimeConfig returns the runtime configuration values that are set
+func (h *RuntimeConfigHandler) GetRuntimeConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.store.Values(),
+	})
+}
+
+// UpdateRuntimeConfig handles changing runtime configuration values, an
+// empty value restores the default of a key
+func (h *RuntimeConfigHandler) UpdateRuntimeConfig(c *gin.Context) {
+	var values map[string]string
+	if err := validation.BindJSON(c, &values); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	if err := h.store.Set(c.Request.Context(), values); err != nil {
+		if errors.Is(err, runtimeconfig.ErrReadOnly) {
+			problem.Respond(c, problem.CodeConflict, "Runtime configuration can't be changed through the API")
+			return
+		}
+		respondError(c, problem.CodeInternal, "Failed to update runtime configuration", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.store.Values(),
+	})
+}
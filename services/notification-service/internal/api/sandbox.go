@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type SandboxHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewSandboxHandler(notificationService *services.NotificationService) *SandboxHandler {
+	return &SandboxHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers sandbox routes
+func (h *SandboxHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	sandbox := rg.Group("/sandbox")
+	sandbox.Use(RequireRole(RoleAdmin, RoleService))
+	{
+		sandbox.GET("", h.GetSandbox)
+		sandbox.PUT("", h.UpdateSandbox)
+	}
+}
+
+// GetSandbox returns whether the caller's tenant is in sandbox mode
+func (h *SandboxHandler) GetSandbox(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	status, err := h.notificationService.GetSandbox(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get sandbox status", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+// UpdateSandbox puts the caller's tenant in or out of sandbox mode
+func (h *SandboxHandler) UpdateSandbox(c *gin.Context) {
+	var request services.SandboxStatus
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	request.TenantID = GetIdentity(c).ResolveTenant(request.TenantID)
+
+	status, err := h.notificationService.SetSandbox(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update sandbox mode", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
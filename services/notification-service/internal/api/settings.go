@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat-notifications/models"
+	"claude-talimat/pkg/validation"
+)
+
+type SettingsHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewSettingsHandler(notificationService *services.NotificationService) *SettingsHandler {
+	return &SettingsHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterRoutes registers notification settings routes. The settings apply
+// to every send of the tenant, so only admins and services manage them.
+func (h *SettingsHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	settings := rg.Group("/settings")
+	settings.Use(RequireRole(RoleAdmin, RoleService))
+	{
+		settings.GET("", h.GetSettings)
+		settings.PUT("", h.UpdateSettings)
+		settings.DELETE("", h.DeleteSettings)
+	}
+}
+
+// GetSettings returns the notification settings of the caller's tenant
+func (h *SettingsHandler) GetSettings(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	settings, err := h.notificationService.GetSettings(c.Request.Context(), tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get notification settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    settings,
+	})
+}
+
+// UpdateSettings replaces the notification settings of the caller's tenant
+func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
+	var request models.NotificationSettings
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	request.TenantID = GetIdentity(c).ResolveTenant(request.TenantID)
+
+	settings, err := h.notificationService.SetSettings(c.Request.Context(), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update notification settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    settings,
+	})
+}
+
+// DeleteSettings removes the notification settings of the caller's tenant
+func (h *SettingsHandler) DeleteSettings(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	if err := h.notificationService.DeleteSettings(c.Request.Context(), tenantID); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete notification settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Notification settings deleted successfully"),
+	})
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type SMSHandler struct {
+	notificationService *services.NotificationService
+	smsService          *services.SMSService
+}
+
+func NewSMSHandler(notificationService *services.NotificationService, smsService *services.SMSService) *SMSHandler {
+	return &SMSHandler{
+		notificationService: notificationService,
+		smsService:          smsService,
+	}
+}
+
+// RegisterRoutes registers SMS settings routes. The sender and providers of a
+// tenant are shared by all its users, only admins change them.
+func (h *SMSHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	sms := rg.Group("/sms")
+	sms.Use(RequireRole(RoleAdmin, RoleService))
+	{
+		sms.GET("/settings", h.GetSettings)
+		sms.PUT("/settings", h.UpdateSettings)
+		sms.GET("/rate-limits", h.GetRateLimits)
+		sms.GET("/opt-outs", h.GetOptOuts)
+		sms.DELETE("/opt-outs/:phone", h.RemoveOptOut)
+	}
+}
+
+// RegisterPublicRoutes registers the delivery report and inbound message routes
+// SMS providers call. Providers can't authenticate as users, each request is
+// verified by the signature or token its provider uses.
+func (h *SMSHandler) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	sms := rg.Group("/sms")
+	{
+		sms.GET("/status/:provider", h.ReceiveDeliveryReport)
+		sms.POST("/status/:provider", h.ReceiveDeliveryReport)
+		sms.GET("/inbound/:provider", h.ReceiveInboundMessage)
+		sms.POST("/inbound/:provider", h.ReceiveInboundMessage)
+	}
+}
+
+// ReceiveDeliveryReport applies a delivery report of an SMS provider
+func (h *SMSHandler) ReceiveDeliveryReport(c *gin.Context) {
+	callback, err := smsCallback(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeInvalidRequest, "Invalid delivery report: "+err.Error())
+		return
+	}
+
+	if err := h.notificationService.ReceiveSMSDeliveryReport(c.Param("provider"), callback); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to apply delivery report", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReceiveInboundMessage applies a reply forwarded by an SMS provider to the
+// notification it answers
+func (h *SMSHandler) ReceiveInboundMessage(c *gin.Context) {
+	callback, err := smsCallback(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeInvalidRequest, "Invalid inbound message: "+err.Error())
+		return
+	}
+
+	message, err := h.smsService.ParseInboundMessage(c.Param("provider"), callback)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to receive inbound message", err)
+		return
+	}
+
+	if _, err := h.notificationService.ReceiveSMSReply(*message); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to apply SMS reply", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetOptOuts returns the numbers that opted out of the SMS of the caller's tenant
+func (h *SMSHandler) GetOptOuts(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	phones, err := h.smsService.GetOptOuts(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get SMS opt-outs", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    phones,
+	})
+}
+
+// RemoveOptOut lets the SMS of the caller's tenant reach a number again
+func (h *SMSHandler) RemoveOptOut(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	if err := h.smsService.OptIn(tenantID, c.Param("phone")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to remove SMS opt-out", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "SMS opt-out removed"),
+	})
+}
+
+// GetRateLimits returns how the rate limits of the SMS providers throttled sends
+func (h *SMSHandler) GetRateLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.smsService.RateLimitStats(),
+	})
+}
+
+// GetSettings returns the SMS settings of the caller's tenant
+func (h *SMSHandler) GetSettings(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	settings, err := h.smsService.GetTenantSettings(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get SMS settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    settings,
+	})
+}
+
+// UpdateSettings replaces the SMS settings of the caller's tenant
+func (h *SMSHandler) UpdateSettings(c *gin.Context) {
+	var request services.SMSTenantSettings
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	request.TenantID = GetIdentity(c).ResolveTenant(request.TenantID)
+
+	settings, err := h.smsService.SetTenantSettings(request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update SMS settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    settings,
+	})
+}
+
+// smsCallback captures a request an SMS provider made. The URL is rebuilt as
+// the provider called it, behind proxies too, since signatures cover it.
+func smsCallback(c *gin.Context) (services.SMSCallback, error) {
+	if err := c.Request.ParseForm(); err != nil {
+		return services.SMSCallback{}, err
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return services.SMSCallback{
+		URL:    scheme + "://" + c.Request.Host + c.Request.URL.RequestURI(),
+		Query:  c.Request.URL.Query(),
+		Form:   c.Request.PostForm,
+		Header: c.Request.Header,
+	}, nil
+}
@@ -0,0 +1,400 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type TemplateHandler struct {
+	templateService *services.TemplateService
+}
+
+func NewTemplateHandler(templateService *services.TemplateService) *TemplateHandler {
+	return &TemplateHandler{
+		templateService: templateService,
+	}
+}
+
+// RegisterRoutes registers template branding, localization, helper, search,
+// import and versioning routes, only admins change them
+func (h *TemplateHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	templates := rg.Group("/templates")
+	{
+		templates.GET("/branding", h.GetBranding)
+		templates.PUT("/branding", RequireRole(RoleAdmin), h.UpdateBranding)
+		templates.GET("/locales", h.GetLocaleSettings)
+		templates.PUT("/locales", RequireRole(RoleAdmin), h.UpdateLocaleSettings)
+		templates.GET("/locales/coverage", h.GetLocaleCoverage)
+		templates.GET("/resolve", h.ResolveTemplate)
+		templates.GET("/helpers", h.GetHelpers)
+		templates.GET("/search", h.SearchTemplates)
+		templates.GET("/export", RequireRole(RoleAdmin), h.ExportTemplates)
+		templates.POST("/import", RequireRole(RoleAdmin), h.ImportTemplates)
+		templates.GET("/:id/variants", h.authorizeTemplate, h.GetVariants)
+		templates.GET("/:id/versions", h.authorizeTemplate, h.GetVersions)
+		templates.GET("/:id/versions/:version", h.authorizeTemplate, h.GetVersion)
+		templates.POST("/:id/preview", h.authorizeTemplate, h.PreviewTemplate)
+		templates.POST("/:id/publish", RequireRole(RoleAdmin), h.authorizeTemplate, h.PublishTemplate)
+		templates.POST("/:id/rollback", RequireRole(RoleAdmin), h.authorizeTemplate, h.RollbackTemplate)
+	}
+}
+
+// authorizeTemplate rejects access to templates of other tenants. Templates of
+// other tenants are reported as missing so their IDs cannot be probed.
+func (h *TemplateHandler) authorizeTemplate(c *gin.Context) {
+	template, err := h.templateService.GetTemplate(c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(template.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Template not found")
+		return
+	}
+
+	c.Next()
+}
+
+// GetBranding returns the branding the caller's tenant renders templates with
+func (h *TemplateHandler) GetBranding(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	branding, err := h.templateService.GetBranding(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get branding", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    branding,
+	})
+}
+
+// UpdateBranding replaces the branding of the caller's tenant
+func (h *TemplateHandler) UpdateBranding(c *gin.Context) {
+	var request services.TemplateBranding
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid branding data", err)
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	branding, err := h.templateService.SetBranding(tenantID, request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update branding", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    branding,
+	})
+}
+
+// GetHelpers documents the helpers templates can call
+func (h *TemplateHandler) GetHelpers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    services.TemplateHelpers(),
+	})
+}
+
+// SearchTemplates returns the templates of the caller's tenant containing
+// every word of q, optionally of a locale, type or active state
+func (h *TemplateHandler) SearchTemplates(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := services.TemplateSearchQuery{
+		TenantID: tenantID,
+		Search:   c.Query("q"),
+		Locale:   c.Query("locale"),
+		Type:     c.Query("type"),
+		Page:     page,
+		Limit:    limit,
+	}
+	if raw := c.Query("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			problem.Respond(c, problem.CodeInvalidRequest, "Invalid filter")
+			return
+		}
+		query.Active = &active
+	}
+
+	templates, total, err := h.templateService.SearchTemplates(query)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to search templates", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"templates": templates,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// GetLocaleSettings returns the locale settings of the caller's tenant
+func (h *TemplateHandler) GetLocaleSettings(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	settings, err := h.templateService.GetLocaleSettings(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get locale settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    settings,
+	})
+}
+
+// UpdateLocaleSettings replaces the locale settings of the caller's tenant
+func (h *TemplateHandler) UpdateLocaleSettings(c *gin.Context) {
+	var request services.TemplateLocaleSettings
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid locale settings", err)
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	settings, err := h.templateService.SetLocaleSettings(tenantID, request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update locale settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    settings,
+	})
+}
+
+// GetLocaleCoverage lists the untranslated templates of the caller's tenant per locale
+func (h *TemplateHandler) GetLocaleCoverage(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	coverage, err := h.templateService.GetLocaleCoverage(tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get locale coverage", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    coverage,
+	})
+}
+
+// ResolveTemplate returns the variant of a template a user of a locale gets
+func (h *TemplateHandler) ResolveTemplate(c *gin.Context) {
+	name, templateType := c.Query("name"), c.Query("type")
+	if name == "" || templateType == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "Template name and type are required")
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+	locale := c.Query("locale")
+
+	template, err := h.templateService.ResolveTemplate(name, templateType, tenantID, locale)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to resolve template", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"template":     template,
+			"locale_chain": h.templateService.LocaleChain(tenantID, locale),
+		},
+	})
+}
+
+// ExportTemplates returns a backup of the templates of the caller's tenant
+func (h *TemplateHandler) ExportTemplates(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	export, err := h.templateService.ExportTemplates(c.Request.Context(), tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to export templates", err)
+		return
+	}
+
+	filename := "templates.json"
+	if tenantID != "" {
+		filename = "templates-" + tenantID + ".json"
+	}
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    export,
+	})
+}
+
+// ImportTemplates imports templates into the caller's tenant, the default
+// safety templates with ?source=defaults or an export otherwise. Existing
+// templates are replaced only with ?overwrite=true.
+func (h *TemplateHandler) ImportTemplates(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	var result *services.TemplateImportResult
+	var err error
+	switch c.DefaultQuery("source", "export") {
+	case "defaults":
+		result, err = h.templateService.SeedDefaultTemplates(c.Request.Context(), tenantID)
+	case "export":
+		var export services.TemplateExport
+		if err := validation.BindJSON(c, &export); err != nil {
+			respondBindError(c, "Invalid template export", err)
+			return
+		}
+		result, err = h.templateService.ImportTemplates(c.Request.Context(), tenantID, export, c.Query("overwrite") == "true")
+	default:
+		problem.Respond(c, problem.CodeInvalidRequest, "Import source must be defaults or export")
+		return
+	}
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to import templates", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// GetVariants returns the locale variants of a template
+func (h *TemplateHandler) GetVariants(c *gin.Context) {
+	template, err := h.templateService.GetTemplate(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get template", err)
+		return
+	}
+
+	variants, err := h.templateService.GetTemplateVariants(template.Name, template.Type, template.TenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get template variants", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    variants,
+	})
+}
+
+// GetVersions returns the published versions of a template
+func (h *TemplateHandler) GetVersions(c *gin.Context) {
+	versions, err := h.templateService.GetTemplateVersions(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get template versions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    versions,
+	})
+}
+
+// GetVersion returns a published version of a template
+func (h *TemplateHandler) GetVersion(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		problem.Respond(c, problem.CodeInvalidRequest, "Invalid template version")
+		return
+	}
+
+	template, err := h.templateService.GetTemplateVersion(c.Param("id"), version)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get template version", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    template,
+	})
+}
+
+// PreviewTemplate renders the working copy of a template with sample data
+func (h *TemplateHandler) PreviewTemplate(c *gin.Context) {
+	var request struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	result, err := h.templateService.RenderDraft(c.Param("id"), request.Data)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to render template", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// PublishTemplate publishes the working copy of a template
+func (h *TemplateHandler) PublishTemplate(c *gin.Context) {
+	template, err := h.templateService.PublishTemplate(c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to publish template", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    template,
+	})
+}
+
+// RollbackTemplate makes notifications use an earlier version of a template
+func (h *TemplateHandler) RollbackTemplate(c *gin.Context) {
+	var request struct {
+		Version int `json:"version" binding:"required,min=1"`
+	}
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid request data", err)
+		return
+	}
+
+	template, err := h.templateService.RollbackTemplate(c.Param("id"), request.Version)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to roll back template", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    template,
+	})
+}
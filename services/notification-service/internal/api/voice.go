@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+)
+
+type VoiceHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewVoiceHandler(notificationService *services.NotificationService) *VoiceHandler {
+	return &VoiceHandler{
+		notificationService: notificationService,
+	}
+}
+
+// RegisterPublicRoutes registers the call event and keypress routes voice
+// providers call. Each request is verified by the signature of its provider.
+func (h *VoiceHandler) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	voice := rg.Group("/voice")
+	{
+		voice.POST("/status/:provider", h.ReceiveCallEvent)
+		voice.POST("/keypress/:provider", h.ReceiveKeypress)
+	}
+}
+
+// ReceiveCallEvent applies the outcome of a call reported by its provider
+func (h *VoiceHandler) ReceiveCallEvent(c *gin.Context) {
+	callback, err := smsCallback(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeInvalidRequest, "Invalid call event: "+err.Error())
+		return
+	}
+
+	if err := h.notificationService.ReceiveVoiceCallEvent(c.Param("provider"), callback); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to apply call event", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ReceiveKeypress acknowledges a notification from the keys pressed during
+// its call, and answers with what the provider speaks to the recipient
+func (h *VoiceHandler) ReceiveKeypress(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		problem.Respond(c, problem.CodeInvalidRequest, "Acknowledgment token is required")
+		return
+	}
+
+	callback, err := smsCallback(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeInvalidRequest, "Invalid keypress: "+err.Error())
+		return
+	}
+
+	contentType, body, err := h.notificationService.ReceiveVoiceKeypress(c.Param("provider"), token, callback)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to apply keypress", err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, []byte(body))
+}
@@ -0,0 +1,378 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/validation"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// webhookEndpointUpdate holds the endpoint fields an update changes, the
+// ones left out keep their value
+type webhookEndpointUpdate struct {
+	Name       *string           `json:"name"`
+	URL        *string           `json:"url"`
+	Method     *string           `json:"method"`
+	Headers    map[string]string `json:"headers"`
+	Events     []string          `json:"events"`
+	Secret     *string           `json:"secret"`
+	IsActive   *bool             `json:"is_active"`
+	RetryCount *int              `json:"retry_count" binding:"omitempty,min=1,max=10"`
+	Timeout    *time.Duration    `json:"timeout"`
+
+	// An empty list removes the filters, an empty transform sends the
+	// payload as it is
+	Filters   []services.WebhookFilter   `json:"filters"`
+	Transform *services.WebhookTransform `json:"transform"`
+
+	// An empty certificate turns mutual TLS off
+	ClientCertificate *services.WebhookClientCertificate `json:"client_certificate"`
+}
+
+// RegisterRoutes registers webhook endpoint routes. Endpoints receive the
+// tenant's events, so only admins and services manage them.
+func (h *WebhookHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	webhooks := rg.Group("/webhooks")
+	webhooks.Use(RequireRole(RoleAdmin, RoleService))
+	{
+		webhooks.GET("/", h.ListEndpoints)
+		webhooks.POST("/", h.CreateEndpoint)
+		webhooks.GET("/events", h.ListEventTypes)
+		webhooks.GET("/allowlist", h.GetAllowList)
+		webhooks.PUT("/allowlist", RequireRole(RoleAdmin), h.UpdateAllowList)
+		webhooks.GET("/:id", h.authorizeEndpoint, h.GetEndpoint)
+		webhooks.PUT("/:id", h.authorizeEndpoint, h.UpdateEndpoint)
+		webhooks.DELETE("/:id", h.authorizeEndpoint, h.DeleteEndpoint)
+		webhooks.GET("/:id/deliveries", h.authorizeEndpoint, h.GetDeliveries)
+		webhooks.POST("/:id/test", h.authorizeEndpoint, h.TestEndpoint)
+		webhooks.GET("/:id/health", h.authorizeEndpoint, h.GetEndpointHealth)
+		webhooks.POST("/:id/enable", h.authorizeEndpoint, h.EnableEndpoint)
+	}
+}
+
+// authorizeEndpoint rejects access to endpoints of other tenants. Endpoints of
+// other tenants are reported as missing so their IDs cannot be probed.
+func (h *WebhookHandler) authorizeEndpoint(c *gin.Context) {
+	endpoint, err := h.webhookService.GetEndpoint(c.Request.Context(), c.Param("id"))
+	if err != nil || !GetIdentity(c).CanAccessTenant(endpoint.TenantID) {
+		problem.Abort(c, problem.CodeNotFound, "Webhook endpoint not found")
+		return
+	}
+
+	c.Next()
+}
+
+// CreateEndpoint handles creating a webhook endpoint. The secret is only
+// returned here.
+func (h *WebhookHandler) CreateEndpoint(c *gin.Context) {
+	var request services.WebhookEndpoint
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid webhook endpoint", err)
+		return
+	}
+
+	identity := GetIdentity(c)
+	request.ID = ""
+	request.TenantID = identity.ResolveTenant(request.TenantID)
+	request.CreatedBy = identity.UserID
+	request.LastTrigger = nil
+	request.LastSuccess = nil
+	request.LastError = ""
+	request.DisabledAt = nil
+	request.DisabledReason = ""
+
+	endpoint, err := h.webhookService.CreateEndpoint(c.Request.Context(), request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to create webhook endpoint", err)
+		return
+	}
+
+	// The secret is shown once, the client certificate key never
+	if endpoint.ClientCertificate != nil {
+		endpoint.ClientCertificate.PrivateKeyPEM = ""
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    endpoint,
+	})
+}
+
+// ListEndpoints returns the webhook endpoints of a tenant
+func (h *WebhookHandler) ListEndpoints(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	endpoints, total, err := h.webhookService.ListEndpoints(c.Request.Context(), tenantID, page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to list webhook endpoints", err)
+		return
+	}
+	for _, endpoint := range endpoints {
+		redactEndpoint(endpoint)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"endpoints": endpoints,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// GetEndpoint returns a single webhook endpoint
+func (h *WebhookHandler) GetEndpoint(c *gin.Context) {
+	endpoint, err := h.webhookService.GetEndpoint(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeNotFound, "Webhook endpoint not found", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    redactEndpoint(endpoint),
+	})
+}
+
+// UpdateEndpoint handles updating a webhook endpoint
+func (h *WebhookHandler) UpdateEndpoint(c *gin.Context) {
+	var request webhookEndpointUpdate
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid webhook endpoint", err)
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if request.Name != nil {
+		updates["name"] = *request.Name
+	}
+	if request.URL != nil {
+		updates["url"] = *request.URL
+	}
+	if request.Method != nil {
+		updates["method"] = *request.Method
+	}
+	if request.Headers != nil {
+		updates["headers"] = request.Headers
+	}
+	if request.Events != nil {
+		updates["events"] = request.Events
+	}
+	if request.Secret != nil {
+		updates["secret"] = *request.Secret
+	}
+	if request.IsActive != nil {
+		updates["is_active"] = *request.IsActive
+	}
+	if request.RetryCount != nil {
+		updates["retry_count"] = *request.RetryCount
+	}
+	if request.Timeout != nil {
+		updates["timeout"] = *request.Timeout
+	}
+	if request.Filters != nil {
+		updates["filters"] = request.Filters
+	}
+	if request.Transform != nil {
+		updates["transform"] = request.Transform
+	}
+	if request.ClientCertificate != nil {
+		updates["client_certificate"] = request.ClientCertificate
+	}
+
+	endpoint, err := h.webhookService.UpdateEndpoint(c.Request.Context(), c.Param("id"), updates)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update webhook endpoint", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    redactEndpoint(endpoint),
+	})
+}
+
+// ListEventTypes returns the event types endpoints of the caller's tenant
+// can subscribe to, with their schemas and sample payloads
+func (h *WebhookHandler) ListEventTypes(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	eventTypes, err := h.webhookService.ListEventTypes(c.Request.Context(), tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get webhook event types", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    eventTypes,
+	})
+}
+
+// GetAllowList returns the destination allow-list of the caller's tenant
+func (h *WebhookHandler) GetAllowList(c *gin.Context) {
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	allowList, err := h.webhookService.GetAllowList(c.Request.Context(), tenantID)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get webhook allow-list", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    allowList,
+	})
+}
+
+// UpdateAllowList replaces the destination allow-list of the caller's tenant
+func (h *WebhookHandler) UpdateAllowList(c *gin.Context) {
+	var request services.WebhookAllowList
+	if err := validation.BindJSON(c, &request); err != nil {
+		respondBindError(c, "Invalid webhook allow-list", err)
+		return
+	}
+
+	tenantID := GetIdentity(c).ResolveTenant(c.Query("tenant_id"))
+
+	allowList, err := h.webhookService.SetAllowList(c.Request.Context(), tenantID, request)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to update webhook allow-list", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    allowList,
+	})
+}
+
+// DeleteEndpoint handles deleting a webhook endpoint
+func (h *WebhookHandler) DeleteEndpoint(c *gin.Context) {
+	if err := h.webhookService.DeleteEndpoint(c.Request.Context(), c.Param("id")); err != nil {
+		respondError(c, problem.CodeInternal, "Failed to delete webhook endpoint", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": localize(c, "Webhook endpoint deleted successfully"),
+	})
+}
+
+// GetDeliveries returns the delivery history of a webhook endpoint
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	deliveries, total, err := h.webhookService.GetDeliveries(c.Request.Context(), c.Param("id"), page, limit)
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get webhook deliveries", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"deliveries": deliveries,
+			"pagination": gin.H{
+				"page":        page,
+				"limit":       limit,
+				"total":       total,
+				"total_pages": (total + limit - 1) / limit,
+			},
+		},
+	})
+}
+
+// TestEndpoint sends a test event to a webhook endpoint. The returned
+// delivery shows the result once the endpoint answered.
+func (h *WebhookHandler) TestEndpoint(c *gin.Context) {
+	delivery, err := h.webhookService.TestEndpoint(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to test webhook endpoint", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    delivery,
+	})
+}
+
+// GetEndpointHealth returns the recent success rate of a webhook endpoint
+func (h *WebhookHandler) GetEndpointHealth(c *gin.Context) {
+	health, err := h.webhookService.GetEndpointHealth(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to get webhook endpoint health", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    health,
+	})
+}
+
+// EnableEndpoint re-enables a disabled webhook endpoint once a test delivery
+// to it succeeds
+func (h *WebhookHandler) EnableEndpoint(c *gin.Context) {
+	endpoint, delivery, err := h.webhookService.EnableEndpoint(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, problem.CodeInternal, "Failed to enable webhook endpoint", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"endpoint": redactEndpoint(endpoint),
+			"delivery": delivery,
+		},
+	})
+}
+
+// redactEndpoint hides the signing secret and the client certificate key
+// of an endpoint
+func redactEndpoint(endpoint *services.WebhookEndpoint) *services.WebhookEndpoint {
+	endpoint.Secret = ""
+	if endpoint.ClientCertificate != nil {
+		endpoint.ClientCertificate.PrivateKeyPEM = ""
+	}
+	return endpoint
+}
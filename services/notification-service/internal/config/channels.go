@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Channel states reported at startup
+const (
+	ChannelEnabled  = "enabled"
+	ChannelDryRun   = "dry_run"
+	ChannelDisabled = "disabled"
+)
+
+// ChannelStatus tells whether a channel sends and through which provider
+type ChannelStatus struct {
+	Name     string
+	State    string
+	Provider string
+	Reason   string // why a channel is disabled
+}
+
+// Channels returns the state of every delivery channel
+func (c *Config) Channels() []ChannelStatus {
+	state := func(enabled bool, dryRun bool) string {
+		switch {
+		case !enabled:
+			return ChannelDisabled
+		case dryRun:
+			return ChannelDryRun
+		default:
+			return ChannelEnabled
+		}
+	}
+
+	channels := []ChannelStatus{
+		{Name: "email", State: state(c.Email.Enabled, c.Email.DryRun), Provider: c.Email.Provider},
+		{Name: "sms", State: state(c.SMS.Enabled, c.SMS.DryRun), Provider: c.SMS.Provider},
+		{Name: "push", State: state(c.Push.Enabled, c.Push.DryRun), Provider: c.Push.Provider},
+		{Name: "inapp", State: ChannelEnabled, Provider: "redis"},
+		{Name: "webhook", State: state(c.Webhook.Enabled, c.Webhook.DryRun)},
+		{Name: "voice", State: state(c.Voice.Provider != "", c.Voice.DryRun), Provider: c.Voice.Provider},
+	}
+
+	reasons := map[string]string{
+		"email":   "EMAIL_ENABLED is false",
+		"sms":     "SMS_ENABLED is false",
+		"push":    "PUSH_ENABLED is false",
+		"webhook": "WEBHOOK_ENABLED is false",
+		"voice":   "VOICE_PROVIDER is not set",
+	}
+	for i := range channels {
+		if channels[i].State == ChannelDisabled {
+			channels[i].Reason = reasons[channels[i].Name]
+		}
+	}
+
+	return channels
+}
+
+// DisabledChannels returns the names of the channels that don't send
+func (c *Config) DisabledChannels() []string {
+	var disabled []string
+	for _, channel := range c.Channels() {
+		if channel.State == ChannelDisabled {
+			disabled = append(disabled, channel.Name)
+		}
+	}
+	return disabled
+}
+
+// validateChannels returns the settings missing for the channels that send.
+// Channels in dry run never reach their provider, so they need no credentials.
+func (c *Config) validateChannels() []string {
+	var problems []string
+	require := func(channel string, settings ...[2]string) {
+		var missing []string
+		for _, setting := range settings {
+			if setting[1] == "" {
+				missing = append(missing, setting[0])
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, requiredBy(missing, channel))
+		}
+	}
+
+	if c.Email.Enabled && !c.Email.DryRun {
+		switch strings.ToLower(c.Email.Provider) {
+		case "", "smtp":
+			require("email", [2]string{"EMAIL_HOST", c.Email.Host}, [2]string{"EMAIL_FROM", c.Email.From})
+			// Relays without authentication are only usual on development machines
+			if c.Environment == EnvironmentStaging || c.IsProduction() {
+				require("email", [2]string{"EMAIL_USERNAME", c.Email.Username}, [2]string{"EMAIL_PASSWORD", c.Email.Password})
+			}
+		case "sendgrid":
+			require("email", [2]string{"EMAIL_API_KEY", c.Email.APIKey}, [2]string{"EMAIL_FROM", c.Email.From})
+		case "ses":
+			require("email",
+				[2]string{"EMAIL_API_KEY", c.Email.APIKey},
+				[2]string{"EMAIL_API_SECRET", c.Email.APISecret},
+				[2]string{"EMAIL_REGION", c.Email.Region},
+				[2]string{"EMAIL_FROM", c.Email.From},
+			)
+		case "mailgun":
+			require("email",
+				[2]string{"EMAIL_API_KEY", c.Email.APIKey},
+				[2]string{"EMAIL_DOMAIN", c.Email.Domain},
+				[2]string{"EMAIL_FROM", c.Email.From},
+			)
+		default:
+			problems = append(problems, fmt.Sprintf("EMAIL_PROVIDER must be smtp, sendgrid, ses or mailgun, got %q", c.Email.Provider))
+		}
+	}
+
+	if c.SMS.Enabled && !c.SMS.DryRun {
+		problems = append(problems, c.validateSMSProvider(strings.ToLower(c.SMS.Provider), SMSProviderConfig{
+			APIKey:     c.SMS.APIKey,
+			APISecret:  c.SMS.APISecret,
+			FromNumber: c.SMS.FromNumber,
+		}, "SMS_")...)
+
+		// Tenants can only be routed to providers with credentials
+		for tenantID, provider := range c.SMS.TenantProviders {
+			provider = strings.ToLower(provider)
+			if provider == strings.ToLower(c.SMS.Provider) {
+				continue
+			}
+			if _, ok := c.SMS.Providers[provider]; !ok {
+				prefix := "SMS_" + strings.ToUpper(provider) + "_"
+				problems = append(problems, fmt.Sprintf("%sAPI_KEY is required to route tenant %s to %s", prefix, tenantID, provider))
+			}
+		}
+		for name, provider := range c.SMS.Providers {
+			problems = append(problems, c.validateSMSProvider(name, provider, "SMS_"+strings.ToUpper(name)+"_")...)
+		}
+	}
+
+	if c.Push.Enabled && !c.Push.DryRun {
+		providers := []string{c.Push.Provider}
+		for _, provider := range c.Push.Platforms {
+			providers = append(providers, provider)
+		}
+
+		validated := make(map[string]bool)
+		for _, provider := range providers {
+			if validated[provider] {
+				continue
+			}
+			validated[provider] = true
+
+			switch provider {
+			case "firebase":
+				require("push", [2]string{"PUSH_FIREBASE_CREDENTIALS", c.Push.FirebaseCredentials})
+			case "apns":
+				require("push",
+					[2]string{"PUSH_APNS_KEY", c.Push.APNSKey},
+					[2]string{"PUSH_APNS_KEY_ID", c.Push.APNSKeyID},
+					[2]string{"PUSH_APNS_TEAM_ID", c.Push.APNSTeamID},
+					[2]string{"PUSH_APNS_TOPIC", c.Push.APNSTopic},
+				)
+			case "pusher":
+				require("push", [2]string{"PUSH_APP_ID", c.Push.AppID}, [2]string{"PUSH_API_SECRET", c.Push.APISecret})
+			case "web-push":
+			default:
+				problems = append(problems, fmt.Sprintf("push provider must be firebase, apns, web-push or pusher, got %q", provider))
+			}
+		}
+	}
+
+	if c.Voice.Provider != "" && !c.Voice.DryRun {
+		require("voice",
+			[2]string{"VOICE_API_KEY", c.Voice.APIKey},
+			[2]string{"VOICE_API_SECRET", c.Voice.APISecret},
+			[2]string{"VOICE_FROM_NUMBER", c.Voice.FromNumber},
+			[2]string{"VOICE_CALLBACK_URL", c.Voice.CallbackURL},
+		)
+	}
+
+	return problems
+}
+
+// validateSMSProvider returns the credentials an SMS provider is missing,
+// named by the prefix of its variables
+func (c *Config) validateSMSProvider(name string, provider SMSProviderConfig, prefix string) []string {
+	var missing []string
+	switch name {
+	case "twilio", "netgsm", "vonage", "iletimerkezi":
+		if provider.APIKey == "" {
+			missing = append(missing, prefix+"API_KEY")
+		}
+		if provider.APISecret == "" {
+			missing = append(missing, prefix+"API_SECRET")
+		}
+	case "messagebird":
+		if provider.APIKey == "" {
+			missing = append(missing, prefix+"API_KEY")
+		}
+	default:
+		return []string{fmt.Sprintf("SMS provider must be twilio, netgsm, vonage, messagebird or iletimerkezi, got %q", name)}
+	}
+	if provider.FromNumber == "" {
+		missing = append(missing, prefix+"FROM_NUMBER")
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	return []string{requiredBy(missing, "sms")}
+}
+
+// requiredBy reports the settings a channel is missing
+func requiredBy(missing []string, channel string) string {
+	if len(missing) == 1 {
+		return fmt.Sprintf("%s is required by the %s channel", missing[0], channel)
+	}
+	return fmt.Sprintf("%s are required by the %s channel", strings.Join(missing, ", "), channel)
+}
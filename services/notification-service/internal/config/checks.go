@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-talimat/pkg/redisclient"
+)
+
+// CheckError lists the dependencies that couldn't be reached at startup
+type CheckError struct {
+	Problems []string
+}
+
+func (e *CheckError) Error() string {
+	return "connectivity checks failed: " + strings.Join(e.Problems, "; ")
+}
+
+// CheckConnectivity makes sure Redis and the servers the enabled channels
+// talk to over their own protocols are reachable. Providers behind HTTP APIs
+// aren't called, a request would send or cost something.
+func (c *Config) CheckConnectivity(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		problems []string
+	)
+	run := func(name string, check func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := check(ctx); err != nil {
+				mu.Lock()
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	run("REDIS_URL", func(ctx context.Context) error {
+		return pingRedis(c.Redis.URL, c.Redis.Password, c.Redis.DB)
+	})
+	if c.Queue.EventsTopic != "" {
+		run("QUEUE_REDIS_URL", func(ctx context.Context) error {
+			return pingRedis(c.Queue.RedisURL, c.Queue.RedisPassword, c.Queue.RedisDB)
+		})
+	}
+	if c.Queue.Enabled {
+		run("QUEUE_SERVICE_URL", func(ctx context.Context) error {
+			address, err := urlAddress(c.Queue.ServiceURL)
+			if err != nil {
+				return err
+			}
+			return dial(ctx, address)
+		})
+	}
+
+	emailProvider := strings.ToLower(c.Email.Provider)
+	if c.Email.Enabled && !c.Email.DryRun && (emailProvider == "" || emailProvider == "smtp") {
+		run("EMAIL_HOST", func(ctx context.Context) error {
+			return dial(ctx, net.JoinHostPort(c.Email.Host, strconv.Itoa(c.Email.Port)))
+		})
+	}
+	if c.Email.Enabled && c.Email.ClamAVAddress != "" {
+		run("EMAIL_CLAMAV_ADDRESS", func(ctx context.Context) error {
+			return dial(ctx, c.Email.ClamAVAddress)
+		})
+	}
+
+	// Recipient references can't be resolved without the user service
+	if c.Recipient.UserServiceURL != "" {
+		run("USER_SERVICE_URL", func(ctx context.Context) error {
+			address, err := urlAddress(c.Recipient.UserServiceURL)
+			if err != nil {
+				return err
+			}
+			return dial(ctx, address)
+		})
+	}
+
+	wg.Wait()
+	sort.Strings(problems)
+
+	if len(problems) > 0 {
+		return &CheckError{Problems: problems}
+	}
+	return nil
+}
+
+// Helper functions
+
+func pingRedis(redisURL string, password string, db int) error {
+	client, err := redisclient.New(redisclient.Config{
+		URL:      redisURL,
+		Password: password,
+		DB:       db,
+	})
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+func dial(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// urlAddress returns the host and port a URL connects to
+func urlAddress(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Port() != "" {
+		return parsed.Host, nil
+	}
+	if parsed.Scheme == "https" {
+		return net.JoinHostPort(parsed.Hostname(), "443"), nil
+	}
+	return net.JoinHostPort(parsed.Hostname(), "80"), nil
+}
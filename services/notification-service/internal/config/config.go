@@ -1,11 +1,25 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+
+	"claude-talimat/pkg/secrets"
+)
+
+// Environments the service runs in
+const (
+	EnvironmentDevelopment = "development"
+	EnvironmentTest        = "test"
+	EnvironmentStaging     = "staging"
+	EnvironmentProduction  = "production"
 )
 
 // Config holds all configuration for the notification service
@@ -19,8 +33,20 @@ type Config struct {
 	Push         PushConfig
 	InApp        InAppConfig
 	Webhook      WebhookConfig
+	Voice        VoiceConfig
 	Template     TemplateConfig
+	Recipient    RecipientConfig
+	Idempotency  IdempotencyConfig
+	Auth         AuthConfig
+	API          APIConfig
+	Privacy      PrivacyConfig
+	Archive      ArchiveConfig
+	Runtime      RuntimeConfig
+	Secrets      SecretsConfig
 	Notification NotificationConfig
+	Queue        QueueConfig
+
+	secrets *secrets.Manager
 }
 
 // RedisConfig holds Redis configuration
@@ -32,6 +58,7 @@ type RedisConfig struct {
 
 // EmailConfig holds email service configuration
 type EmailConfig struct {
+	Enabled  bool
 	Host     string
 	Port     int
 	Username string
@@ -40,22 +67,75 @@ type EmailConfig struct {
 	FromName string
 	UseTLS   bool
 	UseSSL   bool
+	DryRun   bool
+	// Provider is smtp, sendgrid, ses or mailgun
+	Provider  string
+	APIKey    string
+	APISecret string
+	Region    string
+	Domain    string
+	BaseURL   string
+	// WebhookSigningKey and WebhookToken verify bounce and complaint posts
+	WebhookSigningKey string
+	WebhookToken      string
+	// TemplatesDir holds email templates overriding the built-in ones
+	TemplatesDir           string
+	TemplateReloadInterval time.Duration // 0 loads the templates once
+	MJMLCommand            string
+	// Attachments given by S3, http(s) URL or document ID are fetched up to
+	// these sizes, http(s) only from AttachmentHosts, and scanned by ClamAV
+	MaxAttachmentSize     int64
+	MaxAttachmentsSize    int64
+	AttachmentHosts       []string
+	AttachmentS3Endpoint  string
+	AttachmentS3Region    string
+	AttachmentS3AccessKey string
+	AttachmentS3SecretKey string
+	DocumentServiceURL    string
+	DocumentServiceToken  string
+	ClamAVAddress         string
+	BulkConcurrency       int
 }
 
 // SMSConfig holds SMS service configuration
 type SMSConfig struct {
+	Enabled    bool
 	Provider   string
 	APIKey     string
 	APISecret  string
 	FromNumber string
 	BaseURL    string
 	MaxRetries int
-	RetryDelay int
+	RetryDelay time.Duration
 	DryRun     bool
+	// MaxSegments limits the segments of concatenated SMS, SegmentCost is
+	// the price of a segment of the default provider
+	MaxSegments int
+	SegmentCost float64
+	RateLimit   int // messages per second of the default provider
+	// Providers holds the credentials of the providers tenants can be
+	// routed to besides the default one
+	Providers map[string]SMSProviderConfig
+	// TenantProviders routes the SMS of a tenant to another provider
+	TenantProviders map[string]string
+	// StatusCallbackURL is the public URL delivery reports are posted to
+	StatusCallbackURL   string
+	StatusCallbackToken string
+}
+
+// SMSProviderConfig holds the credentials of an SMS provider
+type SMSProviderConfig struct {
+	APIKey      string
+	APISecret   string
+	FromNumber  string
+	BaseURL     string
+	SegmentCost float64
+	RateLimit   int
 }
 
 // PushConfig holds push notification configuration
 type PushConfig struct {
+	Enabled    bool
 	Provider   string
 	APIKey     string
 	APISecret  string
@@ -63,118 +143,635 @@ type PushConfig struct {
 	ProjectID  string
 	BaseURL    string
 	MaxRetries int
-	RetryDelay int
+	RetryDelay time.Duration
 	DryRun     bool
+
+	// Platforms routes the devices of a platform to another provider than
+	// the default one, e.g. "ios=apns,android=firebase,web=web-push"
+	Platforms map[string]string
+	// Firebase service account key, as JSON or the path of the key file
+	FirebaseCredentials string
+	// APNs p8 key, inline or as a path, and the app it signs for
+	APNSKey     string
+	APNSKeyID   string
+	APNSTeamID  string
+	APNSTopic   string
+	APNSSandbox bool
 }
 
 // InAppConfig holds in-app notification configuration
 type InAppConfig struct {
-	TTL        int
+	TTL        time.Duration
 	MaxRetries int
 	BatchSize  int
+	// EntityLinks are the deep link templates of the entities notifications
+	// can be about, by entity type, with {id} standing for the entity ID
+	EntityLinks map[string]string
+	// OperationTimeout bounds how long a single inbox operation may take
+	OperationTimeout time.Duration
+	// Attachments in object storage are linked by URLs signed for
+	// AttachmentURLTTL when read
+	MaxAttachmentSize     int64
+	AttachmentURLTTL      time.Duration
+	AttachmentS3Endpoint  string
+	AttachmentS3Region    string
+	AttachmentS3AccessKey string
+	AttachmentS3SecretKey string
 }
 
 // WebhookConfig holds webhook configuration
 type WebhookConfig struct {
-	MaxRetries int
-	RetryDelay int
-	Timeout    int
-	MaxPayload int64
-	SecretKey  string
+	Enabled       bool
+	MaxRetries    int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	MaxRetryAge   time.Duration
+	DeliveryTTL   time.Duration
+	Timeout       time.Duration
+	MaxPayload    int64
+	SecretKey     string
+	DryRun        bool
+
+	AllowPrivateNetworks bool
+	DisableAfter         time.Duration
+	DisableMinFailures   int
+	MaxConcurrent        int
+}
+
+// VoiceConfig holds voice call configuration
+type VoiceConfig struct {
+	Provider    string // empty turns voice calls off
+	APIKey      string
+	APISecret   string
+	FromNumber  string
+	BaseURL     string
+	CallbackURL string // public URL of the voice callback endpoints
+	Language    string
+	Voice       string
+	RingTimeout time.Duration
+	DryRun      bool
 }
 
 // TemplateConfig holds template configuration
 type TemplateConfig struct {
 	DefaultLocale string
-	CacheTTL      int
+	CacheTTL      time.Duration
 	MaxTemplates  int
+	MaxOutputSize int // bytes a rendered template field may have
+}
+
+// RecipientConfig holds recipient resolution configuration
+type RecipientConfig struct {
+	UserServiceURL string
+	ServiceToken   string
+	Timeout        time.Duration
+	CacheTTL       time.Duration
+	MaxExpansion   int
+}
+
+// IdempotencyConfig holds idempotency key configuration
+type IdempotencyConfig struct {
+	TTL     time.Duration
+	LockTTL time.Duration
+}
+
+// AuthConfig holds authentication configuration
+type AuthConfig struct {
+	JWTSecret string
+	APIKeys   map[string]string
+}
+
+// APIConfig holds HTTP API configuration
+type APIConfig struct {
+	StrictValidation bool // reject request fields the API doesn't know
+}
+
+// PrivacyConfig holds KVKK/GDPR data subject request configuration
+type PrivacyConfig struct {
+	AuditSecret   string
+	AuditTTL      time.Duration // 0 keeps erasure records forever
+	EncryptionKey []byte        // encrypts personal data at rest, nil stores it in plaintext
+}
+
+// ArchiveConfig holds archive configuration for the retention job
+type ArchiveConfig struct {
+	Backend     string // none, s3, postgres
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3Prefix    string
+	S3AccessKey string
+	S3SecretKey string
+	DatabaseURL string
+	Table       string
+}
+
+// RuntimeConfig holds where the tunables changed at runtime are kept
+type RuntimeConfig struct {
+	Backend      string // redis, file, none
+	File         string
+	PollInterval time.Duration
 }
 
 // NotificationConfig holds main notification service configuration
 type NotificationConfig struct {
-	MaxRetries  int
-	RetryDelay  int
-	BatchSize   int
-	QueueSize   int
-	WorkerCount int
+	MaxRetries         int
+	RetryDelay         time.Duration
+	MaxRetryDelay      time.Duration
+	RetryBudgets       map[string]int
+	BatchSize          int
+	QueueSize          int
+	WorkerCount        int
+	ChannelWorkers     map[string]int
+	ChannelMaxInFlight map[string]int
+	DigestInterval     time.Duration
+	DigestMaxItems     int
+	CollapseWindow     time.Duration
+	CallbackSecret     string
+	CallbackTimeout    time.Duration
+	CallbackMaxRetries int
+	ProviderTimeout    time.Duration
+	// Provider circuit breakers
+	BreakerWindow         time.Duration
+	BreakerMinRequests    int
+	BreakerFailureRate    int // percent
+	BreakerOpenDuration   time.Duration
+	BreakerHalfOpenProbes int
+	// Retention
+	RetentionDays      int
+	RetentionInterval  time.Duration
+	RetentionBatchSize int
+	// Storage
+	CleanupInterval time.Duration
+	// Snooze
+	SnoozeInterval time.Duration
+	// Acknowledgments
+	AckBaseURL    string
+	AckTTL        time.Duration
+	AckSecret     string
+	AckSMSKeyword string
+	// One-time codes
+	OTPLength      int
+	OTPTTL         time.Duration
+	OTPMaxAttempts int
+	OTPRateLimit   int
+	OTPRateWindow  time.Duration
+	// Instances elect a leader to run the jobs that must not run twice
+	LeaderLease time.Duration
+}
+
+// QueueConfig holds configuration of the message queue consumer, which reads
+// through the API of the message queue service, and of the event publisher,
+// which writes to the streams of its own Redis database
+type QueueConfig struct {
+	Enabled       bool
+	ServiceURL    string
+	RedisURL      string
+	RedisPassword string
+	RedisDB       int
+	Topic         string
+	BatchSize     int64
+	BlockTime     time.Duration
+	RetryAfter    time.Duration
+	MaxRetries    int
+	EventsTopic   string // Topic the events of the service are published to, empty to not publish them
 }
 
-// Load loads configuration from environment variables
+// Load loads configuration from environment variables and validates it.
+// Durations take Go durations like 30s or 5m, plain numbers are read in the
+// unit the variable always had, seconds unless noted otherwise. Credentials
+// may name a secret of the SECRETS_BACKEND store instead of holding it.
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	godotenv.Load()
 
+	l := &loader{}
+	secretsConfig := l.loadSecretsConfig()
+	manager, err := newSecretManager(secretsConfig)
+	if err != nil {
+		return nil, &ValidationError{Problems: append(l.problems, err.Error())}
+	}
+	l.secrets = manager
+
+	config, err := load(l, secretsConfig)
+	if err != nil {
+		manager.Close()
+		return nil, err
+	}
+	return config, nil
+}
+
+// load reads the configuration from environment variables, resolving secret
+// references with the manager of the loader
+func load(l *loader, secretsConfig SecretsConfig) (*Config, error) {
 	config := &Config{
-		Port:        getEnv("PORT", "8003"),
-		Environment: getEnv("ENVIRONMENT", "development"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
+		Secrets: secretsConfig,
+		secrets: l.secrets,
+		Port:    l.getEnv("PORT", "8003"),
+		// ENVIRONMENT, with the variables the deployments of the other services use
+		Environment: l.getEnv("ENVIRONMENT", l.getEnv("GO_ENV", l.getEnv("NODE_ENV", EnvironmentDevelopment))),
+		LogLevel:    l.getEnv("LOG_LEVEL", "info"),
 		Redis: RedisConfig{
-			URL:      getEnv("REDIS_URL", "redis://localhost:6379"),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       getEnvAsInt("REDIS_DB", 0),
+			URL:      l.getEnv("REDIS_URL", "redis://localhost:6379"),
+			Password: l.getSecret("REDIS_PASSWORD", ""),
+			DB:       l.getEnvAsInt("REDIS_DB", 0),
 		},
+		// The SMTP_ variables are still read for deployments that set them
 		Email: EmailConfig{
-			Host:     getEnv("EMAIL_HOST", "localhost"),
-			Port:     getEnvAsInt("EMAIL_PORT", 587),
-			Username: getEnv("EMAIL_USERNAME", ""),
-			Password: getEnv("EMAIL_PASSWORD", ""),
-			From:     getEnv("EMAIL_FROM", "noreply@claude-talimat.com"),
-			FromName: getEnv("EMAIL_FROM_NAME", "Claude Talimat"),
-			UseTLS:   getEnvAsBool("EMAIL_USE_TLS", true),
-			UseSSL:   getEnvAsBool("EMAIL_USE_SSL", false),
+			Enabled:                l.getEnvAsBool("EMAIL_ENABLED", true),
+			Host:                   l.getEnv("EMAIL_HOST", l.getEnv("SMTP_HOST", "localhost")),
+			Port:                   l.getEnvAsInt("EMAIL_PORT", l.getEnvAsInt("SMTP_PORT", 587)),
+			Username:               l.getEnv("EMAIL_USERNAME", l.getEnv("SMTP_USER", "")),
+			Password:               l.getSecret("EMAIL_PASSWORD", l.getEnv("SMTP_PASSWORD", "")),
+			From:                   l.getEnv("EMAIL_FROM", l.getEnv("SMTP_FROM", "noreply@claude-talimat.com")),
+			FromName:               l.getEnv("EMAIL_FROM_NAME", "Claude Talimat"),
+			UseTLS:                 l.getEnvAsBool("EMAIL_USE_TLS", l.getEnvAsBool("SMTP_TLS", true)),
+			UseSSL:                 l.getEnvAsBool("EMAIL_USE_SSL", false),
+			DryRun:                 l.getEnvAsBool("EMAIL_DRY_RUN", false),
+			Provider:               l.getEnv("EMAIL_PROVIDER", "smtp"),
+			APIKey:                 l.getSecret("EMAIL_API_KEY", ""),
+			APISecret:              l.getSecret("EMAIL_API_SECRET", ""),
+			Region:                 l.getEnv("EMAIL_REGION", ""),
+			Domain:                 l.getEnv("EMAIL_DOMAIN", ""),
+			BaseURL:                l.getEnv("EMAIL_BASE_URL", ""),
+			WebhookSigningKey:      l.getSecret("EMAIL_WEBHOOK_SIGNING_KEY", ""),
+			WebhookToken:           l.getSecret("EMAIL_WEBHOOK_TOKEN", ""),
+			TemplatesDir:           l.getEnv("EMAIL_TEMPLATES_DIR", "templates/email"),
+			TemplateReloadInterval: l.getEnvAsDuration("EMAIL_TEMPLATE_RELOAD_INTERVAL", 5*time.Second, time.Second),
+			MJMLCommand:            l.getEnv("EMAIL_MJML_COMMAND", ""),
+			MaxAttachmentSize:      l.getEnvAsInt64("EMAIL_MAX_ATTACHMENT_SIZE", 10<<20),
+			MaxAttachmentsSize:     l.getEnvAsInt64("EMAIL_MAX_ATTACHMENTS_SIZE", 25<<20),
+			AttachmentHosts:        l.getEnvAsSlice("EMAIL_ATTACHMENT_HOSTS", nil),
+			AttachmentS3Endpoint:   l.getEnv("EMAIL_ATTACHMENT_S3_ENDPOINT", ""),
+			AttachmentS3Region:     l.getEnv("EMAIL_ATTACHMENT_S3_REGION", "eu-central-1"),
+			AttachmentS3AccessKey:  l.getEnv("EMAIL_ATTACHMENT_S3_ACCESS_KEY", ""),
+			AttachmentS3SecretKey:  l.getSecret("EMAIL_ATTACHMENT_S3_SECRET_KEY", ""),
+			DocumentServiceURL:     l.getEnv("DOCUMENT_SERVICE_URL", "http://document-service:8002"),
+			DocumentServiceToken:   l.getSecret("DOCUMENT_SERVICE_TOKEN", ""),
+			ClamAVAddress:          l.getEnv("EMAIL_CLAMAV_ADDRESS", ""),
+			BulkConcurrency:        l.getEnvAsInt("EMAIL_BULK_CONCURRENCY", 10),
 		},
 		SMS: SMSConfig{
-			Provider:   getEnv("SMS_PROVIDER", "netgsm"),
-			APIKey:     getEnv("SMS_API_KEY", ""),
-			APISecret:  getEnv("SMS_API_SECRET", ""),
-			FromNumber: getEnv("SMS_FROM_NUMBER", ""),
-			BaseURL:    getEnv("SMS_BASE_URL", ""),
-			MaxRetries: getEnvAsInt("SMS_MAX_RETRIES", 3),
-			RetryDelay: getEnvAsInt("SMS_RETRY_DELAY", 5),
-			DryRun:     getEnvAsBool("SMS_DRY_RUN", false),
+			Enabled:     l.getEnvAsBool("SMS_ENABLED", true),
+			Provider:    l.getEnv("SMS_PROVIDER", "netgsm"),
+			APIKey:      l.getSecret("SMS_API_KEY", ""),
+			APISecret:   l.getSecret("SMS_API_SECRET", ""),
+			FromNumber:  l.getEnv("SMS_FROM_NUMBER", ""),
+			BaseURL:     l.getEnv("SMS_BASE_URL", ""),
+			MaxRetries:  l.getEnvAsInt("SMS_MAX_RETRIES", 3),
+			RetryDelay:  l.getEnvAsDuration("SMS_RETRY_DELAY", 5*time.Second, time.Second),
+			DryRun:      l.getEnvAsBool("SMS_DRY_RUN", false),
+			MaxSegments: l.getEnvAsInt("SMS_MAX_SEGMENTS", 6),
+			SegmentCost: l.getEnvAsFloat("SMS_SEGMENT_COST", 0),
+			RateLimit:   l.getEnvAsInt("SMS_RATE_LIMIT", 10),
+			Providers: l.getSMSProviderConfigs(
+				"twilio", "netgsm", "vonage", "messagebird", "iletimerkezi",
+			),
+			TenantProviders:     l.getEnvAsStringMap("SMS_TENANT_PROVIDERS", nil),
+			StatusCallbackURL:   l.getEnv("SMS_STATUS_CALLBACK_URL", ""),
+			StatusCallbackToken: l.getSecret("SMS_STATUS_CALLBACK_TOKEN", ""),
 		},
 		Push: PushConfig{
-			Provider:   getEnv("PUSH_PROVIDER", "pusher"),
-			APIKey:     getEnv("PUSH_API_KEY", ""),
-			APISecret:  getEnv("PUSH_API_SECRET", ""),
-			AppID:      getEnv("PUSH_APP_ID", ""),
-			ProjectID:  getEnv("PUSH_PROJECT_ID", ""),
-			BaseURL:    getEnv("PUSH_BASE_URL", ""),
-			MaxRetries: getEnvAsInt("PUSH_MAX_RETRIES", 3),
-			RetryDelay: getEnvAsInt("PUSH_RETRY_DELAY", 5),
-			DryRun:     getEnvAsBool("PUSH_DRY_RUN", false),
+			Enabled:    l.getEnvAsBool("PUSH_ENABLED", true),
+			Provider:   l.getEnv("PUSH_PROVIDER", "pusher"),
+			Platforms:  l.getEnvAsStringMap("PUSH_PLATFORM_PROVIDERS", nil),
+			APIKey:     l.getSecret("PUSH_API_KEY", ""),
+			APISecret:  l.getSecret("PUSH_API_SECRET", ""),
+			AppID:      l.getEnv("PUSH_APP_ID", ""),
+			ProjectID:  l.getEnv("PUSH_PROJECT_ID", ""),
+			BaseURL:    l.getEnv("PUSH_BASE_URL", ""),
+			MaxRetries: l.getEnvAsInt("PUSH_MAX_RETRIES", 3),
+			RetryDelay: l.getEnvAsDuration("PUSH_RETRY_DELAY", 5*time.Second, time.Second),
+			DryRun:     l.getEnvAsBool("PUSH_DRY_RUN", false),
+
+			FirebaseCredentials: l.getSecret("PUSH_FIREBASE_CREDENTIALS", ""),
+			APNSKey:             l.getSecret("PUSH_APNS_KEY", ""),
+			APNSKeyID:           l.getEnv("PUSH_APNS_KEY_ID", ""),
+			APNSTeamID:          l.getEnv("PUSH_APNS_TEAM_ID", ""),
+			APNSTopic:           l.getEnv("PUSH_APNS_TOPIC", ""),
+			APNSSandbox:         l.getEnvAsBool("PUSH_APNS_SANDBOX", false),
 		},
 		InApp: InAppConfig{
-			TTL:        getEnvAsInt("INAPP_TTL", 24),
-			MaxRetries: getEnvAsInt("INAPP_MAX_RETRIES", 3),
-			BatchSize:  getEnvAsInt("INAPP_BATCH_SIZE", 100),
+			TTL:        l.getEnvAsDuration("INAPP_TTL", 24*time.Hour, time.Hour),
+			MaxRetries: l.getEnvAsInt("INAPP_MAX_RETRIES", 3),
+			BatchSize:  l.getEnvAsInt("INAPP_BATCH_SIZE", 100),
+			EntityLinks: l.getEnvAsStringMap("INAPP_ENTITY_LINKS", map[string]string{
+				"document": "/documents/{id}",
+				"incident": "/incidents/{id}",
+				"task":     "/tasks/{id}",
+			}),
+			OperationTimeout:      l.getEnvAsDuration("INAPP_OPERATION_TIMEOUT", 5*time.Second, time.Second),
+			MaxAttachmentSize:     l.getEnvAsInt64("INAPP_MAX_ATTACHMENT_SIZE", 25<<20),
+			AttachmentURLTTL:      l.getEnvAsDuration("INAPP_ATTACHMENT_URL_TTL", 15*time.Minute, time.Minute),
+			AttachmentS3Endpoint:  l.getEnv("INAPP_ATTACHMENT_S3_ENDPOINT", ""),
+			AttachmentS3Region:    l.getEnv("INAPP_ATTACHMENT_S3_REGION", "eu-central-1"),
+			AttachmentS3AccessKey: l.getEnv("INAPP_ATTACHMENT_S3_ACCESS_KEY", ""),
+			AttachmentS3SecretKey: l.getSecret("INAPP_ATTACHMENT_S3_SECRET_KEY", ""),
 		},
 		Webhook: WebhookConfig{
-			MaxRetries: getEnvAsInt("WEBHOOK_MAX_RETRIES", 3),
-			RetryDelay: getEnvAsInt("WEBHOOK_RETRY_DELAY", 5),
-			Timeout:    getEnvAsInt("WEBHOOK_TIMEOUT", 30),
-			MaxPayload: getEnvAsInt64("WEBHOOK_MAX_PAYLOAD", 1048576), // 1MB
-			SecretKey:  getEnv("WEBHOOK_SECRET_KEY", ""),
+			Enabled:       l.getEnvAsBool("WEBHOOK_ENABLED", true),
+			MaxRetries:    l.getEnvAsInt("WEBHOOK_MAX_RETRIES", 3),
+			RetryDelay:    l.getEnvAsDuration("WEBHOOK_RETRY_DELAY", 5*time.Second, time.Second),
+			MaxRetryDelay: l.getEnvAsDuration("WEBHOOK_MAX_RETRY_DELAY", time.Hour, time.Second),
+			MaxRetryAge:   l.getEnvAsDuration("WEBHOOK_MAX_RETRY_AGE", 24*time.Hour, time.Second),
+			DeliveryTTL:   l.getEnvAsDuration("WEBHOOK_DELIVERY_TTL", 30*24*time.Hour, time.Second),
+			Timeout:       l.getEnvAsDuration("WEBHOOK_TIMEOUT", 30*time.Second, time.Second),
+			MaxPayload:    l.getEnvAsInt64("WEBHOOK_MAX_PAYLOAD", 1048576), // 1MB
+			SecretKey:     l.getSecret("WEBHOOK_SECRET_KEY", ""),
+			DryRun:        l.getEnvAsBool("WEBHOOK_DRY_RUN", false),
+
+			AllowPrivateNetworks: l.getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+			DisableAfter:         l.getEnvAsDuration("WEBHOOK_DISABLE_AFTER", 24*time.Hour, time.Second),
+			DisableMinFailures:   l.getEnvAsInt("WEBHOOK_DISABLE_MIN_FAILURES", 10),
+			MaxConcurrent:        l.getEnvAsInt("WEBHOOK_MAX_CONCURRENT_DELIVERIES", 50),
+		},
+		Voice: VoiceConfig{
+			Provider:    l.getEnv("VOICE_PROVIDER", ""),
+			APIKey:      l.getSecret("VOICE_API_KEY", ""),
+			APISecret:   l.getSecret("VOICE_API_SECRET", ""),
+			FromNumber:  l.getEnv("VOICE_FROM_NUMBER", ""),
+			BaseURL:     l.getEnv("VOICE_BASE_URL", ""),
+			CallbackURL: l.getEnv("VOICE_CALLBACK_URL", ""),
+			Language:    l.getEnv("VOICE_LANGUAGE", "tr-TR"),
+			Voice:       l.getEnv("VOICE_TTS_VOICE", ""),
+			RingTimeout: l.getEnvAsDuration("VOICE_RING_TIMEOUT", 30*time.Second, time.Second),
+			DryRun:      l.getEnvAsBool("VOICE_DRY_RUN", false),
 		},
 		Template: TemplateConfig{
-			DefaultLocale: getEnv("TEMPLATE_DEFAULT_LOCALE", "tr"),
-			CacheTTL:      getEnvAsInt("TEMPLATE_CACHE_TTL", 1),
-			MaxTemplates:  getEnvAsInt("TEMPLATE_MAX_TEMPLATES", 1000),
+			DefaultLocale: l.getEnv("TEMPLATE_DEFAULT_LOCALE", "tr"),
+			CacheTTL:      l.getEnvAsDuration("TEMPLATE_CACHE_TTL", time.Hour, time.Hour),
+			MaxTemplates:  l.getEnvAsInt("TEMPLATE_MAX_TEMPLATES", 1000),
+			MaxOutputSize: l.getEnvAsInt("TEMPLATE_MAX_OUTPUT_SIZE", 256<<10),
+		},
+		Recipient: RecipientConfig{
+			UserServiceURL: l.getEnv("USER_SERVICE_URL", "http://auth-service:8004"),
+			ServiceToken:   l.getSecret("USER_SERVICE_TOKEN", ""),
+			Timeout:        l.getEnvAsDuration("USER_SERVICE_TIMEOUT", 10*time.Second, time.Second),
+			CacheTTL:       l.getEnvAsDuration("RECIPIENT_CACHE_TTL", 5*time.Minute, time.Second),
+			MaxExpansion:   l.getEnvAsInt("RECIPIENT_MAX_EXPANSION", 10000),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     l.getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour, time.Second),
+			LockTTL: l.getEnvAsDuration("IDEMPOTENCY_LOCK_TTL", time.Minute, time.Second),
+		},
+		Auth: AuthConfig{
+			JWTSecret: l.getSecret("JWT_SECRET", ""),
+			APIKeys:   l.getSecretMap("NOTIFICATION_API_KEYS", map[string]string{}),
+		},
+		API: APIConfig{
+			StrictValidation: l.getEnvAsBool("API_STRICT_VALIDATION", false),
+		},
+		Privacy: PrivacyConfig{
+			AuditSecret:   l.getSecret("PRIVACY_AUDIT_SECRET", ""),
+			AuditTTL:      l.getEnvAsDuration("PRIVACY_AUDIT_TTL", 0, time.Second),
+			EncryptionKey: l.getSecretAsKey("PII_ENCRYPTION_KEY", 32),
+		},
+		Archive: ArchiveConfig{
+			Backend:     l.getEnv("ARCHIVE_BACKEND", "none"),
+			S3Endpoint:  l.getEnv("ARCHIVE_S3_ENDPOINT", ""),
+			S3Region:    l.getEnv("ARCHIVE_S3_REGION", "eu-central-1"),
+			S3Bucket:    l.getEnv("ARCHIVE_S3_BUCKET", ""),
+			S3Prefix:    l.getEnv("ARCHIVE_S3_PREFIX", "notifications"),
+			S3AccessKey: l.getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+			S3SecretKey: l.getSecret("ARCHIVE_S3_SECRET_KEY", ""),
+			DatabaseURL: l.getSecret("ARCHIVE_DATABASE_URL", ""),
+			Table:       l.getEnv("ARCHIVE_TABLE", "notification_archive"),
+		},
+		Runtime: RuntimeConfig{
+			Backend:      l.getEnv("RUNTIME_CONFIG_BACKEND", "redis"),
+			File:         l.getEnv("RUNTIME_CONFIG_FILE", ""),
+			PollInterval: l.getEnvAsDuration("RUNTIME_CONFIG_POLL_INTERVAL", 30*time.Second, time.Second),
 		},
 		Notification: NotificationConfig{
-			MaxRetries:  getEnvAsInt("NOTIFICATION_MAX_RETRIES", 3),
-			RetryDelay:  getEnvAsInt("NOTIFICATION_RETRY_DELAY", 5),
-			BatchSize:   getEnvAsInt("NOTIFICATION_BATCH_SIZE", 100),
-			QueueSize:   getEnvAsInt("NOTIFICATION_QUEUE_SIZE", 1000),
-			WorkerCount: getEnvAsInt("NOTIFICATION_WORKER_COUNT", 5),
+			MaxRetries:            l.getEnvAsInt("NOTIFICATION_MAX_RETRIES", 3),
+			RetryDelay:            l.getEnvAsDuration("NOTIFICATION_RETRY_DELAY", 5*time.Second, time.Second),
+			MaxRetryDelay:         l.getEnvAsDuration("NOTIFICATION_MAX_RETRY_DELAY", time.Hour, time.Second),
+			RetryBudgets:          l.getEnvAsIntMap("NOTIFICATION_RETRY_BUDGETS", map[string]int{"email": 5, "sms": 3, "push": 3, "inapp": 3, "webhook": 5, "voice": 2}),
+			BatchSize:             l.getEnvAsInt("NOTIFICATION_BATCH_SIZE", 100),
+			QueueSize:             l.getEnvAsInt("NOTIFICATION_QUEUE_SIZE", 1000),
+			WorkerCount:           l.getEnvAsInt("NOTIFICATION_WORKER_COUNT", 5),
+			ChannelWorkers:        l.getEnvAsIntMap("NOTIFICATION_CHANNEL_WORKERS", map[string]int{}),
+			ChannelMaxInFlight:    l.getEnvAsIntMap("NOTIFICATION_CHANNEL_MAX_IN_FLIGHT", map[string]int{"email": 10, "sms": 10, "push": 50, "inapp": 100, "webhook": 50, "voice": 5}),
+			DigestInterval:        l.getEnvAsDuration("NOTIFICATION_DIGEST_INTERVAL", time.Minute, time.Second),
+			DigestMaxItems:        l.getEnvAsInt("NOTIFICATION_DIGEST_MAX_ITEMS", 50),
+			CollapseWindow:        l.getEnvAsDuration("NOTIFICATION_COLLAPSE_WINDOW", 10*time.Minute, time.Second),
+			CallbackSecret:        l.getSecret("NOTIFICATION_CALLBACK_SECRET", ""),
+			CallbackTimeout:       l.getEnvAsDuration("NOTIFICATION_CALLBACK_TIMEOUT", 10*time.Second, time.Second),
+			CallbackMaxRetries:    l.getEnvAsInt("NOTIFICATION_CALLBACK_MAX_RETRIES", 5),
+			ProviderTimeout:       l.getEnvAsDuration("NOTIFICATION_PROVIDER_TIMEOUT", 30*time.Second, time.Second),
+			BreakerWindow:         l.getEnvAsDuration("PROVIDER_BREAKER_WINDOW", time.Minute, time.Second),
+			BreakerMinRequests:    l.getEnvAsInt("PROVIDER_BREAKER_MIN_REQUESTS", 10),
+			BreakerFailureRate:    l.getEnvAsInt("PROVIDER_BREAKER_FAILURE_RATE", 50),
+			BreakerOpenDuration:   l.getEnvAsDuration("PROVIDER_BREAKER_OPEN_DURATION", 30*time.Second, time.Second),
+			BreakerHalfOpenProbes: l.getEnvAsInt("PROVIDER_BREAKER_HALF_OPEN_PROBES", 1),
+			RetentionDays:         l.getEnvAsInt("NOTIFICATION_RETENTION_DAYS", 90),
+			RetentionInterval:     l.getEnvAsDuration("NOTIFICATION_RETENTION_INTERVAL", time.Hour, time.Second),
+			RetentionBatchSize:    l.getEnvAsInt("NOTIFICATION_RETENTION_BATCH_SIZE", 500),
+			CleanupInterval:       l.getEnvAsDuration("NOTIFICATION_CLEANUP_INTERVAL", time.Hour, time.Second),
+			SnoozeInterval:        l.getEnvAsDuration("NOTIFICATION_SNOOZE_INTERVAL", 30*time.Second, time.Second),
+			AckBaseURL:            l.getEnv("ACK_BASE_URL", "http://localhost:8003"),
+			AckTTL:                l.getEnvAsDuration("ACK_TOKEN_TTL", 30*24*time.Hour, time.Second),
+			AckSecret:             l.getSecret("ACK_SECRET", ""),
+			AckSMSKeyword:         l.getEnv("ACK_SMS_KEYWORD", "ONAY"),
+			OTPLength:             l.getEnvAsInt("OTP_LENGTH", 6),
+			OTPTTL:                l.getEnvAsDuration("OTP_TTL", 5*time.Minute, time.Second),
+			OTPMaxAttempts:        l.getEnvAsInt("OTP_MAX_ATTEMPTS", 5),
+			OTPRateLimit:          l.getEnvAsInt("OTP_RATE_LIMIT", 5),
+			OTPRateWindow:         l.getEnvAsDuration("OTP_RATE_WINDOW", time.Hour, time.Second),
+			LeaderLease:           l.getEnvAsDuration("NOTIFICATION_LEADER_LEASE", 15*time.Second, time.Second),
+		},
+		// The message queue service keeps its streams in database 1
+		Queue: QueueConfig{
+			Enabled:       l.getEnvAsBool("QUEUE_CONSUMER_ENABLED", false),
+			ServiceURL:    l.getEnv("QUEUE_SERVICE_URL", "http://message-queue-service:8008"),
+			RedisURL:      l.getEnv("QUEUE_REDIS_URL", l.getEnv("REDIS_URL", "redis://localhost:6379")),
+			RedisPassword: l.getSecret("QUEUE_REDIS_PASSWORD", l.getSecret("REDIS_PASSWORD", "")),
+			RedisDB:       l.getEnvAsInt("QUEUE_REDIS_DB", 1),
+			Topic:         l.getEnv("QUEUE_TOPIC", "notifications"),
+			BatchSize:     l.getEnvAsInt64("QUEUE_BATCH_SIZE", 10),
+			BlockTime:     l.getEnvAsDuration("QUEUE_BLOCK_TIME", 2*time.Second, time.Second),
+			RetryAfter:    l.getEnvAsDuration("QUEUE_RETRY_AFTER", 30*time.Second, time.Second),
+			MaxRetries:    l.getEnvAsInt("QUEUE_MAX_RETRIES", 3),
+			EventsTopic:   l.getEnv("QUEUE_EVENTS_TOPIC", "notification-events"),
 		},
 	}
 
+	// Values that don't parse are reported with the invalid settings
+	problems := append(l.problems, config.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
 	return config, nil
 }
 
+// ValidationError lists every problem of an invalid configuration, so all of
+// them can be fixed at once
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// IsProduction reports whether the service runs in production
+func (c *Config) IsProduction() bool {
+	return c.Environment == EnvironmentProduction
+}
+
+// validate returns the settings that are missing or inconsistent
+func (c *Config) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port <= 65535, "PORT must be a port number, got %q", c.Port)
+
+	switch c.Environment {
+	case EnvironmentDevelopment, EnvironmentTest, EnvironmentStaging, EnvironmentProduction:
+	default:
+		problems = append(problems, fmt.Sprintf("ENVIRONMENT must be development, test, staging or production, got %q", c.Environment))
+	}
+
+	_, err = zerolog.ParseLevel(c.LogLevel)
+	check(err == nil, "LOG_LEVEL must be a log level like debug or info, got %q", c.LogLevel)
+
+	// Redis holds every notification, nothing works without it
+	check(c.Redis.URL != "", "REDIS_URL is required")
+	if c.Redis.URL != "" {
+		_, err := redis.ParseURL(c.Redis.URL)
+		check(err == nil, "REDIS_URL is invalid: %v", err)
+	}
+	if c.Queue.EventsTopic != "" {
+		_, err := redis.ParseURL(c.Queue.RedisURL)
+		check(err == nil, "QUEUE_REDIS_URL is invalid: %v", err)
+	}
+	if c.Queue.Enabled {
+		check(c.Queue.Topic != "", "QUEUE_TOPIC is required while QUEUE_CONSUMER_ENABLED is set")
+		check(c.Queue.ServiceURL != "", "QUEUE_SERVICE_URL is required while QUEUE_CONSUMER_ENABLED is set")
+	}
+
+	// Without credentials no caller could authenticate
+	check(c.Auth.JWTSecret != "" || len(c.Auth.APIKeys) > 0, "JWT_SECRET or NOTIFICATION_API_KEYS is required")
+
+	// Secrets generated at startup don't survive restarts or other instances
+	if c.IsProduction() {
+		check(c.Notification.AckSecret != "", "ACK_SECRET is required in production")
+		check(c.Privacy.AuditSecret != "", "PRIVACY_AUDIT_SECRET is required in production")
+	}
+
+	switch c.Archive.Backend {
+	case "none":
+	case "s3":
+		check(c.Archive.S3Endpoint != "" && c.Archive.S3Bucket != "", "ARCHIVE_S3_ENDPOINT and ARCHIVE_S3_BUCKET are required by the s3 archive")
+		check(c.Archive.S3AccessKey != "" && c.Archive.S3SecretKey != "", "ARCHIVE_S3_ACCESS_KEY and ARCHIVE_S3_SECRET_KEY are required by the s3 archive")
+	case "postgres":
+		check(c.Archive.DatabaseURL != "", "ARCHIVE_DATABASE_URL is required by the postgres archive")
+	default:
+		problems = append(problems, fmt.Sprintf("ARCHIVE_BACKEND must be none, s3 or postgres, got %q", c.Archive.Backend))
+	}
+
+	switch c.Runtime.Backend {
+	case "none", "redis":
+	case "file":
+		check(c.Runtime.File != "", "RUNTIME_CONFIG_FILE is required by the file runtime configuration")
+	default:
+		problems = append(problems, fmt.Sprintf("RUNTIME_CONFIG_BACKEND must be redis, file or none, got %q", c.Runtime.Backend))
+	}
+	check(c.Runtime.PollInterval > 0, "RUNTIME_CONFIG_POLL_INTERVAL must be positive")
+
+	problems = append(problems, c.validateChannels()...)
+
+	check(c.Notification.WorkerCount > 0, "NOTIFICATION_WORKER_COUNT must be positive")
+	for channel, count := range c.Notification.ChannelWorkers {
+		check(count > 0 && count <= 100, "NOTIFICATION_CHANNEL_WORKERS of %s must be between 1 and 100", channel)
+	}
+	for channel, limit := range c.Notification.ChannelMaxInFlight {
+		check(limit > 0, "NOTIFICATION_CHANNEL_MAX_IN_FLIGHT of %s must be positive", channel)
+	}
+	check(c.Notification.BatchSize > 0, "NOTIFICATION_BATCH_SIZE must be positive")
+	check(c.Notification.QueueSize > 0, "NOTIFICATION_QUEUE_SIZE must be positive")
+	check(c.Email.BulkConcurrency > 0, "EMAIL_BULK_CONCURRENCY must be positive")
+	check(c.Webhook.MaxConcurrent > 0, "WEBHOOK_MAX_CONCURRENT_DELIVERIES must be positive")
+	for entityType, link := range c.InApp.EntityLinks {
+		check(strings.Contains(link, "{id}"), "INAPP_ENTITY_LINKS of %s must contain {id}", entityType)
+	}
+	check(c.InApp.MaxAttachmentSize > 0, "INAPP_MAX_ATTACHMENT_SIZE must be positive")
+	// Signed URLs are valid for at most 7 days
+	check(c.InApp.AttachmentURLTTL >= time.Minute && c.InApp.AttachmentURLTTL <= 7*24*time.Hour,
+		"INAPP_ATTACHMENT_URL_TTL must be between 1 minute and 7 days")
+	check((c.InApp.AttachmentS3AccessKey == "") == (c.InApp.AttachmentS3SecretKey == ""),
+		"INAPP_ATTACHMENT_S3_ACCESS_KEY and INAPP_ATTACHMENT_S3_SECRET_KEY must be set together")
+	check(c.Notification.MaxRetries >= 0, "NOTIFICATION_MAX_RETRIES must not be negative")
+	check(c.Notification.RetentionDays > 0, "NOTIFICATION_RETENTION_DAYS must be positive")
+	check(c.Notification.BreakerFailureRate > 0 && c.Notification.BreakerFailureRate <= 100,
+		"PROVIDER_BREAKER_FAILURE_RATE must be a percentage between 1 and 100")
+	check(c.Notification.RetryDelay <= c.Notification.MaxRetryDelay, "NOTIFICATION_RETRY_DELAY must not exceed NOTIFICATION_MAX_RETRY_DELAY")
+	check(c.Webhook.RetryDelay <= c.Webhook.MaxRetryDelay, "WEBHOOK_RETRY_DELAY must not exceed WEBHOOK_MAX_RETRY_DELAY")
+	// Deliveries are looked up while they are retried and replayed from the
+	// dead letters, which keep them for a week
+	check(c.Webhook.DeliveryTTL >= c.Webhook.MaxRetryAge && c.Webhook.DeliveryTTL >= 7*24*time.Hour,
+		"WEBHOOK_DELIVERY_TTL must be at least WEBHOOK_MAX_RETRY_AGE and 168h")
+	check(c.Notification.OTPLength >= 4 && c.Notification.OTPLength <= 10, "OTP_LENGTH must be between 4 and 10 digits")
+	check(c.Notification.OTPMaxAttempts > 0, "OTP_MAX_ATTEMPTS must be positive")
+	check(c.Notification.OTPRateLimit >= 0, "OTP_RATE_LIMIT must not be negative")
+
+	// Intervals of background jobs and timeouts must be positive, a zero
+	// ticker panics and a zero timeout never gives up
+	for _, setting := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"NOTIFICATION_DIGEST_INTERVAL", c.Notification.DigestInterval},
+		{"NOTIFICATION_RETENTION_INTERVAL", c.Notification.RetentionInterval},
+		{"NOTIFICATION_CLEANUP_INTERVAL", c.Notification.CleanupInterval},
+		{"NOTIFICATION_SNOOZE_INTERVAL", c.Notification.SnoozeInterval},
+		{"NOTIFICATION_CALLBACK_TIMEOUT", c.Notification.CallbackTimeout},
+		{"NOTIFICATION_PROVIDER_TIMEOUT", c.Notification.ProviderTimeout},
+		{"INAPP_OPERATION_TIMEOUT", c.InApp.OperationTimeout},
+		{"PROVIDER_BREAKER_WINDOW", c.Notification.BreakerWindow},
+		{"PROVIDER_BREAKER_OPEN_DURATION", c.Notification.BreakerOpenDuration},
+		{"ACK_TOKEN_TTL", c.Notification.AckTTL},
+		{"OTP_TTL", c.Notification.OTPTTL},
+		{"OTP_RATE_WINDOW", c.Notification.OTPRateWindow},
+		{"NOTIFICATION_LEADER_LEASE", c.Notification.LeaderLease},
+		{"WEBHOOK_TIMEOUT", c.Webhook.Timeout},
+		{"USER_SERVICE_TIMEOUT", c.Recipient.Timeout},
+		{"IDEMPOTENCY_TTL", c.Idempotency.TTL},
+		{"IDEMPOTENCY_LOCK_TTL", c.Idempotency.LockTTL},
+	} {
+		check(setting.value > 0, "%s must be positive", setting.name)
+	}
+
+	return problems
+}
+
+// loader reads typed environment variables, remembering the ones that are
+// set but don't parse so they are reported instead of silently defaulted
+type loader struct {
+	problems []string
+	secrets  *secrets.Manager
+}
+
+func (l *loader) invalid(key string, value string, expected string) {
+	problem := fmt.Sprintf("%s must be %s, got %q", key, expected, value)
+
+	// Fallback variables are read more than once
+	for _, reported := range l.problems {
+		if reported == problem {
+			return
+		}
+	}
+	l.problems = append(l.problems, problem)
+}
+
 // getEnv gets an environment variable with a default value
-func getEnv(key, defaultValue string) string {
+func (l *loader) getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
@@ -182,41 +779,156 @@ func getEnv(key, defaultValue string) string {
 }
 
 // getEnvAsInt gets an environment variable as an integer with a default value
-func getEnvAsInt(key string, defaultValue int) int {
+func (l *loader) getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			l.invalid(key, value, "an integer")
+			return defaultValue
 		}
+		return intValue
 	}
 	return defaultValue
 }
 
 // getEnvAsInt64 gets an environment variable as an int64 with a default value
-func getEnvAsInt64(key string, defaultValue int64) int64 {
+func (l *loader) getEnvAsInt64(key string, defaultValue int64) int64 {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return intValue
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			l.invalid(key, value, "an integer")
+			return defaultValue
 		}
+		return intValue
 	}
 	return defaultValue
 }
 
-// getEnvAsBool gets an environment variable as a boolean with a default value
-func getEnvAsBool(key string, defaultValue bool) bool {
+// getEnvAsFloat gets an environment variable as a float64 with a default value
+func (l *loader) getEnvAsFloat(key string, defaultValue float64) float64 {
 	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			l.invalid(key, value, "a number")
+			return defaultValue
 		}
+		return floatValue
 	}
 	return defaultValue
 }
 
-// getEnvAsDuration gets an environment variable as a duration with a default value
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+// getEnvAsBool gets an environment variable as a boolean with a default value
+func (l *loader) getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			l.invalid(key, value, "true or false")
+			return defaultValue
 		}
+		return boolValue
 	}
 	return defaultValue
 }
+
+// getEnvAsDuration gets an environment variable as a duration with a default
+// value. Plain numbers are counted in unit, the unit the variable had before
+// it took durations.
+func (l *loader) getEnvAsDuration(key string, defaultValue time.Duration, unit time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(number) * unit
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		l.invalid(key, value, "a duration like 30s or 5m")
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvAsIntMap gets an environment variable formatted as "key=value,key=value" as a map of integers with a default value
+func (l *loader) getEnvAsIntMap(key string, defaultValue map[string]int) map[string]int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			l.invalid(key, value, "key=value pairs separated by commas")
+			return defaultValue
+		}
+		intValue, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			l.invalid(key, value, "key=integer pairs separated by commas")
+			return defaultValue
+		}
+		result[strings.TrimSpace(parts[0])] = intValue
+	}
+	return result
+}
+
+// getEnvAsStringMap gets an environment variable of "key=value" pairs separated by commas
+func (l *loader) getEnvAsStringMap(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			l.invalid(key, value, "key=value pairs separated by commas")
+			return defaultValue
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result
+}
+
+// getEnvAsSlice gets an environment variable of values separated by commas
+func (l *loader) getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getSMSProviderConfigs reads the credentials of SMS providers from
+// SMS_<PROVIDER>_API_KEY, _API_SECRET, _FROM_NUMBER, _BASE_URL, _SEGMENT_COST
+// and _RATE_LIMIT, skipping the providers without an API key
+func (l *loader) getSMSProviderConfigs(names ...string) map[string]SMSProviderConfig {
+	providers := make(map[string]SMSProviderConfig)
+	for _, name := range names {
+		prefix := "SMS_" + strings.ToUpper(name) + "_"
+		apiKey := l.getSecret(prefix+"API_KEY", "")
+		if apiKey == "" {
+			continue
+		}
+		providers[name] = SMSProviderConfig{
+			APIKey:      apiKey,
+			APISecret:   l.getSecret(prefix+"API_SECRET", ""),
+			FromNumber:  l.getEnv(prefix+"FROM_NUMBER", ""),
+			BaseURL:     l.getEnv(prefix+"BASE_URL", ""),
+			SegmentCost: l.getEnvAsFloat(prefix+"SEGMENT_COST", 0),
+			RateLimit:   l.getEnvAsInt(prefix+"RATE_LIMIT", l.getEnvAsInt("SMS_RATE_LIMIT", 10)),
+		}
+	}
+	return providers
+}
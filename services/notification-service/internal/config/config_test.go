@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setMinimalEnv sets what the defaults leave out, the channels without
+// defaults are switched off
+func setMinimalEnv(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("SMS_ENABLED", "false")
+	t.Setenv("PUSH_ENABLED", "false")
+}
+
+// validationProblems loads the configuration, returning its problems
+func validationProblems(t *testing.T) []string {
+	t.Helper()
+
+	config, err := Load()
+	if err == nil {
+		config.SecretManager().Close()
+		return nil
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	return validationErr.Problems
+}
+
+// hasProblem reports whether one of the problems mentions a variable
+func hasProblem(problems []string, variable string) bool {
+	for _, problem := range problems {
+		if strings.HasPrefix(problem, variable) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	setMinimalEnv(t)
+
+	config, err := Load()
+	if err != nil {
+		t.Fatalf("Expected the defaults to be valid, got %v", err)
+	}
+	defer config.SecretManager().Close()
+
+	if config.Queue.Enabled {
+		t.Errorf("Expected the queue consumer to be off unless enabled")
+	}
+	if config.Port != "8003" || config.Environment != EnvironmentDevelopment {
+		t.Errorf("Expected the default port and environment, got %s and %s", config.Port, config.Environment)
+	}
+}
+
+func TestEveryInvalidSettingIsReported(t *testing.T) {
+	t.Setenv("PORT", "http")
+	t.Setenv("NOTIFICATION_WORKER_COUNT", "many")
+	t.Setenv("IDEMPOTENCY_TTL", "0s")
+
+	problems := validationProblems(t)
+	for _, variable := range []string{"PORT", "NOTIFICATION_WORKER_COUNT", "IDEMPOTENCY_TTL", "JWT_SECRET or NOTIFICATION_API_KEYS"} {
+		if !hasProblem(problems, variable) {
+			t.Errorf("Expected %s to be reported, got %v", variable, problems)
+		}
+	}
+}
+
+func TestTheQueueRedisEventsArePublishedToIsChecked(t *testing.T) {
+	setMinimalEnv(t)
+	t.Setenv("QUEUE_REDIS_URL", "queue:6379")
+
+	if problems := validationProblems(t); !hasProblem(problems, "QUEUE_REDIS_URL") {
+		t.Errorf("Expected the invalid queue Redis to be reported, got %v", problems)
+	}
+}
+
+func TestDurationsTakeGoDurationsOrTheirUnit(t *testing.T) {
+	setMinimalEnv(t)
+	t.Setenv("IDEMPOTENCY_TTL", "90")
+	t.Setenv("IDEMPOTENCY_LOCK_TTL", "2m")
+
+	config, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	defer config.SecretManager().Close()
+
+	if config.Idempotency.TTL != 90*time.Second || config.Idempotency.LockTTL != 2*time.Minute {
+		t.Errorf("Expected 90s and 2m, got %v and %v", config.Idempotency.TTL, config.Idempotency.LockTTL)
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"claude-talimat/pkg/secrets"
+)
+
+// resolveTimeout bounds fetching a secret from the secret store
+const resolveTimeout = 10 * time.Second
+
+// SecretsConfig holds the secret store that credentials given as a reference
+// like secret:notification/smtp#password are read from
+type SecretsConfig struct {
+	Backend         string // env, vault, aws
+	RefreshInterval time.Duration
+	VaultAddress    string
+	VaultToken      string
+	VaultMount      string
+	VaultNamespace  string
+	AWSRegion       string
+	AWSAccessKey    string
+	AWSSecretKey    string
+	AWSSessionToken string
+	AWSEndpoint     string
+}
+
+// loadSecretsConfig reads the secret store settings, which can't be secret
+// references themselves
+func (l *loader) loadSecretsConfig() SecretsConfig {
+	return SecretsConfig{
+		Backend:         l.getEnv("SECRETS_BACKEND", "env"),
+		RefreshInterval: l.getEnvAsDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute, time.Second),
+		VaultAddress:    l.getEnv("VAULT_ADDR", ""),
+		VaultToken:      l.getEnv("VAULT_TOKEN", ""),
+		VaultMount:      l.getEnv("VAULT_MOUNT", "secret"),
+		VaultNamespace:  l.getEnv("VAULT_NAMESPACE", ""),
+		AWSRegion:       l.getEnv("AWS_REGION", ""),
+		AWSAccessKey:    l.getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretKey:    l.getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken: l.getEnv("AWS_SESSION_TOKEN", ""),
+		AWSEndpoint:     l.getEnv("SECRETS_AWS_ENDPOINT", ""),
+	}
+}
+
+// newSecretManager returns the manager resolving secret references from the
+// configured store. With the env backend references are rejected.
+func newSecretManager(c SecretsConfig) (*secrets.Manager, error) {
+	switch c.Backend {
+	case "env":
+		return secrets.NewManager(nil, 0), nil
+	case "vault":
+		provider, err := secrets.NewVaultProvider(secrets.VaultConfig{
+			Address:   c.VaultAddress,
+			Token:     c.VaultToken,
+			Mount:     c.VaultMount,
+			Namespace: c.VaultNamespace,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_BACKEND vault: %w", err)
+		}
+		return secrets.NewManager(provider, c.RefreshInterval), nil
+	case "aws":
+		provider, err := secrets.NewAWSProvider(secrets.AWSConfig{
+			Region:       c.AWSRegion,
+			AccessKey:    c.AWSAccessKey,
+			SecretKey:    c.AWSSecretKey,
+			SessionToken: c.AWSSessionToken,
+			Endpoint:     c.AWSEndpoint,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_BACKEND aws: %w", err)
+		}
+		return secrets.NewManager(provider, c.RefreshInterval), nil
+	default:
+		return nil, fmt.Errorf("SECRETS_BACKEND must be env, vault or aws, got %q", c.Backend)
+	}
+}
+
+// SecretManager returns the manager that resolved the secrets of the
+// configuration and refreshes them
+func (c *Config) SecretManager() *secrets.Manager {
+	return c.secrets
+}
+
+// Reload reads the configuration again with the secrets refreshed since it
+// was loaded, to pick up rotated credentials
+func (c *Config) Reload() (*Config, error) {
+	return load(&loader{secrets: c.secrets}, c.Secrets)
+}
+
+// getSecret gets an environment variable holding a credential. References
+// are resolved from the secret store, and the value is redacted from logs
+// and errors wherever it came from.
+func (l *loader) getSecret(key, defaultValue string) string {
+	value := l.getEnv(key, defaultValue)
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	resolved, err := l.secrets.Resolve(ctx, value)
+	if err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("%s: %v", key, err))
+		return ""
+	}
+	secrets.Register(resolved)
+	return resolved
+}
+
+// getSecretMap gets an environment variable of "key=value" pairs whose
+// values are credentials
+func (l *loader) getSecretMap(key string, defaultValue map[string]string) map[string]string {
+	values := l.getEnvAsStringMap(key, defaultValue)
+
+	resolved := make(map[string]string, len(values))
+	for name, value := range values {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		secret, err := l.secrets.Resolve(ctx, value)
+		cancel()
+		if err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		secrets.Register(secret)
+		resolved[name] = secret
+	}
+	return resolved
+}
+
+// getSecretAsKey gets a credential holding a base64 encoded key of size
+// bytes. The value is left out of the problem reported for a bad key.
+func (l *loader) getSecretAsKey(key string, size int) []byte {
+	value := l.getSecret(key, "")
+	if value == "" {
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(decoded) != size {
+		l.problems = append(l.problems, fmt.Sprintf("%s must be a base64 encoded %d-byte key", key, size))
+		return nil
+	}
+	return decoded
+}
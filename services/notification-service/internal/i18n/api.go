@@ -0,0 +1,294 @@
+package i18n
+
+// apiMessages translates API strings by their English text. Entries with a
+// %s match the strings that differ only in that part.
+var apiMessages = map[string]map[string]string{
+	TR: {
+		// Problem titles
+		"Invalid request":               "Geçersiz istek",
+		"Validation failed":             "Doğrulama başarısız",
+		"Unauthorized":                  "Kimlik doğrulanamadı",
+		"Forbidden":                     "Erişim engellendi",
+		"Resource not found":            "Kaynak bulunamadı",
+		"Conflict with current state":   "Mevcut durumla çakışma",
+		"Idempotency key reused":        "Idempotency anahtarı yeniden kullanıldı",
+		"Request in progress":           "İstek işleniyor",
+		"Rate limit exceeded":           "İstek sınırı aşıldı",
+		"Delivery provider failed":      "Gönderim sağlayıcısı başarısız oldu",
+		"Delivery provider unavailable": "Gönderim sağlayıcısı kullanılamıyor",
+		"Internal server error":         "Sunucu hatası",
+
+		// Field errors
+		"is required":                    "zorunludur",
+		"must be an email address":       "bir e-posta adresi olmalıdır",
+		"must be a phone number like %s": "%s gibi bir telefon numarası olmalıdır",
+		"must be one of %s":              "şunlardan biri olmalıdır: %s",
+		"must be lowercase letters, digits, dots, dashes or underscores": "küçük harf, rakam, nokta, tire veya alt çizgiden oluşmalıdır",
+		"must be a URL": "bir URL olmalıdır",
+		"must have at least %s items or characters": "en az %s öğe veya karakter içermelidir",
+		"must have at most %s items or characters":  "en fazla %s öğe veya karakter içermelidir",
+		"must be at least %s":                       "en az %s olmalıdır",
+		"must be at most %s":                        "en fazla %s olmalıdır",
+		"must be greater than %s":                   "%s değerinden büyük olmalıdır",
+		"must be less than %s":                      "%s değerinden küçük olmalıdır",
+		"failed on the '%s' rule":                   "'%s' kuralını sağlamıyor",
+		"must be an RFC 3339 time":                  "RFC 3339 biçiminde bir zaman olmalıdır",
+		"must be a string":                          "metin olmalıdır",
+		"must be a boolean":                         "true ya da false olmalıdır",
+		"must be an integer":                        "tam sayı olmalıdır",
+		"must be a number":                          "sayı olmalıdır",
+		"must be an array":                          "dizi olmalıdır",
+		"must be an object":                         "nesne olmalıdır",
+		"is not a known field":                      "bilinmeyen bir alandır",
+
+		// Requests
+		"A request with this Idempotency-Key is still being processed": "Bu Idempotency-Key ile gönderilen istek hâlâ işleniyor",
+		"Acknowledgment token is required":                             "Onay anahtarı zorunludur",
+		"At most %s IDs can be queried at once":                        "Tek seferde en fazla %s kimlik sorgulanabilir",
+		"At most %s notifications can be selected at once":             "Tek seferde en fazla %s bildirim seçilebilir",
+		"Authentication required":                                      "Kimlik doğrulaması gerekli",
+		"Category has no default channels, type is required":           "Kategorinin varsayılan kanalı yok, tür zorunludur",
+		"Either type or category is required":                          "Tür ya da kategori alanından biri zorunludur",
+		"Either until or minutes is required":                          "until ya da minutes alanından biri zorunludur",
+		"Export format must be csv or json":                            "Dışa aktarma biçimi csv ya da json olmalıdır",
+		"Failed to search templates":                                   "Şablonlar aranamadı",
+		"Idempotency-Key must not exceed 255 characters":               "Idempotency-Key 255 karakteri aşmamalıdır",
+		"Idempotency-Key was already used with a different request":    "Idempotency-Key farklı bir istekle kullanılmış",
+		"Import source must be defaults or export":                     "İçe aktarma kaynağı defaults ya da export olmalıdır",
+		"Insufficient permissions":                                     "Yetkiniz yetersiz",
+		"Invalid alert event":                                          "Geçersiz uyarı olayı",
+		"Invalid branding data":                                        "Geçersiz marka verisi",
+		"Invalid filter":                                               "Geçersiz filtre",
+		"Invalid locale settings":                                      "Geçersiz dil ayarları",
+		"Invalid preferences data":                                     "Geçersiz tercih verisi",
+		"Invalid request body":                                         "Geçersiz istek gövdesi",
+		"Invalid request data":                                         "Geçersiz istek verisi",
+		"Invalid saved view data":                                      "Geçersiz kayıtlı görünüm verisi",
+		"Invalid snooze data":                                          "Geçersiz erteleme verisi",
+		"Invalid template data":                                        "Geçersiz şablon verisi",
+		"Invalid template export":                                      "Geçersiz şablon dışa aktarımı",
+		"Invalid template version":                                     "Geçersiz şablon sürümü",
+		"Invalid time: %s":                                             "Geçersiz zaman: %s",
+		"Invalid update data":                                          "Geçersiz güncelleme verisi",
+		"Invalid webhook allow-list":                                   "Geçersiz webhook izin listesi",
+		"Invalid webhook endpoint":                                     "Geçersiz webhook uç noktası",
+		"No route for %s":                                              "%s için bir yol yok",
+		"Notification ID is required":                                  "Bildirim kimliği zorunludur",
+		"Only available to operators":                                  "Yalnızca operatörler kullanabilir",
+		"Runtime configuration can't be changed through the API":       "Çalışma zamanı yapılandırması API üzerinden değiştirilemez",
+		"Template name and type are required":                          "Şablon adı ve türü zorunludur",
+		"User ID is required":                                          "Kullanıcı kimliği zorunludur",
+		"class must be validation, timeout, provider or internal":      "class validation, timeout, provider ya da internal olmalıdır",
+		"tenant_id is required":                                        "tenant_id zorunludur",
+
+		// Access
+		"Access denied to this user's notifications":       "Bu kullanıcının bildirimlerine erişim engellendi",
+		"Not allowed to access notifications of this user": "Bu kullanıcının bildirimlerine erişim izniniz yok",
+		"Not allowed to add contact points of this user":   "Bu kullanıcıya iletişim noktası ekleme izniniz yok",
+		"Not allowed to export data of this user":          "Bu kullanıcının verilerini dışa aktarma izniniz yok",
+		"Not allowed to list contact points of this user":  "Bu kullanıcının iletişim noktalarını listeleme izniniz yok",
+		"Not allowed to list devices of this user":         "Bu kullanıcının cihazlarını listeleme izniniz yok",
+		"Not allowed to read preferences of this user":     "Bu kullanıcının tercihlerini okuma izniniz yok",
+		"Not allowed to register devices of this user":     "Bu kullanıcıya cihaz kaydetme izniniz yok",
+		"Not allowed to sign in devices as this user":      "Cihazlarda bu kullanıcı olarak oturum açma izniniz yok",
+		"Not allowed to update preferences of this user":   "Bu kullanıcının tercihlerini güncelleme izniniz yok",
+
+		// Not found
+		"Alert not found":              "Uyarı bulunamadı",
+		"Campaign not found":           "Kampanya bulunamadı",
+		"Category not found":           "Kategori bulunamadı",
+		"Contact point not found":      "İletişim noktası bulunamadı",
+		"Device not found":             "Cihaz bulunamadı",
+		"Escalation not found":         "Eskalasyon bulunamadı",
+		"Escalation policy not found":  "Eskalasyon politikası bulunamadı",
+		"Maintenance window not found": "Bakım aralığı bulunamadı",
+		"Notification not found":       "Bildirim bulunamadı",
+		"Schedule not found":           "Nöbet çizelgesi bulunamadı",
+		"Template not found":           "Şablon bulunamadı",
+		"User preferences not found":   "Kullanıcı tercihleri bulunamadı",
+		"Webhook endpoint not found":   "Webhook uç noktası bulunamadı",
+
+		// Failures
+		"Failed to acknowledge SMS reply":        "SMS yanıtı onaylanamadı",
+		"Failed to acknowledge escalation":       "Eskalasyon onaylanamadı",
+		"Failed to acknowledge notification":     "Bildirim onaylanamadı",
+		"Failed to add email suppression":        "E-posta engeli eklenemedi",
+		"Failed to apply SMS reply":              "SMS yanıtı işlenemedi",
+		"Failed to apply call event":             "Arama olayı işlenemedi",
+		"Failed to apply delivery report":        "İletim raporu işlenemedi",
+		"Failed to apply email feedback":         "E-posta geri bildirimi işlenemedi",
+		"Failed to apply keypress":               "Tuşlama işlenemedi",
+		"Failed to archive notification":         "Bildirim arşivlenemedi",
+		"Failed to broadcast notification":       "Bildirim yayınlanamadı",
+		"Failed to clean up storage":             "Depolama temizlenemedi",
+		"Failed to confirm email address":        "E-posta adresi doğrulanamadı",
+		"Failed to confirm phone number":         "Telefon numarası doğrulanamadı",
+		"Failed to create campaign":              "Kampanya oluşturulamadı",
+		"Failed to create category":              "Kategori oluşturulamadı",
+		"Failed to create contact point":         "İletişim noktası oluşturulamadı",
+		"Failed to create escalation policy":     "Eskalasyon politikası oluşturulamadı",
+		"Failed to create maintenance window":    "Bakım aralığı oluşturulamadı",
+		"Failed to create override":              "Nöbet değişikliği oluşturulamadı",
+		"Failed to create saved view":            "Kayıtlı görünüm oluşturulamadı",
+		"Failed to create schedule":              "Nöbet çizelgesi oluşturulamadı",
+		"Failed to create template":              "Şablon oluşturulamadı",
+		"Failed to create webhook endpoint":      "Webhook uç noktası oluşturulamadı",
+		"Failed to deactivate device":            "Cihaz devre dışı bırakılamadı",
+		"Failed to delete campaign":              "Kampanya silinemedi",
+		"Failed to delete category":              "Kategori silinemedi",
+		"Failed to delete contact point":         "İletişim noktası silinemedi",
+		"Failed to delete device":                "Cihaz silinemedi",
+		"Failed to delete escalation policy":     "Eskalasyon politikası silinemedi",
+		"Failed to delete maintenance window":    "Bakım aralığı silinemedi",
+		"Failed to delete notification settings": "Bildirim ayarları silinemedi",
+		"Failed to delete notification":          "Bildirim silinemedi",
+		"Failed to delete override":              "Nöbet değişikliği silinemedi",
+		"Failed to delete saved view":            "Kayıtlı görünüm silinemedi",
+		"Failed to delete schedule":              "Nöbet çizelgesi silinemedi",
+		"Failed to delete template":              "Şablon silinemedi",
+		"Failed to delete webhook endpoint":      "Webhook uç noktası silinemedi",
+		"Failed to enable webhook endpoint":      "Webhook uç noktası etkinleştirilemedi",
+		"Failed to erase user data":              "Kullanıcı verileri silinemedi",
+		"Failed to export notifications":         "Bildirimler dışa aktarılamadı",
+		"Failed to export templates":             "Şablonlar dışa aktarılamadı",
+		"Failed to export user data":             "Kullanıcı verileri dışa aktarılamadı",
+		"Failed to generate Beams token":         "Beams anahtarı oluşturulamadı",
+		"Failed to get SMS opt-outs":             "SMS abonelik iptalleri alınamadı",
+		"Failed to get SMS settings":             "SMS ayarları alınamadı",
+		"Failed to get acknowledgment report":    "Onay raporu alınamadı",
+		"Failed to get acknowledgment":           "Onay alınamadı",
+		"Failed to get action stats":             "Eylem istatistikleri alınamadı",
+		"Failed to get branding":                 "Marka ayarları alınamadı",
+		"Failed to get campaign progress":        "Kampanya ilerlemesi alınamadı",
+		"Failed to get channel delivery rates":   "Kanal iletim oranları alınamadı",
+		"Failed to get contact point":            "İletişim noktası alınamadı",
+		"Failed to get device":                   "Cihaz alınamadı",
+		"Failed to get devices":                  "Cihazlar alınamadı",
+		"Failed to get email suppressions":       "E-posta engelleri alınamadı",
+		"Failed to get erasure records":          "Silme kayıtları alınamadı",
+		"Failed to get locale coverage":          "Dil kapsamı alınamadı",
+		"Failed to get locale settings":          "Dil ayarları alınamadı",
+		"Failed to get muted deliveries":         "Sessize alınan gönderimler alınamadı",
+		"Failed to get notification history":     "Bildirim geçmişi alınamadı",
+		"Failed to get notification settings":    "Bildirim ayarları alınamadı",
+		"Failed to get notification stats":       "Bildirim istatistikleri alınamadı",
+		"Failed to get notification statuses":    "Bildirim durumları alınamadı",
+		"Failed to get notification threads":     "Bildirim dizileri alınamadı",
+		"Failed to get notification timeline":    "Bildirim zaman çizelgesi alınamadı",
+		"Failed to get notification":             "Bildirim alınamadı",
+		"Failed to get notifications":            "Bildirimler alınamadı",
+		"Failed to get pruned token report":      "Temizlenen anahtar raporu alınamadı",
+		"Failed to get queue backlogs":           "Kuyruk birikimleri alınamadı",
+		"Failed to get recent failures":          "Son hatalar alınamadı",
+		"Failed to get retention policy":         "Saklama politikası alınamadı",
+		"Failed to get retention progress":       "Saklama ilerlemesi alınamadı",
+		"Failed to get sandbox status":           "Test ortamı durumu alınamadı",
+		"Failed to get saved view":               "Kayıtlı görünüm alınamadı",
+		"Failed to get saved views":              "Kayıtlı görünümler alınamadı",
+		"Failed to get snoozed notifications":    "Ertelenen bildirimler alınamadı",
+		"Failed to get storage report":           "Depolama raporu alınamadı",
+		"Failed to get template variants":        "Şablon varyantları alınamadı",
+		"Failed to get template version":         "Şablon sürümü alınamadı",
+		"Failed to get template versions":        "Şablon sürümleri alınamadı",
+		"Failed to get template":                 "Şablon alınamadı",
+		"Failed to get templates":                "Şablonlar alınamadı",
+		"Failed to get tenant usage":             "Kiracı kullanımı alınamadı",
+		"Failed to get unread count":             "Okunmamış sayısı alınamadı",
+		"Failed to get webhook allow-list":       "Webhook izin listesi alınamadı",
+		"Failed to get webhook deliveries":       "Webhook gönderimleri alınamadı",
+		"Failed to get webhook endpoint health":  "Webhook uç noktası sağlığı alınamadı",
+		"Failed to get webhook event types":      "Webhook olay türleri alınamadı",
+		"Failed to get who is on call":           "Nöbetçi bilgisi alınamadı",
+		"Failed to import templates":             "Şablonlar içe aktarılamadı",
+		"Failed to list alerts":                  "Uyarılar listelenemedi",
+		"Failed to list campaigns":               "Kampanyalar listelenemedi",
+		"Failed to list categories":              "Kategoriler listelenemedi",
+		"Failed to list contact points":          "İletişim noktaları listelenemedi",
+		"Failed to list escalation policies":     "Eskalasyon politikaları listelenemedi",
+		"Failed to list escalations":             "Eskalasyonlar listelenemedi",
+		"Failed to list maintenance windows":     "Bakım aralıkları listelenemedi",
+		"Failed to list overrides":               "Nöbet değişiklikleri listelenemedi",
+		"Failed to list schedules":               "Nöbet çizelgeleri listelenemedi",
+		"Failed to list webhook endpoints":       "Webhook uç noktaları listelenemedi",
+		"Failed to mark notification as read":    "Bildirim okundu olarak işaretlenemedi",
+		"Failed to mark notifications as read":   "Bildirimler okundu olarak işaretlenemedi",
+		"Failed to mark thread as read":          "Dizi okundu olarak işaretlenemedi",
+		"Failed to pause campaign":               "Kampanya duraklatılamadı",
+		"Failed to process alert event":          "Uyarı olayı işlenemedi",
+		"Failed to publish template":             "Şablon yayımlanamadı",
+		"Failed to receive inbound message":      "Gelen mesaj alınamadı",
+		"Failed to record action":                "Eylem kaydedilemedi",
+		"Failed to refresh device":               "Cihaz yenilenemedi",
+		"Failed to register device":              "Cihaz kaydedilemedi",
+		"Failed to remove SMS opt-out":           "SMS abonelik iptali kaldırılamadı",
+		"Failed to remove email suppression":     "E-posta engeli kaldırılamadı",
+		"Failed to render template":              "Şablon işlenemedi",
+		"Failed to resolve alert":                "Uyarı çözüldü olarak işaretlenemedi",
+		"Failed to resolve escalation":           "Eskalasyon çözüldü olarak işaretlenemedi",
+		"Failed to resolve template":             "Şablon bulunamadı",
+		"Failed to resume campaign":              "Kampanya sürdürülemedi",
+		"Failed to roll back template":           "Şablon geri alınamadı",
+		"Failed to schedule campaign":            "Kampanya zamanlanamadı",
+		"Failed to send code":                    "Kod gönderilemedi",
+		"Failed to send confirmation link":       "Doğrulama bağlantısı gönderilemedi",
+		"Failed to send mention":                 "Bahsetme bildirimi gönderilemedi",
+		"Failed to send notification":            "Bildirim gönderilemedi",
+		"Failed to send notifications":           "Bildirimler gönderilemedi",
+		"Failed to send test notification":       "Test bildirimi gönderilemedi",
+		"Failed to send verification code":       "Doğrulama kodu gönderilemedi",
+		"Failed to snooze notification":          "Bildirim ertelenemedi",
+		"Failed to start campaign":               "Kampanya başlatılamadı",
+		"Failed to test webhook endpoint":        "Webhook uç noktası test edilemedi",
+		"Failed to trigger escalation":           "Eskalasyon başlatılamadı",
+		"Failed to unsnooze notification":        "Bildirim ertelemesi kaldırılamadı",
+		"Failed to update SMS settings":          "SMS ayarları güncellenemedi",
+		"Failed to update branding":              "Marka ayarları güncellenemedi",
+		"Failed to update campaign":              "Kampanya güncellenemedi",
+		"Failed to update category":              "Kategori güncellenemedi",
+		"Failed to update contact point":         "İletişim noktası güncellenemedi",
+		"Failed to update escalation policy":     "Eskalasyon politikası güncellenemedi",
+		"Failed to update locale settings":       "Dil ayarları güncellenemedi",
+		"Failed to update notification settings": "Bildirim ayarları güncellenemedi",
+		"Failed to update notifications":         "Bildirimler güncellenemedi",
+		"Failed to update preferences":           "Tercihler güncellenemedi",
+		"Failed to update retention policy":      "Saklama politikası güncellenemedi",
+		"Failed to update runtime configuration": "Çalışma zamanı yapılandırması güncellenemedi",
+		"Failed to update sandbox mode":          "Test ortamı modu güncellenemedi",
+		"Failed to update saved view":            "Kayıtlı görünüm güncellenemedi",
+		"Failed to update schedule":              "Nöbet çizelgesi güncellenemedi",
+		"Failed to update template":              "Şablon güncellenemedi",
+		"Failed to update webhook allow-list":    "Webhook izin listesi güncellenemedi",
+		"Failed to update webhook endpoint":      "Webhook uç noktası güncellenemedi",
+		"Failed to verify code":                  "Kod doğrulanamadı",
+
+		// Successes
+		"All notifications marked as read":           "Tüm bildirimler okundu olarak işaretlendi",
+		"Bulk notifications queued for delivery":     "Toplu bildirimler gönderim için kuyruğa alındı",
+		"Campaign deleted successfully":              "Kampanya silindi",
+		"Category deleted successfully":              "Kategori silindi",
+		"Confirmation link sent":                     "Doğrulama bağlantısı gönderildi",
+		"Contact point deleted successfully":         "İletişim noktası silindi",
+		"Device deleted":                             "Cihaz silindi",
+		"Email feedback applied":                     "E-posta geri bildirimi işlendi",
+		"Email suppression removed":                  "E-posta engeli kaldırıldı",
+		"Escalation policy deleted successfully":     "Eskalasyon politikası silindi",
+		"Maintenance window deleted successfully":    "Bakım aralığı silindi",
+		"Notification archived":                      "Bildirim arşivlendi",
+		"Notification deleted":                       "Bildirim silindi",
+		"Notification marked as read":                "Bildirim okundu olarak işaretlendi",
+		"Notification queued for delivery":           "Bildirim gönderim için kuyruğa alındı",
+		"Notification settings deleted successfully": "Bildirim ayarları silindi",
+		"Override deleted successfully":              "Nöbet değişikliği silindi",
+		"Retention run started":                      "Saklama çalışması başlatıldı",
+		"SMS opt-out removed":                        "SMS abonelik iptali kaldırıldı",
+		"Saved view deleted":                         "Kayıtlı görünüm silindi",
+		"Schedule deleted successfully":              "Nöbet çizelgesi silindi",
+		"Template deleted successfully":              "Şablon silindi",
+		"Template updated successfully":              "Şablon güncellendi",
+		"Test notification sent successfully":        "Test bildirimi gönderildi",
+		"Thread marked as read":                      "Dizi okundu olarak işaretlendi",
+		"User preferences updated successfully":      "Kullanıcı tercihleri güncellendi",
+		"Verification code sent":                     "Doğrulama kodu gönderildi",
+		"Webhook endpoint deleted successfully":      "Webhook uç noktası silindi",
+	},
+}
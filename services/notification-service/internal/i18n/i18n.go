@@ -0,0 +1,199 @@
+// Package i18n translates the strings the service writes itself: API error
+// messages and the notifications it generates, like digests and alerts.
+//
+// System notifications are looked up by key. API strings are written in
+// English and looked up by their text, so strings without a translation are
+// served as they are.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Locales with a catalogue
+const (
+	TR = "tr"
+	EN = "en"
+)
+
+const (
+	// Default is the locale of notifications when neither the recipient nor
+	// the tenant sets one
+	Default = TR
+
+	// Source is the locale API strings are written in, responses are in it
+	// when neither the client nor its tenant asks for another
+	Source = EN
+)
+
+const contextKey = "locale"
+
+// Supported are the locales with a catalogue
+var Supported = []string{TR, EN}
+
+// T returns the message of a key in a locale, formatted with args. Keys
+// without a message in the locale fall back to Default.
+func T(locale string, key string, args ...interface{}) string {
+	text, ok := catalogue[Select(locale)][key]
+	if !ok {
+		text, ok = catalogue[Default][key]
+	}
+	if !ok {
+		text = key
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Translate returns an English API string in a locale. Patterns in the
+// catalogue hold one %s for the part of a string that varies, like a path.
+// Strings without a translation are returned as they are.
+func Translate(locale string, text string) string {
+	locale = Select(locale)
+	if locale == Source || text == "" {
+		return text
+	}
+
+	if translated, ok := catalogue[locale][text]; ok {
+		return translated
+	}
+	for _, pattern := range patterns[locale] {
+		if value, ok := pattern.match(text); ok {
+			return fmt.Sprintf(pattern.translated, value)
+		}
+	}
+	return text
+}
+
+// Select returns the first of the locales with a catalogue, matching a
+// regional locale by its language. It returns Default when none has one.
+func Select(locales ...string) string {
+	for _, locale := range locales {
+		if supported := supportedLocale(locale); supported != "" {
+			return supported
+		}
+	}
+	return Default
+}
+
+// Match returns the locale with a catalogue a client prefers most in an
+// Accept-Language header, empty when it accepts none of them
+func Match(acceptLanguage string) string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	var ranges []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		q := 1.0
+		for _, param := range fields[1:] {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.TrimSpace(name) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+
+		locale := supportedLocale(fields[0])
+		if locale == "" || q <= 0 {
+			continue
+		}
+		ranges = append(ranges, weighted{locale: locale, q: q})
+	}
+
+	// Of equally weighted locales the client listed first wins
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	if len(ranges) == 0 {
+		return ""
+	}
+	return ranges[0].locale
+}
+
+// SetLocale sets the locale of the response to a request
+func SetLocale(c *gin.Context, locale string) {
+	c.Set(contextKey, locale)
+	c.Header("Content-Language", locale)
+}
+
+// FromContext returns the locale of the response to a request: the one set
+// by SetLocale, else the one the client asks for, else Source
+func FromContext(c *gin.Context) string {
+	if locale := c.GetString(contextKey); locale != "" {
+		return locale
+	}
+	if locale := Match(c.GetHeader("Accept-Language")); locale != "" {
+		return locale
+	}
+	return Source
+}
+
+// pattern translates API strings with a varying part
+type pattern struct {
+	prefix     string
+	suffix     string
+	translated string
+}
+
+func (p pattern) match(text string) (string, bool) {
+	if len(text) <= len(p.prefix)+len(p.suffix) ||
+		!strings.HasPrefix(text, p.prefix) || !strings.HasSuffix(text, p.suffix) {
+		return "", false
+	}
+	return text[len(p.prefix) : len(text)-len(p.suffix)], true
+}
+
+// patterns holds the catalogue entries with a %s, by locale
+var patterns = make(map[string][]pattern)
+
+func init() {
+	for locale, messages := range apiMessages {
+		for text, translated := range messages {
+			catalogue[locale][text] = translated
+		}
+	}
+
+	for locale, messages := range catalogue {
+		for text, translated := range messages {
+			prefix, suffix, found := strings.Cut(text, "%s")
+			if !found {
+				continue
+			}
+			patterns[locale] = append(patterns[locale], pattern{prefix: prefix, suffix: suffix, translated: translated})
+		}
+
+		// The longest pattern is the most specific
+		sort.Slice(patterns[locale], func(i, j int) bool {
+			a, b := patterns[locale][i], patterns[locale][j]
+			return len(a.prefix)+len(a.suffix) > len(b.prefix)+len(b.suffix)
+		})
+	}
+}
+
+// supportedLocale returns the locale with a catalogue of a language tag
+func supportedLocale(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	language := strings.SplitN(tag, "-", 2)[0]
+	for _, locale := range Supported {
+		if language == locale {
+			return locale
+		}
+	}
+	return ""
+}
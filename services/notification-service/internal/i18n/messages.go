@@ -0,0 +1,114 @@
+package i18n
+
+// Message keys of the notifications the service generates
+const (
+	DigestHourly = "digest.hourly"
+	DigestDaily  = "digest.daily"
+	DigestWeekly = "digest.weekly"
+	DigestTitle  = "digest.title" // digest name, number of notifications
+
+	AckLink  = "ack.link"
+	AckText  = "ack.text"  // acknowledgment link
+	AckSMS   = "ack.sms"   // reply keyword, code
+	AckVoice = "ack.voice" // digit to press
+
+	VoiceNotAcknowledged = "voice.not_acknowledged"
+	VoiceAckFailed       = "voice.ack_failed"
+	VoiceAcknowledged    = "voice.acknowledged"
+
+	WebhookDisabledSubject = "webhook.disabled.subject" // endpoint name
+	WebhookDisabledTitle   = "webhook.disabled.title"
+	WebhookDisabledMessage = "webhook.disabled.message" // URL, endpoint name, reason
+
+	AlertResolvedTitle   = "alert.resolved.title"   // alert title
+	AlertResolvedMessage = "alert.resolved.message" // alert title
+
+	OTPSubject   = "otp.subject"
+	OTPMessage   = "otp.message"    // code, minutes
+	OTPExpiresIn = "otp.expires_in" // minutes
+
+	EmailVerificationSubject = "email_verification.subject"
+	EmailVerificationText    = "email_verification.text" // confirmation link
+	EmailVerificationHTML    = "email_verification.html"
+	EmailVerificationButton  = "email_verification.button"
+
+	MentionTitle    = "mention.title"    // actor, entity
+	AssignmentTitle = "assignment.title" // actor, entity
+	MentionMessage  = "mention.message"
+)
+
+var catalogue = map[string]map[string]string{
+	TR: {
+		DigestHourly: "Saatlik Bildirim Özeti",
+		DigestDaily:  "Günlük Bildirim Özeti",
+		DigestWeekly: "Haftalık Bildirim Özeti",
+		DigestTitle:  "%s - %d yeni bildirim",
+
+		AckLink: "Okudum, onaylıyorum",
+		AckText: "Okuduğunuzu onaylamak için: %s",
+		// Plain ASCII keeps the reply instruction from forcing Unicode encoding
+		AckSMS:   "Okudugunuzu onaylamak icin %s %s yazip yanitlayin.",
+		AckVoice: "Bildirimi onayladığınızı belirtmek için %s tuşuna basın.",
+
+		VoiceNotAcknowledged: "Onay alınmadı. Hoşça kalın.",
+		VoiceAckFailed:       "Onayınız kaydedilemedi. Lütfen bildirimi başka bir kanaldan onaylayın.",
+		VoiceAcknowledged:    "Teşekkürler, bildirimi onayladınız. Hoşça kalın.",
+
+		WebhookDisabledSubject: "Webhook devre dışı bırakıldı: %s",
+		WebhookDisabledTitle:   "Webhook devre dışı bırakıldı",
+		WebhookDisabledMessage: "%s adresine gönderilen webhook'lar sürekli başarısız olduğu için %s uç noktası devre dışı bırakıldı (%s). " +
+			"Sorunu giderdikten sonra uç noktayı yeniden etkinleştirebilirsiniz.",
+
+		AlertResolvedTitle:   "Çözüldü: %s",
+		AlertResolvedMessage: "%s sorunu giderildi.",
+
+		OTPSubject:   "Doğrulama kodunuz",
+		OTPMessage:   "Doğrulama kodunuz: %s. Kod %d dakika geçerlidir.",
+		OTPExpiresIn: "%d dakika",
+
+		EmailVerificationSubject: "E-posta adresinizi doğrulayın",
+		EmailVerificationText:    "Bildirimleri bu adrese almak için adresinizi doğrulayın: %s",
+		EmailVerificationHTML:    "Bildirimleri bu adrese almak için adresinizi doğrulayın.",
+		EmailVerificationButton:  "E-posta adresimi doğrula",
+
+		MentionTitle:    "%s sizden bahsetti: %s",
+		AssignmentTitle: "%s size atadı: %s",
+		MentionMessage:  "Ayrıntıları görmek için açın.",
+	},
+	EN: {
+		DigestHourly: "Hourly Notification Digest",
+		DigestDaily:  "Daily Notification Digest",
+		DigestWeekly: "Weekly Notification Digest",
+		DigestTitle:  "%s - %d new notifications",
+
+		AckLink:  "I have read it",
+		AckText:  "To confirm you have read it: %s",
+		AckSMS:   "Reply %s %s to confirm you have read it.",
+		AckVoice: "Press %s to acknowledge the notification.",
+
+		VoiceNotAcknowledged: "Not acknowledged. Goodbye.",
+		VoiceAckFailed:       "Your acknowledgment couldn't be recorded. Please acknowledge the notification on another channel.",
+		VoiceAcknowledged:    "Thank you, you acknowledged the notification. Goodbye.",
+
+		WebhookDisabledSubject: "Webhook disabled: %s",
+		WebhookDisabledTitle:   "Webhook disabled",
+		WebhookDisabledMessage: "Webhooks sent to %s kept failing, so the endpoint %s was disabled (%s). " +
+			"You can enable the endpoint again once the problem is fixed.",
+
+		AlertResolvedTitle:   "Resolved: %s",
+		AlertResolvedMessage: "%s is resolved.",
+
+		OTPSubject:   "Your verification code",
+		OTPMessage:   "Your verification code is %s. It is valid for %d minutes.",
+		OTPExpiresIn: "%d minutes",
+
+		EmailVerificationSubject: "Verify your email address",
+		EmailVerificationText:    "Verify your address to receive notifications at it: %s",
+		EmailVerificationHTML:    "Verify your address to receive notifications at it.",
+		EmailVerificationButton:  "Verify my email address",
+
+		MentionTitle:    "%s mentioned you on %s",
+		AssignmentTitle: "%s assigned you %s",
+		MentionMessage:  "Open it to see the details.",
+	},
+}
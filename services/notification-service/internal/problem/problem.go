@@ -0,0 +1,155 @@
+// Package problem renders API errors as RFC 7807 problem details with stable,
+// machine-readable codes clients can branch on.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the code of a problem to form its type URI
+const typeBase = "https://claude-talimat.com/problems/"
+
+// Code is a stable error code. Codes are part of the API contract and must not
+// be renamed once published.
+type Code string
+
+// Error catalogue
+const (
+	CodeInvalidRequest       Code = "invalid_request"
+	CodeValidationFailed     Code = "validation_failed"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeConflict             Code = "conflict"
+	CodeIdempotencyKeyReused Code = "idempotency_key_reused"
+	CodeRequestInProgress    Code = "request_in_progress"
+	CodeRateLimited          Code = "rate_limited"
+	CodeProviderFailure      Code = "provider_failure"
+	CodeProviderUnavailable  Code = "provider_unavailable"
+	CodeInternal             Code = "internal_error"
+)
+
+type definition struct {
+	status int
+	title  string
+}
+
+var catalogue = map[Code]definition{
+	CodeInvalidRequest:       {http.StatusBadRequest, "Invalid request"},
+	CodeValidationFailed:     {http.StatusUnprocessableEntity, "Validation failed"},
+	CodeUnauthorized:         {http.StatusUnauthorized, "Unauthorized"},
+	CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	CodeNotFound:             {http.StatusNotFound, "Resource not found"},
+	CodeConflict:             {http.StatusConflict, "Conflict with current state"},
+	CodeIdempotencyKeyReused: {http.StatusUnprocessableEntity, "Idempotency key reused"},
+	CodeRequestInProgress:    {http.StatusConflict, "Request in progress"},
+	CodeRateLimited:          {http.StatusTooManyRequests, "Rate limit exceeded"},
+	CodeProviderFailure:      {http.StatusBadGateway, "Delivery provider failed"},
+	CodeProviderUnavailable:  {http.StatusServiceUnavailable, "Delivery provider unavailable"},
+	CodeInternal:             {http.StatusInternalServerError, "Internal server error"},
+}
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Status     int          `json:"status"`
+	Detail     string       `json:"detail,omitempty"`
+	Instance   string       `json:"instance,omitempty"`
+	Code       Code         `json:"code"`
+	Errors     []FieldError `json:"errors,omitempty"`
+	RetryAfter int          `json:"retry_after,omitempty"` // seconds, also sent as Retry-After
+}
+
+// FieldError describes an invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"` // validation rule the field failed
+	Message string `json:"message"`
+}
+
+// New creates a problem from the catalogue
+func New(code Code, detail string) *Problem {
+	def, ok := catalogue[code]
+	if !ok {
+		code = CodeInternal
+		def = catalogue[CodeInternal]
+	}
+
+	return &Problem{
+		Type:   typeBase + string(code),
+		Title:  def.title,
+		Status: def.status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WithErrors attaches field errors to a problem
+func (p *Problem) WithErrors(errors ...FieldError) *Problem {
+	p.Errors = append(p.Errors, errors...)
+	return p
+}
+
+// WithRetryAfter tells the client when to try again
+func (p *Problem) WithRetryAfter(seconds int) *Problem {
+	if seconds < 1 {
+		seconds = 1
+	}
+	p.RetryAfter = seconds
+	return p
+}
+
+// Error implements the error interface so problems can be passed around as errors
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// Write renders a problem as the response, in the locale of the request
+func Write(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+
+	locale := i18n.FromContext(c)
+	p.Title = i18n.Translate(locale, p.Title)
+	p.Detail = i18n.Translate(locale, p.Detail)
+	for i := range p.Errors {
+		p.Errors[i].Message = i18n.Translate(locale, p.Errors[i].Message)
+	}
+	c.Header("Content-Language", locale)
+	if p.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(p.RetryAfter))
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		c.Status(p.Status)
+		return
+	}
+
+	c.Data(p.Status, ContentType, body)
+}
+
+// Respond renders a problem from the catalogue as the response
+func Respond(c *gin.Context, code Code, detail string) {
+	Write(c, New(code, detail))
+}
+
+// Abort renders a problem from the catalogue and stops the handler chain
+func Abort(c *gin.Context, code Code, detail string) {
+	Write(c, New(code, detail))
+	c.Abort()
+}
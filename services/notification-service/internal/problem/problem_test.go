@@ -0,0 +1,85 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// render writes a problem as the response to a request with an
+// Accept-Language header
+func render(acceptLanguage string, write func(c *gin.Context)) (*httptest.ResponseRecorder, Problem) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/notifications/send", nil)
+	c.Request.Header.Set("Accept-Language", acceptLanguage)
+
+	write(c)
+
+	var p Problem
+	json.Unmarshal(recorder.Body.Bytes(), &p)
+	return recorder, p
+}
+
+func TestProblemsComeFromTheCatalogue(t *testing.T) {
+	p := New(CodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request")
+	if p.Status != http.StatusUnprocessableEntity || p.Type != typeBase+"idempotency_key_reused" || p.Title != "Idempotency key reused" {
+		t.Errorf("Expected the problem of the catalogue, got %+v", p)
+	}
+
+	// Codes outside the catalogue are never sent to clients
+	p = New(Code("made_up"), "detail")
+	if p.Code != CodeInternal || p.Status != http.StatusInternalServerError {
+		t.Errorf("Expected an unknown code to be an internal error, got %+v", p)
+	}
+}
+
+func TestProblemsAreWrittenInTheLocaleOfTheRequest(t *testing.T) {
+	recorder, p := render("tr-TR,tr;q=0.9", func(c *gin.Context) {
+		Respond(c, CodeInvalidRequest, "Idempotency-Key must not exceed 255 characters")
+	})
+
+	if recorder.Code != http.StatusBadRequest || recorder.Header().Get("Content-Type") != ContentType {
+		t.Errorf("Expected a %s response of status 400, got %d %s", ContentType, recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if recorder.Header().Get("Content-Language") != i18n.TR {
+		t.Errorf("Expected the response in Turkish, got %q", recorder.Header().Get("Content-Language"))
+	}
+	if p.Title != "Geçersiz istek" || p.Detail != "Idempotency-Key 255 karakteri aşmamalıdır" {
+		t.Errorf("Expected the title and detail in Turkish, got %q and %q", p.Title, p.Detail)
+	}
+	if p.Instance != "/api/v1/notifications/send" {
+		t.Errorf("Expected the path of the request as the instance, got %q", p.Instance)
+	}
+
+	// The locale set for the tenant wins over the one the client asks for
+	recorder, p = render("tr", func(c *gin.Context) {
+		i18n.SetLocale(c, i18n.EN)
+		Respond(c, CodeInvalidRequest, "Untranslated detail")
+	})
+	if recorder.Header().Get("Content-Language") != i18n.EN || p.Title != "Invalid request" || p.Detail != "Untranslated detail" {
+		t.Errorf("Expected the response in English, got %s %+v", recorder.Header().Get("Content-Language"), p)
+	}
+}
+
+func TestRateLimitedProblemsTellWhenToRetry(t *testing.T) {
+	recorder, p := render("", func(c *gin.Context) {
+		Write(c, New(CodeRateLimited, "").WithRetryAfter(0))
+	})
+
+	if recorder.Code != http.StatusTooManyRequests || p.RetryAfter != 1 {
+		t.Errorf("Expected a retry after at least a second, got %d %+v", recorder.Code, p)
+	}
+	if recorder.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected the Retry-After header, got %q", recorder.Header().Get("Retry-After"))
+	}
+}
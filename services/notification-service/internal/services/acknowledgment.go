@@ -0,0 +1,506 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// AckActionID is the in-app action that acknowledges a notification
+const AckActionID = "acknowledge"
+
+// ackCodeLength is the length of the code recipients reply with by SMS
+const ackCodeLength = 6
+
+// ackRecord is what an acknowledgment token stands for
+type ackRecord struct {
+	Token           string    `json:"token"`
+	RequestID       string    `json:"request_id"`
+	ParentRequestID string    `json:"parent_request_id,omitempty"` // request the delivery was fanned out from
+	DocumentID      string    `json:"document_id,omitempty"`
+	TenantID        string    `json:"tenant_id"`
+	Subject         string    `json:"subject"` // user ID, or the address when the user is unknown
+	Channel         string    `json:"channel"`
+	Recipient       string    `json:"recipient"`
+	IssuedAt        time.Time `json:"issued_at"`
+}
+
+// Acknowledgment is the proof that a recipient confirmed receipt of a notification
+type Acknowledgment struct {
+	DocumentID      string    `json:"document_id,omitempty"`
+	TenantID        string    `json:"tenant_id"`
+	Subject         string    `json:"subject"`
+	RequestID       string    `json:"request_id"`
+	ParentRequestID string    `json:"parent_request_id,omitempty"`
+	Channel         string    `json:"channel"` // channel the acknowledgment came through
+	AcknowledgedAt  time.Time `json:"acknowledged_at"`
+}
+
+// AcknowledgmentListener is called after a recipient confirmed receipt of a
+// notification for the first time
+type AcknowledgmentListener func(ack *Acknowledgment)
+
+// AcknowledgmentReport tells who confirmed receipt of a document and who did not
+type AcknowledgmentReport struct {
+	TenantID        string            `json:"tenant_id"`
+	DocumentID      string            `json:"document_id"`
+	Recipients      int               `json:"recipients"`
+	Acknowledged    int               `json:"acknowledged"`
+	Rate            float64           `json:"rate"`
+	Acknowledgments []*Acknowledgment `json:"acknowledgments"`
+	Pending         []string          `json:"pending"`
+}
+
+// OnAcknowledged registers a listener for acknowledgments
+func (s *NotificationService) OnAcknowledged(listener AcknowledgmentListener) {
+	s.ackListeners = append(s.ackListeners, listener)
+}
+
+// prepareAcknowledgment issues the acknowledgment token of a delivery and
+// embeds it into the message in the way its channel can carry it
+func (s *NotificationService) prepareAcknowledgment(request *NotificationRequest) error {
+	token := s.ackToken(request.ID)
+	code := strings.ToUpper(token[:ackCodeLength])
+	ackURL := strings.TrimRight(s.config.AckBaseURL, "/") + "/api/v1/ack/" + token
+
+	record := ackRecord{
+		Token:      token,
+		RequestID:  request.ID,
+		DocumentID: request.DocumentID,
+		TenantID:   request.TenantID,
+		Subject:    ackSubject(*request),
+		Channel:    request.Type,
+		Recipient:  request.Recipients[0],
+		IssuedAt:   time.Now(),
+	}
+	record.ParentRequestID, _ = request.Metadata["parent_request_id"].(string)
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal acknowledgment record: %w", err)
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getAckTokenKey(token), recordJSON, s.config.AckTTL)
+	if request.DocumentID != "" {
+		recipientsKey := s.getAckRecipientsKey(request.TenantID, request.DocumentID)
+		pipe.SAdd(ctx, recipientsKey, record.Subject)
+		pipe.Expire(ctx, recipientsKey, s.config.AckTTL)
+	}
+	if phone := phoneDigits(record.Recipient); phone != "" && (request.Type == "sms" || request.Type == "all") {
+		pipe.Set(ctx, s.getAckSMSCodeKey(phone, code), token, s.config.AckTTL)
+		pipe.ZAdd(ctx, s.getAckSMSPendingKey(phone), &redis.Z{
+			Score:  float64(record.IssuedAt.Unix()),
+			Member: token,
+		})
+		pipe.Expire(ctx, s.getAckSMSPendingKey(phone), s.config.AckTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store acknowledgment token: %w", err)
+	}
+
+	// Results carry the token so the acknowledgment can find them
+	request.Metadata = copyMetadata(request.Metadata)
+	request.Metadata["ack_token"] = token
+
+	templateData := make(map[string]interface{}, len(request.TemplateData)+2)
+	for k, v := range request.TemplateData {
+		templateData[k] = v
+	}
+	templateData["ack_token"] = token
+	templateData["ack_url"] = ackURL
+	templateData["ack_code"] = code
+	locale := s.ackLocale(record)
+	request.TemplateData = templateData
+
+	switch request.Type {
+	case "email", "all":
+		if request.HTMLBody != "" {
+			request.HTMLBody += fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(ackURL), html.EscapeString(i18n.T(locale, i18n.AckLink)))
+		}
+		if request.TextBody == "" && request.HTMLBody == "" {
+			request.TextBody = request.Message
+		}
+		if request.TextBody != "" {
+			request.TextBody += "\n\n" + i18n.T(locale, i18n.AckText, ackURL)
+		}
+	}
+
+	switch request.Type {
+	case "sms", "all":
+		request.Message += "\n" + i18n.T(locale, i18n.AckSMS, s.config.AckSMSKeyword, code)
+	case "voice":
+		if request.Message == "" {
+			request.Message = request.TextBody
+		}
+		request.Message += " " + i18n.T(locale, i18n.AckVoice, VoiceAckDigit)
+	case "inapp":
+		hasAction := false
+		for _, action := range request.Actions {
+			if action.ID == AckActionID {
+				hasAction = true
+				break
+			}
+		}
+		if !hasAction {
+			request.Actions = append(append([]NotificationAction(nil), request.Actions...), NotificationAction{
+				ID:    AckActionID,
+				Label: i18n.T(locale, i18n.AckLink),
+				Style: ActionStylePrimary,
+			})
+		}
+	}
+
+	return nil
+}
+
+// Acknowledge records that the recipient of a token confirmed receipt. Repeated
+// acknowledgments return the first one.
+func (s *NotificationService) Acknowledge(token string, channel string) (*Acknowledgment, error) {
+	ctx := context.Background()
+
+	record, err := s.getAckRecord(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := s.getAcknowledgment(token); err == nil {
+		return existing, nil
+	}
+
+	if channel == "" {
+		channel = record.Channel
+	}
+
+	ack := &Acknowledgment{
+		DocumentID:      record.DocumentID,
+		TenantID:        record.TenantID,
+		Subject:         record.Subject,
+		RequestID:       record.RequestID,
+		ParentRequestID: record.ParentRequestID,
+		Channel:         channel,
+		AcknowledgedAt:  time.Now(),
+	}
+
+	ackJSON, err := json.Marshal(ack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal acknowledgment: %w", err)
+	}
+
+	// Only the first of concurrent acknowledgments is recorded
+	first, err := s.redis.SetNX(ctx, s.getAckDoneKey(token), ackJSON, s.config.AckTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store acknowledgment: %w", err)
+	}
+	if !first {
+		return s.getAcknowledgment(token)
+	}
+
+	log.Info().
+		Str("requestID", record.RequestID).
+		Str("documentID", record.DocumentID).
+		Str("channel", channel).
+		Msg("Notification acknowledged")
+
+	pipe := s.redis.TxPipeline()
+	if record.DocumentID != "" {
+		// The first acknowledgment of a subject counts for the document, whichever channel it came through
+		acksKey := s.getAckDocumentKey(record.TenantID, record.DocumentID)
+		pipe.HSetNX(ctx, acksKey, record.Subject, ackJSON)
+		pipe.Expire(ctx, acksKey, s.config.AckTTL)
+	}
+	pipe.ZRem(ctx, s.getAckSMSPendingKey(phoneDigits(record.Recipient)), token)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("requestID", record.RequestID).Msg("Failed to index acknowledgment")
+	}
+
+	s.markResultsAcknowledged(token, ack.AcknowledgedAt)
+	s.publishAcknowledgment(ack)
+
+	for _, listener := range s.ackListeners {
+		listener(ack)
+	}
+
+	return ack, nil
+}
+
+// AcknowledgeSMSReply acknowledges the notification an SMS reply refers to. The
+// reply is the keyword optionally followed by the code of the message; without
+// a code the latest unacknowledged message sent to the number is acknowledged.
+func (s *NotificationService) AcknowledgeSMSReply(from string, body string) (*Acknowledgment, error) {
+	words := strings.Fields(strings.ToUpperSpecial(unicode.TurkishCase, body))
+	keyword := strings.ToUpperSpecial(unicode.TurkishCase, s.config.AckSMSKeyword)
+	if len(words) == 0 || words[0] != keyword {
+		return nil, invalid(fmt.Errorf("reply is not an acknowledgment"))
+	}
+
+	return s.acknowledgeSMSReply(phoneDigits(from), words[1:])
+}
+
+// acknowledgeSMSReply acknowledges the message the code of a reply refers to,
+// or the latest unacknowledged message sent to the number without a code
+func (s *NotificationService) acknowledgeSMSReply(phone string, args []string) (*Acknowledgment, error) {
+	ctx := context.Background()
+
+	var token string
+	if len(args) > 0 {
+		stored, err := s.redis.Get(ctx, s.getAckSMSCodeKey(phone, args[0])).Result()
+		if err == redis.Nil {
+			return nil, notFoundf("acknowledgment code not found: %s", args[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get acknowledgment code: %w", err)
+		}
+		token = stored
+	} else {
+		latest, err := s.redis.ZRevRange(ctx, s.getAckSMSPendingKey(phone), 0, 0).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pending acknowledgments: %w", err)
+		}
+		if len(latest) == 0 {
+			return nil, notFoundf("no pending acknowledgment for sender")
+		}
+		token = latest[0]
+	}
+
+	return s.Acknowledge(token, "sms")
+}
+
+// GetAcknowledgmentStatus returns the acknowledgment of a token, nil while the
+// recipient has not acknowledged yet
+func (s *NotificationService) GetAcknowledgmentStatus(token string) (*Acknowledgment, error) {
+	if _, err := s.getAckRecord(token); err != nil {
+		return nil, err
+	}
+
+	ack, err := s.getAcknowledgment(token)
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return ack, err
+}
+
+// GetAcknowledgmentReport returns who acknowledged a document and who has not yet
+func (s *NotificationService) GetAcknowledgmentReport(tenantID string, documentID string) (*AcknowledgmentReport, error) {
+	ctx := context.Background()
+
+	recipients, err := s.redis.SMembers(ctx, s.getAckRecipientsKey(tenantID, documentID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document recipients: %w", err)
+	}
+	if len(recipients) == 0 {
+		return nil, notFoundf("document not found: %s", documentID)
+	}
+
+	acks, err := s.redis.HGetAll(ctx, s.getAckDocumentKey(tenantID, documentID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document acknowledgments: %w", err)
+	}
+
+	report := &AcknowledgmentReport{
+		TenantID:        tenantID,
+		DocumentID:      documentID,
+		Recipients:      len(recipients),
+		Acknowledgments: []*Acknowledgment{},
+		Pending:         []string{},
+	}
+
+	for _, subject := range recipients {
+		ackJSON, ok := acks[subject]
+		if !ok {
+			report.Pending = append(report.Pending, subject)
+			continue
+		}
+
+		var ack Acknowledgment
+		if err := json.Unmarshal([]byte(ackJSON), &ack); err != nil {
+			report.Pending = append(report.Pending, subject)
+			continue
+		}
+		report.Acknowledgments = append(report.Acknowledgments, &ack)
+	}
+
+	sort.Strings(report.Pending)
+	sort.Slice(report.Acknowledgments, func(i, j int) bool {
+		return report.Acknowledgments[i].AcknowledgedAt.Before(report.Acknowledgments[j].AcknowledgedAt)
+	})
+
+	report.Acknowledged = len(report.Acknowledgments)
+	report.Rate = float64(report.Acknowledged) / float64(report.Recipients)
+
+	return report, nil
+}
+
+// acknowledgeAction acknowledges in-app notifications answered with the acknowledge action
+func (s *NotificationService) acknowledgeAction(notification *InAppNotification, action NotificationAction) {
+	if action.ID != AckActionID {
+		return
+	}
+
+	token, ok := notification.Data["ack_token"].(string)
+	if !ok || token == "" {
+		return
+	}
+
+	if _, err := s.Acknowledge(token, "inapp"); err != nil {
+		log.Warn().Err(err).Str("notificationID", notification.ID).Msg("Failed to acknowledge notification")
+	}
+}
+
+// markResultsAcknowledged stamps the delivery results of a token
+func (s *NotificationService) markResultsAcknowledged(token string, at time.Time) {
+	ctx := context.Background()
+
+	resultIDs, err := s.redis.SMembers(ctx, s.getAckResultsKey(token)).Result()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get acknowledged results")
+		return
+	}
+
+	for _, resultID := range resultIDs {
+		result, err := s.GetNotificationStatus(ctx, resultID)
+		if err != nil {
+			continue
+		}
+		result.AcknowledgedAt = &at
+		if err := s.storeResult(*result); err != nil {
+			log.Warn().Err(err).Str("resultID", resultID).Msg("Failed to mark result acknowledged")
+		}
+	}
+}
+
+// publishAcknowledgment tells subscribers that a recipient confirmed receipt
+func (s *NotificationService) publishAcknowledgment(ack *Acknowledgment) {
+	event := WebhookEvent{
+		ID:       generateWebhookID(),
+		Type:     "notification.acknowledged",
+		Source:   "notification-service",
+		UserID:   ack.Subject,
+		TenantID: ack.TenantID,
+		Data: map[string]interface{}{
+			"document_id":     ack.DocumentID,
+			"request_id":      ack.RequestID,
+			"channel":         ack.Channel,
+			"acknowledged_at": ack.AcknowledgedAt,
+		},
+		Timestamp: ack.AcknowledgedAt,
+		Priority:  "normal",
+		CreatedAt: ack.AcknowledgedAt,
+	}
+	s.emitEvent(event)
+}
+
+// getAckRecord loads what a token stands for
+func (s *NotificationService) getAckRecord(token string) (*ackRecord, error) {
+	recordJSON, err := s.redis.Get(context.Background(), s.getAckTokenKey(token)).Result()
+	if err == redis.Nil {
+		return nil, notFoundf("acknowledgment token not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get acknowledgment token: %w", err)
+	}
+
+	var record ackRecord
+	if err := json.Unmarshal([]byte(recordJSON), &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal acknowledgment token: %w", err)
+	}
+
+	return &record, nil
+}
+
+// ackLocale returns the locale of the recipient of a token, the locale of the
+// user when the recipient is a known one
+func (s *NotificationService) ackLocale(record ackRecord) string {
+	recipient := record.Recipient
+	if record.Subject != record.Recipient {
+		recipient = RecipientPrefixUser + record.Subject
+	}
+	return s.messageLocale(record.TenantID, recipient)
+}
+
+// getAcknowledgment loads the acknowledgment of a token
+func (s *NotificationService) getAcknowledgment(token string) (*Acknowledgment, error) {
+	ackJSON, err := s.redis.Get(context.Background(), s.getAckDoneKey(token)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var ack Acknowledgment
+	if err := json.Unmarshal([]byte(ackJSON), &ack); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal acknowledgment: %w", err)
+	}
+
+	return &ack, nil
+}
+
+// ackToken derives the token of a delivery, so retries keep embedding the same one
+func (s *NotificationService) ackToken(requestID string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.AckSecret))
+	mac.Write([]byte(requestID))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// Redis key generators
+func (s *NotificationService) getAckTokenKey(token string) string {
+	return fmt.Sprintf("ack_token:%s", token)
+}
+
+func (s *NotificationService) getAckDoneKey(token string) string {
+	return fmt.Sprintf("ack_done:%s", token)
+}
+
+func (s *NotificationService) getAckResultsKey(token string) string {
+	return fmt.Sprintf("ack_results:%s", token)
+}
+
+func (s *NotificationService) getAckRecipientsKey(tenantID string, documentID string) string {
+	return fmt.Sprintf("ack_document_recipients:%s:%s", tenantID, documentID)
+}
+
+func (s *NotificationService) getAckDocumentKey(tenantID string, documentID string) string {
+	return fmt.Sprintf("ack_document:%s:%s", tenantID, documentID)
+}
+
+func (s *NotificationService) getAckSMSCodeKey(phone string, code string) string {
+	return fmt.Sprintf("ack_sms:%s:%s", phone, code)
+}
+
+func (s *NotificationService) getAckSMSPendingKey(phone string) string {
+	return fmt.Sprintf("ack_sms_pending:%s", phone)
+}
+
+// Helper functions
+func ackSubject(request NotificationRequest) string {
+	if userID, ok := request.Metadata["recipient_user_id"].(string); ok && userID != "" {
+		return userID
+	}
+	if request.UserID != "" && request.Type == "inapp" {
+		return request.UserID
+	}
+	return request.Recipients[0]
+}
+
+// phoneDigits keeps only the digits of a phone number so replies match
+// whichever format the provider reports the sender in
+func phoneDigits(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Action styles
+const (
+	ActionStylePrimary     = "primary"
+	ActionStyleSecondary   = "secondary"
+	ActionStyleDestructive = "destructive"
+)
+
+// maxNotificationActions bounds the buttons a notification can show
+const maxNotificationActions = 5
+
+// NotificationAction is a response a user can give to a notification, such as
+// confirming they read a safety instruction
+type NotificationAction struct {
+	ID          string `json:"id"`
+	Label       string `json:"label"`
+	URL         string `json:"url,omitempty"`          // web URL or deep link the client opens
+	CallbackURL string `json:"callback_url,omitempty"` // receives the response as a signed event
+	Style       string `json:"style,omitempty"`        // primary, secondary, destructive
+}
+
+// ActionResponse records the action a user took on a notification
+type ActionResponse struct {
+	ActionID    string    `json:"action_id"`
+	Label       string    `json:"label"`
+	RespondedAt time.Time `json:"responded_at"`
+}
+
+// ActionStats reports how many actionable notifications were answered
+type ActionStats struct {
+	TenantID     string         `json:"tenant_id"`
+	Category     string         `json:"category,omitempty"`
+	Delivered    int64          `json:"delivered"`
+	Responded    int64          `json:"responded"`
+	ResponseRate float64        `json:"response_rate"`
+	ByAction     map[string]int `json:"by_action"`
+}
+
+// ActionListener is called after a user responded to an actionable notification
+type ActionListener func(notification *InAppNotification, action NotificationAction)
+
+// OnAction registers a listener for action responses
+func (s *InAppNotificationService) OnAction(listener ActionListener) {
+	s.actionListeners = append(s.actionListeners, listener)
+}
+
+// RespondToAction records the action a user took on a notification. Each
+// notification takes a single response, which also marks it as read.
+func (s *InAppNotificationService) RespondToAction(ctx context.Context, notificationID string, userID string, actionID string) (*InAppNotification, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	log.Info().
+		Str("notificationID", notificationID).
+		Str("userID", userID).
+		Str("actionID", actionID).
+		Msg("Recording notification action")
+
+	notification, err := s.GetNotification(ctx, notificationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	// Check if user owns this notification
+	if notification.UserID != userID {
+		return nil, notFoundf("notification not found: %s", notificationID)
+	}
+
+	var action *NotificationAction
+	for i := range notification.Actions {
+		if notification.Actions[i].ID == actionID {
+			action = &notification.Actions[i]
+			break
+		}
+	}
+	if action == nil {
+		return nil, notFoundf("action not found: %s", actionID)
+	}
+	if notification.Response != nil {
+		return nil, conflictf("notification already answered with action: %s", notification.Response.ActionID)
+	}
+
+	now := time.Now()
+	notification.Response = &ActionResponse{
+		ActionID:    action.ID,
+		Label:       action.Label,
+		RespondedAt: now,
+	}
+	wasUnread := !notification.Read
+	if wasUnread {
+		notification.Read = true
+		notification.ReadAt = &now
+	}
+
+	notificationJSON, err := s.pii.marshalInApp(*notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	// Only the first of concurrent responses is recorded
+	first, err := s.redis.SetNX(ctx, s.getActionResponseKey(notificationID), action.ID, s.config.TTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to record action response: %w", err)
+	}
+	if !first {
+		return nil, conflictf("notification already answered: %s", notificationID)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getNotificationKey(notificationID), notificationJSON, s.config.TTL)
+	removed := pipe.SRem(ctx, s.getUnreadKey(userID, notification.TenantID), notificationID)
+	for _, statsKey := range s.getActionStatsKeys(notification.TenantID, notification.Category) {
+		pipe.HIncrBy(ctx, statsKey, "responded", 1)
+		pipe.HIncrBy(ctx, statsKey, "action:"+action.ID, 1)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store action response: %w", err)
+	}
+	s.publishUnreadDelta(ctx, userID, notification.TenantID, UnreadReasonRead, -removed.Val(), notificationID)
+
+	if wasUnread {
+		for _, listener := range s.readListeners {
+			listener(notification)
+		}
+	}
+	for _, listener := range s.actionListeners {
+		listener(notification, *action)
+	}
+
+	return notification, nil
+}
+
+// GetActionStats returns the response rate of the actionable notifications of
+// a tenant, optionally limited to a category
+func (s *InAppNotificationService) GetActionStats(ctx context.Context, tenantID string, category string) (*ActionStats, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	values, err := s.redis.HGetAll(ctx, s.getActionStatsKey(tenantID, category)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get action stats: %w", err)
+	}
+
+	stats := &ActionStats{
+		TenantID: tenantID,
+		Category: category,
+		ByAction: make(map[string]int),
+	}
+	stats.Delivered, _ = strconv.ParseInt(values["delivered"], 10, 64)
+	stats.Responded, _ = strconv.ParseInt(values["responded"], 10, 64)
+
+	for field, value := range values {
+		if actionID := strings.TrimPrefix(field, "action:"); actionID != field {
+			stats.ByAction[actionID], _ = strconv.Atoi(value)
+		}
+	}
+
+	if stats.Delivered > 0 {
+		stats.ResponseRate = float64(stats.Responded) / float64(stats.Delivered)
+	}
+
+	return stats, nil
+}
+
+// recordActionDelivery queues the commands counting an actionable
+// notification towards the response rates
+func (s *InAppNotificationService) recordActionDelivery(ctx context.Context, pipe redis.Pipeliner, notification *InAppNotification) {
+	if len(notification.Actions) == 0 {
+		return
+	}
+
+	for _, statsKey := range s.getActionStatsKeys(notification.TenantID, notification.Category) {
+		pipe.HIncrBy(ctx, statsKey, "delivered", 1)
+	}
+}
+
+// publishActionResponse tells subscribers that a user responded to a notification
+func (s *NotificationService) publishActionResponse(notification *InAppNotification, action NotificationAction) {
+	now := time.Now()
+
+	if action.CallbackURL != "" {
+		callback := statusCallback{
+			URL: action.CallbackURL,
+			Event: StatusEvent{
+				ID:             newID("evt"),
+				Event:          "notification.action",
+				NotificationID: notification.ID,
+				Type:           "inapp",
+				Recipient:      notification.UserID,
+				Status:         "responded",
+				Metadata: map[string]interface{}{
+					"action_id":    action.ID,
+					"action_label": action.Label,
+					"tenant_id":    notification.TenantID,
+				},
+				Timestamp: now,
+			},
+		}
+		if err := s.queueStatusCallback(callback, now); err != nil {
+			log.Error().Err(err).Str("notificationID", notification.ID).Msg("Failed to queue action callback")
+		}
+	}
+
+	event := WebhookEvent{
+		ID:       generateWebhookID(),
+		Type:     "notification.action",
+		Source:   "notification-service",
+		UserID:   notification.UserID,
+		TenantID: notification.TenantID,
+		Data: map[string]interface{}{
+			"notification_id": notification.ID,
+			"category":        notification.Category,
+			"action_id":       action.ID,
+			"action_label":    action.Label,
+			"responded_at":    now,
+		},
+		Timestamp: now,
+		Priority:  notification.Priority,
+		CreatedAt: now,
+	}
+	s.emitEvent(event)
+}
+
+// validateActions checks the actions of a notification
+func validateActions(actions []NotificationAction) error {
+	if len(actions) > maxNotificationActions {
+		return fmt.Errorf("at most %d actions are allowed", maxNotificationActions)
+	}
+
+	seen := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		if action.ID == "" || action.Label == "" {
+			return fmt.Errorf("action ID and label are required")
+		}
+		if seen[action.ID] {
+			return fmt.Errorf("duplicate action ID: %s", action.ID)
+		}
+		seen[action.ID] = true
+
+		switch action.Style {
+		case "", ActionStylePrimary, ActionStyleSecondary, ActionStyleDestructive:
+		default:
+			return fmt.Errorf("invalid action style: %s", action.Style)
+		}
+
+		if action.CallbackURL != "" {
+			if err := validateCallbackURL(action.CallbackURL); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *InAppNotificationService) getActionResponseKey(notificationID string) string {
+	return fmt.Sprintf("action_response:%s", notificationID)
+}
+
+func (s *InAppNotificationService) getActionStatsKey(tenantID string, category string) string {
+	if category == "" {
+		return fmt.Sprintf("action_stats:%s", tenantID)
+	}
+	return fmt.Sprintf("action_stats:%s:%s", tenantID, category)
+}
+
+// getActionStatsKeys returns the stats keys a notification counts towards
+func (s *InAppNotificationService) getActionStatsKeys(tenantID string, category string) []string {
+	keys := []string{s.getActionStatsKey(tenantID, "")}
+	if category != "" {
+		keys = append(keys, s.getActionStatsKey(tenantID, category))
+	}
+	return keys
+}
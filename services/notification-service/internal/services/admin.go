@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Classes failed deliveries are grouped by on the operations dashboard
+const (
+	FailureClassValidation = "validation" // the request can't be sent as it is
+	FailureClassTimeout    = "timeout"    // the provider did not answer in time
+	FailureClassProvider   = "provider"   // the provider rejected or failed the send
+	FailureClassInternal   = "internal"   // anything else
+)
+
+// recentFailuresLimit is how many failed attempts the dashboard keeps
+const recentFailuresLimit = 500
+
+// QueueBacklog represents the entries waiting in one of the queues
+type QueueBacklog struct {
+	Queue     string     `json:"queue"`
+	Due       int64      `json:"due"`       // ready to be processed
+	Scheduled int64      `json:"scheduled"` // waiting for a later time
+	OldestDue *time.Time `json:"oldest_due,omitempty"`
+}
+
+// ChannelRate represents how the deliveries of a channel fared over a period
+type ChannelRate struct {
+	Channel      string  `json:"channel"`
+	Total        int     `json:"total"`
+	Sent         int     `json:"sent"`
+	Failed       int     `json:"failed"`
+	Pending      int     `json:"pending"`
+	Suppressed   int     `json:"suppressed"`
+	DeliveryRate float64 `json:"delivery_rate"` // percentage of deliveries sent
+}
+
+// FailureRecord represents a failed delivery attempt
+type FailureRecord struct {
+	ResultID string    `json:"result_id"`
+	TenantID string    `json:"tenant_id,omitempty"`
+	Type     string    `json:"type"`
+	Class    string    `json:"class"`
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// FailureSummary represents the recent failed delivery attempts
+type FailureSummary struct {
+	ByClass  map[string]int  `json:"by_class"`
+	Failures []FailureRecord `json:"failures"`
+}
+
+// ChannelWorkerStatus represents the workers and the sends in flight of a channel
+type ChannelWorkerStatus struct {
+	Channel     string `json:"channel"`
+	Target      int    `json:"target"` // worker count the configuration asks for
+	Started     int    `json:"started"`
+	MaxInFlight int    `json:"max_in_flight"`
+}
+
+// WorkerStatus represents the queue workers of this instance
+type WorkerStatus struct {
+	Configured     int         `json:"configured"` // worker count the service was started with
+	Target         int         `json:"target"`     // worker count the runtime configuration asks for
+	Started        int         `json:"started"`
+	InFlight       int         `json:"in_flight"`
+	BatchSize      int         `json:"batch_size"`
+	PausedChannels []string    `json:"paused_channels"`
+	Leader         bool        `json:"leader"` // runs the jobs only one instance may run
+	Pools          []PoolStats `json:"pools"`  // the pools bounding concurrent sends
+	// Channels have queues and workers of their own, the ones above work
+	// the queue shared by notifications sent on every channel
+	Channels []ChannelWorkerStatus `json:"channels"`
+}
+
+// TenantUsage represents the deliveries of a tenant over a period
+type TenantUsage struct {
+	TenantID   string         `json:"tenant_id"`
+	Total      int            `json:"total"`
+	Sent       int            `json:"sent"`
+	Failed     int            `json:"failed"`
+	Suppressed int            `json:"suppressed"`
+	ByType     map[string]int `json:"by_type"`
+}
+
+// QueueBacklogs returns the backlog of the delivery, callback and digest queues
+func (s *NotificationService) QueueBacklogs() ([]QueueBacklog, error) {
+	ctx := context.Background()
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	queues := []struct {
+		name string
+		key  string
+	}{
+		{"notifications", s.getQueueKey()},
+		{"callbacks", s.getCallbackQueueKey()},
+		{"digests", s.getDigestDueKey()},
+	}
+	for _, channel := range queueChannels {
+		queues = append(queues, struct {
+			name string
+			key  string
+		}{"notifications:" + channel, s.getChannelQueueKey(channel)})
+	}
+
+	pipe := s.redis.Pipeline()
+	due := make([]*redis.IntCmd, len(queues))
+	scheduled := make([]*redis.IntCmd, len(queues))
+	oldest := make([]*redis.ZSliceCmd, len(queues))
+	for i, queue := range queues {
+		due[i] = pipe.ZCount(ctx, queue.key, "-inf", now)
+		scheduled[i] = pipe.ZCount(ctx, queue.key, "("+now, "+inf")
+		oldest[i] = pipe.ZRangeWithScores(ctx, queue.key, 0, 0)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get queue backlogs: %w", err)
+	}
+
+	backlogs := make([]QueueBacklog, len(queues))
+	for i, queue := range queues {
+		backlogs[i] = QueueBacklog{
+			Queue:     queue.name,
+			Due:       due[i].Val(),
+			Scheduled: scheduled[i].Val(),
+		}
+		if entries := oldest[i].Val(); len(entries) > 0 && backlogs[i].Due > 0 {
+			at := time.Unix(int64(entries[0].Score), 0)
+			backlogs[i].OldestDue = &at
+		}
+	}
+
+	return backlogs, nil
+}
+
+// ChannelRates returns the delivery rates of every channel used over the
+// last days, across tenants
+func (s *NotificationService) ChannelRates(days int) ([]ChannelRate, error) {
+	if days < 1 {
+		days = 1
+	}
+
+	rollups, err := s.tenantRollups(days)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]*ChannelRate)
+	for _, tenantRollups := range rollups {
+		for _, rollup := range tenantRollups {
+			for field, value := range rollup {
+				if !strings.HasPrefix(field, statsFieldChannel) {
+					continue
+				}
+				channel, status, ok := strings.Cut(strings.TrimPrefix(field, statsFieldChannel), ":")
+				if !ok {
+					continue
+				}
+				count, _ := strconv.Atoi(value)
+
+				rate, ok := rates[channel]
+				if !ok {
+					rate = &ChannelRate{Channel: channel}
+					rates[channel] = rate
+				}
+				rate.Total += count
+				switch {
+				case isSuccessStatus(status):
+					rate.Sent += count
+				case status == "failed":
+					rate.Failed += count
+				case status == "pending":
+					rate.Pending += count
+				case status == "suppressed":
+					rate.Suppressed += count
+				}
+			}
+		}
+	}
+
+	result := make([]ChannelRate, 0, len(rates))
+	for _, rate := range rates {
+		if rate.Total > 0 {
+			rate.DeliveryRate = float64(rate.Sent) / float64(rate.Total) * 100
+		}
+		result = append(result, *rate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Channel < result[j].Channel
+	})
+
+	return result, nil
+}
+
+// RecentFailures returns the latest failed delivery attempts, newest first,
+// optionally limited to a class
+func (s *NotificationService) RecentFailures(class string, limit int) (*FailureSummary, error) {
+	if limit < 1 || limit > recentFailuresLimit {
+		limit = recentFailuresLimit
+	}
+
+	ctx := context.Background()
+	entries, err := s.redis.LRange(ctx, s.getRecentFailuresKey(), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent failures: %w", err)
+	}
+
+	summary := &FailureSummary{
+		ByClass:  make(map[string]int),
+		Failures: []FailureRecord{},
+	}
+	for _, entry := range entries {
+		var failure FailureRecord
+		if err := json.Unmarshal([]byte(entry), &failure); err != nil {
+			continue
+		}
+		summary.ByClass[failure.Class]++
+
+		if (class != "" && failure.Class != class) || len(summary.Failures) >= limit {
+			continue
+		}
+		if failure.Error, err = s.pii.open(failure.TenantID, failure.Error); err != nil {
+			failure.Error = ""
+		}
+		summary.Failures = append(summary.Failures, failure)
+	}
+
+	return summary, nil
+}
+
+// WorkerStatus returns the state of the queue workers of this instance
+func (s *NotificationService) WorkerStatus() WorkerStatus {
+	s.workersMu.Lock()
+	started := make(map[string]int, len(s.workers))
+	for channel, count := range s.workers {
+		started[channel] = count
+	}
+	s.workersMu.Unlock()
+
+	s.inFlightMu.Lock()
+	inFlight := len(s.inFlight)
+	s.inFlightMu.Unlock()
+
+	paused := []string{}
+	for channel := range maintenanceChannels {
+		if s.channelPaused(channel) {
+			paused = append(paused, channel)
+		}
+	}
+	sort.Strings(paused)
+
+	pools := []PoolStats{
+		s.emailService.bulk.Stats(),
+		s.webhookService.DeliveryStats(),
+	}
+	channels := make([]ChannelWorkerStatus, 0, len(queueChannels))
+	for _, channel := range queueChannels {
+		pool := s.channelPool(channel)
+		pools = append(pools, pool.Stats())
+		channels = append(channels, ChannelWorkerStatus{
+			Channel:     channel,
+			Target:      s.channelWorkerCount(channel),
+			Started:     started[channel],
+			MaxInFlight: s.channelMaxInFlight(channel),
+		})
+	}
+
+	return WorkerStatus{
+		Configured:     s.config.WorkerCount,
+		Target:         s.workerCount(),
+		Started:        started[""],
+		InFlight:       inFlight,
+		BatchSize:      s.batchSize(),
+		PausedChannels: paused,
+		Leader:         s.IsLeader(),
+		Pools:          pools,
+		Channels:       channels,
+	}
+}
+
+// TenantUsage returns the deliveries of every tenant over the last days,
+// busiest tenants first
+func (s *NotificationService) TenantUsage(days int) ([]TenantUsage, error) {
+	if days < 1 {
+		days = 1
+	}
+
+	rollups, err := s.tenantRollups(days)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]TenantUsage, 0, len(rollups))
+	for tenantID, tenantRollups := range rollups {
+		tenant := TenantUsage{
+			TenantID: tenantID,
+			ByType:   make(map[string]int),
+		}
+		for _, rollup := range tenantRollups {
+			for field, value := range rollup {
+				count, _ := strconv.Atoi(value)
+
+				switch {
+				case field == statsFieldTotal:
+					tenant.Total += count
+				case strings.HasPrefix(field, statsFieldType):
+					tenant.ByType[strings.TrimPrefix(field, statsFieldType)] += count
+				case strings.HasPrefix(field, statsFieldStatus):
+					switch status := strings.TrimPrefix(field, statsFieldStatus); {
+					case isSuccessStatus(status):
+						tenant.Sent += count
+					case status == "failed":
+						tenant.Failed += count
+					case status == "suppressed":
+						tenant.Suppressed += count
+					}
+				}
+			}
+		}
+		usage = append(usage, tenant)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Total != usage[j].Total {
+			return usage[i].Total > usage[j].Total
+		}
+		return usage[i].TenantID < usage[j].TenantID
+	})
+
+	return usage, nil
+}
+
+// tenantRollups reads the daily rollups of the last days of every tenant
+// that has deliveries, by tenant
+func (s *NotificationService) tenantRollups(days int) (map[string][]map[string]string, error) {
+	ctx := context.Background()
+
+	tenants, err := s.redis.SMembers(ctx, s.getRetentionTenantsKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenants: %w", err)
+	}
+
+	now := time.Now().UTC()
+	pipe := s.redis.Pipeline()
+	cmds := make(map[string][]*redis.StringStringMapCmd, len(tenants))
+	for _, tenantID := range tenants {
+		for i := 0; i < days; i++ {
+			cmds[tenantID] = append(cmds[tenantID], pipe.HGetAll(ctx, s.getStatsRollupKey(tenantID, now.AddDate(0, 0, -i))))
+		}
+	}
+	if len(tenants) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get statistics rollups: %w", err)
+		}
+	}
+
+	rollups := make(map[string][]map[string]string, len(tenants))
+	for tenantID, tenantCmds := range cmds {
+		for _, cmd := range tenantCmds {
+			rollups[tenantID] = append(rollups[tenantID], cmd.Val())
+		}
+	}
+
+	return rollups, nil
+}
+
+// recordFailure adds a failed attempt to the recent failures. Retries
+// scheduled for a failure store it again with the same attempt count, those
+// aren't counted twice.
+func (s *NotificationService) recordFailure(previous *NotificationResult, result NotificationResult) {
+	if result.Status != "failed" {
+		return
+	}
+	if previous != nil && previous.Status == "failed" && previous.Attempts == result.Attempts {
+		return
+	}
+
+	class := result.ErrorClass
+	if class == "" {
+		class = FailureClassInternal
+	}
+
+	// The error may quote the recipient
+	message, err := s.pii.seal(result.TenantID, result.Error)
+	if err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to encrypt failure")
+		return
+	}
+
+	entry, err := json.Marshal(FailureRecord{
+		ResultID: result.ID,
+		TenantID: result.TenantID,
+		Type:     result.Type,
+		Class:    class,
+		Error:    message,
+		Attempts: result.Attempts,
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.LPush(ctx, s.getRecentFailuresKey(), entry)
+	pipe.LTrim(ctx, s.getRecentFailuresKey(), 0, recentFailuresLimit-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to record failure")
+	}
+}
+
+// Redis key generators
+func (s *NotificationService) getRecentFailuresKey() string {
+	return "notification_recent_failures"
+}
+
+// Helper functions
+func classifyFailure(err error) string {
+	var providerErr *ProviderError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrValidation):
+		return FailureClassValidation
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FailureClassTimeout
+	case errors.As(err, &providerErr):
+		return FailureClassProvider
+	default:
+		return FailureClassInternal
+	}
+}
+
+// IsFailureClass reports whether class is one of the failure classes
+func IsFailureClass(class string) bool {
+	switch class {
+	case FailureClassValidation, FailureClassTimeout, FailureClassProvider, FailureClassInternal:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ArchivedNotification is a notification result moved out of hot storage
+// together with the request that produced it
+type ArchivedNotification struct {
+	Result     NotificationResult   `json:"result"`
+	Request    *NotificationRequest `json:"request,omitempty"`
+	ArchivedAt time.Time            `json:"archived_at"`
+}
+
+// Archiver stores notifications removed from hot storage by the retention job.
+// Archive must only return nil once the batch is durably stored.
+type Archiver interface {
+	Archive(tenantID string, notifications []ArchivedNotification) error
+}
+
+// S3Archiver writes archived notifications to an S3 compatible bucket as
+// gzipped JSON lines, one object per batch
+type S3Archiver struct {
+	config S3ArchiverConfig
+	client *http.Client
+}
+
+// S3ArchiverConfig holds S3 archive configuration
+type S3ArchiverConfig struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or a MinIO URL
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Timeout   time.Duration
+}
+
+// NewS3Archiver creates a new S3 archiver
+func NewS3Archiver(config S3ArchiverConfig) (*S3Archiver, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("S3 endpoint and bucket are required")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3 credentials are required")
+	}
+
+	// Set default values
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Prefix == "" {
+		config.Prefix = "notifications"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 60 * time.Second
+	}
+
+	return &S3Archiver{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Archive uploads a batch of notifications as a single object
+func (a *S3Archiver) Archive(tenantID string, notifications []ArchivedNotification) error {
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	encoder := json.NewEncoder(writer)
+	for _, notification := range notifications {
+		if err := encoder.Encode(notification); err != nil {
+			return fmt.Errorf("failed to encode archived notification: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress archive batch: %w", err)
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s/%s/%s/batch_%d.jsonl.gz",
+		a.config.Prefix, retentionTenant(tenantID), now.Format("2006/01/02"), now.UnixNano())
+
+	endpoint, err := url.Parse(a.config.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	// Path-style addressing works with AWS and S3 compatible stores alike
+	endpoint.Path = "/" + a.config.Bucket + "/" + key
+
+	req, err := http.NewRequest(http.MethodPut, endpoint.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	a.sign(req, body.Bytes(), now)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("S3 upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("S3 upload returned status %d: %s", resp.StatusCode, string(message))
+	}
+
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to a request
+func (a *S3Archiver) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+a.config.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, a.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.config.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// PostgresArchiver writes archived notifications to a Postgres table. The
+// caller opens the database, so the driver is chosen where the service is wired.
+type PostgresArchiver struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgresArchiver creates a new Postgres archiver and makes sure its table exists
+func NewPostgresArchiver(db *sql.DB, table string) (*PostgresArchiver, error) {
+	if table == "" {
+		table = "notification_archive"
+	}
+
+	archiver := &PostgresArchiver{
+		db:    db,
+		table: table,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id          TEXT PRIMARY KEY,
+		tenant_id   TEXT NOT NULL,
+		request_id  TEXT NOT NULL,
+		type        TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL,
+		archived_at TIMESTAMPTZ NOT NULL,
+		data        JSONB NOT NULL
+	)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive table: %w", err)
+	}
+
+	return archiver, nil
+}
+
+// Archive inserts a batch of notifications in a single transaction
+func (a *PostgresArchiver) Archive(tenantID string, notifications []ArchivedNotification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin archive transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Re-archiving a batch after a partial failure must not fail on duplicates
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`INSERT INTO %s
+		(id, tenant_id, request_id, type, status, created_at, archived_at, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO NOTHING`, a.table))
+	if err != nil {
+		return fmt.Errorf("failed to prepare archive statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, notification := range notifications {
+		data, err := json.Marshal(notification)
+		if err != nil {
+			return fmt.Errorf("failed to marshal archived notification: %w", err)
+		}
+
+		result := notification.Result
+		if _, err := stmt.ExecContext(ctx,
+			result.ID,
+			tenantID,
+			result.RequestID,
+			result.Type,
+			result.Status,
+			result.CreatedAt,
+			notification.ArchivedAt,
+			string(data),
+		); err != nil {
+			return fmt.Errorf("failed to archive notification %s: %w", result.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit archive batch: %w", err)
+	}
+
+	return nil
+}
+
+// Helper functions
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
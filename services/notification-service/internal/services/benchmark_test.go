@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+)
+
+// The benchmarks run the pipelines against miniredis unless
+// BENCHMARK_REDIS_URL points at a real Redis, which `make loadtest` does.
+// That database is flushed, so it must not hold anything else.
+
+// benchmarkBacklog is how many notifications are queued ahead of the ones
+// a benchmark processes
+const benchmarkBacklog = 10000
+
+// newBenchmarkEnv returns the integration environment with logging quieted,
+// so the benchmarks measure the pipeline and not the log output
+func newBenchmarkEnv(b *testing.B) *integrationEnv {
+	b.Helper()
+
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(level) })
+
+	redisURL := os.Getenv("BENCHMARK_REDIS_URL")
+	if redisURL == "" {
+		return newIntegrationEnv(b)
+	}
+
+	// Flushed before the environment starts, which creates its consumer groups
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		b.Fatalf("Invalid BENCHMARK_REDIS_URL: %v", err)
+	}
+	client := redis.NewClient(options)
+	defer client.Close()
+	if err := client.FlushDB(context.Background()).Err(); err != nil {
+		b.Fatalf("Failed to flush the benchmark database: %v", err)
+	}
+
+	return newIntegrationEnvAt(b, redisURL, redisURL)
+}
+
+// queueBenchmarkSMS queues count SMS notifications that are due right away
+func queueBenchmarkSMS(b *testing.B, service *NotificationService, count int) {
+	b.Helper()
+
+	due := time.Now().Add(-time.Second)
+	for i := 0; i < count; i++ {
+		request := NotificationRequest{
+			ID:         generateNotificationID(),
+			Type:       "sms",
+			Recipients: []string{"+905551112233"},
+			Message:    "Vardiya değişikliği " + strconv.Itoa(i),
+			CreatedAt:  due,
+		}
+		result := &NotificationResult{
+			ID:          generateNotificationID(),
+			RequestID:   request.ID,
+			Type:        request.Type,
+			Recipient:   request.Recipients[0],
+			Status:      "pending",
+			MaxAttempts: 1,
+			CreatedAt:   due,
+		}
+
+		if err := service.storeRequest(request); err != nil {
+			b.Fatalf("Failed to store request: %v", err)
+		}
+		if err := service.storeResult(*result); err != nil {
+			b.Fatalf("Failed to store result: %v", err)
+		}
+		if err := service.queueNotification(request, result, due); err != nil {
+			b.Fatalf("Failed to queue notification: %v", err)
+		}
+	}
+}
+
+// BenchmarkQueuePublish measures publishing to the notifications topic
+func BenchmarkQueuePublish(b *testing.B) {
+	env := newBenchmarkEnv(b)
+	env.consumer.Shutdown(context.Background())
+
+	payload := map[string]interface{}{
+		"type":      "sms",
+		"recipient": "+905551112233",
+		"message":   "Acil durum tatbikatı 14:00'te",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env.publish(b, payload)
+	}
+}
+
+// BenchmarkQueueConsumeLatency measures the time from publishing a message
+// to its SMS reaching the provider
+func BenchmarkQueueConsumeLatency(b *testing.B) {
+	env := newBenchmarkEnv(b)
+
+	payload := map[string]interface{}{
+		"type":      "sms",
+		"recipient": "+905551112233",
+		"message":   "Acil durum tatbikatı 14:00'te",
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env.publish(b, payload)
+
+		select {
+		case <-env.netgsm.received:
+		case <-time.After(5 * time.Second):
+			b.Fatal("Timed out waiting for the SMS")
+		}
+	}
+}
+
+// BenchmarkWorkerThroughput measures processing queued notifications with a
+// backlog of benchmarkBacklog behind them
+func BenchmarkWorkerThroughput(b *testing.B) {
+	env := newBenchmarkEnv(b)
+	queueBenchmarkSMS(b, env.service, benchmarkBacklog+b.N)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env.service.processQueuedNotifications(env.service.getChannelQueueKey("sms"))
+	}
+	b.StopTimer()
+
+	if sent := len(env.netgsm.sent()); sent < b.N {
+		b.Fatalf("Expected %d SMS to be sent, got %d", b.N, sent)
+	}
+}
+
+// BenchmarkLargePayloadMemory measures the Redis memory a notification takes
+// by the size of its data. It needs a real Redis to read the memory from.
+func BenchmarkLargePayloadMemory(b *testing.B) {
+	if os.Getenv("BENCHMARK_REDIS_URL") == "" {
+		b.Skip("BENCHMARK_REDIS_URL is not set")
+	}
+
+	for _, size := range []int{1 << 10, 16 << 10, 256 << 10} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			env := newBenchmarkEnv(b)
+			request := NotificationRequest{
+				Type:       "sms",
+				Recipients: []string{"+905551112233"},
+				Message:    "Vardiya değişikliği",
+				Metadata:   map[string]interface{}{"payload": strings.Repeat("x", size)},
+			}
+
+			before := usedMemory(b, env)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				request.ID = ""
+				if _, err := env.service.SendNotification(context.Background(), request); err != nil {
+					b.Fatalf("Failed to send notification: %v", err)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(usedMemory(b, env)-before)/float64(b.N), "redis-B/op")
+		})
+	}
+}
+
+// usedMemory returns the memory Redis reports it uses
+func usedMemory(b *testing.B, env *integrationEnv) int64 {
+	b.Helper()
+
+	info, err := env.client.Info(context.Background(), "memory").Result()
+	if err != nil {
+		b.Fatalf("Failed to get Redis memory: %v", err)
+	}
+
+	for _, line := range strings.Split(info, "\r\n") {
+		if value := strings.TrimPrefix(line, "used_memory:"); value != line {
+			used, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				b.Fatalf("Invalid used memory %q: %v", value, err)
+			}
+			return used
+		}
+	}
+
+	b.Fatal("Redis did not report its used memory")
+	return 0
+}
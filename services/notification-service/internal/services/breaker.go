@@ -0,0 +1,365 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// breakerBuckets is the number of buckets the rolling window is split into
+const breakerBuckets = 10
+
+// BreakerConfig holds provider circuit breaker configuration
+type BreakerConfig struct {
+	Window         time.Duration // Rolling window the failure rate is measured over
+	MinRequests    int           // Sends needed in the window before the breaker can trip
+	FailureRate    float64       // Failure ratio (0-1) that trips the breaker
+	OpenDuration   time.Duration // How long a tripped breaker rejects sends
+	HalfOpenProbes int           // Trial sends allowed once the open period is over
+}
+
+// BreakerState represents the health of a provider as seen by its circuit breaker
+type BreakerState struct {
+	Provider    string     `json:"provider"`
+	State       string     `json:"state"`
+	Requests    int        `json:"requests"`
+	Failures    int        `json:"failures"`
+	FailureRate float64    `json:"failure_rate"`
+	LastError   string     `json:"last_error,omitempty"`
+	OpenedAt    *time.Time `json:"opened_at,omitempty"`
+	RetryAt     *time.Time `json:"retry_at,omitempty"`
+}
+
+// CircuitOpenError is returned when a provider's circuit breaker rejects a
+// send, or when operators paused the channel of the send
+type CircuitOpenError struct {
+	Provider string
+	RetryAt  time.Time
+	Paused   bool // Provider is the paused channel
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.Paused {
+		return fmt.Sprintf("channel %s is paused, retrying at %s", e.Provider, e.RetryAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("circuit breaker of provider %s is open until %s", e.Provider, e.RetryAt.Format(time.RFC3339))
+}
+
+type breakerBucket struct {
+	start    int64
+	requests int
+	failures int
+}
+
+// circuitBreaker tracks the failure rate of a provider over a rolling window.
+// Breakers are kept in memory, so every instance judges provider health on the
+// sends it made itself.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	provider  string
+	config    BreakerConfig
+	state     string
+	buckets   [breakerBuckets]breakerBucket
+	openedAt  time.Time
+	probes    int
+	lastError string
+}
+
+func newCircuitBreaker(provider string, config BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		provider: provider,
+		config:   config,
+		state:    BreakerClosed,
+	}
+}
+
+// allow reports whether a send may go through. When it may not, it also
+// returns the time at which the provider should be tried again.
+func (b *circuitBreaker) allow(now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		retryAt := b.openedAt.Add(b.config.OpenDuration)
+		if now.Before(retryAt) {
+			return retryAt, false
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		fallthrough
+	case BreakerHalfOpen:
+		// Only a few trial sends go through until one of them settles the state
+		if b.probes >= b.config.HalfOpenProbes {
+			return now, false
+		}
+		b.probes++
+	}
+
+	return time.Time{}, true
+}
+
+// record registers the outcome of a send and returns the new state when the
+// outcome changed it
+func (b *circuitBreaker) record(now time.Time, sendErr error) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sendErr != nil {
+		b.lastError = sendErr.Error()
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if sendErr != nil {
+			b.trip(now)
+			return BreakerOpen, true
+		}
+		b.reset()
+		return BreakerClosed, true
+	case BreakerOpen:
+		// Late outcome of a send started before the breaker tripped
+		return b.state, false
+	}
+
+	bucket := b.bucket(now)
+	bucket.requests++
+	if sendErr != nil {
+		bucket.failures++
+	}
+
+	requests, failures := b.totals(now)
+	if sendErr != nil && requests >= b.config.MinRequests &&
+		float64(failures)/float64(requests) >= b.config.FailureRate {
+		b.trip(now)
+		return BreakerOpen, true
+	}
+
+	return b.state, false
+}
+
+// snapshot returns the current state of the breaker
+func (b *circuitBreaker) snapshot(now time.Time) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	requests, failures := b.totals(now)
+	state := BreakerState{
+		Provider:  b.provider,
+		State:     b.state,
+		Requests:  requests,
+		Failures:  failures,
+		LastError: b.lastError,
+	}
+	if requests > 0 {
+		state.FailureRate = float64(failures) / float64(requests)
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.config.OpenDuration)
+		state.OpenedAt = &openedAt
+		state.RetryAt = &retryAt
+	}
+
+	return state
+}
+
+func (b *circuitBreaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.probes = 0
+}
+
+func (b *circuitBreaker) reset() {
+	b.state = BreakerClosed
+	b.buckets = [breakerBuckets]breakerBucket{}
+	b.probes = 0
+	b.lastError = ""
+}
+
+// bucket returns the bucket of the rolling window the given time falls into
+func (b *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	width := int64(b.config.Window / breakerBuckets)
+	start := now.UnixNano() / width * width
+
+	bucket := &b.buckets[(start/width)%breakerBuckets]
+	if bucket.start != start {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// totals sums the buckets that are still inside the rolling window
+func (b *circuitBreaker) totals(now time.Time) (int, int) {
+	cutoff := now.Add(-b.config.Window).UnixNano()
+
+	requests, failures := 0, 0
+	for _, bucket := range b.buckets {
+		if bucket.start > cutoff {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+// providerName returns the provider a notification type is delivered through.
+// In-app and webhook notifications are handled in-house and have no breaker.
+func (s *NotificationService) providerName(notificationType string) string {
+	switch notificationType {
+	case "email", "all":
+		return "email:smtp"
+	case "sms":
+		if s.config.SMSConfig.Provider == "" {
+			return "sms"
+		}
+		return "sms:" + s.config.SMSConfig.Provider
+	case "push":
+		if s.config.PushConfig.Provider == "" {
+			return "push"
+		}
+		return "push:" + s.config.PushConfig.Provider
+	case "voice":
+		if s.config.VoiceConfig.Provider == "" {
+			return "voice"
+		}
+		return "voice:" + s.config.VoiceConfig.Provider
+	}
+	return ""
+}
+
+// breakerFor returns the circuit breaker of the provider behind a notification type
+func (s *NotificationService) breakerFor(notificationType string) *circuitBreaker {
+	provider := s.providerName(notificationType)
+	if provider == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	breaker, ok := s.breakers[provider]
+	s.mu.RUnlock()
+	if ok {
+		return breaker
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if breaker, ok := s.breakers[provider]; ok {
+		return breaker
+	}
+	breaker = newCircuitBreaker(provider, s.config.BreakerConfig)
+	s.breakers[provider] = breaker
+	return breaker
+}
+
+// recordProviderOutcome feeds a send outcome to a breaker and raises an alert
+// when the provider is tripped or recovers
+func (s *NotificationService) recordProviderOutcome(breaker *circuitBreaker, sendErr error) {
+	now := time.Now()
+	state, changed := breaker.record(now, sendErr)
+	if !changed {
+		return
+	}
+
+	snapshot := breaker.snapshot(now)
+
+	event := "provider.circuit_closed"
+	if state == BreakerOpen {
+		event = "provider.circuit_opened"
+		log.Error().
+			Str("provider", breaker.provider).
+			Float64("failureRate", snapshot.FailureRate).
+			Str("lastError", snapshot.LastError).
+			Time("retryAt", *snapshot.RetryAt).
+			Msg("Provider circuit breaker opened")
+	} else {
+		log.Info().Str("provider", breaker.provider).Msg("Provider circuit breaker closed")
+	}
+
+	// Let operators subscribe to provider outages
+	alert := WebhookEvent{
+		ID:     generateWebhookID(),
+		Type:   event,
+		Source: "notification-service",
+		Data: map[string]interface{}{
+			"provider":     snapshot.Provider,
+			"state":        snapshot.State,
+			"failure_rate": snapshot.FailureRate,
+			"last_error":   snapshot.LastError,
+			"retry_at":     snapshot.RetryAt,
+		},
+		Timestamp: now,
+		Priority:  "high",
+		CreatedAt: now,
+	}
+	s.emitEvent(alert)
+}
+
+// ProviderHealth returns the circuit breaker state of every provider used so far
+func (s *NotificationService) ProviderHealth() []BreakerState {
+	now := time.Now()
+
+	s.mu.RLock()
+	states := make([]BreakerState, 0, len(s.breakers))
+	for _, breaker := range s.breakers {
+		states = append(states, breaker.snapshot(now))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Provider < states[j].Provider
+	})
+
+	return states
+}
+
+// deferDelivery parks a delivery rejected by an open circuit breaker until the
+// provider may be tried again. Deferred deliveries do not use up their retry budget.
+func (s *NotificationService) deferDelivery(request NotificationRequest, result *NotificationResult, cause *CircuitOpenError) (*NotificationResult, error) {
+	if result == nil {
+		recipient := ""
+		if len(request.Recipients) > 0 {
+			recipient = request.Recipients[0]
+		}
+		result = s.createFailedResult(request, request.Type, recipient, "")
+		result.Attempts = 0
+	}
+
+	// Spread the deferred deliveries so they do not all hit the provider at once
+	retryAt := cause.RetryAt.Add(retryBackoff(s.config.RetryDelay, s.config.MaxRetryDelay, 1))
+
+	result.Status = "pending"
+	result.Error = cause.Error()
+	result.NextRetryAt = &retryAt
+	result.Metadata = copyMetadata(result.Metadata)
+	result.Metadata["deferred_provider"] = cause.Provider
+
+	if err := s.storeResult(*result); err != nil {
+		return result, fmt.Errorf("failed to store deferred result: %w", err)
+	}
+	if err := s.storeRequestUntil(request, retryAt); err != nil {
+		return result, fmt.Errorf("failed to store deferred request: %w", err)
+	}
+	if err := s.queueNotification(request, result, retryAt); err != nil {
+		return result, fmt.Errorf("failed to queue deferred notification: %w", err)
+	}
+
+	log.Warn().
+		Str("resultID", result.ID).
+		Str("provider", cause.Provider).
+		Time("retryAt", retryAt).
+		Msg("Provider unavailable, notification deferred")
+
+	return result, nil
+}
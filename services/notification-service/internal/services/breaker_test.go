@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testBreakerConfig trips at half of at least 4 sends in a minute, and
+// lets 2 probes through after 30 seconds
+var testBreakerConfig = BreakerConfig{
+	Window:         time.Minute,
+	MinRequests:    4,
+	FailureRate:    0.5,
+	OpenDuration:   30 * time.Second,
+	HalfOpenProbes: 2,
+}
+
+var errTestProvider = errors.New("provider unavailable")
+
+// tripBreaker fails sends at now until the breaker opens
+func tripBreaker(t *testing.T, breaker *circuitBreaker, now time.Time) {
+	t.Helper()
+
+	for i := 0; i < testBreakerConfig.MinRequests; i++ {
+		if state, changed := breaker.record(now, errTestProvider); changed {
+			if state != BreakerOpen {
+				t.Fatalf("Expected the breaker to open, got %s", state)
+			}
+			return
+		}
+	}
+	t.Fatalf("Expected the breaker to open after %d failures", testBreakerConfig.MinRequests)
+}
+
+func TestBreakersOpenAtTheFailureRate(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+
+	for name, test := range map[string]struct {
+		outcomes []error
+		open     bool
+	}{
+		"too few sends":        {[]error{errTestProvider, errTestProvider, errTestProvider}, false},
+		"below the rate":       {[]error{nil, nil, nil, errTestProvider, nil, errTestProvider}, false},
+		"at the rate":          {[]error{nil, nil, errTestProvider, errTestProvider}, true},
+		"successes only":       {[]error{nil, nil, nil, nil, nil}, false},
+		"reached by a success": {[]error{errTestProvider, errTestProvider, errTestProvider, nil}, false},
+	} {
+		breaker := newCircuitBreaker("sms:netgsm", testBreakerConfig)
+		for _, outcome := range test.outcomes {
+			breaker.record(now, outcome)
+		}
+
+		if open := breaker.snapshot(now).State == BreakerOpen; open != test.open {
+			t.Errorf("%s: expected the breaker to be open=%v, got %s", name, test.open, breaker.snapshot(now).State)
+		}
+	}
+}
+
+func TestBreakersForgetFailuresOutsideTheWindow(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker("sms:netgsm", testBreakerConfig)
+
+	for i := 0; i < 3; i++ {
+		breaker.record(now, errTestProvider)
+	}
+
+	later := now.Add(testBreakerConfig.Window + time.Second)
+	if state, changed := breaker.record(later, errTestProvider); changed {
+		t.Errorf("Expected failures of the last window not to count, got %s", state)
+	}
+	if snapshot := breaker.snapshot(later); snapshot.Requests != 1 || snapshot.Failures != 1 {
+		t.Errorf("Expected the window to hold the last failure only, got %d of %d", snapshot.Failures, snapshot.Requests)
+	}
+}
+
+func TestOpenBreakersRejectSendsUntilProbed(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker("sms:netgsm", testBreakerConfig)
+	tripBreaker(t, breaker, now)
+	retryAt := now.Add(testBreakerConfig.OpenDuration)
+
+	if at, ok := breaker.allow(retryAt.Add(-time.Second)); ok || !at.Equal(retryAt) {
+		t.Errorf("Expected sends to be rejected until %v, got %v %v", retryAt, at, ok)
+	}
+	snapshot := breaker.snapshot(now)
+	if snapshot.RetryAt == nil || !snapshot.RetryAt.Equal(retryAt) || snapshot.LastError != errTestProvider.Error() {
+		t.Errorf("Expected the snapshot to tell when and why, got %+v", snapshot)
+	}
+
+	// Outcomes of sends started before the breaker opened change nothing
+	if _, changed := breaker.record(now, nil); changed {
+		t.Errorf("Expected late outcomes not to close the breaker")
+	}
+
+	// Only the probes go through once the open period is over
+	for i := 0; i < testBreakerConfig.HalfOpenProbes; i++ {
+		if _, ok := breaker.allow(retryAt); !ok {
+			t.Errorf("Expected probe %d to go through", i+1)
+		}
+	}
+	if _, ok := breaker.allow(retryAt); ok {
+		t.Errorf("Expected sends beyond the probes to be rejected")
+	}
+	if state := breaker.snapshot(retryAt).State; state != BreakerHalfOpen {
+		t.Errorf("Expected the breaker to be half open while probing, got %s", state)
+	}
+}
+
+func TestProbesCloseOrReopenTheBreaker(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+
+	// A failed probe opens the breaker for another period
+	breaker := newCircuitBreaker("sms:netgsm", testBreakerConfig)
+	tripBreaker(t, breaker, now)
+	retryAt := now.Add(testBreakerConfig.OpenDuration)
+	breaker.allow(retryAt)
+	if state, changed := breaker.record(retryAt, errTestProvider); !changed || state != BreakerOpen {
+		t.Errorf("Expected the failed probe to reopen the breaker, got %s", state)
+	}
+	if at, ok := breaker.allow(retryAt.Add(time.Second)); ok || !at.Equal(retryAt.Add(testBreakerConfig.OpenDuration)) {
+		t.Errorf("Expected the breaker to reject sends for another period, got %v %v", at, ok)
+	}
+
+	// A successful probe closes it with a clean window
+	breaker = newCircuitBreaker("sms:netgsm", testBreakerConfig)
+	tripBreaker(t, breaker, now)
+	breaker.allow(retryAt)
+	if state, changed := breaker.record(retryAt, nil); !changed || state != BreakerClosed {
+		t.Errorf("Expected the successful probe to close the breaker, got %s", state)
+	}
+	snapshot := breaker.snapshot(retryAt)
+	if snapshot.Requests != 0 || snapshot.LastError != "" || snapshot.RetryAt != nil {
+		t.Errorf("Expected the closed breaker to be reset, got %+v", snapshot)
+	}
+	if _, ok := breaker.allow(retryAt); !ok {
+		t.Errorf("Expected the closed breaker to let sends through")
+	}
+	if _, changed := breaker.record(retryAt, errTestProvider); changed {
+		t.Errorf("Expected a single failure after the reset not to trip the breaker")
+	}
+}
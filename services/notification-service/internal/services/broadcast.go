@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// BroadcastRequest is a notification for every user of a tenant
+type BroadcastRequest struct {
+	TenantID   string                 `json:"tenant_id"`
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Message    string                 `json:"message"`
+	Data       map[string]interface{} `json:"data"`
+	Priority   string                 `json:"priority" binding:"omitempty,priority"`
+	Category   string                 `json:"category"`
+	ActionURL  string                 `json:"action_url,omitempty"`
+	ActionText string                 `json:"action_text,omitempty"`
+	Actions    []NotificationAction   `json:"actions,omitempty"`
+	Push       bool                   `json:"push"` // also push to the devices subscribed to the tenant topic
+	ExpiresAt  *time.Time             `json:"expires_at,omitempty"`
+
+	// Files travelling with the notification, like safety procedure PDFs
+	Attachments []InAppAttachment `json:"attachments,omitempty"`
+}
+
+// BroadcastResult represents the result of a broadcast
+type BroadcastResult struct {
+	Broadcast *InAppNotification `json:"broadcast"`
+	PushSent  bool               `json:"push_sent"`
+	PushError string             `json:"push_error,omitempty"`
+}
+
+// Broadcast sends an in-app notification, and optionally a push, to every user
+// of a tenant. Users receive the in-app notification when they next read their
+// inbox, so the size of the tenant does not matter.
+func (s *NotificationService) Broadcast(ctx context.Context, request BroadcastRequest) (*BroadcastResult, error) {
+	log.Info().
+		Str("tenantID", request.TenantID).
+		Str("title", request.Title).
+		Bool("push", request.Push).
+		Msg("Broadcasting notification")
+
+	category, err := s.registeredCategory(ctx, request.TenantID, request.Category)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Type == "" {
+		request.Type = "broadcast"
+	}
+	if request.Priority == "" && category != nil {
+		request.Priority = category.DefaultPriority
+	}
+	if request.Priority == "" {
+		request.Priority = "normal"
+	}
+
+	broadcast, err := s.inAppService.CreateBroadcast(ctx, InAppNotification{
+		TenantID:    request.TenantID,
+		Type:        request.Type,
+		Title:       request.Title,
+		Message:     request.Message,
+		Data:        request.Data,
+		Priority:    request.Priority,
+		Category:    request.Category,
+		ActionURL:   request.ActionURL,
+		ActionText:  request.ActionText,
+		Actions:     request.Actions,
+		Attachments: request.Attachments,
+		ExpiresAt:   request.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BroadcastResult{Broadcast: broadcast}
+
+	if request.Push {
+		data := map[string]interface{}{"broadcast_id": broadcast.ID}
+		for k, v := range request.Data {
+			data[k] = v
+		}
+
+		_, err := s.pushService.SendToTopic(ctx, TenantTopic(request.TenantID), PushMessage{
+			Title:    request.Title,
+			Body:     request.Message,
+			Data:     data,
+			Priority: request.Priority,
+		})
+		if err != nil {
+			// The in-app broadcast stands even when the push fails
+			log.Warn().Err(err).Str("broadcastID", broadcast.ID).Msg("Failed to push broadcast")
+			result.PushError = err.Error()
+		} else {
+			result.PushSent = true
+		}
+	}
+
+	return result, nil
+}
+
+// CreateBroadcast stores an in-app notification for every user of a tenant.
+// Only the broadcast itself is stored; each user's copy is created when the
+// user next reads their inbox.
+func (s *InAppNotificationService) CreateBroadcast(ctx context.Context, broadcast InAppNotification) (*InAppNotification, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	// Validate the broadcast as a notification of any user
+	candidate := broadcast
+	candidate.UserID = "*"
+	if err := s.validateNotification(candidate); err != nil {
+		return nil, invalid(fmt.Errorf("broadcast validation failed: %w", err))
+	}
+
+	// Set default values
+	broadcast.ID = generateBroadcastID()
+	broadcast.UserID = ""
+	broadcast.CreatedAt = time.Now()
+	if broadcast.ExpiresAt == nil {
+		expiresAt := broadcast.CreatedAt.Add(s.config.TTL)
+		broadcast.ExpiresAt = &expiresAt
+	}
+	if !broadcast.ExpiresAt.After(broadcast.CreatedAt) {
+		return nil, invalid(fmt.Errorf("broadcast expiry must be in the future"))
+	}
+
+	broadcastJSON, err := json.Marshal(broadcast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal broadcast: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getBroadcastKey(broadcast.ID), broadcastJSON, time.Until(*broadcast.ExpiresAt))
+	pipe.ZAdd(ctx, s.getTenantBroadcastsKey(broadcast.TenantID), &redis.Z{
+		Score:  float64(broadcast.CreatedAt.Unix()),
+		Member: broadcast.ID,
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store broadcast: %w", err)
+	}
+
+	log.Info().
+		Str("broadcastID", broadcast.ID).
+		Str("tenantID", broadcast.TenantID).
+		Msg("Broadcast created successfully")
+
+	return &broadcast, nil
+}
+
+// deliverBroadcasts creates the user's copies of the broadcasts sent to their
+// tenant since the user last read their inbox. It runs to the end whether or
+// not the reader is still waiting, a delivery cut short could lose broadcasts.
+func (s *InAppNotificationService) deliverBroadcasts(ctx context.Context, userID string, tenantID string) {
+	cursorKey := s.getBroadcastCursorKey(userID, tenantID)
+	broadcastsKey := s.getTenantBroadcastsKey(tenantID)
+
+	// Broadcasts of the cursor's second may not have been seen yet, receipts skip the ones that were
+	min := "-inf"
+	if cursor, err := s.redis.Get(ctx, cursorKey).Result(); err == nil {
+		min = cursor
+	}
+
+	pending, err := s.redis.ZRangeByScoreWithScores(ctx, broadcastsKey, &redis.ZRangeBy{
+		Min: min,
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to get pending broadcasts")
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	var copies []InAppNotification
+	var broadcastIDs []string
+	for _, entry := range pending {
+		broadcastID := entry.Member.(string)
+
+		broadcast, err := s.getBroadcast(ctx, broadcastID)
+		if err == redis.Nil {
+			// Expired broadcasts are dropped by the first reader that notices
+			s.redis.ZRem(ctx, broadcastsKey, broadcastID)
+			continue
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("broadcastID", broadcastID).Msg("Failed to get broadcast")
+			continue
+		}
+
+		// Only one of concurrent reads delivers the user's copy
+		delivered, err := s.redis.SetNX(ctx, s.getBroadcastReceiptKey(broadcastID, userID), 1, time.Until(*broadcast.ExpiresAt)).Result()
+		if err != nil || !delivered {
+			continue
+		}
+
+		notification := *broadcast
+		notification.ID = fmt.Sprintf("%s_%s", broadcastID, userID)
+		notification.UserID = userID
+		notification.Data = copyMetadata(broadcast.Data)
+		notification.Data["broadcast_id"] = broadcastID
+		copies = append(copies, notification)
+		broadcastIDs = append(broadcastIDs, broadcastID)
+	}
+
+	// The user's copies are written together
+	if len(copies) > 0 {
+		created, err := s.CreateNotificationsBulk(ctx, copies)
+		if err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to deliver broadcasts")
+
+			delivered := make(map[string]bool, len(created))
+			for _, notification := range created {
+				delivered[notification.ID] = true
+			}
+			// Copies that were not stored are delivered by a later read
+			for i, notification := range copies {
+				if !delivered[notification.ID] {
+					s.redis.Del(ctx, s.getBroadcastReceiptKey(broadcastIDs[i], userID))
+				}
+			}
+		}
+	}
+
+	latest := strconv.FormatInt(int64(pending[len(pending)-1].Score), 10)
+	if err := s.redis.Set(ctx, cursorKey, latest, s.config.TTL).Err(); err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to store broadcast cursor")
+	}
+}
+
+// getBroadcast loads a broadcast, returning redis.Nil once it expired
+func (s *InAppNotificationService) getBroadcast(ctx context.Context, broadcastID string) (*InAppNotification, error) {
+	broadcastJSON, err := s.redis.Get(ctx, s.getBroadcastKey(broadcastID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var broadcast InAppNotification
+	if err := json.Unmarshal([]byte(broadcastJSON), &broadcast); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal broadcast: %w", err)
+	}
+
+	return &broadcast, nil
+}
+
+// TenantTopic is the push topic every device of a tenant is subscribed to
+func TenantTopic(tenantID string) string {
+	return fmt.Sprintf("tenant-%s", tenantID)
+}
+
+// Redis key generators
+func (s *InAppNotificationService) getBroadcastKey(broadcastID string) string {
+	return fmt.Sprintf("broadcast:%s", broadcastID)
+}
+
+func (s *InAppNotificationService) getTenantBroadcastsKey(tenantID string) string {
+	return fmt.Sprintf("tenant_broadcasts:%s", tenantID)
+}
+
+func (s *InAppNotificationService) getBroadcastCursorKey(userID string, tenantID string) string {
+	return fmt.Sprintf("broadcast_cursor:%s:%s", tenantID, userID)
+}
+
+func (s *InAppNotificationService) getBroadcastReceiptKey(broadcastID string, userID string) string {
+	return fmt.Sprintf("broadcast_receipt:%s:%s", broadcastID, userID)
+}
+
+// Helper functions
+func generateBroadcastID() string {
+	return newID("broadcast")
+}
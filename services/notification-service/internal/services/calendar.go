@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CalendarEvent is an event sent with an email notification as an ICS
+// invite. Sending an event with the UID of one sent before updates it, or
+// cancels it when Cancelled is set; the sequence number calendars use to
+// order the versions is counted by the service.
+type CalendarEvent struct {
+	UID         string                `json:"uid,omitempty"` // the request ID when empty
+	Title       string                `json:"title"`
+	Description string                `json:"description,omitempty"`
+	Location    string                `json:"location,omitempty"`
+	Start       time.Time             `json:"start"`
+	End         time.Time             `json:"end"`
+	Organizer   *CalendarParticipant  `json:"organizer,omitempty"` // the sender when empty
+	Attendees   []CalendarParticipant `json:"attendees,omitempty"` // the recipients when empty
+	Reminders   []int                 `json:"reminders,omitempty"` // minutes before the start
+	Cancelled   bool                  `json:"cancelled,omitempty"`
+	Sequence    int                   `json:"sequence,omitempty"` // set by the service unless higher
+}
+
+// CalendarParticipant is the organizer or an attendee of an event
+type CalendarParticipant struct {
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// calendarSequenceTTL is how long sequence numbers are kept after an event ends
+const calendarSequenceTTL = 30 * 24 * time.Hour
+
+// prepareCalendarEvent gives the event of a request its UID and the next
+// sequence number of that UID
+func (s *NotificationService) prepareCalendarEvent(request *NotificationRequest) error {
+	event := request.Calendar
+	if event.UID == "" {
+		event.UID = request.ID
+	}
+
+	ctx := context.Background()
+	key := s.getCalendarSequenceKey(request.TenantID, event.UID)
+
+	next, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get calendar sequence: %w", err)
+	}
+
+	// The first version is sequence 0, senders may skip ahead
+	sequence := int(next - 1)
+	if event.Sequence > sequence {
+		sequence = event.Sequence
+		if err := s.redis.Set(ctx, key, sequence+1, 0).Err(); err != nil {
+			return fmt.Errorf("failed to set calendar sequence: %w", err)
+		}
+	}
+	event.Sequence = sequence
+
+	if err := s.redis.ExpireAt(ctx, key, event.End.Add(calendarSequenceTTL)).Err(); err != nil {
+		log.Warn().Err(err).Str("uid", event.UID).Msg("Failed to set calendar sequence expiry")
+	}
+
+	return nil
+}
+
+// CalendarAttachment returns the ICS invite of an event. Events without an
+// organizer are organized by the sender, without attendees the recipients
+// are invited.
+func (s *EmailService) CalendarAttachment(event CalendarEvent, recipients []string) EmailAttachment {
+	organizer := CalendarParticipant{Name: s.config.FromName, Email: s.config.From}
+	if event.Organizer != nil {
+		organizer = *event.Organizer
+	}
+
+	if len(event.Attendees) == 0 {
+		for _, recipient := range recipients {
+			address, name := splitAddress(recipient)
+			event.Attendees = append(event.Attendees, CalendarParticipant{Name: name, Email: address})
+		}
+	}
+
+	method := "REQUEST"
+	if event.Cancelled {
+		method = "CANCEL"
+	}
+
+	return EmailAttachment{
+		Name:        "invite.ics",
+		ContentType: fmt.Sprintf("text/calendar; method=%s; charset=UTF-8", method),
+		Data:        buildICS(event, organizer, method, time.Now()),
+	}
+}
+
+// buildICS builds an iCalendar (RFC 5545) object holding one event
+func buildICS(event CalendarEvent, organizer CalendarParticipant, method string, now time.Time) []byte {
+	var lines []string
+	add := func(line string) {
+		lines = append(lines, foldICSLine(line))
+	}
+
+	add("BEGIN:VCALENDAR")
+	add("VERSION:2.0")
+	add("PRODID:-//Claude Talimat//Notification Service//TR")
+	add("CALSCALE:GREGORIAN")
+	add("METHOD:" + method)
+	add("BEGIN:VEVENT")
+	add("UID:" + escapeICSText(event.UID))
+	add("SEQUENCE:" + fmt.Sprint(event.Sequence))
+	add("DTSTAMP:" + formatICSTime(now))
+	add("DTSTART:" + formatICSTime(event.Start))
+	add("DTEND:" + formatICSTime(event.End))
+	add("SUMMARY:" + escapeICSText(event.Title))
+	if event.Description != "" {
+		add("DESCRIPTION:" + escapeICSText(event.Description))
+	}
+	if event.Location != "" {
+		add("LOCATION:" + escapeICSText(event.Location))
+	}
+	add("ORGANIZER" + icsParticipantParams(organizer) + ":mailto:" + organizer.Email)
+	for _, attendee := range event.Attendees {
+		role := "REQ-PARTICIPANT"
+		if attendee.Optional {
+			role = "OPT-PARTICIPANT"
+		}
+		add("ATTENDEE" + icsParticipantParams(attendee) + ";ROLE=" + role +
+			";PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:" + attendee.Email)
+	}
+
+	if event.Cancelled {
+		add("STATUS:CANCELLED")
+	} else {
+		add("STATUS:CONFIRMED")
+		for _, minutes := range event.Reminders {
+			add("BEGIN:VALARM")
+			add("ACTION:DISPLAY")
+			add("DESCRIPTION:" + escapeICSText(event.Title))
+			add(fmt.Sprintf("TRIGGER:-PT%dM", minutes))
+			add("END:VALARM")
+		}
+	}
+
+	add("END:VEVENT")
+	add("END:VCALENDAR")
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// Redis key generators
+func (s *NotificationService) getCalendarSequenceKey(tenantID string, uid string) string {
+	if tenantID == "" {
+		tenantID = "global"
+	}
+	return fmt.Sprintf("calendar_sequence:%s:%s", tenantID, uid)
+}
+
+// Helper functions
+
+// validateCalendarEvent checks the fields of an event
+func validateCalendarEvent(event *CalendarEvent) error {
+	if event == nil {
+		return nil
+	}
+	if event.Title == "" {
+		return fmt.Errorf("calendar event title is required")
+	}
+	if event.Start.IsZero() || event.End.IsZero() {
+		return fmt.Errorf("calendar event start and end are required")
+	}
+	if !event.End.After(event.Start) {
+		return fmt.Errorf("calendar event must end after it starts")
+	}
+	if event.Sequence < 0 {
+		return fmt.Errorf("calendar event sequence must not be negative")
+	}
+
+	participants := event.Attendees
+	if event.Organizer != nil {
+		participants = append([]CalendarParticipant{*event.Organizer}, participants...)
+	}
+	for _, participant := range participants {
+		if _, err := mail.ParseAddress(participant.Email); err != nil {
+			return fmt.Errorf("invalid calendar participant email: %s", participant.Email)
+		}
+	}
+
+	for _, minutes := range event.Reminders {
+		if minutes < 0 {
+			return fmt.Errorf("calendar event reminders must be minutes before the start")
+		}
+	}
+
+	return nil
+}
+
+// formatICSTime formats a time as an iCalendar UTC date-time
+func formatICSTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeICSText escapes an iCalendar text value
+func escapeICSText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+// icsParticipantParams returns the CN parameter of a participant with a name
+func icsParticipantParams(participant CalendarParticipant) string {
+	if participant.Name == "" {
+		return ""
+	}
+	return `;CN="` + strings.NewReplacer(`"`, "'", "\r", "", "\n", " ").Replace(participant.Name) + `"`
+}
+
+// foldICSLine folds a content line into lines of at most 75 octets, without
+// splitting UTF-8 characters
+func foldICSLine(line string) string {
+	var folded strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+		folded.WriteRune(r)
+		length += size
+	}
+	return folded.String()
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// testCalendarEvent is a fire safety training in the Istanbul plant
+func testCalendarEvent() CalendarEvent {
+	start := time.Date(2026, time.March, 10, 9, 0, 0, 0, time.FixedZone("TRT", 3*60*60))
+	return CalendarEvent{
+		UID:         "training-42",
+		Title:       "Yangın eğitimi",
+		Description: "Katılım zorunludur; yanınızda baret, eldiven getirin.\nEğitim sonunda sınav yapılacak.",
+		Location:    "Tuzla fabrikası, B blok",
+		Start:       start,
+		End:         start.Add(2 * time.Hour),
+		Attendees: []CalendarParticipant{
+			{Name: `Ayşe "İSG" Yılmaz`, Email: "ayse@talimat.test"},
+			{Email: "mehmet@talimat.test", Optional: true},
+		},
+		Reminders: []int{1440, 15},
+	}
+}
+
+// unfoldICS joins the folded lines of an iCalendar object
+func unfoldICS(ics string) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(ics, "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func TestICSInvitesDescribeTheEvent(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	organizer := CalendarParticipant{Name: "Talimat İSG", Email: "isg@talimat.test"}
+	ics := string(buildICS(testCalendarEvent(), organizer, "REQUEST", now))
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines of at most 75 octets, got %d: %q", len(line), line)
+		}
+		if !strings.HasSuffix(ics, "\r\n") || strings.Contains(line, "\n") {
+			t.Errorf("Expected CRLF line endings, got %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("Expected folding to keep characters whole, got %q", line)
+		}
+	}
+
+	expected := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Claude Talimat//Notification Service//TR",
+		"CALSCALE:GREGORIAN",
+		"METHOD:REQUEST",
+		"BEGIN:VEVENT",
+		"UID:training-42",
+		"SEQUENCE:0",
+		"DTSTAMP:20260301T120000Z",
+		"DTSTART:20260310T060000Z",
+		"DTEND:20260310T080000Z",
+		"SUMMARY:Yangın eğitimi",
+		`DESCRIPTION:Katılım zorunludur\; yanınızda baret\, eldiven getirin.\nEğitim sonunda sınav yapılacak.`,
+		`LOCATION:Tuzla fabrikası\, B blok`,
+		`ORGANIZER;CN="Talimat İSG":mailto:isg@talimat.test`,
+		`ATTENDEE;CN="Ayşe 'İSG' Yılmaz";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:ayse@talimat.test`,
+		"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:mehmet@talimat.test",
+		"STATUS:CONFIRMED",
+		"BEGIN:VALARM", "ACTION:DISPLAY", "DESCRIPTION:Yangın eğitimi", "TRIGGER:-PT1440M", "END:VALARM",
+		"BEGIN:VALARM", "ACTION:DISPLAY", "DESCRIPTION:Yangın eğitimi", "TRIGGER:-PT15M", "END:VALARM",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	lines := unfoldICS(ics)
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d:\n%s", len(expected), len(lines), ics)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected line %d to be\n%s\ngot\n%s", i+1, expected[i], lines[i])
+		}
+	}
+}
+
+func TestCancelledEventsAreSentAsCancellations(t *testing.T) {
+	email := &EmailService{config: EmailConfig{From: "isg@talimat.test", FromName: "Talimat İSG"}}
+
+	event := testCalendarEvent()
+	event.Attendees = nil
+	event.Cancelled = true
+	event.Sequence = 2
+
+	attachment := email.CalendarAttachment(event, []string{"Ayşe Yılmaz <ayse@talimat.test>"})
+	if attachment.Name != "invite.ics" || attachment.ContentType != "text/calendar; method=CANCEL; charset=UTF-8" {
+		t.Errorf("Expected a cancellation invite, got %s %s", attachment.Name, attachment.ContentType)
+	}
+
+	lines := strings.Join(unfoldICS(string(attachment.Data)), "\n")
+	for _, expected := range []string{
+		"METHOD:CANCEL",
+		"SEQUENCE:2",
+		"STATUS:CANCELLED",
+		`ORGANIZER;CN="Talimat İSG":mailto:isg@talimat.test`,
+		`ATTENDEE;CN="Ayşe Yılmaz";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:ayse@talimat.test`,
+	} {
+		if !strings.Contains(lines, expected) {
+			t.Errorf("Expected the cancellation to hold %q, got\n%s", expected, lines)
+		}
+	}
+	if strings.Contains(lines, "VALARM") {
+		t.Errorf("Expected cancellations not to remind, got\n%s", lines)
+	}
+}
+
+func TestCalendarSequencesCountTheVersionsOfAnEvent(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	prepare := func(tenantID string, event CalendarEvent) *CalendarEvent {
+		request := NotificationRequest{ID: "req-1", TenantID: tenantID, Calendar: &event}
+		if err := env.service.prepareCalendarEvent(&request); err != nil {
+			t.Fatalf("Failed to prepare event: %v", err)
+		}
+		return request.Calendar
+	}
+
+	// Sequences are kept until a while after the event, so it must be ahead
+	upcoming := func() CalendarEvent {
+		event := testCalendarEvent()
+		event.Start = time.Now().Add(7 * 24 * time.Hour)
+		event.End = event.Start.Add(2 * time.Hour)
+		return event
+	}
+
+	event := upcoming()
+	for expected := 0; expected < 3; expected++ {
+		if sequence := prepare("tenant-a", event).Sequence; sequence != expected {
+			t.Errorf("Expected version %d to be sequence %d, got %d", expected+1, expected, sequence)
+		}
+	}
+
+	// Senders may skip ahead, the count carries on from there
+	event.Sequence = 7
+	if sequence := prepare("tenant-a", event).Sequence; sequence != 7 {
+		t.Errorf("Expected the sequence to skip ahead to 7, got %d", sequence)
+	}
+	event.Sequence = 1
+	if sequence := prepare("tenant-a", event).Sequence; sequence != 8 {
+		t.Errorf("Expected the sequence to continue at 8, got %d", sequence)
+	}
+
+	if sequence := prepare("tenant-b", upcoming()).Sequence; sequence != 0 {
+		t.Errorf("Expected the events of tenants to be counted apart, got %d", sequence)
+	}
+
+	unnamed := upcoming()
+	unnamed.UID = ""
+	if uid := prepare("tenant-a", unnamed).UID; uid != "req-1" {
+		t.Errorf("Expected events without a UID to be named after their request, got %q", uid)
+	}
+
+	ttl := env.service.redis.TTL(ctx, env.service.getCalendarSequenceKey("tenant-a", "training-42")).Val()
+	if ttl < time.Until(event.End.Add(calendarSequenceTTL))-time.Minute {
+		t.Errorf("Expected the sequence to be kept until a while after the event, expires in %v", ttl)
+	}
+}
+
+func TestCalendarEventsAreValidated(t *testing.T) {
+	for name, change := range map[string]func(event *CalendarEvent){
+		"no title":          func(event *CalendarEvent) { event.Title = "" },
+		"no start":          func(event *CalendarEvent) { event.Start = time.Time{} },
+		"ends before":       func(event *CalendarEvent) { event.End = event.Start.Add(-time.Hour) },
+		"negative sequence": func(event *CalendarEvent) { event.Sequence = -1 },
+		"bad organizer":     func(event *CalendarEvent) { event.Organizer = &CalendarParticipant{Email: "isg"} },
+		"bad attendee":      func(event *CalendarEvent) { event.Attendees[1].Email = "mehmet at talimat" },
+		"reminder after":    func(event *CalendarEvent) { event.Reminders = []int{-5} },
+	} {
+		event := testCalendarEvent()
+		change(&event)
+		if err := validateCalendarEvent(&event); err == nil {
+			t.Errorf("%s: expected the event to be refused", name)
+		}
+	}
+
+	event := testCalendarEvent()
+	if err := validateCalendarEvent(&event); err != nil {
+		t.Errorf("Expected the event to be valid, got %v", err)
+	}
+	if err := validateCalendarEvent(nil); err != nil {
+		t.Errorf("Expected requests without an event to be valid, got %v", err)
+	}
+}
+
+func TestCalendarInvitesAreAttachedToEmails(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	event := testCalendarEvent()
+	if _, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:       "email",
+		Recipients: []string{"ayse@talimat.test"},
+		Message:    "Yangın eğitimine davetlisiniz",
+		TenantID:   "tenant-a",
+		Calendar:   &event,
+	}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	eventually(t, "the invite to be sent", func() bool { return len(env.smtp.sent()) == 1 })
+	data := env.smtp.sent()[0].Data
+	if !strings.Contains(data, "text/calendar; method=REQUEST; charset=UTF-8") || !strings.Contains(data, "invite.ics") {
+		t.Errorf("Expected the invite to be attached, got\n%s", data)
+	}
+	if !strings.Contains(data, "Subject: =?UTF-8?q?Yang=C4=B1n_e=C4=9Fitimi?=") {
+		t.Errorf("Expected the email to be named after the event, got\n%s", data)
+	}
+
+	invalid := testCalendarEvent()
+	invalid.End = invalid.Start
+	if _, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:       "email",
+		Recipients: []string{"ayse@talimat.test"},
+		Message:    "Yangın eğitimine davetlisiniz",
+		TenantID:   "tenant-a",
+		Calendar:   &invalid,
+	}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected invalid events to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// StatusEvent represents a delivery status event posted to a caller's callback URL
+type StatusEvent struct {
+	ID             string                 `json:"id"`
+	Event          string                 `json:"event"`
+	NotificationID string                 `json:"notification_id"`
+	RequestID      string                 `json:"request_id"`
+	Type           string                 `json:"type"`
+	Recipient      string                 `json:"recipient"`
+	Status         string                 `json:"status"`
+	MessageID      string                 `json:"message_id,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	Attempts       int                    `json:"attempts"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp      time.Time              `json:"timestamp"`
+}
+
+// statusCallback represents a pending delivery of a status event
+type statusCallback struct {
+	URL      string      `json:"url"`
+	Event    StatusEvent `json:"event"`
+	Attempts int         `json:"attempts"`
+}
+
+// isTerminalStatus reports whether a notification status is final
+func isTerminalStatus(status string) bool {
+	switch status {
+	case "sent", "delivered", "failed", "suppressed", "cancelled":
+		return true
+	}
+	return false
+}
+
+// notifyStatus publishes the status event of a result once it is final, and
+// queues it for the caller when they asked for a callback
+func (s *NotificationService) notifyStatus(result NotificationResult) {
+	if !isTerminalStatus(result.Status) {
+		return
+	}
+
+	ctx := context.Background()
+
+	// Only report each final status of a result once
+	first, err := s.redis.SetNX(ctx, s.getCallbackSentKey(result.ID, result.Status), 1, 7*24*time.Hour).Result()
+	if err != nil || !first {
+		return
+	}
+
+	event := StatusEvent{
+		ID:             newID("evt"),
+		Event:          "notification.status",
+		NotificationID: result.ID,
+		RequestID:      result.RequestID,
+		Type:           result.Type,
+		Recipient:      result.Recipient,
+		Status:         result.Status,
+		MessageID:      result.MessageID,
+		Error:          result.Error,
+		Attempts:       result.Attempts,
+		Metadata:       result.Metadata,
+		Timestamp:      time.Now(),
+	}
+
+	s.emitEvent(WebhookEvent{
+		ID:       event.ID,
+		Type:     event.Event,
+		Source:   "notification-service",
+		TenantID: result.TenantID,
+		Data: map[string]interface{}{
+			"notification_id": event.NotificationID,
+			"request_id":      event.RequestID,
+			"type":            event.Type,
+			"recipient":       event.Recipient,
+			"status":          event.Status,
+			"message_id":      event.MessageID,
+			"error":           event.Error,
+			"attempts":        event.Attempts,
+		},
+		Timestamp: event.Timestamp,
+		Priority:  result.Priority,
+		CreatedAt: event.Timestamp,
+	})
+
+	if result.CallbackURL == "" {
+		return
+	}
+
+	callback := statusCallback{URL: result.CallbackURL, Event: event}
+	if err := s.queueStatusCallback(callback, time.Now()); err != nil {
+		log.Error().Err(err).Str("resultID", result.ID).Msg("Failed to queue status callback")
+	}
+}
+
+// validateCallbackURL checks that a callback URL can be posted to
+func validateCallbackURL(rawURL string) error {
+	callbackURL, err := url.Parse(rawURL)
+	if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+		return fmt.Errorf("callback URL must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// queueStatusCallback schedules a status callback delivery attempt
+func (s *NotificationService) queueStatusCallback(callback statusCallback, at time.Time) error {
+	ctx := context.Background()
+
+	callbackJSON, err := json.Marshal(callback)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status callback: %w", err)
+	}
+
+	return s.redis.ZAdd(ctx, s.getCallbackQueueKey(), &redis.Z{
+		Score:  float64(at.Unix()),
+		Member: string(callbackJSON),
+	}).Err()
+}
+
+// startCallbackWorker delivers queued status callbacks
+func (s *NotificationService) startCallbackWorker() {
+	log.Info().Msg("Status callback worker started")
+
+	for {
+		s.processStatusCallbacks()
+
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Status callback worker stopped")
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// processStatusCallbacks delivers every status callback that is due
+func (s *NotificationService) processStatusCallbacks() {
+	ctx := context.Background()
+	queueKey := s.getCallbackQueueKey()
+
+	members, err := s.redis.ZRangeByScore(ctx, queueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().Unix(), 10),
+		Count: int64(s.config.BatchSize),
+	}).Result()
+	if err != nil {
+		return
+	}
+
+	for _, member := range members {
+		// Leave the rest of the batch queued when shutting down
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		// Only one worker wins each callback
+		removed, err := s.redis.ZRem(ctx, queueKey, member).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		var callback statusCallback
+		if err := json.Unmarshal([]byte(member), &callback); err != nil {
+			log.Error().Err(err).Msg("Failed to parse status callback")
+			continue
+		}
+
+		s.trackInFlight(queueKey, member)
+		callback.Attempts++
+		err = s.sendStatusCallback(callback)
+		s.untrackInFlight(member)
+
+		if err != nil {
+			if callback.Attempts >= s.config.CallbackMaxRetries {
+				log.Error().
+					Err(err).
+					Str("url", callback.URL).
+					Str("notificationID", callback.Event.NotificationID).
+					Int("attempts", callback.Attempts).
+					Msg("Status callback failed permanently")
+				continue
+			}
+
+			delay := s.config.RetryDelay * time.Duration(1<<uint(callback.Attempts-1))
+			log.Warn().
+				Err(err).
+				Str("url", callback.URL).
+				Int("attempts", callback.Attempts).
+				Dur("retryIn", delay).
+				Msg("Status callback failed, retrying")
+
+			if err := s.queueStatusCallback(callback, time.Now().Add(delay)); err != nil {
+				log.Error().Err(err).Msg("Failed to re-queue status callback")
+			}
+		}
+	}
+}
+
+// sendStatusCallback posts a signed status event to the caller
+func (s *NotificationService) sendStatusCallback(callback statusCallback) error {
+	body, err := json.Marshal(callback.Event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, callback.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create callback request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Claude-Talimat-Notifications/1.0")
+	req.Header.Set("X-Notification-Event", callback.Event.Event)
+	req.Header.Set("X-Notification-Timestamp", timestamp)
+	if s.config.CallbackSecret != "" {
+		req.Header.Set("X-Notification-Signature", "sha256="+signStatusEvent(s.config.CallbackSecret, timestamp, body))
+	}
+
+	resp, err := s.callbackClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("callback request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *NotificationService) getCallbackQueueKey() string {
+	return "notification_callbacks"
+}
+
+func (s *NotificationService) getCallbackSentKey(resultID string, status string) string {
+	return fmt.Sprintf("notification_callback_sent:%s:%s", resultID, status)
+}
+
+// Helper functions
+
+// signStatusEvent signs "<timestamp>.<body>" with HMAC-SHA256 so callers can
+// verify both the origin and the freshness of an event
+func signStatusEvent(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatusCallbacksRefuseInternalAddresses(t *testing.T) {
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	t.Cleanup(server.Close)
+
+	callback := statusCallback{
+		URL:   server.URL + "/callbacks",
+		Event: StatusEvent{ID: "evt_1", Event: "notification.action", Status: "responded", Timestamp: time.Now()},
+	}
+
+	service := &NotificationService{callbackClient: newWebhookClient(newWebhookTransport(false), time.Second)}
+	if err := service.sendStatusCallback(callback); !errors.Is(err, errBlockedAddress) {
+		t.Errorf("Expected a callback to a loopback address to be refused, got %v", err)
+	}
+	if received != 0 {
+		t.Errorf("Expected the callback not to reach the server, got %d requests", received)
+	}
+
+	service.callbackClient = newWebhookClient(newWebhookTransport(true), time.Second)
+	if err := service.sendStatusCallback(callback); err != nil || received != 1 {
+		t.Errorf("Expected the callback to be sent when private networks are allowed, got %d requests (%v)", received, err)
+	}
+}
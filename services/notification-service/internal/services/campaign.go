@@ -0,0 +1,865 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
+)
+
+// Campaign statuses
+const (
+	CampaignStatusDraft     = "draft"
+	CampaignStatusScheduled = "scheduled"
+	CampaignStatusRunning   = "running"
+	CampaignStatusPaused    = "paused"
+	CampaignStatusCompleted = "completed"
+)
+
+// CampaignService manages notification campaigns
+type CampaignService struct {
+	redis         *redis.Client
+	config        CampaignConfig
+	notifications *NotificationService
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// CampaignConfig holds campaign service configuration
+type CampaignConfig struct {
+	RedisURL      string
+	RedisPassword string
+	RedisDB       int
+	BatchSize     int           // Maximum deliveries per tick
+	TickInterval  time.Duration // How often running campaigns are advanced
+}
+
+// Campaign represents a template sent to an audience on a schedule
+type Campaign struct {
+	ID           string                 `json:"id"`
+	TenantID     string                 `json:"tenant_id"`
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	TemplateID   string                 `json:"template_id"`
+	TemplateData map[string]interface{} `json:"template_data"`
+	Channel      string                 `json:"channel"`       // email, sms, push, inapp
+	Audience     []string               `json:"audience"`      // raw addresses or user:, group:, role: references
+	ThrottleRate int                    `json:"throttle_rate"` // deliveries per minute, 0 for unlimited
+	Priority     string                 `json:"priority" binding:"omitempty,priority"`
+	Category     string                 `json:"category"`
+	Status       string                 `json:"status"`
+	ScheduleAt   *time.Time             `json:"schedule_at,omitempty"`
+	Progress     CampaignProgress       `json:"progress"`
+	CreatedBy    string                 `json:"created_by"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	StartedAt    *time.Time             `json:"started_at,omitempty"`
+	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
+	LastBatchAt  *time.Time             `json:"last_batch_at,omitempty"`
+}
+
+// CampaignProgress represents the delivery progress of a campaign
+type CampaignProgress struct {
+	Total     int     `json:"total"`
+	Processed int     `json:"processed"`
+	Sent      int     `json:"sent"`
+	Failed    int     `json:"failed"`
+	Pending   int     `json:"pending"`
+	Percent   float64 `json:"percent"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+// NewCampaignService creates a new campaign service instance
+func NewCampaignService(config CampaignConfig, notifications *NotificationService) (*CampaignService, error) {
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set default values
+	if config.BatchSize == 0 {
+		config.BatchSize = 100
+	}
+	if config.TickInterval == 0 {
+		config.TickInterval = 1 * time.Second
+	}
+
+	service := &CampaignService{
+		redis:         redisClient,
+		config:        config,
+		notifications: notifications,
+		done:          make(chan struct{}),
+	}
+	service.ctx, service.cancel = context.WithCancel(context.Background())
+
+	// Start background scheduler
+	go service.startScheduler()
+
+	return service, nil
+}
+
+// CreateCampaign creates a new campaign in draft state
+func (s *CampaignService) CreateCampaign(campaign Campaign) (*Campaign, error) {
+	log.Info().
+		Str("name", campaign.Name).
+		Str("tenantID", campaign.TenantID).
+		Msg("Creating campaign")
+
+	if err := s.validateCampaign(campaign); err != nil {
+		return nil, invalid(fmt.Errorf("campaign validation failed: %w", err))
+	}
+
+	// Set default values
+	campaign.ID = generateCampaignID()
+	campaign.Status = CampaignStatusDraft
+	campaign.Progress = CampaignProgress{}
+	campaign.CreatedAt = time.Now()
+	campaign.UpdatedAt = time.Now()
+	campaign.StartedAt = nil
+	campaign.CompletedAt = nil
+	campaign.LastBatchAt = nil
+	if campaign.Priority == "" {
+		campaign.Priority = "normal"
+	}
+
+	if err := s.storeCampaign(&campaign); err != nil {
+		return nil, err
+	}
+
+	// Add to tenant index
+	ctx := context.Background()
+	if err := s.redis.ZAdd(ctx, s.getCampaignsKey(campaign.TenantID), &redis.Z{
+		Score:  float64(campaign.CreatedAt.Unix()),
+		Member: campaign.ID,
+	}).Err(); err != nil {
+		return nil, fmt.Errorf("failed to index campaign: %w", err)
+	}
+
+	log.Info().
+		Str("campaignID", campaign.ID).
+		Msg("Campaign created")
+
+	return &campaign, nil
+}
+
+// GetCampaign gets a campaign by ID, including its current progress
+func (s *CampaignService) GetCampaign(campaignID string) (*Campaign, error) {
+	ctx := context.Background()
+
+	campaignJSON, err := s.redis.Get(ctx, s.getCampaignKey(campaignID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("campaign not found: %s", campaignID)
+		}
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+
+	var campaign Campaign
+	if err := json.Unmarshal([]byte(campaignJSON), &campaign); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal campaign: %w", err)
+	}
+
+	progress, err := s.GetCampaignProgress(campaignID)
+	if err == nil {
+		campaign.Progress = *progress
+	}
+
+	return &campaign, nil
+}
+
+// ListCampaigns lists the campaigns of a tenant, optionally filtered by status
+func (s *CampaignService) ListCampaigns(tenantID string, status string, page int, limit int) ([]*Campaign, error) {
+	ctx := context.Background()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	ids, err := s.redis.ZRevRange(ctx, s.getCampaignsKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+
+	var campaigns []*Campaign
+	offset := (page - 1) * limit
+	for _, id := range ids {
+		campaign, err := s.GetCampaign(id)
+		if err != nil {
+			continue
+		}
+		if status != "" && campaign.Status != status {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		campaigns = append(campaigns, campaign)
+		if len(campaigns) >= limit {
+			break
+		}
+	}
+
+	return campaigns, nil
+}
+
+// UpdateCampaign updates a campaign that has not started yet
+func (s *CampaignService) UpdateCampaign(campaignID string, updates Campaign) (*Campaign, error) {
+	campaign, err := s.GetCampaign(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	if campaign.Status != CampaignStatusDraft {
+		return nil, conflictf("cannot update campaign with status: %s", campaign.Status)
+	}
+
+	if updates.Name != "" {
+		campaign.Name = updates.Name
+	}
+	if updates.Description != "" {
+		campaign.Description = updates.Description
+	}
+	if updates.TemplateID != "" {
+		campaign.TemplateID = updates.TemplateID
+	}
+	if updates.TemplateData != nil {
+		campaign.TemplateData = updates.TemplateData
+	}
+	if updates.Channel != "" {
+		campaign.Channel = updates.Channel
+	}
+	if len(updates.Audience) > 0 {
+		campaign.Audience = updates.Audience
+	}
+	if updates.ThrottleRate != 0 {
+		campaign.ThrottleRate = updates.ThrottleRate
+	}
+	if updates.Priority != "" {
+		campaign.Priority = updates.Priority
+	}
+	if updates.Category != "" {
+		campaign.Category = updates.Category
+	}
+
+	if err := s.validateCampaign(*campaign); err != nil {
+		return nil, invalid(fmt.Errorf("campaign validation failed: %w", err))
+	}
+
+	campaign.UpdatedAt = time.Now()
+	if err := s.storeCampaign(campaign); err != nil {
+		return nil, err
+	}
+
+	return campaign, nil
+}
+
+// DeleteCampaign deletes a campaign that is not running
+func (s *CampaignService) DeleteCampaign(campaignID string) error {
+	campaign, err := s.GetCampaign(campaignID)
+	if err != nil {
+		return err
+	}
+
+	if campaign.Status == CampaignStatusRunning {
+		return conflictf("cannot delete a running campaign")
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, s.getCampaignKey(campaignID))
+	pipe.Del(ctx, s.getRecipientsKey(campaignID))
+	pipe.Del(ctx, s.getProgressKey(campaignID))
+	pipe.ZRem(ctx, s.getCampaignsKey(campaign.TenantID), campaignID)
+	pipe.ZRem(ctx, s.getScheduledKey(), campaignID)
+	pipe.SRem(ctx, s.getRunningKey(), campaignID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete campaign: %w", err)
+	}
+
+	log.Info().
+		Str("campaignID", campaignID).
+		Msg("Campaign deleted")
+
+	return nil
+}
+
+// ScheduleCampaign schedules a draft campaign to start at the given time
+func (s *CampaignService) ScheduleCampaign(campaignID string, scheduleAt time.Time) (*Campaign, error) {
+	campaign, err := s.GetCampaign(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	if campaign.Status != CampaignStatusDraft && campaign.Status != CampaignStatusScheduled {
+		return nil, conflictf("cannot schedule campaign with status: %s", campaign.Status)
+	}
+
+	campaign.Status = CampaignStatusScheduled
+	campaign.ScheduleAt = &scheduleAt
+	campaign.UpdatedAt = time.Now()
+
+	if err := s.storeCampaign(campaign); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := s.redis.ZAdd(ctx, s.getScheduledKey(), &redis.Z{
+		Score:  float64(scheduleAt.Unix()),
+		Member: campaign.ID,
+	}).Err(); err != nil {
+		return nil, fmt.Errorf("failed to schedule campaign: %w", err)
+	}
+
+	log.Info().
+		Str("campaignID", campaign.ID).
+		Time("scheduleAt", scheduleAt).
+		Msg("Campaign scheduled")
+
+	return campaign, nil
+}
+
+// StartCampaign resolves the audience of a campaign and starts delivering it
+func (s *CampaignService) StartCampaign(campaignID string) (*Campaign, error) {
+	campaign, err := s.GetCampaign(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	if campaign.Status != CampaignStatusDraft && campaign.Status != CampaignStatusScheduled {
+		return nil, conflictf("cannot start campaign with status: %s", campaign.Status)
+	}
+
+	log.Info().
+		Str("campaignID", campaign.ID).
+		Int("audienceSize", len(campaign.Audience)).
+		Msg("Starting campaign")
+
+	// Expand the audience into individual recipients
+	resolved, err := s.notifications.recipients.ResolveRecipients(campaign.TenantID, campaign.Channel, campaign.Audience)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve campaign audience: %w", err)
+	}
+
+	var recipients []interface{}
+	for _, recipient := range resolved {
+		if recipient.UserID != "" {
+			recipients = append(recipients, RecipientPrefixUser+recipient.UserID)
+		} else {
+			recipients = append(recipients, recipient.Addresses[0])
+		}
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, s.getRecipientsKey(campaign.ID))
+	if len(recipients) > 0 {
+		pipe.RPush(ctx, s.getRecipientsKey(campaign.ID), recipients...)
+	}
+	pipe.Del(ctx, s.getProgressKey(campaign.ID))
+	pipe.HSet(ctx, s.getProgressKey(campaign.ID), "total", len(recipients), "sent", 0, "failed", 0)
+	pipe.ZRem(ctx, s.getScheduledKey(), campaign.ID)
+	pipe.SAdd(ctx, s.getRunningKey(), campaign.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start campaign: %w", err)
+	}
+
+	now := time.Now()
+	campaign.Status = CampaignStatusRunning
+	campaign.StartedAt = &now
+	campaign.LastBatchAt = &now
+	campaign.UpdatedAt = now
+	campaign.Progress = CampaignProgress{Total: len(recipients), Pending: len(recipients)}
+
+	if err := s.storeCampaign(campaign); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("campaignID", campaign.ID).
+		Int("recipientCount", len(recipients)).
+		Msg("Campaign started")
+
+	return campaign, nil
+}
+
+// PauseCampaign pauses a running campaign
+func (s *CampaignService) PauseCampaign(campaignID string) (*Campaign, error) {
+	campaign, err := s.GetCampaign(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	if campaign.Status != CampaignStatusRunning {
+		return nil, conflictf("cannot pause campaign with status: %s", campaign.Status)
+	}
+
+	ctx := context.Background()
+	if err := s.redis.SRem(ctx, s.getRunningKey(), campaign.ID).Err(); err != nil {
+		return nil, fmt.Errorf("failed to pause campaign: %w", err)
+	}
+
+	campaign.Status = CampaignStatusPaused
+	campaign.UpdatedAt = time.Now()
+
+	if err := s.storeCampaign(campaign); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("campaignID", campaign.ID).
+		Msg("Campaign paused")
+
+	return campaign, nil
+}
+
+// ResumeCampaign resumes a paused campaign
+func (s *CampaignService) ResumeCampaign(campaignID string) (*Campaign, error) {
+	campaign, err := s.GetCampaign(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	if campaign.Status != CampaignStatusPaused {
+		return nil, conflictf("cannot resume campaign with status: %s", campaign.Status)
+	}
+
+	now := time.Now()
+	campaign.Status = CampaignStatusRunning
+	campaign.LastBatchAt = &now
+	campaign.UpdatedAt = now
+
+	if err := s.storeCampaign(campaign); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := s.redis.SAdd(ctx, s.getRunningKey(), campaign.ID).Err(); err != nil {
+		return nil, fmt.Errorf("failed to resume campaign: %w", err)
+	}
+
+	log.Info().
+		Str("campaignID", campaign.ID).
+		Msg("Campaign resumed")
+
+	return campaign, nil
+}
+
+// GetCampaignProgress gets the delivery progress of a campaign
+func (s *CampaignService) GetCampaignProgress(campaignID string) (*CampaignProgress, error) {
+	ctx := context.Background()
+
+	values, err := s.redis.HGetAll(ctx, s.getProgressKey(campaignID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign progress: %w", err)
+	}
+
+	progress := &CampaignProgress{
+		Total:     atoiOrZero(values["total"]),
+		Sent:      atoiOrZero(values["sent"]),
+		Failed:    atoiOrZero(values["failed"]),
+		LastError: values["last_error"],
+	}
+	progress.Processed = progress.Sent + progress.Failed
+	progress.Pending = progress.Total - progress.Processed
+	if progress.Pending < 0 {
+		progress.Pending = 0
+	}
+	if progress.Total > 0 {
+		progress.Percent = float64(progress.Processed) / float64(progress.Total) * 100
+	}
+
+	return progress, nil
+}
+
+// TestConnection tests the campaign service connection
+func (s *CampaignService) TestConnection() error {
+	log.Info().Msg("Testing campaign service connection")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.redis.Ping(ctx).Err(); err != nil {
+		log.Error().Err(err).Msg("Campaign service connection test failed")
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+
+	log.Info().Msg("Campaign service connection test successful")
+	return nil
+}
+
+// startScheduler advances scheduled and running campaigns
+func (s *CampaignService) startScheduler() {
+	log.Info().Msg("Campaign scheduler started")
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Campaign scheduler stopped")
+			return
+		case <-ticker.C:
+			s.startDueCampaigns()
+			s.advanceRunningCampaigns()
+		}
+	}
+}
+
+// Shutdown stops the scheduler and waits for the batch it is sending to finish.
+// Running campaigns keep their remaining recipients and resume on the next start.
+func (s *CampaignService) Shutdown(ctx context.Context) error {
+	s.cancel()
+
+	select {
+	case <-s.done:
+		log.Info().Msg("Campaign scheduler drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("campaign scheduler did not drain: %w", ctx.Err())
+	}
+}
+
+// startDueCampaigns starts scheduled campaigns whose time has come
+func (s *CampaignService) startDueCampaigns() {
+	ctx := context.Background()
+
+	ids, err := s.redis.ZRangeByScore(ctx, s.getScheduledKey(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		// Only one instance wins the right to start the campaign
+		removed, err := s.redis.ZRem(ctx, s.getScheduledKey(), id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		if _, err := s.StartCampaign(id); err != nil {
+			log.Error().Err(err).Str("campaignID", id).Msg("Failed to start scheduled campaign")
+		}
+	}
+}
+
+// advanceRunningCampaigns sends the next batch of every running campaign
+func (s *CampaignService) advanceRunningCampaigns() {
+	// Batches are throttled per campaign, so only the leader sends them
+	if !s.notifications.IsLeader() {
+		return
+	}
+
+	ctx := context.Background()
+
+	ids, err := s.redis.SMembers(ctx, s.getRunningKey()).Result()
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		if err := s.processBatch(id); err != nil {
+			log.Error().Err(err).Str("campaignID", id).Msg("Failed to process campaign batch")
+		}
+	}
+}
+
+// processBatch sends the next throttled batch of a running campaign
+func (s *CampaignService) processBatch(campaignID string) error {
+	campaign, err := s.GetCampaign(campaignID)
+	if err != nil {
+		return err
+	}
+
+	if campaign.Status != CampaignStatusRunning {
+		ctx := context.Background()
+		return s.redis.SRem(ctx, s.getRunningKey(), campaignID).Err()
+	}
+
+	// Work out how many deliveries the throttle allows since the last batch
+	batchSize := s.config.BatchSize
+	now := time.Now()
+	next := now
+	if campaign.ThrottleRate > 0 && campaign.LastBatchAt != nil {
+		batchSize, next = throttledBatch(*campaign.LastBatchAt, now, campaign.ThrottleRate, batchSize)
+	}
+	if batchSize <= 0 {
+		return nil
+	}
+
+	// Render the template once for the whole batch
+	var rendered *TemplateRenderResult
+	if campaign.TemplateID != "" {
+		rendered, err = s.notifications.templateService.RenderTemplate(campaign.TemplateID, campaign.TemplateData)
+		if err != nil {
+			return fmt.Errorf("failed to render campaign template: %w", err)
+		}
+	}
+
+	ctx := context.Background()
+	recipientsKey := s.getRecipientsKey(campaignID)
+	progressKey := s.getProgressKey(campaignID)
+
+	for i := 0; i < batchSize; i++ {
+		// Stop between deliveries on shutdown or pause, the rest stays queued
+		if s.ctx.Err() != nil {
+			break
+		}
+		if running, err := s.redis.SIsMember(ctx, s.getRunningKey(), campaignID).Result(); err != nil || !running {
+			break
+		}
+
+		recipient, err := s.redis.LPop(ctx, recipientsKey).Result()
+		if err == redis.Nil {
+			return s.completeCampaign(campaignID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get next campaign recipient: %w", err)
+		}
+
+		request := NotificationRequest{
+			ID:           generateNotificationID(),
+			Type:         campaign.Channel,
+			Recipients:   []string{recipient},
+			TemplateID:   campaign.TemplateID,
+			TemplateData: campaign.TemplateData,
+			Priority:     campaign.Priority,
+			Category:     campaign.Category,
+			TenantID:     campaign.TenantID,
+			Metadata: map[string]interface{}{
+				"campaign_id": campaign.ID,
+			},
+			CreatedAt: time.Now(),
+		}
+		if rendered != nil {
+			request.Subject = rendered.Subject
+			request.Title = rendered.Title
+			request.Message = rendered.Message
+			request.HTMLBody = rendered.HTMLBody
+			request.TextBody = rendered.TextBody
+		}
+
+		result, err := s.notifications.SendNotification(ctx, request)
+		if err != nil || result == nil || result.Status == "failed" {
+			errorMsg := "delivery failed"
+			if err != nil {
+				errorMsg = err.Error()
+			} else if result != nil && result.Error != "" {
+				errorMsg = result.Error
+			}
+			s.redis.HIncrBy(ctx, progressKey, "failed", 1)
+			s.redis.HSet(ctx, progressKey, "last_error", errorMsg)
+			continue
+		}
+
+		s.redis.HIncrBy(ctx, progressKey, "sent", 1)
+	}
+
+	return s.updateRunningCampaign(campaignID, func(campaign *Campaign) {
+		campaign.LastBatchAt = &next
+		campaign.UpdatedAt = now
+	})
+}
+
+// throttledBatch returns how many deliveries a throttle of rate per minute
+// allows since last, at most limit, and the time the next batch is counted
+// from. The time of the deliveries not yet allowed is carried forward, so
+// rates that don't divide into the tick are kept.
+func throttledBatch(last time.Time, now time.Time, rate int, limit int) (int, time.Time) {
+	since := now.Sub(last)
+	if since > time.Hour {
+		since = time.Hour
+	}
+
+	allowed := int64(since) * int64(rate) / int64(time.Minute)
+	if allowed <= 0 {
+		return 0, last
+	}
+	// A full batch doesn't carry a backlog into the next one
+	if allowed >= int64(limit) {
+		return limit, now
+	}
+	return int(allowed), last.Add(time.Duration(allowed * int64(time.Minute) / int64(rate)))
+}
+
+// maxCampaignUpdateAttempts bounds how often a campaign changed while it was
+// updated is updated again
+const maxCampaignUpdateAttempts = 3
+
+// updateRunningCampaign applies update to a campaign while it is still
+// running. It is compared and set, so a pause, completion or deletion that
+// happened meanwhile isn't overwritten.
+func (s *CampaignService) updateRunningCampaign(campaignID string, update func(campaign *Campaign)) error {
+	ctx := context.Background()
+	key := s.getCampaignKey(campaignID)
+
+	apply := func(tx *redis.Tx) error {
+		campaignJSON, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get campaign: %w", err)
+		}
+
+		var campaign Campaign
+		if err := json.Unmarshal([]byte(campaignJSON), &campaign); err != nil {
+			return fmt.Errorf("failed to unmarshal campaign: %w", err)
+		}
+		if campaign.Status != CampaignStatusRunning {
+			return nil
+		}
+
+		update(&campaign)
+		updatedJSON, err := json.Marshal(&campaign)
+		if err != nil {
+			return fmt.Errorf("failed to marshal campaign: %w", err)
+		}
+
+		if _, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updatedJSON, 0)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to store campaign: %w", err)
+		}
+		return nil
+	}
+
+	for attempt := 0; attempt < maxCampaignUpdateAttempts; attempt++ {
+		if err := s.redis.Watch(ctx, apply, key); !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return conflictf("campaign %s changed while it was updated", campaignID)
+}
+
+// completeCampaign marks a campaign as completed unless it was paused or
+// cancelled meanwhile
+func (s *CampaignService) completeCampaign(campaignID string) error {
+	ctx := context.Background()
+	if err := s.redis.SRem(ctx, s.getRunningKey(), campaignID).Err(); err != nil {
+		return fmt.Errorf("failed to complete campaign: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.updateRunningCampaign(campaignID, func(campaign *Campaign) {
+		campaign.Status = CampaignStatusCompleted
+		campaign.CompletedAt = &now
+		campaign.UpdatedAt = now
+	}); err != nil {
+		return err
+	}
+
+	if progress, err := s.GetCampaignProgress(campaignID); err == nil {
+		log.Info().
+			Str("campaignID", campaignID).
+			Int("sent", progress.Sent).
+			Int("failed", progress.Failed).
+			Msg("Campaign completed")
+	}
+
+	return nil
+}
+
+// validateCampaign validates a campaign
+func (s *CampaignService) validateCampaign(campaign Campaign) error {
+	if campaign.Name == "" {
+		return fmt.Errorf("campaign name is required")
+	}
+
+	if campaign.TemplateID == "" {
+		return fmt.Errorf("template ID is required")
+	}
+
+	switch campaign.Channel {
+	case "email", "sms", "push", "inapp":
+	default:
+		return fmt.Errorf("unsupported campaign channel: %s", campaign.Channel)
+	}
+
+	if len(campaign.Audience) == 0 {
+		return fmt.Errorf("campaign audience is required")
+	}
+
+	if campaign.ThrottleRate < 0 {
+		return fmt.Errorf("throttle rate cannot be negative")
+	}
+
+	return nil
+}
+
+// storeCampaign stores a campaign
+func (s *CampaignService) storeCampaign(campaign *Campaign) error {
+	ctx := context.Background()
+
+	campaignJSON, err := json.Marshal(campaign)
+	if err != nil {
+		return fmt.Errorf("failed to marshal campaign: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getCampaignKey(campaign.ID), campaignJSON, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store campaign: %w", err)
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *CampaignService) getCampaignKey(campaignID string) string {
+	return fmt.Sprintf("campaign:%s", campaignID)
+}
+
+func (s *CampaignService) getCampaignsKey(tenantID string) string {
+	if tenantID == "" {
+		return "campaigns:global"
+	}
+	return fmt.Sprintf("campaigns:%s", tenantID)
+}
+
+func (s *CampaignService) getRecipientsKey(campaignID string) string {
+	return fmt.Sprintf("campaign_recipients:%s", campaignID)
+}
+
+func (s *CampaignService) getProgressKey(campaignID string) string {
+	return fmt.Sprintf("campaign_progress:%s", campaignID)
+}
+
+func (s *CampaignService) getScheduledKey() string {
+	return "campaigns_scheduled"
+}
+
+func (s *CampaignService) getRunningKey() string {
+	return "campaigns_running"
+}
+
+// Helper functions
+func generateCampaignID() string {
+	return newID("campaign")
+}
+
+func atoiOrZero(value string) int {
+	n, _ := strconv.Atoi(value)
+	return n
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestCampaignService returns a campaign service sending through the
+// environment, its scheduler leaves the campaigns to the test
+func newTestCampaignService(t *testing.T, env *integrationEnv) *CampaignService {
+	t.Helper()
+
+	campaigns, err := NewCampaignService(CampaignConfig{
+		RedisURL:     "redis://" + env.service.redis.Options().Addr,
+		TickInterval: time.Hour,
+	}, env.service)
+	if err != nil {
+		t.Fatalf("Failed to create campaign service: %v", err)
+	}
+	t.Cleanup(func() { campaigns.Shutdown(context.Background()) })
+	return campaigns
+}
+
+// startTestCampaign starts an email campaign to audience
+func startTestCampaign(t *testing.T, env *integrationEnv, campaigns *CampaignService, audience ...string) *Campaign {
+	t.Helper()
+
+	template, err := env.service.templateService.CreateTemplate(context.Background(), NotificationTemplate{
+		Name:     "drill",
+		Type:     "email",
+		TenantID: "tenant-a",
+		Category: "safety",
+		IsActive: true,
+		Subject:  "Yangın tatbikatı",
+		Title:    "Yangın tatbikatı",
+		Message:  "Tatbikat yarın saat 10.00'da",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	campaign, err := campaigns.CreateCampaign(Campaign{
+		TenantID:   "tenant-a",
+		Name:       "Yangın tatbikatı duyurusu",
+		TemplateID: template.ID,
+		Channel:    "email",
+		Audience:   audience,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create campaign: %v", err)
+	}
+	if campaign, err = campaigns.StartCampaign(campaign.ID); err != nil {
+		t.Fatalf("Failed to start campaign: %v", err)
+	}
+	return campaign
+}
+
+func TestCampaignThrottleKeepsRatesThatDontDivideIntoTheTick(t *testing.T) {
+	for _, test := range []struct {
+		rate  int
+		limit int
+		want  int
+	}{
+		{rate: 90, limit: 100, want: 90},
+		{rate: 30, limit: 100, want: 30},
+		{rate: 61, limit: 100, want: 61},
+		{rate: 6000, limit: 10, want: 600},
+	} {
+		start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+		last := start
+		sent := 0
+		for tick := 1; tick <= 60; tick++ {
+			var allowed int
+			allowed, last = throttledBatch(last, start.Add(time.Duration(tick)*time.Second), test.rate, test.limit)
+			if allowed > test.limit {
+				t.Fatalf("Expected at most %d deliveries per batch, got %d", test.limit, allowed)
+			}
+			sent += allowed
+		}
+		if sent != test.want {
+			t.Errorf("Expected %d deliveries in a minute at %d/min, got %d", test.want, test.rate, sent)
+		}
+	}
+}
+
+func TestCampaignsAreSentToTheirWholeAudience(t *testing.T) {
+	env := newIntegrationEnv(t)
+	campaigns := newTestCampaignService(t, env)
+
+	campaign := startTestCampaign(t, env, campaigns, "ayse@talimat.test", "mehmet@talimat.test", "zeynep@talimat.test")
+	for i := 0; i < 2; i++ {
+		if err := campaigns.processBatch(campaign.ID); err != nil {
+			t.Fatalf("Failed to process batch: %v", err)
+		}
+	}
+
+	stored, err := campaigns.GetCampaign(campaign.ID)
+	if err != nil {
+		t.Fatalf("Failed to get campaign: %v", err)
+	}
+	if stored.Status != CampaignStatusCompleted || stored.Progress.Sent != 3 || stored.Progress.Pending != 0 {
+		t.Errorf("Expected the campaign to be completed with 3 sent, got %s %+v", stored.Status, stored.Progress)
+	}
+	if len(env.smtp.sent()) != 3 {
+		t.Errorf("Expected 3 emails, got %d", len(env.smtp.sent()))
+	}
+}
+
+// pauseOnFirstDelivery pauses a campaign as its first recipient is taken
+type pauseOnFirstDelivery struct {
+	campaigns  *CampaignService
+	campaignID string
+	paused     bool
+}
+
+func (h *pauseOnFirstDelivery) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *pauseOnFirstDelivery) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if cmd.Name() == "lpop" && !h.paused {
+		h.paused = true
+		if _, err := h.campaigns.PauseCampaign(h.campaignID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *pauseOnFirstDelivery) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *pauseOnFirstDelivery) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestCampaignsPausedDuringABatchStayPaused(t *testing.T) {
+	env := newIntegrationEnv(t)
+	campaigns := newTestCampaignService(t, env)
+
+	campaign := startTestCampaign(t, env, campaigns, "ayse@talimat.test", "mehmet@talimat.test", "zeynep@talimat.test")
+	campaigns.redis.AddHook(&pauseOnFirstDelivery{campaigns: campaigns, campaignID: campaign.ID})
+
+	if err := campaigns.processBatch(campaign.ID); err != nil {
+		t.Fatalf("Failed to process batch: %v", err)
+	}
+
+	stored, err := campaigns.GetCampaign(campaign.ID)
+	if err != nil {
+		t.Fatalf("Failed to get campaign: %v", err)
+	}
+	if stored.Status != CampaignStatusPaused {
+		t.Errorf("Expected the campaign paused during the batch to stay paused, got %s", stored.Status)
+	}
+	if stored.Progress.Sent != 1 {
+		t.Errorf("Expected the batch to stop after the delivery in flight, got %+v", stored.Progress)
+	}
+
+	// Resumed campaigns continue where they stopped
+	if _, err := campaigns.ResumeCampaign(campaign.ID); err != nil {
+		t.Fatalf("Failed to resume campaign: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := campaigns.processBatch(campaign.ID); err != nil {
+			t.Fatalf("Failed to process batch: %v", err)
+		}
+	}
+	if stored, _ := campaigns.GetCampaign(campaign.ID); stored.Status != CampaignStatusCompleted || stored.Progress.Sent != 3 {
+		t.Errorf("Expected the resumed campaign to be completed, got %s %+v", stored.Status, stored.Progress)
+	}
+}
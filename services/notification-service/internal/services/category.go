@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/events"
+	"claude-talimat/pkg/validation"
+)
+
+// maxCategoryNameLength bounds the names of notification categories
+const maxCategoryNameLength = 64
+
+// systemCategories are the categories the service sends in itself. They are
+// accepted whatever a tenant registered.
+var systemCategories = map[string]bool{
+	"digest":              true,
+	"incident":            true,
+	"system":              true,
+	MentionKindMention:    true,
+	MentionKindAssignment: true,
+}
+
+// NotificationCategory is a category a tenant sends notifications in, like
+// safety or training, with the defaults of its notifications. Once a tenant
+// registered categories, notifications of other categories are rejected.
+type NotificationCategory struct {
+	TenantID        string    `json:"tenant_id"`
+	Name            string    `json:"name"` // the category of notifications, unique per tenant
+	Description     string    `json:"description,omitempty"`
+	DefaultPriority string    `json:"default_priority,omitempty"` // of notifications sent without one
+	DefaultChannels []string  `json:"default_channels,omitempty"` // of notifications sent without a type
+	UserMutable     bool      `json:"user_mutable"`               // users may turn the category off in their preferences
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// CreateCategory registers a notification category of a tenant
+func (s *NotificationService) CreateCategory(ctx context.Context, category NotificationCategory) (*NotificationCategory, error) {
+	log.Info().
+		Str("tenantID", category.TenantID).
+		Str("name", category.Name).
+		Msg("Creating notification category")
+
+	if err := validateNotificationCategory(category); err != nil {
+		return nil, invalid(fmt.Errorf("category validation failed: %w", err))
+	}
+
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = category.CreatedAt
+
+	categoryJSON, err := json.Marshal(category)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal category: %w", err)
+	}
+
+	created, err := s.redis.HSetNX(ctx, s.getNotificationCategoriesKey(category.TenantID), category.Name, categoryJSON).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store category: %w", err)
+	}
+	if !created {
+		return nil, conflictf("category already exists: %s", category.Name)
+	}
+
+	return &category, nil
+}
+
+// GetCategory gets a notification category of a tenant
+func (s *NotificationService) GetCategory(ctx context.Context, tenantID string, name string) (*NotificationCategory, error) {
+	categoryJSON, err := s.redis.HGet(ctx, s.getNotificationCategoriesKey(tenantID), name).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("category not found: %s", name)
+		}
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	var category NotificationCategory
+	if err := json.Unmarshal([]byte(categoryJSON), &category); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal category: %w", err)
+	}
+
+	return &category, nil
+}
+
+// ListCategories lists the notification categories of a tenant by name
+func (s *NotificationService) ListCategories(ctx context.Context, tenantID string) ([]*NotificationCategory, error) {
+	values, err := s.redis.HVals(ctx, s.getNotificationCategoriesKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+
+	categories := make([]*NotificationCategory, 0, len(values))
+	for _, categoryJSON := range values {
+		var category NotificationCategory
+		if err := json.Unmarshal([]byte(categoryJSON), &category); err != nil {
+			log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to unmarshal category")
+			continue
+		}
+		categories = append(categories, &category)
+	}
+
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+
+	return categories, nil
+}
+
+// UpdateCategory replaces the description and defaults of a notification category
+func (s *NotificationService) UpdateCategory(ctx context.Context, category NotificationCategory) (*NotificationCategory, error) {
+	existing, err := s.GetCategory(ctx, category.TenantID, category.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateNotificationCategory(category); err != nil {
+		return nil, invalid(fmt.Errorf("category validation failed: %w", err))
+	}
+
+	category.CreatedAt = existing.CreatedAt
+	category.UpdatedAt = time.Now()
+
+	categoryJSON, err := json.Marshal(category)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal category: %w", err)
+	}
+
+	if err := s.redis.HSet(ctx, s.getNotificationCategoriesKey(category.TenantID), category.Name, categoryJSON).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store category: %w", err)
+	}
+
+	return &category, nil
+}
+
+// DeleteCategory deletes a notification category of a tenant. Deleting the
+// last one lets the tenant send in any category again.
+func (s *NotificationService) DeleteCategory(ctx context.Context, tenantID string, name string) error {
+	deleted, err := s.redis.HDel(ctx, s.getNotificationCategoriesKey(tenantID), name).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+	if deleted == 0 {
+		return notFoundf("category not found: %s", name)
+	}
+
+	return nil
+}
+
+// CategoryChannels returns the default channels of a category, none when the
+// category sets none or isn't registered
+func (s *NotificationService) CategoryChannels(ctx context.Context, tenantID string, name string) []string {
+	if name == "" {
+		return nil
+	}
+	category, err := s.GetCategory(ctx, tenantID, name)
+	if err != nil {
+		return nil
+	}
+	return category.DefaultChannels
+}
+
+// registeredCategory returns the registered category of a request, nil when
+// the request has no category or the tenant registered none. Requests in
+// categories the tenant didn't register are rejected.
+func (s *NotificationService) registeredCategory(ctx context.Context, tenantID string, name string) (*NotificationCategory, error) {
+	if name == "" || systemCategories[name] {
+		return nil, nil
+	}
+
+	categoriesKey := s.getNotificationCategoriesKey(tenantID)
+	categoryJSON, err := s.redis.HGet(ctx, categoriesKey, name).Result()
+	if err == redis.Nil {
+		registered, err := s.redis.HLen(ctx, categoriesKey).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get categories: %w", err)
+		}
+		if registered > 0 {
+			return nil, invalid(fmt.Errorf("unknown category: %s", name))
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	var category NotificationCategory
+	if err := json.Unmarshal([]byte(categoryJSON), &category); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal category: %w", err)
+	}
+	return &category, nil
+}
+
+// UpdateUserPreferences updates the notification preferences of a user.
+// Users cannot turn off registered categories that aren't user mutable.
+func (s *NotificationService) UpdateUserPreferences(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	updates map[string]interface{},
+) (*NotificationPreferences, error) {
+	if categories, ok := boolMap(updates["categories"]); ok {
+		for name, enabled := range categories {
+			if enabled {
+				continue
+			}
+			category, err := s.GetCategory(ctx, tenantID, name)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			if category != nil && !category.UserMutable {
+				return nil, invalid(fmt.Errorf("category cannot be turned off: %s", name))
+			}
+		}
+	}
+
+	return s.inAppService.UpdateUserPreferences(ctx, userID, tenantID, updates)
+}
+
+// categoryEventTypes are the event types of the webhook notifications of a
+// tenant, named after the categories they are sent in
+func (s *NotificationService) categoryEventTypes(ctx context.Context, tenantID string) ([]WebhookEventType, error) {
+	descriptions := make(map[string]string, len(systemCategories))
+	for name := range systemCategories {
+		descriptions[name] = ""
+	}
+
+	categories, err := s.ListCategories(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		descriptions[category.Name] = category.Description
+	}
+
+	eventTypes := make([]WebhookEventType, 0, len(descriptions))
+	for name, description := range descriptions {
+		if description == "" {
+			description = fmt.Sprintf("A webhook notification in the %s category was sent", name)
+		}
+		eventTypes = append(eventTypes, WebhookEventType{
+			Name:        name,
+			Description: description,
+			Schema: &events.Schema{
+				Type:        "object",
+				Description: "The template data of the notification",
+			},
+			SamplePayload: samplePayload(name, map[string]interface{}{
+				"title": "Yangın tatbikatı",
+				"site":  "B blok",
+			}),
+		})
+	}
+
+	return eventTypes, nil
+}
+
+// validateNotificationCategory validates a notification category
+func validateNotificationCategory(category NotificationCategory) error {
+	if category.TenantID == "" {
+		return fmt.Errorf("tenant ID is required")
+	}
+	if category.Name == "" {
+		return fmt.Errorf("category name is required")
+	}
+	if len(category.Name) > maxCategoryNameLength {
+		return fmt.Errorf("category name is longer than %d characters", maxCategoryNameLength)
+	}
+	if systemCategories[category.Name] {
+		return fmt.Errorf("category is reserved: %s", category.Name)
+	}
+
+	if category.DefaultPriority != "" && !containsString(validation.Priorities, category.DefaultPriority) {
+		return fmt.Errorf("invalid default priority: %s", category.DefaultPriority)
+	}
+
+	for _, channel := range category.DefaultChannels {
+		if !containsString(queueChannels, channel) {
+			return fmt.Errorf("invalid default channel: %s", channel)
+		}
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *NotificationService) getNotificationCategoriesKey(tenantID string) string {
+	return fmt.Sprintf("notification_categories:%s", tenantID)
+}
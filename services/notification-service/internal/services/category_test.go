@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCategoriesAreValidated(t *testing.T) {
+	for name, test := range map[string]struct {
+		category NotificationCategory
+		valid    bool
+	}{
+		"complete":         {NotificationCategory{TenantID: "tenant-a", Name: "safety", DefaultPriority: "high", DefaultChannels: []string{"inapp", "email"}}, true},
+		"name only":        {NotificationCategory{TenantID: "tenant-a", Name: "safety"}, true},
+		"without tenant":   {NotificationCategory{Name: "safety"}, false},
+		"without name":     {NotificationCategory{TenantID: "tenant-a"}, false},
+		"long name":        {NotificationCategory{TenantID: "tenant-a", Name: strings.Repeat("s", maxCategoryNameLength+1)}, false},
+		"reserved name":    {NotificationCategory{TenantID: "tenant-a", Name: "incident"}, false},
+		"unknown priority": {NotificationCategory{TenantID: "tenant-a", Name: "safety", DefaultPriority: "critical"}, false},
+		"unknown channel":  {NotificationCategory{TenantID: "tenant-a", Name: "safety", DefaultChannels: []string{"fax"}}, false},
+	} {
+		if err := validateNotificationCategory(test.category); (err == nil) != test.valid {
+			t.Errorf("Expected the %s category to be valid=%v, got %v", name, test.valid, err)
+		}
+	}
+}
+
+func TestSystemCategoriesAreAcceptedOnceCategoriesAreRegistered(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	if _, err := env.service.CreateCategory(ctx, NotificationCategory{TenantID: "tenant-a", Name: "safety"}); err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	for name := range systemCategories {
+		if category, err := env.service.registeredCategory(ctx, "tenant-a", name); category != nil || err != nil {
+			t.Errorf("Expected the system category %s to be accepted, got %v %v", name, category, err)
+		}
+	}
+	if _, err := env.service.registeredCategory(ctx, "tenant-a", "drills"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected unregistered categories to be rejected, got %v", err)
+	}
+	// Categories are registered per tenant
+	if category, err := env.service.registeredCategory(ctx, "tenant-b", "drills"); category != nil || err != nil {
+		t.Errorf("Expected tenants without categories to send in any, got %v %v", category, err)
+	}
+}
+
+func TestUsersTurnOffUserMutableCategoriesOnly(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	for _, category := range []NotificationCategory{
+		{TenantID: "tenant-a", Name: "safety"},
+		{TenantID: "tenant-a", Name: "newsletter", UserMutable: true},
+	} {
+		if _, err := env.service.CreateCategory(ctx, category); err != nil {
+			t.Fatalf("Failed to create category: %v", err)
+		}
+	}
+
+	turnOff := func(name string) error {
+		_, err := env.service.UpdateUserPreferences(ctx, "user-1", "tenant-a", map[string]interface{}{
+			"categories": map[string]interface{}{name: false},
+		})
+		return err
+	}
+	if err := turnOff("newsletter"); err != nil {
+		t.Errorf("Expected users to turn off user mutable categories, got %v", err)
+	}
+	if err := turnOff("safety"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected users not to turn off categories that aren't user mutable, got %v", err)
+	}
+	if err := turnOff("unregistered"); err != nil {
+		t.Errorf("Expected users to turn off categories that aren't registered, got %v", err)
+	}
+}
+
+func TestRegisteredCategoriesShapeNotifications(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	request := NotificationRequest{
+		Type:       "inapp",
+		Recipients: []string{"user-1"},
+		Title:      "Tatbikat",
+		Message:    "Yangın tatbikatı saat 14:00'te",
+		Category:   "drills",
+		TenantID:   "tenant-a",
+	}
+	// Tenants without registered categories send in any category
+	if _, err := env.service.SendNotification(ctx, request); err != nil {
+		t.Fatalf("Failed to send notification: %v", err)
+	}
+
+	if _, err := env.service.CreateCategory(ctx, NotificationCategory{
+		TenantID:        "tenant-a",
+		Name:            "safety",
+		DefaultPriority: "high",
+		DefaultChannels: []string{"inapp", "push"},
+	}); err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+	if _, err := env.service.CreateCategory(ctx, NotificationCategory{TenantID: "tenant-a", Name: "safety"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected a second safety category to conflict, got %v", err)
+	}
+	if _, err := env.service.CreateCategory(ctx, NotificationCategory{TenantID: "tenant-a", Name: "news", DefaultChannels: []string{"fax"}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected unknown default channels to be rejected, got %v", err)
+	}
+
+	if _, err := env.service.SendNotification(ctx, request); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected unregistered categories to be rejected, got %v", err)
+	}
+
+	request.Category = "safety"
+	result, err := env.service.SendNotification(ctx, request)
+	if err != nil {
+		t.Fatalf("Failed to send notification: %v", err)
+	}
+	notification, err := env.service.inAppService.GetNotification(ctx, result.MessageID)
+	if err != nil {
+		t.Fatalf("Failed to get notification: %v", err)
+	}
+	if notification.Priority != "high" {
+		t.Errorf("Expected the default priority of the category, got %s", notification.Priority)
+	}
+	if channels := env.service.CategoryChannels(ctx, "tenant-a", "safety"); len(channels) != 2 {
+		t.Errorf("Expected the default channels of the category, got %v", channels)
+	}
+
+	_, err = env.service.UpdateUserPreferences(ctx, "user-1", "tenant-a", map[string]interface{}{
+		"categories": map[string]interface{}{"safety": false},
+	})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected users not to turn off categories that aren't user mutable, got %v", err)
+	}
+
+	if err := env.service.DeleteCategory(ctx, "tenant-a", "safety"); err != nil {
+		t.Fatalf("Failed to delete category: %v", err)
+	}
+	request.Category = "drills"
+	if _, err := env.service.SendNotification(ctx, request); err != nil {
+		t.Errorf("Expected any category once the last one is deleted, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// openCollapseScript counts an occurrence of a collapse key and opens its
+// window on the first one, in one step so a window never outlives its expiry.
+// It returns the count and the ID of the result delivered for the window, if
+// any yet.
+var openCollapseScript = redis.NewScript(`
+local count = redis.call("HINCRBY", KEYS[1], "count", 1)
+redis.call("HSET", KEYS[1], "last_at", ARGV[1])
+if count == 1 then
+	redis.call("HSET", KEYS[1], "first_at", ARGV[1])
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+elseif redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return {count, redis.call("HGET", KEYS[1], "result_id") or ""}`)
+
+// rememberCollapseScript links a window to its result while the window is
+// open, a window that expired meanwhile isn't recreated without its expiry
+var rememberCollapseScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("HSET", KEYS[1], "result_id", ARGV[1])
+end
+return 0`)
+
+// collapseDuplicate merges a request into an earlier notification with the same
+// collapse key when one was sent within the collapse window. It reports whether
+// the request was merged and must not be delivered. Requests that aren't merged
+// opened the window and must either remember their result or forget the window.
+func (s *NotificationService) collapseDuplicate(ctx context.Context, request NotificationRequest) (*NotificationResult, bool) {
+	if request.CollapseKey == "" {
+		return nil, false
+	}
+
+	now := time.Now()
+	key := s.getCollapseKey(request)
+
+	values, err := openCollapseScript.Run(ctx, s.redis, []string{key}, now.Unix(), s.config.CollapseWindow.Milliseconds()).Slice()
+	if err != nil || len(values) != 2 {
+		log.Warn().Err(err).Str("collapseKey", request.CollapseKey).Msg("Failed to check collapse key, delivering")
+		return nil, false
+	}
+	count, _ := values[0].(int64)
+	resultID, _ := values[1].(string)
+
+	// First occurrence opens the window and is delivered normally
+	if count == 1 {
+		return nil, false
+	}
+
+	log.Info().
+		Str("collapseKey", request.CollapseKey).
+		Int64("count", count).
+		Msg("Duplicate notification collapsed")
+
+	if resultID == "" {
+		// The first occurrence is still being delivered
+		return &NotificationResult{
+			ID:          generateNotificationID(),
+			RequestID:   request.ID,
+			Type:        request.Type,
+			Status:      "pending",
+			MaxAttempts: s.maxAttempts(request.TenantID, request.Type),
+			Metadata: map[string]interface{}{
+				"collapse_key":     request.CollapseKey,
+				"collapse_count":   count,
+				"last_occurred_at": now,
+			},
+		}, true
+	}
+
+	result, err := s.GetNotificationStatus(ctx, resultID)
+	if err != nil {
+		log.Warn().Err(err).Str("resultID", resultID).Msg("Collapsed notification result not found")
+		return nil, false
+	}
+
+	result.Metadata = copyMetadata(result.Metadata)
+	result.Metadata["collapse_key"] = request.CollapseKey
+	result.Metadata["collapse_count"] = count
+	result.Metadata["last_occurred_at"] = now
+
+	if err := s.storeResult(*result); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to update collapsed result")
+	}
+
+	// In-app notifications show the merged count to the user
+	if result.Type == "inapp" && result.MessageID != "" {
+		if err := s.inAppService.CollapseNotification(ctx, result.MessageID, int(count), now); err != nil {
+			log.Warn().Err(err).Str("notificationID", result.MessageID).Msg("Failed to collapse in-app notification")
+		}
+	}
+
+	return result, true
+}
+
+// rememberCollapse links the collapse window of a request to its delivered result
+func (s *NotificationService) rememberCollapse(ctx context.Context, request NotificationRequest, result *NotificationResult) {
+	if request.CollapseKey == "" {
+		return
+	}
+
+	if err := rememberCollapseScript.Run(ctx, s.redis, []string{s.getCollapseKey(request)}, result.ID).Err(); err != nil {
+		log.Warn().Err(err).Str("collapseKey", request.CollapseKey).Msg("Failed to record collapsed result")
+	}
+}
+
+// forgetCollapse closes the collapse window a request opened when it wasn't
+// delivered, so its duplicates are delivered instead of merged into nothing
+func (s *NotificationService) forgetCollapse(request NotificationRequest) {
+	if request.CollapseKey == "" {
+		return
+	}
+
+	// The window is closed even when the request was cancelled meanwhile
+	if err := s.redis.Del(context.Background(), s.getCollapseKey(request)).Err(); err != nil {
+		log.Warn().Err(err).Str("collapseKey", request.CollapseKey).Msg("Failed to close collapse window")
+	}
+}
+
+// Redis key generators
+func (s *NotificationService) getCollapseKey(request NotificationRequest) string {
+	// Duplicates only collapse when they target the same recipients
+	recipients := append([]string(nil), request.Recipients...)
+	sort.Strings(recipients)
+	sum := sha1.Sum([]byte(strings.Join(recipients, ",")))
+
+	tenantID := request.TenantID
+	if tenantID == "" {
+		tenantID = "global"
+	}
+
+	return fmt.Sprintf("notification_collapse:%s:%s:%s:%s",
+		tenantID, request.Type, request.CollapseKey, hex.EncodeToString(sum[:8]))
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+// collapsingSend is an email sharing its collapse key with its duplicates
+func collapsingSend() NotificationRequest {
+	return NotificationRequest{
+		Type:        "email",
+		Recipients:  []string{"ayse.yilmaz@talimat.test"},
+		Subject:     "Gaz kaçağı alarmı",
+		Message:     "B blok gaz sensörü alarm verdi",
+		TenantID:    "tenant-a",
+		CollapseKey: "gas-alarm-b",
+	}
+}
+
+func TestCollapseWindowsAlwaysExpire(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	first, err := env.service.SendNotification(ctx, collapsingSend())
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	duplicate, err := env.service.SendNotification(ctx, collapsingSend())
+	if err != nil {
+		t.Fatalf("Failed to send duplicate: %v", err)
+	}
+
+	if duplicate.ID != first.ID || duplicate.Metadata["collapse_count"] != int64(2) {
+		t.Errorf("Expected the duplicate to be merged into %s, got %s %v", first.ID, duplicate.ID, duplicate.Metadata)
+	}
+	if len(env.smtp.sent()) != 1 {
+		t.Errorf("Expected the email to be sent once, got %d", len(env.smtp.sent()))
+	}
+
+	key := env.service.getCollapseKey(collapsingSend())
+	if ttl := env.service.redis.TTL(ctx, key).Val(); ttl <= 0 || ttl > env.service.config.CollapseWindow {
+		t.Errorf("Expected the window to expire within %v, got %v", env.service.config.CollapseWindow, ttl)
+	}
+}
+
+func TestUndeliveredNotificationsCloseTheirCollapseWindow(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	env.service.config.DisabledChannels = []string{"email"}
+	if _, err := env.service.SendNotification(ctx, collapsingSend()); err == nil {
+		t.Fatal("Expected the send on a disabled channel to fail")
+	}
+	if env.service.redis.Exists(ctx, env.service.getCollapseKey(collapsingSend())).Val() != 0 {
+		t.Errorf("Expected the window of the undelivered notification to be closed")
+	}
+
+	// The duplicate is delivered instead of merged into nothing
+	env.service.config.DisabledChannels = nil
+	result, err := env.service.SendNotification(ctx, collapsingSend())
+	if err != nil {
+		t.Fatalf("Failed to send duplicate: %v", err)
+	}
+	if _, err := env.service.GetNotificationStatus(ctx, result.ID); err != nil {
+		t.Errorf("Expected the duplicate to be delivered and stored, got %v", err)
+	}
+	if len(env.smtp.sent()) != 1 {
+		t.Errorf("Expected the duplicate to be sent, got %d emails", len(env.smtp.sent()))
+	}
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+	"claude-talimat-notifications/models"
+	"claude-talimat/pkg/validation"
+)
+
+const (
+	contactPointLinkTTL      = 24 * time.Hour // how long email confirmation links stay valid
+	contactPointSendCooldown = time.Minute    // between two verification messages of a contact point
+)
+
+// emailVerification is what an email confirmation link confirms
+type emailVerification struct {
+	ContactPointID string `json:"contact_point_id"`
+	Address        string `json:"address"`
+}
+
+// CreateContactPoint stores a new contact point of a user. Its addresses
+// aren't sent to until they are verified.
+func (s *NotificationService) CreateContactPoint(contactPoint models.NotificationSubscription) (*models.NotificationSubscription, error) {
+	if err := normalizeContactPoint(&contactPoint); err != nil {
+		return nil, invalid(err)
+	}
+
+	now := time.Now()
+	contactPoint.ID = newID("cp")
+	contactPoint.EmailVerifiedAt = nil
+	contactPoint.PhoneVerifiedAt = nil
+	contactPoint.CreatedAt = now
+	contactPoint.UpdatedAt = now
+
+	if err := s.storeContactPoint(contactPoint); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("contactPointID", contactPoint.ID).
+		Str("userID", contactPoint.UserID).
+		Msg("Contact point created")
+	return &contactPoint, nil
+}
+
+// GetContactPoint gets a contact point by ID
+func (s *NotificationService) GetContactPoint(contactPointID string) (*models.NotificationSubscription, error) {
+	ctx := context.Background()
+	contactPointJSON, err := s.redis.Get(ctx, s.getContactPointKey(contactPointID)).Result()
+	if err == redis.Nil {
+		return nil, notFoundf("contact point not found: %s", contactPointID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact point: %w", err)
+	}
+
+	var contactPoint models.NotificationSubscription
+	if err := json.Unmarshal([]byte(contactPointJSON), &contactPoint); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal contact point: %w", err)
+	}
+	return &contactPoint, nil
+}
+
+// ListContactPoints returns the contact points of a user
+func (s *NotificationService) ListContactPoints(tenantID string, userID string) ([]*models.NotificationSubscription, error) {
+	ctx := context.Background()
+	contactPointIDs, err := s.redis.SMembers(ctx, s.getUserContactPointsKey(tenantID, userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contact points: %w", err)
+	}
+
+	contactPoints := make([]*models.NotificationSubscription, 0, len(contactPointIDs))
+	for _, contactPointID := range contactPointIDs {
+		contactPoint, err := s.GetContactPoint(contactPointID)
+		if err != nil {
+			log.Warn().Err(err).Str("contactPointID", contactPointID).Msg("Failed to get contact point")
+			continue
+		}
+		contactPoints = append(contactPoints, contactPoint)
+	}
+	return contactPoints, nil
+}
+
+// UpdateContactPoint replaces the addresses and preferences of a contact
+// point. Addresses that changed have to be verified again.
+func (s *NotificationService) UpdateContactPoint(contactPointID string, updates models.NotificationSubscription) (*models.NotificationSubscription, error) {
+	contactPoint, err := s.GetContactPoint(contactPointID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates.ID = contactPoint.ID
+	updates.UserID = contactPoint.UserID
+	updates.TenantID = contactPoint.TenantID
+	if err := normalizeContactPoint(&updates); err != nil {
+		return nil, invalid(err)
+	}
+
+	updates.EmailVerifiedAt = nil
+	if sameAddress(updates.EmailAddress, contactPoint.EmailAddress) {
+		updates.EmailVerifiedAt = contactPoint.EmailVerifiedAt
+	}
+	updates.PhoneVerifiedAt = nil
+	if sameAddress(updates.PhoneNumber, contactPoint.PhoneNumber) {
+		updates.PhoneVerifiedAt = contactPoint.PhoneVerifiedAt
+	}
+	updates.CreatedAt = contactPoint.CreatedAt
+	updates.UpdatedAt = time.Now()
+
+	if err := s.storeContactPoint(updates); err != nil {
+		return nil, err
+	}
+	return &updates, nil
+}
+
+// DeleteContactPoint deletes a contact point
+func (s *NotificationService) DeleteContactPoint(contactPointID string) error {
+	contactPoint, err := s.GetContactPoint(contactPointID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, s.getContactPointKey(contactPointID))
+	pipe.SRem(ctx, s.getUserContactPointsKey(contactPoint.TenantID, contactPoint.UserID), contactPointID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete contact point: %w", err)
+	}
+
+	log.Info().Str("contactPointID", contactPointID).Msg("Contact point deleted")
+	return nil
+}
+
+// RequestEmailVerification emails a confirmation link to the address of a
+// contact point
+func (s *NotificationService) RequestEmailVerification(ctx context.Context, contactPointID string) error {
+	contactPoint, err := s.GetContactPoint(contactPointID)
+	if err != nil {
+		return err
+	}
+	if contactPoint.EmailAddress == nil || *contactPoint.EmailAddress == "" {
+		return invalid(fmt.Errorf("contact point has no email address"))
+	}
+	if err := s.reserveVerification(contactPointID, "email"); err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	verificationJSON, err := json.Marshal(emailVerification{
+		ContactPointID: contactPointID,
+		Address:        *contactPoint.EmailAddress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal email verification: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getContactPointLinkKey(token), verificationJSON, contactPointLinkTTL).Err(); err != nil {
+		return fmt.Errorf("failed to store email verification: %w", err)
+	}
+
+	link := strings.TrimRight(s.config.AckBaseURL, "/") + "/api/v1/contact-points/confirm/" + token
+	locale := s.messageLocale(contactPoint.TenantID, RecipientPrefixUser+contactPoint.UserID)
+	_, err = s.emailService.SendEmail(ctx, EmailMessage{
+		To:      []string{*contactPoint.EmailAddress},
+		Subject: i18n.T(locale, i18n.EmailVerificationSubject),
+		Body:    i18n.T(locale, i18n.EmailVerificationText, link),
+		HTMLBody: fmt.Sprintf(`<p>%s</p><p><a href="%s">%s</a></p>`,
+			html.EscapeString(i18n.T(locale, i18n.EmailVerificationHTML)), html.EscapeString(link), html.EscapeString(i18n.T(locale, i18n.EmailVerificationButton))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+	return nil
+}
+
+// ConfirmEmail verifies the email address a confirmation link was sent to
+func (s *NotificationService) ConfirmEmail(token string) (*models.NotificationSubscription, error) {
+	ctx := context.Background()
+	verificationJSON, err := s.redis.Get(ctx, s.getContactPointLinkKey(token)).Result()
+	if err == redis.Nil {
+		return nil, notFoundf("confirmation link is invalid or expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email verification: %w", err)
+	}
+
+	var verification emailVerification
+	if err := json.Unmarshal([]byte(verificationJSON), &verification); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal email verification: %w", err)
+	}
+
+	contactPoint, err := s.GetContactPoint(verification.ContactPointID)
+	if err != nil {
+		return nil, err
+	}
+	if contactPoint.EmailAddress == nil || *contactPoint.EmailAddress != verification.Address {
+		return nil, conflictf("email address changed after the confirmation link was sent")
+	}
+
+	now := time.Now()
+	contactPoint.EmailVerifiedAt = &now
+	contactPoint.UpdatedAt = now
+	if err := s.storeContactPoint(*contactPoint); err != nil {
+		return nil, err
+	}
+	s.redis.Del(ctx, s.getContactPointLinkKey(token))
+
+	log.Info().Str("contactPointID", contactPoint.ID).Msg("Contact point email verified")
+	return contactPoint, nil
+}
+
+// RequestPhoneVerification texts a one-time code to the phone number of a
+// contact point
+func (s *NotificationService) RequestPhoneVerification(ctx context.Context, contactPointID string) error {
+	contactPoint, err := s.GetContactPoint(contactPointID)
+	if err != nil {
+		return err
+	}
+	if contactPoint.PhoneNumber == nil || *contactPoint.PhoneNumber == "" {
+		return invalid(fmt.Errorf("contact point has no phone number"))
+	}
+	if err := s.reserveVerification(contactPointID, "phone"); err != nil {
+		return err
+	}
+
+	_, err = s.SendOTP(ctx, OTPRequest{
+		TenantID:  contactPoint.TenantID,
+		Channel:   "sms",
+		Recipient: *contactPoint.PhoneNumber,
+		Purpose:   contactPointOTPPurpose(contactPointID),
+		Locale:    s.recipientLocale(contactPoint.TenantID, RecipientPrefixUser+contactPoint.UserID),
+	})
+	return err
+}
+
+// ConfirmPhone verifies the phone number of a contact point with the code
+// texted to it
+func (s *NotificationService) ConfirmPhone(ctx context.Context, contactPointID string, code string) (*models.NotificationSubscription, error) {
+	contactPoint, err := s.GetContactPoint(contactPointID)
+	if err != nil {
+		return nil, err
+	}
+	if contactPoint.PhoneNumber == nil || *contactPoint.PhoneNumber == "" {
+		return nil, invalid(fmt.Errorf("contact point has no phone number"))
+	}
+
+	// Codes are sent to the number, one texted before it changed doesn't verify it
+	if err := s.VerifyOTP(ctx, contactPoint.TenantID, *contactPoint.PhoneNumber, contactPointOTPPurpose(contactPointID), code); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	contactPoint.PhoneVerifiedAt = &now
+	contactPoint.UpdatedAt = now
+	if err := s.storeContactPoint(*contactPoint); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("contactPointID", contactPoint.ID).Msg("Contact point phone verified")
+	return contactPoint, nil
+}
+
+// contactPointAddresses returns the verified addresses the contact points of
+// a user give for a channel and category, nil when they give none and the
+// addresses of the user directory are used
+func (s *NotificationService) contactPointAddresses(tenantID string, userID string, channel string, category string) []string {
+	contactPoints, err := s.ListContactPoints(tenantID, userID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to get contact points")
+		return nil
+	}
+
+	var addresses []string
+	for _, contactPoint := range contactPoints {
+		if !coversCategory(contactPoint.Categories, category) {
+			continue
+		}
+
+		var address *string
+		switch channel {
+		case "email", "all":
+			if contactPoint.EmailEnabled && contactPoint.EmailVerifiedAt != nil {
+				address = contactPoint.EmailAddress
+			}
+		case "sms", "voice":
+			if contactPoint.SMSEnabled && contactPoint.PhoneVerifiedAt != nil {
+				address = contactPoint.PhoneNumber
+			}
+		case "push":
+			if contactPoint.PushEnabled {
+				address = contactPoint.PushToken
+			}
+		}
+		if address != nil && *address != "" {
+			addresses = append(addresses, *address)
+		}
+	}
+	return addresses
+}
+
+// storeContactPoint stores a contact point and indexes it by its user
+func (s *NotificationService) storeContactPoint(contactPoint models.NotificationSubscription) error {
+	contactPointJSON, err := json.Marshal(contactPoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal contact point: %w", err)
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getContactPointKey(contactPoint.ID), contactPointJSON, 0)
+	pipe.SAdd(ctx, s.getUserContactPointsKey(contactPoint.TenantID, contactPoint.UserID), contactPoint.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store contact point: %w", err)
+	}
+	return nil
+}
+
+// reserveVerification holds back another verification message to a contact
+// point for a while
+func (s *NotificationService) reserveVerification(contactPointID string, channel string) error {
+	ctx := context.Background()
+	reserved, err := s.redis.SetNX(ctx, s.getContactPointCooldownKey(contactPointID, channel), 1, contactPointSendCooldown).Result()
+	if err != nil {
+		return fmt.Errorf("failed to reserve verification: %w", err)
+	}
+	if !reserved {
+		return conflictf("a verification message was sent less than %s ago", contactPointSendCooldown)
+	}
+	return nil
+}
+
+// normalizeContactPoint validates a contact point and brings its addresses
+// into the form they are compared in
+func normalizeContactPoint(contactPoint *models.NotificationSubscription) error {
+	if contactPoint.UserID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+
+	if contactPoint.EmailAddress != nil {
+		address := strings.ToLower(strings.TrimSpace(*contactPoint.EmailAddress))
+		if address == "" {
+			contactPoint.EmailAddress = nil
+		} else if parsed, err := mail.ParseAddress(address); err != nil || parsed.Address != address {
+			return fmt.Errorf("invalid email address: %s", address)
+		} else {
+			contactPoint.EmailAddress = &address
+		}
+	}
+
+	if contactPoint.PhoneNumber != nil {
+		number := strings.TrimSpace(*contactPoint.PhoneNumber)
+		if number == "" {
+			contactPoint.PhoneNumber = nil
+		} else if !validation.IsPhone(number) {
+			return fmt.Errorf("invalid phone number: %s", number)
+		} else {
+			contactPoint.PhoneNumber = &number
+		}
+	}
+
+	if contactPoint.EmailAddress == nil && contactPoint.PhoneNumber == nil && contactPoint.PushToken == nil {
+		return fmt.Errorf("an email address, phone number or push token is required")
+	}
+
+	if contactPoint.Frequency != "" && !isValidDigestFrequency(contactPoint.Frequency) {
+		return fmt.Errorf("invalid frequency: %s", contactPoint.Frequency)
+	}
+	return nil
+}
+
+// Redis key generators
+func (s *NotificationService) getContactPointKey(contactPointID string) string {
+	return fmt.Sprintf("contact_point:%s", contactPointID)
+}
+
+func (s *NotificationService) getUserContactPointsKey(tenantID string, userID string) string {
+	return fmt.Sprintf("contact_points:%s:%s", tenantID, userID)
+}
+
+func (s *NotificationService) getContactPointLinkKey(token string) string {
+	return fmt.Sprintf("contact_point_link:%s", token)
+}
+
+func (s *NotificationService) getContactPointCooldownKey(contactPointID string, channel string) string {
+	return fmt.Sprintf("contact_point_cooldown:%s:%s", contactPointID, channel)
+}
+
+// Helper functions
+func sameAddress(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func coversCategory(categories []string, category string) bool {
+	if len(categories) == 0 || category == "" {
+		return true
+	}
+	for _, candidate := range categories {
+		if candidate == category {
+			return true
+		}
+	}
+	return false
+}
+
+func contactPointOTPPurpose(contactPointID string) string {
+	return "contact_point:" + contactPointID
+}
+
+func randomToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UpdateCredentials swaps the provider credentials of the email and SMS
+// channels for rotated ones. Sends already talking to a provider finish with
+// the old credentials; every other setting keeps its startup value.
+func (s *NotificationService) UpdateCredentials(email EmailConfig, sms SMSConfig) error {
+	if err := s.emailService.updateCredentials(email); err != nil {
+		return err
+	}
+	s.smsService.updateCredentials(sms)
+
+	log.Info().Msg("Provider credentials updated")
+	return nil
+}
+
+// currentProvider returns the provider emails are sent through
+func (s *EmailService) currentProvider() EmailProvider {
+	s.providerMu.RLock()
+	defer s.providerMu.RUnlock()
+	return s.provider
+}
+
+// updateCredentials creates the provider again with the credentials of config
+func (s *EmailService) updateCredentials(credentials EmailConfig) error {
+	config := s.config
+	config.Username = credentials.Username
+	config.Password = credentials.Password
+	config.APIKey = credentials.APIKey
+	config.APISecret = credentials.APISecret
+	config.WebhookSigningKey = credentials.WebhookSigningKey
+	config.WebhookToken = credentials.WebhookToken
+
+	provider, err := newEmailProvider(config, s.client)
+	if err != nil {
+		return fmt.Errorf("failed to create email provider with rotated credentials: %w", err)
+	}
+
+	s.providerMu.Lock()
+	s.provider = provider
+	s.providerMu.Unlock()
+	return nil
+}
+
+// updateCredentials replaces the credentials of the SMS providers. Providers
+// are created per send, so the next one uses them.
+func (s *SMSService) updateCredentials(credentials SMSConfig) {
+	s.credentialsMu.Lock()
+	defer s.credentialsMu.Unlock()
+
+	s.config.APIKey = credentials.APIKey
+	s.config.APISecret = credentials.APISecret
+	s.config.Providers = credentials.Providers
+}
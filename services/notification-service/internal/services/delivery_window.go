@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/models"
+)
+
+// defaultRecipientTimeZone is the time zone delivery windows are read in for
+// recipients and tenants that set none
+const defaultRecipientTimeZone = "Europe/Istanbul"
+
+// DeliveryWindowError is returned when a send falls outside the delivery
+// window of its tenant in the local time of its recipient
+type DeliveryWindowError struct {
+	Until    time.Time
+	TimeZone string
+}
+
+func (e *DeliveryWindowError) Error() string {
+	return fmt.Sprintf("held for the delivery window until %s (%s)", e.Until.Format(time.RFC3339), e.TimeZone)
+}
+
+// validateDeliveryWindow validates the delivery window of tenant settings
+func validateDeliveryWindow(window models.DeliveryWindow) error {
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return fmt.Errorf("delivery window start: %w", err)
+	}
+	end, err := parseClock(window.End)
+	if err != nil {
+		return fmt.Errorf("delivery window end: %w", err)
+	}
+	if start == end {
+		return fmt.Errorf("delivery window is empty")
+	}
+	for _, day := range window.Days {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("delivery window has an invalid weekday: %d", day)
+		}
+	}
+	if window.Timezone != "" {
+		if _, err := time.LoadLocation(window.Timezone); err != nil {
+			return fmt.Errorf("invalid time zone: %s", window.Timezone)
+		}
+	}
+	return nil
+}
+
+// checkDeliveryWindow returns the error holding back a request when it falls
+// outside the delivery window of its tenant. Urgent notifications and
+// categories the window doesn't cover are never held back.
+func (s *NotificationService) checkDeliveryWindow(ctx context.Context, request NotificationRequest) *DeliveryWindowError {
+	if request.Priority == "urgent" {
+		return nil
+	}
+
+	window := s.tenantSettings(ctx, request.TenantID).DeliveryWindow
+	if window == nil {
+		return nil
+	}
+	if len(window.Categories) > 0 && !containsString(window.Categories, request.Category) {
+		return nil
+	}
+
+	location := s.recipientLocation(ctx, request, window)
+	now := time.Now()
+	slot := nextDeliverySlot(*window, now, location)
+	if !slot.After(now) {
+		return nil
+	}
+
+	return &DeliveryWindowError{Until: slot, TimeZone: location.String()}
+}
+
+// recipientLocation returns the time zone of the recipient of a delivery:
+// the one the user stored in their preferences, the one of their contact,
+// then the one of the window
+func (s *NotificationService) recipientLocation(ctx context.Context, request NotificationRequest, window *models.DeliveryWindow) *time.Location {
+	userID := strings.TrimPrefix(deliveryRecipient(request), RecipientPrefixUser)
+
+	var candidates []string
+	if userID != "" {
+		preferences, err := s.inAppService.GetUserPreferences(ctx, userID, request.TenantID)
+		if err != nil {
+			log.Warn().Err(err).Str("userID", userID).Msg("Failed to get recipient time zone")
+		} else {
+			candidates = append(candidates, preferences.Timezone)
+		}
+	}
+	candidates = append(candidates, request.Timezone, window.Timezone, defaultRecipientTimeZone)
+
+	for _, timezone := range candidates {
+		if timezone == "" {
+			continue
+		}
+		if location, err := time.LoadLocation(timezone); err == nil {
+			return location
+		}
+	}
+	return time.UTC
+}
+
+// nextDeliverySlot returns the earliest time from now on that falls in the
+// window, in the given time zone. Windows ending before they start run past
+// midnight. Local times are built per day, so the window follows daylight
+// saving changes.
+func nextDeliverySlot(window models.DeliveryWindow, now time.Time, location *time.Location) time.Time {
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return now
+	}
+	end, err := parseClock(window.End)
+	if err != nil || start == end {
+		return now
+	}
+
+	local := now.In(location)
+	// The window that opened yesterday may still be open past midnight
+	for offset := -1; offset <= 7; offset++ {
+		opens := time.Date(local.Year(), local.Month(), local.Day()+offset, start/60, start%60, 0, 0, location)
+		if !deliveryDay(window.Days, int(opens.Weekday())) {
+			continue
+		}
+
+		closeDay := local.Day() + offset
+		if end < start {
+			closeDay++
+		}
+		closes := time.Date(local.Year(), local.Month(), closeDay, end/60, end%60, 0, 0, location)
+
+		if !now.Before(opens) && now.Before(closes) {
+			return now
+		}
+		if opens.After(now) {
+			return opens
+		}
+	}
+
+	return now
+}
+
+// deliveryDay reports whether a window opens on a weekday
+func deliveryDay(days []int, weekday int) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, day := range days {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// holdForDeliveryWindow defers a delivery to the next opening of the
+// delivery window. Like deliveries deferred by a circuit breaker, it does not
+// use up its retry budget.
+func (s *NotificationService) holdForDeliveryWindow(request NotificationRequest, result *NotificationResult, cause *DeliveryWindowError) (*NotificationResult, error) {
+	if result == nil {
+		recipient := ""
+		if len(request.Recipients) > 0 {
+			recipient = request.Recipients[0]
+		}
+		result = s.createFailedResult(request, request.Type, recipient, "")
+		result.Attempts = 0
+	}
+
+	// Spread the deliveries held for the window so they do not all go out
+	// the moment it opens
+	sendAt := cause.Until.Add(retryBackoff(s.config.RetryDelay, s.config.MaxRetryDelay, 1))
+	result.Status = "pending"
+	result.Error = cause.Error()
+	result.NextRetryAt = &sendAt
+	result.Metadata = copyMetadata(result.Metadata)
+	result.Metadata["delivery_window_time_zone"] = cause.TimeZone
+
+	if err := s.storeResult(*result); err != nil {
+		return result, fmt.Errorf("failed to store deferred result: %w", err)
+	}
+	if err := s.storeRequestUntil(request, sendAt); err != nil {
+		return result, fmt.Errorf("failed to store deferred request: %w", err)
+	}
+	if err := s.queueNotification(request, result, sendAt); err != nil {
+		return result, fmt.Errorf("failed to queue deferred notification: %w", err)
+	}
+
+	log.Info().
+		Str("resultID", result.ID).
+		Str("timeZone", cause.TimeZone).
+		Time("sendAt", sendAt).
+		Msg("Notification held for the delivery window")
+
+	return result, nil
+}
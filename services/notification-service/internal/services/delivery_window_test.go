@@ -0,0 +1,101 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"claude-talimat-notifications/models"
+)
+
+func TestNextDeliverySlot(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+
+	officeHours := models.DeliveryWindow{Start: "08:00", End: "18:00"}
+	weekdays := models.DeliveryWindow{Start: "08:00", End: "18:00", Days: []int{1, 2, 3, 4, 5}}
+	overnight := models.DeliveryWindow{Start: "22:00", End: "06:00"}
+
+	for _, tc := range []struct {
+		name     string
+		window   models.DeliveryWindow
+		now      time.Time
+		location *time.Location
+		want     time.Time
+	}{
+		{
+			name:     "inside the window",
+			window:   officeHours,
+			now:      time.Date(2026, 6, 10, 9, 30, 0, 0, istanbul),
+			location: istanbul,
+			want:     time.Date(2026, 6, 10, 9, 30, 0, 0, istanbul),
+		},
+		{
+			name:     "before the window",
+			window:   officeHours,
+			now:      time.Date(2026, 6, 10, 6, 0, 0, 0, istanbul),
+			location: istanbul,
+			want:     time.Date(2026, 6, 10, 8, 0, 0, 0, istanbul),
+		},
+		{
+			name:     "after the window",
+			window:   officeHours,
+			now:      time.Date(2026, 6, 10, 18, 0, 0, 0, istanbul),
+			location: istanbul,
+			want:     time.Date(2026, 6, 11, 8, 0, 0, 0, istanbul),
+		},
+		{
+			name:     "in the recipient's time zone",
+			window:   officeHours,
+			now:      time.Date(2026, 6, 10, 10, 0, 0, 0, istanbul),
+			location: newYork,
+			want:     time.Date(2026, 6, 10, 8, 0, 0, 0, newYork),
+		},
+		{
+			name:     "over the start of daylight saving",
+			window:   officeHours,
+			now:      time.Date(2026, 3, 7, 20, 0, 0, 0, newYork),
+			location: newYork,
+			want:     time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "over the end of daylight saving",
+			window:   officeHours,
+			now:      time.Date(2026, 10, 31, 20, 0, 0, 0, newYork),
+			location: newYork,
+			want:     time.Date(2026, 11, 1, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "on the weekend",
+			window:   weekdays,
+			now:      time.Date(2026, 10, 17, 10, 0, 0, 0, istanbul), // Saturday
+			location: istanbul,
+			want:     time.Date(2026, 10, 19, 8, 0, 0, 0, istanbul),
+		},
+		{
+			name:     "past midnight of an overnight window",
+			window:   overnight,
+			now:      time.Date(2026, 6, 10, 2, 0, 0, 0, istanbul),
+			location: istanbul,
+			want:     time.Date(2026, 6, 10, 2, 0, 0, 0, istanbul),
+		},
+		{
+			name:     "before an overnight window",
+			window:   overnight,
+			now:      time.Date(2026, 6, 10, 12, 0, 0, 0, istanbul),
+			location: istanbul,
+			want:     time.Date(2026, 6, 10, 22, 0, 0, 0, istanbul),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextDeliverySlot(tc.window, tc.now, tc.location); !got.Equal(tc.want) {
+				t.Errorf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// Digest frequencies
+const (
+	DigestImmediate = "immediate"
+	DigestHourly    = "hourly"
+	DigestDaily     = "daily"
+	DigestWeekly    = "weekly"
+)
+
+// digestHour is the local hour at which daily and weekly digests are delivered
+const digestHour = 8
+
+// DigestItem represents a notification held back for a digest
+type DigestItem struct {
+	RequestID string                 `json:"request_id"`
+	Title     string                 `json:"title"`
+	Message   string                 `json:"message"`
+	Category  string                 `json:"category"`
+	Priority  string                 `json:"priority"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// digestTarget identifies a pending digest of a user on a channel
+type digestTarget struct {
+	TenantID  string   `json:"tenant_id"`
+	UserID    string   `json:"user_id"`
+	Channel   string   `json:"channel"`
+	Address   string   `json:"address,omitempty"` // of digests queued before they had addresses
+	Addresses []string `json:"addresses,omitempty"`
+	Frequency string   `json:"frequency"`
+}
+
+// digestDelivery holds a delivery back for the recipient's digest when the request
+// is digestible and the recipient prefers digests. It reports whether the delivery
+// was held back.
+func (s *NotificationService) digestDelivery(ctx context.Context, request NotificationRequest, userID string, addresses []string) (*NotificationResult, bool) {
+	// Deliveries that must be acknowledged carry their own token, so they are never merged
+	if !request.Digestible || request.RequireAck || userID == "" {
+		return nil, false
+	}
+	if request.Type != "email" && request.Type != "inapp" {
+		return nil, false
+	}
+
+	preferences, err := s.inAppService.GetUserPreferences(ctx, userID, request.TenantID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to get digest preferences, sending immediately")
+		return nil, false
+	}
+	if preferences.Digest == "" || preferences.Digest == DigestImmediate {
+		return nil, false
+	}
+
+	target := digestTarget{
+		TenantID:  request.TenantID,
+		UserID:    userID,
+		Channel:   request.Type,
+		Addresses: addresses,
+		Frequency: preferences.Digest,
+	}
+
+	timezone := preferences.QuietHours.Timezone
+	dueAt := nextDigestTime(preferences.Digest, timezone, time.Now())
+
+	if err := s.queueDigestItem(target, request, dueAt); err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to queue digest item, sending immediately")
+		return nil, false
+	}
+
+	result := &NotificationResult{
+		ID:          generateNotificationID(),
+		RequestID:   request.ID,
+		Type:        request.Type,
+		Recipient:   strings.Join(addresses, ", "),
+		Status:      "pending",
+		MaxAttempts: s.maxAttempts(request.TenantID, request.Type),
+		Metadata:    copyMetadata(request.Metadata),
+		CallbackURL: request.CallbackURL,
+		TenantID:    request.TenantID,
+		Category:    request.Category,
+		Priority:    request.Priority,
+		CreatedAt:   request.CreatedAt,
+		searchText:  historyText(request),
+	}
+	result.Metadata["digest"] = preferences.Digest
+	result.Metadata["digest_due_at"] = dueAt
+
+	log.Debug().
+		Str("requestID", request.ID).
+		Str("userID", userID).
+		Str("frequency", preferences.Digest).
+		Msg("Notification held for digest")
+
+	return result, true
+}
+
+// queueDigestItem appends a notification to a user's pending digest
+func (s *NotificationService) queueDigestItem(target digestTarget, request NotificationRequest, dueAt time.Time) error {
+	ctx := context.Background()
+
+	item := DigestItem{
+		RequestID: request.ID,
+		Title:     request.Title,
+		Message:   request.Message,
+		Category:  request.Category,
+		Priority:  request.Priority,
+		Metadata:  request.Metadata,
+		CreatedAt: request.CreatedAt,
+	}
+	if item.Title == "" {
+		item.Title = request.Subject
+	}
+
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest item: %w", err)
+	}
+
+	targetJSON, err := json.Marshal(target)
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest target: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.RPush(ctx, s.getDigestKey(target.TenantID, target.UserID, target.Channel), itemJSON)
+	// Keep the earliest due time when the digest is already pending
+	pipe.ZAddNX(ctx, s.getDigestDueKey(), &redis.Z{
+		Score:  float64(dueAt.Unix()),
+		Member: string(targetJSON),
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to queue digest item: %w", err)
+	}
+
+	return nil
+}
+
+// startDigestFlusher periodically flushes digests that are due
+func (s *NotificationService) startDigestFlusher() {
+	log.Info().Dur("interval", s.config.DigestInterval).Msg("Digest flusher started")
+
+	ticker := time.NewTicker(s.config.DigestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Digest flusher stopped")
+			return
+		case <-ticker.C:
+			s.flushDueDigests()
+		}
+	}
+}
+
+// flushDueDigests sends every digest whose due time has passed
+func (s *NotificationService) flushDueDigests() {
+	ctx := context.Background()
+	dueKey := s.getDigestDueKey()
+
+	members, err := s.redis.ZRangeByScore(ctx, dueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return
+	}
+
+	for _, member := range members {
+		// Only one instance wins the right to flush the digest
+		removed, err := s.redis.ZRem(ctx, dueKey, member).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		var target digestTarget
+		if err := json.Unmarshal([]byte(member), &target); err != nil {
+			log.Error().Err(err).Msg("Failed to parse digest target")
+			continue
+		}
+
+		if err := s.flushDigest(target); err != nil {
+			log.Error().
+				Err(err).
+				Str("userID", target.UserID).
+				Str("channel", target.Channel).
+				Msg("Failed to flush digest")
+		}
+	}
+}
+
+// flushDigest sends the accumulated notifications of a user as a single message
+func (s *NotificationService) flushDigest(target digestTarget) error {
+	ctx := context.Background()
+	key := s.getDigestKey(target.TenantID, target.UserID, target.Channel)
+
+	pipe := s.redis.TxPipeline()
+	itemsCmd := pipe.LRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to read digest items: %w", err)
+	}
+
+	var items []DigestItem
+	for _, itemJSON := range itemsCmd.Val() {
+		var item DigestItem
+		if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	// Cap the number of items rendered in a single digest
+	total := len(items)
+	if len(items) > s.config.DigestMaxItems {
+		items = items[len(items)-s.config.DigestMaxItems:]
+	}
+
+	addresses := target.Addresses
+	if len(addresses) == 0 && target.Address != "" {
+		addresses = []string{target.Address}
+	}
+
+	// Digests are titled in the locale of their user
+	recipient := strings.Join(addresses, ", ")
+	if target.UserID != "" {
+		recipient = RecipientPrefixUser + target.UserID
+	}
+	locale := s.messageLocale(target.TenantID, recipient)
+
+	switch target.Channel {
+	case "email":
+		if _, err := s.emailService.SendNotificationDigest(ctx, target.TenantID, addresses, digestTitle(locale, target.Frequency, total), items); err != nil {
+			return fmt.Errorf("failed to send digest email: %w", err)
+		}
+	case "inapp":
+		var titles []string
+		for _, item := range items {
+			titles = append(titles, item.Title)
+		}
+
+		notification := InAppNotification{
+			UserID:   target.UserID,
+			TenantID: target.TenantID,
+			Type:     "digest",
+			Title:    digestTitle(locale, target.Frequency, total),
+			Message:  strings.Join(titles, "\n"),
+			Data: map[string]interface{}{
+				"items": items,
+				"total": total,
+			},
+			Priority:  "normal",
+			Category:  "digest",
+			CreatedAt: time.Now(),
+		}
+
+		if _, err := s.inAppService.CreateNotification(ctx, notification); err != nil {
+			return fmt.Errorf("failed to create digest notification: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported digest channel: %s", target.Channel)
+	}
+
+	log.Info().
+		Str("userID", target.UserID).
+		Str("channel", target.Channel).
+		Int("itemCount", total).
+		Msg("Digest flushed")
+
+	return nil
+}
+
+// Redis key generators
+func (s *NotificationService) getDigestKey(tenantID string, userID string, channel string) string {
+	return fmt.Sprintf("digest:%s:%s:%s", tenantID, userID, channel)
+}
+
+func (s *NotificationService) getDigestDueKey() string {
+	return "digest_due"
+}
+
+// Helper functions
+func isValidDigestFrequency(frequency string) bool {
+	switch frequency {
+	case DigestImmediate, DigestHourly, DigestDaily, DigestWeekly:
+		return true
+	}
+	return false
+}
+
+// nextDigestTime returns when a digest of the given frequency started now is due.
+// Daily and weekly digests are delivered in the morning of the user's timezone.
+func nextDigestTime(frequency string, timezone string, now time.Time) time.Time {
+	location, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" {
+		location = time.UTC
+	}
+	local := now.In(location)
+
+	switch frequency {
+	case DigestHourly:
+		return local.Truncate(time.Hour).Add(time.Hour)
+	case DigestDaily:
+		next := time.Date(local.Year(), local.Month(), local.Day(), digestHour, 0, 0, 0, location)
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	case DigestWeekly:
+		next := time.Date(local.Year(), local.Month(), local.Day(), digestHour, 0, 0, 0, location)
+		daysUntilMonday := (int(time.Monday) - int(local.Weekday()) + 7) % 7
+		next = next.AddDate(0, 0, daysUntilMonday)
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	default:
+		return now
+	}
+}
+
+// digestTitle names a digest of a number of notifications
+func digestTitle(locale string, frequency string, count int) string {
+	key := i18n.DigestDaily
+	switch frequency {
+	case DigestHourly:
+		key = i18n.DigestHourly
+	case DigestWeekly:
+		key = i18n.DigestWeekly
+	}
+	return i18n.T(locale, i18n.DigestTitle, i18n.T(locale, key), count)
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setDigestPreference makes a user of tenant-a prefer digests of frequency
+func setDigestPreference(t *testing.T, env *integrationEnv, userID string, frequency string) {
+	t.Helper()
+
+	if _, err := env.service.inAppService.UpdateUserPreferences(context.Background(), userID, "tenant-a", map[string]interface{}{"digest": frequency}); err != nil {
+		t.Fatalf("Failed to set digest preference: %v", err)
+	}
+}
+
+// dueDigests returns the pending digests, making them due
+func dueDigests(t *testing.T, env *integrationEnv) []string {
+	t.Helper()
+
+	key := env.service.getDigestDueKey()
+	members, err := env.service.redis.ZRange(context.Background(), key, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("Failed to get pending digests: %v", err)
+	}
+	for _, member := range members {
+		makeDue(t, env, key, member)
+	}
+	return members
+}
+
+func TestDigestsAreDueAtTheNextPeriod(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	// A Wednesday afternoon in Istanbul
+	now := time.Date(2026, time.March, 11, 14, 20, 0, 0, istanbul)
+
+	for name, test := range map[string]struct {
+		frequency string
+		timezone  string
+		now       time.Time
+		expected  time.Time
+	}{
+		"hourly":                  {DigestHourly, "Europe/Istanbul", now, time.Date(2026, time.March, 11, 15, 0, 0, 0, istanbul)},
+		"daily after the morning": {DigestDaily, "Europe/Istanbul", now, time.Date(2026, time.March, 12, 8, 0, 0, 0, istanbul)},
+		"daily before it":         {DigestDaily, "Europe/Istanbul", now.Add(-7 * time.Hour), time.Date(2026, time.March, 11, 8, 0, 0, 0, istanbul)},
+		"daily at it":             {DigestDaily, "Europe/Istanbul", now.Add(-6*time.Hour - 20*time.Minute), time.Date(2026, time.March, 12, 8, 0, 0, 0, istanbul)},
+		"daily in UTC":            {DigestDaily, "", now, time.Date(2026, time.March, 12, 8, 0, 0, 0, time.UTC)},
+		"daily, unknown zone":     {DigestDaily, "Mars/Olympus", now, time.Date(2026, time.March, 12, 8, 0, 0, 0, time.UTC)},
+		"weekly":                  {DigestWeekly, "Europe/Istanbul", now, time.Date(2026, time.March, 16, 8, 0, 0, 0, istanbul)},
+		"weekly on monday after":  {DigestWeekly, "Europe/Istanbul", now.AddDate(0, 0, 5), time.Date(2026, time.March, 23, 8, 0, 0, 0, istanbul)},
+		"weekly on monday before": {DigestWeekly, "Europe/Istanbul", now.Add(5*24*time.Hour - 7*time.Hour), time.Date(2026, time.March, 16, 8, 0, 0, 0, istanbul)},
+		"immediate":               {DigestImmediate, "Europe/Istanbul", now, now},
+	} {
+		if due := nextDigestTime(test.frequency, test.timezone, test.now); !due.Equal(test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, due)
+		}
+	}
+}
+
+func TestDigestibleDeliveriesAreHeldForTheDigest(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	setDigestPreference(t, env, "user-1", DigestDaily)
+
+	send := func(request NotificationRequest) *NotificationResult {
+		request.Type = "inapp"
+		request.Recipients = []string{"user-1"}
+		request.TenantID = "tenant-a"
+		result, err := env.service.SendNotification(ctx, request)
+		if err != nil {
+			t.Fatalf("Failed to send %s: %v", request.Title, err)
+		}
+		return result
+	}
+
+	for _, title := range []string{"Yeni talimat yayınlandı", "Eğitim hatırlatması", "Anket sonuçları"} {
+		result := send(NotificationRequest{Title: title, Message: title, Category: "training", Digestible: true})
+		if result.Status != "pending" || result.Metadata["digest"] != DigestDaily || result.Metadata["digest_due_at"] == nil {
+			t.Errorf("Expected %s to be held for the daily digest, got %s %v", title, result.Status, result.Metadata)
+		}
+	}
+
+	// Deliveries that aren't digestible, or must be acknowledged, go out right away
+	send(NotificationRequest{Title: "Yangın alarmı", Message: "Binayı boşaltın", Category: "safety"})
+	send(NotificationRequest{Title: "Talimatı onaylayın", Message: "Onaylayın", Category: "safety", Digestible: true, RequireAck: true})
+
+	_, total, _ := inboxOf(t, env)
+	if total != 2 {
+		t.Errorf("Expected only the immediate notifications in the inbox, got %d", total)
+	}
+	if pending := env.service.redis.LLen(ctx, env.service.getDigestKey("tenant-a", "user-1", "inapp")).Val(); pending != 3 {
+		t.Errorf("Expected 3 notifications in the digest, got %d", pending)
+	}
+	if due := dueDigests(t, env); len(due) != 1 {
+		t.Fatalf("Expected one pending digest, got %v", due)
+	}
+
+	env.service.config.DigestMaxItems = 2
+	env.service.flushDueDigests()
+
+	notifications, total, err := env.service.inAppService.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, nil)
+	if err != nil || total != 3 {
+		t.Fatalf("Expected the digest in the inbox, got %d (%v)", total, err)
+	}
+	digest := notifications[0]
+	if digest.Type != "digest" || digest.Title != "Günlük Bildirim Özeti - 3 yeni bildirim" {
+		t.Errorf("Expected the daily digest of 3 notifications, got %s %q", digest.Type, digest.Title)
+	}
+	// Only the latest items are rendered
+	if digest.Message != "Eğitim hatırlatması\nAnket sonuçları" {
+		t.Errorf("Expected the 2 latest notifications in the digest, got %q", digest.Message)
+	}
+
+	env.service.flushDueDigests()
+	if _, total, _ := inboxOf(t, env); total != 3 {
+		t.Errorf("Expected the digest to be sent once, got %d notifications", total)
+	}
+	if exists := env.service.redis.Exists(ctx, env.service.getDigestKey("tenant-a", "user-1", "inapp")).Val(); exists != 0 {
+		t.Errorf("Expected the flushed digest to be emptied")
+	}
+}
+
+func TestEmailDigestsAreSentToTheUsersAddress(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	recipients := env.service.recipients
+	contact := &UserContact{ID: "user-2", TenantID: "tenant-a", Email: "selin@talimat.test", Locale: "en", IsActive: true}
+	recipients.cache(recipients.getContactKey("tenant-a", contact.ID), contact)
+	setDigestPreference(t, env, "user-2", DigestWeekly)
+
+	for _, title := range []string{"New instruction", "Training reminder"} {
+		result, err := env.service.SendNotification(ctx, NotificationRequest{
+			Type:       "email",
+			Recipients: []string{"user:user-2"},
+			Subject:    title,
+			Message:    title,
+			TenantID:   "tenant-a",
+			Digestible: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if result.Metadata["sent_count"] != 0 {
+			t.Errorf("Expected %s to be held for the digest, got %v", title, result.Metadata)
+		}
+	}
+
+	// Both wait in a single digest
+	due := dueDigests(t, env)
+	if len(due) != 1 || !strings.Contains(due[0], `"addresses":["selin@talimat.test"]`) {
+		t.Fatalf("Expected one digest to the address of the user, got %v", due)
+	}
+	if sent := env.smtp.sent(); len(sent) != 0 {
+		t.Fatalf("Expected nothing to be sent before the digest, got %d emails", len(sent))
+	}
+
+	env.service.flushDueDigests()
+	eventually(t, "the digest email", func() bool { return len(env.smtp.sent()) == 1 })
+	email := env.smtp.sent()[0]
+	if len(email.To) != 1 || email.To[0] != "selin@talimat.test" {
+		t.Errorf("Expected the digest to be sent to the user, got %v", email.To)
+	}
+	if !strings.Contains(email.Data, "Subject: Weekly Notification Digest - 2 new notifications") {
+		t.Errorf("Expected the digest to be titled in the language of the user, got\n%s", email.Data)
+	}
+	for _, title := range []string{"New instruction", "Training reminder"} {
+		if !strings.Contains(email.Data, title) {
+			t.Errorf("Expected the digest to list %s, got\n%s", title, email.Data)
+		}
+	}
+}
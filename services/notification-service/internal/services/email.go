@@ -2,20 +2,27 @@ package services
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"fmt"
-	"html/template"
-	"io"
+	"net/http"
 	"strings"
+	"sync"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/rs/zerolog/log"
-	"gopkg.in/gomail.v2"
+	"golang.org/x/sync/errgroup"
 )
 
 // EmailService handles email notifications
 type EmailService struct {
-	config EmailConfig
+	config     EmailConfig
+	provider   EmailProvider
+	providerMu sync.RWMutex // guards provider, replaced when credentials rotate
+	templates  *emailTemplateStore
+	client     *http.Client
+	scanner    AttachmentScanner
+	bulk       *workerPool // bounds the emails of bulk sends in flight
 }
 
 // EmailConfig holds email service configuration
@@ -28,6 +35,44 @@ type EmailConfig struct {
 	FromName string
 	UseTLS   bool
 	UseSSL   bool
+	DryRun   bool
+	// Provider selects the delivery service: smtp, sendgrid, ses or
+	// mailgun. The SMTP settings above are only used by smtp.
+	Provider string
+	// APIKey and APISecret are the API credentials of the provider, the
+	// access key ID and secret access key for SES
+	APIKey    string
+	APISecret string
+	Region    string // SES region, e.g. eu-central-1
+	Domain    string // Mailgun sending domain
+	BaseURL   string // overrides the API endpoint of the provider
+	// WebhookSigningKey verifies bounce and complaint posts: the SendGrid
+	// verification key or the Mailgun webhook signing key. SES posts carry
+	// WebhookToken in the URL of the SNS subscription instead.
+	WebhookSigningKey string
+	WebhookToken      string
+	// TemplatesDir holds the email templates overriding the built-in ones,
+	// changes are picked up every TemplateReloadInterval
+	TemplatesDir           string
+	TemplateReloadInterval time.Duration
+	// MJMLCommand compiles .mjml templates and layouts, e.g. mjml -i -s
+	MJMLCommand string
+	// Attachments given by reference are fetched when the email is sent,
+	// each up to MaxAttachmentSize bytes and all up to MaxAttachmentsSize.
+	// http(s) URLs are only fetched from AttachmentHosts.
+	MaxAttachmentSize     int64
+	MaxAttachmentsSize    int64
+	AttachmentHosts       []string
+	AttachmentS3Endpoint  string // S3 or MinIO endpoint s3:// URLs are fetched from, AWS when empty
+	AttachmentS3Region    string
+	AttachmentS3AccessKey string
+	AttachmentS3SecretKey string
+	DocumentServiceURL    string // document service document_id attachments are fetched from
+	DocumentServiceToken  string
+	ClamAVAddress         string // clamd attachments are scanned with, e.g. clamav:3310
+	// BulkConcurrency is how many emails of bulk sends are sent at once,
+	// across all bulk sends of the instance
+	BulkConcurrency int
 }
 
 // EmailMessage represents an email message
@@ -42,11 +87,18 @@ type EmailMessage struct {
 	Headers     map[string]string
 }
 
-// EmailAttachment represents an email attachment
+// EmailAttachment represents an email attachment. Its content is given as
+// Data or by reference: URL is an s3:// or http(s) URL and DocumentID a
+// document of the document service, both fetched when the email is sent.
 type EmailAttachment struct {
-	Name        string
-	ContentType string
-	Data        []byte
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+	URL         string `json:"url,omitempty"`
+	DocumentID  string `json:"document_id,omitempty"`
+
+	path string // temporary file holding the fetched content
+	size int64
 }
 
 // EmailTemplate represents an email template
@@ -55,130 +107,137 @@ type EmailTemplate struct {
 	Subject string
 	HTML    string
 	Text    string
+	Layout  string // layout the HTML is wrapped in, base when empty, none for none
 }
 
 // EmailResult represents the result of sending an email
 type EmailResult struct {
-	MessageID string
+	MessageID string // the ID the provider assigned the message
+	Provider  string
 	SentAt    time.Time
 	Success   bool
 	Error     string
+	Simulated bool // dry run, nothing was sent
 }
 
 // NewEmailService creates a new email service instance
-func NewEmailService(config EmailConfig) *EmailService {
-	return &EmailService{
-		config: config,
+func NewEmailService(config EmailConfig) (*EmailService, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	provider, err := newEmailProvider(config, client)
+	if err != nil {
+		return nil, err
+	}
+
+	var scanner AttachmentScanner
+	if config.ClamAVAddress != "" {
+		scanner = &clamAVScanner{address: config.ClamAVAddress, timeout: time.Minute}
 	}
+	if config.BulkConcurrency == 0 {
+		config.BulkConcurrency = 10
+	}
+
+	return &EmailService{
+		config:   config,
+		provider: provider,
+		client:   client,
+		scanner:  scanner,
+		bulk:     newWorkerPool("email_bulk", config.BulkConcurrency),
+		templates: newEmailTemplateStore(
+			config.TemplatesDir,
+			config.TemplateReloadInterval,
+			config.MJMLCommand,
+		),
+	}, nil
 }
 
 // SendEmail sends a single email
-func (s *EmailService) SendEmail(message EmailMessage) (*EmailResult, error) {
+func (s *EmailService) SendEmail(ctx context.Context, message EmailMessage) (*EmailResult, error) {
 	log.Info().
 		Str("to", strings.Join(message.To, ",")).
 		Str("subject", message.Subject).
 		Msg("Sending email")
 
-	// Create gomail message
-	m := gomail.NewMessage()
-
-	// Set headers
-	m.SetHeader("From", fmt.Sprintf("%s <%s>", s.config.FromName, s.config.From))
-	m.SetHeader("To", message.To...)
-	if len(message.Cc) > 0 {
-		m.SetHeader("Cc", message.Cc...)
-	}
-	if len(message.Bcc) > 0 {
-		m.SetHeader("Bcc", message.Bcc...)
-	}
-	m.SetHeader("Subject", message.Subject)
-
-	// Set custom headers
-	for key, value := range message.Headers {
-		m.SetHeader(key, value)
+	// Every email gets a plain text part for clients that don't show HTML
+	if message.Body == "" && message.HTMLBody != "" {
+		message.Body = htmlToText(message.HTMLBody)
 	}
 
-	// Set body
-	if message.HTMLBody != "" {
-		m.SetBody("text/html", message.HTMLBody)
-		if message.Body != "" {
-			m.AddAlternative("text/plain", message.Body)
-		}
-	} else {
-		m.SetBody("text/plain", message.Body)
-	}
-
-	// Add attachments
-	for _, attachment := range message.Attachments {
-		m.Attach(attachment.Name, gomail.SetCopyFunc(func(w io.Writer) error {
-			_, err := w.Write(attachment.Data)
-			return err
-		}))
+	if s.config.DryRun {
+		log.Info().
+			Str("to", strings.Join(message.To, ",")).
+			Msg("Email dry run, email not sent")
+		return &EmailResult{
+			MessageID: generateMessageID(),
+			SentAt:    time.Now(),
+			Success:   true,
+			Simulated: true,
+		}, nil
 	}
 
-	// Create dialer
-	dialer := gomail.NewDialer(s.config.Host, s.config.Port, s.config.Username, s.config.Password)
+	provider := s.currentProvider()
 
-	if s.config.UseTLS {
-		dialer.TLSConfig = &tls.Config{InsecureSkipVerify: false}
-	}
-	if s.config.UseSSL {
-		dialer.SSL = true
-	}
-
-	// Send email
-	if err := dialer.DialAndSend(m); err != nil {
-		log.Error().Err(err).Msg("Failed to send email")
+	attachments, cleanup, err := s.prepareAttachments(ctx, message.Attachments)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to prepare email attachments")
 		return &EmailResult{
-			Success: false,
-			Error:   err.Error(),
+			Provider: provider.Name(),
+			Success:  false,
+			Error:    err.Error(),
 		}, err
 	}
+	defer cleanup()
+	message.Attachments = attachments
 
-	result := &EmailResult{
-		MessageID: generateMessageID(),
-		SentAt:    time.Now(),
-		Success:   true,
+	result, err := provider.Send(ctx, message)
+	if err != nil {
+		log.Error().Err(err).Str("provider", provider.Name()).Msg("Failed to send email")
+		return &EmailResult{
+			Provider: provider.Name(),
+			Success:  false,
+			Error:    err.Error(),
+		}, err
 	}
 
 	log.Info().
 		Str("messageID", result.MessageID).
+		Str("provider", result.Provider).
 		Msg("Email sent successfully")
 
 	return result, nil
 }
 
 // SendBulkEmail sends emails to multiple recipients
-func (s *EmailService) SendBulkEmail(messages []EmailMessage) ([]*EmailResult, error) {
+func (s *EmailService) SendBulkEmail(ctx context.Context, messages []EmailMessage) ([]*EmailResult, error) {
 	log.Info().Int("count", len(messages)).Msg("Sending bulk emails")
 
-	var results []*EmailResult
-	var errors []error
-
-	// Send emails concurrently (limit concurrency to avoid overwhelming SMTP server)
-	semaphore := make(chan struct{}, 10) // Max 10 concurrent sends
-	resultsChan := make(chan *EmailResult, len(messages))
-
-	for _, message := range messages {
-		go func(msg EmailMessage) {
-			semaphore <- struct{}{}        // Acquire semaphore
-			defer func() { <-semaphore }() // Release semaphore
-
-			result, err := s.SendEmail(msg)
+	// Every email of the send takes a worker of the bulk pool, so neither a
+	// large send nor many sends at once overwhelm the provider
+	results := make([]*EmailResult, len(messages))
+	var group errgroup.Group
+	group.SetLimit(s.config.BulkConcurrency)
+
+	for i, message := range messages {
+		i, message := i, message
+		group.Go(func() error {
+			var result *EmailResult
+			var err error
+			if poolErr := s.bulk.Do(ctx, func() { result, err = s.SendEmail(ctx, message) }); poolErr != nil {
+				err = poolErr
+			}
 			if err != nil {
 				result = &EmailResult{
 					Success: false,
 					Error:   err.Error(),
 				}
 			}
-			resultsChan <- result
-		}(message)
+			results[i] = result
+			return nil
+		})
 	}
+	group.Wait()
 
-	// Collect results
-	for i := 0; i < len(messages); i++ {
-		result := <-resultsChan
-		results = append(results, result)
+	var errors []error
+	for i, result := range results {
 		if !result.Success {
 			errors = append(errors, fmt.Errorf("email %d failed: %s", i, result.Error))
 		}
@@ -195,23 +254,41 @@ func (s *EmailService) SendBulkEmail(messages []EmailMessage) ([]*EmailResult, e
 
 // SendTemplatedEmail sends an email using a template
 func (s *EmailService) SendTemplatedEmail(
+	ctx context.Context,
+	to []string,
+	templateName string,
+	templateData map[string]interface{},
+	subject string,
+) (*EmailResult, error) {
+	return s.SendTenantTemplatedEmail(ctx, "", to, templateName, templateData, subject)
+}
+
+// SendTenantTemplatedEmail sends an email using a template of a tenant. An
+// empty subject uses the subject of the template.
+func (s *EmailService) SendTenantTemplatedEmail(
+	ctx context.Context,
+	tenantID string,
 	to []string,
 	templateName string,
 	templateData map[string]interface{},
 	subject string,
 ) (*EmailResult, error) {
 	// Load template
-	tmpl, err := s.loadTemplate(templateName)
+	tmpl, err := s.loadTemplate(tenantID, templateName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load template %s: %w", templateName, err)
 	}
 
 	// Render template
-	htmlBody, textBody, err := s.renderTemplate(tmpl, templateData)
+	htmlBody, textBody, err := s.renderTemplate(tenantID, tmpl, templateData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render template: %w", err)
 	}
 
+	if subject == "" {
+		subject = tmpl.Subject
+	}
+
 	message := EmailMessage{
 		To:       to,
 		Subject:  subject,
@@ -219,11 +296,11 @@ func (s *EmailService) SendTemplatedEmail(
 		Body:     textBody,
 	}
 
-	return s.SendEmail(message)
+	return s.SendEmail(ctx, message)
 }
 
 // SendWelcomeEmail sends a welcome email to new users
-func (s *EmailService) SendWelcomeEmail(to string, userName string, companyName string) (*EmailResult, error) {
+func (s *EmailService) SendWelcomeEmail(ctx context.Context, to string, userName string, companyName string) (*EmailResult, error) {
 	templateData := map[string]interface{}{
 		"UserName":     userName,
 		"CompanyName":  companyName,
@@ -232,6 +309,7 @@ func (s *EmailService) SendWelcomeEmail(to string, userName string, companyName
 	}
 
 	return s.SendTemplatedEmail(
+		ctx,
 		[]string{to},
 		"welcome",
 		templateData,
@@ -240,7 +318,7 @@ func (s *EmailService) SendWelcomeEmail(to string, userName string, companyName
 }
 
 // SendPasswordResetEmail sends a password reset email
-func (s *EmailService) SendPasswordResetEmail(to string, resetToken string, userName string) (*EmailResult, error) {
+func (s *EmailService) SendPasswordResetEmail(ctx context.Context, to string, resetToken string, userName string) (*EmailResult, error) {
 	resetURL := fmt.Sprintf("https://app.claude-talimat.com/reset-password?token=%s", resetToken)
 
 	templateData := map[string]interface{}{
@@ -250,6 +328,7 @@ func (s *EmailService) SendPasswordResetEmail(to string, resetToken string, user
 	}
 
 	return s.SendTemplatedEmail(
+		ctx,
 		[]string{to},
 		"password_reset",
 		templateData,
@@ -259,6 +338,7 @@ func (s *EmailService) SendPasswordResetEmail(to string, resetToken string, user
 
 // SendDocumentNotification sends a notification about a document
 func (s *EmailService) SendDocumentNotification(
+	ctx context.Context,
 	to []string,
 	documentTitle string,
 	documentType string,
@@ -274,6 +354,7 @@ func (s *EmailService) SendDocumentNotification(
 	}
 
 	return s.SendTemplatedEmail(
+		ctx,
 		to,
 		"document_notification",
 		templateData,
@@ -283,6 +364,7 @@ func (s *EmailService) SendDocumentNotification(
 
 // SendComplianceAlert sends a compliance alert email
 func (s *EmailService) SendComplianceAlert(
+	ctx context.Context,
 	to []string,
 	alertType string,
 	description string,
@@ -299,6 +381,7 @@ func (s *EmailService) SendComplianceAlert(
 	}
 
 	return s.SendTemplatedEmail(
+		ctx,
 		to,
 		"compliance_alert",
 		templateData,
@@ -308,6 +391,7 @@ func (s *EmailService) SendComplianceAlert(
 
 // SendDailyDigest sends a daily digest email
 func (s *EmailService) SendDailyDigest(
+	ctx context.Context,
 	to []string,
 	digestData map[string]interface{},
 ) (*EmailResult, error) {
@@ -318,6 +402,7 @@ func (s *EmailService) SendDailyDigest(
 	}
 
 	return s.SendTemplatedEmail(
+		ctx,
 		to,
 		"daily_digest",
 		templateData,
@@ -327,6 +412,7 @@ func (s *EmailService) SendDailyDigest(
 
 // SendWeeklyReport sends a weekly report email
 func (s *EmailService) SendWeeklyReport(
+	ctx context.Context,
 	to []string,
 	reportData map[string]interface{},
 ) (*EmailResult, error) {
@@ -338,6 +424,7 @@ func (s *EmailService) SendWeeklyReport(
 	}
 
 	return s.SendTemplatedEmail(
+		ctx,
 		to,
 		"weekly_report",
 		templateData,
@@ -345,6 +432,31 @@ func (s *EmailService) SendWeeklyReport(
 	)
 }
 
+// SendNotificationDigest sends a summary of accumulated notifications
+func (s *EmailService) SendNotificationDigest(
+	ctx context.Context,
+	tenantID string,
+	to []string,
+	subject string,
+	items []DigestItem,
+) (*EmailResult, error) {
+	templateData := map[string]interface{}{
+		"Date":             time.Now().Format("02.01.2006"),
+		"Count":            len(items),
+		"Items":            items,
+		"NotificationsURL": "https://app.claude-talimat.com/notifications",
+	}
+
+	return s.SendTenantTemplatedEmail(
+		ctx,
+		tenantID,
+		to,
+		"notification_digest",
+		templateData,
+		subject,
+	)
+}
+
 // TestConnection tests the email service connection
 func (s *EmailService) TestConnection() error {
 	log.Info().Msg("Testing email service connection")
@@ -357,7 +469,7 @@ func (s *EmailService) TestConnection() error {
 	}
 
 	// Try to send
-	_, err := s.SendEmail(testMessage)
+	_, err := s.SendEmail(context.Background(), testMessage)
 	if err != nil {
 		log.Error().Err(err).Msg("Email service connection test failed")
 		return fmt.Errorf("connection test failed: %w", err)
@@ -382,75 +494,34 @@ func (s *EmailService) GetQuotaInfo() (map[string]interface{}, error) {
 	return quotaInfo, nil
 }
 
-// loadTemplate loads an email template
-func (s *EmailService) loadTemplate(templateName string) (*EmailTemplate, error) {
-	// In a real implementation, load templates from database or filesystem
-	// For now, return a basic template
-	templates := map[string]*EmailTemplate{
-		"welcome": {
-			Name:    "welcome",
-			Subject: "Hoş Geldiniz",
-			HTML:    `<h1>Hoş Geldiniz {{.UserName}}!</h1><p>{{.CompanyName}} ailesine katıldığınız için teşekkürler.</p>`,
-			Text:    "Hoş Geldiniz {{.UserName}}! {{.CompanyName}} ailesine katıldığınız için teşekkürler.",
-		},
-		"password_reset": {
-			Name:    "password_reset",
-			Subject: "Şifre Sıfırlama",
-			HTML:    `<h1>Şifre Sıfırlama</h1><p>Şifrenizi sıfırlamak için <a href="{{.ResetURL}}">buraya tıklayın</a>.</p>`,
-			Text:    "Şifre Sıfırlama\n\nŞifrenizi sıfırlamak için: {{.ResetURL}}",
-		},
-		"document_notification": {
-			Name:    "document_notification",
-			Subject: "Doküman Bildirimi",
-			HTML:    `<h1>Doküman {{.Action}}</h1><p>{{.DocumentTitle}} dokümanı {{.Action}}.</p>`,
-			Text:    "Doküman {{.Action}}\n\n{{.DocumentTitle}} dokümanı {{.Action}}.",
-		},
-		"compliance_alert": {
-			Name:    "compliance_alert",
-			Subject: "Uyumluluk Uyarısı",
-			HTML:    `<h1>Uyumluluk Uyarısı</h1><p>{{.Description}}</p><p>Gerekli Aksiyon: {{.ActionRequired}}</p>`,
-			Text:    "Uyumluluk Uyarısı\n\n{{.Description}}\n\nGerekli Aksiyon: {{.ActionRequired}}",
-		},
-		"daily_digest": {
-			Name:    "daily_digest",
-			Subject: "Günlük Özet",
-			HTML:    `<h1>Günlük Özet - {{.Date}}</h1><p>Bugünkü aktiviteleri görüntüleyin.</p>`,
-			Text:    "Günlük Özet - {{.Date}}\n\nBugünkü aktiviteleri görüntüleyin.",
-		},
-		"weekly_report": {
-			Name:    "weekly_report",
-			Subject: "Haftalık Rapor",
-			HTML:    `<h1>Haftalık Rapor</h1><p>{{.WeekStart}} - {{.WeekEnd}} arası rapor.</p>`,
-			Text:    "Haftalık Rapor\n\n{{.WeekStart}} - {{.WeekEnd}} arası rapor.",
-		},
-	}
-
-	template, exists := templates[templateName]
-	if !exists {
-		return nil, fmt.Errorf("template %s not found", templateName)
-	}
-
-	return template, nil
+// loadTemplate loads an email template, the tenant's own version when it has one
+func (s *EmailService) loadTemplate(tenantID string, templateName string) (*EmailTemplate, error) {
+	return s.templates.get(tenantID, templateName)
 }
 
-// renderTemplate renders a template with data
+// renderTemplate renders a template with data, the HTML inside its layout. A
+// template without a text version gets one derived from its HTML.
 func (s *EmailService) renderTemplate(
+	tenantID string,
 	tmpl *EmailTemplate,
 	data map[string]interface{},
 ) (string, string, error) {
 	// Render HTML template
-	htmlTemplate, err := template.New("html").Parse(tmpl.HTML)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to parse HTML template: %w", err)
+	var htmlBody string
+	if tmpl.HTML != "" {
+		rendered, err := s.renderHTML(tenantID, tmpl, data)
+		if err != nil {
+			return "", "", err
+		}
+		htmlBody = rendered
 	}
 
-	var htmlBuffer bytes.Buffer
-	if err := htmlTemplate.Execute(&htmlBuffer, data); err != nil {
-		return "", "", fmt.Errorf("failed to execute HTML template: %w", err)
+	if tmpl.Text == "" {
+		return htmlBody, htmlToText(htmlBody), nil
 	}
 
-	// Render text template
-	textTemplate, err := template.New("text").Parse(tmpl.Text)
+	// Render text template, text/template leaves the text unescaped
+	textTemplate, err := texttemplate.New("text").Parse(tmpl.Text)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to parse text template: %w", err)
 	}
@@ -460,20 +531,10 @@ func (s *EmailService) renderTemplate(
 		return "", "", fmt.Errorf("failed to execute text template: %w", err)
 	}
 
-	return htmlBuffer.String(), textBuffer.String(), nil
+	return htmlBody, textBuffer.String(), nil
 }
 
 // generateMessageID generates a unique message ID
 func generateMessageID() string {
-	return fmt.Sprintf("msg_%d_%s", time.Now().UnixNano(), randomString(8))
-}
-
-// randomString generates a random string of specified length
-func randomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
-	}
-	return string(b)
+	return newID("msg")
 }
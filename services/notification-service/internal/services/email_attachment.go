@@ -0,0 +1,437 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Limits used when the configuration sets none
+const (
+	defaultMaxAttachmentSize  = 10 << 20
+	defaultMaxAttachmentsSize = 25 << 20
+)
+
+// AttachmentScanner checks the content of an attachment before it is sent.
+// An error keeps the email from being sent.
+type AttachmentScanner interface {
+	Scan(name string, content io.Reader) error
+}
+
+// SetAttachmentScanner sets the scanner attachments are checked with,
+// replacing the ClamAV scanner of the configuration
+func (s *EmailService) SetAttachmentScanner(scanner AttachmentScanner) {
+	s.scanner = scanner
+}
+
+// open returns the content of an attachment, from its fetched copy when it
+// was given by reference
+func (a EmailAttachment) open() (io.ReadCloser, error) {
+	if a.path != "" {
+		return os.Open(a.path)
+	}
+	return io.NopCloser(bytes.NewReader(a.Data)), nil
+}
+
+// content reads the whole content of an attachment, for providers that
+// take attachments inline
+func (a EmailAttachment) content() ([]byte, error) {
+	if a.path == "" {
+		return a.Data, nil
+	}
+	return os.ReadFile(a.path)
+}
+
+// prepareAttachments fetches the attachments given by reference into
+// temporary files, checks their sizes and scans them. The returned function
+// removes the temporary files once the email was sent.
+func (s *EmailService) prepareAttachments(ctx context.Context, attachments []EmailAttachment) ([]EmailAttachment, func(), error) {
+	var paths []string
+	cleanup := func() {
+		for _, path := range paths {
+			os.Remove(path)
+		}
+	}
+
+	maxSize := s.config.MaxAttachmentSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxAttachmentSize
+	}
+	maxTotal := s.config.MaxAttachmentsSize
+	if maxTotal <= 0 {
+		maxTotal = defaultMaxAttachmentsSize
+	}
+
+	prepared := make([]EmailAttachment, 0, len(attachments))
+	var total int64
+	for _, attachment := range attachments {
+		size := int64(len(attachment.Data))
+		if attachment.URL != "" || attachment.DocumentID != "" {
+			fetched, err := s.fetchAttachment(ctx, attachment, maxSize)
+			if fetched.path != "" {
+				paths = append(paths, fetched.path)
+			}
+			if err != nil {
+				cleanup()
+				return nil, func() {}, err
+			}
+			attachment = fetched
+			size = fetched.size
+		}
+
+		if size > maxSize {
+			cleanup()
+			return nil, func() {}, invalid(fmt.Errorf("attachment %s is larger than %d bytes", attachment.Name, maxSize))
+		}
+		total += size
+		if total > maxTotal {
+			cleanup()
+			return nil, func() {}, invalid(fmt.Errorf("attachments are larger than %d bytes together", maxTotal))
+		}
+
+		if err := s.scanAttachment(attachment); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+
+		prepared = append(prepared, attachment)
+	}
+
+	return prepared, cleanup, nil
+}
+
+// fetchAttachment downloads the content of an attachment given by URL or
+// document ID into a temporary file. Content over maxSize is not read.
+func (s *EmailService) fetchAttachment(ctx context.Context, attachment EmailAttachment, maxSize int64) (EmailAttachment, error) {
+	var req *http.Request
+	var err error
+	if attachment.DocumentID != "" {
+		req, attachment, err = s.documentRequest(ctx, attachment)
+	} else {
+		req, err = s.attachmentRequest(attachment.URL)
+	}
+	if err != nil {
+		return attachment, err
+	}
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return attachment, fmt.Errorf("failed to fetch attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return attachment, fmt.Errorf("failed to fetch attachment %s: status %d", req.URL.Redacted(), resp.StatusCode)
+	}
+	if resp.ContentLength > maxSize {
+		return attachment, invalid(fmt.Errorf("attachment %s is larger than %d bytes", req.URL.Redacted(), maxSize))
+	}
+
+	if attachment.Name == "" {
+		attachment.Name = attachmentName(resp, req.URL)
+	}
+	if attachment.ContentType == "" {
+		attachment.ContentType = resp.Header.Get("Content-Type")
+	}
+
+	file, err := os.CreateTemp("", "email-attachment-*")
+	if err != nil {
+		return attachment, fmt.Errorf("failed to create attachment file: %w", err)
+	}
+	defer file.Close()
+	attachment.path = file.Name()
+
+	// One byte more than allowed tells an attachment that is too large
+	attachment.size, err = io.Copy(file, io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return attachment, fmt.Errorf("failed to fetch attachment: %w", err)
+	}
+
+	return attachment, nil
+}
+
+// attachmentRequest creates the request fetching an attachment URL. s3:// URLs
+// are fetched from the configured S3 or MinIO endpoint, http(s) URLs only from
+// the allowed hosts so requests can't reach internal services.
+func (s *EmailService) attachmentRequest(rawURL string) (*http.Request, error) {
+	attachmentURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, invalid(fmt.Errorf("invalid attachment URL: %w", err))
+	}
+
+	switch attachmentURL.Scheme {
+	case "s3":
+		return s.s3AttachmentRequest(attachmentURL.Host, strings.TrimPrefix(attachmentURL.Path, "/"))
+	case "http", "https":
+		if !s.attachmentHostAllowed(attachmentURL.Host) {
+			return nil, invalid(fmt.Errorf("attachment host %s is not allowed", attachmentURL.Host))
+		}
+		req, err := http.NewRequest(http.MethodGet, attachmentURL.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create attachment request: %w", err)
+		}
+		return req, nil
+	default:
+		return nil, invalid(fmt.Errorf("unsupported attachment URL scheme: %s", attachmentURL.Scheme))
+	}
+}
+
+// s3AttachmentRequest creates a signed path-style request for an object
+func (s *EmailService) s3AttachmentRequest(bucket string, key string) (*http.Request, error) {
+	if bucket == "" || key == "" {
+		return nil, invalid(fmt.Errorf("attachment URL must be s3://bucket/key"))
+	}
+
+	endpoint := strings.TrimRight(s.config.AttachmentS3Endpoint, "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.config.AttachmentS3Region)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attachment request: %w", err)
+	}
+	req.URL.Path = strings.TrimRight(req.URL.Path, "/") + "/" + bucket + "/" + key
+
+	if s.config.AttachmentS3AccessKey != "" {
+		signAWSRequest(req, nil, s.config.AttachmentS3AccessKey, s.config.AttachmentS3SecretKey,
+			s.config.AttachmentS3Region, "s3", time.Now())
+	}
+
+	return req, nil
+}
+
+// documentRequest looks up a document of the document service and creates
+// the request fetching its file. The document's title names the attachment
+// when the request didn't.
+func (s *EmailService) documentRequest(ctx context.Context, attachment EmailAttachment) (*http.Request, EmailAttachment, error) {
+	if s.config.DocumentServiceURL == "" {
+		return nil, attachment, invalid(fmt.Errorf("document attachments are not configured"))
+	}
+	baseURL := strings.TrimRight(s.config.DocumentServiceURL, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/documents/"+url.PathEscape(attachment.DocumentID), nil)
+	if err != nil {
+		return nil, attachment, fmt.Errorf("failed to create document request: %w", err)
+	}
+	s.authorizeDocumentRequest(req)
+	documentURL := req.URL
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, attachment, fmt.Errorf("failed to get document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, attachment, invalid(fmt.Errorf("document not found: %s", attachment.DocumentID))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, attachment, fmt.Errorf("failed to get document %s: status %d", attachment.DocumentID, resp.StatusCode)
+	}
+
+	var document struct {
+		Title    string `json:"title"`
+		FileURL  string `json:"file_url"`
+		FileType string `json:"file_type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, attachment, fmt.Errorf("failed to decode document: %w", err)
+	}
+	if document.FileURL == "" {
+		return nil, attachment, invalid(fmt.Errorf("document %s has no file", attachment.DocumentID))
+	}
+
+	if attachment.ContentType == "" {
+		attachment.ContentType = document.FileType
+	}
+
+	fileURL, err := url.Parse(document.FileURL)
+	if err != nil {
+		return nil, attachment, fmt.Errorf("invalid document file URL: %w", err)
+	}
+	if fileURL.Scheme == "s3" {
+		req, err = s.s3AttachmentRequest(fileURL.Host, strings.TrimPrefix(fileURL.Path, "/"))
+		if attachment.Name == "" {
+			attachment.Name = documentFileName(document.Title, fileURL.Path)
+		}
+		return req, attachment, err
+	}
+
+	// Files the document service serves itself may be given relative to it
+	fileURL = documentURL.ResolveReference(fileURL)
+	req, err = http.NewRequest(http.MethodGet, fileURL.String(), nil)
+	if err != nil {
+		return nil, attachment, fmt.Errorf("failed to create attachment request: %w", err)
+	}
+	if strings.HasPrefix(fileURL.String(), baseURL+"/") {
+		s.authorizeDocumentRequest(req)
+	}
+	if attachment.Name == "" {
+		attachment.Name = documentFileName(document.Title, fileURL.Path)
+	}
+
+	return req, attachment, nil
+}
+
+// authorizeDocumentRequest adds the service token to a document service request
+func (s *EmailService) authorizeDocumentRequest(req *http.Request) {
+	if s.config.DocumentServiceToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.DocumentServiceToken)
+	}
+}
+
+// attachmentHostAllowed tells whether attachments may be fetched from a host
+func (s *EmailService) attachmentHostAllowed(host string) bool {
+	for _, allowed := range s.config.AttachmentHosts {
+		if strings.EqualFold(strings.TrimSpace(allowed), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanAttachment checks an attachment with the configured scanner
+func (s *EmailService) scanAttachment(attachment EmailAttachment) error {
+	if s.scanner == nil {
+		return nil
+	}
+
+	content, err := attachment.open()
+	if err != nil {
+		return fmt.Errorf("failed to open attachment: %w", err)
+	}
+	defer content.Close()
+
+	return s.scanner.Scan(attachment.Name, content)
+}
+
+// clamAVScanner scans attachments with a clamd daemon using its INSTREAM command
+type clamAVScanner struct {
+	address string
+	timeout time.Duration
+}
+
+// clamAVChunkSize is the size of the chunks content is streamed to clamd in
+const clamAVChunkSize = 64 << 10
+
+func (c *clamAVScanner) Scan(name string, content io.Reader) error {
+	conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to ClamAV: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("failed to scan attachment: %w", err)
+	}
+
+	chunk := make([]byte, clamAVChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := content.Read(chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return fmt.Errorf("failed to scan attachment: %w", err)
+			}
+			if _, err := conn.Write(chunk[:n]); err != nil {
+				return fmt.Errorf("failed to scan attachment: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read attachment: %w", readErr)
+		}
+	}
+
+	// A zero length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return fmt.Errorf("failed to scan attachment: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read ClamAV reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(reply, "stream:"), "\x00"))
+
+	switch {
+	case reply == "OK":
+		return nil
+	case strings.HasSuffix(reply, "FOUND"):
+		return invalid(fmt.Errorf("attachment %s is infected: %s", name, strings.TrimSpace(strings.TrimSuffix(reply, "FOUND"))))
+	default:
+		return fmt.Errorf("ClamAV failed to scan attachment %s: %s", name, reply)
+	}
+}
+
+// Helper functions
+
+// validateAttachments checks that each attachment has exactly one source
+func validateAttachments(attachments []EmailAttachment) error {
+	for i, attachment := range attachments {
+		sources := 0
+		if len(attachment.Data) > 0 {
+			sources++
+			if attachment.Name == "" {
+				return fmt.Errorf("attachment %d: name is required", i)
+			}
+		}
+		if attachment.URL != "" {
+			sources++
+			attachmentURL, err := url.Parse(attachment.URL)
+			if err != nil || (attachmentURL.Scheme != "s3" && attachmentURL.Scheme != "http" && attachmentURL.Scheme != "https") || attachmentURL.Host == "" {
+				return fmt.Errorf("attachment %d: URL must be an s3:// or absolute http(s) URL", i)
+			}
+		}
+		if attachment.DocumentID != "" {
+			sources++
+		}
+		if sources != 1 {
+			return fmt.Errorf("attachment %d: exactly one of data, url or document_id is required", i)
+		}
+	}
+	return nil
+}
+
+// attachmentName names a fetched attachment after the filename the response
+// gives or the last element of its URL
+func attachmentName(resp *http.Response, attachmentURL *url.URL) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	if name := path.Base(attachmentURL.Path); name != "" && name != "/" && name != "." {
+		return name
+	}
+	return "attachment"
+}
+
+// documentFileName names a document attachment after its title, keeping the
+// extension of its file
+func documentFileName(title string, filePath string) string {
+	ext := path.Ext(filePath)
+	if title == "" {
+		return path.Base(filePath)
+	}
+	if strings.HasSuffix(strings.ToLower(title), strings.ToLower(ext)) {
+		return title
+	}
+	return title + ext
+}
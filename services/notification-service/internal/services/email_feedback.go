@@ -0,0 +1,533 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of email feedback. Hard bounces and complaints suppress the address,
+// soft bounces are only recorded.
+const (
+	EmailFeedbackHardBounce = "hard_bounce"
+	EmailFeedbackSoftBounce = "soft_bounce"
+	EmailFeedbackComplaint  = "complaint"
+)
+
+// Reasons an address is suppressed besides hard bounces and complaints
+const (
+	SuppressionManual = "manual"
+	SuppressionOptOut = "opt_out"
+)
+
+// EmailCallback is a request a provider made to the feedback endpoint
+type EmailCallback struct {
+	URL    string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// EmailFeedback is a bounce or complaint reported for a recipient
+type EmailFeedback struct {
+	Kind      string `json:"kind" binding:"required,oneof=hard_bounce soft_bounce complaint"`
+	Recipient string `json:"recipient" binding:"required"`
+	MessageID string `json:"message_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// EmailFeedbackReceiver is implemented by providers that post bounces and
+// complaints to the feedback endpoint
+type EmailFeedbackReceiver interface {
+	ParseFeedback(callback EmailCallback) ([]EmailFeedback, error)
+}
+
+// EmailSuppression is an address the email of a tenant is no longer sent to
+type EmailSuppression struct {
+	Email     string    `json:"email" binding:"required,email"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ParseFeedback verifies and parses the bounces and complaints a provider posted
+func (s *EmailService) ParseFeedback(providerName string, callback EmailCallback) ([]EmailFeedback, error) {
+	provider := s.currentProvider()
+	if !strings.EqualFold(providerName, provider.Name()) {
+		return nil, notFoundf("email provider %s is not configured", providerName)
+	}
+
+	receiver, ok := provider.(EmailFeedbackReceiver)
+	if !ok {
+		return nil, notFoundf("email provider %s doesn't report bounces", providerName)
+	}
+
+	return receiver.ParseFeedback(callback)
+}
+
+// ReceiveEmailFeedback applies the bounces and complaints a provider posted
+func (s *NotificationService) ReceiveEmailFeedback(providerName string, callback EmailCallback) error {
+	feedback, err := s.emailService.ParseFeedback(providerName, callback)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range feedback {
+		if err := s.ApplyEmailFeedback(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyEmailFeedback records a bounce or complaint on the result of the message
+// it refers to and suppresses the address of hard bounces and complaints for
+// the tenant of that message. Feedback on unknown messages suppresses the
+// address for every tenant.
+func (s *NotificationService) ApplyEmailFeedback(feedback EmailFeedback) error {
+	recipient := normalizeEmail(feedback.Recipient)
+	if recipient == "" {
+		return invalid(fmt.Errorf("feedback has no recipient"))
+	}
+
+	result, err := s.emailFeedbackResult(feedback.MessageID)
+	if err != nil {
+		return err
+	}
+
+	tenantID := ""
+	if result != nil {
+		tenantID = result.TenantID
+	}
+
+	log.Info().
+		Str("tenantID", tenantID).
+		Str("kind", feedback.Kind).
+		Str("messageID", feedback.MessageID).
+		Msg("Email feedback received")
+
+	switch feedback.Kind {
+	case EmailFeedbackHardBounce, EmailFeedbackComplaint:
+		suppression := EmailSuppression{Email: recipient, Reason: feedback.Kind, Detail: feedback.Reason}
+		if _, err := s.AddEmailSuppression(tenantID, suppression); err != nil {
+			return err
+		}
+	case EmailFeedbackSoftBounce:
+	default:
+		return invalid(fmt.Errorf("invalid feedback kind: %s", feedback.Kind))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	s.recordFeedbackStats(*result, feedback.Kind)
+
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata[feedback.Kind+"_at"] = time.Now()
+	if feedback.Reason != "" {
+		result.Metadata[feedback.Kind+"_reason"] = feedback.Reason
+	}
+
+	// A hard bounce means the message never arrived
+	if feedback.Kind == EmailFeedbackHardBounce && isSuccessStatus(result.Status) {
+		result.Status = "failed"
+		result.Error = "bounced: " + feedback.Reason
+	}
+
+	if err := s.storeResult(*result); err != nil {
+		return fmt.Errorf("failed to update result: %w", err)
+	}
+
+	s.notifyStatus(*result)
+
+	return nil
+}
+
+// emailFeedbackResult returns the result of the message feedback refers to,
+// nil when it isn't known
+func (s *NotificationService) emailFeedbackResult(messageID string) (*NotificationResult, error) {
+	if messageID == "" {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	resultID, err := s.redis.Get(ctx, s.getMessageResultKey("email", messageID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up message: %w", err)
+	}
+
+	result, err := s.GetNotificationStatus(ctx, resultID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetEmailSuppressions returns the suppressed addresses of a tenant
+func (s *NotificationService) GetEmailSuppressions(tenantID string) ([]*EmailSuppression, error) {
+	entries, err := s.redis.HGetAll(context.Background(), s.getEmailSuppressionsKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email suppressions: %w", err)
+	}
+
+	suppressions := make([]*EmailSuppression, 0, len(entries))
+	for _, entry := range entries {
+		var suppression EmailSuppression
+		if err := json.Unmarshal([]byte(entry), &suppression); err != nil {
+			continue
+		}
+		suppressions = append(suppressions, &suppression)
+	}
+
+	sort.Slice(suppressions, func(i, j int) bool {
+		return suppressions[i].CreatedAt.After(suppressions[j].CreatedAt)
+	})
+
+	return suppressions, nil
+}
+
+// AddEmailSuppression stops the email of a tenant to an address
+func (s *NotificationService) AddEmailSuppression(tenantID string, suppression EmailSuppression) (*EmailSuppression, error) {
+	suppression.Email = normalizeEmail(suppression.Email)
+	if suppression.Email == "" {
+		return nil, invalid(fmt.Errorf("email is required"))
+	}
+	if suppression.Reason == "" {
+		suppression.Reason = SuppressionManual
+	}
+	suppression.CreatedAt = time.Now()
+
+	suppressionJSON, err := json.Marshal(suppression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal email suppression: %w", err)
+	}
+
+	if err := s.redis.HSet(context.Background(), s.getEmailSuppressionsKey(tenantID), suppression.Email, suppressionJSON).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store email suppression: %w", err)
+	}
+
+	log.Info().
+		Str("tenantID", tenantID).
+		Str("reason", suppression.Reason).
+		Msg("Email address suppressed")
+
+	return &suppression, nil
+}
+
+// RemoveEmailSuppression lets the email of a tenant reach an address again
+func (s *NotificationService) RemoveEmailSuppression(tenantID string, email string) error {
+	removed, err := s.redis.HDel(context.Background(), s.getEmailSuppressionsKey(tenantID), normalizeEmail(email)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to remove email suppression: %w", err)
+	}
+	if removed == 0 {
+		return notFoundf("email suppression not found: %s", email)
+	}
+	return nil
+}
+
+// emailSuppression returns the suppression of an address for a tenant, its
+// own or one that applies to every tenant, nil when it isn't suppressed. When
+// that can't be told the address is treated as deliverable.
+func (s *NotificationService) emailSuppression(tenantID string, email string) *EmailSuppression {
+	ctx := context.Background()
+	email = normalizeEmail(email)
+
+	keys := []string{s.getEmailSuppressionsKey(tenantID)}
+	if tenantID != "" {
+		keys = append(keys, s.getEmailSuppressionsKey(""))
+	}
+
+	for _, key := range keys {
+		entry, err := s.redis.HGet(ctx, key, email).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to check email suppression")
+			return nil
+		}
+
+		var suppression EmailSuppression
+		if err := json.Unmarshal([]byte(entry), &suppression); err != nil {
+			return nil
+		}
+		return &suppression
+	}
+
+	return nil
+}
+
+// ParseFeedback parses a SendGrid event webhook post, verifying its signature
+// with the verification key of the signed event webhook
+func (p *sendGridProvider) ParseFeedback(callback EmailCallback) ([]EmailFeedback, error) {
+	if err := verifySendGridSignature(p.config.WebhookSigningKey, callback); err != nil {
+		return nil, err
+	}
+
+	var events []struct {
+		Email       string `json:"email"`
+		Event       string `json:"event"`
+		Type        string `json:"type"`
+		Reason      string `json:"reason"`
+		SGMessageID string `json:"sg_message_id"`
+	}
+	if err := json.Unmarshal(callback.Body, &events); err != nil {
+		return nil, invalid(fmt.Errorf("invalid SendGrid events: %w", err))
+	}
+
+	var feedback []EmailFeedback
+	for _, event := range events {
+		item := EmailFeedback{
+			Recipient: event.Email,
+			// Event message IDs are the X-Message-Id followed by a filter suffix
+			MessageID: strings.SplitN(event.SGMessageID, ".", 2)[0],
+			Reason:    event.Reason,
+		}
+
+		switch {
+		case event.Event == "bounce" && event.Type == "blocked":
+			item.Kind = EmailFeedbackSoftBounce
+		case event.Event == "bounce":
+			item.Kind = EmailFeedbackHardBounce
+		case event.Event == "spamreport":
+			item.Kind = EmailFeedbackComplaint
+		default:
+			continue
+		}
+		feedback = append(feedback, item)
+	}
+
+	return feedback, nil
+}
+
+// ParseFeedback parses an SES notification delivered by SNS. SNS posts to the
+// subscription URL set up for the topic, which carries the webhook token; the
+// subscription is confirmed when SNS asks for it.
+func (p *sesProvider) ParseFeedback(callback EmailCallback) ([]EmailFeedback, error) {
+	token := callback.Query.Get("token")
+	if p.config.WebhookToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.config.WebhookToken)) != 1 {
+		return nil, unauthorizedf("invalid SES webhook token")
+	}
+
+	var envelope struct {
+		Type         string `json:"Type"`
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+	}
+	if err := json.Unmarshal(callback.Body, &envelope); err != nil {
+		return nil, invalid(fmt.Errorf("invalid SNS message: %w", err))
+	}
+
+	if envelope.Type == "SubscriptionConfirmation" {
+		return nil, p.confirmSubscription(envelope.SubscribeURL)
+	}
+	if envelope.Type != "Notification" {
+		return nil, nil
+	}
+
+	var notification struct {
+		NotificationType string `json:"notificationType"`
+		Mail             struct {
+			MessageID string `json:"messageId"`
+		} `json:"mail"`
+		Bounce struct {
+			BounceType        string `json:"bounceType"`
+			BouncedRecipients []struct {
+				EmailAddress   string `json:"emailAddress"`
+				DiagnosticCode string `json:"diagnosticCode"`
+			} `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplaintFeedbackType string `json:"complaintFeedbackType"`
+			ComplainedRecipients  []struct {
+				EmailAddress string `json:"emailAddress"`
+			} `json:"complainedRecipients"`
+		} `json:"complaint"`
+	}
+	if err := json.Unmarshal([]byte(envelope.Message), &notification); err != nil {
+		return nil, invalid(fmt.Errorf("invalid SES notification: %w", err))
+	}
+
+	var feedback []EmailFeedback
+	switch notification.NotificationType {
+	case "Bounce":
+		kind := EmailFeedbackSoftBounce
+		if notification.Bounce.BounceType == "Permanent" {
+			kind = EmailFeedbackHardBounce
+		}
+		for _, recipient := range notification.Bounce.BouncedRecipients {
+			feedback = append(feedback, EmailFeedback{
+				Kind:      kind,
+				Recipient: recipient.EmailAddress,
+				MessageID: notification.Mail.MessageID,
+				Reason:    recipient.DiagnosticCode,
+			})
+		}
+	case "Complaint":
+		for _, recipient := range notification.Complaint.ComplainedRecipients {
+			feedback = append(feedback, EmailFeedback{
+				Kind:      EmailFeedbackComplaint,
+				Recipient: recipient.EmailAddress,
+				MessageID: notification.Mail.MessageID,
+				Reason:    notification.Complaint.ComplaintFeedbackType,
+			})
+		}
+	}
+
+	return feedback, nil
+}
+
+// confirmSubscription confirms the SNS subscription of the feedback endpoint
+func (p *sesProvider) confirmSubscription(subscribeURL string) error {
+	parsed, err := url.Parse(subscribeURL)
+	if err != nil || parsed.Scheme != "https" || !strings.HasSuffix(parsed.Hostname(), ".amazonaws.com") {
+		return invalid(fmt.Errorf("invalid SNS subscribe URL: %s", subscribeURL))
+	}
+
+	resp, err := p.client.Get(subscribeURL)
+	if err != nil {
+		return fmt.Errorf("failed to confirm SNS subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to confirm SNS subscription: status %d", resp.StatusCode)
+	}
+
+	log.Info().Msg("SES feedback subscription confirmed")
+	return nil
+}
+
+// ParseFeedback parses a Mailgun webhook post, verifying its signature with
+// the HTTP webhook signing key
+func (p *mailgunProvider) ParseFeedback(callback EmailCallback) ([]EmailFeedback, error) {
+	var payload struct {
+		Signature struct {
+			Timestamp string `json:"timestamp"`
+			Token     string `json:"token"`
+			Signature string `json:"signature"`
+		} `json:"signature"`
+		EventData struct {
+			Event     string `json:"event"`
+			Severity  string `json:"severity"`
+			Recipient string `json:"recipient"`
+			Reason    string `json:"reason"`
+			Message   struct {
+				Headers struct {
+					MessageID string `json:"message-id"`
+				} `json:"headers"`
+			} `json:"message"`
+			DeliveryStatus struct {
+				Message     string `json:"message"`
+				Description string `json:"description"`
+			} `json:"delivery-status"`
+		} `json:"event-data"`
+	}
+	if err := json.Unmarshal(callback.Body, &payload); err != nil {
+		return nil, invalid(fmt.Errorf("invalid Mailgun event: %w", err))
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.config.WebhookSigningKey))
+	mac.Write([]byte(payload.Signature.Timestamp + payload.Signature.Token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if p.config.WebhookSigningKey == "" || !hmac.Equal([]byte(expected), []byte(payload.Signature.Signature)) {
+		return nil, unauthorizedf("invalid Mailgun signature")
+	}
+
+	event := payload.EventData
+	item := EmailFeedback{
+		Recipient: event.Recipient,
+		MessageID: event.Message.Headers.MessageID,
+		Reason:    event.DeliveryStatus.Message,
+	}
+	if item.Reason == "" {
+		item.Reason = event.DeliveryStatus.Description
+	}
+
+	switch {
+	case event.Event == "failed" && event.Severity == "permanent":
+		item.Kind = EmailFeedbackHardBounce
+	case event.Event == "failed":
+		item.Kind = EmailFeedbackSoftBounce
+	case event.Event == "complained":
+		item.Kind = EmailFeedbackComplaint
+	default:
+		return nil, nil
+	}
+
+	return []EmailFeedback{item}, nil
+}
+
+// Redis key generators
+func (s *NotificationService) getEmailSuppressionsKey(tenantID string) string {
+	return fmt.Sprintf("email_suppressions:%s", retentionTenant(tenantID))
+}
+
+// Helper functions
+
+// verifySendGridSignature checks the ECDSA signature SendGrid puts on signed
+// event webhook posts: the timestamp followed by the body, signed with SHA-256
+func verifySendGridSignature(publicKey string, callback EmailCallback) error {
+	if publicKey == "" {
+		return unauthorizedf("invalid SendGrid signature")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid SendGrid verification key: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("invalid SendGrid verification key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("SendGrid verification key is not an ECDSA key")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(callback.Header.Get("X-Twilio-Email-Event-Webhook-Signature"))
+	if err != nil {
+		return unauthorizedf("invalid SendGrid signature")
+	}
+
+	digest := sha256.Sum256(append([]byte(callback.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp")), callback.Body...))
+	if !ecdsa.VerifyASN1(key, digest[:], signature) {
+		return unauthorizedf("invalid SendGrid signature")
+	}
+
+	return nil
+}
+
+// normalizeEmail lower cases an address and drops its display name
+func normalizeEmail(address string) string {
+	email, _ := splitAddress(address)
+	return strings.ToLower(email)
+}
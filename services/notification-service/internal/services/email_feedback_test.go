@@ -0,0 +1,206 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// signedSendGridCallback returns a SendGrid event post signed with key and
+// the verification key SendGrid shows for it
+func signedSendGridCallback(t *testing.T, key *ecdsa.PrivateKey, body string) (EmailCallback, string) {
+	t.Helper()
+
+	digest := sha256.Sum256([]byte("1772442000" + body))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("X-Twilio-Email-Event-Webhook-Timestamp", "1772442000")
+	header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(signature))
+	return EmailCallback{Header: header, Body: []byte(body)}, base64.StdEncoding.EncodeToString(publicKey)
+}
+
+func TestSendGridEventsBecomeFeedback(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	callback, verificationKey := signedSendGridCallback(t, key, `[
+		{"email":"ayse@talimat.test","event":"bounce","type":"bounce","reason":"550 5.1.1 unknown user","sg_message_id":"sendgrid-1.filter0001"},
+		{"email":"mehmet@talimat.test","event":"bounce","type":"blocked","reason":"421 try again later","sg_message_id":"sendgrid-2.filter0001"},
+		{"email":"zeynep@talimat.test","event":"spamreport","sg_message_id":"sendgrid-3.filter0001"},
+		{"email":"ali@talimat.test","event":"delivered","sg_message_id":"sendgrid-4.filter0001"}]`)
+	provider := &sendGridProvider{config: EmailConfig{WebhookSigningKey: verificationKey}}
+
+	feedback, err := provider.ParseFeedback(callback)
+	if err != nil {
+		t.Fatalf("Failed to parse feedback: %v", err)
+	}
+	expected := []EmailFeedback{
+		{Kind: EmailFeedbackHardBounce, Recipient: "ayse@talimat.test", MessageID: "sendgrid-1", Reason: "550 5.1.1 unknown user"},
+		{Kind: EmailFeedbackSoftBounce, Recipient: "mehmet@talimat.test", MessageID: "sendgrid-2", Reason: "421 try again later"},
+		{Kind: EmailFeedbackComplaint, Recipient: "zeynep@talimat.test", MessageID: "sendgrid-3"},
+	}
+	if !reflect.DeepEqual(feedback, expected) {
+		t.Errorf("Expected bounces and complaints of the sent messages, got %+v", feedback)
+	}
+
+	// Posts altered after signing, or signed by another key, are refused
+	tampered := callback
+	tampered.Body = []byte(`[{"email":"ceo@talimat.test","event":"spamreport"}]`)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, otherKey := signedSendGridCallback(t, other, string(callback.Body))
+	for name, test := range map[string]struct {
+		key      string
+		callback EmailCallback
+	}{
+		"altered body": {verificationKey, tampered},
+		"other key":    {otherKey, callback},
+		"no key":       {"", callback},
+		"unsigned":     {verificationKey, EmailCallback{Header: http.Header{}, Body: callback.Body}},
+	} {
+		provider := &sendGridProvider{config: EmailConfig{WebhookSigningKey: test.key}}
+		if _, err := provider.ParseFeedback(test.callback); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: expected the post to be refused, got %v", name, err)
+		}
+	}
+}
+
+// snsNotification wraps an SES notification the way SNS posts it
+func snsNotification(t *testing.T, notification string) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]string{"Type": "Notification", "Message": notification})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	return body
+}
+
+func TestSESNotificationsBecomeFeedback(t *testing.T) {
+	provider := &sesProvider{config: EmailConfig{WebhookToken: "feedback-token"}}
+	query := url.Values{"token": {"feedback-token"}}
+
+	for name, test := range map[string]struct {
+		notification string
+		expected     []EmailFeedback
+	}{
+		"permanent bounce": {
+			`{"notificationType":"Bounce","mail":{"messageId":"ses-1"},"bounce":{"bounceType":"Permanent","bouncedRecipients":[
+				{"emailAddress":"ayse@talimat.test","diagnosticCode":"smtp; 550 5.1.1 user unknown"},
+				{"emailAddress":"mehmet@talimat.test"}]}}`,
+			[]EmailFeedback{
+				{Kind: EmailFeedbackHardBounce, Recipient: "ayse@talimat.test", MessageID: "ses-1", Reason: "smtp; 550 5.1.1 user unknown"},
+				{Kind: EmailFeedbackHardBounce, Recipient: "mehmet@talimat.test", MessageID: "ses-1"},
+			},
+		},
+		"transient bounce": {
+			`{"notificationType":"Bounce","mail":{"messageId":"ses-2"},"bounce":{"bounceType":"Transient","bouncedRecipients":[{"emailAddress":"ayse@talimat.test"}]}}`,
+			[]EmailFeedback{{Kind: EmailFeedbackSoftBounce, Recipient: "ayse@talimat.test", MessageID: "ses-2"}},
+		},
+		"complaint": {
+			`{"notificationType":"Complaint","mail":{"messageId":"ses-3"},"complaint":{"complaintFeedbackType":"abuse","complainedRecipients":[{"emailAddress":"zeynep@talimat.test"}]}}`,
+			[]EmailFeedback{{Kind: EmailFeedbackComplaint, Recipient: "zeynep@talimat.test", MessageID: "ses-3", Reason: "abuse"}},
+		},
+		"delivery": {
+			`{"notificationType":"Delivery","mail":{"messageId":"ses-4"}}`,
+			nil,
+		},
+	} {
+		feedback, err := provider.ParseFeedback(EmailCallback{Query: query, Body: snsNotification(t, test.notification)})
+		if err != nil {
+			t.Fatalf("%s: failed to parse feedback: %v", name, err)
+		}
+		if !reflect.DeepEqual(feedback, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", name, test.expected, feedback)
+		}
+	}
+
+	body := snsNotification(t, `{"notificationType":"Complaint"}`)
+	for name, query := range map[string]url.Values{
+		"wrong token": {"token": {"guessed"}},
+		"no token":    {},
+	} {
+		if _, err := provider.ParseFeedback(EmailCallback{Query: query, Body: body}); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: expected the post to be refused, got %v", name, err)
+		}
+	}
+
+	// Subscriptions are only confirmed with AWS
+	confirmation := []byte(`{"Type":"SubscriptionConfirmation","SubscribeURL":"https://attacker.test/confirm"}`)
+	if _, err := provider.ParseFeedback(EmailCallback{Query: query, Body: confirmation}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected subscribe URLs outside AWS to be refused, got %v", err)
+	}
+}
+
+// signedMailgunEvent returns a Mailgun webhook post signed with key
+func signedMailgunEvent(t *testing.T, key string, eventData string) []byte {
+	t.Helper()
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte("1772442000" + "event-token"))
+	return []byte(`{"signature":{"timestamp":"1772442000","token":"event-token","signature":"` +
+		hex.EncodeToString(mac.Sum(nil)) + `"},"event-data":` + eventData + `}`)
+}
+
+func TestMailgunEventsBecomeFeedback(t *testing.T) {
+	provider := &mailgunProvider{config: EmailConfig{WebhookSigningKey: "mailgun-signing-key"}}
+
+	for name, test := range map[string]struct {
+		eventData string
+		expected  []EmailFeedback
+	}{
+		"permanent failure": {
+			`{"event":"failed","severity":"permanent","recipient":"ayse@talimat.test","message":{"headers":{"message-id":"mailgun-1@mg.talimat.test"}},"delivery-status":{"message":"550 5.1.1 mailbox unavailable"}}`,
+			[]EmailFeedback{{Kind: EmailFeedbackHardBounce, Recipient: "ayse@talimat.test", MessageID: "mailgun-1@mg.talimat.test", Reason: "550 5.1.1 mailbox unavailable"}},
+		},
+		"temporary failure": {
+			`{"event":"failed","severity":"temporary","recipient":"ayse@talimat.test","message":{"headers":{"message-id":"mailgun-2@mg.talimat.test"}},"delivery-status":{"description":"mailbox full"}}`,
+			[]EmailFeedback{{Kind: EmailFeedbackSoftBounce, Recipient: "ayse@talimat.test", MessageID: "mailgun-2@mg.talimat.test", Reason: "mailbox full"}},
+		},
+		"complaint": {
+			`{"event":"complained","recipient":"zeynep@talimat.test","message":{"headers":{"message-id":"mailgun-3@mg.talimat.test"}}}`,
+			[]EmailFeedback{{Kind: EmailFeedbackComplaint, Recipient: "zeynep@talimat.test", MessageID: "mailgun-3@mg.talimat.test"}},
+		},
+		"delivery": {
+			`{"event":"delivered","recipient":"ali@talimat.test"}`,
+			nil,
+		},
+	} {
+		feedback, err := provider.ParseFeedback(EmailCallback{Body: signedMailgunEvent(t, "mailgun-signing-key", test.eventData)})
+		if err != nil {
+			t.Fatalf("%s: failed to parse feedback: %v", name, err)
+		}
+		if !reflect.DeepEqual(feedback, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", name, test.expected, feedback)
+		}
+	}
+
+	forged := signedMailgunEvent(t, "guessed-key", `{"event":"complained","recipient":"ceo@talimat.test"}`)
+	if _, err := provider.ParseFeedback(EmailCallback{Body: forged}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected posts signed with another key to be refused, got %v", err)
+	}
+	unconfigured := &mailgunProvider{config: EmailConfig{}}
+	if _, err := unconfigured.ParseFeedback(EmailCallback{Body: signedMailgunEvent(t, "", `{"event":"complained"}`)}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected posts to be refused without a signing key, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"regexp"
+	"strings"
+)
+
+// emailDefaultLayout wraps templates that don't name a layout
+const emailDefaultLayout = "base"
+
+// emailNoLayout is the layout of templates rendered as they are
+const emailNoLayout = "none"
+
+// EmailBranding is what the layouts of a tenant show around the content
+type EmailBranding struct {
+	Name         string `json:"name,omitempty"`
+	LogoURL      string `json:"logo_url,omitempty"`
+	PrimaryColor string `json:"primary_color,omitempty"`
+	WebsiteURL   string `json:"website_url,omitempty"`
+	Footer       string `json:"footer,omitempty"`
+}
+
+// merge returns the branding with the fields other sets
+func (b EmailBranding) merge(other EmailBranding) EmailBranding {
+	if other.Name != "" {
+		b.Name = other.Name
+	}
+	if other.LogoURL != "" {
+		b.LogoURL = other.LogoURL
+	}
+	if other.PrimaryColor != "" {
+		b.PrimaryColor = other.PrimaryColor
+	}
+	if other.WebsiteURL != "" {
+		b.WebsiteURL = other.WebsiteURL
+	}
+	if other.Footer != "" {
+		b.Footer = other.Footer
+	}
+	return b
+}
+
+// defaultEmailBranding is shown until the templates directory sets a branding
+var defaultEmailBranding = EmailBranding{
+	Name:         "Claude Talimat",
+	PrimaryColor: "#1f6feb",
+	WebsiteURL:   "https://app.claude-talimat.com",
+	Footer:       "Bu e-posta Claude Talimat tarafından gönderilmiştir.",
+}
+
+// builtinEmailLayouts are used when the templates directory has no version of
+// a layout. Layouts render the content of the template with
+// {{template "content" .}} and show the branding as .Brand.
+var builtinEmailLayouts = map[string]string{
+	emailDefaultLayout: `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body style="margin:0;padding:0;background:#f4f5f7;font-family:Arial,Helvetica,sans-serif;color:#1d2129;">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="background:#f4f5f7;">
+<tr><td align="center" style="padding:24px 12px;">
+<table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="max-width:600px;background:#ffffff;border-radius:6px;">
+<tr><td style="padding:20px 24px;border-top:4px solid {{.Brand.PrimaryColor}};">
+{{if .Brand.LogoURL}}<img src="{{.Brand.LogoURL}}" alt="{{.Brand.Name}}" height="32">{{else}}<strong style="font-size:18px;">{{.Brand.Name}}</strong>{{end}}
+</td></tr>
+<tr><td style="padding:8px 24px 24px;font-size:15px;line-height:1.5;">
+{{template "content" .}}
+</td></tr>
+<tr><td style="padding:16px 24px;border-top:1px solid #e5e7eb;font-size:12px;color:#6b7280;">
+{{.Brand.Footer}}{{if .Brand.WebsiteURL}}<br><a href="{{.Brand.WebsiteURL}}" style="color:#6b7280;">{{.Brand.WebsiteURL}}</a>{{end}}
+</td></tr>
+</table>
+</td></tr>
+</table>
+</body>
+</html>`,
+}
+
+// renderHTML renders the HTML of a template inside its layout. Templates
+// that are whole documents, such as compiled MJML, are rendered as they are.
+func (s *EmailService) renderHTML(tenantID string, tmpl *EmailTemplate, data map[string]interface{}) (string, error) {
+	layoutName := tmpl.Layout
+	if layoutName == "" {
+		layoutName = emailDefaultLayout
+	}
+	if isHTMLDocument(tmpl.HTML) {
+		layoutName = emailNoLayout
+	}
+
+	var root *htmltemplate.Template
+	var values interface{} = data
+
+	if layoutName == emailNoLayout {
+		root = htmltemplate.New("content")
+	} else {
+		layout, partials, branding, err := s.templates.layout(tenantID, layoutName)
+		if err != nil {
+			return "", err
+		}
+
+		root, err = htmltemplate.New("layout").Parse(layout)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse email layout: %w", err)
+		}
+		for name, partial := range partials {
+			if _, err := root.New(name).Parse(partial); err != nil {
+				return "", fmt.Errorf("failed to parse email partial %s: %w", name, err)
+			}
+		}
+
+		// The template sees its data as before, the layout sees the branding too
+		withBrand := make(map[string]interface{}, len(data)+1)
+		for key, value := range data {
+			withBrand[key] = value
+		}
+		withBrand["Brand"] = defaultEmailBranding.merge(branding)
+		values = withBrand
+	}
+
+	content := root
+	if layoutName != emailNoLayout {
+		content = root.New("content")
+	}
+	if _, err := content.Parse(tmpl.HTML); err != nil {
+		return "", fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	if err := root.Execute(&buffer, values); err != nil {
+		return "", fmt.Errorf("failed to execute HTML template: %w", err)
+	}
+
+	return buffer.String(), nil
+}
+
+var (
+	htmlDocumentPattern = regexp.MustCompile(`(?is)^\s*(<!doctype|<html)`)
+	htmlDropPattern     = regexp.MustCompile(`(?is)<(head|style|script)[^>]*>.*?</(head|style|script)>`)
+	htmlLinkPattern     = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	htmlBreakPattern    = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlBlockPattern    = regexp.MustCompile(`(?i)</?(p|div|h[1-6]|tr|table|ul|ol|blockquote)(\s[^>]*)?>`)
+	htmlItemPattern     = regexp.MustCompile(`(?i)<li(\s[^>]*)?>`)
+	htmlTagPattern      = regexp.MustCompile(`(?s)<[^>]*>`)
+	textSpacePattern    = regexp.MustCompile(`[ \t]+`)
+	textBlankPattern    = regexp.MustCompile(`\n\s*\n\s*\n+`)
+)
+
+// Helper functions
+
+// isHTMLDocument tells whether HTML is a whole document rather than content
+func isHTMLDocument(html string) bool {
+	return htmlDocumentPattern.MatchString(html)
+}
+
+// htmlToText derives the plain text part of an email from its HTML: blocks
+// and breaks become line breaks, list items bullets and links keep their URL
+func htmlToText(source string) string {
+	text := htmlDropPattern.ReplaceAllString(source, "")
+	text = htmlLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		match := htmlLinkPattern.FindStringSubmatch(link)
+		label := strings.TrimSpace(htmlTagPattern.ReplaceAllString(match[2], ""))
+		if label == "" || label == match[1] {
+			return match[1]
+		}
+		return fmt.Sprintf("%s (%s)", label, match[1])
+	})
+	text = htmlBreakPattern.ReplaceAllString(text, "\n")
+	text = htmlItemPattern.ReplaceAllString(text, "\n- ")
+	text = htmlBlockPattern.ReplaceAllString(text, "\n\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(textSpacePattern.ReplaceAllString(line, " "))
+	}
+	text = strings.Join(lines, "\n")
+	text = textBlankPattern.ReplaceAllString(text, "\n\n")
+
+	return strings.TrimSpace(text)
+}
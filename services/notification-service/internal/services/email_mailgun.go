@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// mailgunDefaultBaseURL is the US region, EU domains set the BaseURL to
+// https://api.eu.mailgun.net
+const mailgunDefaultBaseURL = "https://api.mailgun.net"
+
+// mailgunProvider sends email through the Mailgun messages API
+type mailgunProvider struct {
+	config EmailConfig
+	client *http.Client
+}
+
+func (p *mailgunProvider) Name() string {
+	return EmailProviderMailgun
+}
+
+func (p *mailgunProvider) Send(ctx context.Context, message EmailMessage) (*EmailResult, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	// Every recipient, Bcc included, is an envelope recipient of the MIME message
+	recipients := append(append(append([]string{}, message.To...), message.Cc...), message.Bcc...)
+	for _, recipient := range recipients {
+		form.WriteField("to", recipient)
+	}
+
+	part, err := form.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Mailgun request: %w", err)
+	}
+	if _, err := buildMIMEMessage(p.config, message).WriteTo(part); err != nil {
+		return nil, fmt.Errorf("failed to build Mailgun message: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build Mailgun request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/v3/%s/messages.mime", emailBaseURL(p.config, mailgunDefaultBaseURL), p.config.Domain)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Mailgun request: %w", err)
+	}
+	req.SetBasicAuth("api", p.config.APIKey)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, requestEmailError(EmailProviderMailgun, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpEmailError(EmailProviderMailgun, resp.StatusCode, result.Message)
+	}
+
+	return &EmailResult{
+		// Mailgun IDs come in angle brackets, as in the Message-Id header
+		MessageID: strings.Trim(result.ID, "<>"),
+		Provider:  EmailProviderMailgun,
+		SentAt:    time.Now(),
+		Success:   true,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// mailgunServer is a mock of the Mailgun messages API answering with status
+// and response, recording the recipients and MIME messages it receives
+type mailgunServer struct {
+	*httptest.Server
+	recipients [][]string
+	messages   []string
+	status     int
+	response   string
+}
+
+func newMailgunServer(t *testing.T) *mailgunServer {
+	server := &mailgunServer{status: http.StatusOK, response: `{"id":"<20260302090000.1@mg.talimat.test>","message":"Queued. Thank you."}`}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/mg.talimat.test/messages.mime" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "api" || password != "mailgun-key" {
+			t.Errorf("Expected the API key as basic auth, got %q %q", user, password)
+		}
+
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Failed to parse form: %v", err)
+			return
+		}
+		file, _, err := r.FormFile("message")
+		if err != nil {
+			t.Errorf("Expected the MIME message as a file: %v", err)
+			return
+		}
+		message, _ := io.ReadAll(file)
+		server.recipients = append(server.recipients, r.MultipartForm.Value["to"])
+		server.messages = append(server.messages, string(message))
+
+		w.WriteHeader(server.status)
+		w.Write([]byte(server.response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newMailgunTestProvider(server *mailgunServer) *mailgunProvider {
+	return &mailgunProvider{
+		config: EmailConfig{APIKey: "mailgun-key", Domain: "mg.talimat.test", From: "isg@talimat.test", BaseURL: server.URL + "/"},
+		client: server.Client(),
+	}
+}
+
+func TestMailgunSendsMIMEMessages(t *testing.T) {
+	server := newMailgunServer(t)
+
+	result, err := newMailgunTestProvider(server).Send(context.Background(), EmailMessage{
+		To:       []string{"ayse@talimat.test"},
+		Cc:       []string{"sef@talimat.test"},
+		Bcc:      []string{"arsiv@talimat.test"},
+		Subject:  "Mart vardiyalari",
+		Body:     "Yeni vardiya planı yayında",
+		HTMLBody: "<p>Yeni vardiya planı yayında</p>",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.MessageID != "20260302090000.1@mg.talimat.test" || result.Provider != EmailProviderMailgun || !result.Success {
+		t.Errorf("Expected the Mailgun ID without brackets to identify the send, got %+v", result)
+	}
+
+	if recipients := strings.Join(server.recipients[0], ","); recipients != "ayse@talimat.test,sef@talimat.test,arsiv@talimat.test" {
+		t.Errorf("Expected every recipient in the envelope, got %s", recipients)
+	}
+	message := server.messages[0]
+	if !strings.Contains(message, "Subject: Mart vardiyalari") {
+		t.Errorf("Expected the subject in the MIME message, got\n%s", message)
+	}
+	if !strings.Contains(message, "text/html") || !strings.Contains(message, "text/plain") || strings.Contains(message, "arsiv@talimat.test") {
+		t.Errorf("Expected both parts and no Bcc in the MIME message, got\n%s", message)
+	}
+}
+
+func TestMailgunErrorsAreNormalized(t *testing.T) {
+	for name, test := range map[string]struct {
+		status   int
+		response string
+		code     string
+		message  string
+	}{
+		"rejected":     {http.StatusBadRequest, `{"message":"to parameter is not a valid address. please check documentation"}`, EmailErrorRejected, "to parameter is not a valid address"},
+		"bad key":      {http.StatusUnauthorized, `Forbidden`, EmailErrorAuth, "Unauthorized"},
+		"rate limited": {http.StatusTooManyRequests, `{"message":"Too many requests"}`, EmailErrorRateLimited, "Too many requests"},
+		"server error": {http.StatusInternalServerError, ``, EmailErrorUnavailable, "Internal Server Error"},
+	} {
+		server := newMailgunServer(t)
+		server.status, server.response = test.status, test.response
+
+		_, err := newMailgunTestProvider(server).Send(context.Background(), EmailMessage{To: []string{"ayse@talimat.test"}, Subject: "Tatbikat", Body: "Tatbikat"})
+		var emailErr *EmailError
+		if !errors.As(err, &emailErr) {
+			t.Fatalf("%s: expected an email error, got %v", name, err)
+		}
+		if emailErr.Code != test.code || emailErr.StatusCode != test.status || !strings.Contains(emailErr.Message, test.message) {
+			t.Errorf("%s: expected %s with %q, got %+v", name, test.code, test.message, emailErr)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// Names of the built-in email providers
+const (
+	EmailProviderSMTP     = "smtp"
+	EmailProviderSendGrid = "sendgrid"
+	EmailProviderSES      = "ses"
+	EmailProviderMailgun  = "mailgun"
+)
+
+// Normalized email error codes, the same for every provider
+const (
+	EmailErrorAuth        = "auth"     // credentials were rejected
+	EmailErrorRejected    = "rejected" // the message or a recipient was refused
+	EmailErrorRateLimited = "rate_limited"
+	EmailErrorUnavailable = "unavailable" // the provider is down or unreachable
+)
+
+// EmailProvider sends email through a delivery service. Send returns the
+// message ID the provider assigned and an *EmailError when it failed. It gives
+// up once ctx is done.
+type EmailProvider interface {
+	Name() string
+	Send(ctx context.Context, message EmailMessage) (*EmailResult, error)
+}
+
+// EmailProviderFactory creates an email provider from the service configuration
+type EmailProviderFactory func(config EmailConfig, client *http.Client) (EmailProvider, error)
+
+var (
+	emailProvidersMu sync.RWMutex
+	emailProviders   = map[string]EmailProviderFactory{
+		EmailProviderSMTP: func(config EmailConfig, client *http.Client) (EmailProvider, error) {
+			return &smtpProvider{config: config}, nil
+		},
+		EmailProviderSendGrid: func(config EmailConfig, client *http.Client) (EmailProvider, error) {
+			if config.APIKey == "" {
+				return nil, fmt.Errorf("SendGrid requires an API key")
+			}
+			return &sendGridProvider{config: config, client: client}, nil
+		},
+		EmailProviderSES: func(config EmailConfig, client *http.Client) (EmailProvider, error) {
+			if config.APIKey == "" || config.APISecret == "" || config.Region == "" {
+				return nil, fmt.Errorf("SES requires an access key, a secret key and a region")
+			}
+			return &sesProvider{config: config, client: client}, nil
+		},
+		EmailProviderMailgun: func(config EmailConfig, client *http.Client) (EmailProvider, error) {
+			if config.APIKey == "" || config.Domain == "" {
+				return nil, fmt.Errorf("Mailgun requires an API key and a domain")
+			}
+			return &mailgunProvider{config: config, client: client}, nil
+		},
+	}
+)
+
+// RegisterEmailProvider makes an email provider available under a name, to be
+// selected in EmailConfig.Provider
+func RegisterEmailProvider(name string, factory EmailProviderFactory) {
+	emailProvidersMu.Lock()
+	defer emailProvidersMu.Unlock()
+
+	emailProviders[strings.ToLower(name)] = factory
+}
+
+// newEmailProvider creates the configured provider, SMTP when none is set
+func newEmailProvider(config EmailConfig, client *http.Client) (EmailProvider, error) {
+	name := strings.ToLower(config.Provider)
+	if name == "" {
+		name = EmailProviderSMTP
+	}
+
+	emailProvidersMu.RLock()
+	factory, ok := emailProviders[name]
+	emailProvidersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported email provider: %s", name)
+	}
+
+	provider, err := factory(config, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s: %w", name, err)
+	}
+	return provider, nil
+}
+
+// EmailError is a send failure of a provider normalized to one of the email
+// error codes
+type EmailError struct {
+	Provider   string
+	Code       string
+	StatusCode int // HTTP status or SMTP reply code, 0 when none was received
+	Message    string
+}
+
+func (e *EmailError) Error() string {
+	return fmt.Sprintf("%s error %d (%s): %s", e.Provider, e.StatusCode, e.Code, e.Message)
+}
+
+// Temporary reports whether the send may succeed when retried later
+func (e *EmailError) Temporary() bool {
+	return e.Code == EmailErrorRateLimited || e.Code == EmailErrorUnavailable
+}
+
+// smtpProvider sends email through an SMTP server
+type smtpProvider struct {
+	config EmailConfig
+}
+
+func (p *smtpProvider) Name() string {
+	return EmailProviderSMTP
+}
+
+func (p *smtpProvider) Send(ctx context.Context, message EmailMessage) (*EmailResult, error) {
+	messageID := generateMessageID()
+
+	m := buildMIMEMessage(p.config, message)
+	m.SetHeader("Message-Id", fmt.Sprintf("<%s@%s>", messageID, emailDomain(p.config.From)))
+	if len(message.Bcc) > 0 {
+		m.SetHeader("Bcc", message.Bcc...)
+	}
+
+	dialer := gomail.NewDialer(p.config.Host, p.config.Port, p.config.Username, p.config.Password)
+	if p.config.UseTLS {
+		dialer.TLSConfig = &tls.Config{InsecureSkipVerify: false}
+	}
+	if p.config.UseSSL {
+		dialer.SSL = true
+	}
+
+	// The SMTP client can't be interrupted, so a request that was given up on
+	// isn't started
+	if err := ctx.Err(); err != nil {
+		return nil, requestEmailError(EmailProviderSMTP, err)
+	}
+	if err := dialer.DialAndSend(m); err != nil {
+		return nil, smtpEmailError(err)
+	}
+
+	return &EmailResult{
+		MessageID: messageID,
+		Provider:  EmailProviderSMTP,
+		SentAt:    time.Now(),
+		Success:   true,
+	}, nil
+}
+
+// Helper functions
+
+// buildMIMEMessage builds the MIME message of an email. Bcc recipients are
+// left out, providers taking raw messages get them as envelope recipients.
+func buildMIMEMessage(config EmailConfig, message EmailMessage) *gomail.Message {
+	m := gomail.NewMessage()
+
+	m.SetAddressHeader("From", config.From, config.FromName)
+	m.SetHeader("To", message.To...)
+	if len(message.Cc) > 0 {
+		m.SetHeader("Cc", message.Cc...)
+	}
+	m.SetHeader("Subject", message.Subject)
+
+	for key, value := range message.Headers {
+		m.SetHeader(key, value)
+	}
+
+	if message.HTMLBody != "" {
+		m.SetBody("text/html", message.HTMLBody)
+		if message.Body != "" {
+			m.AddAlternative("text/plain", message.Body)
+		}
+	} else {
+		m.SetBody("text/plain", message.Body)
+	}
+
+	for _, attachment := range message.Attachments {
+		attachment := attachment
+		settings := []gomail.FileSetting{gomail.SetCopyFunc(func(w io.Writer) error {
+			content, err := attachment.open()
+			if err != nil {
+				return err
+			}
+			defer content.Close()
+
+			_, err = io.Copy(w, content)
+			return err
+		})}
+		if attachment.ContentType != "" {
+			settings = append(settings, gomail.SetHeader(map[string][]string{
+				"Content-Type": {attachment.ContentType},
+			}))
+		}
+		m.Attach(attachment.Name, settings...)
+	}
+
+	return m
+}
+
+// httpEmailError normalizes an error response of an email API by its status
+func httpEmailError(provider string, statusCode int, message string) *EmailError {
+	code := EmailErrorRejected
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		code = EmailErrorAuth
+	case statusCode == http.StatusTooManyRequests:
+		code = EmailErrorRateLimited
+	case statusCode >= 500:
+		code = EmailErrorUnavailable
+	}
+
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+
+	return &EmailError{Provider: provider, Code: code, StatusCode: statusCode, Message: message}
+}
+
+// requestEmailError normalizes a request that never got a response
+func requestEmailError(provider string, err error) *EmailError {
+	return &EmailError{Provider: provider, Code: EmailErrorUnavailable, Message: err.Error()}
+}
+
+// smtpEmailError normalizes an SMTP failure by its reply code. 4xx replies
+// are transient, 5xx permanent; failures without a reply mean the server
+// couldn't be reached.
+func smtpEmailError(err error) *EmailError {
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return &EmailError{Provider: EmailProviderSMTP, Code: EmailErrorUnavailable, Message: err.Error()}
+	}
+
+	code := EmailErrorRejected
+	switch {
+	case reply.Code == 530 || reply.Code == 534 || reply.Code == 535:
+		code = EmailErrorAuth
+	case reply.Code >= 400 && reply.Code < 500:
+		code = EmailErrorUnavailable
+	}
+
+	return &EmailError{Provider: EmailProviderSMTP, Code: code, StatusCode: reply.Code, Message: reply.Msg}
+}
+
+// emailBaseURL returns the configured endpoint of a provider or its default
+func emailBaseURL(config EmailConfig, defaultURL string) string {
+	if config.BaseURL != "" {
+		return strings.TrimRight(config.BaseURL, "/")
+	}
+	return defaultURL
+}
+
+// emailDomain returns the domain of an address, used in generated message IDs
+func emailDomain(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return strings.TrimSuffix(address[at+1:], ">")
+	}
+	return "localhost"
+}
+
+// splitAddress splits "Name <address>" into its address and name
+func splitAddress(address string) (string, string) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return strings.TrimSpace(address), ""
+	}
+	return parsed.Address, parsed.Name
+}
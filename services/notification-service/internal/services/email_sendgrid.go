@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const sendGridDefaultBaseURL = "https://api.sendgrid.com"
+
+// sendGridProvider sends email through the SendGrid v3 Mail Send API
+type sendGridProvider struct {
+	config EmailConfig
+	client *http.Client
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To  []sendGridAddress `json:"to"`
+	Cc  []sendGridAddress `json:"cc,omitempty"`
+	Bcc []sendGridAddress `json:"bcc,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content  string `json:"content"`
+	Type     string `json:"type,omitempty"`
+	Filename string `json:"filename"`
+}
+
+type sendGridMail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+}
+
+func (p *sendGridProvider) Name() string {
+	return EmailProviderSendGrid
+}
+
+func (p *sendGridProvider) Send(ctx context.Context, message EmailMessage) (*EmailResult, error) {
+	mail := sendGridMail{
+		Personalizations: []sendGridPersonalization{{
+			To:  sendGridAddresses(message.To),
+			Cc:  sendGridAddresses(message.Cc),
+			Bcc: sendGridAddresses(message.Bcc),
+		}},
+		From:    sendGridAddress{Email: p.config.From, Name: p.config.FromName},
+		Subject: message.Subject,
+		Headers: message.Headers,
+	}
+
+	// SendGrid wants the plain text part first
+	if message.Body != "" {
+		mail.Content = append(mail.Content, sendGridContent{Type: "text/plain", Value: message.Body})
+	}
+	if message.HTMLBody != "" {
+		mail.Content = append(mail.Content, sendGridContent{Type: "text/html", Value: message.HTMLBody})
+	}
+	if len(mail.Content) == 0 {
+		mail.Content = []sendGridContent{{Type: "text/plain", Value: " "}}
+	}
+
+	for _, attachment := range message.Attachments {
+		content, err := attachment.content()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %w", attachment.Name, err)
+		}
+		mail.Attachments = append(mail.Attachments, sendGridAttachment{
+			Content:  base64.StdEncoding.EncodeToString(content),
+			Type:     attachment.ContentType,
+			Filename: attachment.Name,
+		})
+	}
+
+	body, err := json.Marshal(mail)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SendGrid request: %w", err)
+	}
+
+	endpoint := emailBaseURL(p.config, sendGridDefaultBaseURL) + "/v3/mail/send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SendGrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, requestEmailError(EmailProviderSendGrid, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Errors []struct {
+				Message string `json:"message"`
+				Field   string `json:"field"`
+			} `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+
+		messages := make([]string, 0, len(failure.Errors))
+		for _, e := range failure.Errors {
+			if e.Field != "" {
+				messages = append(messages, e.Field+": "+e.Message)
+			} else {
+				messages = append(messages, e.Message)
+			}
+		}
+		return nil, httpEmailError(EmailProviderSendGrid, resp.StatusCode, strings.Join(messages, "; "))
+	}
+
+	return &EmailResult{
+		MessageID: resp.Header.Get("X-Message-Id"),
+		Provider:  EmailProviderSendGrid,
+		SentAt:    time.Now(),
+		Success:   true,
+	}, nil
+}
+
+// Helper functions
+func sendGridAddresses(addresses []string) []sendGridAddress {
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	result := make([]sendGridAddress, 0, len(addresses))
+	for _, address := range addresses {
+		email, name := splitAddress(address)
+		result = append(result, sendGridAddress{Email: email, Name: name})
+	}
+	return result
+}
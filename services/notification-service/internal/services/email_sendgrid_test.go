@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sendGridServer is a mock of the SendGrid Mail Send API answering with
+// status and response, recording the mails it receives
+type sendGridServer struct {
+	*httptest.Server
+	mails    []sendGridMail
+	status   int
+	response string
+}
+
+func newSendGridServer(t *testing.T) *sendGridServer {
+	server := &sendGridServer{status: http.StatusAccepted}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/mail/send" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer sendgrid-key" {
+			t.Errorf("Expected the API key as bearer token, got %q", r.Header.Get("Authorization"))
+		}
+
+		var mail sendGridMail
+		if err := json.NewDecoder(r.Body).Decode(&mail); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		server.mails = append(server.mails, mail)
+
+		w.Header().Set("X-Message-Id", "sendgrid-1")
+		w.WriteHeader(server.status)
+		w.Write([]byte(server.response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newSendGridTestProvider(server *sendGridServer) *sendGridProvider {
+	return &sendGridProvider{
+		config: EmailConfig{APIKey: "sendgrid-key", From: "isg@talimat.test", FromName: "Talimat İSG", BaseURL: server.URL},
+		client: server.Client(),
+	}
+}
+
+func TestSendGridSendsMails(t *testing.T) {
+	server := newSendGridServer(t)
+
+	result, err := newSendGridTestProvider(server).Send(context.Background(), EmailMessage{
+		To:          []string{"Ayşe Yılmaz <ayse@talimat.test>"},
+		Cc:          []string{"sef@talimat.test"},
+		Bcc:         []string{"arsiv@talimat.test"},
+		Subject:     "Eğitim hatırlatması",
+		Body:        "Yarın 09.00'da yangın eğitimi var",
+		HTMLBody:    "<p>Yarın 09.00'da yangın eğitimi var</p>",
+		Headers:     map[string]string{"X-Tenant": "tenant-a"},
+		Attachments: []EmailAttachment{{Name: "program.txt", ContentType: "text/plain", Data: []byte("09.00 Yangın")}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.MessageID != "sendgrid-1" || result.Provider != EmailProviderSendGrid || !result.Success {
+		t.Errorf("Expected the X-Message-Id to identify the send, got %+v", result)
+	}
+
+	mail := server.mails[0]
+	personalization := mail.Personalizations[0]
+	if len(personalization.To) != 1 || personalization.To[0] != (sendGridAddress{Email: "ayse@talimat.test", Name: "Ayşe Yılmaz"}) {
+		t.Errorf("Expected the recipient split into address and name, got %+v", personalization.To)
+	}
+	if len(personalization.Cc) != 1 || len(personalization.Bcc) != 1 || personalization.Bcc[0].Email != "arsiv@talimat.test" {
+		t.Errorf("Expected the Cc and Bcc recipients, got %+v", personalization)
+	}
+	if mail.From != (sendGridAddress{Email: "isg@talimat.test", Name: "Talimat İSG"}) || mail.Subject != "Eğitim hatırlatması" || mail.Headers["X-Tenant"] != "tenant-a" {
+		t.Errorf("Expected the sender, subject and headers, got %+v", mail)
+	}
+	if len(mail.Content) != 2 || mail.Content[0].Type != "text/plain" || mail.Content[1].Type != "text/html" {
+		t.Errorf("Expected the plain text part first, got %+v", mail.Content)
+	}
+	if len(mail.Attachments) != 1 || mail.Attachments[0].Content != base64.StdEncoding.EncodeToString([]byte("09.00 Yangın")) || mail.Attachments[0].Filename != "program.txt" {
+		t.Errorf("Expected the attachment in base64, got %+v", mail.Attachments)
+	}
+
+	// SendGrid refuses mails without content
+	if _, err := newSendGridTestProvider(server).Send(context.Background(), EmailMessage{To: []string{"ayse@talimat.test"}, Subject: "Boş"}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if content := server.mails[1].Content; len(content) != 1 || content[0].Value == "" {
+		t.Errorf("Expected a placeholder body, got %+v", content)
+	}
+}
+
+func TestSendGridErrorsAreNormalized(t *testing.T) {
+	for name, test := range map[string]struct {
+		status   int
+		response string
+		code     string
+		message  string
+	}{
+		"rejected field": {http.StatusBadRequest, `{"errors":[{"message":"Does not contain a valid address.","field":"personalizations.0.to.0.email"},{"message":"The from address is not verified."}]}`, EmailErrorRejected, "personalizations.0.to.0.email: Does not contain a valid address.; The from address is not verified."},
+		"bad key":        {http.StatusUnauthorized, `{"errors":[{"message":"The provided authorization grant is invalid, expired, or revoked"}]}`, EmailErrorAuth, "authorization grant is invalid"},
+		"rate limited":   {http.StatusTooManyRequests, `{}`, EmailErrorRateLimited, "Too Many Requests"},
+		"server error":   {http.StatusServiceUnavailable, `not JSON`, EmailErrorUnavailable, "Service Unavailable"},
+	} {
+		server := newSendGridServer(t)
+		server.status, server.response = test.status, test.response
+
+		_, err := newSendGridTestProvider(server).Send(context.Background(), EmailMessage{To: []string{"ayse@talimat.test"}, Subject: "Tatbikat", Body: "Tatbikat"})
+		var emailErr *EmailError
+		if !errors.As(err, &emailErr) {
+			t.Fatalf("%s: expected an email error, got %v", name, err)
+		}
+		if emailErr.Code != test.code || emailErr.StatusCode != test.status || !strings.Contains(emailErr.Message, test.message) {
+			t.Errorf("%s: expected %s with %q, got %+v", name, test.code, test.message, emailErr)
+		}
+	}
+
+	// Sends that get no response may succeed later
+	server := newSendGridServer(t)
+	server.Close()
+	_, err := newSendGridTestProvider(server).Send(context.Background(), EmailMessage{To: []string{"ayse@talimat.test"}, Body: "Tatbikat"})
+	var emailErr *EmailError
+	if !errors.As(err, &emailErr) || emailErr.Code != EmailErrorUnavailable || !emailErr.Temporary() {
+		t.Errorf("Expected unreachable providers to be unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sesProvider sends email through the Amazon SES v2 API. APIKey and APISecret
+// are the access key ID and secret access key of an IAM user.
+type sesProvider struct {
+	config EmailConfig
+	client *http.Client
+}
+
+// SES error types that mean something other than a rejected message
+var sesErrorCodes = map[string]string{
+	"TooManyRequestsException":           EmailErrorRateLimited,
+	"ThrottlingException":                EmailErrorRateLimited,
+	"LimitExceededException":             EmailErrorRateLimited,
+	"UnrecognizedClientException":        EmailErrorAuth,
+	"InvalidSignatureException":          EmailErrorAuth,
+	"AccessDeniedException":              EmailErrorAuth,
+	"ServiceUnavailableException":        EmailErrorUnavailable,
+	"InternalFailure":                    EmailErrorUnavailable,
+	"AccountSuspendedException":          EmailErrorRejected,
+	"SendingPausedException":             EmailErrorRejected,
+	"MailFromDomainNotVerifiedException": EmailErrorRejected,
+}
+
+func (p *sesProvider) Name() string {
+	return EmailProviderSES
+}
+
+func (p *sesProvider) Send(ctx context.Context, message EmailMessage) (*EmailResult, error) {
+	var raw bytes.Buffer
+	if _, err := buildMIMEMessage(p.config, message).WriteTo(&raw); err != nil {
+		return nil, fmt.Errorf("failed to build SES message: %w", err)
+	}
+
+	destination := map[string][]string{"ToAddresses": message.To}
+	if len(message.Cc) > 0 {
+		destination["CcAddresses"] = message.Cc
+	}
+	if len(message.Bcc) > 0 {
+		destination["BccAddresses"] = message.Bcc
+	}
+
+	// The raw content is base64 encoded by marshaling it as bytes
+	request := map[string]interface{}{
+		"FromEmailAddress": p.config.From,
+		"Destination":      destination,
+		"Content": map[string]interface{}{
+			"Raw": map[string][]byte{"Data": raw.Bytes()},
+		},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SES request: %w", err)
+	}
+
+	defaultURL := fmt.Sprintf("https://email.%s.amazonaws.com", p.config.Region)
+	endpoint := emailBaseURL(p.config, defaultURL) + "/v2/email/outbound-emails"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SES request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signAWSRequest(req, body, p.config.APIKey, p.config.APISecret, p.config.Region, "ses", time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, requestEmailError(EmailProviderSES, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+
+		emailErr := httpEmailError(EmailProviderSES, resp.StatusCode, failure.Message)
+		errorType := resp.Header.Get("X-Amzn-ErrorType")
+		if i := strings.Index(errorType, ":"); i >= 0 {
+			errorType = errorType[:i]
+		}
+		if code, ok := sesErrorCodes[errorType]; ok {
+			emailErr.Code = code
+		}
+		return nil, emailErr
+	}
+
+	var result struct {
+		MessageID string `json:"MessageId"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode SES response: %w", err)
+	}
+
+	return &EmailResult{
+		MessageID: result.MessageID,
+		Provider:  EmailProviderSES,
+		SentAt:    time.Now(),
+		Success:   true,
+	}, nil
+}
+
+// Helper functions
+
+// signAWSRequest signs a request with AWS Signature Version 4, the way the S3
+// archiver does for S3. Content-Type is signed when the request has one.
+func signAWSRequest(req *http.Request, body []byte, accessKey string, secretKey string, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		signedHeaders = "content-type;" + signedHeaders
+		canonicalHeaders = "content-type:" + contentType + "\n" + canonicalHeaders
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sesRequest is the body of an SES v2 SendEmail request
+type sesRequest struct {
+	FromEmailAddress string
+	Destination      map[string][]string
+	Content          struct {
+		Raw struct {
+			Data []byte
+		}
+	}
+}
+
+// sesServer is a mock of the SES v2 API answering with status, errorType and
+// response. It checks the signature the way AWS does, from the request it
+// received.
+type sesServer struct {
+	*httptest.Server
+	requests  []sesRequest
+	status    int
+	errorType string
+	response  string
+}
+
+func newSESServer(t *testing.T) *sesServer {
+	server := &sesServer{status: http.StatusOK, response: `{"MessageId":"ses-1"}`}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/email/outbound-emails" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if expected := sesTestSignature(r, body); r.Header.Get("Authorization") != expected {
+			t.Errorf("Expected the request to be signed as\n%s\ngot\n%s", expected, r.Header.Get("Authorization"))
+		}
+
+		var request sesRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		server.requests = append(server.requests, request)
+
+		if server.errorType != "" {
+			w.Header().Set("X-Amzn-ErrorType", server.errorType)
+		}
+		w.WriteHeader(server.status)
+		w.Write([]byte(server.response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sesTestSignature is the Authorization header AWS expects for a request
+// signed with the test credentials
+func sesTestSignature(r *http.Request, body []byte) string {
+	amzDate := r.Header.Get("X-Amz-Date")
+	scope := amzDate[:8] + "/eu-central-1/ses/aws4_request"
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"content-type:" + r.Header.Get("Content-Type") + "\n" +
+			"host:" + r.Host + "\n" +
+			"x-amz-content-sha256:" + sha256Hex(body) + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		"content-type;host;x-amz-content-sha256;x-amz-date",
+		sha256Hex(body),
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4ses-secret")
+	for _, part := range []string{amzDate[:8], "eu-central-1", "ses", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	return "AWS4-HMAC-SHA256 Credential=ses-key/" + scope +
+		", SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date" +
+		", Signature=" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func newSESTestProvider(server *sesServer) *sesProvider {
+	return &sesProvider{
+		config: EmailConfig{APIKey: "ses-key", APISecret: "ses-secret", Region: "eu-central-1", From: "isg@talimat.test", BaseURL: server.URL},
+		client: server.Client(),
+	}
+}
+
+func TestSESSendsSignedRawMessages(t *testing.T) {
+	server := newSESServer(t)
+
+	result, err := newSESTestProvider(server).Send(context.Background(), EmailMessage{
+		To:      []string{"ayse@talimat.test"},
+		Cc:      []string{"sef@talimat.test"},
+		Bcc:     []string{"arsiv@talimat.test"},
+		Subject: "Denetim raporu",
+		Body:    "Denetim raporu ektedir",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.MessageID != "ses-1" || result.Provider != EmailProviderSES || !result.Success {
+		t.Errorf("Expected the SES message ID to identify the send, got %+v", result)
+	}
+
+	request := server.requests[0]
+	if request.FromEmailAddress != "isg@talimat.test" {
+		t.Errorf("Expected the sender, got %q", request.FromEmailAddress)
+	}
+	for field, expected := range map[string]string{
+		"ToAddresses":  "ayse@talimat.test",
+		"CcAddresses":  "sef@talimat.test",
+		"BccAddresses": "arsiv@talimat.test",
+	} {
+		if addresses := request.Destination[field]; len(addresses) != 1 || addresses[0] != expected {
+			t.Errorf("Expected %s to be %s, got %v", field, expected, addresses)
+		}
+	}
+
+	// Bcc recipients are only envelope recipients
+	raw := string(request.Content.Raw.Data)
+	if !strings.Contains(raw, "Subject: Denetim raporu") || !strings.Contains(raw, "Cc: sef@talimat.test") || strings.Contains(raw, "arsiv@talimat.test") {
+		t.Errorf("Expected the MIME message without Bcc, got\n%s", raw)
+	}
+}
+
+func TestSESSignaturesCoverTheRequest(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	sign := func(body string, secret string) string {
+		req, _ := http.NewRequest(http.MethodPost, "https://email.eu-central-1.amazonaws.com/v2/email/outbound-emails", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		signAWSRequest(req, []byte(body), "ses-key", secret, "eu-central-1", "ses", now)
+
+		if req.Header.Get("X-Amz-Date") != "20260302T090000Z" || req.Header.Get("X-Amz-Content-Sha256") != sha256Hex([]byte(body)) {
+			t.Errorf("Expected the date and payload hash headers, got %v", req.Header)
+		}
+		return req.Header.Get("Authorization")
+	}
+
+	signature := sign(`{"a":1}`, "ses-secret")
+	if !strings.HasPrefix(signature, "AWS4-HMAC-SHA256 Credential=ses-key/20260302/eu-central-1/ses/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Errorf("Expected the credential scope and signed headers, got %s", signature)
+	}
+	if sign(`{"a":1}`, "ses-secret") != signature {
+		t.Errorf("Expected signing to be deterministic")
+	}
+	if sign(`{"a":2}`, "ses-secret") == signature || sign(`{"a":1}`, "other-secret") == signature {
+		t.Errorf("Expected the signature to depend on the body and the secret")
+	}
+}
+
+func TestSESErrorsAreNormalized(t *testing.T) {
+	for name, test := range map[string]struct {
+		status    int
+		errorType string
+		code      string
+	}{
+		"throttled":          {http.StatusBadRequest, "ThrottlingException", EmailErrorRateLimited},
+		"bad signature":      {http.StatusForbidden, "InvalidSignatureException:http://internal.amazon.com/coral/", EmailErrorAuth},
+		"paused account":     {http.StatusBadRequest, "SendingPausedException", EmailErrorRejected},
+		"unverified address": {http.StatusBadRequest, "MessageRejected", EmailErrorRejected},
+		"by status":          {http.StatusServiceUnavailable, "", EmailErrorUnavailable},
+	} {
+		server := newSESServer(t)
+		server.status, server.errorType, server.response = test.status, test.errorType, `{"message":"Email address is not verified."}`
+
+		_, err := newSESTestProvider(server).Send(context.Background(), EmailMessage{To: []string{"ayse@talimat.test"}, Subject: "Tatbikat", Body: "Tatbikat"})
+		var emailErr *EmailError
+		if !errors.As(err, &emailErr) {
+			t.Fatalf("%s: expected an email error, got %v", name, err)
+		}
+		if emailErr.Code != test.code || emailErr.StatusCode != test.status || emailErr.Message != "Email address is not verified." {
+			t.Errorf("%s: expected %s, got %+v", name, test.code, emailErr)
+		}
+	}
+}
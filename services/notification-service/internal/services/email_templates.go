@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Files of the templates directory:
+//
+//	NAME.html, NAME.mjml, NAME.txt, NAME.subject  an email template
+//	NAME.layout                                   the layout of a template, none for none
+//	layouts/NAME.html, layouts/NAME.mjml          a layout wrapping template HTML
+//	partials/NAME.html                            a block templates include
+//	branding.json                                 the branding layouts show
+//
+// A tenants/TENANT_ID/ directory holds the same files for a tenant, which
+// override the shared ones.
+const (
+	emailTemplateHTML    = ".html"
+	emailTemplateMJML    = ".mjml"
+	emailTemplateText    = ".txt"
+	emailTemplateSubject = ".subject"
+	emailTemplateLayout  = ".layout"
+	emailTenantsDir      = "tenants"
+	emailLayoutsDir      = "layouts"
+	emailPartialsDir     = "partials"
+	emailBrandingFile    = "branding.json"
+)
+
+// builtinEmailTemplates are used when the templates directory has no version
+// of a template
+var builtinEmailTemplates = map[string]*EmailTemplate{
+	"welcome": {
+		Name:    "welcome",
+		Subject: "Hoş Geldiniz",
+		HTML:    `<h1>Hoş Geldiniz {{.UserName}}!</h1><p>{{.CompanyName}} ailesine katıldığınız için teşekkürler.</p>`,
+		Text:    "Hoş Geldiniz {{.UserName}}! {{.CompanyName}} ailesine katıldığınız için teşekkürler.",
+	},
+	"password_reset": {
+		Name:    "password_reset",
+		Subject: "Şifre Sıfırlama",
+		HTML:    `<h1>Şifre Sıfırlama</h1><p>Şifrenizi sıfırlamak için <a href="{{.ResetURL}}">buraya tıklayın</a>.</p>`,
+		Text:    "Şifre Sıfırlama\n\nŞifrenizi sıfırlamak için: {{.ResetURL}}",
+	},
+	"document_notification": {
+		Name:    "document_notification",
+		Subject: "Doküman Bildirimi",
+		HTML:    `<h1>Doküman {{.Action}}</h1><p>{{.DocumentTitle}} dokümanı {{.Action}}.</p>`,
+		Text:    "Doküman {{.Action}}\n\n{{.DocumentTitle}} dokümanı {{.Action}}.",
+	},
+	"compliance_alert": {
+		Name:    "compliance_alert",
+		Subject: "Uyumluluk Uyarısı",
+		HTML:    `<h1>Uyumluluk Uyarısı</h1><p>{{.Description}}</p><p>Gerekli Aksiyon: {{.ActionRequired}}</p>`,
+		Text:    "Uyumluluk Uyarısı\n\n{{.Description}}\n\nGerekli Aksiyon: {{.ActionRequired}}",
+	},
+	"daily_digest": {
+		Name:    "daily_digest",
+		Subject: "Günlük Özet",
+		HTML:    `<h1>Günlük Özet - {{.Date}}</h1><p>Bugünkü aktiviteleri görüntüleyin.</p>`,
+		Text:    "Günlük Özet - {{.Date}}\n\nBugünkü aktiviteleri görüntüleyin.",
+	},
+	"notification_digest": {
+		Name:    "notification_digest",
+		Subject: "Bildirim Özeti",
+		HTML:    `<h1>Bildirim Özeti - {{.Date}}</h1><p>{{.Count}} yeni bildiriminiz var.</p><ul>{{range .Items}}<li><strong>{{.Title}}</strong> {{.Message}}</li>{{end}}</ul><p><a href="{{.NotificationsURL}}">Tüm bildirimleri görüntüleyin</a></p>`,
+		Text:    "Bildirim Özeti - {{.Date}}\n\n{{.Count}} yeni bildiriminiz var.\n{{range .Items}}\n- {{.Title}}: {{.Message}}{{end}}\n\nTüm bildirimler: {{.NotificationsURL}}",
+	},
+	"weekly_report": {
+		Name:    "weekly_report",
+		Subject: "Haftalık Rapor",
+		HTML:    `<h1>Haftalık Rapor</h1><p>{{.WeekStart}} - {{.WeekEnd}} arası rapor.</p>`,
+		Text:    "Haftalık Rapor\n\n{{.WeekStart}} - {{.WeekEnd}} arası rapor.",
+	},
+}
+
+// emailTemplateSet holds the files of the templates directory of one tenant,
+// or the shared ones
+type emailTemplateSet struct {
+	templates map[string]*EmailTemplate
+	layouts   map[string]string
+	partials  map[string]string
+	branding  *EmailBranding
+}
+
+func newEmailTemplateSet() *emailTemplateSet {
+	return &emailTemplateSet{
+		templates: make(map[string]*EmailTemplate),
+		layouts:   make(map[string]string),
+		partials:  make(map[string]string),
+	}
+}
+
+// emailTemplateStore loads email templates from a directory. The directory is
+// checked for changes at most once per reload interval and reloaded when a
+// file changed, so edited templates go live without a restart.
+type emailTemplateStore struct {
+	dir            string
+	reloadInterval time.Duration
+	mjmlCommand    string
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	signature string
+	// sets by tenant, "" for the shared one
+	sets map[string]*emailTemplateSet
+}
+
+func newEmailTemplateStore(dir string, reloadInterval time.Duration, mjmlCommand string) *emailTemplateStore {
+	return &emailTemplateStore{
+		dir:            dir,
+		reloadInterval: reloadInterval,
+		mjmlCommand:    mjmlCommand,
+		sets:           make(map[string]*emailTemplateSet),
+	}
+}
+
+// get returns the template of a tenant, the shared one or the built-in one
+func (s *emailTemplateStore) get(tenantID string, name string) (*EmailTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh()
+
+	for _, set := range s.chain(tenantID) {
+		if tmpl, ok := set.templates[name]; ok {
+			return tmpl, nil
+		}
+	}
+	if tmpl, ok := builtinEmailTemplates[name]; ok {
+		return tmpl, nil
+	}
+
+	return nil, notFoundf("email template %q not found, available templates: %s", name, strings.Join(s.names(tenantID), ", "))
+}
+
+// layout returns the layout, partials and branding a tenant renders with.
+// Tenant files override shared files, which override the built-in ones.
+func (s *emailTemplateStore) layout(tenantID string, name string) (string, map[string]string, EmailBranding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh()
+
+	chain := s.chain(tenantID)
+
+	layout, found := builtinEmailLayouts[name]
+	for i := len(chain) - 1; i >= 0; i-- {
+		if html, ok := chain[i].layouts[name]; ok {
+			layout, found = html, true
+		}
+	}
+	if !found {
+		return "", nil, EmailBranding{}, notFoundf("email layout %q not found", name)
+	}
+
+	partials := make(map[string]string)
+	branding := EmailBranding{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for partial, html := range chain[i].partials {
+			partials[partial] = html
+		}
+		if chain[i].branding != nil {
+			branding = branding.merge(*chain[i].branding)
+		}
+	}
+
+	return layout, partials, branding, nil
+}
+
+// chain returns the sets a tenant looks templates up in, its own first
+func (s *emailTemplateStore) chain(tenantID string) []*emailTemplateSet {
+	var chain []*emailTemplateSet
+	if set, ok := s.sets[tenantID]; ok && tenantID != "" {
+		chain = append(chain, set)
+	}
+	if set, ok := s.sets[""]; ok {
+		chain = append(chain, set)
+	}
+	return chain
+}
+
+// names lists the templates available to a tenant
+func (s *emailTemplateStore) names(tenantID string) []string {
+	seen := make(map[string]bool)
+	for name := range builtinEmailTemplates {
+		seen[name] = true
+	}
+	for _, set := range s.chain(tenantID) {
+		for name := range set.templates {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// refresh reloads the directory when its files changed since the last load.
+// A directory that fails to load keeps the templates loaded before.
+func (s *emailTemplateStore) refresh() {
+	if s.dir == "" {
+		return
+	}
+	if !s.checkedAt.IsZero() && (s.reloadInterval <= 0 || time.Since(s.checkedAt) < s.reloadInterval) {
+		return
+	}
+	s.checkedAt = time.Now()
+
+	files, signature, err := s.scan()
+	if err != nil {
+		log.Warn().Err(err).Str("dir", s.dir).Msg("Failed to scan email templates")
+		return
+	}
+	if signature == s.signature {
+		return
+	}
+
+	sets, err := s.load(files)
+	if err != nil {
+		log.Error().Err(err).Str("dir", s.dir).Msg("Failed to load email templates, keeping the previous ones")
+		return
+	}
+
+	s.sets = sets
+	s.signature = signature
+
+	log.Info().
+		Str("dir", s.dir).
+		Int("files", len(files)).
+		Msg("Email templates loaded")
+}
+
+// emailTemplateFile is a file found in the templates directory
+type emailTemplateFile struct {
+	path     string
+	tenantID string
+	kind     string // "", layouts or partials
+	name     string
+	ext      string
+}
+
+// scan lists the files of the directory and a signature of their
+// modification times and sizes that changes whenever one of them does
+func (s *emailTemplateStore) scan() ([]emailTemplateFile, string, error) {
+	if _, err := os.Stat(s.dir); os.IsNotExist(err) {
+		return nil, "", nil
+	}
+
+	var files []emailTemplateFile
+	var signature strings.Builder
+
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		file := emailTemplateFile{path: path}
+		if len(parts) > 2 && parts[0] == emailTenantsDir {
+			file.tenantID = parts[1]
+			parts = parts[2:]
+		}
+		switch {
+		case len(parts) == 1:
+		case len(parts) == 2 && (parts[0] == emailLayoutsDir || parts[0] == emailPartialsDir):
+			file.kind = parts[0]
+		default:
+			return nil
+		}
+
+		base := parts[len(parts)-1]
+		file.ext = filepath.Ext(base)
+		file.name = strings.TrimSuffix(base, file.ext)
+		if !file.known() {
+			return nil
+		}
+
+		files = append(files, file)
+		fmt.Fprintf(&signature, "%s:%d:%d;", rel, info.ModTime().UnixNano(), info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return files, signature.String(), nil
+}
+
+// known tells whether a file is one the store loads
+func (f emailTemplateFile) known() bool {
+	switch f.kind {
+	case emailLayoutsDir:
+		return f.ext == emailTemplateHTML || f.ext == emailTemplateMJML
+	case emailPartialsDir:
+		return f.ext == emailTemplateHTML
+	}
+	if f.name+f.ext == emailBrandingFile {
+		return true
+	}
+	switch f.ext {
+	case emailTemplateHTML, emailTemplateMJML, emailTemplateText, emailTemplateSubject, emailTemplateLayout:
+		return true
+	}
+	return false
+}
+
+// load reads and parses the files, failing on the first one that doesn't
+// parse so a broken edit never goes live
+func (s *emailTemplateStore) load(files []emailTemplateFile) (map[string]*emailTemplateSet, error) {
+	sets := make(map[string]*emailTemplateSet)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.path, err)
+		}
+
+		set, ok := sets[file.tenantID]
+		if !ok {
+			set = newEmailTemplateSet()
+			sets[file.tenantID] = set
+		}
+
+		content := string(data)
+		if file.ext == emailTemplateMJML {
+			if content, err = s.compileMJML(content); err != nil {
+				return nil, fmt.Errorf("failed to compile %s: %w", file.path, err)
+			}
+		}
+
+		switch {
+		case file.kind == emailLayoutsDir:
+			set.layouts[file.name] = content
+			continue
+		case file.kind == emailPartialsDir:
+			set.partials[file.name] = content
+			continue
+		case file.name+file.ext == emailBrandingFile:
+			var branding EmailBranding
+			if err := json.Unmarshal(data, &branding); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", file.path, err)
+			}
+			set.branding = &branding
+			continue
+		}
+
+		tmpl, ok := set.templates[file.name]
+		if !ok {
+			tmpl = &EmailTemplate{Name: file.name}
+			set.templates[file.name] = tmpl
+		}
+
+		switch file.ext {
+		case emailTemplateHTML, emailTemplateMJML:
+			tmpl.HTML = content
+		case emailTemplateText:
+			tmpl.Text = content
+		case emailTemplateSubject:
+			tmpl.Subject = strings.TrimSpace(content)
+		case emailTemplateLayout:
+			tmpl.Layout = strings.TrimSpace(content)
+		}
+	}
+
+	for tenantID, set := range sets {
+		for name, tmpl := range set.templates {
+			if tmpl.HTML == "" && tmpl.Text == "" {
+				return nil, fmt.Errorf("email template %s of tenant %q has no body", name, tenantID)
+			}
+			if _, err := htmltemplate.New(name).Parse(tmpl.HTML); err != nil {
+				return nil, fmt.Errorf("failed to parse email template %s of tenant %q: %w", name, tenantID, err)
+			}
+		}
+		for name, layout := range set.layouts {
+			if _, err := htmltemplate.New(name).Parse(layout); err != nil {
+				return nil, fmt.Errorf("failed to parse email layout %s of tenant %q: %w", name, tenantID, err)
+			}
+		}
+	}
+
+	return sets, nil
+}
+
+// compileMJML compiles MJML to responsive HTML with the configured command,
+// which reads MJML from stdin and writes HTML to stdout, e.g. mjml -i -s.
+// Template actions pass through the compiler as text.
+func (s *emailTemplateStore) compileMJML(mjml string) (string, error) {
+	fields := strings.Fields(s.mjmlCommand)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no MJML compiler configured")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stdin = strings.NewReader(mjml)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"claude-talimat/pkg/secrets"
+)
+
+// Error kinds callers can test for with errors.Is to tell client mistakes from
+// service failures
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrValidation = errors.New("validation failed")
+	ErrConflict   = errors.New("conflict")
+	// ErrUnauthorized is returned for inbound callbacks that fail verification
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// kindError tags an error with one of the error kinds while keeping its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// ProviderError is returned when a delivery provider rejected or failed a send
+type ProviderError struct {
+	Provider string
+	Err      error
+}
+
+// Error redacts secrets, as providers may quote the credentials of a request
+func (e *ProviderError) Error() string {
+	return secrets.Redact(fmt.Sprintf("provider %s failed: %v", e.Provider, e.Err))
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimitError is returned for sends held back because who they are for
+// used up one of their rate limits
+type RateLimitError struct {
+	Scope   string // who is limited, e.g. tenant acme
+	Limit   int
+	Unit    string // what is counted, e.g. notifications
+	Window  string // e.g. minute, hour or day
+	RetryAt time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s exceeded its limit of %d %s per %s", e.Scope, e.Limit, e.Unit, e.Window)
+}
+
+// Helper functions
+func notFoundf(format string, args ...interface{}) error {
+	return &kindError{kind: ErrNotFound, err: fmt.Errorf(format, args...)}
+}
+
+func conflictf(format string, args ...interface{}) error {
+	return &kindError{kind: ErrConflict, err: fmt.Errorf(format, args...)}
+}
+
+func invalid(err error) error {
+	return &kindError{kind: ErrValidation, err: err}
+}
+
+func unauthorizedf(format string, args ...interface{}) error {
+	return &kindError{kind: ErrUnauthorized, err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// History sort orders
+const (
+	HistorySortNewest = "newest"
+	HistorySortOldest = "oldest"
+)
+
+// MaxHistoryLimit caps the page size of history queries
+const MaxHistoryLimit = 100
+
+// historyQueryTTL bounds the life of an intersection a query failed to delete
+const historyQueryTTL = time.Minute
+
+// historyFields are the result fields the notification history can be filtered by
+var historyFields = []string{"type", "status", "category", "priority"}
+
+// HistoryQuery filters and pages the notification history of a tenant. Zero
+// values don't filter.
+type HistoryQuery struct {
+	TenantID string
+	UserID   string // deliveries to a user
+	Type     string // channel
+	Status   string
+	Category string
+	Priority string
+	Search   string     // matches notifications whose subject, title or message contain every word of it
+	From     *time.Time // created at or after, to the second
+	To       *time.Time // created at or before, to the second
+	Sort     string     // newest or oldest, newest when empty
+	Cursor   string     // next cursor of the previous page, the first page when empty
+	Limit    int        // at most MaxHistoryLimit, 20 when zero
+}
+
+// HistoryPage is a page of the notification history
+type HistoryPage struct {
+	Notifications []*NotificationResult `json:"notifications"`
+	Total         int64                 `json:"total"` // matches across all pages
+	NextCursor    string                `json:"next_cursor,omitempty"`
+	HasMore       bool                  `json:"has_more"`
+}
+
+// historyCursor is the position of the last result of a page
+type historyCursor struct {
+	Score int64  `json:"s"`
+	ID    string `json:"id"`
+}
+
+// QueryNotificationHistory returns a page of the notification results of a
+// tenant that match the query. Results are ordered by the index the retention
+// job ages them out by, their IDs break ties within a second. Filters are
+// resolved by intersecting index sets inside Redis, so pages are always full
+// and the total only counts matches. Results stored before the filter indexes
+// existed only show up in unfiltered queries.
+func (s *NotificationService) QueryNotificationHistory(ctx context.Context, query HistoryQuery) (*HistoryPage, error) {
+	if err := normalizeHistoryQuery(&query); err != nil {
+		return nil, err
+	}
+
+	cursor, err := decodeHistoryCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	key := s.getRetentionIndexKey(query.TenantID)
+
+	filterKeys, err := s.historyFilterKeys(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification history: %w", err)
+	}
+
+	// The history comes first so matches keep its scores
+	include := append([]string{key}, filterKeys...)
+	if len(include) > 1 {
+		key = s.getHistoryQueryKey()
+		weights := make([]float64, len(include))
+		weights[0] = 1
+
+		pipe := s.redis.TxPipeline()
+		pipe.ZInterStore(ctx, key, &redis.ZStore{Keys: include, Weights: weights})
+		pipe.Expire(ctx, key, historyQueryTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to query notification history: %w", err)
+		}
+		defer s.redis.Del(ctx, key)
+	}
+
+	min, max := "-inf", "+inf"
+	if query.From != nil {
+		min = strconv.FormatInt(query.From.Unix(), 10)
+	}
+	if query.To != nil {
+		max = strconv.FormatInt(query.To.Unix(), 10)
+	}
+
+	total, err := s.redis.ZCount(ctx, key, min, max).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count notification history: %w", err)
+	}
+
+	entries, err := s.historyEntries(ctx, key, query, cursor, min, max)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification history: %w", err)
+	}
+
+	page := &HistoryPage{
+		Notifications: []*NotificationResult{},
+		Total:         total,
+	}
+	if len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+		page.HasMore = true
+	}
+	if len(entries) == 0 {
+		return page, nil
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i], _ = entry.Member.(string)
+	}
+
+	results, err := s.GetNotificationStatuses(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result != nil {
+			page.Notifications = append(page.Notifications, result)
+		}
+	}
+
+	if page.HasMore {
+		last := entries[len(entries)-1]
+		page.NextCursor = encodeHistoryCursor(historyCursor{Score: int64(last.Score), ID: ids[len(ids)-1]})
+	}
+
+	return page, nil
+}
+
+// historyEntries returns up to one more entry than a page holds, so callers
+// know whether another page follows
+func (s *NotificationService) historyEntries(
+	ctx context.Context,
+	key string,
+	query HistoryQuery,
+	cursor *historyCursor,
+	min string,
+	max string,
+) ([]redis.Z, error) {
+	newest := query.Sort == HistorySortNewest
+	count := int64(query.Limit + 1)
+
+	if cursor == nil {
+		by := &redis.ZRangeBy{Min: min, Max: max, Count: count}
+		if newest {
+			return s.redis.ZRevRangeByScoreWithScores(ctx, key, by).Result()
+		}
+		return s.redis.ZRangeByScoreWithScores(ctx, key, by).Result()
+	}
+
+	// Continue right after the last result of the previous page
+	var rankCmd *redis.IntCmd
+	if newest {
+		rankCmd = s.redis.ZRevRank(ctx, key, cursor.ID)
+	} else {
+		rankCmd = s.redis.ZRank(ctx, key, cursor.ID)
+	}
+
+	rank, err := rankCmd.Result()
+	if err == nil {
+		var entries []redis.Z
+		if newest {
+			entries, err = s.redis.ZRevRangeWithScores(ctx, key, rank+1, rank+count).Result()
+		} else {
+			entries, err = s.redis.ZRangeWithScores(ctx, key, rank+1, rank+count).Result()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Ranges by rank run past the date range
+		for i, entry := range entries {
+			if (query.From != nil && entry.Score < float64(query.From.Unix())) ||
+				(query.To != nil && entry.Score > float64(query.To.Unix())) {
+				return entries[:i], nil
+			}
+		}
+		return entries, nil
+	}
+	if err != redis.Nil {
+		return nil, err
+	}
+
+	// The last result stopped matching since, like a pending one that was
+	// sent. Continue from its second and skip the results of that second
+	// the previous pages listed.
+	score := strconv.FormatInt(cursor.Score, 10)
+	ties, err := s.redis.ZCount(ctx, key, score, score).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	by := &redis.ZRangeBy{Min: score, Max: max, Count: count + ties}
+	if newest {
+		by.Min, by.Max = min, score
+	}
+
+	var entries []redis.Z
+	if newest {
+		entries, err = s.redis.ZRevRangeByScoreWithScores(ctx, key, by).Result()
+	} else {
+		entries, err = s.redis.ZRangeByScoreWithScores(ctx, key, by).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var after []redis.Z
+	for _, entry := range entries {
+		id, _ := entry.Member.(string)
+		if int64(entry.Score) == cursor.Score && ((newest && id >= cursor.ID) || (!newest && id <= cursor.ID)) {
+			continue
+		}
+		after = append(after, entry)
+	}
+	if int64(len(after)) > count {
+		after = after[:count]
+	}
+
+	return after, nil
+}
+
+// historyFilterKeys returns the index sets a result must be in to match a query
+func (s *NotificationService) historyFilterKeys(query HistoryQuery) ([]string, error) {
+	var keys []string
+
+	if query.UserID != "" {
+		keys = append(keys, s.getUserResultsKey(query.TenantID, query.UserID))
+	}
+
+	values := map[string]string{
+		"type":     query.Type,
+		"status":   query.Status,
+		"category": query.Category,
+		"priority": query.Priority,
+	}
+	for _, field := range historyFields {
+		if values[field] != "" {
+			keys = append(keys, s.getHistoryFacetKey(query.TenantID, field, values[field]))
+		}
+	}
+
+	for _, term := range searchTerms(query.Search) {
+		token, err := s.pii.searchToken(query.TenantID, term)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, s.getHistoryFacetKey(query.TenantID, "term", token))
+	}
+
+	return keys, nil
+}
+
+// indexHistory queues the commands adding a new result to the filter and
+// search indexes of the history. The tokens it is searchable by are kept so
+// they can be removed again without the request, which expires long before.
+// Terms are indexed by their tokens, keys and the kept tokens would otherwise
+// reveal the words of encrypted content.
+func (s *NotificationService) indexHistory(ctx context.Context, pipe redis.Pipeliner, result NotificationResult) {
+	for field, value := range historyFieldValues(result) {
+		pipe.SAdd(ctx, s.getHistoryFacetKey(result.TenantID, field, value), result.ID)
+	}
+
+	var tokens []string
+	for _, term := range searchTerms(result.searchText) {
+		token, err := s.pii.searchToken(result.TenantID, term)
+		if err != nil {
+			log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to index search term")
+			continue
+		}
+		pipe.SAdd(ctx, s.getHistoryFacetKey(result.TenantID, "term", token), result.ID)
+		tokens = append(tokens, token)
+	}
+	if len(tokens) > 0 {
+		pipe.HSet(ctx, s.getHistoryTermsKey(result.TenantID), result.ID, strings.Join(tokens, " "))
+	}
+}
+
+// reindexHistoryStatus moves a result whose status changed to its new status set
+func (s *NotificationService) reindexHistoryStatus(ctx context.Context, previous string, result NotificationResult) {
+	pipe := s.redis.TxPipeline()
+	if previous != "" {
+		pipe.SRem(ctx, s.getHistoryFacetKey(result.TenantID, "status", previous), result.ID)
+	}
+	pipe.SAdd(ctx, s.getHistoryFacetKey(result.TenantID, "status", result.Status), result.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to reindex result status")
+	}
+}
+
+// unindexHistory queues the commands removing results of a tenant from the
+// filter and search indexes of the history
+func (s *NotificationService) unindexHistory(ctx context.Context, pipe redis.Pipeliner, tenantID string, results []NotificationResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+
+	termsKey := s.getHistoryTermsKey(tenantID)
+	terms, err := s.redis.HMGet(ctx, termsKey, ids...).Result()
+	if err != nil {
+		log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to get indexed search terms")
+	}
+
+	for i, result := range results {
+		for field, value := range historyFieldValues(result) {
+			pipe.SRem(ctx, s.getHistoryFacetKey(tenantID, field, value), result.ID)
+		}
+		if i < len(terms) {
+			if joined, ok := terms[i].(string); ok {
+				for _, term := range strings.Fields(joined) {
+					pipe.SRem(ctx, s.getHistoryFacetKey(tenantID, "term", term), result.ID)
+				}
+			}
+		}
+	}
+	pipe.HDel(ctx, termsKey, ids...)
+}
+
+// eraseHistoryTerms makes an erased result unsearchable by the words of its content
+func (s *NotificationService) eraseHistoryTerms(ctx context.Context, result NotificationResult) error {
+	termsKey := s.getHistoryTermsKey(result.TenantID)
+
+	joined, err := s.redis.HGet(ctx, termsKey, result.ID).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get indexed search terms: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	for _, term := range strings.Fields(joined) {
+		pipe.SRem(ctx, s.getHistoryFacetKey(result.TenantID, "term", term), result.ID)
+	}
+	pipe.HDel(ctx, termsKey, result.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete indexed search terms: %w", err)
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *NotificationService) getHistoryFacetKey(tenantID string, field string, value string) string {
+	return fmt.Sprintf("notification_history:%s:%s:%s", retentionTenant(tenantID), field, value)
+}
+
+func (s *NotificationService) getHistoryTermsKey(tenantID string) string {
+	return fmt.Sprintf("notification_history_terms:%s", retentionTenant(tenantID))
+}
+
+func (s *NotificationService) getHistoryQueryKey() string {
+	return "notification_history_query:" + uuid.NewString()
+}
+
+// Helper functions
+func normalizeHistoryQuery(query *HistoryQuery) error {
+	switch query.Sort {
+	case "":
+		query.Sort = HistorySortNewest
+	case HistorySortNewest, HistorySortOldest:
+	default:
+		return invalid(fmt.Errorf("unknown sort order %q, use %s or %s", query.Sort, HistorySortNewest, HistorySortOldest))
+	}
+
+	if query.From != nil && query.To != nil && query.From.After(*query.To) {
+		return invalid(fmt.Errorf("from must not be after to"))
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = 20
+	}
+	if query.Limit > MaxHistoryLimit {
+		query.Limit = MaxHistoryLimit
+	}
+
+	return nil
+}
+
+func historyFieldValues(result NotificationResult) map[string]string {
+	values := map[string]string{
+		"type":     result.Type,
+		"status":   result.Status,
+		"category": result.Category,
+		"priority": result.Priority,
+	}
+	for field, value := range values {
+		if value == "" {
+			delete(values, field)
+		}
+	}
+	return values
+}
+
+// historyText returns the content of a request its results are searchable by
+func historyText(request NotificationRequest) string {
+	return strings.Join([]string{request.Subject, request.Title, request.Message}, " ")
+}
+
+func encodeHistoryCursor(cursor historyCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeHistoryCursor(value string) (*historyCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid(fmt.Errorf("invalid cursor"))
+	}
+
+	var cursor historyCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, invalid(fmt.Errorf("invalid cursor"))
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistorySearchTermsAreHashedWhenPersonalDataIsEncrypted(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	var err error
+	if env.service.pii, err = newPIICipher([]byte(strings.Repeat("k", 32)), env.service.redis); err != nil {
+		t.Fatalf("Failed to create PII cipher: %v", err)
+	}
+
+	expired := sendAged(t, env, 100*24*time.Hour)
+
+	words := []string{"vardiya", "haftalık", "yayınlandı"}
+	keys := env.service.redis.Keys(ctx, "notification_history*").Val()
+	for _, key := range keys {
+		for _, word := range words {
+			if strings.Contains(key, word) {
+				t.Errorf("Expected %q not to appear in key %s", word, key)
+			}
+		}
+	}
+	for id, terms := range env.service.redis.HGetAll(ctx, env.service.getHistoryTermsKey("tenant-a")).Val() {
+		for _, word := range words {
+			if strings.Contains(terms, word) {
+				t.Errorf("Expected %q not to be kept as a term of %s", word, id)
+			}
+		}
+	}
+
+	page, err := env.service.QueryNotificationHistory(ctx, HistoryQuery{TenantID: "tenant-a", Search: "VARDİYA"})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	if page.Total != 1 || len(page.Notifications) != 1 || page.Notifications[0].ID != expired.ID {
+		t.Fatalf("Expected the result to be found by a word of its message, got %d", page.Total)
+	}
+
+	// The kept tokens are enough to remove the result from the search index
+	if err := env.service.ApplyRetention("tenant-a"); err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+	if keys := env.service.redis.Keys(ctx, "notification_history:tenant-a:term:*").Val(); len(keys) != 0 {
+		t.Errorf("Expected the search index to be empty once the result is deleted, got %v", keys)
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
+)
+
+// Idempotency record statuses
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyService remembers the outcome of requests carrying an idempotency key
+type IdempotencyService struct {
+	redis  *redis.Client
+	config IdempotencyConfig
+}
+
+// IdempotencyConfig holds idempotency service configuration
+type IdempotencyConfig struct {
+	RedisURL      string
+	RedisPassword string
+	RedisDB       int
+	TTL           time.Duration // How long completed responses are replayed
+	LockTTL       time.Duration // How long an in-progress request holds its key
+}
+
+// IdempotencyRecord represents the stored outcome of an idempotent request
+type IdempotencyRecord struct {
+	RequestHash string    `json:"request_hash"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewIdempotencyService creates a new idempotency service instance
+func NewIdempotencyService(config IdempotencyConfig) (*IdempotencyService, error) {
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set default values
+	if config.TTL == 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.LockTTL == 0 {
+		config.LockTTL = 1 * time.Minute
+	}
+
+	return &IdempotencyService{
+		redis:  redisClient,
+		config: config,
+	}, nil
+}
+
+// maxReserveAttempts bounds how often a key released while it was looked up
+// is claimed again
+const maxReserveAttempts = 3
+
+// Reserve claims an idempotency key for a request. It returns nil when the key
+// was free and is now held by the caller, or the existing record otherwise.
+// Keys released and retaken on every attempt are reported as a conflict.
+func (s *IdempotencyService) Reserve(ctx context.Context, scope string, key string, requestHash string) (*IdempotencyRecord, error) {
+	redisKey := s.getIdempotencyKey(scope, key)
+
+	record := IdempotencyRecord{
+		RequestHash: requestHash,
+		Status:      IdempotencyInProgress,
+		CreatedAt:   time.Now(),
+	}
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	for attempt := 0; attempt < maxReserveAttempts; attempt++ {
+		reserved, err := s.redis.SetNX(ctx, redisKey, recordJSON, s.config.LockTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		existingJSON, err := s.redis.Get(ctx, redisKey).Result()
+		if err == redis.Nil {
+			// The previous holder released the key in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency record: %w", err)
+		}
+
+		var existing IdempotencyRecord
+		if err := json.Unmarshal([]byte(existingJSON), &existing); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+		}
+
+		return &existing, nil
+	}
+
+	return nil, conflictf("idempotency key %s was released and retaken %d times", key, maxReserveAttempts)
+}
+
+// Complete stores the response of a reserved request for later replay
+func (s *IdempotencyService) Complete(
+	ctx context.Context,
+	scope string,
+	key string,
+	requestHash string,
+	statusCode int,
+	contentType string,
+	body []byte,
+) error {
+	record := IdempotencyRecord{
+		RequestHash: requestHash,
+		Status:      IdempotencyCompleted,
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Body:        body,
+		CreatedAt:   time.Now(),
+	}
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getIdempotencyKey(scope, key), recordJSON, s.config.TTL).Err(); err != nil {
+		return fmt.Errorf("failed to store idempotency record: %w", err)
+	}
+
+	return nil
+}
+
+// Release frees a reserved key so the request can be retried
+func (s *IdempotencyService) Release(ctx context.Context, scope string, key string) error {
+	return s.redis.Del(ctx, s.getIdempotencyKey(scope, key)).Err()
+}
+
+// TestConnection tests the idempotency service connection
+func (s *IdempotencyService) TestConnection() error {
+	log.Info().Msg("Testing idempotency service connection")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.redis.Ping(ctx).Err(); err != nil {
+		log.Error().Err(err).Msg("Idempotency service connection test failed")
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+
+	log.Info().Msg("Idempotency service connection test successful")
+	return nil
+}
+
+// Redis key generators
+func (s *IdempotencyService) getIdempotencyKey(scope string, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", scope, key)
+}
@@ -0,0 +1,9 @@
+package services
+
+import "claude-talimat/pkg/ids"
+
+// newID returns a unique ID prefixed with the kind of what it identifies,
+// time-ordered like the IDs of the other services
+func newID(prefix string) string {
+	return ids.New(prefix)
+}
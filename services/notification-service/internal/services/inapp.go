@@ -3,17 +3,30 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
+)
+
+const (
+	// defaultInAppBatchSize bounds the notifications updated per transaction
+	defaultInAppBatchSize = 100
+	// maxMarkReadAttempts bounds retries of a batch that raced another update
+	maxMarkReadAttempts = 3
 )
 
 // InAppNotificationService handles in-app notifications
 type InAppNotificationService struct {
-	redis  *redis.Client
-	config InAppConfig
+	redis           *redis.Client
+	config          InAppConfig
+	actionListeners []ActionListener
+	readListeners   []ReadListener
+	pii             *piiCipher // encrypts titles, messages and data at rest
 }
 
 // InAppConfig holds in-app notification service configuration
@@ -24,6 +37,20 @@ type InAppConfig struct {
 	TTL           time.Duration // Default TTL for notifications
 	MaxRetries    int
 	BatchSize     int
+	EntityLinks   map[string]string // deep link templates by entity type, {id} is replaced by the entity ID
+
+	// OperationTimeout bounds how long a single inbox operation may wait on
+	// Redis, within the deadline of the request it serves
+	OperationTimeout time.Duration
+
+	// Attachments are limited to MaxAttachmentSize each, those in object
+	// storage are linked with URLs signed for AttachmentURLTTL when read
+	MaxAttachmentSize     int64
+	AttachmentURLTTL      time.Duration
+	AttachmentS3Endpoint  string // S3 or MinIO, AWS in AttachmentS3Region when empty
+	AttachmentS3Region    string
+	AttachmentS3AccessKey string
+	AttachmentS3SecretKey string
 }
 
 // InAppNotification represents an in-app notification
@@ -45,6 +72,28 @@ type InAppNotification struct {
 	ActionURL  string                 `json:"action_url,omitempty"`
 	ActionText string                 `json:"action_text,omitempty"`
 	Tags       []string               `json:"tags"`
+
+	// Notifications sharing a thread key are grouped into one thread
+	ThreadKey string `json:"thread_key,omitempty"`
+
+	// The document, incident or task the notification is about
+	Entity *EntityRef `json:"entity,omitempty"`
+
+	// Files travelling with the notification, linked when it is read
+	Attachments []InAppAttachment `json:"attachments,omitempty"`
+
+	// Collapsing of repeated notifications
+	CollapseKey    string     `json:"collapse_key,omitempty"`
+	CollapseCount  int        `json:"collapse_count,omitempty"`
+	LastOccurredAt *time.Time `json:"last_occurred_at,omitempty"`
+
+	// Snoozed notifications are hidden from the inbox until SnoozedUntil
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	SnoozeRepush bool       `json:"snooze_repush,omitempty"`
+
+	// Actions the user can respond with, and the response once given
+	Actions  []NotificationAction `json:"actions,omitempty"`
+	Response *ActionResponse      `json:"response,omitempty"`
 }
 
 // NotificationTemplate represents a notification template
@@ -54,14 +103,37 @@ type NotificationTemplate struct {
 	Type       string                 `json:"type"`
 	Title      string                 `json:"title"`
 	Message    string                 `json:"message"`
+	Subject    string                 `json:"subject,omitempty"`
+	HTMLBody   string                 `json:"html_body,omitempty"`
+	TextBody   string                 `json:"text_body,omitempty"`
 	DataSchema map[string]interface{} `json:"data_schema"`
+	Variables  []string               `json:"variables,omitempty"`
 	Priority   string                 `json:"priority"`
 	Category   string                 `json:"category"`
+	Locale     string                 `json:"locale,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
 	TTL        time.Duration          `json:"ttl"`
 	IsActive   bool                   `json:"is_active"`
+	IsDefault  bool                   `json:"is_default"`
+	Version    int                    `json:"version"`
 	TenantID   string                 `json:"tenant_id"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt  time.Time              `json:"created_at"`
 	UpdatedAt  time.Time              `json:"updated_at"`
+
+	// Definitions type the variables renders are checked against
+	Definitions []TemplateVariable `json:"variable_definitions,omitempty"`
+
+	// ParentID is the template this one inherits from. Fields left empty are
+	// the parent's, fields holding only {{define}} blocks override the
+	// blocks of the parent's field.
+	ParentID string `json:"parent_id,omitempty"`
+
+	// Status is draft while the template differs from the version
+	// notifications are sent with, PublishedVersion
+	Status           string     `json:"status,omitempty"`
+	PublishedVersion int        `json:"published_version,omitempty"`
+	PublishedAt      *time.Time `json:"published_at,omitempty"`
 }
 
 // NotificationPreferences represents user notification preferences
@@ -76,6 +148,8 @@ type NotificationPreferences struct {
 	SMS        bool            `json:"sms"`
 	Push       bool            `json:"push"`
 	InApp      bool            `json:"in_app"`
+	Digest     string          `json:"digest"`             // immediate, hourly, daily, weekly
+	Timezone   string          `json:"timezone,omitempty"` // delivery windows are read in it
 	UpdatedAt  time.Time       `json:"updated_at"`
 }
 
@@ -90,29 +164,20 @@ type QuietHours struct {
 
 // NewInAppNotificationService creates a new in-app notification service instance
 func NewInAppNotificationService(config InAppConfig) (*InAppNotificationService, error) {
-	// Parse Redis URL
-	redisOpts, err := redis.ParseURL(config.RedisURL)
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		return nil, err
 	}
 
-	// Override with config values
-	if config.RedisPassword != "" {
-		redisOpts.Password = config.RedisPassword
+	if config.EntityLinks == nil {
+		config.EntityLinks = defaultEntityLinks
 	}
-	if config.RedisDB != 0 {
-		redisOpts.DB = config.RedisDB
-	}
-
-	// Create Redis client
-	redisClient := redis.NewClient(redisOpts)
-
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	if config.OperationTimeout == 0 {
+		config.OperationTimeout = 5 * time.Second
 	}
 
 	return &InAppNotificationService{
@@ -122,19 +187,119 @@ func NewInAppNotificationService(config InAppConfig) (*InAppNotificationService,
 }
 
 // CreateNotification creates a new in-app notification
-func (s *InAppNotificationService) CreateNotification(notification InAppNotification) (*InAppNotification, error) {
+func (s *InAppNotificationService) CreateNotification(ctx context.Context, notification InAppNotification) (*InAppNotification, error) {
 	log.Info().
 		Str("userID", notification.UserID).
 		Str("type", notification.Type).
 		Str("title", notification.Title).
 		Msg("Creating in-app notification")
 
-	// Validate notification
-	if err := s.validateNotification(notification); err != nil {
-		return nil, fmt.Errorf("notification validation failed: %w", err)
+	notificationJSON, err := s.prepareNotification(&notification)
+	if err != nil {
+		return nil, err
+	}
+
+	// The notification and its indexes are written in one round trip
+	pipe := s.redis.Pipeline()
+	stored, unread := s.queueNotification(ctx, pipe, &notification, notificationJSON)
+	if _, err := pipe.Exec(ctx); err != nil && stored.Err() == nil {
+		log.Error().Err(err).Msg("Failed to index notification")
+	}
+	if err := stored.Err(); err != nil {
+		return nil, fmt.Errorf("failed to store notification: %w", err)
+	}
+	s.publishUnreadDelta(ctx, notification.UserID, notification.TenantID, UnreadReasonCreated, unread.Val(), notification.ID)
+
+	log.Info().
+		Str("notificationID", notification.ID).
+		Msg("In-app notification created successfully")
+
+	s.signAttachments(&notification)
+	return &notification, nil
+}
+
+// CreateNotificationsBulk creates many in-app notifications, writing them in
+// pipelines of the configured batch size. No notification is created unless
+// all of them are valid. The created notifications are returned in order,
+// with an error for those that could not be stored.
+func (s *InAppNotificationService) CreateNotificationsBulk(ctx context.Context, notifications []InAppNotification) ([]*InAppNotification, error) {
+	log.Info().Int("count", len(notifications)).Msg("Creating in-app notifications")
+
+	prepared := make([]InAppNotification, len(notifications))
+	notificationJSONs := make([][]byte, len(notifications))
+	for i, notification := range notifications {
+		notificationJSON, err := s.prepareNotification(&notification)
+		if err != nil {
+			return nil, fmt.Errorf("notification %d: %w", i, err)
+		}
+		prepared[i] = notification
+		notificationJSONs[i] = notificationJSON
+	}
+
+	batchSize := s.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultInAppBatchSize
+	}
+
+	created := make([]*InAppNotification, 0, len(prepared))
+	failed := 0
+	// Each user is told about their new unread notifications once
+	type feed struct{ userID, tenantID string }
+	var feeds []feed
+	unreadIDs := make(map[feed][]string)
+	for i := 0; i < len(prepared); i += batchSize {
+		end := i + batchSize
+		if end > len(prepared) {
+			end = len(prepared)
+		}
+
+		pipe := s.redis.Pipeline()
+		stored := make([]*redis.StatusCmd, end-i)
+		unread := make([]*redis.IntCmd, end-i)
+		for j := i; j < end; j++ {
+			stored[j-i], unread[j-i] = s.queueNotification(ctx, pipe, &prepared[j], notificationJSONs[j])
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to write notification batch")
+		}
+
+		for j := i; j < end; j++ {
+			if err := stored[j-i].Err(); err != nil {
+				failed++
+				continue
+			}
+			if unread[j-i].Val() > 0 {
+				key := feed{prepared[j].UserID, prepared[j].TenantID}
+				if _, ok := unreadIDs[key]; !ok {
+					feeds = append(feeds, key)
+				}
+				unreadIDs[key] = append(unreadIDs[key], prepared[j].ID)
+			}
+			s.signAttachments(&prepared[j])
+			created = append(created, &prepared[j])
+		}
+	}
+
+	for _, key := range feeds {
+		ids := unreadIDs[key]
+		s.publishUnreadDelta(ctx, key.userID, key.tenantID, UnreadReasonCreated, int64(len(ids)), ids...)
+	}
+
+	if failed > 0 {
+		return created, fmt.Errorf("failed to store %d of %d notifications", failed, len(prepared))
+	}
+
+	log.Info().Int("count", len(created)).Msg("In-app notifications created successfully")
+	return created, nil
+}
+
+// prepareNotification validates a notification, sets its defaults and
+// returns its stored form
+func (s *InAppNotificationService) prepareNotification(notification *InAppNotification) ([]byte, error) {
+	if err := s.validateNotification(*notification); err != nil {
+		return nil, invalid(fmt.Errorf("notification validation failed: %w", err))
 	}
 
-	// Set default values
 	if notification.ID == "" {
 		notification.ID = generateNotificationID()
 	}
@@ -146,138 +311,213 @@ func (s *InAppNotificationService) CreateNotification(notification InAppNotifica
 		notification.ExpiresAt = &expiresAt
 	}
 
-	// Store in Redis
-	ctx := context.Background()
-	key := s.getNotificationKey(notification.ID)
-
-	notificationJSON, err := json.Marshal(notification)
+	notificationJSON, err := s.pii.marshalInApp(*notification)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal notification: %w", err)
 	}
+	return notificationJSON, nil
+}
 
-	// Store notification
-	if err := s.redis.Set(ctx, key, notificationJSON, s.config.TTL).Err(); err != nil {
-		return nil, fmt.Errorf("failed to store notification: %w", err)
-	}
+// queueNotification queues the commands storing a notification and adding it
+// to the user's list, unread set and indexes. The returned commands report
+// whether the notification itself was stored and whether it was new to the
+// unread set.
+func (s *InAppNotificationService) queueNotification(
+	ctx context.Context,
+	pipe redis.Pipeliner,
+	notification *InAppNotification,
+	notificationJSON []byte,
+) (*redis.StatusCmd, *redis.IntCmd) {
+	stored := pipe.Set(ctx, s.getNotificationKey(notification.ID), notificationJSON, s.config.TTL)
 
-	// Add to user's notification list
+	score := float64(notification.CreatedAt.Unix())
 	userKey := s.getUserNotificationsKey(notification.UserID, notification.TenantID)
-	if err := s.redis.ZAdd(ctx, userKey, &redis.Z{
-		Score:  float64(notification.CreatedAt.Unix()),
-		Member: notification.ID,
-	}).Err(); err != nil {
-		log.Error().Err(err).Msg("Failed to add notification to user list")
-	}
+	pipe.ZAdd(ctx, userKey, &redis.Z{Score: score, Member: notification.ID})
 
-	// Add to unread set
 	unreadKey := s.getUnreadKey(notification.UserID, notification.TenantID)
-	if err := s.redis.SAdd(ctx, unreadKey, notification.ID).Err(); err != nil {
-		log.Error().Err(err).Msg("Failed to add notification to unread set")
-	}
+	unread := pipe.SAdd(ctx, unreadKey, notification.ID)
 
-	// Add to category index
 	categoryKey := s.getCategoryKey(notification.Category, notification.TenantID)
-	if err := s.redis.ZAdd(ctx, categoryKey, &redis.Z{
-		Score:  float64(notification.CreatedAt.Unix()),
+	pipe.ZAdd(ctx, categoryKey, &redis.Z{Score: score, Member: notification.ID})
+
+	// Add to the user's filter and search indexes
+	s.indexNotification(ctx, pipe, notification)
+	s.touchThread(ctx, pipe, notification, notification.CreatedAt)
+	s.indexEntity(ctx, pipe, notification)
+	s.expireIndex(ctx, pipe, userKey)
+	s.expireIndex(ctx, pipe, unreadKey)
+	s.expireIndex(ctx, pipe, categoryKey)
+
+	// Count towards the response rates of actionable notifications
+	s.recordActionDelivery(ctx, pipe, notification)
+
+	return stored, unread
+}
+
+// CollapseNotification records a repeated occurrence of a notification instead of creating a new one
+func (s *InAppNotificationService) CollapseNotification(ctx context.Context, notificationID string, count int, occurredAt time.Time) error {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	notification, err := s.GetNotification(ctx, notificationID)
+	if err != nil {
+		return fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	notification.CollapseCount = count
+	notification.LastOccurredAt = &occurredAt
+
+	key := s.getNotificationKey(notificationID)
+
+	notificationJSON, err := s.pii.marshalInApp(*notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, key, notificationJSON, s.config.TTL).Err(); err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+
+	// Move the notification to the top of the user's list
+	userKey := s.getUserNotificationsKey(notification.UserID, notification.TenantID)
+	pipe := s.redis.Pipeline()
+	pipe.ZAdd(ctx, userKey, &redis.Z{
+		Score:  float64(occurredAt.Unix()),
 		Member: notification.ID,
-	}).Err(); err != nil {
-		log.Error().Err(err).Msg("Failed to add notification to category index")
+	})
+	s.expireIndex(ctx, pipe, userKey)
+	s.touchThread(ctx, pipe, notification, occurredAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to reorder collapsed notification")
 	}
 
-	log.Info().
-		Str("notificationID", notification.ID).
-		Msg("In-app notification created successfully")
+	log.Debug().
+		Str("notificationID", notificationID).
+		Int("count", count).
+		Msg("In-app notification collapsed")
 
-	return &notification, nil
+	return nil
 }
 
-// GetUserNotifications gets notifications for a specific user
+// GetUserNotifications gets notifications for a specific user. Filters may
+// hold type, category, priority and thread values, read and archived flags and
+// a search string matched against the words of the title and message.
 func (s *InAppNotificationService) GetUserNotifications(
+	ctx context.Context,
 	userID string,
 	tenantID string,
 	page int,
 	limit int,
 	filters map[string]interface{},
 ) ([]*InAppNotification, int, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("userID", userID).
 		Int("page", page).
 		Int("limit", limit).
 		Msg("Getting user notifications")
 
-	ctx := context.Background()
 	userKey := s.getUserNotificationsKey(userID, tenantID)
 
-	// Get total count
-	total, err := s.redis.ZCard(ctx, userKey).Result()
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get notification count: %w", err)
-	}
+	// Deliver tenant broadcasts before the inbox is read
+	s.deliverBroadcasts(ctx, userID, tenantID)
 
 	// Calculate pagination
 	start := int64((page - 1) * limit)
 	stop := start + int64(limit) - 1
 
-	// Get notification IDs (newest first)
-	notificationIDs, err := s.redis.ZRevRange(ctx, userKey, start, stop).Result()
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get notification IDs: %w", err)
+	var notificationIDs []string
+	var total int64
+	var err error
+
+	if len(filters) == 0 {
+		// Get total count
+		total, err = s.redis.ZCard(ctx, userKey).Result()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get notification count: %w", err)
+		}
+
+		// Get notification IDs (newest first)
+		notificationIDs, err = s.redis.ZRevRange(ctx, userKey, start, stop).Result()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get notification IDs: %w", err)
+		}
+	} else {
+		notificationIDs, total, err = s.queryUserNotifications(ctx, userID, tenantID, start, stop, filters)
+		if err != nil {
+			return nil, 0, err
+		}
 	}
 
 	// Get notification details
 	var notifications []*InAppNotification
 	for _, id := range notificationIDs {
-		notification, err := s.GetNotification(id)
+		notification, err := s.GetNotification(ctx, id)
 		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				// Expired notifications only linger in the user's list
+				s.redis.ZRem(ctx, userKey, id)
+				continue
+			}
 			log.Warn().Err(err).Str("notificationID", id).Msg("Failed to get notification")
 			continue
 		}
 
-		// Apply filters
-		if s.matchesFilters(notification, filters) {
-			notifications = append(notifications, notification)
-		}
+		notifications = append(notifications, notification)
 	}
 
 	return notifications, int(total), nil
 }
 
 // GetNotification gets a specific notification by ID
-func (s *InAppNotificationService) GetNotification(notificationID string) (*InAppNotification, error) {
-	ctx := context.Background()
+func (s *InAppNotificationService) GetNotification(ctx context.Context, notificationID string) (*InAppNotification, error) {
 	key := s.getNotificationKey(notificationID)
 
 	notificationJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("notification not found: %s", notificationID)
+			return nil, notFoundf("notification not found: %s", notificationID)
 		}
 		return nil, fmt.Errorf("failed to get notification: %w", err)
 	}
 
-	var notification InAppNotification
-	if err := json.Unmarshal([]byte(notificationJSON), &notification); err != nil {
+	notification, err := s.pii.unmarshalInApp(notificationJSON)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal notification: %w", err)
 	}
+	s.signAttachments(notification)
 
-	return &notification, nil
+	return notification, nil
+}
+
+// ReadListener is called after a user read a notification
+type ReadListener func(notification *InAppNotification)
+
+// OnRead registers a listener for notifications being read
+func (s *InAppNotificationService) OnRead(listener ReadListener) {
+	s.readListeners = append(s.readListeners, listener)
 }
 
 // MarkAsRead marks a notification as read
-func (s *InAppNotificationService) MarkAsRead(notificationID string, userID string) error {
+func (s *InAppNotificationService) MarkAsRead(ctx context.Context, notificationID string, userID string) error {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("notificationID", notificationID).
 		Str("userID", userID).
 		Msg("Marking notification as read")
 
-	notification, err := s.GetNotification(notificationID)
+	notification, err := s.GetNotification(ctx, notificationID)
 	if err != nil {
 		return fmt.Errorf("failed to get notification: %w", err)
 	}
 
 	// Check if user owns this notification
 	if notification.UserID != userID {
-		return fmt.Errorf("user %s does not own notification %s", userID, notificationID)
+		return notFoundf("notification not found: %s", notificationID)
 	}
 
 	// Update notification
@@ -286,10 +526,9 @@ func (s *InAppNotificationService) MarkAsRead(notificationID string, userID stri
 	notification.ReadAt = &now
 
 	// Store updated notification
-	ctx := context.Background()
 	key := s.getNotificationKey(notificationID)
 
-	notificationJSON, err := json.Marshal(notification)
+	notificationJSON, err := s.pii.marshalInApp(*notification)
 	if err != nil {
 		return fmt.Errorf("failed to marshal notification: %w", err)
 	}
@@ -300,9 +539,15 @@ func (s *InAppNotificationService) MarkAsRead(notificationID string, userID stri
 
 	// Remove from unread set
 	unreadKey := s.getUnreadKey(userID, notification.TenantID)
-	if err := s.redis.SRem(ctx, unreadKey, notificationID).Err(); err != nil {
+	removed, err := s.redis.SRem(ctx, unreadKey, notificationID).Result()
+	if err != nil {
 		log.Error().Err(err).Msg("Failed to remove notification from unread set")
 	}
+	s.publishUnreadDelta(ctx, userID, notification.TenantID, UnreadReasonRead, -removed, notificationID)
+
+	for _, listener := range s.readListeners {
+		listener(notification)
+	}
 
 	log.Info().
 		Str("notificationID", notificationID).
@@ -311,60 +556,209 @@ func (s *InAppNotificationService) MarkAsRead(notificationID string, userID stri
 	return nil
 }
 
-// MarkAllAsRead marks all notifications as read for a user
-func (s *InAppNotificationService) MarkAllAsRead(userID string, tenantID string) error {
+// MarkAsUnread marks a read notification as unread again. Snoozed
+// notifications count as unread once they resurface.
+func (s *InAppNotificationService) MarkAsUnread(ctx context.Context, notificationID string, userID string) error {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	log.Info().
+		Str("notificationID", notificationID).
+		Str("userID", userID).
+		Msg("Marking notification as unread")
+
+	notification, err := s.GetNotification(ctx, notificationID)
+	if err != nil {
+		return fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	// Check if user owns this notification
+	if notification.UserID != userID {
+		return notFoundf("notification not found: %s", notificationID)
+	}
+
+	// Update notification
+	notification.Read = false
+	notification.ReadAt = nil
+
+	notificationJSON, err := s.pii.marshalInApp(*notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	unreadKey := s.getUnreadKey(userID, notification.TenantID)
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getNotificationKey(notificationID), notificationJSON, s.config.TTL)
+	var added *redis.IntCmd
+	if notification.SnoozedUntil == nil {
+		added = pipe.SAdd(ctx, unreadKey, notificationID)
+		s.expireIndex(ctx, pipe, unreadKey)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	if added != nil {
+		s.publishUnreadDelta(ctx, userID, notification.TenantID, UnreadReasonUnread, added.Val(), notificationID)
+	}
+
+	log.Info().
+		Str("notificationID", notificationID).
+		Msg("Notification marked as unread")
+
+	return nil
+}
+
+// MarkAllAsRead marks all notifications as read for a user and returns how
+// many were marked. Notifications are updated in batches, each batch costing
+// one read and one transaction regardless of its size.
+func (s *InAppNotificationService) MarkAllAsRead(ctx context.Context, userID string, tenantID string) (int, error) {
 	log.Info().
 		Str("userID", userID).
 		Msg("Marking all notifications as read")
 
-	ctx := context.Background()
 	unreadKey := s.getUnreadKey(userID, tenantID)
 
+	// Broadcasts not delivered yet are marked read too
+	s.deliverBroadcasts(ctx, userID, tenantID)
+
 	// Get all unread notification IDs
 	unreadIDs, err := s.redis.SMembers(ctx, unreadKey).Result()
 	if err != nil {
-		return fmt.Errorf("failed to get unread notifications: %w", err)
+		return 0, fmt.Errorf("failed to get unread notifications: %w", err)
+	}
+
+	batchSize := s.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultInAppBatchSize
 	}
 
-	// Mark each as read
-	for _, id := range unreadIDs {
-		if err := s.MarkAsRead(id, userID); err != nil {
-			log.Warn().Err(err).Str("notificationID", id).Msg("Failed to mark notification as read")
+	marked := 0
+	now := time.Now()
+	for i := 0; i < len(unreadIDs); i += batchSize {
+		end := i + batchSize
+		if end > len(unreadIDs) {
+			end = len(unreadIDs)
 		}
+
+		// Every batch gets the operation timeout of its own
+		batchCtx, cancel := s.withOperationTimeout(ctx)
+		count, err := s.markBatchAsRead(batchCtx, userID, tenantID, unreadIDs[i:end], now)
+		cancel()
+		if err != nil {
+			return marked, err
+		}
+		marked += count
 	}
 
 	log.Info().
-		Int("count", len(unreadIDs)).
+		Int("count", marked).
 		Msg("All notifications marked as read")
 
-	return nil
+	return marked, nil
+}
+
+// markBatchAsRead marks a batch of unread notifications as read in one
+// transaction. The notifications are watched so a concurrent update is retried
+// instead of being overwritten.
+func (s *InAppNotificationService) markBatchAsRead(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	ids []string,
+	readAt time.Time,
+) (int, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.getNotificationKey(id)
+	}
+
+	var marked int
+	var removed []*redis.IntCmd
+	update := func(tx *redis.Tx) error {
+		values, err := tx.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+
+		marked = 0
+		removed = removed[:0]
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, value := range values {
+				notificationJSON, ok := value.(string)
+				if !ok {
+					// Expired notifications only linger in the unread set
+					removed = append(removed, pipe.SRem(ctx, s.getUnreadKey(userID, tenantID), ids[i]))
+					continue
+				}
+
+				notification, err := s.pii.unmarshalInApp(notificationJSON)
+				if err != nil {
+					log.Warn().Err(err).Str("notificationID", ids[i]).Msg("Failed to unmarshal notification")
+					continue
+				}
+				if notification.UserID != userID {
+					continue
+				}
+
+				if !notification.Read {
+					notification.Read = true
+					notification.ReadAt = &readAt
+
+					updated, err := s.pii.marshalInApp(*notification)
+					if err != nil {
+						return fmt.Errorf("failed to marshal notification: %w", err)
+					}
+					pipe.Set(ctx, keys[i], updated, s.config.TTL)
+					marked++
+				}
+				removed = append(removed, pipe.SRem(ctx, s.getUnreadKey(userID, tenantID), ids[i]))
+			}
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxMarkReadAttempts; attempt++ {
+		err := s.redis.Watch(ctx, update, keys...)
+		if err == nil {
+			s.publishUnreadDelta(ctx, userID, tenantID, UnreadReasonRead, -unreadChange(removed))
+			return marked, nil
+		}
+		if err != redis.TxFailedErr {
+			return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+		}
+	}
+
+	return 0, fmt.Errorf("failed to mark notifications as read: too many concurrent updates")
 }
 
 // ArchiveNotification archives a notification
-func (s *InAppNotificationService) ArchiveNotification(notificationID string, userID string) error {
+func (s *InAppNotificationService) ArchiveNotification(ctx context.Context, notificationID string, userID string) error {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("notificationID", notificationID).
 		Str("userID", userID).
 		Msg("Archiving notification")
 
-	notification, err := s.GetNotification(notificationID)
+	notification, err := s.GetNotification(ctx, notificationID)
 	if err != nil {
 		return fmt.Errorf("failed to get notification: %w", err)
 	}
 
 	// Check if user owns this notification
 	if notification.UserID != userID {
-		return fmt.Errorf("user %s does not own notification %s", userID, notificationID)
+		return notFoundf("notification not found: %s", notificationID)
 	}
 
 	// Update notification
 	notification.Archived = true
 
 	// Store updated notification
-	ctx := context.Background()
 	key := s.getNotificationKey(notificationID)
 
-	notificationJSON, err := json.Marshal(notification)
+	notificationJSON, err := s.pii.marshalInApp(*notification)
 	if err != nil {
 		return fmt.Errorf("failed to marshal notification: %w", err)
 	}
@@ -373,6 +767,15 @@ func (s *InAppNotificationService) ArchiveNotification(notificationID string, us
 		return fmt.Errorf("failed to update notification: %w", err)
 	}
 
+	// Add to archived index
+	archivedKey := s.getArchivedKey(userID, notification.TenantID)
+	if err := s.redis.SAdd(ctx, archivedKey, notificationID).Err(); err != nil {
+		log.Error().Err(err).Msg("Failed to add notification to archived index")
+	}
+	if s.config.TTL > 0 {
+		s.redis.Expire(ctx, archivedKey, s.config.TTL)
+	}
+
 	log.Info().
 		Str("notificationID", notificationID).
 		Msg("Notification archived")
@@ -381,27 +784,28 @@ func (s *InAppNotificationService) ArchiveNotification(notificationID string, us
 }
 
 // DeleteNotification deletes a notification
-func (s *InAppNotificationService) DeleteNotification(notificationID string, userID string) error {
+func (s *InAppNotificationService) DeleteNotification(ctx context.Context, notificationID string, userID string) error {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("notificationID", notificationID).
 		Str("userID", userID).
 		Msg("Deleting notification")
 
-	notification, err := s.GetNotification(notificationID)
+	notification, err := s.GetNotification(ctx, notificationID)
 	if err != nil {
 		return fmt.Errorf("failed to get notification: %w", err)
 	}
 
 	// Check if user owns this notification
 	if notification.UserID != userID {
-		return fmt.Errorf("user %s does not own notification %s", userID, notificationID)
+		return notFoundf("notification not found: %s", notificationID)
 	}
 
-	ctx := context.Background()
-
 	// Remove from Redis
 	key := s.getNotificationKey(notificationID)
-	if err := s.redis.Del(ctx, key).Err(); err != nil {
+	if err := s.redis.Del(ctx, key, s.getActionResponseKey(notificationID)).Err(); err != nil {
 		return fmt.Errorf("failed to delete notification: %w", err)
 	}
 
@@ -413,9 +817,11 @@ func (s *InAppNotificationService) DeleteNotification(notificationID string, use
 
 	// Remove from unread set
 	unreadKey := s.getUnreadKey(userID, notification.TenantID)
-	if err := s.redis.SRem(ctx, unreadKey, notificationID).Err(); err != nil {
+	removed, err := s.redis.SRem(ctx, unreadKey, notificationID).Result()
+	if err != nil {
 		log.Error().Err(err).Msg("Failed to remove notification from unread set")
 	}
+	s.publishUnreadDelta(ctx, userID, notification.TenantID, UnreadReasonDeleted, -removed, notificationID)
 
 	// Remove from category index
 	categoryKey := s.getCategoryKey(notification.Category, notification.TenantID)
@@ -423,6 +829,20 @@ func (s *InAppNotificationService) DeleteNotification(notificationID string, use
 		log.Error().Err(err).Msg("Failed to remove notification from category index")
 	}
 
+	// Remove from the user's filter and search indexes
+	pipe := s.redis.Pipeline()
+	s.unindexNotification(ctx, pipe, notification)
+	if notification.SnoozedUntil != nil {
+		pipe.ZRem(ctx, s.getSnoozedKey(userID, notification.TenantID), notificationID)
+		pipe.ZRem(ctx, s.getSnoozeDueKey(), notificationID)
+	}
+	if notification.Entity != nil {
+		pipe.ZRem(ctx, s.getEntityKey(notification.TenantID, notification.Entity.Type, notification.Entity.ID), notificationID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to remove notification from user indexes")
+	}
+
 	log.Info().
 		Str("notificationID", notificationID).
 		Msg("Notification deleted")
@@ -431,10 +851,14 @@ func (s *InAppNotificationService) DeleteNotification(notificationID string, use
 }
 
 // GetUnreadCount gets the count of unread notifications for a user
-func (s *InAppNotificationService) GetUnreadCount(userID string, tenantID string) (int, error) {
-	ctx := context.Background()
+func (s *InAppNotificationService) GetUnreadCount(ctx context.Context, userID string, tenantID string) (int, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	unreadKey := s.getUnreadKey(userID, tenantID)
 
+	s.deliverBroadcasts(ctx, userID, tenantID)
+
 	count, err := s.redis.SCard(ctx, unreadKey).Result()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get unread count: %w", err)
@@ -444,14 +868,18 @@ func (s *InAppNotificationService) GetUnreadCount(userID string, tenantID string
 }
 
 // GetNotificationStats gets notification statistics for a user
-func (s *InAppNotificationService) GetNotificationStats(userID string, tenantID string) (map[string]int, error) {
+func (s *InAppNotificationService) GetNotificationStats(ctx context.Context, userID string, tenantID string) (map[string]int, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("userID", userID).
 		Msg("Getting notification statistics")
 
-	ctx := context.Background()
 	userKey := s.getUserNotificationsKey(userID, tenantID)
 
+	s.deliverBroadcasts(ctx, userID, tenantID)
+
 	// Get total count
 	total, err := s.redis.ZCard(ctx, userKey).Result()
 	if err != nil {
@@ -459,13 +887,13 @@ func (s *InAppNotificationService) GetNotificationStats(userID string, tenantID
 	}
 
 	// Get unread count
-	unreadCount, err := s.GetUnreadCount(userID, tenantID)
+	unreadCount, err := s.GetUnreadCount(ctx, userID, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get unread count: %w", err)
 	}
 
 	// Get notifications for detailed stats
-	notifications, _, err := s.GetUserNotifications(userID, tenantID, 1, 1000, nil)
+	notifications, _, err := s.GetUserNotifications(ctx, userID, tenantID, 1, 1000, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get notifications for stats: %w", err)
 	}
@@ -499,7 +927,10 @@ func (s *InAppNotificationService) GetNotificationStats(userID string, tenantID
 }
 
 // CreateTemplate creates a new notification template
-func (s *InAppNotificationService) CreateTemplate(template NotificationTemplate) (*NotificationTemplate, error) {
+func (s *InAppNotificationService) CreateTemplate(ctx context.Context, template NotificationTemplate) (*NotificationTemplate, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("name", template.Name).
 		Str("type", template.Type).
@@ -507,7 +938,7 @@ func (s *InAppNotificationService) CreateTemplate(template NotificationTemplate)
 
 	// Validate template
 	if err := s.validateTemplate(template); err != nil {
-		return nil, fmt.Errorf("template validation failed: %w", err)
+		return nil, invalid(fmt.Errorf("template validation failed: %w", err))
 	}
 
 	// Set default values
@@ -520,7 +951,6 @@ func (s *InAppNotificationService) CreateTemplate(template NotificationTemplate)
 	template.UpdatedAt = time.Now()
 
 	// Store in Redis
-	ctx := context.Background()
 	key := s.getTemplateKey(template.ID)
 
 	templateJSON, err := json.Marshal(template)
@@ -549,14 +979,16 @@ func (s *InAppNotificationService) CreateTemplate(template NotificationTemplate)
 }
 
 // GetTemplate gets a notification template by ID
-func (s *InAppNotificationService) GetTemplate(templateID string) (*NotificationTemplate, error) {
-	ctx := context.Background()
+func (s *InAppNotificationService) GetTemplate(ctx context.Context, templateID string) (*NotificationTemplate, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	key := s.getTemplateKey(templateID)
 
 	templateJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("template not found: %s", templateID)
+			return nil, notFoundf("template not found: %s", templateID)
 		}
 		return nil, fmt.Errorf("failed to get template: %w", err)
 	}
@@ -570,12 +1002,15 @@ func (s *InAppNotificationService) GetTemplate(templateID string) (*Notification
 }
 
 // UpdateTemplate updates a notification template
-func (s *InAppNotificationService) UpdateTemplate(templateID string, updates map[string]interface{}) (*NotificationTemplate, error) {
+func (s *InAppNotificationService) UpdateTemplate(ctx context.Context, templateID string, updates map[string]interface{}) (*NotificationTemplate, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("templateID", templateID).
 		Msg("Updating notification template")
 
-	template, err := s.GetTemplate(templateID)
+	template, err := s.GetTemplate(ctx, templateID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get template: %w", err)
 	}
@@ -602,7 +1037,6 @@ func (s *InAppNotificationService) UpdateTemplate(templateID string, updates map
 	}
 
 	// Store updated template
-	ctx := context.Background()
 	key := s.getTemplateKey(templateID)
 
 	templateJSON, err := json.Marshal(template)
@@ -622,13 +1056,14 @@ func (s *InAppNotificationService) UpdateTemplate(templateID string, updates map
 }
 
 // DeleteTemplate deletes a notification template
-func (s *InAppNotificationService) DeleteTemplate(templateID string) error {
+func (s *InAppNotificationService) DeleteTemplate(ctx context.Context, templateID string) error {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("templateID", templateID).
 		Msg("Deleting notification template")
 
-	ctx := context.Background()
-
 	// Remove from Redis
 	key := s.getTemplateKey(templateID)
 	if err := s.redis.Del(ctx, key).Err(); err != nil {
@@ -649,8 +1084,10 @@ func (s *InAppNotificationService) DeleteTemplate(templateID string) error {
 }
 
 // GetUserPreferences gets notification preferences for a user
-func (s *InAppNotificationService) GetUserPreferences(userID string, tenantID string) (*NotificationPreferences, error) {
-	ctx := context.Background()
+func (s *InAppNotificationService) GetUserPreferences(ctx context.Context, userID string, tenantID string) (*NotificationPreferences, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	key := s.getPreferencesKey(userID, tenantID)
 
 	preferencesJSON, err := s.redis.Get(ctx, key).Result()
@@ -672,15 +1109,19 @@ func (s *InAppNotificationService) GetUserPreferences(userID string, tenantID st
 
 // UpdateUserPreferences updates notification preferences for a user
 func (s *InAppNotificationService) UpdateUserPreferences(
+	ctx context.Context,
 	userID string,
 	tenantID string,
 	updates map[string]interface{},
 ) (*NotificationPreferences, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
 	log.Info().
 		Str("userID", userID).
 		Msg("Updating user notification preferences")
 
-	preferences, err := s.GetUserPreferences(userID, tenantID)
+	preferences, err := s.GetUserPreferences(ctx, userID, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get preferences: %w", err)
 	}
@@ -689,13 +1130,13 @@ func (s *InAppNotificationService) UpdateUserPreferences(
 	preferences.UpdatedAt = time.Now()
 
 	// Update fields based on updates map
-	if categories, ok := updates["categories"].(map[string]bool); ok {
+	if categories, ok := boolMap(updates["categories"]); ok {
 		preferences.Categories = categories
 	}
-	if types, ok := updates["types"].(map[string]bool); ok {
+	if types, ok := boolMap(updates["types"]); ok {
 		preferences.Types = types
 	}
-	if priority, ok := updates["priority"].(map[string]bool); ok {
+	if priority, ok := boolMap(updates["priority"]); ok {
 		preferences.Priority = priority
 	}
 	if quietHours, ok := updates["quiet_hours"].(QuietHours); ok {
@@ -713,9 +1154,20 @@ func (s *InAppNotificationService) UpdateUserPreferences(
 	if inApp, ok := updates["in_app"].(bool); ok {
 		preferences.InApp = inApp
 	}
+	if digest, ok := updates["digest"].(string); ok {
+		if !isValidDigestFrequency(digest) {
+			return nil, fmt.Errorf("invalid digest frequency: %s", digest)
+		}
+		preferences.Digest = digest
+	}
+	if timezone, ok := updates["timezone"].(string); ok {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+			return nil, invalid(fmt.Errorf("invalid time zone: %s", timezone))
+		}
+		preferences.Timezone = timezone
+	}
 
 	// Store updated preferences
-	ctx := context.Background()
 	key := s.getPreferencesKey(userID, tenantID)
 
 	preferencesJSON, err := json.Marshal(preferences)
@@ -772,6 +1224,22 @@ func (s *InAppNotificationService) validateNotification(notification InAppNotifi
 		return fmt.Errorf("notification message is required")
 	}
 
+	if len(notification.ThreadKey) > maxThreadKeyLength {
+		return fmt.Errorf("thread key is longer than %d characters", maxThreadKeyLength)
+	}
+
+	if err := validateActions(notification.Actions); err != nil {
+		return err
+	}
+
+	if err := s.validateEntity(notification.Entity); err != nil {
+		return err
+	}
+
+	if err := s.validateInAppAttachments(notification.Attachments); err != nil {
+		return err
+	}
+
 	if notification.Priority == "" {
 		notification.Priority = "normal"
 	}
@@ -804,43 +1272,6 @@ func (s *InAppNotificationService) validateTemplate(template NotificationTemplat
 	return nil
 }
 
-// matchesFilters checks if a notification matches the given filters
-func (s *InAppNotificationService) matchesFilters(
-	notification *InAppNotification,
-	filters map[string]interface{},
-) bool {
-	if filters == nil {
-		return true
-	}
-
-	for key, value := range filters {
-		switch key {
-		case "type":
-			if typeStr, ok := value.(string); ok && notification.Type != typeStr {
-				return false
-			}
-		case "category":
-			if categoryStr, ok := value.(string); ok && notification.Category != categoryStr {
-				return false
-			}
-		case "priority":
-			if priorityStr, ok := value.(string); ok && notification.Priority != priorityStr {
-				return false
-			}
-		case "read":
-			if readBool, ok := value.(bool); ok && notification.Read != readBool {
-				return false
-			}
-		case "archived":
-			if archivedBool, ok := value.(bool); ok && notification.Archived != archivedBool {
-				return false
-			}
-		}
-	}
-
-	return true
-}
-
 // getDefaultPreferences returns default notification preferences
 func (s *InAppNotificationService) getDefaultPreferences(userID string, tenantID string) *NotificationPreferences {
 	return &NotificationPreferences{
@@ -876,10 +1307,16 @@ func (s *InAppNotificationService) getDefaultPreferences(userID string, tenantID
 		SMS:       true,
 		Push:      true,
 		InApp:     true,
+		Digest:    DigestImmediate,
 		UpdatedAt: time.Now(),
 	}
 }
 
+// withOperationTimeout bounds an inbox operation by the operation timeout
+func (s *InAppNotificationService) withOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.config.OperationTimeout)
+}
+
 // Redis key generators
 func (s *InAppNotificationService) getNotificationKey(notificationID string) string {
 	return fmt.Sprintf("notification:%s", notificationID)
@@ -914,9 +1351,29 @@ func (s *InAppNotificationService) getPreferencesKey(userID string, tenantID str
 
 // Helper functions
 func generateNotificationID() string {
-	return fmt.Sprintf("notif_%d", time.Now().UnixNano())
+	return newID("notif")
 }
 
 func generateTemplateID() string {
-	return fmt.Sprintf("tmpl_%d", time.Now().UnixNano())
+	return newID("tmpl")
+}
+
+// boolMap reads a map of flags of preference updates, given as is or decoded
+// from JSON
+func boolMap(value interface{}) (map[string]bool, bool) {
+	switch value := value.(type) {
+	case map[string]bool:
+		return value, true
+	case map[string]interface{}:
+		flags := make(map[string]bool, len(value))
+		for key, flag := range value {
+			enabled, ok := flag.(bool)
+			if !ok {
+				return nil, false
+			}
+			flags[key] = enabled
+		}
+		return flags, true
+	}
+	return nil, false
 }
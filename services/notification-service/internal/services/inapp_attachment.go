@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of in-app attachments
+const (
+	AttachmentKindDocument = "document" // a document of the document service
+	AttachmentKindImage    = "image"    // an image in object storage
+	AttachmentKindPDF      = "pdf"      // a PDF in object storage
+)
+
+// maxInAppAttachments bounds the attachments of one notification
+const maxInAppAttachments = 10
+
+// Limits used when the configuration sets none
+const (
+	defaultMaxInAppAttachmentSize = 25 << 20
+	defaultAttachmentURLTTL       = 15 * time.Minute
+)
+
+// InAppAttachment is a file travelling with an in-app notification, like the
+// safety procedure an alert is about. Files in object storage are referenced
+// by s3://bucket/key and handed out as URLs signed when the notification is
+// read, so links in old notifications never outlive their signature.
+type InAppAttachment struct {
+	Kind        string `json:"kind"` // document, image or pdf
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`        // in bytes, required for files in object storage
+	ObjectURL   string `json:"object_url,omitempty"`  // s3://bucket/key of images and PDFs
+	DocumentID  string `json:"document_id,omitempty"` // of document attachments
+
+	// The link to the file, set when the notification is read
+	URL          string     `json:"url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// validateInAppAttachments validates the attachments of a notification
+func (s *InAppNotificationService) validateInAppAttachments(attachments []InAppAttachment) error {
+	if len(attachments) > maxInAppAttachments {
+		return fmt.Errorf("at most %d attachments are allowed", maxInAppAttachments)
+	}
+
+	maxSize := s.config.MaxAttachmentSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxInAppAttachmentSize
+	}
+
+	for i, attachment := range attachments {
+		if attachment.Name == "" {
+			return fmt.Errorf("attachment %d: name is required", i)
+		}
+
+		switch attachment.Kind {
+		case AttachmentKindDocument:
+			if attachment.DocumentID == "" || attachment.ObjectURL != "" {
+				return fmt.Errorf("attachment %d: documents are referenced by document_id only", i)
+			}
+		case AttachmentKindImage, AttachmentKindPDF:
+			if _, _, err := parseObjectURL(attachment.ObjectURL); err != nil {
+				return fmt.Errorf("attachment %d: %w", i, err)
+			}
+			if attachment.DocumentID != "" {
+				return fmt.Errorf("attachment %d: files in object storage have no document_id", i)
+			}
+			if attachment.Size <= 0 {
+				return fmt.Errorf("attachment %d: size is required", i)
+			}
+		default:
+			return fmt.Errorf("attachment %d: kind must be document, image or pdf", i)
+		}
+
+		if attachment.Size > maxSize {
+			return fmt.Errorf("attachment %s is larger than %d bytes", attachment.Name, maxSize)
+		}
+		if attachment.Kind == AttachmentKindImage && attachment.ContentType != "" && !strings.HasPrefix(attachment.ContentType, "image/") {
+			return fmt.Errorf("attachment %d: images must have an image content type", i)
+		}
+		if attachment.Kind == AttachmentKindPDF && attachment.ContentType != "" && attachment.ContentType != "application/pdf" {
+			return fmt.Errorf("attachment %d: PDFs must have the application/pdf content type", i)
+		}
+	}
+	return nil
+}
+
+// signAttachments links the attachments of a notification read now: files
+// in object storage get URLs signed for the configured time, documents the
+// deep link of documents
+func (s *InAppNotificationService) signAttachments(notification *InAppNotification) {
+	if len(notification.Attachments) == 0 {
+		return
+	}
+
+	ttl := s.config.AttachmentURLTTL
+	if ttl <= 0 {
+		ttl = defaultAttachmentURLTTL
+	}
+	now := time.Now()
+
+	// The stored attachments are shared with copies of the notification
+	signed := make([]InAppAttachment, len(notification.Attachments))
+	for i, attachment := range notification.Attachments {
+		attachment.URL = ""
+		attachment.URLExpiresAt = nil
+
+		switch attachment.Kind {
+		case AttachmentKindDocument:
+			if _, ok := s.config.EntityLinks["document"]; ok {
+				attachment.URL = s.entityLink(&EntityRef{Type: "document", ID: attachment.DocumentID})
+			}
+		default:
+			if attachment.Kind == AttachmentKindPDF && attachment.ContentType == "" {
+				attachment.ContentType = "application/pdf"
+			}
+			bucket, key, err := parseObjectURL(attachment.ObjectURL)
+			if err != nil {
+				break
+			}
+			expiresAt := now.Add(ttl)
+			attachment.URL = s.presignObjectURL(bucket, key, ttl, now)
+			attachment.URLExpiresAt = &expiresAt
+		}
+		signed[i] = attachment
+	}
+	notification.Attachments = signed
+}
+
+// presignObjectURL returns a path-style URL of an object carrying an AWS
+// Signature Version 4 in its query, valid for ttl. Without credentials the
+// object is linked as is, for public buckets.
+func (s *InAppNotificationService) presignObjectURL(bucket string, key string, ttl time.Duration, now time.Time) string {
+	region := s.config.AttachmentS3Region
+	if region == "" {
+		region = "eu-central-1"
+	}
+	endpoint := strings.TrimRight(s.config.AttachmentS3Endpoint, "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+
+	path := strings.TrimRight(endpointURL.Path, "/") + "/" + awsURIEncode(bucket) + "/" + awsURIEncode(key)
+	link := endpointURL.Scheme + "://" + endpointURL.Host + path
+	if s.config.AttachmentS3AccessKey == "" {
+		return link
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	scope := date + "/" + region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.config.AttachmentS3AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	// Signatures are computed over %20, not the + of form encoding
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		path,
+		canonicalQuery,
+		"host:" + endpointURL.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.config.AttachmentS3SecretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return link + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+// Helper functions
+
+// parseObjectURL splits an s3://bucket/key URL
+func parseObjectURL(rawURL string) (string, string, error) {
+	objectURL, err := url.Parse(rawURL)
+	if err != nil || objectURL.Scheme != "s3" || objectURL.Host == "" || strings.TrimPrefix(objectURL.Path, "/") == "" {
+		return "", "", fmt.Errorf("object URL must be s3://bucket/key")
+	}
+	return objectURL.Host, strings.TrimPrefix(objectURL.Path, "/"), nil
+}
+
+// awsURIEncode escapes a path the way AWS signatures expect, every byte but
+// unreserved characters and slashes
+func awsURIEncode(path string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(path) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Operations on notifications selected in the notification center
+const (
+	BatchOperationRead    = "read"
+	BatchOperationUnread  = "unread"
+	BatchOperationArchive = "archive"
+	BatchOperationDelete  = "delete"
+)
+
+// Outcomes of a batch operation for one notification
+const (
+	BatchStatusDone     = "done"
+	BatchStatusNotFound = "not_found"
+	BatchStatusFailed   = "failed"
+)
+
+// MaxNotificationBatchSize is how many notifications one batch operation may select
+const MaxNotificationBatchSize = 100
+
+// BatchOperationResult is the outcome of a batch operation for one notification
+type BatchOperationResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // done, not_found or failed
+	Error  string `json:"error,omitempty"`
+}
+
+// ApplyToNotifications applies an operation to notifications a user selected
+// in their notification center and returns its outcome per notification, in
+// the order of the IDs. Notifications of other users or tenants are reported
+// as not found, and one failing notification doesn't stop the others.
+func (s *InAppNotificationService) ApplyToNotifications(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	operation string,
+	notificationIDs []string,
+) ([]BatchOperationResult, error) {
+	log.Info().
+		Str("userID", userID).
+		Str("operation", operation).
+		Int("count", len(notificationIDs)).
+		Msg("Applying operation to selected notifications")
+
+	var apply func(ctx context.Context, notificationID string, userID string) error
+	switch operation {
+	case BatchOperationRead:
+		apply = s.MarkAsRead
+	case BatchOperationUnread:
+		apply = s.MarkAsUnread
+	case BatchOperationArchive:
+		apply = s.ArchiveNotification
+	case BatchOperationDelete:
+		apply = s.DeleteNotification
+	default:
+		return nil, invalid(fmt.Errorf("invalid batch operation: %s", operation))
+	}
+
+	if len(notificationIDs) == 0 {
+		return nil, invalid(fmt.Errorf("at least one notification is required"))
+	}
+	if len(notificationIDs) > MaxNotificationBatchSize {
+		return nil, invalid(fmt.Errorf("at most %d notifications can be selected at once", MaxNotificationBatchSize))
+	}
+
+	results := make([]BatchOperationResult, len(notificationIDs))
+	for i, notificationID := range notificationIDs {
+		results[i] = BatchOperationResult{ID: notificationID, Status: BatchStatusDone}
+
+		// Every notification gets the operation timeout of its own
+		operationCtx, cancel := s.withOperationTimeout(ctx)
+		notification, err := s.GetNotification(operationCtx, notificationID)
+		if err == nil && (notification.UserID != userID || notification.TenantID != tenantID) {
+			err = notFoundf("notification not found: %s", notificationID)
+		}
+		if err == nil {
+			err = apply(operationCtx, notificationID, userID)
+		}
+		cancel()
+
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrNotFound):
+			results[i].Status = BatchStatusNotFound
+		default:
+			log.Warn().Err(err).Str("notificationID", notificationID).Str("operation", operation).Msg("Failed to apply operation to notification")
+			results[i].Status = BatchStatusFailed
+			results[i].Error = err.Error()
+		}
+	}
+
+	return results, nil
+}
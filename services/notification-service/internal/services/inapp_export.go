@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// exportBatchSize is how many notifications an export loads at once
+const exportBatchSize = 200
+
+// ExportUserNotifications passes the in-app notifications of a user that
+// reached their feed between from and to to emit, oldest first. Zero times
+// leave that end of the range open. Notifications are loaded in batches, so
+// the history of a user can be streamed whatever its length. The export stops
+// at the first error emit returns.
+func (s *InAppNotificationService) ExportUserNotifications(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	from time.Time,
+	to time.Time,
+	emit func(*InAppNotification) error,
+) error {
+	log.Info().
+		Str("userID", userID).
+		Str("tenantID", tenantID).
+		Time("from", from).
+		Time("to", to).
+		Msg("Exporting user notifications")
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return invalid(fmt.Errorf("export range ends before it starts"))
+	}
+
+	s.deliverBroadcasts(ctx, userID, tenantID)
+
+	scoreRange := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: exportBatchSize}
+	if !from.IsZero() {
+		scoreRange.Min = strconv.FormatInt(from.Unix(), 10)
+	}
+	if !to.IsZero() {
+		scoreRange.Max = strconv.FormatInt(to.Unix(), 10)
+	}
+
+	userKey := s.getUserNotificationsKey(userID, tenantID)
+	for {
+		ids, err := s.redis.ZRangeByScore(ctx, userKey, scoreRange).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get notification IDs: %w", err)
+		}
+
+		for _, id := range ids {
+			notification, err := s.GetNotification(ctx, id)
+			if err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					log.Warn().Err(err).Str("notificationID", id).Msg("Failed to get notification")
+				}
+				continue
+			}
+			// The list is kept per tenant, this guards against stray entries
+			if notification.TenantID != tenantID || notification.UserID != userID {
+				continue
+			}
+			if err := emit(notification); err != nil {
+				return err
+			}
+		}
+
+		if len(ids) < exportBatchSize {
+			return nil
+		}
+		scoreRange.Offset += exportBatchSize
+	}
+}
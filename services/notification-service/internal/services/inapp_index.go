@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// facetFields are the notification fields users can filter their inbox by
+var facetFields = []string{"type", "category", "priority", "thread", "entity"}
+
+// minSearchTermLength skips terms too short to narrow a search down
+const minSearchTermLength = 2
+
+// queryUserNotifications returns a page of the notification IDs of a user that
+// match the filters, newest first, along with the total number of matches. The
+// filters are resolved by intersecting the user's index sets inside Redis, so
+// pages are always full and the total counts only matching notifications.
+func (s *InAppNotificationService) queryUserNotifications(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	start int64,
+	stop int64,
+	filters map[string]interface{},
+) ([]string, int64, error) {
+	if err := s.ensureUserIndex(ctx, userID, tenantID); err != nil {
+		return nil, 0, err
+	}
+
+	// The user's list comes first so matches keep its ordering scores
+	include := []string{s.getUserNotificationsKey(userID, tenantID)}
+	var exclude []string
+
+	for _, field := range facetFields {
+		if value, ok := filters[field].(string); ok && value != "" {
+			include = append(include, s.getFacetKey(userID, tenantID, field, value))
+		}
+	}
+
+	if search, ok := filters["search"].(string); ok {
+		for _, term := range searchTerms(search) {
+			token, err := s.pii.searchToken(tenantID, term)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to query notifications: %w", err)
+			}
+			include = append(include, s.getFacetKey(userID, tenantID, "term", token))
+		}
+	}
+
+	if read, ok := filters["read"].(bool); ok {
+		if read {
+			exclude = append(exclude, s.getUnreadKey(userID, tenantID))
+		} else {
+			include = append(include, s.getUnreadKey(userID, tenantID))
+		}
+	}
+
+	if archived, ok := filters["archived"].(bool); ok {
+		if archived {
+			include = append(include, s.getArchivedKey(userID, tenantID))
+		} else {
+			exclude = append(exclude, s.getArchivedKey(userID, tenantID))
+		}
+	}
+
+	weights := make([]float64, len(include))
+	weights[0] = 1
+
+	resultKey := s.getQueryKey()
+	pipe := s.redis.TxPipeline()
+	pipe.ZInterStore(ctx, resultKey, &redis.ZStore{Keys: include, Weights: weights})
+	if len(exclude) > 0 {
+		pipe.ZDiffStore(ctx, resultKey, append([]string{resultKey}, exclude...)...)
+	}
+	total := pipe.ZCard(ctx, resultKey)
+	ids := pipe.ZRevRange(ctx, resultKey, start, stop)
+	pipe.Del(ctx, resultKey)
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, fmt.Errorf("failed to query notifications: %w", err)
+	}
+
+	return ids.Val(), total.Val(), nil
+}
+
+// ensureUserIndex builds the filter and search indexes of a user whose
+// notifications predate them
+func (s *InAppNotificationService) ensureUserIndex(ctx context.Context, userID string, tenantID string) error {
+	markerKey := s.getUserIndexedKey(userID, tenantID)
+
+	indexed, err := s.redis.Exists(ctx, markerKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check notification index: %w", err)
+	}
+	if indexed > 0 {
+		return nil
+	}
+
+	ids, err := s.redis.ZRange(ctx, s.getUserNotificationsKey(userID, tenantID), 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get user notifications: %w", err)
+	}
+
+	// Drop the indexes left over from before, like terms indexed in
+	// plaintext before personal data was encrypted
+	stale, err := s.redis.SMembers(ctx, s.getUserIndexesKey(userID, tenantID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get notification indexes: %w", err)
+	}
+
+	pipe := s.redis.Pipeline()
+	if len(stale) > 0 {
+		pipe.Del(ctx, append(stale, s.getUserIndexesKey(userID, tenantID))...)
+	}
+	for _, id := range ids {
+		notification, err := s.GetNotification(ctx, id)
+		if err != nil {
+			continue
+		}
+		s.indexNotification(ctx, pipe, notification)
+	}
+	pipe.Set(ctx, markerKey, 1, s.config.TTL)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to build notification index: %w", err)
+	}
+
+	return nil
+}
+
+// indexNotification queues the commands adding a notification to the filter
+// and search indexes of its user
+func (s *InAppNotificationService) indexNotification(ctx context.Context, pipe redis.Pipeliner, notification *InAppNotification) {
+	indexesKey := s.getUserIndexesKey(notification.UserID, notification.TenantID)
+
+	keys := s.notificationIndexKeys(notification)
+	for _, key := range keys {
+		pipe.SAdd(ctx, key, notification.ID)
+		s.expireIndex(ctx, pipe, key)
+	}
+
+	members := make([]interface{}, len(keys))
+	for i, key := range keys {
+		members[i] = key
+	}
+	pipe.SAdd(ctx, indexesKey, members...)
+	s.expireIndex(ctx, pipe, indexesKey)
+
+	if notification.Archived {
+		archivedKey := s.getArchivedKey(notification.UserID, notification.TenantID)
+		pipe.SAdd(ctx, archivedKey, notification.ID)
+		s.expireIndex(ctx, pipe, archivedKey)
+	}
+}
+
+// unindexNotification queues the commands removing a notification from the
+// filter and search indexes of its user
+func (s *InAppNotificationService) unindexNotification(ctx context.Context, pipe redis.Pipeliner, notification *InAppNotification) {
+	for _, key := range s.notificationIndexKeys(notification) {
+		pipe.SRem(ctx, key, notification.ID)
+	}
+	pipe.SRem(ctx, s.getArchivedKey(notification.UserID, notification.TenantID), notification.ID)
+}
+
+// eraseUserIndex deletes every filter and search index of a user
+func (s *InAppNotificationService) eraseUserIndex(ctx context.Context, userID string, tenantID string) error {
+	indexesKey := s.getUserIndexesKey(userID, tenantID)
+
+	keys, err := s.redis.SMembers(ctx, indexesKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get notification indexes: %w", err)
+	}
+
+	keys = append(keys,
+		indexesKey,
+		s.getArchivedKey(userID, tenantID),
+		s.getUserIndexedKey(userID, tenantID),
+		s.getThreadsKey(userID, tenantID),
+	)
+
+	if err := s.redis.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete notification indexes: %w", err)
+	}
+
+	return nil
+}
+
+// notificationIndexKeys returns the facet and search term sets a notification belongs to
+func (s *InAppNotificationService) notificationIndexKeys(notification *InAppNotification) []string {
+	var keys []string
+
+	values := map[string]string{
+		"type":     notification.Type,
+		"category": notification.Category,
+		"priority": notification.Priority,
+		"thread":   notification.ThreadKey,
+	}
+	if notification.Entity != nil {
+		values["entity"] = entityFacet(notification.Entity.Type, notification.Entity.ID)
+	}
+	for _, field := range facetFields {
+		if values[field] != "" {
+			keys = append(keys, s.getFacetKey(notification.UserID, notification.TenantID, field, values[field]))
+		}
+	}
+
+	// Terms are indexed by their tokens, keys would otherwise reveal the
+	// words of encrypted titles and messages
+	for _, term := range searchTerms(notification.Title + " " + notification.Message) {
+		token, err := s.pii.searchToken(notification.TenantID, term)
+		if err != nil {
+			log.Warn().Err(err).Str("notificationID", notification.ID).Msg("Failed to index search term")
+			continue
+		}
+		keys = append(keys, s.getFacetKey(notification.UserID, notification.TenantID, "term", token))
+	}
+
+	return keys
+}
+
+// expireIndex lets an index expire together with the notifications in it
+func (s *InAppNotificationService) expireIndex(ctx context.Context, pipe redis.Pipeliner, key string) {
+	if s.config.TTL > 0 {
+		pipe.Expire(ctx, key, s.config.TTL)
+	}
+}
+
+// Redis key generators
+func (s *InAppNotificationService) getFacetKey(userID string, tenantID string, field string, value string) string {
+	return fmt.Sprintf("user_notifications:%s:%s:%s:%s", tenantID, userID, field, value)
+}
+
+func (s *InAppNotificationService) getArchivedKey(userID string, tenantID string) string {
+	return fmt.Sprintf("archived:%s:%s", tenantID, userID)
+}
+
+func (s *InAppNotificationService) getUserIndexesKey(userID string, tenantID string) string {
+	return fmt.Sprintf("user_notification_indexes:%s:%s", tenantID, userID)
+}
+
+// v2 indexes search terms by their tokens
+func (s *InAppNotificationService) getUserIndexedKey(userID string, tenantID string) string {
+	return fmt.Sprintf("user_notifications_indexed:v2:%s:%s", tenantID, userID)
+}
+
+func (s *InAppNotificationService) getQueryKey() string {
+	return "user_notifications_query:" + uuid.NewString()
+}
+
+// Helper functions
+
+// searchTerms splits text into the distinct lower-cased words it is searchable by
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLowerSpecial(unicode.TurkishCase, text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	var terms []string
+	for _, word := range words {
+		if len([]rune(word)) < minSearchTermLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+
+	return terms
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newInAppTestService returns an in-app service on miniredis, encrypting
+// personal data with masterKey when it is set
+func newInAppTestService(t *testing.T, masterKey []byte) (*InAppNotificationService, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	service, err := NewInAppNotificationService(InAppConfig{RedisURL: "redis://" + server.Addr()})
+	if err != nil {
+		t.Fatalf("Failed to create in-app service: %v", err)
+	}
+	if service.pii, err = newPIICipher(masterKey, service.redis); err != nil {
+		t.Fatalf("Failed to create PII cipher: %v", err)
+	}
+	return service, server
+}
+
+func TestInAppSearchTermsAreHashedWhenPersonalDataIsEncrypted(t *testing.T) {
+	ctx := context.Background()
+	service, server := newInAppTestService(t, []byte(strings.Repeat("k", 32)))
+
+	if _, err := service.CreateNotification(ctx, InAppNotification{
+		UserID:   "user-1",
+		TenantID: "tenant-a",
+		Type:     "alert",
+		Title:    "Kimyasal sızıntı",
+		Message:  "Ayşe Yılmaz B blokta",
+	}); err != nil {
+		t.Fatalf("Failed to create notification: %v", err)
+	}
+
+	for _, key := range server.Keys() {
+		for _, word := range []string{"kimyasal", "ayşe", "yılmaz"} {
+			if strings.Contains(key, word) {
+				t.Errorf("Expected %q not to appear in key %s", word, key)
+			}
+		}
+	}
+
+	notifications, total, err := service.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, map[string]interface{}{"search": "KİMYASAL"})
+	if err != nil {
+		t.Fatalf("Failed to search notifications: %v", err)
+	}
+	if total != 1 || len(notifications) != 1 || notifications[0].Title != "Kimyasal sızıntı" {
+		t.Errorf("Expected the notification to be found by a word of its title, got %d", total)
+	}
+}
+
+func TestInAppSearchTokensDifferPerTenant(t *testing.T) {
+	service, _ := newInAppTestService(t, []byte(strings.Repeat("k", 32)))
+
+	tokenA, err := service.pii.searchToken("tenant-a", "kimyasal")
+	if err != nil {
+		t.Fatalf("Failed to get search token: %v", err)
+	}
+	tokenB, _ := service.pii.searchToken("tenant-b", "kimyasal")
+	if tokenA == tokenB || tokenA == "kimyasal" {
+		t.Errorf("Expected tenants to index a term by tokens of their own, got %s and %s", tokenA, tokenB)
+	}
+	if again, _ := service.pii.searchToken("tenant-a", "kimyasal"); again != tokenA {
+		t.Errorf("Expected the token of a term to be stable, got %s and %s", tokenA, again)
+	}
+
+	plain, _ := newInAppTestService(t, nil)
+	if token, _ := plain.pii.searchToken("tenant-a", "kimyasal"); token != "kimyasal" {
+		t.Errorf("Expected terms to be indexed as they are without encryption, got %s", token)
+	}
+}
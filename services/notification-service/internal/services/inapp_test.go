@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInAppOperationsStopWithTheirContext(t *testing.T) {
+	service, _ := newInAppTestService(t, nil)
+
+	notification, err := service.CreateNotification(context.Background(), InAppNotification{
+		UserID:   "user-1",
+		TenantID: "tenant-a",
+		Type:     "alert",
+		Title:    "Tatbikat",
+		Message:  "Saat 14.00",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notification: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := service.MarkAsRead(cancelled, notification.ID, "user-1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected marking as read to stop with its request, got %v", err)
+	}
+	if err := service.DeleteNotification(cancelled, notification.ID, "user-1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected deleting to stop with its request, got %v", err)
+	}
+
+	// Operations are bounded by the operation timeout within longer deadlines
+	service.config.OperationTimeout = time.Millisecond
+	ctx, cancel := service.withOperationTimeout(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Millisecond {
+		t.Errorf("Expected the operation to be bounded by its timeout, got %v", deadline)
+	}
+
+	service.config.OperationTimeout = 5 * time.Second
+	if err := service.ArchiveNotification(context.Background(), notification.ID, "user-1"); err != nil {
+		t.Errorf("Expected the notification to be archived, got %v", err)
+	}
+}
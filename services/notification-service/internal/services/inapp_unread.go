@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons of unread count changes
+const (
+	UnreadReasonCreated    = "created"    // notifications reached the feed
+	UnreadReasonRead       = "read"       // notifications were read or answered
+	UnreadReasonUnread     = "unread"     // notifications were marked unread again
+	UnreadReasonDeleted    = "deleted"    // notifications were deleted
+	UnreadReasonSnoozed    = "snoozed"    // notifications were snoozed
+	UnreadReasonResurfaced = "resurfaced" // snoozed notifications came back
+)
+
+// UnreadUpdate is published to the unread channel of a user whenever their
+// unread count changes, so badges, through the WebSocket hub, update without
+// clients querying GetUnreadCount again
+type UnreadUpdate struct {
+	UserID          string    `json:"user_id"`
+	TenantID        string    `json:"tenant_id"`
+	Delta           int64     `json:"delta"` // added to the unread count, negative when it drops
+	Reason          string    `json:"reason"`
+	NotificationIDs []string  `json:"notification_ids,omitempty"`
+	At              time.Time `json:"at"`
+}
+
+// UnreadChannel is the pub/sub channel the unread updates of a user are
+// published to
+func UnreadChannel(userID string, tenantID string) string {
+	return fmt.Sprintf("unread_updates:%s:%s", tenantID, userID)
+}
+
+// publishUnreadDelta tells the subscribers of a user's unread channel that
+// their unread count changed by delta. Updates are best effort: clients
+// missing one resync with GetUnreadCount.
+func (s *InAppNotificationService) publishUnreadDelta(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	reason string,
+	delta int64,
+	notificationIDs ...string,
+) {
+	if delta == 0 {
+		return
+	}
+
+	update, err := json.Marshal(UnreadUpdate{
+		UserID:          userID,
+		TenantID:        tenantID,
+		Delta:           delta,
+		Reason:          reason,
+		NotificationIDs: notificationIDs,
+		At:              time.Now(),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal unread update")
+		return
+	}
+
+	if err := s.redis.Publish(ctx, UnreadChannel(userID, tenantID), update).Err(); err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Failed to publish unread update")
+	}
+}
+
+// unreadChange sums how many notifications unread set commands added or
+// removed, ignoring those that failed
+func unreadChange(commands []*redis.IntCmd) int64 {
+	var changed int64
+	for _, command := range commands {
+		changed += command.Val()
+	}
+	return changed
+}
@@ -0,0 +1,1873 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/goleak"
+
+	"claude-talimat-notifications/internal/i18n"
+	"claude-talimat-notifications/models"
+	"claude-talimat/pkg/ids"
+	"claude-talimat/pkg/types"
+)
+
+// The integration tests run the send pipeline against an in-process Redis
+// and fake providers: messages are published to the notifications topic the
+// way the message queue service publishes them, the queue consumer sends
+// them through the providers, and the status of each delivery is reported to
+// a callback receiver.
+
+// smtpStub is an SMTP server accepting every message it is sent
+type smtpStub struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+func newSMTPStub(t testing.TB) *smtpStub {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start SMTP stub: %v", err)
+	}
+	stub := &smtpStub{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+
+	return stub
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP stub")
+
+	var message smtpMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message = smtpMessage{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.To = append(message.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			message.Data = data.String()
+
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpStub) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) sent() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// netgsmServer is a fake of the Netgsm send API
+type netgsmServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	numbers  []string
+	response string
+	stalled  chan struct{} // when set, answers once closed or the client gives up
+	received chan struct{} // signalled on every SMS, without blocking
+}
+
+func newNetgsmServer(t testing.TB) *netgsmServer {
+	server := &netgsmServer{response: "00 job-1", received: make(chan struct{}, 1)}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sms/send/get" {
+			t.Errorf("Unexpected Netgsm request %s", r.URL.Path)
+		}
+
+		server.mu.Lock()
+		server.numbers = append(server.numbers, r.URL.Query().Get("gsmno"))
+		response := server.response
+		stalled := server.stalled
+		server.mu.Unlock()
+
+		if stalled != nil {
+			select {
+			case <-stalled:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		io.WriteString(w, response)
+		select {
+		case server.received <- struct{}{}:
+		default:
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *netgsmServer) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.numbers...)
+}
+
+func (s *netgsmServer) fail(response string) {
+	s.mu.Lock()
+	s.response = response
+	s.mu.Unlock()
+}
+
+func (s *netgsmServer) stall() {
+	s.mu.Lock()
+	s.stalled = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// resume answers the stalled requests and the ones after them
+func (s *netgsmServer) resume() {
+	s.mu.Lock()
+	if s.stalled != nil {
+		close(s.stalled)
+		s.stalled = nil
+	}
+	s.mu.Unlock()
+}
+
+// fcmServer is a fake of the Google token endpoint and the FCM send API
+type fcmServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	tokens []string
+}
+
+func newFCMServer(t testing.TB) *fcmServer {
+	server := &fcmServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			io.WriteString(w, `{"access_token":"access-1","expires_in":3600}`)
+		case "/v1/projects/talimat/messages:send":
+			if r.Header.Get("Authorization") != "Bearer access-1" {
+				t.Errorf("Expected the access token, got %q", r.Header.Get("Authorization"))
+			}
+			var body struct {
+				Message struct {
+					Token string `json:"token"`
+				} `json:"message"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+
+			server.mu.Lock()
+			server.tokens = append(server.tokens, body.Message.Token)
+			server.mu.Unlock()
+			io.WriteString(w, `{"name":"projects/talimat/messages/1"}`)
+		default:
+			t.Errorf("Unexpected FCM request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fcmServer) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...)
+}
+
+// serviceAccount returns a Firebase service account key whose tokens come
+// from the fake
+func (s *fcmServer) serviceAccount(t testing.TB) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	account, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "talimat",
+		"client_email": "notifications@talimat.iam.gserviceaccount.com",
+		"private_key":  string(privateKey),
+		"token_uri":    s.URL + "/token",
+	})
+	return string(account)
+}
+
+// callbackReceiver records the status events posted to it
+type callbackReceiver struct {
+	*httptest.Server
+	mu     sync.Mutex
+	events []StatusEvent
+}
+
+func newCallbackReceiver(t testing.TB) *callbackReceiver {
+	receiver := &callbackReceiver{}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event StatusEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode status event: %v", err)
+		}
+
+		receiver.mu.Lock()
+		receiver.events = append(receiver.events, event)
+		receiver.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *callbackReceiver) received() []StatusEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StatusEvent(nil), r.events...)
+}
+
+// queueServer is a fake of the consume, ack and nack API of the message
+// queue service, on the streams of the Redis of the message queue
+type queueServer struct {
+	*httptest.Server
+	redis    *redis.Client
+	mu       sync.Mutex
+	requests []string
+}
+
+func newQueueServer(t testing.TB, client *redis.Client) *queueServer {
+	server := &queueServer{redis: client}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		server.requests = append(server.requests, r.Method+" "+r.URL.Path)
+		server.mu.Unlock()
+
+		var request struct {
+			Topic     string `json:"topic"`
+			Consumer  string `json:"consumer"`
+			Count     int64  `json:"count"`
+			BlockTime int    `json:"block_time"`
+			ClaimIdle int    `json:"claim_idle"`
+			Reason    string `json:"reason"`
+		}
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var (
+			response interface{}
+			err      error
+		)
+		switch path := strings.TrimPrefix(r.URL.Path, "/api/v1/messages/"); {
+		case r.URL.Path == "/health":
+			response = map[string]interface{}{"status": "healthy"}
+		case path == "consume":
+			var messages []types.Message
+			messages, err = server.consume(r.Context(), request.Topic, request.Consumer, request.Count, request.BlockTime, request.ClaimIdle)
+			response = map[string]interface{}{"success": true, "messages": messages, "count": len(messages)}
+		case strings.HasSuffix(path, "/ack"):
+			err = client.XAck(r.Context(), types.StreamKey(request.Topic), types.GroupKey(request.Topic), strings.TrimSuffix(path, "/ack")).Err()
+			response = map[string]interface{}{"status": "acknowledged"}
+		case strings.HasSuffix(path, "/nack"):
+			err = server.deadLetter(r.Context(), request.Topic, strings.TrimSuffix(path, "/nack"), request.Reason)
+			response = map[string]interface{}{"status": "nack"}
+		default:
+			t.Errorf("Unexpected message queue request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// consume redelivers the messages pending for claimIdle milliseconds, or
+// else reads new ones, like the message queue service does
+func (s *queueServer) consume(ctx context.Context, topic, consumer string, count int64, blockTime, claimIdle int) ([]types.Message, error) {
+	stream, group := types.StreamKey(topic), types.GroupKey(topic)
+	if err := s.redis.XGroupCreateMkStream(ctx, stream, group, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+
+	claimed, _, err := s.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  time.Duration(claimIdle) * time.Millisecond,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := claimed
+	if len(entries) == 0 {
+		streams, err := s.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{stream, ">"},
+			Count:    count,
+			Block:    time.Duration(blockTime) * time.Millisecond,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, read := range streams {
+			entries = append(entries, read.Messages...)
+		}
+	}
+
+	messages := make([]types.Message, 0, len(entries))
+	for _, entry := range entries {
+		var message types.Message
+		raw, _ := entry.Values["message"].(string)
+		if err := json.Unmarshal([]byte(raw), &message); err != nil {
+			continue
+		}
+		message.ID = entry.ID
+
+		pending, err := s.redis.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: stream, Group: group, Start: entry.ID, End: entry.ID, Count: 1}).Result()
+		if err == nil && len(pending) == 1 && pending[0].RetryCount > 1 {
+			message.RetryCount = int(pending[0].RetryCount - 1)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// deadLetter acknowledges a message and adds it to the dead letter queue
+func (s *queueServer) deadLetter(ctx context.Context, topic, messageID, reason string) error {
+	stream := types.StreamKey(topic)
+	entries, err := s.redis.XRange(ctx, stream, messageID, messageID).Result()
+	if err != nil || len(entries) == 0 {
+		return fmt.Errorf("message not found: %s", messageID)
+	}
+	if err := s.redis.XAck(ctx, stream, types.GroupKey(topic), messageID).Err(); err != nil {
+		return err
+	}
+	return s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: types.DeadLetterKey(topic),
+		Values: map[string]interface{}{
+			"original_id": messageID,
+			"reason":      reason,
+			"message":     entries[0].Values["message"],
+		},
+	}).Err()
+}
+
+// calls returns the requests the queue consumer made
+func (s *queueServer) calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// integrationEnv is the notification service and queue consumer running
+// against miniredis and the fake providers. Like in production the streams
+// of the message queue live in a Redis of their own.
+type integrationEnv struct {
+	queue     *miniredis.Miniredis // Redis of the message queue, nil when the environment runs on a real Redis
+	client    *redis.Client        // client of the Redis of the message queue
+	mq        *queueServer
+	service   *NotificationService
+	consumer  *QueueConsumer
+	smtp      *smtpStub
+	netgsm    *netgsmServer
+	fcm       *fcmServer
+	callbacks *callbackReceiver
+}
+
+func newIntegrationEnv(t testing.TB) *integrationEnv {
+	queue := miniredis.RunT(t)
+	env := newIntegrationEnvAt(t, "redis://"+miniredis.RunT(t).Addr(), "redis://"+queue.Addr())
+	env.queue = queue
+	return env
+}
+
+// newIntegrationEnvAt runs the environment against the Redis at redisURL,
+// with the message queue at queueURL
+func newIntegrationEnvAt(t testing.TB, redisURL string, queueURL string) *integrationEnv {
+	t.Helper()
+
+	options, err := redis.ParseURL(queueURL)
+	if err != nil {
+		t.Fatalf("Invalid Redis URL: %v", err)
+	}
+
+	env := &integrationEnv{
+		client:    redis.NewClient(options),
+		smtp:      newSMTPStub(t),
+		netgsm:    newNetgsmServer(t),
+		fcm:       newFCMServer(t),
+		callbacks: newCallbackReceiver(t),
+	}
+	t.Cleanup(func() { env.client.Close() })
+
+	service, err := NewNotificationService(NotificationConfig{
+		RedisURL: redisURL,
+		EmailConfig: EmailConfig{
+			Provider: EmailProviderSMTP,
+			Host:     "127.0.0.1",
+			Port:     env.smtp.port(),
+			From:     "bildirim@talimat.test",
+			FromName: "Talimat",
+		},
+		SMSConfig: SMSConfig{
+			RedisURL:   redisURL,
+			Provider:   SMSProviderNetgsm,
+			APIKey:     "netgsm-user",
+			APISecret:  "netgsm-password",
+			FromNumber: "TALIMAT",
+			BaseURL:    env.netgsm.URL,
+		},
+		PushConfig: PushConfig{
+			RedisURL:            redisURL,
+			Provider:            PushProviderFirebase,
+			FirebaseCredentials: env.fcm.serviceAccount(t),
+			BaseURL:             env.fcm.URL,
+		},
+		InAppConfig:     InAppConfig{RedisURL: redisURL},
+		WebhookConfig:   WebhookConfig{RedisURL: redisURL, AllowPrivateNetworks: true},
+		TemplateConfig:  TemplateConfig{RedisURL: redisURL},
+		RecipientConfig: RecipientConfig{RedisURL: redisURL},
+		MaxRetries:      1,
+		CallbackSecret:  "callback-secret",
+		OutboxConfig: OutboxConfig{
+			RedisURL:   queueURL,
+			Topic:      types.TopicNotificationEvents,
+			RetryAfter: 100 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notification service: %v", err)
+	}
+	env.service = service
+
+	env.mq = newQueueServer(t, env.client)
+	consumer, err := NewQueueConsumer(QueueConsumerConfig{
+		ServiceURL: env.mq.URL,
+		Consumer:   "integration",
+		BlockTime:  50 * time.Millisecond,
+		RetryAfter: 100 * time.Millisecond,
+		MaxRetries: 1,
+	}, service)
+	if err != nil {
+		t.Fatalf("Failed to create queue consumer: %v", err)
+	}
+	env.consumer = consumer
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		consumer.Shutdown(ctx)
+		service.Shutdown(ctx)
+	})
+
+	return env
+}
+
+// enqueue stores a notification and queues it for the workers, due right away
+func (e *integrationEnv) enqueue(t testing.TB, request NotificationRequest) {
+	t.Helper()
+
+	request.ID = generateNotificationID()
+	request.CreatedAt = time.Now()
+	result := &NotificationResult{
+		ID:          generateNotificationID(),
+		RequestID:   request.ID,
+		Type:        request.Type,
+		Recipient:   request.Recipients[0],
+		Status:      "pending",
+		MaxAttempts: 1,
+		CreatedAt:   request.CreatedAt,
+	}
+
+	if err := e.service.storeRequest(request); err != nil {
+		t.Fatalf("Failed to store request: %v", err)
+	}
+	if err := e.service.storeResult(*result); err != nil {
+		t.Fatalf("Failed to store result: %v", err)
+	}
+	if err := e.service.queueNotification(request, result, request.CreatedAt); err != nil {
+		t.Fatalf("Failed to queue notification: %v", err)
+	}
+}
+
+// publish adds a notification to the notifications topic like the publish
+// endpoint of the message queue service does
+func (e *integrationEnv) publish(t testing.TB, payload map[string]interface{}) string {
+	t.Helper()
+
+	message, err := json.Marshal(types.Message{
+		ID:         ids.New("msg"),
+		Topic:      types.TopicNotifications,
+		Payload:    payload,
+		Priority:   5,
+		MaxRetries: 1,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %v", err)
+	}
+
+	streamID, err := e.client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: types.StreamKey(types.TopicNotifications),
+		Values: map[string]interface{}{"message": string(message), "priority": 5},
+	}).Result()
+	if err != nil {
+		t.Fatalf("Failed to publish message: %v", err)
+	}
+	return streamID
+}
+
+// pending returns how many messages of the topic are unacknowledged
+func (e *integrationEnv) pending(t testing.TB) int64 {
+	t.Helper()
+
+	pending, err := e.client.XPending(context.Background(), types.StreamKey(types.TopicNotifications), types.GroupKey(types.TopicNotifications)).Result()
+	if err != nil {
+		t.Fatalf("Failed to get pending messages: %v", err)
+	}
+	return pending.Count
+}
+
+// deadLettered returns the messages of the dead letter queue of the topic
+func (e *integrationEnv) deadLettered(t testing.TB) []redis.XMessage {
+	t.Helper()
+
+	messages, err := e.client.XRange(context.Background(), types.DeadLetterKey(types.TopicNotifications), "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read dead letter queue: %v", err)
+	}
+	return messages
+}
+
+// eventually fails the test unless condition holds within a few seconds
+func eventually(t testing.TB, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestIntegrationQueuedEmailIsDeliveredAndReported(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	env.publish(t, map[string]interface{}{
+		"type":         "email",
+		"recipient":    "ayse.yilmaz@talimat.test",
+		"subject":      "Yeni talimat yayınlandı",
+		"message":      "Forklift kullanım talimatı güncellendi",
+		"text_body":    "Forklift kullanım talimatı güncellendi.",
+		"callback_url": env.callbacks.URL,
+	})
+
+	eventually(t, "the email to reach the SMTP server", func() bool { return len(env.smtp.sent()) == 1 })
+	email := env.smtp.sent()[0]
+	if len(email.To) != 1 || email.To[0] != "ayse.yilmaz@talimat.test" {
+		t.Errorf("Expected the email to go to the recipient, got %v", email.To)
+	}
+	if !strings.Contains(email.Data, "Forklift") {
+		t.Errorf("Expected the email to hold the message, got %q", email.Data)
+	}
+
+	eventually(t, "the status callback", func() bool { return len(env.callbacks.received()) == 1 })
+	event := env.callbacks.received()[0]
+	if event.Status != "sent" || event.Type != "email" {
+		t.Errorf("Expected a sent email status, got %s %s", event.Type, event.Status)
+	}
+
+	result, err := env.service.GetNotificationStatus(context.Background(), event.NotificationID)
+	if err != nil {
+		t.Fatalf("Failed to get the result: %v", err)
+	}
+	if result.Status != "sent" || result.Recipient != "ayse.yilmaz@talimat.test" {
+		t.Errorf("Expected a sent result for the recipient, got %s for %s", result.Status, result.Recipient)
+	}
+
+	eventually(t, "the message to be acknowledged", func() bool { return env.pending(t) == 0 })
+}
+
+func TestIntegrationQueuedSMSAndPushReachTheirProviders(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	env.publish(t, map[string]interface{}{
+		"type":      "sms",
+		"recipient": "+905551112233",
+		"message":   "Acil durum tatbikatı 14:00'te",
+	})
+	env.publish(t, map[string]interface{}{
+		"type":      "push",
+		"recipient": "device-token-1",
+		"title":     "Yeni talimat",
+		"message":   "Forklift kullanım talimatı yayınlandı",
+	})
+
+	eventually(t, "the SMS to reach Netgsm", func() bool { return len(env.netgsm.sent()) == 1 })
+	if number := env.netgsm.sent()[0]; !strings.Contains(number, "5551112233") {
+		t.Errorf("Expected the SMS to go to the recipient, got %s", number)
+	}
+
+	eventually(t, "the push to reach FCM", func() bool { return len(env.fcm.sent()) == 1 })
+	if token := env.fcm.sent()[0]; token != "device-token-1" {
+		t.Errorf("Expected the push to go to the device, got %s", token)
+	}
+
+	eventually(t, "both messages to be acknowledged", func() bool { return env.pending(t) == 0 })
+	if dead := env.deadLettered(t); len(dead) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(dead))
+	}
+}
+
+func TestIntegrationInvalidMessageIsDeadLettered(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	streamID := env.publish(t, map[string]interface{}{
+		"type":    "email",
+		"message": "Alıcısı olmayan bildirim",
+	})
+
+	eventually(t, "the message to be dead-lettered", func() bool { return len(env.deadLettered(t)) == 1 })
+	dead := env.deadLettered(t)[0]
+	if dead.Values["original_id"] != streamID {
+		t.Errorf("Expected the dead letter of %s, got %v", streamID, dead.Values["original_id"])
+	}
+	if env.pending(t) != 0 {
+		t.Error("Expected the dead-lettered message to be acknowledged")
+	}
+	if len(env.smtp.sent()) != 0 {
+		t.Error("Expected nothing to be sent")
+	}
+}
+
+func TestIntegrationMessageNotMatchingTheCatalogueIsDeadLettered(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	env.publish(t, map[string]interface{}{
+		"type":      "sms",
+		"recipient": "+905551112233",
+		"message":   "Vardiya değişikliği",
+		"priority":  "asap",
+	})
+
+	eventually(t, "the message to be dead-lettered", func() bool { return len(env.deadLettered(t)) == 1 })
+	if reason, _ := env.deadLettered(t)[0].Values["reason"].(string); !strings.Contains(reason, "priority: must be one of") {
+		t.Errorf("Expected the schema problem as the reason, got %q", reason)
+	}
+	if len(env.netgsm.sent()) != 0 {
+		t.Error("Expected nothing to be sent")
+	}
+}
+
+func TestIntegrationProviderFailureIsRetriedThenDeadLettered(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.netgsm.fail("30")
+
+	env.publish(t, map[string]interface{}{
+		"type":         "sms",
+		"recipient":    "+905551112233",
+		"message":      "Vardiya değişikliği",
+		"callback_url": env.callbacks.URL,
+	})
+
+	// The first delivery and its single retry both reach the provider
+	eventually(t, "the message to be dead-lettered", func() bool { return len(env.deadLettered(t)) == 1 })
+	if attempts := len(env.netgsm.sent()); attempts < 2 {
+		t.Errorf("Expected the failed SMS to be retried, got %d attempts", attempts)
+	}
+
+	failures, err := env.service.RecentFailures("", 10)
+	if err != nil {
+		t.Fatalf("Failed to get recent failures: %v", err)
+	}
+	if len(failures.Failures) == 0 || failures.Failures[0].Type != "sms" {
+		t.Errorf("Expected the SMS failure to be recorded, got %+v", failures.Failures)
+	}
+
+	eventually(t, "the failed status callback", func() bool {
+		for _, event := range env.callbacks.received() {
+			if event.Status == "failed" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// events returns the events published to the events topic
+func (e *integrationEnv) events(t testing.TB) []types.Message {
+	t.Helper()
+
+	messages, err := e.client.XRange(context.Background(), types.StreamKey(types.TopicNotificationEvents), "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+
+	events := make([]types.Message, 0, len(messages))
+	for _, message := range messages {
+		var event types.Message
+		if err := json.Unmarshal([]byte(message.Values["message"].(string)), &event); err != nil {
+			t.Fatalf("Failed to decode event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestIntegrationStatusEventIsPublishedToTheQueue(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	env.publish(t, map[string]interface{}{
+		"type":      "sms",
+		"recipient": "+905551112233",
+		"message":   "Acil durum tatbikatı 14:00'te",
+		"tenant_id": "tenant-1",
+	})
+
+	eventually(t, "the status event", func() bool { return len(env.events(t)) == 1 })
+	event := env.events(t)[0]
+	if event.Topic != types.TopicNotificationEvents || event.Payload["type"] != "notification.status" {
+		t.Fatalf("Expected a status event, got %+v", event)
+	}
+	data, _ := event.Payload["data"].(map[string]interface{})
+	if data["status"] != "sent" || data["type"] != "sms" || event.Payload["tenant_id"] != "tenant-1" {
+		t.Errorf("Expected the sent SMS of the tenant, got %+v", event.Payload)
+	}
+	if event.Payload["version"] != float64(1) {
+		t.Errorf("Expected the event to carry the version of its type, got %v", event.Payload["version"])
+	}
+}
+
+func TestIntegrationEventNotMatchingItsSchemaIsNotPublished(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	env.service.emitEvent(WebhookEvent{
+		ID:        "evt-1",
+		Type:      "notification.status",
+		Source:    "notification-service",
+		Data:      map[string]interface{}{"notification_id": "ntf-1", "type": "sms", "status": "lost"},
+		Timestamp: time.Now(),
+		Priority:  "normal",
+		CreatedAt: time.Now(),
+	})
+
+	// Read by the relay and acknowledged without being published
+	eventually(t, "the event to be dropped", func() bool {
+		ctx := context.Background()
+		groups, _ := env.service.redis.XInfoGroups(ctx, env.service.getOutboxKey()).Result()
+		pending, _ := env.service.redis.XPending(ctx, env.service.getOutboxKey(), outboxGroupQueue).Result()
+		for _, group := range groups {
+			if group.Name == outboxGroupQueue {
+				return group.LastDeliveredID != "0-0" && pending != nil && pending.Count == 0
+			}
+		}
+		return false
+	})
+	if events := env.events(t); len(events) != 0 {
+		t.Errorf("Expected nothing to be published, got %+v", events)
+	}
+}
+
+func TestIntegrationOutboxRetriesWhileTheQueueIsDown(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.queue.SetError("LOADING Redis is loading the dataset in memory")
+
+	env.service.emitEvent(WebhookEvent{
+		ID:        "evt-1",
+		Type:      "notification.acknowledged",
+		Source:    "notification-service",
+		Data:      map[string]interface{}{"request_id": "req-1", "acknowledged_at": time.Now()},
+		Timestamp: time.Now(),
+		Priority:  "normal",
+		CreatedAt: time.Now(),
+	})
+
+	// The relay keeps the event while it can't be published
+	time.Sleep(1500 * time.Millisecond)
+	env.queue.SetError("")
+
+	eventually(t, "the event to be published", func() bool { return len(env.events(t)) == 1 })
+	if event := env.events(t)[0]; event.ID != "evt-1" || event.Payload["type"] != "notification.acknowledged" {
+		t.Errorf("Expected the acknowledgment event, got %+v", event)
+	}
+}
+
+func TestIntegrationTenantSettingsApplyToSends(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	if _, err := env.service.SetSettings(context.Background(), models.NotificationSettings{
+		TenantID:         "tenant-a",
+		MaxRetries:       4,
+		DefaultTTL:       3600,
+		RateLimitPerHour: 1,
+	}); err != nil {
+		t.Fatalf("Failed to set settings: %v", err)
+	}
+
+	send := func(tenantID string) (*NotificationResult, error) {
+		return env.service.SendNotification(context.Background(), NotificationRequest{
+			Type:       "sms",
+			Recipients: []string{"+905551112233"},
+			Message:    "Vardiya değişikliği",
+			TenantID:   tenantID,
+		})
+	}
+
+	result, err := send("tenant-a")
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.MaxAttempts != 4 {
+		t.Errorf("Expected the retries of the settings, got %d attempts", result.MaxAttempts)
+	}
+	request, err := env.service.getRequest(result.RequestID)
+	if err != nil {
+		t.Fatalf("Failed to get request: %v", err)
+	}
+	if request.ExpiresAt == nil || time.Until(*request.ExpiresAt) < 59*time.Minute {
+		t.Errorf("Expected the request to expire after the default TTL, got %v", request.ExpiresAt)
+	}
+
+	var rateLimitErr *RateLimitError
+	if _, err := send("tenant-a"); !errors.As(err, &rateLimitErr) || rateLimitErr.Window != "hour" {
+		t.Errorf("Expected the hourly rate limit to be exceeded, got %v", err)
+	}
+
+	// Other tenants keep the configured defaults
+	result, err = send("tenant-b")
+	if err != nil {
+		t.Fatalf("Failed to send for another tenant: %v", err)
+	}
+	if result.MaxAttempts != 1 {
+		t.Errorf("Expected the configured retries, got %d attempts", result.MaxAttempts)
+	}
+}
+
+func TestIntegrationSendsOutsideTheDeliveryWindowWaitForIt(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	// A window opening six hours from now, in UTC
+	opens := time.Now().UTC().Add(6 * time.Hour)
+	if _, err := env.service.SetSettings(context.Background(), models.NotificationSettings{
+		TenantID: "tenant-a",
+		DeliveryWindow: &models.DeliveryWindow{
+			Start:    opens.Format("15:04"),
+			End:      opens.Add(6 * time.Hour).Format("15:04"),
+			Timezone: "UTC",
+		},
+	}); err != nil {
+		t.Fatalf("Failed to set settings: %v", err)
+	}
+
+	send := func(priority string) *NotificationResult {
+		result, err := env.service.SendNotification(context.Background(), NotificationRequest{
+			Type:       "sms",
+			Recipients: []string{"+905551112233"},
+			Message:    "Eğitim hatırlatması",
+			Priority:   priority,
+			TenantID:   "tenant-a",
+		})
+		if err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		return result
+	}
+
+	held := send("normal")
+	if held.Status != "pending" || held.NextRetryAt == nil {
+		t.Fatalf("Expected the send to wait for the window, got %s", held.Status)
+	}
+	if held.NextRetryAt.Before(opens.Truncate(time.Minute)) {
+		t.Errorf("Expected the send to wait until %s, got %s", opens, held.NextRetryAt)
+	}
+
+	// Urgent notifications go out whatever the time
+	if result := send("urgent"); result.Status != "sent" {
+		t.Errorf("Expected the urgent send to go out, got %s", result.Status)
+	}
+	if sent := env.netgsm.sent(); len(sent) != 1 {
+		t.Errorf("Expected only the urgent send to reach the provider, got %d", len(sent))
+	}
+}
+
+func TestIntegrationSlowProviderIsCutOff(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.service.config.ProviderTimeout = 200 * time.Millisecond
+	env.netgsm.stall()
+
+	request := NotificationRequest{
+		Type:       "sms",
+		Recipients: []string{"+905551112233"},
+		Message:    "Vardiya değişikliği",
+	}
+
+	started := time.Now()
+	if _, err := env.service.SendNotification(context.Background(), request); err == nil {
+		t.Fatal("Expected the send to fail once the provider timed out")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected the send to give up after the provider timeout, took %v", elapsed)
+	}
+
+	// A client that already went away doesn't reach the provider at all
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sent := len(env.netgsm.sent())
+	if _, err := env.service.SendNotification(ctx, request); err == nil {
+		t.Error("Expected the send of a cancelled request to fail")
+	}
+	if len(env.netgsm.sent()) != sent {
+		t.Error("Expected the cancelled request not to reach Netgsm")
+	}
+}
+
+func TestIntegrationSlowChannelDoesNotHoldBackOthers(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.service.config.ChannelMaxInFlight = map[string]int{"sms": 1}
+	env.netgsm.stall()
+	t.Cleanup(env.netgsm.resume)
+
+	for i := 0; i < 3; i++ {
+		env.enqueue(t, NotificationRequest{
+			Type:       "sms",
+			Recipients: []string{fmt.Sprintf("+90555111223%d", i)},
+			Message:    "Vardiya değişikliği",
+		})
+	}
+	env.enqueue(t, NotificationRequest{
+		Type:       "email",
+		Recipients: []string{"calisan@talimat.test"},
+		Subject:    "Yeni talimat",
+		Message:    "Yeni bir talimat yayınlandı.",
+	})
+
+	eventually(t, "the email to be sent while SMS are stalled", func() bool { return len(env.smtp.sent()) == 1 })
+	eventually(t, "the SMS sends to wait for their turn", func() bool {
+		stats := env.service.channelPool("sms").Stats()
+		return stats.Active == 1 && stats.Waiting == 2
+	})
+	if sent := len(env.netgsm.sent()); sent != 1 {
+		t.Errorf("Expected a single SMS in flight, got %d", sent)
+	}
+
+	env.netgsm.resume()
+	eventually(t, "the SMS to be sent", func() bool { return len(env.netgsm.sent()) == 3 })
+}
+
+func TestIntegrationSaturatedPoolsQueueWorkAndLeakNothing(t *testing.T) {
+	// Registered first, so it runs once the environment is shut down. Redis
+	// clients live as long as the process, their pools are left running.
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() {
+		goleak.VerifyNone(t, ignore, goleak.IgnoreTopFunction("github.com/go-redis/redis/v8/internal/pool.(*ConnPool).reaper"))
+	})
+
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	env.service.emailService.bulk = newWorkerPool("email_bulk", 2)
+	env.service.webhookService.deliveries = newWorkerPool("webhook_deliveries", 1)
+
+	messages := make([]EmailMessage, 6)
+	for i := range messages {
+		messages[i] = EmailMessage{
+			To:      []string{fmt.Sprintf("calisan%d@talimat.test", i)},
+			Subject: "Yeni talimat",
+			Body:    "Yeni bir talimat yayınlandı.",
+		}
+	}
+	results, err := env.service.emailService.SendBulkEmail(ctx, messages)
+	if err != nil {
+		t.Fatalf("Failed to send bulk email: %v", err)
+	}
+	for i, result := range results {
+		if !result.Success {
+			t.Errorf("Expected email %d to be sent, got %s", i, result.Error)
+		}
+	}
+	if sent := len(env.smtp.sent()); sent != len(messages) {
+		t.Errorf("Expected %d emails to reach the SMTP server, got %d", len(messages), sent)
+	}
+
+	// The receiver holds the first delivery until the others were queued
+	release := make(chan struct{})
+	var received atomic.Int64
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if received.Add(1) == 1 {
+			<-release
+		}
+	}))
+	t.Cleanup(receiver.Close)
+
+	webhooks := env.service.Webhooks()
+	if _, err := webhooks.CreateEndpoint(ctx, WebhookEndpoint{
+		Name:     "Talimat",
+		URL:      receiver.URL,
+		Events:   []string{"notification.status"},
+		IsActive: true,
+	}); err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := webhooks.TriggerWebhook(ctx, WebhookEvent{Type: "notification.status"}); err != nil {
+			t.Fatalf("Failed to trigger webhook: %v", err)
+		}
+	}
+
+	if stats := webhooks.DeliveryStats(); stats.Rejected != 2 {
+		t.Errorf("Expected 2 deliveries to find the pool saturated, got %+v", stats)
+	}
+	close(release)
+	eventually(t, "the queued deliveries to be sent", func() bool { return received.Load() == 3 })
+}
+
+func TestIntegrationContactPointIsUsedOnceVerified(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	email := "Ayse@Talimat.test"
+	phone := "+905551112233"
+	contactPoint, err := env.service.CreateContactPoint(models.NotificationSubscription{
+		UserID:       "user-1",
+		TenantID:     "tenant-a",
+		EmailEnabled: true,
+		SMSEnabled:   true,
+		EmailAddress: &email,
+		PhoneNumber:  &phone,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create contact point: %v", err)
+	}
+	if addresses := env.service.contactPointAddresses("tenant-a", "user-1", "email", ""); len(addresses) != 0 {
+		t.Errorf("Expected unverified addresses to be left out, got %v", addresses)
+	}
+
+	// The confirmation link verifies the email address
+	if err := env.service.RequestEmailVerification(context.Background(), contactPoint.ID); err != nil {
+		t.Fatalf("Failed to request email verification: %v", err)
+	}
+	eventually(t, "the confirmation email", func() bool { return len(env.smtp.sent()) == 1 })
+	links, err := env.service.redis.Keys(ctx, env.service.getContactPointLinkKey("*")).Result()
+	if err != nil || len(links) != 1 {
+		t.Fatalf("Expected one confirmation link, got %v (%v)", links, err)
+	}
+	if _, err := env.service.ConfirmEmail(strings.TrimPrefix(links[0], env.service.getContactPointLinkKey(""))); err != nil {
+		t.Fatalf("Failed to confirm email: %v", err)
+	}
+	if addresses := env.service.contactPointAddresses("tenant-a", "user-1", "email", ""); len(addresses) != 1 || addresses[0] != "ayse@talimat.test" {
+		t.Errorf("Expected the verified email address, got %v", addresses)
+	}
+
+	// The texted code verifies the phone number, wrong codes don't
+	if err := env.service.RequestPhoneVerification(context.Background(), contactPoint.ID); err != nil {
+		t.Fatalf("Failed to request phone verification: %v", err)
+	}
+	if sent := env.netgsm.sent(); len(sent) != 1 {
+		t.Fatalf("Expected the code to be texted, got %v", sent)
+	}
+	if err := env.service.RequestPhoneVerification(context.Background(), contactPoint.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected another code to be held back, got %v", err)
+	}
+	if _, err := env.service.ConfirmPhone(ctx, contactPoint.ID, "abcdef"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a wrong code to be rejected, got %v", err)
+	}
+	// Only the hash of the code is stored, put a known one in its place
+	purpose := contactPointOTPPurpose(contactPoint.ID)
+	known := env.service.hashOTP(OTPRequest{TenantID: "tenant-a", Recipient: phone, Purpose: purpose}, "123456")
+	env.service.redis.HSet(ctx, env.service.getOTPKey("tenant-a", purpose, phone), "code", known)
+	if _, err := env.service.ConfirmPhone(ctx, contactPoint.ID, "123456"); err != nil {
+		t.Fatalf("Failed to confirm phone: %v", err)
+	}
+	if addresses := env.service.contactPointAddresses("tenant-a", "user-1", "sms", ""); len(addresses) != 1 || addresses[0] != phone {
+		t.Errorf("Expected the verified phone number, got %v", addresses)
+	}
+
+	// Changing an address unverifies it
+	changed := "ayse.yilmaz@talimat.test"
+	updated := *contactPoint
+	updated.EmailAddress = &changed
+	result, err := env.service.UpdateContactPoint(contactPoint.ID, updated)
+	if err != nil {
+		t.Fatalf("Failed to update contact point: %v", err)
+	}
+	if result.EmailVerifiedAt != nil || result.PhoneVerifiedAt == nil {
+		t.Errorf("Expected only the changed address to be unverified, got %+v", result)
+	}
+}
+
+func TestIntegrationSystemMessagesFollowTenantLocale(t *testing.T) {
+	env := newIntegrationEnv(t)
+	if _, err := env.service.templateService.SetLocaleSettings("tenant-en", TemplateLocaleSettings{DefaultLocale: "en-GB"}); err != nil {
+		t.Fatalf("Failed to set locale settings: %v", err)
+	}
+
+	if _, err := env.service.SendOTP(context.Background(), OTPRequest{TenantID: "tenant-en", Channel: "email", Recipient: "ayse@talimat.test"}); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+	eventually(t, "the code email", func() bool { return len(env.smtp.sent()) == 1 })
+	if email := env.smtp.sent()[0]; !strings.Contains(email.Data, "Your verification code") {
+		t.Errorf("Expected the code in the tenant's locale, got %q", email.Data)
+	}
+
+	// A locale of the request wins over the tenant's
+	if _, err := env.service.SendOTP(context.Background(), OTPRequest{TenantID: "tenant-en", Channel: "email", Recipient: "mehmet@talimat.test", Locale: "tr"}); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+	eventually(t, "the second code email", func() bool { return len(env.smtp.sent()) == 2 })
+	if email := env.smtp.sent()[1]; strings.Contains(email.Data, "Your verification code") {
+		t.Errorf("Expected the code in the requested locale, got %q", email.Data)
+	}
+
+	if locale := i18n.Match("de-DE, en-US;q=0.7, tr;q=0.9"); locale != i18n.TR {
+		t.Errorf("Expected the most preferred supported locale, got %q", locale)
+	}
+	if detail := i18n.Translate(i18n.TR, "No route for GET /api/v1/nope"); detail != "GET /api/v1/nope için bir yol yok" {
+		t.Errorf("Expected the pattern to be translated, got %q", detail)
+	}
+}
+
+func TestIntegrationOTPIsVerifiedOnceAndRateLimited(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.service.config.OTPConfig.RateLimit = 2
+
+	request := OTPRequest{TenantID: "tenant-a", Channel: "sms", Recipient: "+905551112233", Purpose: "login"}
+	challenge, err := env.service.SendOTP(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+	if challenge.Length != 6 || time.Until(challenge.ExpiresAt) > 5*time.Minute {
+		t.Errorf("Expected a 6 digit code valid for 5 minutes, got %+v", challenge)
+	}
+	if sent := env.netgsm.sent(); len(sent) != 1 {
+		t.Fatalf("Expected the code to be texted, got %v", sent)
+	}
+
+	// The code is stored hashed under a key that doesn't name the recipient
+	ctx := context.Background()
+	keys, _ := env.service.redis.Keys(ctx, "otp:*").Result()
+	for _, key := range keys {
+		if strings.Contains(key, "5551112233") {
+			t.Errorf("Expected keys without the phone number, got %s", key)
+		}
+	}
+	key := env.service.getOTPKey("tenant-a", "login", request.Recipient)
+	known := env.service.hashOTP(request, "123456")
+	env.service.redis.HSet(ctx, key, "code", known)
+
+	if err := env.service.VerifyOTP(ctx, "tenant-a", request.Recipient, "signup", "123456"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the code not to verify another purpose, got %v", err)
+	}
+	if err := env.service.VerifyOTP(ctx, "tenant-a", request.Recipient, "login", "654321"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a wrong code to be rejected, got %v", err)
+	}
+	if err := env.service.VerifyOTP(ctx, "tenant-a", request.Recipient, "login", "123456"); err != nil {
+		t.Fatalf("Failed to verify code: %v", err)
+	}
+	if err := env.service.VerifyOTP(ctx, "tenant-a", request.Recipient, "login", "123456"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the code to verify once, got %v", err)
+	}
+
+	if _, err := env.service.SendOTP(context.Background(), request); err != nil {
+		t.Fatalf("Failed to send second code: %v", err)
+	}
+	var rateLimitErr *RateLimitError
+	if _, err := env.service.SendOTP(context.Background(), request); !errors.As(err, &rateLimitErr) {
+		t.Errorf("Expected the third code within the window to be rate limited, got %v", err)
+	}
+}
+
+func TestIntegrationStorageCleanupRemovesOrphanedEntries(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+	inApp.config.TTL = time.Hour
+
+	kept, err := inApp.CreateNotification(ctx, InAppNotification{UserID: "user-1", TenantID: "tenant-a", Type: "info", Title: "Kept", Message: "Kept"})
+	if err != nil {
+		t.Fatalf("Failed to create notification: %v", err)
+	}
+	expired, err := inApp.CreateNotification(ctx, InAppNotification{UserID: "user-1", TenantID: "tenant-a", Type: "info", Title: "Expired", Message: "Expired"})
+	if err != nil {
+		t.Fatalf("Failed to create notification: %v", err)
+	}
+	userKey := inApp.getUserNotificationsKey("user-1", "tenant-a")
+	if ttl, _ := env.service.redis.TTL(ctx, userKey).Result(); ttl <= 0 {
+		t.Errorf("Expected the notification list to expire, got TTL %v", ttl)
+	}
+
+	// The record expires before the indexes pointing at it
+	env.service.redis.Del(ctx, inApp.getNotificationKey(expired.ID))
+
+	// Deliveries of an endpoint that was deleted
+	webhooks := env.service.webhookService
+	if err := webhooks.storeDelivery(ctx, WebhookDelivery{ID: "delivery-1", EndpointID: "deleted-endpoint", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to store delivery: %v", err)
+	}
+
+	cleanup, err := env.service.CleanupStorage()
+	if err != nil {
+		t.Fatalf("Failed to clean up storage: %v", err)
+	}
+	if cleanup.IndexEntries < 2 || cleanup.OrphanedKeys < 2 {
+		t.Errorf("Expected the stale entries and the orphaned deliveries to be removed, got %+v", cleanup)
+	}
+
+	ids, _ := env.service.redis.ZRange(ctx, userKey, 0, -1).Result()
+	if len(ids) != 1 || ids[0] != kept.ID {
+		t.Errorf("Expected only %s in the notification list, got %v", kept.ID, ids)
+	}
+	if unread, _ := env.service.redis.SIsMember(ctx, inApp.getUnreadKey("user-1", "tenant-a"), expired.ID).Result(); unread {
+		t.Error("Expected the expired notification to leave the unread set")
+	}
+	if n, _ := env.service.redis.Exists(ctx, webhooks.getEndpointDeliveriesKey("deleted-endpoint"), webhooks.getDeliveryKey("delivery-1")).Result(); n != 0 {
+		t.Errorf("Expected the deliveries of the deleted endpoint to be removed, %d keys remain", n)
+	}
+
+	report, err := env.service.StorageReport(0)
+	if err != nil {
+		t.Fatalf("Failed to get storage report: %v", err)
+	}
+	if report.LastCleanup == nil || report.LastCleanup.IndexEntries != cleanup.IndexEntries {
+		t.Errorf("Expected the report to include the last cleanup, got %+v", report.LastCleanup)
+	}
+	prefixes := map[string]StoragePrefix{}
+	for _, prefix := range report.Prefixes {
+		prefixes[prefix.Prefix] = prefix
+	}
+	if prefixes["notification"].Keys != 1 || prefixes["user_notifications"].WithoutTTL != 0 {
+		t.Errorf("Expected one notification and expiring lists, got %+v", report.Prefixes)
+	}
+}
+
+func TestIntegrationInAppThreadsGroupNotifications(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	start := time.Now().Add(-time.Hour)
+	var created []*InAppNotification
+	for i, threadKey := range []string{"incident:123", "incident:456", "incident:123", ""} {
+		notification, err := inApp.CreateNotification(ctx, InAppNotification{
+			UserID:    "user-1",
+			TenantID:  "tenant-a",
+			Type:      "alert",
+			Title:     "Olay güncellemesi",
+			Message:   fmt.Sprintf("Güncelleme %d", i+1),
+			ThreadKey: threadKey,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create notification: %v", err)
+		}
+		created = append(created, notification)
+	}
+	if err := inApp.MarkAsRead(ctx, created[0].ID, "user-1"); err != nil {
+		t.Fatalf("Failed to mark notification as read: %v", err)
+	}
+
+	threads, total, err := inApp.GetUserThreads(ctx, "user-1", "tenant-a", 1, 20)
+	if err != nil {
+		t.Fatalf("Failed to get threads: %v", err)
+	}
+	if total != 2 || len(threads) != 2 {
+		t.Fatalf("Expected 2 threads, got %d", len(threads))
+	}
+	incident := threads[0]
+	if incident.ThreadKey != "incident:123" || incident.Count != 2 || incident.UnreadCount != 1 || incident.Latest.ID != created[2].ID {
+		t.Errorf("Expected the most recently active thread first with its latest notification, got %+v", incident)
+	}
+
+	notifications, matched, err := inApp.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, map[string]interface{}{"thread": "incident:123"})
+	if err != nil {
+		t.Fatalf("Failed to get thread notifications: %v", err)
+	}
+	if matched != 2 || len(notifications) != 2 {
+		t.Errorf("Expected the thread to expand to 2 notifications, got %d", matched)
+	}
+
+	marked, err := inApp.MarkThreadAsRead(ctx, "user-1", "tenant-a", "incident:123")
+	if err != nil {
+		t.Fatalf("Failed to mark thread as read: %v", err)
+	}
+	if marked != 1 {
+		t.Errorf("Expected 1 notification to be marked, got %d", marked)
+	}
+	if count, _ := inApp.GetUnreadCount(ctx, "user-1", "tenant-a"); count != 2 {
+		t.Errorf("Expected the other notifications to stay unread, got %d unread", count)
+	}
+
+	// Threads left empty drop out of the listing
+	for _, notification := range []*InAppNotification{created[0], created[2]} {
+		if err := inApp.DeleteNotification(ctx, notification.ID, "user-1"); err != nil {
+			t.Fatalf("Failed to delete notification: %v", err)
+		}
+	}
+	if threads, _, _ := inApp.GetUserThreads(ctx, "user-1", "tenant-a", 1, 20); len(threads) != 1 || threads[0].ThreadKey != "incident:456" {
+		t.Errorf("Expected only the other thread to be left, got %d threads", len(threads))
+	}
+}
+
+func TestIntegrationSavedViewsFilterTheInAppFeed(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	for _, notification := range []InAppNotification{
+		{Category: "safety", Priority: "urgent", Title: "Yangın tatbikatı", Message: "Saat 14:00"},
+		{Category: "safety", Priority: "normal", Title: "KKD hatırlatması", Message: "Baret takın"},
+		{Category: "approval", Priority: "high", Title: "Onay bekliyor", Message: "Talimat 12"},
+	} {
+		notification.UserID = "user-1"
+		notification.TenantID = "tenant-a"
+		notification.Type = "info"
+		if _, err := inApp.CreateNotification(ctx, notification); err != nil {
+			t.Fatalf("Failed to create notification: %v", err)
+		}
+	}
+
+	unread := false
+	view, err := inApp.CreateSavedView(ctx, SavedView{
+		UserID:   "user-1",
+		TenantID: "tenant-a",
+		Name:     "Safety critical",
+		Category: "safety",
+		Priority: "urgent",
+		Read:     &unread,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create saved view: %v", err)
+	}
+	if _, err := inApp.CreateSavedView(ctx, SavedView{UserID: "user-1", TenantID: "tenant-a", Name: "Safety critical"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected a second view of the same name to conflict, got %v", err)
+	}
+
+	stored, err := inApp.GetSavedView(ctx, "user-1", "tenant-a", view.ID)
+	if err != nil {
+		t.Fatalf("Failed to get saved view: %v", err)
+	}
+	notifications, total, err := inApp.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, stored.Filters())
+	if err != nil {
+		t.Fatalf("Failed to get notifications of the view: %v", err)
+	}
+	if total != 1 || notifications[0].Title != "Yangın tatbikatı" {
+		t.Errorf("Expected the view to match the urgent safety notification, got %d", total)
+	}
+
+	// Views are kept per user
+	if _, err := inApp.GetSavedView(ctx, "user-2", "tenant-a", view.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the view not to be found for another user, got %v", err)
+	}
+
+	if err := inApp.DeleteSavedView(ctx, "user-1", "tenant-a", view.ID); err != nil {
+		t.Fatalf("Failed to delete saved view: %v", err)
+	}
+	if views, _ := inApp.ListSavedViews(ctx, "user-1", "tenant-a"); len(views) != 0 {
+		t.Errorf("Expected no saved views left, got %d", len(views))
+	}
+}
+
+func TestIntegrationMentionsLinkToTheirEntity(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	results, err := env.service.SendMention(ctx, MentionRequest{
+		TenantID:  "tenant-a",
+		UserIDs:   []string{"user-1", "user-2", "user-2", "actor"},
+		Entity:    EntityRef{Type: "incident", ID: "123", Title: "Forklift kazası"},
+		ActorID:   "actor",
+		ActorName: "Ayşe",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send mention: %v", err)
+	}
+	// The actor and the repeated user are notified once at most
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 mentions, got %d", len(results))
+	}
+
+	notifications, total, err := env.service.inAppService.GetEntityNotifications(ctx, "tenant-a", "incident", "123", "user-1", 1, 20)
+	if err != nil {
+		t.Fatalf("Failed to get entity notifications: %v", err)
+	}
+	if total != 1 {
+		t.Fatalf("Expected 1 notification of the user, got %d", total)
+	}
+	notification := notifications[0]
+	if notification.ActionURL != "/incidents/123" {
+		t.Errorf("Expected a deep link to the incident, got %q", notification.ActionURL)
+	}
+	if notification.Entity == nil || notification.Entity.ID != "123" || notification.Category != MentionKindMention {
+		t.Errorf("Expected the notification to be a mention on the incident, got %+v", notification.Entity)
+	}
+
+	if _, total, _ := env.service.inAppService.GetEntityNotifications(ctx, "tenant-a", "incident", "123", "", 1, 20); total != 2 {
+		t.Errorf("Expected 2 notifications about the incident, got %d", total)
+	}
+
+	_, err = env.service.SendMention(ctx, MentionRequest{
+		TenantID: "tenant-a",
+		UserIDs:  []string{"user-1"},
+		Entity:   EntityRef{Type: "invoice", ID: "9"},
+		ActorID:  "actor",
+	})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected unknown entity types to be rejected, got %v", err)
+	}
+}
+
+func TestIntegrationInAppExportCoversTheRequestedRange(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	var ids []string
+	for _, tenantID := range []string{"tenant-a", "tenant-a", "tenant-b"} {
+		notification, err := inApp.CreateNotification(ctx, InAppNotification{
+			UserID:   "user-1",
+			TenantID: tenantID,
+			Type:     "info",
+			Title:    "İş güvenliği talimatı",
+			Message:  "Talimatı okuyun",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create notification: %v", err)
+		}
+		ids = append(ids, notification.ID)
+	}
+
+	// The first notification reached the feed ten days ago
+	old := time.Now().AddDate(0, 0, -10)
+	inApp.redis.ZAdd(ctx, inApp.getUserNotificationsKey("user-1", "tenant-a"), &redis.Z{
+		Score:  float64(old.Unix()),
+		Member: ids[0],
+	})
+
+	export := func(from time.Time) []string {
+		var exported []string
+		err := inApp.ExportUserNotifications(ctx, "user-1", "tenant-a", from, time.Time{}, func(notification *InAppNotification) error {
+			exported = append(exported, notification.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to export: %v", err)
+		}
+		return exported
+	}
+
+	// Oldest first, and never the notifications of another tenant
+	if exported := export(time.Time{}); len(exported) != 2 || exported[0] != ids[0] || exported[1] != ids[1] {
+		t.Errorf("Expected both notifications of the tenant oldest first, got %v", exported)
+	}
+	if exported := export(time.Now().AddDate(0, 0, -2)); len(exported) != 1 || exported[0] != ids[1] {
+		t.Errorf("Expected only the recent notification, got %v", exported)
+	}
+
+	err := inApp.ExportUserNotifications(ctx, "user-1", "tenant-a", time.Now(), old, func(*InAppNotification) error { return nil })
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a reversed range to be rejected, got %v", err)
+	}
+}
+
+func TestIntegrationSendsAreWrittenInTheRecipientsLanguage(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	recipients := env.service.recipients
+	for _, contact := range []*UserContact{
+		{ID: "user-1", TenantID: "tenant-a", Locale: "en-GB", IsActive: true},
+		{ID: "user-2", TenantID: "tenant-a", Locale: "tr", IsActive: true},
+		{ID: "user-3", TenantID: "tenant-a", Locale: "de", IsActive: true},
+	} {
+		recipients.cache(recipients.getContactKey("tenant-a", contact.ID), contact)
+	}
+
+	result, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:       "inapp",
+		Recipients: []string{"user:user-1", "user:user-2", "user:user-3"},
+		Title:      "Safety briefing",
+		Message:    "Read the new instruction",
+		Category:   "safety",
+		TenantID:   "tenant-a",
+		Localizations: map[string]LocalizedContent{
+			"en": {Title: "Safety briefing", Message: "Read the new instruction"},
+			"tr": {Title: "Güvenlik brifingi", Message: "Yeni talimatı okuyun"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.Metadata["sent_count"] != 3 {
+		t.Fatalf("Expected 3 deliveries, got %v", result.Metadata["sent_count"])
+	}
+
+	// German falls back to the service's default locale
+	for userID, title := range map[string]string{"user-1": "Safety briefing", "user-2": "Güvenlik brifingi", "user-3": "Güvenlik brifingi"} {
+		notifications, _, err := inApp.GetUserNotifications(ctx, userID, "tenant-a", 1, 20, nil)
+		if err != nil || len(notifications) != 1 {
+			t.Fatalf("Expected one notification for %s, got %d (%v)", userID, len(notifications), err)
+		}
+		if notifications[0].Title != title {
+			t.Errorf("Expected %s to get %q, got %q", userID, title, notifications[0].Title)
+		}
+	}
+
+	stats, err := env.service.GetNotificationStats("tenant-a", 1)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.ByLocale["en"] == nil || stats.ByLocale["en"].Sent != 1 || stats.ByLocale["tr"] == nil || stats.ByLocale["tr"].Sent != 2 {
+		t.Errorf("Expected 1 English and 2 Turkish deliveries, got %+v", stats.ByLocale)
+	}
+
+	// Templates are rendered in the locale variant of each recipient
+	templates := env.service.templateService
+	for _, template := range []NotificationTemplate{
+		{Name: "briefing", Type: "inapp", Locale: "tr", Title: "Brifing {{.place}}", Message: "Katılın"},
+		{Name: "briefing", Type: "inapp", Locale: "en", Title: "Briefing {{.place}}", Message: "Attend"},
+	} {
+		template.TenantID = "tenant-a"
+		template.Category = "safety"
+		template.IsActive = true
+		if _, err := templates.CreateTemplate(ctx, template); err != nil {
+			t.Fatalf("Failed to create template: %v", err)
+		}
+	}
+	variants, err := templates.GetTemplateVariants("briefing", "inapp", "tenant-a")
+	if err != nil || len(variants) != 2 {
+		t.Fatalf("Expected 2 template variants, got %d (%v)", len(variants), err)
+	}
+	if _, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:         "inapp",
+		Recipients:   []string{"user:user-1"},
+		TemplateID:   findVariant(variants, "tr").ID,
+		TemplateData: map[string]interface{}{"place": "A"},
+		TenantID:     "tenant-a",
+	}); err != nil {
+		t.Fatalf("Failed to send template: %v", err)
+	}
+	notifications, _, _ := inApp.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, map[string]interface{}{"search": "attend"})
+	if len(notifications) != 1 || notifications[0].Title != "Briefing A" {
+		t.Errorf("Expected the English variant of the template, got %d notifications", len(notifications))
+	}
+}
+
+func TestIntegrationInAppAttachmentsAreSignedWhenRead(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+	inApp.config.AttachmentS3Endpoint = "https://minio.example.com"
+	inApp.config.AttachmentS3AccessKey = "access"
+	inApp.config.AttachmentS3SecretKey = "secret"
+
+	created, err := inApp.CreateNotification(ctx, InAppNotification{
+		UserID:   "user-1",
+		TenantID: "tenant-a",
+		Type:     "alert",
+		Title:    "Yangın tatbikatı",
+		Message:  "Tahliye prosedürünü okuyun",
+		Attachments: []InAppAttachment{
+			{Kind: AttachmentKindPDF, Name: "Yangın prosedürü", ObjectURL: "s3://procedures/yangın.pdf", Size: 2 << 20},
+			{Kind: AttachmentKindDocument, Name: "Talimat", DocumentID: "doc-7"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notification: %v", err)
+	}
+
+	notification, err := inApp.GetNotification(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Failed to get notification: %v", err)
+	}
+	if len(notification.Attachments) != 2 {
+		t.Fatalf("Expected 2 attachments, got %d", len(notification.Attachments))
+	}
+	pdf := notification.Attachments[0]
+	if !strings.HasPrefix(pdf.URL, "https://minio.example.com/procedures/yang%C4%B1n.pdf?") || !strings.Contains(pdf.URL, "X-Amz-Signature=") {
+		t.Errorf("Expected a signed link to the PDF, got %q", pdf.URL)
+	}
+	if pdf.URLExpiresAt == nil || pdf.ContentType != "application/pdf" {
+		t.Errorf("Expected the PDF link to expire and the content type to be set, got %+v", pdf)
+	}
+	if document := notification.Attachments[1]; document.URL != "/documents/doc-7" {
+		t.Errorf("Expected a deep link to the document, got %q", document.URL)
+	}
+
+	stored, err := inApp.redis.Get(ctx, inApp.getNotificationKey(created.ID)).Result()
+	if err != nil {
+		t.Fatalf("Failed to get stored notification: %v", err)
+	}
+	if strings.Contains(stored, "X-Amz-Signature") {
+		t.Errorf("Expected signed links not to be stored")
+	}
+
+	for _, attachment := range []InAppAttachment{
+		{Kind: AttachmentKindPDF, Name: "Büyük", ObjectURL: "s3://procedures/big.pdf", Size: 26 << 20},
+		{Kind: AttachmentKindImage, Name: "Boyutsuz", ObjectURL: "s3://procedures/plan.png"},
+		{Kind: AttachmentKindImage, Name: "Yanlış tür", ObjectURL: "s3://procedures/plan.png", Size: 10, ContentType: "application/pdf"},
+	} {
+		_, err := inApp.CreateNotification(ctx, InAppNotification{
+			UserID:      "user-1",
+			TenantID:    "tenant-a",
+			Type:        "alert",
+			Title:       "Yangın tatbikatı",
+			Message:     "Tahliye prosedürünü okuyun",
+			Attachments: []InAppAttachment{attachment},
+		})
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("Expected attachment %s to be rejected, got %v", attachment.Name, err)
+		}
+	}
+}
+
+func TestIntegrationInAppBulkCreationWritesEveryNotification(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+	inApp.config.BatchSize = 2
+
+	var notifications []InAppNotification
+	for i := 0; i < 5; i++ {
+		notifications = append(notifications, InAppNotification{
+			UserID:   "user-1",
+			TenantID: "tenant-a",
+			Type:     "info",
+			Title:    fmt.Sprintf("Talimat %d", i),
+			Message:  "Yeni talimat yayınlandı",
+			Category: "procedures",
+		})
+	}
+
+	created, err := inApp.CreateNotificationsBulk(ctx, notifications)
+	if err != nil {
+		t.Fatalf("Failed to create notifications: %v", err)
+	}
+	if len(created) != 5 || created[4].Title != "Talimat 4" {
+		t.Fatalf("Expected the 5 notifications in order, got %d", len(created))
+	}
+	if count, err := inApp.GetUnreadCount(ctx, "user-1", "tenant-a"); err != nil || count != 5 {
+		t.Errorf("Expected 5 unread notifications, got %d (%v)", count, err)
+	}
+	if _, err := inApp.GetNotification(ctx, created[2].ID); err != nil {
+		t.Errorf("Expected the notifications to be stored, got %v", err)
+	}
+
+	notifications[1].Title = ""
+	if _, err := inApp.CreateNotificationsBulk(ctx, notifications); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected an invalid notification to reject the batch, got %v", err)
+	}
+	if count, _ := inApp.GetUnreadCount(ctx, "user-1", "tenant-a"); count != 5 {
+		t.Errorf("Expected no notification of a rejected batch to be created, got %d unread", count)
+	}
+}
+
+func TestIntegrationUnreadUpdatesArePublishedToTheUser(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	pubsub := inApp.redis.Subscribe(ctx, UnreadChannel("user-1", "tenant-a"))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	updates := pubsub.Channel()
+	next := func() UnreadUpdate {
+		t.Helper()
+		select {
+		case message := <-updates:
+			var update UnreadUpdate
+			if err := json.Unmarshal([]byte(message.Payload), &update); err != nil {
+				t.Fatalf("Failed to unmarshal unread update: %v", err)
+			}
+			return update
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected an unread update")
+		}
+		return UnreadUpdate{}
+	}
+
+	notification := InAppNotification{
+		UserID:   "user-1",
+		TenantID: "tenant-a",
+		Type:     "info",
+		Title:    "Yeni talimat",
+		Message:  "Talimatı okuyun",
+		Category: "procedures",
+	}
+	created, err := inApp.CreateNotificationsBulk(ctx, []InAppNotification{notification, notification})
+	if err != nil {
+		t.Fatalf("Failed to create notifications: %v", err)
+	}
+	if update := next(); update.Delta != 2 || update.Reason != UnreadReasonCreated || len(update.NotificationIDs) != 2 {
+		t.Errorf("Expected one update adding 2 unread notifications, got %+v", update)
+	}
+
+	if err := inApp.MarkAsRead(ctx, created[0].ID, "user-1"); err != nil {
+		t.Fatalf("Failed to mark notification as read: %v", err)
+	}
+	if update := next(); update.Delta != -1 || update.Reason != UnreadReasonRead {
+		t.Errorf("Expected the read to remove 1 unread notification, got %+v", update)
+	}
+
+	// Reading again leaves the count as it is, so nothing is published
+	if err := inApp.MarkAsRead(ctx, created[0].ID, "user-1"); err != nil {
+		t.Fatalf("Failed to mark notification as read: %v", err)
+	}
+	if err := inApp.DeleteNotification(ctx, created[1].ID, "user-1"); err != nil {
+		t.Fatalf("Failed to delete notification: %v", err)
+	}
+	if update := next(); update.Delta != -1 || update.Reason != UnreadReasonDeleted || update.NotificationIDs[0] != created[1].ID {
+		t.Errorf("Expected the deletion to remove 1 unread notification, got %+v", update)
+	}
+}
+
+func TestIntegrationSelectedNotificationsAreUpdatedInOneCall(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	var notifications []InAppNotification
+	for _, userID := range []string{"user-1", "user-1", "user-1", "user-2"} {
+		notifications = append(notifications, InAppNotification{
+			UserID:   userID,
+			TenantID: "tenant-a",
+			Type:     "info",
+			Title:    "Yeni talimat",
+			Message:  "Talimatı okuyun",
+			Category: "procedures",
+		})
+	}
+	created, err := inApp.CreateNotificationsBulk(ctx, notifications)
+	if err != nil {
+		t.Fatalf("Failed to create notifications: %v", err)
+	}
+	selected := []string{created[0].ID, created[1].ID, created[3].ID, "missing"}
+
+	results, err := inApp.ApplyToNotifications(ctx, "user-1", "tenant-a", BatchOperationRead, selected)
+	if err != nil {
+		t.Fatalf("Failed to mark notifications as read: %v", err)
+	}
+	expected := []string{BatchStatusDone, BatchStatusDone, BatchStatusNotFound, BatchStatusNotFound}
+	for i, result := range results {
+		if result.ID != selected[i] || result.Status != expected[i] {
+			t.Errorf("Expected %s to be %s, got %+v", selected[i], expected[i], result)
+		}
+	}
+	if count, _ := inApp.GetUnreadCount(ctx, "user-1", "tenant-a"); count != 1 {
+		t.Errorf("Expected 1 unread notification, got %d", count)
+	}
+	// Other users' notifications are left alone
+	if count, _ := inApp.GetUnreadCount(ctx, "user-2", "tenant-a"); count != 1 {
+		t.Errorf("Expected the notification of user-2 to stay unread, got %d unread", count)
+	}
+
+	if _, err := inApp.ApplyToNotifications(ctx, "user-1", "tenant-a", BatchOperationUnread, selected[:1]); err != nil {
+		t.Fatalf("Failed to mark notifications as unread: %v", err)
+	}
+	notification, _ := inApp.GetNotification(ctx, created[0].ID)
+	if notification.Read || notification.ReadAt != nil {
+		t.Errorf("Expected the notification to be unread again")
+	}
+	if count, _ := inApp.GetUnreadCount(ctx, "user-1", "tenant-a"); count != 2 {
+		t.Errorf("Expected 2 unread notifications, got %d", count)
+	}
+
+	if _, err := inApp.ApplyToNotifications(ctx, "user-1", "tenant-a", BatchOperationDelete, selected[1:2]); err != nil {
+		t.Fatalf("Failed to delete notifications: %v", err)
+	}
+	if _, err := inApp.GetNotification(ctx, created[1].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the notification to be deleted, got %v", err)
+	}
+
+	if _, err := inApp.ApplyToNotifications(ctx, "user-1", "tenant-a", "pin", selected); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected unknown operations to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LocalizedContent is the content of a notification in one locale. The
+// subject defaults to the title and the text body to the message.
+type LocalizedContent struct {
+	Subject  string `json:"subject,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Message  string `json:"message,omitempty"`
+	HTMLBody string `json:"html_body,omitempty"`
+	TextBody string `json:"text_body,omitempty"`
+}
+
+// localizeContent writes a delivery in the language of its recipient, from
+// the content variants of the request or the locale variants of its
+// template. Variants are looked up along the locale chain of the recipient:
+// their locale, its base language, the tenant's default locale, then the
+// service's. Requests without a variant in any of them keep their own
+// content. The locale written in is kept in the metadata of the delivery.
+func (s *NotificationService) localizeContent(request *NotificationRequest) error {
+	// Requests built from a rendered template are already localized
+	_, rendered := request.Metadata["template_version"]
+	renderTemplate := request.TemplateID != "" && !rendered
+	if len(request.Localizations) == 0 && !renderTemplate {
+		return nil
+	}
+
+	chain := s.templateService.LocaleChain(request.TenantID, s.recipientLocale(request.TenantID, deliveryRecipient(*request)))
+
+	var locale string
+	if renderTemplate {
+		template, err := s.templateService.GetTemplate(request.TemplateID)
+		if err != nil {
+			return fmt.Errorf("failed to get template: %w", err)
+		}
+
+		variant := template
+		for _, candidate := range chain {
+			localized := s.templateService.LocalizedVariant(template, candidate)
+			if localized.ID != template.ID || baseLanguage(localized.Locale) == baseLanguage(candidate) {
+				variant = localized
+				break
+			}
+		}
+
+		result, err := s.templateService.RenderTemplate(variant.ID, request.TemplateData)
+		if err != nil {
+			return fmt.Errorf("failed to render template: %w", err)
+		}
+
+		request.TemplateID = variant.ID
+		if request.Category == "" {
+			request.Category = variant.Category
+		}
+		LocalizedContent{
+			Subject:  result.Subject,
+			Title:    result.Title,
+			Message:  result.Message,
+			HTMLBody: result.HTMLBody,
+			TextBody: result.TextBody,
+		}.apply(request)
+		request.Metadata = copyMetadata(request.Metadata)
+		request.Metadata["template_version"] = result.Version
+		locale = variant.Locale
+	} else {
+		var content *LocalizedContent
+		locale, content = pickLocalization(request.Localizations, chain)
+		if content == nil && request.Message == "" && request.HTMLBody == "" {
+			// Without content of its own the request falls back to its first locale
+			locale, content = firstLocalization(request.Localizations)
+		}
+		if content == nil {
+			return nil
+		}
+		content.apply(request)
+	}
+
+	request.Metadata = copyMetadata(request.Metadata)
+	request.Metadata["locale"] = normalizeLanguage(locale)
+	return nil
+}
+
+// apply replaces the content of a request
+func (c LocalizedContent) apply(request *NotificationRequest) {
+	request.Subject = c.Subject
+	if request.Subject == "" {
+		request.Subject = c.Title
+	}
+	request.Title = c.Title
+	request.Message = c.Message
+	request.HTMLBody = c.HTMLBody
+	request.TextBody = c.TextBody
+	if request.TextBody == "" {
+		request.TextBody = c.Message
+	}
+}
+
+// pickLocalization returns the first content variant along a locale chain.
+// Variants of a regional locale, like en-GB, stand in for their language.
+func pickLocalization(localizations map[string]LocalizedContent, chain []string) (string, *LocalizedContent) {
+	for _, locale := range chain {
+		for key, content := range localizations {
+			if sameLocale(key, locale) {
+				return key, &content
+			}
+		}
+		for key, content := range localizations {
+			if baseLanguage(key) == locale {
+				return key, &content
+			}
+		}
+	}
+	return "", nil
+}
+
+// firstLocalization returns the content variant of the alphabetically first
+// locale, so the fallback doesn't change between deliveries
+func firstLocalization(localizations map[string]LocalizedContent) (string, *LocalizedContent) {
+	locales := make([]string, 0, len(localizations))
+	for locale := range localizations {
+		locales = append(locales, locale)
+	}
+	if len(locales) == 0 {
+		return "", nil
+	}
+	sort.Strings(locales)
+
+	content := localizations[locales[0]]
+	return locales[0], &content
+}
+
+// validateLocalizations validates the content variants of a request
+func validateLocalizations(localizations map[string]LocalizedContent) error {
+	for locale, content := range localizations {
+		if normalizeLanguage(locale) == "" {
+			return fmt.Errorf("localization locale is required")
+		}
+		if content.Message == "" && content.HTMLBody == "" {
+			return fmt.Errorf("localization %s has no message", locale)
+		}
+	}
+	return nil
+}
+
+// deliveryRecipient returns the user reference of the recipient of a
+// delivery, empty when it went to raw addresses
+func deliveryRecipient(request NotificationRequest) string {
+	userID, _ := request.Metadata["recipient_user_id"].(string)
+	if userID == "" && request.Type == "inapp" && len(request.Recipients) == 1 {
+		userID = request.Recipients[0]
+	}
+	if userID == "" {
+		return ""
+	}
+	return RecipientPrefixUser + userID
+}
@@ -0,0 +1,488 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// What maintenance windows do with the notifications they hold back
+const (
+	MaintenanceActionSuppress = "suppress" // drop them, they are audited only
+	MaintenanceActionDefer    = "defer"    // send them when the window ends
+)
+
+// maintenanceRetention is how long ended windows are kept
+const maintenanceRetention = 30 * 24 * time.Hour
+
+// maxMaintenanceDuration bounds a window, deferred notifications are useless
+// long after they were sent
+const maxMaintenanceDuration = 7 * 24 * time.Hour
+
+// maintenanceAuditLimit is how many held back deliveries are audited per tenant
+const maintenanceAuditLimit = 10000
+
+// maintenanceChannels are the channels a window may be limited to
+var maintenanceChannels = map[string]bool{
+	"email":   true,
+	"sms":     true,
+	"push":    true,
+	"inapp":   true,
+	"webhook": true,
+	"voice":   true,
+}
+
+// MaintenanceWindow holds back the non-urgent notifications of a tenant for
+// a while. Without categories it is a maintenance window muting the whole
+// tenant during planned downtime; with categories it mutes only those.
+type MaintenanceWindow struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	Name       string    `json:"name"`
+	Reason     string    `json:"reason,omitempty"`
+	Categories []string  `json:"categories,omitempty"` // every category when empty
+	Channels   []string  `json:"channels,omitempty"`   // every channel when empty
+	Action     string    `json:"action"`               // suppress or defer, defer when empty
+	Start      time.Time `json:"start"`                // now when empty
+	End        time.Time `json:"end"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MutedDelivery is the audit record of a delivery a maintenance window held back
+type MutedDelivery struct {
+	ResultID  string     `json:"result_id"`
+	RequestID string     `json:"request_id"`
+	WindowID  string     `json:"window_id"`
+	Type      string     `json:"type"`
+	Recipient string     `json:"recipient"`
+	Category  string     `json:"category,omitempty"`
+	Priority  string     `json:"priority"`
+	Action    string     `json:"action"`
+	SendAt    *time.Time `json:"send_at,omitempty"` // when deferred deliveries go out
+	MutedAt   time.Time  `json:"muted_at"`
+}
+
+// MaintenanceError is returned when a maintenance window holds back a send
+type MaintenanceError struct {
+	WindowID string
+	Action   string
+	Until    time.Time
+}
+
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("notifications muted by maintenance window %s until %s", e.WindowID, e.Until.Format(time.RFC3339))
+}
+
+// CreateMaintenanceWindow schedules a maintenance window
+func (s *NotificationService) CreateMaintenanceWindow(window MaintenanceWindow) (*MaintenanceWindow, error) {
+	log.Info().
+		Str("name", window.Name).
+		Str("tenantID", window.TenantID).
+		Time("end", window.End).
+		Msg("Creating maintenance window")
+
+	now := time.Now()
+	if window.Start.IsZero() {
+		window.Start = now
+	}
+	if window.Action == "" {
+		window.Action = MaintenanceActionDefer
+	}
+	if err := validateMaintenanceWindow(window, now); err != nil {
+		return nil, invalid(fmt.Errorf("maintenance window validation failed: %w", err))
+	}
+
+	window.ID = newID("maintenance")
+	window.CreatedAt = now
+
+	windowJSON, err := json.Marshal(window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal maintenance window: %w", err)
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getMaintenanceWindowKey(window.ID), windowJSON, time.Until(window.End)+maintenanceRetention)
+	pipe.ZAdd(ctx, s.getMaintenanceWindowsKey(window.TenantID), &redis.Z{
+		Score:  float64(window.End.Unix()),
+		Member: window.ID,
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store maintenance window: %w", err)
+	}
+
+	return &window, nil
+}
+
+// GetMaintenanceWindow gets a maintenance window by ID
+func (s *NotificationService) GetMaintenanceWindow(windowID string) (*MaintenanceWindow, error) {
+	windowJSON, err := s.redis.Get(context.Background(), s.getMaintenanceWindowKey(windowID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("maintenance window not found: %s", windowID)
+		}
+		return nil, fmt.Errorf("failed to get maintenance window: %w", err)
+	}
+
+	var window MaintenanceWindow
+	if err := json.Unmarshal([]byte(windowJSON), &window); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal maintenance window: %w", err)
+	}
+
+	return &window, nil
+}
+
+// ListMaintenanceWindows lists the windows of a tenant, the latest ending
+// first. With activeOnly only the windows muting notifications now are listed.
+func (s *NotificationService) ListMaintenanceWindows(tenantID string, activeOnly bool) ([]*MaintenanceWindow, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Windows are scored by their end
+	ended := "-inf"
+	if activeOnly {
+		ended = "(" + strconv.FormatInt(now.Unix(), 10)
+	}
+
+	ids, err := s.redis.ZRevRangeByScore(ctx, s.getMaintenanceWindowsKey(tenantID), &redis.ZRangeBy{
+		Min: ended,
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list maintenance windows: %w", err)
+	}
+
+	windows := []*MaintenanceWindow{}
+	var expired []interface{}
+	for _, id := range ids {
+		window, err := s.GetMaintenanceWindow(id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				expired = append(expired, id)
+			}
+			continue
+		}
+		if activeOnly && (window.Start.After(now) || !window.End.After(now)) {
+			continue
+		}
+		windows = append(windows, window)
+	}
+
+	if len(expired) > 0 {
+		s.redis.ZRem(ctx, s.getMaintenanceWindowsKey(tenantID), expired...)
+	}
+
+	return windows, nil
+}
+
+// DeleteMaintenanceWindow cancels a maintenance window. The deliveries it
+// deferred are sent right away.
+func (s *NotificationService) DeleteMaintenanceWindow(windowID string) error {
+	window, err := s.GetMaintenanceWindow(windowID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, s.getMaintenanceWindowKey(windowID))
+	pipe.ZRem(ctx, s.getMaintenanceWindowsKey(window.TenantID), windowID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete maintenance window: %w", err)
+	}
+
+	released, err := s.releaseDeferredDeliveries(ctx, windowID)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("windowID", windowID).
+		Int("released", released).
+		Msg("Maintenance window deleted")
+
+	return nil
+}
+
+// GetMutedDeliveries returns the audit of the deliveries maintenance windows
+// of a tenant held back, the latest first, optionally of a single window
+func (s *NotificationService) GetMutedDeliveries(tenantID string, windowID string, page int, limit int) ([]*MutedDelivery, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	entries, err := s.redis.LRange(context.Background(), s.getMaintenanceAuditKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get muted deliveries: %w", err)
+	}
+
+	deliveries := []*MutedDelivery{}
+	offset := (page - 1) * limit
+	for _, entry := range entries {
+		var delivery MutedDelivery
+		if err := json.Unmarshal([]byte(entry), &delivery); err != nil {
+			continue
+		}
+		if windowID != "" && delivery.WindowID != windowID {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		deliveries = append(deliveries, &delivery)
+		if len(deliveries) >= limit {
+			break
+		}
+	}
+
+	return deliveries, nil
+}
+
+// checkMaintenance returns the error holding back a request when a
+// maintenance window of its tenant applies to it. Urgent notifications are
+// never held back.
+func (s *NotificationService) checkMaintenance(request NotificationRequest) *MaintenanceError {
+	if request.Priority == "urgent" {
+		return nil
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// Only the windows not over yet are read
+	ids, err := s.redis.ZRangeByScore(ctx, s.getMaintenanceWindowsKey(request.TenantID), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(now.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		log.Warn().Err(err).Str("tenantID", request.TenantID).Msg("Failed to get maintenance windows, sending anyway")
+		return nil
+	}
+
+	for _, id := range ids {
+		window, err := s.GetMaintenanceWindow(id)
+		if err != nil || window.Start.After(now) {
+			continue
+		}
+		if len(window.Categories) > 0 && !containsString(window.Categories, request.Category) {
+			continue
+		}
+		if len(window.Channels) > 0 && !containsString(window.Channels, request.Type) {
+			continue
+		}
+
+		return &MaintenanceError{WindowID: window.ID, Action: window.Action, Until: window.End}
+	}
+
+	return nil
+}
+
+// holdForMaintenance suppresses or defers a delivery held back by a
+// maintenance window and audits it. Like deliveries deferred by a circuit
+// breaker, it does not use up its retry budget.
+func (s *NotificationService) holdForMaintenance(request NotificationRequest, result *NotificationResult, cause *MaintenanceError) (*NotificationResult, error) {
+	if result == nil {
+		recipient := ""
+		if len(request.Recipients) > 0 {
+			recipient = request.Recipients[0]
+		}
+		result = s.createFailedResult(request, request.Type, recipient, "")
+		result.Attempts = 0
+	}
+
+	result.Error = cause.Error()
+	result.NextRetryAt = nil
+	result.Metadata = copyMetadata(result.Metadata)
+	result.Metadata["maintenance_window_id"] = cause.WindowID
+
+	audit := MutedDelivery{
+		ResultID:  result.ID,
+		RequestID: request.ID,
+		WindowID:  cause.WindowID,
+		Type:      request.Type,
+		Recipient: result.Recipient,
+		Category:  request.Category,
+		Priority:  request.Priority,
+		Action:    cause.Action,
+		MutedAt:   time.Now(),
+	}
+
+	if cause.Action == MaintenanceActionDefer {
+		// Spread the deferred deliveries so they do not all go out at once
+		sendAt := cause.Until.Add(retryBackoff(s.config.RetryDelay, s.config.MaxRetryDelay, 1))
+		result.Status = "pending"
+		result.NextRetryAt = &sendAt
+		audit.SendAt = &sendAt
+
+		if err := s.storeResult(*result); err != nil {
+			return result, fmt.Errorf("failed to store deferred result: %w", err)
+		}
+		if err := s.storeRequestUntil(request, sendAt); err != nil {
+			return result, fmt.Errorf("failed to store deferred request: %w", err)
+		}
+		if err := s.queueNotification(request, result, sendAt); err != nil {
+			return result, fmt.Errorf("failed to queue deferred notification: %w", err)
+		}
+		s.trackDeferredDelivery(cause, request, result)
+	} else {
+		result.Status = "suppressed"
+		result.Metadata["suppression_reason"] = "maintenance"
+
+		if err := s.storeResult(*result); err != nil {
+			return result, fmt.Errorf("failed to store suppressed result: %w", err)
+		}
+		s.notifyStatus(*result)
+	}
+
+	s.auditMutedDelivery(request.TenantID, audit)
+
+	log.Info().
+		Str("resultID", result.ID).
+		Str("windowID", cause.WindowID).
+		Str("action", cause.Action).
+		Msg("Notification held back by maintenance window")
+
+	return result, nil
+}
+
+// trackDeferredDelivery remembers the queue entry of a deferred delivery so
+// that cancelling its window sends it right away
+func (s *NotificationService) trackDeferredDelivery(cause *MaintenanceError, request NotificationRequest, result *NotificationResult) {
+	member, err := queueMember(request, result)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	key := s.getMaintenanceDeferredKey(cause.WindowID)
+
+	pipe := s.redis.TxPipeline()
+	pipe.SAdd(ctx, key, member)
+	pipe.ExpireAt(ctx, key, cause.Until.Add(maintenanceRetention))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to track deferred delivery")
+	}
+}
+
+// releaseDeferredDeliveries moves the deliveries a window deferred to the
+// front of the queue. Deliveries no longer queued are left alone.
+func (s *NotificationService) releaseDeferredDeliveries(ctx context.Context, windowID string) (int, error) {
+	key := s.getMaintenanceDeferredKey(windowID)
+
+	members, err := s.redis.SMembers(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get deferred deliveries: %w", err)
+	}
+
+	now := float64(time.Now().Unix())
+	released := 0
+	for _, member := range members {
+		// Only the queue of the delivery's channel holds it
+		for _, queueKey := range s.getQueueKeys() {
+			updated, err := s.redis.ZAddXXCh(ctx, queueKey, &redis.Z{Score: now, Member: member}).Result()
+			if err != nil {
+				return released, fmt.Errorf("failed to release deferred delivery: %w", err)
+			}
+			released += int(updated)
+		}
+	}
+
+	s.redis.Del(ctx, key)
+
+	return released, nil
+}
+
+// auditMutedDelivery records a delivery held back by a maintenance window
+func (s *NotificationService) auditMutedDelivery(tenantID string, delivery MutedDelivery) {
+	deliveryJSON, err := json.Marshal(delivery)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	key := s.getMaintenanceAuditKey(tenantID)
+
+	pipe := s.redis.TxPipeline()
+	pipe.LPush(ctx, key, deliveryJSON)
+	pipe.LTrim(ctx, key, 0, maintenanceAuditLimit-1)
+	pipe.Expire(ctx, key, maintenanceRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", delivery.ResultID).Msg("Failed to audit muted delivery")
+	}
+}
+
+// Helper functions
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMaintenanceWindow validates a maintenance window
+func validateMaintenanceWindow(window MaintenanceWindow, now time.Time) error {
+	if window.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !window.End.After(window.Start) {
+		return fmt.Errorf("end must be after start")
+	}
+	if !window.End.After(now) {
+		return fmt.Errorf("end must be in the future")
+	}
+	if window.End.Sub(window.Start) > maxMaintenanceDuration {
+		return fmt.Errorf("window may last at most %s", maxMaintenanceDuration)
+	}
+
+	switch window.Action {
+	case MaintenanceActionSuppress, MaintenanceActionDefer:
+	default:
+		return fmt.Errorf("unsupported action: %s", window.Action)
+	}
+
+	for _, channel := range window.Channels {
+		if !maintenanceChannels[channel] {
+			return fmt.Errorf("unsupported channel: %s", channel)
+		}
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *NotificationService) getMaintenanceWindowKey(windowID string) string {
+	return fmt.Sprintf("maintenance_window:%s", windowID)
+}
+
+func (s *NotificationService) getMaintenanceWindowsKey(tenantID string) string {
+	if tenantID == "" {
+		return "maintenance_windows:global"
+	}
+	return fmt.Sprintf("maintenance_windows:%s", tenantID)
+}
+
+func (s *NotificationService) getMaintenanceDeferredKey(windowID string) string {
+	return fmt.Sprintf("maintenance_deferred:%s", windowID)
+}
+
+func (s *NotificationService) getMaintenanceAuditKey(tenantID string) string {
+	if tenantID == "" {
+		return "maintenance_audit:global"
+	}
+	return fmt.Sprintf("maintenance_audit:%s", tenantID)
+}
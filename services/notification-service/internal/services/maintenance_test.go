@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// deferToMaintenance opens a window deferring the emails of tenant-a until
+// end and sends one into it
+func deferToMaintenance(t *testing.T, env *integrationEnv, end time.Time) *NotificationResult {
+	t.Helper()
+
+	if _, err := env.service.CreateMaintenanceWindow(MaintenanceWindow{
+		TenantID: "tenant-a",
+		Name:     "Mail server migration",
+		Channels: []string{"email"},
+		Action:   MaintenanceActionDefer,
+		End:      end,
+	}); err != nil {
+		t.Fatalf("Failed to create maintenance window: %v", err)
+	}
+
+	result, err := env.service.SendNotification(context.Background(), NotificationRequest{
+		Type:       "email",
+		Recipients: []string{"ayse.yilmaz@talimat.test"},
+		Subject:    "Vardiya planı",
+		Message:    "Haftalık vardiya planı yayınlandı",
+		TenantID:   "tenant-a",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.Status != "pending" || result.NextRetryAt == nil {
+		t.Fatalf("Expected the email to be deferred, got %s", result.Status)
+	}
+	return result
+}
+
+func TestDeferredRequestsOutliveLongMaintenanceWindows(t *testing.T) {
+	env := newIntegrationEnv(t)
+	end := time.Now().Add(72 * time.Hour)
+
+	result := deferToMaintenance(t, env, end)
+
+	ttl := env.service.redis.TTL(context.Background(), env.service.getRequestKey(result.RequestID)).Val()
+	if ttl < time.Until(end) {
+		t.Errorf("Expected the request to be kept until the window ends in %v, expires in %v", time.Until(end), ttl)
+	}
+}
+
+func TestQueuedNotificationsFailWhenTheirRequestExpired(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	result := deferToMaintenance(t, env, time.Now().Add(time.Hour))
+	env.service.redis.Del(ctx, env.service.getRequestKey(result.RequestID))
+
+	// The deferred delivery falls due
+	queueKey := env.service.getChannelQueueKey("email")
+	member, _ := queueMember(NotificationRequest{ID: result.RequestID}, result)
+	env.service.redis.ZAdd(ctx, queueKey, &redis.Z{Score: float64(time.Now().Unix()), Member: member})
+	env.service.processQueuedNotifications(queueKey)
+
+	eventually(t, "the notification to fail", func() bool {
+		stored, err := env.service.GetNotificationStatus(ctx, result.ID)
+		return err == nil && stored.Status == "failed"
+	})
+}
+
+func TestMaintenanceWindowsAreValidated(t *testing.T) {
+	env := newIntegrationEnv(t)
+	now := time.Now()
+
+	for name, window := range map[string]MaintenanceWindow{
+		"no name":         {End: now.Add(time.Hour)},
+		"ends before":     {Name: "Migration", Start: now.Add(2 * time.Hour), End: now.Add(time.Hour)},
+		"already over":    {Name: "Migration", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)},
+		"too long":        {Name: "Migration", End: now.Add(8 * 24 * time.Hour)},
+		"unknown action":  {Name: "Migration", End: now.Add(time.Hour), Action: "drop"},
+		"unknown channel": {Name: "Migration", End: now.Add(time.Hour), Channels: []string{"fax"}},
+	} {
+		window.TenantID = "tenant-a"
+		if _, err := env.service.CreateMaintenanceWindow(window); !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: expected the window to be refused, got %v", name, err)
+		}
+	}
+
+	window, err := env.service.CreateMaintenanceWindow(MaintenanceWindow{TenantID: "tenant-a", Name: "Migration", End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to create maintenance window: %v", err)
+	}
+	if window.Action != MaintenanceActionDefer || window.Start.Before(now) || window.Start.After(time.Now()) {
+		t.Errorf("Expected windows to defer from now by default, got %s from %v", window.Action, window.Start)
+	}
+}
+
+func TestMaintenanceWindowsHoldBackWhatTheyCover(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	create := func(window MaintenanceWindow) *MaintenanceWindow {
+		window.Name = "Planned downtime"
+		if window.End.IsZero() {
+			window.End = now.Add(time.Hour)
+		}
+		created, err := env.service.CreateMaintenanceWindow(window)
+		if err != nil {
+			t.Fatalf("Failed to create maintenance window: %v", err)
+		}
+		return created
+	}
+
+	trainingEmails := create(MaintenanceWindow{TenantID: "tenant-a", Categories: []string{"training"}, Channels: []string{"email"}})
+	tenantB := create(MaintenanceWindow{TenantID: "tenant-b", Action: MaintenanceActionSuppress})
+	create(MaintenanceWindow{TenantID: "tenant-c", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+
+	// A window that ended is no longer looked at
+	ended := create(MaintenanceWindow{TenantID: "tenant-d"})
+	env.service.redis.ZAdd(ctx, env.service.getMaintenanceWindowsKey("tenant-d"), &redis.Z{Score: float64(now.Add(-time.Minute).Unix()), Member: ended.ID})
+
+	for name, test := range map[string]struct {
+		request  NotificationRequest
+		windowID string // empty when nothing holds the request back
+	}{
+		"covered":             {NotificationRequest{TenantID: "tenant-a", Type: "email", Category: "training"}, trainingEmails.ID},
+		"other category":      {NotificationRequest{TenantID: "tenant-a", Type: "email", Category: "safety"}, ""},
+		"other channel":       {NotificationRequest{TenantID: "tenant-a", Type: "sms", Category: "training"}, ""},
+		"urgent":              {NotificationRequest{TenantID: "tenant-a", Type: "email", Category: "training", Priority: "urgent"}, ""},
+		"whole tenant":        {NotificationRequest{TenantID: "tenant-b", Type: "push", Category: "safety", Priority: "high"}, tenantB.ID},
+		"urgent whole tenant": {NotificationRequest{TenantID: "tenant-b", Type: "push", Priority: "urgent"}, ""},
+		"not started yet":     {NotificationRequest{TenantID: "tenant-c", Type: "email"}, ""},
+		"ended":               {NotificationRequest{TenantID: "tenant-d", Type: "email"}, ""},
+		"other tenant":        {NotificationRequest{TenantID: "tenant-e", Type: "email", Category: "training"}, ""},
+	} {
+		cause := env.service.checkMaintenance(test.request)
+		switch {
+		case test.windowID == "" && cause != nil:
+			t.Errorf("%s: expected the request to go through, held back by %s", name, cause.WindowID)
+		case test.windowID != "" && (cause == nil || cause.WindowID != test.windowID):
+			t.Errorf("%s: expected the request to be held back by %s, got %v", name, test.windowID, cause)
+		}
+	}
+
+	active, err := env.service.ListMaintenanceWindows("tenant-c", true)
+	if err != nil || len(active) != 0 {
+		t.Errorf("Expected windows not started yet not to be active, got %d (%v)", len(active), err)
+	}
+	if all, err := env.service.ListMaintenanceWindows("tenant-c", false); err != nil || len(all) != 1 {
+		t.Errorf("Expected the scheduled window to be listed, got %d (%v)", len(all), err)
+	}
+}
+
+func TestSuppressedDeliveriesAreAudited(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	window, err := env.service.CreateMaintenanceWindow(MaintenanceWindow{
+		TenantID:   "tenant-a",
+		Name:       "Inventory count",
+		Categories: []string{"training"},
+		Action:     MaintenanceActionSuppress,
+		End:        time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create maintenance window: %v", err)
+	}
+
+	result, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:       "inapp",
+		Recipients: []string{"user-1"},
+		Title:      "Eğitim hatırlatması",
+		Message:    "Yarın yangın eğitimi var",
+		Category:   "training",
+		TenantID:   "tenant-a",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.Status != "suppressed" || result.Metadata["suppression_reason"] != "maintenance" || result.Metadata["maintenance_window_id"] != window.ID {
+		t.Errorf("Expected the notification to be suppressed by the window, got %s %v", result.Status, result.Metadata)
+	}
+	if notifications, _, _ := env.service.inAppService.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, nil); len(notifications) != 0 {
+		t.Errorf("Expected nothing to reach the inbox, got %d notifications", len(notifications))
+	}
+
+	audit, err := env.service.GetMutedDeliveries("tenant-a", window.ID, 1, 20)
+	if err != nil || len(audit) != 1 {
+		t.Fatalf("Expected the suppressed delivery to be audited, got %d (%v)", len(audit), err)
+	}
+	if audit[0].ResultID != result.ID || audit[0].Recipient != "user-1" || audit[0].Action != MaintenanceActionSuppress || audit[0].SendAt != nil {
+		t.Errorf("Expected the audit to describe the suppressed delivery, got %+v", audit[0])
+	}
+	if other, _ := env.service.GetMutedDeliveries("tenant-a", "maintenance_other", 1, 20); len(other) != 0 {
+		t.Errorf("Expected the audit to be filtered by window, got %d", len(other))
+	}
+}
+
+func TestCancelledWindowsReleaseTheirDeferredDeliveries(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	end := time.Now().Add(time.Hour)
+
+	result := deferToMaintenance(t, env, end)
+	if result.NextRetryAt.Before(end) {
+		t.Errorf("Expected the email to be sent after the window ends at %v, got %v", end, result.NextRetryAt)
+	}
+
+	windows, err := env.service.ListMaintenanceWindows("tenant-a", true)
+	if err != nil || len(windows) != 1 {
+		t.Fatalf("Expected the active window, got %d (%v)", len(windows), err)
+	}
+	audit, err := env.service.GetMutedDeliveries("tenant-a", windows[0].ID, 1, 20)
+	if err != nil || len(audit) != 1 || audit[0].Action != MaintenanceActionDefer || audit[0].SendAt == nil {
+		t.Fatalf("Expected the deferred delivery to be audited with its send time, got %v (%v)", audit, err)
+	}
+
+	if err := env.service.DeleteMaintenanceWindow(windows[0].ID); err != nil {
+		t.Fatalf("Failed to delete maintenance window: %v", err)
+	}
+	if _, err := env.service.GetMaintenanceWindow(windows[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the window to be gone, got %v", err)
+	}
+
+	queueKey := env.service.getChannelQueueKey("email")
+	env.service.processQueuedNotifications(queueKey)
+	eventually(t, "the released email to be sent", func() bool { return len(env.smtp.sent()) == 1 })
+	eventually(t, "the email to be reported sent", func() bool {
+		stored, err := env.service.GetNotificationStatus(ctx, result.ID)
+		return err == nil && stored.Status == "sent"
+	})
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// Kinds of notifications about an entity
+const (
+	MentionKindMention    = "mention"    // someone referred to the user on the entity
+	MentionKindAssignment = "assignment" // the entity was assigned to the user
+)
+
+// maxMentionRecipients bounds the users one mention notifies
+const maxMentionRecipients = 100
+
+// defaultEntityLinks are the deep links of the entities notifications can be
+// about when none are configured
+var defaultEntityLinks = map[string]string{
+	"document": "/documents/{id}",
+	"incident": "/incidents/{id}",
+	"task":     "/tasks/{id}",
+}
+
+// EntityRef points a notification at the entity it is about
+type EntityRef struct {
+	Type     string                 `json:"type"` // one of the configured entity types, like document, incident or task
+	ID       string                 `json:"id"`
+	Title    string                 `json:"title,omitempty"`
+	URL      string                 `json:"url,omitempty"` // overrides the link of the entity type
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// MentionRequest notifies users that they were mentioned on, or assigned,
+// an entity
+type MentionRequest struct {
+	TenantID  string    `json:"tenant_id"`
+	Kind      string    `json:"kind"` // mention or assignment, mention when empty
+	UserIDs   []string  `json:"user_ids"`
+	Entity    EntityRef `json:"entity"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	ActorName string    `json:"actor_name,omitempty"`
+	Message   string    `json:"message,omitempty"` // like an excerpt of the comment, a generic one when empty
+	Priority  string    `json:"priority,omitempty"`
+}
+
+// SendMention sends an in-app notification about an entity to each mentioned
+// user. Actors are not notified of their own mentions. The notifications go
+// through the usual delivery rules, so preferences, digests and maintenance
+// windows apply to them.
+func (s *NotificationService) SendMention(ctx context.Context, request MentionRequest) ([]*NotificationResult, error) {
+	log.Info().
+		Str("kind", request.Kind).
+		Str("entityType", request.Entity.Type).
+		Str("entityID", request.Entity.ID).
+		Int("userCount", len(request.UserIDs)).
+		Msg("Sending mention")
+
+	if request.Kind == "" {
+		request.Kind = MentionKindMention
+	}
+	if err := s.validateMention(request); err != nil {
+		return nil, invalid(fmt.Errorf("mention validation failed: %w", err))
+	}
+
+	actor := request.ActorName
+	if actor == "" {
+		actor = request.ActorID
+	}
+	entity := request.Entity.Title
+	if entity == "" {
+		entity = request.Entity.Type + " " + request.Entity.ID
+	}
+
+	var results []*NotificationResult
+	seen := make(map[string]bool, len(request.UserIDs))
+	for _, userID := range request.UserIDs {
+		if userID == request.ActorID || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		locale := s.messageLocale(request.TenantID, RecipientPrefixUser+userID)
+		titleKey := i18n.MentionTitle
+		if request.Kind == MentionKindAssignment {
+			titleKey = i18n.AssignmentTitle
+		}
+		message := request.Message
+		if message == "" {
+			message = i18n.T(locale, i18n.MentionMessage)
+		}
+
+		entityRef := request.Entity
+		result, err := s.SendNotification(ctx, NotificationRequest{
+			Type:       "inapp",
+			Recipients: []string{userID},
+			Title:      i18n.T(locale, titleKey, actor, entity),
+			Message:    message,
+			Priority:   request.Priority,
+			Category:   request.Kind,
+			TenantID:   request.TenantID,
+			UserID:     request.ActorID,
+			Entity:     &entityRef,
+			TemplateData: map[string]interface{}{
+				"actor_id":    request.ActorID,
+				"actor_name":  request.ActorName,
+				"entity_type": request.Entity.Type,
+				"entity_id":   request.Entity.ID,
+			},
+		})
+		if err != nil {
+			return results, fmt.Errorf("failed to notify %s: %w", userID, err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// validateMention validates a mention request
+func (s *NotificationService) validateMention(request MentionRequest) error {
+	if request.Kind != MentionKindMention && request.Kind != MentionKindAssignment {
+		return fmt.Errorf("invalid mention kind: %s", request.Kind)
+	}
+	if len(request.UserIDs) == 0 {
+		return fmt.Errorf("at least one user is required")
+	}
+	if len(request.UserIDs) > maxMentionRecipients {
+		return fmt.Errorf("at most %d users can be mentioned at once", maxMentionRecipients)
+	}
+	if request.ActorID == "" && request.ActorName == "" {
+		return fmt.Errorf("actor is required")
+	}
+	return s.inAppService.validateEntity(&request.Entity)
+}
+
+// validateEntity validates the entity a notification is about
+func (s *InAppNotificationService) validateEntity(entity *EntityRef) error {
+	if entity == nil {
+		return nil
+	}
+	if _, ok := s.config.EntityLinks[entity.Type]; !ok {
+		return fmt.Errorf("unknown entity type: %s", entity.Type)
+	}
+	if entity.ID == "" {
+		return fmt.Errorf("entity ID is required")
+	}
+	return nil
+}
+
+// entityLink returns the deep link of an entity
+func (s *InAppNotificationService) entityLink(entity *EntityRef) string {
+	if entity.URL != "" {
+		return entity.URL
+	}
+	return strings.ReplaceAll(s.config.EntityLinks[entity.Type], "{id}", url.PathEscape(entity.ID))
+}
+
+// GetEntityNotifications gets the notifications about an entity, newest
+// first, for an activity feed of the entity. With a user ID only the
+// notifications of that user are returned.
+func (s *InAppNotificationService) GetEntityNotifications(
+	ctx context.Context,
+	tenantID string,
+	entityType string,
+	entityID string,
+	userID string,
+	page int,
+	limit int,
+) ([]*InAppNotification, int, error) {
+	if userID != "" {
+		filters := map[string]interface{}{"entity": entityFacet(entityType, entityID)}
+		return s.GetUserNotifications(ctx, userID, tenantID, page, limit, filters)
+	}
+
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
+	entityKey := s.getEntityKey(tenantID, entityType, entityID)
+
+	total, err := s.redis.ZCard(ctx, entityKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get entity notification count: %w", err)
+	}
+
+	ids, err := s.redis.ZRevRange(ctx, entityKey, start, stop).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get entity notification IDs: %w", err)
+	}
+
+	var notifications []*InAppNotification
+	for _, id := range ids {
+		notification, err := s.GetNotification(ctx, id)
+		if err != nil {
+			log.Warn().Err(err).Str("notificationID", id).Msg("Failed to get notification")
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, int(total), nil
+}
+
+// indexEntity queues the commands adding a notification to the feed of the
+// entity it is about
+func (s *InAppNotificationService) indexEntity(ctx context.Context, pipe redis.Pipeliner, notification *InAppNotification) {
+	if notification.Entity == nil {
+		return
+	}
+
+	entityKey := s.getEntityKey(notification.TenantID, notification.Entity.Type, notification.Entity.ID)
+	pipe.ZAdd(ctx, entityKey, &redis.Z{
+		Score:  float64(notification.CreatedAt.Unix()),
+		Member: notification.ID,
+	})
+	s.expireIndex(ctx, pipe, entityKey)
+}
+
+// entityFacet is the value notifications about an entity are filtered by
+func entityFacet(entityType string, entityID string) string {
+	return entityType + ":" + entityID
+}
+
+// Redis key generators
+func (s *InAppNotificationService) getEntityKey(tenantID string, entityType string, entityID string) string {
+	return fmt.Sprintf("entity_notifications:%s:%s:%s", tenantID, entityType, entityID)
+}
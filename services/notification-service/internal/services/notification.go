@@ -2,15 +2,34 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+	"claude-talimat/pkg/lock"
+	"claude-talimat/pkg/redisclient"
+	"claude-talimat/pkg/runtimeconfig"
+	"claude-talimat/pkg/secrets"
 )
 
+// MaxStatusBatchSize is how many notifications a status batch may query
+const MaxStatusBatchSize = 1000
+
+// requestTTL is how long requests are kept once they are due
+const requestTTL = 24 * time.Hour
+
 // NotificationService handles all notification operations
 type NotificationService struct {
 	emailService    *EmailService
@@ -18,28 +37,76 @@ type NotificationService struct {
 	pushService     *PushNotificationService
 	inAppService    *InAppNotificationService
 	webhookService  *WebhookService
+	voiceService    *VoiceService
 	templateService *TemplateService
+	recipients      *RecipientResolver
+	callbackClient  *http.Client // refuses internal addresses, like webhook deliveries
+	breakers        map[string]*circuitBreaker
 	redis           *redis.Client
 	config          NotificationConfig
+	ackListeners    []AcknowledgmentListener
 	mu              sync.RWMutex
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	inFlight        map[string]string // queued member -> queue key, while being processed
+	inFlightMu      sync.Mutex
+	workers         map[string]int // workers started per channel queue, the ones beyond the worker count idle
+	workersMu       sync.Mutex
+	channelPools    map[string]*workerPool // bound the sends of each channel in flight
+	pii             *piiCipher
+	leader          *lock.Elector // elects the instance running the jobs that must not run twice
+	events          *redis.Client // Redis of the message queue events are published to, nil to not publish them
 }
 
 // NotificationConfig holds notification service configuration
 type NotificationConfig struct {
-	RedisURL       string
-	RedisPassword  string
-	RedisDB        int
-	EmailConfig    EmailConfig
-	SMSConfig      SMSConfig
-	PushConfig     PushConfig
-	InAppConfig    InAppConfig
-	WebhookConfig  WebhookConfig
-	TemplateConfig TemplateConfig
-	MaxRetries     int
-	RetryDelay     time.Duration
-	BatchSize      int
-	QueueSize      int
-	WorkerCount    int
+	RedisURL           string
+	RedisPassword      string
+	RedisDB            int
+	EmailConfig        EmailConfig
+	SMSConfig          SMSConfig
+	PushConfig         PushConfig
+	InAppConfig        InAppConfig
+	WebhookConfig      WebhookConfig
+	VoiceConfig        VoiceConfig
+	TemplateConfig     TemplateConfig
+	RecipientConfig    RecipientConfig
+	MaxRetries         int
+	RetryDelay         time.Duration  // Base delay of the exponential backoff
+	MaxRetryDelay      time.Duration  // Upper bound of a single backoff delay
+	RetryBudgets       map[string]int // Maximum attempts per channel, defaults to MaxRetries
+	BatchSize          int
+	QueueSize          int
+	WorkerCount        int
+	ChannelWorkers     map[string]int // Workers per channel queue, defaults to WorkerCount
+	ChannelMaxInFlight map[string]int // Sends per channel waiting on the provider at once
+	DigestInterval     time.Duration  // How often due digests are flushed
+	DigestMaxItems     int            // Maximum items rendered in a single digest
+	CollapseWindow     time.Duration  // How long duplicates sharing a collapse key are merged
+	CallbackSecret     string         // Secret used to sign status callbacks
+	CallbackTimeout    time.Duration
+	CallbackMaxRetries int
+	ProviderTimeout    time.Duration // How long a single delivery may wait on its provider
+	BreakerConfig      BreakerConfig
+	RetentionDays      int           // Default retention of results for tenants without a policy
+	RetentionInterval  time.Duration // How often the retention job runs
+	RetentionBatchSize int
+	CleanupInterval    time.Duration // How often index entries of expired records are removed
+	Archiver           Archiver      // Where results are archived before deletion, nil to only delete
+	SnoozeInterval     time.Duration // How often due snoozes are woken
+	AckBaseURL         string        // Public base URL acknowledgment links point to
+	AckTTL             time.Duration // How long acknowledgment tokens stay valid
+	AckSecret          string        // Secret acknowledgment tokens are derived with
+	AckSMSKeyword      string        // Keyword recipients reply with to acknowledge by SMS
+	DisabledChannels   []string      // Channels whose sends are rejected
+	PIIEncryptionKey   []byte        // 32-byte key personal data is encrypted at rest with, nil to store it in plaintext
+	LeaderLease        time.Duration // How long a leader instance keeps leading without renewing
+	OutboxConfig       OutboxConfig
+	OTPConfig          OTPConfig
+	// Runtime holds the tunables operators change without a redeploy, nil
+	// keeps the values above
+	Runtime *runtimeconfig.Store
 }
 
 // NotificationRequest represents a notification request
@@ -58,25 +125,55 @@ type NotificationRequest struct {
 	Category     string                 `json:"category"`
 	TenantID     string                 `json:"tenant_id"`
 	UserID       string                 `json:"user_id"`
+	Timezone     string                 `json:"timezone,omitempty"` // of the recipient, delivery windows are read in it
 	Metadata     map[string]interface{} `json:"metadata"`
+	Digestible   bool                   `json:"digestible"`
+	CollapseKey  string                 `json:"collapse_key,omitempty"`
+	ThreadKey    string                 `json:"thread_key,omitempty"` // email and in-app, messages sharing it are shown as one thread
+	CallbackURL  string                 `json:"callback_url,omitempty"`
+	Actions      []NotificationAction   `json:"actions,omitempty"` // in-app only
+	Entity       *EntityRef             `json:"entity,omitempty"`  // in-app only, the notification links to it
+	RequireAck   bool                   `json:"require_ack,omitempty"`
+	DocumentID   string                 `json:"document_id,omitempty"` // document acknowledgments are reported for
+	Attachments  []EmailAttachment      `json:"attachments,omitempty"` // email only, fetched when sent when given by reference
+	Calendar     *CalendarEvent         `json:"calendar,omitempty"`    // email only, attached as an ICS invite
+	Push         *PushOptions           `json:"push,omitempty"`        // images, deep links and localizations of pushes
 	ScheduleAt   *time.Time             `json:"schedule_at,omitempty"`
 	ExpiresAt    *time.Time             `json:"expires_at,omitempty"`
 	CreatedAt    time.Time              `json:"created_at"`
+
+	// Content per locale, each recipient gets the one of their language
+	Localizations map[string]LocalizedContent `json:"localizations,omitempty"`
+	// Files travelling with in-app notifications, like safety procedure PDFs
+	InAppAttachments []InAppAttachment `json:"inapp_attachments,omitempty"`
 }
 
 // NotificationResult represents the result of sending a notification
 type NotificationResult struct {
-	ID          string                 `json:"id"`
-	RequestID   string                 `json:"request_id"`
-	Type        string                 `json:"type"`
-	Recipient   string                 `json:"recipient"`
-	Status      string                 `json:"status"` // pending, sent, failed, cancelled
-	MessageID   string                 `json:"message_id,omitempty"`
-	Error       string                 `json:"error,omitempty"`
-	SentAt      *time.Time             `json:"sent_at,omitempty"`
-	Attempts    int                    `json:"attempts"`
-	MaxAttempts int                    `json:"max_attempts"`
-	Metadata    map[string]interface{} `json:"metadata"`
+	ID             string                 `json:"id"`
+	RequestID      string                 `json:"request_id"`
+	Type           string                 `json:"type"`
+	Recipient      string                 `json:"recipient"`
+	Status         string                 `json:"status"` // pending, sent, failed, cancelled
+	MessageID      string                 `json:"message_id,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	ErrorClass     string                 `json:"error_class,omitempty"` // validation, timeout, provider, internal
+	SentAt         *time.Time             `json:"sent_at,omitempty"`
+	Attempts       int                    `json:"attempts"`
+	MaxAttempts    int                    `json:"max_attempts"`
+	Metadata       map[string]interface{} `json:"metadata"`
+	CallbackURL    string                 `json:"callback_url,omitempty"`
+	TenantID       string                 `json:"tenant_id,omitempty"`
+	Category       string                 `json:"category,omitempty"`
+	Priority       string                 `json:"priority,omitempty"`
+	Summary        bool                   `json:"summary,omitempty"`   // aggregates the deliveries of a fanned-out request
+	Simulated      bool                   `json:"simulated,omitempty"` // dry run or sandbox, nothing was sent
+	NextRetryAt    *time.Time             `json:"next_retry_at,omitempty"`
+	AcknowledgedAt *time.Time             `json:"acknowledged_at,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+
+	// searchText is the content the result is indexed by when first stored
+	searchText string
 }
 
 // NotificationStats represents notification statistics
@@ -91,39 +188,49 @@ type NotificationStats struct {
 	ByDate      map[string]int `json:"by_date"`
 	SuccessRate float64        `json:"success_rate"`
 	AverageTime float64        `json:"average_time"`
+	// Suppressed deliveries by the reason their recipient was suppressed,
+	// and the bounces and complaints reported by email providers
+	Suppressed          int            `json:"suppressed"`
+	BySuppressionReason map[string]int `json:"by_suppression_reason"`
+	ByFeedback          map[string]int `json:"by_feedback"`
+	// Deliveries by the locale they were written in, for sends with content
+	// per locale or templates with locale variants
+	ByLocale map[string]*LocaleStats `json:"by_locale"`
+}
+
+// LocaleStats counts the deliveries written in one locale by status
+type LocaleStats struct {
+	Total   int `json:"total"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Pending int `json:"pending"`
 }
 
 // NewNotificationService creates a new notification service instance
 func NewNotificationService(config NotificationConfig) (*NotificationService, error) {
-	// Parse Redis URL
-	redisOpts, err := redis.ParseURL(config.RedisURL)
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		return nil, err
 	}
 
-	// Override with config values
-	if config.RedisPassword != "" {
-		redisOpts.Password = config.RedisPassword
-	}
-	if config.RedisDB != 0 {
-		redisOpts.DB = config.RedisDB
-	}
-
-	// Create Redis client
-	redisClient := redis.NewClient(redisOpts)
-
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	if config.SMSConfig.Runtime == nil {
+		config.SMSConfig.Runtime = config.Runtime
 	}
 
 	// Initialize sub-services
-	emailService := NewEmailService(config.EmailConfig)
+	emailService, err := NewEmailService(config.EmailConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create email service: %w", err)
+	}
 
-	smsService := NewSMSService(config.SMSConfig)
+	smsService, err := NewSMSService(config.SMSConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SMS service: %w", err)
+	}
 
 	pushService, err := NewPushNotificationService(config.PushConfig)
 	if err != nil {
@@ -135,6 +242,18 @@ func NewNotificationService(config NotificationConfig) (*NotificationService, er
 		return nil, fmt.Errorf("failed to create in-app service: %w", err)
 	}
 
+	pii, err := newPIICipher(config.PIIEncryptionKey, redisClient)
+	if err != nil {
+		return nil, err
+	}
+	pushService.pii = pii
+	inAppService.pii = pii
+
+	voiceService, err := NewVoiceService(config.VoiceConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create voice service: %w", err)
+	}
+
 	webhookService, err := NewWebhookService(config.WebhookConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create webhook service: %w", err)
@@ -145,6 +264,11 @@ func NewNotificationService(config NotificationConfig) (*NotificationService, er
 		return nil, fmt.Errorf("failed to create template service: %w", err)
 	}
 
+	recipientResolver, err := NewRecipientResolver(config.RecipientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recipient resolver: %w", err)
+	}
+
 	// Set default values
 	if config.MaxRetries == 0 {
 		config.MaxRetries = 3
@@ -152,6 +276,9 @@ func NewNotificationService(config NotificationConfig) (*NotificationService, er
 	if config.RetryDelay == 0 {
 		config.RetryDelay = 5 * time.Second
 	}
+	if config.MaxRetryDelay == 0 {
+		config.MaxRetryDelay = 1 * time.Hour
+	}
 	if config.BatchSize == 0 {
 		config.BatchSize = 100
 	}
@@ -161,6 +288,98 @@ func NewNotificationService(config NotificationConfig) (*NotificationService, er
 	if config.WorkerCount == 0 {
 		config.WorkerCount = 5
 	}
+	if config.DigestInterval == 0 {
+		config.DigestInterval = 1 * time.Minute
+	}
+	if config.DigestMaxItems == 0 {
+		config.DigestMaxItems = 50
+	}
+	if config.CollapseWindow == 0 {
+		config.CollapseWindow = 10 * time.Minute
+	}
+	if config.CallbackTimeout == 0 {
+		config.CallbackTimeout = 10 * time.Second
+	}
+	if config.CallbackMaxRetries == 0 {
+		config.CallbackMaxRetries = 5
+	}
+	if config.ProviderTimeout == 0 {
+		config.ProviderTimeout = 30 * time.Second
+	}
+	if config.BreakerConfig.Window == 0 {
+		config.BreakerConfig.Window = 1 * time.Minute
+	}
+	if config.BreakerConfig.MinRequests == 0 {
+		config.BreakerConfig.MinRequests = 10
+	}
+	if config.BreakerConfig.FailureRate == 0 {
+		config.BreakerConfig.FailureRate = 0.5
+	}
+	if config.BreakerConfig.OpenDuration == 0 {
+		config.BreakerConfig.OpenDuration = 30 * time.Second
+	}
+	if config.BreakerConfig.HalfOpenProbes == 0 {
+		config.BreakerConfig.HalfOpenProbes = 1
+	}
+	if config.RetentionDays == 0 {
+		config.RetentionDays = 90
+	}
+	if config.RetentionInterval == 0 {
+		config.RetentionInterval = 1 * time.Hour
+	}
+	if config.RetentionBatchSize == 0 {
+		config.RetentionBatchSize = 500
+	}
+	if config.CleanupInterval == 0 {
+		config.CleanupInterval = 1 * time.Hour
+	}
+	if config.SnoozeInterval == 0 {
+		config.SnoozeInterval = 30 * time.Second
+	}
+	if config.AckTTL == 0 {
+		config.AckTTL = 30 * 24 * time.Hour
+	}
+	if config.AckSecret == "" {
+		// Without a configured secret tokens only verify on this instance
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate acknowledgment secret: %w", err)
+		}
+		config.AckSecret = hex.EncodeToString(secret)
+		log.Warn().Msg("ACK_SECRET is not set, acknowledgment links will not survive a restart")
+	}
+	if config.AckSMSKeyword == "" {
+		config.AckSMSKeyword = "ONAY"
+	}
+	if config.LeaderLease == 0 {
+		config.LeaderLease = 15 * time.Second
+	}
+	if config.OTPConfig.Length == 0 {
+		config.OTPConfig.Length = 6
+	}
+	if config.OTPConfig.TTL == 0 {
+		config.OTPConfig.TTL = 5 * time.Minute
+	}
+	if config.OTPConfig.MaxAttempts == 0 {
+		config.OTPConfig.MaxAttempts = 5
+	}
+	if config.OTPConfig.RateWindow == 0 {
+		config.OTPConfig.RateWindow = time.Hour
+	}
+	if config.OTPConfig.Secret == "" {
+		config.OTPConfig.Secret = config.AckSecret
+	}
+	if config.OutboxConfig.MaxLength == 0 {
+		config.OutboxConfig.MaxLength = 100000
+	}
+	if config.OutboxConfig.RetryAfter == 0 {
+		config.OutboxConfig.RetryAfter = 30 * time.Second
+	}
+
+	events, err := newOutboxPublisher(config.OutboxConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	service := &NotificationService{
 		emailService:    emailService,
@@ -168,19 +387,108 @@ func NewNotificationService(config NotificationConfig) (*NotificationService, er
 		pushService:     pushService,
 		inAppService:    inAppService,
 		webhookService:  webhookService,
+		voiceService:    voiceService,
 		templateService: templateService,
+		recipients:      recipientResolver,
+		callbackClient:  newWebhookClient(newWebhookTransport(config.WebhookConfig.AllowPrivateNetworks), config.CallbackTimeout),
+		breakers:        make(map[string]*circuitBreaker),
 		redis:           redisClient,
 		config:          config,
+		inFlight:        make(map[string]string),
+		workers:         make(map[string]int),
+		channelPools:    make(map[string]*workerPool),
+		pii:             pii,
+		leader:          lock.NewElector(redisClient, "notification-service", config.LeaderLease),
+		events:          events,
+	}
+	service.ctx, service.cancel = context.WithCancel(context.Background())
+	for _, channel := range queueChannels {
+		service.channelPools[channel] = newWorkerPool("channel_"+channel, service.channelMaxInFlight(channel))
 	}
 
-	// Start background workers
-	go service.startWorkers()
+	if err := service.createOutboxGroups(); err != nil {
+		service.leader.Close()
+		return nil, err
+	}
+
+	// Action responses reach subscribers through webhooks and callbacks
+	inAppService.OnAction(service.publishActionResponse)
+	inAppService.OnAction(service.acknowledgeAction)
+
+	// Reads of in-app notifications show up on the timeline of their delivery
+	inAppService.OnRead(service.markResultOpened)
+
+	// Owners hear about endpoints disabled for failing
+	webhookService.OnEndpointDisabled(service.notifyEndpointDisabled)
+
+	// Subscribers hear about deliveries given up on
+	webhookService.OnDeliveryFailed(service.publishWebhookFailure)
+
+	// Webhook notifications are subscribed to by their category
+	webhookService.AddEventTypes(service.categoryEventTypes)
+
+	// Start background workers, as many as the runtime configuration asks for
+	service.resizeWorkers()
+	config.Runtime.OnChange(service.resizeWorkers)
+	service.goBackground(service.startDigestFlusher)
+	service.goBackground(service.startCallbackWorker)
+	service.goBackground(service.startRetentionJob)
+	service.goBackground(service.startStorageJob)
+	service.goBackground(service.startSnoozeWorker)
+	service.goBackground(service.startWebhookRetryWorker)
+	service.goBackground(service.startOutboxRelay)
 
 	return service, nil
 }
 
+// IsLeader reports whether this instance runs the jobs only one instance may
+// run at a time
+func (s *NotificationService) IsLeader() bool {
+	return s.leader.IsLeader()
+}
+
+// Templates returns the template service notifications are rendered with
+func (s *NotificationService) Templates() *TemplateService {
+	return s.templateService
+}
+
+// Voice returns the voice service calls are placed with
+func (s *NotificationService) Voice() *VoiceService {
+	return s.voiceService
+}
+
+// Webhooks returns the webhook service events are delivered with
+func (s *NotificationService) Webhooks() *WebhookService {
+	return s.webhookService
+}
+
+// SMS returns the SMS service messages are sent with
+func (s *NotificationService) SMS() *SMSService {
+	return s.smsService
+}
+
+// Push returns the push service devices are registered with
+func (s *NotificationService) Push() *PushNotificationService {
+	return s.pushService
+}
+
+// InApp returns the in-app service notifications are stored with
+func (s *NotificationService) InApp() *InAppNotificationService {
+	return s.inAppService
+}
+
+// channelDisabled reports whether sends on a channel are turned off
+func (s *NotificationService) channelDisabled(channel string) bool {
+	for _, disabled := range s.config.DisabledChannels {
+		if disabled == channel {
+			return true
+		}
+	}
+	return false
+}
+
 // SendNotification sends a single notification
-func (s *NotificationService) SendNotification(request NotificationRequest) (*NotificationResult, error) {
+func (s *NotificationService) SendNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
 	log.Info().
 		Str("requestID", request.ID).
 		Str("type", request.Type).
@@ -189,7 +497,11 @@ func (s *NotificationService) SendNotification(request NotificationRequest) (*No
 
 	// Validate request
 	if err := s.validateRequest(request); err != nil {
-		return nil, fmt.Errorf("request validation failed: %w", err)
+		return nil, invalid(fmt.Errorf("request validation failed: %w", err))
+	}
+	category, err := s.registeredCategory(ctx, request.TenantID, request.Category)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set default values
@@ -199,43 +511,59 @@ func (s *NotificationService) SendNotification(request NotificationRequest) (*No
 	if request.CreatedAt.IsZero() {
 		request.CreatedAt = time.Now()
 	}
+	if request.Priority == "" && category != nil {
+		request.Priority = category.DefaultPriority
+	}
 	if request.Priority == "" {
 		request.Priority = "normal"
 	}
+	if request.Calendar != nil {
+		if err := s.prepareCalendarEvent(&request); err != nil {
+			return nil, err
+		}
+	}
+
+	// The tenant's settings fill in the default template and expiry
+	settings := s.tenantSettings(ctx, request.TenantID)
+	if err := s.applySettings(&request, settings); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkRateLimits(ctx, settings); err != nil {
+		return nil, err
+	}
 
 	// Store request
 	if err := s.storeRequest(request); err != nil {
 		return nil, fmt.Errorf("failed to store request: %w", err)
 	}
 
-	// Process notification based on type
-	switch request.Type {
-	case "email":
-		return s.sendEmailNotification(request)
-	case "sms":
-		return s.sendSMSNotification(request)
-	case "push":
-		return s.sendPushNotification(request)
-	case "inapp":
-		return s.sendInAppNotification(request)
-	case "webhook":
-		return s.sendWebhookNotification(request)
-	case "all":
-		return s.sendAllNotifications(request)
-	default:
-		return nil, fmt.Errorf("unsupported notification type: %s", request.Type)
+	// Merge duplicates of a recent notification sharing the same collapse key.
+	// The window opens once the request is stored and closes again when it
+	// isn't delivered, so duplicates are never merged into nothing.
+	if result, collapsed := s.collapseDuplicate(ctx, request); collapsed {
+		return result, nil
+	}
+
+	result, err := s.deliver(ctx, request)
+	if err != nil || result == nil {
+		s.forgetCollapse(request)
+		return result, err
 	}
+	s.rememberCollapse(ctx, request, result)
+
+	return result, nil
 }
 
 // SendBulkNotifications sends notifications to multiple recipients
-func (s *NotificationService) SendBulkNotifications(requests []NotificationRequest) ([]*NotificationResult, error) {
+func (s *NotificationService) SendBulkNotifications(ctx context.Context, requests []NotificationRequest) ([]*NotificationResult, error) {
 	log.Info().Int("count", len(requests)).Msg("Sending bulk notifications")
 
 	var results []*NotificationResult
 	var errors []error
 
 	// Process requests in batches
-	batchSize := s.config.BatchSize
+	batchSize := s.batchSize()
 	for i := 0; i < len(requests); i += batchSize {
 		end := i + batchSize
 		if end > len(requests) {
@@ -243,7 +571,7 @@ func (s *NotificationService) SendBulkNotifications(requests []NotificationReque
 		}
 
 		batch := requests[i:end]
-		batchResults, err := s.processBatch(batch)
+		batchResults, err := s.processBatch(ctx, batch)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("batch %d failed: %w", i/batchSize, err))
 		}
@@ -261,6 +589,7 @@ func (s *NotificationService) SendBulkNotifications(requests []NotificationReque
 
 // SendTemplateNotification sends a notification using a template
 func (s *NotificationService) SendTemplateNotification(
+	ctx context.Context,
 	templateID string,
 	recipients []string,
 	data map[string]interface{},
@@ -272,26 +601,47 @@ func (s *NotificationService) SendTemplateNotification(
 		Int("recipientCount", len(recipients)).
 		Msg("Sending template notification")
 
-	// Get template
-	template, err := s.templateService.GetTemplate(templateID)
+	requested, err := s.templateService.GetTemplate(templateID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get template: %w", err)
 	}
 
-	// Render template
-	renderResult, err := s.templateService.RenderTemplate(templateID, data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to render template: %w", err)
+	// Each variant is rendered once, for the users whose locale it is in
+	type renderedVariant struct {
+		template *NotificationTemplate
+		result   *TemplateRenderResult
 	}
+	rendered := make(map[string]renderedVariant)
 
 	// Create notification requests
 	var requests []NotificationRequest
 	for _, recipient := range recipients {
+		variant := s.templateService.LocalizedVariant(requested, s.recipientLocale(requested.TenantID, recipient))
+
+		current, ok := rendered[variant.ID]
+		if !ok {
+			// Get the published version, the one rendered below
+			template, err := s.templateService.GetPublishedTemplate(variant.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get template: %w", err)
+			}
+
+			// Render template
+			renderResult, err := s.templateService.RenderTemplate(variant.ID, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render template: %w", err)
+			}
+
+			current = renderedVariant{template: template, result: renderResult}
+			rendered[variant.ID] = current
+		}
+		template, renderResult := current.template, current.result
+
 		request := NotificationRequest{
 			ID:           generateNotificationID(),
 			Type:         notificationType,
 			Recipients:   []string{recipient},
-			TemplateID:   templateID,
+			TemplateID:   variant.ID,
 			TemplateData: data,
 			Subject:      renderResult.Subject,
 			Title:        renderResult.Title,
@@ -300,34 +650,73 @@ func (s *NotificationService) SendTemplateNotification(
 			TextBody:     renderResult.TextBody,
 			Priority:     template.Priority,
 			Category:     template.Category,
+			Metadata:     map[string]interface{}{"template_version": renderResult.Version},
 			CreatedAt:    time.Now(),
 		}
 		requests = append(requests, request)
 	}
 
 	// Send notifications
-	return s.SendBulkNotifications(requests)
+	return s.SendBulkNotifications(ctx, requests)
 }
 
 // GetNotificationStatus gets the status of a notification
-func (s *NotificationService) GetNotificationStatus(notificationID string) (*NotificationResult, error) {
-	ctx := context.Background()
+func (s *NotificationService) GetNotificationStatus(ctx context.Context, notificationID string) (*NotificationResult, error) {
 	key := s.getResultKey(notificationID)
 
 	resultJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("notification not found: %s", notificationID)
+			return nil, notFoundf("notification not found: %s", notificationID)
 		}
 		return nil, fmt.Errorf("failed to get notification: %w", err)
 	}
 
-	var result NotificationResult
-	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+	result, err := s.pii.unmarshalResult(resultJSON)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
 	}
 
-	return &result, nil
+	return result, nil
+}
+
+// GetNotificationStatuses gets the status of many notifications in one round
+// trip. The results are in the order of the IDs, nil for unknown ones.
+func (s *NotificationService) GetNotificationStatuses(ctx context.Context, notificationIDs []string) ([]*NotificationResult, error) {
+	if len(notificationIDs) > MaxStatusBatchSize {
+		return nil, invalid(fmt.Errorf("at most %d notification IDs can be queried at once", MaxStatusBatchSize))
+	}
+
+	results := make([]*NotificationResult, len(notificationIDs))
+	if len(notificationIDs) == 0 {
+		return results, nil
+	}
+
+	keys := make([]string, len(notificationIDs))
+	for i, id := range notificationIDs {
+		keys[i] = s.getResultKey(id)
+	}
+
+	values, err := s.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+
+	for i, value := range values {
+		resultJSON, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		result, err := s.pii.unmarshalResult(resultJSON)
+		if err != nil {
+			log.Warn().Err(err).Str("resultID", notificationIDs[i]).Msg("Failed to unmarshal result")
+			continue
+		}
+		results[i] = result
+	}
+
+	return results, nil
 }
 
 // GetNotificationStats gets notification statistics
@@ -355,26 +744,27 @@ func (s *NotificationService) GetNotificationStats(tenantID string, days int) (*
 		return nil, fmt.Errorf("failed to calculate stats: %w", err)
 	}
 
-	// Cache stats for 1 hour
-	statsJSON, _ := json.Marshal(stats)
-	s.redis.Set(ctx, statsKey, string(statsJSON), 1*time.Hour)
+	// Cache stats briefly, the rollups behind them are cheap to read
+	if encoded, err := json.Marshal(stats); err == nil {
+		s.redis.Set(ctx, statsKey, string(encoded), 1*time.Minute)
+	}
 
 	return stats, nil
 }
 
 // CancelNotification cancels a pending notification
-func (s *NotificationService) CancelNotification(notificationID string) error {
+func (s *NotificationService) CancelNotification(ctx context.Context, notificationID string) error {
 	log.Info().
 		Str("notificationID", notificationID).
 		Msg("Cancelling notification")
 
-	result, err := s.GetNotificationStatus(notificationID)
+	result, err := s.GetNotificationStatus(ctx, notificationID)
 	if err != nil {
 		return fmt.Errorf("failed to get notification: %w", err)
 	}
 
 	if result.Status != "pending" {
-		return fmt.Errorf("cannot cancel notification with status: %s", result.Status)
+		return conflictf("cannot cancel notification with status: %s", result.Status)
 	}
 
 	// Update status
@@ -382,10 +772,9 @@ func (s *NotificationService) CancelNotification(notificationID string) error {
 	result.Metadata["cancelled_at"] = time.Now()
 
 	// Store updated result
-	ctx := context.Background()
 	key := s.getResultKey(notificationID)
 
-	resultJSON, err := json.Marshal(result)
+	resultJSON, err := s.pii.marshalResult(*result)
 	if err != nil {
 		return fmt.Errorf("failed to marshal result: %w", err)
 	}
@@ -394,6 +783,8 @@ func (s *NotificationService) CancelNotification(notificationID string) error {
 		return fmt.Errorf("failed to update result: %w", err)
 	}
 
+	s.notifyStatus(*result)
+
 	log.Info().
 		Str("notificationID", notificationID).
 		Msg("Notification cancelled")
@@ -402,18 +793,18 @@ func (s *NotificationService) CancelNotification(notificationID string) error {
 }
 
 // RetryFailedNotification retries a failed notification
-func (s *NotificationService) RetryFailedNotification(notificationID string) error {
+func (s *NotificationService) RetryFailedNotification(ctx context.Context, notificationID string) error {
 	log.Info().
 		Str("notificationID", notificationID).
 		Msg("Retrying failed notification")
 
-	result, err := s.GetNotificationStatus(notificationID)
+	result, err := s.GetNotificationStatus(ctx, notificationID)
 	if err != nil {
 		return fmt.Errorf("failed to get notification: %w", err)
 	}
 
 	if result.Status != "failed" {
-		return fmt.Errorf("cannot retry notification with status: %s", result.Status)
+		return conflictf("cannot retry notification with status: %s", result.Status)
 	}
 
 	if result.Attempts >= result.MaxAttempts {
@@ -433,10 +824,9 @@ func (s *NotificationService) RetryFailedNotification(notificationID string) err
 	result.SentAt = nil
 
 	// Store updated result
-	ctx := context.Background()
 	key := s.getResultKey(notificationID)
 
-	resultJSON, err := json.Marshal(result)
+	resultJSON, err := s.pii.marshalResult(*result)
 	if err != nil {
 		return fmt.Errorf("failed to marshal result: %w", err)
 	}
@@ -444,9 +834,10 @@ func (s *NotificationService) RetryFailedNotification(notificationID string) err
 	if err := s.redis.Set(ctx, key, resultJSON, 0).Err(); err != nil {
 		return fmt.Errorf("failed to update result: %w", err)
 	}
+	s.recordTimelineEvent(result.ID, TimelineEvent{Type: TimelineEventQueued, At: time.Now(), Status: result.Status})
 
 	// Re-queue for processing
-	if err := s.queueNotification(request, result); err != nil {
+	if err := s.queueNotification(*request, result, time.Now()); err != nil {
 		return fmt.Errorf("failed to re-queue notification: %w", err)
 	}
 
@@ -498,54 +889,375 @@ func (s *NotificationService) TestConnection() error {
 	return nil
 }
 
+// deliver sends a stored request to its recipients and records the result
+func (s *NotificationService) deliver(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
+	// Expand user, group and role references into individual deliveries,
+	// and requests for all channels into one delivery per channel
+	if hasRecipientReferences(request.Recipients) || request.Type == "all" {
+		return s.sendToResolvedRecipients(ctx, request)
+	}
+
+	// In-app recipients are user IDs, so their digest preferences apply directly
+	if request.Type == "inapp" && len(request.Recipients) == 1 {
+		if result, held := s.digestDelivery(ctx, request, request.Recipients[0], request.Recipients); held {
+			s.storeResult(*result)
+			return result, nil
+		}
+	}
+
+	result, err := s.dispatchNotification(ctx, request)
+
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return s.deferDelivery(request, nil, circuitErr)
+	}
+
+	var maintenanceErr *MaintenanceError
+	if errors.As(err, &maintenanceErr) {
+		return s.holdForMaintenance(request, nil, maintenanceErr)
+	}
+
+	var windowErr *DeliveryWindowError
+	if errors.As(err, &windowErr) {
+		return s.holdForDeliveryWindow(request, nil, windowErr)
+	}
+
+	if result != nil {
+		if err != nil {
+			result.ErrorClass = classifyFailure(err)
+		}
+		s.finishDelivery(request, result)
+	}
+
+	return result, err
+}
+
+// dispatchNotification sends a notification through the channel of its type,
+// short-circuiting when the provider's circuit breaker is open
+func (s *NotificationService) dispatchNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
+	// Disabled channels have no provider configured to send with
+	if s.channelDisabled(request.Type) {
+		return nil, invalid(fmt.Errorf("%s notifications are disabled", request.Type))
+	}
+
+	// Paused channels hold their sends back like a tripped provider
+	if s.channelPaused(request.Type) {
+		return nil, &CircuitOpenError{Provider: request.Type, RetryAt: time.Now().Add(pausedRetryDelay), Paused: true}
+	}
+
+	// Planned maintenance holds back everything but urgent notifications
+	if maintenanceErr := s.checkMaintenance(request); maintenanceErr != nil {
+		return nil, maintenanceErr
+	}
+
+	// Non-urgent sends wait for the delivery window of the recipient's day
+	if windowErr := s.checkDeliveryWindow(ctx, request); windowErr != nil {
+		return nil, windowErr
+	}
+
+	// Each recipient reads the notification in their language
+	if err := s.localizeContent(&request); err != nil {
+		return nil, err
+	}
+
+	// Sandbox tenants never reach providers
+	sandbox := s.IsSandboxTenant(request.TenantID)
+
+	// Sends of a channel in flight are bounded, so a slow provider doesn't
+	// take the workers of the others. Waiting for a turn counts against the
+	// request, not against the provider timeout.
+	if pool := s.channelPool(request.Type); pool != nil && !sandbox {
+		done, err := pool.Hold(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("no %s send became free in time: %w", request.Type, err)
+		}
+		defer done()
+	}
+
+	breaker := s.breakerFor(request.Type)
+	if breaker != nil && !sandbox {
+		if retryAt, ok := breaker.allow(time.Now()); !ok {
+			return nil, &CircuitOpenError{Provider: breaker.provider, RetryAt: retryAt}
+		}
+	}
+
+	if request.RequireAck && len(request.Recipients) > 0 {
+		if err := s.prepareAcknowledgment(&request); err != nil {
+			return nil, err
+		}
+	}
+
+	if sandbox {
+		return s.simulateDelivery(request)
+	}
+
+	// A slow provider holds the delivery for at most the provider timeout
+	ctx, cancel := context.WithTimeout(ctx, s.config.ProviderTimeout)
+	defer cancel()
+
+	var result *NotificationResult
+	var err error
+
+	switch request.Type {
+	case "email":
+		result, err = s.sendEmailNotification(ctx, request)
+	case "sms":
+		result, err = s.sendSMSNotification(ctx, request)
+	case "push":
+		result, err = s.sendPushNotification(ctx, request)
+	case "inapp":
+		result, err = s.sendInAppNotification(ctx, request)
+	case "webhook":
+		result, err = s.sendWebhookNotification(ctx, request)
+	case "voice":
+		result, err = s.sendVoiceNotification(ctx, request)
+	case "all":
+		result, err = s.sendAllNotifications(ctx, request)
+	default:
+		return nil, fmt.Errorf("unsupported notification type: %s", request.Type)
+	}
+
+	// Requests rejected before reaching the provider say nothing about its health
+	if breaker != nil && result != nil {
+		s.recordProviderOutcome(breaker, err)
+		if err != nil {
+			err = &ProviderError{Provider: breaker.provider, Err: err}
+		}
+	}
+
+	return result, err
+}
+
+// sendToResolvedRecipients resolves recipient references and sends one delivery per recipient
+func (s *NotificationService) sendToResolvedRecipients(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
+	resolved, err := s.recipients.ResolveRecipients(request.TenantID, request.Type, request.Recipients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve recipients: %w", err)
+	}
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("no deliverable recipients")
+	}
+
+	log.Info().
+		Str("requestID", request.ID).
+		Int("deliveryCount", len(resolved)).
+		Msg("Recipients resolved")
+
+	var deliveryIDs []string
+	sent, failed, digested, deferred, muted := 0, 0, 0, 0, 0
+
+	for i, recipient := range resolved {
+		// Deliveries go out on the channel their addresses are for, each
+		// one of its own when the request was for all channels
+		channel := request.Type
+		if recipient.Channel != "" {
+			channel = recipient.Channel
+		}
+
+		// Verified contact points of the user take over from the directory
+		if recipient.UserID != "" {
+			if addresses := s.contactPointAddresses(request.TenantID, recipient.UserID, channel, request.Category); len(addresses) > 0 {
+				recipient.Addresses = addresses
+			}
+		}
+
+		// Each delivery gets its own request so it can be retried on its own
+		delivery := request
+		delivery.ID = fmt.Sprintf("%s_%d", request.ID, i+1)
+		delivery.Type = channel
+		delivery.Recipients = recipient.Addresses
+		delivery.Metadata = copyMetadata(request.Metadata)
+		delivery.Metadata["parent_request_id"] = request.ID
+		if recipient.UserID != "" {
+			delivery.Metadata["recipient_user_id"] = recipient.UserID
+		}
+		if delivery.Timezone == "" && recipient.Contact != nil {
+			delivery.Timezone = recipient.Contact.Timezone
+		}
+
+		result, held := s.digestDelivery(ctx, delivery, recipient.UserID, recipient.Addresses)
+		if !held {
+			result, err = s.dispatchNotification(ctx, delivery)
+		}
+
+		var circuitErr *CircuitOpenError
+		isDeferred := errors.As(err, &circuitErr)
+		var maintenanceErr *MaintenanceError
+		isMuted := errors.As(err, &maintenanceErr)
+		var windowErr *DeliveryWindowError
+		isWindowed := errors.As(err, &windowErr)
+
+		switch {
+		case held:
+			if err := s.storeResult(*result); err != nil {
+				log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to store delivery result")
+			}
+		case isDeferred:
+			if result, err = s.deferDelivery(delivery, nil, circuitErr); err != nil {
+				log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to defer delivery")
+			}
+		case isMuted:
+			if result, err = s.holdForMaintenance(delivery, nil, maintenanceErr); err != nil {
+				log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to hold delivery for maintenance")
+			}
+		case isWindowed:
+			if result, err = s.holdForDeliveryWindow(delivery, nil, windowErr); err != nil {
+				log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to hold delivery for the delivery window")
+			}
+		default:
+			if result == nil {
+				result = s.createFailedResult(delivery, channel, strings.Join(recipient.Addresses, ", "), err.Error())
+			}
+			if err != nil {
+				result.ErrorClass = classifyFailure(err)
+			}
+			s.finishDelivery(delivery, result)
+		}
+
+		if held {
+			digested++
+		} else if isDeferred || isWindowed {
+			deferred++
+		} else if isMuted {
+			muted++
+		} else if result.Status == "sent" {
+			sent++
+		} else {
+			failed++
+		}
+		deliveryIDs = append(deliveryIDs, result.ID)
+	}
+
+	// Summarise the fan-out in a single result for the original request
+	summary := &NotificationResult{
+		ID:          generateNotificationID(),
+		RequestID:   request.ID,
+		Type:        request.Type,
+		Recipient:   fmt.Sprintf("%d recipients", len(resolved)),
+		Status:      "sent",
+		Attempts:    1,
+		MaxAttempts: s.maxAttempts(request.TenantID, request.Type),
+		Metadata:    copyMetadata(request.Metadata),
+		TenantID:    request.TenantID,
+		Category:    request.Category,
+		Priority:    request.Priority,
+		Summary:     true,
+		CreatedAt:   time.Now(),
+		searchText:  historyText(request),
+	}
+	summary.Metadata["delivery_ids"] = deliveryIDs
+	summary.Metadata["sent_count"] = sent
+	summary.Metadata["failed_count"] = failed
+	summary.Metadata["digested_count"] = digested
+	summary.Metadata["deferred_count"] = deferred
+	summary.Metadata["muted_count"] = muted
+
+	if sent == 0 && digested == 0 && deferred == 0 && muted == 0 {
+		summary.Status = "failed"
+		summary.Error = fmt.Sprintf("all %d deliveries failed", failed)
+	} else {
+		now := time.Now()
+		summary.SentAt = &now
+	}
+
+	if err := s.storeResult(*summary); err != nil {
+		log.Warn().Err(err).Str("resultID", summary.ID).Msg("Failed to store summary result")
+	}
+
+	return summary, nil
+}
+
 // sendEmailNotification sends an email notification
-func (s *NotificationService) sendEmailNotification(request NotificationRequest) (*NotificationResult, error) {
+func (s *NotificationService) sendEmailNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
 	if len(request.Recipients) == 0 {
 		return nil, fmt.Errorf("no recipients specified")
 	}
 
+	// Addresses that bounced or complained are left out
+	var recipients []string
+	var suppressed *EmailSuppression
+	for _, recipient := range request.Recipients {
+		if suppression := s.emailSuppression(request.TenantID, recipient); suppression != nil {
+			suppressed = suppression
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+	if len(recipients) == 0 {
+		return s.createSuppressedResult(request, "email", request.Recipients[0], suppressed.Reason), nil
+	}
+
 	// Create email message
 	emailMessage := EmailMessage{
-		To:       request.Recipients,
-		Subject:  request.Subject,
-		Body:     request.TextBody,
-		HTMLBody: request.HTMLBody,
-		Priority: request.Priority,
+		To:          recipients,
+		Subject:     request.Subject,
+		Body:        request.TextBody,
+		HTMLBody:    request.HTMLBody,
+		Attachments: request.Attachments,
+	}
+
+	// Messages of a thread all refer to the same made-up root message
+	if request.ThreadKey != "" {
+		sum := sha256.Sum256([]byte(request.TenantID + ":" + request.ThreadKey))
+		root := fmt.Sprintf("<thread-%s@%s>", hex.EncodeToString(sum[:16]), emailDomain(s.emailService.config.From))
+		emailMessage.Headers = map[string]string{
+			"In-Reply-To": root,
+			"References":  root,
+		}
+	}
+
+	// Events are attached as invites, named after the event unless a subject is set
+	if request.Calendar != nil {
+		emailMessage.Attachments = append(emailMessage.Attachments,
+			s.emailService.CalendarAttachment(*request.Calendar, recipients))
+		if emailMessage.Subject == "" {
+			emailMessage.Subject = request.Calendar.Title
+		}
 	}
 
 	// Send email
-	emailResult, err := s.emailService.SendEmail(emailMessage)
+	emailResult, err := s.emailService.SendEmail(ctx, emailMessage)
 	if err != nil {
-		return s.createFailedResult(request, "email", request.Recipients[0], err.Error())
+		return s.createFailedResult(request, "email", request.Recipients[0], err.Error()), err
 	}
 
-	return s.createSuccessResult(request, "email", request.Recipients[0], emailResult.MessageID), nil
+	result := s.createSuccessResult(request, "email", recipients[0], emailResult.MessageID)
+	result.Simulated = emailResult.Simulated
+	return result, nil
 }
 
 // sendSMSNotification sends an SMS notification
-func (s *NotificationService) sendSMSNotification(request NotificationRequest) (*NotificationResult, error) {
+func (s *NotificationService) sendSMSNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
 	if len(request.Recipients) == 0 {
 		return nil, fmt.Errorf("no recipients specified")
 	}
 
+	// Numbers that replied STOP get nothing more from the tenant
+	if s.smsService.IsOptedOut(request.TenantID, request.Recipients[0]) {
+		return s.createSuppressedResult(request, "sms", request.Recipients[0], SuppressionOptOut), nil
+	}
+
 	// Create SMS message
 	smsMessage := SMSMessage{
 		To:       request.Recipients[0],
 		Body:     request.Message,
 		Priority: request.Priority,
+		TenantID: request.TenantID,
 	}
 
 	// Send SMS
-	smsResult, err := s.smsService.SendSMS(smsMessage)
+	smsResult, err := s.smsService.SendSMS(ctx, smsMessage)
 	if err != nil {
-		return s.createFailedResult(request, "sms", request.Recipients[0], err.Error())
+		return s.createFailedResult(request, "sms", request.Recipients[0], err.Error()), err
 	}
 
-	return s.createSuccessResult(request, "sms", request.Recipients[0], smsResult.MessageID), nil
+	result := s.createSuccessResult(request, "sms", request.Recipients[0], smsResult.MessageID)
+	result.Simulated = smsResult.Simulated
+	return result, nil
 }
 
 // sendPushNotification sends a push notification
-func (s *NotificationService) sendPushNotification(request NotificationRequest) (*NotificationResult, error) {
+func (s *NotificationService) sendPushNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
 	if len(request.Recipients) == 0 {
 		return nil, fmt.Errorf("no recipients specified")
 	}
@@ -557,47 +1269,59 @@ func (s *NotificationService) sendPushNotification(request NotificationRequest)
 		Data:     request.TemplateData,
 		Priority: request.Priority,
 		Tokens:   request.Recipients,
+		TenantID: request.TenantID,
 	}
+	request.Push.apply(&pushMessage)
 
 	// Send push notification
-	pushResult, err := s.pushService.SendPushNotification(pushMessage)
+	pushResult, err := s.pushService.SendPushNotification(ctx, pushMessage)
 	if err != nil {
-		return s.createFailedResult(request, "push", request.Recipients[0], err.Error())
+		return s.createFailedResult(request, "push", request.Recipients[0], err.Error()), err
 	}
 
-	return s.createSuccessResult(request, "push", request.Recipients[0], pushResult.MessageID), nil
+	result := s.createSuccessResult(request, "push", request.Recipients[0], pushResult.MessageID)
+	result.Simulated = pushResult.Simulated
+	return result, nil
 }
 
 // sendInAppNotification sends an in-app notification
-func (s *NotificationService) sendInAppNotification(request NotificationRequest) (*NotificationResult, error) {
+func (s *NotificationService) sendInAppNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
 	if len(request.Recipients) == 0 {
 		return nil, fmt.Errorf("no recipients specified")
 	}
 
 	// Create in-app notification
 	inAppNotification := InAppNotification{
-		UserID:    request.Recipients[0],
-		TenantID:  request.TenantID,
-		Type:      request.Category,
-		Title:     request.Title,
-		Message:   request.Message,
-		Data:      request.TemplateData,
-		Priority:  request.Priority,
-		Category:  request.Category,
-		CreatedAt: time.Now(),
+		UserID:      request.Recipients[0],
+		TenantID:    request.TenantID,
+		Type:        request.Category,
+		Title:       request.Title,
+		Message:     request.Message,
+		Data:        request.TemplateData,
+		Priority:    request.Priority,
+		Category:    request.Category,
+		CollapseKey: request.CollapseKey,
+		ThreadKey:   request.ThreadKey,
+		Actions:     request.Actions,
+		Entity:      request.Entity,
+		Attachments: request.InAppAttachments,
+		CreatedAt:   time.Now(),
+	}
+	if request.Entity != nil {
+		inAppNotification.ActionURL = s.inAppService.entityLink(request.Entity)
 	}
 
 	// Send in-app notification
-	_, err := s.inAppService.CreateNotification(inAppNotification)
+	created, err := s.inAppService.CreateNotification(ctx, inAppNotification)
 	if err != nil {
-		return s.createFailedResult(request, "inapp", request.Recipients[0], err.Error())
+		return s.createFailedResult(request, "inapp", request.Recipients[0], err.Error()), err
 	}
 
-	return s.createSuccessResult(request, "inapp", request.Recipients[0], ""), nil
+	return s.createSuccessResult(request, "inapp", request.Recipients[0], created.ID), nil
 }
 
 // sendWebhookNotification sends a webhook notification
-func (s *NotificationService) sendWebhookNotification(request NotificationRequest) (*NotificationResult, error) {
+func (s *NotificationService) sendWebhookNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
 	// Create webhook event
 	webhookEvent := WebhookEvent{
 		ID:        generateWebhookID(),
@@ -612,27 +1336,28 @@ func (s *NotificationService) sendWebhookNotification(request NotificationReques
 	}
 
 	// Trigger webhook
-	err := s.webhookService.TriggerWebhook(webhookEvent)
+	err := s.webhookService.TriggerWebhook(ctx, webhookEvent)
 	if err != nil {
-		return s.createFailedResult(request, "webhook", "webhook", err.Error())
+		return s.createFailedResult(request, "webhook", "webhook", err.Error()), err
 	}
 
-	return s.createSuccessResult(request, "webhook", "webhook", webhookEvent.ID), nil
+	result := s.createSuccessResult(request, "webhook", "webhook", webhookEvent.ID)
+	result.Simulated = s.config.WebhookConfig.DryRun
+	return result, nil
 }
 
 // sendAllNotifications sends notifications to all channels
-func (s *NotificationService) sendAllNotifications(request NotificationRequest) (*NotificationResult, error) {
-	// This would send to all available channels
-	// For now, just send email
-	return s.sendEmailNotification(request)
+func (s *NotificationService) sendAllNotifications(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
+	// Every channel is sent on with the addresses of the recipients for it
+	return s.sendToResolvedRecipients(ctx, request)
 }
 
 // processBatch processes a batch of notification requests
-func (s *NotificationService) processBatch(requests []NotificationRequest) ([]*NotificationResult, error) {
+func (s *NotificationService) processBatch(ctx context.Context, requests []NotificationRequest) ([]*NotificationResult, error) {
 	var results []*NotificationResult
 
 	for _, request := range requests {
-		result, err := s.SendNotification(request)
+		result, err := s.SendNotification(ctx, request)
 		if err != nil {
 			result = &NotificationResult{
 				ID:          generateNotificationID(),
@@ -641,7 +1366,7 @@ func (s *NotificationService) processBatch(requests []NotificationRequest) ([]*N
 				Status:      "failed",
 				Error:       err.Error(),
 				Attempts:    1,
-				MaxAttempts: s.config.MaxRetries,
+				MaxAttempts: s.maxAttempts(request.TenantID, request.Type),
 			}
 		}
 		results = append(results, result)
@@ -650,50 +1375,55 @@ func (s *NotificationService) processBatch(requests []NotificationRequest) ([]*N
 	return results, nil
 }
 
-// startWorkers starts background workers for processing notifications
-func (s *NotificationService) startWorkers() {
-	log.Info().Int("workerCount", s.config.WorkerCount).Msg("Starting notification workers")
-
-	for i := 0; i < s.config.WorkerCount; i++ {
-		go s.worker(i)
-	}
-}
-
-// worker processes notifications from the queue
-func (s *NotificationService) worker(id int) {
-	log.Info().Int("workerID", id).Msg("Notification worker started")
+// worker processes notifications from the queue. Workers beyond the worker
+// count of the runtime configuration idle until it is raised again.
+func (s *NotificationService) worker(channel string, id int) {
+	log.Info().Str("channel", channel).Int("workerID", id).Msg("Notification worker started")
+	queueKey := s.getChannelQueueKey(channel)
 
 	for {
 		// Process queued notifications
-		s.processQueuedNotifications()
+		if id < s.channelWorkerCount(channel) {
+			s.processQueuedNotifications(queueKey)
+		}
 
 		// Sleep before next iteration
-		time.Sleep(1 * time.Second)
+		select {
+		case <-s.ctx.Done():
+			log.Info().Str("channel", channel).Int("workerID", id).Msg("Notification worker stopped")
+			return
+		case <-time.After(1 * time.Second):
+		}
 	}
 }
 
-// processQueuedNotifications processes notifications from the queue
-func (s *NotificationService) processQueuedNotifications() {
+// processQueuedNotifications processes the next due notification of a queue
+func (s *NotificationService) processQueuedNotifications(queueKey string) {
 	ctx := context.Background()
-	queueKey := s.getQueueKey()
 
-	// Get next notification from queue
-	result, err := s.redis.ZRangeWithScores(ctx, queueKey, 0, 0).Result()
-	if err != nil || len(result) == 0 {
+	// Get next notification that is due
+	due, err := s.redis.ZRangeByScoreWithScores(ctx, queueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().Unix(), 10),
+		Count: 1,
+	}).Result()
+	if err != nil || len(due) == 0 {
 		return
 	}
 
 	// Get notification data
-	notificationData := result[0].Member.(string)
-	score := result[0].Score
+	notificationData, _ := due[0].Member.(string)
+	dueAt := time.Unix(int64(due[0].Score), 0)
 
-	// Check if it's time to process
-	if score > float64(time.Now().Unix()) {
+	// Remove from queue, only the worker that removes it processes it
+	removed, err := s.redis.ZRem(ctx, queueKey, notificationData).Result()
+	if err != nil || removed == 0 {
 		return
 	}
 
-	// Remove from queue
-	s.redis.ZRem(ctx, queueKey, notificationData)
+	// Put the notification back if shutdown cuts processing short
+	s.trackInFlight(queueKey, notificationData)
+	defer s.untrackInFlight(notificationData)
 
 	// Parse notification data
 	var notification struct {
@@ -709,74 +1439,165 @@ func (s *NotificationService) processQueuedNotifications() {
 	// Get request and result
 	request, err := s.getRequest(notification.RequestID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get queued request")
+		log.Error().Err(err).Str("requestID", notification.RequestID).Msg("Failed to get queued request")
+		// A request that expired can't be sent anymore, its result must not
+		// stay pending
+		if errors.Is(err, ErrNotFound) {
+			s.failExpiredRequest(ctx, notification.ResultID)
+		}
 		return
 	}
 
-	result, err := s.GetNotificationStatus(notification.ResultID)
+	result, err := s.GetNotificationStatus(ctx, notification.ResultID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get queued result")
 		return
 	}
 
+	// Deliveries that waited too long are given up instead of sent late
+	if reason, timedOut := queueTimedOut(*request, s.tenantSettings(ctx, request.TenantID), dueAt); timedOut {
+		result.Status = "failed"
+		result.Error = reason
+		result.NextRetryAt = nil
+		if err := s.storeResult(*result); err != nil {
+			log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to store timed out notification")
+		}
+		s.notifyStatus(*result)
+		return
+	}
+
 	// Process notification
-	s.processNotification(*request, result)
+	s.processNotification(ctx, *request, result)
+}
+
+// failExpiredRequest fails the result of a queued notification whose request
+// expired before it was due
+func (s *NotificationService) failExpiredRequest(ctx context.Context, resultID string) {
+	result, err := s.GetNotificationStatus(ctx, resultID)
+	if err != nil {
+		return
+	}
+
+	result.Status = "failed"
+	result.Error = "request expired before it was sent"
+	result.NextRetryAt = nil
+	if err := s.storeResult(*result); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to store expired notification")
+	}
+	s.notifyStatus(*result)
 }
 
 // processNotification processes a single notification
-func (s *NotificationService) processNotification(request NotificationRequest, result *NotificationResult) {
+func (s *NotificationService) processNotification(ctx context.Context, request NotificationRequest, result *NotificationResult) {
 	log.Info().
 		Str("requestID", request.ID).
 		Str("resultID", result.ID).
 		Str("type", request.Type).
 		Msg("Processing notification")
 
-	// Increment attempt count
-	result.Attempts++
-
 	// Send notification based on type
-	var err error
-	switch request.Type {
-	case "email":
-		_, err = s.sendEmailNotification(request)
-	case "sms":
-		_, err = s.sendSMSNotification(request)
-	case "push":
-		_, err = s.sendPushNotification(request)
-	case "inapp":
-		_, err = s.sendInAppNotification(request)
-	case "webhook":
-		_, err = s.sendWebhookNotification(request)
-	default:
-		err = fmt.Errorf("unsupported notification type: %s", request.Type)
+	sent, err := s.dispatchNotification(ctx, request)
+
+	// A tripped provider does not count against the retry budget
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		if _, err := s.deferDelivery(request, result, circuitErr); err != nil {
+			log.Error().Err(err).Str("resultID", result.ID).Msg("Failed to defer notification")
+		}
+		return
+	}
+
+	var maintenanceErr *MaintenanceError
+	if errors.As(err, &maintenanceErr) {
+		if _, err := s.holdForMaintenance(request, result, maintenanceErr); err != nil {
+			log.Error().Err(err).Str("resultID", result.ID).Msg("Failed to hold notification for maintenance")
+		}
+		return
 	}
 
+	var windowErr *DeliveryWindowError
+	if errors.As(err, &windowErr) {
+		if _, err := s.holdForDeliveryWindow(request, result, windowErr); err != nil {
+			log.Error().Err(err).Str("resultID", result.ID).Msg("Failed to hold notification for the delivery window")
+		}
+		return
+	}
+
+	// Increment attempt count
+	result.Attempts++
+	result.NextRetryAt = nil
+
 	// Update result
 	if err != nil {
 		result.Status = "failed"
-		result.Error = err.Error()
+		// Provider errors may quote the request, credentials included
+		result.Error = secrets.Redact(err.Error())
+		result.ErrorClass = classifyFailure(err)
 	} else {
 		result.Status = "sent"
+		result.Error = ""
+		result.ErrorClass = ""
 		now := time.Now()
 		result.SentAt = &now
+		if sent != nil {
+			result.MessageID = sent.MessageID
+		}
 	}
 
-	// Store updated result
-	s.storeResult(*result)
+	s.finishDelivery(request, result)
+}
 
-	// Retry if failed and attempts remaining
+// finishDelivery stores a delivery result, scheduling a retry when it failed
+// and the retry budget allows, and reports final results to the caller
+func (s *NotificationService) finishDelivery(request NotificationRequest, result *NotificationResult) {
 	if result.Status == "failed" && result.Attempts < result.MaxAttempts {
-		s.scheduleRetry(request, result)
+		if err := s.scheduleRetry(request, result); err == nil {
+			return
+		}
+	}
+
+	if err := s.storeResult(*result); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to store notification result")
 	}
+	s.notifyStatus(*result)
 }
 
-// scheduleRetry schedules a notification for retry
-func (s *NotificationService) scheduleRetry(request NotificationRequest, result *NotificationResult) {
-	retryDelay := s.config.RetryDelay * time.Duration(result.Attempts)
+// scheduleRetry schedules a notification for retry using exponential backoff with jitter
+func (s *NotificationService) scheduleRetry(request NotificationRequest, result *NotificationResult) error {
+	baseDelay := s.config.RetryDelay
+	if settings := s.tenantSettings(context.Background(), request.TenantID); settings.RetryDelay > 0 {
+		baseDelay = time.Duration(settings.RetryDelay) * time.Second
+	}
+	retryDelay := retryBackoff(baseDelay, s.config.MaxRetryDelay, result.Attempts)
 	retryTime := time.Now().Add(retryDelay)
 
+	// Persist the next retry time so it survives restarts and is visible to callers
+	result.NextRetryAt = &retryTime
+	if err := s.storeResult(*result); err != nil {
+		log.Error().Err(err).Str("resultID", result.ID).Msg("Failed to store result for retry")
+		return err
+	}
+
+	// The retry worker loads the request by ID
+	if err := s.storeRequestUntil(request, retryTime); err != nil {
+		log.Error().Err(err).Str("requestID", request.ID).Msg("Failed to store request for retry")
+		return err
+	}
+
 	// Queue for retry
-	s.queueNotification(request, result)
+	if err := s.queueNotification(request, result, retryTime); err != nil {
+		log.Error().Err(err).Str("resultID", result.ID).Msg("Failed to queue notification retry")
+		return err
+	}
+
+	log.Info().
+		Str("resultID", result.ID).
+		Int("attempt", result.Attempts).
+		Int("maxAttempts", result.MaxAttempts).
+		Dur("retryDelay", retryDelay).
+		Msg("Notification retry scheduled")
+
+	return nil
 }
 
 // validateRequest validates a notification request
@@ -789,24 +1610,65 @@ func (s *NotificationService) validateRequest(request NotificationRequest) error
 		return fmt.Errorf("at least one recipient is required")
 	}
 
-	if request.Message == "" && request.TemplateID == "" {
+	if request.Message == "" && request.TemplateID == "" && len(request.Localizations) == 0 {
 		return fmt.Errorf("message or template ID is required")
 	}
 
+	if err := validateLocalizations(request.Localizations); err != nil {
+		return err
+	}
+
+	if request.CallbackURL != "" {
+		if err := validateCallbackURL(request.CallbackURL); err != nil {
+			return err
+		}
+	}
+
+	if err := validateActions(request.Actions); err != nil {
+		return err
+	}
+
+	if err := s.inAppService.validateEntity(request.Entity); err != nil {
+		return err
+	}
+
+	if err := s.inAppService.validateInAppAttachments(request.InAppAttachments); err != nil {
+		return err
+	}
+
+	if err := validateAttachments(request.Attachments); err != nil {
+		return err
+	}
+
+	if err := validateCalendarEvent(request.Calendar); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // storeRequest stores a notification request
 func (s *NotificationService) storeRequest(request NotificationRequest) error {
+	return s.storeRequestUntil(request, time.Now())
+}
+
+// storeRequestUntil stores a notification request that is sent at sendAt. It
+// is kept for requestTTL past it, so the queue still finds it when deliveries
+// are held back for longer than a day.
+func (s *NotificationService) storeRequestUntil(request NotificationRequest, sendAt time.Time) error {
 	ctx := context.Background()
 	key := s.getRequestKey(request.ID)
 
-	requestJSON, err := json.Marshal(request)
+	requestJSON, err := s.pii.marshalRequest(request)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	return s.redis.Set(ctx, key, requestJSON, 24*time.Hour).Err()
+	ttl := requestTTL
+	if wait := time.Until(sendAt); wait > 0 {
+		ttl += wait
+	}
+	return s.redis.Set(ctx, key, requestJSON, ttl).Err()
 }
 
 // getRequest gets a notification request by ID
@@ -817,74 +1679,135 @@ func (s *NotificationService) getRequest(requestID string) (*NotificationRequest
 	requestJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("request not found: %s", requestID)
+			return nil, notFoundf("request not found: %s", requestID)
 		}
 		return nil, fmt.Errorf("failed to get request: %w", err)
 	}
 
-	var request NotificationRequest
-	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+	request, err := s.pii.unmarshalRequest(requestJSON)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
 	}
 
-	return &request, nil
+	return request, nil
 }
 
-// storeResult stores a notification result
+// storeResult stores a notification result and updates the statistics rollups
 func (s *NotificationService) storeResult(result NotificationResult) error {
 	ctx := context.Background()
 	key := s.getResultKey(result.ID)
 
-	resultJSON, err := json.Marshal(result)
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
+	}
+
+	resultJSON, err := s.pii.marshalResult(result)
 	if err != nil {
 		return fmt.Errorf("failed to marshal result: %w", err)
 	}
 
-	return s.redis.Set(ctx, key, resultJSON, 7*24*time.Hour).Err()
+	// Read the previous version so rollups only count status transitions
+	var previous *NotificationResult
+	if previousJSON, err := s.redis.Get(ctx, key).Result(); err == nil {
+		if stored, err := s.pii.unmarshalResult(previousJSON); err == nil {
+			previous = stored
+		}
+	}
+
+	// Results are kept until the retention job archives or deletes them
+	if err := s.redis.Set(ctx, key, resultJSON, 0).Err(); err != nil {
+		return err
+	}
+
+	if !result.Summary {
+		s.recordStats(previous, result)
+		s.recordFailure(previous, result)
+	}
+	s.recordTimeline(ctx, previous, result)
+
+	if previous == nil {
+		pipe := s.redis.TxPipeline()
+
+		// Index results by age for the retention job
+		pipe.ZAdd(ctx, s.getRetentionIndexKey(result.TenantID), &redis.Z{
+			Score:  float64(result.CreatedAt.Unix()),
+			Member: result.ID,
+		})
+		pipe.SAdd(ctx, s.getRetentionTenantsKey(), retentionTenant(result.TenantID))
+
+		// Index deliveries by user so data subject requests can find them
+		if userID := resultUserID(result); userID != "" {
+			pipe.SAdd(ctx, s.getUserResultsKey(result.TenantID, userID), result.ID)
+		}
+
+		// Index deliveries by acknowledgment token so acknowledgments can stamp them
+		if token, ok := result.Metadata["ack_token"].(string); ok && token != "" {
+			pipe.SAdd(ctx, s.getAckResultsKey(token), result.ID)
+			pipe.Expire(ctx, s.getAckResultsKey(token), s.config.AckTTL)
+		}
+
+		// Index results by their fields and content for history queries
+		s.indexHistory(ctx, pipe, result)
+
+		// Index SMS by number so replies find the notification they answer
+		if result.Type == "sms" {
+			if phone := phoneDigits(result.Recipient); phone != "" {
+				pipe.Set(ctx, s.getLastSMSResultKey(phone), result.ID, messageIndexTTL)
+			}
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to index result")
+		}
+	} else if previous.Status != result.Status {
+		s.reindexHistoryStatus(ctx, previous.Status, result)
+	}
+
+	// Index deliveries by provider message ID so delivery reports can find
+	// them, retries send new messages
+	if deliveryReportChannels[result.Type] && result.MessageID != "" && (previous == nil || previous.MessageID != result.MessageID) {
+		if err := s.redis.Set(ctx, s.getMessageResultKey(result.Type, result.MessageID), result.ID, messageIndexTTL).Err(); err != nil {
+			log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to index result by message ID")
+		}
+	}
+
+	return nil
 }
 
-// queueNotification queues a notification for processing
-func (s *NotificationService) queueNotification(request NotificationRequest, result *NotificationResult) error {
+// queueNotification queues a notification for processing at the given time
+func (s *NotificationService) queueNotification(request NotificationRequest, result *NotificationResult, at time.Time) error {
 	ctx := context.Background()
 	queueKey := s.getQueueKey()
-
-	// Create queue data
-	queueData := map[string]string{
-		"request_id": request.ID,
-		"result_id":  result.ID,
+	if _, ok := s.channelPools[request.Type]; ok {
+		queueKey = s.getChannelQueueKey(request.Type)
 	}
 
-	queueJSON, err := json.Marshal(queueData)
+	member, err := queueMember(request, result)
 	if err != nil {
-		return fmt.Errorf("failed to marshal queue data: %w", err)
+		return err
 	}
 
 	// Add to queue with score (timestamp)
-	score := float64(time.Now().Unix())
+	score := float64(at.Unix())
 	return s.redis.ZAdd(ctx, queueKey, &redis.Z{
 		Score:  score,
-		Member: string(queueJSON),
+		Member: member,
 	}).Err()
 }
 
-// calculateStats calculates notification statistics
-func (s *NotificationService) calculateStats(tenantID string, days int) (*NotificationStats, error) {
-	// This is a simplified implementation
-	// In production, you'd query a proper database
-	stats := &NotificationStats{
-		Total:       0,
-		Sent:        0,
-		Failed:      0,
-		Pending:     0,
-		ByType:      make(map[string]int),
-		ByCategory:  make(map[string]int),
-		ByPriority:  make(map[string]int),
-		ByDate:      make(map[string]int),
-		SuccessRate: 0.0,
-		AverageTime: 0.0,
+// queueMember returns the queue entry of a delivery
+func queueMember(request NotificationRequest, result *NotificationResult) (string, error) {
+	queueData := map[string]string{
+		"request_id": request.ID,
+		"result_id":  result.ID,
 	}
 
-	return stats, nil
+	queueJSON, err := json.Marshal(queueData)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal queue data: %w", err)
+	}
+
+	return string(queueJSON), nil
 }
 
 // createSuccessResult creates a successful notification result
@@ -904,8 +1827,14 @@ func (s *NotificationService) createSuccessResult(
 		MessageID:   messageID,
 		SentAt:      &now,
 		Attempts:    1,
-		MaxAttempts: s.config.MaxRetries,
+		MaxAttempts: s.maxAttempts(request.TenantID, notificationType),
 		Metadata:    request.Metadata,
+		CallbackURL: request.CallbackURL,
+		TenantID:    request.TenantID,
+		Category:    request.Category,
+		Priority:    request.Priority,
+		CreatedAt:   request.CreatedAt,
+		searchText:  historyText(request),
 	}
 }
 
@@ -924,11 +1853,69 @@ func (s *NotificationService) createFailedResult(
 		Status:      "failed",
 		Error:       errorMsg,
 		Attempts:    1,
-		MaxAttempts: s.config.MaxRetries,
+		MaxAttempts: s.maxAttempts(request.TenantID, notificationType),
 		Metadata:    request.Metadata,
+		CallbackURL: request.CallbackURL,
+		TenantID:    request.TenantID,
+		Category:    request.Category,
+		Priority:    request.Priority,
+		CreatedAt:   request.CreatedAt,
+		searchText:  historyText(request),
 	}
 }
 
+// createSuppressedResult creates the result of a delivery held back because
+// the recipient can't or doesn't want to receive it
+func (s *NotificationService) createSuppressedResult(
+	request NotificationRequest,
+	notificationType string,
+	recipient string,
+	reason string,
+) *NotificationResult {
+	result := s.createFailedResult(request, notificationType, recipient, "recipient suppressed: "+reason)
+	result.Status = "suppressed"
+
+	metadata := make(map[string]interface{}, len(request.Metadata)+1)
+	for key, value := range request.Metadata {
+		metadata[key] = value
+	}
+	metadata["suppression_reason"] = reason
+	result.Metadata = metadata
+
+	return result
+}
+
+// recipientLocale returns the locale of a user recipient, empty for raw
+// addresses and users without one
+func (s *NotificationService) recipientLocale(tenantID string, recipient string) string {
+	if !strings.HasPrefix(recipient, RecipientPrefixUser) {
+		return ""
+	}
+
+	contact, err := s.recipients.GetUserContact(tenantID, strings.TrimPrefix(recipient, RecipientPrefixUser))
+	if err != nil {
+		log.Warn().Err(err).Str("recipient", recipient).Msg("Failed to get recipient locale")
+		return ""
+	}
+	return contact.Locale
+}
+
+// TenantLocale returns the default locale of a tenant, empty when it sets none
+func (s *NotificationService) TenantLocale(tenantID string) string {
+	settings, err := s.templateService.GetLocaleSettings(tenantID)
+	if err != nil {
+		log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to get locale settings")
+		return ""
+	}
+	return settings.DefaultLocale
+}
+
+// messageLocale returns the locale the service writes notifications it
+// generates for a recipient in, following the template locale chain
+func (s *NotificationService) messageLocale(tenantID string, recipient string) string {
+	return i18n.Select(s.templateService.LocaleChain(tenantID, s.recipientLocale(tenantID, recipient))...)
+}
+
 // Redis key generators
 func (s *NotificationService) getRequestKey(requestID string) string {
 	return fmt.Sprintf("notification_request:%s", requestID)
@@ -938,15 +1925,54 @@ func (s *NotificationService) getResultKey(resultID string) string {
 	return fmt.Sprintf("notification_result:%s", resultID)
 }
 
+func (s *NotificationService) getMessageResultKey(channel string, messageID string) string {
+	return fmt.Sprintf("message_result:%s:%s", channel, messageID)
+}
+
 func (s *NotificationService) getQueueKey() string {
 	return "notification_queue"
 }
 
+// getChannelQueueKey returns the queue of a channel, the shared queue for an
+// empty channel
+func (s *NotificationService) getChannelQueueKey(channel string) string {
+	if channel == "" {
+		return s.getQueueKey()
+	}
+	return s.getQueueKey() + ":" + channel
+}
+
+// getQueueKeys returns the shared queue and the queues of the channels
+func (s *NotificationService) getQueueKeys() []string {
+	keys := []string{s.getQueueKey()}
+	for _, channel := range queueChannels {
+		keys = append(keys, s.getChannelQueueKey(channel))
+	}
+	return keys
+}
+
 func (s *NotificationService) getStatsKey(tenantID string, days int) string {
 	return fmt.Sprintf("notification_stats:%s:%d", tenantID, days)
 }
 
 // Helper functions
 func generateWebhookID() string {
-	return fmt.Sprintf("webhook_%d", time.Now().UnixNano())
+	return newID("webhook")
+}
+
+func hasRecipientReferences(recipients []string) bool {
+	for _, recipient := range recipients {
+		if isRecipientReference(recipient) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	return copied
 }
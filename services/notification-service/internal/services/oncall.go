@@ -0,0 +1,608 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
+)
+
+// defaultOnCallTimeZone is the time zone rotation restrictions are read in
+// when a schedule names none
+const defaultOnCallTimeZone = "Europe/Istanbul"
+
+// OnCallService manages on-call schedules, the escalation policies that
+// page the people on call until someone acknowledges, and the alerts that
+// trigger them
+type OnCallService struct {
+	redis         *redis.Client
+	config        OnCallConfig
+	notifications *NotificationService
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// OnCallConfig holds on-call service configuration
+type OnCallConfig struct {
+	RedisURL      string
+	RedisPassword string
+	RedisDB       int
+	TickInterval  time.Duration // How often due escalations and alerts are advanced
+
+	// AlertFlapWindow is how long a resolved alert must stay away before its
+	// resolution is sent; coming back within it reopens the alert silently
+	AlertFlapWindow time.Duration
+}
+
+// OnCallSchedule decides who of a team is on call at any time. Rotations
+// listed later take precedence over earlier ones where they overlap, so
+// rotations covering nights or weekends follow the base rotation.
+type OnCallSchedule struct {
+	ID        string           `json:"id"`
+	TenantID  string           `json:"tenant_id"`
+	Name      string           `json:"name"`
+	Team      string           `json:"team,omitempty"`
+	TimeZone  string           `json:"time_zone"` // IANA name restrictions are read in
+	Rotations []OnCallRotation `json:"rotations"`
+	CreatedBy string           `json:"created_by"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// OnCallRotation hands the shift from one participant to the next every
+// ShiftHours, counted from Start
+type OnCallRotation struct {
+	Name         string              `json:"name"`
+	Participants []string            `json:"participants"` // user IDs, in the order they take over
+	Start        time.Time           `json:"start"`        // when the first participant's shift begins
+	ShiftHours   int                 `json:"shift_hours"`  // 24 for daily, 168 for weekly handoffs
+	Restrictions []OnCallRestriction `json:"restrictions,omitempty"`
+}
+
+// OnCallRestriction limits a rotation to a daily window. Windows ending
+// before they start run past midnight, like 18:00 to 08:00.
+type OnCallRestriction struct {
+	Days  []int  `json:"days,omitempty"` // weekdays the window starts on, 0 for Sunday; every day when empty
+	Start string `json:"start"`          // HH:MM in the time zone of the schedule
+	End   string `json:"end"`
+}
+
+// OnCallOverride puts someone else on call for a while, whatever the
+// rotations say
+type OnCallOverride struct {
+	ID         string    `json:"id"`
+	ScheduleID string    `json:"schedule_id"`
+	UserID     string    `json:"user_id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OnCallShift tells who is on call and from where the shift comes
+type OnCallShift struct {
+	ScheduleID string    `json:"schedule_id"`
+	UserID     string    `json:"user_id"`
+	Rotation   string    `json:"rotation,omitempty"`
+	OverrideID string    `json:"override_id,omitempty"`
+	Start      time.Time `json:"start"` // bounds of the rotation shift, restrictions don't narrow them
+	End        time.Time `json:"end"`
+}
+
+// NewOnCallService creates a new on-call service instance
+func NewOnCallService(config OnCallConfig, notifications *NotificationService) (*OnCallService, error) {
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set default values
+	if config.TickInterval == 0 {
+		config.TickInterval = 15 * time.Second
+	}
+	if config.AlertFlapWindow == 0 {
+		config.AlertFlapWindow = 5 * time.Minute
+	}
+
+	service := &OnCallService{
+		redis:         redisClient,
+		config:        config,
+		notifications: notifications,
+		done:          make(chan struct{}),
+	}
+	service.ctx, service.cancel = context.WithCancel(context.Background())
+
+	// Acknowledging any page of an escalation stops it
+	notifications.OnAcknowledged(service.acknowledgeFromNotification)
+
+	// Start background escalator
+	go service.startEscalator()
+
+	return service, nil
+}
+
+// CreateSchedule creates an on-call schedule
+func (s *OnCallService) CreateSchedule(schedule OnCallSchedule) (*OnCallSchedule, error) {
+	log.Info().
+		Str("name", schedule.Name).
+		Str("tenantID", schedule.TenantID).
+		Msg("Creating on-call schedule")
+
+	if schedule.TimeZone == "" {
+		schedule.TimeZone = defaultOnCallTimeZone
+	}
+	if err := s.validateSchedule(schedule); err != nil {
+		return nil, invalid(fmt.Errorf("schedule validation failed: %w", err))
+	}
+
+	schedule.ID = newID("schedule")
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = schedule.CreatedAt
+
+	if err := s.storeSchedule(&schedule); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := s.redis.ZAdd(ctx, s.getSchedulesKey(schedule.TenantID), &redis.Z{
+		Score:  float64(schedule.CreatedAt.Unix()),
+		Member: schedule.ID,
+	}).Err(); err != nil {
+		return nil, fmt.Errorf("failed to index schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// GetSchedule gets an on-call schedule by ID
+func (s *OnCallService) GetSchedule(scheduleID string) (*OnCallSchedule, error) {
+	ctx := context.Background()
+
+	scheduleJSON, err := s.redis.Get(ctx, s.getScheduleKey(scheduleID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("schedule not found: %s", scheduleID)
+		}
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	var schedule OnCallSchedule
+	if err := json.Unmarshal([]byte(scheduleJSON), &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// ListSchedules lists the schedules of a tenant, optionally of a single team
+func (s *OnCallService) ListSchedules(tenantID string, team string) ([]*OnCallSchedule, error) {
+	ctx := context.Background()
+
+	ids, err := s.redis.ZRange(ctx, s.getSchedulesKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	schedules := []*OnCallSchedule{}
+	for _, id := range ids {
+		schedule, err := s.GetSchedule(id)
+		if err != nil {
+			continue
+		}
+		if team != "" && schedule.Team != team {
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+// UpdateSchedule replaces the fields of a schedule that are set in updates
+func (s *OnCallService) UpdateSchedule(scheduleID string, updates OnCallSchedule) (*OnCallSchedule, error) {
+	schedule, err := s.GetSchedule(scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Name != "" {
+		schedule.Name = updates.Name
+	}
+	if updates.Team != "" {
+		schedule.Team = updates.Team
+	}
+	if updates.TimeZone != "" {
+		schedule.TimeZone = updates.TimeZone
+	}
+	if updates.Rotations != nil {
+		schedule.Rotations = updates.Rotations
+	}
+
+	if err := s.validateSchedule(*schedule); err != nil {
+		return nil, invalid(fmt.Errorf("schedule validation failed: %w", err))
+	}
+
+	schedule.UpdatedAt = time.Now()
+	if err := s.storeSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// DeleteSchedule deletes a schedule and its overrides. Policies paging the
+// schedule skip it from then on.
+func (s *OnCallService) DeleteSchedule(scheduleID string) error {
+	schedule, err := s.GetSchedule(scheduleID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, s.getScheduleKey(scheduleID))
+	pipe.Del(ctx, s.getOverridesKey(scheduleID))
+	pipe.ZRem(ctx, s.getSchedulesKey(schedule.TenantID), scheduleID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+
+	log.Info().
+		Str("scheduleID", scheduleID).
+		Msg("On-call schedule deleted")
+
+	return nil
+}
+
+// CreateOverride puts a user on call in place of the rotations for a while
+func (s *OnCallService) CreateOverride(scheduleID string, override OnCallOverride) (*OnCallOverride, error) {
+	if _, err := s.GetSchedule(scheduleID); err != nil {
+		return nil, err
+	}
+
+	if override.UserID == "" {
+		return nil, invalid(fmt.Errorf("override user is required"))
+	}
+	if !override.End.After(override.Start) {
+		return nil, invalid(fmt.Errorf("override must end after it starts"))
+	}
+	if !override.End.After(time.Now()) {
+		return nil, invalid(fmt.Errorf("override must end in the future"))
+	}
+
+	override.ID = newID("override")
+	override.ScheduleID = scheduleID
+	override.CreatedAt = time.Now()
+
+	overrideJSON, err := json.Marshal(override)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal override: %w", err)
+	}
+
+	ctx := context.Background()
+	if err := s.redis.HSet(ctx, s.getOverridesKey(scheduleID), override.ID, overrideJSON).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store override: %w", err)
+	}
+
+	log.Info().
+		Str("scheduleID", scheduleID).
+		Str("userID", override.UserID).
+		Time("start", override.Start).
+		Time("end", override.End).
+		Msg("On-call override created")
+
+	return &override, nil
+}
+
+// ListOverrides returns the current and upcoming overrides of a schedule,
+// the ones starting soonest first. Overrides that ended are dropped.
+func (s *OnCallService) ListOverrides(scheduleID string) ([]*OnCallOverride, error) {
+	ctx := context.Background()
+
+	stored, err := s.redis.HGetAll(ctx, s.getOverridesKey(scheduleID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get overrides: %w", err)
+	}
+
+	now := time.Now()
+	overrides := []*OnCallOverride{}
+	var ended []string
+	for id, overrideJSON := range stored {
+		var override OnCallOverride
+		if err := json.Unmarshal([]byte(overrideJSON), &override); err != nil {
+			continue
+		}
+		if !override.End.After(now) {
+			ended = append(ended, id)
+			continue
+		}
+		overrides = append(overrides, &override)
+	}
+
+	if len(ended) > 0 {
+		if err := s.redis.HDel(ctx, s.getOverridesKey(scheduleID), ended...).Err(); err != nil {
+			log.Warn().Err(err).Str("scheduleID", scheduleID).Msg("Failed to drop ended overrides")
+		}
+	}
+
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Start.Before(overrides[j].Start)
+	})
+
+	return overrides, nil
+}
+
+// DeleteOverride removes an override of a schedule
+func (s *OnCallService) DeleteOverride(scheduleID string, overrideID string) error {
+	ctx := context.Background()
+
+	removed, err := s.redis.HDel(ctx, s.getOverridesKey(scheduleID), overrideID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete override: %w", err)
+	}
+	if removed == 0 {
+		return notFoundf("override not found: %s", overrideID)
+	}
+
+	return nil
+}
+
+// WhoIsOnCall returns the shift of a schedule covering a time. The latest
+// override covering it wins over the rotations. It returns nil when nobody
+// is on call.
+func (s *OnCallService) WhoIsOnCall(scheduleID string, at time.Time) (*OnCallShift, error) {
+	schedule, err := s.GetSchedule(scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := s.ListOverrides(scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var current *OnCallOverride
+	for _, override := range overrides {
+		if at.Before(override.Start) || !at.Before(override.End) {
+			continue
+		}
+		if current == nil || override.CreatedAt.After(current.CreatedAt) {
+			current = override
+		}
+	}
+	if current != nil {
+		return &OnCallShift{
+			ScheduleID: scheduleID,
+			UserID:     current.UserID,
+			OverrideID: current.ID,
+			Start:      current.Start,
+			End:        current.End,
+		}, nil
+	}
+
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	for i := len(schedule.Rotations) - 1; i >= 0; i-- {
+		if shift := schedule.Rotations[i].shiftAt(at, location); shift != nil {
+			shift.ScheduleID = scheduleID
+			return shift, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// TestConnection tests the on-call service connection
+func (s *OnCallService) TestConnection() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.redis.Ping(ctx).Err(); err != nil {
+		log.Error().Err(err).Msg("On-call service connection test failed")
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+
+	return nil
+}
+
+// startEscalator escalates alerts nobody acknowledged in time and closes
+// alerts that recovered
+func (s *OnCallService) startEscalator() {
+	log.Info().Msg("Escalator started")
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Escalator stopped")
+			return
+		case <-ticker.C:
+			s.advanceDueEscalations()
+			s.autoResolveAlerts()
+			s.confirmResolutions()
+		}
+	}
+}
+
+// Shutdown stops the escalator and waits for the escalation it is paging
+// for to finish. Due escalations are picked up on the next start.
+func (s *OnCallService) Shutdown(ctx context.Context) error {
+	s.cancel()
+
+	select {
+	case <-s.done:
+		log.Info().Msg("Escalator drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("escalator did not drain: %w", ctx.Err())
+	}
+}
+
+// shiftAt returns the shift of the rotation covering a time, nil when the
+// rotation hasn't started or its restrictions leave the time out
+func (r OnCallRotation) shiftAt(at time.Time, location *time.Location) *OnCallShift {
+	if at.Before(r.Start) || len(r.Participants) == 0 || r.ShiftHours <= 0 {
+		return nil
+	}
+
+	if len(r.Restrictions) > 0 {
+		covered := false
+		for _, restriction := range r.Restrictions {
+			if restriction.covers(at.In(location)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return nil
+		}
+	}
+
+	// Shifts are counted in elapsed hours, they don't move with daylight saving
+	shiftLength := time.Duration(r.ShiftHours) * time.Hour
+	index := int64(at.Sub(r.Start) / shiftLength)
+	start := r.Start.Add(time.Duration(index) * shiftLength)
+
+	return &OnCallShift{
+		UserID:   r.Participants[index%int64(len(r.Participants))],
+		Rotation: r.Name,
+		Start:    start,
+		End:      start.Add(shiftLength),
+	}
+}
+
+// covers reports whether a local time falls in the window
+func (r OnCallRestriction) covers(local time.Time) bool {
+	start, _ := parseClock(r.Start)
+	end, _ := parseClock(r.End)
+	minute := local.Hour()*60 + local.Minute()
+	weekday := int(local.Weekday())
+
+	if start < end {
+		return r.onDay(weekday) && minute >= start && minute < end
+	}
+
+	// The window runs past midnight, its morning belongs to the previous day
+	return (r.onDay(weekday) && minute >= start) || (r.onDay((weekday+6)%7) && minute < end)
+}
+
+func (r OnCallRestriction) onDay(weekday int) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, day := range r.Days {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSchedule validates a schedule
+func (s *OnCallService) validateSchedule(schedule OnCallSchedule) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+
+	if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone: %s", schedule.TimeZone)
+	}
+
+	if len(schedule.Rotations) == 0 {
+		return fmt.Errorf("at least one rotation is required")
+	}
+
+	for i, rotation := range schedule.Rotations {
+		if len(rotation.Participants) == 0 {
+			return fmt.Errorf("rotation %d has no participants", i+1)
+		}
+		if rotation.Start.IsZero() {
+			return fmt.Errorf("rotation %d needs a start", i+1)
+		}
+		if rotation.ShiftHours <= 0 {
+			return fmt.Errorf("rotation %d needs a positive shift length", i+1)
+		}
+		for _, restriction := range rotation.Restrictions {
+			start, err := parseClock(restriction.Start)
+			if err != nil {
+				return fmt.Errorf("rotation %d: %w", i+1, err)
+			}
+			end, err := parseClock(restriction.End)
+			if err != nil {
+				return fmt.Errorf("rotation %d: %w", i+1, err)
+			}
+			if start == end {
+				return fmt.Errorf("rotation %d has an empty restriction window", i+1)
+			}
+			for _, day := range restriction.Days {
+				if day < 0 || day > 6 {
+					return fmt.Errorf("rotation %d has an invalid weekday: %d", i+1, day)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// storeSchedule stores a schedule
+func (s *OnCallService) storeSchedule(schedule *OnCallSchedule) error {
+	ctx := context.Background()
+
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getScheduleKey(schedule.ID), scheduleJSON, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store schedule: %w", err)
+	}
+
+	return nil
+}
+
+// Helper functions
+
+// parseClock parses an HH:MM time of day into minutes since midnight
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %s", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// Redis key generators
+func (s *OnCallService) getScheduleKey(scheduleID string) string {
+	return fmt.Sprintf("oncall_schedule:%s", scheduleID)
+}
+
+func (s *OnCallService) getSchedulesKey(tenantID string) string {
+	if tenantID == "" {
+		return "oncall_schedules:global"
+	}
+	return fmt.Sprintf("oncall_schedules:%s", tenantID)
+}
+
+func (s *OnCallService) getOverridesKey(scheduleID string) string {
+	return fmt.Sprintf("oncall_overrides:%s", scheduleID)
+}
@@ -0,0 +1,675 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// Alert statuses
+const (
+	AlertStatusOpen     = "open"
+	AlertStatusResolved = "resolved"
+)
+
+// Alert event actions
+const (
+	AlertActionTrigger = "trigger"
+	AlertActionResolve = "resolve"
+)
+
+// alertRetention is how long alerts are kept after they were resolved
+const alertRetention = 30 * 24 * time.Hour
+
+// errAlertClosed is returned for an event of an alert closed meanwhile
+var errAlertClosed = errors.New("alert is closed")
+
+// AlertEvent is a problem, or its recovery, reported by a monitoring source
+type AlertEvent struct {
+	IncidentKey string                 `json:"incident_key" binding:"required"` // events of the same problem share it
+	Action      string                 `json:"action"`                          // trigger or resolve, trigger when empty
+	TenantID    string                 `json:"tenant_id"`
+	Title       string                 `json:"title"`
+	Message     string                 `json:"message"`
+	Severity    string                 `json:"severity"` // critical, warning, info
+	Source      string                 `json:"source"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	// The alert is sent to Recipients on the Type channel, or through the
+	// escalation policy PolicyID
+	Type       string   `json:"type"`
+	Recipients []string `json:"recipients"`
+	PolicyID   string   `json:"policy_id,omitempty"`
+	// AutoResolveMinutes resolves the alert once the source has been quiet
+	// that long, for sources that never report recovery
+	AutoResolveMinutes int `json:"auto_resolve_minutes,omitempty"`
+}
+
+// Alert groups the events of an incident key while the problem lasts. Only
+// its first event notifies, repeats are counted.
+type Alert struct {
+	ID                 string                 `json:"id"`
+	TenantID           string                 `json:"tenant_id"`
+	IncidentKey        string                 `json:"incident_key"`
+	Title              string                 `json:"title"`
+	Message            string                 `json:"message"`
+	Severity           string                 `json:"severity"`
+	Source             string                 `json:"source,omitempty"`
+	Details            map[string]interface{} `json:"details,omitempty"` // of the latest event
+	Status             string                 `json:"status"`
+	Type               string                 `json:"type,omitempty"`
+	Recipients         []string               `json:"recipients,omitempty"`
+	PolicyID           string                 `json:"policy_id,omitempty"`
+	EscalationID       string                 `json:"escalation_id,omitempty"`
+	AutoResolveMinutes int                    `json:"auto_resolve_minutes,omitempty"`
+	Occurrences        int                    `json:"occurrences"`
+	Flaps              int                    `json:"flaps"` // times it came back before its recovery was confirmed
+	NotificationIDs    []string               `json:"notification_ids"`
+	FirstSeenAt        time.Time              `json:"first_seen_at"`
+	LastSeenAt         time.Time              `json:"last_seen_at"`
+	ResolvedAt         *time.Time             `json:"resolved_at,omitempty"`
+	ResolvedBy         string                 `json:"resolved_by,omitempty"` // source, auto or the user who resolved it
+	ResolutionSentAt   *time.Time             `json:"resolution_sent_at,omitempty"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+}
+
+// ProcessAlertEvent applies an event to the alert of its incident key. A
+// trigger opens an alert and notifies, or counts a repeat of the open one. A
+// resolve resolves the open alert; its resolution is sent once the problem
+// stayed away for the flap window, a trigger within it reopens the alert
+// without notifying again.
+func (s *OnCallService) ProcessAlertEvent(event AlertEvent) (*Alert, error) {
+	if event.IncidentKey == "" {
+		return nil, invalid(fmt.Errorf("incident key is required"))
+	}
+
+	switch event.Action {
+	case "", AlertActionTrigger:
+		return s.triggerAlert(event)
+	case AlertActionResolve:
+		alertID, err := s.redis.Get(context.Background(), s.getOpenAlertKey(event.TenantID, event.IncidentKey)).Result()
+		if err == redis.Nil {
+			return nil, notFoundf("no open alert for incident key: %s", event.IncidentKey)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get open alert: %w", err)
+		}
+		return s.resolveAlert(alertID, "source", event.Message)
+	}
+
+	return nil, invalid(fmt.Errorf("invalid alert action: %s", event.Action))
+}
+
+// triggerAlert opens the alert of an incident key, or counts the event on
+// the alert already open
+func (s *OnCallService) triggerAlert(event AlertEvent) (*Alert, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	if event.Severity == "" {
+		event.Severity = "critical"
+	}
+	if err := validateAlertEvent(event); err != nil {
+		return nil, invalid(fmt.Errorf("alert validation failed: %w", err))
+	}
+
+	alert := &Alert{
+		ID:                 newID("alert"),
+		TenantID:           event.TenantID,
+		IncidentKey:        event.IncidentKey,
+		Title:              event.Title,
+		Message:            event.Message,
+		Severity:           event.Severity,
+		Source:             event.Source,
+		Details:            event.Details,
+		Status:             AlertStatusOpen,
+		Type:               event.Type,
+		Recipients:         event.Recipients,
+		PolicyID:           event.PolicyID,
+		AutoResolveMinutes: event.AutoResolveMinutes,
+		Occurrences:        1,
+		NotificationIDs:    []string{},
+		FirstSeenAt:        now,
+		LastSeenAt:         now,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	if alert.Message == "" {
+		alert.Message = alert.Title
+	}
+
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal alert: %w", err)
+	}
+	if err := s.redis.Set(ctx, s.getAlertKey(alert.ID), alertJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store alert: %w", err)
+	}
+
+	// Only the first of concurrent events opens the alert, the key points to
+	// stored alerts only
+	openKey := s.getOpenAlertKey(event.TenantID, event.IncidentKey)
+	opened, err := s.redis.SetNX(ctx, openKey, alert.ID, 0).Result()
+	if err != nil || !opened {
+		s.redis.Del(ctx, s.getAlertKey(alert.ID))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open alert: %w", err)
+	}
+	if !opened {
+		alertID, err := s.redis.Get(ctx, openKey).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to get open alert: %w", err)
+		}
+
+		repeated, err := s.repeatAlert(alertID, event)
+		if errors.Is(err, errAlertClosed) || errors.Is(err, ErrNotFound) {
+			// The alert was closed since, the event opens the next one
+			s.releaseOpenAlert(ctx, event.TenantID, event.IncidentKey, alertID)
+			return s.triggerAlert(event)
+		}
+		return repeated, err
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.ZAdd(ctx, s.getAlertsKey(alert.TenantID), &redis.Z{
+		Score:  float64(now.Unix()),
+		Member: alert.ID,
+	})
+	s.scheduleAutoResolve(ctx, pipe, alert)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.redis.Del(ctx, openKey, s.getAlertKey(alert.ID))
+		return nil, fmt.Errorf("failed to index alert: %w", err)
+	}
+
+	log.Info().
+		Str("alertID", alert.ID).
+		Str("incidentKey", alert.IncidentKey).
+		Str("severity", alert.Severity).
+		Msg("Alert opened")
+
+	return s.notifyAlertOpened(alert)
+}
+
+// repeatAlert counts another event of an alert, reopening it when its
+// recovery wasn't confirmed yet
+func (s *OnCallService) repeatAlert(alertID string, event AlertEvent) (*Alert, error) {
+	alert, err := s.updateAlert(alertID, func(alert *Alert) error {
+		if alert.ResolutionSentAt != nil {
+			return errAlertClosed
+		}
+		if alert.Status == AlertStatusResolved {
+			alert.Status = AlertStatusOpen
+			alert.ResolvedAt = nil
+			alert.ResolvedBy = ""
+			alert.Flaps++
+		}
+		alert.Occurrences++
+		alert.LastSeenAt = time.Now()
+		if event.Details != nil {
+			alert.Details = event.Details
+		}
+		if event.AutoResolveMinutes > 0 {
+			alert.AutoResolveMinutes = event.AutoResolveMinutes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.ZRem(ctx, s.getAlertResolutionsDueKey(), alert.ID)
+	s.scheduleAutoResolve(ctx, pipe, alert)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("alertID", alert.ID).Msg("Failed to reschedule alert")
+	}
+
+	log.Debug().
+		Str("alertID", alert.ID).
+		Int("occurrences", alert.Occurrences).
+		Msg("Alert repeat suppressed")
+
+	return alert, nil
+}
+
+// GetAlert gets an alert by ID
+func (s *OnCallService) GetAlert(alertID string) (*Alert, error) {
+	ctx := context.Background()
+
+	alertJSON, err := s.redis.Get(ctx, s.getAlertKey(alertID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("alert not found: %s", alertID)
+		}
+		return nil, fmt.Errorf("failed to get alert: %w", err)
+	}
+
+	var alert Alert
+	if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal alert: %w", err)
+	}
+
+	return &alert, nil
+}
+
+// ListAlerts lists the alerts of a tenant, the newest first, optionally
+// filtered by status
+func (s *OnCallService) ListAlerts(tenantID string, status string, page int, limit int) ([]*Alert, error) {
+	ctx := context.Background()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	ids, err := s.redis.ZRevRange(ctx, s.getAlertsKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+
+	alerts := []*Alert{}
+	var expired []interface{}
+	offset := (page - 1) * limit
+	for _, id := range ids {
+		alert, err := s.GetAlert(id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				expired = append(expired, id)
+			}
+			continue
+		}
+		if status != "" && alert.Status != status {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		alerts = append(alerts, alert)
+		if len(alerts) >= limit {
+			break
+		}
+	}
+
+	if len(expired) > 0 {
+		s.redis.ZRem(ctx, s.getAlertsKey(tenantID), expired...)
+	}
+
+	return alerts, nil
+}
+
+// ResolveAlert resolves an open alert on behalf of a user
+func (s *OnCallService) ResolveAlert(alertID string, userID string) (*Alert, error) {
+	return s.resolveAlert(alertID, userID, "")
+}
+
+// resolveAlert resolves an alert and schedules its resolution notification
+// after the flap window
+func (s *OnCallService) resolveAlert(alertID string, resolvedBy string, message string) (*Alert, error) {
+	alert, err := s.updateAlert(alertID, func(alert *Alert) error {
+		if alert.Status != AlertStatusOpen {
+			return conflictf("alert is already resolved")
+		}
+
+		now := time.Now()
+		alert.Status = AlertStatusResolved
+		alert.ResolvedAt = &now
+		alert.ResolvedBy = resolvedBy
+		if message != "" {
+			alert.Details = copyMetadata(alert.Details)
+			alert.Details["resolution"] = message
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("alertID", alert.ID).
+		Str("resolvedBy", resolvedBy).
+		Msg("Alert resolved")
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.ZRem(ctx, s.getAlertsAutoResolveKey(), alert.ID)
+	pipe.ZAdd(ctx, s.getAlertResolutionsDueKey(), &redis.Z{
+		Score:  float64(alert.ResolvedAt.Add(s.config.AlertFlapWindow).Unix()),
+		Member: alert.ID,
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to schedule alert resolution: %w", err)
+	}
+
+	return alert, nil
+}
+
+// autoResolveAlerts resolves the alerts whose source has been quiet for
+// their auto-resolve time
+func (s *OnCallService) autoResolveAlerts() {
+	ctx := context.Background()
+
+	for _, id := range s.claimDue(ctx, s.getAlertsAutoResolveKey()) {
+		if _, err := s.resolveAlert(id, "auto", ""); err != nil && !errors.Is(err, ErrConflict) && !errors.Is(err, ErrNotFound) {
+			log.Error().Err(err).Str("alertID", id).Msg("Failed to auto-resolve alert")
+		}
+	}
+}
+
+// confirmResolutions sends the resolution of the alerts that stayed
+// resolved for the flap window
+func (s *OnCallService) confirmResolutions() {
+	ctx := context.Background()
+
+	for _, id := range s.claimDue(ctx, s.getAlertResolutionsDueKey()) {
+		s.confirmResolution(id)
+	}
+}
+
+// confirmResolution closes the incident of a resolved alert: the next event
+// of its key opens a new alert. Its escalation is resolved and everyone who
+// heard about the alert hears about the recovery.
+func (s *OnCallService) confirmResolution(alertID string) {
+	ctx := context.Background()
+
+	var confirmed bool
+	alert, err := s.updateAlert(alertID, func(alert *Alert) error {
+		confirmed = false
+		if alert.Status != AlertStatusResolved || alert.ResolutionSentAt != nil {
+			return nil
+		}
+		now := time.Now()
+		alert.ResolutionSentAt = &now
+		confirmed = true
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Str("alertID", alertID).Msg("Failed to confirm alert resolution")
+		return
+	}
+	if !confirmed {
+		return
+	}
+
+	s.releaseOpenAlert(ctx, alert.TenantID, alert.IncidentKey, alert.ID)
+
+	if alert.EscalationID != "" {
+		if _, err := s.ResolveEscalation(alert.EscalationID, alert.ResolvedBy); err != nil && !errors.Is(err, ErrConflict) {
+			log.Warn().Err(err).Str("alertID", alert.ID).Msg("Failed to resolve alert escalation")
+		}
+	}
+
+	s.notifyAlertResolved(alert)
+}
+
+// notifyAlertOpened sends an alert to its recipients, or through its
+// escalation policy
+func (s *OnCallService) notifyAlertOpened(alert *Alert) (*Alert, error) {
+	if alert.PolicyID != "" {
+		escalation, err := s.TriggerEscalation(Escalation{
+			TenantID: alert.TenantID,
+			PolicyID: alert.PolicyID,
+			Title:    alert.Title,
+			Message:  alert.Message,
+			Priority: alertPriority(alert.Severity),
+			Source:   alert.Source,
+			Metadata: map[string]interface{}{
+				"alert_id":     alert.ID,
+				"incident_key": alert.IncidentKey,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to escalate alert: %w", err)
+		}
+		return s.updateAlert(alert.ID, func(alert *Alert) error {
+			alert.EscalationID = escalation.ID
+			return nil
+		})
+	}
+
+	requestID := s.sendAlertNotification(alert, alert.Type, alert.Recipients, alert.Title, alert.Message, alertPriority(alert.Severity))
+	if requestID == "" {
+		return alert, nil
+	}
+	return s.updateAlert(alert.ID, func(alert *Alert) error {
+		alert.NotificationIDs = append(alert.NotificationIDs, requestID)
+		return nil
+	})
+}
+
+// notifyAlertResolved tells the recipients of an alert, or everyone its
+// escalation paged, that the problem is gone
+func (s *OnCallService) notifyAlertResolved(alert *Alert) {
+	// Recipients are paged together, in the locale of the tenant
+	locale := s.notifications.messageLocale(alert.TenantID, "")
+	title := i18n.T(locale, i18n.AlertResolvedTitle, alert.Title)
+	message := i18n.T(locale, i18n.AlertResolvedMessage, alert.Title)
+	if resolution, ok := alert.Details["resolution"].(string); ok && resolution != "" {
+		message += " " + resolution
+	}
+
+	if alert.EscalationID == "" {
+		s.sendAlertNotification(alert, alert.Type, alert.Recipients, title, message, "normal")
+		return
+	}
+
+	escalation, err := s.GetEscalation(alert.EscalationID)
+	if err != nil {
+		log.Warn().Err(err).Str("alertID", alert.ID).Msg("Failed to get alert escalation")
+		return
+	}
+
+	// Recovery is news, not a page: each paged recipient hears once per channel
+	sent := make(map[string]bool)
+	for _, page := range escalation.Pages {
+		if page.Channel == "voice" || sent[page.Channel+"|"+page.Recipient] {
+			continue
+		}
+		sent[page.Channel+"|"+page.Recipient] = true
+		s.sendAlertNotification(alert, page.Channel, []string{page.Recipient}, title, message, "normal")
+	}
+}
+
+// sendAlertNotification sends a notification of an alert, threaded with the
+// other notifications of its incident key. It returns the request ID.
+func (s *OnCallService) sendAlertNotification(alert *Alert, channel string, recipients []string, title string, message string, priority string) string {
+	request := NotificationRequest{
+		ID:         generateNotificationID(),
+		Type:       channel,
+		Recipients: recipients,
+		Subject:    title,
+		Title:      title,
+		Message:    message,
+		Priority:   priority,
+		Category:   "incident",
+		TenantID:   alert.TenantID,
+		ThreadKey:  "alert:" + alert.IncidentKey,
+		Metadata: map[string]interface{}{
+			"alert_id":     alert.ID,
+			"incident_key": alert.IncidentKey,
+			"severity":     alert.Severity,
+		},
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := s.notifications.SendNotification(context.Background(), request); err != nil {
+		log.Error().Err(err).Str("alertID", alert.ID).Msg("Failed to send alert notification")
+	}
+	return request.ID
+}
+
+// releaseOpenAlert frees an incident key for its next alert, if the key
+// still points to the alert
+func (s *OnCallService) releaseOpenAlert(ctx context.Context, tenantID string, incidentKey string, alertID string) {
+	openKey := s.getOpenAlertKey(tenantID, incidentKey)
+	if current, err := s.redis.Get(ctx, openKey).Result(); err == nil && current == alertID {
+		s.redis.Del(ctx, openKey)
+	}
+}
+
+// scheduleAutoResolve queues an alert to resolve once its source is quiet
+func (s *OnCallService) scheduleAutoResolve(ctx context.Context, pipe redis.Pipeliner, alert *Alert) {
+	if alert.AutoResolveMinutes <= 0 {
+		return
+	}
+	pipe.ZAdd(ctx, s.getAlertsAutoResolveKey(), &redis.Z{
+		Score:  float64(alert.LastSeenAt.Add(time.Duration(alert.AutoResolveMinutes) * time.Minute).Unix()),
+		Member: alert.ID,
+	})
+}
+
+// claimDue takes the due members off a schedule, each member is claimed by
+// one instance only
+func (s *OnCallService) claimDue(ctx context.Context, key string) []string {
+	ids, err := s.redis.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil
+	}
+
+	var claimed []string
+	for _, id := range ids {
+		removed, err := s.redis.ZRem(ctx, key, id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+		claimed = append(claimed, id)
+	}
+	return claimed
+}
+
+// updateAlert applies a change to an alert, retrying when another instance
+// changed it concurrently. Confirmed resolutions expire after alertRetention.
+func (s *OnCallService) updateAlert(alertID string, apply func(alert *Alert) error) (*Alert, error) {
+	ctx := context.Background()
+	key := s.getAlertKey(alertID)
+
+	var updated *Alert
+	update := func(tx *redis.Tx) error {
+		alertJSON, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return notFoundf("alert not found: %s", alertID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get alert: %w", err)
+		}
+
+		var alert Alert
+		if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+			return fmt.Errorf("failed to unmarshal alert: %w", err)
+		}
+
+		if err := apply(&alert); err != nil {
+			return err
+		}
+		alert.UpdatedAt = time.Now()
+
+		updatedJSON, err := json.Marshal(alert)
+		if err != nil {
+			return fmt.Errorf("failed to marshal alert: %w", err)
+		}
+
+		ttl := time.Duration(0)
+		if alert.ResolutionSentAt != nil {
+			ttl = alertRetention
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updatedJSON, ttl)
+			return nil
+		})
+		updated = &alert
+		return err
+	}
+
+	for attempt := 0; attempt < maxEscalationUpdateAttempts; attempt++ {
+		err := s.redis.Watch(ctx, update, key)
+		if err == nil {
+			return updated, nil
+		}
+		if err != redis.TxFailedErr {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("failed to update alert: too many concurrent updates")
+}
+
+// validateAlertEvent validates a trigger event
+func validateAlertEvent(event AlertEvent) error {
+	if event.Title == "" {
+		return fmt.Errorf("alert title is required")
+	}
+
+	switch event.Severity {
+	case "critical", "warning", "info":
+	default:
+		return fmt.Errorf("invalid severity: %s", event.Severity)
+	}
+
+	if event.PolicyID == "" {
+		if event.Type == "" || len(event.Recipients) == 0 {
+			return fmt.Errorf("type and recipients are required without an escalation policy")
+		}
+	}
+
+	if event.AutoResolveMinutes < 0 {
+		return fmt.Errorf("auto-resolve time cannot be negative")
+	}
+
+	return nil
+}
+
+// Helper functions
+
+// alertPriority maps the severity of an alert to the priority it is sent with
+func alertPriority(severity string) string {
+	switch severity {
+	case "critical":
+		return "urgent"
+	case "warning":
+		return "high"
+	}
+	return "normal"
+}
+
+// Redis key generators
+func (s *OnCallService) getAlertKey(alertID string) string {
+	return fmt.Sprintf("alert:%s", alertID)
+}
+
+func (s *OnCallService) getAlertsKey(tenantID string) string {
+	if tenantID == "" {
+		return "alerts:global"
+	}
+	return fmt.Sprintf("alerts:%s", tenantID)
+}
+
+func (s *OnCallService) getOpenAlertKey(tenantID string, incidentKey string) string {
+	if tenantID == "" {
+		tenantID = "global"
+	}
+	return fmt.Sprintf("alert_open:%s:%s", tenantID, incidentKey)
+}
+
+func (s *OnCallService) getAlertsAutoResolveKey() string {
+	return "alerts_autoresolve"
+}
+
+func (s *OnCallService) getAlertResolutionsDueKey() string {
+	return "alerts_resolution_due"
+}
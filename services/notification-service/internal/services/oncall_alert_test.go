@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// testAlertEvent is a trigger of a flapping gas sensor, sent in-app to user-1
+func testAlertEvent() AlertEvent {
+	return AlertEvent{
+		IncidentKey: "sensor:gas-3",
+		TenantID:    "tenant-a",
+		Title:       "Gaz sensörü 3 alarm veriyor",
+		Severity:    "critical",
+		Source:      "scada",
+		Type:        "inapp",
+		Recipients:  []string{"user-1"},
+	}
+}
+
+// alertTitles returns the titles of the in-app notifications of user-1
+func alertTitles(t *testing.T, env *integrationEnv) []string {
+	t.Helper()
+
+	notifications, _, err := env.service.inAppService.GetUserNotifications(context.Background(), "user-1", "tenant-a", 1, 50, nil)
+	if err != nil {
+		t.Fatalf("Failed to get notifications: %v", err)
+	}
+	titles := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		titles = append(titles, notification.Title)
+	}
+	return titles
+}
+
+// makeDue moves a member of a schedule to the past, as if its time came
+func makeDue(t *testing.T, env *integrationEnv, key string, member string) {
+	t.Helper()
+
+	if err := env.service.redis.ZAdd(context.Background(), key, &redis.Z{Score: float64(time.Now().Add(-time.Second).Unix()), Member: member}).Err(); err != nil {
+		t.Fatalf("Failed to reschedule %s: %v", member, err)
+	}
+}
+
+func TestRepeatsOfAnOpenAlertAreSuppressed(t *testing.T) {
+	env := newIntegrationEnv(t)
+	oncall := newTestOnCallService(t, env)
+
+	var alert *Alert
+	for i := 0; i < 3; i++ {
+		event := testAlertEvent()
+		event.Details = map[string]interface{}{"ppm": float64(40 + i)}
+
+		repeated, err := oncall.ProcessAlertEvent(event)
+		if err != nil {
+			t.Fatalf("Failed to process event %d: %v", i+1, err)
+		}
+		if alert != nil && repeated.ID != alert.ID {
+			t.Fatalf("Expected repeats to be grouped under %s, got %s", alert.ID, repeated.ID)
+		}
+		alert = repeated
+	}
+
+	if alert.Occurrences != 3 || alert.Status != AlertStatusOpen || alert.Details["ppm"] != float64(42) {
+		t.Errorf("Expected 3 occurrences with the latest details, got %d %v", alert.Occurrences, alert.Details)
+	}
+	if len(alert.NotificationIDs) != 1 {
+		t.Errorf("Expected only the first event to notify, got %v", alert.NotificationIDs)
+	}
+	eventually(t, "the alert notification", func() bool { return len(alertTitles(t, env)) == 1 })
+
+	// Other incident keys, and the same key of another tenant, are other alerts
+	other := testAlertEvent()
+	other.IncidentKey = "sensor:gas-4"
+	otherTenant := testAlertEvent()
+	otherTenant.TenantID = "tenant-b"
+	for name, event := range map[string]AlertEvent{"other key": other, "other tenant": otherTenant} {
+		separate, err := oncall.ProcessAlertEvent(event)
+		if err != nil {
+			t.Fatalf("%s: failed to process event: %v", name, err)
+		}
+		if separate.ID == alert.ID || separate.Occurrences != 1 {
+			t.Errorf("%s: expected a new alert, got %s with %d occurrences", name, separate.ID, separate.Occurrences)
+		}
+	}
+
+	alerts, err := oncall.ListAlerts("tenant-a", AlertStatusOpen, 1, 20)
+	if err != nil || len(alerts) != 2 {
+		t.Errorf("Expected the 2 open alerts of the tenant, got %d (%v)", len(alerts), err)
+	}
+}
+
+func TestResolutionsAreSentOnceTheAlertStaysAway(t *testing.T) {
+	env := newIntegrationEnv(t)
+	oncall := newTestOnCallService(t, env)
+
+	alert, err := oncall.ProcessAlertEvent(testAlertEvent())
+	if err != nil {
+		t.Fatalf("Failed to open alert: %v", err)
+	}
+
+	resolve := testAlertEvent()
+	resolve.Action = AlertActionResolve
+	resolve.Message = "Değer normale döndü."
+	resolved, err := oncall.ProcessAlertEvent(resolve)
+	if err != nil {
+		t.Fatalf("Failed to resolve alert: %v", err)
+	}
+	if resolved.Status != AlertStatusResolved || resolved.ResolvedBy != "source" || resolved.ResolutionSentAt != nil {
+		t.Errorf("Expected the alert to be resolved by its source, pending confirmation, got %+v", resolved)
+	}
+
+	// The sensor flaps back within the window: the alert reopens silently
+	reopened, err := oncall.ProcessAlertEvent(testAlertEvent())
+	if err != nil {
+		t.Fatalf("Failed to reopen alert: %v", err)
+	}
+	if reopened.ID != alert.ID || reopened.Status != AlertStatusOpen || reopened.Flaps != 1 || reopened.ResolvedAt != nil {
+		t.Errorf("Expected the alert to reopen as a flap, got %+v", reopened)
+	}
+	if due := env.service.redis.ZScore(context.Background(), oncall.getAlertResolutionsDueKey(), alert.ID).Err(); due != redis.Nil {
+		t.Errorf("Expected the pending resolution to be cancelled, got %v", due)
+	}
+
+	if _, err := oncall.ProcessAlertEvent(resolve); err != nil {
+		t.Fatalf("Failed to resolve alert: %v", err)
+	}
+	makeDue(t, env, oncall.getAlertResolutionsDueKey(), alert.ID)
+	oncall.confirmResolutions()
+
+	confirmed, err := oncall.GetAlert(alert.ID)
+	if err != nil {
+		t.Fatalf("Failed to get alert: %v", err)
+	}
+	if confirmed.ResolutionSentAt == nil || len(confirmed.NotificationIDs) != 1 {
+		t.Errorf("Expected the resolution to be confirmed, got %+v", confirmed)
+	}
+	eventually(t, "the resolution notification", func() bool { return len(alertTitles(t, env)) == 2 })
+	if titles := alertTitles(t, env); titles[0] != "Çözüldü: Gaz sensörü 3 alarm veriyor" {
+		t.Errorf("Expected the resolution to follow the alert, got %v", titles)
+	}
+
+	// Confirming again sends nothing more
+	makeDue(t, env, oncall.getAlertResolutionsDueKey(), alert.ID)
+	oncall.confirmResolutions()
+	if titles := alertTitles(t, env); len(titles) != 2 {
+		t.Errorf("Expected the resolution to be sent once, got %v", titles)
+	}
+
+	// The next event of the key is a new problem
+	next, err := oncall.ProcessAlertEvent(testAlertEvent())
+	if err != nil {
+		t.Fatalf("Failed to open alert: %v", err)
+	}
+	if next.ID == alert.ID || next.Occurrences != 1 {
+		t.Errorf("Expected a new alert after the resolution, got %+v", next)
+	}
+	eventually(t, "the notification of the new alert", func() bool { return len(alertTitles(t, env)) == 3 })
+}
+
+func TestQuietAlertsResolveThemselves(t *testing.T) {
+	env := newIntegrationEnv(t)
+	oncall := newTestOnCallService(t, env)
+	ctx := context.Background()
+
+	event := testAlertEvent()
+	event.AutoResolveMinutes = 10
+	alert, err := oncall.ProcessAlertEvent(event)
+	if err != nil {
+		t.Fatalf("Failed to open alert: %v", err)
+	}
+
+	scheduled := func() time.Time {
+		score, err := env.service.redis.ZScore(ctx, oncall.getAlertsAutoResolveKey(), alert.ID).Result()
+		if err != nil {
+			t.Fatalf("Expected the alert to be scheduled to resolve: %v", err)
+		}
+		return time.Unix(int64(score), 0)
+	}
+	if at := scheduled(); at.Before(alert.LastSeenAt.Add(10*time.Minute - time.Second)) {
+		t.Errorf("Expected the alert to resolve 10 minutes after it was last seen, got %v", at)
+	}
+
+	// Repeats push the auto-resolution back
+	makeDue(t, env, oncall.getAlertsAutoResolveKey(), alert.ID)
+	if _, err := oncall.ProcessAlertEvent(event); err != nil {
+		t.Fatalf("Failed to repeat alert: %v", err)
+	}
+	if at := scheduled(); !at.After(time.Now()) {
+		t.Errorf("Expected the repeat to reschedule the auto-resolution, got %v", at)
+	}
+
+	makeDue(t, env, oncall.getAlertsAutoResolveKey(), alert.ID)
+	oncall.autoResolveAlerts()
+	resolved, err := oncall.GetAlert(alert.ID)
+	if err != nil || resolved.Status != AlertStatusResolved || resolved.ResolvedBy != "auto" {
+		t.Errorf("Expected the quiet alert to resolve itself, got %+v (%v)", resolved, err)
+	}
+	if _, err := env.service.redis.ZScore(ctx, oncall.getAlertResolutionsDueKey(), alert.ID).Result(); err != nil {
+		t.Errorf("Expected the resolution to wait for the flap window: %v", err)
+	}
+}
+
+func TestAlertEventsAreValidated(t *testing.T) {
+	env := newIntegrationEnv(t)
+	oncall := newTestOnCallService(t, env)
+
+	for name, test := range map[string]struct {
+		change   func(event *AlertEvent)
+		expected error
+	}{
+		"no incident key":       {func(event *AlertEvent) { event.IncidentKey = "" }, ErrValidation},
+		"unknown action":        {func(event *AlertEvent) { event.Action = "acknowledge" }, ErrValidation},
+		"no title":              {func(event *AlertEvent) { event.Title = "" }, ErrValidation},
+		"unknown severity":      {func(event *AlertEvent) { event.Severity = "fatal" }, ErrValidation},
+		"no recipients":         {func(event *AlertEvent) { event.Recipients = nil }, ErrValidation},
+		"negative auto-resolve": {func(event *AlertEvent) { event.AutoResolveMinutes = -1 }, ErrValidation},
+		"resolve of nothing":    {func(event *AlertEvent) { event.Action = AlertActionResolve }, ErrNotFound},
+	} {
+		event := testAlertEvent()
+		test.change(&event)
+		if _, err := oncall.ProcessAlertEvent(event); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, err)
+		}
+	}
+
+	alert, err := oncall.ProcessAlertEvent(testAlertEvent())
+	if err != nil {
+		t.Fatalf("Failed to open alert: %v", err)
+	}
+	if alert.Severity != "critical" || alert.Message != alert.Title {
+		t.Errorf("Expected alerts to default to critical with their title as message, got %+v", alert)
+	}
+	if _, err := oncall.ResolveAlert(alert.ID, "user-1"); err != nil {
+		t.Fatalf("Failed to resolve alert: %v", err)
+	}
+	if _, err := oncall.ResolveAlert(alert.ID, "user-1"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected resolving twice to conflict, got %v", err)
+	}
+}
@@ -0,0 +1,835 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Escalation statuses
+const (
+	EscalationStatusTriggered    = "triggered"
+	EscalationStatusAcknowledged = "acknowledged"
+	EscalationStatusResolved     = "resolved"
+	EscalationStatusExhausted    = "exhausted" // every level was paged, nobody acknowledged
+)
+
+// Escalation target types
+const (
+	EscalationTargetUser     = "user"
+	EscalationTargetSchedule = "schedule" // whoever is on call when the level is paged
+	EscalationTargetGroup    = "group"
+	EscalationTargetRole     = "role"
+)
+
+// escalationRetention is how long finished escalations are kept
+const escalationRetention = 30 * 24 * time.Hour
+
+// maxEscalationUpdateAttempts bounds the retries of an escalation update
+// racing with another instance
+const maxEscalationUpdateAttempts = 5
+
+// errEscalationFinished stops an update of an escalation that was
+// acknowledged or resolved in the meantime
+var errEscalationFinished = errors.New("escalation is no longer triggered")
+
+// EscalationPolicy pages its levels one after the other until someone
+// acknowledges, waiting DelayMinutes at each level
+type EscalationPolicy struct {
+	ID        string            `json:"id"`
+	TenantID  string            `json:"tenant_id"`
+	Name      string            `json:"name"`
+	Team      string            `json:"team,omitempty"`
+	Levels    []EscalationLevel `json:"levels"`
+	Repeat    int               `json:"repeat"` // times the chain starts over when the last level didn't acknowledge
+	CreatedBy string            `json:"created_by"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// EscalationLevel is a step of an escalation policy
+type EscalationLevel struct {
+	Targets      []EscalationTarget `json:"targets"`
+	Channels     []string           `json:"channels,omitempty"` // push and sms when empty
+	DelayMinutes int                `json:"delay_minutes"`      // wait for an acknowledgment before the next level
+}
+
+// EscalationTarget is who a level pages
+type EscalationTarget struct {
+	Type string `json:"type"` // user, schedule, group, role
+	ID   string `json:"id"`
+}
+
+// Escalation is an alert climbing the levels of a policy
+type Escalation struct {
+	ID               string                 `json:"id"`
+	TenantID         string                 `json:"tenant_id"`
+	PolicyID         string                 `json:"policy_id"`
+	Title            string                 `json:"title"`
+	Message          string                 `json:"message"`
+	Priority         string                 `json:"priority"`
+	Source           string                 `json:"source,omitempty"` // the system that raised the alert
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	Status           string                 `json:"status"`
+	Level            int                    `json:"level"` // index of the level paged last
+	Round            int                    `json:"round"`
+	Pages            []EscalationPage       `json:"pages"`
+	NextEscalationAt *time.Time             `json:"next_escalation_at,omitempty"`
+	AcknowledgedBy   string                 `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt   *time.Time             `json:"acknowledged_at,omitempty"`
+	ResolvedBy       string                 `json:"resolved_by,omitempty"`
+	ResolvedAt       *time.Time             `json:"resolved_at,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+}
+
+// EscalationPage is a notification sent for an escalation
+type EscalationPage struct {
+	Level     int       `json:"level"`
+	Round     int       `json:"round"`
+	Recipient string    `json:"recipient"`
+	Channel   string    `json:"channel"`
+	RequestID string    `json:"request_id"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	PagedAt   time.Time `json:"paged_at"`
+}
+
+// CreatePolicy creates an escalation policy
+func (s *OnCallService) CreatePolicy(policy EscalationPolicy) (*EscalationPolicy, error) {
+	log.Info().
+		Str("name", policy.Name).
+		Str("tenantID", policy.TenantID).
+		Msg("Creating escalation policy")
+
+	if err := s.validatePolicy(policy); err != nil {
+		return nil, invalid(fmt.Errorf("policy validation failed: %w", err))
+	}
+
+	policy.ID = newID("policy")
+	policy.CreatedAt = time.Now()
+	policy.UpdatedAt = policy.CreatedAt
+
+	if err := s.storePolicy(&policy); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := s.redis.ZAdd(ctx, s.getPoliciesKey(policy.TenantID), &redis.Z{
+		Score:  float64(policy.CreatedAt.Unix()),
+		Member: policy.ID,
+	}).Err(); err != nil {
+		return nil, fmt.Errorf("failed to index policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// GetPolicy gets an escalation policy by ID
+func (s *OnCallService) GetPolicy(policyID string) (*EscalationPolicy, error) {
+	ctx := context.Background()
+
+	policyJSON, err := s.redis.Get(ctx, s.getPolicyKey(policyID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("escalation policy not found: %s", policyID)
+		}
+		return nil, fmt.Errorf("failed to get escalation policy: %w", err)
+	}
+
+	var policy EscalationPolicy
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal escalation policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// ListPolicies lists the escalation policies of a tenant, optionally of a
+// single team
+func (s *OnCallService) ListPolicies(tenantID string, team string) ([]*EscalationPolicy, error) {
+	ctx := context.Background()
+
+	ids, err := s.redis.ZRange(ctx, s.getPoliciesKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list escalation policies: %w", err)
+	}
+
+	policies := []*EscalationPolicy{}
+	for _, id := range ids {
+		policy, err := s.GetPolicy(id)
+		if err != nil {
+			continue
+		}
+		if team != "" && policy.Team != team {
+			continue
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// UpdatePolicy replaces the fields of a policy that are set in updates.
+// Running escalations follow the new levels from their next step on.
+func (s *OnCallService) UpdatePolicy(policyID string, updates EscalationPolicy) (*EscalationPolicy, error) {
+	policy, err := s.GetPolicy(policyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Name != "" {
+		policy.Name = updates.Name
+	}
+	if updates.Team != "" {
+		policy.Team = updates.Team
+	}
+	if updates.Levels != nil {
+		policy.Levels = updates.Levels
+		policy.Repeat = updates.Repeat
+	}
+
+	if err := s.validatePolicy(*policy); err != nil {
+		return nil, invalid(fmt.Errorf("policy validation failed: %w", err))
+	}
+
+	policy.UpdatedAt = time.Now()
+	if err := s.storePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// DeletePolicy deletes an escalation policy. Running escalations of the
+// policy stop at their next step.
+func (s *OnCallService) DeletePolicy(policyID string) error {
+	policy, err := s.GetPolicy(policyID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, s.getPolicyKey(policyID))
+	pipe.ZRem(ctx, s.getPoliciesKey(policy.TenantID), policyID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete escalation policy: %w", err)
+	}
+
+	return nil
+}
+
+// TriggerEscalation raises an alert, paging the first level of its policy
+// right away
+func (s *OnCallService) TriggerEscalation(escalation Escalation) (*Escalation, error) {
+	log.Info().
+		Str("policyID", escalation.PolicyID).
+		Str("tenantID", escalation.TenantID).
+		Str("title", escalation.Title).
+		Msg("Triggering escalation")
+
+	if escalation.Title == "" {
+		return nil, invalid(fmt.Errorf("escalation title is required"))
+	}
+
+	policy, err := s.GetPolicy(escalation.PolicyID)
+	if err != nil {
+		return nil, err
+	}
+	if policy.TenantID != escalation.TenantID {
+		return nil, notFoundf("escalation policy not found: %s", escalation.PolicyID)
+	}
+
+	now := time.Now()
+	escalation.ID = newID("escalation")
+	escalation.Status = EscalationStatusTriggered
+	escalation.Level = 0
+	escalation.Round = 0
+	escalation.Pages = []EscalationPage{}
+	escalation.NextEscalationAt = nil
+	escalation.AcknowledgedBy = ""
+	escalation.AcknowledgedAt = nil
+	escalation.ResolvedBy = ""
+	escalation.ResolvedAt = nil
+	escalation.CreatedAt = now
+	escalation.UpdatedAt = now
+	if escalation.Message == "" {
+		escalation.Message = escalation.Title
+	}
+	if escalation.Priority == "" {
+		escalation.Priority = "urgent"
+	}
+
+	escalationJSON, err := json.Marshal(escalation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal escalation: %w", err)
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getEscalationKey(escalation.ID), escalationJSON, 0)
+	pipe.ZAdd(ctx, s.getEscalationsKey(escalation.TenantID), &redis.Z{
+		Score:  float64(now.Unix()),
+		Member: escalation.ID,
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store escalation: %w", err)
+	}
+
+	s.publishEscalation(&escalation, "escalation.triggered")
+
+	return s.pageLevel(&escalation, policy)
+}
+
+// GetEscalation gets an escalation by ID
+func (s *OnCallService) GetEscalation(escalationID string) (*Escalation, error) {
+	ctx := context.Background()
+
+	escalationJSON, err := s.redis.Get(ctx, s.getEscalationKey(escalationID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("escalation not found: %s", escalationID)
+		}
+		return nil, fmt.Errorf("failed to get escalation: %w", err)
+	}
+
+	var escalation Escalation
+	if err := json.Unmarshal([]byte(escalationJSON), &escalation); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal escalation: %w", err)
+	}
+
+	return &escalation, nil
+}
+
+// ListEscalations lists the escalations of a tenant, the newest first,
+// optionally filtered by status
+func (s *OnCallService) ListEscalations(tenantID string, status string, page int, limit int) ([]*Escalation, error) {
+	ctx := context.Background()
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	ids, err := s.redis.ZRevRange(ctx, s.getEscalationsKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list escalations: %w", err)
+	}
+
+	escalations := []*Escalation{}
+	var expired []interface{}
+	offset := (page - 1) * limit
+	for _, id := range ids {
+		escalation, err := s.GetEscalation(id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				expired = append(expired, id)
+			}
+			continue
+		}
+		if status != "" && escalation.Status != status {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		escalations = append(escalations, escalation)
+		if len(escalations) >= limit {
+			break
+		}
+	}
+
+	if len(expired) > 0 {
+		s.redis.ZRem(ctx, s.getEscalationsKey(tenantID), expired...)
+	}
+
+	return escalations, nil
+}
+
+// AcknowledgeEscalation stops an escalation, someone is on it. Repeated
+// acknowledgments return the first one.
+func (s *OnCallService) AcknowledgeEscalation(escalationID string, userID string) (*Escalation, error) {
+	var first bool
+	escalation, err := s.updateEscalation(escalationID, func(escalation *Escalation) error {
+		first = false
+		switch escalation.Status {
+		case EscalationStatusAcknowledged:
+			return nil
+		case EscalationStatusTriggered:
+		default:
+			return conflictf("cannot acknowledge escalation with status: %s", escalation.Status)
+		}
+
+		now := time.Now()
+		escalation.Status = EscalationStatusAcknowledged
+		escalation.AcknowledgedBy = userID
+		escalation.AcknowledgedAt = &now
+		escalation.NextEscalationAt = nil
+		first = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		return escalation, nil
+	}
+
+	log.Info().
+		Str("escalationID", escalationID).
+		Str("userID", userID).
+		Int("level", escalation.Level).
+		Msg("Escalation acknowledged")
+
+	s.publishEscalation(escalation, "escalation.acknowledged")
+	return escalation, nil
+}
+
+// ResolveEscalation closes an escalation, acknowledged or not
+func (s *OnCallService) ResolveEscalation(escalationID string, userID string) (*Escalation, error) {
+	escalation, err := s.updateEscalation(escalationID, func(escalation *Escalation) error {
+		if escalation.Status == EscalationStatusResolved {
+			return conflictf("escalation is already resolved")
+		}
+
+		now := time.Now()
+		escalation.Status = EscalationStatusResolved
+		escalation.ResolvedBy = userID
+		escalation.ResolvedAt = &now
+		escalation.NextEscalationAt = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("escalationID", escalationID).
+		Str("userID", userID).
+		Msg("Escalation resolved")
+
+	s.publishEscalation(escalation, "escalation.resolved")
+	return escalation, nil
+}
+
+// acknowledgeFromNotification acknowledges the escalation a page belongs to
+// when its recipient acknowledged the notification
+func (s *OnCallService) acknowledgeFromNotification(ack *Acknowledgment) {
+	ctx := context.Background()
+
+	for _, requestID := range []string{ack.ParentRequestID, ack.RequestID} {
+		if requestID == "" {
+			continue
+		}
+
+		escalationID, err := s.redis.Get(ctx, s.getEscalationRequestKey(requestID)).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("requestID", requestID).Msg("Failed to look up escalation of page")
+			return
+		}
+
+		if _, err := s.AcknowledgeEscalation(escalationID, ack.Subject); err != nil && !errors.Is(err, ErrConflict) {
+			log.Error().Err(err).Str("escalationID", escalationID).Msg("Failed to acknowledge escalation")
+		}
+		return
+	}
+}
+
+// advanceDueEscalations pages the next level of every escalation whose wait
+// for an acknowledgment is over
+func (s *OnCallService) advanceDueEscalations() {
+	ctx := context.Background()
+
+	for _, id := range s.claimDue(ctx, s.getEscalationsDueKey()) {
+		if err := s.escalate(id); err != nil {
+			log.Error().Err(err).Str("escalationID", id).Msg("Failed to escalate")
+		}
+	}
+}
+
+// escalate moves an unacknowledged escalation to the next level of its
+// policy, starting over while repeats are left
+func (s *OnCallService) escalate(escalationID string) error {
+	escalation, err := s.GetEscalation(escalationID)
+	if err != nil {
+		return err
+	}
+	if escalation.Status != EscalationStatusTriggered {
+		return nil
+	}
+
+	policy, policyErr := s.GetPolicy(escalation.PolicyID)
+
+	escalation, err = s.updateEscalation(escalationID, func(escalation *Escalation) error {
+		if escalation.Status != EscalationStatusTriggered {
+			return errEscalationFinished
+		}
+
+		escalation.NextEscalationAt = nil
+		if policyErr != nil {
+			escalation.Status = EscalationStatusExhausted
+			return nil
+		}
+
+		escalation.Level++
+		if escalation.Level >= len(policy.Levels) {
+			if escalation.Round >= policy.Repeat {
+				escalation.Status = EscalationStatusExhausted
+				return nil
+			}
+			escalation.Round++
+			escalation.Level = 0
+		}
+		return nil
+	})
+	if errors.Is(err, errEscalationFinished) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if escalation.Status == EscalationStatusExhausted {
+		log.Warn().
+			Str("escalationID", escalationID).
+			Str("policyID", escalation.PolicyID).
+			Msg("Escalation exhausted without acknowledgment")
+		s.publishEscalation(escalation, "escalation.exhausted")
+		return nil
+	}
+
+	_, err = s.pageLevel(escalation, policy)
+	return err
+}
+
+// pageLevel notifies the targets of the current level of an escalation on
+// every channel of the level, and schedules the next step
+func (s *OnCallService) pageLevel(escalation *Escalation, policy *EscalationPolicy) (*Escalation, error) {
+	ctx := context.Background()
+	level := policy.Levels[escalation.Level]
+
+	channels := level.Channels
+	if len(channels) == 0 {
+		channels = []string{"push", "sms"}
+	}
+
+	var pages []EscalationPage
+	for _, recipient := range s.resolveTargets(escalation.TenantID, level.Targets) {
+		for _, channel := range channels {
+			request := NotificationRequest{
+				ID:         generateNotificationID(),
+				Type:       channel,
+				Recipients: []string{recipient},
+				Subject:    escalation.Title,
+				Title:      escalation.Title,
+				Message:    escalation.Message,
+				Priority:   escalation.Priority,
+				Category:   "incident",
+				TenantID:   escalation.TenantID,
+				RequireAck: true,
+				Metadata: map[string]interface{}{
+					"escalation_id":    escalation.ID,
+					"escalation_level": escalation.Level,
+					"escalation_round": escalation.Round,
+				},
+				CreatedAt: time.Now(),
+			}
+
+			// Indexed before sending, acknowledgments can come back right away
+			if err := s.redis.Set(ctx, s.getEscalationRequestKey(request.ID), escalation.ID, escalationRetention).Err(); err != nil {
+				log.Warn().Err(err).Str("escalationID", escalation.ID).Msg("Failed to index escalation page")
+			}
+
+			page := EscalationPage{
+				Level:     escalation.Level,
+				Round:     escalation.Round,
+				Recipient: recipient,
+				Channel:   channel,
+				RequestID: request.ID,
+				Status:    "failed",
+				PagedAt:   time.Now(),
+			}
+
+			result, err := s.notifications.SendNotification(ctx, request)
+			if result != nil {
+				page.Status = result.Status
+				page.Error = result.Error
+			}
+			if err != nil {
+				page.Error = err.Error()
+			}
+			pages = append(pages, page)
+		}
+	}
+
+	if len(pages) == 0 {
+		log.Warn().
+			Str("escalationID", escalation.ID).
+			Int("level", escalation.Level).
+			Msg("Escalation level has nobody to page")
+	}
+
+	next := time.Now().Add(time.Duration(level.DelayMinutes) * time.Minute)
+	pagedLevel, pagedRound := escalation.Level, escalation.Round
+
+	updated, err := s.updateEscalation(escalation.ID, func(escalation *Escalation) error {
+		escalation.Pages = append(escalation.Pages, pages...)
+		if escalation.Status == EscalationStatusTriggered && escalation.Level == pagedLevel && escalation.Round == pagedRound {
+			escalation.NextEscalationAt = &next
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.NextEscalationAt != nil {
+		if err := s.redis.ZAdd(ctx, s.getEscalationsDueKey(), &redis.Z{
+			Score:  float64(next.Unix()),
+			Member: escalation.ID,
+		}).Err(); err != nil {
+			return nil, fmt.Errorf("failed to schedule escalation: %w", err)
+		}
+	}
+
+	log.Info().
+		Str("escalationID", escalation.ID).
+		Int("level", pagedLevel).
+		Int("round", pagedRound).
+		Int("pages", len(pages)).
+		Msg("Escalation level paged")
+
+	return updated, nil
+}
+
+// resolveTargets turns the targets of a level into recipient references,
+// schedules into whoever is on call now
+func (s *OnCallService) resolveTargets(tenantID string, targets []EscalationTarget) []string {
+	var recipients []string
+	seen := make(map[string]bool)
+
+	for _, target := range targets {
+		var recipient string
+		switch target.Type {
+		case EscalationTargetUser:
+			recipient = RecipientPrefixUser + target.ID
+		case EscalationTargetGroup:
+			recipient = RecipientPrefixGroup + target.ID
+		case EscalationTargetRole:
+			recipient = RecipientPrefixRole + target.ID
+		case EscalationTargetSchedule:
+			shift, err := s.WhoIsOnCall(target.ID, time.Now())
+			if err != nil {
+				log.Warn().Err(err).Str("scheduleID", target.ID).Msg("Failed to find who is on call")
+				continue
+			}
+			if shift == nil {
+				log.Warn().Str("scheduleID", target.ID).Msg("Nobody is on call")
+				continue
+			}
+			recipient = RecipientPrefixUser + shift.UserID
+		}
+
+		if recipient != "" && !seen[recipient] {
+			seen[recipient] = true
+			recipients = append(recipients, recipient)
+		}
+	}
+
+	return recipients
+}
+
+// updateEscalation applies a change to an escalation, retrying when another
+// instance changed it concurrently. Finished escalations expire after
+// escalationRetention and leave the due set.
+func (s *OnCallService) updateEscalation(escalationID string, apply func(escalation *Escalation) error) (*Escalation, error) {
+	ctx := context.Background()
+	key := s.getEscalationKey(escalationID)
+
+	var updated *Escalation
+	update := func(tx *redis.Tx) error {
+		escalationJSON, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return notFoundf("escalation not found: %s", escalationID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get escalation: %w", err)
+		}
+
+		var escalation Escalation
+		if err := json.Unmarshal([]byte(escalationJSON), &escalation); err != nil {
+			return fmt.Errorf("failed to unmarshal escalation: %w", err)
+		}
+
+		if err := apply(&escalation); err != nil {
+			return err
+		}
+		escalation.UpdatedAt = time.Now()
+
+		updatedJSON, err := json.Marshal(escalation)
+		if err != nil {
+			return fmt.Errorf("failed to marshal escalation: %w", err)
+		}
+
+		ttl := time.Duration(0)
+		if escalation.Status != EscalationStatusTriggered {
+			ttl = escalationRetention
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updatedJSON, ttl)
+			if ttl != 0 {
+				pipe.ZRem(ctx, s.getEscalationsDueKey(), escalationID)
+			}
+			return nil
+		})
+		updated = &escalation
+		return err
+	}
+
+	for attempt := 0; attempt < maxEscalationUpdateAttempts; attempt++ {
+		err := s.redis.Watch(ctx, update, key)
+		if err == nil {
+			return updated, nil
+		}
+		if err != redis.TxFailedErr {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("failed to update escalation: too many concurrent updates")
+}
+
+// publishEscalation tells subscribers how an escalation changed
+func (s *OnCallService) publishEscalation(escalation *Escalation, eventType string) {
+	event := WebhookEvent{
+		ID:       generateWebhookID(),
+		Type:     eventType,
+		Source:   "notification-service",
+		UserID:   escalation.AcknowledgedBy,
+		TenantID: escalation.TenantID,
+		Data: map[string]interface{}{
+			"escalation_id": escalation.ID,
+			"policy_id":     escalation.PolicyID,
+			"title":         escalation.Title,
+			"status":        escalation.Status,
+			"level":         escalation.Level,
+			"round":         escalation.Round,
+			"source":        escalation.Source,
+		},
+		Timestamp: escalation.UpdatedAt,
+		Priority:  escalation.Priority,
+		CreatedAt: time.Now(),
+	}
+	s.notifications.emitEvent(event)
+}
+
+// validatePolicy validates an escalation policy
+func (s *OnCallService) validatePolicy(policy EscalationPolicy) error {
+	if policy.Name == "" {
+		return fmt.Errorf("policy name is required")
+	}
+
+	if len(policy.Levels) == 0 {
+		return fmt.Errorf("at least one level is required")
+	}
+
+	if policy.Repeat < 0 || policy.Repeat > 10 {
+		return fmt.Errorf("repeat must be between 0 and 10")
+	}
+
+	for i, level := range policy.Levels {
+		if len(level.Targets) == 0 {
+			return fmt.Errorf("level %d has no targets", i+1)
+		}
+		if level.DelayMinutes < 1 {
+			return fmt.Errorf("level %d must wait at least a minute", i+1)
+		}
+
+		for _, target := range level.Targets {
+			if target.ID == "" {
+				return fmt.Errorf("level %d has a target without ID", i+1)
+			}
+			switch target.Type {
+			case EscalationTargetUser, EscalationTargetGroup, EscalationTargetRole:
+			case EscalationTargetSchedule:
+				schedule, err := s.GetSchedule(target.ID)
+				if err != nil || schedule.TenantID != policy.TenantID {
+					return fmt.Errorf("level %d pages an unknown schedule: %s", i+1, target.ID)
+				}
+			default:
+				return fmt.Errorf("level %d has an invalid target type: %s", i+1, target.Type)
+			}
+		}
+
+		for _, channel := range level.Channels {
+			switch channel {
+			case "email", "sms", "push", "inapp", "voice":
+			default:
+				return fmt.Errorf("level %d has an unsupported channel: %s", i+1, channel)
+			}
+		}
+	}
+
+	return nil
+}
+
+// storePolicy stores an escalation policy
+func (s *OnCallService) storePolicy(policy *EscalationPolicy) error {
+	ctx := context.Background()
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal escalation policy: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getPolicyKey(policy.ID), policyJSON, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store escalation policy: %w", err)
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *OnCallService) getPolicyKey(policyID string) string {
+	return fmt.Sprintf("escalation_policy:%s", policyID)
+}
+
+func (s *OnCallService) getPoliciesKey(tenantID string) string {
+	if tenantID == "" {
+		return "escalation_policies:global"
+	}
+	return fmt.Sprintf("escalation_policies:%s", tenantID)
+}
+
+func (s *OnCallService) getEscalationKey(escalationID string) string {
+	return fmt.Sprintf("escalation:%s", escalationID)
+}
+
+func (s *OnCallService) getEscalationsKey(tenantID string) string {
+	if tenantID == "" {
+		return "escalations:global"
+	}
+	return fmt.Sprintf("escalations:%s", tenantID)
+}
+
+func (s *OnCallService) getEscalationsDueKey() string {
+	return "escalations_due"
+}
+
+func (s *OnCallService) getEscalationRequestKey(requestID string) string {
+	return fmt.Sprintf("escalation_request:%s", requestID)
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestOnCallService returns an on-call service on the Redis of env. Its
+// escalator doesn't tick during the test, escalations advance when told to.
+func newTestOnCallService(t *testing.T, env *integrationEnv) *OnCallService {
+	t.Helper()
+
+	service, err := NewOnCallService(OnCallConfig{
+		RedisURL:     "redis://" + env.service.redis.Options().Addr,
+		TickInterval: time.Hour,
+	}, env.service)
+	if err != nil {
+		t.Fatalf("Failed to create on-call service: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		service.Shutdown(ctx)
+	})
+	return service
+}
+
+func TestRotationsHandTheShiftOn(t *testing.T) {
+	// Monday 5 January 2026, 08:00 in Istanbul
+	location, err := time.LoadLocation(defaultOnCallTimeZone)
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+	start := time.Date(2026, time.January, 5, 8, 0, 0, 0, location)
+
+	daily := OnCallRotation{Name: "daily", Participants: []string{"ayse", "mehmet", "zeynep"}, Start: start, ShiftHours: 24}
+	nights := OnCallRotation{
+		Name:         "nights",
+		Participants: []string{"ali"},
+		Start:        start,
+		ShiftHours:   168,
+		Restrictions: []OnCallRestriction{{Start: "18:00", End: "08:00"}},
+	}
+	fridayNight := OnCallRotation{
+		Name:         "friday",
+		Participants: []string{"elif"},
+		Start:        start,
+		ShiftHours:   168,
+		Restrictions: []OnCallRestriction{{Days: []int{int(time.Friday)}, Start: "18:00", End: "08:00"}},
+	}
+
+	for name, test := range map[string]struct {
+		rotation OnCallRotation
+		at       time.Time
+		userID   string // empty when nobody is on call
+	}{
+		"before the start":          {daily, start.Add(-time.Minute), ""},
+		"first shift":               {daily, start, "ayse"},
+		"second shift":              {daily, start.Add(25 * time.Hour), "mehmet"},
+		"last shift":                {daily, start.Add(71 * time.Hour), "zeynep"},
+		"back to the first":         {daily, start.Add(72 * time.Hour), "ayse"},
+		"evening in the window":     {nights, start.Add(15 * time.Hour), "ali"},
+		"morning in the window":     {nights, start.Add(23*time.Hour + 59*time.Minute), "ali"},
+		"noon outside the window":   {nights, start.Add(4 * time.Hour), ""},
+		"window end is exclusive":   {nights, start.Add(24 * time.Hour), ""},
+		"friday night":              {fridayNight, start.Add(4*24*time.Hour + 14*time.Hour), "elif"},
+		"saturday morning":          {fridayNight, start.Add(5*24*time.Hour - time.Hour), "elif"},
+		"saturday night":            {fridayNight, start.Add(5*24*time.Hour + 14*time.Hour), ""},
+		"thursday night":            {fridayNight, start.Add(3*24*time.Hour + 14*time.Hour), ""},
+		"restrictions in time zone": {nights, time.Date(2026, time.January, 6, 16, 0, 0, 0, time.UTC), "ali"},
+	} {
+		shift := test.rotation.shiftAt(test.at, location)
+		switch {
+		case test.userID == "" && shift != nil:
+			t.Errorf("%s: expected nobody on call, got %s", name, shift.UserID)
+		case test.userID != "" && (shift == nil || shift.UserID != test.userID):
+			t.Errorf("%s: expected %s on call, got %+v", name, test.userID, shift)
+		}
+	}
+
+	// Shifts keep the bounds of the rotation
+	shift := daily.shiftAt(start.Add(30*time.Hour), location)
+	if !shift.Start.Equal(start.Add(24*time.Hour)) || !shift.End.Equal(start.Add(48*time.Hour)) {
+		t.Errorf("Expected the second shift to run a day from its handoff, got %v to %v", shift.Start, shift.End)
+	}
+}
+
+func TestOverridesAndLaterRotationsTakePrecedence(t *testing.T) {
+	env := newIntegrationEnv(t)
+	onCall := newTestOnCallService(t, env)
+
+	// The base rotation started at midnight of a past day, the second one
+	// covers the hours around now
+	location, _ := time.LoadLocation(defaultOnCallTimeZone)
+	now := time.Now().In(location)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location).AddDate(0, 0, -7)
+	from := now.Add(-time.Hour).Format("15:04")
+	to := now.Add(time.Hour).Format("15:04")
+
+	schedule, err := onCall.CreateSchedule(OnCallSchedule{
+		TenantID: "tenant-a",
+		Name:     "İSG nöbeti",
+		Rotations: []OnCallRotation{
+			{Name: "base", Participants: []string{"ayse"}, Start: midnight, ShiftHours: 24},
+			{Name: "cover", Participants: []string{"mehmet"}, Start: midnight, ShiftHours: 24, Restrictions: []OnCallRestriction{{Start: from, End: to}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+
+	whoIsOnCall := func(at time.Time) string {
+		shift, err := onCall.WhoIsOnCall(schedule.ID, at)
+		if err != nil || shift == nil {
+			t.Fatalf("Failed to find who is on call: %v", err)
+		}
+		return shift.UserID
+	}
+
+	if userID := whoIsOnCall(now); userID != "mehmet" {
+		t.Errorf("Expected the later rotation to win where it covers, got %s", userID)
+	}
+	if userID := whoIsOnCall(now.Add(3 * time.Hour)); userID != "ayse" {
+		t.Errorf("Expected the base rotation outside the later one, got %s", userID)
+	}
+
+	for _, userID := range []string{"zeynep", "elif"} {
+		if _, err := onCall.CreateOverride(schedule.ID, OnCallOverride{
+			UserID: userID,
+			Start:  now.Add(-time.Minute),
+			End:    now.Add(2 * time.Hour),
+		}); err != nil {
+			t.Fatalf("Failed to create override: %v", err)
+		}
+	}
+	if userID := whoIsOnCall(now); userID != "elif" {
+		t.Errorf("Expected the latest override to win over the rotations, got %s", userID)
+	}
+	if userID := whoIsOnCall(now.Add(3 * time.Hour)); userID != "ayse" {
+		t.Errorf("Expected the rotations once the overrides end, got %s", userID)
+	}
+
+	// Schedules page whoever is on call
+	recipients := onCall.resolveTargets("tenant-a", []EscalationTarget{
+		{Type: EscalationTargetSchedule, ID: schedule.ID},
+		{Type: EscalationTargetUser, ID: "elif"},
+		{Type: EscalationTargetRole, ID: "isg-uzmani"},
+	})
+	if len(recipients) != 2 || recipients[0] != RecipientPrefixUser+"elif" || recipients[1] != RecipientPrefixRole+"isg-uzmani" {
+		t.Errorf("Expected the override to be paged once with the role, got %v", recipients)
+	}
+}
+
+func TestEscalationsClimbTheLevelsUntilAcknowledged(t *testing.T) {
+	env := newIntegrationEnv(t)
+	onCall := newTestOnCallService(t, env)
+	ctx := context.Background()
+
+	policy, err := onCall.CreatePolicy(EscalationPolicy{
+		TenantID: "tenant-a",
+		Name:     "Yangın alarmı",
+		Repeat:   1,
+		Levels: []EscalationLevel{
+			{Targets: []EscalationTarget{{Type: EscalationTargetUser, ID: "ayse"}}, Channels: []string{"inapp"}, DelayMinutes: 5},
+			{Targets: []EscalationTarget{{Type: EscalationTargetUser, ID: "mehmet"}}, Channels: []string{"inapp"}, DelayMinutes: 10},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	trigger := func() *Escalation {
+		escalation, err := onCall.TriggerEscalation(Escalation{TenantID: "tenant-a", PolicyID: policy.ID, Title: "B blokta duman"})
+		if err != nil {
+			t.Fatalf("Failed to trigger escalation: %v", err)
+		}
+		return escalation
+	}
+	waits := func(escalation *Escalation, delay time.Duration) bool {
+		return escalation.NextEscalationAt != nil && time.Until(*escalation.NextEscalationAt).Round(time.Minute) == delay
+	}
+
+	escalation := trigger()
+	if escalation.Level != 0 || len(escalation.Pages) != 1 || !waits(escalation, 5*time.Minute) {
+		t.Fatalf("Expected the first level to be paged and wait 5 minutes, got level %d with %d pages until %v", escalation.Level, len(escalation.Pages), escalation.NextEscalationAt)
+	}
+
+	// Nothing advances before its wait is over
+	onCall.advanceDueEscalations()
+	if escalation, _ = onCall.GetEscalation(escalation.ID); escalation.Level != 0 || len(escalation.Pages) != 1 {
+		t.Errorf("Expected the escalation to wait for its delay, got level %d", escalation.Level)
+	}
+
+	// Every step is due once its wait is over, the chain starts over once
+	// before it is exhausted
+	for _, step := range []struct {
+		level int
+		round int
+		delay time.Duration
+	}{
+		{1, 0, 10 * time.Minute},
+		{0, 1, 5 * time.Minute},
+		{1, 1, 10 * time.Minute},
+	} {
+		onCall.redis.ZAdd(ctx, onCall.getEscalationsDueKey(), &redis.Z{Score: float64(time.Now().Add(-time.Second).Unix()), Member: escalation.ID})
+		onCall.advanceDueEscalations()
+
+		escalation, _ = onCall.GetEscalation(escalation.ID)
+		if escalation.Level != step.level || escalation.Round != step.round || !waits(escalation, step.delay) {
+			t.Errorf("Expected level %d of round %d to wait %v, got level %d of round %d until %v", step.level, step.round, step.delay, escalation.Level, escalation.Round, escalation.NextEscalationAt)
+		}
+	}
+
+	if err := onCall.escalate(escalation.ID); err != nil {
+		t.Fatalf("Failed to escalate: %v", err)
+	}
+	escalation, _ = onCall.GetEscalation(escalation.ID)
+	if escalation.Status != EscalationStatusExhausted || len(escalation.Pages) != 4 {
+		t.Errorf("Expected the escalation to be exhausted after 4 pages, got %s with %d", escalation.Status, len(escalation.Pages))
+	}
+	if onCall.redis.ZScore(ctx, onCall.getEscalationsDueKey(), escalation.ID).Err() != redis.Nil {
+		t.Errorf("Expected the exhausted escalation to leave the due set")
+	}
+
+	// Acknowledging stops the climb
+	escalation = trigger()
+	if _, err := onCall.AcknowledgeEscalation(escalation.ID, "ayse"); err != nil {
+		t.Fatalf("Failed to acknowledge escalation: %v", err)
+	}
+	if err := onCall.escalate(escalation.ID); err != nil {
+		t.Fatalf("Failed to escalate: %v", err)
+	}
+	escalation, _ = onCall.GetEscalation(escalation.ID)
+	if escalation.Status != EscalationStatusAcknowledged || escalation.Level != 0 || len(escalation.Pages) != 1 {
+		t.Errorf("Expected the acknowledged escalation to stay at the first level, got %s at %d", escalation.Status, escalation.Level)
+	}
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+	"claude-talimat/pkg/validation"
+)
+
+// verifyOTPScript counts an attempt at a code and takes the code once it
+// matches, in one step so concurrent attempts can't outrun the attempt limit
+// and a code that expired meanwhile isn't recreated without its expiry.
+// It returns 1 when the code matched, 0 when it didn't, -1 when no code is
+// pending and -2 when the code is void after too many attempts.
+var verifyOTPScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+local attempts = redis.call("HINCRBY", KEYS[1], "attempts", 1)
+if attempts > tonumber(ARGV[2]) then
+	redis.call("DEL", KEYS[1])
+	return -2
+end
+if redis.call("HGET", KEYS[1], "code") ~= ARGV[1] then
+	return 0
+end
+redis.call("DEL", KEYS[1])
+return 1`)
+
+// OTPConfig holds how one-time codes are made and how often they are sent
+type OTPConfig struct {
+	Length      int           // digits of a code
+	TTL         time.Duration // how long a code stays valid
+	MaxAttempts int           // wrong codes before a code is void
+	RateLimit   int           // codes a recipient may be sent per RateWindow, 0 for unlimited
+	RateWindow  time.Duration
+	Secret      string // codes are hashed at rest with, defaults to the acknowledgment secret
+}
+
+// OTPRequest asks for a one-time code to be sent to a recipient
+type OTPRequest struct {
+	TenantID   string `json:"tenant_id"`
+	Channel    string `json:"channel"`   // sms or email
+	Recipient  string `json:"recipient"` // phone number or email address
+	Purpose    string `json:"purpose"`   // what the code confirms, codes of one purpose don't verify another
+	TemplateID string `json:"template_id,omitempty"`
+	Locale     string `json:"locale,omitempty"` // of the default wording, defaults to the tenant's
+}
+
+// OTPChallenge describes a code that was sent, without the code
+type OTPChallenge struct {
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Purpose   string    `json:"purpose"`
+	Length    int       `json:"length"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SendOTP generates a one-time code and sends it to the recipient over the
+// channel of the request. A new code replaces the one sent before. Only a
+// hash of the code is kept.
+func (s *NotificationService) SendOTP(ctx context.Context, request OTPRequest) (*OTPChallenge, error) {
+	request.Channel = strings.ToLower(strings.TrimSpace(request.Channel))
+	request.Recipient = otpRecipient(request.Recipient)
+	if request.Purpose == "" {
+		request.Purpose = "default"
+	}
+
+	switch request.Channel {
+	case "sms":
+		if !validation.IsPhone(request.Recipient) {
+			return nil, invalid(fmt.Errorf("invalid phone number: %s", request.Recipient))
+		}
+	case "email":
+		if !strings.Contains(request.Recipient, "@") {
+			return nil, invalid(fmt.Errorf("invalid email address: %s", request.Recipient))
+		}
+	default:
+		return nil, invalid(fmt.Errorf("codes can't be sent by %q, use sms or email", request.Channel))
+	}
+
+	if err := s.countOTPSend(ctx, request); err != nil {
+		return nil, err
+	}
+
+	config := s.config.OTPConfig
+	code, err := randomCode(config.Length)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(config.TTL)
+
+	key := s.getOTPKey(request.TenantID, request.Purpose, request.Recipient)
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"code":     s.hashOTP(request, code),
+		"channel":  request.Channel,
+		"attempts": 0,
+	})
+	pipe.Expire(ctx, key, config.TTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store code: %w", err)
+	}
+
+	if err := s.deliverOTP(ctx, request, code, expiresAt); err != nil {
+		s.redis.Del(ctx, key)
+		return nil, err
+	}
+
+	log.Info().
+		Str("tenantID", request.TenantID).
+		Str("channel", request.Channel).
+		Str("purpose", request.Purpose).
+		Msg("One-time code sent")
+
+	return &OTPChallenge{
+		Channel:   request.Channel,
+		Recipient: request.Recipient,
+		Purpose:   request.Purpose,
+		Length:    config.Length,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// VerifyOTP checks a code sent to a recipient for a purpose. A code verifies
+// once, and is void after too many wrong tries.
+func (s *NotificationService) VerifyOTP(ctx context.Context, tenantID string, recipient string, purpose string, code string) error {
+	recipient = otpRecipient(recipient)
+	if purpose == "" {
+		purpose = "default"
+	}
+
+	request := OTPRequest{TenantID: tenantID, Recipient: recipient, Purpose: purpose}
+	key := s.getOTPKey(tenantID, purpose, recipient)
+	hash := s.hashOTP(request, strings.TrimSpace(code))
+
+	verified, err := verifyOTPScript.Run(ctx, s.redis, []string{key}, hash, s.config.OTPConfig.MaxAttempts).Int()
+	if err != nil {
+		return fmt.Errorf("failed to verify code: %w", err)
+	}
+
+	switch verified {
+	case 1:
+		return nil
+	case 0:
+		return invalid(fmt.Errorf("code is wrong"))
+	case -2:
+		return invalid(fmt.Errorf("too many wrong codes, request a new one"))
+	default:
+		return notFoundf("no code pending or it expired, request a new one")
+	}
+}
+
+// countOTPSend counts a code against the rate limit of its recipient
+func (s *NotificationService) countOTPSend(ctx context.Context, request OTPRequest) error {
+	config := s.config.OTPConfig
+	if config.RateLimit <= 0 {
+		return nil
+	}
+
+	key := s.getOTPRateKey(request.TenantID, request.Recipient)
+	pipe := s.redis.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to count code: %w", err)
+	}
+
+	// The window starts with the first code sent in it
+	remaining := ttl.Val()
+	if remaining <= 0 {
+		remaining = config.RateWindow
+		s.redis.Expire(ctx, key, remaining)
+	}
+
+	if count.Val() > int64(config.RateLimit) {
+		return &RateLimitError{
+			Scope:   "recipient",
+			Limit:   config.RateLimit,
+			Unit:    "codes",
+			Window:  config.RateWindow.String(),
+			RetryAt: time.Now().Add(remaining),
+		}
+	}
+	return nil
+}
+
+// deliverOTP sends a code with the template of the request, or with the
+// default wording when it names none
+func (s *NotificationService) deliverOTP(ctx context.Context, request OTPRequest, code string, expiresAt time.Time) error {
+	minutes := int(s.config.OTPConfig.TTL.Round(time.Minute).Minutes())
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	locale := i18n.Select(s.templateService.LocaleChain(request.TenantID, request.Locale)...)
+	subject := i18n.T(locale, i18n.OTPSubject)
+	message := i18n.T(locale, i18n.OTPMessage, code, minutes)
+	var htmlBody string
+	if request.TemplateID != "" {
+		rendered, err := s.templateService.RenderTemplate(request.TemplateID, map[string]interface{}{
+			"otp_code":   code,
+			"expires_in": i18n.T(locale, i18n.OTPExpiresIn, minutes),
+			"purpose":    request.Purpose,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render code template: %w", err)
+		}
+		if rendered.Subject != "" {
+			subject = rendered.Subject
+		}
+		if rendered.Message != "" {
+			message = rendered.Message
+		}
+		if rendered.TextBody != "" && request.Channel == "email" {
+			message = rendered.TextBody
+		}
+		htmlBody = rendered.HTMLBody
+	}
+
+	switch request.Channel {
+	case "sms":
+		if _, err := s.smsService.SendOTP(ctx, request.Recipient, message, expiresAt, request.TenantID); err != nil {
+			return fmt.Errorf("failed to send code: %w", err)
+		}
+	case "email":
+		if _, err := s.emailService.SendEmail(ctx, EmailMessage{
+			To:       []string{request.Recipient},
+			Subject:  subject,
+			Body:     message,
+			HTMLBody: htmlBody,
+		}); err != nil {
+			return fmt.Errorf("failed to send code: %w", err)
+		}
+	}
+	return nil
+}
+
+// hashOTP returns what a code is stored as. Codes are short, the secret keeps
+// them from being guessed from their hash.
+func (s *NotificationService) hashOTP(request OTPRequest, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.OTPConfig.Secret))
+	mac.Write([]byte(request.TenantID + "\x00" + request.Purpose + "\x00" + otpRecipient(request.Recipient) + "\x00" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// otpRecipientKey names a recipient in keys without giving away the address
+func (s *NotificationService) otpRecipientKey(recipient string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.OTPConfig.Secret))
+	mac.Write([]byte(otpRecipient(recipient)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// otpRecipient returns the form codes and rate limits know a recipient by.
+// Phone numbers take their international format, so a code sent to
+// 0555 111 22 33 verifies for +905551112233 and counts against its limit.
+func otpRecipient(recipient string) string {
+	recipient = strings.TrimSpace(recipient)
+	if strings.Contains(recipient, "@") {
+		return strings.ToLower(recipient)
+	}
+	if !validation.IsPhone(recipient) {
+		return recipient
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, recipient)
+	return "+" + e164Digits(digits)
+}
+
+// randomCode returns a code of the given number of digits
+func randomCode(length int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
+
+// Redis key generators
+func (s *NotificationService) getOTPKey(tenantID string, purpose string, recipient string) string {
+	return fmt.Sprintf("otp:%s:%s:%s", tenantID, purpose, s.otpRecipientKey(recipient))
+}
+
+func (s *NotificationService) getOTPRateKey(tenantID string, recipient string) string {
+	return fmt.Sprintf("otp_rate:%s:%s", tenantID, s.otpRecipientKey(recipient))
+}
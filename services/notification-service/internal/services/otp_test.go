@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestOTPRecipientsAreKeyedInTheirInternationalFormat(t *testing.T) {
+	for _, recipient := range []string{"+905551112233", "905551112233", "05551112233", "0555 111 22 33", "(0555) 111-22-33", "5551112233"} {
+		if got := otpRecipient(recipient); got != "+905551112233" {
+			t.Errorf("Expected %q to be keyed as +905551112233, got %s", recipient, got)
+		}
+	}
+	if got := otpRecipient(" Ayse@Talimat.TEST "); got != "ayse@talimat.test" {
+		t.Errorf("Expected email addresses in lower case, got %s", got)
+	}
+}
+
+func TestOTPSentToALocalNumberVerifiesAndIsRateLimitedForTheInternationalOne(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.service.config.OTPConfig.RateLimit = 1
+	ctx := context.Background()
+
+	request := OTPRequest{TenantID: "tenant-a", Channel: "sms", Recipient: "0555 111 22 33", Purpose: "login"}
+	if _, err := env.service.SendOTP(ctx, request); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+
+	// Only the hash of the code is stored, put a known one in its place
+	key := env.service.getOTPKey("tenant-a", "login", "+905551112233")
+	env.service.redis.HSet(ctx, key, "code", env.service.hashOTP(request, "123456"))
+	if err := env.service.VerifyOTP(ctx, "tenant-a", "+905551112233", "login", "123456"); err != nil {
+		t.Errorf("Expected the code to verify for the number in its international format, got %v", err)
+	}
+
+	var rateLimitErr *RateLimitError
+	request.Recipient = "+905551112233"
+	if _, err := env.service.SendOTP(ctx, request); !errors.As(err, &rateLimitErr) {
+		t.Errorf("Expected both ways of writing the number to share a rate limit, got %v", err)
+	}
+}
+
+func TestOTPVerificationKeepsTheExpiryAndLimitOfTheCode(t *testing.T) {
+	env := newIntegrationEnv(t)
+	env.service.config.OTPConfig.MaxAttempts = 3
+	ctx := context.Background()
+
+	request := OTPRequest{TenantID: "tenant-a", Channel: "email", Recipient: "ayse@talimat.test", Purpose: "login"}
+	if _, err := env.service.SendOTP(ctx, request); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+	key := env.service.getOTPKey("tenant-a", "login", request.Recipient)
+
+	if err := env.service.VerifyOTP(ctx, "tenant-a", request.Recipient, "login", "wrong"); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected a wrong code to be rejected, got %v", err)
+	}
+	if ttl := env.service.redis.TTL(ctx, key).Val(); ttl <= 0 {
+		t.Errorf("Expected the code to keep its expiry after a wrong attempt, got %v", ttl)
+	}
+
+	// Concurrent attempts can't get past the attempt limit
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		wrong int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := env.service.VerifyOTP(ctx, "tenant-a", request.Recipient, "login", "wrong")
+			if err != nil && err.Error() == "code is wrong" {
+				mu.Lock()
+				wrong++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if wrong != 2 {
+		t.Errorf("Expected 2 more attempts to be checked before the code is void, got %d", wrong)
+	}
+
+	// A code that is gone isn't brought back by attempts at it
+	if err := env.service.VerifyOTP(ctx, "tenant-a", request.Recipient, "login", "wrong"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected no code pending, got %v", err)
+	}
+	if exists := env.service.redis.Exists(ctx, key).Val(); exists != 0 {
+		t.Errorf("Expected verification not to recreate the code")
+	}
+}
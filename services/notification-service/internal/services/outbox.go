@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/events"
+	"claude-talimat/pkg/redisclient"
+	"claude-talimat/pkg/types"
+)
+
+// The outbox makes publishing the events of the service at-least-once.
+// Events are added to a Redis stream next to the change causing them, and a
+// relay hands them to every sink: the webhooks subscribed to them and the
+// events topic of the message queue. Each sink reads the stream in a
+// consumer group of its own and only acknowledges an event once it took it,
+// so an event a sink failed to take is retried until it succeeds.
+
+const (
+	outboxRelayInterval = 1 * time.Second
+	outboxBatchSize     = 100
+	outboxGroupWebhooks = "webhooks"
+	outboxGroupQueue    = "queue"
+)
+
+// OutboxConfig holds where the outbox publishes the events of the service
+// to, besides the webhooks subscribed to them
+type OutboxConfig struct {
+	RedisURL      string // Redis of the message queue service, empty to only trigger webhooks
+	RedisPassword string
+	RedisDB       int
+	Topic         string        // Topic events are published to
+	MaxLength     int64         // Events kept in the outbox, older ones are trimmed even when not relayed yet
+	RetryAfter    time.Duration // How long an event a sink failed to take waits before it is retried
+}
+
+// outboxSink is where the relay hands events to
+type outboxSink struct {
+	group   string
+	deliver func(ctx context.Context, event WebhookEvent) error
+}
+
+// newOutboxPublisher returns the client of the Redis events are published
+// to, or nil when they are only used to trigger webhooks
+func newOutboxPublisher(config OutboxConfig) (*redis.Client, error) {
+	if config.RedisURL == "" || config.Topic == "" {
+		return nil, nil
+	}
+
+	client, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the events queue: %w", err)
+	}
+	return client, nil
+}
+
+// emitEvent adds an event to the outbox. Once it was added the event reaches
+// every sink, even when they are unavailable for a while.
+func (s *NotificationService) emitEvent(event WebhookEvent) {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Str("eventID", event.ID).Msg("Failed to marshal event")
+		return
+	}
+
+	err = s.redis.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: s.getOutboxKey(),
+		MaxLen: s.config.OutboxConfig.MaxLength,
+		Approx: true,
+		Values: map[string]interface{}{"event": string(eventJSON)},
+	}).Err()
+	if err != nil {
+		log.Error().Err(err).Str("eventID", event.ID).Str("eventType", event.Type).Msg("Failed to add event to outbox")
+	}
+}
+
+// outboxSinks returns the sinks events are relayed to
+func (s *NotificationService) outboxSinks() []outboxSink {
+	sinks := []outboxSink{{group: outboxGroupWebhooks, deliver: s.webhookService.TriggerWebhook}}
+	if s.events != nil {
+		sinks = append(sinks, outboxSink{group: outboxGroupQueue, deliver: s.publishEvent})
+	}
+	return sinks
+}
+
+// createOutboxGroups creates the consumer groups of the sinks, reading the
+// outbox from its start
+func (s *NotificationService) createOutboxGroups() error {
+	for _, sink := range s.outboxSinks() {
+		err := s.redis.XGroupCreateMkStream(context.Background(), s.getOutboxKey(), sink.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create outbox group %s: %w", sink.group, err)
+		}
+	}
+	return nil
+}
+
+// startOutboxRelay relays the events of the outbox to their sinks
+func (s *NotificationService) startOutboxRelay() {
+	log.Info().Msg("Outbox relay started")
+
+	consumer, _ := os.Hostname()
+	if consumer == "" {
+		consumer = "notification-service"
+	}
+
+	for {
+		for _, sink := range s.outboxSinks() {
+			// Keep relaying while full batches come back
+			for s.ctx.Err() == nil {
+				if s.relayOutbox(sink, consumer) < outboxBatchSize {
+					break
+				}
+			}
+		}
+
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Outbox relay stopped")
+			return
+		case <-time.After(outboxRelayInterval):
+		}
+	}
+}
+
+// relayOutbox hands a batch of events to a sink and returns how many were
+// read. Events the sink failed to take stay pending and are retried once
+// they waited the retry delay.
+func (s *NotificationService) relayOutbox(sink outboxSink, consumer string) int {
+	ctx := context.Background()
+
+	messages, _, err := s.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   s.getOutboxKey(),
+		Group:    sink.group,
+		Consumer: consumer,
+		MinIdle:  s.config.OutboxConfig.RetryAfter,
+		Start:    "0-0",
+		Count:    outboxBatchSize,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		log.Error().Err(err).Str("sink", sink.group).Msg("Failed to claim outbox events")
+		return 0
+	}
+
+	if len(messages) == 0 {
+		streams, err := s.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    sink.group,
+			Consumer: consumer,
+			Streams:  []string{s.getOutboxKey(), ">"},
+			Count:    outboxBatchSize,
+			Block:    -1,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			log.Error().Err(err).Str("sink", sink.group).Msg("Failed to read outbox events")
+			return 0
+		}
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+	}
+
+	for _, message := range messages {
+		raw, _ := message.Values["event"].(string)
+
+		var event WebhookEvent
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			log.Error().Err(err).Str("outboxID", message.ID).Msg("Dropping outbox event that can't be read")
+			s.redis.XAck(ctx, s.getOutboxKey(), sink.group, message.ID)
+			continue
+		}
+
+		if err := sink.deliver(ctx, event); err != nil {
+			// Events a sink rejects are never taken, retrying doesn't help
+			if errors.Is(err, ErrValidation) {
+				log.Error().Err(err).Str("eventID", event.ID).Str("sink", sink.group).Msg("Dropping outbox event rejected by sink")
+				s.redis.XAck(ctx, s.getOutboxKey(), sink.group, message.ID)
+				continue
+			}
+
+			log.Warn().Err(err).Str("eventID", event.ID).Str("sink", sink.group).Msg("Failed to relay outbox event, it will be retried")
+			continue
+		}
+
+		if err := s.redis.XAck(ctx, s.getOutboxKey(), sink.group, message.ID).Err(); err != nil {
+			log.Warn().Err(err).Str("eventID", event.ID).Str("sink", sink.group).Msg("Failed to acknowledge outbox event")
+		}
+	}
+
+	return len(messages)
+}
+
+// publishEvent publishes an event to the events topic of the message queue,
+// in the message format of the message queue service. Events are published
+// with the latest version of their type and must match its schema.
+func (s *NotificationService) publishEvent(ctx context.Context, event WebhookEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(eventJSON, &payload); err != nil {
+		return fmt.Errorf("failed to convert event: %w", err)
+	}
+
+	payload["version"] = events.Latest(event.Type)
+	if err := events.ValidateEvent(payload); err != nil {
+		return invalid(err)
+	}
+
+	priority := types.PriorityValue(event.Priority)
+	message, err := json.Marshal(types.Message{
+		ID:         event.ID,
+		Topic:      s.config.OutboxConfig.Topic,
+		Payload:    payload,
+		Priority:   priority,
+		MaxRetries: 3,
+		CreatedAt:  event.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	err = s.events.XAdd(ctx, &redis.XAddArgs{
+		Stream: types.StreamKey(s.config.OutboxConfig.Topic),
+		Values: map[string]interface{}{
+			"message":  string(message),
+			"priority": priority,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Redis key generators
+func (s *NotificationService) getOutboxKey() string {
+	return "notification_outbox"
+}
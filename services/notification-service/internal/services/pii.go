@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// piiPrefix marks values the PII cipher encrypted. Values without it were
+// stored before encryption was enabled and are read as they are.
+const piiPrefix = "pii:v1:"
+
+// piiSealedField holds the encrypted form of a map of personal data, like
+// the template data of a request
+const piiSealedField = "_pii"
+
+// piiCipher encrypts personal data with AES-GCM before it is stored. Every
+// tenant has its own data key, generated on first use and kept in Redis
+// wrapped by the master key, so deleting it makes the data of the tenant
+// unreadable. A nil cipher stores everything in plaintext.
+type piiCipher struct {
+	master cipher.AEAD
+	redis  *redis.Client
+
+	mu        sync.RWMutex
+	keys      map[string]cipher.AEAD // by tenant
+	indexKeys map[string][]byte      // search index keys, by tenant
+}
+
+// newPIICipher creates a cipher wrapping tenant keys with a 32-byte master
+// key, nil when no key is configured
+func newPIICipher(masterKey []byte, redisClient *redis.Client) (*piiCipher, error) {
+	if len(masterKey) == 0 {
+		return nil, nil
+	}
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("PII encryption key must be 32 bytes, got %d", len(masterKey))
+	}
+
+	master, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &piiCipher{
+		master:    master,
+		redis:     redisClient,
+		keys:      make(map[string]cipher.AEAD),
+		indexKeys: make(map[string][]byte),
+	}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// tenantKey returns the data key of a tenant, creating it on first use.
+// Instances racing to create it agree on the one stored first.
+func (c *piiCipher) tenantKey(tenantID string) (cipher.AEAD, error) {
+	c.mu.RLock()
+	key, ok := c.keys[tenantID]
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	ctx := context.Background()
+	redisKey := c.getTenantKeyKey(tenantID)
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate tenant key: %w", err)
+	}
+	wrapped, err := sealWith(c.master, dataKey, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.redis.SetNX(ctx, redisKey, wrapped, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store tenant key: %w", err)
+	}
+
+	stored, err := c.redis.Get(ctx, redisKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant key: %w", err)
+	}
+	dataKey, err = openWith(c.master, stored, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key of tenant %s: %w", tenantID, err)
+	}
+
+	key, err = newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Search terms are hashed with a key derived from the data key, so
+	// deleting it also makes the search index of the tenant meaningless
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("search-index"))
+
+	c.mu.Lock()
+	c.keys[tenantID] = key
+	c.indexKeys[tenantID] = mac.Sum(nil)
+	c.mu.Unlock()
+	return key, nil
+}
+
+// searchToken returns the token a search term is indexed by. With
+// encryption enabled it is an HMAC of the term keyed per tenant, so index
+// keys do not reveal the words of what they index.
+func (c *piiCipher) searchToken(tenantID string, term string) (string, error) {
+	if c == nil {
+		return term, nil
+	}
+
+	if _, err := c.tenantKey(tenantID); err != nil {
+		return "", err
+	}
+	c.mu.RLock()
+	indexKey := c.indexKeys[tenantID]
+	c.mu.RUnlock()
+
+	mac := hmac.New(sha256.New, indexKey)
+	mac.Write([]byte(term))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// seal encrypts a value with the key of a tenant. Empty values stay empty.
+func (c *piiCipher) seal(tenantID string, value string) (string, error) {
+	if c == nil || value == "" {
+		return value, nil
+	}
+
+	key, err := c.tenantKey(tenantID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealWith(key, []byte(value), tenantID)
+	if err != nil {
+		return "", err
+	}
+	return piiPrefix + sealed, nil
+}
+
+// open decrypts a value sealed with the key of a tenant, values stored in
+// plaintext are returned as they are
+func (c *piiCipher) open(tenantID string, value string) (string, error) {
+	if !strings.HasPrefix(value, piiPrefix) {
+		return value, nil
+	}
+	if c == nil {
+		return "", fmt.Errorf("encrypted data found but PII encryption is not configured")
+	}
+
+	key, err := c.tenantKey(tenantID)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openWith(key, strings.TrimPrefix(value, piiPrefix), tenantID)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt personal data: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// sealFields encrypts strings in place
+func (c *piiCipher) sealFields(tenantID string, fields ...*string) error {
+	for _, field := range fields {
+		sealed, err := c.seal(tenantID, *field)
+		if err != nil {
+			return err
+		}
+		*field = sealed
+	}
+	return nil
+}
+
+// openFields decrypts strings in place
+func (c *piiCipher) openFields(tenantID string, fields ...*string) error {
+	for _, field := range fields {
+		opened, err := c.open(tenantID, *field)
+		if err != nil {
+			return err
+		}
+		*field = opened
+	}
+	return nil
+}
+
+// sealSlice returns a copy of values with every value encrypted
+func (c *piiCipher) sealSlice(tenantID string, values []string) ([]string, error) {
+	if c == nil || values == nil {
+		return values, nil
+	}
+	sealed := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if sealed[i], err = c.seal(tenantID, value); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+// openSlice returns a copy of values with every value decrypted
+func (c *piiCipher) openSlice(tenantID string, values []string) ([]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	opened := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		if opened[i], err = c.open(tenantID, value); err != nil {
+			return nil, err
+		}
+	}
+	return opened, nil
+}
+
+// sealMap returns a map holding the encrypted JSON of data
+func (c *piiCipher) sealMap(tenantID string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c == nil || len(data) == 0 {
+		return data, nil
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal personal data: %w", err)
+	}
+	sealed, err := c.seal(tenantID, string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{piiSealedField: sealed}, nil
+}
+
+// openMap returns the data a map returned by sealMap holds
+func (c *piiCipher) openMap(tenantID string, data map[string]interface{}) (map[string]interface{}, error) {
+	sealed, ok := data[piiSealedField].(string)
+	if !ok || len(data) != 1 {
+		return data, nil
+	}
+
+	encoded, err := c.open(tenantID, sealed)
+	if err != nil {
+		return nil, err
+	}
+	var opened map[string]interface{}
+	if err := json.Unmarshal([]byte(encoded), &opened); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal personal data: %w", err)
+	}
+	return opened, nil
+}
+
+// sealWith encrypts plaintext bound to a tenant, the nonce precedes the
+// ciphertext
+func sealWith(key cipher.AEAD, plaintext []byte, tenantID string) (string, error) {
+	nonce := make([]byte, key.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := key.Seal(nonce, nonce, plaintext, []byte(tenantID))
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func openWith(key cipher.AEAD, value string, tenantID string) ([]byte, error) {
+	sealed, err := base64.RawStdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < key.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:key.NonceSize()], sealed[key.NonceSize():]
+	return key.Open(nil, nonce, ciphertext, []byte(tenantID))
+}
+
+// sealLocalizations returns a copy of the content variants of a request with
+// their content encrypted
+func (c *piiCipher) sealLocalizations(tenantID string, localizations map[string]LocalizedContent) (map[string]LocalizedContent, error) {
+	if c == nil || len(localizations) == 0 {
+		return localizations, nil
+	}
+
+	sealed := make(map[string]LocalizedContent, len(localizations))
+	for locale, content := range localizations {
+		err := c.sealFields(tenantID, &content.Subject, &content.Title, &content.Message, &content.HTMLBody, &content.TextBody)
+		if err != nil {
+			return nil, err
+		}
+		sealed[locale] = content
+	}
+	return sealed, nil
+}
+
+// marshalRequest returns the stored form of a request, its recipients and
+// content encrypted
+func (c *piiCipher) marshalRequest(request NotificationRequest) ([]byte, error) {
+	var err error
+	if request.Recipients, err = c.sealSlice(request.TenantID, request.Recipients); err != nil {
+		return nil, err
+	}
+	if request.TemplateData, err = c.sealMap(request.TenantID, request.TemplateData); err != nil {
+		return nil, err
+	}
+	err = c.sealFields(request.TenantID, &request.Subject, &request.Title, &request.Message, &request.HTMLBody, &request.TextBody)
+	if err != nil {
+		return nil, err
+	}
+	if request.Localizations, err = c.sealLocalizations(request.TenantID, request.Localizations); err != nil {
+		return nil, err
+	}
+	return json.Marshal(request)
+}
+
+// unmarshalRequest reads a stored request
+func (c *piiCipher) unmarshalRequest(data string) (*NotificationRequest, error) {
+	var request NotificationRequest
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if request.Recipients, err = c.openSlice(request.TenantID, request.Recipients); err != nil {
+		return nil, err
+	}
+	if request.TemplateData, err = c.openMap(request.TenantID, request.TemplateData); err != nil {
+		return nil, err
+	}
+	err = c.openFields(request.TenantID, &request.Subject, &request.Title, &request.Message, &request.HTMLBody, &request.TextBody)
+	if err != nil {
+		return nil, err
+	}
+	for locale, content := range request.Localizations {
+		err = c.openFields(request.TenantID, &content.Subject, &content.Title, &content.Message, &content.HTMLBody, &content.TextBody)
+		if err != nil {
+			return nil, err
+		}
+		request.Localizations[locale] = content
+	}
+	return &request, nil
+}
+
+// marshalResult returns the stored form of a result, its recipient and the
+// error quoting it encrypted
+func (c *piiCipher) marshalResult(result NotificationResult) ([]byte, error) {
+	if err := c.sealFields(result.TenantID, &result.Recipient, &result.Error); err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+// unmarshalResult reads a stored result
+func (c *piiCipher) unmarshalResult(data string) (*NotificationResult, error) {
+	var result NotificationResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return nil, err
+	}
+	if err := c.openFields(result.TenantID, &result.Recipient, &result.Error); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// marshalInApp returns the stored form of an in-app notification, its
+// content encrypted. Attachment links are signed anew on every read, so they
+// are not stored.
+func (c *piiCipher) marshalInApp(notification InAppNotification) ([]byte, error) {
+	if len(notification.Attachments) > 0 {
+		attachments := make([]InAppAttachment, len(notification.Attachments))
+		for i, attachment := range notification.Attachments {
+			attachment.URL = ""
+			attachment.URLExpiresAt = nil
+			attachments[i] = attachment
+		}
+		notification.Attachments = attachments
+	}
+
+	var err error
+	if notification.Data, err = c.sealMap(notification.TenantID, notification.Data); err != nil {
+		return nil, err
+	}
+	if err := c.sealFields(notification.TenantID, &notification.Title, &notification.Message); err != nil {
+		return nil, err
+	}
+	return json.Marshal(notification)
+}
+
+// unmarshalInApp reads a stored in-app notification
+func (c *piiCipher) unmarshalInApp(data string) (*InAppNotification, error) {
+	var notification InAppNotification
+	if err := json.Unmarshal([]byte(data), &notification); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if notification.Data, err = c.openMap(notification.TenantID, notification.Data); err != nil {
+		return nil, err
+	}
+	if err := c.openFields(notification.TenantID, &notification.Title, &notification.Message); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// marshalSubscription returns the stored form of a push subscription, its
+// device token and model encrypted
+func (c *piiCipher) marshalSubscription(subscription PushSubscription) ([]byte, error) {
+	if err := c.sealFields(subscription.TenantID, &subscription.DeviceToken, &subscription.DeviceModel); err != nil {
+		return nil, err
+	}
+	return json.Marshal(subscription)
+}
+
+// unmarshalSubscription reads a stored push subscription
+func (c *piiCipher) unmarshalSubscription(data string) (*PushSubscription, error) {
+	var subscription PushSubscription
+	if err := json.Unmarshal([]byte(data), &subscription); err != nil {
+		return nil, err
+	}
+	if err := c.openFields(subscription.TenantID, &subscription.DeviceToken, &subscription.DeviceModel); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// Redis key generators
+func (c *piiCipher) getTenantKeyKey(tenantID string) string {
+	return fmt.Sprintf("pii_key:%s", tenantID)
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// PoolStats represents how busy one of the worker pools is
+type PoolStats struct {
+	Name      string `json:"name"`
+	Size      int    `json:"size"`      // tasks that may run at once
+	Active    int64  `json:"active"`    // tasks running
+	Waiting   int64  `json:"waiting"`   // tasks waiting for a free worker
+	Saturated uint64 `json:"saturated"` // tasks that found every worker busy
+	Rejected  uint64 `json:"rejected"`  // tasks turned away or given up on while waiting
+	Completed uint64 `json:"completed"`
+}
+
+// workerPool bounds how many tasks of a kind run at once. Tasks started with
+// Go run on goroutines of their own that Wait waits for, so none outlive the
+// service. The bound can be changed while tasks run.
+type workerPool struct {
+	name string
+	wg   sync.WaitGroup
+
+	mu    sync.Mutex
+	size  int
+	inUse int
+	freed chan struct{} // closed and replaced when a worker may have become free
+
+	active    atomic.Int64
+	waiting   atomic.Int64
+	saturated atomic.Uint64
+	rejected  atomic.Uint64
+	completed atomic.Uint64
+}
+
+// newWorkerPool creates a pool running at most size tasks at once
+func newWorkerPool(name string, size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{
+		name:  name,
+		size:  size,
+		freed: make(chan struct{}),
+	}
+}
+
+// resize changes how many tasks run at once. Tasks beyond a lowered bound
+// finish, new ones wait until the pool is below it.
+func (p *workerPool) resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size != p.size {
+		p.size = size
+		p.wake()
+	}
+}
+
+// wake lets the tasks waiting for a worker check again, p.mu must be held
+func (p *workerPool) wake() {
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// tryAcquire takes a worker if one is free
+func (p *workerPool) tryAcquire() (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inUse < p.size {
+		p.inUse++
+		return true, nil
+	}
+	return false, p.freed
+}
+
+// acquire takes a worker, waiting for one to be free until ctx is done
+func (p *workerPool) acquire(ctx context.Context) error {
+	ok, freed := p.tryAcquire()
+	if ok {
+		return nil
+	}
+	p.saturated.Add(1)
+
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+	for !ok {
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			p.rejected.Add(1)
+			return ctx.Err()
+		}
+		ok, freed = p.tryAcquire()
+	}
+	return nil
+}
+
+// release gives a worker back
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inUse--
+	p.wake()
+}
+
+// start marks a worker already taken as running a task, the returned
+// function gives the worker back
+func (p *workerPool) start() func() {
+	p.active.Add(1)
+	return func() {
+		p.active.Add(-1)
+		p.completed.Add(1)
+		p.release()
+	}
+}
+
+// Hold takes a worker for the calling goroutine until the returned function
+// is called. It fails when ctx is done before a worker is free.
+func (p *workerPool) Hold(ctx context.Context) (func(), error) {
+	if err := p.acquire(ctx); err != nil {
+		return nil, err
+	}
+	return p.start(), nil
+}
+
+// Do runs task on the calling goroutine once a worker is free. It fails
+// without running task when ctx is done first.
+func (p *workerPool) Do(ctx context.Context, task func()) error {
+	done, err := p.Hold(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	task()
+	return nil
+}
+
+// Go runs task on a goroutine of its own once a worker is free. It fails
+// without running task when ctx is done first.
+func (p *workerPool) Go(ctx context.Context, task func()) error {
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	p.spawn(task)
+	return nil
+}
+
+// TryGo runs task on a goroutine of its own if a worker is free right away
+func (p *workerPool) TryGo(task func()) bool {
+	if ok, _ := p.tryAcquire(); !ok {
+		p.saturated.Add(1)
+		p.rejected.Add(1)
+		return false
+	}
+	p.spawn(task)
+	return true
+}
+
+func (p *workerPool) spawn(task func()) {
+	p.wg.Add(1)
+	done := p.start()
+	go func() {
+		defer p.wg.Done()
+		defer done()
+		task()
+	}()
+}
+
+// Wait blocks until every task started with Go or TryGo has finished
+func (p *workerPool) Wait() {
+	p.wg.Wait()
+}
+
+// Stats returns how busy the pool is
+func (p *workerPool) Stats() PoolStats {
+	p.mu.Lock()
+	size := p.size
+	p.mu.Unlock()
+
+	return PoolStats{
+		Name:      p.name,
+		Size:      size,
+		Active:    p.active.Load(),
+		Waiting:   p.waiting.Load(),
+		Saturated: p.saturated.Load(),
+		Rejected:  p.rejected.Load(),
+		Completed: p.completed.Load(),
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestWorkerPoolBoundsConcurrentTasks(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pool := newWorkerPool("test", 2)
+	release := make(chan struct{})
+	var running, peak atomic.Int64
+
+	var started sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		started.Add(1)
+		go func() {
+			defer started.Done()
+			err := pool.Go(context.Background(), func() {
+				current := running.Add(1)
+				defer running.Add(-1)
+				for {
+					previous := peak.Load()
+					if current <= previous || peak.CompareAndSwap(previous, current) {
+						break
+					}
+				}
+				<-release
+			})
+			if err != nil {
+				t.Errorf("Failed to start task: %v", err)
+			}
+		}()
+	}
+
+	eventually(t, "the pool to be saturated", func() bool {
+		stats := pool.Stats()
+		return stats.Active == 2 && stats.Waiting == 3
+	})
+	close(release)
+	started.Wait()
+	pool.Wait()
+
+	if peak.Load() != 2 {
+		t.Errorf("Expected at most 2 tasks at once, got %d", peak.Load())
+	}
+	stats := pool.Stats()
+	if stats.Completed != 5 || stats.Saturated != 3 || stats.Active != 0 || stats.Waiting != 0 {
+		t.Errorf("Unexpected pool stats %+v", stats)
+	}
+}
+
+func TestWorkerPoolGivesUpWhenSaturated(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pool := newWorkerPool("test", 1)
+	release := make(chan struct{})
+	if !pool.TryGo(func() { <-release }) {
+		t.Fatal("Expected the first task to start")
+	}
+
+	if pool.TryGo(func() { t.Error("Expected the task not to run") }) {
+		t.Error("Expected TryGo to fail while the pool is saturated")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Do(ctx, func() { t.Error("Expected the task not to run") }); err == nil {
+		t.Error("Expected Do to give up once its context is done")
+	}
+
+	close(release)
+	pool.Wait()
+
+	if stats := pool.Stats(); stats.Rejected != 2 || stats.Completed != 1 {
+		t.Errorf("Unexpected pool stats %+v", stats)
+	}
+}
+
+func TestWorkerPoolResizeLetsWaitingTasksStart(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pool := newWorkerPool("test", 1)
+	release := make(chan struct{})
+	if !pool.TryGo(func() { <-release }) {
+		t.Fatal("Expected the first task to start")
+	}
+
+	started := make(chan struct{})
+	go pool.Go(context.Background(), func() { close(started) })
+	eventually(t, "the second task to wait", func() bool { return pool.Stats().Waiting == 1 })
+
+	pool.resize(2)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Error("Expected the waiting task to start once the pool grew")
+	}
+
+	close(release)
+	pool.Wait()
+}
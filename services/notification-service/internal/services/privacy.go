@@ -0,0 +1,532 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
+)
+
+// DataSubjectStore is implemented by every store that holds personal data of
+// notification recipients. Stores added later, such as the database, register
+// with the PrivacyService so data subject requests (KVKK/GDPR) reach them too.
+type DataSubjectStore interface {
+	// ExportUserData returns everything the store holds about a user
+	ExportUserData(ctx context.Context, tenantID string, userID string) (interface{}, error)
+	// EraseUserData removes or anonymises everything the store holds about a
+	// user and returns the number of records affected
+	EraseUserData(ctx context.Context, tenantID string, userID string) (int, error)
+}
+
+// PrivacyService handles KVKK/GDPR data subject requests
+type PrivacyService struct {
+	redis  *redis.Client
+	config PrivacyConfig
+	stores []namedDataSubjectStore
+	mu     sync.RWMutex
+}
+
+// PrivacyConfig holds privacy service configuration
+type PrivacyConfig struct {
+	RedisURL      string
+	RedisPassword string
+	RedisDB       int
+	AuditSecret   string        // Key used to pseudonymise subjects in erasure records
+	AuditTTL      time.Duration // How long erasure records are kept, 0 keeps them forever
+}
+
+type namedDataSubjectStore struct {
+	name  string
+	store DataSubjectStore
+}
+
+// DataSubjectExport represents all notification data held about a user
+type DataSubjectExport struct {
+	UserID     string                 `json:"user_id"`
+	TenantID   string                 `json:"tenant_id"`
+	Data       map[string]interface{} `json:"data"`
+	Errors     map[string]string      `json:"errors,omitempty"`
+	ExportedAt time.Time              `json:"exported_at"`
+}
+
+// ErasureRecord is the anonymised audit trail of an erasure request. It proves
+// that a request was carried out without keeping the identity of the subject.
+type ErasureRecord struct {
+	ID          string            `json:"id"`
+	TenantID    string            `json:"tenant_id"`
+	SubjectHash string            `json:"subject_hash"`
+	RequestedBy string            `json:"requested_by"`
+	Erased      map[string]int    `json:"erased"`
+	Errors      map[string]string `json:"errors,omitempty"`
+	Status      string            `json:"status"` // completed, partial
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+// NewPrivacyService creates a new privacy service covering every store of the
+// notification service
+func NewPrivacyService(config PrivacyConfig, notifications *NotificationService) (*PrivacyService, error) {
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	service := &PrivacyService{
+		redis:  redisClient,
+		config: config,
+	}
+
+	service.RegisterStore("deliveries", notifications)
+	service.RegisterStore("inapp", notifications.inAppService)
+	service.RegisterStore("recipients", notifications.recipients)
+	service.RegisterStore("devices", notifications.pushService)
+
+	return service, nil
+}
+
+// RegisterStore adds a store to the data subject requests
+func (s *PrivacyService) RegisterStore(name string, store DataSubjectStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stores = append(s.stores, namedDataSubjectStore{name: name, store: store})
+}
+
+// ExportUserData collects the notification data of a user from every store
+func (s *PrivacyService) ExportUserData(ctx context.Context, tenantID string, userID string) (*DataSubjectExport, error) {
+	log.Info().
+		Str("tenantID", tenantID).
+		Str("userID", userID).
+		Msg("Exporting user notification data")
+
+	if userID == "" {
+		return nil, invalid(fmt.Errorf("user ID is required"))
+	}
+
+	export := &DataSubjectExport{
+		UserID:     userID,
+		TenantID:   tenantID,
+		Data:       make(map[string]interface{}),
+		ExportedAt: time.Now(),
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, named := range s.stores {
+		data, err := named.store.ExportUserData(ctx, tenantID, userID)
+		if err != nil {
+			// An incomplete export must be visible to whoever answers the request
+			if export.Errors == nil {
+				export.Errors = make(map[string]string)
+			}
+			export.Errors[named.name] = err.Error()
+			continue
+		}
+		export.Data[named.name] = data
+	}
+
+	return export, nil
+}
+
+// EraseUserData erases the notification data of a user from every store and
+// keeps an anonymised record of the erasure
+func (s *PrivacyService) EraseUserData(ctx context.Context, tenantID string, userID string, requestedBy string) (*ErasureRecord, error) {
+	log.Info().
+		Str("tenantID", tenantID).
+		Str("requestedBy", requestedBy).
+		Msg("Erasing user notification data")
+
+	if userID == "" {
+		return nil, invalid(fmt.Errorf("user ID is required"))
+	}
+
+	record := &ErasureRecord{
+		ID:          generateErasureID(),
+		TenantID:    tenantID,
+		SubjectHash: s.subjectHash(tenantID, userID),
+		RequestedBy: requestedBy,
+		Erased:      make(map[string]int),
+		Status:      "completed",
+	}
+
+	s.mu.RLock()
+	for _, named := range s.stores {
+		count, err := named.store.EraseUserData(ctx, tenantID, userID)
+		if err != nil {
+			if record.Errors == nil {
+				record.Errors = make(map[string]string)
+			}
+			record.Errors[named.name] = err.Error()
+			record.Status = "partial"
+		}
+		record.Erased[named.name] = count
+	}
+	s.mu.RUnlock()
+
+	record.CompletedAt = time.Now()
+
+	if err := s.storeErasureRecord(ctx, *record); err != nil {
+		return record, fmt.Errorf("failed to store erasure record: %w", err)
+	}
+
+	log.Info().
+		Str("erasureID", record.ID).
+		Str("status", record.Status).
+		Msg("User notification data erased")
+
+	return record, nil
+}
+
+// GetErasureRecords returns the erasure records of a tenant, newest first
+func (s *PrivacyService) GetErasureRecords(ctx context.Context, tenantID string, page int, limit int) ([]*ErasureRecord, int, error) {
+	listKey := s.getErasuresKey(tenantID)
+
+	total, err := s.redis.ZCard(ctx, listKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get erasure count: %w", err)
+	}
+
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
+
+	ids, err := s.redis.ZRevRange(ctx, listKey, start, stop).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get erasure IDs: %w", err)
+	}
+
+	var records []*ErasureRecord
+	for _, id := range ids {
+		recordJSON, err := s.redis.Get(ctx, s.getErasureKey(id)).Result()
+		if err != nil {
+			continue
+		}
+
+		var record ErasureRecord
+		if err := json.Unmarshal([]byte(recordJSON), &record); err != nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+
+	return records, int(total), nil
+}
+
+// storeErasureRecord stores an erasure record and indexes it by tenant
+func (s *PrivacyService) storeErasureRecord(ctx context.Context, record ErasureRecord) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal erasure record: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getErasureKey(record.ID), recordJSON, s.config.AuditTTL)
+	pipe.ZAdd(ctx, s.getErasuresKey(record.TenantID), &redis.Z{
+		Score:  float64(record.CompletedAt.Unix()),
+		Member: record.ID,
+	})
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// subjectHash pseudonymises a data subject. The same subject always gets the same
+// hash, so repeated requests can be matched without storing who they were about.
+func (s *PrivacyService) subjectHash(tenantID string, userID string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.AuditSecret))
+	mac.Write([]byte(tenantID + ":" + userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Redis key generators
+func (s *PrivacyService) getErasureKey(erasureID string) string {
+	return fmt.Sprintf("privacy_erasure:%s", erasureID)
+}
+
+func (s *PrivacyService) getErasuresKey(tenantID string) string {
+	if tenantID == "" {
+		tenantID = "global"
+	}
+	return fmt.Sprintf("privacy_erasures:%s", tenantID)
+}
+
+// ExportUserData returns the delivery history and pending digests of a user
+func (s *NotificationService) ExportUserData(ctx context.Context, tenantID string, userID string) (interface{}, error) {
+	resultIDs, err := s.redis.SMembers(ctx, s.getUserResultsKey(tenantID, userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user deliveries: %w", err)
+	}
+
+	var deliveries []*NotificationResult
+	for _, id := range resultIDs {
+		result, err := s.GetNotificationStatus(ctx, id)
+		if err != nil {
+			continue
+		}
+		deliveries = append(deliveries, result)
+	}
+
+	digests := make(map[string][]DigestItem)
+	for _, channel := range []string{"email", "inapp"} {
+		items, err := s.redis.LRange(ctx, s.getDigestKey(tenantID, userID, channel), 0, -1).Result()
+		if err != nil {
+			continue
+		}
+		for _, itemJSON := range items {
+			var item DigestItem
+			if err := json.Unmarshal([]byte(itemJSON), &item); err == nil {
+				digests[channel] = append(digests[channel], item)
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"deliveries":      deliveries,
+		"pending_digests": digests,
+	}, nil
+}
+
+// EraseUserData anonymises the delivery results of a user and deletes the
+// requests and pending digests holding their contact details and content.
+// Results are kept as stubs so delivery statistics stay consistent.
+func (s *NotificationService) EraseUserData(ctx context.Context, tenantID string, userID string) (int, error) {
+	userKey := s.getUserResultsKey(tenantID, userID)
+
+	resultIDs, err := s.redis.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user deliveries: %w", err)
+	}
+
+	erased := 0
+	for _, id := range resultIDs {
+		result, err := s.GetNotificationStatus(ctx, id)
+		if err != nil {
+			continue
+		}
+
+		s.redis.Del(ctx, s.getRequestKey(result.RequestID), s.getTimelineKey(id))
+		if err := s.eraseHistoryTerms(ctx, *result); err != nil {
+			return erased, err
+		}
+
+		result.Recipient = ""
+		result.Error = ""
+		result.CallbackURL = ""
+		result.Metadata = map[string]interface{}{"erased": true}
+
+		resultJSON, err := s.pii.marshalResult(*result)
+		if err != nil {
+			continue
+		}
+		if err := s.redis.Set(ctx, s.getResultKey(id), resultJSON, redis.KeepTTL).Err(); err != nil {
+			return erased, fmt.Errorf("failed to anonymise delivery %s: %w", id, err)
+		}
+		erased++
+	}
+
+	for _, channel := range []string{"email", "inapp"} {
+		if deleted, err := s.redis.Del(ctx, s.getDigestKey(tenantID, userID, channel)).Result(); err == nil {
+			erased += int(deleted)
+		}
+	}
+
+	if err := s.redis.Del(ctx, userKey).Err(); err != nil {
+		return erased, fmt.Errorf("failed to delete user delivery index: %w", err)
+	}
+
+	return erased, nil
+}
+
+// ExportUserData returns the in-app notifications, stored preferences and
+// saved views of a user
+func (s *InAppNotificationService) ExportUserData(ctx context.Context, tenantID string, userID string) (interface{}, error) {
+	ids, err := s.getAllUserNotificationIDs(ctx, userID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []*InAppNotification
+	for _, id := range ids {
+		notification, err := s.GetNotification(ctx, id)
+		if err != nil {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+
+	// Only preferences the user actually stored are personal data
+	var preferences *NotificationPreferences
+	if preferencesJSON, err := s.redis.Get(ctx, s.getPreferencesKey(userID, tenantID)).Result(); err == nil {
+		var stored NotificationPreferences
+		if err := json.Unmarshal([]byte(preferencesJSON), &stored); err == nil {
+			preferences = &stored
+		}
+	}
+
+	views, err := s.ListSavedViews(ctx, userID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"notifications": notifications,
+		"preferences":   preferences,
+		"saved_views":   views,
+	}, nil
+}
+
+// EraseUserData deletes the in-app notifications, preferences and saved views
+// of a user
+func (s *InAppNotificationService) EraseUserData(ctx context.Context, tenantID string, userID string) (int, error) {
+	userKey := s.getUserNotificationsKey(userID, tenantID)
+
+	ids, err := s.getAllUserNotificationIDs(ctx, userID, tenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	erased := 0
+	for _, id := range ids {
+		notification, err := s.GetNotification(ctx, id)
+		if err == nil {
+			s.redis.ZRem(ctx, s.getCategoryKey(notification.Category, notification.TenantID), id)
+			if notification.Entity != nil {
+				s.redis.ZRem(ctx, s.getEntityKey(notification.TenantID, notification.Entity.Type, notification.Entity.ID), id)
+			}
+		}
+		s.redis.ZRem(ctx, s.getSnoozeDueKey(), id)
+		if deleted, err := s.redis.Del(ctx, s.getNotificationKey(id), s.getActionResponseKey(id)).Result(); err == nil {
+			erased += int(deleted)
+		}
+	}
+
+	if err := s.eraseUserIndex(ctx, userID, tenantID); err != nil {
+		return erased, err
+	}
+
+	deleted, err := s.redis.Del(ctx,
+		userKey,
+		s.getUnreadKey(userID, tenantID),
+		s.getSnoozedKey(userID, tenantID),
+		s.getPreferencesKey(userID, tenantID),
+		s.getSavedViewsKey(userID, tenantID),
+		s.getBroadcastCursorKey(userID, tenantID),
+	).Result()
+	if err != nil {
+		return erased, fmt.Errorf("failed to delete user notification data: %w", err)
+	}
+
+	return erased + int(deleted), nil
+}
+
+// getAllUserNotificationIDs returns the IDs of every in-app notification of a
+// user, including snoozed ones hidden from the inbox
+func (s *InAppNotificationService) getAllUserNotificationIDs(ctx context.Context, userID string, tenantID string) ([]string, error) {
+	ids, err := s.redis.ZRange(ctx, s.getUserNotificationsKey(userID, tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user notifications: %w", err)
+	}
+
+	snoozed, err := s.redis.ZRange(ctx, s.getSnoozedKey(userID, tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snoozed notifications: %w", err)
+	}
+
+	return append(ids, snoozed...), nil
+}
+
+// ExportUserData returns the contact details cached for a user
+func (r *RecipientResolver) ExportUserData(ctx context.Context, tenantID string, userID string) (interface{}, error) {
+	contactJSON, err := r.redis.Get(ctx, r.getContactKey(tenantID, userID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached contact: %w", err)
+	}
+
+	var contact UserContact
+	if err := json.Unmarshal([]byte(contactJSON), &contact); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached contact: %w", err)
+	}
+
+	return &contact, nil
+}
+
+// EraseUserData drops the contact details cached for a user. Cached group and
+// role member lists expire within the cache TTL.
+func (r *RecipientResolver) EraseUserData(ctx context.Context, tenantID string, userID string) (int, error) {
+	deleted, err := r.redis.Del(ctx, r.getContactKey(tenantID, userID)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete cached contact: %w", err)
+	}
+
+	return int(deleted), nil
+}
+
+// ExportUserData returns the push subscriptions of a user's devices
+func (s *PushNotificationService) ExportUserData(ctx context.Context, tenantID string, userID string) (interface{}, error) {
+	return s.GetUserSubscriptions(userID, tenantID)
+}
+
+// EraseUserData deletes the push subscriptions of a user's devices, and the
+// user Pusher Beams keeps with the devices signed in as it
+func (s *PushNotificationService) EraseUserData(ctx context.Context, tenantID string, userID string) (int, error) {
+	subscriptions, err := s.GetUserSubscriptions(userID, tenantID)
+	if err != nil {
+		return 0, err
+	}
+
+	if beams := s.beamsClient(); beams != nil {
+		if err := beams.deleteUser(ctx, userID); err != nil {
+			return 0, fmt.Errorf("failed to delete Pusher Beams user: %w", err)
+		}
+	}
+
+	erased := 0
+	for _, subscription := range subscriptions {
+		if err := s.DeleteSubscription(subscription.ID); err != nil {
+			return erased, err
+		}
+		erased++
+	}
+
+	return erased, nil
+}
+
+// Redis key generators
+func (s *NotificationService) getUserResultsKey(tenantID string, userID string) string {
+	if tenantID == "" {
+		tenantID = "global"
+	}
+	return fmt.Sprintf("notification_user_results:%s:%s", tenantID, userID)
+}
+
+// Helper functions
+
+// resultUserID returns the user a delivery was addressed to, when it is known
+func resultUserID(result NotificationResult) string {
+	if userID, ok := result.Metadata["recipient_user_id"].(string); ok && userID != "" {
+		return userID
+	}
+	if result.Type == "inapp" {
+		return result.Recipient
+	}
+	return ""
+}
+
+func generateErasureID() string {
+	return newID("erasure")
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// redisDump returns every key of the Redis of env with its value as text
+func redisDump(t *testing.T, env *integrationEnv) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+	client := env.service.redis
+
+	dump := make(map[string]string)
+	for _, key := range client.Keys(ctx, "*").Val() {
+		var value interface{}
+		switch client.Type(ctx, key).Val() {
+		case "string":
+			value = client.Get(ctx, key).Val()
+		case "hash":
+			value = client.HGetAll(ctx, key).Val()
+		case "set":
+			value = client.SMembers(ctx, key).Val()
+		case "zset":
+			value = client.ZRange(ctx, key, 0, -1).Val()
+		case "list":
+			value = client.LRange(ctx, key, 0, -1).Val()
+		}
+		dump[key] = fmt.Sprint(value)
+	}
+	return dump
+}
+
+func TestErasureRemovesEveryTraceOfTheUser(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	var err error
+	if env.service.pii, err = newPIICipher([]byte(strings.Repeat("k", 32)), env.service.redis); err != nil {
+		t.Fatalf("Failed to create PII cipher: %v", err)
+	}
+	// Notifications live long enough to be snoozed
+	env.service.inAppService.config.TTL = 24 * time.Hour
+
+	privacy, err := NewPrivacyService(PrivacyConfig{
+		RedisURL:    "redis://" + env.service.redis.Options().Addr,
+		AuditSecret: "audit-secret",
+	}, env.service)
+	if err != nil {
+		t.Fatalf("Failed to create privacy service: %v", err)
+	}
+
+	send := func(userID string, entity *EntityRef) *NotificationResult {
+		result, err := env.service.SendNotification(ctx, NotificationRequest{
+			Type:       "inapp",
+			Recipients: []string{userID},
+			Title:      "Kaza raporu",
+			Message:    "Forklift kazasının tutanağını imzalayın",
+			Category:   "safety",
+			TenantID:   "tenant-a",
+			Entity:     entity,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		return result
+	}
+
+	// The user holds notifications of every kind, stored preferences, a saved
+	// view, a device and cached contact details
+	linked := send("user-erased", &EntityRef{Type: "incident", ID: "123"})
+	snoozed := send("user-erased", nil)
+	if _, err := env.service.inAppService.SnoozeNotification(ctx, snoozed.MessageID, "user-erased", time.Now().Add(time.Hour), false); err != nil {
+		t.Fatalf("Failed to snooze: %v", err)
+	}
+	if _, err := env.service.inAppService.UpdateUserPreferences(ctx, "user-erased", "tenant-a", map[string]interface{}{"digest": "daily"}); err != nil {
+		t.Fatalf("Failed to store preferences: %v", err)
+	}
+	if _, err := env.service.inAppService.CreateSavedView(ctx, SavedView{UserID: "user-erased", TenantID: "tenant-a", Name: "Kazalar", Category: "safety"}); err != nil {
+		t.Fatalf("Failed to save view: %v", err)
+	}
+	if _, err := env.service.pushService.RegisterSubscription(PushSubscription{
+		UserID:      "user-erased",
+		TenantID:    "tenant-a",
+		DeviceToken: "device-token-of-the-user",
+		Platform:    "android",
+	}); err != nil {
+		t.Fatalf("Failed to register device: %v", err)
+	}
+	env.service.redis.Set(ctx, env.service.recipients.getContactKey("tenant-a", "user-erased"), `{"user_id":"user-erased","email":"erased@talimat.test"}`, 0)
+
+	kept := send("user-kept", &EntityRef{Type: "incident", ID: "123"})
+
+	record, err := privacy.EraseUserData(ctx, "tenant-a", "user-erased", "admin-a")
+	if err != nil {
+		t.Fatalf("Failed to erase: %v", err)
+	}
+	if record.Status != "completed" {
+		t.Fatalf("Expected the erasure to complete, got %s: %v", record.Status, record.Errors)
+	}
+
+	// Delivery results are kept as anonymised stubs found by their message.
+	// Nothing else refers to the encrypted requests and notifications of the
+	// user.
+	stubs := make(map[string]bool)
+	for _, result := range []*NotificationResult{linked, snoozed} {
+		stubs[env.service.getResultKey(result.ID)] = true
+		stubs[env.service.getMessageResultKey("inapp", result.MessageID)] = true
+	}
+	for key, value := range redisDump(t, env) {
+		traces := []string{"user-erased", "erased@talimat.test", "device-token-of-the-user", "Kazalar"}
+		if !stubs[key] {
+			traces = append(traces, linked.RequestID, linked.MessageID, snoozed.RequestID, snoozed.MessageID)
+		}
+		for _, trace := range traces {
+			if strings.Contains(key, trace) || strings.Contains(value, trace) {
+				t.Errorf("Expected %q to be erased, found in %s: %.200s", trace, key, value)
+			}
+		}
+	}
+
+	// The erasure leaves the other users of the tenant alone
+	notification, err := env.service.inAppService.GetNotification(ctx, kept.MessageID)
+	if err != nil || notification.UserID != "user-kept" {
+		t.Errorf("Expected the notification of another user to be kept, got %v", err)
+	}
+	if _, total, _ := env.service.inAppService.GetEntityNotifications(ctx, "tenant-a", "incident", "123", "user-kept", 1, 20); total != 1 {
+		t.Errorf("Expected the entity index of another user to be kept, got %d", total)
+	}
+}
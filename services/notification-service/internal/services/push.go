@@ -1,32 +1,50 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
 
-	pusher "github.com/pusher/pusher-http-go"
+	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
 )
 
 // PushNotificationService handles push notifications
 type PushNotificationService struct {
-	config PushConfig
-	client *http.Client
-	pusher *pusher.Client
+	config    PushConfig
+	client    *http.Client
+	providers map[string]PushProvider
+	redis     *redis.Client
+	pii       *piiCipher // encrypts device tokens and models at rest
 }
 
 // PushConfig holds push notification service configuration
 type PushConfig struct {
-	Provider   string // firebase, apns, web-push, pusher
-	APIKey     string
-	APISecret  string
-	AppID      string
-	ProjectID  string // Firebase project ID
-	BaseURL    string
-	MaxRetries int
-	RetryDelay time.Duration
-	DryRun     bool
+	RedisURL      string
+	RedisPassword string
+	RedisDB       int
+	Provider      string // firebase, apns, web-push, pusher; the default provider
+	// Platforms routes the devices of a platform to another provider, e.g. ios: apns
+	Platforms map[string]string
+	APIKey    string
+	APISecret string // Pusher Beams secret key
+	AppID     string // Pusher Beams instance ID
+	ProjectID string // Firebase project ID
+	// Firebase service account key, as JSON or the path of the key file
+	FirebaseCredentials string
+	// APNs token authentication with a p8 key, given inline or as a path
+	APNSKey     string
+	APNSKeyID   string
+	APNSTeamID  string
+	APNSTopic   string // bundle ID of the app
+	APNSSandbox bool
+	BaseURL     string
+	MaxRetries  int
+	RetryDelay  time.Duration
+	DryRun      bool
 }
 
 // PushMessage represents a push notification message
@@ -34,7 +52,7 @@ type PushMessage struct {
 	Title       string
 	Body        string
 	Data        map[string]interface{}
-	Image       string
+	Image       string // https URL of an image shown with the notification
 	Icon        string
 	Badge       int
 	Sound       string
@@ -44,7 +62,17 @@ type PushMessage struct {
 	Topic       string
 	Tokens      []string
 	UserIDs     []string
+	TenantID    string // tenant of UserIDs, whose registered devices are resolved
 	Tags        map[string]string
+	// DeepLink is opened when the notification is tapped, DeepLinks
+	// overrides it per platform (ios, android, web)
+	DeepLink  string
+	DeepLinks map[string]string
+	// Localizations holds the title and body per language, each device gets
+	// the one of the language it registered with
+	Localizations    map[string]PushLocalization
+	AndroidChannelID string // Android notification channel
+	IOSCategory      string // iOS notification category, selecting its actions
 }
 
 // PushResult represents the result of sending a push notification
@@ -55,55 +83,60 @@ type PushResult struct {
 	FailedCount int
 	Errors      []string
 	SentAt      time.Time
+	Simulated   bool // dry run, providers didn't deliver
+	// Tokens the provider rejected for good, pruned from future sends
+	InvalidTokens []InvalidToken
 }
 
 // PushSubscription represents a push notification subscription
 type PushSubscription struct {
-	ID          string
-	UserID      string
-	DeviceToken string
-	Platform    string // ios, android, web
-	AppVersion  string
-	DeviceModel string
-	OSVersion   string
-	Language    string
-	Timezone    string
-	Tags        map[string]string
-	CreatedAt   time.Time
-	LastActive  time.Time
-	IsActive    bool
+	ID          string            `json:"id"`
+	UserID      string            `json:"user_id"`
+	TenantID    string            `json:"tenant_id"`
+	DeviceToken string            `json:"device_token"`
+	Platform    string            `json:"platform"` // ios, android, web
+	AppVersion  string            `json:"app_version,omitempty"`
+	DeviceModel string            `json:"device_model,omitempty"`
+	OSVersion   string            `json:"os_version,omitempty"`
+	Language    string            `json:"language,omitempty"`
+	Timezone    string            `json:"timezone,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	LastActive  time.Time         `json:"last_active"`
+	IsActive    bool              `json:"is_active"`
 }
 
 // NewPushNotificationService creates a new push notification service instance
 func NewPushNotificationService(config PushConfig) (*PushNotificationService, error) {
-	var pusher *pushnotifications.PushNotifications
-	var err error
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
 
-	// Initialize provider-specific client
-	switch config.Provider {
-	case "pusher":
-		pusher, err = pusher.NewClient(config.AppID, config.APISecret)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize Pusher: %w", err)
-		}
-	case "firebase", "apns", "web-push":
-		// These would be initialized differently
-		pusher = nil
-	default:
-		return nil, fmt.Errorf("unsupported push provider: %s", config.Provider)
+	// Initialize the default provider and the ones platforms are routed to
+	providers, err := newPushProviders(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &PushNotificationService{
-		config: config,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		pusher: pusher,
+		config:    config,
+		client:    httpClient,
+		providers: providers,
+		redis:     redisClient,
 	}, nil
 }
 
 // SendPushNotification sends a push notification
-func (s *PushNotificationService) SendPushNotification(message PushMessage) (*PushResult, error) {
+func (s *PushNotificationService) SendPushNotification(ctx context.Context, message PushMessage) (*PushResult, error) {
 	log.Info().
 		Str("title", message.Title).
 		Int("tokenCount", len(message.Tokens)).
@@ -112,30 +145,21 @@ func (s *PushNotificationService) SendPushNotification(message PushMessage) (*Pu
 
 	// Validate message
 	if err := s.validateMessage(message); err != nil {
-		return nil, fmt.Errorf("message validation failed: %w", err)
+		return nil, invalid(fmt.Errorf("message validation failed: %w", err))
 	}
 
-	// Send based on provider
-	var result *PushResult
-	var err error
-
-	switch s.config.Provider {
-	case "pusher":
-		result, err = s.sendPusherNotification(message)
-	case "firebase":
-		result, err = s.sendFirebaseNotification(message)
-	case "apns":
-		result, err = s.sendAPNSNotification(message)
-	case "web-push":
-		result, err = s.sendWebPushNotification(message)
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", s.config.Provider)
+	// Each provider gets the devices of the platforms routed to it
+	routes, err := s.routeMessage(message)
+	if err != nil {
+		return nil, err
 	}
 
+	result, err := s.sendRouted(ctx, message.TenantID, routes)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to send push notification")
 		return nil, err
 	}
+	result.Simulated = s.config.DryRun
 
 	log.Info().
 		Str("messageID", result.MessageID).
@@ -147,7 +171,7 @@ func (s *PushNotificationService) SendPushNotification(message PushMessage) (*Pu
 }
 
 // SendBulkPushNotifications sends push notifications to multiple recipients
-func (s *PushNotificationService) SendBulkPushNotifications(messages []PushMessage) ([]*PushResult, error) {
+func (s *PushNotificationService) SendBulkPushNotifications(ctx context.Context, messages []PushMessage) ([]*PushResult, error) {
 	log.Info().Int("count", len(messages)).Msg("Sending bulk push notifications")
 
 	var results []*PushResult
@@ -162,7 +186,7 @@ func (s *PushNotificationService) SendBulkPushNotifications(messages []PushMessa
 		}
 
 		batch := messages[i:end]
-		batchResults, err := s.processBatch(batch)
+		batchResults, err := s.processBatch(ctx, batch)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("batch %d failed: %w", i/batchSize, err))
 		}
@@ -179,58 +203,58 @@ func (s *PushNotificationService) SendBulkPushNotifications(messages []PushMessa
 }
 
 // SendToTopic sends a push notification to a topic
-func (s *PushNotificationService) SendToTopic(topic string, message PushMessage) (*PushResult, error) {
+func (s *PushNotificationService) SendToTopic(ctx context.Context, topic string, message PushMessage) (*PushResult, error) {
 	log.Info().
 		Str("topic", topic).
 		Str("title", message.Title).
 		Msg("Sending push notification to topic")
 
 	message.Topic = topic
-	return s.SendPushNotification(message)
+	return s.SendPushNotification(ctx, message)
 }
 
 // SendToUser sends a push notification to a specific user
-func (s *PushNotificationService) SendToUser(userID string, message PushMessage) (*PushResult, error) {
+func (s *PushNotificationService) SendToUser(ctx context.Context, userID string, message PushMessage) (*PushResult, error) {
 	log.Info().
 		Str("userID", userID).
 		Str("title", message.Title).
 		Msg("Sending push notification to user")
 
 	message.UserIDs = []string{userID}
-	return s.SendPushNotification(message)
+	return s.SendPushNotification(ctx, message)
 }
 
 // SendToUsers sends a push notification to multiple users
-func (s *PushNotificationService) SendToUsers(userIDs []string, message PushMessage) (*PushResult, error) {
+func (s *PushNotificationService) SendToUsers(ctx context.Context, userIDs []string, message PushMessage) (*PushResult, error) {
 	log.Info().
 		Int("userCount", len(userIDs)).
 		Str("title", message.Title).
 		Msg("Sending push notification to users")
 
 	message.UserIDs = userIDs
-	return s.SendPushNotification(message)
+	return s.SendPushNotification(ctx, message)
 }
 
 // SendToDevice sends a push notification to a specific device
-func (s *PushNotificationService) SendToDevice(deviceToken string, message PushMessage) (*PushResult, error) {
+func (s *PushNotificationService) SendToDevice(ctx context.Context, deviceToken string, message PushMessage) (*PushResult, error) {
 	log.Info().
 		Str("deviceToken", truncateString(deviceToken, 20)).
 		Str("title", message.Title).
 		Msg("Sending push notification to device")
 
 	message.Tokens = []string{deviceToken}
-	return s.SendPushNotification(message)
+	return s.SendPushNotification(ctx, message)
 }
 
 // SendToDevices sends a push notification to multiple devices
-func (s *PushNotificationService) SendToDevices(deviceTokens []string, message PushMessage) (*PushResult, error) {
+func (s *PushNotificationService) SendToDevices(ctx context.Context, deviceTokens []string, message PushMessage) (*PushResult, error) {
 	log.Info().
 		Int("deviceCount", len(deviceTokens)).
 		Str("title", message.Title).
 		Msg("Sending push notification to devices")
 
 	message.Tokens = deviceTokens
-	return s.SendPushNotification(message)
+	return s.SendPushNotification(ctx, message)
 }
 
 // SubscribeToTopic subscribes a device to a topic
@@ -240,14 +264,7 @@ func (s *PushNotificationService) SubscribeToTopic(deviceToken string, topic str
 		Str("topic", topic).
 		Msg("Subscribing device to topic")
 
-	switch s.config.Provider {
-	case "firebase":
-		return s.subscribeToFirebaseTopic(deviceToken, topic)
-	case "pusher":
-		return s.subscribeToPusherTopic(deviceToken, topic)
-	default:
-		return fmt.Errorf("topic subscription not supported for provider: %s", s.config.Provider)
-	}
+	return s.providerForToken(deviceToken).SubscribeToTopic(deviceToken, topic)
 }
 
 // UnsubscribeFromTopic unsubscribes a device from a topic
@@ -257,32 +274,7 @@ func (s *PushNotificationService) UnsubscribeFromTopic(deviceToken string, topic
 		Str("topic", topic).
 		Msg("Unsubscribing device from topic")
 
-	switch s.config.Provider {
-	case "firebase":
-		return s.unsubscribeFromFirebaseTopic(deviceToken, topic)
-	case "pusher":
-		return s.unsubscribeFromPusherTopic(deviceToken, topic)
-	default:
-		return fmt.Errorf("topic unsubscription not supported for provider: %s", s.config.Provider)
-	}
-}
-
-// GetSubscriptionInfo gets information about a device subscription
-func (s *PushNotificationService) GetSubscriptionInfo(deviceToken string) (*PushSubscription, error) {
-	log.Info().
-		Str("deviceToken", truncateString(deviceToken, 20)).
-		Msg("Getting subscription info")
-
-	// This would typically query your database
-	// For now, return a placeholder
-	return &PushSubscription{
-		ID:          "placeholder",
-		DeviceToken: deviceToken,
-		Platform:    "unknown",
-		IsActive:    true,
-		CreatedAt:   time.Now(),
-		LastActive:  time.Now(),
-	}, nil
+	return s.providerForToken(deviceToken).UnsubscribeFromTopic(deviceToken, topic)
 }
 
 // TestConnection tests the push notification service connection
@@ -301,7 +293,7 @@ func (s *PushNotificationService) TestConnection() error {
 	}
 
 	// Try to send to a test token (this would fail but tests the connection)
-	_, err := s.SendPushNotification(testMessage)
+	_, err := s.SendPushNotification(context.Background(), testMessage)
 	if err != nil {
 		log.Error().Err(err).Msg("Push notification service connection test failed")
 		return fmt.Errorf("connection test failed: %w", err)
@@ -333,15 +325,15 @@ func (s *PushNotificationService) validateMessage(message PushMessage) error {
 		return fmt.Errorf("body exceeds 4000 characters")
 	}
 
-	return nil
+	return validateRichContent(message)
 }
 
 // processBatch processes a batch of push notifications
-func (s *PushNotificationService) processBatch(messages []PushMessage) ([]*PushResult, error) {
+func (s *PushNotificationService) processBatch(ctx context.Context, messages []PushMessage) ([]*PushResult, error) {
 	var results []*PushResult
 
 	for _, message := range messages {
-		result, err := s.SendPushNotification(message)
+		result, err := s.SendPushNotification(ctx, message)
 		if err != nil {
 			result = &PushResult{
 				Success:     false,
@@ -356,154 +348,6 @@ func (s *PushNotificationService) processBatch(messages []PushMessage) ([]*PushR
 	return results, nil
 }
 
-// sendPusherNotification sends a notification via Pusher
-func (s *PushNotificationService) sendPusherNotification(message PushMessage) (*PushResult, error) {
-	if s.pusher == nil {
-		return nil, fmt.Errorf("Pusher not initialized")
-	}
-
-	// Prepare notification data
-	notification := map[string]interface{}{
-		"title": message.Title,
-		"body":  message.Body,
-		"data":  message.Data,
-	}
-
-	if message.Image != "" {
-		notification["image"] = message.Image
-	}
-
-	if message.Icon != "" {
-		notification["icon"] = message.Icon
-	}
-
-	// Send to different targets
-	var sentCount int
-	var failedCount int
-	var errors []string
-
-	// Send to tokens
-	if len(message.Tokens) > 0 {
-		_, err := s.pusher.PublishToInterests([]string{"device"}, notification)
-		if err != nil {
-			failedCount += len(message.Tokens)
-			errors = append(errors, fmt.Sprintf("token send failed: %v", err))
-		} else {
-			sentCount += len(message.Tokens)
-		}
-	}
-
-	// Send to users
-	if len(message.UserIDs) > 0 {
-		_, err := s.pusher.PublishToUsers(message.UserIDs, notification)
-		if err != nil {
-			failedCount += len(message.UserIDs)
-			errors = append(errors, fmt.Sprintf("user send failed: %v", err))
-		} else {
-			sentCount += len(message.UserIDs)
-		}
-	}
-
-	// Send to topic
-	if message.Topic != "" {
-		_, err := s.pusher.PublishToInterests([]string{message.Topic}, notification)
-		if err != nil {
-			failedCount++
-			errors = append(errors, fmt.Sprintf("topic send failed: %v", err))
-		} else {
-			sentCount++
-		}
-	}
-
-	return &PushResult{
-		MessageID:   generateMessageID(),
-		Success:     failedCount == 0,
-		SentCount:   sentCount,
-		FailedCount: failedCount,
-		Errors:      errors,
-		SentAt:      time.Now(),
-	}, nil
-}
-
-// sendFirebaseNotification sends a notification via Firebase
-func (s *PushNotificationService) sendFirebaseNotification(message PushMessage) (*PushResult, error) {
-	// This would implement Firebase Cloud Messaging
-	// For now, return a placeholder result
-	return &PushResult{
-		MessageID:   generateMessageID(),
-		Success:     true,
-		SentCount:   len(message.Tokens) + len(message.UserIDs),
-		FailedCount: 0,
-		SentAt:      time.Now(),
-	}, nil
-}
-
-// sendAPNSNotification sends a notification via Apple Push Notification Service
-func (s *PushNotificationService) sendAPNSNotification(message PushMessage) (*PushResult, error) {
-	// This would implement APNS
-	// For now, return a placeholder result
-	return &PushResult{
-		MessageID:   generateMessageID(),
-		Success:     true,
-		SentCount:   len(message.Tokens) + len(message.UserIDs),
-		FailedCount: 0,
-		SentAt:      time.Now(),
-	}, nil
-}
-
-// sendWebPushNotification sends a notification via Web Push API
-func (s *PushNotificationService) sendWebPushNotification(message PushMessage) (*PushResult, error) {
-	// This would implement Web Push API
-	// For now, return a placeholder result
-	return &PushResult{
-		MessageID:   generateMessageID(),
-		Success:     true,
-		SentCount:   len(message.Tokens) + len(message.UserIDs),
-		FailedCount: 0,
-		SentAt:      time.Now(),
-	}, nil
-}
-
-// subscribeToFirebaseTopic subscribes a device to a Firebase topic
-func (s *PushNotificationService) subscribeToFirebaseTopic(deviceToken string, topic string) error {
-	// This would implement Firebase topic subscription
-	log.Info().
-		Str("deviceToken", truncateString(deviceToken, 20)).
-		Str("topic", topic).
-		Msg("Subscribing to Firebase topic")
-	return nil
-}
-
-// subscribeToPusherTopic subscribes a device to a Pusher topic
-func (s *PushNotificationService) subscribeToPusherTopic(deviceToken string, topic string) error {
-	// This would implement Pusher topic subscription
-	log.Info().
-		Str("deviceToken", truncateString(deviceToken, 20)).
-		Str("topic", topic).
-		Msg("Subscribing to Pusher topic")
-	return nil
-}
-
-// unsubscribeFromFirebaseTopic unsubscribes a device from a Firebase topic
-func (s *PushNotificationService) unsubscribeFromFirebaseTopic(deviceToken string, topic string) error {
-	// This would implement Firebase topic unsubscription
-	log.Info().
-		Str("deviceToken", truncateString(deviceToken, 20)).
-		Str("topic", topic).
-		Msg("Unsubscribing from Firebase topic")
-	return nil
-}
-
-// unsubscribeFromPusherTopic unsubscribes a device from a Pusher topic
-func (s *PushNotificationService) unsubscribeFromPusherTopic(deviceToken string, topic string) error {
-	// This would implement Pusher topic unsubscription
-	log.Info().
-		Str("deviceToken", truncateString(deviceToken, 20)).
-		Str("topic", topic).
-		Msg("Unsubscribing from Pusher topic")
-	return nil
-}
-
 // Helper functions
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
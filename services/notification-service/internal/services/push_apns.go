@@ -0,0 +1,363 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	apnsProductionURL = "https://api.push.apple.com"
+	apnsSandboxURL    = "https://api.sandbox.push.apple.com"
+
+	// apnsTokenLifetime is how long a provider token is reused. Apple rejects
+	// tokens older than an hour and refreshing more than every 20 minutes.
+	apnsTokenLifetime = 50 * time.Minute
+
+	// apnsConcurrency bounds the parallel requests of a multicast send,
+	// which share the HTTP/2 connection
+	apnsConcurrency = 20
+
+	apnsMaxCollapseIDLength = 64
+)
+
+// apnsClient sends notifications to the APNs provider API over HTTP/2,
+// authenticating with a provider token signed by a p8 key
+type apnsClient struct {
+	key     *ecdsa.PrivateKey
+	keyID   string
+	teamID  string
+	topic   string
+	baseURL string
+	dryRun  bool
+	client  *http.Client
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// apnsError is an error response of the APNs provider API
+type apnsError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *apnsError) Error() string {
+	return fmt.Sprintf("APNs error %d: %s", e.StatusCode, e.Reason)
+}
+
+// invalidTokenReason tells whether the error means the token will never work again
+func (e *apnsError) invalidTokenReason() string {
+	switch e.Reason {
+	case "Unregistered":
+		return TokenUnregistered
+	case "BadDeviceToken", "DeviceTokenNotForTopic":
+		return TokenInvalid
+	}
+	if e.StatusCode == http.StatusGone {
+		return TokenUnregistered
+	}
+	return ""
+}
+
+// newAPNSClient creates an APNs client from the p8 key in the config, given
+// either inline or as the path of the key file
+func newAPNSClient(config PushConfig) (*apnsClient, error) {
+	if config.APNSKeyID == "" || config.APNSTeamID == "" || config.APNSTopic == "" {
+		return nil, fmt.Errorf("APNs key ID, team ID and topic are required")
+	}
+
+	keyPEM := config.APNSKey
+	if !strings.Contains(keyPEM, "-----BEGIN") {
+		data, err := os.ReadFile(config.APNSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read APNs key: %w", err)
+		}
+		keyPEM = string(data)
+	}
+
+	key, err := parseECPrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse APNs key: %w", err)
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = apnsProductionURL
+		if config.APNSSandbox {
+			baseURL = apnsSandboxURL
+		}
+	}
+
+	// APNs only speaks HTTP/2, which the transport negotiates over TLS
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+
+	return &apnsClient{
+		key:     key,
+		keyID:   config.APNSKeyID,
+		teamID:  config.APNSTeamID,
+		topic:   config.APNSTopic,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		dryRun:  config.DryRun,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+		},
+	}, nil
+}
+
+func (c *apnsClient) Name() string {
+	return PushProviderAPNS
+}
+
+func (c *apnsClient) Capabilities() PushCapabilities {
+	return PushCapabilities{}
+}
+
+// Send sends a notification via Apple Push Notification Service. Every device
+// gets its own request; devices APNs rejects for good are reported for pruning.
+func (c *apnsClient) Send(ctx context.Context, message PushMessage) (*PushResult, error) {
+	payload, err := json.Marshal(buildAPNSPayload(message))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal APNs payload: %w", err)
+	}
+	if len(payload) > 4096 {
+		return nil, invalid(fmt.Errorf("APNs payload exceeds 4096 bytes"))
+	}
+
+	result := &PushResult{
+		MessageID: generateMessageID(),
+		SentAt:    time.Now(),
+	}
+	outcome := &pushOutcome{result: result}
+
+	if message.Topic != "" {
+		// APNs addresses devices only, tenant topics reach iOS devices through FCM or Pusher
+		outcome.record("", "topic "+message.Topic, fmt.Errorf("topics are not supported by APNs"))
+	}
+
+	headers := apnsHeaders(message)
+	outcome.sendToTokens(message.Tokens, apnsConcurrency, func(token string) error {
+		return c.send(ctx, token, headers, payload)
+	})
+
+	// Nothing went out and a retry may help, so let the caller retry
+	if result.SentCount == 0 && outcome.transient > 0 && len(message.Tokens) > 0 {
+		return result, fmt.Errorf("APNs send failed: %s", result.Errors[0])
+	}
+
+	result.Success = result.FailedCount == 0
+	return result, nil
+}
+
+// SubscribeToTopic is not supported, APNs has no topics
+func (c *apnsClient) SubscribeToTopic(deviceToken string, topic string) error {
+	return fmt.Errorf("topic subscription not supported for provider: %s", PushProviderAPNS)
+}
+
+// UnsubscribeFromTopic is not supported, APNs has no topics
+func (c *apnsClient) UnsubscribeFromTopic(deviceToken string, topic string) error {
+	return fmt.Errorf("topic unsubscription not supported for provider: %s", PushProviderAPNS)
+}
+
+// send sends a notification to a single device
+func (c *apnsClient) send(ctx context.Context, deviceToken string, headers map[string]string, payload []byte) error {
+	if c.dryRun {
+		log.Debug().Str("deviceToken", truncateString(deviceToken, 20)).Msg("APNs dry run, notification not sent")
+		return nil
+	}
+
+	token, err := c.providerToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/3/device/"+deviceToken, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create APNs request: %w", err)
+	}
+	req.Header.Set("authorization", "bearer "+token)
+	req.Header.Set("apns-topic", c.topic)
+	req.Header.Set("content-type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send APNs request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var response struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(body, &response)
+
+	// Provider tokens rejected as expired are minted again on the next send
+	if response.Reason == "ExpiredProviderToken" || response.Reason == "InvalidProviderToken" {
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+	}
+
+	return &apnsError{StatusCode: resp.StatusCode, Reason: response.Reason}
+}
+
+// providerToken returns the cached provider token, signing a new one when it
+// is about to expire
+func (c *apnsClient) providerToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Since(c.issuedAt) < apnsTokenLifetime {
+		return c.token, nil
+	}
+
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{
+		"alg": "ES256",
+		"kid": c.keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": c.teamID,
+		"iat": now.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, sigS, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign APNs provider token: %w", err)
+	}
+
+	// JWS wants the raw fixed-size r || s, not the ASN.1 encoding
+	signature := make([]byte, 64)
+	fillBigInt(signature[:32], r)
+	fillBigInt(signature[32:], sigS)
+
+	c.token = signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	c.issuedAt = now
+
+	return c.token, nil
+}
+
+// buildAPNSPayload builds the aps dictionary of a push message, with the
+// message data as custom keys next to it
+func buildAPNSPayload(message PushMessage) map[string]interface{} {
+	aps := map[string]interface{}{
+		"alert": map[string]string{
+			"title": message.Title,
+			"body":  message.Body,
+		},
+	}
+	if message.Badge > 0 {
+		aps["badge"] = message.Badge
+	}
+	if message.Sound != "" {
+		aps["sound"] = message.Sound
+	}
+	if message.CollapseKey != "" {
+		aps["thread-id"] = message.CollapseKey
+	}
+	if message.IOSCategory != "" {
+		aps["category"] = message.IOSCategory
+	}
+	if message.Image != "" {
+		// Lets the notification service extension download the image
+		aps["mutable-content"] = 1
+	}
+
+	payload := map[string]interface{}{}
+	for k, v := range message.Data {
+		payload[k] = v
+	}
+	if message.Image != "" {
+		payload["image"] = message.Image
+	}
+	if link := message.deepLinkFor(PlatformIOS); link != "" {
+		payload["deep_link"] = link
+	}
+	payload["aps"] = aps
+
+	return payload
+}
+
+// apnsHeaders maps the delivery options of a push message onto APNs headers
+func apnsHeaders(message PushMessage) map[string]string {
+	headers := map[string]string{
+		"apns-push-type": "alert",
+		"apns-priority":  "5",
+	}
+	if message.Priority == "high" || message.Priority == "urgent" {
+		headers["apns-priority"] = "10"
+	}
+	if message.TTL > 0 {
+		headers["apns-expiration"] = strconv.FormatInt(time.Now().Add(message.TTL).Unix(), 10)
+	}
+	if message.CollapseKey != "" && len(message.CollapseKey) <= apnsMaxCollapseIDLength {
+		headers["apns-collapse-id"] = message.CollapseKey
+	}
+	return headers
+}
+
+// parseECPrivateKey parses a PEM encoded PKCS#8 EC private key, the format of
+// the p8 keys Apple issues
+func parseECPrivateKey(data string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, ecErr := x509.ParseECPrivateKey(block.Bytes); ecErr == nil {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an EC key")
+	}
+
+	return key, nil
+}
+
+// fillBigInt writes n big-endian into dst, left-padded with zeros
+func fillBigInt(dst []byte, n *big.Int) {
+	b := n.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
@@ -0,0 +1,542 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	fcmDefaultBaseURL  = "https://fcm.googleapis.com"
+	fcmDefaultTokenURL = "https://oauth2.googleapis.com/token"
+	fcmScope           = "https://www.googleapis.com/auth/firebase.messaging"
+
+	// fcmConcurrency bounds the parallel requests of a multicast send
+	fcmConcurrency = 10
+)
+
+// fcmServiceAccount is the part of a Google service account key FCM needs
+type fcmServiceAccount struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// fcmClient sends messages through the FCM HTTP v1 API, authenticating with
+// OAuth2 access tokens minted from a service account key
+type fcmClient struct {
+	account   fcmServiceAccount
+	key       *rsa.PrivateKey
+	projectID string
+	baseURL   string
+	dryRun    bool
+	client    *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// fcmMessage is the message resource of the FCM HTTP v1 API
+type fcmMessage struct {
+	Token        string            `json:"token,omitempty"`
+	Topic        string            `json:"topic,omitempty"`
+	Notification *fcmNotification  `json:"notification,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *fcmAndroidConfig `json:"android,omitempty"`
+	APNS         *fcmAPNSConfig    `json:"apns,omitempty"`
+	Webpush      *fcmWebpushConfig `json:"webpush,omitempty"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+type fcmAndroidConfig struct {
+	CollapseKey  string                  `json:"collapse_key,omitempty"`
+	Priority     string                  `json:"priority,omitempty"` // NORMAL, HIGH
+	TTL          string                  `json:"ttl,omitempty"`
+	Data         map[string]string       `json:"data,omitempty"` // replaces the message data on Android
+	Notification *fcmAndroidNotification `json:"notification,omitempty"`
+}
+
+type fcmAndroidNotification struct {
+	Icon      string `json:"icon,omitempty"`
+	Sound     string `json:"sound,omitempty"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+type fcmAPNSConfig struct {
+	Headers    map[string]string      `json:"headers,omitempty"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+	FCMOptions *fcmAPNSOptions        `json:"fcm_options,omitempty"`
+}
+
+type fcmAPNSOptions struct {
+	Image string `json:"image,omitempty"`
+}
+
+type fcmWebpushConfig struct {
+	FCMOptions *fcmWebpushOptions `json:"fcm_options,omitempty"`
+}
+
+type fcmWebpushOptions struct {
+	Link string `json:"link,omitempty"`
+}
+
+// fcmError is an error response of the FCM HTTP v1 API
+type fcmError struct {
+	StatusCode int
+	Status     string // canonical status, e.g. NOT_FOUND
+	ErrorCode  string // FCM error code, e.g. UNREGISTERED
+	Message    string
+}
+
+func (e *fcmError) Error() string {
+	code := e.ErrorCode
+	if code == "" {
+		code = e.Status
+	}
+	return fmt.Sprintf("FCM error %d %s: %s", e.StatusCode, code, e.Message)
+}
+
+// invalidTokenReason tells whether the error means the token will never work again
+func (e *fcmError) invalidTokenReason() string {
+	switch e.ErrorCode {
+	case "UNREGISTERED":
+		return TokenUnregistered
+	case "SENDER_ID_MISMATCH":
+		return TokenInvalid
+	case "INVALID_ARGUMENT":
+		if strings.Contains(strings.ToLower(e.Message), "registration token") {
+			return TokenInvalid
+		}
+	}
+	if e.StatusCode == http.StatusNotFound {
+		return TokenUnregistered
+	}
+	return ""
+}
+
+// newFCMClient creates an FCM client from the service account key in the
+// config, given either inline as JSON or as the path of the key file
+func newFCMClient(config PushConfig, client *http.Client) (*fcmClient, error) {
+	credentials := []byte(config.FirebaseCredentials)
+	if !strings.HasPrefix(strings.TrimSpace(config.FirebaseCredentials), "{") {
+		data, err := os.ReadFile(config.FirebaseCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Firebase credentials: %w", err)
+		}
+		credentials = data
+	}
+
+	var account fcmServiceAccount
+	if err := json.Unmarshal(credentials, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse Firebase credentials: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("Firebase credentials must hold client_email and private_key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = fcmDefaultTokenURL
+	}
+
+	key, err := parseRSAPrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Firebase private key: %w", err)
+	}
+
+	projectID := config.ProjectID
+	if projectID == "" {
+		projectID = account.ProjectID
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("Firebase project ID is required")
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = fcmDefaultBaseURL
+	}
+
+	return &fcmClient{
+		account:   account,
+		key:       key,
+		projectID: projectID,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		dryRun:    config.DryRun,
+		client:    client,
+	}, nil
+}
+
+func (c *fcmClient) Name() string {
+	return PushProviderFirebase
+}
+
+func (c *fcmClient) Capabilities() PushCapabilities {
+	return PushCapabilities{Topics: true}
+}
+
+// Send sends a notification via Firebase Cloud Messaging. Tokens are sent to
+// one request each, in parallel; tokens FCM rejects for good are reported for
+// pruning.
+func (c *fcmClient) Send(ctx context.Context, message PushMessage) (*PushResult, error) {
+	base := buildFCMMessage(message)
+	result := &PushResult{
+		MessageID: generateMessageID(),
+		SentAt:    time.Now(),
+	}
+
+	outcome := &pushOutcome{result: result}
+
+	if message.Topic != "" {
+		topicMessage := base
+		topicMessage.Topic = message.Topic
+		outcome.record("", "topic "+message.Topic, c.send(ctx, topicMessage))
+	}
+
+	outcome.sendToTokens(message.Tokens, fcmConcurrency, func(token string) error {
+		tokenMessage := base
+		tokenMessage.Token = token
+		return c.send(ctx, tokenMessage)
+	})
+
+	// Nothing went out and a retry may help, so let the caller retry
+	if result.SentCount == 0 && outcome.transient > 0 {
+		return result, fmt.Errorf("FCM send failed: %s", result.Errors[0])
+	}
+
+	result.Success = result.FailedCount == 0
+	return result, nil
+}
+
+// send sends a single message
+func (c *fcmClient) send(ctx context.Context, message fcmMessage) error {
+	accessToken, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"message":       message,
+		"validate_only": c.dryRun,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal FCM message: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", c.baseURL, url.PathEscape(c.projectID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create FCM request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send FCM request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// Access tokens can be revoked before they expire
+	if resp.StatusCode == http.StatusUnauthorized {
+		c.mu.Lock()
+		c.accessToken = ""
+		c.mu.Unlock()
+	}
+
+	return parseFCMError(resp.StatusCode, respBody)
+}
+
+// SubscribeToTopic subscribes a device to a Firebase topic
+func (c *fcmClient) SubscribeToTopic(deviceToken string, topic string) error {
+	// This would implement Firebase topic subscription
+	log.Info().
+		Str("deviceToken", truncateString(deviceToken, 20)).
+		Str("topic", topic).
+		Msg("Subscribing to Firebase topic")
+	return nil
+}
+
+// UnsubscribeFromTopic unsubscribes a device from a Firebase topic
+func (c *fcmClient) UnsubscribeFromTopic(deviceToken string, topic string) error {
+	// This would implement Firebase topic unsubscription
+	log.Info().
+		Str("deviceToken", truncateString(deviceToken, 20)).
+		Str("topic", topic).
+		Msg("Unsubscribing from Firebase topic")
+	return nil
+}
+
+// token returns a cached access token, minting a new one shortly before it expires
+func (c *fcmClient) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken != "" && time.Now().Before(c.expiresAt.Add(-time.Minute)) {
+		return c.accessToken, nil
+	}
+
+	assertion, err := c.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create FCM access token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request FCM access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("FCM access token request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to parse FCM access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("FCM access token response holds no token")
+	}
+
+	c.accessToken = token.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return c.accessToken, nil
+}
+
+// assertion signs the JWT the service account exchanges for an access token
+func (c *fcmClient) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": c.account.PrivateKeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   c.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   c.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM assertion: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// buildFCMMessage maps a push message onto an FCM message with the Android and
+// APNs specifics FCM passes on to the platforms
+func buildFCMMessage(message PushMessage) fcmMessage {
+	fcm := fcmMessage{
+		Notification: &fcmNotification{
+			Title: message.Title,
+			Body:  message.Body,
+			Image: message.Image,
+		},
+		Data: fcmData(message.Data),
+	}
+
+	android := &fcmAndroidConfig{
+		CollapseKey: message.CollapseKey,
+		Priority:    "NORMAL",
+	}
+	apnsHeaders := map[string]string{"apns-priority": "5"}
+	if message.Priority == "high" || message.Priority == "urgent" {
+		android.Priority = "HIGH"
+		apnsHeaders["apns-priority"] = "10"
+	}
+	if message.TTL > 0 {
+		android.TTL = fmt.Sprintf("%ds", int(message.TTL.Seconds()))
+		apnsHeaders["apns-expiration"] = strconv.FormatInt(time.Now().Add(message.TTL).Unix(), 10)
+	}
+	if message.CollapseKey != "" {
+		apnsHeaders["apns-collapse-id"] = message.CollapseKey
+	}
+	if message.Icon != "" || message.Sound != "" || message.AndroidChannelID != "" {
+		android.Notification = &fcmAndroidNotification{
+			Icon:      message.Icon,
+			Sound:     message.Sound,
+			ChannelID: message.AndroidChannelID,
+		}
+	}
+	if link := message.deepLinkFor(PlatformAndroid); link != "" {
+		android.Data = fcmData(message.Data)
+		if android.Data == nil {
+			android.Data = map[string]string{}
+		}
+		android.Data["deep_link"] = link
+	}
+	fcm.Android = android
+
+	aps := map[string]interface{}{}
+	if message.Badge > 0 {
+		aps["badge"] = message.Badge
+	}
+	if message.Sound != "" {
+		aps["sound"] = message.Sound
+	}
+	if message.IOSCategory != "" {
+		aps["category"] = message.IOSCategory
+	}
+	fcm.APNS = &fcmAPNSConfig{Headers: apnsHeaders}
+	if message.Image != "" {
+		// Lets the notification service extension download the image
+		aps["mutable-content"] = 1
+		fcm.APNS.FCMOptions = &fcmAPNSOptions{Image: message.Image}
+	}
+	payload := map[string]interface{}{}
+	if len(aps) > 0 {
+		payload["aps"] = aps
+	}
+	if link := message.deepLinkFor(PlatformIOS); link != "" {
+		payload["deep_link"] = link
+	}
+	if len(payload) > 0 {
+		fcm.APNS.Payload = payload
+	}
+
+	// FCM only opens https links of web notifications
+	if link := message.deepLinkFor(PlatformWeb); strings.HasPrefix(link, "https://") {
+		fcm.Webpush = &fcmWebpushConfig{FCMOptions: &fcmWebpushOptions{Link: link}}
+	}
+
+	return fcm
+}
+
+// fcmData converts data to the string values FCM requires
+func fcmData(data map[string]interface{}) map[string]string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	converted := make(map[string]string, len(data))
+	for k, v := range data {
+		switch value := v.(type) {
+		case string:
+			converted[k] = value
+		case nil:
+			converted[k] = ""
+		default:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				converted[k] = fmt.Sprint(value)
+				continue
+			}
+			converted[k] = string(encoded)
+		}
+	}
+
+	return converted
+}
+
+// parseFCMError reads the error of an FCM response
+func parseFCMError(statusCode int, body []byte) *fcmError {
+	fcmErr := &fcmError{StatusCode: statusCode, Message: strings.TrimSpace(string(body))}
+
+	var envelope struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				Type      string `json:"@type"`
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fcmErr
+	}
+
+	fcmErr.Message = envelope.Error.Message
+	fcmErr.Status = envelope.Error.Status
+	fcmErr.ErrorCode = envelope.Error.Status
+	for _, detail := range envelope.Error.Details {
+		if detail.ErrorCode != "" {
+			fcmErr.ErrorCode = detail.ErrorCode
+			break
+		}
+	}
+
+	return fcmErr
+}
+
+// parseRSAPrivateKey parses a PEM encoded PKCS#8 or PKCS#1 RSA private key
+func parseRSAPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+
+	return key, nil
+}
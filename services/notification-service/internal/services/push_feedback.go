@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons providers give for rejecting a token for good
+const (
+	TokenUnregistered = "unregistered" // app uninstalled, FCM UNREGISTERED, APNs 410
+	TokenInvalid      = "invalid"      // malformed or issued for another app
+)
+
+// prunedTokenRetention is how long pruned tokens are kept in the tenant report
+const prunedTokenRetention = 90 * 24 * time.Hour
+
+// InvalidToken is a token a provider reported as permanently undeliverable
+type InvalidToken struct {
+	Token  string `json:"token"`
+	Reason string `json:"reason"`
+}
+
+// tokenRejection is implemented by provider errors that can tell a token
+// will never work again
+type tokenRejection interface {
+	invalidTokenReason() string
+}
+
+// pushOutcome collects the outcomes of the requests of a multicast send
+type pushOutcome struct {
+	mu        sync.Mutex
+	result    *PushResult
+	transient int // failures a retry may fix
+}
+
+// record records the outcome of a request to a token or, without token, a topic
+func (o *pushOutcome) record(token string, target string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err == nil {
+		o.result.SentCount++
+		return
+	}
+
+	o.result.FailedCount++
+	o.result.Errors = append(o.result.Errors, fmt.Sprintf("%s: %v", target, err))
+
+	if rejection, ok := err.(tokenRejection); ok && token != "" {
+		if reason := rejection.invalidTokenReason(); reason != "" {
+			o.result.InvalidTokens = append(o.result.InvalidTokens, InvalidToken{Token: token, Reason: reason})
+			return
+		}
+	}
+	o.transient++
+}
+
+// sendToTokens sends to every token with at most concurrency requests in flight
+func (o *pushOutcome) sendToTokens(tokens []string, concurrency int, send func(token string) error) {
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for _, token := range tokens {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(token string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			o.record(token, truncateString(token, 20), send(token))
+		}(token)
+	}
+
+	wg.Wait()
+}
+
+// PrunedToken records a token that was removed from sends
+type PrunedToken struct {
+	SubscriptionID string    `json:"subscription_id,omitempty"`
+	UserID         string    `json:"user_id,omitempty"`
+	Platform       string    `json:"platform,omitempty"`
+	Token          string    `json:"token"` // truncated
+	Reason         string    `json:"reason"`
+	PrunedAt       time.Time `json:"pruned_at"`
+}
+
+// PrunedTokenReport tells how many tokens of a tenant were pruned
+type PrunedTokenReport struct {
+	TenantID   string         `json:"tenant_id"`
+	Since      time.Time      `json:"since"`
+	Total      int            `json:"total"`
+	ByReason   map[string]int `json:"by_reason"`
+	ByPlatform map[string]int `json:"by_platform"`
+	Tokens     []*PrunedToken `json:"tokens"`
+}
+
+// GetPrunedTokenReport returns the tokens of a tenant pruned since the given time, newest first
+func (s *PushNotificationService) GetPrunedTokenReport(tenantID string, since time.Time, limit int) (*PrunedTokenReport, error) {
+	ctx := context.Background()
+
+	entries, err := s.redis.ZRevRangeByScore(ctx, s.getPrunedTokensKey(tenantID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pruned tokens: %w", err)
+	}
+
+	report := &PrunedTokenReport{
+		TenantID:   tenantID,
+		Since:      since,
+		ByReason:   make(map[string]int),
+		ByPlatform: make(map[string]int),
+		Tokens:     []*PrunedToken{},
+	}
+
+	for _, entry := range entries {
+		var pruned PrunedToken
+		if err := json.Unmarshal([]byte(entry), &pruned); err != nil {
+			continue
+		}
+
+		report.Total++
+		report.ByReason[pruned.Reason]++
+		if pruned.Platform != "" {
+			report.ByPlatform[pruned.Platform]++
+		}
+		if len(report.Tokens) < limit {
+			report.Tokens = append(report.Tokens, &pruned)
+		}
+	}
+
+	return report, nil
+}
+
+// pruneInvalidTokens deactivates the subscriptions of tokens a provider
+// rejected for good, so they are left out of future sends
+func (s *PushNotificationService) pruneInvalidTokens(tenantID string, tokens []InvalidToken) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, rejected := range tokens {
+		log.Info().
+			Str("deviceToken", truncateString(rejected.Token, 20)).
+			Str("reason", rejected.Reason).
+			Msg("Pruning push token")
+
+		pruned := PrunedToken{
+			Token:    truncateString(rejected.Token, 20),
+			Reason:   rejected.Reason,
+			PrunedAt: now,
+		}
+		reportTenant := tenantID
+
+		if subscription, err := s.GetSubscriptionInfo(rejected.Token); err == nil {
+			pruned.SubscriptionID = subscription.ID
+			pruned.UserID = subscription.UserID
+			pruned.Platform = subscription.Platform
+			reportTenant = subscription.TenantID
+
+			if subscription.IsActive {
+				deactivated := *subscription
+				deactivated.IsActive = false
+				if err := s.storeSubscription(subscription, &deactivated); err != nil {
+					log.Error().Err(err).Str("subscriptionID", subscription.ID).Msg("Failed to deactivate pruned subscription")
+				}
+			}
+		}
+
+		prunedJSON, err := json.Marshal(pruned)
+		if err != nil {
+			continue
+		}
+
+		pipe := s.redis.TxPipeline()
+		pipe.SAdd(ctx, s.getInvalidTokensKey(), tokenHash(rejected.Token))
+		if reportTenant != "" {
+			reportKey := s.getPrunedTokensKey(reportTenant)
+			pipe.ZAdd(ctx, reportKey, &redis.Z{
+				Score:  float64(now.Unix()),
+				Member: prunedJSON,
+			})
+			pipe.ZRemRangeByScore(ctx, reportKey, "-inf", strconv.FormatInt(now.Add(-prunedTokenRetention).Unix(), 10))
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to record pruned push token")
+		}
+	}
+}
+
+// filterInvalidTokens drops tokens that were pruned earlier
+func (s *PushNotificationService) filterInvalidTokens(tokens []string) []string {
+	if len(tokens) == 0 {
+		return tokens
+	}
+
+	hashes := make([]interface{}, len(tokens))
+	for i, token := range tokens {
+		hashes[i] = tokenHash(token)
+	}
+
+	pruned, err := s.redis.SMIsMember(context.Background(), s.getInvalidTokensKey(), hashes...).Result()
+	if err != nil {
+		// Sending to a dead token is cheaper than not sending at all
+		log.Warn().Err(err).Msg("Failed to check pruned push tokens")
+		return tokens
+	}
+
+	valid := make([]string, 0, len(tokens))
+	for i, token := range tokens {
+		if !pruned[i] {
+			valid = append(valid, token)
+		}
+	}
+
+	return valid
+}
+
+// clearInvalidToken forgets that a token was pruned, once an app registers it again
+func (s *PushNotificationService) clearInvalidToken(token string) {
+	if err := s.redis.SRem(context.Background(), s.getInvalidTokensKey(), tokenHash(token)).Err(); err != nil {
+		log.Warn().Err(err).Msg("Failed to clear pruned push token")
+	}
+}
+
+// Redis key generators
+func (s *PushNotificationService) getInvalidTokensKey() string {
+	return "push_invalid_tokens"
+}
+
+func (s *PushNotificationService) getPrunedTokensKey(tenantID string) string {
+	return fmt.Sprintf("push_pruned:%s", tenantID)
+}
+
+// Helper functions
+
+// tokenHash keys push tokens, which can be several hundred characters long
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the built-in push providers
+const (
+	PushProviderFirebase = "firebase"
+	PushProviderAPNS     = "apns"
+	PushProviderWebPush  = "web-push"
+	PushProviderPusher   = "pusher"
+)
+
+// PushProvider interface for different push providers. Send delivers a message
+// to its tokens, and to its topic and users when the provider addresses them.
+// A provider may return a result together with an error, so the tokens it
+// rejected are pruned even when nothing went out.
+type PushProvider interface {
+	Name() string
+	Capabilities() PushCapabilities
+	Send(ctx context.Context, message PushMessage) (*PushResult, error)
+	SubscribeToTopic(deviceToken string, topic string) error
+	UnsubscribeFromTopic(deviceToken string, topic string) error
+}
+
+// PushCapabilities tells which targets besides device tokens a provider addresses
+type PushCapabilities struct {
+	Topics bool
+	// Users are addressed by the provider itself rather than resolved to
+	// the devices registered for them
+	Users bool
+}
+
+// PushProviderFactory creates a push provider from the service configuration
+type PushProviderFactory func(config PushConfig, client *http.Client) (PushProvider, error)
+
+var (
+	pushProvidersMu sync.RWMutex
+	pushProviders   = map[string]PushProviderFactory{
+		PushProviderFirebase: func(config PushConfig, client *http.Client) (PushProvider, error) {
+			fcm, err := newFCMClient(config, client)
+			if err != nil {
+				return nil, err
+			}
+			return fcm, nil
+		},
+		PushProviderAPNS: func(config PushConfig, client *http.Client) (PushProvider, error) {
+			apns, err := newAPNSClient(config)
+			if err != nil {
+				return nil, err
+			}
+			return apns, nil
+		},
+		PushProviderPusher: func(config PushConfig, client *http.Client) (PushProvider, error) {
+			beams, err := newBeamsClient(config, client)
+			if err != nil {
+				return nil, err
+			}
+			return beams, nil
+		},
+		PushProviderWebPush: func(config PushConfig, client *http.Client) (PushProvider, error) {
+			return &webPushProvider{}, nil
+		},
+	}
+)
+
+// RegisterPushProvider makes a push provider available under a name, to be
+// selected in PushConfig.Provider or PushConfig.Platforms
+func RegisterPushProvider(name string, factory PushProviderFactory) {
+	pushProvidersMu.Lock()
+	defer pushProvidersMu.Unlock()
+
+	pushProviders[name] = factory
+}
+
+// newPushProviders creates the default provider and the providers the
+// platforms are routed to
+func newPushProviders(config PushConfig, client *http.Client) (map[string]PushProvider, error) {
+	names := []string{config.Provider}
+	for platform, name := range config.Platforms {
+		switch platform {
+		case PlatformIOS, PlatformAndroid, PlatformWeb:
+		default:
+			return nil, fmt.Errorf("invalid push platform: %s", platform)
+		}
+		names = append(names, name)
+	}
+
+	pushProvidersMu.RLock()
+	defer pushProvidersMu.RUnlock()
+
+	providers := make(map[string]PushProvider)
+	for _, name := range names {
+		if _, ok := providers[name]; ok {
+			continue
+		}
+
+		factory, ok := pushProviders[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported push provider: %s", name)
+		}
+
+		// BaseURL overrides the endpoint of the default provider only
+		providerConfig := config
+		if name != config.Provider {
+			providerConfig.BaseURL = ""
+		}
+
+		provider, err := factory(providerConfig, client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize %s: %w", name, err)
+		}
+		providers[name] = provider
+	}
+
+	return providers, nil
+}
+
+// pushRoute is a provider and the localization of the message it sends
+type pushRoute struct {
+	provider string
+	language string
+}
+
+// routeMessage splits a message into one message per provider and device
+// language. Devices are routed by the platform they registered with, topics
+// go to every provider that has topics and users to the default provider
+// when it addresses them.
+func (s *PushNotificationService) routeMessage(message PushMessage) (map[pushRoute]*PushMessage, error) {
+	routes := make(map[pushRoute]*PushMessage)
+	route := func(key pushRoute) *PushMessage {
+		routed, ok := routes[key]
+		if !ok {
+			copied := message.localized(key.language)
+			copied.Tokens = nil
+			copied.UserIDs = nil
+			copied.Topic = ""
+			routed = &copied
+			routes[key] = routed
+		}
+		return routed
+	}
+
+	// Subscriptions of the tokens, nil for tokens that were not registered
+	devices := make(map[string]*PushSubscription)
+	var tokens []string
+	for _, token := range message.Tokens {
+		if _, ok := devices[token]; ok {
+			continue
+		}
+		devices[token] = nil
+		if subscription, err := s.GetSubscriptionInfo(token); err == nil {
+			devices[token] = subscription
+		}
+		tokens = append(tokens, token)
+	}
+
+	if len(message.UserIDs) > 0 {
+		if s.defaultProvider().Capabilities().Users {
+			route(pushRoute{provider: s.config.Provider}).UserIDs = message.UserIDs
+		} else {
+			subscriptions, err := s.resolveUserSubscriptions(message.TenantID, message.UserIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, subscription := range subscriptions {
+				if _, ok := devices[subscription.DeviceToken]; ok {
+					continue
+				}
+				devices[subscription.DeviceToken] = subscription
+				tokens = append(tokens, subscription.DeviceToken)
+			}
+
+			if len(tokens) == 0 && message.Topic == "" {
+				return nil, notFoundf("no active devices registered for the users")
+			}
+		}
+	}
+
+	// Tokens pruned earlier would only be rejected again
+	if len(tokens) > 0 {
+		tokens = s.filterInvalidTokens(tokens)
+		if len(tokens) == 0 && len(routes) == 0 && message.Topic == "" {
+			return nil, notFoundf("all device tokens were pruned as invalid")
+		}
+	}
+	for _, token := range tokens {
+		key := pushRoute{provider: s.config.Provider}
+		if device := devices[token]; device != nil {
+			key.provider = s.providerNameForPlatform(device.Platform)
+			key.language = localizationFor(message.Localizations, device.Language)
+		}
+		routed := route(key)
+		routed.Tokens = append(routed.Tokens, token)
+	}
+
+	if message.Topic != "" {
+		topicRouted := false
+		for name, provider := range s.providers {
+			if provider.Capabilities().Topics {
+				route(pushRoute{provider: name}).Topic = message.Topic
+				topicRouted = true
+			}
+		}
+		if !topicRouted {
+			return nil, invalid(fmt.Errorf("topics are not supported by the configured push providers"))
+		}
+	}
+
+	return routes, nil
+}
+
+// sendRouted sends the routed messages through their providers and merges the results
+func (s *PushNotificationService) sendRouted(ctx context.Context, tenantID string, routes map[pushRoute]*PushMessage) (*PushResult, error) {
+	keys := make([]pushRoute, 0, len(routes))
+	for key := range routes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].provider != keys[j].provider {
+			return keys[i].provider < keys[j].provider
+		}
+		return keys[i].language < keys[j].language
+	})
+
+	merged := &PushResult{
+		SentAt: time.Now(),
+	}
+	var firstErr error
+
+	for _, key := range keys {
+		name := key.provider
+		routed := routes[key]
+		result, err := s.providers[name].Send(ctx, *routed)
+
+		if result != nil {
+			if merged.MessageID == "" {
+				merged.MessageID = result.MessageID
+			}
+			merged.SentCount += result.SentCount
+			merged.FailedCount += result.FailedCount
+			merged.Errors = append(merged.Errors, result.Errors...)
+			merged.InvalidTokens = append(merged.InvalidTokens, result.InvalidTokens...)
+		}
+
+		if err != nil {
+			log.Warn().Err(err).Str("provider", name).Msg("Push provider send failed")
+			if firstErr == nil {
+				firstErr = err
+			}
+			if result == nil {
+				merged.FailedCount += pushTargetCount(*routed)
+				merged.Errors = append(merged.Errors, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+
+	if len(merged.InvalidTokens) > 0 {
+		s.pruneInvalidTokens(tenantID, merged.InvalidTokens)
+	}
+
+	// Nothing went out, let the caller retry or report the rejection
+	if merged.SentCount == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	if merged.MessageID == "" {
+		merged.MessageID = generateMessageID()
+	}
+	merged.Success = merged.FailedCount == 0
+	return merged, nil
+}
+
+// providerForToken returns the provider of the platform a token was registered with
+func (s *PushNotificationService) providerForToken(deviceToken string) PushProvider {
+	platform := ""
+	if subscription, err := s.GetSubscriptionInfo(deviceToken); err == nil {
+		platform = subscription.Platform
+	}
+	return s.providers[s.providerNameForPlatform(platform)]
+}
+
+// providerNameForPlatform returns the provider a platform is routed to
+func (s *PushNotificationService) providerNameForPlatform(platform string) string {
+	if name, ok := s.config.Platforms[platform]; ok {
+		return name
+	}
+	return s.config.Provider
+}
+
+func (s *PushNotificationService) defaultProvider() PushProvider {
+	return s.providers[s.config.Provider]
+}
+
+// webPushProvider is a placeholder for the Web Push API
+type webPushProvider struct{}
+
+func (p *webPushProvider) Name() string {
+	return PushProviderWebPush
+}
+
+func (p *webPushProvider) Capabilities() PushCapabilities {
+	return PushCapabilities{}
+}
+
+// Send sends a notification via Web Push API
+func (p *webPushProvider) Send(ctx context.Context, message PushMessage) (*PushResult, error) {
+	// This would implement Web Push API
+	// For now, return a placeholder result
+	return &PushResult{
+		MessageID:   generateMessageID(),
+		Success:     true,
+		SentCount:   len(message.Tokens),
+		FailedCount: 0,
+		SentAt:      time.Now(),
+	}, nil
+}
+
+func (p *webPushProvider) SubscribeToTopic(deviceToken string, topic string) error {
+	return fmt.Errorf("topic subscription not supported for provider: %s", PushProviderWebPush)
+}
+
+func (p *webPushProvider) UnsubscribeFromTopic(deviceToken string, topic string) error {
+	return fmt.Errorf("topic unsubscription not supported for provider: %s", PushProviderWebPush)
+}
+
+// Helper functions
+
+// pushTargetCount counts the targets of a message the way results count them
+func pushTargetCount(message PushMessage) int {
+	count := len(message.Tokens) + len(message.UserIDs)
+	if message.Topic != "" {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// beamsMaxUsers is the number of users Beams accepts in one publish
+	beamsMaxUsers = 1000
+
+	beamsMaxIDLength = 164
+
+	// beamsTokenLifetime is how long the auth tokens of Beams users stay valid
+	beamsTokenLifetime = 24 * time.Hour
+)
+
+// beamsInterestPattern matches the interest names Beams accepts
+var beamsInterestPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-=@,.;]+$`)
+
+// beamsClient publishes notifications with the Pusher Beams publish API, to
+// the devices subscribed to interests or signed in as authenticated users
+type beamsClient struct {
+	instanceID string
+	secretKey  string
+	baseURL    string
+	dryRun     bool
+	client     *http.Client
+}
+
+// beamsPublishRequest is the body of a publish, with a payload per platform
+type beamsPublishRequest struct {
+	Interests []string               `json:"interests,omitempty"`
+	Users     []string               `json:"users,omitempty"`
+	APNS      map[string]interface{} `json:"apns"`
+	FCM       beamsFCMPayload        `json:"fcm"`
+	Web       beamsWebPayload        `json:"web"`
+}
+
+type beamsFCMPayload struct {
+	Notification map[string]string `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+type beamsWebPayload struct {
+	Notification map[string]string      `json:"notification"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	TimeToLive   int64                  `json:"time_to_live,omitempty"`
+}
+
+// beamsError is an error response of the Beams API
+type beamsError struct {
+	StatusCode  int
+	Type        string
+	Description string
+}
+
+func (e *beamsError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("Pusher Beams error %d: %s: %s", e.StatusCode, e.Type, e.Description)
+	}
+	return fmt.Sprintf("Pusher Beams error %d: %s", e.StatusCode, e.Type)
+}
+
+// rejected tells whether Beams refused the publish itself, so sending it
+// again can never succeed. Auth and instance errors are configuration
+// problems instead, and rate limits and server errors pass.
+func (e *beamsError) rejected() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// newBeamsClient creates a Beams client for the instance in AppID, which
+// publishes with the secret key in APISecret
+func newBeamsClient(config PushConfig, client *http.Client) (*beamsClient, error) {
+	if config.AppID == "" || config.APISecret == "" {
+		return nil, fmt.Errorf("Pusher Beams instance ID and secret key are required")
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s.pushnotifications.pusher.com", config.AppID)
+	}
+
+	return &beamsClient{
+		instanceID: config.AppID,
+		secretKey:  config.APISecret,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		dryRun:     config.DryRun,
+		client:     client,
+	}, nil
+}
+
+func (c *beamsClient) Name() string {
+	return PushProviderPusher
+}
+
+func (c *beamsClient) Capabilities() PushCapabilities {
+	return PushCapabilities{Topics: true, Users: true}
+}
+
+// Send sends a notification via Pusher Beams. Topics are published to the
+// interest of the same name and users to the devices they signed in on; Beams
+// does not address single device tokens.
+func (c *beamsClient) Send(ctx context.Context, message PushMessage) (*PushResult, error) {
+	base := buildBeamsPublishRequest(message)
+	result := &PushResult{
+		SentAt: time.Now(),
+	}
+	var publishIDs []string
+	var firstErr error
+
+	fail := func(target string, count int, err error) {
+		result.FailedCount += count
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", target, err))
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if message.Topic != "" {
+		request := base
+		request.Interests = []string{message.Topic}
+		publishID, err := c.publish(ctx, "interests", request)
+		if err != nil {
+			fail("topic "+message.Topic, 1, err)
+		} else {
+			result.SentCount++
+			publishIDs = append(publishIDs, publishID)
+		}
+	}
+
+	for i := 0; i < len(message.UserIDs); i += beamsMaxUsers {
+		end := i + beamsMaxUsers
+		if end > len(message.UserIDs) {
+			end = len(message.UserIDs)
+		}
+
+		request := base
+		request.Users = message.UserIDs[i:end]
+		publishID, err := c.publish(ctx, "users", request)
+		if err != nil {
+			fail(fmt.Sprintf("users %d-%d", i, end-1), end-i, err)
+		} else {
+			result.SentCount += end - i
+			publishIDs = append(publishIDs, publishID)
+		}
+	}
+
+	if len(message.Tokens) > 0 {
+		fail("tokens", len(message.Tokens), invalid(fmt.Errorf("device tokens are not supported by Pusher Beams, target users or a topic")))
+	}
+
+	// Nothing went out, surface the error so the caller can tell retryable
+	// failures from requests Beams will never accept
+	if result.SentCount == 0 && firstErr != nil {
+		var beamsErr *beamsError
+		if errors.As(firstErr, &beamsErr) && beamsErr.rejected() {
+			return nil, invalid(firstErr)
+		}
+		if errors.Is(firstErr, ErrValidation) {
+			return nil, firstErr
+		}
+		return nil, fmt.Errorf("Pusher Beams send failed: %w", firstErr)
+	}
+
+	result.MessageID = generateMessageID()
+	if len(publishIDs) > 0 {
+		result.MessageID = publishIDs[0]
+	}
+	result.Success = result.FailedCount == 0
+	return result, nil
+}
+
+// GenerateBeamsToken issues the token a Beams SDK needs to sign a device in
+// as the given user, so publishes to the user reach it
+func (s *PushNotificationService) GenerateBeamsToken(userID string) (string, time.Time, error) {
+	beams := s.beamsClient()
+	if beams == nil {
+		return "", time.Time{}, invalid(fmt.Errorf("authenticated users are only supported by Pusher Beams"))
+	}
+	if err := validateBeamsUserID(userID); err != nil {
+		return "", time.Time{}, invalid(err)
+	}
+
+	return beams.userToken(userID, time.Now())
+}
+
+// SubscribeToTopic subscribes a device to a Pusher topic. Beams devices
+// subscribe to interests themselves through the client SDK, the server only
+// publishes to them.
+func (c *beamsClient) SubscribeToTopic(deviceToken string, topic string) error {
+	log.Debug().
+		Str("deviceToken", truncateString(deviceToken, 20)).
+		Str("topic", topic).
+		Msg("Pusher Beams devices subscribe to interests from the client SDK")
+	return nil
+}
+
+// UnsubscribeFromTopic unsubscribes a device from a Pusher topic, which like
+// subscribing is up to the client SDK
+func (c *beamsClient) UnsubscribeFromTopic(deviceToken string, topic string) error {
+	log.Debug().
+		Str("deviceToken", truncateString(deviceToken, 20)).
+		Str("topic", topic).
+		Msg("Pusher Beams devices unsubscribe from interests from the client SDK")
+	return nil
+}
+
+// publish publishes a request to interests or users and returns its publish ID
+func (c *beamsClient) publish(ctx context.Context, target string, request beamsPublishRequest) (string, error) {
+	for _, interest := range request.Interests {
+		if len(interest) > beamsMaxIDLength || !beamsInterestPattern.MatchString(interest) {
+			return "", &beamsError{StatusCode: http.StatusUnprocessableEntity, Type: "Invalid interest name", Description: interest}
+		}
+	}
+	for _, userID := range request.Users {
+		if err := validateBeamsUserID(userID); err != nil {
+			return "", &beamsError{StatusCode: http.StatusUnprocessableEntity, Type: "Invalid user ID", Description: err.Error()}
+		}
+	}
+
+	if c.dryRun {
+		log.Debug().
+			Strs("interests", request.Interests).
+			Int("userCount", len(request.Users)).
+			Msg("Pusher Beams dry run, notification not sent")
+		return generateMessageID(), nil
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Pusher Beams publish: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/publish_api/v1/instances/%s/publishes/%s", c.baseURL, url.PathEscape(c.instanceID), target)
+	respBody, err := c.do(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		PublishID string `json:"publishId"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return "", fmt.Errorf("failed to decode Pusher Beams response: %w", err)
+	}
+
+	return response.PublishID, nil
+}
+
+// deleteUser signs a user out of all devices and deletes it from the instance
+func (c *beamsClient) deleteUser(ctx context.Context, userID string) error {
+	if c.dryRun {
+		return nil
+	}
+
+	endpoint := fmt.Sprintf("%s/customer_api/v1/instances/%s/users/%s", c.baseURL, url.PathEscape(c.instanceID), url.PathEscape(userID))
+	_, err := c.do(ctx, http.MethodDelete, endpoint, nil)
+	return err
+}
+
+// do sends an authenticated request to the Beams API and returns the body of
+// a successful response
+func (c *beamsClient) do(ctx context.Context, method string, endpoint string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pusher Beams request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.secretKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send Pusher Beams request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return respBody, nil
+	}
+
+	return nil, parseBeamsError(resp.StatusCode, respBody)
+}
+
+// userToken signs the HS256 token Beams expects for an authenticated user
+func (c *beamsClient) userToken(userID string, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(beamsTokenLifetime)
+
+	header, err := json.Marshal(map[string]string{
+		"alg": "HS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"sub": userID,
+		"iss": fmt.Sprintf("https://%s.pushnotifications.pusher.com", c.instanceID),
+		"exp": expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(c.secretKey))
+	mac.Write([]byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), expiresAt, nil
+}
+
+// buildBeamsPublishRequest maps a push message onto the APNs, FCM and web
+// payloads of a publish
+func buildBeamsPublishRequest(message PushMessage) beamsPublishRequest {
+	fcmNotification := map[string]string{
+		"title": message.Title,
+		"body":  message.Body,
+	}
+	if message.Icon != "" {
+		fcmNotification["icon"] = message.Icon
+	}
+	if message.Sound != "" {
+		fcmNotification["sound"] = message.Sound
+	}
+	if message.CollapseKey != "" {
+		fcmNotification["tag"] = message.CollapseKey
+	}
+	if message.AndroidChannelID != "" {
+		fcmNotification["android_channel_id"] = message.AndroidChannelID
+	}
+	if message.Image != "" {
+		fcmNotification["image"] = message.Image
+	}
+
+	fcmPayload := fcmData(message.Data)
+	if link := message.deepLinkFor(PlatformAndroid); link != "" {
+		if fcmPayload == nil {
+			fcmPayload = map[string]string{}
+		}
+		fcmPayload["deep_link"] = link
+	}
+
+	webNotification := map[string]string{
+		"title": message.Title,
+		"body":  message.Body,
+	}
+	if message.Icon != "" {
+		webNotification["icon"] = message.Icon
+	}
+	if link := message.deepLinkFor(PlatformWeb); link != "" {
+		webNotification["deep_link"] = link
+	}
+
+	return beamsPublishRequest{
+		APNS: buildAPNSPayload(message),
+		FCM: beamsFCMPayload{
+			Notification: fcmNotification,
+			Data:         fcmPayload,
+		},
+		Web: beamsWebPayload{
+			Notification: webNotification,
+			Data:         message.Data,
+			TimeToLive:   int64(message.TTL / time.Second),
+		},
+	}
+}
+
+// parseBeamsError reads the error of a Beams response
+func parseBeamsError(statusCode int, body []byte) *beamsError {
+	beamsErr := &beamsError{StatusCode: statusCode, Type: http.StatusText(statusCode)}
+
+	var response struct {
+		Error       string `json:"error"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		beamsErr.Description = strings.TrimSpace(string(body))
+		return beamsErr
+	}
+
+	if response.Error != "" {
+		beamsErr.Type = response.Error
+	}
+	beamsErr.Description = response.Description
+
+	return beamsErr
+}
+
+// beamsClient returns the Pusher Beams provider, when one is configured
+func (s *PushNotificationService) beamsClient() *beamsClient {
+	beams, _ := s.providers[PushProviderPusher].(*beamsClient)
+	return beams
+}
+
+// validateBeamsUserID validates the ID of a Beams authenticated user
+func validateBeamsUserID(userID string) error {
+	if userID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+	if len(userID) > beamsMaxIDLength {
+		return fmt.Errorf("user ID exceeds %d characters", beamsMaxIDLength)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// beamsServer is a mock of the Beams publish API recording the publishes it receives
+type beamsServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	paths     []string
+	publishes []beamsPublishRequest
+	status    int
+	response  string
+}
+
+func newBeamsServer(t *testing.T) *beamsServer {
+	server := &beamsServer{status: http.StatusOK, response: `{"publishId":"pubid-1"}`}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-key" {
+			t.Errorf("Expected bearer secret key, got %q", r.Header.Get("Authorization"))
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		var publish beamsPublishRequest
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &publish); err != nil {
+				t.Errorf("Failed to decode publish: %v", err)
+			}
+		}
+
+		server.mu.Lock()
+		server.paths = append(server.paths, r.Method+" "+r.URL.Path)
+		server.publishes = append(server.publishes, publish)
+		status, response := server.status, server.response
+		server.mu.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newBeamsTestService(t *testing.T, server *beamsServer) *PushNotificationService {
+	t.Helper()
+
+	beams, err := newBeamsClient(PushConfig{
+		Provider:  "pusher",
+		AppID:     "instance-1",
+		APISecret: "secret-key",
+		BaseURL:   server.URL,
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("Failed to create Beams client: %v", err)
+	}
+	return &PushNotificationService{
+		config:    PushConfig{Provider: PushProviderPusher},
+		providers: map[string]PushProvider{PushProviderPusher: beams},
+	}
+}
+
+func TestBeamsPublishesToInterestsAndUsers(t *testing.T) {
+	server := newBeamsServer(t)
+	service := newBeamsTestService(t, server)
+
+	result, err := service.beamsClient().Send(context.Background(), PushMessage{
+		Title:     "Yeni talimat",
+		Body:      "Forklift kullanım talimatı yayınlandı",
+		Data:      map[string]interface{}{"document_id": "doc-1"},
+		DeepLinks: map[string]string{PlatformWeb: "https://example.com/doc-1"},
+		Badge:     2,
+		Topic:     "tenant-acme",
+		UserIDs:   []string{"user-1", "user-2"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.SentCount != 3 || result.FailedCount != 0 || !result.Success {
+		t.Errorf("Expected 3 sent and no failures, got %d sent and %d failed", result.SentCount, result.FailedCount)
+	}
+	if result.MessageID != "pubid-1" {
+		t.Errorf("Expected publish ID as message ID, got %s", result.MessageID)
+	}
+
+	expectedPaths := []string{
+		"POST /publish_api/v1/instances/instance-1/publishes/interests",
+		"POST /publish_api/v1/instances/instance-1/publishes/users",
+	}
+	if strings.Join(server.paths, ",") != strings.Join(expectedPaths, ",") {
+		t.Fatalf("Expected requests %v, got %v", expectedPaths, server.paths)
+	}
+
+	interests := server.publishes[0]
+	if len(interests.Interests) != 1 || interests.Interests[0] != "tenant-acme" {
+		t.Errorf("Expected interest tenant-acme, got %v", interests.Interests)
+	}
+	if interests.FCM.Notification["title"] != "Yeni talimat" || interests.FCM.Data["document_id"] != "doc-1" {
+		t.Errorf("Unexpected FCM payload: %+v", interests.FCM)
+	}
+	if interests.Web.Notification["deep_link"] != "https://example.com/doc-1" {
+		t.Errorf("Expected web deep link, got %+v", interests.Web.Notification)
+	}
+	aps, _ := interests.APNS["aps"].(map[string]interface{})
+	if aps["badge"] != float64(2) {
+		t.Errorf("Expected APNs badge 2, got %v", aps["badge"])
+	}
+
+	users := server.publishes[1]
+	if strings.Join(users.Users, ",") != "user-1,user-2" {
+		t.Errorf("Expected users user-1,user-2, got %v", users.Users)
+	}
+}
+
+func TestBeamsSplitsUsersIntoPublishesOfAtMostThousand(t *testing.T) {
+	server := newBeamsServer(t)
+	service := newBeamsTestService(t, server)
+
+	userIDs := make([]string, 2500)
+	for i := range userIDs {
+		userIDs[i] = "user"
+	}
+
+	result, err := service.beamsClient().Send(context.Background(), PushMessage{Title: "Title", Body: "Body", UserIDs: userIDs})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(server.publishes) != 3 {
+		t.Fatalf("Expected 3 publishes, got %d", len(server.publishes))
+	}
+	for i, expected := range []int{1000, 1000, 500} {
+		if len(server.publishes[i].Users) != expected {
+			t.Errorf("Expected publish %d to have %d users, got %d", i, expected, len(server.publishes[i].Users))
+		}
+	}
+	if result.SentCount != 2500 {
+		t.Errorf("Expected 2500 sent, got %d", result.SentCount)
+	}
+}
+
+func TestBeamsErrorMapping(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		validation bool
+	}{
+		{"unprocessable publish", http.StatusUnprocessableEntity, `{"error":"Unprocessable Entity","description":"Payload too large"}`, true},
+		{"bad request", http.StatusBadRequest, `{"error":"Bad request","description":"Invalid JSON"}`, true},
+		{"wrong secret key", http.StatusUnauthorized, `{"error":"Unauthorized","description":"Incorrect API Key"}`, false},
+		{"unknown instance", http.StatusNotFound, `{"error":"Instance not found"}`, false},
+		{"rate limited", http.StatusTooManyRequests, `{"error":"Too many requests"}`, false},
+		{"server error", http.StatusInternalServerError, `upstream failure`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newBeamsServer(t)
+			server.status = tt.status
+			server.response = tt.response
+			service := newBeamsTestService(t, server)
+
+			_, err := service.beamsClient().Send(context.Background(), PushMessage{Title: "Title", Body: "Body", Topic: "tenant-acme"})
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+
+			if errors.Is(err, ErrValidation) != tt.validation {
+				t.Errorf("Expected validation error %v, got %v", tt.validation, err)
+			}
+
+			var beamsErr *beamsError
+			if !errors.As(err, &beamsErr) || beamsErr.StatusCode != tt.status {
+				t.Errorf("Expected Beams error with status %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+func TestBeamsPartialFailureKeepsSentTargets(t *testing.T) {
+	server := newBeamsServer(t)
+	service := newBeamsTestService(t, server)
+
+	result, err := service.beamsClient().Send(context.Background(), PushMessage{
+		Title:   "Title",
+		Body:    "Body",
+		Topic:   "invalid interest!",
+		UserIDs: []string{"user-1"},
+		Tokens:  []string{"device-token"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.SentCount != 1 || result.FailedCount != 2 || result.Success {
+		t.Errorf("Expected 1 sent and 2 failed, got %d sent and %d failed", result.SentCount, result.FailedCount)
+	}
+	if len(server.paths) != 1 {
+		t.Errorf("Expected only the user publish to reach Beams, got %v", server.paths)
+	}
+}
+
+func TestBeamsUserToken(t *testing.T) {
+	server := newBeamsServer(t)
+	service := newBeamsTestService(t, server)
+
+	token, _, err := service.GenerateBeamsToken("user-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a JWT, got %s", token)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret-key"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+		t.Error("Expected token signed with the secret key")
+	}
+
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]interface{}
+	json.Unmarshal(claimsJSON, &claims)
+	if claims["sub"] != "user-1" {
+		t.Errorf("Expected subject user-1, got %v", claims["sub"])
+	}
+	if claims["iss"] != "https://instance-1.pushnotifications.pusher.com" {
+		t.Errorf("Expected instance issuer, got %v", claims["iss"])
+	}
+
+	if _, _, err := service.GenerateBeamsToken(""); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected validation error for empty user ID, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PushLocalization is the title and body of a push in one language
+type PushLocalization struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// PushOptions holds the rich content of the push deliveries of a request
+type PushOptions struct {
+	Image    string `json:"image,omitempty"`
+	DeepLink string `json:"deep_link,omitempty"`
+	// Deep links per platform (ios, android, web), overriding DeepLink
+	DeepLinks map[string]string `json:"deep_links,omitempty"`
+	// Title and body per language, picked by the language of each device
+	Localizations    map[string]PushLocalization `json:"localizations,omitempty"`
+	AndroidChannelID string                      `json:"android_channel_id,omitempty"`
+	IOSCategory      string                      `json:"ios_category,omitempty"`
+}
+
+// apply copies the options onto a push message
+func (o *PushOptions) apply(message *PushMessage) {
+	if o == nil {
+		return
+	}
+
+	message.Image = o.Image
+	message.DeepLink = o.DeepLink
+	message.DeepLinks = o.DeepLinks
+	message.Localizations = o.Localizations
+	message.AndroidChannelID = o.AndroidChannelID
+	message.IOSCategory = o.IOSCategory
+}
+
+// deepLinkFor returns the link a notification opens on a platform
+func (m PushMessage) deepLinkFor(platform string) string {
+	if link, ok := m.DeepLinks[platform]; ok && link != "" {
+		return link
+	}
+	return m.DeepLink
+}
+
+// localized returns the message in the language of a localization, which
+// falls back to the default title and body when it is not found
+func (m PushMessage) localized(language string) PushMessage {
+	if localization, ok := m.Localizations[language]; ok {
+		if localization.Title != "" {
+			m.Title = localization.Title
+		}
+		if localization.Body != "" {
+			m.Body = localization.Body
+		}
+	}
+	m.Localizations = nil
+	return m
+}
+
+// localizationFor picks the localization for a device language: an exact
+// match first, then one of the same base language, e.g. tr for tr-TR
+func localizationFor(localizations map[string]PushLocalization, language string) string {
+	if len(localizations) == 0 || language == "" {
+		return ""
+	}
+
+	language = normalizeLanguage(language)
+	base := strings.SplitN(language, "-", 2)[0]
+
+	var baseMatch, regional string
+	for key := range localizations {
+		normalized := normalizeLanguage(key)
+		switch {
+		case normalized == language:
+			return key
+		case normalized == base:
+			baseMatch = key
+		case strings.HasPrefix(normalized, base+"-") && (regional == "" || key < regional):
+			regional = key
+		}
+	}
+
+	if baseMatch != "" {
+		return baseMatch
+	}
+	return regional
+}
+
+// validateRichContent validates the images, links and localizations of a message
+func validateRichContent(message PushMessage) error {
+	if message.Image != "" {
+		parsed, err := url.Parse(message.Image)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("image must be an https URL")
+		}
+	}
+
+	links := map[string]string{"": message.DeepLink}
+	for platform, link := range message.DeepLinks {
+		switch platform {
+		case PlatformIOS, PlatformAndroid, PlatformWeb:
+		default:
+			return fmt.Errorf("invalid deep link platform: %s", platform)
+		}
+		links[platform] = link
+	}
+	for platform, link := range links {
+		if link == "" {
+			continue
+		}
+		// Apps register custom schemes, so any absolute URL is accepted
+		if parsed, err := url.Parse(link); err != nil || parsed.Scheme == "" {
+			if platform == "" {
+				return fmt.Errorf("deep link must be an absolute URL")
+			}
+			return fmt.Errorf("%s deep link must be an absolute URL", platform)
+		}
+	}
+
+	for language, localization := range message.Localizations {
+		if language == "" {
+			return fmt.Errorf("localization language is required")
+		}
+		if len(localization.Title) > 100 {
+			return fmt.Errorf("%s title exceeds 100 characters", language)
+		}
+		if len(localization.Body) > 4000 {
+			return fmt.Errorf("%s body exceeds 4000 characters", language)
+		}
+	}
+
+	return nil
+}
+
+// Helper functions
+func normalizeLanguage(language string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(language), "_", "-"))
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Device platforms push subscriptions can be registered for
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWeb     = "web"
+)
+
+// RegisterSubscription registers the push token of a device. Registering a
+// token that is already known updates its subscription, moving it to the new
+// user when the device changed hands.
+func (s *PushNotificationService) RegisterSubscription(subscription PushSubscription) (*PushSubscription, error) {
+	log.Info().
+		Str("userID", subscription.UserID).
+		Str("platform", subscription.Platform).
+		Str("deviceToken", truncateString(subscription.DeviceToken, 20)).
+		Msg("Registering push subscription")
+
+	if err := validateSubscription(subscription); err != nil {
+		return nil, invalid(fmt.Errorf("subscription validation failed: %w", err))
+	}
+
+	now := time.Now()
+	subscription.ID = generateSubscriptionID()
+	subscription.CreatedAt = now
+
+	existing, err := s.GetSubscriptionInfo(subscription.DeviceToken)
+	if err == nil {
+		subscription.ID = existing.ID
+		subscription.CreatedAt = existing.CreatedAt
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	subscription.LastActive = now
+	subscription.IsActive = true
+
+	if err := s.storeSubscription(existing, &subscription); err != nil {
+		return nil, err
+	}
+
+	// The app only registers tokens that work again
+	s.clearInvalidToken(subscription.DeviceToken)
+
+	// Tenant broadcasts reach devices through the tenant topic
+	if err := s.SubscribeToTopic(subscription.DeviceToken, TenantTopic(subscription.TenantID)); err != nil {
+		log.Warn().Err(err).Str("subscriptionID", subscription.ID).Msg("Failed to subscribe device to tenant topic")
+	}
+
+	return &subscription, nil
+}
+
+// GetSubscription gets a push subscription by ID
+func (s *PushNotificationService) GetSubscription(subscriptionID string) (*PushSubscription, error) {
+	ctx := context.Background()
+
+	subscriptionJSON, err := s.redis.Get(ctx, s.getSubscriptionKey(subscriptionID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("subscription not found: %s", subscriptionID)
+		}
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	subscription, err := s.pii.unmarshalSubscription(subscriptionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal subscription: %w", err)
+	}
+
+	return subscription, nil
+}
+
+// GetSubscriptionInfo gets information about a device subscription
+func (s *PushNotificationService) GetSubscriptionInfo(deviceToken string) (*PushSubscription, error) {
+	ctx := context.Background()
+
+	subscriptionID, err := s.redis.Get(ctx, s.getTokenKey(deviceToken)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("subscription not found for device token")
+		}
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	return s.GetSubscription(subscriptionID)
+}
+
+// GetUserSubscriptions gets the push subscriptions of a user, including inactive ones
+func (s *PushNotificationService) GetUserSubscriptions(userID string, tenantID string) ([]*PushSubscription, error) {
+	ctx := context.Background()
+
+	ids, err := s.redis.SMembers(ctx, s.getUserSubscriptionsKey(userID, tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user subscriptions: %w", err)
+	}
+
+	subscriptions := []*PushSubscription{}
+	for _, id := range ids {
+		subscription, err := s.GetSubscription(id)
+		if err != nil {
+			log.Warn().Err(err).Str("subscriptionID", id).Msg("Failed to get subscription")
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// RefreshSubscription updates a subscription after the app started again,
+// possibly with a token the provider rotated
+func (s *PushNotificationService) RefreshSubscription(subscriptionID string, updates PushSubscription) (*PushSubscription, error) {
+	existing, err := s.GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := *existing
+	if updates.DeviceToken != "" {
+		subscription.DeviceToken = updates.DeviceToken
+	}
+	if updates.AppVersion != "" {
+		subscription.AppVersion = updates.AppVersion
+	}
+	if updates.DeviceModel != "" {
+		subscription.DeviceModel = updates.DeviceModel
+	}
+	if updates.OSVersion != "" {
+		subscription.OSVersion = updates.OSVersion
+	}
+	if updates.Language != "" {
+		subscription.Language = updates.Language
+	}
+	if updates.Timezone != "" {
+		subscription.Timezone = updates.Timezone
+	}
+	if updates.Tags != nil {
+		subscription.Tags = updates.Tags
+	}
+	subscription.LastActive = time.Now()
+	subscription.IsActive = true
+
+	if err := validateSubscription(subscription); err != nil {
+		return nil, invalid(fmt.Errorf("subscription validation failed: %w", err))
+	}
+
+	// A rotated token must not be registered to another device already
+	if subscription.DeviceToken != existing.DeviceToken {
+		if other, err := s.GetSubscriptionInfo(subscription.DeviceToken); err == nil && other.ID != subscriptionID {
+			return nil, conflictf("device token is registered to another subscription: %s", other.ID)
+		}
+	}
+
+	if err := s.storeSubscription(existing, &subscription); err != nil {
+		return nil, err
+	}
+	s.clearInvalidToken(subscription.DeviceToken)
+
+	return &subscription, nil
+}
+
+// DeactivateSubscription stops sending pushes to a device, keeping its
+// subscription until the app registers again
+func (s *PushNotificationService) DeactivateSubscription(subscriptionID string) (*PushSubscription, error) {
+	existing, err := s.GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := *existing
+	subscription.IsActive = false
+
+	if err := s.storeSubscription(existing, &subscription); err != nil {
+		return nil, err
+	}
+
+	if err := s.UnsubscribeFromTopic(subscription.DeviceToken, TenantTopic(subscription.TenantID)); err != nil {
+		log.Warn().Err(err).Str("subscriptionID", subscriptionID).Msg("Failed to unsubscribe device from tenant topic")
+	}
+
+	return &subscription, nil
+}
+
+// DeleteSubscription deletes a push subscription
+func (s *PushNotificationService) DeleteSubscription(subscriptionID string) error {
+	subscription, err := s.GetSubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, s.getSubscriptionKey(subscriptionID), s.getTokenKey(subscription.DeviceToken))
+	pipe.SRem(ctx, s.getUserSubscriptionsKey(subscription.UserID, subscription.TenantID), subscriptionID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	if err := s.UnsubscribeFromTopic(subscription.DeviceToken, TenantTopic(subscription.TenantID)); err != nil {
+		log.Warn().Err(err).Str("subscriptionID", subscriptionID).Msg("Failed to unsubscribe device from tenant topic")
+	}
+
+	return nil
+}
+
+// ResolveUserTokens returns the tokens of the active devices of users
+func (s *PushNotificationService) ResolveUserTokens(tenantID string, userIDs []string) ([]string, error) {
+	subscriptions, err := s.resolveUserSubscriptions(tenantID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]string, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		tokens = append(tokens, subscription.DeviceToken)
+	}
+
+	return tokens, nil
+}
+
+// resolveUserSubscriptions returns the subscriptions of the active devices of users
+func (s *PushNotificationService) resolveUserSubscriptions(tenantID string, userIDs []string) ([]*PushSubscription, error) {
+	var active []*PushSubscription
+	for _, userID := range userIDs {
+		subscriptions, err := s.GetUserSubscriptions(userID, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		for _, subscription := range subscriptions {
+			if subscription.IsActive {
+				active = append(active, subscription)
+			}
+		}
+	}
+
+	return active, nil
+}
+
+// storeSubscription writes a subscription and moves its indexes over from the
+// previous version, if any
+func (s *PushNotificationService) storeSubscription(previous *PushSubscription, subscription *PushSubscription) error {
+	subscriptionJSON, err := s.pii.marshalSubscription(*subscription)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription: %w", err)
+	}
+
+	ctx := context.Background()
+	pipe := s.redis.TxPipeline()
+	if previous != nil {
+		if previous.DeviceToken != subscription.DeviceToken {
+			pipe.Del(ctx, s.getTokenKey(previous.DeviceToken))
+		}
+		if previous.UserID != subscription.UserID || previous.TenantID != subscription.TenantID {
+			pipe.SRem(ctx, s.getUserSubscriptionsKey(previous.UserID, previous.TenantID), subscription.ID)
+		}
+	}
+	pipe.Set(ctx, s.getSubscriptionKey(subscription.ID), subscriptionJSON, 0)
+	pipe.Set(ctx, s.getTokenKey(subscription.DeviceToken), subscription.ID, 0)
+	pipe.SAdd(ctx, s.getUserSubscriptionsKey(subscription.UserID, subscription.TenantID), subscription.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store subscription: %w", err)
+	}
+
+	return nil
+}
+
+// validateSubscription validates a push subscription
+func validateSubscription(subscription PushSubscription) error {
+	if subscription.UserID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+
+	if subscription.TenantID == "" {
+		return fmt.Errorf("tenant ID is required")
+	}
+
+	if subscription.DeviceToken == "" {
+		return fmt.Errorf("device token is required")
+	}
+
+	if len(subscription.DeviceToken) > 4096 {
+		return fmt.Errorf("device token exceeds 4096 characters")
+	}
+
+	switch subscription.Platform {
+	case PlatformIOS, PlatformAndroid, PlatformWeb:
+	default:
+		return fmt.Errorf("invalid platform: %s", subscription.Platform)
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *PushNotificationService) getSubscriptionKey(subscriptionID string) string {
+	return fmt.Sprintf("push_subscription:%s", subscriptionID)
+}
+
+func (s *PushNotificationService) getTokenKey(deviceToken string) string {
+	return fmt.Sprintf("push_token:%s", tokenHash(deviceToken))
+}
+
+func (s *PushNotificationService) getUserSubscriptionsKey(userID string, tenantID string) string {
+	return fmt.Sprintf("push_user_subscriptions:%s:%s", tenantID, userID)
+}
+
+// Helper functions
+func generateSubscriptionID() string {
+	return newID("sub")
+}
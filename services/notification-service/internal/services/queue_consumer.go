@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/events"
+	"claude-talimat/pkg/types"
+	mqclient "message-queue-service/client/go"
+)
+
+// queueSentTTL is how long sent messages are remembered, so a message
+// redelivered after its send but before its acknowledgment isn't sent twice
+const queueSentTTL = 24 * time.Hour
+
+// QueueConsumer feeds the notifications topic of the message queue service
+// into the send pipeline, so other services can send notifications without
+// waiting on HTTP calls. It consumes the topic through the API of the message
+// queue service, acknowledges the messages it sent, leaves the ones that
+// failed pending so they are redelivered and dead-letters them once their
+// retries run out.
+type QueueConsumer struct {
+	client        *mqclient.Client
+	config        QueueConsumerConfig
+	notifications *NotificationService
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// QueueConsumerConfig holds queue consumer configuration
+type QueueConsumerConfig struct {
+	ServiceURL string // Base URL of the message queue service
+	Topic      string
+	Consumer   string        // Name of this instance in the consumer group, the host name by default
+	BatchSize  int64         // Maximum messages read at once
+	BlockTime  time.Duration // How long a read waits for new messages
+	RetryAfter time.Duration // How long a failed message waits before it is redelivered
+	MaxRetries int           // Retries of messages that don't set their own
+}
+
+// queuedNotification is the payload of a notifications message. It takes
+// every field of a notification request, and the single recipient and data
+// the publish helpers of other services send.
+type queuedNotification struct {
+	NotificationRequest
+	Recipient string                 `json:"recipient,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// NewQueueConsumer creates a queue consumer and starts consuming
+func NewQueueConsumer(config QueueConsumerConfig, notifications *NotificationService) (*QueueConsumer, error) {
+	if config.ServiceURL == "" {
+		return nil, fmt.Errorf("message queue service URL is required")
+	}
+
+	// Set default values
+	if config.Topic == "" {
+		config.Topic = types.TopicNotifications
+	}
+	if config.Consumer == "" {
+		config.Consumer, _ = os.Hostname()
+		if config.Consumer == "" {
+			config.Consumer = "notification-service"
+		}
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = 10
+	}
+	if config.BlockTime == 0 {
+		config.BlockTime = 2 * time.Second
+	}
+	if config.RetryAfter == 0 {
+		config.RetryAfter = 30 * time.Second
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+
+	service := &QueueConsumer{
+		client:        mqclient.NewClient(config.ServiceURL),
+		config:        config,
+		notifications: notifications,
+		done:          make(chan struct{}),
+	}
+	service.ctx, service.cancel = context.WithCancel(context.Background())
+
+	// Start background consumer
+	go service.startConsumer()
+
+	return service, nil
+}
+
+// TestConnection tests the connection to the message queue
+func (s *QueueConsumer) TestConnection() error {
+	log.Info().Msg("Testing queue consumer connection")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.client.HealthCheck(ctx); err != nil {
+		log.Error().Err(err).Msg("Queue consumer connection test failed")
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+
+	log.Info().Msg("Queue consumer connection test successful")
+	return nil
+}
+
+// Shutdown stops consuming and waits for the message being sent. Messages
+// read but not sent yet stay pending and are redelivered to another consumer.
+func (s *QueueConsumer) Shutdown(ctx context.Context) error {
+	s.cancel()
+
+	select {
+	case <-s.done:
+		log.Info().Msg("Queue consumer drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("queue consumer did not drain: %w", ctx.Err())
+	}
+}
+
+// startConsumer sends the messages of the topic until shutdown
+func (s *QueueConsumer) startConsumer() {
+	log.Info().
+		Str("topic", s.config.Topic).
+		Str("consumer", s.config.Consumer).
+		Msg("Queue consumer started")
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Queue consumer stopped")
+			return
+		default:
+		}
+
+		messages, err := s.readMessages()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				continue
+			}
+			log.Error().Err(err).Msg("Failed to read queue messages")
+
+			// Back off instead of spinning while the message queue is unreachable
+			select {
+			case <-s.ctx.Done():
+			case <-time.After(s.config.BlockTime):
+			}
+			continue
+		}
+
+		for _, message := range messages {
+			if s.ctx.Err() != nil {
+				break
+			}
+			s.handleMessage(message)
+		}
+	}
+}
+
+// readMessages returns the failed messages due for redelivery, or else waits
+// for new ones. The message queue service redelivers messages left pending
+// for the retry delay, failed ones and the ones of consumers that died.
+func (s *QueueConsumer) readMessages() ([]mqclient.Message, error) {
+	response, err := s.client.Consume(s.ctx, mqclient.ConsumeRequest{
+		Topic:     s.config.Topic,
+		Consumer:  s.config.Consumer,
+		Count:     s.config.BatchSize,
+		BlockTime: int(s.config.BlockTime / time.Millisecond),
+		ClaimIdle: int(s.config.RetryAfter / time.Millisecond),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume messages: %w", err)
+	}
+
+	return response.Messages, nil
+}
+
+// handleMessage sends the notification of a message. Messages that can never
+// be sent are dead-lettered right away, the others once their retries run out.
+func (s *QueueConsumer) handleMessage(message mqclient.Message) {
+	ctx := context.Background()
+
+	// Payloads that drifted from the catalogue are never sent
+	if err := events.Validate(events.TypeNotificationRequested, 0, message.Payload); err != nil {
+		s.deadLetter(message.ID, fmt.Sprintf("invalid notification: %v", err))
+		return
+	}
+
+	payloadJSON, err := json.Marshal(message.Payload)
+	if err != nil {
+		s.deadLetter(message.ID, fmt.Sprintf("invalid notification: %v", err))
+		return
+	}
+
+	var payload queuedNotification
+	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
+		s.deadLetter(message.ID, fmt.Sprintf("invalid notification: %v", err))
+		return
+	}
+
+	// A message sent before its acknowledgment failed is only acknowledged again
+	sent, err := s.notifications.redis.Exists(ctx, s.getSentKey(message.ID)).Result()
+	if err == nil && sent > 0 {
+		s.acknowledge(message.ID)
+		return
+	}
+
+	request := payload.notificationRequest()
+	request.Metadata["queue_message_id"] = message.ID
+
+	if _, err := s.notifications.SendNotification(ctx, request); err != nil {
+		if errors.Is(err, ErrValidation) {
+			s.deadLetter(message.ID, err.Error())
+			return
+		}
+
+		maxRetries := message.MaxRetries
+		if maxRetries <= 0 {
+			maxRetries = s.config.MaxRetries
+		}
+		s.retryOrDeadLetter(message, maxRetries, err)
+		return
+	}
+
+	if err := s.notifications.redis.Set(ctx, s.getSentKey(message.ID), 1, queueSentTTL).Err(); err != nil {
+		log.Warn().Err(err).Str("messageID", message.ID).Msg("Failed to remember sent queue message")
+	}
+	s.acknowledge(message.ID)
+}
+
+// notificationRequest returns the request a notifications message asks for
+func (q queuedNotification) notificationRequest() NotificationRequest {
+	request := q.NotificationRequest
+	if len(request.Recipients) == 0 && q.Recipient != "" {
+		request.Recipients = []string{q.Recipient}
+	}
+
+	request.Metadata = copyMetadata(request.Metadata)
+	for key, value := range q.Data {
+		if _, ok := request.Metadata[key]; !ok {
+			request.Metadata[key] = value
+		}
+	}
+
+	return request
+}
+
+// retryOrDeadLetter leaves a failed message pending so it is redelivered,
+// unless it was retried as often as it may be
+func (s *QueueConsumer) retryOrDeadLetter(message mqclient.Message, maxRetries int, cause error) {
+	if message.RetryCount >= maxRetries {
+		s.deadLetter(message.ID, cause.Error())
+		return
+	}
+
+	log.Warn().
+		Err(cause).
+		Str("messageID", message.ID).
+		Int("retries", message.RetryCount).
+		Msg("Failed to send queue message, it will be redelivered")
+}
+
+// deadLetter moves a message to the dead letter queue of the topic, where
+// the message queue service keeps it so it can be inspected and published again
+func (s *QueueConsumer) deadLetter(messageID string, reason string) {
+	if _, err := s.client.DeadLetter(context.Background(), messageID, s.config.Topic, s.config.Consumer, reason); err != nil {
+		log.Error().Err(err).Str("messageID", messageID).Msg("Failed to dead-letter queue message")
+		return
+	}
+
+	log.Warn().
+		Str("messageID", messageID).
+		Str("reason", reason).
+		Msg("Queue message dead-lettered")
+}
+
+// acknowledge removes a handled message from the pending messages of the group
+func (s *QueueConsumer) acknowledge(messageID string) {
+	if _, err := s.client.Acknowledge(context.Background(), messageID, s.config.Topic, s.config.Consumer); err != nil {
+		log.Warn().Err(err).Str("messageID", messageID).Msg("Failed to acknowledge queue message")
+	}
+}
+
+// Redis key generators
+func (s *QueueConsumer) getSentKey(messageID string) string {
+	return fmt.Sprintf("queue_sent:%s:%s", s.config.Topic, messageID)
+}
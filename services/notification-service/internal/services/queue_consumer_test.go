@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"claude-talimat/pkg/types"
+	mqclient "message-queue-service/client/go"
+)
+
+// containsCall reports whether the queue consumer made a request
+func containsCall(calls []string, call string) bool {
+	for _, made := range calls {
+		if made == call {
+			return true
+		}
+	}
+	return false
+}
+
+func TestQueueConsumerReadsThroughTheMessageQueueAPI(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	messageID := env.publish(t, map[string]interface{}{
+		"type":      "email",
+		"recipient": "ayse.yilmaz@talimat.test",
+		"subject":   "Yeni talimat yayınlandı",
+		"message":   "Forklift kullanım talimatı güncellendi",
+	})
+
+	eventually(t, "the message to be acknowledged", func() bool {
+		return containsCall(env.mq.calls(), "POST /api/v1/messages/"+messageID+"/ack")
+	})
+	if !containsCall(env.mq.calls(), "POST /api/v1/messages/consume") {
+		t.Errorf("Expected the messages to be consumed through the API, got %v", env.mq.calls())
+	}
+	if len(env.smtp.sent()) != 1 {
+		t.Errorf("Expected the email to be sent once, got %d", len(env.smtp.sent()))
+	}
+
+	// Sent messages are remembered in the Redis of the service, not in the
+	// one of the message queue
+	consumer := env.consumer
+	if sent, _ := env.service.redis.Exists(context.Background(), consumer.getSentKey(messageID)).Result(); sent != 1 {
+		t.Errorf("Expected the sent message to be remembered")
+	}
+	if env.queue.Exists(consumer.getSentKey(messageID)) {
+		t.Errorf("Expected the consumer to leave the Redis of the message queue alone")
+	}
+}
+
+func TestQueueConsumerOnlyAcknowledgesMessagesItAlreadySent(t *testing.T) {
+	env := newIntegrationEnv(t)
+	consumer := env.consumer
+
+	// The message was sent before, but its acknowledgment failed
+	if err := env.service.redis.Set(context.Background(), consumer.getSentKey("1-1"), 1, queueSentTTL).Err(); err != nil {
+		t.Fatalf("Failed to remember sent message: %v", err)
+	}
+
+	consumer.handleMessage(mqclient.Message{
+		ID:         "1-1",
+		Topic:      types.TopicNotifications,
+		RetryCount: 1,
+		Payload: map[string]interface{}{
+			"type":      "email",
+			"recipient": "ayse.yilmaz@talimat.test",
+			"subject":   "Yeni talimat yayınlandı",
+			"message":   "Forklift kullanım talimatı güncellendi",
+		},
+	})
+
+	if len(env.smtp.sent()) != 0 {
+		t.Errorf("Expected a redelivered message not to be sent again, got %d emails", len(env.smtp.sent()))
+	}
+	if !containsCall(env.mq.calls(), "POST /api/v1/messages/1-1/ack") {
+		t.Errorf("Expected the redelivered message to be acknowledged, got %v", env.mq.calls())
+	}
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
+)
+
+// Recipient reference prefixes accepted in NotificationRequest.Recipients.
+// Anything without one of these prefixes is treated as a raw address.
+const (
+	RecipientPrefixUser  = "user:"
+	RecipientPrefixGroup = "group:"
+	RecipientPrefixRole  = "role:"
+)
+
+// RecipientResolver turns user, group and role references into deliverable addresses
+type RecipientResolver struct {
+	redis  *redis.Client
+	config RecipientConfig
+	client *http.Client
+}
+
+// RecipientConfig holds recipient resolver configuration
+type RecipientConfig struct {
+	RedisURL       string
+	RedisPassword  string
+	RedisDB        int
+	UserServiceURL string // Base URL of the auth/user service
+	ServiceToken   string // Bearer token used for service-to-service calls
+	Timeout        time.Duration
+	CacheTTL       time.Duration
+	MaxExpansion   int // Maximum number of users a single request may expand to
+}
+
+// UserContact represents the contact details of a user in the directory
+type UserContact struct {
+	ID           string   `json:"id"`
+	TenantID     string   `json:"tenant_id"`
+	Email        string   `json:"email"`
+	Phone        string   `json:"phone"`
+	Role         string   `json:"role"`
+	Locale       string   `json:"locale,omitempty"`
+	Timezone     string   `json:"timezone,omitempty"`
+	DeviceTokens []string `json:"device_tokens,omitempty"`
+	IsActive     bool     `json:"is_active"`
+}
+
+// ResolvedRecipient represents a single delivery target after resolution
+type ResolvedRecipient struct {
+	UserID    string       `json:"user_id,omitempty"`
+	Channel   string       `json:"channel"` // the addresses are for, one of allChannels when resolving for all
+	Addresses []string     `json:"addresses"`
+	Contact   *UserContact `json:"contact,omitempty"`
+}
+
+// userDirectoryResponse is the envelope returned by the user service
+type userDirectoryResponse struct {
+	User  *UserContact   `json:"user,omitempty"`
+	Users []*UserContact `json:"users,omitempty"`
+}
+
+// NewRecipientResolver creates a new recipient resolver instance
+func NewRecipientResolver(config RecipientConfig) (*RecipientResolver, error) {
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set default values
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = 5 * time.Minute
+	}
+	if config.MaxExpansion == 0 {
+		config.MaxExpansion = 10000
+	}
+
+	return &RecipientResolver{
+		redis:  redisClient,
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+		},
+	}, nil
+}
+
+// allChannels are the channels a notification of type all goes out on, to
+// the users having an address for them
+var allChannels = []string{"email", "sms", "push", "inapp"}
+
+// ResolveRecipients expands user, group and role references into concrete
+// addresses for the given channel. Raw addresses are passed through unchanged.
+// For all channels a user gets a recipient for every channel they have an
+// address for.
+func (r *RecipientResolver) ResolveRecipients(tenantID string, channel string, recipients []string) ([]ResolvedRecipient, error) {
+	var resolved []ResolvedRecipient
+	seenUsers := make(map[string]bool)
+	seenAddresses := make(map[string]bool)
+
+	addUser := func(contact *UserContact) {
+		if seenUsers[contact.ID] {
+			return
+		}
+		seenUsers[contact.ID] = true
+
+		if !contact.IsActive {
+			log.Debug().Str("userID", contact.ID).Msg("Skipping inactive recipient")
+			return
+		}
+
+		channels := []string{channel}
+		if channel == "all" {
+			channels = allChannels
+		}
+
+		found := false
+		for _, userChannel := range channels {
+			addresses := r.addressesForChannel(contact, userChannel)
+			if len(addresses) == 0 {
+				continue
+			}
+			found = true
+			resolved = append(resolved, ResolvedRecipient{
+				UserID:    contact.ID,
+				Channel:   userChannel,
+				Addresses: addresses,
+				Contact:   contact,
+			})
+		}
+
+		if !found {
+			log.Warn().
+				Str("userID", contact.ID).
+				Str("channel", channel).
+				Msg("Recipient has no address for channel")
+		}
+	}
+
+	for _, recipient := range recipients {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(recipient, RecipientPrefixUser):
+			contact, err := r.GetUserContact(tenantID, strings.TrimPrefix(recipient, RecipientPrefixUser))
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", recipient, err)
+			}
+			addUser(contact)
+
+		case strings.HasPrefix(recipient, RecipientPrefixGroup):
+			members, err := r.GetGroupMembers(tenantID, strings.TrimPrefix(recipient, RecipientPrefixGroup))
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", recipient, err)
+			}
+			for _, member := range members {
+				addUser(member)
+			}
+
+		case strings.HasPrefix(recipient, RecipientPrefixRole):
+			users, err := r.GetRoleMembers(tenantID, strings.TrimPrefix(recipient, RecipientPrefixRole))
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", recipient, err)
+			}
+			for _, user := range users {
+				addUser(user)
+			}
+
+		default:
+			if seenAddresses[recipient] {
+				continue
+			}
+			seenAddresses[recipient] = true
+			resolved = append(resolved, ResolvedRecipient{
+				Channel:   rawAddressChannel(channel, recipient),
+				Addresses: []string{recipient},
+			})
+		}
+
+		if len(resolved) > r.config.MaxExpansion {
+			return nil, fmt.Errorf("recipient expansion exceeds limit of %d", r.config.MaxExpansion)
+		}
+	}
+
+	return resolved, nil
+}
+
+// GetUserContact gets contact details for a user, using the cache when possible
+func (r *RecipientResolver) GetUserContact(tenantID string, userID string) (*UserContact, error) {
+	ctx := context.Background()
+	key := r.getContactKey(tenantID, userID)
+
+	if cached, err := r.redis.Get(ctx, key).Result(); err == nil {
+		var contact UserContact
+		if err := json.Unmarshal([]byte(cached), &contact); err == nil {
+			return &contact, nil
+		}
+	}
+
+	var response userDirectoryResponse
+	if err := r.get(fmt.Sprintf("/users/%s", url.PathEscape(userID)), tenantID, nil, &response); err != nil {
+		return nil, err
+	}
+	if response.User == nil {
+		return nil, notFoundf("user not found: %s", userID)
+	}
+	if response.User.TenantID != "" && tenantID != "" && response.User.TenantID != tenantID {
+		return nil, fmt.Errorf("user %s does not belong to tenant %s", userID, tenantID)
+	}
+
+	r.cache(key, response.User)
+
+	return response.User, nil
+}
+
+// GetGroupMembers gets the users belonging to a group
+func (r *RecipientResolver) GetGroupMembers(tenantID string, groupID string) ([]*UserContact, error) {
+	return r.listUsers(
+		r.getGroupKey(tenantID, groupID),
+		fmt.Sprintf("/groups/%s/members", url.PathEscape(groupID)),
+		tenantID,
+		nil,
+	)
+}
+
+// GetRoleMembers gets the users holding a role within a tenant
+func (r *RecipientResolver) GetRoleMembers(tenantID string, role string) ([]*UserContact, error) {
+	return r.listUsers(
+		r.getRoleKey(tenantID, role),
+		"/users",
+		tenantID,
+		url.Values{"role": []string{role}},
+	)
+}
+
+// InvalidateUser removes a user's cached contact details
+func (r *RecipientResolver) InvalidateUser(tenantID string, userID string) error {
+	ctx := context.Background()
+	return r.redis.Del(ctx, r.getContactKey(tenantID, userID)).Err()
+}
+
+// TestConnection tests the recipient resolver connection
+func (r *RecipientResolver) TestConnection() error {
+	log.Info().Msg("Testing recipient resolver connection")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.redis.Ping(ctx).Err(); err != nil {
+		log.Error().Err(err).Msg("Recipient resolver connection test failed")
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+
+	log.Info().Msg("Recipient resolver connection test successful")
+	return nil
+}
+
+// listUsers fetches a list of users from the directory, using the cache when possible
+func (r *RecipientResolver) listUsers(cacheKey string, path string, tenantID string, query url.Values) ([]*UserContact, error) {
+	ctx := context.Background()
+
+	if cached, err := r.redis.Get(ctx, cacheKey).Result(); err == nil {
+		var users []*UserContact
+		if err := json.Unmarshal([]byte(cached), &users); err == nil {
+			return users, nil
+		}
+	}
+
+	var response userDirectoryResponse
+	if err := r.get(path, tenantID, query, &response); err != nil {
+		return nil, err
+	}
+
+	var users []*UserContact
+	for _, user := range response.Users {
+		if user.TenantID != "" && tenantID != "" && user.TenantID != tenantID {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	if len(users) > r.config.MaxExpansion {
+		return nil, fmt.Errorf("recipient expansion exceeds limit of %d", r.config.MaxExpansion)
+	}
+
+	r.cache(cacheKey, users)
+
+	// Warm the per-user cache as well
+	for _, user := range users {
+		r.cache(r.getContactKey(tenantID, user.ID), user)
+	}
+
+	return users, nil
+}
+
+// get performs a GET request against the user service
+func (r *RecipientResolver) get(path string, tenantID string, query url.Values, out interface{}) error {
+	if r.config.UserServiceURL == "" {
+		return fmt.Errorf("user directory is not configured")
+	}
+
+	if query == nil {
+		query = url.Values{}
+	}
+	if tenantID != "" {
+		query.Set("tenant_id", tenantID)
+	}
+
+	endpoint := strings.TrimRight(r.config.UserServiceURL, "/") + path
+	if encoded := query.Encode(); encoded != "" {
+		endpoint += "?" + encoded
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create user directory request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if r.config.ServiceToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.ServiceToken)
+	}
+	if tenantID != "" {
+		req.Header.Set("X-Tenant-ID", tenantID)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("user directory request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read user directory response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("not found in user directory: %s", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("user directory returned status %d: %s", resp.StatusCode, truncateString(string(body), 200))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode user directory response: %w", err)
+	}
+
+	return nil
+}
+
+// cache stores a value in the resolver cache
+func (r *RecipientResolver) cache(key string, value interface{}) {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	if err := r.redis.Set(ctx, key, valueJSON, r.config.CacheTTL).Err(); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Failed to cache recipient data")
+	}
+}
+
+// addressesForChannel picks the addresses of a user that apply to a channel
+func (r *RecipientResolver) addressesForChannel(contact *UserContact, channel string) []string {
+	switch channel {
+	case "email":
+		if contact.Email != "" {
+			return []string{contact.Email}
+		}
+	case "sms", "voice":
+		if contact.Phone != "" {
+			return []string{contact.Phone}
+		}
+	case "push":
+		return contact.DeviceTokens
+	case "inapp", "webhook":
+		return []string{contact.ID}
+	}
+	return nil
+}
+
+// Redis key generators
+func (r *RecipientResolver) getContactKey(tenantID string, userID string) string {
+	return fmt.Sprintf("recipient_contact:%s:%s", tenantID, userID)
+}
+
+func (r *RecipientResolver) getGroupKey(tenantID string, groupID string) string {
+	return fmt.Sprintf("recipient_group:%s:%s", tenantID, groupID)
+}
+
+func (r *RecipientResolver) getRoleKey(tenantID string, role string) string {
+	return fmt.Sprintf("recipient_role:%s:%s", tenantID, role)
+}
+
+// rawAddressChannel returns the channel a raw address is delivered on. For
+// all channels it is email for email addresses and SMS for anything else,
+// users are reached on the other channels by reference only.
+func rawAddressChannel(channel string, address string) string {
+	if channel != "all" {
+		return channel
+	}
+	if strings.Contains(address, "@") {
+		return "email"
+	}
+	return "sms"
+}
+
+// isRecipientReference reports whether a recipient is a user, group or role reference
+func isRecipientReference(recipient string) bool {
+	return strings.HasPrefix(recipient, RecipientPrefixUser) ||
+		strings.HasPrefix(recipient, RecipientPrefixGroup) ||
+		strings.HasPrefix(recipient, RecipientPrefixRole)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newRecipientTestResolver returns a resolver on miniredis knowing contacts
+// from its cache only
+func newRecipientTestResolver(t *testing.T, contacts ...*UserContact) *RecipientResolver {
+	t.Helper()
+
+	resolver, err := NewRecipientResolver(RecipientConfig{RedisURL: "redis://" + miniredis.RunT(t).Addr()})
+	if err != nil {
+		t.Fatalf("Failed to create recipient resolver: %v", err)
+	}
+	for _, contact := range contacts {
+		resolver.cache(resolver.getContactKey(contact.TenantID, contact.ID), contact)
+	}
+	return resolver
+}
+
+// channelAddresses returns the addresses of resolved recipients by channel
+func channelAddresses(resolved []ResolvedRecipient) map[string][]string {
+	addresses := make(map[string][]string)
+	for _, recipient := range resolved {
+		addresses[recipient.Channel] = append(addresses[recipient.Channel], recipient.Addresses...)
+	}
+	return addresses
+}
+
+func TestResolveRecipientsForAllChannelsUsesTheAddressOfEachChannel(t *testing.T) {
+	resolver := newRecipientTestResolver(t,
+		&UserContact{
+			ID:           "user-1",
+			TenantID:     "tenant-a",
+			Email:        "ayse@talimat.test",
+			Phone:        "+905551112233",
+			DeviceTokens: []string{"token-1", "token-2"},
+			IsActive:     true,
+		},
+		&UserContact{ID: "user-2", TenantID: "tenant-a", Email: "mehmet@talimat.test", IsActive: true},
+	)
+
+	resolved, err := resolver.ResolveRecipients("tenant-a", "all", []string{"user:user-1", "user:user-2"})
+	if err != nil {
+		t.Fatalf("Failed to resolve recipients: %v", err)
+	}
+
+	expected := map[string][]string{
+		"email": {"ayse@talimat.test", "mehmet@talimat.test"},
+		"sms":   {"+905551112233"},
+		"push":  {"token-1", "token-2"},
+		"inapp": {"user-1", "user-2"},
+	}
+	if got := channelAddresses(resolved); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected every channel to get its own addresses, got %v", got)
+	}
+	for _, recipient := range resolved {
+		if recipient.Contact == nil || recipient.UserID != recipient.Contact.ID {
+			t.Errorf("Expected resolved recipients to keep their user, got %+v", recipient)
+		}
+	}
+}
+
+func TestResolveRecipientsForOneChannel(t *testing.T) {
+	resolver := newRecipientTestResolver(t,
+		&UserContact{ID: "user-1", TenantID: "tenant-a", Email: "ayse@talimat.test", Phone: "+905551112233", IsActive: true},
+		&UserContact{ID: "user-2", TenantID: "tenant-a", Email: "mehmet@talimat.test", IsActive: true},
+		&UserContact{ID: "user-3", TenantID: "tenant-a", Phone: "+905554445566", IsActive: false},
+	)
+
+	resolved, err := resolver.ResolveRecipients("tenant-a", "sms", []string{"user:user-1", "user:user-2", "user:user-3", "user:user-1"})
+	if err != nil {
+		t.Fatalf("Failed to resolve recipients: %v", err)
+	}
+
+	// Users without a phone and inactive users are skipped, duplicates resolve once
+	expected := map[string][]string{"sms": {"+905551112233"}}
+	if got := channelAddresses(resolved); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the phone of the active user only, got %v", got)
+	}
+}
+
+func TestResolveRawAddressesForAllChannels(t *testing.T) {
+	resolver := newRecipientTestResolver(t)
+
+	resolved, err := resolver.ResolveRecipients("tenant-a", "all", []string{"ayse@talimat.test", "+905551112233", "ayse@talimat.test"})
+	if err != nil {
+		t.Fatalf("Failed to resolve recipients: %v", err)
+	}
+
+	expected := map[string][]string{"email": {"ayse@talimat.test"}, "sms": {"+905551112233"}}
+	if got := channelAddresses(resolved); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected email addresses to be emailed and numbers texted, got %v", got)
+	}
+}
+
+func TestSendingToAllChannelsDeliversToTheAddressOfEachChannel(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+
+	recipients := env.service.recipients
+	recipients.cache(recipients.getContactKey("tenant-a", "user-1"), &UserContact{
+		ID:       "user-1",
+		TenantID: "tenant-a",
+		Email:    "ayse@talimat.test",
+		Phone:    "+905551112233",
+		IsActive: true,
+	})
+
+	result, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:       "all",
+		Recipients: []string{"user:user-1"},
+		Subject:    "Tatbikat",
+		Title:      "Tatbikat",
+		Message:    "Saat 14.00'te toplanma alanında olun",
+		TextBody:   "Saat 14.00'te toplanma alanında olun",
+		Category:   "safety",
+		TenantID:   "tenant-a",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.Metadata["sent_count"] != 3 {
+		t.Fatalf("Expected an email, an SMS and an in-app notification, got %v", result.Metadata["sent_count"])
+	}
+
+	if sent := env.smtp.sent(); len(sent) != 1 || !reflect.DeepEqual(sent[0].To, []string{"ayse@talimat.test"}) {
+		t.Errorf("Expected the email to go to the email address, got %+v", sent)
+	}
+	if numbers := env.netgsm.sent(); len(numbers) != 1 || numbers[0] == "ayse@talimat.test" {
+		t.Errorf("Expected the SMS to go to the phone number, got %v", numbers)
+	}
+	notifications, _, err := env.service.inAppService.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, nil)
+	if err != nil || len(notifications) != 1 {
+		t.Errorf("Expected one in-app notification, got %d (%v)", len(notifications), err)
+	}
+}
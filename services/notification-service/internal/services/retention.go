@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/lock"
+)
+
+// retentionLockTTL is how long a retention run holds its lock without
+// refreshing it
+const retentionLockTTL = 1 * time.Minute
+
+// RetentionPolicy describes how long the notification results of a tenant are
+// kept in hot storage
+type RetentionPolicy struct {
+	TenantID      string    `json:"tenant_id"`
+	RetentionDays int       `json:"retention_days"`
+	Archive       bool      `json:"archive"` // archive results before deleting them
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// RetentionProgress reports what the retention job did for a tenant
+type RetentionProgress struct {
+	TenantID   string     `json:"tenant_id"`
+	Running    bool       `json:"running"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastCutoff *time.Time `json:"last_cutoff,omitempty"`
+	Archived   int64      `json:"archived"`
+	Deleted    int64      `json:"deleted"`
+	Remaining  int64      `json:"remaining"` // results still in hot storage
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// GetRetentionPolicy returns the retention policy of a tenant, falling back to
+// the service default
+func (s *NotificationService) GetRetentionPolicy(tenantID string) (*RetentionPolicy, error) {
+	ctx := context.Background()
+
+	policyJSON, err := s.redis.Get(ctx, s.getRetentionPolicyKey(tenantID)).Result()
+	if err == redis.Nil {
+		return &RetentionPolicy{
+			TenantID:      tenantID,
+			RetentionDays: s.config.RetentionDays,
+			Archive:       s.config.Archiver != nil,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+
+	var policy RetentionPolicy
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal retention policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// SetRetentionPolicy stores the retention policy of a tenant
+func (s *NotificationService) SetRetentionPolicy(policy RetentionPolicy) (*RetentionPolicy, error) {
+	log.Info().
+		Str("tenantID", policy.TenantID).
+		Int("retentionDays", policy.RetentionDays).
+		Bool("archive", policy.Archive).
+		Msg("Updating retention policy")
+
+	if policy.RetentionDays < 1 {
+		return nil, invalid(fmt.Errorf("retention days must be at least 1"))
+	}
+	if policy.Archive && s.config.Archiver == nil {
+		return nil, invalid(fmt.Errorf("archiving is not configured"))
+	}
+
+	policy.UpdatedAt = time.Now()
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal retention policy: %w", err)
+	}
+
+	ctx := context.Background()
+	if err := s.redis.Set(ctx, s.getRetentionPolicyKey(policy.TenantID), policyJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store retention policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// GetRetentionProgress returns the archival progress of a tenant
+func (s *NotificationService) GetRetentionProgress(tenantID string) (*RetentionProgress, error) {
+	ctx := context.Background()
+
+	values, err := s.redis.HGetAll(ctx, s.getRetentionProgressKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention progress: %w", err)
+	}
+
+	remaining, err := s.redis.ZCard(ctx, s.getRetentionIndexKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count stored results: %w", err)
+	}
+
+	progress := &RetentionProgress{
+		TenantID:  tenantID,
+		Running:   values["running"] == "1",
+		Remaining: remaining,
+		LastError: values["last_error"],
+	}
+	progress.Archived, _ = strconv.ParseInt(values["archived"], 10, 64)
+	progress.Deleted, _ = strconv.ParseInt(values["deleted"], 10, 64)
+
+	if unix, err := strconv.ParseInt(values["last_run_at"], 10, 64); err == nil {
+		lastRunAt := time.Unix(unix, 0)
+		progress.LastRunAt = &lastRunAt
+	}
+	if unix, err := strconv.ParseInt(values["last_cutoff"], 10, 64); err == nil {
+		lastCutoff := time.Unix(unix, 0)
+		progress.LastCutoff = &lastCutoff
+	}
+
+	return progress, nil
+}
+
+// startRetentionJob periodically archives and deletes expired results
+func (s *NotificationService) startRetentionJob() {
+	log.Info().Dur("interval", s.config.RetentionInterval).Msg("Retention job started")
+
+	ticker := time.NewTicker(s.config.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Retention job stopped")
+			return
+		case <-ticker.C:
+			s.runRetention()
+		}
+	}
+}
+
+// runRetention applies the retention policy of every tenant. Only the leader
+// runs the job, and the lock keeps a run from overlapping one started before
+// the leadership moved.
+func (s *NotificationService) runRetention() {
+	if !s.IsLeader() {
+		return
+	}
+
+	err := lock.Do(s.ctx, s.redis, s.getRetentionLockKey(), retentionLockTTL, func(ctx context.Context) {
+		tenants, err := s.redis.SMembers(ctx, s.getRetentionTenantsKey()).Result()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get tenants for retention")
+			return
+		}
+
+		for _, tenant := range tenants {
+			if ctx.Err() != nil {
+				return
+			}
+
+			tenantID := tenant
+			if tenant == "global" {
+				tenantID = ""
+			}
+
+			if err := s.ApplyRetention(tenantID); err != nil {
+				log.Error().Err(err).Str("tenantID", tenantID).Msg("Failed to apply retention policy")
+			}
+		}
+	})
+	if err != nil && !errors.Is(err, lock.ErrLocked) {
+		log.Error().Err(err).Msg("Failed to lock retention job")
+	}
+}
+
+// StartRetention applies the retention policy of a tenant in the background,
+// Shutdown waits for the run to finish
+func (s *NotificationService) StartRetention(tenantID string) {
+	s.goBackground(func() {
+		if err := s.ApplyRetention(tenantID); err != nil {
+			log.Error().Err(err).Str("tenantID", tenantID).Msg("Retention run failed")
+		}
+	})
+}
+
+// ApplyRetention archives and deletes the results of a tenant that are older
+// than its retention policy allows
+func (s *NotificationService) ApplyRetention(tenantID string) error {
+	policy, err := s.GetRetentionPolicy(tenantID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	indexKey := s.getRetentionIndexKey(tenantID)
+	progressKey := s.getRetentionProgressKey(tenantID)
+	cutoff := time.Now().AddDate(0, 0, -policy.RetentionDays)
+
+	s.redis.HSet(ctx, progressKey,
+		"running", "1",
+		"last_run_at", time.Now().Unix(),
+		"last_cutoff", cutoff.Unix(),
+		"last_error", "",
+	)
+	defer s.redis.HSet(ctx, progressKey, "running", "0")
+
+	for s.ctx.Err() == nil {
+		ids, err := s.redis.ZRangeByScore(ctx, indexKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(cutoff.Unix(), 10),
+			Count: int64(s.config.RetentionBatchSize),
+		}).Result()
+		if err != nil {
+			return s.failRetention(progressKey, fmt.Errorf("failed to get expired results: %w", err))
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		var batch []ArchivedNotification
+		for _, id := range ids {
+			result, err := s.GetNotificationStatus(ctx, id)
+			if err != nil {
+				continue
+			}
+
+			archived := ArchivedNotification{Result: *result, ArchivedAt: time.Now()}
+			if request, err := s.getRequest(result.RequestID); err == nil {
+				archived.Request = request
+			}
+			batch = append(batch, archived)
+		}
+
+		// Nothing is deleted from hot storage unless the archive accepted it
+		if policy.Archive && len(batch) > 0 {
+			if s.config.Archiver == nil {
+				return s.failRetention(progressKey, fmt.Errorf("archiving is not configured"))
+			}
+			if err := s.config.Archiver.Archive(tenantID, batch); err != nil {
+				return s.failRetention(progressKey, fmt.Errorf("failed to archive results: %w", err))
+			}
+		}
+
+		results := make([]NotificationResult, len(batch))
+		pipe := s.redis.TxPipeline()
+		for i, archived := range batch {
+			results[i] = archived.Result
+			pipe.Del(ctx, s.getResultKey(archived.Result.ID))
+			pipe.Del(ctx, s.getRequestKey(archived.Result.RequestID))
+			pipe.Del(ctx, s.getTimelineKey(archived.Result.ID))
+			if userID := resultUserID(archived.Result); userID != "" {
+				pipe.SRem(ctx, s.getUserResultsKey(tenantID, userID), archived.Result.ID)
+			}
+		}
+		members := make([]interface{}, len(ids))
+		for i, id := range ids {
+			members[i] = id
+		}
+		pipe.ZRem(ctx, indexKey, members...)
+		s.unindexHistory(ctx, pipe, tenantID, results)
+
+		if policy.Archive {
+			pipe.HIncrBy(ctx, progressKey, "archived", int64(len(batch)))
+		}
+		pipe.HIncrBy(ctx, progressKey, "deleted", int64(len(batch)))
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return s.failRetention(progressKey, fmt.Errorf("failed to delete expired results: %w", err))
+		}
+
+		log.Info().
+			Str("tenantID", tenantID).
+			Int("count", len(batch)).
+			Bool("archived", policy.Archive).
+			Msg("Expired notification results removed from hot storage")
+	}
+
+	return nil
+}
+
+// failRetention records a failed retention run
+func (s *NotificationService) failRetention(progressKey string, err error) error {
+	s.redis.HSet(context.Background(), progressKey, "last_error", err.Error())
+	return err
+}
+
+// Redis key generators
+func (s *NotificationService) getRetentionPolicyKey(tenantID string) string {
+	return fmt.Sprintf("retention_policy:%s", retentionTenant(tenantID))
+}
+
+func (s *NotificationService) getRetentionProgressKey(tenantID string) string {
+	return fmt.Sprintf("retention_progress:%s", retentionTenant(tenantID))
+}
+
+func (s *NotificationService) getRetentionIndexKey(tenantID string) string {
+	return fmt.Sprintf("notification_results_by_time:%s", retentionTenant(tenantID))
+}
+
+func (s *NotificationService) getRetentionTenantsKey() string {
+	return "retention_tenants"
+}
+
+func (s *NotificationService) getRetentionLockKey() string {
+	return "retention_job_lock"
+}
+
+// Helper functions
+func retentionTenant(tenantID string) string {
+	if tenantID == "" {
+		return "global"
+	}
+	return tenantID
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// archiveRecorder is an archive keeping what it is given, failing with err
+type archiveRecorder struct {
+	archived []ArchivedNotification
+	err      error
+}
+
+func (a *archiveRecorder) Archive(tenantID string, notifications []ArchivedNotification) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.archived = append(a.archived, notifications...)
+	return nil
+}
+
+// sendAged sends an in-app notification to tenant-a and backdates it by age
+// in the retention index
+func sendAged(t *testing.T, env *integrationEnv, age time.Duration) *NotificationResult {
+	t.Helper()
+	ctx := context.Background()
+
+	result, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:       "inapp",
+		Recipients: []string{"user-1"},
+		Title:      "Vardiya planı",
+		Message:    "Haftalık vardiya planı yayınlandı",
+		Category:   "safety",
+		TenantID:   "tenant-a",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	env.service.redis.ZAdd(ctx, env.service.getRetentionIndexKey("tenant-a"), &redis.Z{
+		Score:  float64(time.Now().Add(-age).Unix()),
+		Member: result.ID,
+	})
+	return result
+}
+
+func TestExpiredResultsAreArchivedBeforeTheyAreDeleted(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	archive := &archiveRecorder{}
+	env.service.config.Archiver = archive
+
+	if _, err := env.service.SetRetentionPolicy(RetentionPolicy{TenantID: "tenant-a", RetentionDays: 30, Archive: true}); err != nil {
+		t.Fatalf("Failed to set retention policy: %v", err)
+	}
+	expired := sendAged(t, env, 31*24*time.Hour)
+	kept := sendAged(t, env, 29*24*time.Hour)
+
+	if err := env.service.ApplyRetention("tenant-a"); err != nil {
+		t.Fatalf("Failed to apply retention: %v", err)
+	}
+
+	if len(archive.archived) != 1 || archive.archived[0].Result.ID != expired.ID {
+		t.Fatalf("Expected the expired result to be archived, got %+v", archive.archived)
+	}
+	if archive.archived[0].Request == nil || archive.archived[0].Request.Title != "Vardiya planı" {
+		t.Errorf("Expected the result to be archived with its request, got %+v", archive.archived[0].Request)
+	}
+
+	if _, err := env.service.GetNotificationStatus(ctx, expired.ID); err == nil {
+		t.Errorf("Expected the expired result to be deleted")
+	}
+	if _, err := env.service.getRequest(expired.RequestID); err == nil {
+		t.Errorf("Expected the request of the expired result to be deleted")
+	}
+	if _, err := env.service.GetNotificationStatus(ctx, kept.ID); err != nil {
+		t.Errorf("Expected the result within the retention period to be kept: %v", err)
+	}
+
+	progress, err := env.service.GetRetentionProgress("tenant-a")
+	if err != nil {
+		t.Fatalf("Failed to get retention progress: %v", err)
+	}
+	if progress.Running || progress.Archived != 1 || progress.Deleted != 1 || progress.Remaining != 1 {
+		t.Errorf("Expected one result archived and one remaining, got %+v", progress)
+	}
+}
+
+func TestResultsAreKeptWhenTheArchiveFails(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	env.service.config.Archiver = &archiveRecorder{err: errors.New("bucket unavailable")}
+
+	if _, err := env.service.SetRetentionPolicy(RetentionPolicy{TenantID: "tenant-a", RetentionDays: 30, Archive: true}); err != nil {
+		t.Fatalf("Failed to set retention policy: %v", err)
+	}
+	expired := sendAged(t, env, 31*24*time.Hour)
+
+	if err := env.service.ApplyRetention("tenant-a"); err == nil {
+		t.Fatalf("Expected the retention run to fail")
+	}
+
+	if _, err := env.service.GetNotificationStatus(ctx, expired.ID); err != nil {
+		t.Errorf("Expected the result to stay in hot storage: %v", err)
+	}
+	progress, err := env.service.GetRetentionProgress("tenant-a")
+	if err != nil {
+		t.Fatalf("Failed to get retention progress: %v", err)
+	}
+	if progress.Deleted != 0 || progress.Remaining != 1 || progress.LastError == "" {
+		t.Errorf("Expected nothing deleted and the error recorded, got %+v", progress)
+	}
+}
+
+func TestArchivingRequiresAnArchive(t *testing.T) {
+	env := newIntegrationEnv(t)
+
+	if _, err := env.service.SetRetentionPolicy(RetentionPolicy{TenantID: "tenant-a", RetentionDays: 30, Archive: true}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected archiving without an archive to be invalid, got %v", err)
+	}
+	if _, err := env.service.SetRetentionPolicy(RetentionPolicy{TenantID: "tenant-a", RetentionDays: 0}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a retention of less than a day to be invalid, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// retryJitter is the random source used to spread retries of failed deliveries
+var (
+	retryJitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	retryJitterMu sync.Mutex
+)
+
+// maxAttempts returns the retry budget of a channel for a tenant, the
+// retries of its settings when it has any
+func (s *NotificationService) maxAttempts(tenantID string, notificationType string) int {
+	if settings := s.tenantSettings(context.Background(), tenantID); settings.MaxRetries > 0 {
+		return settings.MaxRetries
+	}
+	if budget, ok := s.config.RetryBudgets[notificationType]; ok && budget > 0 {
+		return budget
+	}
+	return s.config.MaxRetries
+}
+
+// retryBackoff returns the delay before the next attempt after the given number
+// of attempts. The delay doubles with every attempt up to maxDelay, and the upper
+// half is randomised ("equal jitter") so retries of a burst of failures do not
+// all hit the provider at the same moment.
+func retryBackoff(baseDelay time.Duration, maxDelay time.Duration, attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+
+	retryJitterMu.Lock()
+	jitter := retryJitter.Int63n(half + 1)
+	retryJitterMu.Unlock()
+
+	return time.Duration(half + jitter)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Keys of the runtime configuration, the tunables operators change without
+// a redeploy. Unset keys keep the values the service was started with.
+const (
+	RuntimeWorkerCount      = "notification.worker_count"
+	RuntimeBatchSize        = "notification.batch_size"
+	RuntimeStrictValidation = "api.strict_validation"
+)
+
+// RuntimeChannelPaused is the key pausing a channel, e.g. channel.sms.paused.
+// Sends on a paused channel are queued until it is resumed.
+func RuntimeChannelPaused(channel string) string {
+	return "channel." + channel + ".paused"
+}
+
+// RuntimeChannelWorkers is the key setting how many workers process the queue
+// of a channel, e.g. channel.email.workers
+func RuntimeChannelWorkers(channel string) string {
+	return "channel." + channel + ".workers"
+}
+
+// RuntimeChannelMaxInFlight is the key setting how many sends of a channel may
+// wait on its provider at once, e.g. channel.email.max_in_flight
+func RuntimeChannelMaxInFlight(channel string) string {
+	return "channel." + channel + ".max_in_flight"
+}
+
+// RuntimeSMSRateLimit is the key overriding the messages per second of an SMS
+// provider, e.g. sms.netgsm.rate_limit
+func RuntimeSMSRateLimit(provider string) string {
+	return "sms." + strings.ToLower(provider) + ".rate_limit"
+}
+
+// maxWorkerCount bounds the workers the runtime configuration may ask for
+const maxWorkerCount = 100
+
+// queueChannels are the channels with a queue and workers of their own, so a
+// slow provider of one doesn't hold back the deliveries of the others.
+// Notifications sent on every channel at once use the shared queue.
+var queueChannels = []string{"email", "sms", "push", "inapp", "webhook", "voice"}
+
+// defaultChannelMaxInFlight bounds the sends of the channels the
+// configuration has no bound for
+var defaultChannelMaxInFlight = map[string]int{
+	"email":   10,
+	"sms":     10,
+	"push":    50,
+	"inapp":   100,
+	"webhook": 50,
+	"voice":   5,
+}
+
+// pausedRetryDelay is how often queued sends check whether their channel was
+// resumed
+const pausedRetryDelay = 1 * time.Minute
+
+// workerCount returns how many workers process the queue
+func (s *NotificationService) workerCount() int {
+	count := s.config.Runtime.Int(RuntimeWorkerCount, s.config.WorkerCount)
+	if count < 1 || count > maxWorkerCount {
+		return s.config.WorkerCount
+	}
+	return count
+}
+
+// channelWorkerCount returns how many workers process the queue of a
+// channel, the shared queue for an empty channel
+func (s *NotificationService) channelWorkerCount(channel string) int {
+	if channel == "" {
+		return s.workerCount()
+	}
+
+	configured, ok := s.config.ChannelWorkers[channel]
+	if !ok || configured < 1 {
+		configured = s.config.WorkerCount
+	}
+	count := s.config.Runtime.Int(RuntimeChannelWorkers(channel), configured)
+	if count < 1 || count > maxWorkerCount {
+		return configured
+	}
+	return count
+}
+
+// channelMaxInFlight returns how many sends of a channel may wait on its
+// provider at once
+func (s *NotificationService) channelMaxInFlight(channel string) int {
+	configured, ok := s.config.ChannelMaxInFlight[channel]
+	if !ok || configured < 1 {
+		configured = defaultChannelMaxInFlight[channel]
+	}
+	limit := s.config.Runtime.Int(RuntimeChannelMaxInFlight(channel), configured)
+	if limit < 1 {
+		return configured
+	}
+	return limit
+}
+
+// channelPool returns the pool bounding the sends of a channel in flight,
+// nil for channels sent without a bound. The runtime configuration resizes it.
+func (s *NotificationService) channelPool(channel string) *workerPool {
+	pool, ok := s.channelPools[channel]
+	if !ok {
+		return nil
+	}
+	pool.resize(s.channelMaxInFlight(channel))
+	return pool
+}
+
+// batchSize returns how many requests of a bulk send are processed at once
+func (s *NotificationService) batchSize() int {
+	size := s.config.Runtime.Int(RuntimeBatchSize, s.config.BatchSize)
+	if size < 1 {
+		return s.config.BatchSize
+	}
+	return size
+}
+
+// channelPaused reports whether operators paused a channel
+func (s *NotificationService) channelPaused(channel string) bool {
+	return s.config.Runtime.Bool(RuntimeChannelPaused(channel), false)
+}
+
+// resizeWorkers starts workers until as many run as the worker counts ask
+// for, for the shared queue and the queue of every channel. Workers are never
+// stopped, the ones beyond a lowered count idle.
+func (s *NotificationService) resizeWorkers() {
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+
+	// Shutdown waits for the workers started so far
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	for _, channel := range append([]string{""}, queueChannels...) {
+		count := s.channelWorkerCount(channel)
+		if count > s.workers[channel] {
+			log.Info().Str("channel", channel).Int("workerCount", count).Msg("Starting notification workers")
+		}
+		for ; s.workers[channel] < count; s.workers[channel]++ {
+			channel, id := channel, s.workers[channel]
+			s.goBackground(func() { s.worker(channel, id) })
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// maxSavedViews is how many views a user may save
+const maxSavedViews = 50
+
+// maxSavedViewNameLength bounds the names of saved views
+const maxSavedViewNameLength = 100
+
+// SavedView is a named filter combination a user reads their in-app feed
+// through, like "Safety critical" or "My approvals". Empty filters match
+// every notification.
+type SavedView struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	TenantID  string    `json:"tenant_id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+	Thread    string    `json:"thread,omitempty"`
+	Search    string    `json:"search,omitempty"`
+	Read      *bool     `json:"read,omitempty"`
+	Archived  *bool     `json:"archived,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Filters returns the filters of GetUserNotifications the view stands for
+func (v *SavedView) Filters() map[string]interface{} {
+	filters := make(map[string]interface{})
+	for key, value := range map[string]string{
+		"type":     v.Type,
+		"category": v.Category,
+		"priority": v.Priority,
+		"thread":   v.Thread,
+		"search":   v.Search,
+	} {
+		if value != "" {
+			filters[key] = value
+		}
+	}
+	if v.Read != nil {
+		filters["read"] = *v.Read
+	}
+	if v.Archived != nil {
+		filters["archived"] = *v.Archived
+	}
+	return filters
+}
+
+// CreateSavedView saves a view of the in-app feed for a user
+func (s *InAppNotificationService) CreateSavedView(ctx context.Context, view SavedView) (*SavedView, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	log.Info().
+		Str("userID", view.UserID).
+		Str("name", view.Name).
+		Msg("Creating saved view")
+
+	if err := validateSavedView(view); err != nil {
+		return nil, invalid(fmt.Errorf("saved view validation failed: %w", err))
+	}
+
+	views, err := s.ListSavedViews(ctx, view.UserID, view.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(views) >= maxSavedViews {
+		return nil, invalid(fmt.Errorf("at most %d views can be saved", maxSavedViews))
+	}
+	for _, existing := range views {
+		if existing.Name == view.Name {
+			return nil, conflictf("a view named %s already exists", view.Name)
+		}
+	}
+
+	view.ID = newID("view")
+	view.CreatedAt = time.Now()
+	view.UpdatedAt = view.CreatedAt
+
+	if err := s.storeSavedView(ctx, &view); err != nil {
+		return nil, err
+	}
+
+	return &view, nil
+}
+
+// GetSavedView gets a saved view of a user
+func (s *InAppNotificationService) GetSavedView(ctx context.Context, userID string, tenantID string, viewID string) (*SavedView, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	viewJSON, err := s.redis.HGet(ctx, s.getSavedViewsKey(userID, tenantID), viewID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("saved view not found: %s", viewID)
+		}
+		return nil, fmt.Errorf("failed to get saved view: %w", err)
+	}
+
+	var view SavedView
+	if err := json.Unmarshal([]byte(viewJSON), &view); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal saved view: %w", err)
+	}
+
+	return &view, nil
+}
+
+// ListSavedViews lists the saved views of a user in the order they were created
+func (s *InAppNotificationService) ListSavedViews(ctx context.Context, userID string, tenantID string) ([]*SavedView, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	values, err := s.redis.HVals(ctx, s.getSavedViewsKey(userID, tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved views: %w", err)
+	}
+
+	views := make([]*SavedView, 0, len(values))
+	for _, viewJSON := range values {
+		var view SavedView
+		if err := json.Unmarshal([]byte(viewJSON), &view); err != nil {
+			log.Warn().Err(err).Str("userID", userID).Msg("Failed to unmarshal saved view")
+			continue
+		}
+		views = append(views, &view)
+	}
+
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].CreatedAt.Before(views[j].CreatedAt)
+	})
+
+	return views, nil
+}
+
+// UpdateSavedView replaces the name and filters of a saved view
+func (s *InAppNotificationService) UpdateSavedView(ctx context.Context, view SavedView) (*SavedView, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	existing, err := s.GetSavedView(ctx, view.UserID, view.TenantID, view.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateSavedView(view); err != nil {
+		return nil, invalid(fmt.Errorf("saved view validation failed: %w", err))
+	}
+
+	if view.Name != existing.Name {
+		views, err := s.ListSavedViews(ctx, view.UserID, view.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range views {
+			if other.Name == view.Name {
+				return nil, conflictf("a view named %s already exists", view.Name)
+			}
+		}
+	}
+
+	view.CreatedAt = existing.CreatedAt
+	view.UpdatedAt = time.Now()
+
+	if err := s.storeSavedView(ctx, &view); err != nil {
+		return nil, err
+	}
+
+	return &view, nil
+}
+
+// DeleteSavedView deletes a saved view of a user
+func (s *InAppNotificationService) DeleteSavedView(ctx context.Context, userID string, tenantID string, viewID string) error {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	deleted, err := s.redis.HDel(ctx, s.getSavedViewsKey(userID, tenantID), viewID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete saved view: %w", err)
+	}
+	if deleted == 0 {
+		return notFoundf("saved view not found: %s", viewID)
+	}
+
+	return nil
+}
+
+// storeSavedView stores a saved view
+func (s *InAppNotificationService) storeSavedView(ctx context.Context, view *SavedView) error {
+	viewJSON, err := json.Marshal(view)
+	if err != nil {
+		return fmt.Errorf("failed to marshal saved view: %w", err)
+	}
+
+	if err := s.redis.HSet(ctx, s.getSavedViewsKey(view.UserID, view.TenantID), view.ID, viewJSON).Err(); err != nil {
+		return fmt.Errorf("failed to store saved view: %w", err)
+	}
+
+	return nil
+}
+
+// validateSavedView validates a saved view
+func validateSavedView(view SavedView) error {
+	if view.UserID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+	if view.Name == "" {
+		return fmt.Errorf("view name is required")
+	}
+	if len(view.Name) > maxSavedViewNameLength {
+		return fmt.Errorf("view name is longer than %d characters", maxSavedViewNameLength)
+	}
+	return nil
+}
+
+// Redis key generators
+func (s *InAppNotificationService) getSavedViewsKey(userID string, tenantID string) string {
+	return fmt.Sprintf("saved_views:%s:%s", tenantID, userID)
+}
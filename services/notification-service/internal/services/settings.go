@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/models"
+)
+
+// rateWindow is a period the sends of a tenant are counted over
+type rateWindow struct {
+	name   string
+	length time.Duration
+	limit  func(settings *models.NotificationSettings) int
+}
+
+var rateWindows = []rateWindow{
+	{"minute", time.Minute, func(settings *models.NotificationSettings) int { return settings.RateLimitPerMinute }},
+	{"hour", time.Hour, func(settings *models.NotificationSettings) int { return settings.RateLimitPerHour }},
+	{"day", 24 * time.Hour, func(settings *models.NotificationSettings) int { return settings.RateLimitPerDay }},
+}
+
+// GetSettings returns the notification settings of a tenant. Tenants without
+// settings get empty ones, which keep the configured defaults.
+func (s *NotificationService) GetSettings(ctx context.Context, tenantID string) (*models.NotificationSettings, error) {
+	if tenantID == "" {
+		return &models.NotificationSettings{}, nil
+	}
+
+	settingsJSON, err := s.redis.Get(ctx, s.getSettingsKey(tenantID)).Result()
+	if err == redis.Nil {
+		return &models.NotificationSettings{TenantID: tenantID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification settings: %w", err)
+	}
+
+	var settings models.NotificationSettings
+	if err := json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal notification settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SetSettings stores the notification settings of a tenant
+func (s *NotificationService) SetSettings(ctx context.Context, settings models.NotificationSettings) (*models.NotificationSettings, error) {
+	log.Info().
+		Str("tenantID", settings.TenantID).
+		Int("maxRetries", settings.MaxRetries).
+		Int("rateLimitPerMinute", settings.RateLimitPerMinute).
+		Msg("Updating notification settings")
+
+	if settings.TenantID == "" {
+		return nil, invalid(fmt.Errorf("tenant ID is required"))
+	}
+
+	for name, value := range map[string]int{
+		"max retries":           settings.MaxRetries,
+		"retry delay":           settings.RetryDelay,
+		"batch size":            settings.BatchSize,
+		"queue timeout":         settings.QueueTimeout,
+		"default TTL":           settings.DefaultTTL,
+		"rate limit per minute": settings.RateLimitPerMinute,
+		"rate limit per hour":   settings.RateLimitPerHour,
+		"rate limit per day":    settings.RateLimitPerDay,
+	} {
+		if value < 0 {
+			return nil, invalid(fmt.Errorf("%s cannot be negative", name))
+		}
+	}
+
+	for channel, templateID := range map[string]*string{
+		"email": settings.DefaultEmailTemplate,
+		"sms":   settings.DefaultSMSTemplate,
+		"push":  settings.DefaultPushTemplate,
+	} {
+		if templateID == nil || *templateID == "" {
+			continue
+		}
+		template, err := s.templateService.GetTemplate(*templateID)
+		if err != nil {
+			return nil, invalid(fmt.Errorf("default %s template: %w", channel, err))
+		}
+		if template.TenantID != "" && template.TenantID != settings.TenantID {
+			return nil, invalid(fmt.Errorf("default %s template %s belongs to another tenant", channel, *templateID))
+		}
+	}
+
+	if settings.DeliveryWindow != nil {
+		if err := validateDeliveryWindow(*settings.DeliveryWindow); err != nil {
+			return nil, invalid(err)
+		}
+	}
+
+	previous, err := s.GetSettings(ctx, settings.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	settings.ID = previous.ID
+	if settings.ID == "" {
+		settings.ID = newID("settings")
+	}
+	settings.CreatedAt = previous.CreatedAt
+	if settings.CreatedAt.IsZero() {
+		settings.CreatedAt = time.Now()
+	}
+	settings.UpdatedAt = time.Now()
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification settings: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getSettingsKey(settings.TenantID), settingsJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store notification settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// DeleteSettings removes the notification settings of a tenant, its sends
+// go back to the configured defaults
+func (s *NotificationService) DeleteSettings(ctx context.Context, tenantID string) error {
+	deleted, err := s.redis.Del(ctx, s.getSettingsKey(tenantID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete notification settings: %w", err)
+	}
+	if deleted == 0 {
+		return notFoundf("no notification settings for tenant %s", tenantID)
+	}
+
+	log.Info().Str("tenantID", tenantID).Msg("Notification settings deleted")
+	return nil
+}
+
+// tenantSettings returns the settings a delivery of a tenant is made with.
+// Failing to read them falls back to the configured defaults.
+func (s *NotificationService) tenantSettings(ctx context.Context, tenantID string) *models.NotificationSettings {
+	settings, err := s.GetSettings(ctx, tenantID)
+	if err != nil {
+		log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to get notification settings, using defaults")
+		return &models.NotificationSettings{TenantID: tenantID}
+	}
+	return settings
+}
+
+// applySettings fills in what a request leaves to the settings of its
+// tenant: the default template of its channel and when it expires
+func (s *NotificationService) applySettings(request *NotificationRequest, settings *models.NotificationSettings) error {
+	if request.ExpiresAt == nil && settings.DefaultTTL > 0 {
+		expiresAt := request.CreatedAt.Add(time.Duration(settings.DefaultTTL) * time.Second)
+		request.ExpiresAt = &expiresAt
+	}
+
+	if request.TemplateID != "" {
+		return nil
+	}
+	templateID := defaultTemplate(settings, request.Type)
+	if templateID == "" {
+		return nil
+	}
+
+	// The template lays out the content of the request, which it gets as data
+	data := make(map[string]interface{}, len(request.TemplateData)+3)
+	for key, value := range request.TemplateData {
+		data[key] = value
+	}
+	for key, value := range map[string]string{
+		"subject": request.Subject,
+		"title":   request.Title,
+		"message": request.Message,
+	} {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+
+	rendered, err := s.templateService.RenderTemplate(templateID, data)
+	if err != nil {
+		return fmt.Errorf("failed to render default %s template: %w", request.Type, err)
+	}
+
+	request.TemplateID = templateID
+	request.TemplateData = data
+	for _, field := range []struct {
+		target *string
+		value  string
+	}{
+		{&request.Subject, rendered.Subject},
+		{&request.Title, rendered.Title},
+		{&request.Message, rendered.Message},
+		{&request.HTMLBody, rendered.HTMLBody},
+		{&request.TextBody, rendered.TextBody},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	request.Metadata = copyMetadata(request.Metadata)
+	request.Metadata["template_version"] = rendered.Version
+
+	return nil
+}
+
+// checkRateLimits counts a send against the rate limits of its tenant,
+// returning a RateLimitError once one of them is used up
+func (s *NotificationService) checkRateLimits(ctx context.Context, settings *models.NotificationSettings) error {
+	if settings.TenantID == "" {
+		return nil
+	}
+
+	now := time.Now()
+	for _, window := range rateWindows {
+		limit := window.limit(settings)
+		if limit <= 0 {
+			continue
+		}
+
+		start := now.Truncate(window.length)
+		key := s.getRateLimitKey(settings.TenantID, window.name, start)
+
+		pipe := s.redis.TxPipeline()
+		count := pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, window.length)
+		if _, err := pipe.Exec(ctx); err != nil {
+			// Sends aren't held back because the counters can't be kept
+			log.Warn().Err(err).Str("tenantID", settings.TenantID).Msg("Failed to count send against rate limit")
+			return nil
+		}
+
+		if count.Val() > int64(limit) {
+			return &RateLimitError{
+				Scope:   "tenant " + settings.TenantID,
+				Limit:   limit,
+				Unit:    "notifications",
+				Window:  window.name,
+				RetryAt: start.Add(window.length),
+			}
+		}
+	}
+
+	return nil
+}
+
+// queueTimedOut reports whether a delivery due at dueAt waited in the queue
+// longer than the settings of its tenant allow, or expired meanwhile
+func queueTimedOut(request NotificationRequest, settings *models.NotificationSettings, dueAt time.Time) (string, bool) {
+	now := time.Now()
+	if request.ExpiresAt != nil && now.After(*request.ExpiresAt) {
+		return fmt.Sprintf("notification expired at %s", request.ExpiresAt.Format(time.RFC3339)), true
+	}
+	if settings.QueueTimeout > 0 && now.Sub(dueAt) > time.Duration(settings.QueueTimeout)*time.Second {
+		return fmt.Sprintf("notification waited in the queue longer than %ds", settings.QueueTimeout), true
+	}
+	return "", false
+}
+
+// defaultTemplate returns the default template of a channel, empty when the
+// tenant has none
+func defaultTemplate(settings *models.NotificationSettings, channel string) string {
+	var templateID *string
+	switch channel {
+	case "email":
+		templateID = settings.DefaultEmailTemplate
+	case "sms":
+		templateID = settings.DefaultSMSTemplate
+	case "push":
+		templateID = settings.DefaultPushTemplate
+	}
+	if templateID == nil {
+		return ""
+	}
+	return *templateID
+}
+
+// Redis key generators
+func (s *NotificationService) getSettingsKey(tenantID string) string {
+	return fmt.Sprintf("notification_settings:%s", tenantID)
+}
+
+func (s *NotificationService) getRateLimitKey(tenantID string, window string, start time.Time) string {
+	return fmt.Sprintf("notification_rate:%s:%s:%d", tenantID, window, start.Unix())
+}
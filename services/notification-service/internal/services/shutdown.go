@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// goBackground runs a background loop that Shutdown waits for
+func (s *NotificationService) goBackground(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// trackInFlight records a queue member taken off its queue for processing
+func (s *NotificationService) trackInFlight(queueKey string, member string) {
+	s.inFlightMu.Lock()
+	s.inFlight[member] = queueKey
+	s.inFlightMu.Unlock()
+}
+
+// untrackInFlight forgets a queue member once it has been processed
+func (s *NotificationService) untrackInFlight(member string) {
+	s.inFlightMu.Lock()
+	delete(s.inFlight, member)
+	s.inFlightMu.Unlock()
+}
+
+// Shutdown stops the background workers and waits until the notifications they
+// are processing are finished. Work still in flight when ctx expires is put back
+// on its queue so another instance picks it up.
+func (s *NotificationService) Shutdown(ctx context.Context) error {
+	log.Info().Msg("Shutting down notification service")
+
+	// Stop picking up new work, another instance takes over the jobs of
+	// the leader once this one is done
+	s.cancel()
+	defer s.leader.Close()
+
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		s.webhookService.WaitForDeliveries()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Info().Msg("Notification workers drained")
+		return nil
+	case <-ctx.Done():
+		requeued := s.requeueInFlight()
+		log.Warn().
+			Int("requeued", requeued).
+			Msg("Shutdown deadline reached, in-flight notifications requeued")
+		return fmt.Errorf("notification workers did not drain: %w", ctx.Err())
+	}
+}
+
+// requeueInFlight puts every queue member still being processed back on its queue
+func (s *NotificationService) requeueInFlight() int {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+
+	// The shutdown context has expired, so requeueing gets a deadline of its own
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	requeued := 0
+	score := float64(time.Now().Unix())
+	for member, queueKey := range s.inFlight {
+		err := s.redis.ZAdd(ctx, queueKey, &redis.Z{
+			Score:  score,
+			Member: member,
+		}).Err()
+		if err != nil {
+			log.Error().Err(err).Str("queue", queueKey).Msg("Failed to requeue in-flight notification")
+			continue
+		}
+		delete(s.inFlight, member)
+		requeued++
+	}
+
+	return requeued
+}
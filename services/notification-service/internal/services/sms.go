@@ -1,32 +1,70 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
+	"claude-talimat/pkg/runtimeconfig"
+)
+
+const (
+	twilioDefaultBaseURL = "https://api.twilio.com"
+	netgsmDefaultBaseURL = "https://api.netgsm.com.tr"
 )
 
 // SMSService handles SMS notifications
 type SMSService struct {
-	config SMSConfig
-	client *http.Client
+	config     SMSConfig
+	client     *http.Client
+	redis      *redis.Client
+	limiters   map[string]*smsRateLimiter // by provider
+	limitersMu sync.Mutex
+	// credentialsMu guards the credentials in config, replaced when they rotate
+	credentialsMu sync.RWMutex
 }
 
 // SMSConfig holds SMS service configuration
 type SMSConfig struct {
-	Provider   string
-	APIKey     string
-	APISecret  string
-	FromNumber string
-	BaseURL    string
-	MaxRetries int
-	RetryDelay time.Duration
-	RateLimit  int // messages per second
-	DryRun     bool
+	RedisURL      string
+	RedisPassword string
+	RedisDB       int
+	Provider      string // default provider, whose credentials follow
+	APIKey        string
+	APISecret     string
+	FromNumber    string
+	BaseURL       string
+	MaxRetries    int
+	RetryDelay    time.Duration
+	RateLimit     int // messages per second of the default provider, 0 for no limit
+	DryRun        bool
+	// MaxSegments limits how many segments a concatenated SMS may take
+	MaxSegments int
+	// SegmentCost is the price of a segment, for providers that don't report it
+	SegmentCost float64
+	// Providers holds the credentials of the providers tenants are routed to
+	Providers map[string]SMSProviderConfig
+	// TenantProviders routes the SMS of a tenant to another provider than
+	// the default one
+	TenantProviders map[string]string
+	// StatusCallbackURL is the public URL of the delivery report endpoints,
+	// providers post to StatusCallbackURL/<provider>
+	StatusCallbackURL string
+	// StatusCallbackToken authenticates the delivery reports of providers
+	// that don't sign them, it is passed as the token query parameter
+	StatusCallbackToken string
+	// Runtime overrides the rate limits of providers without a redeploy
+	Runtime *runtimeconfig.Store
 }
 
 // SMSMessage represents an SMS message
@@ -34,6 +72,7 @@ type SMSMessage struct {
 	To           string
 	From         string
 	Body         string
+	TenantID     string // selects the provider of the tenant
 	TemplateID   string
 	TemplateData map[string]interface{}
 	Priority     string // low, normal, high
@@ -49,15 +88,20 @@ type SMSResult struct {
 	SentAt           time.Time
 	Success          bool
 	Error            string
+	Encoding         string  // GSM-7 or UCS-2
+	Segments         int     // parts the message was sent in
+	Cost             float64 // reported by the provider or from the segment cost
+	Simulated        bool    // dry run, nothing was sent
 	ProviderResponse map[string]interface{}
 }
 
 // SMSProvider interface for different SMS providers
 type SMSProvider interface {
-	Send(message SMSMessage) (*SMSResult, error)
-	SendBulk(messages []SMSMessage) ([]*SMSResult, error)
-	GetStatus(messageID string) (*SMSResult, error)
-	GetBalance() (float64, error)
+	Capabilities() SMSCapabilities
+	Send(ctx context.Context, message SMSMessage) (*SMSResult, error)
+	SendBulk(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error)
+	GetStatus(ctx context.Context, messageID string) (*SMSResult, error)
+	GetBalance(ctx context.Context) (float64, error)
 }
 
 // TwilioProvider implements SMSProvider for Twilio
@@ -73,103 +117,150 @@ type NetgsmProvider struct {
 }
 
 // NewSMSService creates a new SMS service instance
-func NewSMSService(config SMSConfig) *SMSService {
+func NewSMSService(config SMSConfig) (*SMSService, error) {
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &SMSService{
 		config: config,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-	}
+		redis:    redisClient,
+		limiters: make(map[string]*smsRateLimiter),
+	}, nil
 }
 
 // SendSMS sends a single SMS
-func (s *SMSService) SendSMS(message SMSMessage) (*SMSResult, error) {
+func (s *SMSService) SendSMS(ctx context.Context, message SMSMessage) (*SMSResult, error) {
 	log.Info().
 		Str("to", message.To).
 		Str("body", truncateString(message.Body, 50)).
 		Msg("Sending SMS")
 
-	// Set default values
-	if message.From == "" {
-		message.From = s.config.FromNumber
-	}
-
-	// Validate message
-	if err := s.validateMessage(message); err != nil {
-		return nil, fmt.Errorf("message validation failed: %w", err)
+	// Route the message by the settings of its tenant
+	settings, err := s.GetTenantSettings(message.TenantID)
+	if err != nil {
+		return nil, err
 	}
-
-	// Get provider
-	provider, err := s.getProvider()
+	routes, err := s.getRoutes(settings, message)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get SMS provider: %w", err)
 	}
 
-	// Send with retries
-	var result *SMSResult
-	var lastErr error
-
-	for attempt := 0; attempt <= s.config.MaxRetries; attempt++ {
-		if attempt > 0 {
-			log.Info().Int("attempt", attempt).Msg("Retrying SMS send")
-			time.Sleep(s.config.RetryDelay * time.Duration(attempt))
-		}
-
-		result, lastErr = provider.Send(message)
-		if lastErr == nil {
-			break
-		}
+	// Validate message
+	if err := s.validateMessage(routes[0].prepare(message), routes[0].provider.Capabilities()); err != nil {
+		return nil, invalid(fmt.Errorf("message validation failed: %w", err))
+	}
 
-		log.Warn().
-			Int("attempt", attempt+1).
-			Err(lastErr).
-			Msg("SMS send attempt failed")
+	if s.config.DryRun {
+		return s.simulate(routes[0], message), nil
 	}
 
-	if lastErr != nil {
-		log.Error().Err(lastErr).Msg("All SMS send attempts failed")
+	result, err := s.sendRoutes(ctx, routes, message)
+	if err != nil {
+		log.Error().Err(err).Msg("All SMS send attempts failed")
 		return &SMSResult{
 			To:      message.To,
 			Status:  "failed",
 			Success: false,
-			Error:   lastErr.Error(),
-		}, lastErr
+			Error:   err.Error(),
+		}, err
 	}
 
 	log.Info().
 		Str("messageID", result.MessageID).
 		Str("to", result.To).
+		Int("segments", result.Segments).
 		Msg("SMS sent successfully")
 
 	return result, nil
 }
 
 // SendBulkSMS sends SMS messages to multiple recipients
-func (s *SMSService) SendBulkSMS(messages []SMSMessage) ([]*SMSResult, error) {
+func (s *SMSService) SendBulkSMS(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error) {
 	log.Info().Int("count", len(messages)).Msg("Sending bulk SMS")
 
 	if len(messages) == 0 {
 		return []*SMSResult{}, nil
 	}
 
-	// Validate all messages
+	// Group the messages by the provider they are routed to
+	settings := make(map[string]*SMSTenantSettings)
+	routes := make([][]*smsRoute, len(messages))
+	providers := make(map[string]SMSProvider)
+	batches := make(map[string][]int)
+	var order []string
 	for i, message := range messages {
-		if err := s.validateMessage(message); err != nil {
-			return nil, fmt.Errorf("message %d validation failed: %w", i, err)
+		tenantSettings, ok := settings[message.TenantID]
+		if !ok {
+			var err error
+			tenantSettings, err = s.GetTenantSettings(message.TenantID)
+			if err != nil {
+				return nil, err
+			}
+			settings[message.TenantID] = tenantSettings
+		}
+
+		messageRoutes, err := s.getRoutes(tenantSettings, message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get SMS provider: %w", err)
 		}
+		routes[i] = messageRoutes
+
+		primary := messageRoutes[0]
+		if err := s.validateMessage(primary.prepare(message), primary.provider.Capabilities()); err != nil {
+			return nil, invalid(fmt.Errorf("message %d validation failed: %w", i, err))
+		}
+
+		if _, ok := providers[primary.name]; !ok {
+			providers[primary.name] = primary.provider
+			order = append(order, primary.name)
+		}
+		batches[primary.name] = append(batches[primary.name], i)
 	}
 
-	// Get provider
-	provider, err := s.getProvider()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get SMS provider: %w", err)
+	if s.config.DryRun {
+		results := make([]*SMSResult, len(messages))
+		for i := range messages {
+			results[i] = s.simulate(routes[i][0], messages[i])
+		}
+		return results, nil
 	}
 
 	// Send bulk messages
-	results, err := provider.SendBulk(messages)
-	if err != nil {
-		log.Error().Err(err).Msg("Bulk SMS send failed")
-		return nil, err
+	results := make([]*SMSResult, len(messages))
+	for _, name := range order {
+		batch := make([]SMSMessage, len(batches[name]))
+		for j, i := range batches[name] {
+			batch[j] = routes[i][0].prepare(messages[i])
+		}
+
+		batchResults, err := providers[name].SendBulk(ctx, batch)
+		if err != nil {
+			log.Error().Err(err).Str("provider", name).Msg("Bulk SMS send failed")
+			return nil, err
+		}
+		for j, i := range batches[name] {
+			results[i] = batchResults[j]
+			if results[i].Success {
+				s.recordSegments(results[i], batch[j], name)
+				continue
+			}
+
+			// Try the fallback provider of the tenant
+			if len(routes[i]) > 1 {
+				if result, err := s.sendRoutes(ctx, routes[i][1:], messages[i]); err == nil {
+					results[i] = result
+				}
+			}
+		}
 	}
 
 	// Log results
@@ -192,29 +283,103 @@ func (s *SMSService) SendBulkSMS(messages []SMSMessage) ([]*SMSResult, error) {
 	return results, nil
 }
 
-// SendOTP sends an OTP SMS
-func (s *SMSService) SendOTP(phoneNumber string, otpCode string, templateID string) (*SMSResult, error) {
+// sendRoutes sends a message with the first of its routes that succeeds,
+// retrying each. Routes whose sender rules the message breaks are skipped.
+func (s *SMSService) sendRoutes(ctx context.Context, routes []*smsRoute, message SMSMessage) (*SMSResult, error) {
+	var lastErr error
+	for i, route := range routes {
+		routed := route.prepare(message)
+		if err := s.validateMessage(routed, route.provider.Capabilities()); err != nil {
+			log.Warn().Err(err).Str("provider", route.name).Msg("Skipping SMS provider")
+			lastErr = invalid(fmt.Errorf("message validation failed: %w", err))
+			continue
+		}
+		if i > 0 {
+			log.Warn().Str("provider", route.name).Msg("Falling back to SMS provider")
+		}
+
+		result, err := s.sendWithRetries(ctx, route.provider, routed)
+		if err == nil {
+			s.recordSegments(result, routed, route.name)
+			return result, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// simulate returns the result of a message that is not sent in dry run mode
+func (s *SMSService) simulate(route *smsRoute, message SMSMessage) *SMSResult {
+	message = route.prepare(message)
+
+	log.Info().
+		Str("to", message.To).
+		Str("provider", route.name).
+		Str("body", truncateString(message.Body, 50)).
+		Msg("SMS dry run, message not sent")
+
+	result := &SMSResult{
+		MessageID: generateMessageID(),
+		To:        message.To,
+		Status:    "sent",
+		SentAt:    time.Now(),
+		Success:   true,
+		Simulated: true,
+	}
+	s.recordSegments(result, message, route.name)
+	return result
+}
+
+// sendWithRetries sends a message with a provider, retrying failed attempts
+func (s *SMSService) sendWithRetries(ctx context.Context, provider SMSProvider, message SMSMessage) (*SMSResult, error) {
+	var result *SMSResult
+	var lastErr error
+
+	for attempt := 0; attempt <= s.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			log.Info().Int("attempt", attempt).Msg("Retrying SMS send")
+			select {
+			case <-ctx.Done():
+				return nil, lastErr
+			case <-time.After(s.config.RetryDelay * time.Duration(attempt)):
+			}
+		}
+
+		result, lastErr = provider.Send(ctx, message)
+		if lastErr == nil {
+			return result, nil
+		}
+
+		log.Warn().
+			Int("attempt", attempt+1).
+			Err(lastErr).
+			Msg("SMS send attempt failed")
+	}
+
+	return nil, lastErr
+}
+
+// SendOTP texts a one-time code. The message expires with the code, so a
+// provider holding it back doesn't deliver a code that no longer works.
+func (s *SMSService) SendOTP(ctx context.Context, phoneNumber string, body string, expiresAt time.Time, tenantID string) (*SMSResult, error) {
 	log.Info().
-		Str("phone", phoneNumber).
-		Str("template", templateID).
+		Str("tenantID", tenantID).
 		Msg("Sending OTP SMS")
 
 	message := SMSMessage{
-		To:         phoneNumber,
-		TemplateID: templateID,
-		TemplateData: map[string]interface{}{
-			"otp_code":   otpCode,
-			"expires_in": "5 dakika",
-		},
+		To:        phoneNumber,
+		Body:      body,
 		Priority:  "high",
-		ExpiresAt: &time.Time{}.Add(5 * time.Minute),
+		TenantID:  tenantID,
+		ExpiresAt: &expiresAt,
 	}
 
-	return s.SendSMS(message)
+	return s.SendSMS(ctx, message)
 }
 
 // SendWelcomeSMS sends a welcome SMS to new users
-func (s *SMSService) SendWelcomeSMS(phoneNumber string, userName string, companyName string) (*SMSResult, error) {
+func (s *SMSService) SendWelcomeSMS(ctx context.Context, phoneNumber string, userName string, companyName string) (*SMSResult, error) {
 	message := SMSMessage{
 		To:         phoneNumber,
 		TemplateID: "welcome",
@@ -225,11 +390,11 @@ func (s *SMSService) SendWelcomeSMS(phoneNumber string, userName string, company
 		Priority: "normal",
 	}
 
-	return s.SendSMS(message)
+	return s.SendSMS(ctx, message)
 }
 
 // SendAlertSMS sends an alert SMS
-func (s *SMSService) SendAlertSMS(phoneNumber string, alertType string, description string, severity string) (*SMSResult, error) {
+func (s *SMSService) SendAlertSMS(ctx context.Context, phoneNumber string, alertType string, description string, severity string) (*SMSResult, error) {
 	message := SMSMessage{
 		To:         phoneNumber,
 		TemplateID: "alert",
@@ -242,11 +407,11 @@ func (s *SMSService) SendAlertSMS(phoneNumber string, alertType string, descript
 		Priority: "high",
 	}
 
-	return s.SendSMS(message)
+	return s.SendSMS(ctx, message)
 }
 
 // SendReminderSMS sends a reminder SMS
-func (s *SMSService) SendReminderSMS(phoneNumber string, reminderType string, dueDate string, actionRequired string) (*SMSResult, error) {
+func (s *SMSService) SendReminderSMS(ctx context.Context, phoneNumber string, reminderType string, dueDate string, actionRequired string) (*SMSResult, error) {
 	message := SMSMessage{
 		To:         phoneNumber,
 		TemplateID: "reminder",
@@ -258,19 +423,27 @@ func (s *SMSService) SendReminderSMS(phoneNumber string, reminderType string, du
 		Priority: "normal",
 	}
 
-	return s.SendSMS(message)
+	return s.SendSMS(ctx, message)
 }
 
-// GetSMSStatus gets the status of a sent SMS
-func (s *SMSService) GetSMSStatus(messageID string) (*SMSResult, error) {
+// GetSMSStatus gets the status of an SMS sent with the preferred provider of
+// a tenant
+func (s *SMSService) GetSMSStatus(ctx context.Context, tenantID string, messageID string) (*SMSResult, error) {
 	log.Info().Str("messageID", messageID).Msg("Getting SMS status")
 
-	provider, err := s.getProvider()
+	settings, err := s.GetTenantSettings(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	route, err := s.getProvider(settings, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get SMS provider: %w", err)
 	}
+	if !route.provider.Capabilities().StatusQueries {
+		return nil, invalid(fmt.Errorf("SMS provider %s doesn't support status queries", route.name))
+	}
 
-	result, err := provider.GetStatus(messageID)
+	result, err := route.provider.GetStatus(ctx, messageID)
 	if err != nil {
 		log.Error().Err(err).Str("messageID", messageID).Msg("Failed to get SMS status")
 		return nil, err
@@ -279,16 +452,23 @@ func (s *SMSService) GetSMSStatus(messageID string) (*SMSResult, error) {
 	return result, nil
 }
 
-// GetBalance gets the SMS account balance
-func (s *SMSService) GetBalance() (float64, error) {
+// GetBalance gets the balance of the SMS account of a tenant's preferred provider
+func (s *SMSService) GetBalance(ctx context.Context, tenantID string) (float64, error) {
 	log.Info().Msg("Getting SMS account balance")
 
-	provider, err := s.getProvider()
+	settings, err := s.GetTenantSettings(tenantID)
+	if err != nil {
+		return 0, err
+	}
+	route, err := s.getProvider(settings, "")
 	if err != nil {
 		return 0, fmt.Errorf("failed to get SMS provider: %w", err)
 	}
+	if !route.provider.Capabilities().Balance {
+		return 0, invalid(fmt.Errorf("SMS provider %s doesn't support balance queries", route.name))
+	}
 
-	balance, err := provider.GetBalance()
+	balance, err := route.provider.GetBalance(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get SMS balance")
 		return 0, err
@@ -308,7 +488,7 @@ func (s *SMSService) TestConnection() error {
 		Body: "Bu bir test mesajıdır. SMS servisi başarıyla çalışıyor.",
 	}
 
-	_, err := s.SendSMS(testMessage)
+	_, err := s.SendSMS(context.Background(), testMessage)
 	if err != nil {
 		log.Error().Err(err).Msg("SMS service connection test failed")
 		return fmt.Errorf("connection test failed: %w", err)
@@ -318,8 +498,8 @@ func (s *SMSService) TestConnection() error {
 	return nil
 }
 
-// validateMessage validates an SMS message
-func (s *SMSService) validateMessage(message SMSMessage) error {
+// validateMessage validates an SMS message against the rules of its provider
+func (s *SMSService) validateMessage(message SMSMessage, capabilities SMSCapabilities) error {
 	if message.To == "" {
 		return fmt.Errorf("recipient phone number is required")
 	}
@@ -328,8 +508,13 @@ func (s *SMSService) validateMessage(message SMSMessage) error {
 		return fmt.Errorf("message body or template ID is required")
 	}
 
-	if message.Body != "" && len(message.Body) > 160 {
-		return fmt.Errorf("message body exceeds 160 characters")
+	maxSegments := s.config.MaxSegments
+	if maxSegments <= 0 {
+		maxSegments = smsDefaultMaxSegments
+	}
+	if segmentation := segmentSMS(message.Body); segmentation.Segments > maxSegments {
+		return fmt.Errorf("message body takes %d %s segments, at most %d are allowed",
+			segmentation.Segments, segmentation.Encoding, maxSegments)
 	}
 
 	// Validate phone number format (basic validation)
@@ -337,40 +522,37 @@ func (s *SMSService) validateMessage(message SMSMessage) error {
 		return fmt.Errorf("invalid phone number format: %s", message.To)
 	}
 
-	return nil
+	if !capabilities.Unicode && !isGSM7(message.Body) {
+		return fmt.Errorf("message body has characters the SMS provider can't send")
+	}
+
+	return validateSender(message.From, capabilities)
 }
 
-// getProvider returns the appropriate SMS provider
-func (s *SMSService) getProvider() (SMSProvider, error) {
-	switch strings.ToLower(s.config.Provider) {
-	case "twilio":
-		return &TwilioProvider{
-			config: s.config,
-			client: s.client,
-		}, nil
-	case "netgsm":
-		return &NetgsmProvider{
-			config: s.config,
-			client: s.client,
-		}, nil
-	default:
-		return nil, fmt.Errorf("unsupported SMS provider: %s", s.config.Provider)
+// TwilioProvider implementation. APIKey holds the account SID, APISecret its auth token.
+func (p *TwilioProvider) Capabilities() SMSCapabilities {
+	return SMSCapabilities{
+		StatusQueries: true,
+		Balance:       true,
+		Unicode:       true,
 	}
 }
 
-// TwilioProvider implementation
-func (p *TwilioProvider) Send(message SMSMessage) (*SMSResult, error) {
+func (p *TwilioProvider) Send(ctx context.Context, message SMSMessage) (*SMSResult, error) {
 	// Twilio API endpoint
-	url := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", p.config.BaseURL, p.config.APISecret)
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", smsBaseURL(p.config, twilioDefaultBaseURL), p.config.APIKey)
 
 	// Prepare form data
 	formData := url.Values{}
-	formData.Set("To", message.To)
+	formData.Set("To", "+"+e164Digits(message.To))
 	formData.Set("From", message.From)
 	formData.Set("Body", message.Body)
+	if callbackURL := p.statusCallbackURL(); callbackURL != "" {
+		formData.Set("StatusCallback", callbackURL)
+	}
 
 	// Make request
-	resp, err := p.client.PostForm(url, formData)
+	resp, err := p.do(ctx, http.MethodPost, endpoint, formData)
 	if err != nil {
 		return nil, fmt.Errorf("Twilio API request failed: %w", err)
 	}
@@ -407,29 +589,14 @@ func (p *TwilioProvider) Send(message SMSMessage) (*SMSResult, error) {
 	}, nil
 }
 
-func (p *TwilioProvider) SendBulk(messages []SMSMessage) ([]*SMSResult, error) {
-	var results []*SMSResult
-
-	for _, message := range messages {
-		result, err := p.Send(message)
-		if err != nil {
-			result = &SMSResult{
-				To:      message.To,
-				Status:  "failed",
-				Success: false,
-				Error:   err.Error(),
-			}
-		}
-		results = append(results, result)
-	}
-
-	return results, nil
+func (p *TwilioProvider) SendBulk(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error) {
+	return sendEach(ctx, p, messages), nil
 }
 
-func (p *TwilioProvider) GetStatus(messageID string) (*SMSResult, error) {
-	url := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages/%s.json", p.config.BaseURL, p.config.APISecret, messageID)
+func (p *TwilioProvider) GetStatus(ctx context.Context, messageID string) (*SMSResult, error) {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages/%s.json", smsBaseURL(p.config, twilioDefaultBaseURL), p.config.APIKey, messageID)
 
-	resp, err := p.client.Get(url)
+	resp, err := p.do(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Twilio API request failed: %w", err)
 	}
@@ -453,10 +620,10 @@ func (p *TwilioProvider) GetStatus(messageID string) (*SMSResult, error) {
 	}, nil
 }
 
-func (p *TwilioProvider) GetBalance() (float64, error) {
-	url := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Balance.json", p.config.BaseURL, p.config.APISecret)
+func (p *TwilioProvider) GetBalance(ctx context.Context) (float64, error) {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Balance.json", smsBaseURL(p.config, twilioDefaultBaseURL), p.config.APIKey)
 
-	resp, err := p.client.Get(url)
+	resp, err := p.do(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return 0, fmt.Errorf("Twilio API request failed: %w", err)
 	}
@@ -477,10 +644,39 @@ func (p *TwilioProvider) GetBalance() (float64, error) {
 	return balance, nil
 }
 
+// do sends a request authenticated with the account SID and auth token
+func (p *TwilioProvider) do(ctx context.Context, method string, endpoint string, form url.Values) (*http.Response, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.config.APIKey, p.config.APISecret)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return p.client.Do(req)
+}
+
 // NetgsmProvider implementation
-func (p *NetgsmProvider) Send(message SMSMessage) (*SMSResult, error) {
+func (p *NetgsmProvider) Capabilities() SMSCapabilities {
+	return SMSCapabilities{
+		StatusQueries:      false,
+		Balance:            true,
+		Unicode:            true,
+		AlphanumericSender: true,
+		RegisteredSender:   true,
+	}
+}
+
+func (p *NetgsmProvider) Send(ctx context.Context, message SMSMessage) (*SMSResult, error) {
 	// Netgsm API endpoint
-	url := fmt.Sprintf("%s/sms/send/get", p.config.BaseURL)
+	endpoint := fmt.Sprintf("%s/sms/send/get", smsBaseURL(p.config, netgsmDefaultBaseURL))
 
 	// Prepare query parameters
 	params := url.Values{}
@@ -492,17 +688,18 @@ func (p *NetgsmProvider) Send(message SMSMessage) (*SMSResult, error) {
 	params.Set("dil", "TR")
 
 	// Make request
-	resp, err := p.client.Get(fmt.Sprintf("%s?%s", url, params.Encode()))
+	resp, err := p.get(ctx, fmt.Sprintf("%s?%s", endpoint, params.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("Netgsm API request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Parse response
-	var response string
-	if _, err := fmt.Fscanf(resp.Body, "%s", &response); err != nil {
+	// Parse response, "00 <job ID>" on success
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
 		return nil, fmt.Errorf("failed to read Netgsm response: %w", err)
 	}
+	response := strings.TrimSpace(string(body))
 
 	// Check response code
 	if !strings.HasPrefix(response, "00") {
@@ -510,7 +707,7 @@ func (p *NetgsmProvider) Send(message SMSMessage) (*SMSResult, error) {
 	}
 
 	// Extract message ID
-	parts := strings.Split(response, " ")
+	parts := strings.Fields(response)
 	messageID := ""
 	if len(parts) > 1 {
 		messageID = parts[1]
@@ -526,26 +723,11 @@ func (p *NetgsmProvider) Send(message SMSMessage) (*SMSResult, error) {
 	}, nil
 }
 
-func (p *NetgsmProvider) SendBulk(messages []SMSMessage) ([]*SMSResult, error) {
-	var results []*SMSResult
-
-	for _, message := range messages {
-		result, err := p.Send(message)
-		if err != nil {
-			result = &SMSResult{
-				To:      message.To,
-				Status:  "failed",
-				Success: false,
-				Error:   err.Error(),
-			}
-		}
-		results = append(results, result)
-	}
-
-	return results, nil
+func (p *NetgsmProvider) SendBulk(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error) {
+	return sendEach(ctx, p, messages), nil
 }
 
-func (p *NetgsmProvider) GetStatus(messageID string) (*SMSResult, error) {
+func (p *NetgsmProvider) GetStatus(ctx context.Context, messageID string) (*SMSResult, error) {
 	// Netgsm doesn't provide detailed status, return basic info
 	return &SMSResult{
 		MessageID: messageID,
@@ -555,14 +737,14 @@ func (p *NetgsmProvider) GetStatus(messageID string) (*SMSResult, error) {
 	}, nil
 }
 
-func (p *NetgsmProvider) GetBalance() (float64, error) {
-	url := fmt.Sprintf("%s/balance/list", p.config.BaseURL)
+func (p *NetgsmProvider) GetBalance(ctx context.Context) (float64, error) {
+	endpoint := fmt.Sprintf("%s/balance/list", smsBaseURL(p.config, netgsmDefaultBaseURL))
 
 	params := url.Values{}
 	params.Set("usercode", p.config.APIKey)
 	params.Set("password", p.config.APISecret)
 
-	resp, err := p.client.Get(fmt.Sprintf("%s?%s", url, params.Encode()))
+	resp, err := p.get(ctx, fmt.Sprintf("%s?%s", endpoint, params.Encode()))
 	if err != nil {
 		return 0, fmt.Errorf("Netgsm API request failed: %w", err)
 	}
@@ -582,6 +764,26 @@ func (p *NetgsmProvider) GetBalance() (float64, error) {
 	return balance, nil
 }
 
+// get sends a request to the Netgsm API, the credentials are in its query
+func (p *NetgsmProvider) get(ctx context.Context, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.client.Do(req)
+}
+
+// recordSegments reports the encoding and segments of a sent message, and
+// their cost when the provider didn't report it
+func (s *SMSService) recordSegments(result *SMSResult, message SMSMessage, providerName string) {
+	segmentation := segmentSMS(message.Body)
+	result.Encoding = segmentation.Encoding
+	result.Segments = segmentation.Segments
+	if result.Cost == 0 {
+		result.Cost = float64(segmentation.Segments) * s.providerConfig(providerName).SegmentCost
+	}
+}
+
 // Helper functions
 func isValidPhoneNumber(phone string) bool {
 	// Basic phone number validation
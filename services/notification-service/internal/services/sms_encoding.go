@@ -0,0 +1,99 @@
+package services
+
+import "strings"
+
+// SMS encodings
+const (
+	SMSEncodingGSM7 = "GSM-7"
+	SMSEncodingUCS2 = "UCS-2"
+)
+
+// Characters fitting a single SMS, and a segment of a concatenated SMS whose
+// user data header takes the rest
+const (
+	gsm7SingleLimit  = 160
+	gsm7SegmentLimit = 153
+	ucs2SingleLimit  = 70
+	ucs2SegmentLimit = 67
+)
+
+// smsDefaultMaxSegments limits concatenated SMS when no limit is configured
+const smsDefaultMaxSegments = 6
+
+// gsm7Basic is the GSM 03.38 default alphabet
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension holds the characters sent with an escape, as two septets
+const gsm7Extension = "^{}\\[~]|€\f"
+
+// SMSSegmentation tells how a text is encoded and split into SMS segments
+type SMSSegmentation struct {
+	Encoding string
+	Length   int // septets in GSM-7, UTF-16 code units in UCS-2
+	Segments int
+}
+
+// isGSM7 tells whether a text can be sent in the GSM-7 alphabet. Texts with
+// other characters, such as the Turkish ş, ğ and ı, need UCS-2.
+func isGSM7(text string) bool {
+	for _, r := range text {
+		if !strings.ContainsRune(gsm7Basic, r) && !strings.ContainsRune(gsm7Extension, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentSMS calculates the encoding of a text and the segments it is sent in.
+// A single character outside GSM-7 makes the whole text UCS-2.
+func segmentSMS(text string) SMSSegmentation {
+	segmentation := SMSSegmentation{Encoding: SMSEncodingGSM7}
+	single, segment, width := gsm7SingleLimit, gsm7SegmentLimit, gsm7Width
+	if !isGSM7(text) {
+		segmentation.Encoding = SMSEncodingUCS2
+		single, segment, width = ucs2SingleLimit, ucs2SegmentLimit, ucs2Width
+	}
+
+	for _, r := range text {
+		segmentation.Length += width(r)
+	}
+
+	switch {
+	case segmentation.Length == 0:
+		return segmentation
+	case segmentation.Length <= single:
+		segmentation.Segments = 1
+		return segmentation
+	}
+
+	// Escaped characters and surrogate pairs are never split between segments
+	segmentation.Segments = 1
+	used := 0
+	for _, r := range text {
+		w := width(r)
+		if used+w > segment {
+			segmentation.Segments++
+			used = 0
+		}
+		used += w
+	}
+
+	return segmentation
+}
+
+// gsm7Width returns the septets a GSM-7 character takes
+func gsm7Width(r rune) int {
+	if strings.ContainsRune(gsm7Extension, r) {
+		return 2
+	}
+	return 1
+}
+
+// ucs2Width returns the UTF-16 code units a character takes
+func ucs2Width(r rune) int {
+	if r > 0xFFFF {
+		return 2
+	}
+	return 1
+}
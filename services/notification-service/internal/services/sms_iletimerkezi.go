@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const iletiMerkeziDefaultBaseURL = "https://api.iletimerkezi.com"
+
+// İleti Merkezi report statuses of a single message
+var iletiMerkeziStatuses = map[string]string{
+	"110": "queued",
+	"111": "delivered",
+	"112": "failed",
+}
+
+// IletiMerkeziProvider implements SMSProvider for the İleti Merkezi JSON API
+type IletiMerkeziProvider struct {
+	config SMSConfig
+	client *http.Client
+}
+
+// iletiMerkeziResponse is the response envelope of the İleti Merkezi API
+type iletiMerkeziResponse struct {
+	Response struct {
+		Status struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"status"`
+		Order struct {
+			ID      string `json:"id"`
+			Message []struct {
+				Number string `json:"number"`
+				Status string `json:"status"`
+			} `json:"message"`
+		} `json:"order"`
+		Balance struct {
+			Amount string `json:"amount"`
+			SMS    string `json:"sms"`
+		} `json:"balance"`
+	} `json:"response"`
+}
+
+func (p *IletiMerkeziProvider) Capabilities() SMSCapabilities {
+	return SMSCapabilities{
+		StatusQueries:      true,
+		Balance:            true,
+		Unicode:            true,
+		AlphanumericSender: true,
+		// Senders must be registered headers of the account
+		RegisteredSender: true,
+	}
+}
+
+func (p *IletiMerkeziProvider) Send(ctx context.Context, message SMSMessage) (*SMSResult, error) {
+	result, err := p.do(ctx, "/v1/send-sms/json", map[string]interface{}{
+		"sender":       message.From,
+		"sendDateTime": []string{},
+		// Informational messages need no İYS consent
+		"iys": "0",
+		"message": map[string]interface{}{
+			"text": message.Body,
+			"receipents": map[string]interface{}{
+				"number": []string{e164Digits(message.To)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMSResult{
+		MessageID:        result.Response.Order.ID,
+		To:               message.To,
+		Status:           "sent",
+		SentAt:           time.Now(),
+		Success:          true,
+		ProviderResponse: map[string]interface{}{"order_id": result.Response.Order.ID},
+	}, nil
+}
+
+func (p *IletiMerkeziProvider) SendBulk(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error) {
+	return sendEach(ctx, p, messages), nil
+}
+
+func (p *IletiMerkeziProvider) GetStatus(ctx context.Context, messageID string) (*SMSResult, error) {
+	result, err := p.do(ctx, "/v1/get-report/json", map[string]interface{}{
+		"id":       messageID,
+		"page":     1,
+		"rowCount": 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := "unknown"
+	if len(result.Response.Order.Message) > 0 {
+		if mapped, ok := iletiMerkeziStatuses[result.Response.Order.Message[0].Status]; ok {
+			status = mapped
+		}
+	}
+
+	return &SMSResult{
+		MessageID:        messageID,
+		Status:           status,
+		Success:          status == "delivered",
+		ProviderResponse: map[string]interface{}{"status": status},
+	}, nil
+}
+
+func (p *IletiMerkeziProvider) GetBalance(ctx context.Context) (float64, error) {
+	result, err := p.do(ctx, "/v1/get-balance/json", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseFloat(result.Response.Balance.Amount)
+}
+
+// do posts an authenticated request and checks the status of its response
+func (p *IletiMerkeziProvider) do(ctx context.Context, path string, order map[string]interface{}) (*iletiMerkeziResponse, error) {
+	request := map[string]interface{}{
+		"authentication": map[string]string{
+			"key":  p.config.APIKey,
+			"hash": iletiMerkeziHash(p.config.APIKey, p.config.APISecret),
+		},
+	}
+	if order != nil {
+		request["order"] = order
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"request": request})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal İleti Merkezi request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, smsBaseURL(p.config, iletiMerkeziDefaultBaseURL)+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create İleti Merkezi request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("İleti Merkezi API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result iletiMerkeziResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode İleti Merkezi response: %w", err)
+	}
+
+	if result.Response.Status.Code != "200" {
+		return nil, fmt.Errorf("İleti Merkezi API error %s: %s", result.Response.Status.Code, result.Response.Status.Message)
+	}
+
+	return &result, nil
+}
+
+// iletiMerkeziHash signs the API key with the secret, as the API authenticates
+func iletiMerkeziHash(key string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// iletiMerkeziRequest is the request envelope of the İleti Merkezi API
+type iletiMerkeziRequest struct {
+	Request struct {
+		Authentication struct {
+			Key  string `json:"key"`
+			Hash string `json:"hash"`
+		} `json:"authentication"`
+		Order map[string]interface{} `json:"order"`
+	} `json:"request"`
+}
+
+// iletiMerkeziServer is a mock of the İleti Merkezi API answering with
+// response, recording the requests it receives
+type iletiMerkeziServer struct {
+	*httptest.Server
+	paths    []string
+	requests []iletiMerkeziRequest
+	response string
+}
+
+func newIletiMerkeziServer(t *testing.T) *iletiMerkeziServer {
+	server := &iletiMerkeziServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request iletiMerkeziRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if request.Request.Authentication.Key != "ileti-key" || request.Request.Authentication.Hash != iletiMerkeziHash("ileti-key", "ileti-secret") {
+			t.Errorf("Expected the key signed with the secret, got %+v", request.Request.Authentication)
+		}
+
+		server.paths = append(server.paths, r.Method+" "+r.URL.Path)
+		server.requests = append(server.requests, request)
+		w.Write([]byte(server.response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newIletiMerkeziTestProvider(server *iletiMerkeziServer) *IletiMerkeziProvider {
+	return &IletiMerkeziProvider{
+		config: SMSConfig{APIKey: "ileti-key", APISecret: "ileti-secret", BaseURL: server.URL},
+		client: server.Client(),
+	}
+}
+
+func TestIletiMerkeziSendsOrders(t *testing.T) {
+	server := newIletiMerkeziServer(t)
+	server.response = `{"response":{"status":{"code":"200","message":"İşlem başarılı"},"order":{"id":"order-1"}}}`
+
+	result, err := newIletiMerkeziTestProvider(server).Send(context.Background(), SMSMessage{To: "05321234567", From: "TALIMAT", Body: "Baretinizi takmayı unutmayın"})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.MessageID != "order-1" || !result.Success {
+		t.Errorf("Expected the order to identify the send, got %+v", result)
+	}
+
+	if server.paths[0] != "POST /v1/send-sms/json" {
+		t.Errorf("Expected an SMS order, got %s", server.paths[0])
+	}
+	order := server.requests[0].Request.Order
+	message, _ := order["message"].(map[string]interface{})
+	receipents, _ := message["receipents"].(map[string]interface{})
+	numbers, _ := receipents["number"].([]interface{})
+	if order["sender"] != "TALIMAT" || order["iys"] != "0" || len(numbers) != 1 || numbers[0] != "905321234567" {
+		t.Errorf("Expected the sender and the number in digits, got %v", order)
+	}
+	if message["text"] != "Baretinizi takmayı unutmayın" {
+		t.Errorf("Expected the text of the message, got %v", message["text"])
+	}
+}
+
+func TestIletiMerkeziErrorsAreReported(t *testing.T) {
+	for name, test := range map[string]struct {
+		response string
+		expected string
+	}{
+		"rejected credentials": {`{"response":{"status":{"code":"401","message":"Üyelik bilgileri hatalı"}}}`, "İleti Merkezi API error 401: Üyelik bilgileri hatalı"},
+		"unknown sender":       {`{"response":{"status":{"code":"452","message":"Gönderici adı hatalı"}}}`, "error 452"},
+		"not JSON":             {`<html>Service Unavailable</html>`, "failed to decode İleti Merkezi response"},
+	} {
+		server := newIletiMerkeziServer(t)
+		server.response = test.response
+
+		_, err := newIletiMerkeziTestProvider(server).Send(context.Background(), SMSMessage{To: "905321234567", From: "TALIMAT", Body: "Tatbikat"})
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", name, test.expected, err)
+		}
+	}
+}
+
+func TestIletiMerkeziReportStatusesAreMapped(t *testing.T) {
+	for code, expected := range map[string]string{
+		"110": "queued",
+		"111": "delivered",
+		"112": "failed",
+		"999": "unknown",
+	} {
+		server := newIletiMerkeziServer(t)
+		server.response = `{"response":{"status":{"code":"200"},"order":{"id":"order-1","message":[{"number":"905321234567","status":"` + code + `"}]}}}`
+
+		result, err := newIletiMerkeziTestProvider(server).GetStatus(context.Background(), "order-1")
+		if err != nil {
+			t.Fatalf("Failed to get status: %v", err)
+		}
+		if result.Status != expected || result.Success != (expected == "delivered") {
+			t.Errorf("Expected report status %s to be %s, got %s", code, expected, result.Status)
+		}
+		if server.paths[0] != "POST /v1/get-report/json" || server.requests[0].Request.Order["id"] != "order-1" {
+			t.Errorf("Expected the report of the order, got %s %v", server.paths[0], server.requests[0].Request.Order)
+		}
+	}
+
+	server := newIletiMerkeziServer(t)
+	server.response = `{"response":{"status":{"code":"200"},"balance":{"amount":"150.75","sms":"3015"}}}`
+	if balance, err := newIletiMerkeziTestProvider(server).GetBalance(context.Background()); err != nil || balance != 150.75 {
+		t.Errorf("Expected a balance of 150.75, got %v %v", balance, err)
+	}
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Actions an SMS reply takes on the notification it answers
+const (
+	SMSReplyAcknowledge = "acknowledge"
+	SMSReplyOptOut      = "opt_out"
+	SMSReplyEscalate    = "escalate"
+	SMSReplyIgnored     = "ignored"
+)
+
+var smsReplyActions = map[string]bool{
+	SMSReplyAcknowledge: true,
+	SMSReplyOptOut:      true,
+	SMSReplyEscalate:    true,
+}
+
+// defaultSMSKeywords are the reply keywords every tenant understands, the
+// acknowledgment keyword of the configuration is added to them
+var defaultSMSKeywords = map[string]string{
+	"OK":     SMSReplyAcknowledge,
+	"TAMAM":  SMSReplyAcknowledge,
+	"STOP":   SMSReplyOptOut,
+	"DUR":    SMSReplyOptOut,
+	"IPTAL":  SMSReplyOptOut,
+	"İPTAL":  SMSReplyOptOut,
+	"HELP":   SMSReplyEscalate,
+	"YARDIM": SMSReplyEscalate,
+	"YARDİM": SMSReplyEscalate,
+	"ACIL":   SMSReplyEscalate,
+	"ACİL":   SMSReplyEscalate,
+}
+
+// SMSInboundMessage is a message a recipient sent to one of our numbers
+type SMSInboundMessage struct {
+	MessageID string `json:"message_id,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+	Body      string `json:"body"`
+}
+
+// SMSInboundReceiver is implemented by providers that forward the messages
+// recipients send to the inbound endpoint
+type SMSInboundReceiver interface {
+	ParseInboundMessage(callback SMSCallback) (*SMSInboundMessage, error)
+}
+
+// SMSReplyOutcome is what an inbound reply did
+type SMSReplyOutcome struct {
+	Action         string          `json:"action"`
+	Keyword        string          `json:"keyword,omitempty"`
+	TenantID       string          `json:"tenant_id,omitempty"`
+	ResultID       string          `json:"result_id,omitempty"`
+	RequestID      string          `json:"request_id,omitempty"`
+	Acknowledgment *Acknowledgment `json:"acknowledgment,omitempty"`
+}
+
+// ParseInboundMessage verifies and parses an inbound message forwarded by a provider
+func (s *SMSService) ParseInboundMessage(providerName string, callback SMSCallback) (*SMSInboundMessage, error) {
+	provider, err := s.providerByName(providerName)
+	if err != nil {
+		return nil, notFoundf("%v", err)
+	}
+
+	receiver, ok := provider.(SMSInboundReceiver)
+	if !ok {
+		return nil, notFoundf("SMS provider %s doesn't forward inbound messages", providerName)
+	}
+
+	message, err := receiver.ParseInboundMessage(callback)
+	if err != nil {
+		return nil, err
+	}
+	if message.From == "" {
+		return nil, invalid(fmt.Errorf("inbound message has no sender"))
+	}
+
+	return message, nil
+}
+
+// ReceiveSMSReply applies a reply to the notification last sent to its sender.
+// The first word of the reply is looked up in the keywords of the tenant of
+// that notification; replies without a keyword are ignored.
+func (s *NotificationService) ReceiveSMSReply(reply SMSInboundMessage) (*SMSReplyOutcome, error) {
+	phone := phoneDigits(reply.From)
+	if phone == "" {
+		return nil, invalid(fmt.Errorf("invalid sender: %s", reply.From))
+	}
+
+	result, err := s.lastSMSResult(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := &SMSReplyOutcome{Action: SMSReplyIgnored}
+	if result != nil {
+		outcome.TenantID = result.TenantID
+		outcome.ResultID = result.ID
+		outcome.RequestID = result.RequestID
+	}
+
+	settings, err := s.smsService.GetTenantSettings(outcome.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(normalizeKeyword(reply.Body))
+	if len(words) > 0 {
+		if action, ok := s.smsKeywords(settings)[words[0]]; ok {
+			outcome.Action = action
+			outcome.Keyword = words[0]
+		}
+	}
+
+	log.Info().
+		Str("tenantID", outcome.TenantID).
+		Str("resultID", outcome.ResultID).
+		Str("action", outcome.Action).
+		Msg("SMS reply received")
+
+	switch outcome.Action {
+	case SMSReplyAcknowledge:
+		ack, err := s.acknowledgeSMSReply(phone, words[1:])
+		if err != nil {
+			return nil, err
+		}
+		outcome.Acknowledgment = ack
+	case SMSReplyOptOut:
+		if err := s.smsService.OptOut(outcome.TenantID, phone); err != nil {
+			return nil, err
+		}
+		s.applySMSReply(result, "opted_out_at")
+		s.publishSMSReply("sms.opted_out", "normal", reply, outcome)
+	case SMSReplyEscalate:
+		if result == nil {
+			return nil, notFoundf("no notification sent to sender")
+		}
+		s.applySMSReply(result, "escalated_at")
+		s.publishSMSReply("notification.escalated", "high", reply, outcome)
+	}
+
+	return outcome, nil
+}
+
+// smsKeywords returns the reply keywords of a tenant, its own keywords
+// override the defaults
+func (s *NotificationService) smsKeywords(settings *SMSTenantSettings) map[string]string {
+	keywords := make(map[string]string, len(defaultSMSKeywords)+len(settings.Keywords)+1)
+	for keyword, action := range defaultSMSKeywords {
+		keywords[keyword] = action
+	}
+	if s.config.AckSMSKeyword != "" {
+		keywords[normalizeKeyword(s.config.AckSMSKeyword)] = SMSReplyAcknowledge
+	}
+	for keyword, action := range settings.Keywords {
+		keywords[keyword] = action
+	}
+	return keywords
+}
+
+// lastSMSResult returns the result of the latest SMS sent to a number, nil
+// when none was sent lately
+func (s *NotificationService) lastSMSResult(phone string) (*NotificationResult, error) {
+	ctx := context.Background()
+	resultID, err := s.redis.Get(ctx, s.getLastSMSResultKey(phone)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up notification: %w", err)
+	}
+
+	result, err := s.GetNotificationStatus(ctx, resultID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	return result, nil
+}
+
+// applySMSReply stamps the result a reply answered with the time of the reply
+func (s *NotificationService) applySMSReply(result *NotificationResult, field string) {
+	if result == nil {
+		return
+	}
+
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata[field] = time.Now()
+
+	if err := s.storeResult(*result); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to record SMS reply")
+	}
+}
+
+// publishSMSReply tells subscribers what a reply asked for
+func (s *NotificationService) publishSMSReply(eventType string, priority string, reply SMSInboundMessage, outcome *SMSReplyOutcome) {
+	now := time.Now()
+	event := WebhookEvent{
+		ID:       generateWebhookID(),
+		Type:     eventType,
+		Source:   "notification-service",
+		TenantID: outcome.TenantID,
+		Data: map[string]interface{}{
+			"request_id": outcome.RequestID,
+			"result_id":  outcome.ResultID,
+			"from":       reply.From,
+			"keyword":    outcome.Keyword,
+			"body":       reply.Body,
+		},
+		Timestamp: now,
+		Priority:  priority,
+		CreatedAt: now,
+	}
+	s.emitEvent(event)
+}
+
+// OptOut stops SMS of a tenant to a number
+func (s *SMSService) OptOut(tenantID string, phone string) error {
+	if err := s.redis.SAdd(context.Background(), s.getOptOutKey(tenantID), phoneDigits(phone)).Err(); err != nil {
+		return fmt.Errorf("failed to record SMS opt-out: %w", err)
+	}
+	return nil
+}
+
+// OptIn lets SMS of a tenant reach a number that opted out again
+func (s *SMSService) OptIn(tenantID string, phone string) error {
+	if err := s.redis.SRem(context.Background(), s.getOptOutKey(tenantID), phoneDigits(phone)).Err(); err != nil {
+		return fmt.Errorf("failed to remove SMS opt-out: %w", err)
+	}
+	return nil
+}
+
+// GetOptOuts returns the numbers that opted out of the SMS of a tenant
+func (s *SMSService) GetOptOuts(tenantID string) ([]string, error) {
+	phones, err := s.redis.SMembers(context.Background(), s.getOptOutKey(tenantID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SMS opt-outs: %w", err)
+	}
+	return phones, nil
+}
+
+// IsOptedOut reports whether a number opted out of the SMS of a tenant. When
+// that can't be told the number is treated as subscribed.
+func (s *SMSService) IsOptedOut(tenantID string, phone string) bool {
+	optedOut, err := s.redis.SIsMember(context.Background(), s.getOptOutKey(tenantID), phoneDigits(phone)).Result()
+	if err != nil {
+		log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to check SMS opt-out")
+		return false
+	}
+	return optedOut
+}
+
+// ParseInboundMessage parses a message Twilio forwards to the messaging
+// webhook of a number, verifying its X-Twilio-Signature
+func (p *TwilioProvider) ParseInboundMessage(callback SMSCallback) (*SMSInboundMessage, error) {
+	if err := p.verifySignature(callback.URL, callback); err != nil {
+		return nil, err
+	}
+
+	return &SMSInboundMessage{
+		MessageID: callback.Form.Get("MessageSid"),
+		From:      callback.Form.Get("From"),
+		To:        callback.Form.Get("To"),
+		Body:      callback.Form.Get("Body"),
+	}, nil
+}
+
+// ParseInboundMessage parses a message Netgsm forwards to the inbound URL set
+// in its panel, which carries the status callback token
+func (p *NetgsmProvider) ParseInboundMessage(callback SMSCallback) (*SMSInboundMessage, error) {
+	if err := p.verifyCallback(callback); err != nil {
+		return nil, err
+	}
+
+	return &SMSInboundMessage{
+		MessageID: callback.param("id"),
+		From:      callback.param("gsmno"),
+		To:        callback.param("msgheader"),
+		Body:      callback.param("message"),
+	}, nil
+}
+
+// Redis key generators
+func (s *SMSService) getOptOutKey(tenantID string) string {
+	return fmt.Sprintf("sms_optout:%s", tenantID)
+}
+
+func (s *NotificationService) getLastSMSResultKey(phone string) string {
+	return fmt.Sprintf("sms_last_result:%s", phone)
+}
+
+// Helper functions
+
+// normalizeKeyword upper cases a reply the Turkish way, so "tamam" and
+// "iptal" match TAMAM and İPTAL
+func normalizeKeyword(text string) string {
+	return strings.TrimSpace(strings.ToUpperSpecial(unicode.TurkishCase, text))
+}
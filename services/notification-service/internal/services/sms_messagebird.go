@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const messageBirdDefaultBaseURL = "https://rest.messagebird.com"
+
+// MessageBirdProvider implements SMSProvider for the MessageBird REST API
+type MessageBirdProvider struct {
+	config SMSConfig
+	client *http.Client
+}
+
+// messageBirdMessage is the message resource of the MessageBird API
+type messageBirdMessage struct {
+	ID         string `json:"id"`
+	Recipients struct {
+		Items []struct {
+			Recipient int64  `json:"recipient"`
+			Status    string `json:"status"`
+		} `json:"items"`
+	} `json:"recipients"`
+	Errors []struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+		Parameter   string `json:"parameter"`
+	} `json:"errors"`
+}
+
+func (p *MessageBirdProvider) Capabilities() SMSCapabilities {
+	return SMSCapabilities{
+		StatusQueries:      true,
+		Balance:            true,
+		Unicode:            true,
+		AlphanumericSender: true,
+	}
+}
+
+func (p *MessageBirdProvider) Send(ctx context.Context, message SMSMessage) (*SMSResult, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"originator": message.From,
+		"recipients": []string{e164Digits(message.To)},
+		"body":       message.Body,
+		// Picks GSM-7 or UCS-2 by the characters of the body
+		"datacoding": "auto",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal MessageBird message: %w", err)
+	}
+
+	var result messageBirdMessage
+	statusCode, err := p.do(ctx, http.MethodPost, "/messages", body, &result)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusCreated {
+		return nil, messageBirdError(statusCode, result)
+	}
+
+	return &SMSResult{
+		MessageID:        result.ID,
+		To:               message.To,
+		Status:           "sent",
+		SentAt:           time.Now(),
+		Success:          true,
+		ProviderResponse: map[string]interface{}{"id": result.ID},
+	}, nil
+}
+
+func (p *MessageBirdProvider) SendBulk(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error) {
+	return sendEach(ctx, p, messages), nil
+}
+
+func (p *MessageBirdProvider) GetStatus(ctx context.Context, messageID string) (*SMSResult, error) {
+	var result messageBirdMessage
+	statusCode, err := p.do(ctx, http.MethodGet, "/messages/"+messageID, nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, messageBirdError(statusCode, result)
+	}
+
+	status := "unknown"
+	if len(result.Recipients.Items) > 0 {
+		status = result.Recipients.Items[0].Status
+	}
+
+	return &SMSResult{
+		MessageID:        messageID,
+		Status:           status,
+		Success:          status == "delivered",
+		ProviderResponse: map[string]interface{}{"status": status},
+	}, nil
+}
+
+func (p *MessageBirdProvider) GetBalance(ctx context.Context) (float64, error) {
+	var result struct {
+		Amount float64 `json:"amount"`
+	}
+	statusCode, err := p.do(ctx, http.MethodGet, "/balance", nil, &result)
+	if err != nil {
+		return 0, err
+	}
+	if statusCode != http.StatusOK {
+		return 0, fmt.Errorf("MessageBird API error: status %d", statusCode)
+	}
+
+	return result.Amount, nil
+}
+
+// do sends a request authenticated with the access key and decodes the response
+func (p *MessageBirdProvider) do(ctx context.Context, method string, path string, body []byte, result interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, smsBaseURL(p.config, messageBirdDefaultBaseURL)+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create MessageBird request: %w", err)
+	}
+	req.Header.Set("Authorization", "AccessKey "+p.config.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("MessageBird API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to decode MessageBird response: %w", err)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// messageBirdError builds the error of a failed MessageBird response
+func messageBirdError(statusCode int, result messageBirdMessage) error {
+	if len(result.Errors) == 0 {
+		return fmt.Errorf("MessageBird API error: status %d", statusCode)
+	}
+
+	descriptions := make([]string, 0, len(result.Errors))
+	for _, e := range result.Errors {
+		descriptions = append(descriptions, fmt.Sprintf("%d %s", e.Code, e.Description))
+	}
+	return fmt.Errorf("MessageBird API error: %s", strings.Join(descriptions, "; "))
+}
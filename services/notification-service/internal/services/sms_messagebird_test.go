@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// messageBirdServer is a mock of the MessageBird REST API answering with
+// status and response, recording the requests it receives
+type messageBirdServer struct {
+	*httptest.Server
+	requests []string
+	bodies   []map[string]interface{}
+	status   int
+	response string
+}
+
+func newMessageBirdServer(t *testing.T) *messageBirdServer {
+	server := &messageBirdServer{status: http.StatusCreated, response: `{"id":"mb-1"}`}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "AccessKey messagebird-key" {
+			t.Errorf("Expected the access key, got %q", r.Header.Get("Authorization"))
+		}
+
+		var body map[string]interface{}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Errorf("Failed to decode request: %v", err)
+			}
+		}
+		server.requests = append(server.requests, r.Method+" "+r.URL.Path)
+		server.bodies = append(server.bodies, body)
+
+		w.WriteHeader(server.status)
+		w.Write([]byte(server.response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newMessageBirdTestProvider(server *messageBirdServer) *MessageBirdProvider {
+	return &MessageBirdProvider{
+		config: SMSConfig{APIKey: "messagebird-key", BaseURL: server.URL},
+		client: server.Client(),
+	}
+}
+
+func TestMessageBirdCreatesMessages(t *testing.T) {
+	server := newMessageBirdServer(t)
+
+	result, err := newMessageBirdTestProvider(server).Send(context.Background(), SMSMessage{To: "+905321234567", From: "TALIMAT", Body: "Yarın İSG eğitimi var"})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.MessageID != "mb-1" || !result.Success {
+		t.Errorf("Expected the created message to identify the send, got %+v", result)
+	}
+
+	if server.requests[0] != "POST /messages" {
+		t.Errorf("Expected a message to be created, got %s", server.requests[0])
+	}
+	body := server.bodies[0]
+	recipients, _ := body["recipients"].([]interface{})
+	if body["originator"] != "TALIMAT" || len(recipients) != 1 || recipients[0] != "905321234567" {
+		t.Errorf("Expected the sender and recipient in digits, got %v", body)
+	}
+	if body["body"] != "Yarın İSG eğitimi var" || body["datacoding"] != "auto" {
+		t.Errorf("Expected the text with the encoding picked by MessageBird, got %v", body)
+	}
+}
+
+func TestMessageBirdErrorsAreReported(t *testing.T) {
+	for name, test := range map[string]struct {
+		status   int
+		response string
+		expected string
+	}{
+		"described errors": {http.StatusUnprocessableEntity, `{"errors":[{"code":9,"description":"no (correct) recipients found","parameter":"recipient"},{"code":2,"description":"originator is too long"}]}`, "9 no (correct) recipients found; 2 originator is too long"},
+		"bare status":      {http.StatusUnauthorized, `{}`, "status 401"},
+		"not JSON":         {http.StatusBadGateway, `Bad Gateway`, "failed to decode MessageBird response"},
+	} {
+		server := newMessageBirdServer(t)
+		server.status, server.response = test.status, test.response
+
+		_, err := newMessageBirdTestProvider(server).Send(context.Background(), SMSMessage{To: "905321234567", From: "TALIMAT", Body: "Tatbikat"})
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", name, test.expected, err)
+		}
+	}
+}
+
+func TestMessageBirdReportsStatusesAndBalance(t *testing.T) {
+	server := newMessageBirdServer(t)
+	provider := newMessageBirdTestProvider(server)
+
+	server.status, server.response = http.StatusOK, `{"id":"mb-1","recipients":{"items":[{"recipient":905321234567,"status":"delivered"}]}}`
+	result, err := provider.GetStatus(context.Background(), "mb-1")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if server.requests[0] != "GET /messages/mb-1" || result.Status != "delivered" || !result.Success {
+		t.Errorf("Expected the message to be delivered, got %s from %s", result.Status, server.requests[0])
+	}
+
+	server.status, server.response = http.StatusNotFound, `{"errors":[{"code":20,"description":"message not found"}]}`
+	if _, err := provider.GetStatus(context.Background(), "mb-2"); err == nil || !strings.Contains(err.Error(), "message not found") {
+		t.Errorf("Expected unknown messages to be reported, got %v", err)
+	}
+
+	server.status, server.response = http.StatusOK, `{"payment":"prepaid","type":"euros","amount":42.3}`
+	if balance, err := provider.GetBalance(context.Background()); err != nil || balance != 42.3 {
+		t.Errorf("Expected a balance of 42.3, got %v %v", balance, err)
+	}
+}
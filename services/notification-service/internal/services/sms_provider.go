@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Names of the built-in SMS providers
+const (
+	SMSProviderTwilio       = "twilio"
+	SMSProviderNetgsm       = "netgsm"
+	SMSProviderVonage       = "vonage"
+	SMSProviderMessageBird  = "messagebird"
+	SMSProviderIletiMerkezi = "iletimerkezi"
+)
+
+// smsMaxAlphanumericSender is the length limit of alphanumeric sender IDs
+const smsMaxAlphanumericSender = 11
+
+// SMSCapabilities tells what an SMS provider supports
+type SMSCapabilities struct {
+	StatusQueries bool // GetStatus reports the delivery of a message
+	Balance       bool
+	// Unicode providers send UCS-2 for characters outside GSM-7, such as
+	// the Turkish ş, ğ and ı
+	Unicode bool
+	// AlphanumericSender providers accept sender IDs like TALIMAT besides
+	// phone numbers
+	AlphanumericSender bool
+	// RegisteredSender providers only accept sender IDs registered with
+	// them, so a sender must be configured
+	RegisteredSender bool
+}
+
+// SMSProviderConfig holds the credentials of an SMS provider
+type SMSProviderConfig struct {
+	APIKey      string
+	APISecret   string
+	FromNumber  string
+	BaseURL     string
+	SegmentCost float64
+	RateLimit   int // messages per second, 0 for no limit
+}
+
+// SMSProviderFactory creates an SMS provider from its configuration
+type SMSProviderFactory func(config SMSConfig, client *http.Client) SMSProvider
+
+var (
+	smsProvidersMu sync.RWMutex
+	smsProviders   = map[string]SMSProviderFactory{
+		SMSProviderTwilio: func(config SMSConfig, client *http.Client) SMSProvider {
+			return &TwilioProvider{config: config, client: client}
+		},
+		SMSProviderNetgsm: func(config SMSConfig, client *http.Client) SMSProvider {
+			return &NetgsmProvider{config: config, client: client}
+		},
+		SMSProviderVonage: func(config SMSConfig, client *http.Client) SMSProvider {
+			return &VonageProvider{config: config, client: client}
+		},
+		SMSProviderMessageBird: func(config SMSConfig, client *http.Client) SMSProvider {
+			return &MessageBirdProvider{config: config, client: client}
+		},
+		SMSProviderIletiMerkezi: func(config SMSConfig, client *http.Client) SMSProvider {
+			return &IletiMerkeziProvider{config: config, client: client}
+		},
+	}
+)
+
+// RegisterSMSProvider makes an SMS provider available under a name, to be
+// selected in SMSConfig.Provider or SMSConfig.TenantProviders
+func RegisterSMSProvider(name string, factory SMSProviderFactory) {
+	smsProvidersMu.Lock()
+	defer smsProvidersMu.Unlock()
+
+	smsProviders[strings.ToLower(name)] = factory
+}
+
+// providerByName returns a registered SMS provider, configured with its own
+// credentials when it is not the default provider
+func (s *SMSService) providerByName(name string) (SMSProvider, error) {
+	name = strings.ToLower(name)
+
+	smsProvidersMu.RLock()
+	factory, ok := smsProviders[name]
+	smsProvidersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported SMS provider: %s", name)
+	}
+
+	return factory(s.providerConfig(name), s.client), nil
+}
+
+// providerConfig returns the configuration a provider is created with
+func (s *SMSService) providerConfig(name string) SMSConfig {
+	s.credentialsMu.RLock()
+	defer s.credentialsMu.RUnlock()
+
+	config := s.config
+	config.Provider = name
+
+	if name == strings.ToLower(s.config.Provider) {
+		return config
+	}
+
+	credentials := s.config.Providers[name]
+	config.APIKey = credentials.APIKey
+	config.APISecret = credentials.APISecret
+	config.FromNumber = credentials.FromNumber
+	config.BaseURL = credentials.BaseURL
+	config.SegmentCost = credentials.SegmentCost
+	config.RateLimit = credentials.RateLimit
+	return config
+}
+
+// validateSender checks a sender against the sender ID rules of a provider
+func validateSender(from string, capabilities SMSCapabilities) error {
+	if from == "" {
+		if capabilities.RegisteredSender {
+			return fmt.Errorf("a registered sender ID is required")
+		}
+		return nil
+	}
+
+	if isPhoneSender(from) {
+		return nil
+	}
+
+	if !capabilities.AlphanumericSender {
+		return fmt.Errorf("sender must be a phone number: %s", from)
+	}
+	if len(from) > smsMaxAlphanumericSender {
+		return fmt.Errorf("sender ID exceeds %d characters: %s", smsMaxAlphanumericSender, from)
+	}
+	for _, r := range from {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ' ' || r == '.' || r == '-') {
+			return fmt.Errorf("sender ID may only hold latin letters, digits, spaces, dots and dashes: %s", from)
+		}
+	}
+
+	return nil
+}
+
+// Helper functions
+
+// isPhoneSender tells whether a sender is a phone number rather than a sender ID
+func isPhoneSender(from string) bool {
+	digits := strings.TrimPrefix(from, "+")
+	if digits == "" || len(digits) > 15 {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// e164Digits returns a phone number as the digits of its international
+// format, e.g. 905321234567, the way most providers expect it
+func e164Digits(phone string) string {
+	phone = strings.TrimSpace(phone)
+	phone = strings.TrimPrefix(phone, "+")
+	phone = strings.TrimPrefix(phone, "00")
+
+	// Turkish numbers without country code
+	if strings.HasPrefix(phone, "0") {
+		phone = "90" + strings.TrimPrefix(phone, "0")
+	} else if len(phone) == 10 && strings.HasPrefix(phone, "5") {
+		phone = "90" + phone
+	}
+
+	return phone
+}
+
+// smsBaseURL returns the configured API URL or the provider's default
+func smsBaseURL(config SMSConfig, defaultURL string) string {
+	if config.BaseURL != "" {
+		return strings.TrimRight(config.BaseURL, "/")
+	}
+	return defaultURL
+}
+
+// sendEach sends messages one at a time, recording failures in their results
+func sendEach(ctx context.Context, provider SMSProvider, messages []SMSMessage) []*SMSResult {
+	results := make([]*SMSResult, 0, len(messages))
+	for _, message := range messages {
+		result, err := provider.Send(ctx, message)
+		if err != nil {
+			result = &SMSResult{
+				To:      message.To,
+				Status:  "failed",
+				Success: false,
+				Error:   err.Error(),
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
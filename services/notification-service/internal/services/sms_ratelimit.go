@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SMSRateLimitStats reports how the rate limiter of a provider held sends back
+type SMSRateLimitStats struct {
+	Provider  string  `json:"provider"`
+	Rate      float64 `json:"rate"` // messages per second
+	Sends     int64   `json:"sends"`
+	Throttled int64   `json:"throttled"` // sends that waited for their turn
+	Waiting   int     `json:"waiting"`   // sends waiting right now
+	WaitMs    int64   `json:"wait_ms"`   // total time sends waited
+	MaxWaitMs int64   `json:"max_wait_ms"`
+}
+
+// smsRateLimiter is a token bucket holding a provider to its send rate. Sends
+// reserve a token and wait for it when the bucket is empty, so they queue up
+// in the order they arrived instead of failing. Limiters are kept in memory,
+// every instance holds its own sends to the rate.
+type smsRateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // tokens the bucket holds
+	tokens float64
+	last   time.Time
+	stats  SMSRateLimitStats
+}
+
+func newSMSRateLimiter(provider string, rate int) *smsRateLimiter {
+	return &smsRateLimiter{
+		rate:   float64(rate),
+		burst:  float64(rate), // one second of sends
+		tokens: float64(rate),
+		last:   time.Now(),
+		stats:  SMSRateLimitStats{Provider: provider, Rate: float64(rate)},
+	}
+}
+
+// wait blocks until the send may go out, or until ctx is done
+func (l *smsRateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// Reserve a token, a negative balance is the queue in front of this send
+	l.tokens--
+	l.stats.Sends++
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.stats.Throttled++
+		l.stats.Waiting++
+		l.stats.WaitMs += delay.Milliseconds()
+		if delay.Milliseconds() > l.stats.MaxWaitMs {
+			l.stats.MaxWaitMs = delay.Milliseconds()
+		}
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	log.Debug().
+		Str("provider", l.stats.Provider).
+		Dur("delay", delay).
+		Msg("SMS send throttled")
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	l.stats.Waiting--
+	if err != nil {
+		// The send that gave up hands its turn back
+		l.tokens++
+	}
+	l.mu.Unlock()
+	return err
+}
+
+// setRate changes the send rate, sends already waiting keep their turn
+func (l *smsRateLimiter) setRate(rate int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate == float64(rate) {
+		return
+	}
+	l.rate = float64(rate)
+	l.burst = float64(rate)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.stats.Rate = float64(rate)
+}
+
+// snapshot returns the statistics of the limiter
+func (l *smsRateLimiter) snapshot() SMSRateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// rateLimitedProvider sends through a provider once its rate limiter allows
+type rateLimitedProvider struct {
+	SMSProvider
+	limiter *smsRateLimiter
+}
+
+func (p *rateLimitedProvider) Send(ctx context.Context, message SMSMessage) (*SMSResult, error) {
+	if err := p.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.SMSProvider.Send(ctx, message)
+}
+
+// SendBulk sends one message at a time, each waiting for its turn
+func (p *rateLimitedProvider) SendBulk(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error) {
+	return sendEach(ctx, p, messages), nil
+}
+
+// rateLimited wraps a provider in the rate limiter of its name. Providers
+// without a configured rate are returned as they are. The runtime
+// configuration overrides the rate of a provider.
+func (s *SMSService) rateLimited(name string, provider SMSProvider) SMSProvider {
+	rate := s.config.Runtime.Int(RuntimeSMSRateLimit(name), s.providerConfig(name).RateLimit)
+	if rate <= 0 {
+		return provider
+	}
+
+	s.limitersMu.Lock()
+	limiter, ok := s.limiters[name]
+	if !ok {
+		limiter = newSMSRateLimiter(name, rate)
+		s.limiters[name] = limiter
+	} else {
+		limiter.setRate(rate)
+	}
+	s.limitersMu.Unlock()
+
+	return &rateLimitedProvider{SMSProvider: provider, limiter: limiter}
+}
+
+// RateLimitStats returns the rate limiter statistics of every provider used so far
+func (s *SMSService) RateLimitStats() []SMSRateLimitStats {
+	s.limitersMu.Lock()
+	stats := make([]SMSRateLimitStats, 0, len(s.limiters))
+	for _, limiter := range s.limiters {
+		stats = append(stats, limiter.snapshot())
+	}
+	s.limitersMu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Provider < stats[j].Provider
+	})
+
+	return stats
+}
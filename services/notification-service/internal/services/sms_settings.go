@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// SMSTenantSettings are the sender and routing rules of the SMS of a tenant.
+// Empty settings send with the configured default provider and sender.
+type SMSTenantSettings struct {
+	TenantID string `json:"tenant_id"`
+	// SenderID is the sender ID or from number of the tenant's messages
+	SenderID string `json:"sender_id,omitempty"`
+	// Provider is the preferred provider, FallbackProvider is tried when a
+	// message can't be sent with the provider it was routed to
+	Provider         string `json:"provider,omitempty"`
+	FallbackProvider string `json:"fallback_provider,omitempty"`
+	// CountryRoutes routes numbers by country calling code, e.g. 90: netgsm.
+	// The longest matching code wins over the preferred provider.
+	CountryRoutes map[string]string `json:"country_routes,omitempty"`
+	// Keywords map reply keywords to the action they take, acknowledge,
+	// opt_out or escalate, on top of the default keywords
+	Keywords  map[string]string `json:"keywords,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// smsRoute is a provider a message is sent with
+type smsRoute struct {
+	name     string
+	provider SMSProvider
+	from     string // default sender of the tenant with the provider
+}
+
+// prepare sets the default sender of the route on a message without one
+func (r *smsRoute) prepare(message SMSMessage) SMSMessage {
+	if message.From == "" {
+		message.From = r.from
+	}
+	return message
+}
+
+// GetTenantSettings returns the SMS settings of a tenant
+func (s *SMSService) GetTenantSettings(tenantID string) (*SMSTenantSettings, error) {
+	if tenantID == "" {
+		return &SMSTenantSettings{}, nil
+	}
+
+	ctx := context.Background()
+	settingsJSON, err := s.redis.Get(ctx, s.getTenantSettingsKey(tenantID)).Result()
+	if err == redis.Nil {
+		return &SMSTenantSettings{TenantID: tenantID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SMS settings: %w", err)
+	}
+
+	var settings SMSTenantSettings
+	if err := json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal SMS settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SetTenantSettings stores the SMS settings of a tenant
+func (s *SMSService) SetTenantSettings(settings SMSTenantSettings) (*SMSTenantSettings, error) {
+	log.Info().
+		Str("tenantID", settings.TenantID).
+		Str("provider", settings.Provider).
+		Str("fallbackProvider", settings.FallbackProvider).
+		Msg("Updating SMS settings")
+
+	if settings.TenantID == "" {
+		return nil, invalid(fmt.Errorf("tenant ID is required"))
+	}
+
+	settings.Provider = strings.ToLower(strings.TrimSpace(settings.Provider))
+	settings.FallbackProvider = strings.ToLower(strings.TrimSpace(settings.FallbackProvider))
+	for _, name := range []string{settings.Provider, settings.FallbackProvider} {
+		if name == "" {
+			continue
+		}
+		if _, err := s.providerByName(name); err != nil {
+			return nil, invalid(err)
+		}
+	}
+
+	routes := make(map[string]string, len(settings.CountryRoutes))
+	for code, name := range settings.CountryRoutes {
+		code = strings.TrimPrefix(strings.TrimSpace(code), "+")
+		if !isPhoneSender(code) || len(code) > 4 {
+			return nil, invalid(fmt.Errorf("invalid country calling code: %s", code))
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, err := s.providerByName(name); err != nil {
+			return nil, invalid(err)
+		}
+		routes[code] = name
+	}
+	settings.CountryRoutes = routes
+
+	keywords := make(map[string]string, len(settings.Keywords))
+	for keyword, action := range settings.Keywords {
+		keyword = normalizeKeyword(keyword)
+		if keyword == "" || strings.ContainsAny(keyword, " \t") {
+			return nil, invalid(fmt.Errorf("invalid reply keyword: %q", keyword))
+		}
+		if !smsReplyActions[action] {
+			return nil, invalid(fmt.Errorf("invalid reply action: %s", action))
+		}
+		keywords[keyword] = action
+	}
+	settings.Keywords = keywords
+
+	// Provider specific sender rules are checked when sending
+	if settings.SenderID != "" {
+		if err := validateSender(settings.SenderID, SMSCapabilities{AlphanumericSender: true}); err != nil {
+			return nil, invalid(err)
+		}
+	}
+
+	settings.UpdatedAt = time.Now()
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SMS settings: %w", err)
+	}
+
+	ctx := context.Background()
+	if err := s.redis.Set(ctx, s.getTenantSettingsKey(settings.TenantID), settingsJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store SMS settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// getProvider returns the provider the SMS of a tenant to a number are sent
+// with, the number may be empty to get the tenant's preferred provider
+func (s *SMSService) getProvider(settings *SMSTenantSettings, to string) (*smsRoute, error) {
+	return s.route(s.providerName(settings, to), settings)
+}
+
+// getRoutes returns the providers a message is tried with in order: the one
+// it is routed to and the fallback provider of its tenant
+func (s *SMSService) getRoutes(settings *SMSTenantSettings, message SMSMessage) ([]*smsRoute, error) {
+	primary, err := s.getProvider(settings, message.To)
+	if err != nil {
+		return nil, err
+	}
+	routes := []*smsRoute{primary}
+
+	if settings.FallbackProvider != "" && settings.FallbackProvider != primary.name {
+		fallback, err := s.route(settings.FallbackProvider, settings)
+		if err != nil {
+			log.Warn().Err(err).Str("tenantID", settings.TenantID).Msg("Ignoring SMS fallback provider")
+			return routes, nil
+		}
+		routes = append(routes, fallback)
+	}
+
+	return routes, nil
+}
+
+// route returns a provider with the sender the tenant uses with it
+func (s *SMSService) route(name string, settings *SMSTenantSettings) (*smsRoute, error) {
+	provider, err := s.providerByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	from := settings.SenderID
+	if from == "" {
+		from = s.providerConfig(name).FromNumber
+	}
+
+	return &smsRoute{name: name, provider: s.rateLimited(name, provider), from: from}, nil
+}
+
+// providerName picks the provider of a number: the tenant's route for its
+// country, the tenant's preferred provider, the provider the configuration
+// assigns the tenant, or the default provider
+func (s *SMSService) providerName(settings *SMSTenantSettings, to string) string {
+	if to != "" && len(settings.CountryRoutes) > 0 {
+		digits := e164Digits(to)
+		matched := ""
+		for code := range settings.CountryRoutes {
+			if strings.HasPrefix(digits, code) && len(code) > len(matched) {
+				matched = code
+			}
+		}
+		if matched != "" {
+			return settings.CountryRoutes[matched]
+		}
+	}
+
+	if settings.Provider != "" {
+		return settings.Provider
+	}
+	if name, ok := s.config.TenantProviders[settings.TenantID]; ok && settings.TenantID != "" {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(s.config.Provider)
+}
+
+// Redis key generators
+func (s *SMSService) getTenantSettingsKey(tenantID string) string {
+	return fmt.Sprintf("sms_settings:%s", tenantID)
+}
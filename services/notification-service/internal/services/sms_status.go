@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// messageIndexTTL is how long results can be found by their provider message
+// ID. Providers give up reporting the delivery of a message well before.
+const messageIndexTTL = 7 * 24 * time.Hour
+
+// deliveryReportChannels are the channels whose providers report deliveries
+// of single messages, so their results are indexed by message ID. In-app
+// notifications report being read.
+var deliveryReportChannels = map[string]bool{
+	"sms":   true,
+	"email": true,
+	"voice": true,
+	"inapp": true,
+}
+
+// SMSCallback is a request a provider made to a callback endpoint, a delivery
+// report or an inbound message
+type SMSCallback struct {
+	URL    string     // URL the request was made to, signatures may cover it
+	Query  url.Values // query parameters
+	Form   url.Values // form parameters of POST requests
+	Header http.Header
+}
+
+// param returns a parameter of the form, or of the query when not posted
+func (c SMSCallback) param(name string) string {
+	if value := c.Form.Get(name); value != "" {
+		return value
+	}
+	return c.Query.Get(name)
+}
+
+// SMSDeliveryReport is the delivery status a provider reported for a message
+type SMSDeliveryReport struct {
+	MessageID      string
+	Status         string // sent, delivered, failed
+	ProviderStatus string
+	Error          string
+}
+
+// SMSDeliveryReporter is implemented by providers that report deliveries to
+// the status callback endpoint
+type SMSDeliveryReporter interface {
+	ParseDeliveryReport(callback SMSCallback) (*SMSDeliveryReport, error)
+}
+
+// Twilio message statuses, the ones not listed are still on their way
+var twilioStatuses = map[string]string{
+	"delivered":   "delivered",
+	"read":        "delivered",
+	"undelivered": "failed",
+	"failed":      "failed",
+	"canceled":    "cancelled",
+}
+
+// Netgsm report statuses of undelivered messages, 0 is still on its way and
+// 1 delivered
+var netgsmFailures = map[string]string{
+	"2":  "expired",
+	"3":  "invalid or restricted number",
+	"4":  "not sent to the operator",
+	"11": "rejected by the operator",
+	"12": "delivery error",
+	"13": "duplicate message",
+	"14": "insufficient credit",
+	"15": "number is blacklisted",
+	"16": "rejected by İYS",
+}
+
+// ParseDeliveryReport verifies and parses a delivery report posted by a provider
+func (s *SMSService) ParseDeliveryReport(providerName string, callback SMSCallback) (*SMSDeliveryReport, error) {
+	provider, err := s.providerByName(providerName)
+	if err != nil {
+		return nil, notFoundf("%v", err)
+	}
+
+	reporter, ok := provider.(SMSDeliveryReporter)
+	if !ok {
+		return nil, notFoundf("SMS provider %s doesn't report deliveries", providerName)
+	}
+
+	report, err := reporter.ParseDeliveryReport(callback)
+	if err != nil {
+		return nil, err
+	}
+	if report.MessageID == "" {
+		return nil, invalid(fmt.Errorf("delivery report has no message ID"))
+	}
+
+	return report, nil
+}
+
+// ReceiveSMSDeliveryReport applies a delivery report to the result of the
+// message it refers to and reports the final status to the caller
+func (s *NotificationService) ReceiveSMSDeliveryReport(providerName string, callback SMSCallback) error {
+	report, err := s.smsService.ParseDeliveryReport(providerName, callback)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	resultID, err := s.redis.Get(ctx, s.getMessageResultKey("sms", report.MessageID)).Result()
+	if err == redis.Nil {
+		// Messages sent with the same account by others, or reported too late
+		log.Debug().
+			Str("provider", providerName).
+			Str("messageID", report.MessageID).
+			Msg("Ignoring delivery report of unknown message")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up message: %w", err)
+	}
+
+	result, err := s.GetNotificationStatus(ctx, resultID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	// Only the first final report changes a result. Intermediate statuses,
+	// reports of earlier attempts and reports arriving late are ignored.
+	if result.Status != "sent" || result.MessageID != report.MessageID || report.Status == "sent" {
+		return nil
+	}
+
+	result.Status = report.Status
+	result.Error = report.Error
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["provider_status"] = report.ProviderStatus
+	if report.Status == "delivered" {
+		result.Metadata["delivered_at"] = time.Now()
+	}
+
+	if err := s.storeResult(*result); err != nil {
+		return fmt.Errorf("failed to update result: %w", err)
+	}
+
+	s.notifyStatus(*result)
+
+	log.Info().
+		Str("resultID", result.ID).
+		Str("status", result.Status).
+		Msg("SMS delivery report applied")
+
+	return nil
+}
+
+// ParseDeliveryReport parses a Twilio status callback, verifying its
+// X-Twilio-Signature with the auth token
+func (p *TwilioProvider) ParseDeliveryReport(callback SMSCallback) (*SMSDeliveryReport, error) {
+	callbackURL := p.statusCallbackURL()
+	if callbackURL == "" {
+		callbackURL = callback.URL
+	}
+
+	if err := p.verifySignature(callbackURL, callback); err != nil {
+		return nil, err
+	}
+
+	providerStatus := callback.Form.Get("MessageStatus")
+	report := &SMSDeliveryReport{
+		MessageID:      callback.Form.Get("MessageSid"),
+		Status:         "sent",
+		ProviderStatus: providerStatus,
+	}
+	if status, ok := twilioStatuses[providerStatus]; ok {
+		report.Status = status
+	}
+	if report.Status == "failed" {
+		report.Error = fmt.Sprintf("Twilio delivery failed: %s (error %s)", providerStatus, callback.Form.Get("ErrorCode"))
+	}
+
+	return report, nil
+}
+
+// verifySignature checks the X-Twilio-Signature of a callback made to a URL
+func (p *TwilioProvider) verifySignature(callbackURL string, callback SMSCallback) error {
+	expected := twilioSignature(p.config.APISecret, callbackURL, callback.Form)
+	if !hmac.Equal([]byte(expected), []byte(callback.Header.Get("X-Twilio-Signature"))) {
+		return unauthorizedf("invalid Twilio signature")
+	}
+	return nil
+}
+
+// statusCallbackURL returns the URL Twilio posts delivery reports to
+func (p *TwilioProvider) statusCallbackURL() string {
+	if p.config.StatusCallbackURL == "" {
+		return ""
+	}
+	return strings.TrimRight(p.config.StatusCallbackURL, "/") + "/" + SMSProviderTwilio
+}
+
+// ParseDeliveryReport parses a Netgsm delivery report. Netgsm doesn't sign its
+// reports, the report URL set in its panel carries the status callback token.
+func (p *NetgsmProvider) ParseDeliveryReport(callback SMSCallback) (*SMSDeliveryReport, error) {
+	if err := p.verifyCallback(callback); err != nil {
+		return nil, err
+	}
+
+	providerStatus := callback.param("status")
+	report := &SMSDeliveryReport{
+		MessageID:      callback.param("jobid"),
+		Status:         "failed",
+		ProviderStatus: providerStatus,
+	}
+
+	switch providerStatus {
+	case "0":
+		report.Status = "sent"
+	case "1":
+		report.Status = "delivered"
+	default:
+		reason, ok := netgsmFailures[providerStatus]
+		if !ok {
+			reason = "status " + providerStatus
+		}
+		report.Error = "Netgsm delivery failed: " + reason
+	}
+
+	return report, nil
+}
+
+// verifyCallback checks the status callback token of a Netgsm callback URL
+func (p *NetgsmProvider) verifyCallback(callback SMSCallback) error {
+	token := callback.Query.Get("token")
+	if p.config.StatusCallbackToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.config.StatusCallbackToken)) != 1 {
+		return unauthorizedf("invalid Netgsm callback token")
+	}
+	return nil
+}
+
+// Helper functions
+
+// twilioSignature signs a callback the way Twilio does: the URL followed by
+// the sorted form parameters, HMAC-SHA1 with the auth token, base64 encoded
+func twilioSignature(authToken string, callbackURL string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var payload strings.Builder
+	payload.WriteString(callbackURL)
+	for _, key := range keys {
+		for _, value := range form[key] {
+			payload.WriteString(key)
+			payload.WriteString(value)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(payload.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
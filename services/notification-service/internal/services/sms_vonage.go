@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const vonageDefaultBaseURL = "https://rest.nexmo.com"
+
+// VonageProvider implements SMSProvider for the Vonage SMS API
+type VonageProvider struct {
+	config SMSConfig
+	client *http.Client
+}
+
+func (p *VonageProvider) Capabilities() SMSCapabilities {
+	return SMSCapabilities{
+		// Vonage reports deliveries through delivery receipts only
+		StatusQueries:      false,
+		Balance:            true,
+		Unicode:            true,
+		AlphanumericSender: true,
+	}
+}
+
+func (p *VonageProvider) Send(ctx context.Context, message SMSMessage) (*SMSResult, error) {
+	endpoint := fmt.Sprintf("%s/sms/json", smsBaseURL(p.config, vonageDefaultBaseURL))
+
+	formData := url.Values{}
+	formData.Set("api_key", p.config.APIKey)
+	formData.Set("api_secret", p.config.APISecret)
+	formData.Set("from", message.From)
+	formData.Set("to", e164Digits(message.To))
+	formData.Set("text", message.Body)
+	if !isGSM7(message.Body) {
+		formData.Set("type", "unicode")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vonage request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Vonage API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		MessageCount string `json:"message-count"`
+		Messages     []struct {
+			To        string `json:"to"`
+			MessageID string `json:"message-id"`
+			Status    string `json:"status"`
+			ErrorText string `json:"error-text"`
+			Price     string `json:"message-price"`
+			Network   string `json:"network"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Vonage response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || len(result.Messages) == 0 {
+		return nil, fmt.Errorf("Vonage API error: status %d", resp.StatusCode)
+	}
+
+	// Long texts are split into one message per part, all of which must succeed
+	var cost float64
+	for _, part := range result.Messages {
+		if part.Status != "0" {
+			return nil, fmt.Errorf("Vonage API error %s: %s", part.Status, part.ErrorText)
+		}
+		if price, err := parseFloat(part.Price); err == nil {
+			cost += price
+		}
+	}
+
+	return &SMSResult{
+		MessageID: result.Messages[0].MessageID,
+		To:        message.To,
+		Status:    "sent",
+		SentAt:    time.Now(),
+		Success:   true,
+		Cost:      cost,
+		ProviderResponse: map[string]interface{}{
+			"message_count": result.MessageCount,
+			"price":         result.Messages[0].Price,
+			"network":       result.Messages[0].Network,
+		},
+	}, nil
+}
+
+func (p *VonageProvider) SendBulk(ctx context.Context, messages []SMSMessage) ([]*SMSResult, error) {
+	return sendEach(ctx, p, messages), nil
+}
+
+func (p *VonageProvider) GetStatus(ctx context.Context, messageID string) (*SMSResult, error) {
+	return nil, invalid(fmt.Errorf("Vonage doesn't support message status queries"))
+}
+
+func (p *VonageProvider) GetBalance(ctx context.Context) (float64, error) {
+	params := url.Values{}
+	params.Set("api_key", p.config.APIKey)
+	params.Set("api_secret", p.config.APISecret)
+	endpoint := fmt.Sprintf("%s/account/get-balance?%s", smsBaseURL(p.config, vonageDefaultBaseURL), params.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Vonage request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("Vonage API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Vonage API error: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Value float64 `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode Vonage response: %w", err)
+	}
+
+	return result.Value, nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// vonageServer is a mock of the Vonage SMS API answering sends with status
+// and response, recording the forms it receives
+type vonageServer struct {
+	*httptest.Server
+	forms    []url.Values
+	status   int
+	response string
+}
+
+func newVonageServer(t *testing.T) *vonageServer {
+	server := &vonageServer{status: http.StatusOK}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/account/get-balance" {
+			if r.URL.Query().Get("api_key") != "vonage-key" || r.URL.Query().Get("api_secret") != "vonage-secret" {
+				t.Errorf("Expected the balance query to carry the credentials, got %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"value":12.5,"autoReload":false}`))
+			return
+		}
+
+		if r.Method != http.MethodPost || r.URL.Path != "/sms/json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse form: %v", err)
+		}
+		server.forms = append(server.forms, r.PostForm)
+
+		w.WriteHeader(server.status)
+		w.Write([]byte(server.response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newVonageTestProvider(server *vonageServer) *VonageProvider {
+	return &VonageProvider{
+		config: SMSConfig{APIKey: "vonage-key", APISecret: "vonage-secret", BaseURL: server.URL},
+		client: server.Client(),
+	}
+}
+
+func TestVonageSendsFormsAndAddsUpTheParts(t *testing.T) {
+	server := newVonageServer(t)
+	server.response = `{"message-count":"2","messages":[
+		{"to":"905321234567","message-id":"vonage-1","status":"0","message-price":"0.05","network":"28601"},
+		{"to":"905321234567","message-id":"vonage-2","status":"0","message-price":"0.05","network":"28601"}]}`
+	provider := newVonageTestProvider(server)
+
+	result, err := provider.Send(context.Background(), SMSMessage{To: "05321234567", From: "TALIMAT", Body: "Vardiya değişikliği: yarın 08.00"})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.MessageID != "vonage-1" || !result.Success || result.Cost < 0.0999 || result.Cost > 0.1001 {
+		t.Errorf("Expected the first part to identify the send costing both parts, got %s costing %v", result.MessageID, result.Cost)
+	}
+
+	form := server.forms[0]
+	for name, expected := range map[string]string{
+		"api_key":    "vonage-key",
+		"api_secret": "vonage-secret",
+		"from":       "TALIMAT",
+		"to":         "905321234567",
+		"text":       "Vardiya değişikliği: yarın 08.00",
+		"type":       "unicode",
+	} {
+		if form.Get(name) != expected {
+			t.Errorf("Expected %s to be %q, got %q", name, expected, form.Get(name))
+		}
+	}
+
+	// Texts in GSM-7 are sent as they are
+	server.response = `{"message-count":"1","messages":[{"message-id":"vonage-3","status":"0"}]}`
+	if _, err := provider.Send(context.Background(), SMSMessage{To: "+905321234567", From: "TALIMAT", Body: "Tatbikat saat 14.00"}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if server.forms[1].Has("type") {
+		t.Errorf("Expected GSM-7 texts to be sent without a type, got %q", server.forms[1].Get("type"))
+	}
+}
+
+func TestVonageErrorsAreReported(t *testing.T) {
+	for name, test := range map[string]struct {
+		status   int
+		response string
+		expected string
+	}{
+		"rejected part": {http.StatusOK, `{"message-count":"2","messages":[{"status":"0"},{"status":"4","error-text":"Bad Credentials"}]}`, "Vonage API error 4: Bad Credentials"},
+		"server error":  {http.StatusInternalServerError, `{}`, "status 500"},
+		"no messages":   {http.StatusOK, `{"message-count":"0","messages":[]}`, "status 200"},
+		"not JSON":      {http.StatusBadGateway, `<html>Bad Gateway</html>`, "failed to decode Vonage response"},
+	} {
+		server := newVonageServer(t)
+		server.status, server.response = test.status, test.response
+
+		_, err := newVonageTestProvider(server).Send(context.Background(), SMSMessage{To: "905321234567", From: "TALIMAT", Body: "Tatbikat"})
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", name, test.expected, err)
+		}
+	}
+}
+
+func TestVonageReportsItsBalanceButNoStatuses(t *testing.T) {
+	provider := newVonageTestProvider(newVonageServer(t))
+
+	if balance, err := provider.GetBalance(context.Background()); err != nil || balance != 12.5 {
+		t.Errorf("Expected a balance of 12.5, got %v %v", balance, err)
+	}
+	if _, err := provider.GetStatus(context.Background(), "vonage-1"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected status queries to be unsupported, got %v", err)
+	}
+}
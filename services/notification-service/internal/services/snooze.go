@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// SnoozeNotification hides a notification from the user's inbox until the
+// given time. With repush the user is also reminded by push when it returns.
+func (s *InAppNotificationService) SnoozeNotification(
+	ctx context.Context,
+	notificationID string,
+	userID string,
+	until time.Time,
+	repush bool,
+) (*InAppNotification, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	log.Info().
+		Str("notificationID", notificationID).
+		Str("userID", userID).
+		Time("until", until).
+		Msg("Snoozing notification")
+
+	notification, err := s.GetNotification(ctx, notificationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	// Check if user owns this notification
+	if notification.UserID != userID {
+		return nil, notFoundf("notification not found: %s", notificationID)
+	}
+
+	if !until.After(time.Now()) {
+		return nil, invalid(fmt.Errorf("snooze time must be in the future"))
+	}
+	if notification.ExpiresAt != nil && until.After(*notification.ExpiresAt) {
+		return nil, invalid(fmt.Errorf("notification expires before the snooze time"))
+	}
+
+	notification.SnoozedUntil = &until
+	notification.SnoozeRepush = repush
+
+	notificationJSON, err := s.pii.marshalInApp(*notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getNotificationKey(notificationID), notificationJSON, s.config.TTL)
+	pipe.ZRem(ctx, s.getUserNotificationsKey(userID, notification.TenantID), notificationID)
+	removed := pipe.SRem(ctx, s.getUnreadKey(userID, notification.TenantID), notificationID)
+	pipe.ZAdd(ctx, s.getSnoozedKey(userID, notification.TenantID), &redis.Z{
+		Score:  float64(until.Unix()),
+		Member: notificationID,
+	})
+	pipe.ZAdd(ctx, s.getSnoozeDueKey(), &redis.Z{
+		Score:  float64(until.Unix()),
+		Member: notificationID,
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to snooze notification: %w", err)
+	}
+	s.publishUnreadDelta(ctx, userID, notification.TenantID, UnreadReasonSnoozed, -removed.Val(), notificationID)
+
+	return notification, nil
+}
+
+// UnsnoozeNotification returns a snoozed notification to the user's inbox right away
+func (s *InAppNotificationService) UnsnoozeNotification(ctx context.Context, notificationID string, userID string) (*InAppNotification, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	notification, err := s.GetNotification(ctx, notificationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	// Check if user owns this notification
+	if notification.UserID != userID {
+		return nil, notFoundf("notification not found: %s", notificationID)
+	}
+
+	if notification.SnoozedUntil == nil {
+		return nil, conflictf("notification is not snoozed: %s", notificationID)
+	}
+
+	if err := s.resurface(ctx, notification, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// GetSnoozedNotifications gets the snoozed notifications of a user, the ones
+// returning soonest first
+func (s *InAppNotificationService) GetSnoozedNotifications(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	page int,
+	limit int,
+) ([]*InAppNotification, int, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	snoozedKey := s.getSnoozedKey(userID, tenantID)
+
+	total, err := s.redis.ZCard(ctx, snoozedKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get snoozed count: %w", err)
+	}
+
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
+
+	ids, err := s.redis.ZRange(ctx, snoozedKey, start, stop).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get snoozed notification IDs: %w", err)
+	}
+
+	var notifications []*InAppNotification
+	for _, id := range ids {
+		notification, err := s.GetNotification(ctx, id)
+		if err != nil {
+			log.Warn().Err(err).Str("notificationID", id).Msg("Failed to get notification")
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, int(total), nil
+}
+
+// WakeDueSnoozes returns every notification whose snooze has passed to its
+// user's inbox. It returns the woken notifications that asked for a reminder push.
+func (s *InAppNotificationService) WakeDueSnoozes(now time.Time) ([]*InAppNotification, error) {
+	ctx := context.Background()
+	dueKey := s.getSnoozeDueKey()
+
+	ids, err := s.redis.ZRangeByScore(ctx, dueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due snoozes: %w", err)
+	}
+
+	var reminders []*InAppNotification
+	for _, id := range ids {
+		// Only one instance wins the right to wake the notification
+		removed, err := s.redis.ZRem(ctx, dueKey, id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		notification, err := s.GetNotification(ctx, id)
+		if err != nil {
+			// Notifications deleted or expired while snoozed stay gone
+			continue
+		}
+		if notification.SnoozedUntil == nil {
+			continue
+		}
+
+		repush := notification.SnoozeRepush
+		if err := s.resurface(ctx, notification, now); err != nil {
+			log.Error().Err(err).Str("notificationID", id).Msg("Failed to wake snoozed notification")
+			continue
+		}
+
+		if repush {
+			reminders = append(reminders, notification)
+		}
+	}
+
+	return reminders, nil
+}
+
+// resurface puts a snoozed notification back at the top of its user's inbox
+func (s *InAppNotificationService) resurface(ctx context.Context, notification *InAppNotification, at time.Time) error {
+	notification.SnoozedUntil = nil
+	notification.SnoozeRepush = false
+
+	notificationJSON, err := s.pii.marshalInApp(*notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, s.getNotificationKey(notification.ID), notificationJSON, s.config.TTL)
+	pipe.ZAdd(ctx, s.getUserNotificationsKey(notification.UserID, notification.TenantID), &redis.Z{
+		Score:  float64(at.Unix()),
+		Member: notification.ID,
+	})
+	s.expireIndex(ctx, pipe, s.getUserNotificationsKey(notification.UserID, notification.TenantID))
+	var added *redis.IntCmd
+	if !notification.Read {
+		added = pipe.SAdd(ctx, s.getUnreadKey(notification.UserID, notification.TenantID), notification.ID)
+		s.expireIndex(ctx, pipe, s.getUnreadKey(notification.UserID, notification.TenantID))
+	}
+	pipe.ZRem(ctx, s.getSnoozedKey(notification.UserID, notification.TenantID), notification.ID)
+	pipe.ZRem(ctx, s.getSnoozeDueKey(), notification.ID)
+	s.indexNotification(ctx, pipe, notification)
+	s.touchThread(ctx, pipe, notification, at)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to resurface notification: %w", err)
+	}
+	if added != nil {
+		s.publishUnreadDelta(ctx, notification.UserID, notification.TenantID, UnreadReasonResurfaced, added.Val(), notification.ID)
+	}
+
+	return nil
+}
+
+// startSnoozeWorker periodically returns snoozed in-app notifications that are due
+func (s *NotificationService) startSnoozeWorker() {
+	log.Info().Dur("interval", s.config.SnoozeInterval).Msg("Snooze worker started")
+
+	ticker := time.NewTicker(s.config.SnoozeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Snooze worker stopped")
+			return
+		case <-ticker.C:
+			s.wakeSnoozedNotifications()
+		}
+	}
+}
+
+// wakeSnoozedNotifications wakes due snoozes and reminds users who asked for it by push
+func (s *NotificationService) wakeSnoozedNotifications() {
+	reminders, err := s.inAppService.WakeDueSnoozes(time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to wake snoozed notifications")
+		return
+	}
+
+	for _, notification := range reminders {
+		_, err := s.pushService.SendPushNotification(context.Background(), PushMessage{
+			Title:    notification.Title,
+			Body:     notification.Message,
+			Priority: notification.Priority,
+			UserIDs:  []string{notification.UserID},
+			TenantID: notification.TenantID,
+			Data: map[string]interface{}{
+				"notification_id": notification.ID,
+				"reminder":        true,
+			},
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("notificationID", notification.ID).Msg("Failed to push snooze reminder")
+		}
+	}
+}
+
+// Redis key generators
+func (s *InAppNotificationService) getSnoozedKey(userID string, tenantID string) string {
+	return fmt.Sprintf("snoozed:%s:%s", tenantID, userID)
+}
+
+func (s *InAppNotificationService) getSnoozeDueKey() string {
+	return "snoozed_due"
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newSnoozeTestNotification creates an unread notification of user-1 that
+// lives for a day
+func newSnoozeTestNotification(t *testing.T, env *integrationEnv, title string) *InAppNotification {
+	t.Helper()
+
+	env.service.inAppService.config.TTL = 24 * time.Hour
+	notification, err := env.service.inAppService.CreateNotification(context.Background(), InAppNotification{
+		UserID:   "user-1",
+		TenantID: "tenant-a",
+		Type:     "info",
+		Title:    title,
+		Message:  title,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notification: %v", err)
+	}
+	return notification
+}
+
+// inboxOf returns the inbox size, unread count and snoozed count of user-1
+func inboxOf(t *testing.T, env *integrationEnv) (int, int, int) {
+	t.Helper()
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	_, total, err := inApp.GetUserNotifications(ctx, "user-1", "tenant-a", 1, 20, nil)
+	if err != nil {
+		t.Fatalf("Failed to get notifications: %v", err)
+	}
+	unread, err := inApp.GetUnreadCount(ctx, "user-1", "tenant-a")
+	if err != nil {
+		t.Fatalf("Failed to get unread count: %v", err)
+	}
+	_, snoozed, err := inApp.GetSnoozedNotifications(ctx, "user-1", "tenant-a", 1, 20)
+	if err != nil {
+		t.Fatalf("Failed to get snoozed notifications: %v", err)
+	}
+	return total, unread, snoozed
+}
+
+func TestSnoozedNotificationsReturnWhenDue(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	reminded := newSnoozeTestNotification(t, env, "Eğitim anketini doldurun")
+	quiet := newSnoozeTestNotification(t, env, "Yemekhane menüsü")
+	until := time.Now().Add(time.Hour)
+
+	if _, err := inApp.SnoozeNotification(ctx, reminded.ID, "user-1", until, true); err != nil {
+		t.Fatalf("Failed to snooze: %v", err)
+	}
+	if _, err := inApp.SnoozeNotification(ctx, quiet.ID, "user-1", until.Add(time.Minute), false); err != nil {
+		t.Fatalf("Failed to snooze: %v", err)
+	}
+	if total, unread, snoozed := inboxOf(t, env); total != 0 || unread != 0 || snoozed != 2 {
+		t.Errorf("Expected snoozed notifications to leave the inbox, got %d in the inbox, %d unread, %d snoozed", total, unread, snoozed)
+	}
+
+	snoozed, _, _ := inApp.GetSnoozedNotifications(ctx, "user-1", "tenant-a", 1, 20)
+	if len(snoozed) != 2 || snoozed[0].ID != reminded.ID || snoozed[0].SnoozedUntil == nil || !snoozed[0].SnoozeRepush {
+		t.Errorf("Expected the snoozed notifications soonest first, got %+v", snoozed)
+	}
+
+	if reminders, err := inApp.WakeDueSnoozes(until.Add(-time.Second)); err != nil || len(reminders) != 0 {
+		t.Errorf("Expected nothing to return before its time, got %d (%v)", len(reminders), err)
+	}
+
+	reminders, err := inApp.WakeDueSnoozes(until.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to wake snoozes: %v", err)
+	}
+	if len(reminders) != 1 || reminders[0].ID != reminded.ID {
+		t.Errorf("Expected a reminder for the notification that asked for one, got %+v", reminders)
+	}
+	if total, unread, snoozed := inboxOf(t, env); total != 2 || unread != 2 || snoozed != 0 {
+		t.Errorf("Expected the notifications back in the inbox, got %d in the inbox, %d unread, %d snoozed", total, unread, snoozed)
+	}
+	woken, err := inApp.GetNotification(ctx, reminded.ID)
+	if err != nil || woken.SnoozedUntil != nil || woken.SnoozeRepush {
+		t.Errorf("Expected the snooze to be cleared, got %+v (%v)", woken, err)
+	}
+
+	if reminders, _ := inApp.WakeDueSnoozes(until.Add(time.Hour)); len(reminders) != 0 {
+		t.Errorf("Expected notifications to be woken once, got %d reminders", len(reminders))
+	}
+}
+
+func TestSnoozesCanBeCutShort(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	inApp := env.service.inAppService
+
+	notification := newSnoozeTestNotification(t, env, "Baret denetimi")
+	if err := inApp.MarkAsRead(ctx, notification.ID, "user-1"); err != nil {
+		t.Fatalf("Failed to mark as read: %v", err)
+	}
+	if _, err := inApp.SnoozeNotification(ctx, notification.ID, "user-1", time.Now().Add(time.Hour), false); err != nil {
+		t.Fatalf("Failed to snooze: %v", err)
+	}
+
+	if _, err := inApp.UnsnoozeNotification(ctx, notification.ID, "user-1"); err != nil {
+		t.Fatalf("Failed to unsnooze: %v", err)
+	}
+	if total, unread, snoozed := inboxOf(t, env); total != 1 || unread != 0 || snoozed != 0 {
+		t.Errorf("Expected the read notification back in the inbox, still read, got %d in the inbox, %d unread, %d snoozed", total, unread, snoozed)
+	}
+	if reminders, _ := inApp.WakeDueSnoozes(time.Now().Add(2 * time.Hour)); len(reminders) != 0 {
+		t.Errorf("Expected the cut short snooze not to fire, got %d reminders", len(reminders))
+	}
+
+	if _, err := inApp.UnsnoozeNotification(ctx, notification.ID, "user-1"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected notifications that aren't snoozed to conflict, got %v", err)
+	}
+}
+
+func TestSnoozesAreValidated(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	notification := newSnoozeTestNotification(t, env, "İSG kurulu toplantısı")
+
+	for name, test := range map[string]struct {
+		notificationID string
+		userID         string
+		until          time.Time
+		expected       error
+	}{
+		"in the past":          {notification.ID, "user-1", time.Now().Add(-time.Minute), ErrValidation},
+		"after it expires":     {notification.ID, "user-1", time.Now().Add(48 * time.Hour), ErrValidation},
+		"of another user":      {notification.ID, "user-2", time.Now().Add(time.Hour), ErrNotFound},
+		"unknown notification": {"inapp_unknown", "user-1", time.Now().Add(time.Hour), ErrNotFound},
+	} {
+		if _, err := env.service.inAppService.SnoozeNotification(ctx, test.notificationID, test.userID, test.until, false); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, err)
+		}
+	}
+
+	if total, unread, snoozed := inboxOf(t, env); total != 1 || unread != 1 || snoozed != 0 {
+		t.Errorf("Expected refused snoozes to leave the inbox alone, got %d in the inbox, %d unread, %d snoozed", total, unread, snoozed)
+	}
+}
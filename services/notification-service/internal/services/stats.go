@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// statsRetention is how long daily statistics rollups are kept
+const statsRetention = 400 * 24 * time.Hour
+
+// Rollup hash field prefixes
+const (
+	statsFieldTotal         = "total"
+	statsFieldStatus        = "status:"
+	statsFieldType          = "type:"
+	statsFieldCategory      = "category:"
+	statsFieldPriority      = "priority:"
+	statsFieldDeliveryTime  = "delivery_ms_sum"
+	statsFieldDeliveryCount = "delivery_count"
+	statsFieldSuppression   = "suppression:"
+	statsFieldFeedback      = "feedback:"
+	statsFieldChannel       = "channel:" // channel:<type>:<status>
+	statsFieldLocale        = "locale:"  // locale:<locale>:<status>
+)
+
+// recordStats updates the daily rollup of a tenant for a stored result.
+// Only changes relative to the previously stored version are counted, so
+// storing the same result repeatedly does not inflate the numbers.
+func (s *NotificationService) recordStats(previous *NotificationResult, result NotificationResult) {
+	if previous != nil && previous.Status == result.Status {
+		return
+	}
+
+	ctx := context.Background()
+	key := s.getStatsRollupKey(result.TenantID, result.CreatedAt)
+
+	pipe := s.redis.TxPipeline()
+
+	if previous == nil {
+		pipe.HIncrBy(ctx, key, statsFieldTotal, 1)
+		pipe.HIncrBy(ctx, key, statsFieldType+result.Type, 1)
+		if result.Category != "" {
+			pipe.HIncrBy(ctx, key, statsFieldCategory+result.Category, 1)
+		}
+		if result.Priority != "" {
+			pipe.HIncrBy(ctx, key, statsFieldPriority+result.Priority, 1)
+		}
+	} else {
+		pipe.HIncrBy(ctx, key, statsFieldStatus+previous.Status, -1)
+		pipe.HIncrBy(ctx, key, statsFieldChannel+previous.Type+":"+previous.Status, -1)
+	}
+	pipe.HIncrBy(ctx, key, statsFieldStatus+result.Status, 1)
+	pipe.HIncrBy(ctx, key, statsFieldChannel+result.Type+":"+result.Status, 1)
+
+	// Deliveries written in a locale of the request or its template
+	if locale, ok := result.Metadata["locale"].(string); ok && locale != "" {
+		if previous != nil {
+			pipe.HIncrBy(ctx, key, statsFieldLocale+locale+":"+previous.Status, -1)
+		}
+		pipe.HIncrBy(ctx, key, statsFieldLocale+locale+":"+result.Status, 1)
+	}
+
+	if reason, ok := result.Metadata["suppression_reason"].(string); ok && result.Status == "suppressed" {
+		pipe.HIncrBy(ctx, key, statsFieldSuppression+reason, 1)
+	}
+
+	// Track delivery latency the first time a result becomes successful
+	if isSuccessStatus(result.Status) && (previous == nil || !isSuccessStatus(previous.Status)) && result.SentAt != nil {
+		latency := result.SentAt.Sub(result.CreatedAt)
+		if latency >= 0 {
+			pipe.HIncrBy(ctx, key, statsFieldDeliveryTime, latency.Milliseconds())
+			pipe.HIncrBy(ctx, key, statsFieldDeliveryCount, 1)
+		}
+	}
+
+	pipe.Expire(ctx, key, statsRetention)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to update notification statistics")
+	}
+}
+
+// recordFeedbackStats counts a bounce or complaint in the rollup of the day
+// the result it refers to was created
+func (s *NotificationService) recordFeedbackStats(result NotificationResult, kind string) {
+	ctx := context.Background()
+	key := s.getStatsRollupKey(result.TenantID, result.CreatedAt)
+
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, key, statsFieldFeedback+kind, 1)
+	pipe.Expire(ctx, key, statsRetention)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to update feedback statistics")
+	}
+}
+
+// calculateStats aggregates the daily rollups of the last days into statistics
+func (s *NotificationService) calculateStats(tenantID string, days int) (*NotificationStats, error) {
+	if days < 1 {
+		days = 1
+	}
+
+	stats := &NotificationStats{
+		ByType:              make(map[string]int),
+		ByCategory:          make(map[string]int),
+		ByPriority:          make(map[string]int),
+		ByDate:              make(map[string]int),
+		BySuppressionReason: make(map[string]int),
+		ByFeedback:          make(map[string]int),
+		ByLocale:            make(map[string]*LocaleStats),
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	var deliveryTime, deliveryCount int64
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i)
+
+		rollup, err := s.redis.HGetAll(ctx, s.getStatsRollupKey(tenantID, day)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get statistics rollup: %w", err)
+		}
+
+		date := day.Format("2006-01-02")
+		stats.ByDate[date] = 0
+
+		for field, value := range rollup {
+			count, _ := strconv.ParseInt(value, 10, 64)
+
+			switch {
+			case field == statsFieldTotal:
+				stats.Total += int(count)
+				stats.ByDate[date] = int(count)
+			case field == statsFieldDeliveryTime:
+				deliveryTime += count
+			case field == statsFieldDeliveryCount:
+				deliveryCount += count
+			case strings.HasPrefix(field, statsFieldStatus):
+				switch status := strings.TrimPrefix(field, statsFieldStatus); {
+				case isSuccessStatus(status):
+					stats.Sent += int(count)
+				case status == "failed":
+					stats.Failed += int(count)
+				case status == "pending":
+					stats.Pending += int(count)
+				case status == "suppressed":
+					stats.Suppressed += int(count)
+				}
+			case strings.HasPrefix(field, statsFieldSuppression):
+				stats.BySuppressionReason[strings.TrimPrefix(field, statsFieldSuppression)] += int(count)
+			case strings.HasPrefix(field, statsFieldLocale):
+				locale, status, ok := strings.Cut(strings.TrimPrefix(field, statsFieldLocale), ":")
+				if !ok {
+					continue
+				}
+				localeStats, ok := stats.ByLocale[locale]
+				if !ok {
+					localeStats = &LocaleStats{}
+					stats.ByLocale[locale] = localeStats
+				}
+				localeStats.Total += int(count)
+				switch {
+				case isSuccessStatus(status):
+					localeStats.Sent += int(count)
+				case status == "failed":
+					localeStats.Failed += int(count)
+				case status == "pending":
+					localeStats.Pending += int(count)
+				}
+			case strings.HasPrefix(field, statsFieldFeedback):
+				stats.ByFeedback[strings.TrimPrefix(field, statsFieldFeedback)] += int(count)
+			case strings.HasPrefix(field, statsFieldType):
+				stats.ByType[strings.TrimPrefix(field, statsFieldType)] += int(count)
+			case strings.HasPrefix(field, statsFieldCategory):
+				stats.ByCategory[strings.TrimPrefix(field, statsFieldCategory)] += int(count)
+			case strings.HasPrefix(field, statsFieldPriority):
+				stats.ByPriority[strings.TrimPrefix(field, statsFieldPriority)] += int(count)
+			}
+		}
+	}
+
+	if stats.Total > 0 {
+		stats.SuccessRate = float64(stats.Sent) / float64(stats.Total) * 100
+	}
+	if deliveryCount > 0 {
+		// Average delivery time in seconds
+		stats.AverageTime = float64(deliveryTime) / float64(deliveryCount) / 1000
+	}
+
+	return stats, nil
+}
+
+// Redis key generators
+func (s *NotificationService) getStatsRollupKey(tenantID string, day time.Time) string {
+	if tenantID == "" {
+		tenantID = "global"
+	}
+	return fmt.Sprintf("notification_rollup:%s:%s", tenantID, day.UTC().Format("2006-01-02"))
+}
+
+// Helper functions
+func isSuccessStatus(status string) bool {
+	return status == "sent" || status == "delivered"
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/lock"
+)
+
+const (
+	// storageLockTTL is how long a cleanup run holds its lock without
+	// refreshing it
+	storageLockTTL = 1 * time.Minute
+
+	// storageScanCount is how many keys a scan step asks Redis for
+	storageScanCount = 500
+
+	// DefaultStorageReportLimit is how many keys a storage report scans when
+	// the caller sets no limit
+	DefaultStorageReportLimit = 100000
+)
+
+// StorageReport describes what the service keeps in Redis, by key prefix
+type StorageReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Keys        int64           `json:"keys"`
+	Bytes       int64           `json:"bytes"`
+	WithoutTTL  int64           `json:"without_ttl"`
+	Prefixes    []StoragePrefix `json:"prefixes"`
+	Truncated   bool            `json:"truncated"` // the scan stopped at its limit, the counts are a lower bound
+	LastCleanup *StorageCleanup `json:"last_cleanup,omitempty"`
+}
+
+// StoragePrefix is the usage of the keys sharing a prefix, the part of a key
+// before its first colon
+type StoragePrefix struct {
+	Prefix     string `json:"prefix"`
+	Keys       int64  `json:"keys"`
+	Bytes      int64  `json:"bytes"`       // as reported by MEMORY USAGE, 0 where Redis doesn't support it
+	WithoutTTL int64  `json:"without_ttl"` // keys that never expire
+}
+
+// StorageCleanup reports what a cleanup run removed
+type StorageCleanup struct {
+	RanAt          time.Time `json:"ran_at"`
+	IndexEntries   int64     `json:"index_entries"`   // entries of indexes pointing at expired records
+	OrphanedKeys   int64     `json:"orphaned_keys"`   // keys of records whose owner is gone
+	ExpiredEntries int64     `json:"expired_entries"` // entries older than the retention of their index
+	Error          string    `json:"error,omitempty"`
+}
+
+// StorageReport counts the keys in Redis and their memory by prefix. It scans
+// at most limit keys.
+func (s *NotificationService) StorageReport(limit int) (*StorageReport, error) {
+	if limit <= 0 {
+		limit = DefaultStorageReportLimit
+	}
+
+	ctx := context.Background()
+	prefixes := make(map[string]*StoragePrefix)
+	report := &StorageReport{GeneratedAt: time.Now()}
+
+	var cursor uint64
+	for {
+		keys, next, err := s.redis.Scan(ctx, cursor, "*", storageScanCount).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan keys: %w", err)
+		}
+		if remaining := int64(limit) - report.Keys; int64(len(keys)) > remaining {
+			keys = keys[:remaining]
+			report.Truncated = true
+		}
+
+		// Redis versions without MEMORY USAGE fail only those commands
+		pipe := s.redis.Pipeline()
+		ttls := make([]*redis.DurationCmd, len(keys))
+		sizes := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			ttls[i] = pipe.TTL(ctx, key)
+			sizes[i] = pipe.MemoryUsage(ctx, key)
+		}
+		pipe.Exec(ctx)
+
+		for i, key := range keys {
+			ttl, err := ttls[i].Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get key TTL: %w", err)
+			}
+			if ttl == -2 {
+				// Expired since the scan
+				continue
+			}
+
+			prefix := storagePrefix(key)
+			usage, ok := prefixes[prefix]
+			if !ok {
+				usage = &StoragePrefix{Prefix: prefix}
+				prefixes[prefix] = usage
+			}
+
+			usage.Keys++
+			report.Keys++
+			if ttl < 0 {
+				usage.WithoutTTL++
+				report.WithoutTTL++
+			}
+			if size, err := sizes[i].Result(); err == nil {
+				usage.Bytes += size
+				report.Bytes += size
+			}
+		}
+
+		cursor = next
+		if cursor == 0 || report.Truncated {
+			break
+		}
+	}
+
+	report.Prefixes = make([]StoragePrefix, 0, len(prefixes))
+	for _, usage := range prefixes {
+		report.Prefixes = append(report.Prefixes, *usage)
+	}
+	sort.Slice(report.Prefixes, func(i, j int) bool {
+		if report.Prefixes[i].Bytes != report.Prefixes[j].Bytes {
+			return report.Prefixes[i].Bytes > report.Prefixes[j].Bytes
+		}
+		if report.Prefixes[i].Keys != report.Prefixes[j].Keys {
+			return report.Prefixes[i].Keys > report.Prefixes[j].Keys
+		}
+		return report.Prefixes[i].Prefix < report.Prefixes[j].Prefix
+	})
+
+	lastCleanup, err := s.lastStorageCleanup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.LastCleanup = lastCleanup
+
+	return report, nil
+}
+
+// startStorageJob periodically removes what expired records left behind
+func (s *NotificationService) startStorageJob() {
+	log.Info().Dur("interval", s.config.CleanupInterval).Msg("Storage cleanup job started")
+
+	ticker := time.NewTicker(s.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Storage cleanup job stopped")
+			return
+		case <-ticker.C:
+			s.runStorageCleanup()
+		}
+	}
+}
+
+// runStorageCleanup cleans up storage on the leader, the lock keeps a run
+// from overlapping one started before the leadership moved
+func (s *NotificationService) runStorageCleanup() {
+	if !s.IsLeader() {
+		return
+	}
+
+	if _, err := s.CleanupStorage(); err != nil && !errors.Is(err, ErrConflict) {
+		log.Error().Err(err).Msg("Failed to clean up storage")
+	}
+}
+
+// CleanupStorage removes the index entries of expired in-app notifications
+// and webhook deliveries, deliveries older than their retention and the
+// records of deleted webhook endpoints
+func (s *NotificationService) CleanupStorage() (*StorageCleanup, error) {
+	cleanup := &StorageCleanup{RanAt: time.Now()}
+
+	var cleanupErr error
+	err := lock.Do(s.ctx, s.redis, s.getStorageLockKey(), storageLockTTL, func(ctx context.Context) {
+		for _, step := range []func(context.Context, *StorageCleanup) error{
+			s.inAppService.pruneIndexes,
+			s.webhookService.pruneDeliveries,
+			s.webhookService.pruneEndpointState,
+		} {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := step(ctx, cleanup); err != nil {
+				cleanupErr = err
+				return
+			}
+		}
+	})
+	if errors.Is(err, lock.ErrLocked) {
+		return nil, conflictf("a storage cleanup is already running")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock storage cleanup: %w", err)
+	}
+	if cleanupErr != nil {
+		cleanup.Error = cleanupErr.Error()
+	}
+
+	ctx := context.Background()
+	if err := s.redis.HSet(ctx, s.getStorageCleanupKey(),
+		"ran_at", cleanup.RanAt.Unix(),
+		"index_entries", cleanup.IndexEntries,
+		"orphaned_keys", cleanup.OrphanedKeys,
+		"expired_entries", cleanup.ExpiredEntries,
+		"error", cleanup.Error,
+	).Err(); err != nil {
+		log.Warn().Err(err).Msg("Failed to record storage cleanup")
+	}
+
+	log.Info().
+		Int64("indexEntries", cleanup.IndexEntries).
+		Int64("orphanedKeys", cleanup.OrphanedKeys).
+		Int64("expiredEntries", cleanup.ExpiredEntries).
+		Msg("Storage cleaned up")
+
+	return cleanup, cleanupErr
+}
+
+// lastStorageCleanup returns what the last cleanup run removed, nil before
+// the first run
+func (s *NotificationService) lastStorageCleanup(ctx context.Context) (*StorageCleanup, error) {
+	values, err := s.redis.HGetAll(ctx, s.getStorageCleanupKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last storage cleanup: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	cleanup := &StorageCleanup{Error: values["error"]}
+	if unix, err := strconv.ParseInt(values["ran_at"], 10, 64); err == nil {
+		cleanup.RanAt = time.Unix(unix, 0)
+	}
+	cleanup.IndexEntries, _ = strconv.ParseInt(values["index_entries"], 10, 64)
+	cleanup.OrphanedKeys, _ = strconv.ParseInt(values["orphaned_keys"], 10, 64)
+	cleanup.ExpiredEntries, _ = strconv.ParseInt(values["expired_entries"], 10, 64)
+
+	return cleanup, nil
+}
+
+// pruneIndexes removes the notifications that expired from the lists,
+// unread sets and category indexes they were added to
+func (s *InAppNotificationService) pruneIndexes(ctx context.Context, cleanup *StorageCleanup) error {
+	for _, index := range []struct {
+		pattern string
+		keyType string
+	}{
+		{s.getUserNotificationsKey("*", "*"), "zset"},
+		{s.getUnreadKey("*", "*"), "set"},
+		{s.getCategoryKey("*", "*"), "zset"},
+		{s.getEntityKey("*", "*", "*"), "zset"},
+	} {
+		err := scanKeys(ctx, s.redis, index.pattern, index.keyType, func(key string) error {
+			removed, err := pruneIndex(ctx, s.redis, key, index.keyType, s.getNotificationKey)
+			cleanup.IndexEntries += removed
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneDeliveries trims the delivery indexes of webhook endpoints to their
+// retention, dropping the indexes and deliveries of deleted endpoints
+func (s *WebhookService) pruneDeliveries(ctx context.Context, cleanup *StorageCleanup) error {
+	cutoff := strconv.FormatInt(time.Now().Add(-s.config.DeliveryTTL).Unix(), 10)
+
+	return scanKeys(ctx, s.redis, s.getEndpointDeliveriesKey("*"), "zset", func(key string) error {
+		endpointID := strings.TrimPrefix(key, s.getEndpointDeliveriesKey(""))
+
+		exists, err := s.redis.Exists(ctx, s.getEndpointKey(endpointID)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to check webhook endpoint: %w", err)
+		}
+		if exists == 0 {
+			deliveryIDs, err := s.redis.ZRange(ctx, key, 0, -1).Result()
+			if err != nil {
+				return fmt.Errorf("failed to get webhook deliveries: %w", err)
+			}
+			keys := []string{key}
+			for _, id := range deliveryIDs {
+				keys = append(keys, s.getDeliveryKey(id))
+			}
+			deleted, err := s.redis.Del(ctx, keys...).Result()
+			if err != nil {
+				return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+			}
+			cleanup.OrphanedKeys += deleted
+			return nil
+		}
+
+		// Deliveries written before they had a TTL are deleted with their entry
+		expiredIDs, err := s.redis.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: cutoff}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get expired webhook deliveries: %w", err)
+		}
+		if len(expiredIDs) > 0 {
+			pipe := s.redis.TxPipeline()
+			for _, id := range expiredIDs {
+				pipe.Del(ctx, s.getDeliveryKey(id))
+			}
+			trimmed := pipe.ZRemRangeByScore(ctx, key, "-inf", cutoff)
+			if _, err := pipe.Exec(ctx); err != nil {
+				return fmt.Errorf("failed to trim webhook deliveries: %w", err)
+			}
+			cleanup.ExpiredEntries += trimmed.Val()
+		}
+
+		removed, err := pruneIndex(ctx, s.redis, key, "zset", s.getDeliveryKey)
+		cleanup.IndexEntries += removed
+		return err
+	})
+}
+
+// pruneEndpointState deletes the failure state of deleted webhook endpoints
+func (s *WebhookService) pruneEndpointState(ctx context.Context, cleanup *StorageCleanup) error {
+	return scanKeys(ctx, s.redis, s.getEndpointStateKey("*"), "hash", func(key string) error {
+		endpointID := strings.TrimPrefix(key, s.getEndpointStateKey(""))
+
+		exists, err := s.redis.Exists(ctx, s.getEndpointKey(endpointID)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to check webhook endpoint: %w", err)
+		}
+		if exists > 0 {
+			return nil
+		}
+
+		deleted, err := s.redis.Del(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to delete webhook endpoint state: %w", err)
+		}
+		cleanup.OrphanedKeys += deleted
+		return nil
+	})
+}
+
+// Redis key generators
+func (s *NotificationService) getStorageLockKey() string {
+	return "storage_cleanup_lock"
+}
+
+func (s *NotificationService) getStorageCleanupKey() string {
+	return "storage_cleanup"
+}
+
+// Helper functions
+
+// scanKeys calls fn for every key of a type matching a pattern
+func scanKeys(ctx context.Context, client *redis.Client, pattern string, keyType string, fn func(key string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.ScanType(ctx, cursor, pattern, storageScanCount, keyType).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", pattern, err)
+		}
+
+		for _, key := range keys {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// pruneIndex removes the members of a set or sorted set whose record, named
+// by recordKey, no longer exists. It returns how many were removed.
+func pruneIndex(ctx context.Context, client *redis.Client, key string, keyType string, recordKey func(id string) string) (int64, error) {
+	var removed int64
+	var cursor uint64
+	for {
+		var members []string
+		var next uint64
+		var err error
+		if keyType == "zset" {
+			var pairs []string
+			pairs, next, err = client.ZScan(ctx, key, cursor, "", storageScanCount).Result()
+			// ZSCAN returns members and scores in turn
+			for i := 0; i < len(pairs); i += 2 {
+				members = append(members, pairs[i])
+			}
+		} else {
+			members, next, err = client.SScan(ctx, key, cursor, "", storageScanCount).Result()
+		}
+		if err != nil {
+			return removed, fmt.Errorf("failed to scan %s: %w", key, err)
+		}
+
+		pipe := client.Pipeline()
+		exists := make([]*redis.IntCmd, len(members))
+		for i, member := range members {
+			exists[i] = pipe.Exists(ctx, recordKey(member))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return removed, fmt.Errorf("failed to check records of %s: %w", key, err)
+		}
+
+		var stale []interface{}
+		for i, member := range members {
+			if exists[i].Val() == 0 {
+				stale = append(stale, member)
+			}
+		}
+		if len(stale) > 0 {
+			var count int64
+			if keyType == "zset" {
+				count, err = client.ZRem(ctx, key, stale...).Result()
+			} else {
+				count, err = client.SRem(ctx, key, stale...).Result()
+			}
+			if err != nil {
+				return removed, fmt.Errorf("failed to prune %s: %w", key, err)
+			}
+			removed += count
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// storagePrefix returns the prefix a key is reported under
+func storagePrefix(key string) string {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
@@ -1,21 +1,30 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"html/template"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
 )
 
+// maxTemplateDepth limits how many ancestors a template can inherit from
+const maxTemplateDepth = 5
+
+// templateFieldPattern matches the data key a template action references
+var templateFieldPattern = regexp.MustCompile(`^\.([A-Za-z_][A-Za-z0-9_]*)`)
+
 // TemplateService handles notification templates
 type TemplateService struct {
 	redis  *redis.Client
+	store  TemplateStore
+	cache  *templateCache
 	config TemplateConfig
 }
 
@@ -25,8 +34,9 @@ type TemplateConfig struct {
 	RedisPassword string
 	RedisDB       int
 	DefaultLocale string
-	CacheTTL      time.Duration
+	CacheTTL      time.Duration // how long templates are cached in memory
 	MaxTemplates  int
+	MaxOutputSize int // bytes a rendered field may have
 }
 
 // TemplateVariable represents a template variable
@@ -41,6 +51,7 @@ type TemplateVariable struct {
 
 // TemplateRenderResult represents the result of rendering a template
 type TemplateRenderResult struct {
+	Version   int               `json:"version"` // the version of the template rendered
 	Subject   string            `json:"subject"`
 	Title     string            `json:"title"`
 	Message   string            `json:"message"`
@@ -66,29 +77,13 @@ type TemplateCategory struct {
 
 // NewTemplateService creates a new template service instance
 func NewTemplateService(config TemplateConfig) (*TemplateService, error) {
-	// Parse Redis URL
-	redisOpts, err := redis.ParseURL(config.RedisURL)
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
-	}
-
-	// Override with config values
-	if config.RedisPassword != "" {
-		redisOpts.Password = config.RedisPassword
-	}
-	if config.RedisDB != 0 {
-		redisOpts.DB = config.RedisDB
-	}
-
-	// Create Redis client
-	redisClient := redis.NewClient(redisOpts)
-
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		return nil, err
 	}
 
 	// Set default values
@@ -102,14 +97,23 @@ func NewTemplateService(config TemplateConfig) (*TemplateService, error) {
 		config.MaxTemplates = 1000
 	}
 
+	store := &redisTemplateStore{redis: redisClient}
+	if persisted, err := store.persistTemplates(context.Background()); err != nil {
+		log.Warn().Err(err).Msg("Failed to remove the expiry of stored templates")
+	} else if persisted > 0 {
+		log.Info().Int("count", persisted).Msg("Removed the expiry of stored templates")
+	}
+
 	return &TemplateService{
 		redis:  redisClient,
+		store:  store,
+		cache:  newTemplateCache(config.CacheTTL),
 		config: config,
 	}, nil
 }
 
 // CreateTemplate creates a new notification template
-func (s *TemplateService) CreateTemplate(template NotificationTemplate) (*NotificationTemplate, error) {
+func (s *TemplateService) CreateTemplate(ctx context.Context, template NotificationTemplate) (*NotificationTemplate, error) {
 	log.Info().
 		Str("name", template.Name).
 		Str("type", template.Type).
@@ -118,23 +122,33 @@ func (s *TemplateService) CreateTemplate(template NotificationTemplate) (*Notifi
 
 	// Validate template
 	if err := s.validateTemplate(template); err != nil {
-		return nil, fmt.Errorf("template validation failed: %w", err)
+		return nil, invalid(fmt.Errorf("template validation failed: %w", err))
 	}
 
 	// Set default values
 	if template.ID == "" {
 		template.ID = generateTemplateID()
 	}
+	if err := s.validateParent(template); err != nil {
+		return nil, err
+	}
 	if template.CreatedAt.IsZero() {
 		template.CreatedAt = time.Now()
 	}
 	template.UpdatedAt = time.Now()
-	if template.Version == 0 {
-		template.Version = 1
-	}
+	template.Version = 1
+	template.PublishedVersion = 0
+	template.PublishedAt = nil
+
+	// Templates are published right away unless created as drafts
+	publish := template.Status != TemplateStatusDraft
+	template.Status = TemplateStatusDraft
 	if template.Locale == "" {
 		template.Locale = s.config.DefaultLocale
 	}
+	if err := s.validateVariantLocale(template); err != nil {
+		return nil, err
+	}
 	if template.Priority == "" {
 		template.Priority = "normal"
 	}
@@ -142,17 +156,9 @@ func (s *TemplateService) CreateTemplate(template NotificationTemplate) (*Notifi
 	// Extract variables from template
 	template.Variables = s.extractVariables(template)
 
-	// Store in Redis
-	ctx := context.Background()
-	key := s.getTemplateKey(template.ID)
-
-	templateJSON, err := json.Marshal(template)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal template: %w", err)
-	}
-
-	if err := s.redis.Set(ctx, key, templateJSON, s.config.CacheTTL).Err(); err != nil {
-		return nil, fmt.Errorf("failed to store template: %w", err)
+	// Store durably, templates never expire
+	if err := s.storeWorkingCopy(&template); err != nil {
+		return nil, err
 	}
 
 	// Add to templates index
@@ -191,35 +197,24 @@ func (s *TemplateService) CreateTemplate(template NotificationTemplate) (*Notifi
 		log.Error().Err(err).Msg("Failed to add template to locale index")
 	}
 
+	// Add to search index
+	if err := s.indexTemplateTerms(ctx, &template); err != nil {
+		log.Error().Err(err).Msg("Failed to add template to search index")
+	}
+
 	log.Info().
 		Str("templateID", template.ID).
 		Msg("Notification template created successfully")
 
-	return &template, nil
-}
-
-// GetTemplate gets a notification template by ID
-func (s *TemplateService) GetTemplate(templateID string) (*NotificationTemplate, error) {
-	ctx := context.Background()
-	key := s.getTemplateKey(templateID)
-
-	templateJSON, err := s.redis.Get(ctx, key).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("template not found: %s", templateID)
-		}
-		return nil, fmt.Errorf("failed to get template: %w", err)
-	}
-
-	var template NotificationTemplate
-	if err := json.Unmarshal([]byte(templateJSON), &template); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal template: %w", err)
+	if publish {
+		return s.PublishTemplate(template.ID)
 	}
 
 	return &template, nil
 }
 
-// GetTemplateByName gets a template by name and type
+// GetTemplateByName gets a template by name and type in a locale, falling
+// back to the tenant's and the service's default locale
 func (s *TemplateService) GetTemplateByName(name string, templateType string, tenantID string, locale string) (*NotificationTemplate, error) {
 	log.Info().
 		Str("name", name).
@@ -227,33 +222,11 @@ func (s *TemplateService) GetTemplateByName(name string, templateType string, te
 		Str("locale", locale).
 		Msg("Getting template by name")
 
-	// Get all templates for the type and tenant
-	templates, err := s.GetTemplatesByType(templateType, tenantID, 1, 100)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get templates by type: %w", err)
-	}
-
-	// Find template by name and locale
-	for _, template := range templates {
-		if template.Name == name && template.Locale == locale {
-			return template, nil
-		}
-	}
-
-	// If not found in specified locale, try default locale
-	if locale != s.config.DefaultLocale {
-		for _, template := range templates {
-			if template.Name == name && template.Locale == s.config.DefaultLocale {
-				return template, nil
-			}
-		}
-	}
-
-	return nil, fmt.Errorf("template not found: %s (type: %s, locale: %s)", name, templateType, locale)
+	return s.ResolveTemplate(name, templateType, tenantID, locale)
 }
 
 // UpdateTemplate updates a notification template
-func (s *TemplateService) UpdateTemplate(templateID string, updates map[string]interface{}) (*NotificationTemplate, error) {
+func (s *TemplateService) UpdateTemplate(ctx context.Context, templateID string, updates map[string]interface{}) (*NotificationTemplate, error) {
 	log.Info().
 		Str("templateID", templateID).
 		Msg("Updating notification template")
@@ -262,10 +235,23 @@ func (s *TemplateService) UpdateTemplate(templateID string, updates map[string]i
 	if err != nil {
 		return nil, fmt.Errorf("failed to get template: %w", err)
 	}
+	previous := *template
+
+	// Content edits of a published version start the next version as a
+	// draft, the published one stays in use until the draft is published
+	if hasContentUpdates(updates) {
+		published, err := s.versionExists(template.ID, template.Version)
+		if err != nil {
+			return nil, err
+		}
+		if published {
+			template.Version++
+		}
+		template.Status = TemplateStatusDraft
+	}
 
 	// Apply updates
 	template.UpdatedAt = time.Now()
-	template.Version++
 
 	// Update fields based on updates map
 	if name, ok := updates["name"].(string); ok {
@@ -310,21 +296,64 @@ func (s *TemplateService) UpdateTemplate(templateID string, updates map[string]i
 	if metadata, ok := updates["metadata"].(map[string]interface{}); ok {
 		template.Metadata = metadata
 	}
+	if raw, ok := updates["variable_definitions"]; ok {
+		definitionsJSON, err := json.Marshal(raw)
+		if err != nil {
+			return nil, invalid(fmt.Errorf("invalid variable definitions: %w", err))
+		}
+		var definitions []TemplateVariable
+		if err := json.Unmarshal(definitionsJSON, &definitions); err != nil {
+			return nil, invalid(fmt.Errorf("invalid variable definitions: %w", err))
+		}
+		if err := validateVariableDefinitions(definitions); err != nil {
+			return nil, invalid(fmt.Errorf("template validation failed: %w", err))
+		}
+		template.Definitions = definitions
+	}
+	if parentID, ok := updates["parent_id"].(string); ok {
+		template.ParentID = parentID
+		if err := s.validateParent(*template); err != nil {
+			return nil, err
+		}
+	}
+
+	// Renamed or relocalized templates must not clash with another variant
+	if template.Name != previous.Name || template.Type != previous.Type || !sameLocale(template.Locale, previous.Locale) {
+		if err := s.validateVariantLocale(*template); err != nil {
+			return nil, err
+		}
+	}
 
 	// Re-extract variables
 	template.Variables = s.extractVariables(*template)
 
 	// Store updated template
-	ctx := context.Background()
-	key := s.getTemplateKey(templateID)
-
-	templateJSON, err := json.Marshal(template)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal template: %w", err)
+	if err := s.storeWorkingCopy(template); err != nil {
+		return nil, err
 	}
 
-	if err := s.redis.Set(ctx, key, templateJSON, s.config.CacheTTL).Err(); err != nil {
-		return nil, fmt.Errorf("failed to update template: %w", err)
+	// Move the template between the indices it changed
+	score := float64(template.CreatedAt.Unix())
+	reindex := []struct {
+		from, to string
+	}{
+		{s.getTypeTemplatesKey(previous.Type, template.TenantID), s.getTypeTemplatesKey(template.Type, template.TenantID)},
+		{s.getCategoryTemplatesKey(previous.Category, template.TenantID), s.getCategoryTemplatesKey(template.Category, template.TenantID)},
+		{s.getLocaleTemplatesKey(previous.Locale, template.TenantID), s.getLocaleTemplatesKey(template.Locale, template.TenantID)},
+	}
+	for _, index := range reindex {
+		if index.from == index.to {
+			continue
+		}
+		if err := s.redis.ZRem(ctx, index.from, templateID).Err(); err != nil {
+			log.Error().Err(err).Msg("Failed to remove template from index")
+		}
+		if err := s.redis.ZAdd(ctx, index.to, &redis.Z{Score: score, Member: templateID}).Err(); err != nil {
+			log.Error().Err(err).Msg("Failed to add template to index")
+		}
+	}
+	if err := s.indexTemplateTerms(ctx, template); err != nil {
+		log.Error().Err(err).Msg("Failed to update template search index")
 	}
 
 	log.Info().
@@ -336,7 +365,7 @@ func (s *TemplateService) UpdateTemplate(templateID string, updates map[string]i
 }
 
 // DeleteTemplate deletes a notification template
-func (s *TemplateService) DeleteTemplate(templateID string) error {
+func (s *TemplateService) DeleteTemplate(ctx context.Context, templateID string) error {
 	log.Info().
 		Str("templateID", templateID).
 		Msg("Deleting notification template")
@@ -346,12 +375,9 @@ func (s *TemplateService) DeleteTemplate(templateID string) error {
 		return fmt.Errorf("failed to get template: %w", err)
 	}
 
-	ctx := context.Background()
-
-	// Remove from Redis
-	key := s.getTemplateKey(templateID)
-	if err := s.redis.Del(ctx, key).Err(); err != nil {
-		return fmt.Errorf("failed to delete template: %w", err)
+	// Remove from the store and the cache
+	if err := s.removeTemplate(templateID); err != nil {
+		return err
 	}
 
 	// Remove from indices
@@ -375,6 +401,14 @@ func (s *TemplateService) DeleteTemplate(templateID string) error {
 		log.Error().Err(err).Msg("Failed to remove template from locale index")
 	}
 
+	if err := s.unindexTemplateTerms(ctx, template); err != nil {
+		log.Error().Err(err).Msg("Failed to remove template from search index")
+	}
+
+	if err := s.deleteVersions(templateID); err != nil {
+		log.Error().Err(err).Msg("Failed to remove template versions")
+	}
+
 	log.Info().
 		Str("templateID", templateID).
 		Msg("Notification template deleted")
@@ -382,17 +416,34 @@ func (s *TemplateService) DeleteTemplate(templateID string) error {
 	return nil
 }
 
-// GetTemplatesByType gets templates by type
-func (s *TemplateService) GetTemplatesByType(templateType string, tenantID string, page int, limit int) ([]*NotificationTemplate, error) {
-	ctx := context.Background()
-	typeKey := s.getTypeTemplatesKey(templateType, tenantID)
+// ListTemplates gets the templates of a tenant, newest first
+func (s *TemplateService) ListTemplates(ctx context.Context, tenantID string, page int, limit int) ([]*NotificationTemplate, error) {
+	// Calculate pagination
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
 
-	// Get total count
-	total, err := s.redis.ZCard(ctx, typeKey).Result()
+	templateIDs, err := s.redis.ZRevRange(ctx, s.getTemplatesKey(tenantID), start, stop).Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get template count: %w", err)
+		return nil, fmt.Errorf("failed to get template IDs: %w", err)
 	}
 
+	var templates []*NotificationTemplate
+	for _, id := range templateIDs {
+		template, err := s.GetTemplate(id)
+		if err != nil {
+			log.Warn().Err(err).Str("templateID", id).Msg("Failed to get template")
+			continue
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, nil
+}
+
+// GetTemplatesByType gets templates by type
+func (s *TemplateService) GetTemplatesByType(ctx context.Context, templateType string, tenantID string, page int, limit int) ([]*NotificationTemplate, error) {
+	typeKey := s.getTypeTemplatesKey(templateType, tenantID)
+
 	// Calculate pagination
 	start := int64((page - 1) * limit)
 	stop := start + int64(limit) - 1
@@ -418,16 +469,9 @@ func (s *TemplateService) GetTemplatesByType(templateType string, tenantID strin
 }
 
 // GetTemplatesByCategory gets templates by category
-func (s *TemplateService) GetTemplatesByCategory(category string, tenantID string, page int, limit int) ([]*NotificationTemplate, error) {
-	ctx := context.Background()
+func (s *TemplateService) GetTemplatesByCategory(ctx context.Context, category string, tenantID string, page int, limit int) ([]*NotificationTemplate, error) {
 	categoryKey := s.getCategoryTemplatesKey(category, tenantID)
 
-	// Get total count
-	total, err := s.redis.ZCard(ctx, categoryKey).Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get template count: %w", err)
-	}
-
 	// Calculate pagination
 	start := int64((page - 1) * limit)
 	stop := start + int64(limit) - 1
@@ -452,7 +496,8 @@ func (s *TemplateService) GetTemplatesByCategory(category string, tenantID strin
 	return templates, nil
 }
 
-// RenderTemplate renders a template with data
+// RenderTemplate renders the published version of a template with data, so
+// edits that aren't published yet never reach notifications
 func (s *TemplateService) RenderTemplate(templateID string, data map[string]interface{}) (*TemplateRenderResult, error) {
 	log.Info().
 		Str("templateID", templateID).
@@ -467,65 +512,88 @@ func (s *TemplateService) RenderTemplate(templateID string, data map[string]inte
 		return nil, fmt.Errorf("template %s is not active", templateID)
 	}
 
-	// Validate required variables
-	missingVars := s.validateRequiredVariables(template, data)
-	if len(missingVars) > 0 {
-		return nil, fmt.Errorf("missing required variables: %v", missingVars)
+	published, err := s.publishedVersion(template)
+	if err != nil {
+		return nil, err
 	}
 
-	// Render template
-	result := &TemplateRenderResult{
-		Variables: make(map[string]string),
+	return s.render(published, data)
+}
+
+// RenderDraft renders the working copy of a template, to preview edits
+// before they are published
+func (s *TemplateService) RenderDraft(templateID string, data map[string]interface{}) (*TemplateRenderResult, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
 	}
 
-	// Render subject
-	if template.Subject != "" {
-		subject, err := s.renderString(template.Subject, data)
-		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("subject render error: %v", err))
-		} else {
-			result.Subject = subject
-		}
+	return s.render(template, data)
+}
+
+// render renders a version of a template with data
+func (s *TemplateService) render(template *NotificationTemplate, data map[string]interface{}) (*TemplateRenderResult, error) {
+	// Defined variables are checked by type and get their defaults
+	data, err := applyVariableDefinitions(template.Definitions, data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Render title
-	if template.Title != "" {
-		title, err := s.renderString(template.Title, data)
-		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("title render error: %v", err))
-		} else {
-			result.Title = title
+	// Validate required variables
+	missingVars := s.validateRequiredVariables(template, data)
+	if len(missingVars) > 0 {
+		missing := &VariablesError{}
+		for _, name := range missingVars {
+			missing.Errors = append(missing.Errors, missingVariable(name))
 		}
+		return nil, missing
 	}
 
-	// Render message
-	if template.Message != "" {
-		message, err := s.renderString(template.Message, data)
-		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("message render error: %v", err))
-		} else {
-			result.Message = message
-		}
+	// Each field is rendered from the template and the published versions of
+	// the ancestors it inherits
+	chain, err := s.templateChain(template, s.GetPublishedTemplate)
+	if err != nil {
+		return nil, err
 	}
+	renderData := s.withBranding(template.TenantID, data)
+	funcs := templateFuncs(helperContext{locale: template.Locale, priority: template.Priority})
 
-	// Render HTML body
-	if template.HTMLBody != "" {
-		htmlBody, err := s.renderString(template.HTMLBody, data)
-		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("HTML body render error: %v", err))
-		} else {
-			result.HTMLBody = htmlBody
-		}
+	// Render template
+	result := &TemplateRenderResult{
+		Version:   template.Version,
+		Variables: make(map[string]string),
 	}
 
-	// Render text body
-	if template.TextBody != "" {
-		textBody, err := s.renderString(template.TextBody, data)
+	fields := []struct {
+		name   string
+		value  func(t *NotificationTemplate) string
+		target *string
+		html   bool
+	}{
+		{"subject", func(t *NotificationTemplate) string { return t.Subject }, &result.Subject, false},
+		{"title", func(t *NotificationTemplate) string { return t.Title }, &result.Title, false},
+		{"message", func(t *NotificationTemplate) string { return t.Message }, &result.Message, false},
+		{"HTML body", func(t *NotificationTemplate) string { return t.HTMLBody }, &result.HTMLBody, true},
+		{"text body", func(t *NotificationTemplate) string { return t.TextBody }, &result.TextBody, false},
+	}
+
+	for _, field := range fields {
+		var layers []string
+		for _, t := range chain {
+			if value := field.value(t); value != "" {
+				layers = append(layers, value)
+			}
+		}
+		if len(layers) == 0 {
+			continue
+		}
+
+		rendered, err := s.renderString(layers, renderData, field.html, funcs)
 		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("text body render error: %v", err))
-		} else {
-			result.TextBody = textBody
+			result.Errors = append(result.Errors, fmt.Sprintf("%s render error: %v", field.name, err))
+			continue
 		}
+		*field.target = rendered
 	}
 
 	// Store variables for reference
@@ -538,7 +606,8 @@ func (s *TemplateService) RenderTemplate(templateID string, data map[string]inte
 	}
 
 	log.Info().
-		Str("templateID", templateID).
+		Str("templateID", template.ID).
+		Int("version", template.Version).
 		Int("errorCount", len(result.Errors)).
 		Msg("Template rendered")
 
@@ -546,14 +615,14 @@ func (s *TemplateService) RenderTemplate(templateID string, data map[string]inte
 }
 
 // CreateCategory creates a new template category
-func (s *TemplateService) CreateCategory(category TemplateCategory) (*TemplateCategory, error) {
+func (s *TemplateService) CreateCategory(ctx context.Context, category TemplateCategory) (*TemplateCategory, error) {
 	log.Info().
 		Str("name", category.Name).
 		Msg("Creating template category")
 
 	// Validate category
 	if err := s.validateCategory(category); err != nil {
-		return nil, fmt.Errorf("category validation failed: %w", err)
+		return nil, invalid(fmt.Errorf("category validation failed: %w", err))
 	}
 
 	// Set default values
@@ -566,7 +635,6 @@ func (s *TemplateService) CreateCategory(category TemplateCategory) (*TemplateCa
 	category.UpdatedAt = time.Now()
 
 	// Store in Redis
-	ctx := context.Background()
 	key := s.getCategoryKey(category.ID)
 
 	categoryJSON, err := json.Marshal(category)
@@ -595,14 +663,13 @@ func (s *TemplateService) CreateCategory(category TemplateCategory) (*TemplateCa
 }
 
 // GetCategory gets a template category by ID
-func (s *TemplateService) GetCategory(categoryID string) (*TemplateCategory, error) {
-	ctx := context.Background()
+func (s *TemplateService) GetCategory(ctx context.Context, categoryID string) (*TemplateCategory, error) {
 	key := s.getCategoryKey(categoryID)
 
 	categoryJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("category not found: %s", categoryID)
+			return nil, notFoundf("category not found: %s", categoryID)
 		}
 		return nil, fmt.Errorf("failed to get category: %w", err)
 	}
@@ -616,8 +683,7 @@ func (s *TemplateService) GetCategory(categoryID string) (*TemplateCategory, err
 }
 
 // GetCategories gets all template categories
-func (s *TemplateService) GetCategories(tenantID string) ([]*TemplateCategory, error) {
-	ctx := context.Background()
+func (s *TemplateService) GetCategories(ctx context.Context, tenantID string) ([]*TemplateCategory, error) {
 	categoriesKey := s.getCategoriesKey(tenantID)
 
 	// Get category IDs
@@ -629,7 +695,7 @@ func (s *TemplateService) GetCategories(tenantID string) ([]*TemplateCategory, e
 	// Get category details
 	var categories []*TemplateCategory
 	for _, id := range categoryIDs {
-		category, err := s.GetCategory(id)
+		category, err := s.GetCategory(ctx, id)
 		if err != nil {
 			log.Warn().Err(err).Str("categoryID", id).Msg("Failed to get category")
 			continue
@@ -672,13 +738,67 @@ func (s *TemplateService) validateTemplate(template NotificationTemplate) error
 		return fmt.Errorf("template category is required")
 	}
 
-	if template.Message == "" && template.HTMLBody == "" && template.TextBody == "" {
+	// Templates inheriting from a parent may leave every format to it
+	if template.Message == "" && template.HTMLBody == "" && template.TextBody == "" && template.ParentID == "" {
 		return fmt.Errorf("at least one message format is required")
 	}
 
+	if err := validateVariableDefinitions(template.Definitions); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// validateParent checks that a template can inherit from its parent: the
+// parent is global or of the same tenant, of the same type, and doesn't
+// inherit from the template itself
+func (s *TemplateService) validateParent(template NotificationTemplate) error {
+	if template.ParentID == "" {
+		return nil
+	}
+
+	parent, err := s.GetTemplate(template.ParentID)
+	if err != nil {
+		return fmt.Errorf("failed to get parent template: %w", err)
+	}
+	if parent.TenantID != "" && parent.TenantID != template.TenantID {
+		return invalid(fmt.Errorf("parent template %s belongs to another tenant", parent.ID))
+	}
+	if parent.Type != template.Type {
+		return invalid(fmt.Errorf("parent template %s is a %s template, not %s", parent.ID, parent.Type, template.Type))
+	}
+
+	_, err = s.templateChain(&template, s.GetTemplate)
+	return err
+}
+
+// templateChain returns a template after the ancestors it inherits from,
+// the root first, getting each ancestor with get
+func (s *TemplateService) templateChain(template *NotificationTemplate, get func(templateID string) (*NotificationTemplate, error)) ([]*NotificationTemplate, error) {
+	chain := []*NotificationTemplate{template}
+	seen := map[string]bool{template.ID: true}
+
+	for current := template; current.ParentID != ""; {
+		if seen[current.ParentID] {
+			return nil, invalid(fmt.Errorf("template %s inherits from itself", template.ID))
+		}
+		if len(chain) > maxTemplateDepth {
+			return nil, invalid(fmt.Errorf("template %s inherits more than %d levels", template.ID, maxTemplateDepth))
+		}
+
+		parent, err := get(current.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent template: %w", err)
+		}
+		seen[parent.ID] = true
+		chain = append([]*NotificationTemplate{parent}, chain...)
+		current = parent
+	}
+
+	return chain, nil
+}
+
 // validateCategory validates a template category
 func (s *TemplateService) validateCategory(category TemplateCategory) error {
 	if category.Name == "" {
@@ -738,10 +858,12 @@ func (s *TemplateService) extractVariablesFromString(text string) []string {
 		}
 		endIdx += startIdx
 
+		// Only plain references like {{.Name}} require data, actions such as
+		// {{define}} and the injected .Brand don't
 		if endIdx > startIdx+2 {
 			variable := strings.TrimSpace(text[startIdx+2 : endIdx])
-			if variable != "" {
-				variables = append(variables, variable)
+			if match := templateFieldPattern.FindStringSubmatch(variable); match != nil && match[1] != "Brand" {
+				variables = append(variables, match[1])
 			}
 		}
 
@@ -764,28 +886,7 @@ func (s *TemplateService) validateRequiredVariables(template *NotificationTempla
 	return missing
 }
 
-// renderString renders a template string with data
-func (s *TemplateService) renderString(templateStr string, data map[string]interface{}) (string, error) {
-	// Create a new template
-	tmpl, err := template.New("").Parse(templateStr)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
-	}
-
-	// Execute template
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
-	}
-
-	return buf.String(), nil
-}
-
 // Redis key generators
-func (s *TemplateService) getTemplateKey(templateID string) string {
-	return fmt.Sprintf("template:%s", templateID)
-}
-
 func (s *TemplateService) getTemplatesKey(tenantID string) string {
 	if tenantID == "" {
 		return "templates:global"
@@ -827,5 +928,5 @@ func (s *TemplateService) getCategoriesKey(tenantID string) string {
 
 // Helper functions
 func generateCategoryID() string {
-	return fmt.Sprintf("cat_%d", time.Now().UnixNano())
+	return newID("cat")
 }
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateBranding is the brand of a tenant. Every template renders with it
+// as .Brand, e.g. {{.Brand.CompanyName}}, unless the data sets Brand itself.
+type TemplateBranding struct {
+	CompanyName    string `json:"company_name,omitempty"`
+	LogoURL        string `json:"logo_url,omitempty"`
+	PrimaryColor   string `json:"primary_color,omitempty"`
+	SecondaryColor string `json:"secondary_color,omitempty"`
+	Footer         string `json:"footer,omitempty"`
+	SupportEmail   string `json:"support_email,omitempty"`
+	SupportPhone   string `json:"support_phone,omitempty"`
+	SupportURL     string `json:"support_url,omitempty"`
+}
+
+var brandColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// merge returns the branding with the fields other sets
+func (b TemplateBranding) merge(other TemplateBranding) TemplateBranding {
+	fields := []struct {
+		value *string
+		other string
+	}{
+		{&b.CompanyName, other.CompanyName},
+		{&b.LogoURL, other.LogoURL},
+		{&b.PrimaryColor, other.PrimaryColor},
+		{&b.SecondaryColor, other.SecondaryColor},
+		{&b.Footer, other.Footer},
+		{&b.SupportEmail, other.SupportEmail},
+		{&b.SupportPhone, other.SupportPhone},
+		{&b.SupportURL, other.SupportURL},
+	}
+	for _, field := range fields {
+		if field.other != "" {
+			*field.value = field.other
+		}
+	}
+	return b
+}
+
+// GetBranding returns the branding set for a tenant, the global branding for
+// an empty tenant ID
+func (s *TemplateService) GetBranding(tenantID string) (*TemplateBranding, error) {
+	ctx := context.Background()
+
+	brandingJSON, err := s.redis.Get(ctx, s.getBrandingKey(tenantID)).Result()
+	if err == redis.Nil {
+		return &TemplateBranding{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branding: %w", err)
+	}
+
+	var branding TemplateBranding
+	if err := json.Unmarshal([]byte(brandingJSON), &branding); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal branding: %w", err)
+	}
+
+	return &branding, nil
+}
+
+// SetBranding replaces the branding of a tenant. Fields a tenant leaves
+// empty are taken from the global branding when rendering.
+func (s *TemplateService) SetBranding(tenantID string, branding TemplateBranding) (*TemplateBranding, error) {
+	if err := validateBranding(branding); err != nil {
+		return nil, invalid(fmt.Errorf("branding validation failed: %w", err))
+	}
+
+	brandingJSON, err := json.Marshal(branding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal branding: %w", err)
+	}
+
+	ctx := context.Background()
+	if err := s.redis.Set(ctx, s.getBrandingKey(tenantID), brandingJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store branding: %w", err)
+	}
+
+	log.Info().Str("tenantID", tenantID).Msg("Template branding updated")
+
+	return &branding, nil
+}
+
+// brandingFor returns the branding templates of a tenant render with, the
+// tenant's over the global one
+func (s *TemplateService) brandingFor(tenantID string) TemplateBranding {
+	branding, err := s.GetBranding("")
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get global branding")
+		branding = &TemplateBranding{}
+	}
+	if tenantID == "" {
+		return *branding
+	}
+
+	tenantBranding, err := s.GetBranding(tenantID)
+	if err != nil {
+		log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to get tenant branding")
+		return *branding
+	}
+	return branding.merge(*tenantBranding)
+}
+
+// withBranding returns the render data with the branding of a tenant added
+func (s *TemplateService) withBranding(tenantID string, data map[string]interface{}) map[string]interface{} {
+	if _, ok := data["Brand"]; ok {
+		return data
+	}
+
+	withBrand := make(map[string]interface{}, len(data)+1)
+	for key, value := range data {
+		withBrand[key] = value
+	}
+	withBrand["Brand"] = s.brandingFor(tenantID)
+	return withBrand
+}
+
+// Redis key generators
+func (s *TemplateService) getBrandingKey(tenantID string) string {
+	if tenantID == "" {
+		return "template_branding:global"
+	}
+	return fmt.Sprintf("template_branding:%s", tenantID)
+}
+
+// Helper functions
+
+// validateBranding checks the colors, URLs and support address of a branding
+func validateBranding(branding TemplateBranding) error {
+	for _, color := range []string{branding.PrimaryColor, branding.SecondaryColor} {
+		if color != "" && !brandColorPattern.MatchString(color) {
+			return fmt.Errorf("invalid color %q, expected #rgb or #rrggbb", color)
+		}
+	}
+
+	for _, rawURL := range []string{branding.LogoURL, branding.SupportURL} {
+		if rawURL == "" {
+			continue
+		}
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid URL %q, expected an absolute http(s) URL", rawURL)
+		}
+	}
+
+	if branding.SupportEmail != "" {
+		if _, err := mail.ParseAddress(branding.SupportEmail); err != nil {
+			return fmt.Errorf("invalid support email %q", branding.SupportEmail)
+		}
+	}
+
+	return nil
+}
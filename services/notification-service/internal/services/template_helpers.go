@@ -0,0 +1,385 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"claude-talimat/pkg/validation"
+)
+
+// TemplateHelper documents a function templates can call. Helpers take the
+// piped value last, so {{.due | formatDate "long"}} formats .due.
+type TemplateHelper struct {
+	Name        string `json:"name"`
+	Usage       string `json:"usage"`
+	Description string `json:"description"`
+	Example     string `json:"example"`
+}
+
+// helperContext is what helpers know of the template being rendered
+type helperContext struct {
+	locale   string // dates, numbers and casing follow Turkish rules unless it is another language
+	priority string // for the priority helpers
+}
+
+// turkish tells whether the template is written in Turkish, the default of
+// templates without a locale
+func (hc helperContext) turkish() bool {
+	language, _, _ := strings.Cut(hc.locale, "-")
+	return language == "" || language == "tr"
+}
+
+// templateHelper is a documented helper and how its function is built for a render
+type templateHelper struct {
+	TemplateHelper
+	build func(hc helperContext) interface{}
+}
+
+// templateHelpers are the functions templates can call besides the safe
+// builtins. None of them reach outside the data of the render.
+var templateHelpers = []templateHelper{
+	{
+		TemplateHelper{"upper", "upper TEXT", "Upper cases text, with the dotted İ of Turkish templates", `{{.city | upper}}`},
+		func(hc helperContext) interface{} {
+			if hc.turkish() {
+				return func(text string) string { return strings.ToUpperSpecial(unicode.TurkishCase, text) }
+			}
+			return strings.ToUpper
+		},
+	},
+	{
+		TemplateHelper{"lower", "lower TEXT", "Lower cases text, with the dotless ı of Turkish templates", `{{.title | lower}}`},
+		func(hc helperContext) interface{} {
+			if hc.turkish() {
+				return func(text string) string { return strings.ToLowerSpecial(unicode.TurkishCase, text) }
+			}
+			return strings.ToLower
+		},
+	},
+	{
+		TemplateHelper{"trim", "trim TEXT", "Removes leading and trailing white space", `{{.note | trim}}`},
+		func(helperContext) interface{} { return strings.TrimSpace },
+	},
+	{
+		TemplateHelper{"join", "join SEPARATOR LIST", "Joins the values of a list", `{{join .sites ", "}}`},
+		func(helperContext) interface{} {
+			return func(values []interface{}, separator string) string {
+				parts := make([]string, len(values))
+				for i, value := range values {
+					parts[i] = fmt.Sprint(value)
+				}
+				return strings.Join(parts, separator)
+			}
+		},
+	},
+	{
+		TemplateHelper{"default", "default FALLBACK VALUE", "Returns the fallback when the value is missing or empty", `{{.owner | default "İSG birimi"}}`},
+		func(helperContext) interface{} {
+			return func(fallback interface{}, value interface{}) interface{} {
+				if value == nil || value == "" {
+					return fallback
+				}
+				return value
+			}
+		},
+	},
+	{
+		TemplateHelper{
+			"formatDate", "formatDate LAYOUT DATE",
+			"Formats a date, an RFC 3339 or YYYY-MM-DD string or Unix seconds, in the zone it carries. LAYOUT is short, long, full, datetime, time or a Go layout; Turkish templates get Turkish month and day names.",
+			`{{.due | formatDate "long"}}`,
+		},
+		func(hc helperContext) interface{} {
+			return func(layout string, value interface{}) (string, error) {
+				date, err := helperDate(value)
+				if err != nil {
+					return "", err
+				}
+				return formatHelperDate(date, layout, hc.turkish()), nil
+			}
+		},
+	},
+	{
+		TemplateHelper{
+			"formatNumber", "formatNumber DECIMALS NUMBER",
+			"Formats a number with the given decimals and grouped thousands, 1.234,5 in Turkish templates",
+			`{{.distance | formatNumber 1}}`,
+		},
+		func(hc helperContext) interface{} {
+			return func(decimals int, value interface{}) (string, error) {
+				number, err := helperNumber(value)
+				if err != nil {
+					return "", err
+				}
+				return formatHelperNumber(number, decimals, hc.turkish()), nil
+			}
+		},
+	},
+	{
+		TemplateHelper{
+			"formatCurrency", "formatCurrency CODE AMOUNT",
+			"Formats an amount of an ISO 4217 currency with two decimals, 1.234,50 ₺ in Turkish templates",
+			`{{.fine | formatCurrency "TRY"}}`,
+		},
+		func(hc helperContext) interface{} {
+			return func(currency string, value interface{}) (string, error) {
+				amount, err := helperNumber(value)
+				if err != nil {
+					return "", err
+				}
+				return formatHelperCurrency(amount, currency, hc.turkish())
+			}
+		},
+	},
+	{
+		TemplateHelper{
+			"plural", "plural SINGULAR PLURAL COUNT",
+			"Returns the singular for a count of one, the plural otherwise",
+			`{{.count}} {{.count | plural "finding" "findings"}}`,
+		},
+		func(helperContext) interface{} {
+			return func(singular string, plural string, value interface{}) (string, error) {
+				count, err := helperNumber(value)
+				if err != nil {
+					return "", err
+				}
+				if count == 1 || count == -1 {
+					return singular, nil
+				}
+				return plural, nil
+			}
+		},
+	},
+	{
+		TemplateHelper{"priority", "priority", "Returns the priority of the template, low, normal, high or urgent", `{{if eq priority "urgent"}}ACİL: {{end}}`},
+		func(hc helperContext) interface{} {
+			return func() string { return hc.priority }
+		},
+	},
+	{
+		TemplateHelper{
+			"priorityAtLeast", "priorityAtLeast PRIORITY",
+			"Tells whether the priority of the template is at least the given one, for blocks shown to important notifications only",
+			`{{if priorityAtLeast "high"}}Lütfen hemen yanıtlayın.{{end}}`,
+		},
+		func(hc helperContext) interface{} {
+			return func(minimum string) (bool, error) {
+				rank := priorityRank(minimum)
+				if rank < 0 {
+					return false, fmt.Errorf("unknown priority %q", minimum)
+				}
+				return priorityRank(hc.priority) >= rank, nil
+			}
+		},
+	},
+}
+
+// templateHelperNames are the names of the template helpers
+var templateHelperNames = func() map[string]bool {
+	names := make(map[string]bool, len(templateHelpers))
+	for _, helper := range templateHelpers {
+		names[helper.Name] = true
+	}
+	return names
+}()
+
+// TemplateHelpers documents the helpers templates can call
+func TemplateHelpers() []TemplateHelper {
+	helpers := make([]TemplateHelper, len(templateHelpers))
+	for i, helper := range templateHelpers {
+		helpers[i] = helper.TemplateHelper
+	}
+	return helpers
+}
+
+// templateFuncs builds the helpers of a render of a template
+func templateFuncs(hc helperContext) map[string]interface{} {
+	funcs := make(map[string]interface{}, len(templateHelpers))
+	for _, helper := range templateHelpers {
+		funcs[helper.Name] = helper.build(hc)
+	}
+	return funcs
+}
+
+// Named layouts of formatDate
+var (
+	turkishDateLayouts = map[string]string{
+		"short":    "02.01.2006",
+		"long":     "2 January 2006",
+		"full":     "2 January 2006 Monday",
+		"datetime": "02.01.2006 15:04",
+		"time":     "15:04",
+	}
+	englishDateLayouts = map[string]string{
+		"short":    "02/01/2006",
+		"long":     "2 January 2006",
+		"full":     "Monday, 2 January 2006",
+		"datetime": "02/01/2006 15:04",
+		"time":     "15:04",
+	}
+)
+
+var (
+	turkishMonths      = []string{"Ocak", "Şubat", "Mart", "Nisan", "Mayıs", "Haziran", "Temmuz", "Ağustos", "Eylül", "Ekim", "Kasım", "Aralık"}
+	turkishShortMonths = []string{"Oca", "Şub", "Mar", "Nis", "May", "Haz", "Tem", "Ağu", "Eyl", "Eki", "Kas", "Ara"}
+	turkishDays        = []string{"Pazar", "Pazartesi", "Salı", "Çarşamba", "Perşembe", "Cuma", "Cumartesi"}
+	turkishShortDays   = []string{"Paz", "Pzt", "Sal", "Çar", "Per", "Cum", "Cmt"}
+)
+
+// currencySymbols are the symbols of currencies formatCurrency writes as symbols
+var currencySymbols = map[string]string{
+	"TRY": "₺",
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+}
+
+// maxHelperDecimals bounds the decimals of formatNumber
+const maxHelperDecimals = 10
+
+// Helper functions
+
+// formatHelperDate formats a date with a named or Go layout. The month and
+// day names of Go layouts are swapped for Turkish ones up front; none of
+// them contains a layout element.
+func formatHelperDate(date time.Time, layout string, turkish bool) string {
+	if layout == "" {
+		layout = "short"
+	}
+	layouts := englishDateLayouts
+	if turkish {
+		layouts = turkishDateLayouts
+	}
+	if named, ok := layouts[layout]; ok {
+		layout = named
+	}
+
+	if turkish {
+		layout = strings.NewReplacer(
+			"January", turkishMonths[date.Month()-1],
+			"Monday", turkishDays[date.Weekday()],
+			"Jan", turkishShortMonths[date.Month()-1],
+			"Mon", turkishShortDays[date.Weekday()],
+		).Replace(layout)
+	}
+	return date.Format(layout)
+}
+
+// formatHelperNumber formats a number with grouped thousands
+func formatHelperNumber(number float64, decimals int, turkish bool) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+	if decimals > maxHelperDecimals {
+		decimals = maxHelperDecimals
+	}
+
+	formatted := strconv.FormatFloat(math.Abs(number), 'f', decimals, 64)
+	integer, fraction, _ := strings.Cut(formatted, ".")
+
+	thousands, point := ",", "."
+	if turkish {
+		thousands, point = ".", ","
+	}
+
+	var grouped strings.Builder
+	if number < 0 && strings.Trim(formatted, "0.") != "" {
+		grouped.WriteByte('-')
+	}
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString(thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+	if fraction != "" {
+		grouped.WriteString(point + fraction)
+	}
+	return grouped.String()
+}
+
+// formatHelperCurrency formats an amount of a currency, the symbol after the
+// amount in Turkish and before it otherwise
+func formatHelperCurrency(amount float64, currency string, turkish bool) (string, error) {
+	code := strings.ToUpper(currency)
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("invalid currency code %q", currency)
+	}
+
+	formatted := formatHelperNumber(amount, 2, turkish)
+	symbol, ok := currencySymbols[code]
+	switch {
+	case turkish && ok:
+		return formatted + " " + symbol, nil
+	case turkish:
+		return formatted + " " + code, nil
+	case ok:
+		return symbol + formatted, nil
+	default:
+		return code + " " + formatted, nil
+	}
+}
+
+// helperDate converts the value a date helper got to a time
+func helperDate(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		date, err := parseVariableDate(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", v)
+		}
+		return date, nil
+	default:
+		if seconds, err := helperNumber(value); err == nil {
+			return time.Unix(int64(seconds), 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v", value)
+}
+
+// helperNumber converts the value a number helper got to a float
+func helperNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", v)
+		}
+		return number, nil
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(reflected.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(reflected.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return reflected.Float(), nil
+	}
+	return 0, fmt.Errorf("invalid number %v", value)
+}
+
+// priorityRank orders priorities from low up, -1 for unknown ones
+func priorityRank(priority string) int {
+	for i, candidate := range validation.Priorities {
+		if candidate == priority {
+			return i
+		}
+	}
+	return -1
+}
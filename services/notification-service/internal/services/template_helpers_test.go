@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTemplateHelpersFollowTheLocale(t *testing.T) {
+	templates := &TemplateService{}
+	data := map[string]interface{}{
+		"site":  "istanbul depo",
+		"title": "IŞIK",
+		"note":  "  Baret takın \n",
+		"sites": []interface{}{"A-1", "B-2"},
+		"owner": "",
+		"due":   "2026-03-02",
+		"at":    "2026-03-02T09:30:00+03:00",
+		"big":   1234567.891,
+		"small": -0.001,
+		"debt":  -1234,
+		"fine":  1234.5,
+		"one":   "1",
+		"count": 0,
+		"text":  "üç",
+	}
+
+	for name, test := range map[string]struct {
+		locale   string
+		priority string
+		template string
+		expected string // empty when the render fails
+	}{
+		"Turkish upper":             {"tr", "", `{{.site | upper}}`, "İSTANBUL DEPO"},
+		"English upper":             {"en", "", `{{.site | upper}}`, "ISTANBUL DEPO"},
+		"Turkish lower":             {"tr", "", `{{.title | lower}}`, "ışık"},
+		"English lower":             {"en-GB", "", `{{.title | lower}}`, "işik"},
+		"no locale is Turkish":      {"", "", `{{.site | upper}}`, "İSTANBUL DEPO"},
+		"trim":                      {"tr", "", `[{{.note | trim}}]`, "[Baret takın]"},
+		"join":                      {"tr", "", `{{join .sites ", "}}`, "A-1, B-2"},
+		"default":                   {"tr", "", `{{.owner | default "İSG birimi"}}`, "İSG birimi"},
+		"Turkish short date":        {"tr", "", `{{.due | formatDate "short"}}`, "02.03.2026"},
+		"English short date":        {"en", "", `{{.due | formatDate "short"}}`, "02/03/2026"},
+		"Turkish long date":         {"tr", "", `{{.due | formatDate "long"}}`, "2 Mart 2026"},
+		"Turkish full date":         {"tr", "", `{{.due | formatDate "full"}}`, "2 Mart 2026 Pazartesi"},
+		"English full date":         {"en", "", `{{.due | formatDate "full"}}`, "Monday, 2 March 2026"},
+		"date and time in its zone": {"tr", "", `{{.at | formatDate "datetime"}}`, "02.03.2026 09:30"},
+		"Turkish Go layout":         {"tr", "", `{{.due | formatDate "Mon 2 Jan"}}`, "Pzt 2 Mar"},
+		"not a date":                {"tr", "", `{{.text | formatDate "short"}}`, ""},
+		"Turkish number":            {"tr", "", `{{.big | formatNumber 2}}`, "1.234.567,89"},
+		"English number":            {"en", "", `{{.big | formatNumber 2}}`, "1,234,567.89"},
+		"negative number":           {"tr", "", `{{.debt | formatNumber 0}}`, "-1.234"},
+		"rounded to zero":           {"en", "", `{{.small | formatNumber 2}}`, "0.00"},
+		"not a number":              {"tr", "", `{{.text | formatNumber 2}}`, ""},
+		"Turkish currency":          {"tr", "", `{{.fine | formatCurrency "TRY"}}`, "1.234,50 ₺"},
+		"English currency":          {"en", "", `{{.fine | formatCurrency "try"}}`, "₺1,234.50"},
+		"Turkish other currency":    {"tr", "", `{{.fine | formatCurrency "CHF"}}`, "1.234,50 CHF"},
+		"English other currency":    {"en", "", `{{.fine | formatCurrency "CHF"}}`, "CHF 1,234.50"},
+		"invalid currency":          {"tr", "", `{{.fine | formatCurrency "TL"}}`, ""},
+		"singular":                  {"en", "", `{{.one | plural "finding" "findings"}}`, "finding"},
+		"plural":                    {"en", "", `{{.count | plural "finding" "findings"}}`, "findings"},
+		"priority":                  {"tr", "urgent", `{{if eq priority "urgent"}}ACİL{{end}}`, "ACİL"},
+		"priority at least":         {"tr", "urgent", `{{if priorityAtLeast "high"}}ACİL{{else}}-{{end}}`, "ACİL"},
+		"priority below":            {"tr", "normal", `{{if priorityAtLeast "high"}}ACİL{{else}}-{{end}}`, "-"},
+		"unknown priority":          {"tr", "normal", `{{if priorityAtLeast "critical"}}ACİL{{end}}`, ""},
+	} {
+		rendered, err := templates.renderString([]string{test.template}, data, false, templateFuncs(helperContext{locale: test.locale, priority: test.priority}))
+		if test.expected == "" && err == nil {
+			t.Errorf("%s: expected the render to fail, got %q", name, rendered)
+		}
+		if test.expected != "" && (err != nil || rendered != test.expected) {
+			t.Errorf("%s: expected %q, got %q (%v)", name, test.expected, rendered, err)
+		}
+	}
+}
+
+func TestTemplateHelpersAreDocumented(t *testing.T) {
+	helpers := TemplateHelpers()
+	if len(helpers) != len(templateHelperNames) {
+		t.Fatalf("Expected every helper to be documented once, got %d of %d", len(helpers), len(templateHelperNames))
+	}
+
+	templates := &TemplateService{}
+	for _, helper := range helpers {
+		if !strings.HasPrefix(helper.Usage, helper.Name) || helper.Description == "" || !strings.Contains(helper.Example, helper.Name) {
+			t.Errorf("Expected %s to be documented with its usage and an example, got %+v", helper.Name, helper)
+		}
+		// Examples must at least parse with the helpers of a render
+		if _, err := templates.renderString([]string{"{{define \"example\"}}" + helper.Example + "{{end}}"}, nil, false, templateFuncs(helperContext{})); err != nil {
+			t.Errorf("Expected the example of %s to parse, got %v", helper.Name, err)
+		}
+	}
+}
+
+func TestTemplatesRenderWithTheirOwnLocaleAndPriority(t *testing.T) {
+	env := newIntegrationEnv(t)
+	templates := env.service.templateService
+
+	for _, test := range []struct {
+		locale   string
+		priority string
+		expected string
+	}{
+		{"tr", "urgent", "ACİL İSTANBUL DEPO: 2 Mart 2026 Pazartesi, ceza 1.234,50 ₺"},
+		{"en", "normal", "ISTANBUL DEPO: Monday, 2 March 2026, fine ₺1,234.50"},
+	} {
+		template, err := templates.CreateTemplate(context.Background(), NotificationTemplate{
+			Name:     "inspection",
+			Type:     "inapp",
+			Locale:   test.locale,
+			Priority: test.priority,
+			TenantID: "tenant-a",
+			Category: "safety",
+			IsActive: true,
+			Title:    "Denetim",
+			Message:  `{{if priorityAtLeast "high"}}ACİL {{end}}{{.site | upper}}: {{.due | formatDate "full"}}, {{if eq .locale "tr"}}ceza{{else}}fine{{end}} {{.fine | formatCurrency "TRY"}}`,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create template: %v", err)
+		}
+
+		result, err := templates.RenderDraft(template.ID, map[string]interface{}{"site": "istanbul depo", "due": "2026-03-02", "fine": 1234.5, "locale": test.locale})
+		if err != nil {
+			t.Fatalf("Failed to render template: %v", err)
+		}
+		if result.Message != test.expected || len(result.Errors) > 0 {
+			t.Errorf("Expected %q in %s, got %q (%v)", test.expected, test.locale, result.Message, result.Errors)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateExport is a backup of the templates of a tenant, with the branding
+// and locale settings they render with. Importing it restores them.
+type TemplateExport struct {
+	TenantID   string                  `json:"tenant_id,omitempty"`
+	ExportedAt time.Time               `json:"exported_at"`
+	Templates  []NotificationTemplate  `json:"templates"`
+	Branding   *TemplateBranding       `json:"branding,omitempty"`
+	Locales    *TemplateLocaleSettings `json:"locales,omitempty"`
+}
+
+// TemplateImportResult lists the IDs of the templates an import created,
+// updated or left as they were, and the templates it failed on
+type TemplateImportResult struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Skipped []string `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// ExportTemplates returns the working copies of the templates of a tenant
+// with its branding and locale settings
+func (s *TemplateService) ExportTemplates(ctx context.Context, tenantID string) (*TemplateExport, error) {
+	templateIDs, err := s.redis.ZRange(ctx, s.getTemplatesKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template IDs: %w", err)
+	}
+
+	export := &TemplateExport{
+		TenantID:   tenantID,
+		ExportedAt: time.Now(),
+		Templates:  []NotificationTemplate{},
+	}
+	for _, id := range templateIDs {
+		template, err := s.GetTemplate(id)
+		if err != nil {
+			log.Warn().Err(err).Str("templateID", id).Msg("Failed to get template")
+			continue
+		}
+		export.Templates = append(export.Templates, *template)
+	}
+
+	if export.Branding, err = s.GetBranding(tenantID); err != nil {
+		return nil, err
+	}
+	if export.Locales, err = s.GetLocaleSettings(tenantID); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// ImportTemplates imports templates into a tenant. A template whose name,
+// type and locale match an existing one is skipped, or replaces its content
+// when overwrite is set. Imported templates are published, parents before
+// the templates inheriting from them.
+func (s *TemplateService) ImportTemplates(ctx context.Context, tenantID string, export TemplateExport, overwrite bool) (*TemplateImportResult, error) {
+	log.Info().
+		Str("tenantID", tenantID).
+		Int("templateCount", len(export.Templates)).
+		Bool("overwrite", overwrite).
+		Msg("Importing templates")
+
+	result := &TemplateImportResult{Created: []string{}, Updated: []string{}, Skipped: []string{}}
+
+	if export.Branding != nil {
+		if _, err := s.SetBranding(tenantID, *export.Branding); err != nil {
+			return nil, err
+		}
+	}
+	if export.Locales != nil {
+		if _, err := s.SetLocaleSettings(tenantID, *export.Locales); err != nil {
+			return nil, err
+		}
+	}
+
+	// IDs change on import, inheriting templates are pointed at the
+	// imported parents
+	exported := make(map[string]bool)
+	for _, template := range export.Templates {
+		if template.ID != "" {
+			exported[template.ID] = true
+		}
+	}
+	imported := make(map[string]string)
+	failed := make(map[string]bool)
+
+	pending := export.Templates
+	for len(pending) > 0 {
+		var waiting []NotificationTemplate
+		for _, template := range pending {
+			if parentID := template.ParentID; parentID != "" && exported[parentID] {
+				if failed[parentID] {
+					failed[template.ID] = true
+					result.Errors = append(result.Errors, fmt.Sprintf("%s: parent template %s was not imported", template.Name, parentID))
+					continue
+				}
+				if imported[parentID] == "" {
+					waiting = append(waiting, template)
+					continue
+				}
+				template.ParentID = imported[parentID]
+			}
+
+			id, outcome, err := s.importTemplate(ctx, tenantID, template, overwrite)
+			if err != nil {
+				failed[template.ID] = true
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", template.Name, err))
+				continue
+			}
+			imported[template.ID] = id
+
+			switch outcome {
+			case "created":
+				result.Created = append(result.Created, id)
+			case "updated":
+				result.Updated = append(result.Updated, id)
+			default:
+				result.Skipped = append(result.Skipped, id)
+			}
+		}
+
+		if len(waiting) == len(pending) {
+			for _, template := range waiting {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: template inherits from itself", template.Name))
+			}
+			break
+		}
+		pending = waiting
+	}
+
+	log.Info().
+		Str("tenantID", tenantID).
+		Int("created", len(result.Created)).
+		Int("updated", len(result.Updated)).
+		Int("skipped", len(result.Skipped)).
+		Int("errorCount", len(result.Errors)).
+		Msg("Templates imported")
+
+	return result, nil
+}
+
+// SeedDefaultTemplates imports the default templates into a tenant, leaving
+// templates the tenant already has as they are. Seeding again only adds
+// the defaults the tenant deleted.
+func (s *TemplateService) SeedDefaultTemplates(ctx context.Context, tenantID string) (*TemplateImportResult, error) {
+	templates := DefaultTemplates()
+	for i := range templates {
+		templates[i].IsActive = true
+		templates[i].IsDefault = true
+	}
+
+	return s.ImportTemplates(ctx, tenantID, TemplateExport{Templates: templates}, false)
+}
+
+// importTemplate creates a template or updates the variant it matches,
+// returning the ID of the template and what was done to it
+func (s *TemplateService) importTemplate(ctx context.Context, tenantID string, template NotificationTemplate, overwrite bool) (string, string, error) {
+	template.TenantID = tenantID
+	if template.Locale == "" {
+		template.Locale = s.config.DefaultLocale
+	}
+
+	variants, err := s.GetTemplateVariants(template.Name, template.Type, tenantID)
+	if err != nil {
+		return "", "", err
+	}
+
+	existing := findVariant(variants, template.Locale)
+	if existing == nil {
+		template.ID = ""
+		template.Status = ""
+		created, err := s.CreateTemplate(ctx, template)
+		if err != nil {
+			return "", "", err
+		}
+		return created.ID, "created", nil
+	}
+
+	if !overwrite {
+		return existing.ID, "skipped", nil
+	}
+
+	updated, err := s.UpdateTemplate(ctx, existing.ID, map[string]interface{}{
+		"category":             template.Category,
+		"subject":              template.Subject,
+		"title":                template.Title,
+		"message":              template.Message,
+		"html_body":            template.HTMLBody,
+		"text_body":            template.TextBody,
+		"priority":             template.Priority,
+		"is_active":            template.IsActive,
+		"tags":                 template.Tags,
+		"metadata":             template.Metadata,
+		"variable_definitions": template.Definitions,
+		"parent_id":            template.ParentID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if updated.Status == TemplateStatusDraft {
+		if _, err := s.PublishTemplate(updated.ID); err != nil {
+			return "", "", err
+		}
+	}
+	return updated.ID, "updated", nil
+}
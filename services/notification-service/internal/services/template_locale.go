@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateLocaleSettings are the locales a tenant's templates are written in.
+// Templates fall back to DefaultLocale when there is no variant in the
+// locale of a user, the service default when the tenant sets none.
+type TemplateLocaleSettings struct {
+	DefaultLocale    string   `json:"default_locale,omitempty"`
+	SupportedLocales []string `json:"supported_locales,omitempty"` // the coverage report checks these
+}
+
+// LocaleCoverage lists the templates without a variant in a locale
+type LocaleCoverage struct {
+	Locale       string             `json:"locale"`
+	Translated   int                `json:"translated"`
+	Total        int                `json:"total"`
+	Untranslated []TemplateVariants `json:"untranslated"`
+}
+
+// TemplateVariants is a logical template, the locale variants sharing a
+// name and type
+type TemplateVariants struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Locales []string `json:"locales"`
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// GetLocaleSettings returns the locale settings of a tenant
+func (s *TemplateService) GetLocaleSettings(tenantID string) (*TemplateLocaleSettings, error) {
+	ctx := context.Background()
+
+	settingsJSON, err := s.redis.Get(ctx, s.getLocaleSettingsKey(tenantID)).Result()
+	if err == redis.Nil {
+		return &TemplateLocaleSettings{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get locale settings: %w", err)
+	}
+
+	var settings TemplateLocaleSettings
+	if err := json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal locale settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SetLocaleSettings replaces the locale settings of a tenant. The default
+// locale is always one of the supported ones.
+func (s *TemplateService) SetLocaleSettings(tenantID string, settings TemplateLocaleSettings) (*TemplateLocaleSettings, error) {
+	settings.DefaultLocale = normalizeLanguage(settings.DefaultLocale)
+	if settings.DefaultLocale != "" && !localePattern.MatchString(settings.DefaultLocale) {
+		return nil, invalid(fmt.Errorf("invalid default locale: %s", settings.DefaultLocale))
+	}
+
+	var supported []string
+	seen := make(map[string]bool)
+	for _, locale := range append(settings.SupportedLocales, settings.DefaultLocale) {
+		locale = normalizeLanguage(locale)
+		if locale == "" || seen[locale] {
+			continue
+		}
+		if !localePattern.MatchString(locale) {
+			return nil, invalid(fmt.Errorf("invalid locale: %s", locale))
+		}
+		seen[locale] = true
+		supported = append(supported, locale)
+	}
+	settings.SupportedLocales = supported
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal locale settings: %w", err)
+	}
+
+	ctx := context.Background()
+	if err := s.redis.Set(ctx, s.getLocaleSettingsKey(tenantID), settingsJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store locale settings: %w", err)
+	}
+
+	log.Info().
+		Str("tenantID", tenantID).
+		Str("defaultLocale", settings.DefaultLocale).
+		Msg("Template locale settings updated")
+
+	return &settings, nil
+}
+
+// LocaleChain returns the locales a template is looked up in for a user, in
+// order: the user's locale, its base language, the tenant default and the
+// service default
+func (s *TemplateService) LocaleChain(tenantID string, userLocale string) []string {
+	var chain []string
+	add := func(locale string) {
+		locale = normalizeLanguage(locale)
+		if locale == "" {
+			return
+		}
+		for _, existing := range chain {
+			if existing == locale {
+				return
+			}
+		}
+		chain = append(chain, locale)
+	}
+
+	add(userLocale)
+	add(baseLanguage(userLocale))
+
+	if tenantID != "" {
+		settings, err := s.GetLocaleSettings(tenantID)
+		if err != nil {
+			log.Warn().Err(err).Str("tenantID", tenantID).Msg("Failed to get locale settings")
+		} else {
+			add(settings.DefaultLocale)
+		}
+	}
+
+	add(s.config.DefaultLocale)
+	return chain
+}
+
+// GetTemplateVariants returns the locale variants of a logical template
+func (s *TemplateService) GetTemplateVariants(name string, templateType string, tenantID string) ([]*NotificationTemplate, error) {
+	ctx := context.Background()
+
+	templateIDs, err := s.redis.ZRange(ctx, s.getTypeTemplatesKey(templateType, tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template IDs: %w", err)
+	}
+
+	var variants []*NotificationTemplate
+	for _, id := range templateIDs {
+		template, err := s.GetTemplate(id)
+		if err != nil {
+			log.Warn().Err(err).Str("templateID", id).Msg("Failed to get template")
+			continue
+		}
+		if template.Name == name {
+			variants = append(variants, template)
+		}
+	}
+
+	return variants, nil
+}
+
+// ResolveTemplate returns the variant of a logical template for a user's
+// locale, following the locale chain
+func (s *TemplateService) ResolveTemplate(name string, templateType string, tenantID string, userLocale string) (*NotificationTemplate, error) {
+	variants, err := s.GetTemplateVariants(name, templateType, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, locale := range s.LocaleChain(tenantID, userLocale) {
+		if variant := findVariant(variants, locale); variant != nil {
+			return variant, nil
+		}
+	}
+
+	return nil, notFoundf("template not found: %s (type: %s, locale: %s)", name, templateType, userLocale)
+}
+
+// LocalizedVariant returns the variant of a template in a user's locale or
+// its base language, the template itself when there is none
+func (s *TemplateService) LocalizedVariant(template *NotificationTemplate, userLocale string) *NotificationTemplate {
+	if userLocale == "" || sameLocale(template.Locale, userLocale) {
+		return template
+	}
+
+	variants, err := s.GetTemplateVariants(template.Name, template.Type, template.TenantID)
+	if err != nil {
+		log.Warn().Err(err).Str("templateID", template.ID).Msg("Failed to get template variants")
+		return template
+	}
+
+	for _, locale := range []string{userLocale, baseLanguage(userLocale)} {
+		if variant := findVariant(variants, locale); variant != nil && variant.IsActive {
+			return variant
+		}
+	}
+	return template
+}
+
+// GetLocaleCoverage reports the templates of a tenant missing in each of its
+// supported locales, or in each locale its templates use when it sets none
+func (s *TemplateService) GetLocaleCoverage(tenantID string) ([]LocaleCoverage, error) {
+	ctx := context.Background()
+
+	templateIDs, err := s.redis.ZRange(ctx, s.getTemplatesKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template IDs: %w", err)
+	}
+
+	logical := make(map[string]*TemplateVariants)
+	used := make(map[string]bool)
+	for _, id := range templateIDs {
+		template, err := s.GetTemplate(id)
+		if err != nil {
+			log.Warn().Err(err).Str("templateID", id).Msg("Failed to get template")
+			continue
+		}
+
+		key := template.Type + ":" + template.Name
+		if logical[key] == nil {
+			logical[key] = &TemplateVariants{Name: template.Name, Type: template.Type}
+		}
+		locale := normalizeLanguage(template.Locale)
+		logical[key].Locales = append(logical[key].Locales, locale)
+		used[locale] = true
+	}
+
+	settings, err := s.GetLocaleSettings(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	locales := settings.SupportedLocales
+	if len(locales) == 0 {
+		for locale := range used {
+			locales = append(locales, locale)
+		}
+		sort.Strings(locales)
+	}
+
+	keys := make([]string, 0, len(logical))
+	for key := range logical {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	coverage := make([]LocaleCoverage, 0, len(locales))
+	for _, locale := range locales {
+		report := LocaleCoverage{
+			Locale:       locale,
+			Total:        len(keys),
+			Untranslated: []TemplateVariants{},
+		}
+		for _, key := range keys {
+			variants := logical[key]
+			if containsLocale(variants.Locales, locale) {
+				report.Translated++
+			} else {
+				report.Untranslated = append(report.Untranslated, *variants)
+			}
+		}
+		coverage = append(coverage, report)
+	}
+
+	return coverage, nil
+}
+
+// validateVariantLocale checks that a logical template has a single variant
+// per locale
+func (s *TemplateService) validateVariantLocale(template NotificationTemplate) error {
+	if !localePattern.MatchString(normalizeLanguage(template.Locale)) {
+		return invalid(fmt.Errorf("invalid locale: %s", template.Locale))
+	}
+
+	variants, err := s.GetTemplateVariants(template.Name, template.Type, template.TenantID)
+	if err != nil {
+		return err
+	}
+	for _, variant := range variants {
+		if variant.ID != template.ID && sameLocale(variant.Locale, template.Locale) {
+			return conflictf("template %s already has a %s variant: %s", template.Name, template.Locale, variant.ID)
+		}
+	}
+	return nil
+}
+
+// Redis key generators
+func (s *TemplateService) getLocaleSettingsKey(tenantID string) string {
+	if tenantID == "" {
+		return "template_locales:global"
+	}
+	return fmt.Sprintf("template_locales:%s", tenantID)
+}
+
+// Helper functions
+
+// findVariant returns the variant of a locale
+func findVariant(variants []*NotificationTemplate, locale string) *NotificationTemplate {
+	for _, variant := range variants {
+		if sameLocale(variant.Locale, locale) {
+			return variant
+		}
+	}
+	return nil
+}
+
+func sameLocale(a string, b string) bool {
+	return normalizeLanguage(a) == normalizeLanguage(b)
+}
+
+func containsLocale(locales []string, locale string) bool {
+	for _, l := range locales {
+		if sameLocale(l, locale) {
+			return true
+		}
+	}
+	return false
+}
+
+// baseLanguage returns the language of a locale, e.g. tr for tr-TR
+func baseLanguage(locale string) string {
+	return strings.SplitN(normalizeLanguage(locale), "-", 2)[0]
+}
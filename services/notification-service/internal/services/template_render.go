@@ -0,0 +1,385 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+	"time"
+)
+
+// defaultMaxTemplateOutput limits rendered fields when the configuration sets no limit
+const defaultMaxTemplateOutput = 256 << 10
+
+// Types of template variables
+const (
+	VariableTypeString  = "string"
+	VariableTypeNumber  = "number"
+	VariableTypeBoolean = "boolean"
+	VariableTypeDate    = "date"
+	VariableTypeArray   = "array"
+	VariableTypeObject  = "object"
+)
+
+// Rules template variables of a render can break
+const (
+	VariableRuleRequired = "required"
+	VariableRuleType     = "type"
+	VariableRulePattern  = "pattern"
+	VariableRuleDefault  = "default"
+)
+
+// VariableError is a variable of a render breaking its definition
+type VariableError struct {
+	Variable string `json:"variable"`
+	Rule     string `json:"rule"` // required, type, pattern or default
+	Message  string `json:"message"`
+}
+
+// VariablesError is returned for renders whose data breaks the variable
+// definitions of the template, listing each broken variable so clients can
+// point at them
+type VariablesError struct {
+	Errors []VariableError
+}
+
+func (e *VariablesError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, variableErr := range e.Errors {
+		messages[i] = variableErr.Message
+	}
+	return "invalid template variables: " + strings.Join(messages, "; ")
+}
+
+func (e *VariablesError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// errTemplateOutputTooLarge stops templates that render more than allowed
+var errTemplateOutputTooLarge = errors.New("rendered output exceeds the size limit")
+
+// allowedTemplateBuiltins are the builtins of Go templates user-authored
+// templates may use. call is left out, it runs functions found in the data.
+var allowedTemplateBuiltins = map[string]bool{
+	"and": true, "or": true, "not": true, "len": true, "index": true, "slice": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"print": true, "printf": true, "println": true, "html": true, "js": true, "urlquery": true,
+}
+
+// renderString renders a template string with data. Later layers override
+// the body and the {{define}} blocks of earlier ones; a layer of only
+// definitions keeps the body before it. HTML is escaped by context in HTML
+// bodies, missing keys are errors and only the helpers in funcs and
+// whitelisted builtins run.
+func (s *TemplateService) renderString(layers []string, data map[string]interface{}, html bool, funcs map[string]interface{}) (string, error) {
+	maxOutput := s.config.MaxOutputSize
+	if maxOutput <= 0 {
+		maxOutput = defaultMaxTemplateOutput
+	}
+
+	var buf bytes.Buffer
+	output := &limitedWriter{w: &buf, remaining: maxOutput}
+
+	if html {
+		tmpl := htmltemplate.New("").Option("missingkey=error").Funcs(funcs)
+		for _, layer := range layers {
+			if _, err := tmpl.Parse(layer); err != nil {
+				return "", fmt.Errorf("failed to parse template: %w", err)
+			}
+		}
+		for _, t := range tmpl.Templates() {
+			if err := checkTemplateTree(t.Tree); err != nil {
+				return "", err
+			}
+		}
+		if err := tmpl.Execute(output, data); err != nil {
+			return "", fmt.Errorf("failed to execute template: %w", err)
+		}
+		return buf.String(), nil
+	}
+
+	tmpl := texttemplate.New("").Option("missingkey=error").Funcs(funcs)
+	for _, layer := range layers {
+		if _, err := tmpl.Parse(layer); err != nil {
+			return "", fmt.Errorf("failed to parse template: %w", err)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if err := checkTemplateTree(t.Tree); err != nil {
+			return "", err
+		}
+	}
+	if err := tmpl.Execute(output, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// applyVariableDefinitions checks the data of a render against the variable
+// definitions of a template. Missing variables get their default value, or
+// nil when optional so templates can test for them. Broken definitions are
+// returned as a *VariablesError.
+func applyVariableDefinitions(definitions []TemplateVariable, data map[string]interface{}) (map[string]interface{}, error) {
+	if len(definitions) == 0 {
+		return data, nil
+	}
+
+	checked := make(map[string]interface{}, len(data)+len(definitions))
+	for key, value := range data {
+		checked[key] = value
+	}
+
+	var problems []VariableError
+	for _, definition := range definitions {
+		value, ok := checked[definition.Name]
+		if !ok || value == nil {
+			switch {
+			case definition.DefaultValue != "":
+				defaultValue, err := parseVariableDefault(definition)
+				if err != nil {
+					problems = append(problems, VariableError{Variable: definition.Name, Rule: VariableRuleDefault, Message: err.Error()})
+					continue
+				}
+				checked[definition.Name] = defaultValue
+			case definition.Required:
+				problems = append(problems, missingVariable(definition.Name))
+			default:
+				checked[definition.Name] = nil
+			}
+			continue
+		}
+
+		if problem := checkVariableValue(definition, value); problem != nil {
+			problems = append(problems, *problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &VariablesError{Errors: problems}
+	}
+	return checked, nil
+}
+
+// Helper functions
+
+// validateVariableDefinitions checks the types and patterns of definitions
+func validateVariableDefinitions(definitions []TemplateVariable) error {
+	seen := make(map[string]bool)
+	for _, definition := range definitions {
+		if definition.Name == "" {
+			return fmt.Errorf("variable name is required")
+		}
+		if seen[definition.Name] {
+			return fmt.Errorf("variable %s is defined twice", definition.Name)
+		}
+		seen[definition.Name] = true
+
+		switch definition.Type {
+		case "", VariableTypeString, VariableTypeNumber, VariableTypeBoolean, VariableTypeDate, VariableTypeArray, VariableTypeObject:
+		default:
+			return fmt.Errorf("variable %s has unknown type %s", definition.Name, definition.Type)
+		}
+
+		if definition.Validation != "" {
+			if _, err := regexp.Compile(definition.Validation); err != nil {
+				return fmt.Errorf("variable %s has an invalid validation pattern: %w", definition.Name, err)
+			}
+		}
+		if definition.DefaultValue != "" {
+			if _, err := parseVariableDefault(definition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkVariableValue checks a value against the type and pattern of its definition
+func checkVariableValue(definition TemplateVariable, value interface{}) *VariableError {
+	kind := reflect.ValueOf(value).Kind()
+
+	valid := true
+	switch definition.Type {
+	case VariableTypeNumber:
+		switch value.(type) {
+		case json.Number:
+		default:
+			valid = kind >= reflect.Int && kind <= reflect.Float64
+		}
+	case VariableTypeBoolean:
+		valid = kind == reflect.Bool
+	case VariableTypeDate:
+		switch v := value.(type) {
+		case time.Time:
+		case string:
+			_, err := parseVariableDate(v)
+			valid = err == nil
+		default:
+			valid = false
+		}
+	case VariableTypeArray:
+		valid = kind == reflect.Slice || kind == reflect.Array
+	case VariableTypeObject:
+		valid = kind == reflect.Map || kind == reflect.Struct
+	case VariableTypeString, "":
+		valid = kind == reflect.String
+	}
+	if !valid {
+		expected := definition.Type
+		if expected == "" {
+			expected = VariableTypeString
+		}
+		return &VariableError{
+			Variable: definition.Name,
+			Rule:     VariableRuleType,
+			Message:  fmt.Sprintf("%s must be a %s", definition.Name, expected),
+		}
+	}
+
+	if definition.Validation != "" {
+		pattern, err := regexp.Compile(definition.Validation)
+		if err != nil {
+			return &VariableError{
+				Variable: definition.Name,
+				Rule:     VariableRulePattern,
+				Message:  fmt.Sprintf("%s has an invalid validation pattern", definition.Name),
+			}
+		}
+		if !pattern.MatchString(fmt.Sprint(value)) {
+			return &VariableError{
+				Variable: definition.Name,
+				Rule:     VariableRulePattern,
+				Message:  fmt.Sprintf("%s does not match %s", definition.Name, definition.Validation),
+			}
+		}
+	}
+
+	return nil
+}
+
+// missingVariable is the error of a required variable without a value
+func missingVariable(name string) VariableError {
+	return VariableError{Variable: name, Rule: VariableRuleRequired, Message: fmt.Sprintf("%s is required", name)}
+}
+
+// parseVariableDefault converts the default value of a definition to its type
+func parseVariableDefault(definition TemplateVariable) (interface{}, error) {
+	raw := definition.DefaultValue
+
+	var value interface{}
+	var err error
+	switch definition.Type {
+	case VariableTypeNumber:
+		value, err = strconv.ParseFloat(raw, 64)
+	case VariableTypeBoolean:
+		value, err = strconv.ParseBool(raw)
+	case VariableTypeDate:
+		_, err = parseVariableDate(raw)
+		value = raw
+	case VariableTypeArray, VariableTypeObject:
+		err = json.Unmarshal([]byte(raw), &value)
+	default:
+		value = raw
+	}
+	if err != nil {
+		return nil, fmt.Errorf("default value of %s is not a valid %s", definition.Name, definition.Type)
+	}
+	return value, nil
+}
+
+// parseVariableDate parses a date variable, a date or an RFC 3339 timestamp
+func parseVariableDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// checkTemplateTree rejects templates calling functions that aren't whitelisted
+func checkTemplateTree(tree *parse.Tree) error {
+	if tree == nil || tree.Root == nil {
+		return nil
+	}
+	return checkTemplateNode(tree.Root)
+}
+
+func checkTemplateNode(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTemplateNode(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkTemplateNode(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			if err := checkTemplateNode(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if err := checkTemplateNode(arg); err != nil {
+				return err
+			}
+		}
+	case *parse.ChainNode:
+		return checkTemplateNode(n.Node)
+	case *parse.IdentifierNode:
+		if !templateHelperNames[n.Ident] && !allowedTemplateBuiltins[n.Ident] {
+			return invalid(fmt.Errorf("function %s is not allowed in templates", n.Ident))
+		}
+	case *parse.IfNode:
+		return checkBranchNode(&n.BranchNode)
+	case *parse.RangeNode:
+		return checkBranchNode(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranchNode(&n.BranchNode)
+	case *parse.TemplateNode:
+		return checkTemplateNode(n.Pipe)
+	}
+	return nil
+}
+
+func checkBranchNode(n *parse.BranchNode) error {
+	if err := checkTemplateNode(n.Pipe); err != nil {
+		return err
+	}
+	if err := checkTemplateNode(n.List); err != nil {
+		return err
+	}
+	if n.ElseList != nil {
+		return checkTemplateNode(n.ElseList)
+	}
+	return nil
+}
+
+// limitedWriter fails writes once more than remaining bytes were written
+type limitedWriter struct {
+	w         io.Writer
+	remaining int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.remaining {
+		return 0, errTemplateOutputTooLarge
+	}
+	l.remaining -= len(p)
+	return l.w.Write(p)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestVariablesAreCheckedAgainstTheirDefinition(t *testing.T) {
+	for name, test := range map[string]struct {
+		definition TemplateVariable
+		data       map[string]interface{}
+		rule       string
+		expected   interface{}
+	}{
+		"string":                {TemplateVariable{Name: "v", Type: VariableTypeString}, map[string]interface{}{"v": "depo"}, "", "depo"},
+		"untyped string":        {TemplateVariable{Name: "v"}, map[string]interface{}{"v": "depo"}, "", "depo"},
+		"number as string":      {TemplateVariable{Name: "v", Type: VariableTypeNumber}, map[string]interface{}{"v": "üç"}, VariableRuleType, nil},
+		"int":                   {TemplateVariable{Name: "v", Type: VariableTypeNumber}, map[string]interface{}{"v": 3}, "", 3},
+		"JSON number":           {TemplateVariable{Name: "v", Type: VariableTypeNumber}, map[string]interface{}{"v": json.Number("3.5")}, "", json.Number("3.5")},
+		"boolean":               {TemplateVariable{Name: "v", Type: VariableTypeBoolean}, map[string]interface{}{"v": "true"}, VariableRuleType, nil},
+		"date":                  {TemplateVariable{Name: "v", Type: VariableTypeDate}, map[string]interface{}{"v": "2026-03-02"}, "", "2026-03-02"},
+		"timestamp":             {TemplateVariable{Name: "v", Type: VariableTypeDate}, map[string]interface{}{"v": "2026-03-02T09:00:00+03:00"}, "", "2026-03-02T09:00:00+03:00"},
+		"not a date":            {TemplateVariable{Name: "v", Type: VariableTypeDate}, map[string]interface{}{"v": "02.03.2026"}, VariableRuleType, nil},
+		"array":                 {TemplateVariable{Name: "v", Type: VariableTypeArray}, map[string]interface{}{"v": []string{"A"}}, "", []string{"A"}},
+		"object as array":       {TemplateVariable{Name: "v", Type: VariableTypeArray}, map[string]interface{}{"v": map[string]interface{}{}}, VariableRuleType, nil},
+		"object":                {TemplateVariable{Name: "v", Type: VariableTypeObject}, map[string]interface{}{"v": map[string]interface{}{"a": 1}}, "", map[string]interface{}{"a": 1}},
+		"matching pattern":      {TemplateVariable{Name: "v", Validation: "^[A-Z]-[0-9]+$"}, map[string]interface{}{"v": "A-12"}, "", "A-12"},
+		"breaking pattern":      {TemplateVariable{Name: "v", Validation: "^[A-Z]-[0-9]+$"}, map[string]interface{}{"v": "depo"}, VariableRulePattern, nil},
+		"pattern of a number":   {TemplateVariable{Name: "v", Type: VariableTypeNumber, Validation: "^[0-9]$"}, map[string]interface{}{"v": 12}, VariableRulePattern, nil},
+		"missing and required":  {TemplateVariable{Name: "v", Required: true}, nil, VariableRuleRequired, nil},
+		"nil and required":      {TemplateVariable{Name: "v", Required: true}, map[string]interface{}{"v": nil}, VariableRuleRequired, nil},
+		"missing and optional":  {TemplateVariable{Name: "v"}, nil, "", nil},
+		"default":               {TemplateVariable{Name: "v", Required: true, DefaultValue: "İSG birimi"}, nil, "", "İSG birimi"},
+		"number default":        {TemplateVariable{Name: "v", Type: VariableTypeNumber, DefaultValue: "2.5"}, nil, "", 2.5},
+		"boolean default":       {TemplateVariable{Name: "v", Type: VariableTypeBoolean, DefaultValue: "true"}, nil, "", true},
+		"array default":         {TemplateVariable{Name: "v", Type: VariableTypeArray, DefaultValue: `["A"]`}, nil, "", []interface{}{"A"}},
+		"broken default":        {TemplateVariable{Name: "v", Type: VariableTypeNumber, DefaultValue: "iki"}, nil, VariableRuleDefault, nil},
+		"default of a given":    {TemplateVariable{Name: "v", DefaultValue: "İSG birimi"}, map[string]interface{}{"v": "Ayşe"}, "", "Ayşe"},
+		"type checked, no type": {TemplateVariable{Name: "v"}, map[string]interface{}{"v": 3}, VariableRuleType, nil},
+	} {
+		checked, err := applyVariableDefinitions([]TemplateVariable{test.definition}, test.data)
+		if test.rule == "" {
+			if err != nil {
+				t.Errorf("%s: expected the variable to pass, got %v", name, err)
+			} else if value, ok := checked["v"]; !ok || !reflect.DeepEqual(value, test.expected) {
+				t.Errorf("%s: expected %#v, got %#v", name, test.expected, value)
+			}
+			continue
+		}
+
+		var variablesErr *VariablesError
+		if !errors.As(err, &variablesErr) || !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: expected a variables error, got %v", name, err)
+			continue
+		}
+		if len(variablesErr.Errors) != 1 || variablesErr.Errors[0].Variable != "v" || variablesErr.Errors[0].Rule != test.rule {
+			t.Errorf("%s: expected v to break %s, got %+v", name, test.rule, variablesErr.Errors)
+		}
+	}
+
+	// Data of templates without definitions is left alone
+	data := map[string]interface{}{"v": 3}
+	if checked, err := applyVariableDefinitions(nil, data); err != nil || !reflect.DeepEqual(checked, data) {
+		t.Errorf("Expected data without definitions to pass unchanged, got %v (%v)", checked, err)
+	}
+}
+
+func TestVariableDefinitionsAreValidated(t *testing.T) {
+	for name, definitions := range map[string][]TemplateVariable{
+		"no name":         {{Type: VariableTypeString}},
+		"defined twice":   {{Name: "site"}, {Name: "site"}},
+		"unknown type":    {{Name: "site", Type: "text"}},
+		"invalid pattern": {{Name: "site", Validation: "^[A-Z"}},
+		"invalid default": {{Name: "count", Type: VariableTypeNumber, DefaultValue: "üç"}},
+		"invalid date":    {{Name: "due", Type: VariableTypeDate, DefaultValue: "yarın"}},
+		"invalid object":  {{Name: "owner", Type: VariableTypeObject, DefaultValue: "{"}},
+	} {
+		if err := validateVariableDefinitions(definitions); err == nil {
+			t.Errorf("%s: expected the definitions to be refused", name)
+		}
+	}
+
+	if err := validateVariableDefinitions([]TemplateVariable{
+		{Name: "site", Type: VariableTypeString, Required: true, Validation: "^[A-Z]-[0-9]+$"},
+		{Name: "due", Type: VariableTypeDate, DefaultValue: "2026-03-02"},
+		{Name: "sites", Type: VariableTypeArray, DefaultValue: `["A-1"]`},
+	}); err != nil {
+		t.Errorf("Expected the definitions to be valid, got %v", err)
+	}
+}
+
+func TestRendersReportEveryBrokenVariable(t *testing.T) {
+	env := newIntegrationEnv(t)
+	templates := env.service.templateService
+
+	template, err := templates.CreateTemplate(context.Background(), NotificationTemplate{
+		Name:     "inspection",
+		Type:     "inapp",
+		TenantID: "tenant-a",
+		Category: "safety",
+		IsActive: true,
+		Title:    "Denetim {{.site}}",
+		Message:  "{{.count}} bulgu, sorumlu {{.owner}}, son tarih {{.due}}",
+		Definitions: []TemplateVariable{
+			{Name: "site", Type: VariableTypeString, Required: true, Validation: "^[A-Z]-[0-9]+$"},
+			{Name: "count", Type: VariableTypeNumber, Required: true},
+			{Name: "owner", Type: VariableTypeString, DefaultValue: "İSG birimi"},
+			{Name: "due", Type: VariableTypeDate, Required: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	_, err = templates.RenderDraft(template.ID, map[string]interface{}{"site": "depo", "count": "üç"})
+	var variablesErr *VariablesError
+	if !errors.As(err, &variablesErr) || !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected template variable errors, got %v", err)
+	}
+	rules := map[string]string{}
+	for _, variableErr := range variablesErr.Errors {
+		rules[variableErr.Variable] = variableErr.Rule
+	}
+	expected := map[string]string{"site": VariableRulePattern, "count": VariableRuleType, "due": VariableRuleRequired}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected %v, got %+v", expected, variablesErr.Errors)
+	}
+
+	result, err := templates.RenderDraft(template.ID, map[string]interface{}{"site": "A-12", "count": 3, "due": "2026-03-02"})
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	if result.Message != "3 bulgu, sorumlu İSG birimi, son tarih 2026-03-02" {
+		t.Errorf("Expected the default of owner to be applied, got %q", result.Message)
+	}
+
+	if _, err := templates.CreateTemplate(context.Background(), NotificationTemplate{
+		Name:        "broken",
+		Type:        "inapp",
+		TenantID:    "tenant-a",
+		Category:    "safety",
+		Title:       "Denetim",
+		Message:     "{{.count}}",
+		Definitions: []TemplateVariable{{Name: "count", Type: VariableTypeNumber, DefaultValue: "üç"}},
+	}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected templates with broken definitions to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateSearchQuery selects the templates of a tenant containing every
+// word of a search
+type TemplateSearchQuery struct {
+	TenantID string
+	Search   string // matched against the words of the name, tags, subject and bodies
+	Locale   string
+	Type     string
+	Active   *bool // active or inactive templates only, both when nil
+	Page     int
+	Limit    int
+}
+
+// SearchTemplates returns a page of the templates matching a search, newest
+// first, and how many match in all. Searches run on the working copies.
+func (s *TemplateService) SearchTemplates(query TemplateSearchQuery) ([]*NotificationTemplate, int, error) {
+	terms := searchTerms(query.Search)
+	if len(terms) == 0 {
+		return nil, 0, invalid(fmt.Errorf("search must have a word of at least %d characters", minSearchTermLength))
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.Limit < 1 {
+		query.Limit = 20
+	}
+
+	ctx := context.Background()
+	if err := s.ensureTemplateSearchIndex(ctx, query.TenantID); err != nil {
+		return nil, 0, err
+	}
+
+	keys := make([]string, len(terms))
+	for i, term := range terms {
+		keys[i] = s.getTemplateSearchKey(query.TenantID, term)
+	}
+	templateIDs, err := s.redis.SInter(ctx, keys...).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search templates: %w", err)
+	}
+
+	var matches []*NotificationTemplate
+	for _, id := range templateIDs {
+		template, err := s.GetTemplate(id)
+		if err != nil {
+			log.Warn().Err(err).Str("templateID", id).Msg("Failed to get template")
+			continue
+		}
+		if query.Locale != "" && !sameLocale(template.Locale, query.Locale) {
+			continue
+		}
+		if query.Type != "" && template.Type != query.Type {
+			continue
+		}
+		if query.Active != nil && template.IsActive != *query.Active {
+			continue
+		}
+		matches = append(matches, template)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	start := (query.Page - 1) * query.Limit
+	if start >= len(matches) {
+		return []*NotificationTemplate{}, len(matches), nil
+	}
+	end := start + query.Limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	return matches[start:end], len(matches), nil
+}
+
+// indexTemplateTerms makes a template searchable by the words of its
+// current content, dropping the words it no longer contains
+func (s *TemplateService) indexTemplateTerms(ctx context.Context, template *NotificationTemplate) error {
+	termsKey := s.getTemplateTermsKey(template.TenantID)
+
+	previous, err := s.redis.HGet(ctx, termsKey, template.ID).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get indexed search terms: %w", err)
+	}
+
+	terms := searchTerms(templateText(template))
+	current := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		current[term] = true
+	}
+
+	pipe := s.redis.TxPipeline()
+	for _, term := range strings.Fields(previous) {
+		if !current[term] {
+			pipe.SRem(ctx, s.getTemplateSearchKey(template.TenantID, term), template.ID)
+		}
+	}
+	for _, term := range terms {
+		pipe.SAdd(ctx, s.getTemplateSearchKey(template.TenantID, term), template.ID)
+	}
+	if len(terms) > 0 {
+		pipe.HSet(ctx, termsKey, template.ID, strings.Join(terms, " "))
+	} else {
+		pipe.HDel(ctx, termsKey, template.ID)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to index search terms: %w", err)
+	}
+
+	return nil
+}
+
+// unindexTemplateTerms makes a deleted template unsearchable
+func (s *TemplateService) unindexTemplateTerms(ctx context.Context, template *NotificationTemplate) error {
+	termsKey := s.getTemplateTermsKey(template.TenantID)
+
+	joined, err := s.redis.HGet(ctx, termsKey, template.ID).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get indexed search terms: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	for _, term := range strings.Fields(joined) {
+		pipe.SRem(ctx, s.getTemplateSearchKey(template.TenantID, term), template.ID)
+	}
+	pipe.HDel(ctx, termsKey, template.ID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete indexed search terms: %w", err)
+	}
+
+	return nil
+}
+
+// ensureTemplateSearchIndex indexes the templates of a tenant that predate
+// the search index
+func (s *TemplateService) ensureTemplateSearchIndex(ctx context.Context, tenantID string) error {
+	markerKey := s.getTemplateSearchIndexedKey(tenantID)
+
+	indexed, err := s.redis.Exists(ctx, markerKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check template search index: %w", err)
+	}
+	if indexed > 0 {
+		return nil
+	}
+
+	templateIDs, err := s.redis.ZRange(ctx, s.getTemplatesKey(tenantID), 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get template IDs: %w", err)
+	}
+
+	for _, id := range templateIDs {
+		template, err := s.GetTemplate(id)
+		if err != nil {
+			log.Warn().Err(err).Str("templateID", id).Msg("Failed to get template")
+			continue
+		}
+		if err := s.indexTemplateTerms(ctx, template); err != nil {
+			return fmt.Errorf("failed to build template search index: %w", err)
+		}
+	}
+
+	if err := s.redis.Set(ctx, markerKey, 1, 0).Err(); err != nil {
+		return fmt.Errorf("failed to build template search index: %w", err)
+	}
+
+	return nil
+}
+
+// Redis key generators
+func (s *TemplateService) getTemplateSearchKey(tenantID string, term string) string {
+	return fmt.Sprintf("template_search:%s:%s", retentionTenant(tenantID), term)
+}
+
+func (s *TemplateService) getTemplateTermsKey(tenantID string) string {
+	return fmt.Sprintf("template_search_terms:%s", retentionTenant(tenantID))
+}
+
+func (s *TemplateService) getTemplateSearchIndexedKey(tenantID string) string {
+	return fmt.Sprintf("template_search_indexed:%s", retentionTenant(tenantID))
+}
+
+// Helper functions
+
+// templateText returns the content a template is searchable by
+func templateText(template *NotificationTemplate) string {
+	return strings.Join([]string{
+		template.Name,
+		strings.Join(template.Tags, " "),
+		template.Subject,
+		template.Title,
+		template.Message,
+		template.TextBody,
+		htmlTagPattern.ReplaceAllString(template.HTMLBody, " "),
+	}, " ")
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// createSearchTestTemplates creates the templates searches run on: a Turkish
+// and an English PPE email and an inactive drill, plus a drill of another tenant
+func createSearchTestTemplates(t *testing.T, env *integrationEnv) []*NotificationTemplate {
+	t.Helper()
+
+	var created []*NotificationTemplate
+	for _, template := range []NotificationTemplate{
+		{Name: "ppe_violation", Type: "email", Locale: "tr", Tags: []string{"kkd"}, Subject: "KKD ihlali", HTMLBody: "<p>Baret takılmadan <b>sahaya</b> girildi</p>", IsActive: true},
+		{Name: "ppe_violation", Type: "email", Locale: "en", Tags: []string{"ppe"}, Subject: "PPE violation", HTMLBody: "<p>Entered the site without a helmet</p>", IsActive: true},
+		{Name: "drill", Type: "inapp", Locale: "tr", Title: "Tatbikat", Message: "Baret ve yelek ile toplanma alanına gelin"},
+		{Name: "drill", Type: "inapp", Locale: "tr", Title: "Tatbikat", Message: "Baret takın", TenantID: "tenant-b", IsActive: true},
+	} {
+		if template.TenantID == "" {
+			template.TenantID = "tenant-a"
+		}
+		template.Category = "safety"
+		result, err := env.service.templateService.CreateTemplate(context.Background(), template)
+		if err != nil {
+			t.Fatalf("Failed to create template: %v", err)
+		}
+		created = append(created, result)
+	}
+	return created
+}
+
+// searchTemplateIDs returns the IDs of the templates of tenant-a matching a query
+func searchTemplateIDs(t *testing.T, env *integrationEnv, query TemplateSearchQuery) []string {
+	t.Helper()
+
+	query.TenantID = "tenant-a"
+	results, total, err := env.service.templateService.SearchTemplates(query)
+	if err != nil {
+		t.Fatalf("Failed to search templates: %v", err)
+	}
+	if query.Limit == 0 && total != len(results) {
+		t.Errorf("Expected all %d matches on one page, got %d", total, len(results))
+	}
+	ids := []string{}
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func TestTemplatesAreSearchedByEveryWord(t *testing.T) {
+	env := newIntegrationEnv(t)
+	created := createSearchTestTemplates(t, env)
+	inactive := false
+
+	for name, test := range map[string]struct {
+		query    TemplateSearchQuery
+		expected []int // of created, newest first
+	}{
+		"word of a body":          {TemplateSearchQuery{Search: "baret"}, []int{2, 0}}, // not the drill of tenant-b
+		"in any case":             {TemplateSearchQuery{Search: "BARET"}, []int{2, 0}},
+		"in Turkish case":         {TemplateSearchQuery{Search: "TAKILMADAN"}, []int{0}},
+		"every word":              {TemplateSearchQuery{Search: "baret sahaya"}, []int{0}},
+		"word of the HTML":        {TemplateSearchQuery{Search: "sahaya"}, []int{0}},
+		"only short words":        {TemplateSearchQuery{Search: "p - b"}, nil},
+		"name":                    {TemplateSearchQuery{Search: "violation"}, []int{1, 0}},
+		"tag":                     {TemplateSearchQuery{Search: "kkd"}, []int{0}},
+		"subject":                 {TemplateSearchQuery{Search: "ihlali"}, []int{0}},
+		"title":                   {TemplateSearchQuery{Search: "tatbikat"}, []int{2}},
+		"of a locale":             {TemplateSearchQuery{Search: "violation", Locale: "en"}, []int{1}},
+		"of a type":               {TemplateSearchQuery{Search: "baret", Type: "email"}, []int{0}},
+		"inactive":                {TemplateSearchQuery{Search: "baret", Active: &inactive}, []int{2}},
+		"word of no template":     {TemplateSearchQuery{Search: "gözlük"}, []int{}},
+		"one word of no template": {TemplateSearchQuery{Search: "baret gözlük"}, []int{}},
+		"second page":             {TemplateSearchQuery{Search: "baret", Page: 2, Limit: 1}, []int{0}},
+		"past the last page":      {TemplateSearchQuery{Search: "baret", Page: 3, Limit: 1}, []int{}},
+	} {
+		if test.expected == nil {
+			test.query.TenantID = "tenant-a"
+			if _, _, err := env.service.templateService.SearchTemplates(test.query); !errors.Is(err, ErrValidation) {
+				t.Errorf("%s: expected searches without words to be refused, got %v", name, err)
+			}
+			continue
+		}
+
+		expected := []string{}
+		for _, i := range test.expected {
+			expected = append(expected, created[i].ID)
+		}
+		if ids := searchTemplateIDs(t, env, test.query); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, ids)
+		}
+	}
+}
+
+func TestTemplateSearchIndexFollowsChanges(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	templates := env.service.templateService
+	created := createSearchTestTemplates(t, env)
+
+	if _, err := templates.UpdateTemplate(ctx, created[0].ID, map[string]interface{}{"html_body": "<p>Gözlük takılmadan sahaya girildi</p>"}); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+	if ids := searchTemplateIDs(t, env, TemplateSearchQuery{Search: "baret"}); len(ids) != 1 || ids[0] != created[2].ID {
+		t.Errorf("Expected updated templates to lose the words they no longer contain, got %v", ids)
+	}
+	if ids := searchTemplateIDs(t, env, TemplateSearchQuery{Search: "gözlük"}); len(ids) != 1 || ids[0] != created[0].ID {
+		t.Errorf("Expected updated templates to be searchable by their new words, got %v", ids)
+	}
+
+	if err := templates.DeleteTemplate(ctx, created[2].ID); err != nil {
+		t.Fatalf("Failed to delete template: %v", err)
+	}
+	if ids := searchTemplateIDs(t, env, TemplateSearchQuery{Search: "tatbikat"}); len(ids) != 0 {
+		t.Errorf("Expected deleted templates to be unsearchable, got %v", ids)
+	}
+	if members := templates.redis.SMembers(ctx, templates.getTemplateSearchKey("tenant-a", "yelek")).Val(); len(members) != 0 {
+		t.Errorf("Expected the words of deleted templates to be dropped, got %v", members)
+	}
+
+	// Templates stored before the index are indexed on the first search
+	if err := templates.redis.Del(ctx, templates.getTemplateSearchIndexedKey("tenant-a"), templates.getTemplateTermsKey("tenant-a"), templates.getTemplateSearchKey("tenant-a", "helmet")).Err(); err != nil {
+		t.Fatalf("Failed to drop search index: %v", err)
+	}
+	if ids := searchTemplateIDs(t, env, TemplateSearchQuery{Search: "helmet"}); len(ids) != 1 || ids[0] != created[1].ID {
+		t.Errorf("Expected the search index to be rebuilt, got %v", ids)
+	}
+}
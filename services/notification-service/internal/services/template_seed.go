@@ -0,0 +1,122 @@
+package services
+
+// Categories of the default templates
+const (
+	TemplateCategorySafety    = "safety"
+	TemplateCategoryTraining  = "training"
+	TemplateCategoryDocuments = "documents"
+)
+
+// DefaultTemplates returns the curated occupational safety templates new
+// tenants start with. Each call returns new copies callers may change.
+func DefaultTemplates() []NotificationTemplate {
+	return []NotificationTemplate{
+		{
+			Name:     "incident_alert",
+			Type:     "email",
+			Category: TemplateCategorySafety,
+			Priority: "urgent",
+			Locale:   "tr",
+			Tags:     []string{"iş güvenliği", "olay"},
+			Subject:  "Olay Bildirimi: {{.IncidentType}} - {{.Location}}",
+			Title:    "Olay Bildirimi",
+			Message:  "{{.Location}} alanında {{.IncidentType}} olayı bildirildi. Önem derecesi: {{.Severity}}.",
+			HTMLBody: `<h1>Olay Bildirimi</h1><p><strong>{{.Location}}</strong> alanında <strong>{{.IncidentType}}</strong> olayı bildirildi.</p>` +
+				`<ul><li>Önem derecesi: {{.Severity}}</li><li>Olay zamanı: {{.OccurredAt}}</li><li>Bildiren: {{.ReportedBy}}</li></ul>` +
+				`{{if .IncidentURL}}<p><a href="{{.IncidentURL}}">Olay kaydını görüntüleyin</a></p>{{end}}`,
+			TextBody: "Olay Bildirimi\n\n{{.Location}} alanında {{.IncidentType}} olayı bildirildi.\n\nÖnem derecesi: {{.Severity}}\nOlay zamanı: {{.OccurredAt}}\nBildiren: {{.ReportedBy}}" +
+				"{{if .IncidentURL}}\n\nOlay kaydı: {{.IncidentURL}}{{end}}",
+			Definitions: []TemplateVariable{
+				{Name: "IncidentType", Type: VariableTypeString, Required: true, Description: "Olayın türü, ör. yaralanma, ramak kala"},
+				{Name: "Location", Type: VariableTypeString, Required: true, Description: "Olayın gerçekleştiği alan"},
+				{Name: "Severity", Type: VariableTypeString, DefaultValue: "Belirtilmedi", Description: "Önem derecesi"},
+				{Name: "OccurredAt", Type: VariableTypeDate, Required: true, Description: "Olay zamanı"},
+				{Name: "ReportedBy", Type: VariableTypeString, Required: true, Description: "Olayı bildiren kişi"},
+				{Name: "IncidentURL", Type: VariableTypeString, Description: "Olay kaydının adresi"},
+			},
+		},
+		{
+			Name:     "toolbox_talk_reminder",
+			Type:     "email",
+			Category: TemplateCategorySafety,
+			Priority: "normal",
+			Locale:   "tr",
+			Tags:     []string{"iş güvenliği", "eğitim"},
+			Subject:  "Hatırlatma: {{.Topic}} konulu iş başı konuşması",
+			Title:    "İş Başı Konuşması",
+			Message:  "{{.Topic}} konulu iş başı konuşması {{.Date}} tarihinde {{.Location}} alanında yapılacak.",
+			HTMLBody: `<h1>İş Başı Konuşması</h1><p><strong>{{.Topic}}</strong> konulu iş başı konuşması <strong>{{.Date}}</strong> tarihinde <strong>{{.Location}}</strong> alanında yapılacak.</p>` +
+				`<p>Konuşmayı yürüten: {{.Supervisor}}</p><p>Lütfen kişisel koruyucu donanımlarınızla zamanında katılın.</p>`,
+			TextBody: "İş Başı Konuşması\n\n{{.Topic}} konulu iş başı konuşması {{.Date}} tarihinde {{.Location}} alanında yapılacak.\n\nKonuşmayı yürüten: {{.Supervisor}}\n\nLütfen kişisel koruyucu donanımlarınızla zamanında katılın.",
+			Definitions: []TemplateVariable{
+				{Name: "Topic", Type: VariableTypeString, Required: true, Description: "Konuşmanın konusu"},
+				{Name: "Date", Type: VariableTypeDate, Required: true, Description: "Konuşmanın tarihi"},
+				{Name: "Location", Type: VariableTypeString, Required: true, Description: "Toplanma alanı"},
+				{Name: "Supervisor", Type: VariableTypeString, Required: true, Description: "Konuşmayı yürüten kişi"},
+			},
+		},
+		{
+			Name:     "ppe_violation",
+			Type:     "email",
+			Category: TemplateCategorySafety,
+			Priority: "high",
+			Locale:   "tr",
+			Tags:     []string{"iş güvenliği", "kkd"},
+			Subject:  "KKD İhlali: {{.WorkerName}} - {{.Location}}",
+			Title:    "KKD İhlali",
+			Message:  "{{.WorkerName}}, {{.Location}} alanında {{.MissingEquipment}} kullanmadan çalışırken tespit edildi.",
+			HTMLBody: `<h1>Kişisel Koruyucu Donanım İhlali</h1><p><strong>{{.WorkerName}}</strong>, <strong>{{.Location}}</strong> alanında <strong>{{.MissingEquipment}}</strong> kullanmadan çalışırken tespit edildi.</p>` +
+				`<p>Tespit zamanı: {{.DetectedAt}}</p><p>Gerekli aksiyon: {{.ActionRequired}}</p>`,
+			TextBody: "Kişisel Koruyucu Donanım İhlali\n\n{{.WorkerName}}, {{.Location}} alanında {{.MissingEquipment}} kullanmadan çalışırken tespit edildi.\n\nTespit zamanı: {{.DetectedAt}}\nGerekli aksiyon: {{.ActionRequired}}",
+			Definitions: []TemplateVariable{
+				{Name: "WorkerName", Type: VariableTypeString, Required: true, Description: "İhlali yapan çalışan"},
+				{Name: "Location", Type: VariableTypeString, Required: true, Description: "İhlalin tespit edildiği alan"},
+				{Name: "MissingEquipment", Type: VariableTypeString, Required: true, Description: "Kullanılmayan donanım, ör. baret, emniyet kemeri"},
+				{Name: "DetectedAt", Type: VariableTypeDate, Required: true, Description: "Tespit zamanı"},
+				{Name: "ActionRequired", Type: VariableTypeString, DefaultValue: "Çalışma durdurulmalı ve eksik donanım tamamlanmalıdır.", Description: "Alınması gereken aksiyon"},
+			},
+		},
+		{
+			Name:     "training_expiry",
+			Type:     "email",
+			Category: TemplateCategoryTraining,
+			Priority: "high",
+			Locale:   "tr",
+			Tags:     []string{"eğitim", "sertifika"},
+			Subject:  "{{.TrainingName}} eğitiminizin süresi doluyor",
+			Title:    "Eğitim Süresi Doluyor",
+			Message:  "{{.EmployeeName}}, {{.TrainingName}} eğitiminizin geçerliliği {{.ExpiryDate}} tarihinde sona eriyor ({{.DaysLeft}} gün kaldı).",
+			HTMLBody: `<h1>Eğitim Süresi Doluyor</h1><p>Sayın {{.EmployeeName}},</p><p><strong>{{.TrainingName}}</strong> eğitiminizin geçerliliği <strong>{{.ExpiryDate}}</strong> tarihinde sona eriyor ({{.DaysLeft}} gün kaldı).</p>` +
+				`{{if .EnrollURL}}<p><a href="{{.EnrollURL}}">Yenileme eğitimine kaydolun</a></p>{{end}}`,
+			TextBody: "Eğitim Süresi Doluyor\n\nSayın {{.EmployeeName}},\n\n{{.TrainingName}} eğitiminizin geçerliliği {{.ExpiryDate}} tarihinde sona eriyor ({{.DaysLeft}} gün kaldı)." +
+				"{{if .EnrollURL}}\n\nYenileme eğitimine kaydolun: {{.EnrollURL}}{{end}}",
+			Definitions: []TemplateVariable{
+				{Name: "EmployeeName", Type: VariableTypeString, Required: true, Description: "Eğitimi alan çalışan"},
+				{Name: "TrainingName", Type: VariableTypeString, Required: true, Description: "Eğitimin adı, ör. Yüksekte Çalışma"},
+				{Name: "ExpiryDate", Type: VariableTypeDate, Required: true, Description: "Geçerliliğin bittiği tarih"},
+				{Name: "DaysLeft", Type: VariableTypeNumber, Required: true, Description: "Kalan gün sayısı"},
+				{Name: "EnrollURL", Type: VariableTypeString, Description: "Yenileme eğitimine kayıt adresi"},
+			},
+		},
+		{
+			Name:     "document_approval",
+			Type:     "email",
+			Category: TemplateCategoryDocuments,
+			Priority: "normal",
+			Locale:   "tr",
+			Tags:     []string{"doküman", "onay"},
+			Subject:  "Onayınız bekleniyor: {{.DocumentTitle}}",
+			Title:    "Doküman Onayı",
+			Message:  "{{.RequestedBy}}, {{.DocumentTitle}} dokümanı için onayınızı bekliyor. Son tarih: {{.DueDate}}.",
+			HTMLBody: `<h1>Doküman Onayı</h1><p><strong>{{.RequestedBy}}</strong>, <strong>{{.DocumentTitle}}</strong> dokümanı için onayınızı bekliyor.</p>` +
+				`<p>Son tarih: {{.DueDate}}</p><p><a href="{{.ApprovalURL}}">Dokümanı inceleyin ve onaylayın</a></p>`,
+			TextBody: "Doküman Onayı\n\n{{.RequestedBy}}, {{.DocumentTitle}} dokümanı için onayınızı bekliyor.\n\nSon tarih: {{.DueDate}}\nİnceleyin ve onaylayın: {{.ApprovalURL}}",
+			Definitions: []TemplateVariable{
+				{Name: "DocumentTitle", Type: VariableTypeString, Required: true, Description: "Onaylanacak doküman"},
+				{Name: "RequestedBy", Type: VariableTypeString, Required: true, Description: "Onay isteyen kişi"},
+				{Name: "DueDate", Type: VariableTypeDate, Required: true, Description: "Onay için son tarih"},
+				{Name: "ApprovalURL", Type: VariableTypeString, Required: true, Description: "Onay sayfasının adresi"},
+			},
+		},
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TemplateStore is the durable storage of templates, the source of truth
+// the template cache reads through to. Templates are never expired from it.
+type TemplateStore interface {
+	GetTemplate(ctx context.Context, templateID string) ([]byte, error)
+	PutTemplate(ctx context.Context, templateID string, templateJSON []byte) error
+	DeleteTemplate(ctx context.Context, templateID string) error
+}
+
+// redisTemplateStore stores templates in Redis without an expiry
+type redisTemplateStore struct {
+	redis *redis.Client
+}
+
+func (r *redisTemplateStore) GetTemplate(ctx context.Context, templateID string) ([]byte, error) {
+	templateJSON, err := r.redis.Get(ctx, r.getTemplateKey(templateID)).Bytes()
+	if err == redis.Nil {
+		return nil, notFoundf("template not found: %s", templateID)
+	}
+	return templateJSON, err
+}
+
+func (r *redisTemplateStore) PutTemplate(ctx context.Context, templateID string, templateJSON []byte) error {
+	return r.redis.Set(ctx, r.getTemplateKey(templateID), templateJSON, 0).Err()
+}
+
+func (r *redisTemplateStore) DeleteTemplate(ctx context.Context, templateID string) error {
+	return r.redis.Del(ctx, r.getTemplateKey(templateID)).Err()
+}
+
+// persistTemplates removes the expiry templates stored before the durable
+// store were written with, so they don't disappear after the cache TTL
+func (r *redisTemplateStore) persistTemplates(ctx context.Context) (int, error) {
+	persisted := 0
+	iter := r.redis.Scan(ctx, 0, r.getTemplateKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		ok, err := r.redis.Persist(ctx, iter.Val()).Result()
+		if err != nil {
+			return persisted, err
+		}
+		if ok {
+			persisted++
+		}
+	}
+	return persisted, iter.Err()
+}
+
+// Redis key generators
+func (r *redisTemplateStore) getTemplateKey(templateID string) string {
+	return fmt.Sprintf("template:%s", templateID)
+}
+
+// templateCache is the in-process read-through cache of templates. Entries
+// expire after the cache TTL and are invalidated when a template changes
+// through this instance; other instances see the change once theirs expire.
+type templateCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]templateCacheEntry
+}
+
+type templateCacheEntry struct {
+	templateJSON []byte
+	expiresAt    time.Time
+}
+
+func newTemplateCache(ttl time.Duration) *templateCache {
+	return &templateCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]templateCacheEntry),
+	}
+}
+
+func (c *templateCache) get(templateID string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[templateID]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, templateID)
+		return nil, false
+	}
+	return entry.templateJSON, true
+}
+
+func (c *templateCache) set(templateID string, templateJSON []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[templateID] = templateCacheEntry{
+		templateJSON: templateJSON,
+		expiresAt:    c.now().Add(c.ttl),
+	}
+}
+
+func (c *templateCache) invalidate(templateID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, templateID)
+}
+
+// GetTemplate gets a notification template by ID, from the cache when it
+// holds the template and from the store otherwise
+func (s *TemplateService) GetTemplate(templateID string) (*NotificationTemplate, error) {
+	templateJSON, ok := s.cache.get(templateID)
+	if !ok {
+		var err error
+		templateJSON, err = s.store.GetTemplate(context.Background(), templateID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to get template: %w", err)
+		}
+		s.cache.set(templateID, templateJSON)
+	}
+
+	// Every caller gets its own copy to change
+	var template NotificationTemplate
+	if err := json.Unmarshal(templateJSON, &template); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal template: %w", err)
+	}
+
+	return &template, nil
+}
+
+// storeWorkingCopy stores the editable copy of a template
+func (s *TemplateService) storeWorkingCopy(template *NotificationTemplate) error {
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template: %w", err)
+	}
+
+	if err := s.store.PutTemplate(context.Background(), template.ID, templateJSON); err != nil {
+		return fmt.Errorf("failed to store template: %w", err)
+	}
+	s.cache.invalidate(template.ID)
+
+	return nil
+}
+
+// removeTemplate deletes a template from the store and the cache
+func (s *TemplateService) removeTemplate(templateID string) error {
+	if err := s.store.DeleteTemplate(context.Background(), templateID); err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	s.cache.invalidate(templateID)
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryTemplateStore is a template store counting the reads reaching it
+type memoryTemplateStore struct {
+	mu        sync.Mutex
+	templates map[string][]byte
+	reads     int
+}
+
+func (m *memoryTemplateStore) GetTemplate(ctx context.Context, templateID string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reads++
+	templateJSON, ok := m.templates[templateID]
+	if !ok {
+		return nil, notFoundf("template not found: %s", templateID)
+	}
+	return templateJSON, nil
+}
+
+func (m *memoryTemplateStore) PutTemplate(ctx context.Context, templateID string, templateJSON []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.templates[templateID] = templateJSON
+	return nil
+}
+
+func (m *memoryTemplateStore) DeleteTemplate(ctx context.Context, templateID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.templates, templateID)
+	return nil
+}
+
+// newTemplateStoreTestService returns a template service caching for a
+// minute and a function moving its clock forward
+func newTemplateStoreTestService(t *testing.T) (*TemplateService, *memoryTemplateStore, func(time.Duration)) {
+	t.Helper()
+
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	cache := newTemplateCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	store := &memoryTemplateStore{templates: make(map[string][]byte)}
+	service := &TemplateService{
+		store:  store,
+		cache:  cache,
+		config: TemplateConfig{CacheTTL: time.Minute},
+	}
+
+	return service, store, func(d time.Duration) { now = now.Add(d) }
+}
+
+func storeTestTemplate(t *testing.T, service *TemplateService, title string) {
+	t.Helper()
+
+	template := &NotificationTemplate{
+		ID:       "tmpl-1",
+		Name:     "ppe_violation",
+		Type:     "email",
+		Title:    title,
+		Message:  "{{.Worker}} KKD kullanmadan sahaya girdi",
+		IsActive: true,
+	}
+	if err := service.storeWorkingCopy(template); err != nil {
+		t.Fatalf("Failed to store template: %v", err)
+	}
+}
+
+func TestTemplateSurvivesCacheExpiry(t *testing.T) {
+	service, store, advance := newTemplateStoreTestService(t)
+	storeTestTemplate(t, service, "KKD ihlali")
+
+	if _, err := service.GetTemplate("tmpl-1"); err != nil {
+		t.Fatalf("Expected template, got %v", err)
+	}
+	if _, err := service.GetTemplate("tmpl-1"); err != nil {
+		t.Fatalf("Expected cached template, got %v", err)
+	}
+	if store.reads != 1 {
+		t.Errorf("Expected the second read to be cached, store was read %d times", store.reads)
+	}
+
+	// Long after the cache TTL the template is read from the store again
+	advance(24 * time.Hour)
+
+	template, err := service.GetTemplate("tmpl-1")
+	if err != nil {
+		t.Fatalf("Expected template to survive cache expiry, got %v", err)
+	}
+	if template.Title != "KKD ihlali" {
+		t.Errorf("Expected title KKD ihlali, got %s", template.Title)
+	}
+	if store.reads != 2 {
+		t.Errorf("Expected the expired entry to be read through, store was read %d times", store.reads)
+	}
+}
+
+func TestTemplateCacheInvalidatedOnUpdate(t *testing.T) {
+	service, _, _ := newTemplateStoreTestService(t)
+	storeTestTemplate(t, service, "KKD ihlali")
+
+	if _, err := service.GetTemplate("tmpl-1"); err != nil {
+		t.Fatalf("Expected template, got %v", err)
+	}
+
+	storeTestTemplate(t, service, "KKD ihlali tespit edildi")
+
+	template, err := service.GetTemplate("tmpl-1")
+	if err != nil {
+		t.Fatalf("Expected template, got %v", err)
+	}
+	if template.Title != "KKD ihlali tespit edildi" {
+		t.Errorf("Expected the updated title, got %s", template.Title)
+	}
+}
+
+func TestTemplateCacheInvalidatedOnDelete(t *testing.T) {
+	service, _, _ := newTemplateStoreTestService(t)
+	storeTestTemplate(t, service, "KKD ihlali")
+
+	if _, err := service.GetTemplate("tmpl-1"); err != nil {
+		t.Fatalf("Expected template, got %v", err)
+	}
+	if err := service.removeTemplate("tmpl-1"); err != nil {
+		t.Fatalf("Failed to remove template: %v", err)
+	}
+
+	if _, err := service.GetTemplate("tmpl-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected not found after delete, got %v", err)
+	}
+}
+
+func TestCachedTemplatesAreCopies(t *testing.T) {
+	service, _, _ := newTemplateStoreTestService(t)
+	storeTestTemplate(t, service, "KKD ihlali")
+
+	template, err := service.GetTemplate("tmpl-1")
+	if err != nil {
+		t.Fatalf("Expected template, got %v", err)
+	}
+	template.Title = "changed"
+
+	cached, err := service.GetTemplate("tmpl-1")
+	if err != nil {
+		t.Fatalf("Expected template, got %v", err)
+	}
+	if cached.Title != "KKD ihlali" {
+		t.Errorf("Expected changes to a returned template not to reach the cache, got %s", cached.Title)
+	}
+}
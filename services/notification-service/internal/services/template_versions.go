@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Template statuses
+const (
+	TemplateStatusDraft     = "draft"
+	TemplateStatusPublished = "published"
+)
+
+// templateContentFields are the updates that change what a template renders
+var templateContentFields = []string{
+	"type", "locale", "subject", "title", "message", "html_body", "text_body", "priority", "category", "parent_id", "variable_definitions",
+}
+
+// PublishTemplate publishes the working copy of a template as an immutable
+// version, which notifications are sent with from then on
+func (s *TemplateService) PublishTemplate(templateID string) (*NotificationTemplate, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	exists, err := s.versionExists(templateID, template.Version)
+	if err != nil {
+		return nil, err
+	}
+	if exists && template.PublishedVersion == template.Version {
+		return nil, conflictf("template %s has no draft to publish", templateID)
+	}
+
+	now := time.Now()
+	template.Status = TemplateStatusPublished
+	template.PublishedVersion = template.Version
+	template.PublishedAt = &now
+
+	// A version rolled back from is published again as it was stored
+	if !exists {
+		if err := s.storeVersion(template); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.storeWorkingCopy(template); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("templateID", templateID).
+		Int("version", template.Version).
+		Msg("Template published")
+
+	return template, nil
+}
+
+// RollbackTemplate makes notifications use an earlier published version of a
+// template. The working copy is left as it is.
+func (s *TemplateService) RollbackTemplate(templateID string, version int) (*NotificationTemplate, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	target, err := s.GetTemplateVersion(templateID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	template.PublishedVersion = target.Version
+	template.PublishedAt = target.PublishedAt
+	template.Status = TemplateStatusDraft
+	if target.Version == template.Version {
+		template.Status = TemplateStatusPublished
+	}
+
+	if err := s.storeWorkingCopy(template); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("templateID", templateID).
+		Int("version", version).
+		Msg("Template rolled back")
+
+	return template, nil
+}
+
+// GetTemplateVersions returns the published versions of a template, the newest first
+func (s *TemplateService) GetTemplateVersions(templateID string) ([]*NotificationTemplate, error) {
+	ctx := context.Background()
+
+	versions, err := s.redis.ZRevRange(ctx, s.getTemplateVersionsKey(templateID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template versions: %w", err)
+	}
+
+	var templates []*NotificationTemplate
+	for _, member := range versions {
+		version, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+		template, err := s.GetTemplateVersion(templateID, version)
+		if err != nil {
+			log.Warn().Err(err).Str("templateID", templateID).Int("version", version).Msg("Failed to get template version")
+			continue
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, nil
+}
+
+// GetTemplateVersion returns a published version of a template
+func (s *TemplateService) GetTemplateVersion(templateID string, version int) (*NotificationTemplate, error) {
+	ctx := context.Background()
+
+	templateJSON, err := s.redis.Get(ctx, s.getTemplateVersionKey(templateID, version)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, notFoundf("template version not found: %s v%d", templateID, version)
+		}
+		return nil, fmt.Errorf("failed to get template version: %w", err)
+	}
+
+	var template NotificationTemplate
+	if err := json.Unmarshal([]byte(templateJSON), &template); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal template version: %w", err)
+	}
+
+	return &template, nil
+}
+
+// GetPublishedTemplate returns the version of a template notifications are sent with
+func (s *TemplateService) GetPublishedTemplate(templateID string) (*NotificationTemplate, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	return s.publishedVersion(template)
+}
+
+// publishedVersion returns the published version of a template
+func (s *TemplateService) publishedVersion(template *NotificationTemplate) (*NotificationTemplate, error) {
+	// Templates stored before versioning are used as they are
+	if template.Status == "" {
+		return template, nil
+	}
+	if template.PublishedVersion == 0 {
+		return nil, conflictf("template %s has no published version", template.ID)
+	}
+
+	published, err := s.GetTemplateVersion(template.ID, template.PublishedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Activation applies to every version
+	published.IsActive = template.IsActive
+	return published, nil
+}
+
+// storeVersion stores a version of a template, which is never changed after
+func (s *TemplateService) storeVersion(template *NotificationTemplate) error {
+	ctx := context.Background()
+
+	templateJSON, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template version: %w", err)
+	}
+
+	stored, err := s.redis.SetNX(ctx, s.getTemplateVersionKey(template.ID, template.Version), templateJSON, 0).Result()
+	if err != nil {
+		return fmt.Errorf("failed to store template version: %w", err)
+	}
+	if !stored {
+		return conflictf("template version already exists: %s v%d", template.ID, template.Version)
+	}
+
+	if err := s.redis.ZAdd(ctx, s.getTemplateVersionsKey(template.ID), &redis.Z{
+		Score:  float64(template.Version),
+		Member: strconv.Itoa(template.Version),
+	}).Err(); err != nil {
+		return fmt.Errorf("failed to index template version: %w", err)
+	}
+
+	return nil
+}
+
+// versionExists tells whether a version of a template was published
+func (s *TemplateService) versionExists(templateID string, version int) (bool, error) {
+	ctx := context.Background()
+
+	count, err := s.redis.Exists(ctx, s.getTemplateVersionKey(templateID, version)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check template version: %w", err)
+	}
+	return count > 0, nil
+}
+
+// deleteVersions removes every version of a deleted template
+func (s *TemplateService) deleteVersions(templateID string) error {
+	ctx := context.Background()
+	versionsKey := s.getTemplateVersionsKey(templateID)
+
+	versions, err := s.redis.ZRange(ctx, versionsKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get template versions: %w", err)
+	}
+
+	keys := []string{versionsKey}
+	for _, member := range versions {
+		if version, err := strconv.Atoi(member); err == nil {
+			keys = append(keys, s.getTemplateVersionKey(templateID, version))
+		}
+	}
+
+	return s.redis.Del(ctx, keys...).Err()
+}
+
+// Redis key generators
+func (s *TemplateService) getTemplateVersionKey(templateID string, version int) string {
+	return fmt.Sprintf("template_version:%s:%d", templateID, version)
+}
+
+func (s *TemplateService) getTemplateVersionsKey(templateID string) string {
+	return fmt.Sprintf("template_versions:%s", templateID)
+}
+
+// Helper functions
+
+// hasContentUpdates tells whether updates change what a template renders
+func hasContentUpdates(updates map[string]interface{}) bool {
+	for _, field := range templateContentFields {
+		if _, ok := updates[field]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// maxThreadKeyLength bounds the thread keys notifications are grouped by
+const maxThreadKeyLength = 200
+
+// NotificationThread groups the notifications of a user sharing a thread
+// key, like every update about one incident
+type NotificationThread struct {
+	ThreadKey      string             `json:"thread_key"`
+	Count          int64              `json:"count"`
+	UnreadCount    int64              `json:"unread_count"`
+	Latest         *InAppNotification `json:"latest"`
+	LastActivityAt time.Time          `json:"last_activity_at"`
+}
+
+// GetUserThreads gets the threads of a user, the most recently active first.
+// Notifications without a thread key are not part of any.
+func (s *InAppNotificationService) GetUserThreads(
+	ctx context.Context,
+	userID string,
+	tenantID string,
+	page int,
+	limit int,
+) ([]*NotificationThread, int, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	threadsKey := s.getThreadsKey(userID, tenantID)
+
+	s.deliverBroadcasts(ctx, userID, tenantID)
+
+	total, err := s.redis.ZCard(ctx, threadsKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get thread count: %w", err)
+	}
+
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
+
+	threadKeys, err := s.redis.ZRevRange(ctx, threadsKey, start, stop).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get thread keys: %w", err)
+	}
+
+	var threads []*NotificationThread
+	for _, threadKey := range threadKeys {
+		thread, err := s.getThread(ctx, userID, tenantID, threadKey)
+		if err != nil {
+			log.Warn().Err(err).Str("threadKey", threadKey).Msg("Failed to get thread")
+			continue
+		}
+		if thread == nil {
+			// Every notification of the thread expired or was deleted
+			s.redis.ZRem(ctx, threadsKey, threadKey)
+			continue
+		}
+		threads = append(threads, thread)
+	}
+
+	return threads, int(total), nil
+}
+
+// getThread counts the notifications of a thread in the user's inbox and
+// loads the latest of them. It returns nil for threads left empty.
+func (s *InAppNotificationService) getThread(ctx context.Context, userID string, tenantID string, threadKey string) (*NotificationThread, error) {
+	// The user's list comes first so its ordering scores are kept, snoozed
+	// notifications are not in it and don't count
+	memberKey := s.getQueryKey()
+	unreadKey := s.getQueryKey()
+
+	pipe := s.redis.TxPipeline()
+	count := pipe.ZInterStore(ctx, memberKey, &redis.ZStore{
+		Keys:    []string{s.getUserNotificationsKey(userID, tenantID), s.getThreadKey(userID, tenantID, threadKey)},
+		Weights: []float64{1, 0},
+	})
+	unread := pipe.ZInterStore(ctx, unreadKey, &redis.ZStore{
+		Keys:    []string{memberKey, s.getUnreadKey(userID, tenantID)},
+		Weights: []float64{1, 0},
+	})
+	latest := pipe.ZRevRangeWithScores(ctx, memberKey, 0, 0)
+	pipe.Del(ctx, memberKey, unreadKey)
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to query thread: %w", err)
+	}
+	if count.Val() == 0 || len(latest.Val()) == 0 {
+		return nil, nil
+	}
+
+	newest := latest.Val()[0]
+	notification, err := s.GetNotification(ctx, newest.Member.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return &NotificationThread{
+		ThreadKey:      threadKey,
+		Count:          count.Val(),
+		UnreadCount:    unread.Val(),
+		Latest:         notification,
+		LastActivityAt: time.Unix(int64(newest.Score), 0),
+	}, nil
+}
+
+// MarkThreadAsRead marks every notification of a thread as read for a user
+// and returns how many were marked
+func (s *InAppNotificationService) MarkThreadAsRead(ctx context.Context, userID string, tenantID string, threadKey string) (int, error) {
+	ctx, cancel := s.withOperationTimeout(ctx)
+	defer cancel()
+
+	log.Info().
+		Str("userID", userID).
+		Str("threadKey", threadKey).
+		Msg("Marking thread as read")
+
+	unreadIDs, err := s.redis.SInter(ctx, s.getThreadKey(userID, tenantID, threadKey), s.getUnreadKey(userID, tenantID)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unread thread notifications: %w", err)
+	}
+
+	batchSize := s.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultInAppBatchSize
+	}
+
+	marked := 0
+	now := time.Now()
+	for i := 0; i < len(unreadIDs); i += batchSize {
+		end := i + batchSize
+		if end > len(unreadIDs) {
+			end = len(unreadIDs)
+		}
+
+		count, err := s.markBatchAsRead(ctx, userID, tenantID, unreadIDs[i:end], now)
+		if err != nil {
+			return marked, err
+		}
+		marked += count
+	}
+
+	return marked, nil
+}
+
+// touchThread queues the commands moving the thread of a notification to the
+// top of its user's threads
+func (s *InAppNotificationService) touchThread(ctx context.Context, pipe redis.Pipeliner, notification *InAppNotification, at time.Time) {
+	if notification.ThreadKey == "" {
+		return
+	}
+
+	threadsKey := s.getThreadsKey(notification.UserID, notification.TenantID)
+	pipe.ZAdd(ctx, threadsKey, &redis.Z{
+		Score:  float64(at.Unix()),
+		Member: notification.ThreadKey,
+	})
+	s.expireIndex(ctx, pipe, threadsKey)
+}
+
+// Redis key generators
+func (s *InAppNotificationService) getThreadsKey(userID string, tenantID string) string {
+	return fmt.Sprintf("notification_threads:%s:%s", tenantID, userID)
+}
+
+// getThreadKey returns the set of the notifications in a thread, it is one
+// of the user's filter indexes
+func (s *InAppNotificationService) getThreadKey(userID string, tenantID string, threadKey string) string {
+	return s.getFacetKey(userID, tenantID, "thread", threadKey)
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Timeline event types
+const (
+	TimelineEventCreated       = "created"
+	TimelineEventQueued        = "queued"
+	TimelineEventAttempt       = "attempt"
+	TimelineEventDelivered     = "delivered"
+	TimelineEventStatusChanged = "status_changed"
+	TimelineEventOpened        = "opened"
+	TimelineEventAcknowledged  = "acknowledged"
+	TimelineEventEscalated     = "escalated"
+)
+
+// maxTimelineEvents caps the events kept per notification, the oldest are
+// dropped first
+const maxTimelineEvents = 100
+
+// TimelineEvent is something that happened to a notification
+type TimelineEvent struct {
+	Type      string     `json:"type"`
+	At        time.Time  `json:"at"`
+	Status    string     `json:"status,omitempty"`
+	Attempt   int        `json:"attempt,omitempty"`
+	Error     string     `json:"error,omitempty"` // provider error of a failed attempt
+	MessageID string     `json:"message_id,omitempty"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"` // when a queued notification is sent
+}
+
+// NotificationTimeline is every event of a notification, oldest first
+type NotificationTimeline struct {
+	NotificationID string          `json:"notification_id"`
+	TenantID       string          `json:"tenant_id,omitempty"`
+	Status         string          `json:"status"`
+	Events         []TimelineEvent `json:"events"`
+}
+
+// timelineMetadataEvents are the events results record as a time in their metadata
+var timelineMetadataEvents = map[string]string{
+	"opened_at":    TimelineEventOpened,
+	"escalated_at": TimelineEventEscalated,
+}
+
+// GetNotificationTimeline returns the events of a notification. Notifications
+// stored before events were recorded get a timeline rebuilt from their result.
+func (s *NotificationService) GetNotificationTimeline(ctx context.Context, notificationID string) (*NotificationTimeline, error) {
+	result, err := s.GetNotificationStatus(ctx, notificationID)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsJSON, err := s.redis.LRange(ctx, s.getTimelineKey(notificationID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification events: %w", err)
+	}
+
+	timeline := &NotificationTimeline{
+		NotificationID: result.ID,
+		TenantID:       result.TenantID,
+		Status:         result.Status,
+		Events:         []TimelineEvent{},
+	}
+
+	for _, eventJSON := range eventsJSON {
+		var event TimelineEvent
+		if err := json.Unmarshal([]byte(eventJSON), &event); err == nil {
+			timeline.Events = append(timeline.Events, event)
+		}
+	}
+
+	if len(timeline.Events) == 0 {
+		timeline.Events = rebuildTimeline(*result)
+	}
+
+	return timeline, nil
+}
+
+// recordTimeline appends the events that turned the previous version of a
+// result into the stored one
+func (s *NotificationService) recordTimeline(ctx context.Context, previous *NotificationResult, result NotificationResult) {
+	events := timelineEvents(previous, result, time.Now())
+	if len(events) == 0 {
+		return
+	}
+
+	members := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		eventJSON, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		members = append(members, eventJSON)
+	}
+
+	key := s.getTimelineKey(result.ID)
+	pipe := s.redis.TxPipeline()
+	pipe.RPush(ctx, key, members...)
+	pipe.LTrim(ctx, key, -maxTimelineEvents, -1)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", result.ID).Msg("Failed to record notification events")
+	}
+}
+
+// recordTimelineEvent appends an event of a result stored without storeResult
+func (s *NotificationService) recordTimelineEvent(resultID string, event TimelineEvent) {
+	ctx := context.Background()
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	key := s.getTimelineKey(resultID)
+	pipe := s.redis.TxPipeline()
+	pipe.RPush(ctx, key, eventJSON)
+	pipe.LTrim(ctx, key, -maxTimelineEvents, -1)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("resultID", resultID).Msg("Failed to record notification event")
+	}
+}
+
+// markResultOpened stamps the delivery result of an in-app notification the
+// first time its recipient reads it
+func (s *NotificationService) markResultOpened(notification *InAppNotification) {
+	ctx := context.Background()
+
+	resultID, err := s.redis.Get(ctx, s.getMessageResultKey("inapp", notification.ID)).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Warn().Err(err).Str("notificationID", notification.ID).Msg("Failed to look up notification result")
+		}
+		return
+	}
+
+	result, err := s.GetNotificationStatus(ctx, resultID)
+	if err != nil {
+		return
+	}
+	if _, opened := result.Metadata["opened_at"]; opened {
+		return
+	}
+
+	result.Metadata = copyMetadata(result.Metadata)
+	result.Metadata["opened_at"] = time.Now()
+	if err := s.storeResult(*result); err != nil {
+		log.Warn().Err(err).Str("resultID", resultID).Msg("Failed to mark result opened")
+	}
+}
+
+// Redis key generators
+func (s *NotificationService) getTimelineKey(resultID string) string {
+	return fmt.Sprintf("notification_events:%s", resultID)
+}
+
+// Helper functions
+
+// timelineEvents returns the events between two versions of a result,
+// previous is nil for new results
+func timelineEvents(previous *NotificationResult, result NotificationResult, now time.Time) []TimelineEvent {
+	var events []TimelineEvent
+
+	var before NotificationResult
+	if previous != nil {
+		before = *previous
+	} else {
+		events = append(events, TimelineEvent{Type: TimelineEventCreated, At: result.CreatedAt})
+	}
+
+	// Sends count attempts, suppressed and muted deliveries only change status
+	attempted := result.Attempts > before.Attempts && (result.Status == "sent" || result.Status == "failed")
+	if attempted {
+		events = append(events, TimelineEvent{
+			Type:      TimelineEventAttempt,
+			At:        now,
+			Status:    result.Status,
+			Attempt:   result.Attempts,
+			Error:     result.Error,
+			MessageID: result.MessageID,
+		})
+	}
+
+	retryChanged := result.NextRetryAt != nil && (before.NextRetryAt == nil || !before.NextRetryAt.Equal(*result.NextRetryAt))
+	if retryChanged || (result.Status == "pending" && before.Status != "pending") {
+		events = append(events, TimelineEvent{
+			Type:    TimelineEventQueued,
+			At:      now,
+			Status:  result.Status,
+			RetryAt: result.NextRetryAt,
+		})
+	}
+
+	if !attempted && result.Status != before.Status && result.Status != "pending" {
+		event := TimelineEvent{
+			Type:   TimelineEventStatusChanged,
+			At:     now,
+			Status: result.Status,
+			Error:  result.Error,
+		}
+		if result.Status == "delivered" {
+			event.Type = TimelineEventDelivered
+		}
+		events = append(events, event)
+	}
+
+	if result.AcknowledgedAt != nil && before.AcknowledgedAt == nil {
+		events = append(events, TimelineEvent{Type: TimelineEventAcknowledged, At: *result.AcknowledgedAt})
+	}
+
+	for field, eventType := range timelineMetadataEvents {
+		if _, ok := result.Metadata[field]; !ok {
+			continue
+		}
+		if _, ok := before.Metadata[field]; ok {
+			continue
+		}
+		events = append(events, TimelineEvent{Type: eventType, At: now})
+	}
+
+	return events
+}
+
+// rebuildTimeline approximates the events of a result from its latest version
+func rebuildTimeline(result NotificationResult) []TimelineEvent {
+	events := []TimelineEvent{{Type: TimelineEventCreated, At: result.CreatedAt}}
+
+	if result.Attempts > 0 && result.SentAt != nil {
+		events = append(events, TimelineEvent{
+			Type:      TimelineEventAttempt,
+			At:        *result.SentAt,
+			Status:    "sent",
+			Attempt:   result.Attempts,
+			MessageID: result.MessageID,
+		})
+	}
+
+	switch result.Status {
+	case "pending":
+		events = append(events, TimelineEvent{
+			Type:    TimelineEventQueued,
+			At:      result.CreatedAt,
+			Status:  result.Status,
+			RetryAt: result.NextRetryAt,
+		})
+	case "delivered":
+		events = append(events, TimelineEvent{
+			Type:   TimelineEventDelivered,
+			At:     metadataTime(result.Metadata, "delivered_at", result.CreatedAt),
+			Status: result.Status,
+		})
+	case "sent":
+	default:
+		events = append(events, TimelineEvent{
+			Type:   TimelineEventStatusChanged,
+			At:     result.CreatedAt,
+			Status: result.Status,
+			Error:  result.Error,
+		})
+	}
+
+	for field, eventType := range timelineMetadataEvents {
+		if _, ok := result.Metadata[field]; ok {
+			events = append(events, TimelineEvent{Type: eventType, At: metadataTime(result.Metadata, field, result.CreatedAt)})
+		}
+	}
+
+	if result.AcknowledgedAt != nil {
+		events = append(events, TimelineEvent{Type: TimelineEventAcknowledged, At: *result.AcknowledgedAt})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At.Before(events[j].At)
+	})
+
+	return events
+}
+
+// metadataTime reads a time stored in metadata, which JSON turns into a string
+func metadataTime(metadata map[string]interface{}, field string, fallback time.Time) time.Time {
+	switch value := metadata[field].(type) {
+	case time.Time:
+		return value
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// Names of the built-in voice providers
+const (
+	VoiceProviderTwilio = "twilio"
+)
+
+// VoiceAckDigit is the key recipients press to acknowledge a call
+const VoiceAckDigit = "1"
+
+// VoiceService places automated calls reading a message out with
+// text-to-speech, for alerts that must reach someone when messages go unread
+type VoiceService struct {
+	config   VoiceConfig
+	provider VoiceProvider
+}
+
+// VoiceConfig holds voice call service configuration
+type VoiceConfig struct {
+	Provider   string // empty turns voice calls off
+	APIKey     string
+	APISecret  string
+	FromNumber string
+	BaseURL    string
+	// CallbackURL is the public URL of the voice callback endpoints,
+	// providers post call events to CallbackURL/status/<provider> and
+	// keypresses to CallbackURL/keypress/<provider>
+	CallbackURL string
+	Language    string        // language of the text-to-speech, e.g. tr-TR
+	Voice       string        // text-to-speech voice of the provider
+	RingTimeout time.Duration // how long a call rings before it is given up
+	DryRun      bool
+}
+
+// VoiceCall is an automated call reading a message out
+type VoiceCall struct {
+	To       string
+	From     string
+	Message  string
+	TenantID string
+	// AckToken lets the recipient acknowledge the notification by pressing
+	// VoiceAckDigit during the call
+	AckToken string
+}
+
+// VoiceCallResult represents a placed call
+type VoiceCallResult struct {
+	CallID           string
+	To               string
+	Status           string
+	SentAt           time.Time
+	Simulated        bool // dry run, no call was placed
+	ProviderResponse map[string]interface{}
+}
+
+// VoiceCallEvent is the outcome of a call reported by its provider
+type VoiceCallEvent struct {
+	CallID         string
+	Status         string // sent, delivered, failed
+	ProviderStatus string
+	AnsweredBy     string // human, voicemail, unknown
+	Duration       int    // seconds
+	Error          string
+}
+
+// VoiceProvider places calls and parses the callbacks they cause
+type VoiceProvider interface {
+	PlaceCall(ctx context.Context, call VoiceCall) (*VoiceCallResult, error)
+	// ParseCallEvent verifies and parses a call status callback
+	ParseCallEvent(callback SMSCallback) (*VoiceCallEvent, error)
+	// ParseKeypress verifies a keypress callback and returns the digits
+	// pressed during the call of an acknowledgment token
+	ParseKeypress(ackToken string, callback SMSCallback) (string, error)
+	// Reply returns the content type and body that speak a message to the
+	// caller in answer to a keypress
+	Reply(message string) (string, string)
+}
+
+// NewVoiceService creates a new voice call service instance
+func NewVoiceService(config VoiceConfig) (*VoiceService, error) {
+	// Set default values
+	if config.Language == "" {
+		config.Language = "tr-TR"
+	}
+	if config.RingTimeout == 0 {
+		config.RingTimeout = 30 * time.Second
+	}
+
+	service := &VoiceService{config: config}
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	switch strings.ToLower(config.Provider) {
+	case "":
+	case VoiceProviderTwilio:
+		if config.Voice == "" {
+			config.Voice = "Polly.Filiz"
+		}
+		service.config = config
+		service.provider = &TwilioVoiceProvider{config: config, client: client}
+	default:
+		return nil, fmt.Errorf("unsupported voice provider: %s", config.Provider)
+	}
+
+	return service, nil
+}
+
+// PlaceCall calls a number and reads the message out
+func (s *VoiceService) PlaceCall(ctx context.Context, call VoiceCall) (*VoiceCallResult, error) {
+	log.Info().
+		Str("to", call.To).
+		Str("message", truncateString(call.Message, 50)).
+		Bool("ack", call.AckToken != "").
+		Msg("Placing voice call")
+
+	if call.Message == "" {
+		return nil, invalid(fmt.Errorf("voice call message is required"))
+	}
+	if call.From == "" {
+		call.From = s.config.FromNumber
+	}
+
+	if s.config.DryRun {
+		log.Info().Str("to", call.To).Msg("Voice dry run, call not placed")
+		return &VoiceCallResult{
+			CallID:    newID("call"),
+			To:        call.To,
+			Status:    "sent",
+			SentAt:    time.Now(),
+			Simulated: true,
+		}, nil
+	}
+
+	provider, err := s.getProvider(s.config.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := provider.PlaceCall(ctx, call)
+	if err != nil {
+		log.Error().Err(err).Str("to", call.To).Msg("Failed to place voice call")
+		return nil, err
+	}
+
+	log.Info().
+		Str("callID", result.CallID).
+		Str("to", call.To).
+		Msg("Voice call placed")
+
+	return result, nil
+}
+
+// ParseCallEvent verifies and parses a call status callback of a provider
+func (s *VoiceService) ParseCallEvent(providerName string, callback SMSCallback) (*VoiceCallEvent, error) {
+	provider, err := s.getProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := provider.ParseCallEvent(callback)
+	if err != nil {
+		return nil, err
+	}
+	if event.CallID == "" {
+		return nil, invalid(fmt.Errorf("call event has no call ID"))
+	}
+
+	return event, nil
+}
+
+// ProviderName returns the name of the configured voice provider
+func (s *VoiceService) ProviderName() string {
+	return strings.ToLower(s.config.Provider)
+}
+
+// getProvider returns the provider callbacks of a name are meant for
+func (s *VoiceService) getProvider(providerName string) (VoiceProvider, error) {
+	if s.provider == nil {
+		return nil, fmt.Errorf("voice calls are not configured")
+	}
+	if !strings.EqualFold(providerName, s.config.Provider) {
+		return nil, notFoundf("unsupported voice provider: %s", providerName)
+	}
+	return s.provider, nil
+}
+
+// sendVoiceNotification calls the recipient and reads the notification out
+func (s *NotificationService) sendVoiceNotification(ctx context.Context, request NotificationRequest) (*NotificationResult, error) {
+	if len(request.Recipients) == 0 {
+		return nil, fmt.Errorf("no recipients specified")
+	}
+
+	message := request.Message
+	if message == "" {
+		message = request.TextBody
+	}
+	ackToken, _ := request.Metadata["ack_token"].(string)
+
+	call := VoiceCall{
+		To:       request.Recipients[0],
+		Message:  message,
+		TenantID: request.TenantID,
+		AckToken: ackToken,
+	}
+
+	callResult, err := s.voiceService.PlaceCall(ctx, call)
+	if err != nil {
+		return s.createFailedResult(request, "voice", request.Recipients[0], err.Error()), err
+	}
+
+	result := s.createSuccessResult(request, "voice", request.Recipients[0], callResult.CallID)
+	result.Simulated = callResult.Simulated
+	return result, nil
+}
+
+// ReceiveVoiceCallEvent applies the outcome of a call to its result. Calls
+// answered by a person or a voicemail count as delivered, the answer is kept
+// in the answered_by metadata.
+func (s *NotificationService) ReceiveVoiceCallEvent(providerName string, callback SMSCallback) error {
+	event, err := s.voiceService.ParseCallEvent(providerName, callback)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	resultID, err := s.redis.Get(ctx, s.getMessageResultKey("voice", event.CallID)).Result()
+	if err == redis.Nil {
+		log.Debug().
+			Str("provider", providerName).
+			Str("callID", event.CallID).
+			Msg("Ignoring event of unknown call")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up call: %w", err)
+	}
+
+	result, err := s.GetNotificationStatus(ctx, resultID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get notification: %w", err)
+	}
+
+	// Only the final event of the latest attempt changes a result
+	if result.Status != "sent" || result.MessageID != event.CallID || event.Status == "sent" {
+		return nil
+	}
+
+	result.Status = event.Status
+	result.Error = event.Error
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["provider_status"] = event.ProviderStatus
+	result.Metadata["answered_by"] = event.AnsweredBy
+	result.Metadata["call_duration"] = event.Duration
+	if event.Status == "delivered" {
+		result.Metadata["delivered_at"] = time.Now()
+	}
+
+	if err := s.storeResult(*result); err != nil {
+		return fmt.Errorf("failed to update result: %w", err)
+	}
+
+	s.notifyStatus(*result)
+
+	log.Info().
+		Str("resultID", result.ID).
+		Str("status", result.Status).
+		Str("answeredBy", event.AnsweredBy).
+		Msg("Voice call event applied")
+
+	return nil
+}
+
+// ReceiveVoiceKeypress acknowledges the notification of a call when the
+// recipient pressed VoiceAckDigit. It returns the content type and body the
+// provider speaks to the recipient in answer.
+func (s *NotificationService) ReceiveVoiceKeypress(providerName string, ackToken string, callback SMSCallback) (string, string, error) {
+	provider, err := s.voiceService.getProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	digits, err := provider.ParseKeypress(ackToken, callback)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The reply is spoken in the locale the call was made in
+	locale := i18n.Default
+	if record, err := s.getAckRecord(ackToken); err == nil {
+		locale = s.ackLocale(*record)
+	}
+
+	if digits != VoiceAckDigit {
+		contentType, body := provider.Reply(i18n.T(locale, i18n.VoiceNotAcknowledged))
+		return contentType, body, nil
+	}
+
+	if _, err := s.Acknowledge(ackToken, "voice"); err != nil {
+		log.Error().Err(err).Msg("Failed to acknowledge voice call")
+		contentType, body := provider.Reply(i18n.T(locale, i18n.VoiceAckFailed))
+		return contentType, body, nil
+	}
+
+	contentType, body := provider.Reply(i18n.T(locale, i18n.VoiceAcknowledged))
+	return contentType, body, nil
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// twilioVoiceServer is a mock of the Twilio Calls API answering with status
+// and response, recording the forms it receives
+type twilioVoiceServer struct {
+	*httptest.Server
+	forms    []url.Values
+	status   int
+	response string
+}
+
+func newTwilioVoiceServer(t *testing.T) *twilioVoiceServer {
+	server := &twilioVoiceServer{status: http.StatusCreated, response: `{"sid":"CA123","status":"queued"}`}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/2010-04-01/Accounts/AC-voice/Calls.json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "AC-voice" || password != "voice-token" {
+			t.Errorf("Expected the account credentials, got %q %q", user, password)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse form: %v", err)
+		}
+		server.forms = append(server.forms, r.PostForm)
+
+		w.WriteHeader(server.status)
+		w.Write([]byte(server.response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestVoiceService returns a voice service calling through server
+func newTestVoiceService(server *twilioVoiceServer) *VoiceService {
+	config := VoiceConfig{
+		Provider:    VoiceProviderTwilio,
+		APIKey:      "AC-voice",
+		APISecret:   "voice-token",
+		FromNumber:  "+902121234567",
+		BaseURL:     server.URL,
+		CallbackURL: "https://notify.talimat.test/api/v1/voice/",
+		Language:    "tr-TR",
+		Voice:       "Polly.Filiz",
+		RingTimeout: 25 * time.Second,
+	}
+	return &VoiceService{config: config, provider: &TwilioVoiceProvider{config: config, client: server.Client()}}
+}
+
+// signedVoiceCallback returns a callback to callbackURL signed the way Twilio signs it
+func signedVoiceCallback(callbackURL string, form url.Values) SMSCallback {
+	header := http.Header{}
+	header.Set("X-Twilio-Signature", twilioSignature("voice-token", callbackURL, form))
+	return SMSCallback{URL: callbackURL, Form: form, Header: header}
+}
+
+func TestTwilioCallsReadTheMessageOut(t *testing.T) {
+	server := newTwilioVoiceServer(t)
+	voice := newTestVoiceService(server)
+
+	result, err := voice.PlaceCall(context.Background(), VoiceCall{To: "05321234567", Message: "Depoda yangın alarmı & tahliye"})
+	if err != nil {
+		t.Fatalf("Failed to place call: %v", err)
+	}
+	if result.CallID != "CA123" || result.Status != "sent" {
+		t.Errorf("Expected the call SID to identify the call, got %+v", result)
+	}
+
+	form := server.forms[0]
+	for name, expected := range map[string]string{
+		"To":               "+905321234567",
+		"From":             "+902121234567",
+		"Timeout":          "25",
+		"MachineDetection": "Enable",
+		"StatusCallback":   "https://notify.talimat.test/api/v1/voice/status/twilio",
+	} {
+		if form.Get(name) != expected {
+			t.Errorf("Expected %s to be %q, got %q", name, expected, form.Get(name))
+		}
+	}
+	say := `<Say language="tr-TR" voice="Polly.Filiz">Depoda yangın alarmı &amp; tahliye</Say>`
+	if twiml := form.Get("Twiml"); strings.Count(twiml, say) != 2 || strings.Contains(twiml, "<Gather") {
+		t.Errorf("Expected the escaped message to be read out twice, got %s", twiml)
+	}
+
+	// Acknowledgeable calls wait for the key press
+	if _, err := voice.PlaceCall(context.Background(), VoiceCall{To: "905321234567", Message: "Gaz kaçağı", AckToken: "token/1"}); err != nil {
+		t.Fatalf("Failed to place call: %v", err)
+	}
+	gather := `<Gather numDigits="1" timeout="10" method="POST" action="https://notify.talimat.test/api/v1/voice/keypress/twilio?token=token%2F1">`
+	if twiml := server.forms[1].Get("Twiml"); strings.Count(twiml, gather) != 2 {
+		t.Errorf("Expected the message to be read out while waiting for the key press, got %s", twiml)
+	}
+
+	if _, err := voice.PlaceCall(context.Background(), VoiceCall{To: "905321234567"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected calls without a message to be refused, got %v", err)
+	}
+	server.status, server.response = http.StatusBadRequest, `{"code":21211,"message":"The 'To' number is not a valid phone number."}`
+	if _, err := voice.PlaceCall(context.Background(), VoiceCall{To: "905321234567", Message: "Tatbikat"}); err == nil || !strings.Contains(err.Error(), "not a valid phone number") {
+		t.Errorf("Expected the Twilio error to be reported, got %v", err)
+	}
+}
+
+func TestTwilioCallEventsAreMapped(t *testing.T) {
+	voice := newTestVoiceService(newTwilioVoiceServer(t))
+	callbackURL := "https://notify.talimat.test/api/v1/voice/status/twilio"
+
+	for name, test := range map[string]struct {
+		callStatus string
+		answeredBy string
+		status     string
+		answer     string
+		error      string
+	}{
+		"answered by a person":  {"completed", "human", "delivered", "human", ""},
+		"answered by voicemail": {"completed", "machine_end_beep", "delivered", "voicemail", ""},
+		"answered by a fax":     {"completed", "fax", "failed", "fax", "answered by a fax machine"},
+		"busy":                  {"busy", "", "failed", "unknown", "line was busy"},
+		"not answered":          {"no-answer", "", "failed", "unknown", "call was not answered"},
+		"still ringing":         {"ringing", "", "sent", "unknown", ""},
+	} {
+		form := url.Values{"CallSid": {"CA123"}, "CallStatus": {test.callStatus}, "CallDuration": {"14"}}
+		if test.answeredBy != "" {
+			form.Set("AnsweredBy", test.answeredBy)
+		}
+
+		event, err := voice.ParseCallEvent("twilio", signedVoiceCallback(callbackURL, form))
+		if err != nil {
+			t.Fatalf("%s: failed to parse event: %v", name, err)
+		}
+		if event.CallID != "CA123" || event.Status != test.status || event.AnsweredBy != test.answer || !strings.Contains(event.Error, test.error) {
+			t.Errorf("%s: expected %s answered by %s, got %+v", name, test.status, test.answer, event)
+		}
+		if test.status == "delivered" && event.Duration != 14 {
+			t.Errorf("%s: expected the call duration, got %d", name, event.Duration)
+		}
+	}
+
+	form := url.Values{"CallSid": {"CA123"}, "CallStatus": {"completed"}}
+	forged := signedVoiceCallback(callbackURL, form)
+	forged.Form = url.Values{"CallSid": {"CA999"}, "CallStatus": {"completed"}}
+	if _, err := voice.ParseCallEvent("twilio", forged); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected altered callbacks to be refused, got %v", err)
+	}
+	if _, err := voice.ParseCallEvent("vonage", signedVoiceCallback(callbackURL, form)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected callbacks of other providers to be refused, got %v", err)
+	}
+}
+
+func TestVoiceCallsAreReportedAndAcknowledged(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	server := newTwilioVoiceServer(t)
+	env.service.voiceService = newTestVoiceService(server)
+
+	result, err := env.service.SendNotification(ctx, NotificationRequest{
+		Type:       "voice",
+		Recipients: []string{"905321234567"},
+		Message:    "Kazan dairesinde basınç alarmı.",
+		Priority:   "urgent",
+		TenantID:   "tenant-a",
+		RequireAck: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if result.Status != "sent" || result.MessageID != "CA123" {
+		t.Fatalf("Expected the call to be placed, got %s %s", result.Status, result.MessageID)
+	}
+	token, _ := result.Metadata["ack_token"].(string)
+	if token == "" || !strings.Contains(server.forms[0].Get("Twiml"), "token="+url.QueryEscape(token)) {
+		t.Fatalf("Expected the call to wait for the acknowledgment of token %q", token)
+	}
+
+	// Voicemail counts as delivered
+	statusURL := "https://notify.talimat.test/api/v1/voice/status/twilio"
+	status := url.Values{"CallSid": {"CA123"}, "CallStatus": {"completed"}, "AnsweredBy": {"machine_start"}, "CallDuration": {"21"}}
+	if err := env.service.ReceiveVoiceCallEvent("twilio", signedVoiceCallback(statusURL, status)); err != nil {
+		t.Fatalf("Failed to receive call event: %v", err)
+	}
+	stored, err := env.service.GetNotificationStatus(ctx, result.ID)
+	if err != nil || stored.Status != "delivered" || stored.Metadata["answered_by"] != "voicemail" {
+		t.Errorf("Expected the call to be delivered to voicemail, got %+v (%v)", stored, err)
+	}
+
+	keypressURL := "https://notify.talimat.test/api/v1/voice/keypress/twilio?token=" + url.QueryEscape(token)
+	press := func(digits string) string {
+		_, reply, err := env.service.ReceiveVoiceKeypress("twilio", token, signedVoiceCallback(keypressURL, url.Values{"CallSid": {"CA123"}, "Digits": {digits}}))
+		if err != nil {
+			t.Fatalf("Failed to receive keypress: %v", err)
+		}
+		return reply
+	}
+
+	if reply := press("9"); !strings.Contains(reply, "Onay alınmadı") || !strings.Contains(reply, "<Hangup/>") {
+		t.Errorf("Expected other keys not to acknowledge, got %s", reply)
+	}
+	if _, err := env.service.getAcknowledgment(token); err == nil {
+		t.Errorf("Expected the notification not to be acknowledged yet")
+	}
+
+	if reply := press(VoiceAckDigit); !strings.Contains(reply, "bildirimi onayladınız") {
+		t.Errorf("Expected the acknowledgment to be confirmed, got %s", reply)
+	}
+	ack, err := env.service.getAcknowledgment(token)
+	if err != nil || ack.Channel != "voice" || ack.RequestID != result.RequestID {
+		t.Errorf("Expected the notification to be acknowledged by voice, got %+v (%v)", ack, err)
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// twilioCallFailures describe the Twilio call statuses of unanswered calls
+var twilioCallFailures = map[string]string{
+	"busy":      "line was busy",
+	"no-answer": "call was not answered",
+	"failed":    "call could not be placed",
+	"canceled":  "call was cancelled",
+}
+
+// TwilioVoiceProvider places calls through Twilio Voice, reading messages out
+// with its text-to-speech and detecting answering machines
+type TwilioVoiceProvider struct {
+	config VoiceConfig
+	client *http.Client
+}
+
+func (p *TwilioVoiceProvider) PlaceCall(ctx context.Context, call VoiceCall) (*VoiceCallResult, error) {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Calls.json", p.baseURL(), p.config.APIKey)
+
+	formData := url.Values{}
+	formData.Set("To", "+"+e164Digits(call.To))
+	formData.Set("From", call.From)
+	formData.Set("Twiml", p.callTwiML(call))
+	formData.Set("Timeout", strconv.Itoa(int(p.config.RingTimeout.Seconds())))
+	formData.Set("MachineDetection", "Enable")
+	if callbackURL := p.callbackURL("status"); callbackURL != "" {
+		formData.Set("StatusCallback", callbackURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.config.APIKey, p.config.APISecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Twilio API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Twilio response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		errorMsg := "unknown error"
+		if errMsg, ok := result["message"].(string); ok {
+			errorMsg = errMsg
+		}
+		return nil, fmt.Errorf("Twilio API error: %s", errorMsg)
+	}
+
+	callID, _ := result["sid"].(string)
+	return &VoiceCallResult{
+		CallID:           callID,
+		To:               call.To,
+		Status:           "sent",
+		SentAt:           time.Now(),
+		ProviderResponse: result,
+	}, nil
+}
+
+// ParseCallEvent parses a Twilio call status callback, verifying its
+// X-Twilio-Signature with the auth token
+func (p *TwilioVoiceProvider) ParseCallEvent(callback SMSCallback) (*VoiceCallEvent, error) {
+	callbackURL := p.callbackURL("status")
+	if callbackURL == "" {
+		callbackURL = callback.URL
+	}
+	if err := p.verifySignature(callbackURL, callback); err != nil {
+		return nil, err
+	}
+
+	providerStatus := callback.Form.Get("CallStatus")
+	duration, _ := strconv.Atoi(callback.Form.Get("CallDuration"))
+	event := &VoiceCallEvent{
+		CallID:         callback.Form.Get("CallSid"),
+		Status:         "sent",
+		ProviderStatus: providerStatus,
+		AnsweredBy:     twilioAnsweredBy(callback.Form.Get("AnsweredBy")),
+		Duration:       duration,
+	}
+
+	switch providerStatus {
+	case "completed":
+		event.Status = "delivered"
+		if event.AnsweredBy == "fax" {
+			event.Status = "failed"
+			event.Error = "Twilio call failed: answered by a fax machine"
+		}
+	default:
+		if reason, ok := twilioCallFailures[providerStatus]; ok {
+			event.Status = "failed"
+			event.Error = "Twilio call failed: " + reason
+		}
+	}
+
+	return event, nil
+}
+
+// ParseKeypress parses the digits Twilio gathered during the call of an
+// acknowledgment token, verifying the X-Twilio-Signature
+func (p *TwilioVoiceProvider) ParseKeypress(ackToken string, callback SMSCallback) (string, error) {
+	callbackURL := p.keypressURL(ackToken)
+	if callbackURL == "" {
+		callbackURL = callback.URL
+	}
+	if err := p.verifySignature(callbackURL, callback); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(callback.Form.Get("Digits")), nil
+}
+
+// Reply returns TwiML speaking a message and hanging up
+func (p *TwilioVoiceProvider) Reply(message string) (string, string) {
+	var twiml bytes.Buffer
+	twiml.WriteString(xml.Header)
+	twiml.WriteString("<Response>")
+	p.writeSay(&twiml, message)
+	twiml.WriteString("<Hangup/></Response>")
+	return "application/xml", twiml.String()
+}
+
+// callTwiML returns the TwiML of a call. Acknowledgeable calls read the
+// message out while waiting for a keypress, and read it once more when
+// nothing was pressed.
+func (p *TwilioVoiceProvider) callTwiML(call VoiceCall) string {
+	var twiml bytes.Buffer
+	twiml.WriteString("<Response>")
+
+	if call.AckToken == "" {
+		p.writeSay(&twiml, call.Message)
+		twiml.WriteString(`<Pause length="1"/>`)
+		p.writeSay(&twiml, call.Message)
+		twiml.WriteString("</Response>")
+		return twiml.String()
+	}
+
+	gather := fmt.Sprintf(`<Gather numDigits="1" timeout="10" method="POST" action="%s">`, xmlEscape(p.keypressURL(call.AckToken)))
+	for i := 0; i < 2; i++ {
+		twiml.WriteString(gather)
+		p.writeSay(&twiml, call.Message)
+		twiml.WriteString("</Gather>")
+	}
+	p.writeSay(&twiml, "Onay alınmadı. Hoşça kalın.")
+	twiml.WriteString("</Response>")
+	return twiml.String()
+}
+
+func (p *TwilioVoiceProvider) writeSay(twiml *bytes.Buffer, message string) {
+	fmt.Fprintf(twiml, `<Say language="%s" voice="%s">%s</Say>`, xmlEscape(p.config.Language), xmlEscape(p.config.Voice), xmlEscape(message))
+}
+
+// verifySignature checks the X-Twilio-Signature of a callback made to a URL
+func (p *TwilioVoiceProvider) verifySignature(callbackURL string, callback SMSCallback) error {
+	expected := twilioSignature(p.config.APISecret, callbackURL, callback.Form)
+	if !hmac.Equal([]byte(expected), []byte(callback.Header.Get("X-Twilio-Signature"))) {
+		return unauthorizedf("invalid Twilio signature")
+	}
+	return nil
+}
+
+// callbackURL returns the URL Twilio calls back for a kind of callback
+func (p *TwilioVoiceProvider) callbackURL(kind string) string {
+	if p.config.CallbackURL == "" {
+		return ""
+	}
+	return strings.TrimRight(p.config.CallbackURL, "/") + "/" + kind + "/" + VoiceProviderTwilio
+}
+
+// keypressURL returns the URL Twilio posts the digits of a call to
+func (p *TwilioVoiceProvider) keypressURL(ackToken string) string {
+	callbackURL := p.callbackURL("keypress")
+	if callbackURL == "" {
+		return ""
+	}
+	return callbackURL + "?token=" + url.QueryEscape(ackToken)
+}
+
+func (p *TwilioVoiceProvider) baseURL() string {
+	if p.config.BaseURL != "" {
+		return strings.TrimRight(p.config.BaseURL, "/")
+	}
+	return twilioDefaultBaseURL
+}
+
+// Helper functions
+
+// twilioAnsweredBy maps the answering machine detection of Twilio
+func twilioAnsweredBy(answeredBy string) string {
+	switch {
+	case answeredBy == "human":
+		return "human"
+	case strings.HasPrefix(answeredBy, "machine"):
+		return "voicemail"
+	case answeredBy == "fax":
+		return "fax"
+	}
+	return "unknown"
+}
+
+func xmlEscape(s string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
@@ -7,19 +7,32 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/redisclient"
 )
 
+// maxWebhookResponseBody is how much of an endpoint's response is kept on
+// the delivery
+const maxWebhookResponseBody = 4096
+
 // WebhookService handles webhook notifications
 type WebhookService struct {
-	redis  *redis.Client
-	config WebhookConfig
-	client *http.Client
+	redis             *redis.Client
+	config            WebhookConfig
+	client            *http.Client
+	deliveries        *workerPool // bounds the deliveries in flight
+	disabledListeners []EndpointDisabledListener
+	failedListeners   []DeliveryFailedListener
+	eventTypeSources  []EventTypeSource
 }
 
 // WebhookConfig holds webhook service configuration
@@ -29,9 +42,26 @@ type WebhookConfig struct {
 	RedisDB       int
 	MaxRetries    int
 	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration // longest wait between attempts
+	MaxRetryAge   time.Duration // deliveries older than this are dead-lettered
+	DeliveryTTL   time.Duration // how long deliveries can be looked up
 	Timeout       time.Duration
 	MaxPayload    int64
 	SecretKey     string
+	DryRun        bool
+
+	// AllowPrivateNetworks lets endpoints use internal addresses, for
+	// development only
+	AllowPrivateNetworks bool
+
+	// Endpoints failing every attempt for DisableAfter, at least
+	// DisableMinFailures times, are disabled
+	DisableAfter       time.Duration
+	DisableMinFailures int
+
+	// MaxConcurrentDeliveries is how many deliveries are sent at once.
+	// Deliveries beyond it wait on the retry queue for a free worker.
+	MaxConcurrentDeliveries int
 }
 
 // WebhookEndpoint represents a webhook endpoint
@@ -51,7 +81,21 @@ type WebhookEndpoint struct {
 	LastTrigger *time.Time             `json:"last_trigger,omitempty"`
 	LastSuccess *time.Time             `json:"last_success,omitempty"`
 	LastError   string                 `json:"last_error,omitempty"`
+	TenantID    string                 `json:"tenant_id"`
 	Metadata    map[string]interface{} `json:"metadata"`
+
+	// CreatedBy is told when the endpoint is disabled for failing
+	CreatedBy      string     `json:"created_by,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+
+	// Filters must all match for an event to be sent, Transform reshapes
+	// the payload before it is sent
+	Filters   []WebhookFilter   `json:"filters,omitempty"`
+	Transform *WebhookTransform `json:"transform,omitempty"`
+
+	// ClientCertificate is presented to endpoints requiring mutual TLS
+	ClientCertificate *WebhookClientCertificate `json:"client_certificate,omitempty"`
 }
 
 // WebhookPayload represents a webhook payload
@@ -102,53 +146,65 @@ type WebhookEvent struct {
 
 // NewWebhookService creates a new webhook service instance
 func NewWebhookService(config WebhookConfig) (*WebhookService, error) {
-	// Parse Redis URL
-	redisOpts, err := redis.ParseURL(config.RedisURL)
+	redisClient, err := redisclient.New(redisclient.Config{
+		URL:      config.RedisURL,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		return nil, err
 	}
 
-	// Override with config values
-	if config.RedisPassword != "" {
-		redisOpts.Password = config.RedisPassword
+	// Set default values
+	if config.RetryDelay == 0 {
+		config.RetryDelay = 5 * time.Second
 	}
-	if config.RedisDB != 0 {
-		redisOpts.DB = config.RedisDB
+	if config.MaxRetryDelay == 0 {
+		config.MaxRetryDelay = 1 * time.Hour
 	}
-
-	// Create Redis client
-	redisClient := redis.NewClient(redisOpts)
-
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	if config.MaxRetryAge == 0 {
+		config.MaxRetryAge = 24 * time.Hour
 	}
-
-	// Create HTTP client
-	httpClient := &http.Client{
-		Timeout: config.Timeout,
+	if config.DeliveryTTL == 0 {
+		config.DeliveryTTL = 30 * 24 * time.Hour
+	}
+	if config.MaxPayload == 0 {
+		config.MaxPayload = 1 << 20
+	}
+	if config.DisableAfter == 0 {
+		config.DisableAfter = 24 * time.Hour
+	}
+	if config.DisableMinFailures == 0 {
+		config.DisableMinFailures = 10
+	}
+	if config.MaxConcurrentDeliveries == 0 {
+		config.MaxConcurrentDeliveries = 50
 	}
 
+	// Create HTTP client, refusing internal addresses
+	httpClient := newWebhookClient(newWebhookTransport(config.AllowPrivateNetworks), config.Timeout)
+
 	return &WebhookService{
-		redis:  redisClient,
-		config: config,
-		client: httpClient,
+		redis:      redisClient,
+		config:     config,
+		client:     httpClient,
+		deliveries: newWorkerPool("webhook_deliveries", config.MaxConcurrentDeliveries),
 	}, nil
 }
 
 // CreateEndpoint creates a new webhook endpoint
-func (s *WebhookService) CreateEndpoint(endpoint WebhookEndpoint) (*WebhookEndpoint, error) {
+func (s *WebhookService) CreateEndpoint(ctx context.Context, endpoint WebhookEndpoint) (*WebhookEndpoint, error) {
 	log.Info().
 		Str("name", endpoint.Name).
 		Str("url", endpoint.URL).
 		Msg("Creating webhook endpoint")
 
 	// Validate endpoint
-	if err := s.validateEndpoint(endpoint); err != nil {
-		return nil, fmt.Errorf("endpoint validation failed: %w", err)
+	if err := s.validateEndpoint(ctx, endpoint); err != nil {
+		return nil, invalid(fmt.Errorf("endpoint validation failed: %w", err))
+	}
+	if err := s.validateEvents(endpoint); err != nil {
+		return nil, err
 	}
 
 	// Set default values
@@ -170,7 +226,6 @@ func (s *WebhookService) CreateEndpoint(endpoint WebhookEndpoint) (*WebhookEndpo
 	}
 
 	// Store in Redis
-	ctx := context.Background()
 	key := s.getEndpointKey(endpoint.ID)
 
 	endpointJSON, err := json.Marshal(endpoint)
@@ -207,14 +262,13 @@ func (s *WebhookService) CreateEndpoint(endpoint WebhookEndpoint) (*WebhookEndpo
 }
 
 // GetEndpoint gets a webhook endpoint by ID
-func (s *WebhookService) GetEndpoint(endpointID string) (*WebhookEndpoint, error) {
-	ctx := context.Background()
+func (s *WebhookService) GetEndpoint(ctx context.Context, endpointID string) (*WebhookEndpoint, error) {
 	key := s.getEndpointKey(endpointID)
 
 	endpointJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("endpoint not found: %s", endpointID)
+			return nil, notFoundf("endpoint not found: %s", endpointID)
 		}
 		return nil, fmt.Errorf("failed to get endpoint: %w", err)
 	}
@@ -228,15 +282,16 @@ func (s *WebhookService) GetEndpoint(endpointID string) (*WebhookEndpoint, error
 }
 
 // UpdateEndpoint updates a webhook endpoint
-func (s *WebhookService) UpdateEndpoint(endpointID string, updates map[string]interface{}) (*WebhookEndpoint, error) {
+func (s *WebhookService) UpdateEndpoint(ctx context.Context, endpointID string, updates map[string]interface{}) (*WebhookEndpoint, error) {
 	log.Info().
 		Str("endpointID", endpointID).
 		Msg("Updating webhook endpoint")
 
-	endpoint, err := s.GetEndpoint(endpointID)
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get endpoint: %w", err)
 	}
+	previousEvents := endpoint.Events
 
 	// Apply updates
 	endpoint.UpdatedAt = time.Now()
@@ -245,8 +300,8 @@ func (s *WebhookService) UpdateEndpoint(endpointID string, updates map[string]in
 	if name, ok := updates["name"].(string); ok {
 		endpoint.Name = name
 	}
-	if url, ok := updates["url"].(string); ok {
-		endpoint.URL = url
+	if endpointURL, ok := updates["url"].(string); ok {
+		endpoint.URL = endpointURL
 	}
 	if method, ok := updates["method"].(string); ok {
 		endpoint.Method = method
@@ -262,6 +317,10 @@ func (s *WebhookService) UpdateEndpoint(endpointID string, updates map[string]in
 	}
 	if isActive, ok := updates["is_active"].(bool); ok {
 		endpoint.IsActive = isActive
+		if isActive {
+			endpoint.DisabledAt = nil
+			endpoint.DisabledReason = ""
+		}
 	}
 	if retryCount, ok := updates["retry_count"].(int); ok {
 		endpoint.RetryCount = retryCount
@@ -269,9 +328,31 @@ func (s *WebhookService) UpdateEndpoint(endpointID string, updates map[string]in
 	if timeout, ok := updates["timeout"].(time.Duration); ok {
 		endpoint.Timeout = timeout
 	}
+	if filters, ok := updates["filters"].([]WebhookFilter); ok {
+		endpoint.Filters = filters
+	}
+	if transform, ok := updates["transform"].(*WebhookTransform); ok {
+		endpoint.Transform = transform
+	}
+	if certificate, ok := updates["client_certificate"].(*WebhookClientCertificate); ok {
+		// An empty certificate turns mutual TLS off
+		if certificate.CertificatePEM == "" {
+			certificate = nil
+		}
+		endpoint.ClientCertificate = certificate
+	}
+
+	if err := s.validateEndpoint(ctx, *endpoint); err != nil {
+		return nil, invalid(fmt.Errorf("endpoint validation failed: %w", err))
+	}
+	// Endpoints subscribed before the registry keep their events until changed
+	if _, ok := updates["events"]; ok {
+		if err := s.validateEvents(*endpoint); err != nil {
+			return nil, err
+		}
+	}
 
 	// Store updated endpoint
-	ctx := context.Background()
 	key := s.getEndpointKey(endpointID)
 
 	endpointJSON, err := json.Marshal(endpoint)
@@ -283,6 +364,20 @@ func (s *WebhookService) UpdateEndpoint(endpointID string, updates map[string]in
 		return nil, fmt.Errorf("failed to update endpoint: %w", err)
 	}
 
+	// Move the endpoint to the indices of the events it now subscribes to
+	for _, event := range previousEvents {
+		eventKey := s.getEventEndpointsKey(event, endpoint.TenantID)
+		if err := s.redis.SRem(ctx, eventKey, endpointID).Err(); err != nil {
+			log.Error().Err(err).Msg("Failed to remove endpoint from event index")
+		}
+	}
+	for _, event := range endpoint.Events {
+		eventKey := s.getEventEndpointsKey(event, endpoint.TenantID)
+		if err := s.redis.SAdd(ctx, eventKey, endpointID).Err(); err != nil {
+			log.Error().Err(err).Msg("Failed to add endpoint to event index")
+		}
+	}
+
 	log.Info().
 		Str("endpointID", endpointID).
 		Msg("Webhook endpoint updated successfully")
@@ -291,18 +386,16 @@ func (s *WebhookService) UpdateEndpoint(endpointID string, updates map[string]in
 }
 
 // DeleteEndpoint deletes a webhook endpoint
-func (s *WebhookService) DeleteEndpoint(endpointID string) error {
+func (s *WebhookService) DeleteEndpoint(ctx context.Context, endpointID string) error {
 	log.Info().
 		Str("endpointID", endpointID).
 		Msg("Deleting webhook endpoint")
 
-	endpoint, err := s.GetEndpoint(endpointID)
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
 	if err != nil {
 		return fmt.Errorf("failed to get endpoint: %w", err)
 	}
 
-	ctx := context.Background()
-
 	// Remove from Redis
 	key := s.getEndpointKey(endpointID)
 	if err := s.redis.Del(ctx, key).Err(); err != nil {
@@ -330,8 +423,41 @@ func (s *WebhookService) DeleteEndpoint(endpointID string) error {
 	return nil
 }
 
+// ListEndpoints gets the webhook endpoints of a tenant, the newest first
+func (s *WebhookService) ListEndpoints(ctx context.Context, tenantID string, page int, limit int) ([]*WebhookEndpoint, int, error) {
+	key := s.getEndpointsKey(tenantID)
+
+	// Get total count
+	total, err := s.redis.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get endpoint count: %w", err)
+	}
+
+	// Calculate pagination
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
+
+	endpointIDs, err := s.redis.ZRevRange(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get endpoint IDs: %w", err)
+	}
+
+	// Get endpoint details
+	var endpoints []*WebhookEndpoint
+	for _, id := range endpointIDs {
+		endpoint, err := s.GetEndpoint(ctx, id)
+		if err != nil {
+			log.Warn().Err(err).Str("endpointID", id).Msg("Failed to get endpoint")
+			continue
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, int(total), nil
+}
+
 // TriggerWebhook triggers a webhook for a specific event
-func (s *WebhookService) TriggerWebhook(event WebhookEvent) error {
+func (s *WebhookService) TriggerWebhook(ctx context.Context, event WebhookEvent) error {
 	log.Info().
 		Str("eventID", event.ID).
 		Str("eventType", event.Type).
@@ -339,7 +465,7 @@ func (s *WebhookService) TriggerWebhook(event WebhookEvent) error {
 		Msg("Triggering webhook")
 
 	// Get endpoints for this event
-	endpoints, err := s.getEndpointsForEvent(event.Type, event.TenantID)
+	endpoints, err := s.getEndpointsForEvent(ctx, event.Type, event.TenantID)
 	if err != nil {
 		return fmt.Errorf("failed to get endpoints for event: %w", err)
 	}
@@ -349,6 +475,14 @@ func (s *WebhookService) TriggerWebhook(event WebhookEvent) error {
 		return nil
 	}
 
+	if s.config.DryRun {
+		log.Info().
+			Str("eventID", event.ID).
+			Int("endpointCount", len(endpoints)).
+			Msg("Webhook dry run, event not delivered")
+		return nil
+	}
+
 	// Create payload
 	payload := WebhookPayload{
 		ID:        generatePayloadID(),
@@ -359,8 +493,16 @@ func (s *WebhookService) TriggerWebhook(event WebhookEvent) error {
 		Version:   "1.0",
 	}
 
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	if int64(len(payloadJSON)) > s.config.MaxPayload {
+		return invalid(fmt.Errorf("webhook payload is %d bytes, the limit is %d", len(payloadJSON), s.config.MaxPayload))
+	}
+
 	// Store payload
-	if err := s.storePayload(payload); err != nil {
+	if err := s.storePayload(ctx, payload); err != nil {
 		return fmt.Errorf("failed to store payload: %w", err)
 	}
 
@@ -370,6 +512,19 @@ func (s *WebhookService) TriggerWebhook(event WebhookEvent) error {
 			continue
 		}
 
+		matched, err := endpoint.matchesFilters(payload)
+		if err != nil {
+			log.Error().Err(err).Str("endpointID", endpoint.ID).Msg("Failed to evaluate webhook filters")
+			continue
+		}
+		if !matched {
+			log.Debug().
+				Str("eventID", event.ID).
+				Str("endpointID", endpoint.ID).
+				Msg("Webhook event filtered out")
+			continue
+		}
+
 		delivery := WebhookDelivery{
 			ID:          generateDeliveryID(),
 			EndpointID:  endpoint.ID,
@@ -381,37 +536,85 @@ func (s *WebhookService) TriggerWebhook(event WebhookEvent) error {
 		}
 
 		// Store delivery
-		if err := s.storeDelivery(delivery); err != nil {
+		if err := s.storeDelivery(ctx, delivery); err != nil {
 			log.Error().Err(err).Msg("Failed to store delivery")
 			continue
 		}
 
-		// Send webhook asynchronously
-		go s.sendWebhook(delivery, endpoint, payload)
+		// Send webhook asynchronously, the delivery outlives the request
+		// triggering it and has the timeout of its endpoint
+		delivery, endpoint := delivery, *endpoint
+		if !s.deliveries.TryGo(func() { s.sendWebhook(context.Background(), delivery, endpoint, payload) }) {
+			s.queueDelivery(ctx, delivery)
+		}
 	}
 
 	return nil
 }
 
+// queueDelivery leaves a delivery to the retry worker because every delivery
+// worker is busy. It's sent as soon as a worker is free, without using up an
+// attempt.
+func (s *WebhookService) queueDelivery(ctx context.Context, delivery WebhookDelivery) {
+	log.Warn().
+		Str("deliveryID", delivery.ID).
+		Str("endpointID", delivery.EndpointID).
+		Msg("Webhook delivery workers saturated, delivery queued")
+
+	if err := s.redis.ZAdd(ctx, s.getRetryQueueKey(), &redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: delivery.ID,
+	}).Err(); err != nil {
+		log.Error().Err(err).Str("deliveryID", delivery.ID).Msg("Failed to queue webhook delivery")
+	}
+}
+
+// DeliveryStats returns how busy the delivery workers are
+func (s *WebhookService) DeliveryStats() PoolStats {
+	return s.deliveries.Stats()
+}
+
+// WaitForDeliveries blocks until the deliveries in flight have finished
+func (s *WebhookService) WaitForDeliveries() {
+	s.deliveries.Wait()
+}
+
 // sendWebhook sends a webhook to an endpoint
-func (s *WebhookService) sendWebhook(delivery WebhookDelivery, endpoint WebhookEndpoint, payload WebhookPayload) {
+func (s *WebhookService) sendWebhook(ctx context.Context, delivery WebhookDelivery, endpoint WebhookEndpoint, payload WebhookPayload) {
 	log.Info().
 		Str("deliveryID", delivery.ID).
 		Str("endpointID", endpoint.ID).
 		Str("url", endpoint.URL).
 		Msg("Sending webhook")
 
-	// Prepare request
-	payloadJSON, err := json.Marshal(payload)
+	// Prepare request, transforming the payload for the endpoint
+	payloadJSON, err := endpoint.renderPayload(payload)
+	if err != nil {
+		s.updateDeliveryStatus(ctx, delivery.ID, "failed", err.Error())
+		return
+	}
+	if int64(len(payloadJSON)) > s.config.MaxPayload {
+		s.failDelivery(ctx, &delivery, fmt.Sprintf("payload is %d bytes, the limit is %d", len(payloadJSON), s.config.MaxPayload), endpoint)
+		return
+	}
+
+	// The allow-list may have changed since the endpoint was created. Dead
+	// letters can be replayed once the destination is allowed again.
+	if err := s.checkDestination(ctx, endpoint); err != nil {
+		s.failDelivery(ctx, &delivery, err.Error(), endpoint)
+		return
+	}
+
+	client, err := s.clientFor(endpoint)
 	if err != nil {
-		s.updateDeliveryStatus(delivery.ID, "failed", err.Error())
+		s.failDelivery(ctx, &delivery, err.Error(), endpoint)
 		return
 	}
 
 	// Create request
 	req, err := http.NewRequest(endpoint.Method, endpoint.URL, bytes.NewBuffer(payloadJSON))
 	if err != nil {
-		s.updateDeliveryStatus(delivery.ID, "failed", err.Error())
+		s.updateDeliveryStatus(ctx, delivery.ID, "failed", err.Error())
 		return
 	}
 
@@ -434,31 +637,41 @@ func (s *WebhookService) sendWebhook(delivery WebhookDelivery, endpoint WebhookE
 	}
 
 	// Send request
-	ctx, cancel := context.WithTimeout(context.Background(), endpoint.Timeout)
+	attemptCtx, cancel := context.WithTimeout(ctx, endpoint.Timeout)
 	defer cancel()
 
-	req = req.WithContext(ctx)
-	resp, err := s.client.Do(req)
+	req = req.WithContext(attemptCtx)
+	attemptedAt := time.Now()
+	delivery.Attempts++
+	delivery.LastAttempt = &attemptedAt
+	resp, err := client.Do(req)
 	if err != nil {
-		s.handleDeliveryError(delivery.ID, err.Error(), endpoint)
+		// Don't keep the response of an earlier attempt
+		delivery.ResponseCode = 0
+		delivery.ResponseBody = ""
+		delivery.ResponseHeaders = nil
+
+		// Retrying a blocked address fails the same way
+		if errors.Is(err, errBlockedAddress) {
+			s.failDelivery(ctx, &delivery, err.Error(), endpoint)
+			return
+		}
+		s.handleDeliveryError(ctx, &delivery, err.Error(), endpoint)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Read response
-	var responseBody string
-	if resp.Body != nil {
-		bodyBytes, _ := json.Marshal(resp.Body)
-		responseBody = string(bodyBytes)
+	// Read response, keeping only the start of large bodies
+	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody+1))
+	if err != nil {
+		log.Warn().Err(err).Str("deliveryID", delivery.ID).Msg("Failed to read webhook response")
 	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	responseBody := truncateString(string(bodyBytes), maxWebhookResponseBody)
 
 	// Update delivery status
-	delivery.Status = "sent"
 	delivery.ResponseCode = resp.StatusCode
 	delivery.ResponseBody = responseBody
-	delivery.LastAttempt = &time.Time{}
-	delivery.CompletedAt = &time.Time{}
-	delivery.Attempts++
 
 	// Store response headers
 	delivery.ResponseHeaders = make(map[string]string)
@@ -470,87 +683,83 @@ func (s *WebhookService) sendWebhook(delivery WebhookDelivery, endpoint WebhookE
 
 	// Check if successful
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		completedAt := time.Now()
 		delivery.Status = "sent"
-		s.updateEndpointSuccess(endpoint.ID)
+		delivery.Error = ""
+		delivery.NextRetry = nil
+		delivery.CompletedAt = &completedAt
+		s.updateEndpointSuccess(ctx, endpoint.ID)
+		s.recordAttempt(ctx, endpoint, true)
+
+		// Update delivery
+		if err := s.updateDelivery(ctx, delivery); err != nil {
+			log.Error().Err(err).Str("deliveryID", delivery.ID).Msg("Failed to update delivery")
+		}
 	} else {
-		delivery.Status = "failed"
-		delivery.Error = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, responseBody)
-		s.handleDeliveryError(delivery.ID, delivery.Error, endpoint)
+		s.handleDeliveryError(ctx, &delivery, fmt.Sprintf("HTTP %d: %s", resp.StatusCode, responseBody), endpoint)
 	}
 
-	// Update delivery
-	s.updateDelivery(delivery)
-
 	log.Info().
 		Str("deliveryID", delivery.ID).
 		Int("statusCode", resp.StatusCode).
+		Dur("duration", time.Since(attemptedAt)).
 		Msg("Webhook sent")
 }
 
-// handleDeliveryError handles webhook delivery errors
-func (s *WebhookService) handleDeliveryError(deliveryID string, errorMsg string, endpoint WebhookEndpoint) {
-	delivery, err := s.getDelivery(deliveryID)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to get delivery for error handling")
-		return
-	}
-
-	delivery.Attempts++
-	delivery.LastAttempt = &time.Time{}
+// handleDeliveryError records a failed attempt and schedules the next one
+func (s *WebhookService) handleDeliveryError(ctx context.Context, delivery *WebhookDelivery, errorMsg string, endpoint WebhookEndpoint) {
 	delivery.Error = errorMsg
+	s.recordAttempt(ctx, endpoint, false)
 
-	if delivery.Attempts < delivery.MaxAttempts {
-		// Schedule retry
-		delivery.Status = "retrying"
-		retryDelay := s.config.RetryDelay * time.Duration(delivery.Attempts)
-		delivery.NextRetry = &time.Time{}.Add(retryDelay)
+	s.scheduleRetry(ctx, delivery, endpoint)
+}
 
-		// Schedule retry
-		time.AfterFunc(retryDelay, func() {
-			s.retryWebhook(delivery.ID)
-		})
-	} else {
-		// Max retries reached
-		delivery.Status = "failed"
-		delivery.CompletedAt = &time.Time{}
-		s.updateEndpointError(endpoint.ID, errorMsg)
-	}
+// failDelivery records a failure retrying won't fix and dead-letters the
+// delivery
+func (s *WebhookService) failDelivery(ctx context.Context, delivery *WebhookDelivery, errorMsg string, endpoint WebhookEndpoint) {
+	delivery.Error = errorMsg
+	s.recordAttempt(ctx, endpoint, false)
 
-	s.updateDelivery(*delivery)
+	s.deadLetter(ctx, delivery, endpoint)
 }
 
 // retryWebhook retries a failed webhook delivery
-func (s *WebhookService) retryWebhook(deliveryID string) {
-	delivery, err := s.getDelivery(deliveryID)
+func (s *WebhookService) retryWebhook(ctx context.Context, deliveryID string) {
+	delivery, err := s.getDelivery(ctx, deliveryID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get delivery for retry")
 		return
 	}
 
-	endpoint, err := s.GetEndpoint(delivery.EndpointID)
+	endpoint, err := s.GetEndpoint(ctx, delivery.EndpointID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get endpoint for retry")
+		s.updateDeliveryStatus(ctx, deliveryID, "failed", "endpoint no longer exists")
+		return
+	}
+	if !endpoint.IsActive {
+		s.updateDeliveryStatus(ctx, deliveryID, "failed", "endpoint is not active")
 		return
 	}
 
-	payload, err := s.getPayload(delivery.PayloadID)
+	payload, err := s.getPayload(ctx, delivery.PayloadID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get payload for retry")
+		s.updateDeliveryStatus(ctx, deliveryID, "failed", "payload expired")
 		return
 	}
 
 	// Send webhook again
-	s.sendWebhook(*delivery, *endpoint, *payload)
+	s.sendWebhook(ctx, *delivery, *endpoint, *payload)
 }
 
 // GetDelivery gets a webhook delivery by ID
-func (s *WebhookService) GetDelivery(deliveryID string) (*WebhookDelivery, error) {
-	return s.getDelivery(deliveryID)
+func (s *WebhookService) GetDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	return s.getDelivery(ctx, deliveryID)
 }
 
 // GetDeliveries gets webhook deliveries for an endpoint
-func (s *WebhookService) GetDeliveries(endpointID string, page int, limit int) ([]*WebhookDelivery, int, error) {
-	ctx := context.Background()
+func (s *WebhookService) GetDeliveries(ctx context.Context, endpointID string, page int, limit int) ([]*WebhookDelivery, int, error) {
 	key := s.getEndpointDeliveriesKey(endpointID)
 
 	// Get total count
@@ -572,7 +781,7 @@ func (s *WebhookService) GetDeliveries(endpointID string, page int, limit int) (
 	// Get delivery details
 	var deliveries []*WebhookDelivery
 	for _, id := range deliveryIDs {
-		delivery, err := s.getDelivery(id)
+		delivery, err := s.getDelivery(ctx, id)
 		if err != nil {
 			log.Warn().Err(err).Str("deliveryID", id).Msg("Failed to get delivery")
 			continue
@@ -583,17 +792,34 @@ func (s *WebhookService) GetDeliveries(endpointID string, page int, limit int) (
 	return deliveries, int(total), nil
 }
 
-// TestEndpoint tests a webhook endpoint
-func (s *WebhookService) TestEndpoint(endpointID string) error {
+// TestEndpoint sends a test event to a webhook endpoint, returning the
+// delivery to follow its result with
+func (s *WebhookService) TestEndpoint(ctx context.Context, endpointID string) (*WebhookDelivery, error) {
 	log.Info().
 		Str("endpointID", endpointID).
 		Msg("Testing webhook endpoint")
 
-	endpoint, err := s.GetEndpoint(endpointID)
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
 	if err != nil {
-		return fmt.Errorf("failed to get endpoint: %w", err)
+		return nil, fmt.Errorf("failed to get endpoint: %w", err)
+	}
+
+	testDelivery, testPayload, err := s.newTestDelivery(ctx, *endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send test webhook, the delivery outlives the request
+	if !s.deliveries.TryGo(func() { s.sendWebhook(context.Background(), *testDelivery, *endpoint, *testPayload) }) {
+		s.queueDelivery(ctx, *testDelivery)
 	}
 
+	return testDelivery, nil
+}
+
+// newTestDelivery stores a test payload and a single attempt delivery of it
+// to an endpoint
+func (s *WebhookService) newTestDelivery(ctx context.Context, endpoint WebhookEndpoint) (*WebhookDelivery, *WebhookPayload, error) {
 	// Create test payload
 	testPayload := WebhookPayload{
 		ID:        generatePayloadID(),
@@ -616,21 +842,19 @@ func (s *WebhookService) TestEndpoint(endpointID string) error {
 		Attempts:    0,
 		MaxAttempts: 1,
 		CreatedAt:   time.Now(),
+		Metadata:    map[string]interface{}{"test": true},
 	}
 
 	// Store test data
-	if err := s.storePayload(testPayload); err != nil {
-		return fmt.Errorf("failed to store test payload: %w", err)
+	if err := s.storePayload(ctx, testPayload); err != nil {
+		return nil, nil, fmt.Errorf("failed to store test payload: %w", err)
 	}
 
-	if err := s.storeDelivery(testDelivery); err != nil {
-		return fmt.Errorf("failed to store test delivery: %w", err)
+	if err := s.storeDelivery(ctx, testDelivery); err != nil {
+		return nil, nil, fmt.Errorf("failed to store test delivery: %w", err)
 	}
 
-	// Send test webhook
-	go s.sendWebhook(testDelivery, *endpoint, testPayload)
-
-	return nil
+	return &testDelivery, &testPayload, nil
 }
 
 // TestConnection tests the webhook service connection
@@ -650,7 +874,7 @@ func (s *WebhookService) TestConnection() error {
 }
 
 // validateEndpoint validates a webhook endpoint
-func (s *WebhookService) validateEndpoint(endpoint WebhookEndpoint) error {
+func (s *WebhookService) validateEndpoint(ctx context.Context, endpoint WebhookEndpoint) error {
 	if endpoint.Name == "" {
 		return fmt.Errorf("endpoint name is required")
 	}
@@ -659,16 +883,49 @@ func (s *WebhookService) validateEndpoint(endpoint WebhookEndpoint) error {
 		return fmt.Errorf("endpoint URL is required")
 	}
 
+	parsed, err := url.Parse(endpoint.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("endpoint URL must be an absolute http(s) URL")
+	}
+	if err := s.checkDestination(ctx, endpoint); err != nil {
+		return err
+	}
+
+	if endpoint.ClientCertificate != nil {
+		if parsed.Scheme != "https" {
+			return fmt.Errorf("client certificates need an https endpoint URL")
+		}
+		if _, err := endpoint.ClientCertificate.keyPair(); err != nil {
+			return err
+		}
+	}
+
+	switch endpoint.Method {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("invalid endpoint method: %s", endpoint.Method)
+	}
+
 	if len(endpoint.Events) == 0 {
 		return fmt.Errorf("at least one event type is required")
 	}
 
+	for _, filter := range endpoint.Filters {
+		if err := filter.validate(); err != nil {
+			return err
+		}
+	}
+	if endpoint.Transform != nil {
+		if err := endpoint.Transform.validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // getEndpointsForEvent gets endpoints that should be triggered for a specific event
-func (s *WebhookService) getEndpointsForEvent(eventType string, tenantID string) ([]*WebhookEndpoint, error) {
-	ctx := context.Background()
+func (s *WebhookService) getEndpointsForEvent(ctx context.Context, eventType string, tenantID string) ([]*WebhookEndpoint, error) {
 	eventKey := s.getEventEndpointsKey(eventType, tenantID)
 
 	// Get endpoint IDs for this event
@@ -680,7 +937,7 @@ func (s *WebhookService) getEndpointsForEvent(eventType string, tenantID string)
 	// Get endpoint details
 	var endpoints []*WebhookEndpoint
 	for _, id := range endpointIDs {
-		endpoint, err := s.GetEndpoint(id)
+		endpoint, err := s.GetEndpoint(ctx, id)
 		if err != nil {
 			log.Warn().Err(err).Str("endpointID", id).Msg("Failed to get endpoint")
 			continue
@@ -694,8 +951,7 @@ func (s *WebhookService) getEndpointsForEvent(eventType string, tenantID string)
 }
 
 // storePayload stores a webhook payload
-func (s *WebhookService) storePayload(payload WebhookPayload) error {
-	ctx := context.Background()
+func (s *WebhookService) storePayload(ctx context.Context, payload WebhookPayload) error {
 	key := s.getPayloadKey(payload.ID)
 
 	payloadJSON, err := json.Marshal(payload)
@@ -703,13 +959,17 @@ func (s *WebhookService) storePayload(payload WebhookPayload) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	// Store with TTL (24 hours)
-	return s.redis.Set(ctx, key, payloadJSON, 24*time.Hour).Err()
+	// Store with TTL (24 hours), payloads are kept as long as their
+	// deliveries are retried
+	ttl := 24 * time.Hour
+	if s.config.MaxRetryAge > ttl {
+		ttl = s.config.MaxRetryAge
+	}
+	return s.redis.Set(ctx, key, payloadJSON, ttl).Err()
 }
 
 // storeDelivery stores a webhook delivery
-func (s *WebhookService) storeDelivery(delivery WebhookDelivery) error {
-	ctx := context.Background()
+func (s *WebhookService) storeDelivery(ctx context.Context, delivery WebhookDelivery) error {
 	key := s.getDeliveryKey(delivery.ID)
 
 	deliveryJSON, err := json.Marshal(delivery)
@@ -717,28 +977,29 @@ func (s *WebhookService) storeDelivery(delivery WebhookDelivery) error {
 		return fmt.Errorf("failed to marshal delivery: %w", err)
 	}
 
-	// Store delivery
-	if err := s.redis.Set(ctx, key, deliveryJSON, 0).Err(); err != nil {
-		return fmt.Errorf("failed to store delivery: %w", err)
-	}
-
-	// Add to endpoint deliveries index
+	// Store delivery, the index of the endpoint expires with its newest one
 	endpointDeliveriesKey := s.getEndpointDeliveriesKey(delivery.EndpointID)
-	return s.redis.ZAdd(ctx, endpointDeliveriesKey, &redis.Z{
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, key, deliveryJSON, s.config.DeliveryTTL)
+	pipe.ZAdd(ctx, endpointDeliveriesKey, &redis.Z{
 		Score:  float64(delivery.CreatedAt.Unix()),
 		Member: delivery.ID,
-	}).Err()
+	})
+	pipe.Expire(ctx, endpointDeliveriesKey, s.config.DeliveryTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store delivery: %w", err)
+	}
+	return nil
 }
 
 // getDelivery gets a webhook delivery by ID
-func (s *WebhookService) getDelivery(deliveryID string) (*WebhookDelivery, error) {
-	ctx := context.Background()
+func (s *WebhookService) getDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
 	key := s.getDeliveryKey(deliveryID)
 
 	deliveryJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("delivery not found: %s", deliveryID)
+			return nil, notFoundf("delivery not found: %s", deliveryID)
 		}
 		return nil, fmt.Errorf("failed to get delivery: %w", err)
 	}
@@ -752,14 +1013,13 @@ func (s *WebhookService) getDelivery(deliveryID string) (*WebhookDelivery, error
 }
 
 // getPayload gets a webhook payload by ID
-func (s *WebhookService) getPayload(payloadID string) (*WebhookPayload, error) {
-	ctx := context.Background()
+func (s *WebhookService) getPayload(ctx context.Context, payloadID string) (*WebhookPayload, error) {
 	key := s.getPayloadKey(payloadID)
 
 	payloadJSON, err := s.redis.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("payload not found: %s", payloadID)
+			return nil, notFoundf("payload not found: %s", payloadID)
 		}
 		return nil, fmt.Errorf("failed to get payload: %w", err)
 	}
@@ -773,8 +1033,8 @@ func (s *WebhookService) getPayload(payloadID string) (*WebhookPayload, error) {
 }
 
 // updateDeliveryStatus updates a delivery status
-func (s *WebhookService) updateDeliveryStatus(deliveryID string, status string, errorMsg string) {
-	delivery, err := s.getDelivery(deliveryID)
+func (s *WebhookService) updateDeliveryStatus(ctx context.Context, deliveryID string, status string, errorMsg string) {
+	delivery, err := s.getDelivery(ctx, deliveryID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get delivery for status update")
 		return
@@ -782,18 +1042,20 @@ func (s *WebhookService) updateDeliveryStatus(deliveryID string, status string,
 
 	delivery.Status = status
 	delivery.Error = errorMsg
-	delivery.LastAttempt = &time.Time{}
 
 	if status == "sent" || status == "failed" {
-		delivery.CompletedAt = &time.Time{}
+		completedAt := time.Now()
+		delivery.NextRetry = nil
+		delivery.CompletedAt = &completedAt
 	}
 
-	s.updateDelivery(*delivery)
+	if err := s.updateDelivery(ctx, *delivery); err != nil {
+		log.Error().Err(err).Str("deliveryID", deliveryID).Msg("Failed to update delivery")
+	}
 }
 
 // updateDelivery updates a webhook delivery
-func (s *WebhookService) updateDelivery(delivery WebhookDelivery) error {
-	ctx := context.Background()
+func (s *WebhookService) updateDelivery(ctx context.Context, delivery WebhookDelivery) error {
 	key := s.getDeliveryKey(delivery.ID)
 
 	deliveryJSON, err := json.Marshal(delivery)
@@ -801,16 +1063,28 @@ func (s *WebhookService) updateDelivery(delivery WebhookDelivery) error {
 		return fmt.Errorf("failed to marshal delivery: %w", err)
 	}
 
-	return s.redis.Set(ctx, key, deliveryJSON, 0).Err()
+	return s.redis.Set(ctx, key, deliveryJSON, s.config.DeliveryTTL).Err()
+}
+
+// storeEndpoint saves an endpoint whose indices are unchanged
+func (s *WebhookService) storeEndpoint(ctx context.Context, endpoint WebhookEndpoint) error {
+	endpointJSON, err := json.Marshal(endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal endpoint: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getEndpointKey(endpoint.ID), endpointJSON, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store endpoint: %w", err)
+	}
+	return nil
 }
 
 // updateEndpointSuccess updates endpoint success metrics
-func (s *WebhookService) updateEndpointSuccess(endpointID string) {
-	ctx := context.Background()
+func (s *WebhookService) updateEndpointSuccess(ctx context.Context, endpointID string) {
 	key := s.getEndpointKey(endpointID)
 
 	// Get current endpoint
-	endpoint, err := s.GetEndpoint(endpointID)
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get endpoint for success update")
 		return
@@ -835,12 +1109,11 @@ func (s *WebhookService) updateEndpointSuccess(endpointID string) {
 }
 
 // updateEndpointError updates endpoint error metrics
-func (s *WebhookService) updateEndpointError(endpointID string, errorMsg string) {
-	ctx := context.Background()
+func (s *WebhookService) updateEndpointError(ctx context.Context, endpointID string, errorMsg string) {
 	key := s.getEndpointKey(endpointID)
 
 	// Get current endpoint
-	endpoint, err := s.GetEndpoint(endpointID)
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get endpoint for error update")
 		return
@@ -903,9 +1176,9 @@ func (s *WebhookService) getEndpointDeliveriesKey(endpointID string) string {
 
 // Helper functions
 func generatePayloadID() string {
-	return fmt.Sprintf("payload_%d", time.Now().UnixNano())
+	return newID("payload")
 }
 
 func generateDeliveryID() string {
-	return fmt.Sprintf("delivery_%d", time.Now().UnixNano())
+	return newID("delivery")
 }
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"claude-talimat/pkg/events"
+)
+
+// WebhookEventType is an event endpoints can subscribe to, with the schema of
+// its data and a payload as endpoints receive it
+type WebhookEventType struct {
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	Version       int            `json:"version,omitempty"` // of the event catalogue definition
+	Schema        *events.Schema `json:"schema"`
+	SamplePayload WebhookPayload `json:"sample_payload"`
+}
+
+// EventTypeSource returns the event types of a tenant besides the registered
+// ones, like the categories webhook notifications are sent in
+type EventTypeSource func(ctx context.Context, tenantID string) ([]WebhookEventType, error)
+
+// AddEventTypes registers a source of tenant event types endpoints may
+// subscribe to
+func (s *WebhookService) AddEventTypes(source EventTypeSource) {
+	s.eventTypeSources = append(s.eventTypeSources, source)
+}
+
+// webhookEventSamples are the event types the service delivers to webhooks,
+// described by the event catalogue, with sample data
+var webhookEventSamples = map[string]map[string]interface{}{
+	events.TypeNotificationStatus: {
+		"notification_id": "notif_1700000000000000000",
+		"request_id":      "req_1700000000000000000",
+		"type":            "email",
+		"recipient":       "ayse@example.com",
+		"status":          "delivered",
+		"message_id":      "msg_1700000000000000000",
+		"attempts":        1,
+	},
+	events.TypeNotificationAcknowledged: {
+		"document_id":     "doc_42",
+		"request_id":      "req_1700000000000000000",
+		"channel":         "email",
+		"acknowledged_at": "2026-01-05T09:30:00Z",
+	},
+	events.TypeNotificationAction: {
+		"notification_id": "inapp_1700000000000000000",
+		"category":        "safety",
+		"action_id":       "approve",
+		"action_label":    "Onayla",
+		"responded_at":    "2026-01-05T09:30:00Z",
+	},
+	events.TypeNotificationEscalated: {
+		"request_id": "req_1700000000000000000",
+		"result_id":  "res_1700000000000000000",
+		"from":       "+905551112233",
+		"keyword":    "YARDIM",
+		"body":       "YARDIM",
+	},
+	events.TypeSMSOptedOut: {
+		"request_id": "req_1700000000000000000",
+		"result_id":  "res_1700000000000000000",
+		"from":       "+905551112233",
+		"keyword":    "IPTAL",
+		"body":       "IPTAL",
+	},
+	events.TypeProviderCircuitOpened: {
+		"provider":     "netgsm",
+		"state":        "open",
+		"failure_rate": 0.75,
+		"last_error":   "connection refused",
+		"retry_at":     "2026-01-05T09:31:00Z",
+	},
+	events.TypeProviderCircuitClosed: {
+		"provider":     "netgsm",
+		"state":        "closed",
+		"failure_rate": 0.0,
+	},
+	events.TypeEscalationTriggered:    escalationSample("triggered"),
+	events.TypeEscalationAcknowledged: escalationSample("acknowledged"),
+	events.TypeEscalationResolved:     escalationSample("resolved"),
+	events.TypeEscalationExhausted:    escalationSample("exhausted"),
+	events.TypeWebhookFailed: {
+		"endpoint_id": "webhook_1700000000000000000",
+		"delivery_id": "delivery_1700000000000000000",
+		"event":       events.TypeNotificationStatus,
+		"url":         "https://example.com/hooks/talimat",
+		"error":       "HTTP 503",
+		"attempts":    5,
+	},
+}
+
+// ListEventTypes returns the event types endpoints of a tenant may subscribe
+// to by name, the registered ones and those of the tenant
+func (s *WebhookService) ListEventTypes(ctx context.Context, tenantID string) ([]WebhookEventType, error) {
+	eventTypes := make([]WebhookEventType, 0, len(webhookEventSamples))
+	seen := make(map[string]bool, len(webhookEventSamples))
+	for name, sample := range webhookEventSamples {
+		definition, ok := events.Lookup(name, 0)
+		if !ok {
+			continue
+		}
+		eventTypes = append(eventTypes, WebhookEventType{
+			Name:          name,
+			Description:   definition.Description,
+			Version:       definition.Version,
+			Schema:        definition.Schema,
+			SamplePayload: samplePayload(name, sample),
+		})
+		seen[name] = true
+	}
+
+	for _, source := range s.eventTypeSources {
+		tenantTypes, err := source(ctx, tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get event types: %w", err)
+		}
+		for _, eventType := range tenantTypes {
+			if !seen[eventType.Name] {
+				eventTypes = append(eventTypes, eventType)
+				seen[eventType.Name] = true
+			}
+		}
+	}
+
+	sort.Slice(eventTypes, func(i, j int) bool {
+		return eventTypes[i].Name < eventTypes[j].Name
+	})
+
+	return eventTypes, nil
+}
+
+// validateEvents checks that an endpoint subscribes to event types of the
+// registry or of its tenant only
+func (s *WebhookService) validateEvents(endpoint WebhookEndpoint) error {
+	eventTypes, err := s.ListEventTypes(context.Background(), endpoint.TenantID)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(eventTypes))
+	for _, eventType := range eventTypes {
+		known[eventType.Name] = true
+	}
+	for _, event := range endpoint.Events {
+		if !known[event] {
+			return invalid(fmt.Errorf("endpoint validation failed: unknown event type: %s", event))
+		}
+	}
+
+	return nil
+}
+
+// Helper functions
+
+// samplePayload is a payload of an event as endpoints receive it
+func samplePayload(eventType string, data map[string]interface{}) WebhookPayload {
+	return WebhookPayload{
+		ID:        "payload_1700000000000000000",
+		Event:     eventType,
+		Timestamp: time.Date(2026, time.January, 5, 9, 30, 0, 0, time.UTC),
+		Data:      data,
+		Source:    "notification-service",
+		Version:   "1.0",
+	}
+}
+
+func escalationSample(status string) map[string]interface{} {
+	return map[string]interface{}{
+		"escalation_id": "esc_1700000000000000000",
+		"policy_id":     "policy_1700000000000000000",
+		"title":         "Kimyasal sızıntı, B blok",
+		"status":        status,
+		"level":         1,
+		"round":         1,
+		"source":        "incident",
+	}
+}
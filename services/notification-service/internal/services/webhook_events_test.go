@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"claude-talimat/pkg/events"
+)
+
+func TestRegisteredEventTypesDescribeTheirPayload(t *testing.T) {
+	webhooks := &WebhookService{}
+
+	eventTypes, err := webhooks.ListEventTypes(context.Background(), "tenant-a")
+	if err != nil {
+		t.Fatalf("Failed to list event types: %v", err)
+	}
+	if len(eventTypes) != len(webhookEventSamples) {
+		t.Errorf("Expected every sampled event type to be in the catalogue, got %d of %d", len(eventTypes), len(webhookEventSamples))
+	}
+
+	for i, eventType := range eventTypes {
+		if i > 0 && eventTypes[i-1].Name >= eventType.Name {
+			t.Errorf("Expected event types sorted by name, got %s after %s", eventType.Name, eventTypes[i-1].Name)
+		}
+		if eventType.Schema == nil || eventType.Description == "" || eventType.Version == 0 {
+			t.Errorf("Expected %s to be described by the catalogue, got %+v", eventType.Name, eventType)
+		}
+		// Samples must stay true to the schema endpoints are told to expect
+		sample := eventType.SamplePayload
+		if sample.Event != eventType.Name || sample.Source != "notification-service" {
+			t.Errorf("Expected a sample payload of %s, got %+v", eventType.Name, sample)
+		}
+		if err := events.Validate(eventType.Name, eventType.Version, sample.Data); err != nil {
+			t.Errorf("Expected the sample of %s to match its schema, got %v", eventType.Name, err)
+		}
+	}
+}
+
+func TestTenantEventTypesAreAddedBySources(t *testing.T) {
+	webhooks := &WebhookService{}
+	webhooks.AddEventTypes(func(ctx context.Context, tenantID string) ([]WebhookEventType, error) {
+		if tenantID != "tenant-a" {
+			return nil, nil
+		}
+		return []WebhookEventType{
+			{Name: "safety", Description: "İş güvenliği"},
+			{Name: events.TypeNotificationStatus, Description: "shadowed"},
+		}, nil
+	})
+	webhooks.AddEventTypes(func(ctx context.Context, tenantID string) ([]WebhookEventType, error) {
+		return []WebhookEventType{{Name: "safety", Description: "shadowed"}}, nil
+	})
+
+	eventTypes, err := webhooks.ListEventTypes(context.Background(), "tenant-a")
+	if err != nil {
+		t.Fatalf("Failed to list event types: %v", err)
+	}
+	descriptions := map[string]string{}
+	for _, eventType := range eventTypes {
+		if _, ok := descriptions[eventType.Name]; ok {
+			t.Errorf("Expected %s to be listed once", eventType.Name)
+		}
+		descriptions[eventType.Name] = eventType.Description
+	}
+	// Registered types and earlier sources win
+	if descriptions["safety"] != "İş güvenliği" || descriptions[events.TypeNotificationStatus] == "shadowed" {
+		t.Errorf("Expected the first definition of each event type, got %v", descriptions)
+	}
+
+	failing := errors.New("categories unavailable")
+	webhooks.AddEventTypes(func(ctx context.Context, tenantID string) ([]WebhookEventType, error) {
+		return nil, failing
+	})
+	if _, err := webhooks.ListEventTypes(context.Background(), "tenant-a"); !errors.Is(err, failing) {
+		t.Errorf("Expected the error of the source, got %v", err)
+	}
+}
+
+func TestEndpointsSubscribeToKnownEventsOnly(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	webhooks := env.service.Webhooks()
+
+	if _, err := env.service.CreateCategory(ctx, NotificationCategory{TenantID: "tenant-a", Name: "safety", Description: "İş güvenliği"}); err != nil {
+		t.Fatalf("Failed to create category: %v", err)
+	}
+
+	for name, test := range map[string]struct {
+		tenantID string
+		events   []string
+		allowed  bool
+	}{
+		"registered event":          {"tenant-a", []string{events.TypeNotificationStatus, events.TypeEscalationTriggered}, true},
+		"unknown event":             {"tenant-a", []string{events.TypeNotificationStatus, "document.published"}, false},
+		"category of the tenant":    {"tenant-a", []string{"safety"}, true},
+		"system category":           {"tenant-a", []string{"incident"}, true},
+		"category of another":       {"tenant-b", []string{"safety"}, false},
+		"event named in other case": {"tenant-a", []string{"Notification.Status"}, false},
+	} {
+		_, err := webhooks.CreateEndpoint(ctx, WebhookEndpoint{
+			Name:     name,
+			URL:      "https://hooks.example.com/talimat",
+			TenantID: test.tenantID,
+			Events:   test.events,
+			IsActive: true,
+		})
+		if test.allowed && err != nil {
+			t.Errorf("%s: expected the endpoint to be created, got %v", name, err)
+		}
+		if !test.allowed && !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: expected the endpoint to be refused, got %v", name, err)
+		}
+	}
+
+	created, err := webhooks.CreateEndpoint(ctx, WebhookEndpoint{
+		Name:     "ISG",
+		URL:      "https://hooks.example.com/talimat",
+		TenantID: "tenant-a",
+		Events:   []string{"safety"},
+		IsActive: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+	if _, err := webhooks.UpdateEndpoint(ctx, created.ID, map[string]interface{}{"events": []string{"document.published"}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected updates to unknown event types to be refused, got %v", err)
+	}
+	if _, err := webhooks.UpdateEndpoint(ctx, created.ID, map[string]interface{}{"events": []string{"safety", events.TypeWebhookFailed}}); err != nil {
+		t.Errorf("Expected updates to known event types to be saved, got %v", err)
+	}
+
+	// The categories of the tenant are listed for discovery
+	eventTypes, err := webhooks.ListEventTypes(ctx, "tenant-a")
+	if err != nil {
+		t.Fatalf("Failed to list event types: %v", err)
+	}
+	found := false
+	for _, eventType := range eventTypes {
+		if eventType.Name == "safety" {
+			found = eventType.Description == "İş güvenliği" && eventType.Schema != nil
+		}
+	}
+	if !found {
+		t.Errorf("Expected the registered category among the event types")
+	}
+}
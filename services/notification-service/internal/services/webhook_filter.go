@@ -0,0 +1,313 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operators webhook filters compare payload fields with
+const (
+	FilterOpEquals    = "eq"
+	FilterOpNotEquals = "ne"
+	FilterOpIn        = "in"
+	FilterOpNotIn     = "not_in"
+	FilterOpExists    = "exists"
+	FilterOpNotExists = "not_exists"
+	FilterOpContains  = "contains"
+	FilterOpGreater   = "gt"
+	FilterOpLess      = "lt"
+)
+
+// WebhookFilter matches a field of the payload. Fields are dotted paths into
+// the payload as it is sent, like data.severity or $.data.items.0.name.
+type WebhookFilter struct {
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// WebhookTransform reshapes the payload sent to an endpoint. Fields are
+// selected first, then renamed, then the static fields are added.
+type WebhookTransform struct {
+	Include []string               `json:"include,omitempty"` // fields to keep, all when empty
+	Rename  map[string]string      `json:"rename,omitempty"`  // field to its new path
+	Enrich  map[string]interface{} `json:"enrich,omitempty"`  // static fields to add
+}
+
+// matchesFilters reports whether a payload passes every filter of an endpoint
+func (e WebhookEndpoint) matchesFilters(payload WebhookPayload) (bool, error) {
+	if len(e.Filters) == 0 {
+		return true, nil
+	}
+
+	document, err := payloadDocument(payload)
+	if err != nil {
+		return false, err
+	}
+
+	for _, filter := range e.Filters {
+		if !filter.matches(document) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// renderPayload returns the body sent to an endpoint for a payload
+func (e WebhookEndpoint) renderPayload(payload WebhookPayload) ([]byte, error) {
+	if e.Transform == nil {
+		return json.Marshal(payload)
+	}
+
+	document, err := payloadDocument(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e.Transform.apply(document))
+}
+
+// matches evaluates the filter against a payload document
+func (f WebhookFilter) matches(document map[string]interface{}) bool {
+	value, found := lookupPath(document, f.Field)
+
+	switch f.Operator {
+	case FilterOpExists:
+		return found
+	case FilterOpNotExists:
+		return !found
+	case FilterOpEquals:
+		return found && valuesEqual(value, f.Value)
+	case FilterOpNotEquals:
+		return !found || !valuesEqual(value, f.Value)
+	case FilterOpIn:
+		return found && containsValue(f.Value, value)
+	case FilterOpNotIn:
+		return !found || !containsValue(f.Value, value)
+	case FilterOpContains:
+		if !found {
+			return false
+		}
+		if text, ok := value.(string); ok {
+			expected, ok := f.Value.(string)
+			return ok && strings.Contains(text, expected)
+		}
+		return containsValue(value, f.Value)
+	case FilterOpGreater, FilterOpLess:
+		actual, ok := toFloat(value)
+		if !found || !ok {
+			return false
+		}
+		expected, ok := toFloat(f.Value)
+		if !ok {
+			return false
+		}
+		if f.Operator == FilterOpGreater {
+			return actual > expected
+		}
+		return actual < expected
+	}
+	return false
+}
+
+// apply builds the transformed payload from a payload document
+func (t WebhookTransform) apply(document map[string]interface{}) map[string]interface{} {
+	result := document
+	if len(t.Include) > 0 {
+		result = make(map[string]interface{})
+		for _, field := range t.Include {
+			if value, ok := lookupPath(document, field); ok {
+				setPath(result, field, value)
+			}
+		}
+	}
+
+	for from, to := range t.Rename {
+		if value, ok := lookupPath(result, from); ok {
+			deletePath(result, from)
+			setPath(result, to, value)
+		}
+	}
+
+	for field, value := range t.Enrich {
+		setPath(result, field, value)
+	}
+
+	return result
+}
+
+// validate checks the filter can be evaluated
+func (f WebhookFilter) validate() error {
+	if len(splitPath(f.Field)) == 0 {
+		return fmt.Errorf("filter field is required")
+	}
+
+	switch f.Operator {
+	case FilterOpExists, FilterOpNotExists:
+	case FilterOpEquals, FilterOpNotEquals, FilterOpContains:
+		if f.Value == nil {
+			return fmt.Errorf("filter on %s needs a value", f.Field)
+		}
+	case FilterOpIn, FilterOpNotIn:
+		if _, ok := f.Value.([]interface{}); !ok && reflect.ValueOf(f.Value).Kind() != reflect.Slice {
+			return fmt.Errorf("filter on %s needs a list of values", f.Field)
+		}
+	case FilterOpGreater, FilterOpLess:
+		if _, ok := toFloat(f.Value); !ok {
+			return fmt.Errorf("filter on %s needs a number", f.Field)
+		}
+	default:
+		return fmt.Errorf("invalid filter operator: %s", f.Operator)
+	}
+	return nil
+}
+
+// validate checks every path of the transform is usable
+func (t WebhookTransform) validate() error {
+	for _, field := range t.Include {
+		if len(splitPath(field)) == 0 {
+			return fmt.Errorf("included field is empty")
+		}
+	}
+	for from, to := range t.Rename {
+		if len(splitPath(from)) == 0 || len(splitPath(to)) == 0 {
+			return fmt.Errorf("renamed fields need a source and a target")
+		}
+	}
+	for field := range t.Enrich {
+		if len(splitPath(field)) == 0 {
+			return fmt.Errorf("enriched field is empty")
+		}
+	}
+	return nil
+}
+
+// Helper functions
+
+// payloadDocument returns the payload as the JSON document endpoints receive
+func payloadDocument(payload WebhookPayload) (map[string]interface{}, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(payloadJSON, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return document, nil
+}
+
+// splitPath splits a dotted path, allowing a leading $ as in JSONPath
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func lookupPath(document map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = document
+	for _, part := range splitPath(path) {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath sets a value, creating the objects on its path. Missing parts are
+// created as objects, also when they are numbers.
+func setPath(document map[string]interface{}, path string, value interface{}) {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return
+	}
+
+	node := document
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			node[part] = child
+		}
+		node = child
+	}
+	node[parts[len(parts)-1]] = value
+}
+
+func deletePath(document map[string]interface{}, path string) {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return
+	}
+
+	node := document
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		node = child
+	}
+	delete(node, parts[len(parts)-1])
+}
+
+// valuesEqual compares values as JSON, so 1 matches 1.0 from a payload
+func valuesEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+// containsValue reports whether list holds value
+func containsValue(list interface{}, value interface{}) bool {
+	items, ok := normalizeJSON(list).([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range items {
+		if valuesEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeJSON(value interface{}) interface{} {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(valueJSON, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := normalizeJSON(value).(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
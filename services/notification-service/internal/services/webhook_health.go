@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/i18n"
+)
+
+// healthWindow is how far back the success rate of an endpoint is computed
+const healthWindow = 24 * time.Hour
+
+// WebhookEndpointHealth reports how an endpoint has answered recently
+type WebhookEndpointHealth struct {
+	EndpointID          string     `json:"endpoint_id"`
+	IsActive            bool       `json:"is_active"`
+	Successes           int64      `json:"successes"` // in the last 24 hours
+	Failures            int64      `json:"failures"`
+	SuccessRate         float64    `json:"success_rate"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	FailingSince        *time.Time `json:"failing_since,omitempty"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+}
+
+// EndpointDisabledListener is called after an endpoint was disabled for
+// failing continuously
+type EndpointDisabledListener func(endpoint *WebhookEndpoint)
+
+// OnEndpointDisabled registers a listener for automatically disabled endpoints
+func (s *WebhookService) OnEndpointDisabled(listener EndpointDisabledListener) {
+	s.disabledListeners = append(s.disabledListeners, listener)
+}
+
+// recordAttempt counts the outcome of a delivery attempt. An endpoint that
+// has failed every attempt for DisableAfter, at least DisableMinFailures
+// times, is disabled.
+func (s *WebhookService) recordAttempt(ctx context.Context, endpoint WebhookEndpoint, success bool) {
+	now := time.Now()
+	stateKey := s.getEndpointStateKey(endpoint.ID)
+	bucketKey := s.getEndpointHealthKey(endpoint.ID, now)
+
+	pipe := s.redis.TxPipeline()
+	if success {
+		pipe.HIncrBy(ctx, bucketKey, "success", 1)
+		pipe.Del(ctx, stateKey)
+	} else {
+		pipe.HIncrBy(ctx, bucketKey, "failure", 1)
+		pipe.HSetNX(ctx, stateKey, "failing_since", now.Unix())
+		pipe.HIncrBy(ctx, stateKey, "consecutive_failures", 1)
+	}
+	pipe.Expire(ctx, bucketKey, healthWindow+time.Hour)
+	state := pipe.HGetAll(ctx, stateKey)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Warn().Err(err).Str("endpointID", endpoint.ID).Msg("Failed to record webhook endpoint health")
+		return
+	}
+	if success || !endpoint.IsActive {
+		return
+	}
+
+	failingSince, consecutiveFailures := parseEndpointState(state.Val())
+	if failingSince == nil || consecutiveFailures < int64(s.config.DisableMinFailures) || now.Sub(*failingSince) < s.config.DisableAfter {
+		return
+	}
+
+	reason := fmt.Sprintf("%d failed attempts since %s", consecutiveFailures, failingSince.Format(time.RFC3339))
+	if err := s.disableEndpoint(ctx, endpoint.ID, reason); err != nil {
+		log.Error().Err(err).Str("endpointID", endpoint.ID).Msg("Failed to disable webhook endpoint")
+	}
+}
+
+// disableEndpoint deactivates a failing endpoint and tells the listeners
+func (s *WebhookService) disableEndpoint(ctx context.Context, endpointID string, reason string) error {
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
+	if err != nil {
+		return err
+	}
+	if !endpoint.IsActive {
+		return nil
+	}
+
+	now := time.Now()
+	endpoint.IsActive = false
+	endpoint.DisabledAt = &now
+	endpoint.DisabledReason = reason
+	endpoint.UpdatedAt = now
+	if err := s.storeEndpoint(ctx, *endpoint); err != nil {
+		return err
+	}
+
+	log.Warn().
+		Str("endpointID", endpoint.ID).
+		Str("tenantID", endpoint.TenantID).
+		Str("reason", reason).
+		Msg("Webhook endpoint disabled")
+
+	for _, listener := range s.disabledListeners {
+		listener(endpoint)
+	}
+	return nil
+}
+
+// GetEndpointHealth returns the recent success rate of an endpoint and how
+// long it has been failing
+func (s *WebhookService) GetEndpointHealth(ctx context.Context, endpointID string) (*WebhookEndpointHealth, error) {
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	pipe := s.redis.Pipeline()
+	var buckets []*redis.StringStringMapCmd
+	for hour := time.Duration(0); hour < healthWindow; hour += time.Hour {
+		buckets = append(buckets, pipe.HGetAll(ctx, s.getEndpointHealthKey(endpointID, now.Add(-hour))))
+	}
+	state := pipe.HGetAll(ctx, s.getEndpointStateKey(endpointID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get endpoint health: %w", err)
+	}
+
+	health := &WebhookEndpointHealth{
+		EndpointID:     endpoint.ID,
+		IsActive:       endpoint.IsActive,
+		DisabledAt:     endpoint.DisabledAt,
+		DisabledReason: endpoint.DisabledReason,
+	}
+	for _, bucket := range buckets {
+		successes, _ := strconv.ParseInt(bucket.Val()["success"], 10, 64)
+		failures, _ := strconv.ParseInt(bucket.Val()["failure"], 10, 64)
+		health.Successes += successes
+		health.Failures += failures
+	}
+	if attempts := health.Successes + health.Failures; attempts > 0 {
+		health.SuccessRate = float64(health.Successes) / float64(attempts)
+	}
+	health.FailingSince, health.ConsecutiveFailures = parseEndpointState(state.Val())
+
+	return health, nil
+}
+
+// EnableEndpoint re-enables an endpoint after a test delivery to it
+// succeeded. The failed test delivery is returned with a conflict error.
+func (s *WebhookService) EnableEndpoint(ctx context.Context, endpointID string) (*WebhookEndpoint, *WebhookDelivery, error) {
+	log.Info().
+		Str("endpointID", endpointID).
+		Msg("Re-enabling webhook endpoint")
+
+	endpoint, err := s.GetEndpoint(ctx, endpointID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get endpoint: %w", err)
+	}
+
+	delivery, payload, err := s.newTestDelivery(ctx, *endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.sendWebhook(ctx, *delivery, *endpoint, *payload)
+
+	if delivery, err = s.getDelivery(ctx, delivery.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to get test delivery: %w", err)
+	}
+	if delivery.Status != "sent" {
+		return nil, delivery, conflictf("test delivery failed, endpoint left disabled: %s", delivery.Error)
+	}
+
+	// The test may have taken a while, apply it to the current endpoint
+	if endpoint, err = s.GetEndpoint(ctx, endpointID); err != nil {
+		return nil, nil, fmt.Errorf("failed to get endpoint: %w", err)
+	}
+	endpoint.IsActive = true
+	endpoint.DisabledAt = nil
+	endpoint.DisabledReason = ""
+	endpoint.UpdatedAt = time.Now()
+	if err := s.storeEndpoint(ctx, *endpoint); err != nil {
+		return nil, nil, err
+	}
+
+	return endpoint, delivery, nil
+}
+
+// notifyEndpointDisabled tells the owner of an endpoint, or the admins of
+// its tenant when it has none, that the endpoint was disabled
+func (s *NotificationService) notifyEndpointDisabled(endpoint *WebhookEndpoint) {
+	recipient := RecipientPrefixRole + "admin"
+	if endpoint.CreatedBy != "" {
+		recipient = RecipientPrefixUser + endpoint.CreatedBy
+	}
+
+	locale := s.messageLocale(endpoint.TenantID, recipient)
+	request := NotificationRequest{
+		ID:         generateNotificationID(),
+		Type:       "email",
+		Recipients: []string{recipient},
+		Subject:    i18n.T(locale, i18n.WebhookDisabledSubject, endpoint.Name),
+		Title:      i18n.T(locale, i18n.WebhookDisabledTitle),
+		Message:    i18n.T(locale, i18n.WebhookDisabledMessage, endpoint.URL, endpoint.Name, endpoint.DisabledReason),
+		Priority:   "high",
+		Category:   "system",
+		TenantID:   endpoint.TenantID,
+		Metadata: map[string]interface{}{
+			"webhook_endpoint_id": endpoint.ID,
+		},
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := s.SendNotification(context.Background(), request); err != nil {
+		log.Error().Err(err).Str("endpointID", endpoint.ID).Msg("Failed to notify webhook endpoint owner")
+	}
+}
+
+// Helper functions
+func parseEndpointState(state map[string]string) (*time.Time, int64) {
+	consecutiveFailures, _ := strconv.ParseInt(state["consecutive_failures"], 10, 64)
+
+	seconds, err := strconv.ParseInt(state["failing_since"], 10, 64)
+	if err != nil {
+		return nil, consecutiveFailures
+	}
+	failingSince := time.Unix(seconds, 0)
+	return &failingSince, consecutiveFailures
+}
+
+// Redis key generators
+func (s *WebhookService) getEndpointHealthKey(endpointID string, at time.Time) string {
+	return fmt.Sprintf("webhook_endpoint_health:%s:%s", endpointID, at.UTC().Format("2006010215"))
+}
+
+func (s *WebhookService) getEndpointStateKey(endpointID string) string {
+	return fmt.Sprintf("webhook_endpoint_state:%s", endpointID)
+}
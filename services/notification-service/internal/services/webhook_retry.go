@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/events"
+)
+
+// deadLetterTTL is how long exhausted deliveries can be inspected and replayed
+const deadLetterTTL = 7 * 24 * time.Hour
+
+// DeliveryFailedListener is called after a delivery was given up on and
+// moved to the dead letter queue
+type DeliveryFailedListener func(delivery *WebhookDelivery, endpoint WebhookEndpoint)
+
+// OnDeliveryFailed registers a listener for dead-lettered deliveries
+func (s *WebhookService) OnDeliveryFailed(listener DeliveryFailedListener) {
+	s.failedListeners = append(s.failedListeners, listener)
+}
+
+// scheduleRetry queues a failed delivery for another attempt, or moves it to
+// the dead letter queue once its attempts or its maximum age are used up
+func (s *WebhookService) scheduleRetry(ctx context.Context, delivery *WebhookDelivery, endpoint WebhookEndpoint) {
+	now := time.Now()
+	nextRetry := now.Add(retryBackoff(s.config.RetryDelay, s.config.MaxRetryDelay, delivery.Attempts))
+	deadline := delivery.CreatedAt.Add(s.config.MaxRetryAge)
+
+	if delivery.Attempts >= delivery.MaxAttempts || nextRetry.After(deadline) {
+		s.deadLetter(ctx, delivery, endpoint)
+		return
+	}
+
+	delivery.Status = "retrying"
+	delivery.NextRetry = &nextRetry
+	if err := s.updateDelivery(ctx, *delivery); err != nil {
+		log.Error().Err(err).Str("deliveryID", delivery.ID).Msg("Failed to update delivery")
+	}
+
+	if err := s.redis.ZAdd(ctx, s.getRetryQueueKey(), &redis.Z{
+		Score:  float64(nextRetry.Unix()),
+		Member: delivery.ID,
+	}).Err(); err != nil {
+		log.Error().Err(err).Str("deliveryID", delivery.ID).Msg("Failed to schedule webhook retry")
+		return
+	}
+
+	log.Info().
+		Str("deliveryID", delivery.ID).
+		Int("attempts", delivery.Attempts).
+		Time("nextRetry", nextRetry).
+		Msg("Webhook retry scheduled")
+}
+
+// deadLetter gives up on a delivery and keeps it, with its payload, in the
+// dead letter queue so it can be replayed. Test deliveries are dropped.
+func (s *WebhookService) deadLetter(ctx context.Context, delivery *WebhookDelivery, endpoint WebhookEndpoint) {
+	completedAt := time.Now()
+	delivery.Status = "failed"
+	delivery.NextRetry = nil
+	delivery.CompletedAt = &completedAt
+	if err := s.updateDelivery(ctx, *delivery); err != nil {
+		log.Error().Err(err).Str("deliveryID", delivery.ID).Msg("Failed to update delivery")
+	}
+	s.updateEndpointError(ctx, endpoint.ID, delivery.Error)
+
+	if isTest, _ := delivery.Metadata["test"].(bool); isTest {
+		return
+	}
+
+	now := time.Now()
+	deadLettersKey := s.getDeadLettersKey()
+
+	if err := s.redis.ZAdd(ctx, deadLettersKey, &redis.Z{
+		Score:  float64(now.Unix()),
+		Member: delivery.ID,
+	}).Err(); err != nil {
+		log.Error().Err(err).Str("deliveryID", delivery.ID).Msg("Failed to dead-letter webhook delivery")
+		return
+	}
+	if err := s.redis.ZRemRangeByScore(ctx, deadLettersKey, "-inf", strconv.FormatInt(now.Add(-deadLetterTTL).Unix(), 10)).Err(); err != nil {
+		log.Warn().Err(err).Msg("Failed to trim webhook dead letters")
+	}
+	if err := s.redis.Expire(ctx, s.getPayloadKey(delivery.PayloadID), deadLetterTTL).Err(); err != nil {
+		log.Warn().Err(err).Str("payloadID", delivery.PayloadID).Msg("Failed to keep dead-lettered payload")
+	}
+
+	log.Warn().
+		Str("deliveryID", delivery.ID).
+		Str("endpointID", delivery.EndpointID).
+		Int("attempts", delivery.Attempts).
+		Str("error", delivery.Error).
+		Msg("Webhook delivery exhausted, moved to dead letter queue")
+
+	for _, listener := range s.failedListeners {
+		listener(delivery, endpoint)
+	}
+}
+
+// DueRetries returns up to limit deliveries whose retry is due
+func (s *WebhookService) DueRetries(limit int) ([]string, error) {
+	ctx := context.Background()
+
+	deliveryIDs, err := s.redis.ZRangeByScore(ctx, s.getRetryQueueKey(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().Unix(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due webhook retries: %w", err)
+	}
+
+	return deliveryIDs, nil
+}
+
+// ClaimRetry takes a due retry off the queue, only one worker wins each
+func (s *WebhookService) ClaimRetry(deliveryID string) bool {
+	removed, err := s.redis.ZRem(context.Background(), s.getRetryQueueKey(), deliveryID).Result()
+	return err == nil && removed > 0
+}
+
+// RetryQueueKey is the queue claimed retries are put back on when they
+// can't be finished
+func (s *WebhookService) RetryQueueKey() string {
+	return s.getRetryQueueKey()
+}
+
+// GetDeadLetters returns the exhausted deliveries, the newest first
+func (s *WebhookService) GetDeadLetters(ctx context.Context, page int, limit int) ([]*WebhookDelivery, int, error) {
+	key := s.getDeadLettersKey()
+
+	total, err := s.redis.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get dead letter count: %w", err)
+	}
+
+	start := int64((page - 1) * limit)
+	stop := start + int64(limit) - 1
+
+	deliveryIDs, err := s.redis.ZRevRange(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get dead letters: %w", err)
+	}
+
+	var deliveries []*WebhookDelivery
+	for _, id := range deliveryIDs {
+		delivery, err := s.getDelivery(ctx, id)
+		if err != nil {
+			log.Warn().Err(err).Str("deliveryID", id).Msg("Failed to get delivery")
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, int(total), nil
+}
+
+// ReplayDeadLetter delivers the payload of an exhausted delivery again, as a
+// new delivery with a fresh retry budget
+func (s *WebhookService) ReplayDeadLetter(ctx context.Context, deliveryID string) (*WebhookDelivery, error) {
+	exhausted, err := s.getDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.redis.ZScore(ctx, s.getDeadLettersKey(), deliveryID).Result(); err != nil {
+		if err == redis.Nil {
+			return nil, conflictf("delivery %s is not in the dead letter queue", deliveryID)
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	endpoint, err := s.GetEndpoint(ctx, exhausted.EndpointID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get endpoint: %w", err)
+	}
+	if _, err := s.getPayload(ctx, exhausted.PayloadID); err != nil {
+		return nil, fmt.Errorf("failed to get payload: %w", err)
+	}
+
+	delivery := WebhookDelivery{
+		ID:          generateDeliveryID(),
+		EndpointID:  endpoint.ID,
+		PayloadID:   exhausted.PayloadID,
+		Status:      "pending",
+		MaxAttempts: endpoint.RetryCount,
+		CreatedAt:   time.Now(),
+		Metadata:    map[string]interface{}{"replay_of": exhausted.ID},
+	}
+	if err := s.storeDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("failed to store delivery: %w", err)
+	}
+
+	// The retry worker sends it right away
+	if err := s.redis.ZAdd(ctx, s.getRetryQueueKey(), &redis.Z{
+		Score:  float64(delivery.CreatedAt.Unix()),
+		Member: delivery.ID,
+	}).Err(); err != nil {
+		return nil, fmt.Errorf("failed to queue delivery: %w", err)
+	}
+	if err := s.redis.ZRem(ctx, s.getDeadLettersKey(), deliveryID).Err(); err != nil {
+		log.Warn().Err(err).Str("deliveryID", deliveryID).Msg("Failed to remove dead letter")
+	}
+
+	log.Info().
+		Str("deliveryID", delivery.ID).
+		Str("replayOf", deliveryID).
+		Msg("Webhook dead letter replayed")
+
+	return &delivery, nil
+}
+
+// startWebhookRetryWorker sends the webhook retries that are due. Retries are
+// kept in Redis, so the ones pending when an instance stops are sent by
+// another instance or after the restart.
+func (s *NotificationService) startWebhookRetryWorker() {
+	log.Info().Msg("Webhook retry worker started")
+
+	for {
+		s.processWebhookRetries()
+
+		select {
+		case <-s.ctx.Done():
+			log.Info().Msg("Webhook retry worker stopped")
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// processWebhookRetries sends every webhook retry that is due
+func (s *NotificationService) processWebhookRetries() {
+	deliveryIDs, err := s.webhookService.DueRetries(s.config.BatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get due webhook retries")
+		return
+	}
+
+	queueKey := s.webhookService.RetryQueueKey()
+	for _, deliveryID := range deliveryIDs {
+		// Leave the rest of the batch queued when shutting down
+		if s.ctx.Err() != nil {
+			return
+		}
+		if !s.webhookService.ClaimRetry(deliveryID) {
+			continue
+		}
+
+		s.trackInFlight(queueKey, deliveryID)
+		s.webhookService.retryWebhook(context.Background(), deliveryID)
+		s.untrackInFlight(deliveryID)
+	}
+}
+
+// publishWebhookFailure tells subscribers that a delivery was given up on.
+// Failures of deliveries carrying a webhook.failed event aren't published, so
+// a failing subscriber can't cause an endless stream of them.
+func (s *NotificationService) publishWebhookFailure(delivery *WebhookDelivery, endpoint WebhookEndpoint) {
+	var eventType string
+	if payload, err := s.webhookService.getPayload(context.Background(), delivery.PayloadID); err == nil {
+		eventType = payload.Event
+	}
+	if eventType == events.TypeWebhookFailed {
+		return
+	}
+
+	now := time.Now()
+	event := WebhookEvent{
+		ID:       generateWebhookID(),
+		Type:     events.TypeWebhookFailed,
+		Source:   "notification-service",
+		TenantID: endpoint.TenantID,
+		Data: map[string]interface{}{
+			"endpoint_id": endpoint.ID,
+			"delivery_id": delivery.ID,
+			"event":       eventType,
+			"url":         endpoint.URL,
+			"error":       delivery.Error,
+			"attempts":    delivery.Attempts,
+		},
+		Timestamp: now,
+		Priority:  "high",
+		CreatedAt: now,
+	}
+	s.emitEvent(event)
+}
+
+// Redis key generators
+func (s *WebhookService) getRetryQueueKey() string {
+	return "webhook_retry_queue"
+}
+
+func (s *WebhookService) getDeadLettersKey() string {
+	return "webhook_dead_letters"
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// errBlockedAddress is returned when a webhook would reach an internal address
+var errBlockedAddress = errors.New("webhook destination is not a public address")
+
+// blockedNetworks are the ranges webhooks may not reach besides the private,
+// loopback and link-local ones the net package knows
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // this network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved
+)
+
+// WebhookAllowList limits the hosts the endpoints of a tenant may send to.
+// Hosts are exact names or wildcards like *.example.com, an empty list
+// allows every public host.
+type WebhookAllowList struct {
+	Hosts []string `json:"hosts"`
+}
+
+// WebhookClientCertificate is the certificate an endpoint is called with
+// when it requires mutual TLS
+type WebhookClientCertificate struct {
+	CertificatePEM string `json:"certificate_pem"`
+	PrivateKeyPEM  string `json:"private_key_pem,omitempty"`
+}
+
+// GetAllowList returns the destination allow-list of a tenant
+func (s *WebhookService) GetAllowList(ctx context.Context, tenantID string) (*WebhookAllowList, error) {
+	allowListJSON, err := s.redis.Get(ctx, s.getAllowListKey(tenantID)).Result()
+	if err == redis.Nil {
+		return &WebhookAllowList{Hosts: []string{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook allow-list: %w", err)
+	}
+
+	var allowList WebhookAllowList
+	if err := json.Unmarshal([]byte(allowListJSON), &allowList); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook allow-list: %w", err)
+	}
+
+	return &allowList, nil
+}
+
+// SetAllowList replaces the destination allow-list of a tenant. Endpoints
+// outside the new list stop receiving events.
+func (s *WebhookService) SetAllowList(ctx context.Context, tenantID string, allowList WebhookAllowList) (*WebhookAllowList, error) {
+	hosts := []string{}
+	seen := make(map[string]bool)
+	for _, host := range allowList.Hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" || seen[host] {
+			continue
+		}
+		if strings.Contains(strings.TrimPrefix(host, "*."), "*") || strings.ContainsAny(host, "/:") {
+			return nil, invalid(fmt.Errorf("invalid allow-list host: %s", host))
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	allowList.Hosts = hosts
+
+	allowListJSON, err := json.Marshal(allowList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook allow-list: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, s.getAllowListKey(tenantID), allowListJSON, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store webhook allow-list: %w", err)
+	}
+
+	return &allowList, nil
+}
+
+// checkDestination rejects endpoint URLs outside the allow-list of their
+// tenant, and hosts resolving to internal addresses. The addresses are
+// checked again when connecting, so a host can't be pointed inside later.
+func (s *WebhookService) checkDestination(ctx context.Context, endpoint WebhookEndpoint) error {
+	parsed, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint URL: %w", err)
+	}
+	host := strings.ToLower(parsed.Hostname())
+
+	allowList, err := s.GetAllowList(ctx, endpoint.TenantID)
+	if err != nil {
+		return err
+	}
+	if !allowList.allows(host) {
+		return fmt.Errorf("endpoint host %s is not in the tenant's allow-list", host)
+	}
+
+	if s.config.AllowPrivateNetworks {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errBlockedAddress
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if isBlockedIP(ip) {
+			return errBlockedAddress
+		}
+		return nil
+	}
+
+	// Hosts that don't resolve yet are left to the check when connecting
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, address := range addresses {
+		if isBlockedIP(address.IP) {
+			return errBlockedAddress
+		}
+	}
+	return nil
+}
+
+// clientFor returns the HTTP client an endpoint is called with. Endpoints
+// with a client certificate get their own client, without keep-alives so
+// no connections are left behind.
+func (s *WebhookService) clientFor(endpoint WebhookEndpoint) (*http.Client, error) {
+	if endpoint.ClientCertificate == nil {
+		return s.client, nil
+	}
+
+	certificate, err := endpoint.ClientCertificate.keyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := newWebhookTransport(s.config.AllowPrivateNetworks)
+	transport.TLSClientConfig = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	transport.DisableKeepAlives = true
+
+	return newWebhookClient(transport, s.config.Timeout), nil
+}
+
+// keyPair parses the certificate and its private key
+func (c WebhookClientCertificate) keyPair() (tls.Certificate, error) {
+	certificate, err := tls.X509KeyPair([]byte(c.CertificatePEM), []byte(c.PrivateKeyPEM))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return certificate, nil
+}
+
+// allows reports whether a host may receive webhooks
+func (a WebhookAllowList) allows(host string) bool {
+	if len(a.Hosts) == 0 {
+		return true
+	}
+	for _, allowed := range a.Hosts {
+		if allowed == host {
+			return true
+		}
+		if suffix := strings.TrimPrefix(allowed, "*"); suffix != allowed && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookTransport returns a transport refusing to connect to internal
+// addresses, whatever the endpoint's host resolves to when connecting
+func newWebhookTransport(allowPrivateNetworks bool) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivateNetworks {
+		dialer.Control = func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isBlockedIP(ip) {
+				return errBlockedAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// newWebhookClient returns a client that doesn't follow redirects, so an
+// endpoint can't send deliveries on to a host outside the allow-list
+func newWebhookClient(transport *http.Transport, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Helper functions
+func isBlockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Redis key generators
+func (s *WebhookService) getAllowListKey(tenantID string) string {
+	if tenantID == "" {
+		return "webhook_allowlist:global"
+	}
+	return fmt.Sprintf("webhook_allowlist:%s", tenantID)
+}
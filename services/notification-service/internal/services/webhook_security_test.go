@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClientCertificate returns a self-signed client certificate named
+// commonName with its private key, both PEM encoded
+func testClientCertificate(t *testing.T, commonName string) WebhookClientCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	return WebhookClientCertificate{
+		CertificatePEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		PrivateKeyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func TestAllowListsMatchHostsAndWildcards(t *testing.T) {
+	allowList := WebhookAllowList{Hosts: []string{"hooks.talimat.test", "*.partner.test"}}
+
+	for host, allowed := range map[string]bool{
+		"hooks.talimat.test":     true,
+		"api.hooks.talimat.test": false,
+		"a.partner.test":         true,
+		"a.b.partner.test":       true,
+		"partner.test":           false,
+		"evilpartner.test":       false,
+		"attacker.test":          false,
+	} {
+		if allowList.allows(host) != allowed {
+			t.Errorf("Expected %s to be allowed=%v", host, allowed)
+		}
+	}
+
+	if !(WebhookAllowList{}).allows("attacker.test") {
+		t.Errorf("Expected an empty allow-list to allow every host")
+	}
+}
+
+func TestAllowListsAreNormalizedWhenSet(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	webhooks := env.service.webhookService
+
+	allowList, err := webhooks.SetAllowList(ctx, "tenant-a", WebhookAllowList{Hosts: []string{" Hooks.Talimat.TEST ", "hooks.talimat.test", "", "*.partner.test"}})
+	if err != nil {
+		t.Fatalf("Failed to set allow-list: %v", err)
+	}
+	if expected := []string{"hooks.talimat.test", "*.partner.test"}; !reflect.DeepEqual(allowList.Hosts, expected) {
+		t.Errorf("Expected %v, got %v", expected, allowList.Hosts)
+	}
+	if stored, err := webhooks.GetAllowList(ctx, "tenant-a"); err != nil || !reflect.DeepEqual(stored.Hosts, allowList.Hosts) {
+		t.Errorf("Expected the allow-list to be stored, got %v %v", stored, err)
+	}
+
+	for _, host := range []string{"*.*.partner.test", "hooks*.talimat.test", "hooks.talimat.test:443", "https://hooks.talimat.test"} {
+		if _, err := webhooks.SetAllowList(ctx, "tenant-a", WebhookAllowList{Hosts: []string{host}}); !errors.Is(err, ErrValidation) {
+			t.Errorf("Expected %s to be refused, got %v", host, err)
+		}
+	}
+}
+
+func TestDestinationsAreChecked(t *testing.T) {
+	env := newIntegrationEnv(t)
+	ctx := context.Background()
+	webhooks := env.service.webhookService
+	webhooks.config.AllowPrivateNetworks = false
+
+	if _, err := webhooks.SetAllowList(ctx, "tenant-a", WebhookAllowList{Hosts: []string{"hooks.talimat.test", "10.0.0.5"}}); err != nil {
+		t.Fatalf("Failed to set allow-list: %v", err)
+	}
+
+	for name, test := range map[string]struct {
+		tenantID string
+		url      string
+		expected string
+	}{
+		"allowed host":         {"tenant-a", "https://hooks.talimat.test/events", ""},
+		"host outside list":    {"tenant-a", "https://attacker.test/events", "not in the tenant's allow-list"},
+		"allowed but private":  {"tenant-a", "http://10.0.0.5/events", errBlockedAddress.Error()},
+		"public address":       {"tenant-b", "https://93.184.216.34/events", ""},
+		"loopback":             {"tenant-b", "http://127.0.0.1:8080/events", errBlockedAddress.Error()},
+		"IPv6 loopback":        {"tenant-b", "http://[::1]/events", errBlockedAddress.Error()},
+		"localhost":            {"tenant-b", "http://localhost/events", errBlockedAddress.Error()},
+		"localhost subdomain":  {"tenant-b", "http://api.localhost/events", errBlockedAddress.Error()},
+		"cloud metadata":       {"tenant-b", "http://169.254.169.254/latest/meta-data", errBlockedAddress.Error()},
+		"private network":      {"tenant-b", "http://192.168.1.10/events", errBlockedAddress.Error()},
+		"carrier-grade NAT":    {"tenant-b", "http://100.64.0.1/events", errBlockedAddress.Error()},
+		"IPv6 unique local":    {"tenant-b", "http://[fd00::1]/events", errBlockedAddress.Error()},
+		"IPv4-mapped loopback": {"tenant-b", "http://[::ffff:127.0.0.1]/events", errBlockedAddress.Error()},
+	} {
+		err := webhooks.checkDestination(ctx, WebhookEndpoint{TenantID: test.tenantID, URL: test.url})
+		if test.expected == "" && err != nil {
+			t.Errorf("%s: expected %s to be allowed, got %v", name, test.url, err)
+		}
+		if test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)) {
+			t.Errorf("%s: expected %s to be refused with %q, got %v", name, test.url, test.expected, err)
+		}
+	}
+
+	// Private networks can be allowed for endpoints inside the deployment
+	webhooks.config.AllowPrivateNetworks = true
+	if err := webhooks.checkDestination(ctx, WebhookEndpoint{TenantID: "tenant-b", URL: "http://127.0.0.1:8080/events"}); err != nil {
+		t.Errorf("Expected internal addresses to be allowed, got %v", err)
+	}
+}
+
+func TestInternalAddressesAreRefusedWhenConnecting(t *testing.T) {
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	t.Cleanup(server.Close)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// Names are checked by the address they resolve to when connecting, so
+	// they can't be pointed inside after the endpoint was checked
+	client := newWebhookClient(newWebhookTransport(false), time.Second)
+	for _, url := range []string{server.URL, "http://localhost:" + port} {
+		if _, err := client.Get(url); !errors.Is(err, errBlockedAddress) {
+			t.Errorf("Expected the connection to %s to be refused, got %v", url, err)
+		}
+	}
+	if received != 0 {
+		t.Errorf("Expected no request to reach the server, got %d", received)
+	}
+
+	client = newWebhookClient(newWebhookTransport(true), time.Second)
+	if resp, err := client.Get(server.URL); err != nil {
+		t.Errorf("Expected internal addresses to be reached when allowed, got %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	for ip, blocked := range map[string]bool{
+		"169.254.169.254": true,
+		"172.16.0.1":      true,
+		"0.0.0.0":         true,
+		"198.18.0.1":      true,
+		"224.0.0.1":       true,
+		"fe80::1":         true,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+	} {
+		if isBlockedIP(net.ParseIP(ip)) != blocked {
+			t.Errorf("Expected %s to be blocked=%v", ip, blocked)
+		}
+	}
+}
+
+func TestClientCertificatesAreLoadedPerEndpoint(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	webhooks := &WebhookService{
+		config: WebhookConfig{AllowPrivateNetworks: true, Timeout: time.Second},
+		client: server.Client(),
+	}
+
+	// Endpoints without a certificate share the client of the service
+	client, err := webhooks.clientFor(WebhookEndpoint{URL: server.URL})
+	if err != nil || client != webhooks.client {
+		t.Errorf("Expected the shared client, got %v", err)
+	}
+
+	certificate := testClientCertificate(t, "tenant-a-webhooks")
+	client, err = webhooks.clientFor(WebhookEndpoint{URL: server.URL, ClientCertificate: &certificate})
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	transport := client.Transport.(*http.Transport)
+	if !transport.DisableKeepAlives || transport.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected a TLS 1.2+ client without keep-alives, got %+v", transport)
+	}
+
+	// The test server's certificate isn't publicly trusted
+	transport.TLSClientConfig.RootCAs = x509.NewCertPool()
+	transport.TLSClientConfig.RootCAs.AddCert(server.Certificate())
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to call endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "tenant-a-webhooks" {
+		t.Errorf("Expected the endpoint to receive its certificate, got %d %q", resp.StatusCode, body)
+	}
+
+	for name, broken := range map[string]WebhookClientCertificate{
+		"no key":    {CertificatePEM: certificate.CertificatePEM},
+		"other key": {CertificatePEM: certificate.CertificatePEM, PrivateKeyPEM: testClientCertificate(t, "other").PrivateKeyPEM},
+		"not PEM":   {CertificatePEM: "certificate", PrivateKeyPEM: "key"},
+	} {
+		broken := broken
+		if _, err := webhooks.clientFor(WebhookEndpoint{URL: server.URL, ClientCertificate: &broken}); err == nil || !strings.Contains(err.Error(), "invalid client certificate") {
+			t.Errorf("%s: expected the certificate to be refused, got %v", name, err)
+		}
+	}
+}
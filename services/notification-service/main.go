@@ -1,363 +1,597 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"flag"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq" // registers the postgres driver of the archive
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat-notifications/internal/api"
+	"claude-talimat-notifications/internal/config"
+	"claude-talimat-notifications/internal/problem"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/envelope"
+	"claude-talimat/pkg/health"
+	"claude-talimat/pkg/logging"
+	"claude-talimat/pkg/middleware"
+	"claude-talimat/pkg/redisclient"
+	"claude-talimat/pkg/runtimeconfig"
+	"claude-talimat/pkg/validation"
 )
 
-// NotificationRequest represents a notification request
-type NotificationRequest struct {
-	ID        string                 `json:"id"`
-	Type      string                 `json:"type"`      // email, sms, push, inapp
-	Recipient string                 `json:"recipient"` // email address, phone number, user ID
-	Title     string                 `json:"title"`
-	Message   string                 `json:"message"`
-	Priority  string                 `json:"priority"` // low, normal, high, urgent
-	Category  string                 `json:"category"`
-	Data      map[string]interface{} `json:"data,omitempty"`
-	Schedule  *time.Time             `json:"schedule,omitempty"`
-}
-
-// NotificationResponse represents a notification response
-type NotificationResponse struct {
-	ID        string    `json:"id"`
-	Status    string    `json:"status"` // pending, sent, failed
-	Message   string    `json:"message"`
-	Timestamp time.Time `json:"timestamp"`
-}
+// shutdownTimeout bounds how long in-flight work may take to drain on shutdown
+const shutdownTimeout = 30 * time.Second
 
-// HealthResponse represents health check response
-type HealthResponse struct {
-	Status    string `json:"status"`
-	Service   string `json:"service"`
-	Timestamp int64  `json:"timestamp"`
-	Version   string `json:"version"`
-	Uptime    string `json:"uptime"`
-}
-
-var startTime = time.Now()
+// checkTimeout bounds the connectivity checks run at startup
+const checkTimeout = 10 * time.Second
 
 func main() {
-	// Set Gin to release mode
-	gin.SetMode(gin.ReleaseMode)
+	skipChecks := flag.Bool("skip-checks", false, "start without checking that Redis, the mail server and the user service are reachable")
+	flag.Parse()
+
+	// A service started with a broken configuration fails later and less clearly
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Setup("notification-service", os.Getenv("LOG_LEVEL"))
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
 
-	// Create router
-	router := gin.New()
+	logging.Setup("notification-service", cfg.LogLevel)
 
-	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-	router.Use(corsMiddleware())
-
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		uptime := time.Since(startTime).String()
-		response := HealthResponse{
-			Status:    "healthy",
-			Service:   "notification-service",
-			Timestamp: time.Now().Unix(),
-			Version:   "1.0.0",
-			Uptime:    uptime,
+	for _, channel := range cfg.Channels() {
+		event := log.Info()
+		if channel.State == config.ChannelDisabled {
+			event = log.Warn()
 		}
-		c.JSON(http.StatusOK, response)
-	})
-
-	// Root endpoint
-	router.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"service": "Claude Notification Service",
-			"version": "1.0.0",
-			"status":  "running",
-			"endpoints": gin.H{
-				"health": "/health",
-				"send":   "/api/v1/notifications/send",
-				"status": "/api/v1/notifications/:id/status",
-			},
-		})
-	})
+		event.
+			Str("channel", channel.Name).
+			Str("state", channel.State).
+			Str("provider", channel.Provider).
+			Str("reason", channel.Reason).
+			Msg("Notification channel")
+	}
 
-	// API v1 routes
-	api := router.Group("/api/v1")
-	{
-		// Notifications group
-		notifications := api.Group("/notifications")
-		{
-			// Send notification
-			notifications.POST("/send", sendNotification)
+	if *skipChecks {
+		log.Warn().Msg("Connectivity checks skipped")
+	} else if err := cfg.CheckConnectivity(checkTimeout); err != nil {
+		log.Fatal().Err(err).Msg("Dependencies are unreachable, start with --skip-checks to ignore")
+	}
 
-			// Get notification status
-			notifications.GET("/:id/status", getNotificationStatus)
+	archiver, err := newArchiver(cfg.Archive)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create archiver")
+	}
 
-			// Send bulk notifications
-			notifications.POST("/send-bulk", sendBulkNotifications)
-		}
+	runtimeConfig, err := newRuntimeConfig(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load runtime configuration")
+	}
 
-		// Templates group
-		templates := api.Group("/templates")
-		{
-			// Get available templates
-			templates.GET("/", getTemplates)
+	notificationService, err := services.NewNotificationService(notificationConfig(cfg, archiver, runtimeConfig))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create notification service")
+	}
 
-			// Get template by ID
-			templates.GET("/:id", getTemplate)
+	// Rotated provider credentials apply without a restart, the other
+	// secrets are read once at startup
+	cfg.SecretManager().OnChange(func() {
+		rotated, err := cfg.Reload()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to reload configuration with rotated secrets")
+			return
 		}
-
-		// Statistics group
-		stats := api.Group("/stats")
-		{
-			// Get notification statistics
-			stats.GET("/", getNotificationStats)
+		config := notificationConfig(rotated, archiver, runtimeConfig)
+		if err := notificationService.UpdateCredentials(config.EmailConfig, config.SMSConfig); err != nil {
+			log.Error().Err(err).Msg("Failed to apply rotated credentials")
 		}
+	})
+
+	idempotencyService, err := services.NewIdempotencyService(services.IdempotencyConfig{
+		RedisURL:      cfg.Redis.URL,
+		RedisPassword: cfg.Redis.Password,
+		RedisDB:       cfg.Redis.DB,
+		TTL:           cfg.Idempotency.TTL,
+		LockTTL:       cfg.Idempotency.LockTTL,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create idempotency service")
 	}
 
-	// Start server
-	log.Printf("Starting Notification Service on port 8007")
-	if err := router.Run(":8007"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	privacyService, err := services.NewPrivacyService(services.PrivacyConfig{
+		RedisURL:      cfg.Redis.URL,
+		RedisPassword: cfg.Redis.Password,
+		RedisDB:       cfg.Redis.DB,
+		AuditSecret:   cfg.Privacy.AuditSecret,
+		AuditTTL:      cfg.Privacy.AuditTTL,
+	}, notificationService)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create privacy service")
 	}
-}
 
-// CORS middleware
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	campaignService, err := services.NewCampaignService(services.CampaignConfig{
+		RedisURL:      cfg.Redis.URL,
+		RedisPassword: cfg.Redis.Password,
+		RedisDB:       cfg.Redis.DB,
+	}, notificationService)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create campaign service")
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
+	onCallService, err := services.NewOnCallService(services.OnCallConfig{
+		RedisURL:      cfg.Redis.URL,
+		RedisPassword: cfg.Redis.Password,
+		RedisDB:       cfg.Redis.DB,
+	}, notificationService)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create on-call service")
+	}
+
+	var queueConsumer *services.QueueConsumer
+	if cfg.Queue.Enabled {
+		queueConsumer, err = services.NewQueueConsumer(services.QueueConsumerConfig{
+			ServiceURL: cfg.Queue.ServiceURL,
+			Topic:      cfg.Queue.Topic,
+			BatchSize:  cfg.Queue.BatchSize,
+			BlockTime:  cfg.Queue.BlockTime,
+			RetryAfter: cfg.Queue.RetryAfter,
+			MaxRetries: cfg.Queue.MaxRetries,
+		}, notificationService)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create queue consumer")
 		}
+	}
 
-		c.Next()
+	healthRedis, err := redisclient.New(redisclient.Config{
+		URL:      cfg.Redis.URL,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create Redis client")
 	}
-}
 
-// sendNotification handles single notification requests
-func sendNotification(c *gin.Context) {
-	var request NotificationRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
-		return
+	if cfg.IsProduction() {
+		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Validate required fields
-	if request.Type == "" || request.Recipient == "" || request.Title == "" || request.Message == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Missing required fields",
-			"message": "Type, recipient, title, and message are required",
-		})
-		return
+	router := newRouter(cfg, apiServices{
+		notifications: notificationService,
+		idempotency:   idempotencyService,
+		privacy:       privacyService,
+		campaigns:     campaignService,
+		onCall:        onCallService,
+		runtimeConfig: runtimeConfig,
+		healthRedis:   healthRedis,
+	})
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: router,
 	}
 
-	// Generate notification ID if not provided
-	if request.ID == "" {
-		request.ID = generateID()
+	// Start server
+	go func() {
+		log.Info().
+			Str("port", cfg.Port).
+			Str("environment", cfg.Environment).
+			Msg("Starting Notification Service")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("Failed to start server")
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shutdown the server
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Info().Msg("Shutting down Notification Service")
+
+	// Let in-flight requests finish before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
 
-	// Set default values
-	if request.Priority == "" {
-		request.Priority = "normal"
+	// Stop the producers of notifications before the pipeline they feed
+	if queueConsumer != nil {
+		if err := queueConsumer.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to shut down queue consumer")
+		}
 	}
-	if request.Category == "" {
-		request.Category = "general"
+	if err := campaignService.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to shut down campaign service")
 	}
-
-	// Simulate notification processing
-	response := NotificationResponse{
-		ID:        request.ID,
-		Status:    "pending",
-		Message:   "Notification queued for delivery",
-		Timestamp: time.Now(),
+	if err := onCallService.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to shut down on-call service")
+	}
+	if err := notificationService.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to shut down notification service")
 	}
+	runtimeConfig.Close()
+	cfg.SecretManager().Close()
 
-	log.Printf("Notification queued: ID=%s, Type=%s, Recipient=%s", request.ID, request.Type, request.Recipient)
+	log.Info().Msg("Notification Service stopped")
+}
 
-	c.JSON(http.StatusOK, response)
+// apiServices are the services the routes of the API are served by
+type apiServices struct {
+	notifications *services.NotificationService
+	idempotency   *services.IdempotencyService
+	privacy       *services.PrivacyService
+	campaigns     *services.CampaignService
+	onCall        *services.OnCallService
+	runtimeConfig *runtimeconfig.Store
+	healthRedis   *redis.Client
 }
 
-// sendBulkNotifications handles bulk notification requests
-func sendBulkNotifications(c *gin.Context) {
-	var request struct {
-		Notifications []NotificationRequest `json:"notifications"`
-	}
+// newRouter mounts the routes of every handler, on both versions of the API
+func newRouter(cfg *config.Config, svc apiServices) *gin.Engine {
+	// Create router
+	router := gin.New()
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request",
-			"message": err.Error(),
-		})
-		return
+	// Add middleware
+	router.Use(gin.Logger())
+	router.Use(gin.Recovery())
+	router.Use(middleware.CORS())
+
+	// Unknown routes answer with a problem like every other error
+	router.NoRoute(func(c *gin.Context) {
+		problem.Respond(c, problem.CodeNotFound, "No route for "+c.Request.Method+" "+c.Request.URL.Path)
+	})
+
+	notificationHandler := api.NewNotificationHandler(svc.notifications, svc.idempotency)
+	ackHandler := api.NewAckHandler(svc.notifications)
+	contactPointHandler := api.NewContactPointHandler(svc.notifications)
+	emailHandler := api.NewEmailHandler(svc.notifications)
+	smsHandler := api.NewSMSHandler(svc.notifications, svc.notifications.SMS())
+	voiceHandler := api.NewVoiceHandler(svc.notifications)
+
+	// Health check endpoints
+	router.GET("/health", health.Handler("notification-service", "1.0.0", svc.healthRedis))
+	router.GET("/health/providers", notificationHandler.HealthCheck)
+
+	// Links in notifications and provider callbacks can't carry credentials
+	publicRoutes := []func(*gin.RouterGroup){
+		ackHandler.RegisterPublicRoutes,
+		contactPointHandler.RegisterPublicRoutes,
+		emailHandler.RegisterPublicRoutes,
+		smsHandler.RegisterPublicRoutes,
+		voiceHandler.RegisterPublicRoutes,
 	}
 
-	if len(request.Notifications) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "No notifications provided",
-			"message": "At least one notification is required",
-		})
-		return
+	routes := []func(*gin.RouterGroup){
+		notificationHandler.RegisterRoutes,
+		ackHandler.RegisterRoutes,
+		contactPointHandler.RegisterRoutes,
+		emailHandler.RegisterRoutes,
+		smsHandler.RegisterRoutes,
+		api.NewAdminHandler(svc.notifications).RegisterRoutes,
+		api.NewCampaignHandler(svc.campaigns).RegisterRoutes,
+		api.NewCategoryHandler(svc.notifications).RegisterRoutes,
+		api.NewDeviceHandler(svc.notifications.Push()).RegisterRoutes,
+		api.NewInAppHandler(svc.notifications.InApp()).RegisterRoutes,
+		api.NewMaintenanceHandler(svc.notifications).RegisterRoutes,
+		api.NewOnCallHandler(svc.onCall).RegisterRoutes,
+		api.NewOTPHandler(svc.notifications).RegisterRoutes,
+		api.NewPrivacyHandler(svc.privacy).RegisterRoutes,
+		api.NewRetentionHandler(svc.notifications).RegisterRoutes,
+		api.NewRuntimeConfigHandler(svc.runtimeConfig).RegisterRoutes,
+		api.NewSandboxHandler(svc.notifications).RegisterRoutes,
+		api.NewSettingsHandler(svc.notifications).RegisterRoutes,
+		api.NewTemplateHandler(svc.notifications.Templates()).RegisterRoutes,
+		api.NewWebhookHandler(svc.notifications.Webhooks()).RegisterRoutes,
 	}
 
-	// Process each notification
-	var responses []NotificationResponse
-	for _, notification := range request.Notifications {
-		// Generate ID if not provided
-		if notification.ID == "" {
-			notification.ID = generateID()
-		}
+	auth := api.AuthMiddleware(api.AuthConfig{
+		JWTSecret: cfg.Auth.JWTSecret,
+		APIKeys:   cfg.Auth.APIKeys,
+	})
+	locale := api.LocaleMiddleware(svc.notifications.TenantLocale)
+	strict := validation.Strict(func() bool {
+		return svc.runtimeConfig.Bool(services.RuntimeStrictValidation, cfg.API.StrictValidation)
+	})
 
-		// Set default values
-		if notification.Priority == "" {
-			notification.Priority = "normal"
-		}
-		if notification.Category == "" {
-			notification.Category = "general"
-		}
+	// Version 1 keeps working until clients moved to version 2. Public links
+	// were handed out already and are not deprecated.
+	public := router.Group("/api/v1")
+	v1 := router.Group("/api/v1", envelope.Deprecated("/api/v2"), strict, auth, locale)
 
-		response := NotificationResponse{
-			ID:        notification.ID,
-			Status:    "pending",
-			Message:   "Notification queued for delivery",
-			Timestamp: time.Now(),
-		}
+	// Version 2 serves the same routes with every JSON response in one envelope
+	publicV2 := router.Group("/api/v2", envelope.Middleware())
+	v2 := router.Group("/api/v2", envelope.Middleware(), strict, auth, locale)
 
-		responses = append(responses, response)
-		log.Printf("Bulk notification queued: ID=%s, Type=%s, Recipient=%s", notification.ID, notification.Type, notification.Recipient)
+	for _, register := range publicRoutes {
+		register(public)
+		register(publicV2)
+	}
+	for _, register := range routes {
+		register(v1)
+		register(v2)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success":       true,
-		"total":         len(responses),
-		"notifications": responses,
-		"message":       "Bulk notifications queued for delivery",
-	})
+	return router
 }
 
-// getNotificationStatus returns the status of a notification
-func getNotificationStatus(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Missing notification ID",
-			"message": "Notification ID is required",
-		})
-		return
-	}
+// notificationConfig returns the configuration of the notification service
+// and the channel services it creates
+func notificationConfig(cfg *config.Config, archiver services.Archiver, runtimeConfig *runtimeconfig.Store) services.NotificationConfig {
+	redisURL, redisPassword, redisDB := cfg.Redis.URL, cfg.Redis.Password, cfg.Redis.DB
 
-	// Simulate status lookup
-	status := "sent"              // In real implementation, this would query a database
-	if time.Now().Unix()%3 == 0 { // Simulate some failed notifications
-		status = "failed"
-	}
+	emailProvider := cfg.Email.Provider
+	pushProvider, pushPlatforms := cfg.Push.Provider, cfg.Push.Platforms
 
-	response := NotificationResponse{
-		ID:        id,
-		Status:    status,
-		Message:   "Notification status retrieved",
-		Timestamp: time.Now(),
+	// Disabled channels never send, so they are set up with the providers
+	// that need no credentials
+	if !cfg.Email.Enabled {
+		emailProvider = services.EmailProviderSMTP
+	}
+	if !cfg.Push.Enabled {
+		pushProvider, pushPlatforms = services.PushProviderWebPush, nil
 	}
 
-	c.JSON(http.StatusOK, response)
-}
+	smsProviders := make(map[string]services.SMSProviderConfig, len(cfg.SMS.Providers))
+	for name, provider := range cfg.SMS.Providers {
+		smsProviders[name] = services.SMSProviderConfig{
+			APIKey:      provider.APIKey,
+			APISecret:   provider.APISecret,
+			FromNumber:  provider.FromNumber,
+			BaseURL:     provider.BaseURL,
+			SegmentCost: provider.SegmentCost,
+			RateLimit:   provider.RateLimit,
+		}
+	}
 
-// getTemplates returns available notification templates
-func getTemplates(c *gin.Context) {
-	templates := []gin.H{
-		{
-			"id":          "welcome",
-			"name":        "Welcome Template",
-			"type":        "email",
-			"category":    "onboarding",
-			"description": "Welcome email for new users",
+	return services.NotificationConfig{
+		RedisURL:      redisURL,
+		RedisPassword: redisPassword,
+		RedisDB:       redisDB,
+		EmailConfig: services.EmailConfig{
+			Host:                   cfg.Email.Host,
+			Port:                   cfg.Email.Port,
+			Username:               cfg.Email.Username,
+			Password:               cfg.Email.Password,
+			From:                   cfg.Email.From,
+			FromName:               cfg.Email.FromName,
+			UseTLS:                 cfg.Email.UseTLS,
+			UseSSL:                 cfg.Email.UseSSL,
+			DryRun:                 cfg.Email.DryRun,
+			Provider:               emailProvider,
+			APIKey:                 cfg.Email.APIKey,
+			APISecret:              cfg.Email.APISecret,
+			Region:                 cfg.Email.Region,
+			Domain:                 cfg.Email.Domain,
+			BaseURL:                cfg.Email.BaseURL,
+			WebhookSigningKey:      cfg.Email.WebhookSigningKey,
+			WebhookToken:           cfg.Email.WebhookToken,
+			TemplatesDir:           cfg.Email.TemplatesDir,
+			TemplateReloadInterval: cfg.Email.TemplateReloadInterval,
+			MJMLCommand:            cfg.Email.MJMLCommand,
+			MaxAttachmentSize:      cfg.Email.MaxAttachmentSize,
+			MaxAttachmentsSize:     cfg.Email.MaxAttachmentsSize,
+			AttachmentHosts:        cfg.Email.AttachmentHosts,
+			AttachmentS3Endpoint:   cfg.Email.AttachmentS3Endpoint,
+			AttachmentS3Region:     cfg.Email.AttachmentS3Region,
+			AttachmentS3AccessKey:  cfg.Email.AttachmentS3AccessKey,
+			AttachmentS3SecretKey:  cfg.Email.AttachmentS3SecretKey,
+			DocumentServiceURL:     cfg.Email.DocumentServiceURL,
+			DocumentServiceToken:   cfg.Email.DocumentServiceToken,
+			ClamAVAddress:          cfg.Email.ClamAVAddress,
+			BulkConcurrency:        cfg.Email.BulkConcurrency,
+		},
+		SMSConfig: services.SMSConfig{
+			RedisURL:            redisURL,
+			RedisPassword:       redisPassword,
+			RedisDB:             redisDB,
+			Provider:            cfg.SMS.Provider,
+			APIKey:              cfg.SMS.APIKey,
+			APISecret:           cfg.SMS.APISecret,
+			FromNumber:          cfg.SMS.FromNumber,
+			BaseURL:             cfg.SMS.BaseURL,
+			MaxRetries:          cfg.SMS.MaxRetries,
+			RetryDelay:          cfg.SMS.RetryDelay,
+			RateLimit:           cfg.SMS.RateLimit,
+			DryRun:              cfg.SMS.DryRun,
+			MaxSegments:         cfg.SMS.MaxSegments,
+			SegmentCost:         cfg.SMS.SegmentCost,
+			Providers:           smsProviders,
+			TenantProviders:     cfg.SMS.TenantProviders,
+			StatusCallbackURL:   cfg.SMS.StatusCallbackURL,
+			StatusCallbackToken: cfg.SMS.StatusCallbackToken,
+		},
+		PushConfig: services.PushConfig{
+			RedisURL:            redisURL,
+			RedisPassword:       redisPassword,
+			RedisDB:             redisDB,
+			Provider:            pushProvider,
+			Platforms:           pushPlatforms,
+			APIKey:              cfg.Push.APIKey,
+			APISecret:           cfg.Push.APISecret,
+			AppID:               cfg.Push.AppID,
+			ProjectID:           cfg.Push.ProjectID,
+			FirebaseCredentials: cfg.Push.FirebaseCredentials,
+			APNSKey:             cfg.Push.APNSKey,
+			APNSKeyID:           cfg.Push.APNSKeyID,
+			APNSTeamID:          cfg.Push.APNSTeamID,
+			APNSTopic:           cfg.Push.APNSTopic,
+			APNSSandbox:         cfg.Push.APNSSandbox,
+			BaseURL:             cfg.Push.BaseURL,
+			MaxRetries:          cfg.Push.MaxRetries,
+			RetryDelay:          cfg.Push.RetryDelay,
+			DryRun:              cfg.Push.DryRun,
+		},
+		InAppConfig: services.InAppConfig{
+			RedisURL:         redisURL,
+			RedisPassword:    redisPassword,
+			RedisDB:          redisDB,
+			TTL:              cfg.InApp.TTL,
+			MaxRetries:       cfg.InApp.MaxRetries,
+			BatchSize:        cfg.InApp.BatchSize,
+			EntityLinks:      cfg.InApp.EntityLinks,
+			OperationTimeout: cfg.InApp.OperationTimeout,
+
+			MaxAttachmentSize:     cfg.InApp.MaxAttachmentSize,
+			AttachmentURLTTL:      cfg.InApp.AttachmentURLTTL,
+			AttachmentS3Endpoint:  cfg.InApp.AttachmentS3Endpoint,
+			AttachmentS3Region:    cfg.InApp.AttachmentS3Region,
+			AttachmentS3AccessKey: cfg.InApp.AttachmentS3AccessKey,
+			AttachmentS3SecretKey: cfg.InApp.AttachmentS3SecretKey,
+		},
+		WebhookConfig: services.WebhookConfig{
+			RedisURL:                redisURL,
+			RedisPassword:           redisPassword,
+			RedisDB:                 redisDB,
+			MaxRetries:              cfg.Webhook.MaxRetries,
+			RetryDelay:              cfg.Webhook.RetryDelay,
+			MaxRetryDelay:           cfg.Webhook.MaxRetryDelay,
+			MaxRetryAge:             cfg.Webhook.MaxRetryAge,
+			DeliveryTTL:             cfg.Webhook.DeliveryTTL,
+			Timeout:                 cfg.Webhook.Timeout,
+			MaxPayload:              cfg.Webhook.MaxPayload,
+			SecretKey:               cfg.Webhook.SecretKey,
+			DryRun:                  cfg.Webhook.DryRun,
+			AllowPrivateNetworks:    cfg.Webhook.AllowPrivateNetworks,
+			DisableAfter:            cfg.Webhook.DisableAfter,
+			DisableMinFailures:      cfg.Webhook.DisableMinFailures,
+			MaxConcurrentDeliveries: cfg.Webhook.MaxConcurrent,
+		},
+		VoiceConfig: services.VoiceConfig{
+			Provider:    cfg.Voice.Provider,
+			APIKey:      cfg.Voice.APIKey,
+			APISecret:   cfg.Voice.APISecret,
+			FromNumber:  cfg.Voice.FromNumber,
+			BaseURL:     cfg.Voice.BaseURL,
+			CallbackURL: cfg.Voice.CallbackURL,
+			Language:    cfg.Voice.Language,
+			Voice:       cfg.Voice.Voice,
+			RingTimeout: cfg.Voice.RingTimeout,
+			DryRun:      cfg.Voice.DryRun,
 		},
-		{
-			"id":          "reminder",
-			"name":        "Reminder Template",
-			"type":        "sms",
-			"category":    "reminder",
-			"description": "SMS reminder for appointments",
+		TemplateConfig: services.TemplateConfig{
+			RedisURL:      redisURL,
+			RedisPassword: redisPassword,
+			RedisDB:       redisDB,
+			DefaultLocale: cfg.Template.DefaultLocale,
+			CacheTTL:      cfg.Template.CacheTTL,
+			MaxTemplates:  cfg.Template.MaxTemplates,
+			MaxOutputSize: cfg.Template.MaxOutputSize,
 		},
-		{
-			"id":          "alert",
-			"name":        "Alert Template",
-			"type":        "push",
-			"category":    "security",
-			"description": "Push notification for security alerts",
+		RecipientConfig: services.RecipientConfig{
+			RedisURL:       redisURL,
+			RedisPassword:  redisPassword,
+			RedisDB:        redisDB,
+			UserServiceURL: cfg.Recipient.UserServiceURL,
+			ServiceToken:   cfg.Recipient.ServiceToken,
+			Timeout:        cfg.Recipient.Timeout,
+			CacheTTL:       cfg.Recipient.CacheTTL,
+			MaxExpansion:   cfg.Recipient.MaxExpansion,
 		},
+		MaxRetries:         cfg.Notification.MaxRetries,
+		RetryDelay:         cfg.Notification.RetryDelay,
+		MaxRetryDelay:      cfg.Notification.MaxRetryDelay,
+		RetryBudgets:       cfg.Notification.RetryBudgets,
+		BatchSize:          cfg.Notification.BatchSize,
+		QueueSize:          cfg.Notification.QueueSize,
+		WorkerCount:        cfg.Notification.WorkerCount,
+		ChannelWorkers:     cfg.Notification.ChannelWorkers,
+		ChannelMaxInFlight: cfg.Notification.ChannelMaxInFlight,
+		DigestInterval:     cfg.Notification.DigestInterval,
+		DigestMaxItems:     cfg.Notification.DigestMaxItems,
+		CollapseWindow:     cfg.Notification.CollapseWindow,
+		CallbackSecret:     cfg.Notification.CallbackSecret,
+		CallbackTimeout:    cfg.Notification.CallbackTimeout,
+		CallbackMaxRetries: cfg.Notification.CallbackMaxRetries,
+		ProviderTimeout:    cfg.Notification.ProviderTimeout,
+		BreakerConfig: services.BreakerConfig{
+			Window:         cfg.Notification.BreakerWindow,
+			MinRequests:    cfg.Notification.BreakerMinRequests,
+			FailureRate:    float64(cfg.Notification.BreakerFailureRate) / 100,
+			OpenDuration:   cfg.Notification.BreakerOpenDuration,
+			HalfOpenProbes: cfg.Notification.BreakerHalfOpenProbes,
+		},
+		RetentionDays:      cfg.Notification.RetentionDays,
+		RetentionInterval:  cfg.Notification.RetentionInterval,
+		RetentionBatchSize: cfg.Notification.RetentionBatchSize,
+		CleanupInterval:    cfg.Notification.CleanupInterval,
+		Archiver:           archiver,
+		SnoozeInterval:     cfg.Notification.SnoozeInterval,
+		AckBaseURL:         cfg.Notification.AckBaseURL,
+		AckTTL:             cfg.Notification.AckTTL,
+		AckSecret:          cfg.Notification.AckSecret,
+		AckSMSKeyword:      cfg.Notification.AckSMSKeyword,
+		DisabledChannels:   cfg.DisabledChannels(),
+		PIIEncryptionKey:   cfg.Privacy.EncryptionKey,
+		LeaderLease:        cfg.Notification.LeaderLease,
+		OutboxConfig: services.OutboxConfig{
+			RedisURL:      cfg.Queue.RedisURL,
+			RedisPassword: cfg.Queue.RedisPassword,
+			RedisDB:       cfg.Queue.RedisDB,
+			Topic:         cfg.Queue.EventsTopic,
+			RetryAfter:    cfg.Queue.RetryAfter,
+		},
+		OTPConfig: services.OTPConfig{
+			Length:      cfg.Notification.OTPLength,
+			TTL:         cfg.Notification.OTPTTL,
+			MaxAttempts: cfg.Notification.OTPMaxAttempts,
+			RateLimit:   cfg.Notification.OTPRateLimit,
+			RateWindow:  cfg.Notification.OTPRateWindow,
+		},
+		Runtime: runtimeConfig,
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success":   true,
-		"templates": templates,
-		"total":     len(templates),
-	})
 }
 
-// getTemplate returns a specific template by ID
-func getTemplate(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Missing template ID",
-			"message": "Template ID is required",
+// newRuntimeConfig returns the store of the tunables operators change while
+// the service runs, nil when they keep their configured values
+func newRuntimeConfig(cfg *config.Config) (*runtimeconfig.Store, error) {
+	switch cfg.Runtime.Backend {
+	case "redis":
+		client, err := redisclient.New(redisclient.Config{
+			URL:      cfg.Redis.URL,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
 		})
-		return
-	}
-
-	// Simulate template lookup
-	template := gin.H{
-		"id":          id,
-		"name":        "Template " + id,
-		"type":        "email",
-		"category":    "general",
-		"description": "Template description for " + id,
-		"variables":   []string{"name", "company", "date"},
-		"created_at":  time.Now().Format(time.RFC3339),
+		if err != nil {
+			return nil, err
+		}
+		return runtimeconfig.New(runtimeconfig.NewRedisSource(client, "notification-service"), cfg.Runtime.PollInterval)
+	case "file":
+		return runtimeconfig.New(runtimeconfig.NewFileSource(cfg.Runtime.File), cfg.Runtime.PollInterval)
+	default:
+		return nil, nil
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success":  true,
-		"template": template,
-	})
 }
 
-// getNotificationStats returns notification statistics
-func getNotificationStats(c *gin.Context) {
-	stats := gin.H{
-		"total":        150,
-		"sent":         120,
-		"failed":       15,
-		"pending":      15,
-		"success_rate": 80.0,
-		"by_type": gin.H{
-			"email": 50,
-			"sms":   30,
-			"push":  40,
-			"inapp": 30,
-		},
-		"by_category": gin.H{
-			"general":    40,
-			"onboarding": 30,
-			"reminder":   35,
-			"security":   25,
-			"marketing":  20,
-		},
-		"period": "last_24_hours",
+// newArchiver returns the archive results are written to before the retention
+// job deletes them, nil when they are only deleted
+func newArchiver(cfg config.ArchiveConfig) (services.Archiver, error) {
+	switch cfg.Backend {
+	case "s3":
+		return services.NewS3Archiver(services.S3ArchiverConfig{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			Prefix:    cfg.S3Prefix,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	case "postgres":
+		db, err := sql.Open("postgres", cfg.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return services.NewPostgresArchiver(db, cfg.Table)
+	default:
+		return nil, nil
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"stats":   stats,
-	})
-}
-
-// generateID generates a unique ID
-func generateID() string {
-	return "notif_" + time.Now().Format("20060102150405") + "_" + time.Now().Format("000000000")
 }
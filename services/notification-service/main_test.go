@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"claude-talimat-notifications/internal/config"
+	"claude-talimat-notifications/internal/services"
+)
+
+func TestArchiveBackendsAreSelectedByConfig(t *testing.T) {
+	archiver, err := newArchiver(config.ArchiveConfig{Backend: "none"})
+	if archiver != nil || err != nil {
+		t.Errorf("Expected no archive without a backend, got %T %v", archiver, err)
+	}
+
+	archiver, err = newArchiver(config.ArchiveConfig{
+		Backend:     "s3",
+		S3Endpoint:  "https://s3.eu-central-1.amazonaws.com",
+		S3Bucket:    "talimat-archive",
+		S3AccessKey: "access-key",
+		S3SecretKey: "secret-key",
+	})
+	if _, ok := archiver.(*services.S3Archiver); !ok || err != nil {
+		t.Errorf("Expected an S3 archive, got %T %v", archiver, err)
+	}
+	if _, err := newArchiver(config.ArchiveConfig{Backend: "s3", S3Endpoint: "https://s3.eu-central-1.amazonaws.com"}); err == nil {
+		t.Errorf("Expected an S3 archive without a bucket to be rejected")
+	}
+
+	// The driver is linked in, so the archive fails on the database that isn't there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = newArchiver(config.ArchiveConfig{
+		Backend:     "postgres",
+		DatabaseURL: "postgres://talimat@" + addr + "/talimat?sslmode=disable&connect_timeout=1",
+	})
+	if err == nil || strings.Contains(err.Error(), "unknown driver") {
+		t.Errorf("Expected the Postgres archive to connect with its driver, got %v", err)
+	}
+}
+
+func TestTheLoadedConfigurationStartsTheServices(t *testing.T) {
+	redisURL := "redis://" + miniredis.RunT(t).Addr()
+	t.Setenv("REDIS_URL", redisURL)
+	t.Setenv("REDIS_DB", "2")
+	t.Setenv("JWT_SECRET", "test-jwt-secret")
+	t.Setenv("EMAIL_ENABLED", "false")
+	t.Setenv("EMAIL_PROVIDER", "sendgrid")
+	t.Setenv("PUSH_ENABLED", "false")
+	t.Setenv("PUSH_PROVIDER", "fcm")
+	t.Setenv("SMS_ENABLED", "false")
+	t.Setenv("PROVIDER_BREAKER_FAILURE_RATE", "25")
+	t.Setenv("RUNTIME_CONFIG_BACKEND", "none")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	t.Cleanup(func() { cfg.SecretManager().Close() })
+
+	notificationCfg := notificationConfig(cfg, nil, nil)
+	for name, db := range map[string]int{
+		"sms":      notificationCfg.SMSConfig.RedisDB,
+		"push":     notificationCfg.PushConfig.RedisDB,
+		"inapp":    notificationCfg.InAppConfig.RedisDB,
+		"webhook":  notificationCfg.WebhookConfig.RedisDB,
+		"template": notificationCfg.TemplateConfig.RedisDB,
+	} {
+		if db != 2 {
+			t.Errorf("Expected the %s service to use the configured Redis database, got %d", name, db)
+		}
+	}
+	if notificationCfg.BreakerConfig.FailureRate != 0.25 {
+		t.Errorf("Expected the failure rate in percent to be a fraction, got %v", notificationCfg.BreakerConfig.FailureRate)
+	}
+
+	// Disabled channels start without the credentials of their providers
+	if notificationCfg.EmailConfig.Provider != services.EmailProviderSMTP || notificationCfg.PushConfig.Provider != services.PushProviderWebPush {
+		t.Errorf("Expected disabled channels to need no credentials, got %s and %s", notificationCfg.EmailConfig.Provider, notificationCfg.PushConfig.Provider)
+	}
+	notificationService, err := services.NewNotificationService(notificationCfg)
+	if err != nil {
+		t.Fatalf("Failed to start the notification service: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	notificationService.Shutdown(ctx)
+}
@@ -7,6 +7,9 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+
+	"claude-talimat/pkg/redisclient"
+	"claude-talimat/pkg/types"
 )
 
 // MessageQueueIntegration handles message queue operations for notifications
@@ -16,39 +19,28 @@ type MessageQueueIntegration struct {
 	service string
 }
 
-// NotificationMessage represents a notification message in the queue
-type NotificationMessage struct {
-	ID        string                 `json:"id"`
-	Type      string                 `json:"type"`
-	Recipient string                 `json:"recipient"`
-	Title     string                 `json:"title"`
-	Message   string                 `json:"message"`
-	Priority  string                 `json:"priority"`
-	Category  string                 `json:"category"`
-	Data      map[string]interface{} `json:"data,omitempty"`
-	Schedule  *time.Time             `json:"schedule,omitempty"`
-}
-
 // NewMessageQueueIntegration creates a new message queue integration
-func NewMessageQueueIntegration(redisURL string) *MessageQueueIntegration {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisURL,
-		Password: "",
-		DB:       1, // Use DB 1 for message queue
+func NewMessageQueueIntegration(redisURL string) (*MessageQueueIntegration, error) {
+	rdb, err := redisclient.New(redisclient.Config{
+		URL: redisURL,
+		DB:  1, // Use DB 1 for message queue
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &MessageQueueIntegration{
 		rdb:     rdb,
 		ctx:     context.Background(),
 		service: "notification-service",
-	}
+	}, nil
 }
 
 // PublishNotification publishes a notification to the message queue
-func (mq *MessageQueueIntegration) PublishNotification(notification NotificationMessage) error {
+func (mq *MessageQueueIntegration) PublishNotification(notification types.NotificationMessage) error {
 	// Convert notification to message queue format
 	message := map[string]interface{}{
-		"topic": "notifications",
+		"topic": types.TopicNotifications,
 		"payload": map[string]interface{}{
 			"type":      notification.Type,
 			"recipient": notification.Recipient,
@@ -59,7 +51,7 @@ func (mq *MessageQueueIntegration) PublishNotification(notification Notification
 			"data":      notification.Data,
 			"schedule":  notification.Schedule,
 		},
-		"priority":    mq.getPriorityValue(notification.Priority),
+		"priority":    types.PriorityValue(notification.Priority),
 		"max_retries": 3,
 		"metadata": map[string]interface{}{
 			"created_by": mq.service,
@@ -74,12 +66,12 @@ func (mq *MessageQueueIntegration) PublishNotification(notification Notification
 	}
 
 	// Add to Redis Stream
-	streamKey := "mq:topic:notifications"
+	streamKey := types.StreamKey(types.TopicNotifications)
 	args := &redis.XAddArgs{
 		Stream: streamKey,
 		Values: map[string]interface{}{
 			"message":  string(messageData),
-			"priority": mq.getPriorityValue(notification.Priority),
+			"priority": types.PriorityValue(notification.Priority),
 		},
 	}
 
@@ -93,7 +85,7 @@ func (mq *MessageQueueIntegration) PublishNotification(notification Notification
 }
 
 // PublishBulkNotifications publishes multiple notifications
-func (mq *MessageQueueIntegration) PublishBulkNotifications(notifications []NotificationMessage) error {
+func (mq *MessageQueueIntegration) PublishBulkNotifications(notifications []types.NotificationMessage) error {
 	for _, notification := range notifications {
 		if err := mq.PublishNotification(notification); err != nil {
 			log.Printf("Failed to publish notification: %v", err)
@@ -104,9 +96,9 @@ func (mq *MessageQueueIntegration) PublishBulkNotifications(notifications []Noti
 }
 
 // ConsumeNotifications consumes notifications from the queue
-func (mq *MessageQueueIntegration) ConsumeNotifications(consumerName string, count int64) ([]NotificationMessage, error) {
-	streamKey := "mq:topic:notifications"
-	consumerGroup := "mq:group:notifications"
+func (mq *MessageQueueIntegration) ConsumeNotifications(consumerName string, count int64) ([]types.NotificationMessage, error) {
+	streamKey := types.StreamKey(types.TopicNotifications)
+	consumerGroup := types.GroupKey(types.TopicNotifications)
 
 	// Create consumer group if it doesn't exist
 	_, err := mq.rdb.XGroupCreateMkStream(mq.ctx, streamKey, consumerGroup, "0").Result()
@@ -126,12 +118,12 @@ func (mq *MessageQueueIntegration) ConsumeNotifications(consumerName string, cou
 	streams, err := mq.rdb.XReadGroup(mq.ctx, args).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return []NotificationMessage{}, nil
+			return []types.NotificationMessage{}, nil
 		}
 		return nil, err
 	}
 
-	var notifications []NotificationMessage
+	var notifications []types.NotificationMessage
 	for _, stream := range streams {
 		for _, message := range stream.Messages {
 			var msg map[string]interface{}
@@ -140,7 +132,7 @@ func (mq *MessageQueueIntegration) ConsumeNotifications(consumerName string, cou
 			}
 
 			payload := msg["payload"].(map[string]interface{})
-			notification := NotificationMessage{
+			notification := types.NotificationMessage{
 				ID:        message.ID,
 				Type:      payload["type"].(string),
 				Recipient: payload["recipient"].(string),
@@ -164,8 +156,8 @@ func (mq *MessageQueueIntegration) ConsumeNotifications(consumerName string, cou
 
 // AcknowledgeNotification acknowledges a processed notification
 func (mq *MessageQueueIntegration) AcknowledgeNotification(messageID, consumerName string) error {
-	streamKey := "mq:topic:notifications"
-	consumerGroup := "mq:group:notifications"
+	streamKey := types.StreamKey(types.TopicNotifications)
+	consumerGroup := types.GroupKey(types.TopicNotifications)
 
 	_, err := mq.rdb.XAck(mq.ctx, streamKey, consumerGroup, messageID).Result()
 	if err != nil {
@@ -178,8 +170,8 @@ func (mq *MessageQueueIntegration) AcknowledgeNotification(messageID, consumerNa
 
 // NegativeAcknowledgeNotification negatively acknowledges a notification
 func (mq *MessageQueueIntegration) NegativeAcknowledgeNotification(messageID, consumerName string, retry bool) error {
-	streamKey := "mq:topic:notifications"
-	consumerGroup := "mq:group:notifications"
+	streamKey := types.StreamKey(types.TopicNotifications)
+	consumerGroup := types.GroupKey(types.TopicNotifications)
 
 	if retry {
 		// Claim message for retry
@@ -203,7 +195,7 @@ func (mq *MessageQueueIntegration) NegativeAcknowledgeNotification(messageID, co
 		}
 
 		// Move to dead letter queue
-		deadLetterKey := "mq:dlq:notifications"
+		deadLetterKey := types.DeadLetterKey(types.TopicNotifications)
 		mq.rdb.XAdd(mq.ctx, &redis.XAddArgs{
 			Stream: deadLetterKey,
 			Values: map[string]interface{}{
@@ -218,22 +210,6 @@ func (mq *MessageQueueIntegration) NegativeAcknowledgeNotification(messageID, co
 	return nil
 }
 
-// getPriorityValue converts priority string to numeric value
-func (mq *MessageQueueIntegration) getPriorityValue(priority string) int {
-	switch priority {
-	case "urgent":
-		return 9
-	case "high":
-		return 7
-	case "normal":
-		return 5
-	case "low":
-		return 3
-	default:
-		return 5
-	}
-}
-
 // Close closes the Redis connection
 func (mq *MessageQueueIntegration) Close() error {
 	return mq.rdb.Close()
@@ -242,11 +218,15 @@ func (mq *MessageQueueIntegration) Close() error {
 // Example usage in the notification service
 func ExampleUsage() {
 	// Initialize message queue integration
-	mq := NewMessageQueueIntegration("redis:6379")
+	mq, err := NewMessageQueueIntegration("redis://redis:6379")
+	if err != nil {
+		log.Printf("Failed to connect to the message queue: %v", err)
+		return
+	}
 	defer mq.Close()
 
 	// Publish a notification
-	notification := NotificationMessage{
+	notification := types.NotificationMessage{
 		Type:      "email",
 		Recipient: "user@example.com",
 		Title:     "Welcome",
@@ -74,7 +74,8 @@ type NotificationTemplate struct {
 	UpdatedAt   time.Time              `json:"updated_at" db:"updated_at"`
 }
 
-// NotificationSubscription represents a user's notification preferences
+// NotificationSubscription represents a contact point of a user: the
+// addresses notifications reach them at and what they want to get there
 type NotificationSubscription struct {
 	ID                string                 `json:"id" db:"id"`
 	UserID            string                 `json:"user_id" db:"user_id"`
@@ -86,6 +87,9 @@ type NotificationSubscription struct {
 	EmailAddress      *string                `json:"email_address,omitempty" db:"email_address"`
 	PhoneNumber       *string                `json:"phone_number,omitempty" db:"phone_number"`
 	PushToken         *string                `json:"push_token,omitempty" db:"push_token"`
+	// Addresses are only sent to once verified, changing one unverifies it
+	EmailVerifiedAt   *time.Time             `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	PhoneVerifiedAt   *time.Time             `json:"phone_verified_at,omitempty" db:"phone_verified_at"`
 	Categories        []string               `json:"categories" db:"categories"`
 	Frequency         string                 `json:"frequency" db:"frequency"`
 	QuietHours        *QuietHours            `json:"quiet_hours,omitempty" db:"quiet_hours"`
@@ -102,26 +106,45 @@ type QuietHours struct {
 	Timezone  string `json:"timezone"`
 }
 
-// NotificationSettings represents global notification settings
+// NotificationSettings represents the notification settings of a tenant.
+// Zero values keep the defaults of the service configuration, durations are
+// in seconds.
 type NotificationSettings struct {
 	ID                    string                 `json:"id" db:"id"`
 	TenantID              string                 `json:"tenant_id" db:"tenant_id"`
 	DefaultEmailTemplate  *string                `json:"default_email_template,omitempty" db:"default_email_template"`
 	DefaultSMSTemplate    *string                `json:"default_sms_template,omitempty" db:"default_sms_template"`
 	DefaultPushTemplate   *string                `json:"default_push_template,omitempty" db:"default_push_template"`
+	// MaxRetries is the number of delivery attempts, RetryDelay the base delay
+	// of the backoff between them
 	MaxRetries            int                    `json:"max_retries" db:"max_retries"`
 	RetryDelay            int                    `json:"retry_delay" db:"retry_delay"`
 	BatchSize             int                    `json:"batch_size" db:"batch_size"`
+	// QueueTimeout is how long a queued delivery may wait past its due time,
+	// DefaultTTL when notifications without an expiry expire
 	QueueTimeout          int                    `json:"queue_timeout" db:"queue_timeout"`
 	DefaultTTL            int                    `json:"default_ttl" db:"default_ttl"`
+	// Sends of the tenant beyond a rate limit are rejected
 	RateLimitPerMinute    int                    `json:"rate_limit_per_minute" db:"rate_limit_per_minute"`
 	RateLimitPerHour      int                    `json:"rate_limit_per_hour" db:"rate_limit_per_hour"`
 	RateLimitPerDay       int                    `json:"rate_limit_per_day" db:"rate_limit_per_day"`
+	// Non-urgent sends outside the delivery window wait for it to open
+	DeliveryWindow        *DeliveryWindow        `json:"delivery_window,omitempty" db:"delivery_window"`
 	Metadata              map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
 	CreatedAt             time.Time              `json:"created_at" db:"created_at"`
 	UpdatedAt             time.Time              `json:"updated_at" db:"updated_at"`
 }
 
+// DeliveryWindow is the time of day the non-urgent notifications of a tenant
+// are sent in, in the local time of their recipient
+type DeliveryWindow struct {
+	Start      string   `json:"start"`                // Format: "HH:MM"
+	End        string   `json:"end"`                  // Format: "HH:MM", before Start for windows over midnight
+	Days       []int    `json:"days,omitempty"`       // 0=Sunday, every day when empty
+	Categories []string `json:"categories,omitempty"` // every category when empty
+	Timezone   string   `json:"timezone,omitempty"`   // of recipients without one of their own
+}
+
 // Request/Response models
 
 // SendNotificationRequest represents a request to send a notification
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+
+	"claude-talimat-notifications/internal/api"
+	"claude-talimat-notifications/internal/config"
+	"claude-talimat-notifications/internal/services"
+	"claude-talimat/pkg/redisclient"
+)
+
+// newTestRouter returns the router of the service on miniredis
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	redisURL := "redis://" + miniredis.RunT(t).Addr()
+	t.Setenv("REDIS_URL", redisURL)
+	t.Setenv("JWT_SECRET", "test-jwt-secret")
+	t.Setenv("NOTIFICATION_API_KEYS", "scheduler=test-api-key")
+	t.Setenv("SMS_ENABLED", "false")
+	t.Setenv("PUSH_ENABLED", "false")
+	t.Setenv("RUNTIME_CONFIG_BACKEND", "none")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	t.Cleanup(func() { cfg.SecretManager().Close() })
+
+	notificationService, err := services.NewNotificationService(notificationConfig(cfg, nil, nil))
+	if err != nil {
+		t.Fatalf("Failed to create notification service: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		notificationService.Shutdown(ctx)
+	})
+
+	idempotencyService, err := services.NewIdempotencyService(services.IdempotencyConfig{RedisURL: redisURL})
+	if err != nil {
+		t.Fatalf("Failed to create idempotency service: %v", err)
+	}
+	privacyService, err := services.NewPrivacyService(services.PrivacyConfig{RedisURL: redisURL}, notificationService)
+	if err != nil {
+		t.Fatalf("Failed to create privacy service: %v", err)
+	}
+	campaignService, err := services.NewCampaignService(services.CampaignConfig{RedisURL: redisURL}, notificationService)
+	if err != nil {
+		t.Fatalf("Failed to create campaign service: %v", err)
+	}
+	onCallService, err := services.NewOnCallService(services.OnCallConfig{RedisURL: redisURL}, notificationService)
+	if err != nil {
+		t.Fatalf("Failed to create on-call service: %v", err)
+	}
+	healthRedis, err := redisclient.New(redisclient.Config{URL: redisURL})
+	if err != nil {
+		t.Fatalf("Failed to create Redis client: %v", err)
+	}
+
+	return newRouter(cfg, apiServices{
+		notifications: notificationService,
+		idempotency:   idempotencyService,
+		privacy:       privacyService,
+		campaigns:     campaignService,
+		onCall:        onCallService,
+		healthRedis:   healthRedis,
+	})
+}
+
+func TestEveryHandlerIsMountedOnBothVersions(t *testing.T) {
+	router := newTestRouter(t)
+
+	mounted := make(map[string]bool)
+	for _, route := range router.Routes() {
+		mounted[route.Method+" "+route.Path] = true
+	}
+
+	// A route of every handler, the campaign, in-app and webhook ones with
+	// all their CRUD routes
+	for _, route := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/notifications/send"},
+		{http.MethodGet, "/ack/:token"},
+		{http.MethodGet, "/contact-points"},
+		{http.MethodGet, "/email/suppressions"},
+		{http.MethodGet, "/sms/settings"},
+		{http.MethodGet, "/admin/queues"},
+		{http.MethodGet, "/campaigns/"},
+		{http.MethodPost, "/campaigns/"},
+		{http.MethodPut, "/campaigns/:id"},
+		{http.MethodDelete, "/campaigns/:id"},
+		{http.MethodGet, "/categories"},
+		{http.MethodPost, "/devices"},
+		{http.MethodGet, "/inapp/notifications"},
+		{http.MethodPost, "/inapp/notifications/:id/read"},
+		{http.MethodDelete, "/inapp/notifications/:id"},
+		{http.MethodGet, "/maintenance/windows"},
+		{http.MethodGet, "/oncall/schedules"},
+		{http.MethodPost, "/otp/send"},
+		{http.MethodGet, "/privacy/users/:user_id/export"},
+		{http.MethodGet, "/retention/policy"},
+		{http.MethodGet, "/admin/runtime-config"},
+		{http.MethodGet, "/sandbox"},
+		{http.MethodGet, "/settings"},
+		{http.MethodGet, "/templates/"},
+		{http.MethodPost, "/voice/status/:provider"},
+		{http.MethodGet, "/webhooks/"},
+		{http.MethodPost, "/webhooks/"},
+		{http.MethodPut, "/webhooks/:id"},
+		{http.MethodDelete, "/webhooks/:id"},
+	} {
+		for _, version := range []string{"/api/v1", "/api/v2"} {
+			if !mounted[route.method+" "+version+route.path] {
+				t.Errorf("Expected %s %s%s to be mounted", route.method, version, route.path)
+			}
+		}
+	}
+}
+
+func TestEveryPrivateRouteRequiresCredentials(t *testing.T) {
+	router := newTestRouter(t)
+
+	// Routes called by recipients and providers, which authenticate with
+	// their token or signature instead
+	public := map[string]bool{
+		"GET /ack/:token":                    true,
+		"POST /ack/:token":                   true,
+		"GET /contact-points/confirm/:token": true,
+		"GET /sms/status/:provider":          true,
+		"POST /sms/status/:provider":         true,
+		"GET /sms/inbound/:provider":         true,
+		"POST /sms/inbound/:provider":        true,
+		"POST /email/feedback/:provider":     true,
+		"POST /voice/status/:provider":       true,
+		"POST /voice/keypress/:provider":     true,
+	}
+
+	params := regexp.MustCompile(`[:*](\w+)`)
+	checked := 0
+	for _, route := range router.Routes() {
+		version, path, found := strings.Cut(strings.TrimPrefix(route.Path, "/api/"), "/")
+		if !strings.HasPrefix(route.Path, "/api/") || !found {
+			continue
+		}
+		if public[route.Method+" /"+path] {
+			continue
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(route.Method, "/api/"+version+"/"+params.ReplaceAllString(path, "$1"), nil))
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s %s to require credentials, got %d", route.Method, route.Path, recorder.Code)
+		}
+		checked++
+	}
+	if checked == 0 {
+		t.Fatalf("Expected private routes to be mounted")
+	}
+}
+
+func TestOnlySendsAreIdempotent(t *testing.T) {
+	router := newTestRouter(t)
+
+	replayed := func(method string, path string, body string) bool {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(api.APIKeyHeader, "test-api-key")
+		req.Header.Set(api.TenantHeader, "tenant-a")
+		req.Header.Set(api.IdempotencyKeyHeader, "key-1")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Header().Get("Idempotent-Replayed") == "true"
+	}
+
+	send := `{"type":"inapp","category":"safety","recipient_id":"user-1","title":"Tatbikat","message":"Saat 14.00"}`
+	for _, version := range []string{"/api/v1", "/api/v2"} {
+		replayed(http.MethodPost, version+"/notifications/send", send)
+		if !replayed(http.MethodPost, version+"/notifications/send", send) {
+			t.Errorf("Expected the retried send of %s to be replayed", version)
+		}
+
+		replayed(http.MethodGet, version+"/notifications/history", "")
+		if replayed(http.MethodGet, version+"/notifications/history", "") {
+			t.Errorf("Expected reads of %s not to be replayed", version)
+		}
+	}
+}
+
+func TestExportsAreStreamedOutsideTheEnvelope(t *testing.T) {
+	router := newTestRouter(t)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(api.APIKeyHeader, "test-api-key")
+		req.Header.Set(api.TenantHeader, "tenant-a")
+		req.Header.Set(api.IdempotencyKeyHeader, "key-1")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	send := `{"type":"inapp","category":"safety","recipient_id":"user-1","title":"Tatbikat","message":"Saat 14.00"}`
+	if recorder := serve(http.MethodPost, "/api/v2/notifications/send", send); recorder.Code != http.StatusOK {
+		t.Fatalf("Failed to send: %d %s", recorder.Code, recorder.Body)
+	}
+
+	for i := 0; i < 2; i++ {
+		recorder := serve(http.MethodGet, "/api/v2/inapp/export?format=json&user_id=user-1", "")
+
+		var exported []map[string]interface{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &exported); err != nil || len(exported) != 1 {
+			t.Fatalf("Expected the export to be a bare array of the notification, got %s", recorder.Body)
+		}
+		if status := recorder.Result().Trailer.Get(api.ExportStatusTrailer); status != "complete" {
+			t.Errorf("Expected the export to end with a complete status, got %q", status)
+		}
+		if recorder.Header().Get("Idempotent-Replayed") != "" {
+			t.Errorf("Expected the export not to be replayed")
+		}
+	}
+
+	// Failures before the stream starts are still in the envelope
+	recorder := serve(http.MethodGet, "/api/v2/inapp/export?format=xml&user_id=user-1", "")
+	var failure struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &failure); err != nil || recorder.Code != http.StatusBadRequest || failure.Error.Code == "" {
+		t.Errorf("Expected the invalid export to fail in the envelope, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestInboxAndStatusRoutesAreServed(t *testing.T) {
+	router := newTestRouter(t)
+
+	serve := func(method string, path string, body string, out interface{}) int {
+		req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(api.APIKeyHeader, "test-api-key")
+		req.Header.Set(api.TenantHeader, "tenant-a")
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if out != nil {
+			if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+				t.Fatalf("Failed to decode %s %s: %s", method, path, recorder.Body)
+			}
+		}
+		return recorder.Code
+	}
+
+	var sent struct {
+		NotificationID string `json:"notification_id"`
+	}
+	send := `{"type":"inapp","category":"safety","recipient_id":"user-1","title":"Tatbikat","message":"Saat 14.00"}`
+	if code := serve(http.MethodPost, "/notifications/send", send, &sent); code != http.StatusOK {
+		t.Fatalf("Failed to send: %d", code)
+	}
+
+	var inbox struct {
+		Data struct {
+			Notifications []struct {
+				ID string `json:"id"`
+			} `json:"notifications"`
+		} `json:"data"`
+	}
+	serve(http.MethodGet, "/inapp/notifications?user_id=user-1", "", &inbox)
+	if len(inbox.Data.Notifications) != 1 {
+		t.Fatalf("Expected the inbox to hold the notification, got %+v", inbox.Data.Notifications)
+	}
+	inboxPath := "/inapp/notifications/" + inbox.Data.Notifications[0].ID + "?user_id=user-1"
+
+	unread := func() int64 {
+		var response struct {
+			Data struct {
+				UnreadCount int64 `json:"unread_count"`
+			} `json:"data"`
+		}
+		serve(http.MethodGet, "/inapp/notifications/unread-count?user_id=user-1", "", &response)
+		return response.Data.UnreadCount
+	}
+	if count := unread(); count != 1 {
+		t.Errorf("Expected the notification to be unread, got %d", count)
+	}
+	readPath := "/inapp/notifications/" + inbox.Data.Notifications[0].ID + "/read?user_id=user-1"
+	if code := serve(http.MethodPost, readPath, "", nil); code != http.StatusOK {
+		t.Errorf("Failed to mark the notification as read: %d", code)
+	}
+	if count := unread(); count != 0 {
+		t.Errorf("Expected the notification to be read, got %d unread", count)
+	}
+	if code := serve(http.MethodGet, "/inapp/stats?user_id=user-1", "", nil); code != http.StatusOK {
+		t.Errorf("Failed to get the stats of the inbox: %d", code)
+	}
+	if code := serve(http.MethodDelete, inboxPath, "", nil); code != http.StatusOK {
+		t.Errorf("Failed to delete the notification: %d", code)
+	}
+	serve(http.MethodGet, "/inapp/notifications?user_id=user-1", "", &inbox)
+	if len(inbox.Data.Notifications) != 0 {
+		t.Errorf("Expected the deleted notification to leave the inbox, got %+v", inbox.Data.Notifications)
+	}
+
+	var history struct {
+		Data struct {
+			Total int64 `json:"total"`
+		} `json:"data"`
+	}
+	serve(http.MethodGet, "/notifications/history", "", &history)
+	if history.Data.Total != 1 {
+		t.Errorf("Expected the history to hold the send, got %d", history.Data.Total)
+	}
+
+	var timeline struct {
+		Data services.NotificationTimeline `json:"data"`
+	}
+	serve(http.MethodGet, "/notifications/"+sent.NotificationID+"/timeline", "", &timeline)
+	if timeline.Data.NotificationID != sent.NotificationID || len(timeline.Data.Events) == 0 {
+		t.Errorf("Expected the timeline of the send, got %+v", timeline.Data)
+	}
+
+	var batch struct {
+		Data struct {
+			Summary struct {
+				Found    int `json:"found"`
+				NotFound int `json:"not_found"`
+			} `json:"summary"`
+		} `json:"data"`
+	}
+	serve(http.MethodPost, "/notifications/status-batch", `{"ids":["`+sent.NotificationID+`","missing"]}`, &batch)
+	if batch.Data.Summary.Found != 1 || batch.Data.Summary.NotFound != 1 {
+		t.Errorf("Expected the batch to find the send only, got %+v", batch.Data.Summary)
+	}
+}
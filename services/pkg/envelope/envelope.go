@@ -0,0 +1,250 @@
+// Package envelope serves version 2 of the service APIs, where every JSON
+// response has the same shape: the resource under data, pagination and
+// messages under meta and failures under error. The handlers of version 1
+// are reused, the middleware rewrites what they answer.
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response is the body of every JSON response of version 2
+type Response struct {
+	Data  interface{}            `json:"data"`
+	Meta  map[string]interface{} `json:"meta,omitempty"`
+	Error *Error                 `json:"error,omitempty"`
+}
+
+// Error describes why a request failed
+type Error struct {
+	Code    string      `json:"code"`
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Pagination is the position of a page in a listing
+type Pagination struct {
+	Page       int  `json:"page"`
+	Limit      int  `json:"limit"`
+	Total      int  `json:"total"`
+	TotalPages int  `json:"total_pages"`
+	HasMore    bool `json:"has_more"`
+}
+
+// errorCodes are the codes of failures whose body doesn't carry one
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "invalid_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "validation_failed",
+	http.StatusTooManyRequests:     "rate_limited",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+// recorderKey is the context key the recorder of a request is kept under
+const recorderKey = "envelope.recorder"
+
+// recorder holds the response of the handlers back so it can be rewritten,
+// unless a handler streams it
+type recorder struct {
+	gin.ResponseWriter
+	body      *bytes.Buffer
+	streaming bool
+}
+
+func (w *recorder) Write(data []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *recorder) WriteString(data string) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.WriteString(data)
+	}
+	return w.body.WriteString(data)
+}
+
+// Stream lets a handler write its response straight to the client, like a
+// large export that must not be held in memory. It isn't wrapped in the
+// envelope, so it is called once the handler knows it won't fail with a
+// problem. Without the middleware it does nothing.
+func Stream(c *gin.Context) {
+	value, _ := c.Get(recorderKey)
+	if rec, ok := value.(*recorder); ok {
+		rec.streaming = true
+	}
+}
+
+// Middleware wraps the JSON responses of the handlers after it in the
+// envelope. It must run before middleware that can reject a request, so
+// their failures are wrapped too. Other responses, like HTML pages, are left
+// as they are, and streamed ones are passed through as they are written.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := c.Writer
+		rec := &recorder{ResponseWriter: writer, body: &bytes.Buffer{}}
+		c.Writer = rec
+		c.Set(recorderKey, rec)
+
+		c.Next()
+
+		c.Writer = writer
+		if rec.streaming {
+			return
+		}
+		body := rec.body.Bytes()
+		status := writer.Status()
+
+		if len(body) == 0 || !strings.Contains(writer.Header().Get("Content-Type"), "json") {
+			writer.Write(body)
+			return
+		}
+
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			writer.Write(body)
+			return
+		}
+
+		var response Response
+		if status >= http.StatusBadRequest {
+			response = failure(status, decoded)
+		} else {
+			response = success(decoded)
+		}
+
+		wrapped, err := json.Marshal(response)
+		if err != nil {
+			writer.Write(body)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writer.Write(wrapped)
+	}
+}
+
+// Deprecated marks the responses of a version as deprecated, pointing
+// clients to the version replacing it
+func Deprecated(successor string) gin.HandlerFunc {
+	link := "<" + successor + ">; rel=\"successor-version\""
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", link)
+		c.Next()
+	}
+}
+
+// success wraps a successful response. Objects with a data field keep it as
+// the data and move their other fields to meta, other objects are the data
+// themselves but for their message and success flag.
+func success(decoded interface{}) Response {
+	object, ok := decoded.(map[string]interface{})
+	if !ok {
+		return Response{Data: decoded}
+	}
+	delete(object, "success")
+
+	meta := map[string]interface{}{}
+	var data interface{}
+	if value, ok := object["data"]; ok {
+		delete(object, "data")
+		for key, field := range object {
+			meta[key] = field
+		}
+		data = value
+	} else {
+		if message, ok := object["message"]; ok {
+			meta["message"] = message
+			delete(object, "message")
+		}
+		data = object
+	}
+
+	// Listings answer their items and pagination together, the items are the data
+	if listing, ok := data.(map[string]interface{}); ok {
+		if page, ok := listing["pagination"].(map[string]interface{}); ok {
+			meta["pagination"] = pagination(page)
+			delete(listing, "pagination")
+			if len(listing) == 1 {
+				for _, items := range listing {
+					data = items
+				}
+			}
+		}
+	}
+	if page, ok := meta["pagination"].(map[string]interface{}); ok {
+		meta["pagination"] = pagination(page)
+	}
+
+	if len(meta) == 0 {
+		meta = nil
+	}
+	return Response{Data: data, Meta: meta}
+}
+
+// failure wraps a failed response, either an RFC 7807 problem or an object
+// with an error title and a message
+func failure(status int, decoded interface{}) Response {
+	object, _ := decoded.(map[string]interface{})
+
+	failure := &Error{Status: status}
+	if code, ok := object["code"].(string); ok {
+		failure.Code = code
+	} else if code, ok := errorCodes[status]; ok {
+		failure.Code = code
+	} else {
+		failure.Code = "internal_error"
+	}
+
+	for _, key := range []string{"detail", "message", "title", "error"} {
+		if message, ok := object[key].(string); ok && message != "" {
+			failure.Message = message
+			break
+		}
+	}
+	if failure.Message == "" {
+		failure.Message = http.StatusText(status)
+	}
+
+	details := map[string]interface{}{}
+	for _, key := range []string{"errors", "retry_after"} {
+		if value, ok := object[key]; ok {
+			details[key] = value
+		}
+	}
+	if len(details) > 0 {
+		failure.Details = details
+	}
+
+	return Response{Error: failure}
+}
+
+// pagination standardizes the pagination of a listing
+func pagination(page map[string]interface{}) Pagination {
+	number := func(key string) int {
+		value, _ := page[key].(float64)
+		return int(value)
+	}
+
+	result := Pagination{
+		Page:       number("page"),
+		Limit:      number("limit"),
+		Total:      number("total"),
+		TotalPages: number("total_pages"),
+	}
+	if result.TotalPages == 0 && result.Limit > 0 {
+		result.TotalPages = (result.Total + result.Limit - 1) / result.Limit
+	}
+	result.HasMore = result.Page < result.TotalPages
+	return result
+}
@@ -0,0 +1,285 @@
+// Package events is the catalogue of the events the services exchange
+// through the message queue. Every event type has a Go struct and a version,
+// the JSON Schema of each is derived from its struct, and producers and
+// consumers validate payloads against it so they don't drift apart silently.
+package events
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"claude-talimat/pkg/types"
+)
+
+// Event types
+const (
+	TypeNotificationRequested    = "notification.requested"
+	TypeNotificationStatus       = "notification.status"
+	TypeNotificationAcknowledged = "notification.acknowledged"
+	TypeNotificationAction       = "notification.action"
+	TypeNotificationEscalated    = "notification.escalated"
+	TypeSMSOptedOut              = "sms.opted_out"
+	TypeProviderCircuitOpened    = "provider.circuit_opened"
+	TypeProviderCircuitClosed    = "provider.circuit_closed"
+	TypeEscalationTriggered      = "escalation.triggered"
+	TypeEscalationAcknowledged   = "escalation.acknowledged"
+	TypeEscalationResolved       = "escalation.resolved"
+	TypeEscalationExhausted      = "escalation.exhausted"
+	TypeWebhookFailed            = "webhook.failed"
+	TypeIncidentRaised           = "incident.raised"
+)
+
+// Envelope is the payload of a message of the events topic, the event data
+// is described by the definition of its type
+type Envelope struct {
+	ID        string                 `json:"id" binding:"required"`
+	Type      string                 `json:"type" binding:"required"`
+	Version   int                    `json:"version,omitempty"` // 0 for the latest version
+	Source    string                 `json:"source" binding:"required"`
+	Data      map[string]interface{} `json:"data" binding:"required"`
+	Timestamp time.Time              `json:"timestamp" binding:"required"`
+	UserID    string                 `json:"user_id,omitempty"`
+	TenantID  string                 `json:"tenant_id,omitempty"`
+	Priority  string                 `json:"priority,omitempty" enum:"low,normal,high,urgent"`
+}
+
+// NotificationRequested asks the notification service to send a
+// notification, it is the payload of a message of the notifications topic.
+// Who it goes to and what it says are checked by the notification service, as
+// they can come from a template.
+type NotificationRequested struct {
+	ID           string                 `json:"id,omitempty"`
+	Type         string                 `json:"type" binding:"required" enum:"email,sms,push,inapp,webhook,voice,all"`
+	Recipient    string                 `json:"recipient,omitempty"`
+	Recipients   []string               `json:"recipients,omitempty"`
+	Subject      string                 `json:"subject,omitempty"`
+	Title        string                 `json:"title,omitempty"`
+	Message      string                 `json:"message,omitempty"`
+	TextBody     string                 `json:"text_body,omitempty"`
+	HTMLBody     string                 `json:"html_body,omitempty"`
+	TemplateID   string                 `json:"template_id,omitempty"`
+	TemplateData map[string]interface{} `json:"template_data,omitempty"`
+	Priority     string                 `json:"priority,omitempty" enum:"low,normal,high,urgent"`
+	Category     string                 `json:"category,omitempty"`
+	TenantID     string                 `json:"tenant_id,omitempty"`
+	UserID       string                 `json:"user_id,omitempty"`
+	CallbackURL  string                 `json:"callback_url,omitempty" format:"uri"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Schedule     *time.Time             `json:"schedule,omitempty"`
+	ScheduleAt   *time.Time             `json:"schedule_at,omitempty"`
+	ExpiresAt    *time.Time             `json:"expires_at,omitempty"`
+}
+
+// NotificationStatus reports a notification reached a final status
+type NotificationStatus struct {
+	NotificationID string `json:"notification_id" binding:"required"`
+	RequestID      string `json:"request_id,omitempty"`
+	Type           string `json:"type" binding:"required"`
+	Recipient      string `json:"recipient,omitempty"`
+	Status         string `json:"status" binding:"required" enum:"sent,delivered,failed,suppressed,cancelled"`
+	MessageID      string `json:"message_id,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Attempts       int    `json:"attempts,omitempty"`
+}
+
+// NotificationAcknowledged reports a recipient confirmed receipt
+type NotificationAcknowledged struct {
+	DocumentID     string    `json:"document_id,omitempty"`
+	RequestID      string    `json:"request_id" binding:"required"`
+	Channel        string    `json:"channel,omitempty"`
+	AcknowledgedAt time.Time `json:"acknowledged_at" binding:"required"`
+}
+
+// NotificationAction reports a recipient responded to an action of a
+// notification
+type NotificationAction struct {
+	NotificationID string    `json:"notification_id" binding:"required"`
+	Category       string    `json:"category,omitempty"`
+	ActionID       string    `json:"action_id" binding:"required"`
+	ActionLabel    string    `json:"action_label,omitempty"`
+	RespondedAt    time.Time `json:"responded_at" binding:"required"`
+}
+
+// SMSReply reports a recipient answered an SMS with a keyword
+type SMSReply struct {
+	RequestID string `json:"request_id,omitempty"`
+	ResultID  string `json:"result_id,omitempty"`
+	From      string `json:"from" binding:"required"`
+	Keyword   string `json:"keyword,omitempty"`
+	Body      string `json:"body,omitempty"`
+}
+
+// ProviderCircuit reports the circuit breaker of a provider opened or closed
+type ProviderCircuit struct {
+	Provider    string     `json:"provider" binding:"required"`
+	State       string     `json:"state" binding:"required" enum:"closed,open,half_open"`
+	FailureRate float64    `json:"failure_rate,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	RetryAt     *time.Time `json:"retry_at,omitempty"`
+}
+
+// Escalation reports an on-call escalation changed status
+type Escalation struct {
+	EscalationID string `json:"escalation_id" binding:"required"`
+	PolicyID     string `json:"policy_id,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Status       string `json:"status" binding:"required" enum:"triggered,acknowledged,resolved,exhausted"`
+	Level        int    `json:"level,omitempty"`
+	Round        int    `json:"round,omitempty"`
+	Source       string `json:"source,omitempty"`
+}
+
+// WebhookFailed reports a webhook delivery was given up on
+type WebhookFailed struct {
+	EndpointID string `json:"endpoint_id" binding:"required"`
+	DeliveryID string `json:"delivery_id" binding:"required"`
+	Event      string `json:"event,omitempty"` // type of the event the delivery carried
+	URL        string `json:"url,omitempty" format:"uri"`
+	Error      string `json:"error,omitempty"`
+	Attempts   int    `json:"attempts,omitempty"`
+}
+
+// IncidentRaised reports an occupational safety incident was recorded
+type IncidentRaised struct {
+	IncidentID   string    `json:"incident_id" binding:"required"`
+	Title        string    `json:"title,omitempty"`
+	IncidentType string    `json:"incident_type,omitempty"`
+	Severity     string    `json:"severity" binding:"required" enum:"low,medium,high,critical"`
+	Location     string    `json:"location,omitempty"`
+	ReportedBy   string    `json:"reported_by,omitempty"`
+	OccurredAt   time.Time `json:"occurred_at" binding:"required"`
+	TenantID     string    `json:"tenant_id,omitempty"`
+}
+
+// Definition describes a version of an event type
+type Definition struct {
+	Type        string  `json:"type"`
+	Version     int     `json:"version"`
+	Topic       string  `json:"topic"`
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+// catalogue holds the definitions of every event type, by type and version.
+// A change that breaks consumers adds a version instead of changing one.
+var catalogue = map[string][]Definition{}
+
+func init() {
+	define(TypeNotificationRequested, 1, types.TopicNotifications, "A notification is requested", NotificationRequested{})
+	define(TypeNotificationStatus, 1, types.TopicNotificationEvents, "A notification reached a final status", NotificationStatus{})
+	define(TypeNotificationAcknowledged, 1, types.TopicNotificationEvents, "A recipient confirmed receipt of a notification", NotificationAcknowledged{})
+	define(TypeNotificationAction, 1, types.TopicNotificationEvents, "A recipient responded to an action of a notification", NotificationAction{})
+	define(TypeNotificationEscalated, 1, types.TopicNotificationEvents, "A recipient asked for help in an SMS reply", SMSReply{})
+	define(TypeSMSOptedOut, 1, types.TopicNotificationEvents, "A recipient opted out of SMS in a reply", SMSReply{})
+	define(TypeProviderCircuitOpened, 1, types.TopicNotificationEvents, "A provider failed too often and is no longer used", ProviderCircuit{})
+	define(TypeProviderCircuitClosed, 1, types.TopicNotificationEvents, "A provider recovered and is used again", ProviderCircuit{})
+	define(TypeEscalationTriggered, 1, types.TopicNotificationEvents, "An on-call escalation was triggered", Escalation{})
+	define(TypeEscalationAcknowledged, 1, types.TopicNotificationEvents, "An on-call escalation was acknowledged", Escalation{})
+	define(TypeEscalationResolved, 1, types.TopicNotificationEvents, "An on-call escalation was resolved", Escalation{})
+	define(TypeEscalationExhausted, 1, types.TopicNotificationEvents, "Every level of an on-call escalation was paged and nobody acknowledged", Escalation{})
+	define(TypeWebhookFailed, 1, types.TopicNotificationEvents, "A webhook delivery was given up on", WebhookFailed{})
+	define(TypeIncidentRaised, 1, types.TopicNotificationEvents, "An occupational safety incident was recorded", IncidentRaised{})
+}
+
+// define adds a version of an event type to the catalogue, with the schema
+// of value
+func define(eventType string, version int, topic string, description string, value interface{}) {
+	schema := SchemaOf(value)
+	schema.ID = fmt.Sprintf("https://talimat/events/%s/v%d.json", eventType, version)
+	schema.Title = eventType
+	schema.Description = description
+
+	definitions := append(catalogue[eventType], Definition{
+		Type:        eventType,
+		Version:     version,
+		Topic:       topic,
+		Description: description,
+		Schema:      schema,
+	})
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Version < definitions[j].Version })
+	catalogue[eventType] = definitions
+}
+
+// All returns the definitions of the catalogue, by type and version
+func All() []Definition {
+	var definitions []Definition
+	for _, versions := range catalogue {
+		definitions = append(definitions, versions...)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		if definitions[i].Type != definitions[j].Type {
+			return definitions[i].Type < definitions[j].Type
+		}
+		return definitions[i].Version < definitions[j].Version
+	})
+	return definitions
+}
+
+// Lookup returns a version of an event type, version 0 returns the latest
+func Lookup(eventType string, version int) (Definition, bool) {
+	versions := catalogue[eventType]
+	if len(versions) == 0 {
+		return Definition{}, false
+	}
+	if version == 0 {
+		return versions[len(versions)-1], true
+	}
+	for _, definition := range versions {
+		if definition.Version == version {
+			return definition, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Latest returns the latest version of an event type, 0 when it is unknown
+func Latest(eventType string) int {
+	definition, _ := Lookup(eventType, 0)
+	return definition.Version
+}
+
+// envelopeSchema is the schema of the payloads of the events topic
+var envelopeSchema = SchemaOf(Envelope{})
+
+// Validate checks the data of an event against a version of its type
+func Validate(eventType string, version int, data map[string]interface{}) error {
+	definition, ok := Lookup(eventType, version)
+	if !ok {
+		return &ValidationError{Event: eventType, Version: version, Problems: []string{"unknown event type or version"}}
+	}
+	if problems := definition.Schema.Check(data); len(problems) > 0 {
+		return &ValidationError{Event: eventType, Version: definition.Version, Problems: problems}
+	}
+	return nil
+}
+
+// ValidateEvent checks the payload of a message of the events topic, the
+// envelope and the event data in it
+func ValidateEvent(payload map[string]interface{}) error {
+	if problems := envelopeSchema.Check(payload); len(problems) > 0 {
+		eventType, _ := payload["type"].(string)
+		return &ValidationError{Event: eventType, Problems: problems}
+	}
+
+	version := 0
+	if value, ok := toNumber(payload["version"]); ok {
+		version = int(value)
+	}
+	return Validate(payload["type"].(string), version, payload["data"].(map[string]interface{}))
+}
+
+// ValidateMessage checks the payload of a message published to topic.
+// Payloads of the notifications topic are notification requests, those of
+// the events topic envelopes. Other topics aren't in the catalogue and are
+// not checked.
+func ValidateMessage(topic string, payload map[string]interface{}) error {
+	switch topic {
+	case types.TopicNotifications:
+		return Validate(TypeNotificationRequested, 0, payload)
+	case types.TopicNotificationEvents:
+		return ValidateEvent(payload)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListHandler lists the definitions of the catalogue with their schemas
+func ListHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		definitions := All()
+		c.JSON(http.StatusOK, gin.H{
+			"events": definitions,
+			"count":  len(definitions),
+		})
+	}
+}
+
+// SchemaHandler returns the JSON Schema of the event type in the type path
+// parameter, of its latest version unless the version query asks for another
+func SchemaHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eventType := c.Param("type")
+
+		version := 0
+		if value := c.Query("version"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid version",
+					"message": fmt.Sprintf("version must be a positive number, got %s", value),
+				})
+				return
+			}
+			version = parsed
+		}
+
+		definition, ok := Lookup(eventType, version)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Event type not found",
+				"message": fmt.Sprintf("no schema for %s", eventType),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, definition.Schema)
+	}
+}
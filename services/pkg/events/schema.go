@@ -0,0 +1,231 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaDialect is the JSON Schema version the schemas are written in
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema the catalogue describes events with.
+// Properties not in a schema are allowed, so producers can add fields before
+// consumers know them.
+type Schema struct {
+	Dialect     string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"` // empty for any value
+	Format      string             `json:"format,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+}
+
+// ValidationError lists why a payload doesn't match the schema of its event
+type ValidationError struct {
+	Event    string   `json:"event"`
+	Version  int      `json:"version,omitempty"`
+	Problems []string `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	event := e.Event
+	if event == "" {
+		event = "event"
+	}
+	if e.Version > 0 {
+		event = fmt.Sprintf("%s v%d", event, e.Version)
+	}
+	return fmt.Sprintf("%s is invalid: %s", event, strings.Join(e.Problems, "; "))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf derives the schema of a struct from its fields. The json tag
+// names a property, `binding:"required"` makes it required, an enum tag lists
+// the values it may take and a format tag sets its format.
+func SchemaOf(value interface{}) *Schema {
+	schema := schemaOfType(reflect.TypeOf(value))
+	schema.Dialect = schemaDialect
+	return schema
+}
+
+func schemaOfType(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOfType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" || !field.IsExported() {
+				continue
+			}
+
+			property := schemaOfType(field.Type)
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property.Enum = strings.Split(enum, ",")
+			}
+			if format := field.Tag.Get("format"); format != "" {
+				property.Format = format
+			}
+			schema.Properties[name] = property
+			if strings.Contains(field.Tag.Get("binding"), "required") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	}
+	return &Schema{}
+}
+
+// Check returns what is wrong with a value decoded from JSON, nothing when
+// it matches the schema
+func (s *Schema) Check(value interface{}) []string {
+	var problems []string
+	s.check("", value, &problems)
+	return problems
+}
+
+func (s *Schema) check(path string, value interface{}, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		name := path
+		if name == "" {
+			name = "payload"
+		}
+		*problems = append(*problems, name+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch s.Type {
+	case "":
+		return
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, text) {
+			fail("must be one of %s", strings.Join(s.Enum, ", "))
+		}
+		switch s.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				fail("must be an RFC 3339 date-time")
+			}
+		case "uri":
+			if parsed, err := url.Parse(text); text != "" && (err != nil || !parsed.IsAbs()) {
+				fail("must be an absolute URI")
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be a boolean")
+		}
+	case "integer":
+		number, ok := toNumber(value)
+		if !ok || number != math.Trunc(number) {
+			fail("must be an integer")
+		}
+	case "number":
+		if _, ok := toNumber(value); !ok {
+			fail("must be a number")
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		for _, name := range s.Required {
+			if object[name] == nil {
+				fail("%s is required", name)
+			}
+		}
+
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			// Optional properties may be null, like a field without a value
+			if property, ok := object[name]; ok && property != nil {
+				s.Properties[name].check(join(path, name), property, problems)
+			}
+		}
+	}
+}
+
+// toNumber returns a JSON number as a float
+func toNumber(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case json.Number:
+		parsed, err := number.Float64()
+		return parsed, err == nil
+	}
+	return 0, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+// Package health answers the health checks of the services.
+package health
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Health statuses
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+)
+
+// checkTimeout bounds how long a dependency may take to answer a health check
+const checkTimeout = 2 * time.Second
+
+var startTime = time.Now()
+
+// Response represents health check response
+type Response struct {
+	Status    string `json:"status"`
+	Service   string `json:"service"`
+	Timestamp int64  `json:"timestamp"`
+	Version   string `json:"version"`
+	Uptime    string `json:"uptime"`
+	Redis     string `json:"redis_status,omitempty"` // only for services given a Redis client
+}
+
+// Handler reports a service healthy while its Redis answers, redisClient may
+// be nil for services that don't depend on one. Unhealthy services answer
+// 503 so orchestrators take them out of rotation.
+func Handler(service string, version string, redisClient *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		response := Response{
+			Status:    StatusHealthy,
+			Service:   service,
+			Timestamp: time.Now().Unix(),
+			Version:   version,
+			Uptime:    time.Since(startTime).String(),
+		}
+
+		if redisClient != nil {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+			defer cancel()
+
+			response.Redis = StatusHealthy
+			if err := redisClient.Ping(ctx).Err(); err != nil {
+				response.Redis = StatusUnhealthy
+				response.Status = StatusUnhealthy
+			}
+		}
+
+		statusCode := http.StatusOK
+		if response.Status != StatusHealthy {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		c.JSON(statusCode, response)
+	}
+}
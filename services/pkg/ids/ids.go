@@ -0,0 +1,11 @@
+// Package ids generates the IDs of the records the services store.
+package ids
+
+import "github.com/google/uuid"
+
+// New returns a unique ID prefixed with the kind of what it identifies.
+// The UUIDv7 behind it is random from crypto/rand and sorts by creation
+// time, so IDs created in the same instant never collide.
+func New(prefix string) string {
+	return prefix + "_" + uuid.Must(uuid.NewV7()).String()
+}
@@ -0,0 +1,134 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Elector elects one replica of a service as its leader. The leader holds a
+// lease it renews; when it stops renewing, another replica takes over once
+// the lease expired. A nil Elector always leads, so services run without one.
+type Elector struct {
+	client *redis.Client
+	name   string
+	ttl    time.Duration
+
+	mu     sync.RWMutex
+	lock   *Lock
+	leader bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewElector starts campaigning for the leadership of name with a lease of
+// ttl. Losing the leadership takes up to ttl to notice, so leaders should
+// check IsLeader before each piece of work.
+func NewElector(client *redis.Client, name string, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+
+	elector := &Elector{
+		client: client,
+		name:   name,
+		ttl:    ttl,
+		done:   make(chan struct{}),
+	}
+
+	var ctx context.Context
+	ctx, elector.cancel = context.WithCancel(context.Background())
+	go elector.campaign(ctx)
+
+	return elector
+}
+
+// IsLeader reports whether this replica leads
+func (e *Elector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Close stops campaigning and hands the leadership over right away
+func (e *Elector) Close() {
+	if e == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lock != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := e.lock.Release(ctx); err != nil {
+			log.Warn().Err(err).Str("name", e.name).Msg("Failed to resign leadership")
+		}
+		e.lock = nil
+		e.leader = false
+	}
+}
+
+// campaign renews the lease while leading and tries to take it otherwise
+func (e *Elector) campaign(ctx context.Context) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.renew(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) renew(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lock != nil {
+		err := e.lock.Refresh(ctx)
+		if err == nil {
+			return
+		}
+		// A lease that can't be renewed may have expired, stop leading
+		// before another replica starts
+		log.Warn().Err(err).Str("name", e.name).Msg("Lost leadership")
+		e.lock = nil
+		e.leader = false
+	}
+
+	lock, err := Acquire(ctx, e.client, e.getLeaderKey(), e.ttl)
+	if err != nil {
+		if err != ErrLocked && ctx.Err() == nil {
+			log.Warn().Err(err).Str("name", e.name).Msg("Failed to campaign for leadership")
+		}
+		return
+	}
+
+	log.Info().Str("name", e.name).Msg("Elected leader")
+	e.lock = lock
+	e.leader = true
+}
+
+// Redis key generators
+func (e *Elector) getLeaderKey() string {
+	return "leader:" + e.name
+}
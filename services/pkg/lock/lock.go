@@ -0,0 +1,148 @@
+// Package lock coordinates the replicas of a service through Redis: locks
+// let one replica at a time do a piece of work, leader election lets one
+// replica run the background loops that must not run twice.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/ids"
+)
+
+// ErrLocked is returned when another holder has the lock
+var ErrLocked = errors.New("lock is held by another holder")
+
+// ErrNotHeld is returned when a lock expired or was taken over before it was
+// refreshed or released
+var ErrNotHeld = errors.New("lock is not held")
+
+// Scripts compare the token so holders only touch a lock they still own
+var (
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+	refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Lock is a lock on a Redis key that expires unless it is refreshed, so a
+// crashed holder can't keep it forever
+type Lock struct {
+	client *redis.Client
+	key    string
+	token  string
+	ttl    time.Duration
+}
+
+// Acquire takes the lock on key for ttl, or returns ErrLocked
+func Acquire(ctx context.Context, client *redis.Client, key string, ttl time.Duration) (*Lock, error) {
+	token := ids.New("lock")
+
+	acquired, err := client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if !acquired {
+		return nil, ErrLocked
+	}
+
+	return &Lock{
+		client: client,
+		key:    key,
+		token:  token,
+		ttl:    ttl,
+	}, nil
+}
+
+// Key returns the key of the lock
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Refresh extends the lock by its ttl, or returns ErrNotHeld when it was lost
+func (l *Lock) Refresh(ctx context.Context) error {
+	refreshed, err := refreshScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to refresh lock %s: %w", l.key, err)
+	}
+	if refreshed == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Release gives the lock up, or returns ErrNotHeld when it was lost already
+func (l *Lock) Release(ctx context.Context) error {
+	released, err := releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Int()
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", l.key, err)
+	}
+	if released == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Do runs fn while holding the lock on key, refreshing it so work taking
+// longer than ttl keeps it. The context of fn is cancelled when the lock is
+// lost, and ErrLocked is returned without running fn when it is held.
+func Do(ctx context.Context, client *redis.Client, key string, ttl time.Duration, fn func(ctx context.Context)) error {
+	lock, err := Acquire(ctx, client, key, ttl)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lock.keepAlive(ctx, cancel)
+	}()
+
+	fn(ctx)
+
+	cancel()
+	<-done
+
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer releaseCancel()
+	if err := lock.Release(releaseCtx); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Failed to release lock")
+	}
+	return nil
+}
+
+// keepAlive refreshes the lock until ctx is done, calling lost when it
+// can't be refreshed anymore
+func (l *Lock) keepAlive(ctx context.Context, lost func()) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("key", l.key).Msg("Lost lock")
+			lost()
+			return
+		}
+	}
+}
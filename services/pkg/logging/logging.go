@@ -0,0 +1,38 @@
+// Package logging sets up the structured logs of the services.
+package logging
+
+import (
+	stdlog "log"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"claude-talimat/pkg/secrets"
+)
+
+// Setup makes the global logger write JSON lines tagged with the service at
+// the given level, info when it is empty or unknown. LOG_FORMAT=console
+// switches to human-readable output for development. Messages of the
+// standard library logger go through the same logger. Registered secrets are
+// redacted from every line.
+func Setup(service string, level string) {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil || level == "" {
+		parsed = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(parsed)
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+
+	var logger zerolog.Logger
+	if os.Getenv("LOG_FORMAT") == "console" {
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: secrets.NewRedactingWriter(os.Stderr), TimeFormat: time.RFC3339})
+	} else {
+		logger = zerolog.New(secrets.NewRedactingWriter(os.Stdout))
+	}
+	log.Logger = logger.With().Timestamp().Str("service", service).Logger()
+
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.Logger)
+}
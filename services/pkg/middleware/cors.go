@@ -0,0 +1,41 @@
+// Package middleware holds the gin middleware every service runs.
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsHeaders are the request headers browsers may send to the services
+var corsHeaders = []string{
+	"Origin",
+	"Content-Type",
+	"Content-Length",
+	"Accept-Encoding",
+	"X-CSRF-Token",
+	"Authorization",
+	"X-API-Key",
+	"X-Tenant-ID",
+	"Idempotency-Key",
+}
+
+// CORS lets browsers call the services from any origin and answers their
+// preflight requests
+func CORS() gin.HandlerFunc {
+	allowedHeaders := strings.Join(corsHeaders, ", ")
+
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", allowedHeaders)
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+// Package redisclient creates the Redis clients of the services.
+package redisclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// connectTimeout bounds the ping that checks a new client can connect
+const connectTimeout = 5 * time.Second
+
+// Config holds Redis connection configuration
+type Config struct {
+	URL      string // redis://[:password@]host:port[/db]
+	Password string // Overrides the password of the URL
+	DB       int    // Overrides the database of the URL
+}
+
+// New creates a Redis client and checks it can connect
+func New(config Config) (*redis.Client, error) {
+	// Parse Redis URL
+	redisOpts, err := redis.ParseURL(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+
+	// Override with config values
+	if config.Password != "" {
+		redisOpts.Password = config.Password
+	}
+	if config.DB != 0 {
+		redisOpts.DB = config.DB
+	}
+
+	// Create Redis client
+	redisClient := redis.NewClient(redisOpts)
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		redisClient.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return redisClient, nil
+}
@@ -0,0 +1,256 @@
+// Package runtimeconfig holds the tunables operators change while the services
+// run, like worker counts, batch sizes, rate limits and paused channels.
+// Values are strings keyed by dotted names; services read them through typed
+// getters with the default of their static configuration.
+package runtimeconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrReadOnly is returned when values are set on a source that can't store them
+var ErrReadOnly = errors.New("runtime configuration is read-only")
+
+// Source loads the runtime configuration of a service
+type Source interface {
+	Load(ctx context.Context) (map[string]string, error)
+}
+
+// Watcher is a source that announces changes, so they apply before the
+// next poll. Watch calls changed for every change until ctx is done.
+type Watcher interface {
+	Watch(ctx context.Context, changed func())
+}
+
+// Writer is a source operators can change values through
+type Writer interface {
+	// Set stores values, an empty value removes its key so the default
+	// applies again
+	Set(ctx context.Context, values map[string]string) error
+}
+
+// Store holds the current runtime configuration and keeps it up to date. A
+// nil Store returns the defaults, so services run without one.
+type Store struct {
+	source   Source
+	interval time.Duration
+
+	mu        sync.RWMutex
+	values    map[string]string
+	listeners []func()
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New loads the runtime configuration of a source and reloads it every
+// interval, and whenever a watching source announces a change
+func New(source Source, interval time.Duration) (*Store, error) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	values, err := source.Load(ctx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load runtime configuration: %w", err)
+	}
+
+	store := &Store{
+		source:   source,
+		interval: interval,
+		values:   values,
+		done:     make(chan struct{}),
+	}
+
+	var watchCtx context.Context
+	watchCtx, store.cancel = context.WithCancel(context.Background())
+	go store.watch(watchCtx)
+
+	return store, nil
+}
+
+// Close stops reloading the configuration
+func (s *Store) Close() {
+	if s == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// OnChange registers a function called after a reload changed any value
+func (s *Store) OnChange(fn func()) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.listeners = append(s.listeners, fn)
+	s.mu.Unlock()
+}
+
+// Values returns a copy of every value set
+func (s *Store) Values() map[string]string {
+	values := make(map[string]string)
+	if s == nil {
+		return values
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, value := range s.values {
+		values[key] = value
+	}
+	return values
+}
+
+// Set stores values through the source and applies them right away
+func (s *Store) Set(ctx context.Context, values map[string]string) error {
+	if s == nil {
+		return ErrReadOnly
+	}
+	writer, ok := s.source.(Writer)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	if err := writer.Set(ctx, values); err != nil {
+		return err
+	}
+	return s.Reload(ctx)
+}
+
+// Reload loads the configuration again, calling the change listeners when
+// any value changed
+func (s *Store) Reload(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	values, err := s.source.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load runtime configuration: %w", err)
+	}
+
+	s.mu.Lock()
+	changed := !reflect.DeepEqual(values, s.values)
+	s.values = values
+	listeners := append([]func(){}, s.listeners...)
+	s.mu.Unlock()
+
+	if changed {
+		log.Info().Interface("values", values).Msg("Runtime configuration changed")
+		for _, listener := range listeners {
+			listener()
+		}
+	}
+	return nil
+}
+
+// String returns the value of a key, or def when it isn't set
+func (s *Store) String(key string, def string) string {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
+	return def
+}
+
+// Int returns the integer value of a key, or def when it isn't set or
+// isn't an integer
+func (s *Store) Int(key string, def int) int {
+	if value, ok := s.lookup(key); ok {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Warn().Str("key", key).Str("value", value).Msg("Runtime configuration value is not an integer")
+	}
+	return def
+}
+
+// Float returns the number value of a key, or def when it isn't set or isn't
+// a number
+func (s *Store) Float(key string, def float64) float64 {
+	if value, ok := s.lookup(key); ok {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+		log.Warn().Str("key", key).Str("value", value).Msg("Runtime configuration value is not a number")
+	}
+	return def
+}
+
+// Bool returns the boolean value of a key, or def when it isn't set or isn't
+// a boolean
+func (s *Store) Bool(key string, def bool) bool {
+	if value, ok := s.lookup(key); ok {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+		log.Warn().Str("key", key).Str("value", value).Msg("Runtime configuration value is not a boolean")
+	}
+	return def
+}
+
+// Duration returns the duration value of a key, like 30s or 5m, or def when
+// it isn't set or isn't a duration
+func (s *Store) Duration(key string, def time.Duration) time.Duration {
+	if value, ok := s.lookup(key); ok {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Warn().Str("key", key).Str("value", value).Msg("Runtime configuration value is not a duration")
+	}
+	return def
+}
+
+func (s *Store) lookup(key string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	return value, ok && value != ""
+}
+
+// watch reloads the configuration every interval and on announced changes
+func (s *Store) watch(ctx context.Context) {
+	defer close(s.done)
+
+	changed := make(chan struct{}, 1)
+	if watcher, ok := s.source.(Watcher); ok {
+		go watcher.Watch(ctx, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+
+		reloadCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := s.Reload(reloadCtx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("Failed to reload runtime configuration")
+		}
+		cancel()
+	}
+}
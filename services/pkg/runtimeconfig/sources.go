@@ -0,0 +1,120 @@
+package runtimeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisSource keeps the runtime configuration of a service in a Redis hash
+// and announces changes on a channel of the same name, so every instance
+// applies them at once. Operators change values through the admin API of the
+// service, or with HSET followed by PUBLISH.
+type RedisSource struct {
+	redis *redis.Client
+	key   string
+}
+
+// NewRedisSource creates a source keeping the configuration of a service in
+// the hash runtime_config:<service>
+func NewRedisSource(redisClient *redis.Client, service string) *RedisSource {
+	return &RedisSource{
+		redis: redisClient,
+		key:   Key(service),
+	}
+}
+
+// Key returns the Redis hash and channel of the runtime configuration of a service
+func Key(service string) string {
+	return fmt.Sprintf("runtime_config:%s", service)
+}
+
+// Load returns every value of the hash
+func (s *RedisSource) Load(ctx context.Context) (map[string]string, error) {
+	values, err := s.redis.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Set stores values in the hash and announces the change
+func (s *RedisSource) Set(ctx context.Context, values map[string]string) error {
+	pipe := s.redis.TxPipeline()
+	for key, value := range values {
+		if value == "" {
+			pipe.HDel(ctx, s.key, key)
+		} else {
+			pipe.HSet(ctx, s.key, key, value)
+		}
+	}
+	pipe.Publish(ctx, s.key, "changed")
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store runtime configuration: %w", err)
+	}
+	return nil
+}
+
+// Watch calls changed for every announcement on the channel of the hash. The
+// subscription reconnects by itself when Redis goes away.
+func (s *RedisSource) Watch(ctx context.Context, changed func()) {
+	pubsub := s.redis.Subscribe(ctx, s.key)
+	go func() {
+		<-ctx.Done()
+		pubsub.Close()
+	}()
+
+	for range pubsub.Channel() {
+		changed()
+	}
+}
+
+// FileSource reads the runtime configuration from a JSON object of a file,
+// for deployments that mount it from a config map. Changes to the file are
+// picked up by the next poll.
+type FileSource struct {
+	path string
+}
+
+// NewFileSource creates a source reading the JSON object of a file
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Load reads the file, a missing file is an empty configuration. Numbers
+// and booleans are turned into the strings the getters parse.
+func (s *FileSource) Load(ctx context.Context) (map[string]string, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value := value.(type) {
+		case string:
+			values[key] = value
+		case bool:
+			values[key] = strconv.FormatBool(value)
+		case float64:
+			values[key] = strconv.FormatFloat(value, 'f', -1, 64)
+		case nil:
+		default:
+			return nil, fmt.Errorf("%s: value of %s must be a string, number or boolean", s.path, key)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AWSConfig holds the settings of AWS Secrets Manager
+type AWSConfig struct {
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // for temporary credentials
+	Endpoint     string // overrides https://secretsmanager.<region>.amazonaws.com
+	Timeout      time.Duration
+}
+
+// AWSProvider fetches secrets from AWS Secrets Manager. Secrets stored as a
+// JSON object have its fields, any other secret the single field "".
+type AWSProvider struct {
+	config AWSConfig
+	client *http.Client
+}
+
+// NewAWSProvider creates a provider reading secrets from AWS Secrets Manager
+func NewAWSProvider(config AWSConfig) (*AWSProvider, error) {
+	if config.Region == "" {
+		return nil, fmt.Errorf("AWS region is required")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("AWS credentials are required")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", config.Region)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	Register(config.SecretKey, config.SessionToken)
+
+	return &AWSProvider{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns the name of the provider
+func (p *AWSProvider) Name() string {
+	return "aws"
+}
+
+// Fetch reads the current version of a secret
+func (p *AWSProvider) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": path})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.config.Endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Secrets Manager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, payload, time.Now().UTC())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Secrets Manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("Secrets Manager returned status %d: %s", resp.StatusCode, string(message))
+	}
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode Secrets Manager response: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(body.SecretString), &raw); err == nil {
+		return stringFields(raw), nil
+	}
+	return map[string]string{"": body.SecretString}, nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to a request
+func (p *AWSProvider) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.config.SessionToken)
+	}
+
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"x-amz-target:" + req.Header.Get("X-Amz-Target") + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + p.config.Region + "/secretsmanager/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+p.config.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, p.config.Region)
+	signingKey = hmacSHA256(signingKey, "secretsmanager")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.config.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in logs and error messages
+const Redacted = "[REDACTED]"
+
+// minRedactLength keeps short values like "1" or "on" from being redacted
+// from every message they happen to appear in
+const minRedactLength = 6
+
+var (
+	redactMu       sync.RWMutex
+	redactValues   = make(map[string]bool)
+	redactReplacer = strings.NewReplacer()
+)
+
+// Register marks values as secrets, so Redact removes them. Values are also
+// removed in the escaped form they take inside JSON log lines.
+func Register(values ...string) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+
+	added := false
+	for _, value := range values {
+		if len(value) < minRedactLength || redactValues[value] {
+			continue
+		}
+		redactValues[value] = true
+		added = true
+	}
+	if !added {
+		return
+	}
+
+	// Longer secrets go first, so one containing another is redacted whole
+	sorted := make([]string, 0, len(redactValues))
+	for value := range redactValues {
+		sorted = append(sorted, value)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	var pairs []string
+	for _, value := range sorted {
+		pairs = append(pairs, value, Redacted)
+		if escaped, err := json.Marshal(value); err == nil {
+			if escaped := string(escaped[1 : len(escaped)-1]); escaped != value {
+				pairs = append(pairs, escaped, Redacted)
+			}
+		}
+	}
+	redactReplacer = strings.NewReplacer(pairs...)
+}
+
+// Redact returns s with every registered secret replaced
+func Redact(s string) string {
+	redactMu.RLock()
+	replacer := redactReplacer
+	redactMu.RUnlock()
+	return replacer.Replace(s)
+}
+
+// NewRedactingWriter returns a writer that redacts registered secrets from
+// what is written to w, for the output of loggers
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w: w}
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	// Callers check that everything they passed was written
+	return len(p), nil
+}
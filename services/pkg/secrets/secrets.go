@@ -0,0 +1,221 @@
+// Package secrets resolves credentials kept in a secret store, HashiCorp
+// Vault or AWS Secrets Manager, and keeps them out of logs and error messages.
+// Settings name a secret with a reference like
+// secret:notification/smtp#password, the field password of the secret
+// notification/smtp. Every other value is used as it is.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// referencePrefix starts the values that name a secret instead of holding it
+const referencePrefix = "secret:"
+
+// Provider fetches secrets from a secret store. A secret holds named fields,
+// a secret stored as a plain string has the single field "".
+type Provider interface {
+	Name() string
+	Fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+// IsReference reports whether a value names a secret
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, referencePrefix)
+}
+
+// parseReference splits a reference into the path and field of the secret
+func parseReference(reference string) (path string, field string, err error) {
+	path = strings.TrimPrefix(reference, referencePrefix)
+	if i := strings.LastIndex(path, "#"); i >= 0 {
+		path, field = path[:i], path[i+1:]
+	}
+	if path == "" {
+		return "", "", fmt.Errorf("secret reference %q names no secret", reference)
+	}
+	return path, field, nil
+}
+
+// Manager resolves secret references and refreshes the secrets it resolved,
+// so rotated credentials are picked up without a restart. A Manager without
+// a provider passes values through and rejects references.
+type Manager struct {
+	provider Provider
+	interval time.Duration
+
+	mu        sync.RWMutex
+	secrets   map[string]map[string]string // path -> fields
+	listeners []func()
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewManager creates a manager fetching secrets from a provider and fetching
+// them again every interval, never when interval is zero
+func NewManager(provider Provider, interval time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := &Manager{
+		provider: provider,
+		interval: interval,
+		secrets:  make(map[string]map[string]string),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	if provider != nil && interval > 0 {
+		go manager.refreshLoop(ctx)
+	} else {
+		close(manager.done)
+	}
+	return manager
+}
+
+// Close stops refreshing secrets
+func (m *Manager) Close() {
+	m.cancel()
+	<-m.done
+}
+
+// OnChange registers a function called after a refresh changed any secret
+func (m *Manager) OnChange(fn func()) {
+	m.mu.Lock()
+	m.listeners = append(m.listeners, fn)
+	m.mu.Unlock()
+}
+
+// Resolve returns the secret a reference names, or the value itself when it
+// is no reference. Resolved secrets are redacted from now on, and fetched
+// once until the next refresh.
+func (m *Manager) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	if m.provider == nil {
+		return "", fmt.Errorf("secret reference %q needs a secrets backend", value)
+	}
+
+	path, field, err := parseReference(value)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.RLock()
+	fields, ok := m.secrets[path]
+	m.mu.RUnlock()
+
+	if !ok {
+		fields, err = m.provider.Fetch(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch secret %s from %s: %w", path, m.provider.Name(), err)
+		}
+		for _, secret := range fields {
+			Register(secret)
+		}
+
+		m.mu.Lock()
+		m.secrets[path] = fields
+		m.mu.Unlock()
+	}
+
+	return secretField(path, field, fields)
+}
+
+// secretField returns a field of a secret. Without a field the secret must
+// have a single one.
+func secretField(path string, field string, fields map[string]string) (string, error) {
+	if field == "" && len(fields) == 1 {
+		for _, secret := range fields {
+			return secret, nil
+		}
+	}
+
+	secret, ok := fields[field]
+	if !ok {
+		if field == "" {
+			return "", fmt.Errorf("secret %s has several fields, name one with %s#<field>", path, path)
+		}
+		return "", fmt.Errorf("secret %s has no field %s", path, field)
+	}
+	return secret, nil
+}
+
+// Refresh fetches every secret resolved so far again, calling the change
+// listeners when any of them changed. Secrets that fail to fetch keep their
+// last value.
+func (m *Manager) Refresh(ctx context.Context) error {
+	if m.provider == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	paths := make([]string, 0, len(m.secrets))
+	for path := range m.secrets {
+		paths = append(paths, path)
+	}
+	m.mu.RUnlock()
+
+	var failed []string
+	var changed []string
+	for _, path := range paths {
+		fields, err := m.provider.Fetch(ctx, path)
+		if err != nil {
+			log.Warn().Err(err).Str("secret", path).Msg("Failed to refresh secret")
+			failed = append(failed, path)
+			continue
+		}
+		for _, secret := range fields {
+			Register(secret)
+		}
+
+		m.mu.Lock()
+		if !reflect.DeepEqual(m.secrets[path], fields) {
+			changed = append(changed, path)
+		}
+		m.secrets[path] = fields
+		m.mu.Unlock()
+	}
+
+	if len(changed) > 0 {
+		log.Info().Strs("secrets", changed).Msg("Secrets rotated")
+
+		m.mu.RLock()
+		listeners := append([]func(){}, m.listeners...)
+		m.mu.RUnlock()
+		for _, listener := range listeners {
+			listener()
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to refresh secrets %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// refreshLoop refreshes the secrets every interval
+func (m *Manager) refreshLoop(ctx context.Context) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		refreshCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		m.Refresh(refreshCtx)
+		cancel()
+	}
+}
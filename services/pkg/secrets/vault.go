@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultConfig holds the settings of a HashiCorp Vault KV version 2 store
+type VaultConfig struct {
+	Address   string // e.g. https://vault.internal:8200
+	Token     string
+	Mount     string // mount of the KV engine, secret when empty
+	Namespace string // Vault Enterprise namespace
+	Timeout   time.Duration
+}
+
+// VaultProvider fetches secrets from the KV version 2 engine of Vault
+type VaultProvider struct {
+	config VaultConfig
+	client *http.Client
+}
+
+// NewVaultProvider creates a provider reading secrets from Vault
+func NewVaultProvider(config VaultConfig) (*VaultProvider, error) {
+	if config.Address == "" || config.Token == "" {
+		return nil, fmt.Errorf("Vault address and token are required")
+	}
+	if config.Mount == "" {
+		config.Mount = "secret"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	Register(config.Token)
+
+	return &VaultProvider{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Name returns the name of the provider
+func (p *VaultProvider) Name() string {
+	return "vault"
+}
+
+// Fetch reads the latest version of a secret
+func (p *VaultProvider) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s",
+		strings.TrimRight(p.config.Address, "/"),
+		strings.Trim(p.config.Mount, "/"),
+		strings.Trim(path, "/"),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.config.Token)
+	if p.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.config.Namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("Vault returned status %d: %s", resp.StatusCode, string(message))
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+
+	return stringFields(body.Data.Data), nil
+}
+
+// stringFields turns the fields of a JSON secret into strings, fields that
+// aren't strings keep their JSON form
+func stringFields(raw map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if s, ok := value.(string); ok {
+			fields[key] = s
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		fields[key] = string(encoded)
+	}
+	return fields
+}
@@ -0,0 +1,88 @@
+// Package types holds the messages the services exchange through the message
+// queue, so producers and consumers agree on their shape.
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// TopicNotifications is the topic notifications are sent through
+const TopicNotifications = "notifications"
+
+// TopicNotificationEvents is the topic the notification service publishes
+// its events to, like delivery statuses and acknowledgments
+const TopicNotificationEvents = "notification-events"
+
+// Message represents a message in the queue
+type Message struct {
+	ID          string                 `json:"id"`
+	Topic       string                 `json:"topic"`
+	Payload     map[string]interface{} `json:"payload"`
+	Priority    int                    `json:"priority"` // 1-10, higher is more priority
+	RetryCount  int                    `json:"retry_count"`
+	MaxRetries  int                    `json:"max_retries"`
+	CreatedAt   time.Time              `json:"created_at"`
+	ScheduledAt *time.Time             `json:"scheduled_at,omitempty"`
+	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// MessageRequest represents a request to publish a message
+type MessageRequest struct {
+	Topic       string                 `json:"topic" binding:"required,topic"`
+	Payload     map[string]interface{} `json:"payload" binding:"required"`
+	Priority    int                    `json:"priority" binding:"omitempty,min=1,max=10"`
+	MaxRetries  int                    `json:"max_retries"`
+	ScheduledAt *time.Time             `json:"scheduled_at,omitempty"`
+	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// MessageResponse represents a response for message operations
+type MessageResponse struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NotificationMessage is the payload of a message of the notifications topic
+type NotificationMessage struct {
+	ID        string                 `json:"id,omitempty"`
+	Type      string                 `json:"type"`      // email, sms, push, inapp
+	Recipient string                 `json:"recipient"` // email address, phone number, user ID
+	Title     string                 `json:"title"`
+	Message   string                 `json:"message"`
+	Priority  string                 `json:"priority"` // low, normal, high, urgent
+	Category  string                 `json:"category"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Schedule  *time.Time             `json:"schedule,omitempty"`
+}
+
+// PriorityValue returns the queue priority of a notification priority
+func PriorityValue(priority string) int {
+	switch priority {
+	case "urgent":
+		return 9
+	case "high":
+		return 7
+	case "low":
+		return 3
+	default:
+		return 5
+	}
+}
+
+// Redis keys of the message queue, shared by its producers and consumers
+func StreamKey(topic string) string {
+	return fmt.Sprintf("mq:topic:%s", topic)
+}
+
+func GroupKey(topic string) string {
+	return fmt.Sprintf("mq:group:%s", topic)
+}
+
+func DeadLetterKey(topic string) string {
+	return fmt.Sprintf("mq:dlq:%s", topic)
+}
@@ -0,0 +1,267 @@
+// Package validation binds request bodies and reports what is wrong with
+// them field by field, with the rules the services share: phone numbers,
+// notification priorities and topic names besides the ones of the validator.
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// strictKey is the context key telling BindJSON to reject unknown fields
+const strictKey = "validation.strict"
+
+// Priorities are the priorities of notifications and events
+var Priorities = []string{"low", "normal", "high", "urgent"}
+
+var (
+	// phonePattern accepts international numbers, with or without the plus,
+	// and Turkish numbers written with the trunk prefix, spaces, dashes and
+	// parentheses aside
+	phonePattern = regexp.MustCompile(`^(\+?[1-9]\d{7,14}|0[1-9]\d{9})$`)
+	phoneNoise   = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+
+	// topicPattern is what topic names of the message queue may look like
+	topicPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}$`)
+)
+
+// FieldError describes an invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error is a request body that failed to bind. Fields lists the invalid
+// fields, it is empty when the body couldn't be read at all.
+type Error struct {
+	Fields []FieldError
+	err    error
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.err.Error()
+	}
+
+	problems := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		problems = append(problems, field.Field+" "+field.Message)
+	}
+	return strings.Join(problems, "; ")
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func init() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Errors name fields the way clients send them
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	validate.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return IsPhone(fl.Field().String())
+	})
+	validate.RegisterValidation("priority", func(fl validator.FieldLevel) bool {
+		priority := fl.Field().String()
+		for _, candidate := range Priorities {
+			if priority == candidate {
+				return true
+			}
+		}
+		return false
+	})
+	validate.RegisterValidation("topic", func(fl validator.FieldLevel) bool {
+		return topicPattern.MatchString(fl.Field().String())
+	})
+}
+
+// IsPhone reports whether value is a phone number SMS and voice calls can
+// be sent to
+func IsPhone(value string) bool {
+	return phonePattern.MatchString(phoneNoise.Replace(value))
+}
+
+// Strict makes BindJSON reject fields the request types don't know, for the
+// requests after it while enabled returns true
+func Strict(enabled func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(strictKey, enabled())
+		c.Next()
+	}
+}
+
+// BindJSON decodes the JSON body of a request into obj and validates it.
+// Failures are returned as *Error.
+func BindJSON(c *gin.Context, obj interface{}) error {
+	if c.Request.Body == nil {
+		return &Error{err: errors.New("request body is empty")}
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return &Error{err: fmt.Errorf("failed to read request body: %w", err)}
+	}
+	// Middleware after the handler may read the body again
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if binding.EnableDecoderUseNumber {
+		decoder.UseNumber()
+	}
+	if c.GetBool(strictKey) {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(obj); err != nil {
+		if err == io.EOF {
+			return &Error{err: errors.New("request body is empty")}
+		}
+		return &Error{Fields: decodeErrors(err), err: err}
+	}
+
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return &Error{Fields: Fields(err), err: err}
+	}
+	return nil
+}
+
+// Fields returns the invalid fields of a binding error, nil when it names
+// none
+func Fields(err error) []FieldError {
+	var bindErr *Error
+	if errors.As(err, &bindErr) {
+		return bindErr.Fields
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return decodeErrors(err)
+	}
+
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, FieldError{
+			Field:   fieldName(fieldErr),
+			Rule:    fieldErr.Tag(),
+			Message: message(fieldErr),
+		})
+	}
+	return fields
+}
+
+// decodeErrors returns the field a JSON decoding error is about
+func decodeErrors(err error) []FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: "must be " + jsonType(typeErr.Type),
+		}}
+	}
+
+	// The decoder reports unknown fields as json: unknown field "name"
+	if name := strings.TrimPrefix(err.Error(), "json: unknown field "); name != err.Error() {
+		return []FieldError{{
+			Field:   strings.Trim(name, `"`),
+			Rule:    "unknown",
+			Message: "is not a known field",
+		}}
+	}
+	return nil
+}
+
+// message explains a failed rule to the client
+func message(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be an email address"
+	case "phone":
+		return "must be a phone number like +905551112233"
+	case "priority":
+		return "must be one of " + strings.Join(Priorities, ", ")
+	case "topic":
+		return "must be lowercase letters, digits, dots, dashes or underscores"
+	case "url":
+		return "must be a URL"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "min", "gte":
+		if fieldErr.Kind() == reflect.String || fieldErr.Kind() == reflect.Slice || fieldErr.Kind() == reflect.Map {
+			return "must have at least " + param + " items or characters"
+		}
+		return "must be at least " + param
+	case "max", "lte":
+		if fieldErr.Kind() == reflect.String || fieldErr.Kind() == reflect.Slice || fieldErr.Kind() == reflect.Map {
+			return "must have at most " + param + " items or characters"
+		}
+		return "must be at most " + param
+	case "gt":
+		return "must be greater than " + param
+	case "lt":
+		return "must be less than " + param
+	}
+	return "failed on the '" + fieldErr.Tag() + "' rule"
+}
+
+// Helper functions
+func fieldName(fieldErr validator.FieldError) string {
+	// Namespace is "Struct.field.nested", clients know fields without the struct
+	namespace := fieldErr.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fieldErr.Field()
+}
+
+func jsonType(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "an RFC 3339 time"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct, reflect.Ptr:
+		return "an object"
+	}
+	return "a " + t.String()
+}